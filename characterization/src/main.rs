@@ -0,0 +1,231 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Accuracy characterization for the datasketches crate.
+//!
+//! Each run sweeps the stream length `n` over a geometric grid and prints one CSV row per
+//! grid point. A row summarizes the error observed across all trials at that `n`: the mean,
+//! the root mean square, and the quantiles of the error distribution at the normal-tail
+//! probabilities of -3, -2, -1, 0, +1, +2 and +3 standard deviations, plus the extremes.
+//! These columns line up with the plots published by the Java characterization suite.
+//!
+//! For HLL, CPC and Theta the error is the relative error of the estimate, `est / n - 1`.
+//! For KLL it is the largest absolute rank error over a fixed set of evenly spaced items.
+
+mod profile;
+
+use std::io;
+use std::io::BufWriter;
+use std::io::Write;
+
+use clap::Parser;
+use clap::ValueEnum;
+use datasketches::cpc::CpcSketch;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::kll::KllSketch;
+use datasketches::theta::ThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+
+use crate::profile::Permutation;
+use crate::profile::Profile;
+use crate::profile::checkpoints;
+
+#[derive(Clone, Copy, ValueEnum)]
+enum Family {
+    Hll,
+    Cpc,
+    Theta,
+    Kll,
+}
+
+#[derive(Clone, Copy, ValueEnum)]
+enum TargetType {
+    Hll4,
+    Hll6,
+    Hll8,
+}
+
+impl From<TargetType> for HllType {
+    fn from(value: TargetType) -> Self {
+        match value {
+            TargetType::Hll4 => HllType::Hll4,
+            TargetType::Hll6 => HllType::Hll6,
+            TargetType::Hll8 => HllType::Hll8,
+        }
+    }
+}
+
+/// The distinct-counting sketches under test.
+trait Cardinality {
+    fn update(&mut self, value: u64);
+    fn estimate(&self) -> f64;
+}
+
+impl Cardinality for HllSketch {
+    fn update(&mut self, value: u64) {
+        HllSketch::update(self, value);
+    }
+
+    fn estimate(&self) -> f64 {
+        HllSketch::estimate(self)
+    }
+}
+
+impl Cardinality for CpcSketch {
+    fn update(&mut self, value: u64) {
+        CpcSketch::update(self, value);
+    }
+
+    fn estimate(&self) -> f64 {
+        CpcSketch::estimate(self)
+    }
+}
+
+impl Cardinality for ThetaSketch {
+    fn update(&mut self, value: u64) {
+        ThetaSketch::update(self, value);
+    }
+
+    fn estimate(&self) -> f64 {
+        ThetaSketch::estimate(self)
+    }
+}
+
+#[derive(Parser)]
+#[clap(about = "Print error-vs-n profiles of a sketch family as CSV.")]
+struct Command {
+    #[arg(value_enum, help = "Sketch family to characterize.")]
+    family: Family,
+    #[arg(long, default_value_t = 12, help = "Log2 of K for HLL, CPC and Theta.")]
+    lg_k: u8,
+    #[arg(long, default_value_t = 200, help = "K for KLL.")]
+    k: u16,
+    #[arg(long, value_enum, default_value_t = TargetType::Hll8, help = "HLL target type.")]
+    hll_type: TargetType,
+    #[arg(
+        long,
+        default_value_t = 100,
+        help = "Number of independent trials per point."
+    )]
+    trials: usize,
+    #[arg(
+        long,
+        default_value_t = 100_000_000,
+        help = "Largest stream length to profile."
+    )]
+    max_n: u64,
+    #[arg(long, default_value_t = 16, help = "Grid points per doubling of n.")]
+    points_per_octave: u32,
+    #[arg(
+        long,
+        default_value_t = 33,
+        help = "Items queried per KLL rank-error measurement."
+    )]
+    rank_points: usize,
+}
+
+impl Command {
+    fn run(self) -> io::Result<()> {
+        assert!(self.trials > 0, "trials must be positive");
+        assert!(self.max_n > 0, "max-n must be positive");
+        assert!(
+            self.points_per_octave > 0,
+            "points-per-octave must be positive"
+        );
+        assert!(self.rank_points > 1, "rank-points must be at least 2");
+
+        let ns = checkpoints(self.max_n, self.points_per_octave);
+        let mut profile = Profile::new(ns.len(), self.trials);
+        match self.family {
+            Family::Hll => {
+                let hll_type = self.hll_type.into();
+                self.cardinality(&ns, &mut profile, || HllSketch::new(self.lg_k, hll_type))
+            }
+            Family::Cpc => self.cardinality(&ns, &mut profile, || CpcSketch::new(self.lg_k)),
+            Family::Theta => self.cardinality(&ns, &mut profile, || {
+                ThetaSketchBuilder::default().lg_k(self.lg_k).build()
+            }),
+            Family::Kll => self.rank_error(&ns, &mut profile),
+        }
+
+        let mut out = BufWriter::new(io::stdout().lock());
+        profile.write_csv(&mut out, &ns)?;
+        out.flush()
+    }
+
+    /// Feeds each trial one continuous stream of distinct values and records the relative error
+    /// of the estimate every time the stream length crosses a grid point.
+    fn cardinality<S: Cardinality>(
+        &self,
+        ns: &[u64],
+        profile: &mut Profile,
+        new_sketch: impl Fn() -> S,
+    ) {
+        // A single counter shared by every trial keeps the streams disjoint, so the trials see
+        // independent hash values.
+        let mut next_value = 0u64;
+        for trial in 0..self.trials {
+            let mut sketch = new_sketch();
+            let mut count = 0u64;
+            for (point, &n) in ns.iter().enumerate() {
+                while count < n {
+                    sketch.update(next_value);
+                    next_value += 1;
+                    count += 1;
+                }
+                let estimate = sketch.estimate();
+                profile.record(point, trial, estimate / n as f64 - 1.0);
+            }
+        }
+    }
+
+    /// Builds a fresh KLL sketch for every grid point from a shuffled stream of `0..n`, so the
+    /// true rank of every item is known exactly, and records the worst rank error over
+    /// `rank_points` evenly spaced items.
+    fn rank_error(&self, ns: &[u64], profile: &mut Profile) {
+        let mut split_points = Vec::with_capacity(self.rank_points);
+        for trial in 0..self.trials {
+            for (point, &n) in ns.iter().enumerate() {
+                let permutation =
+                    Permutation::new(n, trial as u64 * ns.len() as u64 + point as u64);
+                let mut sketch = KllSketch::<f64>::new(self.k);
+                for i in 0..n {
+                    sketch.update(permutation.apply(i) as f64);
+                }
+
+                split_points.clear();
+                let last = self.rank_points as u64 - 1;
+                split_points.extend((0..=last).map(|j| ((n - 1) * j / last) as f64));
+                split_points.dedup();
+                let ranks = sketch
+                    .cdf(&split_points, true)
+                    .expect("sketch is not empty");
+                let error = split_points
+                    .iter()
+                    .zip(&ranks)
+                    .map(|(&item, &rank)| (rank - (item + 1.0) / n as f64).abs())
+                    .fold(0.0, f64::max);
+                profile.record(point, trial, error);
+            }
+        }
+    }
+}
+
+fn main() -> io::Result<()> {
+    Command::parse().run()
+}
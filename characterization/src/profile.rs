@@ -0,0 +1,164 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::io;
+use std::io::Write;
+
+/// Normal-tail probabilities for -3, -2, -1, 0, +1, +2 and +3 standard deviations.
+const TAIL_PROBABILITIES: [f64; 7] = [0.00135, 0.02275, 0.15866, 0.5, 0.84134, 0.97725, 0.99865];
+
+/// Returns the distinct stream lengths `round(2^(i / points_per_octave))` up to `max_n`.
+pub fn checkpoints(max_n: u64, points_per_octave: u32) -> Vec<u64> {
+    let mut ns = Vec::new();
+    for i in 0.. {
+        let n = 2f64.powf(i as f64 / points_per_octave as f64).round() as u64;
+        if n > max_n {
+            break;
+        }
+        if ns.last() != Some(&n) {
+            ns.push(n);
+        }
+    }
+    ns
+}
+
+/// Errors observed at each grid point, one per trial.
+pub struct Profile {
+    trials: usize,
+    errors: Vec<f64>,
+}
+
+impl Profile {
+    pub fn new(num_points: usize, trials: usize) -> Self {
+        Self {
+            trials,
+            errors: vec![0.0; num_points * trials],
+        }
+    }
+
+    pub fn record(&mut self, point: usize, trial: usize, error: f64) {
+        self.errors[point * self.trials + trial] = error;
+    }
+
+    pub fn write_csv(&mut self, out: &mut impl Write, ns: &[u64]) -> io::Result<()> {
+        write!(out, "n,trials,mean,rmse,min")?;
+        for p in TAIL_PROBABILITIES {
+            write!(out, ",q{p}")?;
+        }
+        writeln!(out, ",max")?;
+
+        for (errors, n) in self.errors.chunks_mut(self.trials).zip(ns) {
+            errors.sort_by(f64::total_cmp);
+            let len = errors.len() as f64;
+            let mean = errors.iter().sum::<f64>() / len;
+            let rmse = (errors.iter().map(|e| e * e).sum::<f64>() / len).sqrt();
+            write!(out, "{n},{},{mean:e},{rmse:e},{:e}", self.trials, errors[0])?;
+            for p in TAIL_PROBABILITIES {
+                write!(out, ",{:e}", quantile(errors, p))?;
+            }
+            writeln!(out, ",{:e}", errors[errors.len() - 1])?;
+        }
+        Ok(())
+    }
+}
+
+/// Linearly interpolated quantile of sorted, non-empty `values`.
+fn quantile(values: &[f64], p: f64) -> f64 {
+    let pos = p * (values.len() - 1) as f64;
+    let lo = pos.floor() as usize;
+    let hi = pos.ceil() as usize;
+    values[lo] + (values[hi] - values[lo]) * (pos - lo as f64)
+}
+
+/// A pseudo-random permutation of `0..n` that needs no storage.
+///
+/// Mixes values over the smallest power-of-two domain covering `n` with a keyed bijection and
+/// cycle-walks until the result falls back inside `0..n`.
+pub struct Permutation {
+    n: u64,
+    mask: u64,
+    shift: u32,
+    key: u64,
+}
+
+impl Permutation {
+    pub fn new(n: u64, seed: u64) -> Self {
+        let bits = (64 - (n.max(2) - 1).leading_zeros()).max(2);
+        Self {
+            n,
+            mask: if bits == 64 {
+                u64::MAX
+            } else {
+                (1 << bits) - 1
+            },
+            shift: bits / 2,
+            key: splitmix64(seed),
+        }
+    }
+
+    pub fn apply(&self, value: u64) -> u64 {
+        let mut x = value;
+        loop {
+            x = self.mix(x);
+            if x < self.n {
+                return x;
+            }
+        }
+    }
+
+    fn mix(&self, mut x: u64) -> u64 {
+        for round in 0..3u64 {
+            x = x.wrapping_add(self.key.rotate_left(round as u32 * 21)) & self.mask;
+            x ^= x >> self.shift;
+            x = x.wrapping_mul(0x9E37_79B9_7F4A_7C15) & self.mask;
+        }
+        x
+    }
+}
+
+fn splitmix64(seed: u64) -> u64 {
+    let mut z = seed.wrapping_add(0x9E37_79B9_7F4A_7C15);
+    z = (z ^ (z >> 30)).wrapping_mul(0xBF58_476D_1CE4_E5B9);
+    z = (z ^ (z >> 27)).wrapping_mul(0x94D0_49BB_1331_11EB);
+    z ^ (z >> 31)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn permutation_is_a_bijection() {
+        for n in [1, 2, 3, 7, 100, 1000, 4096] {
+            let permutation = Permutation::new(n, n);
+            let mut seen = vec![false; n as usize];
+            for i in 0..n {
+                let x = permutation.apply(i) as usize;
+                assert!(!seen[x], "n={n} repeats {x}");
+                seen[x] = true;
+            }
+        }
+    }
+
+    #[test]
+    fn checkpoints_are_distinct_and_bounded() {
+        let ns = checkpoints(1000, 16);
+        assert_eq!(ns[0], 1);
+        assert!(ns.windows(2).all(|w| w[0] < w[1]));
+        assert!(*ns.last().unwrap() <= 1000);
+    }
+}
@@ -0,0 +1,98 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+/*
+ * C interface to the HLL, Theta and Bloom filter sketches of the datasketches Rust library.
+ *
+ * Sketches are opaque handles created by a *_new or *_deserialize function and released with
+ * the matching *_free function. Constructors return NULL on invalid arguments or input.
+ * Serialized images are owned by the library and must be released with ds_bytes_free.
+ */
+
+#ifndef DATASKETCHES_H
+#define DATASKETCHES_H
+
+#include <stdbool.h>
+#include <stddef.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* Seed used by the Java and C++ libraries unless configured otherwise. */
+#define DS_DEFAULT_SEED UINT64_C(9001)
+
+typedef enum ds_status {
+    DS_OK = 0,
+    DS_INVALID_ARGUMENT = 1,
+    DS_DESERIALIZE_ERROR = 2,
+    DS_INCOMPATIBLE = 3,
+} ds_status;
+
+typedef struct DsHllSketch ds_hll_sketch;
+typedef struct DsThetaSketch ds_theta_sketch;
+typedef struct DsThetaUnion ds_theta_union;
+typedef struct DsBloomFilter ds_bloom_filter;
+
+void ds_bytes_free(uint8_t *data, size_t len);
+
+/* HLL: lg_k in [4, 21], hll_type one of 4, 6 or 8. */
+ds_hll_sketch *ds_hll_new(uint8_t lg_k, uint8_t hll_type);
+void ds_hll_free(ds_hll_sketch *sketch);
+ds_status ds_hll_update(ds_hll_sketch *sketch, const uint8_t *data, size_t len);
+ds_status ds_hll_update_u64(ds_hll_sketch *sketch, uint64_t value);
+ds_status ds_hll_estimate(const ds_hll_sketch *sketch, double *out_estimate);
+/* Merging a sketch into itself is a no-op. */
+ds_status ds_hll_merge(ds_hll_sketch *sketch, const ds_hll_sketch *other);
+uint8_t *ds_hll_serialize(const ds_hll_sketch *sketch, size_t *out_len);
+ds_hll_sketch *ds_hll_deserialize(const uint8_t *data, size_t len);
+
+/* Theta: lg_k in [5, 26]. */
+ds_theta_sketch *ds_theta_new(uint8_t lg_k, uint64_t seed);
+void ds_theta_free(ds_theta_sketch *sketch);
+ds_status ds_theta_update(ds_theta_sketch *sketch, const uint8_t *data, size_t len);
+ds_status ds_theta_update_u64(ds_theta_sketch *sketch, uint64_t value);
+ds_status ds_theta_estimate(const ds_theta_sketch *sketch, double *out_estimate);
+uint8_t *ds_theta_serialize(const ds_theta_sketch *sketch, size_t *out_len);
+
+ds_theta_union *ds_theta_union_new(uint8_t lg_k, uint64_t seed);
+void ds_theta_union_free(ds_theta_union *union_);
+ds_status ds_theta_union_update(ds_theta_union *union_, const ds_theta_sketch *sketch);
+ds_status ds_theta_union_update_serialized(ds_theta_union *union_, const uint8_t *data, size_t len);
+ds_status ds_theta_union_estimate(const ds_theta_union *union_, double *out_estimate);
+uint8_t *ds_theta_union_serialize(const ds_theta_union *union_, size_t *out_len);
+
+/* Bloom filter: max_items > 0, fpp in (0, 1]. */
+ds_bloom_filter *ds_bloom_new(uint64_t max_items, double fpp, uint64_t seed);
+void ds_bloom_free(ds_bloom_filter *filter);
+ds_status ds_bloom_insert(ds_bloom_filter *filter, const uint8_t *data, size_t len);
+ds_status ds_bloom_insert_u64(ds_bloom_filter *filter, uint64_t value);
+bool ds_bloom_contains(const ds_bloom_filter *filter, const uint8_t *data, size_t len);
+bool ds_bloom_contains_u64(const ds_bloom_filter *filter, uint64_t value);
+/* Merging a filter into itself is a no-op. */
+ds_status ds_bloom_merge(ds_bloom_filter *filter, const ds_bloom_filter *other);
+uint8_t *ds_bloom_serialize(const ds_bloom_filter *filter, size_t *out_len);
+ds_bloom_filter *ds_bloom_deserialize(const uint8_t *data, size_t len);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* DATASKETCHES_H */
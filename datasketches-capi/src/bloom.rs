@@ -0,0 +1,192 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use datasketches::bloom::BloomFilter;
+use datasketches::bloom::BloomFilterBuilder;
+use datasketches::hash_value::raw_bytes;
+
+use crate::DsStatus;
+use crate::borrow_bytes;
+use crate::free_handle;
+use crate::into_raw_bytes;
+use crate::new_handle;
+
+/// Opaque handle to a Bloom filter.
+pub struct DsBloomFilter(BloomFilter);
+
+/// Creates a Bloom filter sized for `max_items` insertions at false positive rate `fpp`.
+///
+/// Returns null if `max_items` is 0 or `fpp` is not in `(0, 1]`.
+#[unsafe(no_mangle)]
+pub extern "C" fn ds_bloom_new(max_items: u64, fpp: f64, seed: u64) -> *mut DsBloomFilter {
+    new_handle(|| {
+        let filter = BloomFilterBuilder::with_accuracy(max_items, fpp)
+            .seed(seed)
+            .build();
+        Some(DsBloomFilter(filter))
+    })
+}
+
+/// Releases a filter. `filter` may be null.
+///
+/// # Safety
+///
+/// `filter` must be null or a live handle returned by this library.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_bloom_free(filter: *mut DsBloomFilter) {
+    // SAFETY: guaranteed by the caller.
+    unsafe { free_handle(filter) }
+}
+
+/// Inserts the key made of `len` bytes at `data`.
+///
+/// # Safety
+///
+/// `filter` must be a live handle and `data` must be valid for reads of `len` bytes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_bloom_insert(
+    filter: *mut DsBloomFilter,
+    data: *const u8,
+    len: usize,
+) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let Some(filter) = (unsafe { filter.as_mut() }) else {
+        return DsStatus::InvalidArgument;
+    };
+    // SAFETY: guaranteed by the caller.
+    let Some(data) = (unsafe { borrow_bytes(data, len) }) else {
+        return DsStatus::InvalidArgument;
+    };
+    filter.0.insert(raw_bytes::from_slice(data));
+    DsStatus::Ok
+}
+
+/// Inserts an integer key.
+///
+/// # Safety
+///
+/// `filter` must be a live handle.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_bloom_insert_u64(filter: *mut DsBloomFilter, value: u64) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let Some(filter) = (unsafe { filter.as_mut() }) else {
+        return DsStatus::InvalidArgument;
+    };
+    filter.0.insert(value);
+    DsStatus::Ok
+}
+
+/// Returns `true` if the key made of `len` bytes at `data` may have been inserted, and `false`
+/// if it definitely was not.
+///
+/// # Safety
+///
+/// `filter` must be a live handle and `data` must be valid for reads of `len` bytes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_bloom_contains(
+    filter: *const DsBloomFilter,
+    data: *const u8,
+    len: usize,
+) -> bool {
+    // SAFETY: guaranteed by the caller.
+    let Some(filter) = (unsafe { filter.as_ref() }) else {
+        return false;
+    };
+    // SAFETY: guaranteed by the caller.
+    let Some(data) = (unsafe { borrow_bytes(data, len) }) else {
+        return false;
+    };
+    filter.0.contains(&raw_bytes::from_slice(data))
+}
+
+/// Returns `true` if the integer key may have been inserted.
+///
+/// # Safety
+///
+/// `filter` must be a live handle.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_bloom_contains_u64(filter: *const DsBloomFilter, value: u64) -> bool {
+    // SAFETY: guaranteed by the caller.
+    unsafe { filter.as_ref() }.is_some_and(|filter| filter.0.contains(&value))
+}
+
+/// Merges `other` into `filter` with a bitwise OR.
+///
+/// Returns [`DsStatus::Incompatible`] unless both filters share their size, number of hashes and
+/// seed. Merging a filter into itself does nothing.
+///
+/// # Safety
+///
+/// Both arguments must be live handles.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_bloom_merge(
+    filter: *mut DsBloomFilter,
+    other: *const DsBloomFilter,
+) -> DsStatus {
+    // merging a handle into itself leaves it unchanged, and borrowing it twice would alias
+    if std::ptr::eq(filter, other) {
+        return if filter.is_null() {
+            DsStatus::InvalidArgument
+        } else {
+            DsStatus::Ok
+        };
+    }
+    // SAFETY: guaranteed by the caller.
+    let (Some(filter), Some(other)) = (unsafe { filter.as_mut() }, unsafe { other.as_ref() })
+    else {
+        return DsStatus::InvalidArgument;
+    };
+    if !filter.0.is_compatible(&other.0) {
+        return DsStatus::Incompatible;
+    }
+    filter.0.union(&other.0);
+    DsStatus::Ok
+}
+
+/// Serializes the filter.
+///
+/// Returns a buffer to release with [`ds_bytes_free`](crate::ds_bytes_free) and stores its
+/// length in `out_len`, or null if an argument is null.
+///
+/// # Safety
+///
+/// `filter` must be a live handle and `out_len` must be valid for writes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_bloom_serialize(
+    filter: *const DsBloomFilter,
+    out_len: *mut usize,
+) -> *mut u8 {
+    // SAFETY: guaranteed by the caller.
+    match unsafe { filter.as_ref() } {
+        Some(filter) => unsafe { into_raw_bytes(filter.0.serialize(), out_len) },
+        None => std::ptr::null_mut(),
+    }
+}
+
+/// Reads a filter from a serialized image, returning null if the bytes are not a valid image.
+///
+/// # Safety
+///
+/// `data` must be valid for reads of `len` bytes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_bloom_deserialize(data: *const u8, len: usize) -> *mut DsBloomFilter {
+    // SAFETY: guaranteed by the caller.
+    let Some(data) = (unsafe { borrow_bytes(data, len) }) else {
+        return std::ptr::null_mut();
+    };
+    new_handle(|| BloomFilter::deserialize(data).ok().map(DsBloomFilter))
+}
@@ -0,0 +1,181 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use datasketches::hash_value::raw_bytes;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+
+use crate::DsStatus;
+use crate::borrow_bytes;
+use crate::free_handle;
+use crate::into_raw_bytes;
+use crate::new_handle;
+
+/// Opaque handle to an HLL sketch.
+pub struct DsHllSketch(HllSketch);
+
+/// Creates an empty HLL sketch with `2^lg_k` buckets.
+///
+/// `hll_type` is 4, 6 or 8 for the HLL_4, HLL_6 and HLL_8 array types. Returns null if `lg_k`
+/// is not in `[4, 21]` or `hll_type` is not recognized.
+#[unsafe(no_mangle)]
+pub extern "C" fn ds_hll_new(lg_k: u8, hll_type: u8) -> *mut DsHllSketch {
+    new_handle(|| {
+        let hll_type = match hll_type {
+            4 => HllType::Hll4,
+            6 => HllType::Hll6,
+            8 => HllType::Hll8,
+            _ => return None,
+        };
+        Some(DsHllSketch(HllSketch::new(lg_k, hll_type)))
+    })
+}
+
+/// Releases a sketch. `sketch` may be null.
+///
+/// # Safety
+///
+/// `sketch` must be null or a live handle returned by this library.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_hll_free(sketch: *mut DsHllSketch) {
+    // SAFETY: guaranteed by the caller.
+    unsafe { free_handle(sketch) }
+}
+
+/// Adds the key made of `len` bytes at `data`.
+///
+/// # Safety
+///
+/// `sketch` must be a live handle and `data` must be valid for reads of `len` bytes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_hll_update(
+    sketch: *mut DsHllSketch,
+    data: *const u8,
+    len: usize,
+) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let Some(sketch) = (unsafe { sketch.as_mut() }) else {
+        return DsStatus::InvalidArgument;
+    };
+    // SAFETY: guaranteed by the caller.
+    let Some(data) = (unsafe { borrow_bytes(data, len) }) else {
+        return DsStatus::InvalidArgument;
+    };
+    sketch.0.update(raw_bytes::from_slice(data));
+    DsStatus::Ok
+}
+
+/// Adds an integer key.
+///
+/// # Safety
+///
+/// `sketch` must be a live handle.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_hll_update_u64(sketch: *mut DsHllSketch, value: u64) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let Some(sketch) = (unsafe { sketch.as_mut() }) else {
+        return DsStatus::InvalidArgument;
+    };
+    sketch.0.update(value);
+    DsStatus::Ok
+}
+
+/// Stores the estimated number of distinct keys in `out_estimate`.
+///
+/// # Safety
+///
+/// `sketch` must be a live handle and `out_estimate` must be valid for writes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_hll_estimate(
+    sketch: *const DsHllSketch,
+    out_estimate: *mut f64,
+) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let (Some(sketch), Some(out_estimate)) =
+        (unsafe { sketch.as_ref() }, unsafe { out_estimate.as_mut() })
+    else {
+        return DsStatus::InvalidArgument;
+    };
+    *out_estimate = sketch.0.estimate();
+    DsStatus::Ok
+}
+
+/// Merges `other` into `sketch`, keeping the configuration of `sketch`. Merging a sketch into
+/// itself does nothing.
+///
+/// # Safety
+///
+/// Both arguments must be live handles.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_hll_merge(
+    sketch: *mut DsHllSketch,
+    other: *const DsHllSketch,
+) -> DsStatus {
+    // merging a handle into itself leaves it unchanged, and borrowing it twice would alias
+    if std::ptr::eq(sketch, other) {
+        return if sketch.is_null() {
+            DsStatus::InvalidArgument
+        } else {
+            DsStatus::Ok
+        };
+    }
+    // SAFETY: guaranteed by the caller.
+    let (Some(sketch), Some(other)) = (unsafe { sketch.as_mut() }, unsafe { other.as_ref() })
+    else {
+        return DsStatus::InvalidArgument;
+    };
+    let mut union = HllUnion::new(sketch.0.lg_config_k());
+    union.update(&sketch.0);
+    union.update(&other.0);
+    sketch.0 = union.to_sketch(sketch.0.target_type());
+    DsStatus::Ok
+}
+
+/// Serializes the sketch into the compact image shared with Java and C++.
+///
+/// Returns a buffer to release with [`ds_bytes_free`](crate::ds_bytes_free) and stores its
+/// length in `out_len`, or null if an argument is null.
+///
+/// # Safety
+///
+/// `sketch` must be a live handle and `out_len` must be valid for writes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_hll_serialize(
+    sketch: *const DsHllSketch,
+    out_len: *mut usize,
+) -> *mut u8 {
+    // SAFETY: guaranteed by the caller.
+    match unsafe { sketch.as_ref() } {
+        Some(sketch) => unsafe { into_raw_bytes(sketch.0.serialize(), out_len) },
+        None => std::ptr::null_mut(),
+    }
+}
+
+/// Reads a sketch from a serialized image, returning null if the bytes are not a valid image.
+///
+/// # Safety
+///
+/// `data` must be valid for reads of `len` bytes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_hll_deserialize(data: *const u8, len: usize) -> *mut DsHllSketch {
+    // SAFETY: guaranteed by the caller.
+    let Some(data) = (unsafe { borrow_bytes(data, len) }) else {
+        return std::ptr::null_mut();
+    };
+    new_handle(|| HllSketch::deserialize(data).ok().map(DsHllSketch))
+}
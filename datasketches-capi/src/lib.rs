@@ -0,0 +1,128 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! C bindings for the HLL, Theta and Bloom filter sketches of the `datasketches` crate.
+//!
+//! The library is built as a `cdylib` and a `staticlib`; `include/datasketches.h` declares the
+//! exported functions. Every sketch is an opaque handle created by a `*_new` or `*_deserialize`
+//! function and released with the matching `*_free` function.
+//!
+//! # Conventions
+//!
+//! * Functions that create a handle return `NULL` when the arguments are invalid or the input
+//!   cannot be deserialized.
+//! * Functions that can fail return a [`DsStatus`].
+//! * Serialized images are returned as buffers owned by the library and must be released with
+//!   [`ds_bytes_free`].
+//! * Byte keys are hashed as their raw bytes, matching the `byte[]` update methods of the Java
+//!   library, and integer keys as their 8 little-endian bytes, matching the `long` overloads.
+//! * Constructors never unwind across the FFI boundary: a panic raised by an invalid argument is
+//!   caught and reported as `NULL`.
+
+// Exposing a C interface requires raw pointers and `extern "C"` entry points.
+#![allow(unsafe_code)]
+
+mod bloom;
+mod hll;
+mod theta;
+
+use std::panic::UnwindSafe;
+use std::panic::catch_unwind;
+
+pub use self::bloom::*;
+pub use self::hll::*;
+pub use self::theta::*;
+
+/// Outcome of a fallible call.
+#[repr(C)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum DsStatus {
+    /// The call succeeded.
+    Ok = 0,
+    /// An argument was null or out of range.
+    InvalidArgument = 1,
+    /// The input bytes are not a valid serialized image.
+    DeserializeError = 2,
+    /// The two sketches cannot be merged, e.g. because their seeds or sizes differ.
+    Incompatible = 3,
+}
+
+/// Releases a buffer returned by one of the `*_serialize` functions.
+///
+/// # Safety
+///
+/// `data` and `len` must come from the same serialize call, and the buffer must not be freed
+/// twice. `data` may be null.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_bytes_free(data: *mut u8, len: usize) {
+    if !data.is_null() {
+        // SAFETY: the buffer was produced by `into_raw_bytes` with the same length.
+        drop(unsafe { Box::from_raw(std::ptr::slice_from_raw_parts_mut(data, len)) });
+    }
+}
+
+/// Hands ownership of `bytes` to the caller, storing its length in `out_len`.
+///
+/// # Safety
+///
+/// `out_len` must be null or valid for writes.
+unsafe fn into_raw_bytes(bytes: Vec<u8>, out_len: *mut usize) -> *mut u8 {
+    if out_len.is_null() {
+        return std::ptr::null_mut();
+    }
+    let bytes = bytes.into_boxed_slice();
+    // SAFETY: checked for null above; the caller guarantees the pointer is valid.
+    unsafe { *out_len = bytes.len() };
+    Box::into_raw(bytes) as *mut u8
+}
+
+/// Borrows `len` bytes at `data`, treating a zero length as an empty slice.
+///
+/// # Safety
+///
+/// When `len` is non-zero, `data` must be valid for reads of `len` bytes.
+unsafe fn borrow_bytes<'a>(data: *const u8, len: usize) -> Option<&'a [u8]> {
+    if len == 0 {
+        Some(&[])
+    } else if data.is_null() {
+        None
+    } else {
+        // SAFETY: non-null and the caller guarantees `len` readable bytes.
+        Some(unsafe { std::slice::from_raw_parts(data, len) })
+    }
+}
+
+/// Moves the value built by `f` to the heap and returns an owning pointer, or null if `f`
+/// returned `None` or panicked.
+fn new_handle<T>(f: impl FnOnce() -> Option<T> + UnwindSafe) -> *mut T {
+    match catch_unwind(f) {
+        Ok(Some(value)) => Box::into_raw(Box::new(value)),
+        Ok(None) | Err(_) => std::ptr::null_mut(),
+    }
+}
+
+/// Drops a handle created by [`new_handle`].
+///
+/// # Safety
+///
+/// `handle` must be null or a pointer returned by [`new_handle`] that has not been freed.
+unsafe fn free_handle<T>(handle: *mut T) {
+    if !handle.is_null() {
+        // SAFETY: the caller guarantees the pointer came from `Box::into_raw`.
+        drop(unsafe { Box::from_raw(handle) });
+    }
+}
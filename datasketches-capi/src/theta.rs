@@ -0,0 +1,255 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use datasketches::hash_value::raw_bytes;
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::theta::ThetaUnion;
+use datasketches::theta::ThetaUnionBuilder;
+
+use crate::DsStatus;
+use crate::borrow_bytes;
+use crate::free_handle;
+use crate::into_raw_bytes;
+use crate::new_handle;
+
+/// Opaque handle to an updatable Theta sketch.
+pub struct DsThetaSketch(ThetaSketch);
+
+/// Opaque handle to a Theta union.
+pub struct DsThetaUnion {
+    union: ThetaUnion,
+    seed: u64,
+}
+
+/// Creates an empty Theta sketch with nominal size `2^lg_k`, hashing keys with `seed`.
+///
+/// Returns null if `lg_k` is not in `[5, 26]`.
+#[unsafe(no_mangle)]
+pub extern "C" fn ds_theta_new(lg_k: u8, seed: u64) -> *mut DsThetaSketch {
+    new_handle(|| {
+        let sketch = ThetaSketchBuilder::default().lg_k(lg_k).seed(seed).build();
+        Some(DsThetaSketch(sketch))
+    })
+}
+
+/// Releases a sketch. `sketch` may be null.
+///
+/// # Safety
+///
+/// `sketch` must be null or a live handle returned by this library.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_free(sketch: *mut DsThetaSketch) {
+    // SAFETY: guaranteed by the caller.
+    unsafe { free_handle(sketch) }
+}
+
+/// Adds the key made of `len` bytes at `data`.
+///
+/// # Safety
+///
+/// `sketch` must be a live handle and `data` must be valid for reads of `len` bytes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_update(
+    sketch: *mut DsThetaSketch,
+    data: *const u8,
+    len: usize,
+) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let Some(sketch) = (unsafe { sketch.as_mut() }) else {
+        return DsStatus::InvalidArgument;
+    };
+    // SAFETY: guaranteed by the caller.
+    let Some(data) = (unsafe { borrow_bytes(data, len) }) else {
+        return DsStatus::InvalidArgument;
+    };
+    sketch.0.update(raw_bytes::from_slice(data));
+    DsStatus::Ok
+}
+
+/// Adds an integer key.
+///
+/// # Safety
+///
+/// `sketch` must be a live handle.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_update_u64(sketch: *mut DsThetaSketch, value: u64) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let Some(sketch) = (unsafe { sketch.as_mut() }) else {
+        return DsStatus::InvalidArgument;
+    };
+    sketch.0.update(value);
+    DsStatus::Ok
+}
+
+/// Stores the estimated number of distinct keys in `out_estimate`.
+///
+/// # Safety
+///
+/// `sketch` must be a live handle and `out_estimate` must be valid for writes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_estimate(
+    sketch: *const DsThetaSketch,
+    out_estimate: *mut f64,
+) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let (Some(sketch), Some(out_estimate)) =
+        (unsafe { sketch.as_ref() }, unsafe { out_estimate.as_mut() })
+    else {
+        return DsStatus::InvalidArgument;
+    };
+    *out_estimate = sketch.0.estimate();
+    DsStatus::Ok
+}
+
+/// Serializes the sketch as an ordered compact image.
+///
+/// Returns a buffer to release with [`ds_bytes_free`](crate::ds_bytes_free) and stores its
+/// length in `out_len`, or null if an argument is null.
+///
+/// # Safety
+///
+/// `sketch` must be a live handle and `out_len` must be valid for writes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_serialize(
+    sketch: *const DsThetaSketch,
+    out_len: *mut usize,
+) -> *mut u8 {
+    // SAFETY: guaranteed by the caller.
+    match unsafe { sketch.as_ref() } {
+        Some(sketch) => unsafe { into_raw_bytes(sketch.0.compact(true).serialize(), out_len) },
+        None => std::ptr::null_mut(),
+    }
+}
+
+/// Creates an empty union with nominal size `2^lg_k` for sketches built with `seed`.
+///
+/// Returns null if `lg_k` is not in `[5, 26]`.
+#[unsafe(no_mangle)]
+pub extern "C" fn ds_theta_union_new(lg_k: u8, seed: u64) -> *mut DsThetaUnion {
+    new_handle(|| {
+        let union = ThetaUnionBuilder::default().lg_k(lg_k).seed(seed).build();
+        Some(DsThetaUnion { union, seed })
+    })
+}
+
+/// Releases a union. `union` may be null.
+///
+/// # Safety
+///
+/// `union` must be null or a live handle returned by this library.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_union_free(union: *mut DsThetaUnion) {
+    // SAFETY: guaranteed by the caller.
+    unsafe { free_handle(union) }
+}
+
+/// Merges a sketch into the union.
+///
+/// Returns [`DsStatus::Incompatible`] if the sketch was built with a different seed.
+///
+/// # Safety
+///
+/// Both arguments must be live handles.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_union_update(
+    union: *mut DsThetaUnion,
+    sketch: *const DsThetaSketch,
+) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let (Some(union), Some(sketch)) = (unsafe { union.as_mut() }, unsafe { sketch.as_ref() })
+    else {
+        return DsStatus::InvalidArgument;
+    };
+    match union.union.update(&sketch.0) {
+        Ok(()) => DsStatus::Ok,
+        Err(_) => DsStatus::Incompatible,
+    }
+}
+
+/// Merges a serialized compact sketch, as written by Java, C++ or [`ds_theta_serialize`], into
+/// the union.
+///
+/// Returns [`DsStatus::DeserializeError`] if the bytes are not a valid image for the union's
+/// seed.
+///
+/// # Safety
+///
+/// `union` must be a live handle and `data` must be valid for reads of `len` bytes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_union_update_serialized(
+    union: *mut DsThetaUnion,
+    data: *const u8,
+    len: usize,
+) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let Some(union) = (unsafe { union.as_mut() }) else {
+        return DsStatus::InvalidArgument;
+    };
+    // SAFETY: guaranteed by the caller.
+    let Some(data) = (unsafe { borrow_bytes(data, len) }) else {
+        return DsStatus::InvalidArgument;
+    };
+    let Ok(sketch) = CompactThetaSketch::deserialize_with_seed(data, union.seed) else {
+        return DsStatus::DeserializeError;
+    };
+    match union.union.update(&sketch) {
+        Ok(()) => DsStatus::Ok,
+        Err(_) => DsStatus::Incompatible,
+    }
+}
+
+/// Stores the estimated number of distinct keys in the union in `out_estimate`.
+///
+/// # Safety
+///
+/// `union` must be a live handle and `out_estimate` must be valid for writes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_union_estimate(
+    union: *const DsThetaUnion,
+    out_estimate: *mut f64,
+) -> DsStatus {
+    // SAFETY: guaranteed by the caller.
+    let (Some(union), Some(out_estimate)) =
+        (unsafe { union.as_ref() }, unsafe { out_estimate.as_mut() })
+    else {
+        return DsStatus::InvalidArgument;
+    };
+    *out_estimate = union.union.to_sketch(false).estimate();
+    DsStatus::Ok
+}
+
+/// Serializes the result of the union as an ordered compact image.
+///
+/// Returns a buffer to release with [`ds_bytes_free`](crate::ds_bytes_free) and stores its
+/// length in `out_len`, or null if an argument is null.
+///
+/// # Safety
+///
+/// `union` must be a live handle and `out_len` must be valid for writes.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn ds_theta_union_serialize(
+    union: *const DsThetaUnion,
+    out_len: *mut usize,
+) -> *mut u8 {
+    // SAFETY: guaranteed by the caller.
+    match unsafe { union.as_ref() } {
+        Some(union) => unsafe { into_raw_bytes(union.union.to_sketch(true).serialize(), out_len) },
+        None => std::ptr::null_mut(),
+    }
+}
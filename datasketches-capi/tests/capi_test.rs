@@ -0,0 +1,219 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Exercises the C entry points, which are unsafe to call.
+#![allow(unsafe_code)]
+
+use std::ptr;
+
+use datasketches::hash::DEFAULT_UPDATE_SEED;
+use datasketches::hll::HllSketch;
+use datasketches_capi::*;
+
+/// Returns the estimate `query` stores, checking that it succeeds.
+fn read_estimate(query: impl FnOnce(*mut f64) -> DsStatus) -> f64 {
+    let mut estimate = f64::NAN;
+    assert_eq!(query(&mut estimate), DsStatus::Ok);
+    estimate
+}
+
+fn take_bytes(data: *mut u8, len: usize) -> Vec<u8> {
+    assert!(!data.is_null());
+    let bytes = unsafe { std::slice::from_raw_parts(data, len) }.to_vec();
+    unsafe { ds_bytes_free(data, len) };
+    bytes
+}
+
+#[test]
+fn test_hll_roundtrip() {
+    let sketch = ds_hll_new(12, 4);
+    assert!(!sketch.is_null());
+    unsafe {
+        for i in 0..1000u64 {
+            assert_eq!(ds_hll_update_u64(sketch, i), DsStatus::Ok);
+        }
+        let key = b"apple";
+        assert_eq!(ds_hll_update(sketch, key.as_ptr(), key.len()), DsStatus::Ok);
+        let estimate = read_estimate(|out| ds_hll_estimate(sketch, out));
+        assert!((estimate - 1001.0).abs() < 1001.0 * 0.05, "{estimate}");
+
+        let mut len = 0;
+        let bytes = take_bytes(ds_hll_serialize(sketch, &mut len), len);
+        let rust = HllSketch::deserialize(&bytes).unwrap();
+        assert_eq!(rust.estimate(), estimate);
+
+        let copy = ds_hll_deserialize(bytes.as_ptr(), bytes.len());
+        assert!(!copy.is_null());
+        assert_eq!(read_estimate(|out| ds_hll_estimate(copy, out)), estimate);
+        ds_hll_free(copy);
+        ds_hll_free(sketch);
+    }
+}
+
+#[test]
+fn test_hll_merge() {
+    let a = ds_hll_new(12, 8);
+    let b = ds_hll_new(12, 6);
+    unsafe {
+        for i in 0..500u64 {
+            ds_hll_update_u64(a, i);
+            ds_hll_update_u64(b, i + 250);
+        }
+        assert_eq!(ds_hll_merge(a, b), DsStatus::Ok);
+        let estimate = read_estimate(|out| ds_hll_estimate(a, out));
+        assert!((estimate - 750.0).abs() < 750.0 * 0.05, "{estimate}");
+
+        assert_eq!(ds_hll_merge(a, a), DsStatus::Ok);
+        assert_eq!(read_estimate(|out| ds_hll_estimate(a, out)), estimate);
+        assert_eq!(
+            ds_hll_merge(ptr::null_mut(), ptr::null()),
+            DsStatus::InvalidArgument
+        );
+        ds_hll_free(a);
+        ds_hll_free(b);
+    }
+}
+
+#[test]
+fn test_invalid_arguments() {
+    assert!(ds_hll_new(3, 4).is_null());
+    assert!(ds_hll_new(12, 5).is_null());
+    assert!(ds_theta_new(4, DEFAULT_UPDATE_SEED).is_null());
+    assert!(ds_theta_union_new(27, DEFAULT_UPDATE_SEED).is_null());
+    assert!(ds_bloom_new(0, 0.01, 0).is_null());
+    assert!(ds_bloom_new(100, 1.5, 0).is_null());
+    unsafe {
+        assert!(ds_hll_deserialize(ptr::null(), 0).is_null());
+        assert!(ds_hll_deserialize(ptr::null(), 8).is_null());
+        let garbage = [1u8, 2, 3];
+        assert!(ds_bloom_deserialize(garbage.as_ptr(), garbage.len()).is_null());
+        assert_eq!(
+            ds_hll_update_u64(ptr::null_mut(), 1),
+            DsStatus::InvalidArgument
+        );
+        assert!(ds_hll_serialize(ptr::null(), ptr::null_mut()).is_null());
+        let mut estimate = 0.0;
+        assert_eq!(
+            ds_hll_estimate(ptr::null(), &mut estimate),
+            DsStatus::InvalidArgument
+        );
+        assert_eq!(
+            ds_theta_estimate(ptr::null(), &mut estimate),
+            DsStatus::InvalidArgument
+        );
+        assert_eq!(
+            ds_theta_union_estimate(ptr::null(), &mut estimate),
+            DsStatus::InvalidArgument
+        );
+        ds_hll_free(ptr::null_mut());
+        ds_theta_free(ptr::null_mut());
+        ds_bloom_free(ptr::null_mut());
+        ds_bytes_free(ptr::null_mut(), 0);
+    }
+}
+
+#[test]
+fn test_theta_union() {
+    let a = ds_theta_new(12, DEFAULT_UPDATE_SEED);
+    let b = ds_theta_new(12, DEFAULT_UPDATE_SEED);
+    let union = ds_theta_union_new(12, DEFAULT_UPDATE_SEED);
+    unsafe {
+        for i in 0..1000u64 {
+            ds_theta_update_u64(a, i);
+            ds_theta_update_u64(b, i + 500);
+        }
+        assert_eq!(read_estimate(|out| ds_theta_estimate(a, out)), 1000.0);
+
+        let mut len = 0;
+        let bytes = take_bytes(ds_theta_serialize(b, &mut len), len);
+        assert_eq!(ds_theta_union_update(union, a), DsStatus::Ok);
+        assert_eq!(
+            ds_theta_union_update_serialized(union, bytes.as_ptr(), bytes.len()),
+            DsStatus::Ok
+        );
+        let estimate = read_estimate(|out| ds_theta_union_estimate(union, out));
+        assert!((estimate - 1500.0).abs() < 1500.0 * 0.05, "{estimate}");
+
+        let bytes = take_bytes(ds_theta_union_serialize(union, &mut len), len);
+        let other = ds_theta_union_new(12, DEFAULT_UPDATE_SEED);
+        assert_eq!(
+            ds_theta_union_update_serialized(other, bytes.as_ptr(), bytes.len()),
+            DsStatus::Ok
+        );
+        assert_eq!(
+            read_estimate(|out| ds_theta_union_estimate(other, out)),
+            estimate
+        );
+
+        let mismatched = ds_theta_new(12, 42);
+        ds_theta_update_u64(mismatched, 1);
+        assert_eq!(
+            ds_theta_union_update(union, mismatched),
+            DsStatus::Incompatible
+        );
+        let bytes = take_bytes(ds_theta_serialize(mismatched, &mut len), len);
+        assert_eq!(
+            ds_theta_union_update_serialized(union, bytes.as_ptr(), bytes.len()),
+            DsStatus::DeserializeError
+        );
+
+        ds_theta_free(mismatched);
+        ds_theta_union_free(other);
+        ds_theta_union_free(union);
+        ds_theta_free(a);
+        ds_theta_free(b);
+    }
+}
+
+#[test]
+fn test_bloom_roundtrip_and_merge() {
+    let a = ds_bloom_new(1000, 0.01, 7);
+    let b = ds_bloom_new(1000, 0.01, 7);
+    unsafe {
+        let apple = b"apple";
+        let pear = b"pear";
+        assert_eq!(
+            ds_bloom_insert(a, apple.as_ptr(), apple.len()),
+            DsStatus::Ok
+        );
+        assert_eq!(ds_bloom_insert_u64(b, 42), DsStatus::Ok);
+        assert!(ds_bloom_contains(a, apple.as_ptr(), apple.len()));
+        assert!(!ds_bloom_contains(a, pear.as_ptr(), pear.len()));
+        assert!(!ds_bloom_contains_u64(a, 42));
+
+        assert_eq!(ds_bloom_merge(a, b), DsStatus::Ok);
+        assert!(ds_bloom_contains_u64(a, 42));
+        assert_eq!(ds_bloom_merge(a, a), DsStatus::Ok);
+        assert!(ds_bloom_contains_u64(a, 42));
+        assert!(!ds_bloom_contains(a, pear.as_ptr(), pear.len()));
+
+        let mut len = 0;
+        let bytes = take_bytes(ds_bloom_serialize(a, &mut len), len);
+        let copy = ds_bloom_deserialize(bytes.as_ptr(), bytes.len());
+        assert!(!copy.is_null());
+        assert!(ds_bloom_contains(copy, apple.as_ptr(), apple.len()));
+        assert!(ds_bloom_contains_u64(copy, 42));
+
+        let other_seed = ds_bloom_new(1000, 0.01, 8);
+        assert_eq!(ds_bloom_merge(a, other_seed), DsStatus::Incompatible);
+
+        ds_bloom_free(other_seed);
+        ds_bloom_free(copy);
+        ds_bloom_free(a);
+        ds_bloom_free(b);
+    }
+}
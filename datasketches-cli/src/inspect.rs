@@ -0,0 +1,330 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Preamble decoding for `ds inspect`.
+//!
+//! Every sketch image starts with a preamble whose first three bytes hold the preamble size,
+//! the serial version and the family ID. The remaining fields differ by family; they are
+//! decoded here for the families whose layout is known, without validating the image, so
+//! that damaged or foreign images can still be identified.
+
+use std::io::Write;
+
+use datasketches::cpc::CpcSketch;
+use datasketches::hll::HllSketch;
+use datasketches::theta::CompactThetaSketch;
+
+use crate::HLL_FAMILY_ID;
+use crate::KLL_FAMILY_ID;
+use crate::Result;
+use crate::THETA_FAMILY_ID;
+
+const QUICKSELECT_FAMILY_ID: u8 = 2;
+const QUANTILES_FAMILY_ID: u8 = 8;
+const TUPLE_FAMILY_ID: u8 = 9;
+const FREQUENCY_FAMILY_ID: u8 = 10;
+const CPC_FAMILY_ID: u8 = 16;
+const REQ_FAMILY_ID: u8 = 17;
+
+fn family_name(id: u8) -> Option<&'static str> {
+    let name = match id {
+        1 => "ALPHA",
+        QUICKSELECT_FAMILY_ID => "QUICKSELECT",
+        THETA_FAMILY_ID => "THETA",
+        4 => "UNION",
+        5 => "INTERSECTION",
+        6 => "A_NOT_B",
+        HLL_FAMILY_ID => "HLL",
+        QUANTILES_FAMILY_ID => "QUANTILES",
+        TUPLE_FAMILY_ID => "TUPLE",
+        FREQUENCY_FAMILY_ID => "FREQUENCY",
+        11 => "RESERVOIR",
+        12 => "RESERVOIR_UNION",
+        13 => "VAROPT",
+        14 => "VAROPT_UNION",
+        KLL_FAMILY_ID => "KLL",
+        CPC_FAMILY_ID => "CPC",
+        REQ_FAMILY_ID => "REQ",
+        18 => "COUNTMIN",
+        19 => "EBPPS or DENSITY",
+        20 => "TDIGEST",
+        21 => "BLOOMFILTER",
+        _ => return None,
+    };
+    Some(name)
+}
+
+/// Formats `flags` in hex followed by the names of its set bits.
+fn describe_flags(flags: u8, names: &[(u8, &str)]) -> String {
+    let set = names
+        .iter()
+        .filter(|(mask, _)| flags & mask != 0)
+        .map(|(_, name)| *name)
+        .collect::<Vec<_>>();
+    if set.is_empty() {
+        format!("{flags:#04x}")
+    } else {
+        format!("{flags:#04x} ({})", set.join(", "))
+    }
+}
+
+fn read_u16(image: &[u8], offset: usize) -> Option<u16> {
+    let bytes = image.get(offset..offset + 2)?;
+    Some(u16::from_le_bytes(bytes.try_into().unwrap()))
+}
+
+fn read_u64(image: &[u8], offset: usize) -> Option<u64> {
+    let bytes = image.get(offset..offset + 8)?;
+    Some(u64::from_le_bytes(bytes.try_into().unwrap()))
+}
+
+/// Writes what the preamble of `image` says about the sketch, one `key: value` per line.
+///
+/// The estimate of HLL, CPC and Theta images and the stream length of KLL and classic
+/// quantiles images are printed as well; an image the library cannot read reports why
+/// instead of an estimate.
+pub fn inspect(image: &[u8], out: &mut impl Write) -> Result<()> {
+    if image.len() < 8 {
+        return Err(format!(
+            "input is too short to be a sketch: {} bytes, a preamble is at least 8",
+            image.len()
+        )
+        .into());
+    }
+
+    let family_id = image[2];
+    match family_name(family_id) {
+        Some(name) => writeln!(out, "family: {name} ({family_id})")?,
+        None => writeln!(out, "family: unknown ({family_id})")?,
+    }
+    writeln!(out, "serial_version: {}", image[1])?;
+    // HLL, CPC, KLL and REQ count their preamble in 4-byte ints; the upper two bits of the
+    // byte are spare in the Theta and frequent items layouts.
+    match family_id {
+        HLL_FAMILY_ID | CPC_FAMILY_ID | KLL_FAMILY_ID | REQ_FAMILY_ID => {
+            writeln!(out, "preamble_ints: {}", image[0])?
+        }
+        _ => writeln!(out, "preamble_longs: {}", image[0] & 0x3F)?,
+    }
+
+    match family_id {
+        HLL_FAMILY_ID => {
+            let mode = match image[7] & 0x3 {
+                0 => "LIST",
+                1 => "SET",
+                2 => "HLL",
+                _ => "unknown",
+            };
+            let target_type = match (image[7] >> 2) & 0x3 {
+                0 => "HLL4",
+                1 => "HLL6",
+                2 => "HLL8",
+                _ => "unknown",
+            };
+            writeln!(out, "lg_k: {}", image[3])?;
+            writeln!(out, "mode: {mode}")?;
+            writeln!(out, "type: {target_type}")?;
+            let flags = [(4, "empty"), (8, "compact"), (16, "out of order")];
+            writeln!(out, "flags: {}", describe_flags(image[5], &flags))?;
+            match HllSketch::deserialize(image) {
+                Ok(sketch) => writeln!(out, "estimate: {}", sketch.estimate())?,
+                Err(err) => writeln!(out, "estimate: unavailable ({err})")?,
+            }
+        }
+        QUICKSELECT_FAMILY_ID | THETA_FAMILY_ID => {
+            if family_id == QUICKSELECT_FAMILY_ID {
+                writeln!(out, "lg_k: {}", image[3])?;
+            } else if image[1] == 4 {
+                writeln!(out, "entry_bits: {}", image[3])?;
+            }
+            let flags = [
+                (2, "read only"),
+                (4, "empty"),
+                (8, "compact"),
+                (16, "ordered"),
+            ];
+            writeln!(out, "flags: {}", describe_flags(image[5], &flags))?;
+            if image[1] >= 3 {
+                writeln!(out, "seed_hash: {:#06x}", read_u16(image, 6).unwrap())?;
+            }
+            if family_id == THETA_FAMILY_ID {
+                match CompactThetaSketch::deserialize(image) {
+                    Ok(sketch) => writeln!(out, "estimate: {}", sketch.estimate())?,
+                    Err(err) => writeln!(out, "estimate: unavailable ({err})")?,
+                }
+            }
+        }
+        CPC_FAMILY_ID => {
+            writeln!(out, "lg_k: {}", image[3])?;
+            let flags = [
+                (1 << 1, "compressed"),
+                (1 << 2, "has hip"),
+                (1 << 3, "has table"),
+                (1 << 4, "has window"),
+            ];
+            writeln!(out, "flags: {}", describe_flags(image[5], &flags))?;
+            writeln!(out, "seed_hash: {:#06x}", read_u16(image, 6).unwrap())?;
+            match CpcSketch::deserialize(image) {
+                Ok(sketch) => writeln!(out, "estimate: {}", sketch.estimate())?,
+                Err(err) => writeln!(out, "estimate: unavailable ({err})")?,
+            }
+        }
+        KLL_FAMILY_ID => {
+            writeln!(out, "k: {}", read_u16(image, 4).unwrap())?;
+            writeln!(out, "m: {}", image[6])?;
+            let flags = [(1, "empty"), (2, "level zero sorted"), (4, "single item")];
+            writeln!(out, "flags: {}", describe_flags(image[3], &flags))?;
+            let n = if image[3] & 1 != 0 {
+                Some(0)
+            } else if image[3] & 4 != 0 {
+                Some(1)
+            } else {
+                read_u64(image, 8)
+            };
+            if let Some(n) = n {
+                writeln!(out, "n: {n}")?;
+            }
+        }
+        QUANTILES_FAMILY_ID => {
+            writeln!(out, "k: {}", read_u16(image, 4).unwrap())?;
+            let flags = [
+                (1, "big endian"),
+                (2, "read only"),
+                (4, "empty"),
+                (8, "compact"),
+                (16, "sorted"),
+            ];
+            writeln!(out, "flags: {}", describe_flags(image[3], &flags))?;
+            let n = if image[3] & 4 != 0 {
+                Some(0)
+            } else {
+                read_u64(image, 8)
+            };
+            if let Some(n) = n {
+                writeln!(out, "n: {n}")?;
+            }
+        }
+        REQ_FAMILY_ID => {
+            writeln!(out, "k: {}", read_u16(image, 4).unwrap())?;
+            writeln!(out, "num_levels: {}", image[6])?;
+            let flags = [
+                (4, "empty"),
+                (8, "high rank accuracy"),
+                (16, "raw items"),
+                (32, "level zero sorted"),
+            ];
+            writeln!(out, "flags: {}", describe_flags(image[3], &flags))?;
+        }
+        FREQUENCY_FAMILY_ID => {
+            writeln!(out, "lg_max_map_size: {}", image[3])?;
+            writeln!(out, "lg_cur_map_size: {}", image[4])?;
+            writeln!(out, "flags: {}", describe_flags(image[5], &[(5, "empty")]))?;
+        }
+        TUPLE_FAMILY_ID => {
+            writeln!(out, "sketch_type: {}", image[3])?;
+            let flags = [
+                (2, "read only"),
+                (4, "empty"),
+                (8, "compact"),
+                (16, "ordered"),
+            ];
+            writeln!(out, "flags: {}", describe_flags(image[5], &flags))?;
+            writeln!(out, "seed_hash: {:#06x}", read_u16(image, 6).unwrap())?;
+        }
+        _ => {}
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use datasketches::hll::HllType;
+    use datasketches::kll::KllSketch;
+    use datasketches::theta::ThetaSketchBuilder;
+
+    use super::*;
+
+    fn inspect_to_string(image: &[u8]) -> String {
+        let mut out = vec![];
+        inspect(image, &mut out).unwrap();
+        String::from_utf8(out).unwrap()
+    }
+
+    #[test]
+    fn test_inspect_hll() {
+        let mut sketch = HllSketch::new(11, HllType::Hll6);
+        sketch.update("a");
+        let shown = inspect_to_string(&sketch.serialize());
+        assert!(
+            shown.starts_with("family: HLL (7)\nserial_version: 1\n"),
+            "{shown}"
+        );
+        assert!(
+            shown.contains("lg_k: 11\nmode: LIST\ntype: HLL6\n"),
+            "{shown}"
+        );
+        assert!(shown.contains("estimate: 1"), "{shown}");
+
+        let shown = inspect_to_string(&HllSketch::new(11, HllType::Hll6).serialize());
+        assert!(shown.contains("flags: 0x0c (empty, compact)\n"), "{shown}");
+    }
+
+    #[test]
+    fn test_inspect_theta() {
+        let mut sketch = ThetaSketchBuilder::default().build();
+        sketch.update(1);
+        sketch.update(2);
+        let shown = inspect_to_string(&sketch.compact(true).serialize());
+        assert!(shown.starts_with("family: THETA (3)\n"), "{shown}");
+        assert!(shown.contains("compact, ordered"), "{shown}");
+        assert!(shown.contains("estimate: 2\n"), "{shown}");
+    }
+
+    #[test]
+    fn test_inspect_kll() {
+        let mut sketch = KllSketch::<f64>::new(200);
+        sketch.update(1.0);
+        let shown = inspect_to_string(&sketch.serialize());
+        assert!(shown.contains("k: 200\n"), "{shown}");
+        assert!(shown.contains("(single item)\nn: 1\n"), "{shown}");
+
+        for i in 0..10 {
+            sketch.update(i as f64);
+        }
+        let shown = inspect_to_string(&sketch.serialize());
+        assert!(shown.ends_with("n: 11\n"), "{shown}");
+    }
+
+    #[test]
+    fn test_inspect_damaged_image() {
+        let mut sketch = HllSketch::new(12, HllType::Hll8);
+        sketch.update("a");
+        let mut image = sketch.serialize();
+        image[1] = 9;
+        let shown = inspect_to_string(&image);
+        assert!(shown.contains("serial_version: 9\n"), "{shown}");
+        assert!(shown.contains("estimate: unavailable ("), "{shown}");
+
+        let shown = inspect_to_string(&[1, 1, 99, 0, 0, 0, 0, 0]);
+        assert_eq!(
+            shown,
+            "family: unknown (99)\nserial_version: 1\npreamble_longs: 1\n"
+        );
+
+        assert!(inspect(&[1, 2, 3], &mut vec![]).is_err());
+    }
+}
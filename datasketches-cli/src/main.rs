@@ -0,0 +1,413 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! `ds`, a command-line tool for ad-hoc work with serialized sketches.
+//!
+//! `ds build` reads one item per line from stdin and writes the serialized HLL, Theta or KLL
+//! sketch of them. `ds merge` combines sketch files of one family and `ds show` prints the
+//! estimate or quantiles held in a sketch file. The family of an existing file is read from
+//! its preamble, so files written by the Java and C++ libraries work as well; KLL files are
+//! read as `double` sketches. `ds inspect` decodes the preamble of any sketch image to
+//! identify it, including families the other commands do not handle.
+
+use std::error::Error;
+use std::fs;
+use std::io;
+use std::io::BufRead;
+use std::io::Read;
+use std::io::Write;
+use std::path::PathBuf;
+use std::process::ExitCode;
+
+use clap::Parser;
+use clap::Subcommand;
+use clap::ValueEnum;
+use datasketches::common::NumStdDev;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+use datasketches::kll::KllSketch;
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::theta::ThetaUnionBuilder;
+
+mod inspect;
+
+type Result<T> = std::result::Result<T, Box<dyn Error>>;
+
+/// Family IDs stored in the third byte of every preamble.
+const THETA_FAMILY_ID: u8 = 3;
+const HLL_FAMILY_ID: u8 = 7;
+const KLL_FAMILY_ID: u8 = 15;
+
+/// The largest lg_k of an HLL sketch, used for unions so they adopt the inputs' precision.
+const HLL_MAX_LG_K: u8 = 21;
+
+#[derive(Clone, Copy, Debug, PartialEq, Eq, ValueEnum)]
+enum Family {
+    Hll,
+    Theta,
+    Kll,
+}
+
+impl Family {
+    fn detect(image: &[u8]) -> Result<Family> {
+        match image.get(2) {
+            Some(&HLL_FAMILY_ID) => Ok(Family::Hll),
+            Some(&THETA_FAMILY_ID) => Ok(Family::Theta),
+            Some(&KLL_FAMILY_ID) => Ok(Family::Kll),
+            Some(id) => Err(format!("unsupported sketch family ID {id}").into()),
+            None => Err("input is too short to be a sketch".into()),
+        }
+    }
+}
+
+#[derive(Clone, Copy, ValueEnum)]
+enum TargetType {
+    Hll4,
+    Hll6,
+    Hll8,
+}
+
+impl From<TargetType> for HllType {
+    fn from(value: TargetType) -> Self {
+        match value {
+            TargetType::Hll4 => HllType::Hll4,
+            TargetType::Hll6 => HllType::Hll6,
+            TargetType::Hll8 => HllType::Hll8,
+        }
+    }
+}
+
+#[derive(Parser)]
+#[clap(name = "ds", about = "Build, merge and inspect serialized sketches.")]
+struct Cli {
+    #[command(subcommand)]
+    command: Command,
+}
+
+#[derive(Subcommand)]
+enum Command {
+    /// Build a sketch from stdin, one item per line.
+    ///
+    /// HLL and Theta sketches count distinct lines; KLL sketches parse every line as a number.
+    /// Empty lines are skipped.
+    Build {
+        #[arg(value_enum, help = "Sketch family to build.")]
+        family: Family,
+        #[arg(long, default_value_t = 12, help = "Log2 of K for HLL and Theta.")]
+        lg_k: u8,
+        #[arg(long, default_value_t = 200, help = "K for KLL.")]
+        k: u16,
+        #[arg(long, value_enum, default_value_t = TargetType::Hll8, help = "HLL target type.")]
+        hll_type: TargetType,
+        #[arg(short, long, help = "Output file; defaults to stdout.")]
+        output: Option<PathBuf>,
+    },
+    /// Merge sketch files of the same family into one sketch.
+    Merge {
+        #[arg(required = true, help = "Sketch files to merge.")]
+        inputs: Vec<PathBuf>,
+        #[arg(
+            long,
+            value_enum,
+            help = "HLL target type of the result; defaults to the type of the first input."
+        )]
+        hll_type: Option<TargetType>,
+        #[arg(short, long, help = "Output file; defaults to stdout.")]
+        output: Option<PathBuf>,
+    },
+    /// Print the estimate of an HLL or Theta sketch, or the quantiles of a KLL sketch.
+    Show {
+        #[arg(help = "Sketch file; defaults to stdin.")]
+        input: Option<PathBuf>,
+        #[arg(
+            long,
+            value_delimiter = ',',
+            default_values_t = [0.0, 0.25, 0.5, 0.75, 0.9, 0.99, 1.0],
+            help = "Normalized ranks of the KLL quantiles to print."
+        )]
+        ranks: Vec<f64>,
+    },
+    /// Describe the preamble of a serialized sketch of any family.
+    ///
+    /// The image is not validated, so damaged images and families this tool cannot merge or
+    /// show are still identified.
+    Inspect {
+        #[arg(help = "Sketch file; defaults to stdin.")]
+        input: Option<PathBuf>,
+    },
+}
+
+impl Command {
+    fn run(self) -> Result<()> {
+        match self {
+            Command::Build {
+                family,
+                lg_k,
+                k,
+                hll_type,
+                output,
+            } => {
+                let stdin = io::stdin().lock();
+                let image = match family {
+                    Family::Hll => build_hll(stdin, lg_k, hll_type.into())?,
+                    Family::Theta => build_theta(stdin, lg_k)?,
+                    Family::Kll => build_kll(stdin, k)?,
+                };
+                write_output(output, &image)
+            }
+            Command::Merge {
+                inputs,
+                hll_type,
+                output,
+            } => {
+                let images = inputs
+                    .iter()
+                    .map(|path| {
+                        fs::read(path).map_err(|e| format!("cannot read {}: {e}", path.display()))
+                    })
+                    .collect::<std::result::Result<Vec<_>, _>>()?;
+                let image = merge(&images, hll_type.map(HllType::from))?;
+                write_output(output, &image)
+            }
+            Command::Show { input, ranks } => {
+                let image = read_input(input)?;
+                show(&image, &ranks, &mut io::stdout().lock())
+            }
+            Command::Inspect { input } => {
+                let image = read_input(input)?;
+                inspect::inspect(&image, &mut io::stdout().lock())
+            }
+        }
+    }
+}
+
+/// Calls `f` with every non-empty line of `input`.
+fn for_each_line(input: impl BufRead, mut f: impl FnMut(&str) -> Result<()>) -> Result<()> {
+    for line in input.lines() {
+        let line = line?;
+        let line = line.strip_suffix('\r').unwrap_or(&line);
+        if !line.is_empty() {
+            f(line)?;
+        }
+    }
+    Ok(())
+}
+
+fn build_hll(input: impl BufRead, lg_k: u8, hll_type: HllType) -> Result<Vec<u8>> {
+    let mut sketch = HllSketch::new(lg_k, hll_type);
+    for_each_line(input, |line| {
+        sketch.update(line);
+        Ok(())
+    })?;
+    Ok(sketch.serialize())
+}
+
+fn build_theta(input: impl BufRead, lg_k: u8) -> Result<Vec<u8>> {
+    let mut sketch = ThetaSketchBuilder::default().lg_k(lg_k).build();
+    for_each_line(input, |line| {
+        sketch.update(line);
+        Ok(())
+    })?;
+    Ok(sketch.compact(true).serialize())
+}
+
+fn build_kll(input: impl BufRead, k: u16) -> Result<Vec<u8>> {
+    let mut sketch = KllSketch::<f64>::new(k);
+    for_each_line(input, |line| {
+        let value = line
+            .trim()
+            .parse::<f64>()
+            .map_err(|e| format!("invalid number {line:?}: {e}"))?;
+        sketch.update(value);
+        Ok(())
+    })?;
+    Ok(sketch.serialize())
+}
+
+fn merge(images: &[Vec<u8>], hll_type: Option<HllType>) -> Result<Vec<u8>> {
+    let family = Family::detect(&images[0])?;
+    for image in &images[1..] {
+        let other = Family::detect(image)?;
+        if other != family {
+            return Err(format!("cannot merge {other:?} sketches into {family:?} sketches").into());
+        }
+    }
+
+    match family {
+        Family::Hll => {
+            let mut union = HllUnion::new(HLL_MAX_LG_K);
+            let mut target_type = hll_type;
+            for image in images {
+                let sketch = HllSketch::deserialize(image)?;
+                target_type.get_or_insert(sketch.target_type());
+                union.update(&sketch);
+            }
+            let target_type = target_type.expect("merge has at least one input");
+            Ok(union.to_sketch(target_type).serialize())
+        }
+        Family::Theta => {
+            let mut union = ThetaUnionBuilder::default().build();
+            for image in images {
+                union.update(&CompactThetaSketch::deserialize(image)?)?;
+            }
+            Ok(union.to_sketch(true).serialize())
+        }
+        Family::Kll => {
+            let mut merged = KllSketch::<f64>::deserialize(&images[0])?;
+            for image in &images[1..] {
+                merged.merge(&KllSketch::<f64>::deserialize(image)?);
+            }
+            Ok(merged.serialize())
+        }
+    }
+}
+
+fn show(image: &[u8], ranks: &[f64], out: &mut impl Write) -> Result<()> {
+    match Family::detect(image)? {
+        Family::Hll => {
+            let sketch = HllSketch::deserialize(image)?;
+            writeln!(out, "family: HLL")?;
+            writeln!(out, "lg_k: {}", sketch.lg_config_k())?;
+            writeln!(out, "type: {:?}", sketch.target_type())?;
+            writeln!(out, "estimate: {}", sketch.estimate())?;
+            writeln!(out, "lower_bound: {}", sketch.lower_bound(NumStdDev::Two))?;
+            writeln!(out, "upper_bound: {}", sketch.upper_bound(NumStdDev::Two))?;
+        }
+        Family::Theta => {
+            let sketch = CompactThetaSketch::deserialize(image)?;
+            writeln!(out, "family: Theta")?;
+            writeln!(out, "retained: {}", sketch.num_retained())?;
+            writeln!(out, "theta: {}", sketch.theta())?;
+            writeln!(out, "estimate: {}", sketch.estimate())?;
+            writeln!(out, "lower_bound: {}", sketch.lower_bound(NumStdDev::Two))?;
+            writeln!(out, "upper_bound: {}", sketch.upper_bound(NumStdDev::Two))?;
+        }
+        Family::Kll => {
+            let sketch = KllSketch::<f64>::deserialize(image)?;
+            writeln!(out, "family: KLL")?;
+            writeln!(out, "k: {}", sketch.k())?;
+            writeln!(out, "n: {}", sketch.n())?;
+            writeln!(out, "retained: {}", sketch.num_retained())?;
+            for &rank in ranks {
+                if !(0.0..=1.0).contains(&rank) {
+                    return Err(format!("rank must be in [0, 1], got {rank}").into());
+                }
+                match sketch.quantile(rank, true) {
+                    Some(quantile) => writeln!(out, "quantile({rank}): {quantile}")?,
+                    None => writeln!(out, "quantile({rank}): none")?,
+                }
+            }
+        }
+    }
+    Ok(())
+}
+
+fn read_input(input: Option<PathBuf>) -> Result<Vec<u8>> {
+    match input {
+        Some(path) => {
+            fs::read(&path).map_err(|e| format!("cannot read {}: {e}", path.display()).into())
+        }
+        None => {
+            let mut image = vec![];
+            io::stdin().lock().read_to_end(&mut image)?;
+            Ok(image)
+        }
+    }
+}
+
+fn write_output(output: Option<PathBuf>, image: &[u8]) -> Result<()> {
+    match output {
+        Some(path) => {
+            fs::write(&path, image).map_err(|e| format!("cannot write {}: {e}", path.display()))?
+        }
+        None => io::stdout().lock().write_all(image)?,
+    }
+    Ok(())
+}
+
+fn main() -> ExitCode {
+    match Cli::parse().command.run() {
+        Ok(()) => ExitCode::SUCCESS,
+        Err(err) => {
+            eprintln!("ds: {err}");
+            ExitCode::FAILURE
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn show_to_string(image: &[u8], ranks: &[f64]) -> String {
+        let mut out = vec![];
+        show(image, ranks, &mut out).unwrap();
+        String::from_utf8(out).unwrap()
+    }
+
+    #[test]
+    fn test_build_and_show_hll() {
+        let input = "a\nb\r\n\nc\na\n";
+        let image = build_hll(input.as_bytes(), 10, HllType::Hll4).unwrap();
+        assert_eq!(Family::detect(&image).unwrap(), Family::Hll);
+        let shown = show_to_string(&image, &[]);
+        assert!(shown.contains("lg_k: 10\n"), "{shown}");
+        assert!(shown.contains("type: Hll4\n"), "{shown}");
+        let sketch = HllSketch::deserialize(&image).unwrap();
+        assert!((sketch.estimate() - 3.0).abs() < 0.01);
+    }
+
+    #[test]
+    fn test_merge_theta() {
+        let left = build_theta("a\nb\nc\n".as_bytes(), 12).unwrap();
+        let right = build_theta("c\nd\n".as_bytes(), 12).unwrap();
+        let merged = merge(&[left, right], None).unwrap();
+        let shown = show_to_string(&merged, &[]);
+        assert!(shown.contains("estimate: 4\n"), "{shown}");
+    }
+
+    #[test]
+    fn test_merge_and_show_kll() {
+        let left = build_kll("1\n2\n3\n".as_bytes(), 200).unwrap();
+        let right = build_kll(" 4 \n5\n".as_bytes(), 200).unwrap();
+        let merged = merge(&[left, right], None).unwrap();
+        let shown = show_to_string(&merged, &[0.0, 0.5, 1.0]);
+        assert!(shown.contains("n: 5\n"), "{shown}");
+        assert!(shown.contains("quantile(0): 1\n"), "{shown}");
+        assert!(shown.contains("quantile(0.5): 3\n"), "{shown}");
+        assert!(shown.contains("quantile(1): 5\n"), "{shown}");
+    }
+
+    #[test]
+    fn test_errors() {
+        let err = build_kll("1\nx\n".as_bytes(), 200).unwrap_err();
+        assert!(err.to_string().contains("invalid number \"x\""));
+
+        let hll = build_hll("a\n".as_bytes(), 12, HllType::Hll8).unwrap();
+        let kll = build_kll("1\n".as_bytes(), 200).unwrap();
+        let err = merge(&[hll, kll], None).unwrap_err();
+        assert_eq!(
+            err.to_string(),
+            "cannot merge Kll sketches into Hll sketches"
+        );
+
+        let err = show(&[1, 2], &[], &mut vec![]).unwrap_err();
+        assert_eq!(err.to_string(), "input is too short to be a sketch");
+    }
+}
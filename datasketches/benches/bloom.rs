@@ -0,0 +1,133 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Insert, query, union and serialization benchmarks for `BloomFilter`.
+
+use std::hint::black_box;
+
+use criterion::BenchmarkId;
+use criterion::Criterion;
+use criterion::Throughput;
+use criterion::criterion_group;
+use criterion::criterion_main;
+use datasketches::bloom::BloomFilter;
+use datasketches::bloom::BloomFilterBuilder;
+
+/// Expected number of items of the benchmarked filters
+const CAPACITIES: [u64; 3] = [10_000, 1_000_000, 10_000_000];
+const FALSE_POSITIVE_RATE: f64 = 0.01;
+const NUM_UPDATES: u64 = 100_000;
+
+fn build(capacity: u64, offset: u64, n: u64) -> BloomFilter {
+    let mut filter = BloomFilterBuilder::with_accuracy(capacity, FALSE_POSITIVE_RATE).build();
+    for i in offset..offset + n {
+        filter.insert(i);
+    }
+    filter
+}
+
+fn bench_insert(c: &mut Criterion) {
+    let mut group = c.benchmark_group("bloom/insert");
+    group.throughput(Throughput::Elements(NUM_UPDATES));
+    for capacity in CAPACITIES {
+        group.bench_function(BenchmarkId::new("insert", capacity), |b| {
+            b.iter(|| build(capacity, 0, black_box(NUM_UPDATES)))
+        });
+        group.bench_function(BenchmarkId::new("insert_all", capacity), |b| {
+            b.iter(|| {
+                let mut filter =
+                    BloomFilterBuilder::with_accuracy(capacity, FALSE_POSITIVE_RATE).build();
+                filter.insert_all(0..black_box(NUM_UPDATES));
+                filter
+            })
+        });
+    }
+    group.finish();
+}
+
+fn bench_contains(c: &mut Criterion) {
+    let mut group = c.benchmark_group("bloom/contains");
+    group.throughput(Throughput::Elements(NUM_UPDATES));
+    for capacity in CAPACITIES {
+        let filter = build(capacity, 0, NUM_UPDATES);
+        group.bench_with_input(
+            BenchmarkId::from_parameter(capacity),
+            &filter,
+            |b, filter| {
+                // Half of the probed items were inserted.
+                b.iter(|| {
+                    (NUM_UPDATES / 2..NUM_UPDATES * 3 / 2)
+                        .filter(|i| filter.contains(i))
+                        .count()
+                })
+            },
+        );
+    }
+    group.finish();
+}
+
+fn bench_union(c: &mut Criterion) {
+    let mut group = c.benchmark_group("bloom/union");
+    for capacity in CAPACITIES {
+        let left = build(capacity, 0, NUM_UPDATES);
+        let right = build(capacity, NUM_UPDATES, NUM_UPDATES);
+        group.throughput(Throughput::Bytes(left.serialize().len() as u64));
+        group.bench_with_input(
+            BenchmarkId::from_parameter(capacity),
+            &(left, right),
+            |b, (left, right)| {
+                b.iter(|| {
+                    let mut union = left.clone();
+                    union.union(right);
+                    union
+                })
+            },
+        );
+    }
+    group.finish();
+}
+
+fn bench_serialization(c: &mut Criterion) {
+    let mut group = c.benchmark_group("bloom/serialize");
+    for capacity in CAPACITIES {
+        let filter = build(capacity, 0, NUM_UPDATES);
+        group.bench_with_input(
+            BenchmarkId::from_parameter(capacity),
+            &filter,
+            |b, filter| b.iter(|| filter.serialize()),
+        );
+    }
+    group.finish();
+
+    let mut group = c.benchmark_group("bloom/deserialize");
+    for capacity in CAPACITIES {
+        let bytes = build(capacity, 0, NUM_UPDATES).serialize();
+        group.bench_with_input(BenchmarkId::from_parameter(capacity), &bytes, |b, bytes| {
+            b.iter(|| BloomFilter::deserialize(black_box(bytes)).unwrap())
+        });
+    }
+    group.finish();
+}
+
+criterion_group!(
+    benches,
+    bench_insert,
+    bench_contains,
+    bench_union,
+    bench_serialization
+);
+criterion_main!(benches);
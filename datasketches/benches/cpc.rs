@@ -0,0 +1,98 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Update, union and serialization benchmarks for `CpcSketch`.
+
+use std::hint::black_box;
+
+use criterion::BenchmarkId;
+use criterion::Criterion;
+use criterion::Throughput;
+use criterion::criterion_group;
+use criterion::criterion_main;
+use datasketches::cpc::CpcSketch;
+use datasketches::cpc::CpcUnion;
+
+const LG_KS: [u8; 3] = [10, 12, 14];
+const NUM_UPDATES: u64 = 100_000;
+const NUM_SKETCHES: u64 = 100;
+
+fn build(lg_k: u8, offset: u64, n: u64) -> CpcSketch {
+    let mut sketch = CpcSketch::new(lg_k);
+    for i in offset..offset + n {
+        sketch.update(i);
+    }
+    sketch
+}
+
+fn bench_update(c: &mut Criterion) {
+    let mut group = c.benchmark_group("cpc/update");
+    group.throughput(Throughput::Elements(NUM_UPDATES));
+    for lg_k in LG_KS {
+        group.bench_function(BenchmarkId::from_parameter(lg_k), |b| {
+            b.iter(|| build(lg_k, 0, black_box(NUM_UPDATES)))
+        });
+    }
+    group.finish();
+}
+
+fn bench_union(c: &mut Criterion) {
+    let mut group = c.benchmark_group("cpc/union");
+    group.throughput(Throughput::Elements(NUM_SKETCHES));
+    for lg_k in LG_KS {
+        let sketches: Vec<_> = (0..NUM_SKETCHES)
+            .map(|i| build(lg_k, i * 10_000, 10_000))
+            .collect();
+        group.bench_with_input(
+            BenchmarkId::from_parameter(lg_k),
+            &sketches,
+            |b, sketches| {
+                b.iter(|| {
+                    let mut union = CpcUnion::new(lg_k);
+                    for sketch in sketches {
+                        union.update(sketch);
+                    }
+                    union.to_sketch()
+                })
+            },
+        );
+    }
+    group.finish();
+}
+
+fn bench_serialization(c: &mut Criterion) {
+    let mut group = c.benchmark_group("cpc/serialize");
+    for lg_k in LG_KS {
+        let sketch = build(lg_k, 0, NUM_UPDATES);
+        group.bench_with_input(BenchmarkId::from_parameter(lg_k), &sketch, |b, sketch| {
+            b.iter(|| sketch.serialize())
+        });
+    }
+    group.finish();
+
+    let mut group = c.benchmark_group("cpc/deserialize");
+    for lg_k in LG_KS {
+        let bytes = build(lg_k, 0, NUM_UPDATES).serialize();
+        group.bench_with_input(BenchmarkId::from_parameter(lg_k), &bytes, |b, bytes| {
+            b.iter(|| CpcSketch::deserialize(black_box(bytes)).unwrap())
+        });
+    }
+    group.finish();
+}
+
+criterion_group!(benches, bench_update, bench_union, bench_serialization);
+criterion_main!(benches);
@@ -0,0 +1,106 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Update, union and serialization benchmarks for `HllSketch`.
+
+use std::hint::black_box;
+
+use criterion::BenchmarkId;
+use criterion::Criterion;
+use criterion::Throughput;
+use criterion::criterion_group;
+use criterion::criterion_main;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+
+const LG_KS: [u8; 3] = [10, 12, 14];
+const HLL_TYPES: [HllType; 3] = [HllType::Hll4, HllType::Hll6, HllType::Hll8];
+const NUM_UPDATES: u64 = 100_000;
+const NUM_SKETCHES: u64 = 100;
+
+fn build(lg_k: u8, hll_type: HllType, offset: u64, n: u64) -> HllSketch {
+    let mut sketch = HllSketch::new(lg_k, hll_type);
+    for i in offset..offset + n {
+        sketch.update(i);
+    }
+    sketch
+}
+
+fn bench_update(c: &mut Criterion) {
+    let mut group = c.benchmark_group("hll/update");
+    group.throughput(Throughput::Elements(NUM_UPDATES));
+    for hll_type in HLL_TYPES {
+        for lg_k in LG_KS {
+            let id = BenchmarkId::new(format!("{hll_type:?}"), lg_k);
+            group.bench_function(id, |b| {
+                b.iter(|| build(lg_k, hll_type, 0, black_box(NUM_UPDATES)))
+            });
+        }
+    }
+    group.finish();
+}
+
+fn bench_union(c: &mut Criterion) {
+    let mut group = c.benchmark_group("hll/union");
+    group.throughput(Throughput::Elements(NUM_SKETCHES));
+    for hll_type in HLL_TYPES {
+        for lg_k in LG_KS {
+            let sketches: Vec<_> = (0..NUM_SKETCHES)
+                .map(|i| build(lg_k, hll_type, i * 10_000, 10_000))
+                .collect();
+            let id = BenchmarkId::new(format!("{hll_type:?}"), lg_k);
+            group.bench_with_input(id, &sketches, |b, sketches| {
+                b.iter(|| {
+                    let mut union = HllUnion::new(lg_k);
+                    for sketch in sketches {
+                        union.update(sketch);
+                    }
+                    union.to_sketch(hll_type)
+                })
+            });
+        }
+    }
+    group.finish();
+}
+
+fn bench_serialization(c: &mut Criterion) {
+    let mut group = c.benchmark_group("hll/serialize");
+    for hll_type in HLL_TYPES {
+        for lg_k in LG_KS {
+            let sketch = build(lg_k, hll_type, 0, NUM_UPDATES);
+            let id = BenchmarkId::new(format!("{hll_type:?}"), lg_k);
+            group.bench_with_input(id, &sketch, |b, sketch| b.iter(|| sketch.serialize()));
+        }
+    }
+    group.finish();
+
+    let mut group = c.benchmark_group("hll/deserialize");
+    for hll_type in HLL_TYPES {
+        for lg_k in LG_KS {
+            let bytes = build(lg_k, hll_type, 0, NUM_UPDATES).serialize();
+            let id = BenchmarkId::new(format!("{hll_type:?}"), lg_k);
+            group.bench_with_input(id, &bytes, |b, bytes| {
+                b.iter(|| HllSketch::deserialize(black_box(bytes)).unwrap())
+            });
+        }
+    }
+    group.finish();
+}
+
+criterion_group!(benches, bench_update, bench_union, bench_serialization);
+criterion_main!(benches);
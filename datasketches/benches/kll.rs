@@ -0,0 +1,140 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Update, merge, query and serialization benchmarks for `KllSketch`.
+
+use std::hint::black_box;
+
+use criterion::BenchmarkId;
+use criterion::Criterion;
+use criterion::Throughput;
+use criterion::criterion_group;
+use criterion::criterion_main;
+use datasketches::kll::KllSketch;
+
+const KS: [u16; 3] = [100, 200, 800];
+const NUM_UPDATES: u64 = 100_000;
+const NUM_SKETCHES: u64 = 100;
+
+fn build(k: u16, offset: u64, n: u64) -> KllSketch<f64> {
+    let mut sketch = KllSketch::new(k);
+    for i in offset..offset + n {
+        sketch.update(i as f64);
+    }
+    sketch
+}
+
+fn bench_update(c: &mut Criterion) {
+    let mut group = c.benchmark_group("kll/update");
+    group.throughput(Throughput::Elements(NUM_UPDATES));
+    for k in KS {
+        group.bench_function(BenchmarkId::from_parameter(k), |b| {
+            b.iter(|| build(k, 0, black_box(NUM_UPDATES)))
+        });
+    }
+    group.finish();
+}
+
+fn bench_sorted_update(c: &mut Criterion) {
+    let items: Vec<f64> = (0..NUM_UPDATES).map(|i| i as f64).collect();
+    let mut group = c.benchmark_group("kll/update_sorted");
+    group.throughput(Throughput::Elements(NUM_UPDATES));
+    for k in KS {
+        group.bench_with_input(BenchmarkId::new("update", k), &items, |b, items| {
+            b.iter(|| {
+                let mut sketch = KllSketch::new(k);
+                for &item in black_box(items) {
+                    sketch.update(item);
+                }
+                sketch
+            })
+        });
+        group.bench_with_input(
+            BenchmarkId::new("update_from_iter", k),
+            &items,
+            |b, items| {
+                b.iter(|| {
+                    let mut sketch = KllSketch::new(k);
+                    sketch.update_from_iter(black_box(items).iter().copied());
+                    sketch
+                })
+            },
+        );
+    }
+    group.finish();
+}
+
+fn bench_merge(c: &mut Criterion) {
+    let mut group = c.benchmark_group("kll/merge");
+    group.throughput(Throughput::Elements(NUM_SKETCHES));
+    for k in KS {
+        let sketches: Vec<_> = (0..NUM_SKETCHES)
+            .map(|i| build(k, i * 10_000, 10_000))
+            .collect();
+        group.bench_with_input(BenchmarkId::from_parameter(k), &sketches, |b, sketches| {
+            b.iter(|| {
+                let mut result = KllSketch::new(k);
+                for sketch in sketches {
+                    result.merge(sketch);
+                }
+                result
+            })
+        });
+    }
+    group.finish();
+}
+
+fn bench_query(c: &mut Criterion) {
+    let mut group = c.benchmark_group("kll/quantile");
+    for k in KS {
+        let sketch = build(k, 0, NUM_UPDATES);
+        group.bench_with_input(BenchmarkId::from_parameter(k), &sketch, |b, sketch| {
+            b.iter(|| sketch.quantile(black_box(0.99), true))
+        });
+    }
+    group.finish();
+}
+
+fn bench_serialization(c: &mut Criterion) {
+    let mut group = c.benchmark_group("kll/serialize");
+    for k in KS {
+        let sketch = build(k, 0, NUM_UPDATES);
+        group.bench_with_input(BenchmarkId::from_parameter(k), &sketch, |b, sketch| {
+            b.iter(|| sketch.serialize())
+        });
+    }
+    group.finish();
+
+    let mut group = c.benchmark_group("kll/deserialize");
+    for k in KS {
+        let bytes = build(k, 0, NUM_UPDATES).serialize();
+        group.bench_with_input(BenchmarkId::from_parameter(k), &bytes, |b, bytes| {
+            b.iter(|| KllSketch::<f64>::deserialize(black_box(bytes)).unwrap())
+        });
+    }
+    group.finish();
+}
+
+criterion_group!(
+    benches,
+    bench_update,
+    bench_sorted_update,
+    bench_merge,
+    bench_query,
+    bench_serialization
+);
+criterion_main!(benches);
@@ -0,0 +1,110 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Update, union and serialization benchmarks for Theta sketches.
+
+use std::hint::black_box;
+
+use criterion::BenchmarkId;
+use criterion::Criterion;
+use criterion::Throughput;
+use criterion::criterion_group;
+use criterion::criterion_main;
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::theta::ThetaUnionBuilder;
+
+const LG_KS: [u8; 3] = [10, 12, 14];
+const NUM_UPDATES: u64 = 100_000;
+const NUM_SKETCHES: u64 = 100;
+
+fn build(lg_k: u8, offset: u64, n: u64) -> ThetaSketch {
+    let mut sketch = ThetaSketchBuilder::default().lg_k(lg_k).build();
+    for i in offset..offset + n {
+        sketch.update(i);
+    }
+    sketch
+}
+
+fn bench_update(c: &mut Criterion) {
+    let mut group = c.benchmark_group("theta/update");
+    group.throughput(Throughput::Elements(NUM_UPDATES));
+    for lg_k in LG_KS {
+        group.bench_function(BenchmarkId::from_parameter(lg_k), |b| {
+            b.iter(|| build(lg_k, 0, black_box(NUM_UPDATES)))
+        });
+    }
+    group.finish();
+}
+
+fn bench_union(c: &mut Criterion) {
+    let mut group = c.benchmark_group("theta/union");
+    group.throughput(Throughput::Elements(NUM_SKETCHES));
+    for lg_k in LG_KS {
+        let sketches: Vec<_> = (0..NUM_SKETCHES)
+            .map(|i| build(lg_k, i * 10_000, 10_000).compact(true))
+            .collect();
+        group.bench_with_input(
+            BenchmarkId::from_parameter(lg_k),
+            &sketches,
+            |b, sketches| {
+                b.iter(|| {
+                    let mut union = ThetaUnionBuilder::default().lg_k(lg_k).build();
+                    for sketch in sketches {
+                        union.update(sketch).unwrap();
+                    }
+                    union.to_sketch(true)
+                })
+            },
+        );
+    }
+    group.finish();
+}
+
+fn bench_serialization(c: &mut Criterion) {
+    let mut group = c.benchmark_group("theta/serialize");
+    for lg_k in LG_KS {
+        let sketch = build(lg_k, 0, NUM_UPDATES).compact(true);
+        group.bench_with_input(BenchmarkId::new("plain", lg_k), &sketch, |b, sketch| {
+            b.iter(|| sketch.serialize())
+        });
+        group.bench_with_input(
+            BenchmarkId::new("compressed", lg_k),
+            &sketch,
+            |b, sketch| b.iter(|| sketch.serialize_compressed()),
+        );
+    }
+    group.finish();
+
+    let mut group = c.benchmark_group("theta/deserialize");
+    for lg_k in LG_KS {
+        let sketch = build(lg_k, 0, NUM_UPDATES).compact(true);
+        for (name, bytes) in [
+            ("plain", sketch.serialize()),
+            ("compressed", sketch.serialize_compressed()),
+        ] {
+            group.bench_with_input(BenchmarkId::new(name, lg_k), &bytes, |b, bytes| {
+                b.iter(|| CompactThetaSketch::deserialize(black_box(bytes)).unwrap())
+            });
+        }
+    }
+    group.finish();
+}
+
+criterion_group!(benches, bench_update, bench_union, bench_serialization);
+criterion_main!(benches);
@@ -0,0 +1,296 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Background merging of serialized sketches by key
+//!
+//! An [`Aggregator`] runs a thread that receives serialized sketches from any number of
+//! producers over a channel and merges each into a union kept per key. Every flush interval,
+//! and whenever [`Aggregator::flush`] is called, the unions collected so far are handed to a
+//! callback as a [`Flush`] and the aggregator starts over with empty unions, so each flush
+//! covers the images received since the previous one.
+//!
+//! The unions are any type implementing [`ImageUnion`]. [`HllUnion`](crate::hll::HllUnion),
+//! [`CpcUnion`](crate::cpc::CpcUnion), [`ThetaUnion`](crate::theta::ThetaUnion) and
+//! [`KllSketch`](crate::kll::KllSketch) implement it when their features are enabled.
+//!
+//! # Examples
+//!
+//! ```
+//! # use std::collections::BTreeSet;
+//! # use std::sync::mpsc;
+//! # use std::time::Duration;
+//! # use datasketches::aggregator::Aggregator;
+//! # use datasketches::aggregator::ImageUnion;
+//! # use datasketches::error::Error;
+//! /// Collects the distinct bytes of every image
+//! #[derive(Default)]
+//! struct DistinctBytes(BTreeSet<u8>);
+//!
+//! impl ImageUnion for DistinctBytes {
+//!     fn update_image(&mut self, image: &[u8]) -> Result<(), Error> {
+//!         self.0.extend(image);
+//!         Ok(())
+//!     }
+//! }
+//!
+//! let (flushes, received) = mpsc::channel();
+//! let aggregator = Aggregator::spawn(
+//!     Duration::from_secs(60),
+//!     |_key: &&str| DistinctBytes::default(),
+//!     move |flush| flushes.send(flush.into_unions()).unwrap(),
+//! );
+//!
+//! let sender = aggregator.sender();
+//! std::thread::spawn(move || {
+//!     sender.send("a", vec![1, 2]);
+//!     sender.send("a", vec![2, 3]);
+//!     sender.send("b", vec![7]);
+//! })
+//! .join()
+//! .unwrap();
+//! aggregator.close();
+//!
+//! let unions = received.recv().unwrap();
+//! assert_eq!(unions["a"].0, BTreeSet::from([1, 2, 3]));
+//! assert_eq!(unions["b"].0, BTreeSet::from([7]));
+//! ```
+
+use std::collections::HashMap;
+use std::hash::Hash;
+use std::sync::mpsc;
+use std::sync::mpsc::Receiver;
+use std::sync::mpsc::RecvTimeoutError;
+use std::sync::mpsc::Sender;
+use std::thread::JoinHandle;
+use std::time::Duration;
+use std::time::Instant;
+
+use crate::error::Error;
+
+/// A union that merges sketches from their serialized images.
+pub trait ImageUnion {
+    /// Merges the sketch serialized in `image` into this union.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the image is not a valid sketch this union can merge.
+    fn update_image(&mut self, image: &[u8]) -> Result<(), Error>;
+}
+
+/// Messages from the handles to the aggregator thread
+enum Message<K> {
+    Image(K, Vec<u8>),
+    Flush,
+    Close,
+}
+
+/// A background thread maintaining a union of serialized sketches per key.
+///
+/// See the [module level documentation](self) for an example. Dropping the aggregator closes
+/// it like [`close`](Self::close) does, except that a panic of the flush callback is not
+/// propagated.
+#[derive(Debug)]
+pub struct Aggregator<K> {
+    sender: Sender<Message<K>>,
+    worker: Option<JoinHandle<()>>,
+}
+
+impl<K> Aggregator<K>
+where
+    K: Eq + Hash + Clone + Send + 'static,
+{
+    /// Starts an aggregator thread.
+    ///
+    /// `new_union` creates the union for a key when the first image for it arrives after a
+    /// flush. `on_flush` runs on the aggregator thread every `flush_interval`, on each call to
+    /// [`flush`](Self::flush) and once more when the aggregator is closed, but only when
+    /// images arrived since the previous flush.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `flush_interval` is zero or if the thread cannot be spawned.
+    pub fn spawn<U, N, F>(flush_interval: Duration, new_union: N, on_flush: F) -> Self
+    where
+        U: ImageUnion,
+        N: FnMut(&K) -> U + Send + 'static,
+        F: FnMut(Flush<K, U>) + Send + 'static,
+    {
+        assert!(!flush_interval.is_zero(), "flush_interval must be positive");
+        let (sender, receiver) = mpsc::channel();
+        let worker = std::thread::Builder::new()
+            .name("datasketches-aggregator".to_string())
+            .spawn(move || run(receiver, flush_interval, new_union, on_flush))
+            .expect("failed to spawn the aggregator thread");
+        Self {
+            sender,
+            worker: Some(worker),
+        }
+    }
+
+    /// Returns a handle for sending images from other threads.
+    pub fn sender(&self) -> AggregatorSender<K> {
+        AggregatorSender {
+            sender: self.sender.clone(),
+        }
+    }
+
+    /// Queues `image` to be merged into the union of `key`.
+    ///
+    /// Returns false if the aggregator thread has stopped, which only happens when the flush
+    /// callback panicked.
+    pub fn send(&self, key: K, image: Vec<u8>) -> bool {
+        self.sender.send(Message::Image(key, image)).is_ok()
+    }
+
+    /// Requests a flush of the images queued so far, without waiting for it.
+    pub fn flush(&self) {
+        let _ = self.sender.send(Message::Flush);
+    }
+
+    /// Flushes the queued images and stops the aggregator thread.
+    ///
+    /// Images sent through an [`AggregatorSender`] after this call are dropped.
+    ///
+    /// # Panics
+    ///
+    /// Resumes the panic of the flush callback, if it panicked.
+    pub fn close(mut self) {
+        if let Err(panic) = self.stop() {
+            std::panic::resume_unwind(panic);
+        }
+    }
+}
+
+impl<K> Aggregator<K> {
+    /// Asks the thread to flush and exit, and waits for it
+    fn stop(&mut self) -> std::thread::Result<()> {
+        let _ = self.sender.send(Message::Close);
+        match self.worker.take() {
+            Some(worker) => worker.join(),
+            None => Ok(()),
+        }
+    }
+}
+
+impl<K> Drop for Aggregator<K> {
+    fn drop(&mut self) {
+        let _ = self.stop();
+    }
+}
+
+/// A cloneable handle for sending images to an [`Aggregator`] from any thread.
+#[derive(Debug)]
+pub struct AggregatorSender<K> {
+    sender: Sender<Message<K>>,
+}
+
+impl<K> Clone for AggregatorSender<K> {
+    fn clone(&self) -> Self {
+        Self {
+            sender: self.sender.clone(),
+        }
+    }
+}
+
+impl<K> AggregatorSender<K> {
+    /// Queues `image` to be merged into the union of `key`.
+    ///
+    /// Returns false if the aggregator has been closed, in which case the image is dropped.
+    pub fn send(&self, key: K, image: Vec<u8>) -> bool {
+        self.sender.send(Message::Image(key, image)).is_ok()
+    }
+}
+
+/// The unions collected by an [`Aggregator`] between two flushes.
+#[derive(Debug)]
+pub struct Flush<K, U> {
+    unions: HashMap<K, U>,
+    errors: Vec<(K, Error)>,
+}
+
+impl<K, U> Flush<K, U> {
+    /// Returns the union of each key that received a valid image.
+    pub fn unions(&self) -> &HashMap<K, U> {
+        &self.unions
+    }
+
+    /// Returns the unions, consuming the flush.
+    pub fn into_unions(self) -> HashMap<K, U> {
+        self.unions
+    }
+
+    /// Returns the key and the error of each image that could not be merged, in arrival order.
+    pub fn errors(&self) -> &[(K, Error)] {
+        &self.errors
+    }
+}
+
+/// The loop of the aggregator thread
+fn run<K, U, N, F>(
+    receiver: Receiver<Message<K>>,
+    flush_interval: Duration,
+    mut new_union: N,
+    mut on_flush: F,
+) where
+    K: Eq + Hash + Clone,
+    U: ImageUnion,
+    N: FnMut(&K) -> U,
+    F: FnMut(Flush<K, U>),
+{
+    let mut unions: HashMap<K, U> = HashMap::new();
+    let mut errors = Vec::new();
+    let mut deadline = Instant::now() + flush_interval;
+    let mut flush = |unions: &mut HashMap<K, U>, errors: &mut Vec<(K, Error)>| {
+        if !unions.is_empty() || !errors.is_empty() {
+            on_flush(Flush {
+                unions: std::mem::take(unions),
+                errors: std::mem::take(errors),
+            });
+        }
+    };
+
+    loop {
+        let timeout = deadline.saturating_duration_since(Instant::now());
+        match receiver.recv_timeout(timeout) {
+            Ok(Message::Image(key, image)) => {
+                let result = match unions.get_mut(&key) {
+                    Some(union) => union.update_image(&image),
+                    None => {
+                        let mut union = new_union(&key);
+                        let result = union.update_image(&image);
+                        if result.is_ok() {
+                            unions.insert(key.clone(), union);
+                        }
+                        result
+                    }
+                };
+                if let Err(err) = result {
+                    errors.push((key, err));
+                }
+            }
+            Ok(Message::Flush) => flush(&mut unions, &mut errors),
+            Err(RecvTimeoutError::Timeout) => {
+                flush(&mut unions, &mut errors);
+                deadline = Instant::now() + flush_interval;
+            }
+            Ok(Message::Close) | Err(RecvTimeoutError::Disconnected) => {
+                flush(&mut unions, &mut errors);
+                return;
+            }
+        }
+    }
+}
@@ -16,7 +16,10 @@
 // under the License.
 
 use super::BloomFilter;
+use super::BloomHasher;
+use super::XxHashBloomHasher;
 use crate::codec::family::Family;
+use crate::common::SketchConfig;
 use crate::hash::DEFAULT_UPDATE_SEED;
 
 /// Builder for creating [`BloomFilter`] instances.
@@ -150,12 +153,39 @@ impl BloomFilterBuilder {
         self
     }
 
+    /// Apply the seed of `config`, where set.
+    pub fn config(self, config: &SketchConfig) -> Self {
+        match config.seed {
+            Some(seed) => self.seed(seed),
+            None => self,
+        }
+    }
+
     /// Builds the Bloom filter.
     ///
     /// # Panics
     ///
     /// Panics if neither `with_accuracy()` nor `with_size()` was called.
     pub fn build(self) -> BloomFilter {
+        self.build_with_hasher(XxHashBloomHasher)
+    }
+
+    /// Builds the Bloom filter with a custom hashing strategy.
+    ///
+    /// See [`BloomHasher`] for the available strategies. Filters built with a strategy other
+    /// than the default [`XxHashBloomHasher`] cannot be queried by other implementations.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::BloomFilterBuilder;
+    /// # use datasketches::bloom::Murmur3BloomHasher;
+    /// let mut filter =
+    ///     BloomFilterBuilder::with_accuracy(100, 0.01).build_with_hasher(Murmur3BloomHasher);
+    /// filter.insert("apple");
+    /// assert!(filter.contains(&"apple"));
+    /// ```
+    pub fn build_with_hasher<H: BloomHasher>(self, hasher: H) -> BloomFilter<H> {
         let num_hashes = self.num_hashes;
         let num_words = self.num_bits.div_ceil(64) as usize;
         let bit_array = vec![0u64; num_words].into_boxed_slice();
@@ -165,6 +195,7 @@ impl BloomFilterBuilder {
             num_hashes,
             num_bits_set: 0,
             bit_array,
+            hasher,
         }
     }
 
@@ -0,0 +1,184 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::hash::Hash;
+
+use crate::bloom::BloomFilter;
+use crate::bloom::BloomFilterBuilder;
+use crate::bloom::BloomHasher;
+use crate::bloom::XxHashBloomHasher;
+use crate::bloom::sketch::compute_bit_index;
+use crate::common::SketchEvent;
+use crate::common::observer::notify;
+
+/// A Bloom filter with `NUM_WORDS` 64-bit words of bits stored inline, which never allocates.
+///
+/// The filter has `64 * NUM_WORDS` bits and hashes items like a [`BloomFilter`] with the default
+/// [`XxHashBloomHasher`], so for the same size, number of hashes and seed both set the same
+/// bits. [`new`](Self::new) is a `const fn`, so a filter can live in a `static` or on the stack
+/// without a heap allocator; [`to_filter`](Self::to_filter) copies it into a [`BloomFilter`] for
+/// serialization and set operations.
+///
+/// `NUM_WORDS` must be positive; zero fails to compile.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::bloom::FixedBloomFilter;
+/// // 4096 bits and 3 hash functions
+/// let mut filter = FixedBloomFilter::<64>::new(3, 9001);
+/// filter.insert("apple");
+/// assert!(filter.contains(&"apple"));
+/// assert!(!filter.contains(&"grape"));
+/// assert_eq!(filter.to_filter().bits_used(), filter.bits_used());
+/// ```
+#[derive(Debug, Clone, PartialEq)]
+pub struct FixedBloomFilter<const NUM_WORDS: usize> {
+    seed: u64,
+    num_hashes: u16,
+    num_bits_set: u64,
+    bit_array: [u64; NUM_WORDS],
+}
+
+impl<const NUM_WORDS: usize> FixedBloomFilter<NUM_WORDS> {
+    const CAPACITY: usize = {
+        assert!(NUM_WORDS > 0, "NUM_WORDS must be positive");
+        assert!(
+            NUM_WORDS as u64 <= BloomFilterBuilder::MAX_NUM_BITS / 64,
+            "NUM_WORDS exceeds the maximum size of a Bloom filter"
+        );
+        NUM_WORDS * 64
+    };
+
+    /// Creates an empty filter with `num_hashes` hash functions and the given hash seed.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `num_hashes` is outside
+    /// `[BloomFilterBuilder::MIN_NUM_HASHES, BloomFilterBuilder::MAX_NUM_HASHES]`.
+    pub const fn new(num_hashes: u16, seed: u64) -> Self {
+        assert!(
+            num_hashes >= BloomFilterBuilder::MIN_NUM_HASHES
+                && num_hashes <= BloomFilterBuilder::MAX_NUM_HASHES,
+            "num_hashes out of range"
+        );
+        let _ = Self::CAPACITY;
+        Self {
+            seed,
+            num_hashes,
+            num_bits_set: 0,
+            bit_array: [0; NUM_WORDS],
+        }
+    }
+
+    /// Tests whether an item is possibly in the set.
+    ///
+    /// See [`BloomFilter::contains`].
+    pub fn contains<T: Hash>(&self, item: &T) -> bool {
+        let (h0, h1) = XxHashBloomHasher.hash_pair(self.seed, item);
+        self.contains_hash(h0, h1)
+    }
+
+    /// Inserts an item into the filter.
+    pub fn insert<T: Hash>(&mut self, item: T) {
+        let (h0, h1) = XxHashBloomHasher.hash_pair(self.seed, &item);
+        self.insert_hash(h0, h1);
+    }
+
+    /// Tests whether an item with the given base hashes is possibly in the set.
+    ///
+    /// See [`BloomFilter::contains_hash`].
+    pub fn contains_hash(&self, h0: u64, h1: u64) -> bool {
+        if self.is_empty() {
+            return false;
+        }
+        (1..=self.num_hashes).all(|i| {
+            let bit_index = compute_bit_index(h0, h1, i, Self::CAPACITY);
+            self.bit_array[bit_index >> 6] & (1 << (bit_index & 63)) != 0
+        })
+    }
+
+    /// Inserts an item given by its base hashes.
+    ///
+    /// Reports [`SketchEvent::BloomSaturated`] when the insert fills half of the filter.
+    pub fn insert_hash(&mut self, h0: u64, h1: u64) {
+        let half = Self::CAPACITY as u64 / 2;
+        let was_saturated = self.num_bits_set >= half;
+        for i in 1..=self.num_hashes {
+            let bit_index = compute_bit_index(h0, h1, i, Self::CAPACITY);
+            let word = &mut self.bit_array[bit_index >> 6];
+            let mask = 1 << (bit_index & 63);
+            if *word & mask == 0 {
+                *word |= mask;
+                self.num_bits_set += 1;
+            }
+        }
+        if !was_saturated && self.num_bits_set >= half {
+            notify(SketchEvent::BloomSaturated {
+                capacity: Self::CAPACITY,
+                num_hashes: self.num_hashes,
+            });
+        }
+    }
+
+    /// Clears all bits, keeping the configuration.
+    pub fn reset(&mut self) {
+        self.bit_array = [0; NUM_WORDS];
+        self.num_bits_set = 0;
+    }
+
+    /// Returns true if no item has been inserted.
+    pub fn is_empty(&self) -> bool {
+        self.num_bits_set == 0
+    }
+
+    /// Returns the number of bits set to 1.
+    pub fn bits_used(&self) -> u64 {
+        self.num_bits_set
+    }
+
+    /// Returns the number of bits of the filter, `64 * NUM_WORDS`.
+    pub const fn capacity(&self) -> usize {
+        Self::CAPACITY
+    }
+
+    /// Returns the number of hash functions.
+    pub fn num_hashes(&self) -> u16 {
+        self.num_hashes
+    }
+
+    /// Returns the hash seed.
+    pub fn seed(&self) -> u64 {
+        self.seed
+    }
+
+    /// Returns the bits of the filter, in the layout of [`BloomFilter::bit_array`].
+    pub fn bit_array(&self) -> &[u64; NUM_WORDS] {
+        &self.bit_array
+    }
+
+    /// Copies the filter into a heap-allocated [`BloomFilter`].
+    pub fn to_filter(&self) -> BloomFilter {
+        BloomFilter {
+            seed: self.seed,
+            num_hashes: self.num_hashes,
+            num_bits_set: self.num_bits_set,
+            bit_array: self.bit_array.into(),
+            hasher: XxHashBloomHasher,
+        }
+    }
+}
@@ -0,0 +1,139 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::hash::Hash;
+use std::hash::Hasher;
+
+use crate::bloom::sketch::compute_hash;
+use crate::hash::MurmurHash3X64128;
+use crate::hash::write_integers_le;
+
+/// A hashing strategy for [`BloomFilter`](super::BloomFilter).
+///
+/// A Bloom filter derives all of its bit positions from two 64-bit base hashes of an item using
+/// double hashing. Implementations of this trait decide how those two values are computed.
+///
+/// The strategy is not recorded in the serialized image. A filter must be deserialized with the
+/// same strategy it was built with, see
+/// [`deserialize_with_hasher`](super::BloomFilter::deserialize_with_hasher).
+pub trait BloomHasher {
+    /// Computes the two base hash values of `item` under the filter's `seed`.
+    fn hash_pair<T: Hash + ?Sized>(&self, seed: u64, item: &T) -> (u64, u64);
+}
+
+/// The default strategy, compatible with the Java and C++ Bloom filters.
+///
+/// Computes `h0 = XXHash64(item, seed)` and `h1 = XXHash64(item, h0)`.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub struct XxHashBloomHasher;
+
+impl BloomHasher for XxHashBloomHasher {
+    fn hash_pair<T: Hash + ?Sized>(&self, seed: u64, item: &T) -> (u64, u64) {
+        compute_hash(seed, item)
+    }
+}
+
+/// A strategy using both halves of a single MurmurHash3 x64 128-bit hash.
+///
+/// This hashes each item once instead of twice, at the cost of images that other
+/// implementations cannot query.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub struct Murmur3BloomHasher;
+
+impl BloomHasher for Murmur3BloomHasher {
+    fn hash_pair<T: Hash + ?Sized>(&self, seed: u64, item: &T) -> (u64, u64) {
+        let mut hasher = MurmurHash3X64128::with_seed(seed);
+        item.hash(&mut hasher);
+        hasher.finish128()
+    }
+}
+
+/// A strategy for items that already are 128-bit hashes computed upstream.
+///
+/// The first 16 bytes the item feeds to the hasher are taken verbatim as the two base hashes,
+/// low half first, so a `u128` hash or a `(u64, u64)` pair is used without re-hashing. Shorter
+/// inputs are zero padded. The filter seed is not applied; seed the upstream hash instead.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::bloom::BloomFilterBuilder;
+/// # use datasketches::bloom::PrehashedBloomHasher;
+/// let mut filter =
+///     BloomFilterBuilder::with_accuracy(1000, 0.01).build_with_hasher(PrehashedBloomHasher);
+///
+/// let hash: u128 = 0x0123_4567_89ab_cdef_fedc_ba98_7654_3210;
+/// filter.insert(hash);
+/// assert!(filter.contains(&hash));
+/// ```
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub struct PrehashedBloomHasher;
+
+impl BloomHasher for PrehashedBloomHasher {
+    fn hash_pair<T: Hash + ?Sized>(&self, _seed: u64, item: &T) -> (u64, u64) {
+        let mut capture = Capture::default();
+        item.hash(&mut capture);
+        let h0 = u64::from_le_bytes(capture.buf[..8].try_into().unwrap());
+        let h1 = u64::from_le_bytes(capture.buf[8..].try_into().unwrap());
+        (h0, h1)
+    }
+}
+
+/// Records the first 16 bytes written to it.
+#[derive(Default)]
+struct Capture {
+    buf: [u8; 16],
+    len: usize,
+}
+
+impl Hasher for Capture {
+    fn finish(&self) -> u64 {
+        u64::from_le_bytes(self.buf[..8].try_into().unwrap())
+    }
+
+    write_integers_le!();
+
+    fn write(&mut self, bytes: &[u8]) {
+        let n = bytes.len().min(self.buf.len() - self.len);
+        self.buf[self.len..self.len + n].copy_from_slice(&bytes[..n]);
+        self.len += n;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_prehashed_takes_halves_verbatim() {
+        let hash: u128 = (7 << 64) | 3;
+        assert_eq!(PrehashedBloomHasher.hash_pair(9001, &hash), (3, 7));
+        assert_eq!(
+            PrehashedBloomHasher.hash_pair(9001, &(3_u64, 7_u64)),
+            (3, 7)
+        );
+        assert_eq!(PrehashedBloomHasher.hash_pair(9001, &5_u64), (5, 0));
+    }
+
+    #[test]
+    fn test_murmur_uses_both_halves() {
+        let (h0, h1) = Murmur3BloomHasher.hash_pair(9001, &42_u64);
+        let mut hasher = MurmurHash3X64128::with_seed(9001);
+        42_u64.hash(&mut hasher);
+        assert_eq!((h0, h1), hasher.finish128());
+    }
+}
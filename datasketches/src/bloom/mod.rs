@@ -109,7 +109,8 @@
 //!
 //! # Implementation Details
 //!
-//! * Uses XXHash64 for hashing
+//! * Uses XXHash64 for hashing by default; other strategies can be plugged in through
+//!   [`BloomHasher`]
 //! * Implements double hashing (Kirsch-Mitzenmacher method) for k hash functions
 //! * Bits packed efficiently in `u64` words
 //! * Compatible serialization format (family ID: 21)
@@ -121,7 +122,19 @@
 //!   Filter"
 
 mod builder;
+mod fixed;
+mod hasher;
 mod sketch;
+mod wrapper;
 
 pub use self::builder::BloomFilterBuilder;
+pub use self::fixed::FixedBloomFilter;
+pub use self::hasher::BloomHasher;
+pub use self::hasher::Murmur3BloomHasher;
+pub use self::hasher::PrehashedBloomHasher;
+pub use self::hasher::XxHashBloomHasher;
 pub use self::sketch::BloomFilter;
+pub use self::wrapper::BloomFilterWrapper;
+
+/// A Bloom filter shared read-only across threads.
+pub type SharedBloomFilter = crate::common::SharedCompactSketch<BloomFilter>;
@@ -17,19 +17,35 @@
 
 use std::hash::Hash;
 use std::hash::Hasher;
-
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use crate::bloom::BloomFilterBuilder;
+use crate::bloom::BloomFilterWrapper;
+use crate::bloom::BloomHasher;
+use crate::bloom::XxHashBloomHasher;
 use crate::codec::SketchBytes;
 use crate::codec::SketchSlice;
 use crate::codec::assert::ensure_preamble_longs_in_range;
 use crate::codec::assert::ensure_serial_version_is;
 use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
 use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::SketchEvent;
+use crate::common::observer::notify;
 use crate::error::Error;
 use crate::hash::XxHash64;
 
 // Serialization constants
 const SERIAL_VERSION: u8 = 1;
 const EMPTY_FLAG_MASK: u8 = 1 << 2;
+/// Set when the bit array is stored as the gaps between its set bits rather than as raw words.
+const COMPRESSED_FLAG_MASK: u8 = 1 << 3;
 
 /// A Bloom filter for probabilistic set membership testing.
 ///
@@ -39,8 +55,11 @@ const EMPTY_FLAG_MASK: u8 = 1 << 2;
 /// * Constant space usage
 ///
 /// Use [`super::BloomFilterBuilder`] to construct instances.
+///
+/// Items are hashed with the [`BloomHasher`] strategy `H`, which defaults to
+/// [`XxHashBloomHasher`] for compatibility with the Java and C++ filters.
 #[derive(Debug, Clone, PartialEq)]
-pub struct BloomFilter {
+pub struct BloomFilter<H = XxHashBloomHasher> {
     /// Hash seed for all hash functions
     pub(super) seed: u64,
     /// Number of hash functions to use (k)
@@ -49,9 +68,11 @@ pub struct BloomFilter {
     pub(super) num_bits_set: u64,
     /// Bit array packed into u64 words
     pub(super) bit_array: Box<[u64]>,
+    /// Strategy computing the base hashes of an item
+    pub(super) hasher: H,
 }
 
-impl BloomFilter {
+impl<H: BloomHasher> BloomFilter<H> {
     /// Tests whether an item is possibly in the set.
     ///
     /// Returns:
@@ -122,6 +143,73 @@ impl BloomFilter {
         self.set_bits(h0, h1);
     }
 
+    /// Tests whether an item with the given base hashes is possibly in the set.
+    ///
+    /// `h0` and `h1` take the place of the [`BloomHasher`] output for the item, which lets a
+    /// caller that already has a 128-bit hash of its keys skip hashing them again. The same pair
+    /// must be used for insertion and lookup.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::BloomFilterBuilder;
+    /// let mut filter = BloomFilterBuilder::with_accuracy(100, 0.01).build();
+    /// filter.insert_hash(0x1234, 0x5678);
+    /// assert!(filter.contains_hash(0x1234, 0x5678));
+    /// ```
+    pub fn contains_hash(&self, h0: u64, h1: u64) -> bool {
+        if self.is_empty() {
+            return false;
+        }
+        self.check_bits(h0, h1)
+    }
+
+    /// Inserts an item given by its base hashes.
+    ///
+    /// See [`contains_hash`](Self::contains_hash).
+    pub fn insert_hash(&mut self, h0: u64, h1: u64) {
+        self.set_bits(h0, h1);
+    }
+
+    /// Inserts every item of an iterator into the filter.
+    ///
+    /// This is equivalent to calling [`insert`](Self::insert) for each item, but hashes the
+    /// items in small batches before touching the bit array. Keeping the hashing and the
+    /// scattered bit writes in separate passes lets the memory accesses of a batch overlap,
+    /// which pays off when bulk loading filters much larger than the CPU caches.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::BloomFilterBuilder;
+    /// let mut filter = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+    ///
+    /// filter.insert_all(0..500_u64);
+    /// filter.insert_all(["apple", "banana"]);
+    ///
+    /// assert!(filter.contains(&42_u64));
+    /// assert!(filter.contains(&"banana"));
+    /// ```
+    pub fn insert_all<T: Hash, I: IntoIterator<Item = T>>(&mut self, items: I) {
+        const BATCH_SIZE: usize = 16;
+
+        let mut hashes = [(0u64, 0u64); BATCH_SIZE];
+        let mut items = items.into_iter();
+        loop {
+            let mut len = 0;
+            for item in items.by_ref().take(BATCH_SIZE) {
+                hashes[len] = self.compute_hash(&item);
+                len += 1;
+            }
+            for &(h0, h1) in &hashes[..len] {
+                self.set_bits(h0, h1);
+            }
+            if len < BATCH_SIZE {
+                break;
+            }
+        }
+    }
+
     /// Resets the filter to its initial empty state.
     ///
     /// Clears all bits while preserving capacity and configuration.
@@ -171,7 +259,7 @@ impl BloomFilter {
     /// assert!(f1.contains(&"a"));
     /// assert!(f1.contains(&"b"));
     /// ```
-    pub fn union(&mut self, other: &BloomFilter) {
+    pub fn union(&mut self, other: &BloomFilter<H>) {
         assert!(
             self.is_compatible(other),
             "Cannot union incompatible Bloom filters"
@@ -215,7 +303,7 @@ impl BloomFilter {
     /// assert!(f1.contains(&"b")); // In both
     /// // "a" and "c" likely return false now
     /// ```
-    pub fn intersect(&mut self, other: &BloomFilter) {
+    pub fn intersect(&mut self, other: &BloomFilter<H>) {
         assert!(
             self.is_compatible(other),
             "Cannot intersect incompatible Bloom filters"
@@ -269,6 +357,28 @@ impl BloomFilter {
         self.bit_array.len() * 64
     }
 
+    /// Returns the bit array of the filter, packed into 64-bit words.
+    ///
+    /// Bit `i` of the filter is bit `i % 64` of word `i / 64`, counting from the least
+    /// significant bit, which is also the order of the words in the serialized image. Together
+    /// with [`num_hashes`](Self::num_hashes) and [`seed`](Self::seed), the words are all that
+    /// another implementation of the same hashing needs to probe the filter.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::BloomFilterBuilder;
+    /// let mut filter = BloomFilterBuilder::with_size(128, 3).build();
+    /// filter.insert("apple");
+    /// let words = filter.bit_array();
+    /// assert_eq!(words.len(), 2);
+    /// let ones: u32 = words.iter().map(|word| word.count_ones()).sum();
+    /// assert_eq!(u64::from(ones), filter.bits_used());
+    /// ```
+    pub fn bit_array(&self) -> &[u64] {
+        &self.bit_array
+    }
+
     /// Returns the number of hash functions used.
     pub fn num_hashes(&self) -> u16 {
         self.num_hashes
@@ -305,6 +415,27 @@ impl BloomFilter {
         load.powf(k)
     }
 
+    /// Estimates the number of distinct items inserted into the filter.
+    ///
+    /// Uses the Swamidass-Baldi estimate derived from the number of bits set:
+    /// `-(capacity / k) * ln(1 - load_factor)`. Returns infinity once every bit is set, which
+    /// signals a saturated filter.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::BloomFilterBuilder;
+    /// let mut filter = BloomFilterBuilder::with_accuracy(10_000, 0.01).build();
+    /// for i in 0..1000_u64 {
+    ///     filter.insert(i);
+    /// }
+    /// let estimate = filter.estimated_num_items();
+    /// assert!((estimate - 1000.0).abs() < 50.0);
+    /// ```
+    pub fn estimated_num_items(&self) -> f64 {
+        estimate_num_items(self.num_bits_set, self.capacity(), self.num_hashes)
+    }
+
     /// Checks if two filters are compatible for merging.
     ///
     /// Filters are compatible if they have the same:
@@ -333,6 +464,183 @@ impl BloomFilter {
     /// assert!(restored.contains(&"test"));
     /// ```
     pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        let preamble_longs = if self.is_empty() {
+            Family::BLOOMFILTER.min_pre_longs as usize
+        } else {
+            Family::BLOOMFILTER.max_pre_longs as usize
+        };
+        let bit_array_bytes = if self.is_empty() {
+            0
+        } else {
+            self.bit_array.len() * 8
+        };
+        8 * preamble_longs + bit_array_bytes
+    }
+
+    /// Serializes the filter into `buf`, returning the number of bytes written.
+    ///
+    /// This writes the same image as [`serialize`](Self::serialize) without allocating, so a
+    /// buffer can be reused across filters.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `buf` is shorter than [`serialized_size_bytes`].
+    ///
+    /// [`serialized_size_bytes`]: Self::serialized_size_bytes
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::{BloomFilter, BloomFilterBuilder};
+    /// let mut filter = BloomFilterBuilder::with_accuracy(100, 0.01).build();
+    /// filter.insert("test");
+    ///
+    /// let mut buf = vec![0; filter.serialized_size_bytes()];
+    /// let len = filter.serialize_into(&mut buf).unwrap();
+    /// assert_eq!(&buf[..len], filter.serialize().as_slice());
+    /// ```
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Writes the serialized filter to `writer`.
+    ///
+    /// This streams the image [`serialize`](Self::serialize) returns in chunks instead of
+    /// assembling it in memory first.
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::{BloomFilter, BloomFilterBuilder};
+    /// let mut filter = BloomFilterBuilder::with_accuracy(100, 0.01).build();
+    /// filter.insert("test");
+    ///
+    /// let mut stream = Vec::new();
+    /// filter.write_to(&mut stream).unwrap();
+    /// filter.write_to(&mut stream).unwrap();
+    ///
+    /// let mut reader = stream.as_slice();
+    /// let first = BloomFilter::read_from(&mut reader).unwrap();
+    /// let second = BloomFilter::read_from(&mut reader).unwrap();
+    /// assert!(first.contains(&"test") && second.contains(&"test"));
+    /// assert!(reader.is_empty());
+    /// ```
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    /// Serializes the filter in compressed form if that is smaller.
+    ///
+    /// A sparse filter is written as the positions of its set bits, each encoded as the
+    /// variable-length gap to the previous one, which takes a few bytes per set bit instead of
+    /// eight bytes per word of the bit array. A flag in the preamble marks the form, and
+    /// [`deserialize`](Self::deserialize) and [`read_from`](Self::read_from) accept both. Falls
+    /// back to the image of [`serialize`](Self::serialize) when the filter is empty, too full
+    /// to gain from compression, or larger than 512 MiB, the largest bit array a compressed
+    /// image is read with.
+    ///
+    /// The compressed form is specific to this crate: the Java and C++ filters, and
+    /// [`wrap`](Self::wrap), only read the plain form.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::{BloomFilter, BloomFilterBuilder};
+    /// let mut filter = BloomFilterBuilder::with_size(1 << 20, 3).build();
+    /// filter.insert("tenant-42");
+    ///
+    /// let bytes = filter.serialize_compressed();
+    /// assert!(bytes.len() < filter.serialize().len());
+    /// let restored = BloomFilter::deserialize(&bytes).unwrap();
+    /// assert_eq!(restored, filter);
+    /// ```
+    pub fn serialize_compressed(&self) -> Vec<u8> {
+        let plain_size = self.serialized_size_bytes();
+        let (compressed_size, num_positions) = self.compressed_size_bytes();
+        if self.is_empty()
+            || compressed_size >= plain_size
+            || self.bit_array.len() > MAX_UNSTORED_NUM_WORDS
+        {
+            return self.serialize();
+        }
+        let mut bytes = SketchBytes::with_capacity(compressed_size);
+        self.write_compressed_image(&mut bytes, num_positions);
+        bytes.into_bytes()
+    }
+
+    /// Returns the size of the compressed image of a non-empty filter and the number of set bit
+    /// positions it lists.
+    ///
+    /// The count comes from the bit array rather than `num_bits_set`, which a plain image may
+    /// declare inconsistently, so the written image always lists as many positions as it claims.
+    fn compressed_size_bytes(&self) -> (usize, u64) {
+        let mut size = 8 * Family::BLOOMFILTER.max_pre_longs as usize + 8;
+        let mut num_positions = 0;
+        let mut next = 0;
+        for position in self.set_bit_positions() {
+            size += varint_len(position - next);
+            num_positions += 1;
+            next = position + 1;
+        }
+        (size, num_positions)
+    }
+
+    /// Returns the positions of the set bits in increasing order.
+    fn set_bit_positions(&self) -> impl Iterator<Item = u64> + '_ {
+        self.bit_array
+            .iter()
+            .enumerate()
+            .flat_map(|(index, &word)| {
+                let base = index as u64 * 64;
+                let mut remaining = word;
+                std::iter::from_fn(move || {
+                    if remaining == 0 {
+                        return None;
+                    }
+                    let bit = remaining.trailing_zeros() as u64;
+                    remaining &= remaining - 1;
+                    Some(base + bit)
+                })
+            })
+    }
+
+    fn write_compressed_image(&self, bytes: &mut SketchBytes, num_positions: u64) {
+        self.write_preamble(bytes, COMPRESSED_FLAG_MASK);
+        bytes.write_u64_le(num_positions);
+
+        let mut next = 0;
+        for position in self.set_bit_positions() {
+            write_varint(bytes, position - next);
+            next = position + 1;
+        }
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        let is_empty = self.is_empty();
+        self.write_preamble(bytes, if is_empty { EMPTY_FLAG_MASK } else { 0 });
+
+        if !is_empty {
+            bytes.write_u64_le(self.num_bits_set);
+
+            // Bit array
+            for &word in &self.bit_array {
+                bytes.write_u64_le(word);
+            }
+        }
+    }
+
+    fn write_preamble(&self, bytes: &mut SketchBytes, flags: u8) {
         let is_empty = self.is_empty();
         let preamble_longs = if is_empty {
             Family::BLOOMFILTER.min_pre_longs
@@ -340,19 +648,11 @@ impl BloomFilter {
             Family::BLOOMFILTER.max_pre_longs
         };
 
-        let capacity = 8 * preamble_longs as usize
-            + if is_empty {
-                0
-            } else {
-                self.bit_array.len() * 8
-            };
-        let mut bytes = SketchBytes::with_capacity(capacity);
-
         // Preamble
         bytes.write_u8(preamble_longs); // Byte 0
         bytes.write_u8(SERIAL_VERSION); // Byte 1
         bytes.write_u8(Family::BLOOMFILTER.id); // Byte 2
-        bytes.write_u8(if is_empty { EMPTY_FLAG_MASK } else { 0 }); // Byte 3: flags
+        bytes.write_u8(flags); // Byte 3: flags
         bytes.write_u16_le(self.num_hashes); // Bytes 4-5
         bytes.write_u16_le(0); // Bytes 6-7: unused
 
@@ -362,125 +662,135 @@ impl BloomFilter {
         let num_longs = self.bit_array.len() as i32;
         bytes.write_i32_le(num_longs);
         bytes.write_u32_le(0); // unused
-
-        if !is_empty {
-            bytes.write_u64_le(self.num_bits_set);
-
-            // Bit array
-            for &word in &self.bit_array {
-                bytes.write_u64_le(word);
-            }
-        }
-
-        bytes.into_bytes()
     }
 
-    /// Deserializes a filter from bytes.
+    /// Deserializes a filter built with the hashing strategy `hasher`.
+    ///
+    /// The strategy is not part of the serialized image, so it must match the one the filter
+    /// was built with for queries to give meaningful answers.
     ///
     /// # Errors
     ///
-    /// Returns an error if:
-    /// * The data is truncated or corrupted
-    /// * The family ID doesn't match (not a Bloom filter)
-    /// * The serial version is unsupported
+    /// Returns an error under the same conditions as [`BloomFilter::deserialize`].
     ///
     /// # Examples
     ///
     /// ```
-    /// # use datasketches::bloom::{BloomFilter, BloomFilterBuilder};
-    /// let original = BloomFilterBuilder::with_accuracy(100, 0.01).build();
+    /// # use datasketches::bloom::{BloomFilter, BloomFilterBuilder, Murmur3BloomHasher};
+    /// let mut original =
+    ///     BloomFilterBuilder::with_accuracy(100, 0.01).build_with_hasher(Murmur3BloomHasher);
+    /// original.insert("apple");
     /// let bytes = original.serialize();
     ///
-    /// let restored = BloomFilter::deserialize(&bytes).unwrap();
-    /// assert_eq!(original, restored);
+    /// let restored = BloomFilter::deserialize_with_hasher(&bytes, Murmur3BloomHasher).unwrap();
+    /// assert!(restored.contains(&"apple"));
     /// ```
-    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
-        let mut cursor = SketchSlice::new(bytes);
+    pub fn deserialize_with_hasher(bytes: &[u8], hasher: H) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes), hasher)
+    }
 
-        // Read preamble
-        let preamble_longs = cursor
-            .read_u8()
-            .map_err(insufficient_data("preamble_longs"))?;
-        let serial_version = cursor
-            .read_u8()
-            .map_err(insufficient_data("serial_version"))?;
-        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
-
-        // Byte 3: flags byte (directly after family_id)
-        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
-
-        // Validate
-        Family::BLOOMFILTER.validate_id(family_id)?;
-        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
-        ensure_preamble_longs_in_range(
-            Family::BLOOMFILTER.min_pre_longs..=Family::BLOOMFILTER.max_pre_longs,
-            preamble_longs,
-        )?;
-
-        let is_empty = (flags & EMPTY_FLAG_MASK) != 0;
-
-        // Bytes 4-5: num_hashes (u16)
-        let num_hashes = cursor
-            .read_u16_le()
-            .map_err(insufficient_data("num_hashes"))?;
-        if num_hashes == 0 || num_hashes > i16::MAX as u16 {
-            return Err(Error::deserial(format!(
-                "invalid num_hashes: expected [1, {}], got {}",
-                i16::MAX,
-                num_hashes
+    /// Creates a filter over an existing bit array, with a custom hashing strategy.
+    ///
+    /// See [`from_bit_array`](BloomFilter::from_bit_array) for the layout of the words.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the bit array is empty or longer than
+    /// [`BloomFilterBuilder::MAX_NUM_BITS`], or if `num_hashes` is outside
+    /// `[BloomFilterBuilder::MIN_NUM_HASHES, BloomFilterBuilder::MAX_NUM_HASHES]`.
+    pub fn from_bit_array_with_hasher(
+        bit_array: impl Into<Box<[u64]>>,
+        num_hashes: u16,
+        seed: u64,
+        hasher: H,
+    ) -> Result<Self, Error> {
+        let bit_array = bit_array.into();
+        let max_num_words = BloomFilterBuilder::MAX_NUM_BITS / 64;
+        if bit_array.is_empty() || bit_array.len() as u64 > max_num_words {
+            return Err(Error::invalid_argument(format!(
+                "bit array must hold between 1 and {max_num_words} words, got {}",
+                bit_array.len()
             )));
         }
-        // Bytes 6-7: unused (u16)
-        let _unused = cursor
-            .read_u16_le()
-            .map_err(insufficient_data("unused_header"))?;
-        let seed = cursor.read_u64_le().map_err(insufficient_data("seed"))?;
-
-        // Bit array capacity is stored as number of 64-bit words (int32) + unused padding (uint32).
-        let num_longs = cursor
-            .read_i32_le()
-            .map_err(insufficient_data("num_longs"))?;
-        let _unused = cursor.read_u32_le().map_err(insufficient_data("unused"))?;
-
-        if num_longs <= 0 {
-            return Err(Error::deserial(format!(
-                "invalid num_longs: expected at least 1, got {}",
-                num_longs
+        let hash_range = BloomFilterBuilder::MIN_NUM_HASHES..=BloomFilterBuilder::MAX_NUM_HASHES;
+        if !hash_range.contains(&num_hashes) {
+            return Err(Error::invalid_argument(format!(
+                "num_hashes must be between {} and {}, got {num_hashes}",
+                hash_range.start(),
+                hash_range.end()
             )));
         }
 
-        let num_words = num_longs as usize;
-        let mut bit_array = vec![0u64; num_words].into_boxed_slice();
+        let num_bits_set = bit_array.iter().map(|w| w.count_ones() as u64).sum();
+        Ok(BloomFilter {
+            seed,
+            num_hashes,
+            num_bits_set,
+            bit_array,
+            hasher,
+        })
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>, hasher: H) -> Result<Self, Error> {
+        let Preamble {
+            is_empty,
+            is_compressed,
+            num_hashes,
+            seed,
+            num_words,
+        } = read_preamble(&mut cursor)?;
+
+        let bit_array: Box<[u64]>;
         let num_bits_set;
 
-        if is_empty {
+        if is_compressed {
+            num_bits_set = cursor
+                .read_u64_le()
+                .map_err(insufficient_data("num_bits_set"))?;
+            let capacity_bits = num_words as u64 * 64;
+            if num_bits_set > capacity_bits {
+                return Err(Error::deserial(format!(
+                    "invalid num_bits_set: expected <= {capacity_bits}, got {num_bits_set}"
+                )));
+            }
+
+            let mut words = zeroed_words(num_words)?;
+            let mut next = 0u64;
+            for _ in 0..num_bits_set {
+                let position = read_varint(&mut cursor)?
+                    .checked_add(next)
+                    .filter(|&position| position < capacity_bits)
+                    .ok_or_else(|| {
+                        Error::deserial(format!(
+                            "set bit position out of range: expected < {capacity_bits}"
+                        ))
+                    })?;
+                words[(position / 64) as usize] |= 1 << (position % 64);
+                next = position + 1;
+            }
+            bit_array = words.into_boxed_slice();
+        } else if is_empty {
+            bit_array = zeroed_words(num_words)?.into_boxed_slice();
             num_bits_set = 0;
         } else {
             let raw_num_bits_set = cursor
                 .read_u64_le()
                 .map_err(insufficient_data("num_bits_set"))?;
 
-            for word in &mut bit_array {
-                *word = cursor
-                    .read_u64_le()
-                    .map_err(insufficient_data("bit_array"))?;
+            // grow with the input so that a corrupt word count fails before allocating the array
+            let mut words = Vec::with_capacity(cursor.capacity_hint(num_words, 8));
+            for _ in 0..num_words {
+                words.push(
+                    cursor
+                        .read_u64_le()
+                        .map_err(insufficient_data("bit_array"))?,
+                );
             }
+            bit_array = words.into_boxed_slice();
 
-            // Handle "dirty" state: 0xFFFFFFFFFFFFFFFF indicates bits need recounting
-            const DIRTY_BITS_VALUE: u64 = 0xFFFFFFFFFFFFFFFF;
-            if raw_num_bits_set == DIRTY_BITS_VALUE {
-                num_bits_set = bit_array.iter().map(|w| w.count_ones() as u64).sum();
-            } else {
-                let raw_num_words_set = raw_num_bits_set.div_ceil(64) as usize;
-                if raw_num_words_set > num_words {
-                    return Err(Error::deserial(format!(
-                        "invalid num_bits_set: expected <= {}, got {}",
-                        num_words * 64,
-                        raw_num_bits_set
-                    )));
-                }
-                num_bits_set = raw_num_bits_set;
-            }
+            num_bits_set = resolve_num_bits_set(raw_num_bits_set, num_words, || {
+                bit_array.iter().map(|w| w.count_ones() as u64).sum()
+            })?;
         }
 
         Ok(BloomFilter {
@@ -488,26 +798,13 @@ impl BloomFilter {
             num_hashes,
             num_bits_set,
             bit_array,
+            hasher,
         })
     }
 
-    /// Computes the two base hash values using XXHash64.
-    ///
-    /// Uses a two-hash approach:
-    /// * h0 = XXHash64(item, seed)
-    /// * h1 = XXHash64(item, h0)
+    /// Computes the two base hash values for an item under this filter's seed and hasher.
     fn compute_hash<T: Hash>(&self, item: &T) -> (u64, u64) {
-        // First hash with the configured seed
-        let mut hasher = XxHash64::with_seed(self.seed);
-        item.hash(&mut hasher);
-        let h0 = hasher.finish();
-
-        // Second hash using h0 as the seed
-        let mut hasher = XxHash64::with_seed(h0);
-        item.hash(&mut hasher);
-        let h1 = hasher.finish();
-
-        (h0, h1)
+        self.hasher.hash_pair(self.seed, item)
     }
 
     /// Checks if all k bits are set for the given hash values.
@@ -522,24 +819,26 @@ impl BloomFilter {
     }
 
     /// Sets all k bits for the given hash values.
+    ///
+    /// Reports [`SketchEvent::BloomSaturated`] when these bits fill half of the filter.
     fn set_bits(&mut self, h0: u64, h1: u64) {
+        let half = self.capacity() as u64 / 2;
+        let was_saturated = self.num_bits_set >= half;
         for i in 1..=self.num_hashes {
             let bit_index = self.compute_bit_index(h0, h1, i);
             self.set_bit(bit_index);
         }
+        if !was_saturated && self.num_bits_set >= half {
+            notify(SketchEvent::BloomSaturated {
+                capacity: self.capacity(),
+                num_hashes: self.num_hashes,
+            });
+        }
     }
 
-    /// Computes a bit index using double hashing (Kirsch-Mitzenmacher).
-    ///
-    /// Formula:
-    /// ```text
-    /// hash_index = ((h0 + i * h1) >> 1) % capacity_bits
-    /// ```
-    ///
-    /// The right shift by 1 improves bit distribution. The index `i` is 1-based.
+    /// Computes the bit index probed by the `i`-th hash function.
     fn compute_bit_index(&self, h0: u64, h1: u64, i: u16) -> usize {
-        let hash = h0.wrapping_add(u64::from(i).wrapping_mul(h1)) as usize;
-        (hash >> 1) % self.capacity()
+        compute_bit_index(h0, h1, i, self.capacity())
     }
 
     /// Gets the value of a single bit.
@@ -568,10 +867,353 @@ impl BloomFilter {
     }
 }
 
+/// Inserts every item of the iterator through [`BloomFilter::insert_all`].
+impl<H: BloomHasher, T: Hash> Extend<T> for BloomFilter<H> {
+    fn extend<I: IntoIterator<Item = T>>(&mut self, iter: I) {
+        self.insert_all(iter);
+    }
+}
+
+impl BloomFilter {
+    /// Deserializes a filter from bytes.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if:
+    /// * The data is truncated or corrupted
+    /// * The family ID doesn't match (not a Bloom filter)
+    /// * The serial version is unsupported
+    /// * An empty or compressed image declares a bit array larger than 512 MiB; those images do not
+    ///   store the array, so its size is not bounded by the input
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::{BloomFilter, BloomFilterBuilder};
+    /// let original = BloomFilterBuilder::with_accuracy(100, 0.01).build();
+    /// let bytes = original.serialize();
+    ///
+    /// let restored = BloomFilter::deserialize(&bytes).unwrap();
+    /// assert_eq!(original, restored);
+    /// ```
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::deserialize_with_hasher(bytes, XxHashBloomHasher)
+    }
+
+    /// Creates a filter over an existing bit array, such as one exported with
+    /// [`bit_array`](Self::bit_array) or kept by another system as a raw bitset.
+    ///
+    /// Bit `i` of the filter is bit `i % 64` of word `i / 64`, so the capacity is 64 bits per
+    /// word. The filter probes and sets the bits as a filter built with the same `num_hashes`
+    /// and `seed` would, and is compatible with it for unions and intersections.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the bit array is empty or longer than
+    /// [`BloomFilterBuilder::MAX_NUM_BITS`], or if `num_hashes` is outside
+    /// `[BloomFilterBuilder::MIN_NUM_HASHES, BloomFilterBuilder::MAX_NUM_HASHES]`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::{BloomFilter, BloomFilterBuilder};
+    /// let mut original = BloomFilterBuilder::with_accuracy(100, 0.01).build();
+    /// original.insert("apple");
+    ///
+    /// let words = original.bit_array().to_vec();
+    /// let restored =
+    ///     BloomFilter::from_bit_array(words, original.num_hashes(), original.seed()).unwrap();
+    /// assert!(restored.contains(&"apple"));
+    /// assert_eq!(restored, original);
+    /// ```
+    pub fn from_bit_array(
+        bit_array: impl Into<Box<[u64]>>,
+        num_hashes: u16,
+        seed: u64,
+    ) -> Result<Self, Error> {
+        Self::from_bit_array_with_hasher(bit_array, num_hashes, seed, XxHashBloomHasher)
+    }
+
+    /// Reads a filter written by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// Exactly the bytes of one image are consumed, so several filters can be read back from
+    /// the same stream.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader), XxHashBloomHasher)
+    }
+
+    /// Deserializes a filter from bytes, requiring it to have been built with `seed`.
+    ///
+    /// The seed is stored in the serialized image, so [`deserialize`](Self::deserialize)
+    /// always recovers it. Use this variant when the filter is going to be combined with or
+    /// probed alongside filters of a known seed, to reject a mismatched image up front rather
+    /// than panicking later in [`union`](Self::union) or [`intersect`](Self::intersect).
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the image was written with a different seed, or under the same
+    /// conditions as [`deserialize`](Self::deserialize).
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::{BloomFilter, BloomFilterBuilder};
+    /// let filter = BloomFilterBuilder::with_accuracy(100, 0.01).seed(7).build();
+    /// let bytes = filter.serialize();
+    ///
+    /// assert!(BloomFilter::deserialize_with_seed(&bytes, 7).is_ok());
+    /// assert!(BloomFilter::deserialize_with_seed(&bytes, 9001).is_err());
+    /// ```
+    pub fn deserialize_with_seed(bytes: &[u8], seed: u64) -> Result<Self, Error> {
+        let filter = Self::deserialize(bytes)?;
+        if filter.seed != seed {
+            return Err(Error::incompatible_seed(seed, filter.seed));
+        }
+        Ok(filter)
+    }
+
+    /// Wraps a serialized filter for read-only querying without copying its bit array.
+    ///
+    /// Call [`BloomFilterWrapper::heapify`] on the result to get a mutable copy.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize).
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::bloom::{BloomFilter, BloomFilterBuilder};
+    /// let mut filter = BloomFilterBuilder::with_accuracy(100, 0.01).build();
+    /// filter.insert(42_u64);
+    /// let bytes = filter.serialize();
+    ///
+    /// let wrapped = BloomFilter::wrap(&bytes).unwrap();
+    /// assert!(wrapped.contains(&42_u64));
+    /// assert_eq!(wrapped.heapify(), filter);
+    /// ```
+    pub fn wrap(bytes: &[u8]) -> Result<BloomFilterWrapper<'_>, Error> {
+        BloomFilterWrapper::new(bytes)
+    }
+}
+
+/// The fixed part of a serialized filter, shared by [`BloomFilter::deserialize`] and
+/// [`BloomFilterWrapper`].
+pub(super) struct Preamble {
+    pub(super) is_empty: bool,
+    pub(super) is_compressed: bool,
+    pub(super) num_hashes: u16,
+    pub(super) seed: u64,
+    pub(super) num_words: usize,
+}
+
+/// Reads and validates the preamble, leaving the cursor at the bit count of a non-empty image.
+pub(super) fn read_preamble(cursor: &mut SketchSlice) -> Result<Preamble, Error> {
+    let preamble_longs = cursor
+        .read_u8()
+        .map_err(insufficient_data("preamble_longs"))?;
+    let serial_version = cursor
+        .read_u8()
+        .map_err(insufficient_data("serial_version"))?;
+    let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+
+    // Byte 3: flags byte (directly after family_id)
+    let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+
+    // Validate
+    Family::BLOOMFILTER.validate_id(family_id)?;
+    ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+    ensure_preamble_longs_in_range(
+        Family::BLOOMFILTER.min_pre_longs..=Family::BLOOMFILTER.max_pre_longs,
+        preamble_longs,
+    )?;
+
+    let is_empty = (flags & EMPTY_FLAG_MASK) != 0;
+    let is_compressed = (flags & COMPRESSED_FLAG_MASK) != 0;
+    if is_empty && is_compressed {
+        return Err(Error::deserial("empty filter marked as compressed"));
+    }
+
+    // Bytes 4-5: num_hashes (u16)
+    let num_hashes = cursor
+        .read_u16_le()
+        .map_err(insufficient_data("num_hashes"))?;
+    if num_hashes == 0 || num_hashes > i16::MAX as u16 {
+        return Err(Error::deserial(format!(
+            "invalid num_hashes: expected [1, {}], got {}",
+            i16::MAX,
+            num_hashes
+        )));
+    }
+    // Bytes 6-7: unused (u16)
+    let _unused = cursor
+        .read_u16_le()
+        .map_err(insufficient_data("unused_header"))?;
+    let seed = cursor.read_u64_le().map_err(insufficient_data("seed"))?;
+
+    // Bit array capacity is stored as number of 64-bit words (int32) + unused padding (uint32).
+    let num_longs = cursor
+        .read_i32_le()
+        .map_err(insufficient_data("num_longs"))?;
+    let _unused = cursor.read_u32_le().map_err(insufficient_data("unused"))?;
+
+    if num_longs <= 0 {
+        return Err(Error::deserial(format!(
+            "invalid num_longs: expected at least 1, got {}",
+            num_longs
+        )));
+    }
+
+    Ok(Preamble {
+        is_empty,
+        is_compressed,
+        num_hashes,
+        seed,
+        num_words: num_longs as usize,
+    })
+}
+
+/// Returns the number of bytes [`write_varint`] takes for `value`.
+fn varint_len(value: u64) -> usize {
+    (64 - (value | 1).leading_zeros() as usize).div_ceil(7)
+}
+
+/// Writes `value` in LEB128 form: seven bits per byte, least significant first, with the high
+/// bit set on every byte but the last.
+fn write_varint(bytes: &mut SketchBytes, mut value: u64) {
+    while value >= 0x80 {
+        bytes.write_u8((value as u8) | 0x80);
+        value >>= 7;
+    }
+    bytes.write_u8(value as u8);
+}
+
+fn read_varint(cursor: &mut SketchSlice<'_>) -> Result<u64, Error> {
+    let mut value = 0u64;
+    for shift in (0..64).step_by(7) {
+        let byte = cursor
+            .read_u8()
+            .map_err(insufficient_data("set bit position"))?;
+        value |= u64::from(byte & 0x7f) << shift;
+        if byte & 0x80 == 0 {
+            return Ok(value);
+        }
+    }
+    Err(Error::deserial(
+        "set bit position varint longer than 64 bits",
+    ))
+}
+
+/// Largest bit array, in words, that an empty or compressed image may declare: 512 MiB.
+///
+/// These images do not store the array, so a few bytes could otherwise claim gigabytes of it.
+/// Plain images store every word, which bounds their array by the input instead.
+const MAX_UNSTORED_NUM_WORDS: usize = 1 << 26;
+
+/// Rejects an empty or compressed image declaring more than [`MAX_UNSTORED_NUM_WORDS`].
+pub(super) fn ensure_unstored_num_words(num_words: usize) -> Result<(), Error> {
+    if num_words > MAX_UNSTORED_NUM_WORDS {
+        return Err(Error::deserial(format!(
+            "invalid num_longs: an image without its bit array holds at most \
+             {MAX_UNSTORED_NUM_WORDS} words, got {num_words}"
+        )));
+    }
+    Ok(())
+}
+
+/// Allocates the zeroed bit array of an empty or compressed image, failing on a count past
+/// [`MAX_UNSTORED_NUM_WORDS`] or an allocation the system refuses.
+fn zeroed_words(num_words: usize) -> Result<Vec<u64>, Error> {
+    ensure_unstored_num_words(num_words)?;
+    let mut words = Vec::new();
+    words.try_reserve_exact(num_words).map_err(|_| {
+        Error::deserial(format!("cannot allocate a bit array of {num_words} words"))
+    })?;
+    words.resize(num_words, 0);
+    Ok(words)
+}
+
+/// Validates the serialized bit count, recounting the bits when the image marks it as dirty.
+pub(super) fn resolve_num_bits_set(
+    raw_num_bits_set: u64,
+    num_words: usize,
+    count_bits: impl FnOnce() -> u64,
+) -> Result<u64, Error> {
+    // Handle "dirty" state: 0xFFFFFFFFFFFFFFFF indicates bits need recounting
+    const DIRTY_BITS_VALUE: u64 = 0xFFFFFFFFFFFFFFFF;
+    if raw_num_bits_set == DIRTY_BITS_VALUE {
+        return Ok(count_bits());
+    }
+
+    let raw_num_words_set = raw_num_bits_set.div_ceil(64) as usize;
+    if raw_num_words_set > num_words {
+        return Err(Error::deserial(format!(
+            "invalid num_bits_set: expected <= {}, got {}",
+            num_words * 64,
+            raw_num_bits_set
+        )));
+    }
+    Ok(raw_num_bits_set)
+}
+
+/// Estimates the number of distinct items from the number of bits set.
+pub(super) fn estimate_num_items(num_bits_set: u64, capacity_bits: usize, num_hashes: u16) -> f64 {
+    let m = capacity_bits as f64;
+    let k = num_hashes as f64;
+    -(m / k) * (-(num_bits_set as f64) / m).ln_1p()
+}
+
+/// Computes the two base hash values using XXHash64.
+///
+/// Uses a two-hash approach:
+/// * h0 = XXHash64(item, seed)
+/// * h1 = XXHash64(item, h0)
+pub(super) fn compute_hash<T: Hash + ?Sized>(seed: u64, item: &T) -> (u64, u64) {
+    // First hash with the configured seed
+    let mut hasher = XxHash64::with_seed(seed);
+    item.hash(&mut hasher);
+    let h0 = hasher.finish();
+
+    // Second hash using h0 as the seed
+    let mut hasher = XxHash64::with_seed(h0);
+    item.hash(&mut hasher);
+    let h1 = hasher.finish();
+
+    (h0, h1)
+}
+
+/// Computes a bit index using double hashing (Kirsch-Mitzenmacher).
+///
+/// Formula:
+/// ```text
+/// hash_index = ((h0 + i * h1) >> 1) % capacity_bits
+/// ```
+///
+/// The right shift by 1 improves bit distribution. The index `i` is 1-based.
+pub(super) fn compute_bit_index(h0: u64, h1: u64, i: u16, capacity_bits: usize) -> usize {
+    let hash = h0.wrapping_add(u64::from(i).wrapping_mul(h1)) as usize;
+    (hash >> 1) % capacity_bits
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(BloomFilter);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(BloomFilter);
+impl_fingerprint_via_image!(BloomFilter);
+
 #[cfg(test)]
 mod tests {
     use super::BloomFilter;
+    use super::compute_bit_index;
+    use super::compute_hash;
     use crate::bloom::BloomFilterBuilder;
+    use crate::error::ErrorKind;
+    use crate::error::SketchError;
 
     #[test]
     fn test_builder_with_accuracy() {
@@ -616,6 +1258,22 @@ mod tests {
         assert!(was_present);
     }
 
+    #[test]
+    fn test_insert_all() {
+        let mut batched = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+        let mut single = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+
+        // Not a multiple of the batch size, to cover the trailing partial batch.
+        batched.insert_all(0..1003_u64);
+        for i in 0..1003_u64 {
+            single.insert(i);
+        }
+        assert_eq!(batched, single);
+
+        batched.insert_all(std::iter::empty::<u64>());
+        assert_eq!(batched, single);
+    }
+
     #[test]
     fn test_reset() {
         let mut filter = BloomFilterBuilder::with_accuracy(100, 0.01).build();
@@ -685,6 +1343,27 @@ mod tests {
         assert!(restored.contains(&42_u64));
     }
 
+    #[test]
+    fn test_deserialize_with_seed() {
+        let mut filter = BloomFilterBuilder::with_accuracy(100, 0.01).seed(7).build();
+        filter.insert("test");
+        let bytes = filter.serialize();
+
+        assert_eq!(
+            BloomFilter::deserialize_with_seed(&bytes, 7).unwrap(),
+            filter
+        );
+        let err = BloomFilter::deserialize_with_seed(&bytes, 8).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidData);
+        assert_eq!(
+            err.sketch_error(),
+            Some(&SketchError::IncompatibleSeed {
+                expected: 8,
+                actual: 7
+            })
+        );
+    }
+
     #[test]
     fn test_statistics() {
         let mut filter = BloomFilterBuilder::with_size(1000, 5).build();
@@ -697,6 +1376,25 @@ mod tests {
         assert!(filter.estimated_fpp() > 0.0);
     }
 
+    #[test]
+    fn test_estimated_num_items() {
+        let mut filter = BloomFilterBuilder::with_accuracy(10_000, 0.01).build();
+        assert_eq!(filter.estimated_num_items(), 0.0);
+
+        for i in 0..5000_u64 {
+            filter.insert(i);
+        }
+        let estimate = filter.estimated_num_items();
+        assert!((estimate - 5000.0).abs() < 5000.0 * 0.03, "{estimate}");
+
+        let mut filter = BloomFilterBuilder::with_size(64, 1).build();
+        for i in 0..2000_u64 {
+            filter.insert(i);
+        }
+        assert_eq!(filter.load_factor(), 1.0);
+        assert_eq!(filter.estimated_num_items(), f64::INFINITY);
+    }
+
     #[test]
     fn test_is_compatible() {
         let f1 = BloomFilterBuilder::with_accuracy(100, 0.01)
@@ -713,6 +1411,59 @@ mod tests {
         assert!(!f1.is_compatible(&f3));
     }
 
+    #[test]
+    fn test_bit_array_round_trip() {
+        let mut original = BloomFilterBuilder::with_size(1000, 5).seed(7).build();
+        for i in 0..100_u64 {
+            original.insert(i);
+        }
+        assert_eq!(original.bit_array().len(), 16);
+
+        let restored = BloomFilter::from_bit_array(
+            original.bit_array().to_vec(),
+            original.num_hashes(),
+            original.seed(),
+        )
+        .unwrap();
+        assert_eq!(restored, original);
+        assert_eq!(restored.bits_used(), original.bits_used());
+        assert!(restored.is_compatible(&original));
+        for i in 0..100_u64 {
+            assert!(restored.contains(&i));
+        }
+    }
+
+    #[test]
+    fn test_bit_array_layout() {
+        let mut words = vec![0u64; 2];
+        let filter = BloomFilter::from_bit_array(words.clone(), 1, 0).unwrap();
+        assert!(filter.is_empty());
+        assert_eq!(filter.capacity(), 128);
+
+        // with one hash function, an item sets exactly the bit it probes
+        let (h0, h1) = compute_hash(0, &"apple");
+        let bit = compute_bit_index(h0, h1, 1, 128);
+        words[bit / 64] |= 1 << (bit % 64);
+        let filter = BloomFilter::from_bit_array(words.clone(), 1, 0).unwrap();
+        assert_eq!(filter.bits_used(), 1);
+        assert!(filter.contains(&"apple"));
+
+        let mut inserted = BloomFilter::from_bit_array(vec![0u64; 2], 1, 0).unwrap();
+        inserted.insert("apple");
+        assert_eq!(inserted.bit_array(), &words[..]);
+    }
+
+    #[test]
+    fn test_from_bit_array_invalid() {
+        let err = BloomFilter::from_bit_array(vec![], 3, 0).unwrap_err();
+        assert!(err.message().contains("bit array must hold"), "{err}");
+        let err = BloomFilter::from_bit_array(vec![0u64; 4], 0, 0).unwrap_err();
+        assert!(
+            err.message().contains("num_hashes must be between"),
+            "{err}"
+        );
+    }
+
     #[test]
     #[should_panic(expected = "max_items must be greater than 0")]
     fn test_invalid_max_items() {
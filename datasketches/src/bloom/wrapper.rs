@@ -0,0 +1,212 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! A read-only view over a serialized Bloom filter
+//!
+//! [`BloomFilterWrapper`] validates the preamble of a serialized filter and answers membership
+//! queries by reading bit words straight out of the borrowed bytes.
+
+use std::hash::Hash;
+
+use crate::bloom::BloomFilter;
+use crate::bloom::XxHashBloomHasher;
+use crate::bloom::sketch::Preamble;
+use crate::bloom::sketch::compute_bit_index;
+use crate::bloom::sketch::compute_hash;
+use crate::bloom::sketch::ensure_unstored_num_words;
+use crate::bloom::sketch::estimate_num_items;
+use crate::bloom::sketch::read_preamble;
+use crate::bloom::sketch::resolve_num_bits_set;
+use crate::codec::SketchSlice;
+use crate::codec::assert::insufficient_data;
+use crate::error::Error;
+
+/// A read-only view of a serialized [`BloomFilter`].
+///
+/// The wrapper borrows the image and never copies the bit array, so a query-only service can
+/// probe a very large filter without first materializing it on the heap. Use
+/// [`heapify`](Self::heapify) to obtain an owned, mutable copy. Queries hash items with the
+/// default [`XxHashBloomHasher`].
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::bloom::BloomFilter;
+/// # use datasketches::bloom::BloomFilterBuilder;
+/// let mut filter = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+/// filter.insert("apple");
+/// let bytes = filter.serialize();
+///
+/// let wrapped = BloomFilter::wrap(&bytes).unwrap();
+/// assert!(wrapped.contains(&"apple"));
+///
+/// let mut heapified = wrapped.heapify();
+/// heapified.insert("banana");
+/// assert!(heapified.contains(&"banana"));
+/// ```
+#[derive(Debug, Clone, Copy)]
+pub struct BloomFilterWrapper<'a> {
+    seed: u64,
+    num_hashes: u16,
+    num_bits_set: u64,
+    num_words: usize,
+    /// Little-endian bit words; empty when the image is of an empty filter
+    words: &'a [u8],
+}
+
+impl<'a> BloomFilterWrapper<'a> {
+    /// Wraps a serialized filter without copying its bit array.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if:
+    /// * The data is truncated or corrupted
+    /// * The family ID doesn't match (not a Bloom filter)
+    /// * The serial version is unsupported
+    /// * The image was written by
+    ///   [`BloomFilter::serialize_compressed`](crate::bloom::BloomFilter::serialize_compressed)
+    pub fn new(bytes: &'a [u8]) -> Result<Self, Error> {
+        let mut cursor = SketchSlice::new(bytes);
+        let Preamble {
+            is_empty,
+            is_compressed,
+            num_hashes,
+            seed,
+            num_words,
+        } = read_preamble(&mut cursor)?;
+
+        if is_compressed {
+            return Err(Error::deserial(
+                "a compressed filter has no bit array to wrap; deserialize it instead",
+            ));
+        }
+
+        if is_empty {
+            // heapify allocates the array, so bound it as deserializing does
+            ensure_unstored_num_words(num_words)?;
+            return Ok(BloomFilterWrapper {
+                seed,
+                num_hashes,
+                num_bits_set: 0,
+                num_words,
+                words: &[],
+            });
+        }
+
+        let raw_num_bits_set = cursor
+            .read_u64_le()
+            .map_err(insufficient_data("num_bits_set"))?;
+        let offset = bytes.len() - cursor.remaining().len();
+        let words = bytes
+            .get(offset..offset + num_words * 8)
+            .ok_or_else(|| Error::insufficient_data("bit_array"))?;
+        let num_bits_set = resolve_num_bits_set(raw_num_bits_set, num_words, || {
+            words
+                .chunks_exact(8)
+                .map(|w| u64::from_le_bytes(w.try_into().unwrap()).count_ones() as u64)
+                .sum()
+        })?;
+
+        Ok(BloomFilterWrapper {
+            seed,
+            num_hashes,
+            num_bits_set,
+            num_words,
+            words,
+        })
+    }
+
+    /// Tests whether an item is possibly in the wrapped filter.
+    ///
+    /// See [`BloomFilter::contains`].
+    pub fn contains<T: Hash>(&self, item: &T) -> bool {
+        if self.is_empty() {
+            return false;
+        }
+
+        let (h0, h1) = compute_hash(self.seed, item);
+        (1..=self.num_hashes).all(|i| {
+            let bit_index = compute_bit_index(h0, h1, i, self.capacity());
+            self.get_bit(bit_index)
+        })
+    }
+
+    /// Returns whether the wrapped filter is empty (no items inserted).
+    pub fn is_empty(&self) -> bool {
+        self.num_bits_set == 0
+    }
+
+    /// Returns the number of bits set to 1.
+    pub fn bits_used(&self) -> u64 {
+        self.num_bits_set
+    }
+
+    /// Returns the total number of bits in the filter (capacity).
+    pub fn capacity(&self) -> usize {
+        self.num_words * 64
+    }
+
+    /// Returns the number of hash functions used.
+    pub fn num_hashes(&self) -> u16 {
+        self.num_hashes
+    }
+
+    /// Returns the hash seed.
+    pub fn seed(&self) -> u64 {
+        self.seed
+    }
+
+    /// Returns the current load factor (fraction of bits set).
+    pub fn load_factor(&self) -> f64 {
+        self.num_bits_set as f64 / self.capacity() as f64
+    }
+
+    /// Estimates the current false positive probability.
+    ///
+    /// See [`BloomFilter::estimated_fpp`].
+    pub fn estimated_fpp(&self) -> f64 {
+        self.load_factor().powf(self.num_hashes as f64)
+    }
+
+    /// Estimates the number of distinct items inserted into the filter.
+    ///
+    /// See [`BloomFilter::estimated_num_items`].
+    pub fn estimated_num_items(&self) -> f64 {
+        estimate_num_items(self.num_bits_set, self.capacity(), self.num_hashes)
+    }
+
+    /// Copies the wrapped image into an owned, updatable [`BloomFilter`].
+    pub fn heapify(&self) -> BloomFilter {
+        let mut bit_array = vec![0u64; self.num_words].into_boxed_slice();
+        for (word, chunk) in bit_array.iter_mut().zip(self.words.chunks_exact(8)) {
+            *word = u64::from_le_bytes(chunk.try_into().unwrap());
+        }
+
+        BloomFilter {
+            seed: self.seed,
+            num_hashes: self.num_hashes,
+            num_bits_set: self.num_bits_set,
+            bit_array,
+            hasher: XxHashBloomHasher,
+        }
+    }
+
+    fn get_bit(&self, bit_index: usize) -> bool {
+        let byte = self.words[bit_index >> 3];
+        (byte >> (bit_index & 7)) & 1 != 0
+    }
+}
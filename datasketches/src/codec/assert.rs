@@ -19,18 +19,41 @@ use std::collections::Bound;
 use std::ops::RangeBounds;
 
 use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::error::SketchError;
 
 pub(crate) fn insufficient_data(tag: &'static str) -> impl FnOnce(std::io::Error) -> Error {
-    move |_| Error::insufficient_data(tag)
+    move |_| Error::unexpected_end(tag)
 }
 
 pub(crate) fn ensure_serial_version_is(expected: u8, actual: u8) -> Result<(), Error> {
     if expected == actual {
         Ok(())
     } else {
-        Err(Error::deserial(format!(
-            "unsupported serial version: expected {expected}, got {actual}"
-        )))
+        Err(Error::unsupported_serial_version(expected, actual))
+    }
+}
+
+pub(crate) fn ensure_seed_hash_is(expected: u16, actual: u16) -> Result<(), Error> {
+    if expected == actual {
+        Ok(())
+    } else {
+        Err(Error::incompatible_seed_hash(
+            ErrorKind::InvalidData,
+            expected,
+            actual,
+        ))
+    }
+}
+
+pub(crate) fn ensure_lg_k_in(min: u8, max: u8, lg_k: u8) -> Result<(), Error> {
+    if (min..=max).contains(&lg_k) {
+        Ok(())
+    } else {
+        Err(Error::from_reason(
+            ErrorKind::InvalidData,
+            SketchError::LgKOutOfRange { lg_k, min, max },
+        ))
     }
 }
 
@@ -51,19 +74,21 @@ pub(crate) fn ensure_preamble_longs_in_range(
     if expected.contains(&actual) {
         Ok(())
     } else {
-        Err(Error::deserial(format!(
-            "invalid preamble longs: expected {}, got {actual}",
-            match (start, end) {
-                (Bound::Included(a), Bound::Included(b)) => format!("[{a}, {b}]"),
-                (Bound::Included(a), Bound::Excluded(b)) => format!("[{a}, {b})"),
-                (Bound::Excluded(a), Bound::Included(b)) => format!("({a}, {b}]"),
-                (Bound::Excluded(a), Bound::Excluded(b)) => format!("({a}, {b})"),
-                (Bound::Unbounded, Bound::Included(b)) => format!("at most {b}"),
-                (Bound::Unbounded, Bound::Excluded(b)) => format!("less than {b}"),
-                (Bound::Included(a), Bound::Unbounded) => format!("at least {a}"),
-                (Bound::Excluded(a), Bound::Unbounded) => format!("greater than {a}"),
-                (Bound::Unbounded, Bound::Unbounded) => unreachable!("unbounded range"),
-            }
-        )))
+        let expected = match (start, end) {
+            (Bound::Included(a), Bound::Included(b)) => format!("[{a}, {b}]"),
+            (Bound::Included(a), Bound::Excluded(b)) => format!("[{a}, {b})"),
+            (Bound::Excluded(a), Bound::Included(b)) => format!("({a}, {b}]"),
+            (Bound::Excluded(a), Bound::Excluded(b)) => format!("({a}, {b})"),
+            (Bound::Unbounded, Bound::Included(b)) => format!("at most {b}"),
+            (Bound::Unbounded, Bound::Excluded(b)) => format!("less than {b}"),
+            (Bound::Included(a), Bound::Unbounded) => format!("at least {a}"),
+            (Bound::Excluded(a), Bound::Unbounded) => format!("greater than {a}"),
+            (Bound::Unbounded, Bound::Unbounded) => unreachable!("unbounded range"),
+        };
+        Err(Error::from_reason(
+            ErrorKind::InvalidData,
+            SketchError::InvalidPreamble { actual },
+        )
+        .with_context("expected", expected))
     }
 }
@@ -0,0 +1,90 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Base64 text form of sketches, for storing them in text columns and passing them to and from
+//! database UDFs.
+//!
+//! The text is the standard, padded base64 alphabet of RFC 4648 over the same image as the
+//! sketch's `serialize` method, which is also how the DataSketches PostgreSQL extension prints
+//! sketches.
+
+use ::base64::Engine;
+use ::base64::engine::general_purpose::STANDARD;
+
+use crate::error::Error;
+
+/// Encodes a byte image as base64 text.
+pub(crate) fn encode(image: &[u8]) -> String {
+    STANDARD.encode(image)
+}
+
+/// Decodes base64 text and decodes the resulting image with `decode`.
+///
+/// Surrounding whitespace, such as a trailing newline, is ignored.
+pub(crate) fn decode<T>(
+    text: &str,
+    decode: impl FnOnce(&[u8]) -> Result<T, Error>,
+) -> Result<T, Error> {
+    let image = STANDARD
+        .decode(text.trim())
+        .map_err(|err| Error::deserial(format!("invalid base64 sketch image: {err}")))?;
+    decode(&image)
+}
+
+/// Implements `to_base64` and `from_base64` for a sketch type through its byte image.
+///
+/// The arguments follow [`impl_serde_via_image`](crate::codec::serde): by default the image is
+/// produced by the inherent `serialize(&self)` and decoded by the inherent `deserialize(&[u8])`,
+/// and generic parameters and their bounds go in the leading brackets.
+macro_rules! impl_base64_via_image {
+    ([$($generics:tt)*] $ty:ty, |$s:ident| $encode:expr, |$b:ident| $decode:expr) => {
+        impl<$($generics)*> $ty {
+            /// Serializes this sketch as base64 text.
+            ///
+            /// The text encodes the same image as `serialize`, using the standard, padded
+            /// base64 alphabet.
+            pub fn to_base64(&self) -> String {
+                let $s = self;
+                $crate::codec::base64::encode(&$encode)
+            }
+
+            /// Deserializes a sketch from base64 text written by `to_base64` or by another
+            /// DataSketches implementation.
+            ///
+            /// Surrounding whitespace is ignored.
+            ///
+            /// # Errors
+            ///
+            /// Returns an error if the text is not valid base64 or does not hold a valid image.
+            pub fn from_base64(text: &str) -> Result<Self, $crate::error::Error> {
+                $crate::codec::base64::decode(text, |$b| $decode)
+            }
+        }
+    };
+    ([$($generics:tt)*] $ty:ty) => {
+        impl_base64_via_image!(
+            [$($generics)*] $ty,
+            |s| s.serialize(),
+            |b| <$ty>::deserialize(b)
+        );
+    };
+    ($ty:ty) => {
+        impl_base64_via_image!([] $ty);
+    };
+}
+
+pub(crate) use impl_base64_via_image;
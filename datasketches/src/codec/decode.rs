@@ -20,37 +20,112 @@ use std::io::Cursor;
 use std::io::Read;
 
 /// A wrapper around a byte slice that provides methods for reading various types of data from it.
+///
+/// While streaming a sketch in, the bytes come from a reader instead, which is read no further
+/// than the image itself.
 pub struct SketchSlice<'a> {
-    slice: Cursor<&'a [u8]>,
+    source: Source<'a>,
+}
+
+enum Source<'a> {
+    Slice(Cursor<&'a [u8]>),
+    Reader(&'a mut dyn Read),
+}
+
+/// Upper bound on the bytes preallocated from a length read off a stream, whose actual size is
+/// unknown until the items arrive.
+const READER_PREALLOCATION_LIMIT: usize = 1 << 16;
+
+impl<'a> SketchSlice<'a> {
+    /// Creates a new `SketchSlice` reading from the given reader.
+    #[allow(dead_code)] // unused when no sketch feature is enabled
+    pub(crate) fn from_reader(reader: &'a mut dyn Read) -> SketchSlice<'a> {
+        SketchSlice {
+            source: Source::Reader(reader),
+        }
+    }
 }
 
 impl SketchSlice<'_> {
     /// Creates a new `SketchSlice` from the given byte slice.
     pub fn new(slice: &[u8]) -> SketchSlice<'_> {
         SketchSlice {
-            slice: Cursor::new(slice),
+            source: Source::Slice(Cursor::new(slice)),
         }
     }
 
     /// Advances the position of the slice by `n` bytes.
+    ///
+    /// Advancing past the end is not an error by itself; the next read fails instead.
     pub fn advance(&mut self, n: u64) {
-        let pos = self.slice.position();
-        self.slice.set_position(pos + n);
+        match &mut self.source {
+            Source::Slice(slice) => {
+                let pos = slice.position();
+                slice.set_position(pos + n);
+            }
+            Source::Reader(reader) => {
+                let _ = io::copy(&mut reader.take(n), &mut io::sink());
+            }
+        }
     }
 
     /// Returns the not-yet-read portion of the underlying slice.
     ///
     /// Useful for handing the remaining bytes to a variable-length decoder that reports how many
-    /// bytes it consumed; pair it with [`advance`](Self::advance).
+    /// bytes it consumed; pair it with [`advance`](Self::advance). Bytes that have not yet been
+    /// read from a reader are unknown, so this is empty while streaming.
     pub fn remaining(&self) -> &[u8] {
-        let buf = self.slice.get_ref();
-        let pos = (self.slice.position() as usize).min(buf.len());
-        &buf[pos..]
+        match &self.source {
+            Source::Slice(slice) => {
+                let buf = slice.get_ref();
+                let pos = (slice.position() as usize).min(buf.len());
+                &buf[pos..]
+            }
+            Source::Reader(_) => &[],
+        }
+    }
+
+    /// Returns how many of `count` items of at least `item_size` bytes each are worth
+    /// preallocating, so that a corrupt count cannot trigger a huge allocation.
+    #[allow(dead_code)] // only some sketches preallocate from a serialized count
+    pub(crate) fn capacity_hint(&self, count: usize, item_size: usize) -> usize {
+        let available = match &self.source {
+            Source::Slice(_) => self.remaining().len(),
+            Source::Reader(_) => READER_PREALLOCATION_LIMIT,
+        };
+        count.min(available / item_size)
     }
 
     /// Reads exactly `buf.len()` bytes from the slice into `buf`.
     pub fn read_exact(&mut self, buf: &mut [u8]) -> io::Result<()> {
-        self.slice.read_exact(buf)
+        match &mut self.source {
+            Source::Slice(slice) => slice.read_exact(buf),
+            Source::Reader(reader) => reader.read_exact(buf),
+        }
+    }
+
+    /// Reads exactly `len` bytes into a new vector.
+    ///
+    /// Unlike allocating `len` bytes up front, a corrupt length fails with `UnexpectedEof` once
+    /// the input runs out instead of attempting a huge allocation.
+    #[allow(dead_code)] // only variable-length items read raw byte runs
+    pub(crate) fn read_bytes(&mut self, len: usize) -> io::Result<Vec<u8>> {
+        if let Source::Reader(reader) = &mut self.source {
+            let mut buf = Vec::with_capacity(len.min(READER_PREALLOCATION_LIMIT));
+            reader.take(len as u64).read_to_end(&mut buf)?;
+            if buf.len() < len {
+                return Err(io::ErrorKind::UnexpectedEof.into());
+            }
+            return Ok(buf);
+        }
+
+        let remaining = self.remaining();
+        if remaining.len() < len {
+            return Err(io::ErrorKind::UnexpectedEof.into());
+        }
+        let buf = remaining[..len].to_vec();
+        self.advance(len as u64);
+        Ok(buf)
     }
 
     /// Reads a single byte from the slice and returns it as a `u8`.
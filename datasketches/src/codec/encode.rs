@@ -15,37 +15,172 @@
 // specific language governing permissions and limitations
 // under the License.
 
-/// A simple wrapper around a `Vec<u8>` that provides methods for writing various types of data.
-pub struct SketchBytes {
-    bytes: Vec<u8>,
+use std::io;
+use std::io::Write;
+
+use crate::error::Error;
+use crate::error::ErrorKind;
+
+/// A simple wrapper around a byte buffer that provides methods for writing various types of data.
+///
+/// The buffer is either a growable `Vec<u8>`, a borrowed `&mut [u8]` while serializing into a
+/// caller-provided slice, or a writer that receives the image in chunks while streaming.
+pub struct SketchBytes<'a> {
+    buf: Buf<'a>,
 }
 
-impl SketchBytes {
+enum Buf<'a> {
+    Owned(Vec<u8>),
+    /// Writes past the end of `buf` are dropped but still counted in `len`, so that the
+    /// required size can be reported.
+    Borrowed {
+        buf: &'a mut [u8],
+        len: usize,
+    },
+    /// Writes are staged in `chunk` and handed to `writer` once it fills up. After the first
+    /// failed write, the remaining image is only counted.
+    Writer {
+        writer: &'a mut dyn Write,
+        chunk: Vec<u8>,
+        len: usize,
+        error: Option<io::Error>,
+    },
+}
+
+/// Number of bytes staged before they are handed to a writer.
+const WRITER_CHUNK_SIZE: usize = 8192;
+
+impl SketchBytes<'static> {
     /// Constructs an empty `SketchBytes` with at least the specified capacity.
     pub fn with_capacity(capacity: usize) -> Self {
         Self {
-            bytes: Vec::with_capacity(capacity),
+            buf: Buf::Owned(Vec::with_capacity(capacity)),
         }
     }
+}
 
-    /// Consumes the `SketchBytes` and returns the underlying `Vec<u8>`.
+impl<'a> SketchBytes<'a> {
+    /// Runs serializer `f` against `buf`, returning the number of bytes written.
+    ///
+    /// Returns an error if `buf` is smaller than the image, leaving its contents unspecified.
+    #[allow(dead_code)] // unused when no sketch feature is enabled
+    pub(crate) fn write_into(
+        buf: &'a mut [u8],
+        f: impl FnOnce(&mut SketchBytes<'a>),
+    ) -> Result<usize, Error> {
+        let capacity = buf.len();
+        let mut bytes = SketchBytes {
+            buf: Buf::Borrowed { buf, len: 0 },
+        };
+        f(&mut bytes);
+        let len = bytes.len();
+        if len > capacity {
+            return Err(Error::insufficient_buffer(
+                ErrorKind::InvalidArgument,
+                len,
+                capacity,
+            ));
+        }
+        Ok(len)
+    }
+
+    /// Runs serializer `f` against `writer`, streaming the image in chunks.
+    #[allow(dead_code)] // unused when no sketch feature is enabled
+    pub(crate) fn write_to(
+        writer: &'a mut dyn Write,
+        f: impl FnOnce(&mut SketchBytes<'a>),
+    ) -> io::Result<()> {
+        let mut bytes = SketchBytes {
+            buf: Buf::Writer {
+                writer,
+                chunk: Vec::with_capacity(WRITER_CHUNK_SIZE),
+                len: 0,
+                error: None,
+            },
+        };
+        f(&mut bytes);
+        match bytes.buf {
+            Buf::Writer {
+                writer,
+                chunk,
+                error: None,
+                ..
+            } => writer.write_all(&chunk),
+            Buf::Writer {
+                error: Some(err), ..
+            } => Err(err),
+            _ => unreachable!("buffer was constructed as a writer"),
+        }
+    }
+
+    /// Returns the number of bytes written so far.
+    pub fn len(&self) -> usize {
+        match &self.buf {
+            Buf::Owned(vec) => vec.len(),
+            Buf::Borrowed { len, .. } | Buf::Writer { len, .. } => *len,
+        }
+    }
+
+    /// Returns `true` if nothing has been written yet.
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+
+    /// Consumes the `SketchBytes` and returns the written bytes.
     pub fn into_bytes(self) -> Vec<u8> {
-        self.bytes
+        match self.buf {
+            Buf::Owned(vec) => vec,
+            Buf::Borrowed { buf, len } => buf[..len.min(buf.len())].to_vec(),
+            Buf::Writer { .. } => unreachable!("streamed bytes are not retained"),
+        }
     }
 
     /// Writes the given byte slice to the `SketchBytes`.
-    pub fn write(&mut self, buf: &[u8]) {
-        self.bytes.extend_from_slice(buf);
+    pub fn write(&mut self, bytes: &[u8]) {
+        match &mut self.buf {
+            Buf::Owned(vec) => vec.extend_from_slice(bytes),
+            Buf::Borrowed { buf, len } => {
+                let end = *len + bytes.len();
+                if let Some(dst) = buf.get_mut(*len..end) {
+                    dst.copy_from_slice(bytes);
+                }
+                *len = end;
+            }
+            Buf::Writer {
+                writer,
+                chunk,
+                len,
+                error,
+            } => {
+                *len += bytes.len();
+                if error.is_some() {
+                    return;
+                }
+                let mut result = Ok(());
+                if chunk.len() + bytes.len() > WRITER_CHUNK_SIZE {
+                    result = writer.write_all(chunk);
+                    chunk.clear();
+                }
+                if result.is_ok() {
+                    if bytes.len() >= WRITER_CHUNK_SIZE {
+                        result = writer.write_all(bytes);
+                    } else {
+                        chunk.extend_from_slice(bytes);
+                    }
+                }
+                *error = result.err();
+            }
+        }
     }
 
     /// Writes a single byte to the `SketchBytes`.
     pub fn write_u8(&mut self, n: u8) {
-        self.bytes.push(n);
+        self.write(&[n]);
     }
 
     /// Writes a single byte to the `SketchBytes`.
     pub fn write_i8(&mut self, n: i8) {
-        self.bytes.push(n as u8);
+        self.write(&[n as u8]);
     }
 
     /// Writes a 16-bit unsigned integer to the `SketchBytes` in little-endian byte order.
@@ -35,6 +35,15 @@ pub struct Family {
 }
 
 impl Family {
+    /// The updatable QuickSelect form of the Theta sketch, written by direct sketches.
+    #[cfg(feature = "theta")]
+    pub const QUICKSELECT: Family = Family {
+        id: 2,
+        name: "QUICKSELECT",
+        min_pre_longs: 3,
+        max_pre_longs: 3,
+    };
+
     /// Theta Sketch for cardinality estimation.
     #[cfg(feature = "theta")]
     pub const THETA: Family = Family {
@@ -53,6 +62,15 @@ impl Family {
         max_pre_longs: 1,
     };
 
+    /// Classic quantiles sketch.
+    #[cfg(feature = "quantiles")]
+    pub const QUANTILES: Family = Family {
+        id: 8,
+        name: "QUANTILES",
+        min_pre_longs: 1,
+        max_pre_longs: 2,
+    };
+
     /// Tuple Sketch for cardinality estimation with per-key summaries.
     #[cfg(feature = "tuple")]
     pub const TUPLE: Family = Family {
@@ -71,6 +89,51 @@ impl Family {
         max_pre_longs: 4,
     };
 
+    /// Reservoir sampling sketch.
+    #[cfg(feature = "sampling")]
+    pub const RESERVOIR: Family = Family {
+        id: 11,
+        name: "RESERVOIR",
+        min_pre_longs: 1,
+        max_pre_longs: 2,
+    };
+
+    /// Union of reservoir sampling sketches.
+    #[cfg(feature = "sampling")]
+    pub const RESERVOIR_UNION: Family = Family {
+        id: 12,
+        name: "RESERVOIR_UNION",
+        min_pre_longs: 1,
+        max_pre_longs: 1,
+    };
+
+    /// VarOpt sampling sketch for weighted items.
+    #[cfg(feature = "sampling")]
+    pub const VAROPT: Family = Family {
+        id: 13,
+        name: "VAROPT",
+        min_pre_longs: 1,
+        max_pre_longs: 4,
+    };
+
+    /// Union of VarOpt sampling sketches.
+    #[cfg(feature = "sampling")]
+    pub const VAROPT_UNION: Family = Family {
+        id: 14,
+        name: "VAROPT_UNION",
+        min_pre_longs: 1,
+        max_pre_longs: 4,
+    };
+
+    /// KLL quantiles sketch.
+    #[cfg(feature = "kll")]
+    pub const KLL: Family = Family {
+        id: 15,
+        name: "KLL",
+        min_pre_longs: 1,
+        max_pre_longs: 2,
+    };
+
     /// Compressed Probabilistic Counting (CPC) Sketch.
     #[cfg(feature = "cpc")]
     pub const CPC: Family = Family {
@@ -80,6 +143,15 @@ impl Family {
         max_pre_longs: 5,
     };
 
+    /// Relative Error Quantiles (REQ) sketch.
+    #[cfg(feature = "req")]
+    pub const REQ: Family = Family {
+        id: 17,
+        name: "REQ",
+        min_pre_longs: 1,
+        max_pre_longs: 2,
+    };
+
     /// CountMin Sketch
     #[cfg(feature = "countmin")]
     pub const COUNTMIN: Family = Family {
@@ -89,6 +161,27 @@ impl Family {
         max_pre_longs: 2,
     };
 
+    /// Density sketch for kernel density estimation.
+    ///
+    /// Only the C++ implementation defines this family, and it reuses the ID of [`Self::EBPPS`].
+    /// Its preamble size is counted in 4-byte ints rather than longs.
+    #[cfg(feature = "density")]
+    pub const DENSITY: Family = Family {
+        id: 19,
+        name: "DENSITY",
+        min_pre_longs: 3,
+        max_pre_longs: 6,
+    };
+
+    /// Exact and bounded probability proportional to size (EBPPS) sampling sketch.
+    #[cfg(feature = "sampling")]
+    pub const EBPPS: Family = Family {
+        id: 19,
+        name: "EBPPS",
+        min_pre_longs: 1,
+        max_pre_longs: 5,
+    };
+
     /// T-Digest for estimating quantiles and ranks.
     #[cfg(feature = "tdigest")]
     pub const TDIGEST: Family = Family {
@@ -106,6 +199,26 @@ impl Family {
         min_pre_longs: 3,
         max_pre_longs: 4,
     };
+
+    /// Quotient Filter.
+    #[cfg(feature = "quotient")]
+    pub const QUOTIENTFILTER: Family = Family {
+        id: 22,
+        name: "QUOTIENTFILTER",
+        min_pre_longs: 2,
+        max_pre_longs: 3,
+    };
+
+    /// Frequent Directions sketch for low-rank approximation of matrices.
+    ///
+    /// The core libraries do not define this family; its ID follows the last one they use.
+    #[cfg(feature = "matrix")]
+    pub const FREQUENT_DIRECTIONS: Family = Family {
+        id: 23,
+        name: "FREQUENT_DIRECTIONS",
+        min_pre_longs: 2,
+        max_pre_longs: 4,
+    };
 }
 
 impl Family {
@@ -0,0 +1,67 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Fingerprints of sketches, for checking that replicas hold the same state.
+//!
+//! A fingerprint is the first 64 bits of the 128-bit MurmurHash3 of the sketch's `serialize`
+//! image with seed 0. The image is the portable form of a sketch, so the fingerprint is the same
+//! on every platform and can be recomputed from the bytes by any implementation.
+//!
+//! Some images list their entries in the order of an internal hash table, which depends on the
+//! order of the updates: the coupons of an HLL sketch, the hashes of an unordered Theta or Tuple
+//! sketch and the items of a frequent items sketch. Those sketches hash their image with the
+//! entries sorted instead, so that two replicas holding the same entries agree.
+
+use crate::hash::murmurhash3_x64_128;
+
+/// Computes the fingerprint of a serialized image.
+pub(crate) fn fingerprint(image: &[u8]) -> u64 {
+    murmurhash3_x64_128(image, 0).0
+}
+
+/// Implements `fingerprint` for a sketch type through its byte image.
+///
+/// The arguments follow [`impl_base64_via_image`](crate::codec::base64) without the decoder: by
+/// default the image is produced by the inherent `serialize(&self)`, which sketches with a
+/// history-dependent entry order replace by their sorted image. Generic parameters and their
+/// bounds go in the leading brackets.
+macro_rules! impl_fingerprint_via_image {
+    ([$($generics:tt)*] $ty:ty, |$s:ident| $encode:expr) => {
+        impl<$($generics)*> $ty {
+            /// Returns a 64-bit fingerprint of the serialized state of this sketch.
+            ///
+            /// Sketches holding the same state have the same fingerprint on every platform, so
+            /// replicas can compare fingerprints before exchanging full images. The
+            /// fingerprint is the first 64 bits of the 128-bit MurmurHash3, with seed 0, of the
+            /// `serialize` image, with its entries sorted where the image lists them in the
+            /// order of a hash table. Different states collide with a probability of about
+            /// 2^-64.
+            pub fn fingerprint(&self) -> u64 {
+                let $s = self;
+                $crate::codec::fingerprint::fingerprint(&$encode)
+            }
+        }
+    };
+    ([$($generics:tt)*] $ty:ty) => {
+        impl_fingerprint_via_image!([$($generics)*] $ty, |s| s.serialize());
+    };
+    ($ty:ty) => {
+        impl_fingerprint_via_image!([] $ty);
+    };
+}
+
+pub(crate) use impl_fingerprint_via_image;
@@ -26,8 +26,15 @@ pub use self::encode::SketchBytes;
     feature = "bloom",
     feature = "countmin",
     feature = "cpc",
+    feature = "density",
     feature = "frequencies",
     feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
     feature = "tdigest",
     feature = "theta",
     feature = "tuple",
@@ -39,10 +46,44 @@ pub(crate) mod assert;
     feature = "bloom",
     feature = "countmin",
     feature = "cpc",
+    feature = "density",
     feature = "frequencies",
     feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
     feature = "tdigest",
     feature = "theta",
     feature = "tuple",
 ))]
 pub(crate) mod family;
+
+#[cfg(feature = "base64")]
+#[allow(dead_code, unused_imports, unused_macros)] // only used by the enabled sketches
+pub(crate) mod base64;
+
+#[cfg(any(
+    feature = "bloom",
+    feature = "countmin",
+    feature = "cpc",
+    feature = "density",
+    feature = "frequencies",
+    feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
+    feature = "tdigest",
+    feature = "theta",
+    feature = "tuple",
+))]
+pub(crate) mod fingerprint;
+
+#[cfg(feature = "serde")]
+#[allow(dead_code, unused_imports, unused_macros)] // only used by the enabled sketches
+pub(crate) mod serde;
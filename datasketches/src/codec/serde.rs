@@ -0,0 +1,113 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Serde support for sketches, delegating to their binary serialization format.
+//!
+//! Every sketch serializes as a single byte string holding the same image as its `serialize`
+//! method, so it can be embedded in any serde data format and read back by the other
+//! DataSketches implementations once extracted. Human-readable formats without a native byte
+//! type, such as JSON, represent the image as an array of integers, which is also accepted when
+//! deserializing.
+
+use std::fmt;
+use std::marker::PhantomData;
+
+use serde::Deserializer;
+use serde::de::Error as _;
+use serde::de::SeqAccess;
+use serde::de::Visitor;
+
+use crate::error::Error;
+
+/// Deserializes a byte image and decodes it with `decode`.
+pub(crate) fn deserialize_image<'de, D, T>(
+    deserializer: D,
+    decode: impl FnOnce(&[u8]) -> Result<T, Error>,
+) -> Result<T, D::Error>
+where
+    D: Deserializer<'de>,
+{
+    let image = deserializer.deserialize_bytes(ImageVisitor(PhantomData))?;
+    decode(&image).map_err(D::Error::custom)
+}
+
+struct ImageVisitor<'de>(PhantomData<&'de ()>);
+
+impl<'de> Visitor<'de> for ImageVisitor<'de> {
+    type Value = Vec<u8>;
+
+    fn expecting(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str("a serialized sketch image")
+    }
+
+    fn visit_bytes<E: serde::de::Error>(self, v: &[u8]) -> Result<Self::Value, E> {
+        Ok(v.to_vec())
+    }
+
+    fn visit_byte_buf<E: serde::de::Error>(self, v: Vec<u8>) -> Result<Self::Value, E> {
+        Ok(v)
+    }
+
+    fn visit_seq<A: SeqAccess<'de>>(self, mut seq: A) -> Result<Self::Value, A::Error> {
+        let mut image = Vec::with_capacity(seq.size_hint().unwrap_or(0));
+        while let Some(byte) = seq.next_element()? {
+            image.push(byte);
+        }
+        Ok(image)
+    }
+}
+
+/// Implements `serde::Serialize` and `serde::Deserialize` for a sketch type through its byte
+/// image.
+///
+/// By default the image is produced by the inherent `serialize(&self)` and decoded by the
+/// inherent `deserialize(&[u8])`; both can be overridden for types with other signatures.
+/// Generic parameters and their bounds go in the leading brackets.
+macro_rules! impl_serde_via_image {
+    ([$($generics:tt)*] $ty:ty, |$s:ident| $encode:expr, |$b:ident| $decode:expr) => {
+        impl<$($generics)*> ::serde::Serialize for $ty {
+            fn serialize<Ser>(&self, serializer: Ser) -> Result<Ser::Ok, Ser::Error>
+            where
+                Ser: ::serde::Serializer,
+            {
+                let $s = self;
+                serializer.serialize_bytes(&$encode)
+            }
+        }
+
+        impl<'de, $($generics)*> ::serde::Deserialize<'de> for $ty {
+            fn deserialize<De>(deserializer: De) -> Result<Self, De::Error>
+            where
+                De: ::serde::Deserializer<'de>,
+            {
+                $crate::codec::serde::deserialize_image(deserializer, |$b| $decode)
+            }
+        }
+    };
+    ([$($generics:tt)*] $ty:ty) => {
+        impl_serde_via_image!(
+            [$($generics)*] $ty,
+            |s| s.serialize(),
+            |b| <$ty>::deserialize(b)
+        );
+    };
+    ($ty:ty) => {
+        impl_serde_via_image!([] $ty);
+    };
+}
+
+pub(crate) use impl_serde_via_image;
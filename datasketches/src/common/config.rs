@@ -0,0 +1,68 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Configuration shared by the builders of many sketches
+
+#[cfg(feature = "hll")]
+use crate::hll::HllType;
+
+/// Defaults applied to sketch builders through their `config` method.
+///
+/// An application creating sketches in many places can keep its seed, lg_k and HLL type in one
+/// `SketchConfig`, pass it to every builder and log it for auditing. A field left at `None`
+/// keeps the default of the builder, and a builder ignores the fields it has no setting for:
+/// the HLL builder has no seed and the Bloom and quotient filter builders have no lg_k.
+/// Setters called on a builder after `config` override the configuration.
+///
+/// A configuration can be scoped to an aggregation by capturing it in the closure that
+/// creates the unions of an `Aggregator`.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::common::SketchConfig;
+/// # use datasketches::hll::HllSketchBuilder;
+/// # use datasketches::hll::HllType;
+/// # use datasketches::theta::ThetaSketchBuilder;
+/// let mut config = SketchConfig::default();
+/// config.seed = Some(42);
+/// config.lg_k = Some(14);
+/// config.hll_type = Some(HllType::Hll8);
+///
+/// let hll = HllSketchBuilder::default().config(&config).build();
+/// assert_eq!(hll.lg_config_k(), 14);
+/// assert_eq!(hll.target_type(), HllType::Hll8);
+///
+/// let theta = ThetaSketchBuilder::default()
+///     .config(&config)
+///     .lg_k(10)
+///     .build();
+/// assert_eq!(theta.lg_k(), 10);
+/// ```
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct SketchConfig {
+    /// The hash seed of the Theta and Tuple sketches and unions, and of the Bloom and quotient
+    /// filters.
+    pub seed: Option<u64>,
+    /// The log2 of the nominal number of entries or registers of the HLL, Theta and Tuple
+    /// sketches and unions. Each builder panics on a value outside of its own range.
+    pub lg_k: Option<u8>,
+    /// The target type of the HLL sketches.
+    #[cfg(feature = "hll")]
+    pub hll_type: Option<HllType>,
+}
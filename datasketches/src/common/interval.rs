@@ -0,0 +1,54 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Estimates together with their confidence bounds
+
+/// An estimate with its lower and upper confidence bounds.
+///
+/// Returned by [`DistinctCountEstimator::estimate_with_bounds`], which reads all three values
+/// from the same sketch state.
+///
+/// [`DistinctCountEstimator::estimate_with_bounds`]: crate::common::DistinctCountEstimator::estimate_with_bounds
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct Interval {
+    /// The approximate lower bound.
+    pub lower: f64,
+    /// The estimate.
+    pub estimate: f64,
+    /// The approximate upper bound.
+    pub upper: f64,
+}
+
+impl Interval {
+    /// Returns whether `value` lies within the bounds, inclusive.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::common::Interval;
+    /// let interval = Interval {
+    ///     lower: 90.0,
+    ///     estimate: 100.0,
+    ///     upper: 110.0,
+    /// };
+    /// assert!(interval.contains(110.0));
+    /// assert!(!interval.contains(80.0));
+    /// ```
+    pub fn contains(&self, value: f64) -> bool {
+        self.lower <= value && value <= self.upper
+    }
+}
@@ -17,10 +17,78 @@
 
 //! Data structures and functions that may be used across all the sketch families.
 
+mod config;
+mod interval;
 mod num_std_dev;
 mod resize;
+mod shared;
+mod traits;
+pub use self::config::SketchConfig;
+pub use self::interval::Interval;
 pub use self::num_std_dev::NumStdDev;
 pub use self::resize::ResizeFactor;
+pub use self::shared::SharedCompactSketch;
+pub use self::traits::DistinctCountEstimator;
+pub use self::traits::MergeableSketch;
+pub use self::traits::QuantileSketch;
 
 #[cfg(any(feature = "cpc", feature = "hll"))]
 pub(crate) mod inv_pow2;
+
+#[cfg(any(
+    feature = "bloom",
+    feature = "hll",
+    feature = "theta",
+    feature = "tuple"
+))]
+pub(crate) mod observer;
+#[cfg(any(
+    feature = "bloom",
+    feature = "hll",
+    feature = "theta",
+    feature = "tuple"
+))]
+pub use self::observer::SketchEvent;
+#[cfg(any(
+    feature = "bloom",
+    feature = "hll",
+    feature = "theta",
+    feature = "tuple"
+))]
+pub use self::observer::SketchObserver;
+#[cfg(any(
+    feature = "bloom",
+    feature = "hll",
+    feature = "theta",
+    feature = "tuple"
+))]
+pub use self::observer::set_observer;
+
+#[cfg(all(
+    feature = "rayon",
+    any(feature = "cpc", feature = "hll", feature = "theta")
+))]
+pub(crate) mod parallel;
+
+#[cfg(any(feature = "kll", feature = "quantiles", feature = "req"))]
+mod partition;
+#[cfg(any(feature = "kll", feature = "req"))]
+mod quantile_bounds;
+#[cfg(any(
+    feature = "density",
+    feature = "kll",
+    feature = "quantiles",
+    feature = "req",
+    feature = "sampling",
+    all(feature = "theta", any(feature = "cpc", feature = "hll"))
+))]
+#[allow(dead_code)] // some utilities are only used for certain sketches
+pub(crate) mod random;
+#[cfg(any(feature = "kll", feature = "quantiles", feature = "req"))]
+pub(crate) mod sorted_view;
+#[cfg(any(feature = "kll", feature = "quantiles", feature = "req"))]
+pub use self::partition::PartitionBoundaries;
+#[cfg(any(feature = "kll", feature = "req"))]
+pub use self::quantile_bounds::QuantileBounds;
+#[cfg(any(feature = "kll", feature = "quantiles", feature = "req"))]
+pub use self::sorted_view::SortedView;
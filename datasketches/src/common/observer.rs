@@ -0,0 +1,134 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::sync::OnceLock;
+
+use crate::error::Error;
+use crate::error::ErrorKind;
+
+/// A notable change in the internal state of a sketch, reported to the [`SketchObserver`].
+///
+/// Events mark the changes that cost an allocation or a pass over the retained state, or that
+/// change the accuracy of a sketch, so they happen a few times over the life of a sketch
+/// rather than on every update.
+#[derive(Debug, Clone, Copy, PartialEq)]
+#[non_exhaustive]
+pub enum SketchEvent {
+    /// An HLL sketch outgrew its coupon list and moved to a coupon hash set.
+    HllListToSet {
+        /// The lg_config_k of the sketch
+        lg_config_k: u8,
+    },
+    /// The coupon hash set of an HLL sketch doubled in size.
+    HllSetResize {
+        /// The lg_config_k of the sketch
+        lg_config_k: u8,
+        /// log2 of the new number of slots
+        lg_size: u8,
+    },
+    /// An HLL sketch moved from List or Set mode to its register array.
+    HllToArray {
+        /// The lg_config_k of the sketch
+        lg_config_k: u8,
+        /// The number of coupons carried over into the registers
+        num_coupons: usize,
+    },
+    /// The hash table of a Theta or Tuple sketch, union or intersection grew.
+    ThetaResize {
+        /// log2 of the nominal number of entries
+        lg_nom_size: u8,
+        /// log2 of the new number of slots
+        lg_cur_size: u8,
+    },
+    /// The hash table of a Theta or Tuple sketch, union or intersection lowered theta to keep
+    /// its nominal number of entries.
+    ThetaRebuild {
+        /// log2 of the nominal number of entries
+        lg_nom_size: u8,
+        /// The new theta, as a 64-bit threshold
+        theta: u64,
+    },
+    /// An insert set half of the bits of a Bloom filter, past which the false positive rate
+    /// exceeds the one the filter was sized for.
+    BloomSaturated {
+        /// The number of bits of the filter
+        capacity: usize,
+        /// The number of hash functions of the filter
+        num_hashes: u16,
+    },
+}
+
+/// A process-wide receiver of [`SketchEvent`]s, installed with [`set_observer`].
+///
+/// The observer is called synchronously on the thread that changed the sketch, so it should
+/// hand the event off quickly, for example by incrementing a metrics counter. Closures taking
+/// a `&SketchEvent` implement this trait.
+///
+/// # Examples
+///
+/// ```
+/// # use std::sync::atomic::AtomicUsize;
+/// # use std::sync::atomic::Ordering;
+/// # use datasketches::common::SketchEvent;
+/// # use datasketches::common::set_observer;
+/// static PROMOTIONS: AtomicUsize = AtomicUsize::new(0);
+///
+/// set_observer(|event: &SketchEvent| {
+///     if let SketchEvent::HllToArray { .. } = event {
+///         PROMOTIONS.fetch_add(1, Ordering::Relaxed);
+///     }
+/// })
+/// .unwrap();
+/// ```
+pub trait SketchObserver: Send + Sync {
+    /// Called on every event of every sketch in the process.
+    fn on_event(&self, event: &SketchEvent);
+}
+
+impl<F> SketchObserver for F
+where
+    F: Fn(&SketchEvent) + Send + Sync,
+{
+    fn on_event(&self, event: &SketchEvent) {
+        self(event)
+    }
+}
+
+static OBSERVER: OnceLock<Box<dyn SketchObserver>> = OnceLock::new();
+
+/// Installs the observer of the sketches of this process.
+///
+/// Until an observer is installed, events are dropped at the cost of one atomic load each.
+///
+/// # Errors
+///
+/// Returns an error if an observer is already installed; it can only be set once.
+pub fn set_observer(observer: impl SketchObserver + 'static) -> Result<(), Error> {
+    OBSERVER.set(Box::new(observer)).map_err(|_| {
+        Error::new(
+            ErrorKind::InvalidArgument,
+            "a sketch observer is already installed",
+        )
+    })
+}
+
+/// Reports `event` to the installed observer, if any.
+pub(crate) fn notify(event: SketchEvent) {
+    if let Some(observer) = OBSERVER.get() {
+        observer.on_event(&event);
+    }
+}
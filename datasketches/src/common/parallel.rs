@@ -0,0 +1,45 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Parallel tree reduction behind the `par_union_serialized` helpers
+
+use crate::error::Error;
+
+/// Number of images a single task merges sequentially
+const LEAF_SIZE: usize = 64;
+
+/// Reduce `items` by splitting them in halves with `rayon::join` until at most
+/// [`LEAF_SIZE`] remain, folding each chunk with `leaf` and pairs of results with `combine`.
+///
+/// The first error found in either half is returned.
+pub(crate) fn tree_reduce<T, U, L, C>(items: &[T], leaf: &L, combine: &C) -> Result<U, Error>
+where
+    T: Sync,
+    U: Send,
+    L: Fn(&[T]) -> Result<U, Error> + Sync,
+    C: Fn(U, U) -> Result<U, Error> + Sync,
+{
+    if items.len() <= LEAF_SIZE {
+        return leaf(items);
+    }
+    let (left, right) = items.split_at(items.len() / 2);
+    let (left, right) = rayon::join(
+        || tree_reduce(left, leaf, combine),
+        || tree_reduce(right, leaf, combine),
+    );
+    combine(left?, right?)
+}
@@ -0,0 +1,136 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+/// Split points that divide the input stream of a quantiles sketch into parts of roughly equal
+/// weight, for planning balanced range partitions.
+///
+/// A partition into _n_ parts has _n+1_ boundaries: the first is the minimum item of the stream,
+/// the last is its maximum, and the ones in between are the quantiles at the ranks _1/n_, _2/n_,
+/// and so on. With inclusive search criteria each part holds the items in `(lower, upper]`, and
+/// the first part also holds the minimum; with exclusive criteria each part holds the items in
+/// `[lower, upper)`, and the last part also holds the maximum.
+///
+/// The boundaries, ranks and part sizes are estimates with the rank error of the sketch they
+/// come from. Parts narrower than that error are not meaningful, and when the sketch retains
+/// fewer distinct items than parts are requested, some boundaries repeat and their parts are
+/// empty.
+///
+/// Partitions are returned by `partition_boundaries` on [`KllSketch`](crate::kll::KllSketch),
+/// [`KllItemsSketch`](crate::kll::KllItemsSketch),
+/// [`DoublesSketch`](crate::quantiles::DoublesSketch) and [`ReqSketch`](crate::req::ReqSketch).
+#[derive(Debug, Clone)]
+pub struct PartitionBoundaries<T> {
+    boundaries: Vec<T>,
+    natural_ranks: Vec<u64>,
+    total_weight: u64,
+    inclusive: bool,
+}
+
+impl<T> PartitionBoundaries<T> {
+    pub(crate) fn new(
+        boundaries: Vec<T>,
+        natural_ranks: Vec<u64>,
+        total_weight: u64,
+        inclusive: bool,
+    ) -> Self {
+        debug_assert_eq!(boundaries.len(), natural_ranks.len());
+        debug_assert!(boundaries.len() >= 2);
+        PartitionBoundaries {
+            boundaries,
+            natural_ranks,
+            total_weight,
+            inclusive,
+        }
+    }
+
+    /// Returns the number of parts.
+    pub fn num_parts(&self) -> usize {
+        self.boundaries.len() - 1
+    }
+
+    /// Returns the `num_parts() + 1` boundaries in ascending order, starting with the minimum
+    /// item and ending with the maximum item of the stream.
+    pub fn boundaries(&self) -> &[T] {
+        &self.boundaries
+    }
+
+    /// Returns the estimated number of stream items up to each boundary.
+    ///
+    /// With inclusive criteria an item equal to the boundary is counted; otherwise only the
+    /// smaller items are.
+    pub fn natural_ranks(&self) -> &[u64] {
+        &self.natural_ranks
+    }
+
+    /// Returns the natural ranks divided by the total weight, each in `[0.0, 1.0]`.
+    pub fn normalized_ranks(&self) -> Vec<f64> {
+        self.natural_ranks
+            .iter()
+            .map(|&rank| rank as f64 / self.total_weight as f64)
+            .collect()
+    }
+
+    /// Returns the estimated number of stream items in each part.
+    ///
+    /// The sizes add up to the total weight.
+    pub fn part_sizes(&self) -> Vec<u64> {
+        let num_parts = self.num_parts();
+        (0..num_parts)
+            .map(|part| {
+                let lower = if part == 0 {
+                    0
+                } else {
+                    self.natural_ranks[part]
+                };
+                let upper = if part + 1 == num_parts {
+                    self.total_weight
+                } else {
+                    self.natural_ranks[part + 1]
+                };
+                upper - lower
+            })
+            .collect()
+    }
+
+    /// Returns the number of items in the stream.
+    pub fn total_weight(&self) -> u64 {
+        self.total_weight
+    }
+
+    /// Returns true if the parts include their upper boundary rather than their lower one.
+    pub fn is_inclusive(&self) -> bool {
+        self.inclusive
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_part_sizes() {
+        // the items 1 to 10 with weight 1, split in two
+        let inclusive = PartitionBoundaries::new(vec![1, 5, 10], vec![1, 5, 10], 10, true);
+        assert_eq!(inclusive.num_parts(), 2);
+        assert_eq!(inclusive.part_sizes(), [5, 5]);
+        assert_eq!(inclusive.normalized_ranks(), [0.1, 0.5, 1.0]);
+
+        let exclusive = PartitionBoundaries::new(vec![1, 6, 10], vec![0, 5, 9], 10, false);
+        assert_eq!(exclusive.part_sizes(), [5, 5]);
+        assert_eq!(exclusive.normalized_ranks(), [0.0, 0.5, 0.9]);
+    }
+}
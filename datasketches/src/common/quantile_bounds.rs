@@ -0,0 +1,75 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Quantiles together with the items at the bounds of their rank
+
+use crate::common::SortedView;
+
+/// A quantile with the items at the lower and upper confidence bounds of its rank.
+///
+/// The true quantile of the requested rank lies between [`lower`](Self::lower) and
+/// [`upper`](Self::upper) with the confidence of the sketch's rank error, so a dashboard can
+/// draw the band between them rather than a single line. The band is narrow where the data is
+/// dense and wide where it is sparse, such as in a long tail of latencies.
+///
+/// Returned by `quantile_with_rank_bounds` on [`KllSketch`](crate::kll::KllSketch),
+/// [`KllItemsSketch`](crate::kll::KllItemsSketch) and [`ReqSketch`](crate::req::ReqSketch).
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct QuantileBounds<T> {
+    /// The item at the lower bound of the rank.
+    pub lower: T,
+    /// The quantile of the rank.
+    pub quantile: T,
+    /// The item at the upper bound of the rank.
+    pub upper: T,
+    /// The lower bound of the rank, in `[0.0, 1.0]`.
+    pub lower_rank: f64,
+    /// The upper bound of the rank, in `[0.0, 1.0]`.
+    pub upper_rank: f64,
+}
+
+impl<T: Clone> QuantileBounds<T> {
+    /// Reads the quantiles of `rank` and of its bounds from one sorted view, with ranks 0 and
+    /// 1 at the exact extremes like the `quantile` of the sketches.
+    pub(crate) fn from_view(
+        view: &SortedView<T>,
+        min_item: &T,
+        max_item: &T,
+        rank: f64,
+        (lower_rank, upper_rank): (f64, f64),
+        inclusive: bool,
+    ) -> Self {
+        let lower_rank = lower_rank.clamp(0.0, 1.0);
+        let upper_rank = upper_rank.clamp(0.0, 1.0);
+        let at = |rank: f64| {
+            if rank == 0.0 {
+                min_item.clone()
+            } else if rank == 1.0 {
+                max_item.clone()
+            } else {
+                view.quantile(rank, inclusive)
+            }
+        };
+        QuantileBounds {
+            lower: at(lower_rank),
+            quantile: at(rank),
+            upper: at(upper_rank),
+            lower_rank,
+            upper_rank,
+        }
+    }
+}
@@ -0,0 +1,79 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! A lightweight, thread-local pseudorandom generator for the sketches that sample or compact
+//! their input at random.
+//!
+//! The generator is an xorshift64* stream seeded once per thread from the standard library's
+//! randomly keyed hasher, so no external dependency is needed. It is not suitable for
+//! cryptographic use.
+
+use std::cell::Cell;
+use std::collections::hash_map::RandomState;
+use std::hash::BuildHasher;
+
+thread_local! {
+    static STATE: Cell<u64> = Cell::new(initial_state());
+}
+
+fn initial_state() -> u64 {
+    // xorshift must never be seeded with zero
+    RandomState::new().hash_one(0x2545_f491_4f6c_dd1du64) | 1
+}
+
+/// Returns the next pseudorandom 64-bit value of the current thread.
+pub(crate) fn next_u64() -> u64 {
+    STATE.with(|state| {
+        let mut x = state.get();
+        x ^= x >> 12;
+        x ^= x << 25;
+        x ^= x >> 27;
+        state.set(x);
+        x.wrapping_mul(0x2545_f491_4f6c_dd1d)
+    })
+}
+
+/// Returns a fair pseudorandom bit as `0` or `1`.
+pub(crate) fn next_bit() -> u32 {
+    (next_u64() >> 63) as u32
+}
+
+/// Returns a uniformly distributed value in `[0, 1)`.
+pub(crate) fn next_f64() -> f64 {
+    // the top 53 bits fill the mantissa exactly
+    (next_u64() >> 11) as f64 * (1.0 / (1u64 << 53) as f64)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_next_bit_is_roughly_fair() {
+        let n = 10_000;
+        let ones: u32 = (0..n).map(|_| next_bit()).sum();
+        assert!((4_500..=5_500).contains(&ones), "ones: {ones}");
+    }
+
+    #[test]
+    fn test_next_f64_is_in_unit_interval() {
+        for _ in 0..10_000 {
+            let x = next_f64();
+            assert!((0.0..1.0).contains(&x), "x: {x}");
+        }
+    }
+}
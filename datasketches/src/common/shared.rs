@@ -0,0 +1,170 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::fmt;
+use std::ops::Deref;
+use std::sync::Arc;
+
+/// An immutable sketch shared across threads.
+///
+/// The sketch lives behind an [`Arc`], so cloning the handle is a reference count increment,
+/// and only its `&self` methods are reachable through [`Deref`]. A query engine can deserialize
+/// a sketch once, cache the handle, and answer queries from any number of threads without a
+/// lock: nothing can update the sketch, so every thread sees the state it was shared with.
+///
+/// The handle is `Send` and `Sync` whenever the sketch is, which holds for every sketch of this
+/// crate. The sketches computing some state lazily on a query, such as the composite estimate
+/// of an [`HllSketch`](crate::hll::HllSketch), cache it in atomics, so that concurrent queries
+/// agree and never block each other.
+///
+/// Each family names its shared sketch: [`SharedHllSketch`](crate::hll::SharedHllSketch),
+/// [`SharedCompactThetaSketch`](crate::theta::SharedCompactThetaSketch) and
+/// [`SharedBloomFilter`](crate::bloom::SharedBloomFilter), built from an image with their
+/// `deserialize` or from a sketch with [`new`](Self::new).
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hll::HllSketch;
+/// # use datasketches::hll::HllType;
+/// # use datasketches::hll::SharedHllSketch;
+/// let mut sketch = HllSketch::new(12, HllType::Hll8);
+/// sketch.extend(0..10_000);
+/// let shared = SharedHllSketch::deserialize(&sketch.serialize()).unwrap();
+///
+/// let handles: Vec<_> = (0..4)
+///     .map(|_| {
+///         let shared = shared.clone();
+///         std::thread::spawn(move || shared.estimate())
+///     })
+///     .collect();
+/// for handle in handles {
+///     assert_eq!(handle.join().unwrap(), sketch.estimate());
+/// }
+/// ```
+pub struct SharedCompactSketch<S> {
+    inner: Arc<S>,
+}
+
+impl<S> SharedCompactSketch<S> {
+    /// Shares `sketch`, which can no longer be updated.
+    pub fn new(sketch: S) -> Self {
+        SharedCompactSketch {
+            inner: Arc::new(sketch),
+        }
+    }
+
+    /// Returns true if both handles share the same sketch.
+    pub fn ptr_eq(this: &Self, other: &Self) -> bool {
+        Arc::ptr_eq(&this.inner, &other.inner)
+    }
+
+    /// Returns the sketch, cloning it unless this is its last handle.
+    ///
+    /// The returned sketch is owned and can be updated again.
+    pub fn into_inner(self) -> S
+    where
+        S: Clone,
+    {
+        Arc::unwrap_or_clone(self.inner)
+    }
+}
+
+impl<S> Clone for SharedCompactSketch<S> {
+    fn clone(&self) -> Self {
+        SharedCompactSketch {
+            inner: Arc::clone(&self.inner),
+        }
+    }
+}
+
+impl<S> Deref for SharedCompactSketch<S> {
+    type Target = S;
+
+    fn deref(&self) -> &S {
+        &self.inner
+    }
+}
+
+impl<S> AsRef<S> for SharedCompactSketch<S> {
+    fn as_ref(&self) -> &S {
+        &self.inner
+    }
+}
+
+impl<S> From<S> for SharedCompactSketch<S> {
+    fn from(sketch: S) -> Self {
+        SharedCompactSketch::new(sketch)
+    }
+}
+
+impl<S> From<Arc<S>> for SharedCompactSketch<S> {
+    fn from(inner: Arc<S>) -> Self {
+        SharedCompactSketch { inner }
+    }
+}
+
+impl<S: fmt::Debug> fmt::Debug for SharedCompactSketch<S> {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_tuple("SharedCompactSketch")
+            .field(&self.inner)
+            .finish()
+    }
+}
+
+impl<S: PartialEq> PartialEq for SharedCompactSketch<S> {
+    fn eq(&self, other: &Self) -> bool {
+        self.inner == other.inner
+    }
+}
+
+#[cfg(feature = "hll")]
+impl SharedCompactSketch<crate::hll::HllSketch> {
+    /// Deserializes an HLL image into a shared sketch.
+    ///
+    /// # Errors
+    ///
+    /// Fails like [`HllSketch::deserialize`](crate::hll::HllSketch::deserialize).
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, crate::error::Error> {
+        crate::hll::HllSketch::deserialize(bytes).map(Self::new)
+    }
+}
+
+#[cfg(feature = "theta")]
+impl SharedCompactSketch<crate::theta::CompactThetaSketch> {
+    /// Deserializes a compact theta image into a shared sketch.
+    ///
+    /// # Errors
+    ///
+    /// Fails like
+    /// [`CompactThetaSketch::deserialize`](crate::theta::CompactThetaSketch::deserialize).
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, crate::error::Error> {
+        crate::theta::CompactThetaSketch::deserialize(bytes).map(Self::new)
+    }
+}
+
+#[cfg(feature = "bloom")]
+impl SharedCompactSketch<crate::bloom::BloomFilter> {
+    /// Deserializes a Bloom filter image into a shared filter.
+    ///
+    /// # Errors
+    ///
+    /// Fails like [`BloomFilter::deserialize`](crate::bloom::BloomFilter::deserialize).
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, crate::error::Error> {
+        crate::bloom::BloomFilter::deserialize(bytes).map(Self::new)
+    }
+}
@@ -0,0 +1,246 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::cmp::Ordering;
+
+use crate::common::PartitionBoundaries;
+
+/// A sorted view of the retained items of a quantiles sketch, with cumulative weights.
+///
+/// Each retained item stands for `weight` items of the input stream. Iterating the view yields
+/// `(item, weight, cumulative_weight)` in ascending item order, where the cumulative weight
+/// includes the item itself, so custom statistics and CDF plots can be computed in one pass.
+///
+/// Views are returned by `sorted_view` on [`KllSketch`](crate::kll::KllSketch),
+/// [`DoublesSketch`](crate::quantiles::DoublesSketch) and [`ReqSketch`](crate::req::ReqSketch).
+#[derive(Debug, Clone)]
+pub struct SortedView<T> {
+    entries: Vec<(T, u64)>,
+    total_weight: u64,
+}
+
+impl<T> SortedView<T> {
+    /// Returns the number of retained items in the view.
+    pub fn len(&self) -> usize {
+        self.entries.len()
+    }
+
+    /// Returns true if the view holds no items.
+    pub fn is_empty(&self) -> bool {
+        self.entries.is_empty()
+    }
+
+    /// Returns the sum of the weights of all items, which is the number of items in the stream.
+    pub fn total_weight(&self) -> u64 {
+        self.total_weight
+    }
+
+    /// Returns an iterator over `(item, weight, cumulative_weight)` in ascending item order.
+    pub fn iter(&self) -> impl Iterator<Item = (&T, u64, u64)> + '_ {
+        let mut previous = 0;
+        self.entries.iter().map(move |(item, cumulative)| {
+            let weight = cumulative - previous;
+            previous = *cumulative;
+            (item, weight, *cumulative)
+        })
+    }
+}
+
+impl<T: Clone> SortedView<T> {
+    /// Builds a view from the retained items and their weights.
+    pub(crate) fn new<F>(mut entries: Vec<(T, u64)>, less: F) -> Self
+    where
+        F: Fn(&T, &T) -> bool,
+    {
+        entries.sort_by(|a, b| {
+            if less(&a.0, &b.0) {
+                Ordering::Less
+            } else if less(&b.0, &a.0) {
+                Ordering::Greater
+            } else {
+                Ordering::Equal
+            }
+        });
+        let mut total_weight = 0;
+        for entry in &mut entries {
+            total_weight += entry.1;
+            entry.1 = total_weight;
+        }
+        SortedView {
+            entries,
+            total_weight,
+        }
+    }
+
+    /// Returns the normalized rank of the given item.
+    pub(crate) fn rank<F>(&self, item: &T, inclusive: bool, less: F) -> f64
+    where
+        F: Fn(&T, &T) -> bool,
+    {
+        self.natural_rank(item, inclusive, less) as f64 / self.total_weight as f64
+    }
+
+    /// Returns the weight of the entries smaller than the given item, or not greater if inclusive.
+    fn natural_rank<F>(&self, item: &T, inclusive: bool, less: F) -> u64
+    where
+        F: Fn(&T, &T) -> bool,
+    {
+        let count = if inclusive {
+            self.entries.partition_point(|(v, _)| !less(item, v))
+        } else {
+            self.entries.partition_point(|(v, _)| less(v, item))
+        };
+        if count == 0 {
+            return 0;
+        }
+        self.entries[count - 1].1
+    }
+
+    /// Returns the item at the given normalized rank.
+    pub(crate) fn quantile(&self, rank: f64, inclusive: bool) -> T {
+        let weight = rank * self.total_weight as f64;
+        let index = if inclusive {
+            let weight = weight.ceil() as u64;
+            self.entries.partition_point(|(_, w)| *w < weight)
+        } else {
+            let weight = weight as u64;
+            self.entries.partition_point(|(_, w)| *w <= weight)
+        };
+        let index = index.min(self.entries.len() - 1);
+        self.entries[index].0.clone()
+    }
+
+    /// Returns the ranks of the split points followed by 1.0.
+    pub(crate) fn cdf<F>(&self, split_points: &[T], inclusive: bool, less: F) -> Vec<f64>
+    where
+        F: Fn(&T, &T) -> bool + Copy,
+    {
+        let mut ranks = Vec::with_capacity(split_points.len() + 1);
+        for split_point in split_points {
+            ranks.push(self.rank(split_point, inclusive, less));
+        }
+        ranks.push(1.0);
+        ranks
+    }
+
+    /// Returns the fraction of the weight that falls into each interval between split points.
+    pub(crate) fn pmf<F>(&self, split_points: &[T], inclusive: bool, less: F) -> Vec<f64>
+    where
+        F: Fn(&T, &T) -> bool + Copy,
+    {
+        let mut buckets = self.cdf(split_points, inclusive, less);
+        for i in (1..buckets.len()).rev() {
+            buckets[i] -= buckets[i - 1];
+        }
+        buckets
+    }
+
+    /// Splits the view into `num_parts` parts of roughly equal weight between the minimum and
+    /// maximum items of the stream, which the view may no longer retain.
+    pub(crate) fn partition_boundaries<F>(
+        &self,
+        num_parts: usize,
+        inclusive: bool,
+        min_item: T,
+        max_item: T,
+        less: F,
+    ) -> PartitionBoundaries<T>
+    where
+        F: Fn(&T, &T) -> bool + Copy,
+    {
+        let mut boundaries = Vec::with_capacity(num_parts + 1);
+        boundaries.push(min_item);
+        for part in 1..num_parts {
+            boundaries.push(self.quantile(part as f64 / num_parts as f64, inclusive));
+        }
+        boundaries.push(max_item);
+        let natural_ranks = boundaries
+            .iter()
+            .map(|boundary| self.natural_rank(boundary, inclusive, less))
+            .collect();
+        PartitionBoundaries::new(boundaries, natural_ranks, self.total_weight, inclusive)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn less(a: &f64, b: &f64) -> bool {
+        a < b
+    }
+
+    #[test]
+    fn test_rank_and_quantile() {
+        let view = SortedView::new(vec![(3.0, 1), (1.0, 1), (2.0, 2)], less);
+        assert_eq!(view.rank(&0.5, true, less), 0.0);
+        assert_eq!(view.rank(&1.0, true, less), 0.25);
+        assert_eq!(view.rank(&1.0, false, less), 0.0);
+        assert_eq!(view.rank(&2.0, true, less), 0.75);
+        assert_eq!(view.rank(&2.0, false, less), 0.25);
+        assert_eq!(view.rank(&3.0, true, less), 1.0);
+
+        assert_eq!(view.quantile(0.0, true), 1.0);
+        assert_eq!(view.quantile(0.25, true), 1.0);
+        assert_eq!(view.quantile(0.5, true), 2.0);
+        assert_eq!(view.quantile(1.0, true), 3.0);
+        assert_eq!(view.quantile(0.0, false), 1.0);
+        assert_eq!(view.quantile(0.25, false), 2.0);
+        assert_eq!(view.quantile(0.75, false), 3.0);
+        assert_eq!(view.quantile(1.0, false), 3.0);
+    }
+
+    #[test]
+    fn test_cdf_and_pmf() {
+        let view = SortedView::new(vec![(1.0, 1), (2.0, 1), (3.0, 1), (4.0, 1)], less);
+        assert_eq!(view.cdf(&[2.0, 3.0], true, less), [0.5, 0.75, 1.0]);
+        assert_eq!(view.cdf(&[2.0, 3.0], false, less), [0.25, 0.5, 1.0]);
+        assert_eq!(view.pmf(&[2.0, 3.0], true, less), [0.5, 0.25, 0.25]);
+    }
+
+    #[test]
+    fn test_partition_boundaries() {
+        let view = SortedView::new((1..=8).map(|i| (f64::from(i), 1)).collect(), less);
+        let partition = view.partition_boundaries(4, true, 1.0, 8.0, less);
+        assert_eq!(partition.boundaries(), [1.0, 2.0, 4.0, 6.0, 8.0]);
+        assert_eq!(partition.natural_ranks(), [1, 2, 4, 6, 8]);
+        assert_eq!(partition.part_sizes(), [2, 2, 2, 2]);
+
+        let partition = view.partition_boundaries(4, false, 1.0, 8.0, less);
+        assert_eq!(partition.boundaries(), [1.0, 3.0, 5.0, 7.0, 8.0]);
+        assert_eq!(partition.natural_ranks(), [0, 2, 4, 6, 7]);
+        assert_eq!(partition.part_sizes(), [2, 2, 2, 2]);
+
+        // a min and max the view no longer retains still bound the partition
+        let partition = view.partition_boundaries(1, true, 0.0, 9.0, less);
+        assert_eq!(partition.boundaries(), [0.0, 9.0]);
+        assert_eq!(partition.part_sizes(), [8]);
+    }
+
+    #[test]
+    fn test_iter() {
+        let view = SortedView::new(vec![(3.0, 4), (1.0, 1), (2.0, 2)], less);
+        assert_eq!(view.len(), 3);
+        assert_eq!(view.total_weight(), 7);
+        let entries: Vec<_> = view.iter().map(|(item, w, c)| (*item, w, c)).collect();
+        assert_eq!(entries, [(1.0, 1, 1), (2.0, 2, 3), (3.0, 4, 7)]);
+
+        let empty = SortedView::<f64>::new(vec![], less);
+        assert!(empty.is_empty());
+        assert_eq!(empty.iter().count(), 0);
+    }
+}
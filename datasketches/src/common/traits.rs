@@ -0,0 +1,164 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Traits shared by sketches of different families
+//!
+//! These traits let generic code aggregate over any sketch of a kind without naming the concrete
+//! type. Each sketch keeps its inherent methods, which the trait implementations forward to.
+
+use crate::common::Interval;
+use crate::common::NumStdDev;
+use crate::error::Error;
+
+/// A sketch estimating the number of distinct items it has seen.
+///
+/// Implemented by the HLL, CPC and Theta sketches.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::common::DistinctCountEstimator;
+/// # use datasketches::common::NumStdDev;
+/// # use datasketches::hll::{HllSketch, HllType};
+/// fn report(sketch: &impl DistinctCountEstimator) -> String {
+///     format!(
+///         "{:.0} in [{:.0}, {:.0}]",
+///         sketch.estimate(),
+///         sketch.lower_bound(NumStdDev::Two),
+///         sketch.upper_bound(NumStdDev::Two)
+///     )
+/// }
+///
+/// let mut sketch = HllSketch::new(12, HllType::Hll8);
+/// sketch.update("apple");
+/// assert_eq!(report(&sketch), "1 in [1, 1]");
+/// ```
+pub trait DistinctCountEstimator {
+    /// Returns whether the sketch has not seen any item.
+    fn is_empty(&self) -> bool;
+
+    /// Returns whether [`estimate`](Self::estimate) is the exact number of distinct items.
+    ///
+    /// Theta sketches are exact until theta first drops below one, and while exact the estimate
+    /// and both bounds are the retained count itself. HLL and CPC sketches keep only part of
+    /// each hash, so even their sparse modes can merge distinct items, and they are exact only
+    /// while empty.
+    fn is_exact(&self) -> bool;
+
+    /// Returns the estimated number of distinct items.
+    fn estimate(&self) -> f64;
+
+    /// Returns the approximate lower bound of the estimate at the given confidence.
+    fn lower_bound(&self, num_std_dev: NumStdDev) -> f64;
+
+    /// Returns the approximate upper bound of the estimate at the given confidence.
+    fn upper_bound(&self, num_std_dev: NumStdDev) -> f64;
+
+    /// Returns the estimate together with its lower and upper bounds at the given confidence.
+    ///
+    /// All three values are read through one borrow of the sketch, so they always describe the
+    /// same state.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::common::DistinctCountEstimator;
+    /// # use datasketches::common::NumStdDev;
+    /// # use datasketches::cpc::CpcSketch;
+    /// let mut sketch = CpcSketch::new(11);
+    /// sketch.extend(0..1000);
+    /// let interval = sketch.estimate_with_bounds(NumStdDev::Two);
+    /// assert_eq!(interval.estimate, sketch.estimate());
+    /// assert!(interval.lower <= interval.estimate && interval.estimate <= interval.upper);
+    /// assert!(interval.contains(1000.0));
+    /// ```
+    fn estimate_with_bounds(&self, num_std_dev: NumStdDev) -> Interval {
+        Interval {
+            lower: self.lower_bound(num_std_dev),
+            estimate: self.estimate(),
+            upper: self.upper_bound(num_std_dev),
+        }
+    }
+}
+
+/// A sketch answering rank and quantile queries over a stream of items.
+///
+/// Implemented by the KLL, classic quantiles and REQ sketches. Queries return `None` when the
+/// sketch is empty.
+pub trait QuantileSketch {
+    /// The type of the sketched items.
+    type Item;
+
+    /// Returns the number of items the sketch has seen.
+    fn n(&self) -> u64;
+
+    /// Returns whether the sketch still retains every item it has seen.
+    ///
+    /// Ranks and quantiles are then exact, computed from the items themselves.
+    fn is_exact(&self) -> bool;
+
+    /// Returns whether the sketch has not seen any item.
+    fn is_empty(&self) -> bool {
+        self.n() == 0
+    }
+
+    /// Returns the smallest item seen.
+    fn min_item(&self) -> Option<Self::Item>;
+
+    /// Returns the largest item seen.
+    fn max_item(&self) -> Option<Self::Item>;
+
+    /// Returns the approximate normalized rank of `item`.
+    fn rank(&self, item: Self::Item, inclusive: bool) -> Option<f64>;
+
+    /// Returns the approximate item at the normalized `rank`.
+    fn quantile(&self, rank: f64, inclusive: bool) -> Option<Self::Item>;
+}
+
+/// A sketch, or a union of sketches, that can absorb another sketch of type `Rhs`.
+///
+/// Quantile sketches merge sketches of their own type. For the distinct counting families the
+/// union types implement this trait, taking the sketches they combine.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::common::MergeableSketch;
+/// # use datasketches::kll::KllSketch;
+/// fn merge_all<S: MergeableSketch + Default>(sketches: &[S]) -> S {
+///     let mut result = S::default();
+///     for sketch in sketches {
+///         result.merge(sketch).unwrap();
+///     }
+///     result
+/// }
+///
+/// let mut a = KllSketch::<f64>::default();
+/// let mut b = KllSketch::<f64>::default();
+/// a.update(1.0);
+/// b.update(2.0);
+/// assert_eq!(merge_all(&[a, b]).n(), 2);
+/// ```
+pub trait MergeableSketch<Rhs: ?Sized = Self> {
+    /// Merges `other` into `self`.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the sketches cannot be combined, for example because they were
+    /// built with different seeds. Families whose merge cannot fail always return `Ok`.
+    fn merge(&mut self, other: &Rhs) -> Result<(), Error>;
+}
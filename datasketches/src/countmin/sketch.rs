@@ -17,13 +17,22 @@
 
 use std::hash::Hash;
 use std::hash::Hasher;
+use std::io;
+use std::io::Read;
+use std::io::Write;
 
 use crate::codec::SketchBytes;
 use crate::codec::SketchSlice;
 use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_seed_hash_is;
 use crate::codec::assert::ensure_serial_version_is;
 use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
 use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
 use crate::countmin::CountMinValue;
 use crate::countmin::UnsignedCountMinValue;
 use crate::countmin::serialization::FLAGS_IS_EMPTY;
@@ -37,6 +46,12 @@ use crate::hash::compute_seed_hash;
 
 const MAX_TABLE_ENTRIES: usize = 1 << 30;
 
+/// The most counters an empty image may describe.
+///
+/// Empty images do not store the table, so 16 bytes could otherwise claim gigabytes of it.
+/// Larger empty sketches are written with their zeroed counters instead.
+const MAX_EMPTY_IMAGE_ENTRIES: usize = 1 << 26;
+
 /// Count-Min sketch for estimating item frequencies.
 ///
 /// The sketch provides upper and lower bounds on estimated item frequencies
@@ -123,6 +138,35 @@ impl<T: CountMinValue> CountMinSketch<T> {
         self.total_weight == T::ZERO
     }
 
+    /// Returns the estimated size of the sketch in bytes
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>()
+            + self.counts.capacity() * size_of::<T>()
+            + self.hash_seeds.capacity() * size_of::<u64>()
+    }
+
+    /// Returns the estimated size in bytes of a sketch of the given configuration, which its
+    /// updates do not change.
+    ///
+    /// # Panics
+    ///
+    /// Panics under the same conditions as [`new`](Self::new).
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::countmin::CountMinSketch;
+    /// let sketch = CountMinSketch::<i64>::new(4, 128);
+    /// assert_eq!(
+    ///     CountMinSketch::<i64>::max_estimated_size(4, 128),
+    ///     sketch.estimated_size()
+    /// );
+    /// ```
+    pub fn max_estimated_size(num_hashes: u8, num_buckets: u32) -> usize {
+        let entries = entries_for_config(num_hashes, num_buckets);
+        size_of::<Self>() + entries * size_of::<T>() + num_hashes as usize * size_of::<u64>()
+    }
+
     /// Suggests the number of buckets to achieve the given relative error.
     ///
     /// # Panics
@@ -228,7 +272,7 @@ impl<T: CountMinValue> CountMinSketch<T> {
     ///
     /// # Panics
     ///
-    /// Panics if the sketches have incompatible configurations.
+    /// Panics if the sketches differ in number of hashes, number of buckets or seed.
     ///
     /// # Examples
     ///
@@ -247,9 +291,18 @@ impl<T: CountMinValue> CountMinSketch<T> {
         if std::ptr::eq(self, other) {
             panic!("Cannot merge a sketch with itself.");
         }
-        assert_eq!(self.num_hashes, other.num_hashes);
-        assert_eq!(self.num_buckets, other.num_buckets);
-        assert_eq!(self.seed, other.seed);
+        assert_eq!(
+            self.num_hashes, other.num_hashes,
+            "cannot merge sketches with different num_hashes"
+        );
+        assert_eq!(
+            self.num_buckets, other.num_buckets,
+            "cannot merge sketches with different num_buckets"
+        );
+        assert_eq!(
+            self.seed, other.seed,
+            "cannot merge sketches with different seeds"
+        );
         assert_eq!(self.counts.len(), other.counts.len());
         let counts_len = self.counts.len();
         for i in 0..counts_len {
@@ -271,19 +324,95 @@ impl<T: CountMinValue> CountMinSketch<T> {
     /// assert!(decoded.estimate("apple") >= 1);
     /// ```
     pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
         let header_size = PREAMBLE_LONGS_SHORT as usize * LONG_SIZE_BYTES;
         let value_size = LONG_SIZE_BYTES;
-        let payload_size = if self.is_empty() {
+        let payload_size = if self.has_empty_image() {
             0
         } else {
             value_size + (self.counts.len() * value_size)
         };
-        let mut bytes = SketchBytes::with_capacity(header_size + payload_size);
+        header_size + payload_size
+    }
+
+    /// Returns the size in bytes of the image of a non-empty sketch of the given configuration,
+    /// the most [`serialize`](Self::serialize) produces. Images store every count in 8 bytes,
+    /// whatever the value type.
+    ///
+    /// # Panics
+    ///
+    /// Panics under the same conditions as [`new`](Self::new).
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::countmin::CountMinSketch;
+    /// let max_size = CountMinSketch::<u32>::max_serialized_bytes(4, 128);
+    /// assert_eq!(max_size, 16 + 8 + 8 * 4 * 128);
+    ///
+    /// let mut sketch = CountMinSketch::<u32>::new(4, 128);
+    /// sketch.update("apple");
+    /// assert_eq!(sketch.serialize().len(), max_size);
+    /// ```
+    pub fn max_serialized_bytes(num_hashes: u8, num_buckets: u32) -> usize {
+        let entries = entries_for_config(num_hashes, num_buckets);
+        PREAMBLE_LONGS_SHORT as usize * LONG_SIZE_BYTES + LONG_SIZE_BYTES * (1 + entries)
+    }
+
+    /// Serializes this sketch into `buf`, returning the number of bytes written.
+    ///
+    /// The image is the one [`serialize`](Self::serialize) returns; writing it into a reused
+    /// buffer avoids allocating a `Vec` per sketch.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `buf` is shorter than [`serialized_size_bytes`].
+    ///
+    /// [`serialized_size_bytes`]: Self::serialized_size_bytes
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::countmin::CountMinSketch;
+    /// # let mut sketch = CountMinSketch::<i64>::new(4, 128);
+    /// # sketch.update("apple");
+    /// let mut buf = vec![0; sketch.serialized_size_bytes()];
+    /// sketch.serialize_into(&mut buf).unwrap();
+    /// assert_eq!(buf, sketch.serialize());
+    /// ```
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Writes the serialized sketch to `writer`.
+    ///
+    /// This streams the image [`serialize`](Self::serialize) returns in chunks instead of
+    /// assembling it in memory first.
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
 
+    /// Returns whether the sketch serializes to the short image that omits the counters.
+    fn has_empty_image(&self) -> bool {
+        self.is_empty() && self.counts.len() <= MAX_EMPTY_IMAGE_ENTRIES
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
         bytes.write_u8(PREAMBLE_LONGS_SHORT);
         bytes.write_u8(SERIAL_VERSION);
         bytes.write_u8(Family::COUNTMIN.id);
-        bytes.write_u8(if self.is_empty() { FLAGS_IS_EMPTY } else { 0 });
+        let has_empty_image = self.has_empty_image();
+        bytes.write_u8(if has_empty_image { FLAGS_IS_EMPTY } else { 0 });
         bytes.write_u32_le(0); // unused
 
         bytes.write_u32_le(self.num_buckets);
@@ -292,15 +421,14 @@ impl<T: CountMinValue> CountMinSketch<T> {
         bytes.write_u16_le(self.seed_hash);
         bytes.write_u8(0);
 
-        if self.is_empty() {
-            return bytes.into_bytes();
+        if has_empty_image {
+            return;
         }
 
         bytes.write(&self.total_weight.to_bytes());
         for count in &self.counts {
             bytes.write(&count.to_bytes());
         }
-        bytes.into_bytes()
     }
 
     /// Deserializes a sketch from bytes using the default seed.
@@ -319,6 +447,19 @@ impl<T: CountMinValue> CountMinSketch<T> {
         Self::deserialize_with_seed(bytes, DEFAULT_UPDATE_SEED)
     }
 
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// Exactly the bytes of one image are consumed, so several sketches can be read back from
+    /// the same stream.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader), DEFAULT_UPDATE_SEED)
+    }
+
     /// Deserializes a sketch from bytes using the provided seed.
     ///
     /// # Examples
@@ -332,6 +473,20 @@ impl<T: CountMinValue> CountMinSketch<T> {
     /// assert!(decoded.estimate("apple") >= 1);
     /// ```
     pub fn deserialize_with_seed(bytes: &[u8], seed: u64) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes), seed)
+    }
+
+    /// Reads a sketch written with `seed` by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as
+    /// [`deserialize_with_seed`](Self::deserialize_with_seed) and [`read_from`](Self::read_from).
+    pub fn read_from_with_seed(reader: &mut impl Read, seed: u64) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader), seed)
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>, seed: u64) -> Result<Self, Error> {
         fn read_value<T: CountMinValue>(
             cursor: &mut SketchSlice<'_>,
             tag: &'static str,
@@ -341,7 +496,6 @@ impl<T: CountMinValue> CountMinSketch<T> {
             T::try_from_bytes(bs)
         }
 
-        let mut cursor = SketchSlice::new(bytes);
         let preamble_longs = cursor
             .read_u8()
             .map_err(insufficient_data("preamble_longs"))?;
@@ -368,22 +522,35 @@ impl<T: CountMinValue> CountMinSketch<T> {
         cursor.read_u8().map_err(insufficient_data("unused8"))?;
 
         let expected_seed_hash = compute_seed_hash(seed);
-        if seed_hash != expected_seed_hash {
-            return Err(Error::deserial(format!(
-                "incompatible seed hash: expected {expected_seed_hash}, got {seed_hash}",
-            )));
-        }
+        ensure_seed_hash_is(expected_seed_hash, seed_hash)?;
 
         let entries = entries_for_config_checked(num_hashes, num_buckets)?;
-        let mut sketch = Self::make(num_hashes, num_buckets, seed, entries);
         if (flags & FLAGS_IS_EMPTY) != 0 {
+            if entries > MAX_EMPTY_IMAGE_ENTRIES {
+                return Err(Error::deserial(format!(
+                    "invalid num_hashes and num_buckets: an empty image holds at most \
+                     {MAX_EMPTY_IMAGE_ENTRIES} counters, got {entries}"
+                )));
+            }
+            let mut counts = Vec::new();
+            counts.try_reserve_exact(entries).map_err(|_| {
+                Error::deserial(format!("cannot allocate a table of {entries} counters"))
+            })?;
+            counts.resize(entries, T::ZERO);
+            let mut sketch = Self::make(num_hashes, num_buckets, seed, 0);
+            sketch.counts = counts;
             return Ok(sketch);
         }
 
-        sketch.total_weight = read_value(&mut cursor, "total_weight")?;
-        for count in &mut sketch.counts {
-            *count = read_value(&mut cursor, "counts")?;
+        let total_weight = read_value(&mut cursor, "total_weight")?;
+        // read the counters before allocating the table, so a corrupt size fails on short input
+        let mut counts = Vec::with_capacity(cursor.capacity_hint(entries, size_of::<T>()));
+        for _ in 0..entries {
+            counts.push(read_value(&mut cursor, "counts")?);
         }
+        let mut sketch = Self::make(num_hashes, num_buckets, seed, 0);
+        sketch.total_weight = total_weight;
+        sketch.counts = counts;
         Ok(sketch)
     }
 
@@ -410,7 +577,75 @@ impl<T: CountMinValue> CountMinSketch<T> {
     }
 }
 
+/// Counts every item of the iterator once, as [`CountMinSketch::update`] does.
+impl<T: CountMinValue, I: Hash> Extend<I> for CountMinSketch<T> {
+    fn extend<It: IntoIterator<Item = I>>(&mut self, iter: It) {
+        for item in iter {
+            self.update(item);
+        }
+    }
+}
+
 impl<T: UnsignedCountMinValue> CountMinSketch<T> {
+    /// Updates the sketch with a single occurrence of the item, using conservative update.
+    ///
+    /// See [`update_conservative_with_weight`](Self::update_conservative_with_weight).
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::countmin::CountMinSketch;
+    /// let mut sketch = CountMinSketch::<u64>::new(4, 128);
+    /// sketch.update_conservative("apple");
+    /// assert_eq!(sketch.estimate("apple"), 1);
+    /// ```
+    pub fn update_conservative<I: Hash>(&mut self, item: I) {
+        self.update_conservative_with_weight(item, T::ONE);
+    }
+
+    /// Updates the sketch with the given item and weight, using conservative update.
+    ///
+    /// Instead of adding `weight` to every counter of the item, a conservative update raises
+    /// each of them only as far as the item's new estimate, the smallest counter plus
+    /// `weight`, and leaves the larger ones alone. Estimates stay upper bounds of the true
+    /// frequencies, so the bounds still hold, but collisions with heavy items inflate them
+    /// much less. This relies on counters never decreasing, hence unsigned weights only.
+    ///
+    /// Sketches updated conservatively can be merged with each other and with plainly updated
+    /// sketches of the same configuration.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::countmin::CountMinSketch;
+    /// let mut plain = CountMinSketch::<u64>::new(2, 16);
+    /// let mut conservative = CountMinSketch::<u64>::new(2, 16);
+    /// for i in 0..100_u64 {
+    ///     plain.update_with_weight(i, 10);
+    ///     conservative.update_conservative_with_weight(i, 10);
+    /// }
+    /// assert!(conservative.estimate(7_u64) >= 10);
+    /// assert!(conservative.estimate(7_u64) <= plain.estimate(7_u64));
+    /// ```
+    pub fn update_conservative_with_weight<I: Hash>(&mut self, item: I, weight: T) {
+        if weight == T::ZERO {
+            return;
+        }
+        self.total_weight = self.total_weight + weight;
+        let num_buckets = self.num_buckets as usize;
+        let mut indices = [0usize; u8::MAX as usize];
+        let indices = &mut indices[..self.hash_seeds.len()];
+        let mut min = T::MAX;
+        for (row, (index, seed)) in indices.iter_mut().zip(&self.hash_seeds).enumerate() {
+            *index = row * num_buckets + self.bucket_index(&item, *seed);
+            min = min.min(self.counts[*index]);
+        }
+        let estimate = min + weight;
+        for &index in indices.iter() {
+            self.counts[index] = self.counts[index].max(estimate);
+        }
+    }
+
     /// Divides every counter by two, truncating toward zero.
     ///
     /// Useful for exponential decay where counts represent recent activity.
@@ -501,3 +736,9 @@ fn make_hash_seeds(seed: u64, num_hashes: u8) -> Vec<u64> {
     }
     seeds
 }
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!([T: CountMinValue] CountMinSketch<T>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([T: CountMinValue] CountMinSketch<T>);
+impl_fingerprint_via_image!([T: CountMinValue] CountMinSketch<T>);
@@ -28,6 +28,7 @@ use crate::cpc::compression_data::LENGTH_LIMITED_UNARY_ENCODING_TABLE65;
 use crate::cpc::determine_correct_offset;
 use crate::cpc::determine_flavor;
 use crate::cpc::pair_table::PairTable;
+use crate::error::Error;
 
 #[derive(Default)]
 pub(super) struct CompressedState {
@@ -355,46 +356,48 @@ pub(super) struct UncompressedState {
 }
 
 impl CompressedState {
-    pub fn uncompress(&self, lg_k: u8, num_coupons: u32) -> UncompressedState {
-        match determine_flavor(lg_k, num_coupons) {
+    /// Decodes the compressed table and window.
+    ///
+    /// The caller has already checked that the table and window presence matches the flavor,
+    /// but their contents come straight from the serialized image and are validated here.
+    pub fn uncompress(&self, lg_k: u8, num_coupons: u32) -> Result<UncompressedState, Error> {
+        Ok(match determine_flavor(lg_k, num_coupons) {
             Flavor::Empty => UncompressedState {
                 table: PairTable::new(2, lg_k + 6),
                 window: vec![],
             },
-            Flavor::Sparse => self.uncompress_sparse_flavor(lg_k),
-            Flavor::Hybrid => self.uncompress_hybrid_flavor(lg_k),
-            Flavor::Pinned => self.uncompress_pinned_flavor(lg_k, num_coupons),
-            Flavor::Sliding => self.uncompress_sliding_flavor(lg_k, num_coupons),
-        }
+            Flavor::Sparse => self.uncompress_sparse_flavor(lg_k)?,
+            Flavor::Hybrid => self.uncompress_hybrid_flavor(lg_k)?,
+            Flavor::Pinned => self.uncompress_pinned_flavor(lg_k, num_coupons)?,
+            Flavor::Sliding => self.uncompress_sliding_flavor(lg_k, num_coupons)?,
+        })
     }
 
-    fn uncompress_sparse_flavor(&self, lg_k: u8) -> UncompressedState {
+    fn uncompress_sparse_flavor(&self, lg_k: u8) -> Result<UncompressedState, Error> {
         debug_assert!(self.window_data.is_empty(), "window is not expected");
-        debug_assert!(!self.table_data.is_empty(), "table is expected");
 
         let pairs = uncompress_surprising_values(
             &self.table_data,
             self.table_data_words,
             self.table_num_entries,
             lg_k,
-        );
+        )?;
 
-        UncompressedState {
+        Ok(UncompressedState {
             table: PairTable::from_slots(lg_k, self.table_num_entries, pairs),
             window: vec![],
-        }
+        })
     }
 
-    fn uncompress_hybrid_flavor(&self, lg_k: u8) -> UncompressedState {
+    fn uncompress_hybrid_flavor(&self, lg_k: u8) -> Result<UncompressedState, Error> {
         debug_assert!(self.window_data.is_empty(), "window is not expected");
-        debug_assert!(!self.table_data.is_empty(), "table is expected");
 
         let mut pairs = uncompress_surprising_values(
             &self.table_data,
             self.table_data_words,
             self.table_num_entries,
             lg_k,
-        );
+        )?;
 
         // In the hybrid flavor, some of these pairs actually belong in the window, so we will
         // separate them out, moving the "true" pairs to the bottom of the array.
@@ -403,7 +406,6 @@ impl CompressedState {
         let mut next_true_pair = 0;
         for i in 0..self.table_num_entries {
             let row_col = pairs[i as usize];
-            assert_ne!(row_col, u32::MAX);
             let col = row_col & 63;
             if col < 8 {
                 let row = row_col >> 6;
@@ -414,15 +416,17 @@ impl CompressedState {
             }
         }
 
-        UncompressedState {
+        Ok(UncompressedState {
             table: PairTable::from_slots(lg_k, next_true_pair, pairs),
             window,
-        }
+        })
     }
 
-    fn uncompress_pinned_flavor(&self, lg_k: u8, num_coupons: u32) -> UncompressedState {
-        debug_assert!(!self.window_data.is_empty(), "window is expected");
-
+    fn uncompress_pinned_flavor(
+        &self,
+        lg_k: u8,
+        num_coupons: u32,
+    ) -> Result<UncompressedState, Error> {
         let mut window = vec![];
         uncompress_sliding_window(
             &self.window_data,
@@ -430,36 +434,37 @@ impl CompressedState {
             &mut window,
             lg_k,
             num_coupons,
-        );
+        )?;
         let num_pairs = self.table_num_entries;
         let table = if num_pairs == 0 {
             PairTable::new(2, lg_k + 6)
         } else {
-            debug_assert!(!self.table_data.is_empty(), "table is expected");
             let mut pairs = uncompress_surprising_values(
                 &self.table_data,
                 self.table_data_words,
                 num_pairs,
                 lg_k,
-            );
+            )?;
             // undo the compressor's 8-column shift
-            for i in 0..num_pairs {
-                let i = i as usize;
-                assert!(
-                    (pairs[i] & 63) < 56,
-                    "pair column index is invalid: {}",
-                    pairs[i]
-                );
-                pairs[i] += 8;
+            for pair in pairs.iter_mut() {
+                if (*pair & 63) >= 56 {
+                    return Err(Error::deserial(format!(
+                        "pair column index is invalid: {}",
+                        *pair & 63
+                    )));
+                }
+                *pair += 8;
             }
             PairTable::from_slots(lg_k, num_pairs, pairs)
         };
-        UncompressedState { table, window }
+        Ok(UncompressedState { table, window })
     }
 
-    fn uncompress_sliding_flavor(&self, lg_k: u8, num_coupons: u32) -> UncompressedState {
-        debug_assert!(!self.window_data.is_empty(), "window is expected");
-
+    fn uncompress_sliding_flavor(
+        &self,
+        lg_k: u8,
+        num_coupons: u32,
+    ) -> Result<UncompressedState, Error> {
         let mut window = vec![];
         uncompress_sliding_window(
             &self.window_data,
@@ -467,38 +472,45 @@ impl CompressedState {
             &mut window,
             lg_k,
             num_coupons,
-        );
+        )?;
         let num_pairs = self.table_num_entries;
         let table = if num_pairs == 0 {
             PairTable::new(2, lg_k + 6)
         } else {
-            debug_assert!(!self.table_data.is_empty(), "table is expected");
             let mut pairs = uncompress_surprising_values(
                 &self.table_data,
                 self.table_data_words,
                 num_pairs,
                 lg_k,
-            );
+            )?;
             let pseudo_phase = determine_pseudo_phase(lg_k, num_coupons);
             let permutation = &COLUMN_PERMUTATIONS_FOR_DECODING[pseudo_phase as usize];
             let offset = determine_correct_offset(lg_k, num_coupons);
-            assert!(offset <= 56, "offset is invalid: {offset}");
+            if offset > 56 {
+                return Err(Error::deserial(format!(
+                    "window offset is invalid: {offset}"
+                )));
+            }
 
-            for i in 0..num_pairs {
-                let i = i as usize;
-                let row_col = pairs[i];
-                let row = row_col >> 6;
-                let mut col = (row_col & 63) as u8;
+            for pair in pairs.iter_mut() {
+                let row = *pair >> 6;
+                let mut col = (*pair & 63) as u8;
+                // the compressor only emits columns outside the window
+                if col >= 56 {
+                    return Err(Error::deserial(format!(
+                        "pair column index is invalid: {col}"
+                    )));
+                }
                 // first undo the permutation
                 col = permutation[col as usize];
                 // then undo the rotation: old = (new + (offset+8)) mod 64
                 col = (col + (offset + 8)) & 63;
-                pairs[i] = (row << 6) | (col as u32);
+                *pair = (row << 6) | (col as u32);
             }
 
             PairTable::from_slots(lg_k, num_pairs, pairs)
         };
-        UncompressedState { table, window }
+        Ok(UncompressedState { table, window })
     }
 }
 
@@ -507,12 +519,12 @@ fn uncompress_surprising_values(
     data_words: usize,
     num_pairs: u32,
     lg_k: u8,
-) -> Vec<u32> {
+) -> Result<Vec<u32>, Error> {
     let k = 1 << lg_k;
     let mut pairs = vec![0; num_pairs as usize];
     let num_base_bits = golomb_choose_number_of_base_bits(k + num_pairs, num_pairs as u64);
-    low_level_uncompress_pairs(&mut pairs, num_pairs, num_base_bits, data, data_words);
-    pairs
+    low_level_uncompress_pairs(&mut pairs, num_base_bits, lg_k, &data[..data_words])?;
+    Ok(pairs)
 }
 
 fn uncompress_sliding_window(
@@ -521,31 +533,29 @@ fn uncompress_sliding_window(
     window: &mut Vec<u8>,
     lg_k: u8,
     num_coupons: u32,
-) {
+) -> Result<(), Error> {
     let k = 1 << lg_k;
     window.resize(k, 0);
     let pseudo_phase = determine_pseudo_phase(lg_k, num_coupons);
     low_level_uncompress_bytes(
         window,
-        k as u32,
-        data,
-        data_words,
+        &data[..data_words],
         &DECODING_TABLES_FOR_HIGH_ENTROPY_BYTE[pseudo_phase as usize],
-    );
+    )
 }
 
+/// Decodes `pairs.len()` row/column pairs, rejecting any that fall outside the `k` by 64 matrix.
 fn low_level_uncompress_pairs(
     pairs: &mut [u32],
-    num_pairs_to_decode: u32,
     num_base_bits: u8,
+    lg_k: u8,
     compressed_words: &[u32],
-    num_compressed_words: usize,
-) {
+) -> Result<(), Error> {
     let mut word_index = 0;
     let mut bitbuf = 0;
     let mut bufbits = 0;
     let golomb_lo_mask = (1 << num_base_bits) - 1;
-    let mut predicted_row_index = 0u32;
+    let mut predicted_row_index = 0u64;
     let mut predicted_col_index = 0u8;
 
     // for each pair we need to read:
@@ -553,7 +563,7 @@ fn low_level_uncompress_pairs(
     // y_delta_hi (unary)
     // y_delta_lo (basebits)
 
-    for pair_index in 0..num_pairs_to_decode {
+    for pair in pairs.iter_mut() {
         // ensure 12 bits in bit buffer
         maybe_fill_bitbuf(
             &mut bitbuf,
@@ -561,7 +571,7 @@ fn low_level_uncompress_pairs(
             compressed_words,
             &mut word_index,
             12,
-        );
+        )?;
         let peek12 = bitbuf & 0xfff;
         let lookup = LENGTH_LIMITED_UNARY_DECODING_TABLE65[peek12 as usize];
         let code_word_length = (lookup >> 8) as u8;
@@ -569,7 +579,7 @@ fn low_level_uncompress_pairs(
         bitbuf >>= code_word_length;
         bufbits -= code_word_length;
 
-        let golomb_hi = read_unary(compressed_words, &mut word_index, &mut bitbuf, &mut bufbits);
+        let golomb_hi = read_unary(compressed_words, &mut word_index, &mut bitbuf, &mut bufbits)?;
         // ensure num_base_bits in the bit buffer
         maybe_fill_bitbuf(
             &mut bitbuf,
@@ -577,11 +587,13 @@ fn low_level_uncompress_pairs(
             compressed_words,
             &mut word_index,
             num_base_bits,
-        );
+        )?;
         let golomb_lo = bitbuf & golomb_lo_mask;
         bitbuf >>= num_base_bits;
         bufbits -= num_base_bits;
-        let y_delta = ((golomb_hi << num_base_bits) | golomb_lo) as u32;
+
+        // golomb_hi is bounded by the number of compressed bits, so this cannot overflow
+        let y_delta = (golomb_hi << num_base_bits) | golomb_lo;
 
         // Now that we have x_delta and y_delta, we can compute the pair's row and column
         if y_delta > 0 {
@@ -589,30 +601,28 @@ fn low_level_uncompress_pairs(
         }
         let row_index = predicted_row_index + y_delta;
         let col_index = predicted_col_index + x_delta;
-        let row_col = (row_index << 6) | (col_index as u32);
-        pairs[pair_index as usize] = row_col;
-        predicted_row_index = row_index;
+        if row_index >> lg_k != 0 || col_index >= 64 {
+            return Err(Error::deserial("surprising value is outside the matrix"));
+        }
+        let row_index = row_index as u32;
+        *pair = (row_index << 6) | (col_index as u32);
+        predicted_row_index = row_index as u64;
         predicted_col_index = col_index + 1;
     }
 
-    debug_assert!(
-        word_index <= num_compressed_words,
-        "word_index: {word_index}, num_compressed_words: {num_compressed_words}",
-    );
+    Ok(())
 }
 
 fn low_level_uncompress_bytes(
     byte_array: &mut [u8],
-    num_bytes_to_decode: u32,
     compressed_words: &[u32],
-    num_compressed_words: usize,
     decoding_table: &[u16],
-) {
+) -> Result<(), Error> {
     let mut word_index = 0;
     let mut bitbuf = 0;
     let mut bufbits = 0;
 
-    for byte_index in 0..num_bytes_to_decode {
+    for byte in byte_array.iter_mut() {
         // ensure 12 bits in bit buffer
         maybe_fill_bitbuf(
             &mut bitbuf,
@@ -620,45 +630,42 @@ fn low_level_uncompress_bytes(
             compressed_words,
             &mut word_index,
             12,
-        );
+        )?;
         // These 12 bits will include an entire Huffman codeword.
         let peek12 = bitbuf & 0xfff;
         let lookup = decoding_table[peek12 as usize];
         let code_word_length = (lookup >> 8) as u8;
-        let decoded_byte = (lookup & 0xff) as u8;
-        byte_array[byte_index as usize] = decoded_byte;
+        *byte = (lookup & 0xff) as u8;
         bitbuf >>= code_word_length;
         bufbits -= code_word_length;
     }
 
-    // Buffer over-run should be impossible unless there is a bug.
-    debug_assert!(
-        word_index <= num_compressed_words,
-        "word_index: {word_index}, num_compressed_words: {num_compressed_words}",
-    );
+    Ok(())
 }
 
 fn determine_pseudo_phase(lg_k: u8, num_coupons: u32) -> u8 {
-    let k = 1 << lg_k;
+    // widen so that the scaled comparisons cannot overflow for large lg_k
+    let k = 1u64 << lg_k;
+    let c = num_coupons as u64;
     // This mid-range logic produces pseudo-phases. They are used to select encoding tables.
     // The thresholds were chosen by hand after looking at plots of measured compression.
-    if 1000 * num_coupons < 2375 * k {
-        if 4 * num_coupons < 3 * k {
+    if 1000 * c < 2375 * k {
+        if 4 * c < 3 * k {
             // mid-range table
             16
-        } else if 10 * num_coupons < 11 * k {
+        } else if 10 * c < 11 * k {
             // mid-range table
             16 + 1
-        } else if 100 * num_coupons < 132 * k {
+        } else if 100 * c < 132 * k {
             // mid-range table
             16 + 2
-        } else if 3 * num_coupons < 5 * k {
+        } else if 3 * c < 5 * k {
             // mid-range table
             16 + 3
-        } else if 1000 * num_coupons < 1965 * k {
+        } else if 1000 * c < 1965 * k {
             // mid-range table
             16 + 4
-        } else if 1000 * num_coupons < 2275 * k {
+        } else if 1000 * c < 2275 * k {
             // mid-range table
             16 + 5
         } else {
@@ -703,18 +710,18 @@ fn read_unary(
     next_word_index: &mut usize,
     bitbuf: &mut u64,
     bufbits: &mut u8,
-) -> u64 {
+) -> Result<u64, Error> {
     let mut subtotal = 0u64;
     loop {
         // ensure 8 bits in bit buffer
-        maybe_fill_bitbuf(bitbuf, bufbits, compressed_words, next_word_index, 8);
+        maybe_fill_bitbuf(bitbuf, bufbits, compressed_words, next_word_index, 8)?;
         // These 8 bits include either all or part of the Unary codeword
         let peek8 = *bitbuf & 0xff;
         let trailing_zeros = peek8.trailing_zeros() as u8;
         if trailing_zeros < 8 {
             *bufbits -= 1 + trailing_zeros;
             *bitbuf >>= 1 + trailing_zeros;
-            return subtotal + trailing_zeros as u64;
+            return Ok(subtotal + trailing_zeros as u64);
         }
         // The codeword was partial, so read some more
         subtotal += 8;
@@ -737,18 +744,25 @@ fn maybe_flush_bitbuf(
     }
 }
 
+/// Refills the bit buffer from `words` when it holds fewer than `minbits` bits.
+///
+/// The compressor pads its output so that a valid stream never needs a word past its end.
 fn maybe_fill_bitbuf(
     bitbuf: &mut u64,
     bufbits: &mut u8,
     words: &[u32],
     word_index: &mut usize,
     minbits: u8,
-) {
+) -> Result<(), Error> {
     if *bufbits < minbits {
-        *bitbuf |= (words[*word_index] as u64) << *bufbits;
+        let word = words
+            .get(*word_index)
+            .ok_or_else(|| Error::insufficient_data("compressed data ended early"))?;
+        *bitbuf |= (*word as u64) << *bufbits;
         *word_index += 1;
         *bufbits += 32;
     }
+    Ok(())
 }
 
 // Explanation of padding: we write
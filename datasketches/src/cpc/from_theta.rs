@@ -0,0 +1,86 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::cpc::CpcSketch;
+use crate::theta::ThetaSketchView;
+use crate::thetacommon::conversion::dropped_hit_probabilities;
+use crate::thetacommon::conversion::hit;
+use crate::thetacommon::conversion::leading_zeros;
+
+impl CpcSketch {
+    /// Builds a CPC sketch with the default seed from the retained hashes of a Theta sketch.
+    ///
+    /// Each retained hash becomes one coupon, with the low bits of the hash as the row and its
+    /// leading zeros as the column. An exact Theta sketch converts without loss beyond that of
+    /// the CPC sketch itself.
+    ///
+    /// A Theta sketch in estimation mode only retains the hashes below theta, which fill the
+    /// columns with the most leading zeros. The columns the dropped hashes would have set in
+    /// each row are drawn at random from a stream of the estimated size, as
+    /// [`HllSketch::from_theta`](crate::hll::HllSketch::from_theta) draws its registers, so
+    /// the conversion is not deterministic. The estimate stays close to that of a CPC sketch
+    /// of the stream, with the error of the Theta estimate added, as long as `lg_k` is at most
+    /// the lg_k of the Theta sketch.
+    ///
+    /// The converted sketch is flagged as merged, so its estimate does not use the HIP
+    /// accumulator. It can be unioned with other sketches converted from Theta sketches of the
+    /// same seed, but not with sketches updated with the items.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `lg_k` is not in the range `[4, 26]`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::cpc::CpcSketch;
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// let mut theta = ThetaSketchBuilder::default().lg_k(12).build();
+    /// theta.extend(0..100_000);
+    ///
+    /// let cpc = CpcSketch::from_theta(&theta, 9);
+    /// assert!((cpc.estimate() - 100_000.0).abs() < 10_000.0);
+    /// ```
+    pub fn from_theta<S: ThetaSketchView>(theta: &S, lg_k: u8) -> Self {
+        let mut sketch = CpcSketch::new(lg_k);
+        let k = 1u64 << lg_k;
+        for entry in theta.iter() {
+            let hash = entry.hash();
+            let col = leading_zeros(hash).min(63);
+            let row = (hash & (k - 1)) as u32;
+            let mut row_col = (row << 6) | col;
+            // avoid the "empty" value of the hash table, as `update` does
+            if row_col == u32::MAX {
+                row_col ^= 1 << 6;
+            }
+            sketch.row_col_update(row_col);
+        }
+
+        let probabilities = dropped_hit_probabilities(theta.theta(), theta.num_retained(), lg_k);
+        for row in 0..k as u32 {
+            for (col, &p) in probabilities.iter().enumerate() {
+                if hit(p) {
+                    sketch.row_col_update((row << 6) | col as u32);
+                }
+            }
+        }
+
+        // retained hashes arrive in hash order, which the HIP accumulator does not allow for
+        sketch.merge_flag = true;
+        sketch
+    }
+}
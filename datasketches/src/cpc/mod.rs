@@ -38,14 +38,18 @@
 mod compression;
 mod compression_data;
 mod estimator;
+#[cfg(feature = "theta")]
+mod from_theta;
 mod kxp_byte_lookup;
 mod pair_table;
 mod serialization;
 mod sketch;
+mod snapshot;
 mod union;
 mod wrapper;
 
 pub use self::sketch::CpcSketch;
+pub use self::snapshot::CpcSnapshot;
 pub use self::union::CpcUnion;
 pub use self::wrapper::CpcWrapper;
 
@@ -74,10 +78,11 @@ fn count_bits_set_in_matrix(matrix: &[u64]) -> u32 {
 }
 
 fn determine_flavor(lg_k: u8, num_coupons: u32) -> Flavor {
-    let k = 1 << lg_k;
-    let c2 = num_coupons << 1;
-    let c8 = num_coupons << 3;
-    let c32 = num_coupons << 5;
+    // widen so that the shifts cannot overflow for large lg_k
+    let k = 1u64 << lg_k;
+    let c2 = (num_coupons as u64) << 1;
+    let c8 = (num_coupons as u64) << 3;
+    let c32 = (num_coupons as u64) << 5;
     if num_coupons == 0 {
         Flavor::Empty
     } else if c32 < (3 * k) {
@@ -24,7 +24,7 @@ const DOWNSIZE_DENOMINATOR: u32 = 4;
 ///
 /// This table stores `(row, col)` pairs and uses linear probing for collision resolution. It is
 /// optimized for scenarios where the cardinality of entries is low.
-#[derive(Debug, Clone)]
+#[derive(Debug, Clone, PartialEq)]
 pub(super) struct PairTable {
     /// log2 of number of slots
     lg_size: u8,
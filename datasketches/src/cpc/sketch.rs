@@ -16,15 +16,27 @@
 // under the License.
 
 use std::hash::Hash;
+use std::io;
+use std::io::Read;
+use std::io::Write;
 
 use crate::codec::SketchBytes;
 use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_lg_k_in;
 use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_seed_hash_is;
 use crate::codec::assert::ensure_serial_version_is;
 use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
 use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::DistinctCountEstimator;
 use crate::common::NumStdDev;
 use crate::common::inv_pow2::inv_pow2;
+use crate::cpc::CpcSnapshot;
 use crate::cpc::DEFAULT_LG_K;
 use crate::cpc::Flavor;
 use crate::cpc::MAX_LG_K;
@@ -53,7 +65,10 @@ use crate::hash::compute_seed_hash;
 /// A Compressed Probabilistic Counting sketch.
 ///
 /// See the [module level documentation](super) for more.
-#[derive(Debug, Clone)]
+///
+/// `==` compares the representation, including the layout of the sparse pair table; see
+/// [`is_equivalent`](Self::is_equivalent) to compare only the retained state.
+#[derive(Debug, Clone, PartialEq)]
 pub struct CpcSketch {
     // immutable config variables
     lg_k: u8,
@@ -169,6 +184,60 @@ impl CpcSketch {
         self.num_coupons == 0
     }
 
+    /// Returns an immutable view of the current estimates.
+    ///
+    /// The snapshot holds the coupon count and the HIP accumulator but no part of the bit
+    /// matrix, so taking one is cheap enough to do on every read. See [`CpcSnapshot`].
+    pub fn snapshot(&self) -> CpcSnapshot {
+        CpcSnapshot::new(
+            self.lg_k,
+            self.num_coupons,
+            self.merge_flag,
+            self.hip_est_accum,
+        )
+    }
+
+    /// Returns true if `other` holds the same coupons as this sketch, however they are stored.
+    ///
+    /// The sketches must have the same lg_k and seed hash and the same bit matrix, and their
+    /// estimates must differ by at most `tolerance` relative to the larger one. The HIP
+    /// estimate depends on the order of the updates, so a sketch recomputed from the stream in
+    /// another order needs a tolerance of about its relative error.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `tolerance` is negative or NaN.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::cpc::CpcSketch;
+    /// let mut sketch = CpcSketch::new(10);
+    /// let mut recomputed = CpcSketch::new(10);
+    /// sketch.extend(0..10000);
+    /// recomputed.extend(0..10000);
+    /// assert!(sketch.is_equivalent(&recomputed, 0.0));
+    ///
+    /// let mut reordered = CpcSketch::new(10);
+    /// reordered.extend((0..10000).rev());
+    /// assert!(sketch.is_equivalent(&reordered, 0.05));
+    /// ```
+    pub fn is_equivalent(&self, other: &CpcSketch, tolerance: f64) -> bool {
+        assert!(
+            tolerance >= 0.0,
+            "tolerance must be non-negative, got {tolerance}"
+        );
+        if self.lg_k != other.lg_k
+            || self.seed_hash != other.seed_hash
+            || self.num_coupons != other.num_coupons
+            || self.build_bit_matrix() != other.build_bit_matrix()
+        {
+            return false;
+        }
+        let (estimate, other_estimate) = (self.estimate(), other.estimate());
+        (estimate - other_estimate).abs() <= tolerance * estimate.max(other_estimate)
+    }
+
     /// Update the sketch with a hashable value.
     ///
     /// You may use [`hash_value`](crate::hash_value) wrappers when matching other datasketches
@@ -453,25 +522,74 @@ impl CpcSketch {
 
     /// Returns the estimated size of the sketch in bytes
     pub fn estimated_size(&self) -> usize {
-        let heap_size = self.sliding_window.capacity()
+        size_of::<Self>() + self.heap_size()
+    }
+
+    /// Returns the size of the sliding window and the surprising value table in bytes.
+    pub(super) fn heap_size(&self) -> usize {
+        self.sliding_window.capacity()
             + self
                 .surprising_value_table
                 .as_ref()
                 .map(|t| t.estimated_size())
-                .unwrap_or(0);
-
-        size_of::<Self>() + heap_size
+                .unwrap_or(0)
     }
 }
 
 impl CpcSketch {
     /// Serializes this CpcSketch to bytes.
     pub fn serialize(&self) -> Vec<u8> {
-        let mut bytes = SketchBytes::with_capacity(256);
+        let compressed = self.compressed();
+        let mut bytes = SketchBytes::with_capacity(self.image_size(&compressed));
+        self.write_image(&mut bytes, &compressed);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    ///
+    /// The size depends on how well the sketch compresses, so this compresses the sketch just as
+    /// serializing does.
+    pub fn serialized_size_bytes(&self) -> usize {
+        self.image_size(&self.compressed())
+    }
+
+    /// Serializes this CpcSketch into `buf`, returning the number of bytes written.
+    ///
+    /// Writes the same image as [`serialize`](Self::serialize). Returns an error if `buf` is
+    /// shorter than [`serialized_size_bytes`](Self::serialized_size_bytes).
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        let compressed = self.compressed();
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes, &compressed))
+    }
 
+    /// Streams this CpcSketch to `writer` in the format of [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        let compressed = self.compressed();
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes, &compressed))
+    }
+
+    fn compressed(&self) -> CompressedState {
         let mut compressed = CompressedState::default();
         compressed.compress(self);
+        compressed
+    }
 
+    fn image_size(&self, compressed: &CompressedState) -> usize {
+        let has_hip = !self.merge_flag;
+        let has_table = !compressed.table_data.is_empty();
+        let has_window = !compressed.window_data.is_empty();
+        let preamble_ints = make_preamble_ints(self.num_coupons, has_hip, has_table, has_window);
+        let data_words = if self.is_empty() {
+            0
+        } else {
+            compressed.window_data_words + compressed.table_data_words
+        };
+        4 * (preamble_ints as usize + data_words)
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes, compressed: &CompressedState) {
         let has_hip = !self.merge_flag;
         let has_table = !compressed.table_data.is_empty();
         let has_window = !compressed.window_data.is_empty();
@@ -496,7 +614,7 @@ impl CpcSketch {
                 // HIP values can be in two different places in the sequence of fields
                 // this is the first HIP decision point
                 if has_hip {
-                    self.write_hip(&mut bytes);
+                    self.write_hip(bytes);
                 }
             }
             if has_table {
@@ -509,7 +627,7 @@ impl CpcSketch {
             }
             // this is the second HIP decision point
             if has_hip && !(has_table && has_window) {
-                self.write_hip(&mut bytes);
+                self.write_hip(bytes);
             }
             if has_window {
                 for i in 0..compressed.window_data_words {
@@ -522,7 +640,6 @@ impl CpcSketch {
                 }
             }
         }
-        bytes.into_bytes()
     }
 
     /// Deserializes a CpcSketch from bytes.
@@ -530,9 +647,25 @@ impl CpcSketch {
         Self::deserialize_with_seed(bytes, DEFAULT_UPDATE_SEED)
     }
 
+    /// Reads a CpcSketch from `reader`, consuming exactly the bytes of its image.
+    ///
+    /// Fails like [`deserialize`](Self::deserialize); a failing `reader` is reported as
+    /// insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_from_with_seed(reader, DEFAULT_UPDATE_SEED)
+    }
+
+    /// Reads a CpcSketch from `reader` with the provided seed.
+    pub fn read_from_with_seed(reader: &mut impl Read, seed: u64) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader), seed)
+    }
+
     /// Deserializes a CpcSketch from bytes with the provided seed.
     pub fn deserialize_with_seed(bytes: &[u8], seed: u64) -> Result<Self, Error> {
-        let mut cursor = SketchSlice::new(bytes);
+        Self::read_image(SketchSlice::new(bytes), seed)
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>, seed: u64) -> Result<Self, Error> {
         let preamble_ints = cursor
             .read_u8()
             .map_err(insufficient_data("preamble_ints"))?;
@@ -625,22 +758,8 @@ impl CpcSketch {
         let expected_preamble_ints =
             make_preamble_ints(num_coupons, has_hip, has_table, has_window);
         ensure_preamble_longs_in(&[expected_preamble_ints], preamble_ints)?;
-        if seed_hash != compute_seed_hash(seed) {
-            return Err(Error::new(
-                ErrorKind::InvalidData,
-                format!(
-                    "seed hash mismatch: expected {}, got {}",
-                    compute_seed_hash(seed),
-                    seed_hash
-                ),
-            ));
-        }
-        if !(MIN_LG_K..=MAX_LG_K).contains(&lg_k) {
-            return Err(Error::invalid_argument(format!(
-                "lg_k out of range; got {}",
-                lg_k
-            )));
-        }
+        ensure_seed_hash_is(compute_seed_hash(seed), seed_hash)?;
+        ensure_lg_k_in(MIN_LG_K, MAX_LG_K, lg_k)?;
         if first_interesting_column > 63 {
             return Err(Error::invalid_argument(format!(
                 "first_interesting_column out of range; got {}",
@@ -648,7 +767,62 @@ impl CpcSketch {
             )));
         }
 
-        let uncompressed = compressed.uncompress(lg_k, num_coupons);
+        if num_coupons as u64 > (1u64 << lg_k) * 64 {
+            return Err(Error::deserial(format!(
+                "num_coupons exceeds the number of bits in the matrix; got {num_coupons}"
+            )));
+        }
+        // every surprising value takes at least one bit of the compressed table
+        if compressed.table_num_entries > num_coupons
+            || compressed.table_num_entries as u64 > compressed.table_data_words as u64 * 32
+        {
+            return Err(Error::deserial(format!(
+                "table_num_entries is inconsistent with the table data; got {}",
+                compressed.table_num_entries
+            )));
+        }
+
+        let expects_window = match determine_flavor(lg_k, num_coupons) {
+            Flavor::Empty => None,
+            Flavor::Sparse | Flavor::Hybrid => Some(false),
+            Flavor::Pinned | Flavor::Sliding => Some(true),
+        };
+        let flags_match = match expects_window {
+            None => !has_table && !has_window,
+            Some(false) => has_table && !has_window,
+            Some(true) => has_window,
+        };
+        if !flags_match {
+            return Err(Error::deserial(format!(
+                "table and window flags do not match {num_coupons} coupons at lg_k {lg_k}"
+            )));
+        }
+
+        let uncompressed = compressed.uncompress(lg_k, num_coupons)?;
+        // Columns below the window offset are implicitly full; table entries there are
+        // surprising zeros, while entries above the window are surprising ones.
+        let window_offset = determine_correct_offset(lg_k, num_coupons);
+        let mut decoded = (1u64 << lg_k) * window_offset as u64;
+        decoded += uncompressed
+            .window
+            .iter()
+            .map(|b| b.count_ones() as u64)
+            .sum::<u64>();
+        for &slot in uncompressed.table.slots() {
+            if slot != u32::MAX {
+                if ((slot & 63) as u8) < window_offset {
+                    decoded = decoded.wrapping_sub(1);
+                } else {
+                    decoded += 1;
+                }
+            }
+        }
+        if decoded != num_coupons as u64 {
+            return Err(Error::deserial(format!(
+                "expected {num_coupons} coupons, decoded {}",
+                decoded as i64
+            )));
+        }
         Ok(CpcSketch {
             lg_k,
             seed,
@@ -656,7 +830,7 @@ impl CpcSketch {
             first_interesting_column,
             num_coupons,
             surprising_value_table: Some(uncompressed.table),
-            window_offset: determine_correct_offset(lg_k, num_coupons),
+            window_offset,
             sliding_window: uncompressed.window,
             merge_flag: !has_hip,
             kxp,
@@ -741,3 +915,49 @@ impl CpcSketch {
         self.num_coupons
     }
 }
+
+/// Updates the sketch with every value of the iterator, as [`CpcSketch::update`] does.
+impl<T: Hash> Extend<T> for CpcSketch {
+    fn extend<I: IntoIterator<Item = T>>(&mut self, iter: I) {
+        for value in iter {
+            self.update(value);
+        }
+    }
+}
+
+/// Collects the values into a sketch with the default lg_k and seed.
+impl<T: Hash> FromIterator<T> for CpcSketch {
+    fn from_iter<I: IntoIterator<Item = T>>(iter: I) -> Self {
+        let mut sketch = CpcSketch::default();
+        sketch.extend(iter);
+        sketch
+    }
+}
+
+impl DistinctCountEstimator for CpcSketch {
+    fn is_empty(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn is_exact(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn estimate(&self) -> f64 {
+        self.estimate()
+    }
+
+    fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.lower_bound(num_std_dev)
+    }
+
+    fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.upper_bound(num_std_dev)
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(CpcSketch);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(CpcSketch);
+impl_fingerprint_via_image!(CpcSketch);
@@ -0,0 +1,127 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::common::DistinctCountEstimator;
+use crate::common::NumStdDev;
+use crate::cpc::estimator::estimate;
+use crate::cpc::estimator::lower_bound;
+use crate::cpc::estimator::upper_bound;
+
+/// An immutable view of the estimates of a [`CpcSketch`](crate::cpc::CpcSketch) at one point in
+/// time.
+///
+/// Both the HIP and the ICON estimators of CPC only need the number of coupons and the HIP
+/// accumulator, so a snapshot is a copy of those values without the bit matrix. It can be
+/// taken as often as a reader needs it and is queried without touching the sketch again.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::common::NumStdDev;
+/// # use datasketches::cpc::CpcSketch;
+/// let mut sketch = CpcSketch::new(11);
+/// sketch.extend(0..10000);
+/// let snapshot = sketch.snapshot();
+/// sketch.extend(10000..20000);
+///
+/// assert!(snapshot.lower_bound(NumStdDev::Two) <= 10000.0);
+/// assert!(snapshot.upper_bound(NumStdDev::Two) >= 10000.0);
+/// assert!(sketch.estimate() > snapshot.estimate());
+/// ```
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct CpcSnapshot {
+    lg_k: u8,
+    num_coupons: u32,
+    merge_flag: bool,
+    hip_est_accum: f64,
+}
+
+impl CpcSnapshot {
+    pub(super) fn new(lg_k: u8, num_coupons: u32, merge_flag: bool, hip_est_accum: f64) -> Self {
+        Self {
+            lg_k,
+            num_coupons,
+            merge_flag,
+            hip_est_accum,
+        }
+    }
+
+    /// Returns the lg_k of the sketch.
+    pub fn lg_k(&self) -> u8 {
+        self.lg_k
+    }
+
+    /// Returns true if the sketch was empty.
+    pub fn is_empty(&self) -> bool {
+        self.num_coupons == 0
+    }
+
+    /// Returns the cardinality estimate, as
+    /// [`CpcSketch::estimate`](crate::cpc::CpcSketch::estimate).
+    pub fn estimate(&self) -> f64 {
+        estimate(
+            self.merge_flag,
+            self.hip_est_accum,
+            self.lg_k,
+            self.num_coupons,
+        )
+    }
+
+    /// Returns the lower bound of the confidence interval given `kappa`.
+    pub fn lower_bound(&self, kappa: NumStdDev) -> f64 {
+        lower_bound(
+            self.merge_flag,
+            self.hip_est_accum,
+            self.lg_k,
+            self.num_coupons,
+            kappa,
+        )
+    }
+
+    /// Returns the upper bound of the confidence interval given `kappa`.
+    pub fn upper_bound(&self, kappa: NumStdDev) -> f64 {
+        upper_bound(
+            self.merge_flag,
+            self.hip_est_accum,
+            self.lg_k,
+            self.num_coupons,
+            kappa,
+        )
+    }
+}
+
+impl DistinctCountEstimator for CpcSnapshot {
+    fn is_empty(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn is_exact(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn estimate(&self) -> f64 {
+        self.estimate()
+    }
+
+    fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.lower_bound(num_std_dev)
+    }
+
+    fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.upper_bound(num_std_dev)
+    }
+}
@@ -61,12 +61,21 @@
 //! which requires doing some extra work to figure out the values of num_coupons, offset,
 //! first_interesting_column, and kxp.
 
+use std::borrow::Borrow;
+use std::iter::Sum;
+
+#[cfg(feature = "aggregator")]
+use crate::aggregator::ImageUnion;
+use crate::common::MergeableSketch;
+#[cfg(feature = "rayon")]
+use crate::common::parallel::tree_reduce;
 use crate::cpc::CpcSketch;
 use crate::cpc::DEFAULT_LG_K;
 use crate::cpc::Flavor;
 use crate::cpc::count_bits_set_in_matrix;
 use crate::cpc::determine_correct_offset;
 use crate::cpc::pair_table::PairTable;
+use crate::error::Error;
 use crate::hash::DEFAULT_UPDATE_SEED;
 
 /// The union (merge) operation for the CPC sketches.
@@ -108,6 +117,67 @@ impl CpcUnion {
         Self { lg_k, seed, state }
     }
 
+    /// Union a collection of serialized sketches written with the default seed in parallel.
+    ///
+    /// See [`par_union_serialized_with_seed`](Self::par_union_serialized_with_seed).
+    #[cfg(feature = "rayon")]
+    pub fn par_union_serialized<B>(lg_k: u8, images: &[B]) -> Result<Self, Error>
+    where
+        B: AsRef<[u8]> + Sync,
+    {
+        Self::par_union_serialized_with_seed(lg_k, DEFAULT_UPDATE_SEED, images)
+    }
+
+    /// Union a collection of serialized sketches in parallel.
+    ///
+    /// The images are merged in a tree reduction on the rayon thread pool: chunks of images
+    /// are deserialized and merged into partial unions, which are then merged pairwise. The
+    /// first image that fails to deserialize, including one written with another seed, is
+    /// reported as an error.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `lg_k` is not in the range `[4, 26]`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::cpc::CpcSketch;
+    /// # use datasketches::cpc::CpcUnion;
+    /// let images: Vec<Vec<u8>> = (0..100)
+    ///     .map(|p| {
+    ///         let mut sketch = CpcSketch::new(10);
+    ///         sketch.update(&p);
+    ///         sketch.serialize()
+    ///     })
+    ///     .collect();
+    ///
+    /// let union = CpcUnion::par_union_serialized(10, &images).unwrap();
+    /// assert_eq!(union.to_sketch().estimate().round(), 100.0);
+    /// ```
+    #[cfg(feature = "rayon")]
+    pub fn par_union_serialized_with_seed<B>(
+        lg_k: u8,
+        seed: u64,
+        images: &[B],
+    ) -> Result<Self, Error>
+    where
+        B: AsRef<[u8]> + Sync,
+    {
+        let leaf = |chunk: &[B]| {
+            let mut union = CpcUnion::with_seed(lg_k, seed);
+            for image in chunk {
+                union.update(&CpcSketch::deserialize_with_seed(image.as_ref(), seed)?);
+            }
+            Ok(union)
+        };
+        let combine = |mut left: CpcUnion, right: CpcUnion| {
+            left.update(&right.to_sketch());
+            Ok(left)
+        };
+        tree_reduce(images, &leaf, &combine)
+    }
+
     /// Return the parameter lg_k.
     ///
     /// Note that due to merging with source sketches that may have a lower value of lg_k, this
@@ -116,6 +186,18 @@ impl CpcUnion {
         self.lg_k
     }
 
+    /// Returns the estimated size of the union in bytes
+    ///
+    /// Once the union has absorbed a sketch past the sliding-window flavor, it holds a full
+    /// bit matrix of `k` words.
+    pub fn estimated_size(&self) -> usize {
+        let heap_size = match &self.state {
+            UnionState::Accumulator(sketch) => sketch.heap_size(),
+            UnionState::BitMatrix(matrix) => matrix.capacity() * size_of::<u64>(),
+        };
+        size_of::<Self>() + heap_size
+    }
+
     /// Get the union result as a new sketch.
     ///
     /// # Examples
@@ -428,3 +510,52 @@ enum UnionState {
     Accumulator(CpcSketch),
     BitMatrix(Vec<u64>),
 }
+
+impl MergeableSketch<CpcSketch> for CpcUnion {
+    fn merge(&mut self, other: &CpcSketch) -> Result<(), Error> {
+        self.update(other);
+        Ok(())
+    }
+}
+
+/// Unions the sketches into a sketch of the lg_k and seed of the first one, or returns an empty
+/// default sketch when there are none.
+///
+/// # Panics
+///
+/// Panics if the sketches were built with different seeds, as [`CpcUnion::update`] does.
+impl Sum for CpcSketch {
+    fn sum<I: Iterator<Item = Self>>(iter: I) -> Self {
+        union_all(iter)
+    }
+}
+
+/// Unions the sketches, as the `Sum<CpcSketch>` impl does.
+impl<'a> Sum<&'a CpcSketch> for CpcSketch {
+    fn sum<I: Iterator<Item = &'a Self>>(iter: I) -> Self {
+        union_all(iter)
+    }
+}
+
+fn union_all<S: Borrow<CpcSketch>>(mut sketches: impl Iterator<Item = S>) -> CpcSketch {
+    let Some(first) = sketches.next() else {
+        return CpcSketch::default();
+    };
+    let first = first.borrow();
+    let mut union = CpcUnion::with_seed(first.lg_k(), first.seed());
+    union.update(first);
+    for sketch in sketches {
+        union.update(sketch.borrow());
+    }
+    union.to_sketch()
+}
+
+/// Deserializes the image with the seed of the union, so an image written with another seed
+/// is an error.
+#[cfg(feature = "aggregator")]
+impl ImageUnion for CpcUnion {
+    fn update_image(&mut self, image: &[u8]) -> Result<(), Error> {
+        self.update(&CpcSketch::deserialize_with_seed(image, self.seed)?);
+        Ok(())
+    }
+}
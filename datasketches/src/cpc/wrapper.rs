@@ -16,6 +16,7 @@
 // under the License.
 
 use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_lg_k_in;
 use crate::codec::assert::ensure_preamble_longs_in;
 use crate::codec::assert::ensure_serial_version_is;
 use crate::codec::assert::insufficient_data;
@@ -62,12 +63,7 @@ impl CpcWrapper {
         let first_interesting_column = cursor
             .read_u8()
             .map_err(insufficient_data("first_interesting_column"))?;
-        if !(MIN_LG_K..=MAX_LG_K).contains(&lg_k) {
-            return Err(Error::invalid_argument(format!(
-                "lg_k out of range; got {}",
-                lg_k
-            )));
-        }
+        ensure_lg_k_in(MIN_LG_K, MAX_LG_K, lg_k)?;
         if first_interesting_column > 63 {
             return Err(Error::invalid_argument(format!(
                 "first_interesting_column out of range; got {}",
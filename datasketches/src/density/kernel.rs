@@ -0,0 +1,48 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+/// A kernel function measuring the similarity of two points.
+///
+/// Implementations must be symmetric and return values in `[0, 1]`, with `1` for identical
+/// points. Both slices always have the dimension of the sketch.
+pub trait DensityKernel {
+    /// Evaluates the kernel on the points `a` and `b`.
+    fn evaluate(&self, a: &[f64], b: &[f64]) -> f64;
+}
+
+/// The Gaussian (radial basis function) kernel `exp(-||a - b||^2)`.
+///
+/// This is the default kernel of [`DensitySketch`](crate::density::DensitySketch) and matches the
+/// default kernel of the C++ implementation.
+#[derive(Default, Debug, Clone, Copy, PartialEq, Eq)]
+pub struct GaussianKernel;
+
+impl DensityKernel for GaussianKernel {
+    fn evaluate(&self, a: &[f64], b: &[f64]) -> f64 {
+        let squared_distance: f64 = a.iter().zip(b).map(|(x, y)| (x - y) * (x - y)).sum();
+        (-squared_distance).exp()
+    }
+}
+
+impl<F> DensityKernel for F
+where
+    F: Fn(&[f64], &[f64]) -> f64,
+{
+    fn evaluate(&self, a: &[f64], b: &[f64]) -> f64 {
+        self(a, b)
+    }
+}
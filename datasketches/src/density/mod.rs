@@ -0,0 +1,69 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Density sketch for kernel density estimation over multidimensional points.
+//!
+//! The sketch keeps a weighted coreset of the points it has seen, from which it estimates the
+//! kernel density at any query point. Points are stored in levels; a point at level `h`
+//! represents `2^h` input points. When the sketch grows beyond its capacity, a level is
+//! compacted: its points are shuffled and half of them, chosen greedily to keep the kernel
+//! discrepancy low, are promoted to the next level.
+//!
+//! This is a port of the density sketch of the C++ implementation and reads and writes its
+//! serialization format for `double` points.
+//!
+//! # Usage
+//!
+//! ```
+//! # use datasketches::density::DensitySketch;
+//! let mut sketch = DensitySketch::new(10, 2);
+//! for i in 0..1000 {
+//!     let x = (i % 10) as f64 * 0.01;
+//!     sketch.update(&[x, x]);
+//! }
+//! let near = sketch.estimate(&[0.05, 0.05]).unwrap();
+//! let far = sketch.estimate(&[5.0, 5.0]).unwrap();
+//! assert!(near > far);
+//! ```
+//!
+//! # Kernels
+//!
+//! [`GaussianKernel`] is used by default. Other kernels implement [`DensityKernel`], which is
+//! also implemented for closures:
+//!
+//! ```
+//! # use datasketches::density::DensitySketch;
+//! let laplacian = |a: &[f64], b: &[f64]| {
+//!     let distance: f64 = a.iter().zip(b).map(|(x, y)| (x - y).abs()).sum();
+//!     (-distance).exp()
+//! };
+//! let mut sketch = DensitySketch::with_kernel(10, 1, laplacian);
+//! sketch.update(&[1.0]);
+//! assert_eq!(sketch.estimate(&[1.0]), Some(1.0));
+//! ```
+//!
+//! # Reference
+//!
+//! Karnin and Liberty (2019). "Discrepancy, Coresets, and Sketches in Machine Learning"
+
+mod kernel;
+mod serialization;
+mod sketch;
+
+pub use self::kernel::DensityKernel;
+pub use self::kernel::GaussianKernel;
+pub use self::sketch::DensitySketch;
@@ -0,0 +1,540 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use super::DensityKernel;
+use super::GaussianKernel;
+use super::serialization::FLAGS_IS_EMPTY;
+use super::serialization::PREAMBLE_INTS_LONG;
+use super::serialization::PREAMBLE_INTS_SHORT;
+use super::serialization::SERIAL_VERSION;
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::random;
+use crate::error::Error;
+
+const MIN_K: u16 = 2;
+
+/// A sketch estimating the kernel density of a stream of `dim`-dimensional points.
+///
+/// See the [module level documentation](super) for more.
+#[derive(Debug, Clone)]
+pub struct DensitySketch<K = GaussianKernel> {
+    kernel: K,
+    k: u16,
+    dim: u32,
+    num_retained: u32,
+    n: u64,
+    levels: Vec<Vec<Vec<f64>>>,
+}
+
+impl DensitySketch<GaussianKernel> {
+    /// Creates a new sketch with the given `k` for points of dimension `dim`, using the
+    /// [`GaussianKernel`].
+    ///
+    /// Larger values of `k` retain more points and give more accurate estimates.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `k` is less than 2 or `dim` is 0.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::density::DensitySketch;
+    /// let sketch = DensitySketch::new(32, 3);
+    /// assert_eq!(sketch.k(), 32);
+    /// assert_eq!(sketch.dim(), 3);
+    /// ```
+    pub fn new(k: u16, dim: u32) -> Self {
+        Self::with_kernel(k, dim, GaussianKernel)
+    }
+
+    /// Deserializes a sketch from bytes, using the [`GaussianKernel`].
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the bytes do not hold a valid density sketch image.
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::deserialize_with_kernel(bytes, GaussianKernel)
+    }
+
+    /// Reads a sketch from `reader`, using the [`GaussianKernel`].
+    ///
+    /// Exactly the bytes of one image are consumed.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the stream does not hold a valid density sketch image.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader), GaussianKernel)
+    }
+}
+
+impl<K: DensityKernel> DensitySketch<K> {
+    /// Creates a new sketch with the given `k` for points of dimension `dim`, using `kernel`.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `k` is less than 2 or `dim` is 0.
+    pub fn with_kernel(k: u16, dim: u32, kernel: K) -> Self {
+        assert!(k >= MIN_K, "k must be at least {MIN_K}, got {k}");
+        assert!(dim > 0, "dim must be at least 1, got {dim}");
+        DensitySketch {
+            kernel,
+            k,
+            dim,
+            num_retained: 0,
+            n: 0,
+            levels: vec![vec![]],
+        }
+    }
+
+    /// Returns the parameter k.
+    pub fn k(&self) -> u16 {
+        self.k
+    }
+
+    /// Returns the dimension of the points.
+    pub fn dim(&self) -> u32 {
+        self.dim
+    }
+
+    /// Returns the kernel of this sketch.
+    pub fn kernel(&self) -> &K {
+        &self.kernel
+    }
+
+    /// Returns true if the sketch has not seen any points.
+    pub fn is_empty(&self) -> bool {
+        self.n == 0
+    }
+
+    /// Returns the number of points seen by the sketch.
+    pub fn n(&self) -> u64 {
+        self.n
+    }
+
+    /// Returns the number of points retained by the sketch.
+    pub fn num_retained(&self) -> u32 {
+        self.num_retained
+    }
+
+    /// Returns true if the sketch has compacted points, so that estimates are approximate.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.levels.len() > 1
+    }
+
+    /// Returns the estimated size of the sketch in bytes
+    pub fn estimated_size(&self) -> usize {
+        let points_size: usize = self
+            .levels
+            .iter()
+            .map(|level| {
+                level.capacity() * size_of::<Vec<f64>>()
+                    + level
+                        .iter()
+                        .map(|point| point.capacity() * size_of::<f64>())
+                        .sum::<usize>()
+            })
+            .sum();
+        size_of::<Self>() + self.levels.capacity() * size_of::<Vec<Vec<f64>>>() + points_size
+    }
+
+    /// Updates the sketch with a point.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the length of `point` differs from the dimension of the sketch.
+    pub fn update(&mut self, point: &[f64]) {
+        self.check_dim(point.len());
+        while self.num_retained as usize >= self.capacity() {
+            self.compact();
+        }
+        self.levels[0].push(point.to_vec());
+        self.num_retained += 1;
+        self.n += 1;
+    }
+
+    /// Merges another sketch into this one.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the sketches have different dimensions.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::density::DensitySketch;
+    /// let mut a = DensitySketch::new(10, 1);
+    /// let mut b = DensitySketch::new(10, 1);
+    /// a.update(&[1.0]);
+    /// b.update(&[2.0]);
+    ///
+    /// a.merge(&b);
+    /// assert_eq!(a.n(), 2);
+    /// assert_eq!(a.num_retained(), 2);
+    /// ```
+    pub fn merge(&mut self, other: &DensitySketch<K>) {
+        if other.is_empty() {
+            return;
+        }
+        self.check_dim(other.dim as usize);
+
+        if self.levels.len() < other.levels.len() {
+            self.levels.resize_with(other.levels.len(), Vec::new);
+        }
+        for (level, other_level) in self.levels.iter_mut().zip(&other.levels) {
+            level.extend(other_level.iter().cloned());
+        }
+        self.num_retained += other.num_retained;
+        self.n += other.n;
+        while self.num_retained as usize >= self.capacity() {
+            self.compact();
+        }
+    }
+
+    /// Returns the estimated density at the given point, or `None` if the sketch is empty.
+    ///
+    /// The estimate is the weighted average of the kernel between `point` and every retained
+    /// point.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the length of `point` differs from the dimension of the sketch.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::density::DensitySketch;
+    /// let mut sketch = DensitySketch::new(10, 1);
+    /// assert_eq!(sketch.estimate(&[0.0]), None);
+    ///
+    /// sketch.update(&[0.0]);
+    /// sketch.update(&[1.0]);
+    /// let estimate = sketch.estimate(&[0.0]).unwrap();
+    /// assert!((estimate - (1.0 + (-1.0f64).exp()) / 2.0).abs() < 1e-12);
+    /// ```
+    pub fn estimate(&self, point: &[f64]) -> Option<f64> {
+        self.check_dim(point.len());
+        if self.is_empty() {
+            return None;
+        }
+
+        let mut density = 0.0;
+        for (height, level) in self.levels.iter().enumerate() {
+            let weight = (1u64 << height) as f64;
+            for retained in level {
+                density += weight * self.kernel.evaluate(retained, point);
+            }
+        }
+        Some(density / self.n as f64)
+    }
+
+    /// Returns an iterator over the retained points and their weights.
+    ///
+    /// The weights sum to [`n()`](Self::n).
+    pub fn iter(&self) -> impl Iterator<Item = (&[f64], u64)> + '_ {
+        self.levels.iter().enumerate().flat_map(|(height, level)| {
+            level
+                .iter()
+                .map(move |point| (point.as_slice(), 1u64 << height))
+        })
+    }
+
+    /// Serializes the sketch to bytes in the format of the C++ implementation.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::density::DensitySketch;
+    /// let mut sketch = DensitySketch::new(10, 2);
+    /// sketch.update(&[1.0, 2.0]);
+    ///
+    /// let bytes = sketch.serialize();
+    /// let restored = DensitySketch::deserialize(&bytes).unwrap();
+    /// assert_eq!(restored.n(), 1);
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        let preamble_ints = if self.is_empty() {
+            PREAMBLE_INTS_SHORT
+        } else {
+            PREAMBLE_INTS_LONG
+        };
+        4 * preamble_ints as usize
+            + if self.is_empty() {
+                0
+            } else {
+                4 * self.levels.len() + 8 * self.num_retained as usize * self.dim as usize
+            }
+    }
+
+    /// Serializes this sketch into `buf`, returning the number of bytes written.
+    ///
+    /// Writes the image [`serialize`](Self::serialize) returns. Returns an error if `buf` is
+    /// shorter than [`serialized_size_bytes`](Self::serialized_size_bytes).
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Streams this sketch to `writer` in the format of [`serialize`](Self::serialize).
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        let is_empty = self.is_empty();
+        let preamble_ints = if is_empty {
+            PREAMBLE_INTS_SHORT
+        } else {
+            PREAMBLE_INTS_LONG
+        };
+
+        bytes.write_u8(preamble_ints);
+        bytes.write_u8(SERIAL_VERSION);
+        bytes.write_u8(Family::DENSITY.id);
+        bytes.write_u8(if is_empty { FLAGS_IS_EMPTY } else { 0 });
+        bytes.write_u16_le(self.k);
+        bytes.write_u16_le(0); // unused
+        bytes.write_u32_le(self.dim);
+        if is_empty {
+            return;
+        }
+
+        bytes.write_u32_le(self.num_retained);
+        bytes.write_u64_le(self.n);
+        for level in &self.levels {
+            bytes.write_u32_le(level.len() as u32);
+        }
+        for point in self.levels.iter().flatten() {
+            for &coordinate in point {
+                bytes.write_f64_le(coordinate);
+            }
+        }
+    }
+
+    /// Deserializes a sketch from bytes, using `kernel`.
+    ///
+    /// The kernel is not part of the serialized image; it must be the kernel the sketch was
+    /// built with for estimates to be meaningful.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the bytes do not hold a valid density sketch image.
+    pub fn deserialize_with_kernel(bytes: &[u8], kernel: K) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes), kernel)
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>, kernel: K) -> Result<Self, Error> {
+        let preamble_ints = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_ints"))?;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let k = cursor.read_u16_le().map_err(insufficient_data("k"))?;
+        let _unused = cursor.read_u16_le().map_err(insufficient_data("unused"))?;
+        let dim = cursor.read_u32_le().map_err(insufficient_data("dim"))?;
+
+        Family::DENSITY.validate_id(family_id)?;
+        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        if k < MIN_K {
+            return Err(Error::deserial(format!(
+                "k must be at least {MIN_K}, got {k}"
+            )));
+        }
+        if dim == 0 {
+            return Err(Error::deserial("dim must be at least 1, got 0"));
+        }
+
+        let is_empty = flags & FLAGS_IS_EMPTY != 0;
+        let expected_preamble_ints = if is_empty {
+            PREAMBLE_INTS_SHORT
+        } else {
+            PREAMBLE_INTS_LONG
+        };
+        if preamble_ints != expected_preamble_ints {
+            return Err(Error::invalid_preamble_longs(
+                &[expected_preamble_ints],
+                preamble_ints,
+            ));
+        }
+        if is_empty {
+            return Ok(Self::with_kernel(k, dim, kernel));
+        }
+
+        let num_retained = cursor
+            .read_u32_le()
+            .map_err(insufficient_data("num_retained"))?;
+        let n = cursor.read_u64_le().map_err(insufficient_data("n"))?;
+
+        // The number of levels is implied by the level sizes adding up to num_retained.
+        let mut level_sizes = vec![];
+        let mut num_to_read = i64::from(num_retained);
+        while num_to_read > 0 {
+            let level_size = cursor
+                .read_u32_le()
+                .map_err(insufficient_data("level_size"))?;
+            num_to_read -= i64::from(level_size);
+            level_sizes.push(level_size);
+        }
+        if num_to_read < 0 {
+            return Err(Error::deserial(format!(
+                "level sizes exceed the number of retained points {num_retained}"
+            )));
+        }
+        let mut levels = Vec::with_capacity(level_sizes.len().max(1));
+        for level_size in level_sizes {
+            let point_size = (dim as usize * 8).max(1);
+            let mut level =
+                Vec::with_capacity(cursor.capacity_hint(level_size as usize, point_size));
+            for _ in 0..level_size {
+                let mut point = Vec::with_capacity(cursor.capacity_hint(dim as usize, 8));
+                for _ in 0..dim {
+                    point.push(cursor.read_f64_le().map_err(insufficient_data("points"))?);
+                }
+                level.push(point);
+            }
+            levels.push(level);
+        }
+        if levels.is_empty() {
+            levels.push(vec![]);
+        }
+
+        Ok(DensitySketch {
+            kernel,
+            k,
+            dim,
+            num_retained,
+            n,
+            levels,
+        })
+    }
+
+    fn check_dim(&self, dim: usize) {
+        assert_eq!(
+            dim, self.dim as usize,
+            "dimension mismatch: expected {}, got {dim}",
+            self.dim
+        );
+    }
+
+    fn capacity(&self) -> usize {
+        self.k as usize * self.levels.len()
+    }
+
+    /// Compacts the lowest level holding at least k points.
+    fn compact(&mut self) {
+        let k = self.k as usize;
+        if let Some(height) = self.levels.iter().position(|level| level.len() >= k) {
+            if height + 1 >= self.levels.len() {
+                self.levels.push(vec![]);
+            }
+            self.compact_level(height);
+        }
+    }
+
+    /// Promotes about half of the points of a level to the next one.
+    ///
+    /// After a random shuffle, each point is signed to counter the kernel discrepancy of the
+    /// points signed before it, and the points with a positive sign are promoted.
+    fn compact_level(&mut self, height: usize) {
+        let mut level = std::mem::take(&mut self.levels[height]);
+        shuffle(&mut level);
+
+        let mut promoted = vec![false; level.len()];
+        promoted[0] = random::next_bit() == 1;
+        for i in 1..level.len() {
+            let delta: f64 = (0..i)
+                .map(|j| {
+                    let sign = if promoted[j] { 1.0 } else { -1.0 };
+                    sign * self.kernel.evaluate(&level[i], &level[j])
+                })
+                .sum();
+            promoted[i] = delta < 0.0;
+        }
+
+        for (point, promoted) in level.into_iter().zip(promoted) {
+            if promoted {
+                self.levels[height + 1].push(point);
+            } else {
+                self.num_retained -= 1;
+            }
+        }
+    }
+}
+
+fn shuffle<T>(items: &mut [T]) {
+    for i in (1..items.len()).rev() {
+        let j = (random::next_u64() % (i as u64 + 1)) as usize;
+        items.swap(i, j);
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(DensitySketch);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(DensitySketch);
+impl_fingerprint_via_image!(DensitySketch);
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_compaction_keeps_capacity() {
+        let mut sketch = DensitySketch::new(8, 1);
+        for i in 0..1000 {
+            sketch.update(&[i as f64]);
+            assert!((sketch.num_retained() as usize) <= sketch.capacity());
+        }
+        assert!(sketch.is_estimation_mode());
+        assert_eq!(sketch.iter().count(), sketch.num_retained() as usize);
+    }
+
+    #[test]
+    fn test_shuffle_is_a_permutation() {
+        let mut items: Vec<u32> = (0..100).collect();
+        shuffle(&mut items);
+        items.sort_unstable();
+        assert_eq!(items, (0..100).collect::<Vec<_>>());
+    }
+}
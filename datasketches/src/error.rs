@@ -27,6 +27,9 @@ pub enum ErrorKind {
     InvalidArgument,
     /// The sketch data deserializing is malformed.
     InvalidData,
+    /// The sketch data was written in a serial version this library does not read, typically
+    /// by a newer release.
+    UnsupportedVersion,
 }
 
 impl ErrorKind {
@@ -35,6 +38,7 @@ impl ErrorKind {
         match self {
             ErrorKind::InvalidArgument => "InvalidArgument",
             ErrorKind::InvalidData => "InvalidData",
+            ErrorKind::UnsupportedVersion => "UnsupportedVersion",
         }
     }
 }
@@ -45,6 +49,124 @@ impl fmt::Display for ErrorKind {
     }
 }
 
+/// SketchError is the specific cause of an [`Error`], for failures that callers may want to
+/// handle programmatically.
+///
+/// Failures without a variant here, such as most internal inconsistencies of a corrupt image,
+/// are described by the error message only.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::error::SketchError;
+/// # use datasketches::hll::HllSketch;
+/// # use datasketches::hll::HllType;
+/// let bytes = HllSketch::new(12, HllType::Hll8).serialize();
+/// let err = HllSketch::deserialize(&bytes[..4]).unwrap_err();
+/// assert!(matches!(
+///     err.sketch_error(),
+///     Some(SketchError::UnexpectedEnd { .. })
+/// ));
+/// ```
+#[derive(Clone, Debug, PartialEq, Eq)]
+#[non_exhaustive]
+pub enum SketchError {
+    /// The family id of a serialized image belongs to another kind of sketch.
+    InvalidFamily {
+        /// The family id of the sketch being read.
+        expected: u8,
+        /// The family id found in the image.
+        actual: u8,
+    },
+    /// The serial version of an image is not one this library reads.
+    UnsupportedSerialVersion {
+        /// The serial version this library reads, or the newest one if it reads several.
+        expected: u8,
+        /// The serial version found in the image.
+        actual: u8,
+    },
+    /// The preamble length of an image does not match its format or flags.
+    InvalidPreamble {
+        /// The preamble length found in the image, in longs or ints depending on the family.
+        actual: u8,
+    },
+    /// Two sketches, or a sketch and the seed it is read with, were built with different
+    /// hash seeds.
+    IncompatibleSeedHash {
+        /// The seed hash of the expected seed.
+        expected: u16,
+        /// The seed hash found in the other sketch or the image.
+        actual: u16,
+    },
+    /// An image was written with another hash seed than the one it is read with, for formats
+    /// that store the whole seed rather than its hash, such as Bloom filters.
+    IncompatibleSeed {
+        /// The seed the image is read with.
+        expected: u64,
+        /// The seed found in the image.
+        actual: u64,
+    },
+    /// A caller-provided buffer is too small for the image to be written into it, or for
+    /// the image it is expected to hold.
+    InsufficientBuffer {
+        /// The number of bytes required.
+        needed: usize,
+        /// The number of bytes available.
+        got: usize,
+    },
+    /// An image ended before the named field could be read.
+    UnexpectedEnd {
+        /// The field that was being read.
+        field: &'static str,
+    },
+    /// The lg_k of an image is outside the range the sketch supports.
+    LgKOutOfRange {
+        /// The lg_k found in the image.
+        lg_k: u8,
+        /// The smallest supported lg_k.
+        min: u8,
+        /// The largest supported lg_k.
+        max: u8,
+    },
+}
+
+impl fmt::Display for SketchError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            SketchError::InvalidFamily { expected, actual } => {
+                write!(f, "invalid family: expected {expected}, got {actual}")
+            }
+            SketchError::UnsupportedSerialVersion { expected, actual } => {
+                write!(
+                    f,
+                    "unsupported serial version: expected {expected}, got {actual}"
+                )
+            }
+            SketchError::InvalidPreamble { actual } => {
+                write!(f, "invalid preamble longs: got {actual}")
+            }
+            SketchError::IncompatibleSeedHash { expected, actual } => {
+                write!(
+                    f,
+                    "incompatible seed hash: expected {expected}, got {actual}"
+                )
+            }
+            SketchError::IncompatibleSeed { expected, actual } => {
+                write!(f, "incompatible seed: expected {expected}, got {actual}")
+            }
+            SketchError::InsufficientBuffer { needed, got } => {
+                write!(f, "buffer too small: need {needed} bytes, got {got}")
+            }
+            SketchError::UnexpectedEnd { field } => write!(f, "insufficient data: {field}"),
+            SketchError::LgKOutOfRange { lg_k, min, max } => {
+                write!(f, "lg_k must be in [{min}, {max}], got {lg_k}")
+            }
+        }
+    }
+}
+
+impl std::error::Error for SketchError {}
+
 /// Error is the error struct returned by all datasketches functions.
 ///
 /// # Examples
@@ -55,10 +177,12 @@ impl fmt::Display for ErrorKind {
 /// let err = Error::new(ErrorKind::InvalidArgument, "bad input");
 /// assert_eq!(err.kind(), ErrorKind::InvalidArgument);
 /// assert_eq!(err.message(), "bad input");
+/// assert!(err.sketch_error().is_none());
 /// ```
 pub struct Error {
     kind: ErrorKind,
     message: String,
+    reason: Option<SketchError>,
     context: Vec<(&'static str, String)>,
 }
 
@@ -68,6 +192,18 @@ impl Error {
         Self {
             kind,
             message: message.into(),
+            reason: None,
+            context: vec![],
+        }
+    }
+
+    /// Create a new Error with error kind and a structured cause, which also provides the
+    /// message.
+    pub fn from_reason(kind: ErrorKind, reason: SketchError) -> Self {
+        Self {
+            kind,
+            message: reason.to_string(),
+            reason: Some(reason),
             context: vec![],
         }
     }
@@ -87,6 +223,11 @@ impl Error {
     pub fn message(&self) -> &str {
         self.message.as_str()
     }
+
+    /// Return the structured cause of the error, if it has one.
+    pub fn sketch_error(&self) -> Option<&SketchError> {
+        self.reason.as_ref()
+    }
 }
 
 #[allow(dead_code)] // some convenient constructors are only used for certain sketches
@@ -99,6 +240,10 @@ impl Error {
         Self::new(ErrorKind::InvalidData, msg)
     }
 
+    pub(crate) fn unexpected_end(field: &'static str) -> Self {
+        Self::from_reason(ErrorKind::InvalidData, SketchError::UnexpectedEnd { field })
+    }
+
     pub(crate) fn insufficient_data(msg: impl fmt::Display) -> Self {
         Self::deserial(format!("insufficient data: {msg}"))
     }
@@ -108,15 +253,59 @@ impl Error {
     }
 
     pub(crate) fn invalid_family(expected: u8, actual: u8, name: &'static str) -> Self {
-        Self::deserial(format!(
-            "invalid family: expected {expected} ({name}), got {actual}"
-        ))
+        Self::from_reason(
+            ErrorKind::InvalidData,
+            SketchError::InvalidFamily { expected, actual },
+        )
+        .with_context("family", name)
+    }
+
+    /// Reports an image of serial version `actual`, where `newest` is the newest version read.
+    pub(crate) fn unsupported_serial_version(newest: u8, actual: u8) -> Self {
+        let reason = SketchError::UnsupportedSerialVersion {
+            expected: newest,
+            actual,
+        };
+        if actual > newest {
+            Self::new(
+                ErrorKind::UnsupportedVersion,
+                format!(
+                    "serial version {actual} is newer than {newest}, the newest this library reads"
+                ),
+            )
+            .with_reason(reason)
+        } else {
+            Self::from_reason(ErrorKind::UnsupportedVersion, reason)
+        }
     }
 
     pub(crate) fn invalid_preamble_longs(expected: &[u8], actual: u8) -> Self {
-        Error::deserial(format!(
-            "invalid preamble longs: expected {expected:?}, got {actual}"
-        ))
+        Self::from_reason(
+            ErrorKind::InvalidData,
+            SketchError::InvalidPreamble { actual },
+        )
+        .with_context("expected", format!("{expected:?}"))
+    }
+
+    /// Attaches a structured cause to an error whose message says more than the cause's own.
+    pub(crate) fn with_reason(mut self, reason: SketchError) -> Self {
+        self.reason = Some(reason);
+        self
+    }
+
+    pub(crate) fn incompatible_seed_hash(kind: ErrorKind, expected: u16, actual: u16) -> Self {
+        Self::from_reason(kind, SketchError::IncompatibleSeedHash { expected, actual })
+    }
+
+    pub(crate) fn incompatible_seed(expected: u64, actual: u64) -> Self {
+        Self::from_reason(
+            ErrorKind::InvalidData,
+            SketchError::IncompatibleSeed { expected, actual },
+        )
+    }
+
+    pub(crate) fn insufficient_buffer(kind: ErrorKind, needed: usize, got: usize) -> Self {
+        Self::from_reason(kind, SketchError::InsufficientBuffer { needed, got })
     }
 }
 
@@ -127,6 +316,7 @@ impl fmt::Debug for Error {
             let mut de = f.debug_struct("Error");
             de.field("kind", &self.kind);
             de.field("message", &self.message);
+            de.field("reason", &self.reason);
             de.field("context", &self.context);
             return de.finish();
         }
@@ -172,7 +362,13 @@ impl fmt::Display for Error {
     }
 }
 
-impl std::error::Error for Error {}
+impl std::error::Error for Error {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        self.reason
+            .as_ref()
+            .map(|reason| reason as &(dyn std::error::Error + 'static))
+    }
+}
 
 #[cfg(test)]
 mod tests {
@@ -193,4 +389,19 @@ mod tests {
             .with_context("file", "foo");
         assert_snapshot!(err, @"InvalidData, context: { index: 42, file: foo } => parsing failed");
     }
+
+    #[test]
+    fn test_format_with_reason() {
+        let err = Error::invalid_family(3, 7, "THETA");
+        assert_eq!(
+            err.sketch_error(),
+            Some(&SketchError::InvalidFamily {
+                expected: 3,
+                actual: 7
+            })
+        );
+        assert_snapshot!(err, @"InvalidData, context: { family: THETA } => invalid family: expected 3, got 7");
+        let source = std::error::Error::source(&err).unwrap();
+        assert_eq!(source.to_string(), "invalid family: expected 3, got 7");
+    }
 }
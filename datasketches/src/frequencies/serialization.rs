@@ -58,8 +58,7 @@ impl FrequentItemValue for String {
             Error::insufficient_data("failed to read string item length".to_string())
         })?;
 
-        let mut slice = vec![0; len as usize];
-        cursor.read_exact(&mut slice).map_err(|_| {
+        let slice = cursor.read_bytes(len as usize).map_err(|_| {
             Error::insufficient_data("failed to read string item bytes".to_string())
         })?;
 
@@ -19,13 +19,21 @@
 
 use std::borrow::Borrow;
 use std::hash::Hash;
+use std::io;
+use std::io::Read;
+use std::io::Write;
 
 use crate::codec::SketchBytes;
 use crate::codec::SketchSlice;
 use crate::codec::assert::ensure_preamble_longs_in;
 use crate::codec::assert::ensure_serial_version_is;
 use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
 use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
 use crate::error::Error;
 use crate::frequencies::FrequentItemValue;
 use crate::frequencies::reverse_purge_item_hash_map::ReversePurgeItemHashMap;
@@ -39,6 +47,9 @@ type SerializeItem<T> = fn(&mut SketchBytes, &T);
 type DeserializeItems<T> = fn(SketchSlice<'_>, usize) -> Result<Vec<T>, Error>;
 
 const LG_MIN_MAP_SIZE: u8 = 3;
+/// Largest map accepted from a serialized image; the Java and C++ sketches index their maps with
+/// 32-bit integers.
+const MAX_LG_MAP_SIZE: u8 = 31;
 const SAMPLE_SIZE: usize = 1024;
 const EPSILON_FACTOR: f64 = 3.5;
 const LOAD_FACTOR_NUMERATOR: usize = 3;
@@ -99,6 +110,7 @@ pub struct FrequentItemsSketch<T> {
     offset: u64,
     stream_weight: u64,
     sample_size: usize,
+    num_purges: u64,
     hash_map: ReversePurgeItemHashMap<T>,
 }
 
@@ -140,6 +152,14 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
         self.hash_map.num_active()
     }
 
+    /// Returns the estimated size of the sketch in bytes
+    ///
+    /// The map grows up to the maximum map size, and items are counted by their inline size
+    /// only.
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>() + self.hash_map.heap_size()
+    }
+
     /// Returns the total weight of the stream.
     ///
     /// This is the sum of all counts passed to `update` and `update_with_count`.
@@ -240,6 +260,54 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
         self.hash_map.lg_length()
     }
 
+    /// Returns the number of counters sampled to estimate the median count when the map is
+    /// full and must be purged.
+    ///
+    /// Defaults to `min(1024, maximum_map_capacity)`, as in Java.
+    pub fn sample_size(&self) -> usize {
+        self.sample_size
+    }
+
+    /// Sets the number of counters sampled to estimate the median count on a purge.
+    ///
+    /// A purge subtracts the sampled median from every counter and drops the counters that
+    /// reach zero, which adds the median to [`maximum_error`](Self::maximum_error). A larger
+    /// sample estimates the median more closely, so each purge frees close to half of the map;
+    /// a smaller sample makes each purge cheaper at the cost of a less predictable amount of
+    /// freed space. The setting is not serialized.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `sample_size` is not in `[1, 1024]`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::frequencies::FrequentItemsSketch;
+    /// let mut sketch = FrequentItemsSketch::<i64>::new(64);
+    /// sketch.set_sample_size(16);
+    /// sketch.extend(0..1000);
+    /// assert_eq!(sketch.sample_size(), 16);
+    /// assert!(sketch.num_purges() > 0);
+    /// ```
+    pub fn set_sample_size(&mut self, sample_size: usize) {
+        assert!(
+            (1..=SAMPLE_SIZE).contains(&sample_size),
+            "sample_size must be in [1, {SAMPLE_SIZE}], got {sample_size}"
+        );
+        self.sample_size = sample_size;
+    }
+
+    /// Returns the number of times the map has been purged since the sketch was created,
+    /// deserialized or reset.
+    ///
+    /// Each purge happens when the map at its maximum size overflows, and each one increases
+    /// [`maximum_error`](Self::maximum_error). A high count relative to the stream length
+    /// suggests a larger maximum map size.
+    pub fn num_purges(&self) -> u64 {
+        self.num_purges
+    }
+
     /// Updates the sketch with a count of one.
     ///
     /// # Examples
@@ -359,8 +427,12 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
     }
 
     /// Resets the sketch to an empty state.
+    ///
+    /// The purge sample size is kept, and the purge count starts over from zero.
     pub fn reset(&mut self) {
+        let sample_size = self.sample_size;
         *self = Self::with_lg_map_sizes(self.lg_max_map_size, LG_MIN_MAP_SIZE);
+        self.sample_size = sample_size;
     }
 
     /// Returns frequent items using the sketch maximum error as threshold.
@@ -441,6 +513,7 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
             } else {
                 let delta = self.hash_map.purge(self.sample_size);
                 self.offset += delta;
+                self.num_purges += 1;
                 if self.hash_map.num_active() > self.maximum_map_capacity() {
                     panic!("purge did not reduce number of active items");
                 }
@@ -465,17 +538,33 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
             offset: 0,
             stream_weight: 0,
             sample_size,
+            num_purges: 0,
             hash_map: map,
         }
     }
 
+    fn serialized_size_inner(&self, count_serialize_size: CountSerializeSize<T>) -> usize {
+        if self.is_empty() {
+            return PREAMBLE_LONGS_EMPTY as usize * 8;
+        }
+        let mut total_bytes = 0;
+        total_bytes += PREAMBLE_LONGS_NONEMPTY as usize * 8;
+        total_bytes += self.num_active_items() * 8;
+        for (k, _) in &self.hash_map.active_entries() {
+            total_bytes += count_serialize_size(k);
+        }
+        total_bytes
+    }
+
+    /// Writes the image, listing the items in the order of the hash map or, if `sort_items`,
+    /// in the order of their serialized bytes.
     fn serialize_inner(
         &self,
-        count_serialize_size: CountSerializeSize<T>,
+        bytes: &mut SketchBytes,
         serialize_item: SerializeItem<T>,
-    ) -> Vec<u8> {
+        sort_items: bool,
+    ) {
         if self.is_empty() {
-            let mut bytes = SketchBytes::with_capacity(PREAMBLE_LONGS_EMPTY as usize * 8);
             bytes.write_u8(PREAMBLE_LONGS_EMPTY);
             bytes.write_u8(SERIAL_VERSION);
             bytes.write_u8(Family::FREQUENCY.id);
@@ -483,21 +572,24 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
             bytes.write_u8(self.hash_map.lg_length());
             bytes.write_u8(EMPTY_FLAG_MASK);
             bytes.write_u16_le(0); // unused
-            return bytes.into_bytes();
+            return;
         }
 
         let active_items = self.num_active_items();
-        let active_entries = self.hash_map.active_entries();
-
-        let mut bytes = SketchBytes::with_capacity({
-            let mut total_bytes = 0;
-            total_bytes += PREAMBLE_LONGS_NONEMPTY as usize * 8;
-            total_bytes += active_items * 8;
-            for (k, _) in &active_entries {
-                total_bytes += count_serialize_size(k);
-            }
-            total_bytes
-        });
+        let mut active_entries = self.hash_map.active_entries();
+        if sort_items {
+            let mut keyed: Vec<_> = active_entries
+                .into_iter()
+                .map(|entry| {
+                    let mut item = SketchBytes::with_capacity(0);
+                    serialize_item(&mut item, entry.0);
+                    (item.into_bytes(), entry)
+                })
+                .collect();
+            keyed.sort_unstable_by(|a, b| a.0.cmp(&b.0));
+            active_entries = keyed.into_iter().map(|(_, entry)| entry).collect();
+        }
+
         bytes.write_u8(PREAMBLE_LONGS_NONEMPTY);
         bytes.write_u8(SERIAL_VERSION);
         bytes.write_u8(Family::FREQUENCY.id);
@@ -515,17 +607,14 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
             bytes.write_u64_le(*v);
         }
         for (k, _) in &active_entries {
-            serialize_item(&mut bytes, k);
+            serialize_item(bytes, k);
         }
-
-        bytes.into_bytes()
     }
 
     fn deserialize_inner(
-        bytes: &[u8],
+        mut cursor: SketchSlice<'_>,
         deserialize_items: DeserializeItems<T>,
     ) -> Result<Self, Error> {
-        let mut cursor = SketchSlice::new(bytes);
         let pre_longs = cursor.read_u8().map_err(insufficient_data("pre_longs"))?;
         let pre_longs = pre_longs & 0x3F;
         let serial_version = cursor
@@ -548,6 +637,11 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
         if lg_cur > lg_max {
             return Err(Error::deserial("lg_cur_map_size exceeds lg_max_map_size"));
         }
+        if lg_max > MAX_LG_MAP_SIZE {
+            return Err(Error::deserial(format!(
+                "lg_max_map_size must be at most {MAX_LG_MAP_SIZE}, got {lg_max}"
+            )));
+        }
 
         let is_empty = (flags & EMPTY_FLAG_MASK) != 0;
         if is_empty {
@@ -568,7 +662,7 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
             .map_err(insufficient_data("stream_weight"))?;
         let offset_val = cursor.read_u64_le().map_err(insufficient_data("offset"))?;
 
-        let mut values = Vec::with_capacity(active_items);
+        let mut values = Vec::with_capacity(cursor.capacity_hint(active_items, 8));
         for i in 0..active_items {
             values.push(cursor.read_u64_le().map_err(|_| {
                 Error::insufficient_data(format!(
@@ -577,6 +671,17 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
             })?);
         }
 
+        // every unit of weight is either still counted or was removed by a purge, and each
+        // purge removes at least the amount it adds to the offset
+        let retained = values
+            .iter()
+            .try_fold(offset_val, |acc, &value| acc.checked_add(value));
+        if retained.is_none_or(|retained| retained > stream_weight) {
+            return Err(Error::deserial(format!(
+                "counts and offset exceed the stream weight {stream_weight}"
+            )));
+        }
+
         let items = deserialize_items(cursor, active_items)?;
         if items.len() != active_items {
             return Err(Error::deserial(
@@ -594,6 +699,15 @@ impl<T: Eq + Hash> FrequentItemsSketch<T> {
     }
 }
 
+/// Counts every item of the iterator once, as [`FrequentItemsSketch::update`] does.
+impl<T: Eq + Hash> Extend<T> for FrequentItemsSketch<T> {
+    fn extend<I: IntoIterator<Item = T>>(&mut self, iter: I) {
+        for item in iter {
+            self.update(item);
+        }
+    }
+}
+
 impl<T: FrequentItemValue> FrequentItemsSketch<T> {
     /// Serializes this sketch into a byte vector.
     ///
@@ -622,7 +736,66 @@ impl<T: FrequentItemValue> FrequentItemsSketch<T> {
     /// assert!(decoded.estimate(&apple) >= 2);
     /// ```
     pub fn serialize(&self) -> Vec<u8> {
-        self.serialize_inner(T::serialize_size, |bytes, item| item.serialize_value(bytes))
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.serialize_inner(&mut bytes, |bytes, item| item.serialize_value(bytes), false);
+        bytes.into_bytes()
+    }
+
+    /// Returns the image with its items sorted by their serialized bytes.
+    ///
+    /// The order of the items in the hash map depends on the order of the updates, so sorting
+    /// them leaves an image that depends only on the retained items and counts.
+    fn canonical_image(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.serialize_inner(&mut bytes, |bytes, item| item.serialize_value(bytes), true);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces, as reported by
+    /// [`FrequentItemValue::serialize_size`] for the items.
+    pub fn serialized_size_bytes(&self) -> usize {
+        self.serialized_size_inner(T::serialize_size)
+    }
+
+    /// Serializes this sketch into `buf`, returning the number of bytes written.
+    ///
+    /// Writes the image [`serialize`](Self::serialize) returns, so a single buffer can be reused
+    /// across sketches.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `buf` is too short for the image.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::frequencies::FrequentItemsSketch;
+    /// let mut sketch = FrequentItemsSketch::<String>::new(64);
+    /// sketch.update_with_count("apple".to_string(), 2);
+    ///
+    /// let mut buf = [0u8; 256];
+    /// let len = sketch.serialize_into(&mut buf).unwrap();
+    /// assert_eq!(len, sketch.serialized_size_bytes());
+    /// assert_eq!(&buf[..len], sketch.serialize().as_slice());
+    /// ```
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| {
+            self.serialize_inner(bytes, |bytes, item| item.serialize_value(bytes), false)
+        })
+    }
+
+    /// Writes the serialized sketch to `writer`.
+    ///
+    /// This streams the image [`serialize`](Self::serialize) returns in chunks instead of
+    /// assembling it in memory first.
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| {
+            self.serialize_inner(bytes, |bytes, item| item.serialize_value(bytes), false)
+        })
     }
 
     /// Deserializes a sketch from bytes.
@@ -652,8 +825,25 @@ impl<T: FrequentItemValue> FrequentItemsSketch<T> {
     /// assert!(decoded.estimate(&apple) >= 2);
     /// ```
     pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
-        Self::deserialize_inner(bytes, |mut cursor, num_items| {
-            let mut items = Vec::with_capacity(num_items);
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// Exactly the bytes of one image are consumed, so several sketches can be read back from
+    /// the same stream.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    fn read_image(cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        Self::deserialize_inner(cursor, |mut cursor, num_items| {
+            let mut items = Vec::with_capacity(cursor.capacity_hint(num_items, 1));
             for i in 0..num_items {
                 let item = T::deserialize_value(&mut cursor).map_err(|_| {
                     Error::insufficient_data(format!(
@@ -666,3 +856,12 @@ impl<T: FrequentItemValue> FrequentItemsSketch<T> {
         })
     }
 }
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!([T: FrequentItemValue] FrequentItemsSketch<T>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([T: FrequentItemValue] FrequentItemsSketch<T>);
+impl_fingerprint_via_image!(
+    [T: FrequentItemValue] FrequentItemsSketch<T>,
+    |s| s.canonical_image()
+);
@@ -15,28 +15,100 @@
 // specific language governing permissions and limitations
 // under the License.
 
+//! Hash functions shared by the sketches.
+//!
+//! [`MurmurHash3X64128`] is the hash behind the HLL, CPC, Theta, Tuple, Count-Min and frequent
+//! items sketches. It produces the same 128-bit values as the Java and C++ `MurmurHash3`, so
+//! downstream systems can pre-hash keys exactly as the sketches do. It also computes the
+//! `fingerprint` of every sketch from its serialized image.
+//!
+//! # Compatibility with Java
+//!
+//! The sketches feed values through the [`Hash`](std::hash::Hash) trait and seed the hasher with
+//! [`DEFAULT_UPDATE_SEED`] unless configured otherwise. For the common key types this matches
+//! the corresponding Java `update` overloads:
+//!
+//! * `i64` and `u64` values hash as their 8 little-endian bytes, like Java's `hash(long[], seed)`
+//!   over a single long.
+//! * Byte slices and strings hash as their raw bytes, like Java's `hash(byte[], seed)` and the
+//!   UTF-8 encoding used for `String` keys, only when wrapped with
+//!   [`raw_bytes`](crate::hash_value::raw_bytes). Rust's own `Hash` for `str` and `[u8]` adds a
+//!   terminator or length prefix.
+//! * Floating point values match Java only when wrapped with
+//!   [`canonical_float`](crate::hash_value::canonical_float).
+//!
+//! Hashing the same bytes directly with [`murmurhash3_x64_128`] yields the same `(h1, h2)` pair.
+//! Theta and Tuple sketches then keep `h1 >> 1` as the hash of the key.
+//!
+//! # Portability
+//!
+//! The hashers write integers in little-endian byte order rather than the native one, so the
+//! hash of a value is also the same on big-endian targets such as `s390x`.
+//!
+//! The hash of a value is the same on every target, including 32-bit ones such as
+//! `wasm32-unknown-unknown`, as long as the value's `Hash` impl does not write a `usize`. The
+//! length prefix that Rust's `Hash` adds to slices and `Vec`s is a `usize`, so sketches that must
+//! agree across platforms should feed such keys through
+//! [`raw_bytes`](crate::hash_value::raw_bytes).
+
 #[cfg(any(
+    feature = "bloom",
     feature = "countmin",
     feature = "cpc",
+    feature = "density",
     feature = "frequencies",
     feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
+    feature = "tdigest",
     feature = "theta",
     feature = "tuple",
 ))]
 mod murmurhash;
 #[cfg(any(
+    feature = "bloom",
     feature = "countmin",
     feature = "cpc",
+    feature = "density",
     feature = "frequencies",
     feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
+    feature = "tdigest",
     feature = "theta",
     feature = "tuple",
 ))]
-pub(crate) use self::murmurhash::MurmurHash3X64128;
+pub use self::murmurhash::MurmurHash3X64128;
+#[cfg(any(
+    feature = "bloom",
+    feature = "countmin",
+    feature = "cpc",
+    feature = "density",
+    feature = "frequencies",
+    feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
+    feature = "tdigest",
+    feature = "theta",
+    feature = "tuple",
+))]
+pub use self::murmurhash::murmurhash3_x64_128;
 
-#[cfg(feature = "bloom")]
+#[cfg(any(feature = "bloom", feature = "quotient"))]
 mod xxhash;
-#[cfg(feature = "bloom")]
+#[cfg(any(feature = "bloom", feature = "quotient"))]
 pub(crate) use self::xxhash::XxHash64;
 
 /// The seed 9001 used in the sketch update methods is a prime number that was chosen very early
@@ -56,12 +128,20 @@ pub(crate) use self::xxhash::XxHash64;
     feature = "bloom",
     feature = "countmin",
     feature = "cpc",
+    feature = "density",
     feature = "frequencies",
     feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
+    feature = "tdigest",
     feature = "theta",
     feature = "tuple",
 ))]
-pub(crate) const DEFAULT_UPDATE_SEED: u64 = 9001;
+pub const DEFAULT_UPDATE_SEED: u64 = 9001;
 
 /// Computes and checks the 16-bit seed hash from the given long seed.
 ///
@@ -88,6 +168,72 @@ pub(crate) fn compute_seed_hash(seed: u64) -> u16 {
     seed_hash
 }
 
+/// Implements the integer methods of [`Hasher`](std::hash::Hasher) with the little-endian bytes
+/// of the integer.
+///
+/// The default methods write native-endian bytes, which would hash integers differently on
+/// big-endian targets than in Java and C++.
+#[cfg(any(
+    feature = "bloom",
+    feature = "countmin",
+    feature = "cpc",
+    feature = "density",
+    feature = "frequencies",
+    feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
+    feature = "tdigest",
+    feature = "theta",
+    feature = "tuple",
+))]
+macro_rules! write_integers_le {
+    () => {
+        $crate::hash::write_integers_le!(
+            write_u16: u16,
+            write_u32: u32,
+            write_u64: u64,
+            write_u128: u128,
+            write_usize: usize,
+            write_i16: i16,
+            write_i32: i32,
+            write_i64: i64,
+            write_i128: i128,
+            write_isize: isize
+        );
+    };
+    ($($method:ident: $ty:ty),*) => {
+        $(
+            #[inline]
+            fn $method(&mut self, i: $ty) {
+                self.write(&i.to_le_bytes());
+            }
+        )*
+    };
+}
+
+#[cfg(any(
+    feature = "bloom",
+    feature = "countmin",
+    feature = "cpc",
+    feature = "density",
+    feature = "frequencies",
+    feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
+    feature = "tdigest",
+    feature = "theta",
+    feature = "tuple",
+))]
+pub(crate) use write_integers_le;
+
 /// Reads an u64 from a byte slice in little-endian order.
 ///
 /// # Panics
@@ -97,8 +243,16 @@ pub(crate) fn compute_seed_hash(seed: u64) -> u16 {
     feature = "bloom",
     feature = "countmin",
     feature = "cpc",
+    feature = "density",
     feature = "frequencies",
     feature = "hll",
+    feature = "kll",
+    feature = "matrix",
+    feature = "quantiles",
+    feature = "quotient",
+    feature = "req",
+    feature = "sampling",
+    feature = "tdigest",
     feature = "theta",
     feature = "tuple",
 ))]
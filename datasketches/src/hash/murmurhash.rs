@@ -24,7 +24,28 @@ const C2: u64 = 0x4cf5ad432745937f;
 
 /// The MurmurHash3 is a fast, non-cryptographic, 128-bit hash function that has
 /// excellent avalanche and 2-way bit independence properties.
-#[derive(Debug)]
+///
+/// This is the x64 128-bit variant used by the Java and C++ implementations. It implements
+/// [`Hasher`], so any [`Hash`](std::hash::Hash) value can be fed to it exactly as the sketch
+/// update methods do. [`finish128`](Self::finish128) returns both 64-bit halves, which correspond
+/// to the two elements of the `long[]` returned by Java's `MurmurHash3.hash`.
+///
+/// # Examples
+///
+/// ```
+/// # use std::hash::Hash;
+/// # use std::hash::Hasher;
+/// # use datasketches::hash::DEFAULT_UPDATE_SEED;
+/// # use datasketches::hash::MurmurHash3X64128;
+/// let mut hasher = MurmurHash3X64128::with_seed(DEFAULT_UPDATE_SEED);
+/// 42_u64.hash(&mut hasher);
+/// let (h1, h2) = hasher.finish128();
+///
+/// // Equivalent to Java's `MurmurHash3.hash(new long[] {42}, 9001)`.
+/// let expected = datasketches::hash::murmurhash3_x64_128(&42_u64.to_le_bytes(), 9001);
+/// assert_eq!((h1, h2), expected);
+/// ```
+#[derive(Debug, Clone)]
 pub struct MurmurHash3X64128 {
     h1: u64,
     h2: u64,
@@ -34,6 +55,9 @@ pub struct MurmurHash3X64128 {
 }
 
 impl MurmurHash3X64128 {
+    /// Creates a hasher with the given seed.
+    ///
+    /// The seed initializes both 64-bit halves of the state, as in Java's `MurmurHash3`.
     pub fn with_seed(seed: u64) -> Self {
         MurmurHash3X64128 {
             h1: seed,
@@ -44,6 +68,9 @@ impl MurmurHash3X64128 {
         }
     }
 
+    /// Returns the 128-bit hash of the bytes written so far as `(h1, h2)`.
+    ///
+    /// The hasher is not consumed, so more bytes can be written afterwards.
     pub fn finish128(&self) -> (u64, u64) {
         let mut h1 = self.h1;
         let mut h2 = self.h2;
@@ -114,6 +141,7 @@ impl MurmurHash3X64128 {
 }
 
 impl Default for MurmurHash3X64128 {
+    /// Creates a hasher with [`DEFAULT_UPDATE_SEED`].
     fn default() -> Self {
         Self::with_seed(DEFAULT_UPDATE_SEED)
     }
@@ -124,6 +152,8 @@ impl Hasher for MurmurHash3X64128 {
         self.finish128().0
     }
 
+    super::write_integers_le!();
+
     fn write(&mut self, mut bytes: &[u8]) {
         if self.buf_len + bytes.len() < 16 {
             self.buf[self.buf_len..self.buf_len + bytes.len()].copy_from_slice(bytes);
@@ -166,6 +196,25 @@ impl Hasher for MurmurHash3X64128 {
     }
 }
 
+/// Computes the MurmurHash3 x64 128-bit hash of `key` with the given `seed`.
+///
+/// The result matches Java's `MurmurHash3.hash(byte[] key, long seed)` and C++'s
+/// `MurmurHash3_x64_128`.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hash::murmurhash3_x64_128;
+/// let (h1, h2) = murmurhash3_x64_128(b"The quick brown fox jumps over the lazy dog", 0);
+/// assert_eq!(h1, 0xe34bbc7bbc071b6c);
+/// assert_eq!(h2, 0x7a433ca9c49a9347);
+/// ```
+pub fn murmurhash3_x64_128(key: &[u8], seed: u64) -> (u64, u64) {
+    let mut hasher = MurmurHash3X64128::with_seed(seed);
+    hasher.write(key);
+    hasher.finish128()
+}
+
 /// Finalization mix: force all bits of a hash block to avalanche.
 #[inline]
 fn fmix64(mut k: u64) -> u64 {
@@ -178,13 +227,9 @@ fn fmix64(mut k: u64) -> u64 {
 
 #[cfg(test)]
 mod tests {
-    use super::*;
+    use std::hash::Hash;
 
-    fn murmurhash3_x64_128(key: &[u8], seed: u64) -> (u64, u64) {
-        let mut hasher = MurmurHash3X64128::with_seed(seed);
-        hasher.write(key);
-        hasher.finish128()
-    }
+    use super::*;
 
     #[test]
     fn test_remainder() {
@@ -229,4 +274,70 @@ mod tests {
         assert_eq!(h1, 0xe88abda785929c9e);
         assert_eq!(h2, 0x96b98587cacc83d6);
     }
+
+    #[test]
+    fn test_incremental_writes() {
+        let key = "The quick brown fox jumps over the lazy dog".as_bytes();
+        let expected = murmurhash3_x64_128(key, 9001);
+        for split in 0..key.len() {
+            let mut hasher = MurmurHash3X64128::with_seed(9001);
+            hasher.write(&key[..split]);
+            hasher.write(&key[split..]);
+            assert_eq!(hasher.finish128(), expected, "split at {split}");
+        }
+    }
+
+    #[test]
+    fn test_integer_writes_are_little_endian() {
+        let hash_of = |write: &dyn Fn(&mut MurmurHash3X64128)| {
+            let mut hasher = MurmurHash3X64128::default();
+            write(&mut hasher);
+            hasher.finish128()
+        };
+        let expected = |bytes: &[u8]| murmurhash3_x64_128(bytes, DEFAULT_UPDATE_SEED);
+
+        assert_eq!(hash_of(&|h| h.write_u16(0x0102)), expected(&[2, 1]));
+        assert_eq!(
+            hash_of(&|h| h.write_i32(-2)),
+            expected(&[0xfe, 0xff, 0xff, 0xff])
+        );
+        assert_eq!(
+            hash_of(&|h| h.write_u64(0x0102_0304_0506_0708)),
+            expected(&[8, 7, 6, 5, 4, 3, 2, 1])
+        );
+        let mut bytes = [0; 16];
+        bytes[0] = 1;
+        bytes[15] = 0x80;
+        assert_eq!(hash_of(&|h| h.write_u128((1 << 127) | 1)), expected(&bytes));
+        assert_eq!(hash_of(&|h| h.write_i128((1 << 127) | 1)), expected(&bytes));
+    }
+
+    #[test]
+    fn test_hash_trait_matches_java_conventions() {
+        // Java hashes a long as its 8 little-endian bytes
+        let mut hasher = MurmurHash3X64128::default();
+        (-7_i64).hash(&mut hasher);
+        assert_eq!(
+            hasher.finish128(),
+            murmurhash3_x64_128(&(-7_i64).to_le_bytes(), DEFAULT_UPDATE_SEED)
+        );
+
+        // Rust's `str` hash appends a 0xff terminator that Java's UTF-8 string hash does not
+        let mut hasher = MurmurHash3X64128::default();
+        "abc".hash(&mut hasher);
+        assert_eq!(
+            hasher.finish128(),
+            murmurhash3_x64_128(b"abc\xff", DEFAULT_UPDATE_SEED)
+        );
+
+        // Java hashes a char[] as its little-endian UTF-16 code units, across many blocks
+        let text = "The quick brown fox jumps over the lazy dog, \u{00e9}t\u{00e9} \u{1F600}";
+        let units: Vec<u8> = text.encode_utf16().flat_map(u16::to_le_bytes).collect();
+        let mut hasher = MurmurHash3X64128::default();
+        crate::hash_value::utf16::from_str(text).hash(&mut hasher);
+        assert_eq!(
+            hasher.finish128(),
+            murmurhash3_x64_128(&units, DEFAULT_UPDATE_SEED)
+        );
+    }
 }
@@ -134,6 +134,8 @@ impl Hasher for XxHash64 {
         self.finish64()
     }
 
+    super::write_integers_le!();
+
     fn write(&mut self, bytes: &[u8]) {
         self.total_len = self.total_len.wrapping_add(bytes.len() as u64);
 
@@ -226,6 +228,20 @@ mod tests {
         assert_eq!(xxhash64(&buf[..100], 0), 0x4BFE019CD91D9EA4);
     }
 
+    #[test]
+    fn test_integer_writes_are_little_endian() {
+        let mut hasher = XxHash64::with_seed(0);
+        hasher.write_u32(0x0102_0304);
+        hasher.write_i64(-2);
+        assert_eq!(
+            hasher.finish64(),
+            xxhash64(
+                &[4, 3, 2, 1, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff],
+                0
+            )
+        );
+    }
+
     #[test]
     fn test_vectors_seed_prime32() {
         let buf = fill_test_buffer(101);
@@ -0,0 +1,137 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! IP address hash value wrappers.
+//!
+//! [`IpAddrBytes`] hashes IP addresses as their octets in network byte order: 4 bytes for IPv4
+//! and 16 bytes for IPv6. Rust's own `Hash` for [`IpAddr`] also writes the address family, so
+//! it agrees with no other implementation.
+//!
+//! IPv4-mapped IPv6 addresses such as `::ffff:192.0.2.1` hash as the IPv4 address they map,
+//! matching Java, where `InetAddress` parses them as an `Inet4Address`. The hash then equals
+//! that of `update(address.getAddress())` in the Java sketches.
+
+use std::hash::Hasher;
+use std::net::IpAddr;
+use std::net::Ipv4Addr;
+use std::net::Ipv6Addr;
+
+use super::value::HashStrategy;
+use super::value::Value;
+
+/// An IP address value wrapper that hashes the address octets.
+///
+/// See the [module level documentation](super) for more.
+pub type IpAddrBytes<T> = Value<T, IpAddrBytesStrategy>;
+
+/// Hashing strategy for [`IpAddrBytes`].
+#[doc(hidden)]
+pub struct IpAddrBytesStrategy;
+
+/// Create an octet hashable value from an IP address.
+///
+/// # Examples
+///
+/// ```
+/// # use std::net::IpAddr;
+/// # use datasketches::hash_value::calculate_hash;
+/// # use datasketches::hash_value::ip_addr::from_ip_addr;
+/// # use datasketches::hash_value::raw_bytes::from_slice;
+/// let v4: IpAddr = "192.0.2.1".parse().unwrap();
+/// assert_eq!(
+///     calculate_hash(from_ip_addr(v4)),
+///     calculate_hash(from_slice(&[192, 0, 2, 1]))
+/// );
+///
+/// let mapped: IpAddr = "::ffff:192.0.2.1".parse().unwrap();
+/// assert_eq!(
+///     calculate_hash(from_ip_addr(mapped)),
+///     calculate_hash(from_ip_addr(v4))
+/// );
+/// ```
+pub fn from_ip_addr(v: IpAddr) -> IpAddrBytes<IpAddr> {
+    IpAddrBytes::new(v)
+}
+
+/// Create an octet hashable value from an IPv4 address.
+///
+/// # Examples
+///
+/// ```
+/// # use std::net::IpAddr;
+/// # use std::net::Ipv4Addr;
+/// # use datasketches::hash_value::calculate_hash;
+/// # use datasketches::hash_value::ip_addr::{from_ip_addr, from_ipv4};
+/// let addr = Ipv4Addr::new(192, 0, 2, 1);
+/// assert_eq!(
+///     calculate_hash(from_ipv4(addr)),
+///     calculate_hash(from_ip_addr(IpAddr::V4(addr)))
+/// );
+/// ```
+pub fn from_ipv4(v: Ipv4Addr) -> IpAddrBytes<Ipv4Addr> {
+    IpAddrBytes::new(v)
+}
+
+/// Create an octet hashable value from an IPv6 address.
+///
+/// # Examples
+///
+/// ```
+/// # use std::net::Ipv4Addr;
+/// # use std::net::Ipv6Addr;
+/// # use datasketches::hash_value::calculate_hash;
+/// # use datasketches::hash_value::ip_addr::{from_ipv4, from_ipv6};
+/// # use datasketches::hash_value::raw_bytes::from_slice;
+/// let addr = Ipv6Addr::LOCALHOST;
+/// assert_eq!(
+///     calculate_hash(from_ipv6(addr)),
+///     calculate_hash(from_slice(&addr.octets()))
+/// );
+///
+/// let v4 = Ipv4Addr::new(192, 0, 2, 1);
+/// assert_eq!(
+///     calculate_hash(from_ipv6(v4.to_ipv6_mapped())),
+///     calculate_hash(from_ipv4(v4))
+/// );
+/// ```
+pub fn from_ipv6(v: Ipv6Addr) -> IpAddrBytes<Ipv6Addr> {
+    IpAddrBytes::new(v)
+}
+
+impl HashStrategy<Ipv4Addr> for IpAddrBytesStrategy {
+    fn hash<H: Hasher>(value: &Ipv4Addr, state: &mut H) {
+        state.write(&value.octets());
+    }
+}
+
+impl HashStrategy<Ipv6Addr> for IpAddrBytesStrategy {
+    fn hash<H: Hasher>(value: &Ipv6Addr, state: &mut H) {
+        match value.to_ipv4_mapped() {
+            Some(v4) => state.write(&v4.octets()),
+            None => state.write(&value.octets()),
+        }
+    }
+}
+
+impl HashStrategy<IpAddr> for IpAddrBytesStrategy {
+    fn hash<H: Hasher>(value: &IpAddr, state: &mut H) {
+        match value {
+            IpAddr::V4(v4) => <Self as HashStrategy<Ipv4Addr>>::hash(v4, state),
+            IpAddr::V6(v6) => <Self as HashStrategy<Ipv6Addr>>::hash(v6, state),
+        }
+    }
+}
@@ -71,11 +71,66 @@
 //! * [`raw_bytes::from_string`]
 //! * [`raw_bytes::from_slice`]
 //! * [`raw_bytes::from_str`]
+//!
+//! ## UTF-16 Strings
+//!
+//! [`utf16::Utf16`] hashes strings as their UTF-16 code units in little-endian byte order, which
+//! is how the Java sketches hash a `char[]`. Use it to agree with Java code that updates sketches
+//! with `String.toCharArray()`; Java's `update(String)` hashes UTF-8 bytes like
+//! [`raw_bytes::from_str`].
+//!
+//! Read the docs of concrete value wrapper for more details and examples.
+//!
+//! * [`utf16::from_string`]
+//! * [`utf16::from_str`]
+//! * [`utf16::from_units`]
+//!
+//! ## IP Addresses
+//!
+//! [`ip_addr::IpAddrBytes`] hashes IP addresses as their octets in network byte order, with
+//! IPv4-mapped IPv6 addresses hashing as their IPv4 address, the way Java hashes the bytes of an
+//! `InetAddress`.
+//!
+//! Read the docs of concrete value wrapper for more details and examples.
+//!
+//! * [`ip_addr::from_ip_addr`]
+//! * [`ip_addr::from_ipv4`]
+//! * [`ip_addr::from_ipv6`]
+//!
+//! ## User-defined Types
+//!
+//! Domain types are fed to sketches through their own [`Hash`] impl. To give such a type one
+//! canonical byte representation wherever it is sketched, implement `Hash` by writing exactly
+//! those bytes, or by hashing one of the wrappers above, rather than deriving it: a derived impl
+//! hashes every field with its Rust representation, including length prefixes and enum
+//! discriminants. Identifiers such as UUIDs are usually best hashed as their raw bytes.
+//!
+//! ```
+//! # use std::hash::Hash;
+//! # use std::hash::Hasher;
+//! # use datasketches::hash_value::calculate_hash;
+//! # use datasketches::hash_value::raw_bytes;
+//! /// A user id, hashed as its 16 raw bytes like `update(byte[])` in Java.
+//! struct UserId([u8; 16]);
+//!
+//! impl Hash for UserId {
+//!     fn hash<H: Hasher>(&self, state: &mut H) {
+//!         raw_bytes::from_slice(&self.0).hash(state);
+//!     }
+//! }
+//!
+//! assert_eq!(
+//!     calculate_hash(UserId([7; 16])),
+//!     calculate_hash(raw_bytes::from_slice(&[7; 16]))
+//! );
+//! ```
 
 pub mod canonical_float;
+pub mod ip_addr;
 pub mod natural_extend;
 pub mod raw_bytes;
 pub mod sign_extend;
+pub mod utf16;
 pub mod value;
 
 use std::hash::Hash;
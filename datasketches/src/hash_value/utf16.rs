@@ -0,0 +1,140 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! UTF-16 string hash value wrappers.
+//!
+//! [`Utf16`] hashes strings as their UTF-16 code units, each written as two little-endian bytes,
+//! without Rust's string length prefix.
+//!
+//! This is how the Java sketches hash a `char[]` passed to `update`, so a Java pipeline that
+//! updates with `String.toCharArray()` agrees with a Rust pipeline that updates with these
+//! wrappers. Java's `update(String)` hashes UTF-8 bytes instead, which
+//! [`raw_bytes::from_str`](super::raw_bytes::from_str) reproduces.
+//!
+//! Empty strings have zero bytes to hash, while the Java sketches skip empty arrays, so check
+//! `is_empty` before updating a sketch when that behavior matters.
+
+use std::hash::Hasher;
+
+use super::value::HashStrategy;
+use super::value::Value;
+
+/// A string value wrapper that hashes UTF-16 code units.
+///
+/// See the [module level documentation](super) for more.
+pub type Utf16<T> = Value<T, Utf16Strategy>;
+
+/// Hashing strategy for [`Utf16`].
+#[doc(hidden)]
+pub struct Utf16Strategy;
+
+/// Create a UTF-16 hashable value from a string.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hash_value::calculate_hash;
+/// # use datasketches::hash_value::utf16::{from_str, from_string};
+/// assert_eq!(
+///     calculate_hash(from_string("abc".to_owned())),
+///     calculate_hash(from_str("abc"))
+/// );
+/// assert!(from_string(String::new()).is_empty());
+/// ```
+pub fn from_string(v: String) -> Utf16<String> {
+    Utf16::new(v)
+}
+
+/// Create a UTF-16 hashable value from a string slice.
+///
+/// Characters outside the Basic Multilingual Plane hash as their surrogate pairs, as they are
+/// stored in a Java `char[]`.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hash_value::calculate_hash;
+/// # use datasketches::hash_value::raw_bytes;
+/// # use datasketches::hash_value::utf16::{from_str, from_units};
+/// assert_eq!(
+///     calculate_hash(from_str("ab")),
+///     calculate_hash(raw_bytes::from_slice(&[b'a', 0, b'b', 0]))
+/// );
+/// assert_eq!(
+///     calculate_hash(from_str("\u{1F600}")),
+///     calculate_hash(from_units(&[0xD83D, 0xDE00]))
+/// );
+/// assert!(from_str("").is_empty());
+/// ```
+pub fn from_str(v: &str) -> Utf16<&str> {
+    Utf16::new(v)
+}
+
+/// Create a UTF-16 hashable value from UTF-16 code units, such as a `char[]` received from Java.
+///
+/// The units are hashed as they are, so unpaired surrogates need not be valid UTF-16.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hash_value::calculate_hash;
+/// # use datasketches::hash_value::utf16::{from_str, from_units};
+/// let units: Vec<u16> = "abc".encode_utf16().collect();
+/// assert_eq!(
+///     calculate_hash(from_units(&units)),
+///     calculate_hash(from_str("abc"))
+/// );
+/// assert!(from_units(&[]).is_empty());
+/// ```
+pub fn from_units(v: &[u16]) -> Utf16<&[u16]> {
+    Utf16::new(v)
+}
+
+/// Writes code units as little-endian bytes, a chunk at a time.
+fn write_units<H: Hasher>(units: impl Iterator<Item = u16>, state: &mut H) {
+    let mut buf = [0u8; 64];
+    let mut len = 0;
+    for unit in units {
+        buf[len..len + 2].copy_from_slice(&unit.to_le_bytes());
+        len += 2;
+        if len == buf.len() {
+            state.write(&buf);
+            len = 0;
+        }
+    }
+    if len > 0 {
+        state.write(&buf[..len]);
+    }
+}
+
+impl HashStrategy<String> for Utf16Strategy {
+    fn hash<H: Hasher>(value: &String, state: &mut H) {
+        write_units(value.encode_utf16(), state);
+    }
+}
+
+impl HashStrategy<&str> for Utf16Strategy {
+    fn hash<H: Hasher>(value: &&str, state: &mut H) {
+        write_units(value.encode_utf16(), state);
+    }
+}
+
+impl HashStrategy<&[u16]> for Utf16Strategy {
+    fn hash<H: Hasher>(value: &&[u16], state: &mut H) {
+        write_units(value.iter().copied(), state);
+    }
+}
@@ -34,12 +34,37 @@ use crate::hll::serialization::COUPON_SIZE_BYTES;
 use crate::hll::serialization::CUR_MODE_HLL;
 use crate::hll::serialization::HLL_PREAMBLE_SIZE;
 use crate::hll::serialization::HLL_PREINTS;
+use crate::hll::serialization::MAX_REGISTER_VALUE;
 use crate::hll::serialization::OUT_OF_ORDER_FLAG_MASK;
 use crate::hll::serialization::SERIAL_VERSION;
 use crate::hll::serialization::TGT_HLL4;
+use crate::hll::serialization::check_hll_header;
 use crate::hll::serialization::encode_mode_byte;
 
-const AUX_TOKEN: u8 = 15;
+pub(super) const AUX_TOKEN: u8 = 15;
+
+/// Check that the 4-bit values of an HLL4 image, offset by `cur_min`, are register values
+///
+/// Only a `cur_min` close to the largest register value can push the values past it, so the
+/// registers are scanned for those alone.
+pub(super) fn check_packed_values(data: &[u8], cur_min: u8) -> Result<(), Error> {
+    if cur_min + (AUX_TOKEN - 1) <= MAX_REGISTER_VALUE {
+        return Ok(());
+    }
+    let max_raw = data
+        .iter()
+        .flat_map(|&byte| [byte & 0x0F, byte >> 4])
+        .filter(|&raw| raw < AUX_TOKEN)
+        .max()
+        .unwrap_or(0);
+    if cur_min + max_raw > MAX_REGISTER_VALUE {
+        return Err(Error::deserial(format!(
+            "register value {} exceeds {MAX_REGISTER_VALUE}",
+            cur_min + max_raw
+        )));
+    }
+    Ok(())
+}
 
 /// Core Array4 data structure - stores 4-bit values efficiently
 #[derive(Debug, Clone, PartialEq)]
@@ -72,17 +97,21 @@ impl Array4 {
         }
     }
 
+    /// Zero all registers in place and drop the exception table, returning to the state of
+    /// [`new`](Self::new).
+    pub fn clear(&mut self) {
+        self.bytes.fill(0);
+        self.cur_min = 0;
+        self.num_at_cur_min = 1 << self.lg_config_k;
+        self.aux_map = None;
+        self.estimator = HipEstimator::new(self.lg_config_k);
+    }
+
     /// Get raw 4-bit value from slot (not adjusted for cur_min)
     #[inline]
     fn get_raw(&self, slot: u32) -> u8 {
         debug_assert!(slot >> 1 < self.bytes.len() as u32);
-
-        let byte = self.bytes[(slot >> 1) as usize];
-        if slot & 1 == 0 {
-            byte & 15 // low nibble for even slots
-        } else {
-            byte >> 4 // high nibble for odd slots
-        }
+        get_packed(&self.bytes, slot)
     }
 
     /// Get the actual value at a slot (adjusted for cur_min and aux_map)
@@ -109,6 +138,21 @@ impl Array4 {
         1 << self.lg_config_k
     }
 
+    /// Get the current minimum register value
+    pub(super) fn cur_min(&self) -> u8 {
+        self.cur_min
+    }
+
+    /// Get the number of registers at the current minimum value
+    pub(super) fn num_at_cur_min(&self) -> u32 {
+        self.num_at_cur_min
+    }
+
+    /// Iterate over the (slot, value) pairs of the exception table
+    pub(super) fn aux_entries(&self) -> impl Iterator<Item = (u32, u8)> + '_ {
+        self.aux_map.iter().flat_map(|aux| aux.iter())
+    }
+
     /// Get the current HIP accumulator value
     pub(super) fn hip_accum(&self) -> f64 {
         self.estimator.hip_accum()
@@ -261,6 +305,17 @@ impl Array4 {
             .estimate(self.lg_config_k, self.cur_min, self.num_at_cur_min)
     }
 
+    /// Get the composite estimate, which ignores the HIP accumulator
+    pub fn composite_estimate(&self) -> f64 {
+        self.estimator
+            .composite_estimate(self.lg_config_k, self.cur_min, self.num_at_cur_min)
+    }
+
+    /// Get the HIP estimator state of this array
+    pub(super) fn estimator(&self) -> &HipEstimator {
+        &self.estimator
+    }
+
     /// Get upper bound for cardinality estimate
     pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
         self.estimator.upper_bound(
@@ -288,6 +343,11 @@ impl Array4 {
         self.estimator.set_hip_accum(value);
     }
 
+    /// Set the out-of-order flag, which invalidates the HIP accumulator when set
+    pub(super) fn set_out_of_order(&mut self, ooo: bool) {
+        self.estimator.set_out_of_order(ooo);
+    }
+
     /// Check if the sketch is empty (all slots are zero)
     pub fn is_empty(&self) -> bool {
         self.num_at_cur_min == (1 << self.lg_config_k) && self.cur_min == 0
@@ -296,10 +356,13 @@ impl Array4 {
     /// Deserialize Array4 from HLL mode bytes
     ///
     /// Expects full HLL preamble (40 bytes) followed by packed 4-bit data and optional aux map.
+    /// A compact image lists the aux entries sequentially, while an updatable image stores the
+    /// whole aux hash table of `1 << lg_aux_arr` entries.
     pub fn deserialize(
         mut cursor: SketchSlice,
         cur_min: u8,
         lg_config_k: u8,
+        lg_aux_arr: u8,
         compact: bool,
         ooo: bool,
     ) -> Result<Self, Error> {
@@ -319,31 +382,45 @@ impl Array4 {
         let aux_count = cursor
             .read_u32_le()
             .map_err(insufficient_data("aux_count"))?;
+        check_hll_header(lg_config_k, cur_min, num_at_cur_min)?;
 
         // Read packed 4-bit byte array
         let mut data = vec![0u8; num_bytes];
-        if !compact {
-            cursor
-                .read_exact(&mut data)
-                .map_err(insufficient_data("data"))?;
-        } else {
-            cursor.advance(num_bytes as u64);
-        }
+        cursor
+            .read_exact(&mut data)
+            .map_err(insufficient_data("data"))?;
+        check_packed_values(&data, cur_min)?;
 
         // Read aux map if present
         let mut aux_map = None;
         if aux_count > 0 {
+            // at most k - 1 exceptions at a 3/4 load factor fit in a table of 2k entries
+            let max_lg_aux_arr = lg_config_k + 1;
+            if !compact && lg_aux_arr > max_lg_aux_arr {
+                return Err(Error::deserial(format!(
+                    "aux table lg_arr must be at most {max_lg_aux_arr} for lg_k {lg_config_k}, \
+                     got {lg_aux_arr}"
+                )));
+            }
+            let num_aux_entries = if compact { aux_count } else { 1 << lg_aux_arr };
             let mut aux = AuxMap::new(lg_config_k);
-            for i in 0..aux_count {
+            for i in 0..num_aux_entries {
                 let coupon = cursor.read_u32_le().map_err(|_| {
                     Error::insufficient_data(format!(
-                        "expected {aux_count} aux coupons, failed at index {i}",
+                        "expected {num_aux_entries} aux entries, failed at index {i}",
                     ))
                 })?;
                 let coupon = Coupon(coupon);
+                if coupon.is_empty() {
+                    continue;
+                }
                 let slot = coupon.slot() & ((1 << lg_config_k) - 1);
-                let value = coupon.value();
-                aux.insert(slot, value);
+                if aux.get(slot).is_some() {
+                    return Err(Error::deserial(format!(
+                        "aux map holds slot {slot} more than once"
+                    )));
+                }
+                aux.insert(slot, coupon.value());
             }
             aux_map = Some(aux);
         }
@@ -368,31 +445,35 @@ impl Array4 {
     /// Serialize Array4 to bytes
     ///
     /// Produces full HLL preamble (40 bytes) followed by packed 4-bit data and optional aux map.
-    pub fn serialize(&self, lg_config_k: u8) -> Vec<u8> {
-        let num_bytes = 1 << (lg_config_k - 1); // k/2 bytes for 4-bit packing
-
+    /// The compact form writes only the populated aux entries; the updatable form writes the
+    /// whole aux hash table and records its size in the lg_arr byte.
+    pub fn serialize(&self, bytes: &mut SketchBytes, lg_config_k: u8, compact: bool) {
         // Collect aux map entries if present
-        let aux_entries: Vec<(u32, u8)> = if let Some(aux) = &self.aux_map {
-            aux.iter().collect()
-        } else {
-            vec![]
+        let aux_map = self.aux_map.as_ref().filter(|aux| aux.len() > 0);
+        let aux_entries: Vec<Coupon> = match aux_map {
+            Some(aux) if compact => aux
+                .iter()
+                .map(|(slot, value)| Coupon::pack(slot, value))
+                .collect(),
+            Some(aux) => aux.entries().to_vec(),
+            None => vec![],
+        };
+        let lg_aux_arr = match aux_map {
+            Some(aux) if !compact => aux.lg_size(),
+            _ => 0,
         };
 
-        let aux_count = aux_entries.len() as u32;
-        let total_size = HLL_PREAMBLE_SIZE + num_bytes + (aux_count as usize * COUPON_SIZE_BYTES);
-        let mut bytes = SketchBytes::with_capacity(total_size);
+        let aux_count = aux_map.map_or(0, |aux| aux.len());
 
         // Write standard header
         bytes.write_u8(HLL_PREINTS);
         bytes.write_u8(SERIAL_VERSION);
         bytes.write_u8(Family::HLL.id);
         bytes.write_u8(lg_config_k);
-        bytes.write_u8(0); // unused for HLL mode
+        bytes.write_u8(lg_aux_arr);
 
-        // Write flags.
-        // COMPACT_FLAG_MASK is always set: aux map entries are written as a compact sequential
-        // list of populated entries only.
-        let mut flags = COMPACT_FLAG_MASK;
+        // Write flags
+        let mut flags = if compact { COMPACT_FLAG_MASK } else { 0 };
         if self.estimator.is_out_of_order() {
             flags |= OUT_OF_ORDER_FLAG_MASK;
         }
@@ -419,11 +500,20 @@ impl Array4 {
         bytes.write(&self.bytes);
 
         // Write aux map entries if present
-        for (slot, value) in aux_entries.iter().copied() {
-            bytes.write_u32_le(Coupon::pack(slot, value).raw());
+        for coupon in aux_entries {
+            bytes.write_u32_le(coupon.raw());
         }
+    }
 
-        bytes.into_bytes()
+    /// Returns the number of bytes [`serialize`](Self::serialize) writes.
+    pub fn serialized_size(&self, lg_config_k: u8, compact: bool) -> usize {
+        let num_bytes = 1 << (lg_config_k - 1); // k/2 bytes for 4-bit packing
+        let num_aux_entries = match self.aux_map.as_ref().filter(|aux| aux.len() > 0) {
+            Some(aux) if compact => aux.len() as usize,
+            Some(aux) => aux.entries().len(),
+            None => 0,
+        };
+        HLL_PREAMBLE_SIZE + num_bytes + (num_aux_entries * COUPON_SIZE_BYTES)
     }
 
     /// Returns the estimated size of the heap allocations in bytes
@@ -437,6 +527,17 @@ impl Array4 {
     }
 }
 
+/// Read the raw 4-bit value at `slot` from a packed register array
+#[inline]
+pub(super) fn get_packed(bytes: &[u8], slot: u32) -> u8 {
+    let byte = bytes[(slot >> 1) as usize];
+    if slot & 1 == 0 {
+        byte & 15 // low nibble for even slots
+    } else {
+        byte >> 4 // high nibble for odd slots
+    }
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -541,4 +642,45 @@ mod tests {
             assert_eq!(arr.get(slot), 1);
         }
     }
+
+    #[test]
+    fn test_serialize_round_trip_with_aux_entries() {
+        use crate::hll::HllSketch;
+        use crate::hll::mode::Mode;
+
+        let lg_config_k = 6;
+        let mut arr = Array4::new(lg_config_k);
+        for slot in 0..10 {
+            arr.update(Coupon::pack(slot, 16 + slot as u8));
+        }
+        for slot in 10..(1 << lg_config_k) {
+            arr.update(Coupon::pack(slot, 1));
+        }
+        let aux = arr.aux_map.as_ref().unwrap();
+        assert_eq!(aux.len(), 10);
+
+        let serialize = |compact| {
+            let mut bytes = SketchBytes::with_capacity(0);
+            arr.serialize(&mut bytes, lg_config_k, compact);
+            assert_eq!(bytes.len(), arr.serialized_size(lg_config_k, compact));
+            bytes.into_bytes()
+        };
+        let compact = serialize(true);
+        let updatable = serialize(false);
+        assert_eq!(
+            compact.len(),
+            HLL_PREAMBLE_SIZE + 32 + 10 * COUPON_SIZE_BYTES
+        );
+        assert_eq!(
+            updatable.len(),
+            HLL_PREAMBLE_SIZE + 32 + (COUPON_SIZE_BYTES << aux.lg_size())
+        );
+        assert_eq!(updatable[4], aux.lg_size());
+
+        let expected = HllSketch::from_mode(lg_config_k, Mode::Array4(arr));
+        for bytes in [compact, updatable] {
+            let sketch = HllSketch::deserialize(&bytes).unwrap();
+            assert_eq!(sketch, expected);
+        }
+    }
 }
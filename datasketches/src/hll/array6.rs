@@ -35,6 +35,7 @@ use crate::hll::serialization::HLL_PREINTS;
 use crate::hll::serialization::OUT_OF_ORDER_FLAG_MASK;
 use crate::hll::serialization::SERIAL_VERSION;
 use crate::hll::serialization::TGT_HLL6;
+use crate::hll::serialization::check_hll_header;
 use crate::hll::serialization::encode_mode_byte;
 
 const VAL_MASK_6: u16 = 0x3F; // 6 bits: 0b0011_1111
@@ -64,20 +65,19 @@ impl Array6 {
         }
     }
 
+    /// Zero all registers in place, returning to the state of [`new`](Self::new).
+    pub fn clear(&mut self) {
+        self.bytes.fill(0);
+        self.num_zeros = 1 << self.lg_config_k;
+        self.estimator = HipEstimator::new(self.lg_config_k);
+    }
+
     /// Get value from a slot (6-bit value)
     ///
     /// Uses 16-bit window reads to handle values crossing byte boundaries.
     #[inline]
     fn get_raw(&self, slot: u32) -> u8 {
-        let start_bit = slot * 6;
-        let byte_idx = (start_bit >> 3) as usize; // Divide by 8
-        let shift = (start_bit & 7) as u8; // Mod 8
-
-        // Read 2 bytes as u16 (little-endian)
-        let two_bytes = u16::from_le_bytes([self.bytes[byte_idx], self.bytes[byte_idx + 1]]);
-
-        // Extract 6 bits at the shift position
-        ((two_bytes >> shift) & VAL_MASK_6) as u8
+        get_packed(&self.bytes, slot)
     }
 
     /// Get the unpacked 6-bit value (0-63) at the given slot
@@ -91,6 +91,11 @@ impl Array6 {
         1 << self.lg_config_k
     }
 
+    /// Get the number of registers that are still zero
+    pub(super) fn num_zeros(&self) -> u32 {
+        self.num_zeros
+    }
+
     /// Get the current HIP accumulator value
     pub(super) fn hip_accum(&self) -> f64 {
         self.estimator.hip_accum()
@@ -101,25 +106,7 @@ impl Array6 {
     /// Uses read-modify-write on 16-bit window to preserve surrounding bits.
     #[inline]
     fn put_raw(&mut self, slot: u32, value: u8) {
-        debug_assert!(value <= 63, "6-bit value must be 0-63");
-
-        let start_bit = slot * 6;
-        let byte_idx = (start_bit >> 3) as usize;
-        let shift = (start_bit & 0x7) as u8;
-
-        // Read current 2 bytes
-        let mut two_bytes = u16::from_le_bytes([self.bytes[byte_idx], self.bytes[byte_idx + 1]]);
-
-        // Clear the 6-bit slot
-        two_bytes &= !(VAL_MASK_6 << shift);
-
-        // Insert new value
-        two_bytes |= ((value as u16) & VAL_MASK_6) << shift;
-
-        // Write back
-        let bytes_out = two_bytes.to_le_bytes();
-        self.bytes[byte_idx] = bytes_out[0];
-        self.bytes[byte_idx + 1] = bytes_out[1];
+        put_packed(&mut self.bytes, slot, value);
     }
 
     /// Update with a coupon
@@ -151,6 +138,17 @@ impl Array6 {
         self.estimator.estimate(self.lg_config_k, 0, self.num_zeros)
     }
 
+    /// Get the composite estimate, which ignores the HIP accumulator
+    pub fn composite_estimate(&self) -> f64 {
+        self.estimator
+            .composite_estimate(self.lg_config_k, 0, self.num_zeros)
+    }
+
+    /// Get the HIP estimator state of this array
+    pub(super) fn estimator(&self) -> &HipEstimator {
+        &self.estimator
+    }
+
     /// Get upper bound for cardinality estimate
     pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
         self.estimator
@@ -170,6 +168,11 @@ impl Array6 {
         self.estimator.set_hip_accum(value);
     }
 
+    /// Set the out-of-order flag, which invalidates the HIP accumulator when set
+    pub(super) fn set_out_of_order(&mut self, ooo: bool) {
+        self.estimator.set_out_of_order(ooo);
+    }
+
     /// Check if the sketch is empty (all slots are zero)
     pub fn is_empty(&self) -> bool {
         self.num_zeros == (1 << self.lg_config_k)
@@ -178,12 +181,7 @@ impl Array6 {
     /// Deserialize Array6 from HLL mode bytes
     ///
     /// Expects full HLL preamble (40 bytes) followed by packed 6-bit data.
-    pub fn deserialize(
-        mut cursor: SketchSlice,
-        lg_config_k: u8,
-        compact: bool,
-        ooo: bool,
-    ) -> Result<Self, Error> {
+    pub fn deserialize(mut cursor: SketchSlice, lg_config_k: u8, ooo: bool) -> Result<Self, Error> {
         let k = 1 << lg_config_k;
         let num_bytes = num_bytes_for_k(k);
 
@@ -201,16 +199,13 @@ impl Array6 {
         let _aux_count = cursor
             .read_u32_le()
             .map_err(insufficient_data("aux_count"))?; // always 0
+        check_hll_header(lg_config_k, 0, num_zeros)?;
 
         // Read packed byte array from offset HLL_BYTE_ARR_START
         let mut data = vec![0u8; num_bytes];
-        if !compact {
-            cursor
-                .read_exact(&mut data)
-                .map_err(insufficient_data("data"))?;
-        } else {
-            cursor.advance(num_bytes as u64);
-        }
+        cursor
+            .read_exact(&mut data)
+            .map_err(insufficient_data("data"))?;
 
         // Create estimator and restore state
         let mut estimator = HipEstimator::new(lg_config_k);
@@ -230,12 +225,7 @@ impl Array6 {
     /// Serialize Array6 to bytes
     ///
     /// Produces full HLL preamble (40 bytes) followed by packed 6-bit data.
-    pub fn serialize(&self, lg_config_k: u8) -> Vec<u8> {
-        let k = 1 << lg_config_k;
-        let num_bytes = num_bytes_for_k(k);
-        let total_size = HLL_PREAMBLE_SIZE + num_bytes;
-        let mut bytes = SketchBytes::with_capacity(total_size);
-
+    pub fn serialize(&self, bytes: &mut SketchBytes, lg_config_k: u8) {
         // Write standard header
         bytes.write_u8(HLL_PREINTS);
         bytes.write_u8(SERIAL_VERSION);
@@ -269,8 +259,11 @@ impl Array6 {
 
         // Write packed byte array
         bytes.write(&self.bytes);
+    }
 
-        bytes.into_bytes()
+    /// Returns the number of bytes [`serialize`](Self::serialize) writes.
+    pub fn serialized_size(&self, lg_config_k: u8) -> usize {
+        HLL_PREAMBLE_SIZE + num_bytes_for_k(1 << lg_config_k)
     }
 
     /// Returns the estimated size of the heap allocations in bytes
@@ -280,7 +273,47 @@ impl Array6 {
 }
 
 /// Calculate number of bytes needed for k slots with 6 bits each
-fn num_bytes_for_k(k: u32) -> usize {
+/// Read the 6-bit value at `slot` from a packed register array
+#[inline]
+pub(super) fn get_packed(bytes: &[u8], slot: u32) -> u8 {
+    let start_bit = slot * 6;
+    let byte_idx = (start_bit >> 3) as usize; // Divide by 8
+    let shift = (start_bit & 7) as u8; // Mod 8
+
+    // Read 2 bytes as u16 (little-endian)
+    let two_bytes = u16::from_le_bytes([bytes[byte_idx], bytes[byte_idx + 1]]);
+
+    // Extract 6 bits at the shift position
+    ((two_bytes >> shift) & VAL_MASK_6) as u8
+}
+
+/// Write the 6-bit value at `slot` into a packed register array
+///
+/// Uses read-modify-write on 16-bit window to preserve surrounding bits.
+#[inline]
+pub(super) fn put_packed(bytes: &mut [u8], slot: u32, value: u8) {
+    debug_assert!(value <= 63, "6-bit value must be 0-63");
+
+    let start_bit = slot * 6;
+    let byte_idx = (start_bit >> 3) as usize;
+    let shift = (start_bit & 0x7) as u8;
+
+    // Read current 2 bytes
+    let mut two_bytes = u16::from_le_bytes([bytes[byte_idx], bytes[byte_idx + 1]]);
+
+    // Clear the 6-bit slot
+    two_bytes &= !(VAL_MASK_6 << shift);
+
+    // Insert new value
+    two_bytes |= ((value as u16) & VAL_MASK_6) << shift;
+
+    // Write back
+    let bytes_out = two_bytes.to_le_bytes();
+    bytes[byte_idx] = bytes_out[0];
+    bytes[byte_idx + 1] = bytes_out[1];
+}
+
+pub(super) fn num_bytes_for_k(k: u32) -> usize {
     // k slots * 6 bits = k * 6/8 bytes = k * 3/4 bytes
     // Add 1 for 16-bit window read safety
     (((k * 3) >> 2) + 1) as usize
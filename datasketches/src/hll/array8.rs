@@ -31,11 +31,24 @@ use crate::hll::estimator::HipEstimator;
 use crate::hll::serialization::CUR_MODE_HLL;
 use crate::hll::serialization::HLL_PREAMBLE_SIZE;
 use crate::hll::serialization::HLL_PREINTS;
+use crate::hll::serialization::MAX_REGISTER_VALUE;
 use crate::hll::serialization::OUT_OF_ORDER_FLAG_MASK;
 use crate::hll::serialization::SERIAL_VERSION;
 use crate::hll::serialization::TGT_HLL8;
+use crate::hll::serialization::check_hll_header;
 use crate::hll::serialization::encode_mode_byte;
 
+/// Check that the one-byte registers of an HLL8 image are register values
+pub(super) fn check_values(data: &[u8]) -> Result<(), Error> {
+    match data.iter().position(|&value| value > MAX_REGISTER_VALUE) {
+        Some(slot) => Err(Error::deserial(format!(
+            "register {slot} holds {}, more than {MAX_REGISTER_VALUE}",
+            data[slot]
+        ))),
+        None => Ok(()),
+    }
+}
+
 /// Core Array8 data structure - one byte per slot, no packing
 #[derive(Debug, Clone, PartialEq)]
 pub struct Array8 {
@@ -60,6 +73,29 @@ impl Array8 {
         }
     }
 
+    /// Creates an array from its registers and the matching estimator state.
+    pub(super) fn from_parts(
+        lg_config_k: u8,
+        registers: &[u8],
+        num_zeros: u32,
+        estimator: HipEstimator,
+    ) -> Self {
+        debug_assert_eq!(registers.len(), 1 << lg_config_k);
+        Self {
+            lg_config_k,
+            bytes: registers.into(),
+            num_zeros,
+            estimator,
+        }
+    }
+
+    /// Zero all registers in place, returning to the state of [`new`](Self::new).
+    pub fn clear(&mut self) {
+        self.bytes.fill(0);
+        self.num_zeros = 1 << self.lg_config_k;
+        self.estimator = HipEstimator::new(self.lg_config_k);
+    }
+
     /// Get value from a slot
     ///
     /// Direct array access - no bit manipulation required.
@@ -105,6 +141,17 @@ impl Array8 {
         self.estimator.estimate(self.lg_config_k, 0, self.num_zeros)
     }
 
+    /// Get the composite estimate, which ignores the HIP accumulator
+    pub fn composite_estimate(&self) -> f64 {
+        self.estimator
+            .composite_estimate(self.lg_config_k, 0, self.num_zeros)
+    }
+
+    /// Get the HIP estimator state of this array
+    pub(super) fn estimator(&self) -> &HipEstimator {
+        &self.estimator
+    }
+
     /// Get upper bound for cardinality estimate
     pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
         self.estimator
@@ -124,6 +171,11 @@ impl Array8 {
         self.estimator.set_hip_accum(value);
     }
 
+    /// Set the out-of-order flag, which invalidates the HIP accumulator when set
+    pub(super) fn set_out_of_order(&mut self, ooo: bool) {
+        self.estimator.set_out_of_order(ooo);
+    }
+
     /// Check if the sketch is empty (all slots are zero)
     pub fn is_empty(&self) -> bool {
         self.num_zeros == (1 << self.lg_config_k)
@@ -139,6 +191,11 @@ impl Array8 {
         1 << self.lg_config_k
     }
 
+    /// Get the number of registers that are still zero
+    pub(super) fn num_zeros(&self) -> u32 {
+        self.num_zeros
+    }
+
     /// Get the current HIP accumulator value
     pub(super) fn hip_accum(&self) -> f64 {
         self.estimator.hip_accum()
@@ -252,12 +309,7 @@ impl Array8 {
     /// Deserialize Array8 from HLL mode bytes
     ///
     /// Expects full HLL preamble (40 bytes) followed by k bytes of data.
-    pub fn deserialize(
-        mut cursor: SketchSlice,
-        lg_config_k: u8,
-        compact: bool,
-        ooo: bool,
-    ) -> Result<Self, Error> {
+    pub fn deserialize(mut cursor: SketchSlice, lg_config_k: u8, ooo: bool) -> Result<Self, Error> {
         let k = 1usize << lg_config_k;
 
         // Read HIP estimator values from preamble
@@ -274,16 +326,14 @@ impl Array8 {
         let _aux_count = cursor
             .read_u32_le()
             .map_err(insufficient_data("aux_count"))?; // always 0
+        check_hll_header(lg_config_k, 0, num_zeros)?;
 
         // Read byte array from offset HLL_BYTE_ARR_START
         let mut data = vec![0u8; k];
-        if !compact {
-            cursor
-                .read_exact(&mut data)
-                .map_err(insufficient_data("data"))?;
-        } else {
-            cursor.advance(k as u64);
-        }
+        cursor
+            .read_exact(&mut data)
+            .map_err(insufficient_data("data"))?;
+        check_values(&data)?;
 
         // Create estimator and restore state
         let mut estimator = HipEstimator::new(lg_config_k);
@@ -303,11 +353,7 @@ impl Array8 {
     /// Serialize Array8 to bytes
     ///
     /// Produces full HLL preamble (40 bytes) followed by k bytes of data.
-    pub fn serialize(&self, lg_config_k: u8) -> Vec<u8> {
-        let k = 1 << lg_config_k;
-        let total_size = HLL_PREAMBLE_SIZE + k as usize;
-        let mut bytes = SketchBytes::with_capacity(total_size);
-
+    pub fn serialize(&self, bytes: &mut SketchBytes, lg_config_k: u8) {
         // Write standard header
         bytes.write_u8(HLL_PREINTS);
         bytes.write_u8(SERIAL_VERSION);
@@ -341,8 +387,11 @@ impl Array8 {
 
         // Write byte array
         bytes.write(&self.bytes);
+    }
 
-        bytes.into_bytes()
+    /// Returns the number of bytes [`serialize`](Self::serialize) writes.
+    pub fn serialized_size(&self, lg_config_k: u8) -> usize {
+        HLL_PREAMBLE_SIZE + (1 << lg_config_k)
     }
 
     /// Returns the estimated size of the heap allocations in bytes
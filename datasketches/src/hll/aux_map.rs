@@ -72,7 +72,7 @@ impl PartialEq for AuxMap {
 ///
 /// This determines the initial size of the auxiliary hash map
 /// based on the sketch size.
-fn lg_aux_arr_ints(lg_config_k: u8) -> u8 {
+pub(super) fn lg_aux_arr_ints(lg_config_k: u8) -> u8 {
     static LG_AUX_ARR_INTS: &[u8] = &[
         0, 2, 2, 2, 2, 2, 2, 3, 3, 3, // 0-9
         4, 4, 5, 5, 6, 7, 8, 9, 10, 11, // 10-19
@@ -215,6 +215,21 @@ impl AuxMap {
         self.lg_size = new_lg_size;
     }
 
+    /// Returns log2 of the hash table size
+    pub fn lg_size(&self) -> u8 {
+        self.lg_size
+    }
+
+    /// Returns the number of stored entries
+    pub fn len(&self) -> u32 {
+        self.count
+    }
+
+    /// Returns the raw hash table, including empty entries
+    pub fn entries(&self) -> &[Coupon] {
+        &self.entries
+    }
+
     /// Iterate over (slot, value) pairs without consuming the map
     pub fn iter(&self) -> impl Iterator<Item = (u32, u8)> + '_ {
         let config_k_mask = (1 << self.lg_config_k) - 1;
@@ -0,0 +1,158 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::common::SketchConfig;
+use crate::hll::HllSketch;
+use crate::hll::HllType;
+use crate::hll::array4::Array4;
+use crate::hll::array6::Array6;
+use crate::hll::array8::Array8;
+use crate::hll::mode::Mode;
+
+/// Default log2 of the number of buckets, as in Java.
+const DEFAULT_LG_K: u8 = 12;
+
+/// Builder for creating [`HllSketch`] instances.
+///
+/// Defaults to lg_k 12 and [`HllType::Hll4`], as in Java. Each setter validates its argument,
+/// so an invalid configuration is reported while the builder is set up rather than on first
+/// use.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hll::HllSketchBuilder;
+/// # use datasketches::hll::HllType;
+/// let mut sketch = HllSketchBuilder::default()
+///     .lg_k(14)
+///     .hll_type(HllType::Hll8)
+///     .build();
+/// sketch.update("apple");
+/// assert_eq!(sketch.lg_config_k(), 14);
+/// assert_eq!(sketch.estimate(), 1.0);
+/// ```
+#[derive(Debug, Clone)]
+pub struct HllSketchBuilder {
+    lg_k: u8,
+    hll_type: HllType,
+    start_full_size: bool,
+}
+
+impl Default for HllSketchBuilder {
+    fn default() -> Self {
+        Self {
+            lg_k: DEFAULT_LG_K,
+            hll_type: HllType::Hll4,
+            start_full_size: false,
+        }
+    }
+}
+
+impl HllSketchBuilder {
+    /// Set lg_k (log2 of the number of buckets).
+    ///
+    /// # Panics
+    ///
+    /// If lg_k is not in range `[4, 21]`
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketchBuilder;
+    /// let sketch = HllSketchBuilder::default().lg_k(10).build();
+    /// assert_eq!(sketch.lg_config_k(), 10);
+    /// ```
+    pub fn lg_k(mut self, lg_k: u8) -> Self {
+        assert!(
+            (4..=21).contains(&lg_k),
+            "lg_config_k must be in [4, 21], got {}",
+            lg_k
+        );
+        self.lg_k = lg_k;
+        self
+    }
+
+    /// Set the target HLL type.
+    pub fn hll_type(mut self, hll_type: HllType) -> Self {
+        self.hll_type = hll_type;
+        self
+    }
+
+    /// Apply the lg_k and HLL type of `config`, where set.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the lg_k of `config` is not in `[4, 21]`.
+    pub fn config(mut self, config: &SketchConfig) -> Self {
+        if let Some(lg_k) = config.lg_k {
+            self = self.lg_k(lg_k);
+        }
+        if let Some(hll_type) = config.hll_type {
+            self = self.hll_type(hll_type);
+        }
+        self
+    }
+
+    /// Start in HLL mode instead of List mode.
+    ///
+    /// A full-size sketch allocates its whole register array up front, which avoids the
+    /// promotions through List and Set mode when many distinct values are expected, and
+    /// estimates with the HIP estimator from the first update on. Like C++, a reset sketch
+    /// still returns to List mode.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketchBuilder;
+    /// let mut sketch = HllSketchBuilder::default()
+    ///     .lg_k(10)
+    ///     .start_full_size(true)
+    ///     .build();
+    /// assert!(sketch.is_empty());
+    ///
+    /// sketch.update("apple");
+    /// assert!(sketch.hip_estimate().is_some());
+    /// ```
+    pub fn start_full_size(mut self, start_full_size: bool) -> Self {
+        self.start_full_size = start_full_size;
+        self
+    }
+
+    /// Build the HllSketch.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllSketchBuilder;
+    /// # use datasketches::hll::HllType;
+    /// let sketch = HllSketchBuilder::default().build();
+    /// assert_eq!(sketch, HllSketch::new(12, HllType::Hll4));
+    /// ```
+    pub fn build(self) -> HllSketch {
+        if !self.start_full_size {
+            return HllSketch::new(self.lg_k, self.hll_type);
+        }
+
+        let mode = match self.hll_type {
+            HllType::Hll4 => Mode::Array4(Array4::new(self.lg_k)),
+            HllType::Hll6 => Mode::Array6(Array6::new(self.lg_k)),
+            HllType::Hll8 => Mode::Array8(Array8::new(self.lg_k)),
+        };
+        HllSketch::from_mode(self.lg_k, mode)
+    }
+}
@@ -0,0 +1,191 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! An HLL sketch updated through `&self` from many threads
+//!
+//! [`ConcurrentHll`] spreads updates over a fixed set of shards, each an HLL8 sketch behind
+//! its own lock. A thread sticks to one shard and only moves on to another when that shard is
+//! busy, so contention stays low without any per-thread registration. Queries merge the shards
+//! with an [`HllUnion`].
+
+use std::hash::Hash;
+use std::sync::Mutex;
+use std::sync::MutexGuard;
+use std::sync::atomic::AtomicUsize;
+use std::sync::atomic::Ordering;
+
+use crate::common::NumStdDev;
+use crate::hll::Coupon;
+use crate::hll::HllSketch;
+use crate::hll::HllType;
+use crate::hll::HllUnion;
+
+/// Source of the shard each thread tries first
+static NEXT_SHARD_HINT: AtomicUsize = AtomicUsize::new(0);
+
+thread_local! {
+    static SHARD_HINT: usize = NEXT_SHARD_HINT.fetch_add(1, Ordering::Relaxed);
+}
+
+/// A sharded HLL sketch with `&self` update methods.
+///
+/// The sketch is `Send` and `Sync`, so it can be shared behind an `Arc` by threads or async
+/// tasks. Every shard is an HLL8 [`HllSketch`] with the configured lg_k, so the memory use and
+/// the cost of a query grow with the number of shards. Since merged shards lose the sequential
+/// update history, estimates come from the composite estimator rather than the HIP estimator.
+///
+/// # Examples
+///
+/// ```
+/// # use std::sync::Arc;
+/// # use datasketches::hll::ConcurrentHll;
+/// let sketch = Arc::new(ConcurrentHll::with_shards(12, 4));
+/// let handles: Vec<_> = (0..4)
+///     .map(|t| {
+///         let sketch = Arc::clone(&sketch);
+///         std::thread::spawn(move || {
+///             for i in 0..1000 {
+///                 sketch.update(t * 1000 + i);
+///             }
+///         })
+///     })
+///     .collect();
+/// for handle in handles {
+///     handle.join().unwrap();
+/// }
+/// let error = (sketch.estimate() - 4000.0).abs() / 4000.0;
+/// assert!(error < 0.05);
+/// ```
+#[derive(Debug)]
+pub struct ConcurrentHll {
+    lg_config_k: u8,
+    shards: Box<[Mutex<HllSketch>]>,
+}
+
+impl ConcurrentHll {
+    /// Creates a sketch with one shard per available CPU.
+    ///
+    /// # Panics
+    ///
+    /// If `lg_config_k` is not in range [4, 21]
+    pub fn new(lg_config_k: u8) -> Self {
+        let num_shards = std::thread::available_parallelism().map_or(1, |n| n.get());
+        Self::with_shards(lg_config_k, num_shards)
+    }
+
+    /// Creates a sketch with `num_shards` shards.
+    ///
+    /// # Panics
+    ///
+    /// If `lg_config_k` is not in range [4, 21], or if `num_shards` is zero.
+    pub fn with_shards(lg_config_k: u8, num_shards: usize) -> Self {
+        assert!(num_shards > 0, "num_shards must be positive");
+        let shards = (0..num_shards)
+            .map(|_| Mutex::new(HllSketch::new(lg_config_k, HllType::Hll8)))
+            .collect();
+        Self {
+            lg_config_k,
+            shards,
+        }
+    }
+
+    /// Returns the configured lg_k
+    pub fn lg_config_k(&self) -> u8 {
+        self.lg_config_k
+    }
+
+    /// Returns the number of shards
+    pub fn num_shards(&self) -> usize {
+        self.shards.len()
+    }
+
+    /// Update the sketch with a hashable value.
+    ///
+    /// See [`HllSketch::update`].
+    pub fn update<T: Hash>(&self, value: T) {
+        self.update_with_coupon(Coupon::from_hash(value));
+    }
+
+    /// Update the sketch with an already computed 128-bit hash.
+    ///
+    /// See [`HllSketch::update_hash`].
+    pub fn update_hash(&self, lo: u64, hi: u64) {
+        self.update_with_coupon(Coupon::from_hash128(lo, hi));
+    }
+
+    /// Update the sketch with a pre-computed [`Coupon`].
+    ///
+    /// The coupon goes to the calling thread's shard, or to the first other shard that is not
+    /// locked. If all shards are busy, the call waits for the thread's own shard.
+    pub fn update_with_coupon(&self, coupon: Coupon) {
+        let start = SHARD_HINT.with(|hint| *hint) % self.shards.len();
+        for i in 0..self.shards.len() {
+            let shard = &self.shards[(start + i) % self.shards.len()];
+            if let Ok(mut sketch) = shard.try_lock() {
+                sketch.update_with_coupon(coupon);
+                return;
+            }
+        }
+        lock(&self.shards[start]).update_with_coupon(coupon);
+    }
+
+    /// Returns true if no shard has received an update
+    pub fn is_empty(&self) -> bool {
+        self.shards.iter().all(|shard| lock(shard).is_empty())
+    }
+
+    /// Returns the cardinality estimate of the merged shards
+    pub fn estimate(&self) -> f64 {
+        self.merge().estimate()
+    }
+
+    /// Returns the upper bound of the cardinality estimate given `num_std_dev`
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.merge().upper_bound(num_std_dev)
+    }
+
+    /// Returns the lower bound of the cardinality estimate given `num_std_dev`
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.merge().lower_bound(num_std_dev)
+    }
+
+    /// Merges the shards into a single sketch of the given type
+    pub fn to_sketch(&self, hll_type: HllType) -> HllSketch {
+        self.merge().to_sketch(hll_type)
+    }
+
+    /// Reset all shards to the empty state
+    pub fn reset(&self) {
+        for shard in self.shards.iter() {
+            lock(shard).reset();
+        }
+    }
+
+    fn merge(&self) -> HllUnion {
+        let mut union = HllUnion::new(self.lg_config_k);
+        for shard in self.shards.iter() {
+            union.update(&lock(shard));
+        }
+        union
+    }
+}
+
+fn lock(shard: &Mutex<HllSketch>) -> MutexGuard<'_, HllSketch> {
+    // A shard is only mutated by non-panicking updates, so a poisoned lock still guards a
+    // consistent sketch.
+    shard.lock().unwrap_or_else(|e| e.into_inner())
+}
@@ -106,29 +106,17 @@ impl Container {
 
     /// Get cardinality estimate using cubic interpolation
     pub fn estimate(&self) -> f64 {
-        let len = self.len as f64;
-        let est = using_x_and_y_tables(&X_ARR, &Y_ARR, len);
-        len.max(est)
+        coupon_estimate(self.len)
     }
 
     /// Get upper confidence bound for cardinality estimate
     pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
-        let len = self.len as f64;
-        let est = using_x_and_y_tables(&X_ARR, &Y_ARR, len);
-        // Upper bound: negative RSE means (1 + rse) < 1, so bound > estimate
-        let rse = -(num_std_dev as u8 as f64) * COUPON_RSE;
-        let bound = est / (1.0 + rse);
-        len.max(bound)
+        coupon_upper_bound(self.len, num_std_dev)
     }
 
     /// Get lower confidence bound for cardinality estimate
     pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
-        let len = self.len as f64;
-        let est = using_x_and_y_tables(&X_ARR, &Y_ARR, len);
-        // Lower bound: positive RSE means (1 + rse) > 1, so bound < estimate
-        let rse = (num_std_dev as u8 as f64) * COUPON_RSE;
-        let bound = est / (1.0 + rse);
-        len.max(bound)
+        coupon_lower_bound(self.len, num_std_dev)
     }
 
     /// Iterate over all non-empty coupons
@@ -141,3 +129,30 @@ impl Container {
         self.coupons.len() * size_of::<Coupon>()
     }
 }
+
+/// Cardinality estimate for `len` distinct coupons, using cubic interpolation
+pub(super) fn coupon_estimate(len: usize) -> f64 {
+    let len = len as f64;
+    let est = using_x_and_y_tables(&X_ARR, &Y_ARR, len);
+    len.max(est)
+}
+
+/// Upper confidence bound for `len` distinct coupons
+pub(super) fn coupon_upper_bound(len: usize, num_std_dev: NumStdDev) -> f64 {
+    let len = len as f64;
+    let est = using_x_and_y_tables(&X_ARR, &Y_ARR, len);
+    // Upper bound: negative RSE means (1 + rse) < 1, so bound > estimate
+    let rse = -(num_std_dev as u8 as f64) * COUPON_RSE;
+    let bound = est / (1.0 + rse);
+    len.max(bound)
+}
+
+/// Lower confidence bound for `len` distinct coupons
+pub(super) fn coupon_lower_bound(len: usize, num_std_dev: NumStdDev) -> f64 {
+    let len = len as f64;
+    let est = using_x_and_y_tables(&X_ARR, &Y_ARR, len);
+    // Lower bound: positive RSE means (1 + rse) > 1, so bound < estimate
+    let rse = (num_std_dev as u8 as f64) * COUPON_RSE;
+    let bound = est / (1.0 + rse);
+    len.max(bound)
+}
@@ -0,0 +1,362 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! An HLL sketch operating directly over an externally owned buffer
+//!
+//! [`DirectHllSketch`] keeps the HLL mode image of an HLL6 or HLL8 sketch in a caller-provided
+//! byte slice and updates its registers and estimator fields in place. The slice can be a
+//! memory-mapped file or a shared memory segment, so several processes can aggregate into the
+//! same sketch.
+
+use std::hash::Hash;
+
+use crate::codec::assert::ensure_lg_k_in;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::family::Family;
+use crate::common::NumStdDev;
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::hll::Coupon;
+use crate::hll::HllSketch;
+use crate::hll::HllType;
+use crate::hll::array6;
+use crate::hll::estimator::HipEstimator;
+use crate::hll::serialization::CUR_MODE_HLL;
+use crate::hll::serialization::HLL_PREAMBLE_SIZE;
+use crate::hll::serialization::HLL_PREINTS;
+use crate::hll::serialization::MAX_REGISTER_VALUE;
+use crate::hll::serialization::OUT_OF_ORDER_FLAG_MASK;
+use crate::hll::serialization::SERIAL_VERSION;
+use crate::hll::serialization::TGT_HLL4;
+use crate::hll::serialization::TGT_HLL6;
+use crate::hll::serialization::TGT_HLL8;
+use crate::hll::serialization::encode_mode_byte;
+use crate::hll::serialization::extract_cur_mode;
+use crate::hll::serialization::extract_tgt_hll_type;
+
+// Byte offsets of the HLL mode preamble fields
+const PREAMBLE_INTS_BYTE: usize = 0;
+const SERIAL_VERSION_BYTE: usize = 1;
+const FAMILY_BYTE: usize = 2;
+const LG_K_BYTE: usize = 3;
+const FLAGS_BYTE: usize = 5;
+const MODE_BYTE: usize = 7;
+const HIP_ACCUM_DOUBLE: usize = 8;
+const KXQ0_DOUBLE: usize = 16;
+const KXQ1_DOUBLE: usize = 24;
+const NUM_AT_CUR_MIN_INT: usize = 32;
+
+/// An HLL sketch whose registers live in a borrowed, fixed-size byte buffer.
+///
+/// The buffer holds the updatable HLL mode image of an HLL6 or HLL8 sketch: the 40-byte
+/// preamble with the HIP accumulator and KxQ registers, followed by the register array. Each
+/// update writes the changed register and estimator fields straight back, so the buffer is
+/// always a valid image that [`HllSketch::deserialize`], [`HllSketch::wrap`] or another
+/// [`DirectHllSketch`] can read. HLL4 is not supported because its exception table has no
+/// fixed size.
+///
+/// Unlike [`HllSketch`], a direct sketch starts in HLL mode rather than List mode, so its
+/// estimate comes from the HIP estimator from the first update on.
+///
+/// The sketch does not synchronize access to the buffer. Processes sharing one buffer must
+/// serialize their updates, for example with a file lock around each batch.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hll::DirectHllSketch;
+/// # use datasketches::hll::HllSketch;
+/// # use datasketches::hll::HllType;
+/// let mut buf = vec![0u8; DirectHllSketch::required_size_bytes(10, HllType::Hll8)];
+/// let mut sketch = DirectHllSketch::new(&mut buf, 10, HllType::Hll8).unwrap();
+/// for i in 0..1000 {
+///     sketch.update(i);
+/// }
+/// let estimate = sketch.estimate();
+///
+/// // The buffer is a regular HLL image.
+/// let heap = HllSketch::deserialize(&buf).unwrap();
+/// assert_eq!(heap.estimate(), estimate);
+/// ```
+#[derive(Debug)]
+pub struct DirectHllSketch<'a> {
+    bytes: &'a mut [u8],
+    lg_config_k: u8,
+    hll_type: HllType,
+}
+
+impl<'a> DirectHllSketch<'a> {
+    /// Returns the number of bytes a direct sketch with the given configuration needs.
+    ///
+    /// # Panics
+    ///
+    /// If `lg_config_k` is not in range [4, 21], or if `hll_type` is [`HllType::Hll4`].
+    pub fn required_size_bytes(lg_config_k: u8, hll_type: HllType) -> usize {
+        assert!(
+            (4..=21).contains(&lg_config_k),
+            "lg_config_k must be in [4, 21], got {}",
+            lg_config_k
+        );
+        let k = 1u32 << lg_config_k;
+        HLL_PREAMBLE_SIZE
+            + match hll_type {
+                HllType::Hll4 => panic!("direct HLL sketches support only Hll6 and Hll8"),
+                HllType::Hll6 => array6::num_bytes_for_k(k),
+                HllType::Hll8 => k as usize,
+            }
+    }
+
+    /// Creates an empty sketch in `bytes`, overwriting its contents.
+    ///
+    /// Returns an `InvalidArgument` error if `bytes` is shorter than
+    /// [`required_size_bytes`](Self::required_size_bytes).
+    ///
+    /// # Panics
+    ///
+    /// If `lg_config_k` is not in range [4, 21], or if `hll_type` is [`HllType::Hll4`].
+    pub fn new(bytes: &'a mut [u8], lg_config_k: u8, hll_type: HllType) -> Result<Self, Error> {
+        let required = Self::required_size_bytes(lg_config_k, hll_type);
+        if bytes.len() < required {
+            return Err(Error::insufficient_buffer(
+                ErrorKind::InvalidArgument,
+                required,
+                bytes.len(),
+            ));
+        }
+        let tgt_type = match hll_type {
+            HllType::Hll6 => TGT_HLL6,
+            _ => TGT_HLL8,
+        };
+
+        let bytes = &mut bytes[..required];
+        bytes[..HLL_PREAMBLE_SIZE].fill(0);
+        bytes[PREAMBLE_INTS_BYTE] = HLL_PREINTS;
+        bytes[SERIAL_VERSION_BYTE] = SERIAL_VERSION;
+        bytes[FAMILY_BYTE] = Family::HLL.id;
+        bytes[LG_K_BYTE] = lg_config_k;
+        bytes[MODE_BYTE] = encode_mode_byte(CUR_MODE_HLL, tgt_type);
+        bytes[HLL_PREAMBLE_SIZE..].fill(0);
+
+        let mut sketch = Self {
+            bytes,
+            lg_config_k,
+            hll_type,
+        };
+        sketch.write_estimator(&HipEstimator::new(lg_config_k));
+        sketch.set_num_zeros(1 << lg_config_k);
+        Ok(sketch)
+    }
+
+    /// Wraps a buffer holding an HLL mode image of an HLL6 or HLL8 sketch.
+    ///
+    /// The image may come from [`DirectHllSketch::new`], from
+    /// [`HllSketch::serialize_updatable`] of a sketch that reached HLL mode, or from an
+    /// updatable Java sketch in writable memory. List and Set mode images are rejected, since
+    /// their coupon tables would have to grow. The registers are scanned once to check that
+    /// the stored zero count matches them and that each holds a register value.
+    pub fn wrap(bytes: &'a mut [u8]) -> Result<Self, Error> {
+        if bytes.len() < HLL_PREAMBLE_SIZE {
+            return Err(Error::insufficient_buffer(
+                ErrorKind::InvalidData,
+                HLL_PREAMBLE_SIZE,
+                bytes.len(),
+            ));
+        }
+        Family::HLL.validate_id(bytes[FAMILY_BYTE])?;
+        ensure_serial_version_is(SERIAL_VERSION, bytes[SERIAL_VERSION_BYTE])?;
+        let mode_byte = bytes[MODE_BYTE];
+        if extract_cur_mode(mode_byte) != CUR_MODE_HLL || bytes[PREAMBLE_INTS_BYTE] != HLL_PREINTS {
+            return Err(Error::deserial(
+                "direct HLL sketches need an HLL mode image, got List or Set mode",
+            ));
+        }
+        let lg_config_k = bytes[LG_K_BYTE];
+        ensure_lg_k_in(4, 21, lg_config_k)?;
+        let hll_type = match extract_tgt_hll_type(mode_byte) {
+            TGT_HLL6 => HllType::Hll6,
+            TGT_HLL8 => HllType::Hll8,
+            TGT_HLL4 => {
+                return Err(Error::deserial(
+                    "direct HLL sketches support only Hll6 and Hll8, got Hll4",
+                ));
+            }
+            hll_type => {
+                return Err(Error::deserial(format!("invalid HLL type: {hll_type}")));
+            }
+        };
+        let required = Self::required_size_bytes(lg_config_k, hll_type);
+        if bytes.len() < required {
+            return Err(
+                Error::insufficient_buffer(ErrorKind::InvalidData, required, bytes.len())
+                    .with_context("lg_k", lg_config_k),
+            );
+        }
+
+        let sketch = Self {
+            bytes: &mut bytes[..required],
+            lg_config_k,
+            hll_type,
+        };
+        // updates decrement the stored zero count, so it has to agree with the registers
+        let mut zeros = 0u32;
+        for slot in 0..1u32 << lg_config_k {
+            match sketch.register(slot) {
+                0 => zeros += 1,
+                value if value > MAX_REGISTER_VALUE => {
+                    return Err(Error::deserial(format!(
+                        "register {slot} holds {value}, more than {MAX_REGISTER_VALUE}"
+                    )));
+                }
+                _ => {}
+            }
+        }
+        if zeros != sketch.num_zeros() {
+            return Err(Error::deserial(format!(
+                "expected {} zero registers, found {zeros}",
+                sketch.num_zeros()
+            )));
+        }
+        Ok(sketch)
+    }
+
+    /// Returns the configured lg_k of the sketch
+    pub fn lg_config_k(&self) -> u8 {
+        self.lg_config_k
+    }
+
+    /// Returns the target HLL type of the sketch
+    pub fn target_type(&self) -> HllType {
+        self.hll_type
+    }
+
+    /// Returns true if no register has been set
+    pub fn is_empty(&self) -> bool {
+        self.num_zeros() == 1 << self.lg_config_k
+    }
+
+    /// Update the sketch with a hashable value.
+    ///
+    /// See [`HllSketch::update`].
+    pub fn update<T: Hash>(&mut self, value: T) {
+        self.update_with_coupon(Coupon::from_hash(value));
+    }
+
+    /// Update the sketch with an already computed 128-bit hash.
+    ///
+    /// See [`HllSketch::update_hash`].
+    pub fn update_hash(&mut self, lo: u64, hi: u64) {
+        self.update_with_coupon(Coupon::from_hash128(lo, hi));
+    }
+
+    /// Update the sketch with a pre-computed [`Coupon`].
+    pub fn update_with_coupon(&mut self, coupon: Coupon) {
+        let mask = (1 << self.lg_config_k) - 1;
+        let slot = coupon.slot() & mask;
+        let new_value = coupon.value();
+
+        let old_value = self.register(slot);
+        if new_value > old_value {
+            let mut estimator = self.estimator();
+            estimator.update(self.lg_config_k, old_value, new_value);
+            self.write_estimator(&estimator);
+            self.put_register(slot, new_value);
+            if old_value == 0 {
+                self.set_num_zeros(self.num_zeros() - 1);
+            }
+        }
+    }
+
+    /// Returns the cardinality estimate
+    pub fn estimate(&self) -> f64 {
+        self.estimator()
+            .estimate(self.lg_config_k, 0, self.num_zeros())
+    }
+
+    /// Returns the upper bound of the cardinality estimate given `num_std_dev`
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.estimator()
+            .upper_bound(self.lg_config_k, 0, self.num_zeros(), num_std_dev)
+    }
+
+    /// Returns the lower bound of the cardinality estimate given `num_std_dev`
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.estimator()
+            .lower_bound(self.lg_config_k, 0, self.num_zeros(), num_std_dev)
+    }
+
+    /// Returns a heap copy of the sketch
+    pub fn to_sketch(&self) -> HllSketch {
+        HllSketch::deserialize(self.bytes).expect("direct sketch holds a valid HLL image")
+    }
+
+    fn register(&self, slot: u32) -> u8 {
+        let registers = &self.bytes[HLL_PREAMBLE_SIZE..];
+        match self.hll_type {
+            HllType::Hll6 => array6::get_packed(registers, slot),
+            _ => registers[slot as usize],
+        }
+    }
+
+    fn put_register(&mut self, slot: u32, value: u8) {
+        let registers = &mut self.bytes[HLL_PREAMBLE_SIZE..];
+        match self.hll_type {
+            HllType::Hll6 => array6::put_packed(registers, slot, value),
+            _ => registers[slot as usize] = value,
+        }
+    }
+
+    fn estimator(&self) -> HipEstimator {
+        let mut estimator = HipEstimator::new(self.lg_config_k);
+        estimator.set_hip_accum(read_f64(self.bytes, HIP_ACCUM_DOUBLE));
+        estimator.set_kxq0(read_f64(self.bytes, KXQ0_DOUBLE));
+        estimator.set_kxq1(read_f64(self.bytes, KXQ1_DOUBLE));
+        estimator.set_out_of_order(self.bytes[FLAGS_BYTE] & OUT_OF_ORDER_FLAG_MASK != 0);
+        estimator
+    }
+
+    fn write_estimator(&mut self, estimator: &HipEstimator) {
+        write_f64(self.bytes, HIP_ACCUM_DOUBLE, estimator.hip_accum());
+        write_f64(self.bytes, KXQ0_DOUBLE, estimator.kxq0());
+        write_f64(self.bytes, KXQ1_DOUBLE, estimator.kxq1());
+    }
+
+    fn num_zeros(&self) -> u32 {
+        let offset = NUM_AT_CUR_MIN_INT;
+        u32::from_le_bytes(
+            self.bytes[offset..offset + 4]
+                .try_into()
+                .expect("slice has 4 bytes"),
+        )
+    }
+
+    fn set_num_zeros(&mut self, num_zeros: u32) {
+        let offset = NUM_AT_CUR_MIN_INT;
+        self.bytes[offset..offset + 4].copy_from_slice(&num_zeros.to_le_bytes());
+    }
+}
+
+fn read_f64(bytes: &[u8], offset: usize) -> f64 {
+    f64::from_le_bytes(
+        bytes[offset..offset + 8]
+            .try_into()
+            .expect("slice has 8 bytes"),
+    )
+}
+
+fn write_f64(bytes: &mut [u8], offset: usize, value: f64) {
+    bytes[offset..offset + 8].copy_from_slice(&value.to_le_bytes());
+}
@@ -0,0 +1,250 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Reading and writing the HLL sketch columns of Apache Druid segments.
+//!
+//! Druid's `HLLSketchBuild` and `HLLSketchMerge` metrics persist one compact HLL image per row,
+//! as written by [`HllSketch::serialize`], in a version 1 `GenericIndexed` column:
+//!
+//! | Bytes | Field                                                     |
+//! |-------|-----------------------------------------------------------|
+//! | 1     | version, `0x01`                                           |
+//! | 1     | `0x01` if the values are sorted, `0x00` otherwise         |
+//! | 4     | number of bytes that follow this field                    |
+//! | 4     | number of rows `n`                                        |
+//! | 4 × n | end offset of each row, relative to the first row         |
+//! | …     | per row, a null marker (`-1` if null, else `0`) and image |
+//!
+//! All the integers of the layout are big-endian; the images themselves are little-endian as
+//! usual. A null row, one that had no input, is written as the marker `-1` and no image.
+//! Segments written before the marker was introduced store null rows as a `0` marker and no
+//! image, so an empty value reads as null too. A row aggregated from inputs that were all
+//! empty is not null but an empty sketch of [`DEFAULT_LG_K`] and [`DEFAULT_HLL_TYPE`], unless
+//! the metric configures other values.
+//!
+//! Columns larger than 2 GiB are split by Druid over several files in a version 2
+//! `GenericIndexed`, which is not supported.
+//!
+//! # Examples
+//!
+//! ```
+//! # use datasketches::hll::HllSketch;
+//! # use datasketches::hll::HllType;
+//! # use datasketches::hll::druid;
+//! let mut sketch = HllSketch::new(druid::DEFAULT_LG_K, druid::DEFAULT_HLL_TYPE);
+//! sketch.extend(0..1000);
+//!
+//! let column = druid::write_column([Some(&sketch), None]);
+//! let rows = druid::read_column(&column).unwrap();
+//! assert_eq!(rows, [Some(sketch), None]);
+//! ```
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::insufficient_data;
+use crate::error::Error;
+use crate::hll::HllSketch;
+use crate::hll::HllType;
+use crate::hll::HllUnion;
+
+/// The lg_k Druid configures HLL metrics and aggregators with by default.
+pub const DEFAULT_LG_K: u8 = 12;
+
+/// The target type Druid configures HLL metrics and aggregators with by default.
+pub const DEFAULT_HLL_TYPE: HllType = HllType::Hll4;
+
+const VERSION_ONE: u8 = 1;
+const VERSION_TWO: u8 = 2;
+const NULL_MARKER: i32 = -1;
+
+/// Reads one row of a Druid HLL column, where an empty value is a null row.
+///
+/// # Errors
+///
+/// Returns an error if a non-empty value is not a valid HLL image.
+pub fn read_value(bytes: &[u8]) -> Result<Option<HllSketch>, Error> {
+    if bytes.is_empty() {
+        return Ok(None);
+    }
+    HllSketch::deserialize(bytes).map(Some)
+}
+
+/// Returns the bytes Druid stores for one row: the compact image, or no bytes for a null row.
+pub fn write_value(sketch: Option<&HllSketch>) -> Vec<u8> {
+    sketch.map_or_else(Vec::new, HllSketch::serialize)
+}
+
+/// Returns the value of each row of a Druid HLL column, without decoding the images.
+///
+/// Null rows are `None`. The bytes following the column, such as the other parts of a column
+/// file, are ignored.
+///
+/// # Errors
+///
+/// Returns an error if the column is truncated, its offsets are out of range, or it is not a
+/// version 1 `GenericIndexed`.
+pub fn column_values(bytes: &[u8]) -> Result<Vec<Option<&[u8]>>, Error> {
+    let mut slice = SketchSlice::new(bytes);
+    let version = slice.read_u8().map_err(insufficient_data("version"))?;
+    match version {
+        VERSION_ONE => {}
+        VERSION_TWO => {
+            return Err(Error::deserial(
+                "GenericIndexed version 2 columns span several files and are not supported",
+            ));
+        }
+        _ => {
+            return Err(Error::deserial(format!(
+                "unknown GenericIndexed version {version}"
+            )));
+        }
+    }
+    slice.read_u8().map_err(insufficient_data("sorted_flag"))?;
+    let num_bytes = slice
+        .read_u32_be()
+        .map_err(insufficient_data("num_bytes"))? as usize;
+    let body = &bytes[6..];
+    if body.len() < num_bytes {
+        return Err(Error::insufficient_data(format!(
+            "column of {num_bytes} bytes, got {}",
+            body.len()
+        )));
+    }
+
+    let mut header = SketchSlice::new(&body[..num_bytes]);
+    let num_rows = header
+        .read_u32_be()
+        .map_err(insufficient_data("num_rows"))? as usize;
+    let values_at = num_rows
+        .checked_mul(4)
+        .and_then(|offsets| offsets.checked_add(4))
+        .filter(|&values_at| values_at <= num_bytes)
+        .ok_or_else(|| {
+            Error::insufficient_data(format!("{num_rows} row offsets in {num_bytes} bytes"))
+        })?;
+    let values = &body[values_at..num_bytes];
+
+    let mut rows = Vec::with_capacity(num_rows);
+    let mut start = 0;
+    for row in 0..num_rows {
+        let end = header.read_u32_be().map_err(insufficient_data("offset"))? as usize;
+        if end < start + 4 || end > values.len() {
+            return Err(Error::deserial(format!(
+                "offset {end} of row {row} is out of range"
+            )));
+        }
+        let marker = i32::from_be_bytes(values[start..start + 4].try_into().unwrap());
+        let value = &values[start + 4..end];
+        rows.push((marker != NULL_MARKER && !value.is_empty()).then_some(value));
+        start = end;
+    }
+    Ok(rows)
+}
+
+/// Reads every row of a Druid HLL column.
+///
+/// # Errors
+///
+/// Returns an error if the column is malformed, see [`column_values`], or if one of its
+/// images is not a valid HLL image.
+pub fn read_column(bytes: &[u8]) -> Result<Vec<Option<HllSketch>>, Error> {
+    column_values(bytes)?
+        .into_iter()
+        .map(|value| value.map_or(Ok(None), read_value))
+        .collect()
+}
+
+/// Writes the rows as a Druid HLL column, `None` being a null row.
+///
+/// The values are flagged as unsorted, as Druid does not look complex values up.
+///
+/// # Panics
+///
+/// Panics if the column would exceed 2 GiB, the limit of a version 1 `GenericIndexed`.
+pub fn write_column<'a, I>(sketches: I) -> Vec<u8>
+where
+    I: IntoIterator<Item = Option<&'a HllSketch>>,
+{
+    let mut offsets = SketchBytes::with_capacity(0);
+    let mut values = SketchBytes::with_capacity(0);
+    let mut num_rows = 0u32;
+    for sketch in sketches {
+        match sketch {
+            Some(sketch) => {
+                values.write_i32_be(0);
+                values.write(&sketch.serialize());
+            }
+            None => values.write_i32_be(NULL_MARKER),
+        }
+        offsets.write_u32_be(values.len() as u32);
+        num_rows += 1;
+    }
+
+    let num_bytes = 4 + offsets.len() + values.len();
+    assert!(
+        num_bytes <= i32::MAX as usize,
+        "a Druid column must be at most 2 GiB, got {num_bytes} bytes"
+    );
+    let mut bytes = SketchBytes::with_capacity(6 + num_bytes);
+    bytes.write_u8(VERSION_ONE);
+    bytes.write_u8(0);
+    bytes.write_u32_be(num_bytes as u32);
+    bytes.write_u32_be(num_rows);
+    bytes.write(&offsets.into_bytes());
+    bytes.write(&values.into_bytes());
+    bytes.into_bytes()
+}
+
+/// Merges the values of Druid HLL rows as the `HLLSketchMerge` aggregator does.
+///
+/// The images are unioned at `lg_k`, skipping the null rows, and the result is returned with
+/// `hll_type`. Without any image, the result is an empty sketch.
+///
+/// # Errors
+///
+/// Returns an error if one of the values is not a valid HLL image.
+///
+/// # Panics
+///
+/// Panics if `lg_k` is not in the range `[4, 21]`.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hll::HllSketch;
+/// # use datasketches::hll::HllType;
+/// # use datasketches::hll::druid;
+/// let mut sketch = HllSketch::new(12, HllType::Hll8);
+/// sketch.extend(0..1000);
+/// let column = druid::write_column([Some(&sketch), None, Some(&sketch)]);
+///
+/// let values = druid::column_values(&column).unwrap();
+/// let merged = druid::merge(values, druid::DEFAULT_LG_K, druid::DEFAULT_HLL_TYPE).unwrap();
+/// assert!((merged.estimate() - 1000.0).abs() < 50.0);
+/// ```
+pub fn merge<'a, I>(values: I, lg_k: u8, hll_type: HllType) -> Result<HllSketch, Error>
+where
+    I: IntoIterator<Item = Option<&'a [u8]>>,
+{
+    let mut union = HllUnion::new(lg_k);
+    for value in values.into_iter().flatten() {
+        if !value.is_empty() {
+            union.update_bytes(value)?;
+        }
+    }
+    Ok(union.to_sketch(hll_type))
+}
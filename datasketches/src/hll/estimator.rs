@@ -22,6 +22,9 @@
 //! This is more accurate than the standard HLL estimator, especially for
 //! moderate cardinalities.
 
+use std::sync::atomic::AtomicU64;
+use std::sync::atomic::Ordering;
+
 use crate::common::NumStdDev;
 use crate::common::inv_pow2::inv_pow2;
 use crate::hll::composite_interpolation;
@@ -48,17 +51,78 @@ pub struct HipEstimator {
     kxq1: f64,
     /// Out-of-order flag: when true, HIP updates are skipped
     out_of_order: bool,
+    /// Last composite estimate, valid until the next register change
+    composite: CompositeCache,
+}
+
+/// Composite estimate cached together with the arguments it was computed for
+///
+/// The estimate also depends on `cur_min` and `num_at_cur_min`, which the arrays maintain
+/// outside of the estimator, so a cached value is only served when those arguments match.
+/// Atomics keep the estimator `Sync` while the cache is filled through `&self`.
+#[derive(Debug)]
+struct CompositeCache {
+    /// `lg_config_k`, `cur_min` and `num_at_cur_min` packed into one word
+    key: AtomicU64,
+    /// Bits of the cached estimate, or of NaN when stale
+    value: AtomicU64,
+}
+
+const STALE: u64 = f64::NAN.to_bits();
+
+impl CompositeCache {
+    const fn new() -> Self {
+        Self {
+            key: AtomicU64::new(0),
+            value: AtomicU64::new(STALE),
+        }
+    }
+
+    fn key(lg_config_k: u8, cur_min: u8, num_at_cur_min: u32) -> u64 {
+        ((lg_config_k as u64) << 40) | ((cur_min as u64) << 32) | num_at_cur_min as u64
+    }
+
+    fn get(&self, key: u64) -> Option<f64> {
+        let value = f64::from_bits(self.value.load(Ordering::Acquire));
+        (self.key.load(Ordering::Acquire) == key && !value.is_nan()).then_some(value)
+    }
+
+    fn set(&self, key: u64, value: f64) {
+        self.key.store(key, Ordering::Release);
+        self.value.store(value.to_bits(), Ordering::Release);
+    }
+
+    fn invalidate(&self) {
+        self.value.store(STALE, Ordering::Release);
+    }
+}
+
+impl Clone for CompositeCache {
+    fn clone(&self) -> Self {
+        Self {
+            key: AtomicU64::new(self.key.load(Ordering::Acquire)),
+            value: AtomicU64::new(self.value.load(Ordering::Acquire)),
+        }
+    }
+}
+
+/// The cache is derived state, so it never makes two estimators unequal.
+impl PartialEq for CompositeCache {
+    fn eq(&self, _other: &Self) -> bool {
+        true
+    }
 }
 
 impl HipEstimator {
     /// Create a new HIP estimator for a sketch with 2^lg_config_k registers
-    pub fn new(lg_config_k: u8) -> Self {
-        let k = 1 << lg_config_k;
+    pub const fn new(lg_config_k: u8) -> Self {
+        let k = 1u32 << lg_config_k;
         Self {
             hip_accum: 0.0,
             kxq0: k as f64, // All registers start at 0, so kxq0 = k * (1/2^0) = k
             kxq1: 0.0,
             out_of_order: false,
+            composite: CompositeCache::new(),
         }
     }
 
@@ -89,6 +153,8 @@ impl HipEstimator {
 
     /// Update only the KxQ registers (internal helper)
     fn update_kxq(&mut self, old_value: u8, new_value: u8) {
+        self.composite.invalidate();
+
         // Subtract old value contribution
         if old_value < 32 {
             self.kxq0 -= inv_pow2(old_value);
@@ -115,7 +181,7 @@ impl HipEstimator {
     /// * `num_at_cur_min`: Number of registers at cur_min value
     pub fn estimate(&self, lg_config_k: u8, cur_min: u8, num_at_cur_min: u32) -> f64 {
         if self.out_of_order {
-            self.get_composite_estimate(lg_config_k, cur_min, num_at_cur_min)
+            self.composite_estimate(lg_config_k, cur_min, num_at_cur_min)
         } else {
             self.hip_accum
         }
@@ -146,7 +212,8 @@ impl HipEstimator {
 
     /// Get lower bound for cardinality estimate
     ///
-    /// Returns the lower confidence bound for the cardinality estimate.
+    /// Returns the lower confidence bound for the cardinality estimate. Like Java and C++, the
+    /// bound never falls below the number of non-zero registers.
     ///
     /// # Arguments
     ///
@@ -163,8 +230,15 @@ impl HipEstimator {
     ) -> f64 {
         let estimate = self.estimate(lg_config_k, cur_min, num_at_cur_min);
         let rse = get_rel_err(lg_config_k, false, self.out_of_order, num_std_dev);
+        let k = 1u32 << lg_config_k;
+        // saturate, since the count comes from an image that may claim more registers than k
+        let num_non_zeros = if cur_min == 0 {
+            k.saturating_sub(num_at_cur_min)
+        } else {
+            k
+        };
         // RSE is positive for lower bounds, so (1 + rse) > 1, making bound < estimate
-        estimate / (1.0 + rse)
+        (estimate / (1.0 + rse)).max(num_non_zeros as f64)
     }
 
     /// Get raw HLL estimate using standard HyperLogLog formula
@@ -172,7 +246,7 @@ impl HipEstimator {
     /// Formula: correctionFactor * k^2 / (kxq0 + kxq1)
     ///
     /// Uses lg_k-specific correction factors for small k.
-    fn get_raw_estimate(&self, lg_config_k: u8) -> f64 {
+    pub fn raw_estimate(&self, lg_config_k: u8) -> f64 {
         let k = (1 << lg_config_k) as f64;
 
         // Correction factors from empirical analysis
@@ -208,9 +282,25 @@ impl HipEstimator {
     ///
     /// This is the primary estimator used when in out-of-order mode.
     /// It uses cubic interpolation on raw HLL estimate, then blends
-    /// with linear counting for small cardinalities.
-    fn get_composite_estimate(&self, lg_config_k: u8, cur_min: u8, num_at_cur_min: u32) -> f64 {
-        let raw_est = self.get_raw_estimate(lg_config_k);
+    /// with linear counting for small cardinalities. The result is cached
+    /// until the KxQ registers change or the arguments differ.
+    pub fn composite_estimate(&self, lg_config_k: u8, cur_min: u8, num_at_cur_min: u32) -> f64 {
+        let key = CompositeCache::key(lg_config_k, cur_min, num_at_cur_min);
+        if let Some(estimate) = self.composite.get(key) {
+            return estimate;
+        }
+        let estimate = self.compute_composite_estimate(lg_config_k, cur_min, num_at_cur_min);
+        self.composite.set(key, estimate);
+        estimate
+    }
+
+    /// Drop the cached composite estimate, so that the next call recomputes it
+    pub fn invalidate_cache(&self) {
+        self.composite.invalidate();
+    }
+
+    fn compute_composite_estimate(&self, lg_config_k: u8, cur_min: u8, num_at_cur_min: u32) -> f64 {
+        let raw_est = self.raw_estimate(lg_config_k);
 
         // Get composite interpolation table
         let x_arr = composite_interpolation::get_x_arr(lg_config_k);
@@ -305,11 +395,13 @@ impl HipEstimator {
 
     /// Set the kxq0 register directly
     pub fn set_kxq0(&mut self, value: f64) {
+        self.composite.invalidate();
         self.kxq0 = value;
     }
 
     /// Set the kxq1 register directly
     pub fn set_kxq1(&mut self, value: f64) {
+        self.composite.invalidate();
         self.kxq1 = value;
     }
 }
@@ -328,7 +420,12 @@ impl HipEstimator {
 /// # Returns
 ///
 /// Relative error factor to apply to estimate
-fn get_rel_err(lg_config_k: u8, upper_bound: bool, ooo: bool, num_std_dev: NumStdDev) -> f64 {
+pub(super) fn get_rel_err(
+    lg_config_k: u8,
+    upper_bound: bool,
+    ooo: bool,
+    num_std_dev: NumStdDev,
+) -> f64 {
     // For lg_k > 12, use analytical formula with RSE factors
     if lg_config_k > 12 {
         // RSE factors from Apache DataSketches C++ implementation
@@ -573,4 +670,24 @@ mod tests {
         assert_eq!(est.kxq0(), 678.9);
         assert_eq!(est.kxq1(), 0.0012);
     }
+
+    #[test]
+    fn test_lower_bound_at_least_non_zero_registers() {
+        let mut est = HipEstimator::new(4);
+        est.set_hip_accum(5.0);
+
+        // 6 of the 16 registers are non-zero, which exceeds 5.0 / (1 + rse)
+        assert_eq!(est.lower_bound(4, 0, 10, NumStdDev::Two), 6.0);
+        assert!(est.upper_bound(4, 0, 10, NumStdDev::Two) > 5.0);
+
+        // With cur_min > 0 every register is non-zero
+        est.set_hip_accum(20.0);
+        assert_eq!(est.lower_bound(4, 1, 3, NumStdDev::Three), 16.0);
+        assert!(est.lower_bound(4, 1, 3, NumStdDev::One) > 16.0);
+
+        // A count above k clamps to no non-zero register instead of wrapping around
+        est.set_hip_accum(5.0);
+        let lower = est.lower_bound(4, 0, 17, NumStdDev::Two);
+        assert!(lower > 0.0 && lower < 5.0, "{lower}");
+    }
 }
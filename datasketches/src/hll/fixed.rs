@@ -0,0 +1,180 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! HLL sketch with its registers stored inline
+
+use std::hash::Hash;
+
+use crate::common::NumStdDev;
+use crate::hll::Coupon;
+use crate::hll::HllSketch;
+use crate::hll::array8::Array8;
+use crate::hll::estimator::HipEstimator;
+use crate::hll::mode::Mode;
+
+/// An HLL8 sketch with `K` registers stored inline, which never allocates.
+///
+/// `K` is the number of registers, `2^lg_k`, and must be a power of two in `[2^4, 2^21]`; other
+/// values fail to compile. The sketch holds its `K` registers in an array and starts in HLL
+/// mode, like a [`HllSketchBuilder::start_full_size`](crate::hll::HllSketchBuilder) sketch,
+/// so no update ever allocates. [`new`](Self::new) is a `const fn`, so a sketch can live in a
+/// `static` or on the stack of a thread without a heap allocator.
+///
+/// The registers and estimator follow [`HllSketch`] in HLL8 mode: for the same updates,
+/// [`to_sketch`](Self::to_sketch) returns the sketch an [`HllSketch`] started at full size
+/// would hold, which can then be serialized or merged.
+///
+/// # Examples
+///
+/// ```
+/// # use std::sync::Mutex;
+/// # use datasketches::hll::FixedHllSketch;
+/// static SKETCH: Mutex<FixedHllSketch<1024>> = Mutex::new(FixedHllSketch::new());
+///
+/// let mut sketch = SKETCH.lock().unwrap();
+/// for i in 0..1000 {
+///     sketch.update(i);
+/// }
+/// assert_eq!(sketch.lg_config_k(), 10);
+/// assert!((sketch.estimate() - 1000.0).abs() < 100.0);
+/// ```
+#[derive(Debug, Clone, PartialEq)]
+pub struct FixedHllSketch<const K: usize> {
+    registers: [u8; K],
+    /// Count of registers with value 0
+    num_zeros: u32,
+    estimator: HipEstimator,
+}
+
+impl<const K: usize> Default for FixedHllSketch<K> {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl<const K: usize> FixedHllSketch<K> {
+    const LG_CONFIG_K: u8 = {
+        assert!(
+            K.is_power_of_two() && K >= 1 << 4 && K <= 1 << 21,
+            "K must be a power of two in [2^4, 2^21]"
+        );
+        K.trailing_zeros() as u8
+    };
+
+    /// Creates an empty sketch.
+    pub const fn new() -> Self {
+        Self {
+            registers: [0; K],
+            num_zeros: K as u32,
+            estimator: HipEstimator::new(Self::LG_CONFIG_K),
+        }
+    }
+
+    /// Returns the configured lg_k, `log2(K)`
+    pub const fn lg_config_k(&self) -> u8 {
+        Self::LG_CONFIG_K
+    }
+
+    /// Returns true if no value has been added
+    pub fn is_empty(&self) -> bool {
+        self.num_zeros == K as u32
+    }
+
+    /// Resets the sketch to its empty state.
+    pub fn reset(&mut self) {
+        *self = Self::new();
+    }
+
+    /// Update the sketch with a hashable value.
+    ///
+    /// See [`HllSketch::update`].
+    pub fn update<T: Hash>(&mut self, value: T) {
+        self.update_with_coupon(Coupon::from_hash(value));
+    }
+
+    /// Update the sketch with an already computed 128-bit hash.
+    ///
+    /// See [`HllSketch::update_hash`].
+    pub fn update_hash(&mut self, lo: u64, hi: u64) {
+        self.update_with_coupon(Coupon::from_hash128(lo, hi));
+    }
+
+    /// Update the sketch with a pre-computed [`Coupon`].
+    pub fn update_with_coupon(&mut self, coupon: Coupon) {
+        let slot = coupon.slot() as usize & (K - 1);
+        let new_value = coupon.value();
+        let old_value = self.registers[slot];
+        if new_value > old_value {
+            self.estimator
+                .update(Self::LG_CONFIG_K, old_value, new_value);
+            self.registers[slot] = new_value;
+            if old_value == 0 {
+                self.num_zeros -= 1;
+            }
+        }
+    }
+
+    /// Get the current cardinality estimate
+    pub fn estimate(&self) -> f64 {
+        self.estimator
+            .estimate(Self::LG_CONFIG_K, 0, self.num_zeros)
+    }
+
+    /// Get upper bound for cardinality estimate
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.estimator
+            .upper_bound(Self::LG_CONFIG_K, 0, self.num_zeros, num_std_dev)
+    }
+
+    /// Get lower bound for cardinality estimate
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.estimator
+            .lower_bound(Self::LG_CONFIG_K, 0, self.num_zeros, num_std_dev)
+    }
+
+    /// Get the composite estimate, which ignores the HIP accumulator
+    pub fn composite_estimate(&self) -> f64 {
+        self.estimator
+            .composite_estimate(Self::LG_CONFIG_K, 0, self.num_zeros)
+    }
+
+    /// Returns the registers, one byte per register
+    pub fn registers(&self) -> &[u8; K] {
+        &self.registers
+    }
+
+    /// Copies the sketch into a heap-allocated HLL8 [`HllSketch`], for serialization or a
+    /// union.
+    pub fn to_sketch(&self) -> HllSketch {
+        let array = Array8::from_parts(
+            Self::LG_CONFIG_K,
+            &self.registers,
+            self.num_zeros,
+            self.estimator.clone(),
+        );
+        HllSketch::from_mode(Self::LG_CONFIG_K, Mode::Array8(array))
+    }
+}
+
+/// Updates the sketch with every value of the iterator, as [`FixedHllSketch::update`] does.
+impl<const K: usize, T: Hash> Extend<T> for FixedHllSketch<K> {
+    fn extend<I: IntoIterator<Item = T>>(&mut self, iter: I) {
+        for value in iter {
+            self.update(value);
+        }
+    }
+}
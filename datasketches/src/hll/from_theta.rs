@@ -0,0 +1,89 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::hll::Coupon;
+use crate::hll::HllSketch;
+use crate::hll::HllType;
+use crate::hll::mode::Mode;
+use crate::theta::ThetaSketchView;
+use crate::thetacommon::conversion::dropped_hit_probabilities;
+use crate::thetacommon::conversion::hit;
+
+impl HllSketch {
+    /// Builds an HLL sketch from the retained hashes of a Theta sketch.
+    ///
+    /// This shrinks stored Theta sketches whose items are no longer available. Each retained
+    /// hash becomes one coupon, with the low bits of the hash as the slot and its leading zeros
+    /// as the value. An exact Theta sketch converts without loss beyond that of the HLL sketch
+    /// itself.
+    ///
+    /// A Theta sketch in estimation mode only retains the hashes below theta, which are the
+    /// ones with the most leading zeros, so the slots that receive one get the register value
+    /// the whole stream would have given them. For the other slots, the value of the dropped
+    /// hashes is drawn at random from a stream of the estimated size, so the conversion is not
+    /// deterministic. The estimate stays close to that of an HLL sketch of the stream, with
+    /// the error of the Theta estimate added, as long as `lg_config_k` is at most the lg_k of
+    /// the Theta sketch.
+    ///
+    /// The converted sketch is out of order, so its estimate comes from the registers. It can
+    /// be unioned with other sketches converted from Theta sketches of the same seed, but not
+    /// with sketches updated with the items, whose coupons come from another hash.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `lg_config_k` is not in the range `[4, 21]`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// let mut theta = ThetaSketchBuilder::default().lg_k(12).build();
+    /// theta.extend(0..100_000);
+    ///
+    /// let hll = HllSketch::from_theta(&theta.compact(true), 9, HllType::Hll4);
+    /// assert!((hll.estimate() - 100_000.0).abs() < 10_000.0);
+    /// ```
+    pub fn from_theta<S: ThetaSketchView>(theta: &S, lg_config_k: u8, hll_type: HllType) -> Self {
+        let mut sketch = HllSketch::new(lg_config_k, hll_type);
+        for entry in theta.iter() {
+            let hash = entry.hash();
+            sketch.update_with_coupon(Coupon::from_hash128(hash, hash << 1));
+        }
+
+        // the register value of the dropped hashes is one more than their most leading zeros
+        let probabilities =
+            dropped_hit_probabilities(theta.theta(), theta.num_retained(), lg_config_k);
+        if !probabilities.is_empty() {
+            for slot in 0..1 << lg_config_k {
+                if let Some(zeros) = probabilities.iter().rposition(|&p| hit(p)) {
+                    sketch.update_with_coupon(Coupon::pack(slot, zeros as u8 + 1));
+                }
+            }
+        }
+
+        // retained hashes arrive in hash order, which the HIP accumulator does not allow for
+        match sketch.mode_mut() {
+            Mode::Array4(arr) => arr.set_out_of_order(true),
+            Mode::Array6(arr) => arr.set_out_of_order(true),
+            Mode::Array8(arr) => arr.set_out_of_order(true),
+            Mode::List { .. } | Mode::Set { .. } => {}
+        }
+        sketch
+    }
+}
@@ -44,12 +44,14 @@ pub struct HashSet {
 
 impl Default for HashSet {
     fn default() -> Self {
-        const LG_INIT_SET_SIZE: usize = 5;
-        Self::new(LG_INIT_SET_SIZE)
+        Self::new(Self::LG_INIT_SIZE)
     }
 }
 
 impl HashSet {
+    /// Log2 of the table size a Set starts with when promoted from a List
+    pub(super) const LG_INIT_SIZE: usize = 5;
+
     pub fn new(lg_size: usize) -> Self {
         Self {
             container: Container::new(lg_size),
@@ -103,6 +105,13 @@ impl HashSet {
             .read_u32_le()
             .map_err(insufficient_data("coupon_count"))?;
         let coupon_count = coupon_count as usize;
+        if coupon_count >= 1 << lg_arr {
+            // insertion needs at least one empty slot to terminate
+            return Err(Error::deserial(format!(
+                "coupon_count {coupon_count} does not fit a table of size {}",
+                1 << lg_arr
+            )));
+        }
 
         if compact {
             // Compact mode: only couponCount coupons are stored
@@ -143,17 +152,19 @@ impl HashSet {
     }
 
     /// Serialize a HashSet to bytes
-    pub fn serialize(&self, lg_config_k: u8, hll_type: HllType) -> Vec<u8> {
-        let compact = true; // Always use compact format
+    ///
+    /// The compact form writes only the stored coupons; the updatable form writes the whole
+    /// coupon array, including empty entries.
+    pub fn serialize(
+        &self,
+        bytes: &mut SketchBytes,
+        lg_config_k: u8,
+        hll_type: HllType,
+        compact: bool,
+    ) {
         let coupon_count = self.container.len();
         let lg_arr = self.container.lg_size();
 
-        // Compute size
-        let array_size = if compact { coupon_count } else { 1 << lg_arr };
-        let total_size = SET_PREAMBLE_SIZE + (array_size * 4);
-
-        let mut bytes = SketchBytes::with_capacity(total_size);
-
         // Write preamble
         bytes.write_u8(HASH_SET_PREINTS);
         bytes.write_u8(SERIAL_VERSION);
@@ -188,7 +199,15 @@ impl HashSet {
                 bytes.write_u32_le(coupon.raw());
             }
         }
+    }
 
-        bytes.into_bytes()
+    /// Returns the number of bytes [`serialize`](Self::serialize) writes.
+    pub fn serialized_size(&self, compact: bool) -> usize {
+        let array_size = if compact {
+            self.container.len()
+        } else {
+            1 << self.container.lg_size()
+        };
+        SET_PREAMBLE_SIZE + (array_size * 4)
     }
 }
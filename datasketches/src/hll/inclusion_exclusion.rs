@@ -0,0 +1,86 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Intersection estimates of HLL sketches by inclusion–exclusion
+
+use crate::common::Interval;
+use crate::common::NumStdDev;
+use crate::hll::HllSketch;
+use crate::hll::HllUnion;
+
+/// Estimates the number of distinct items seen by both `a` and `b`.
+///
+/// HLL sketches cannot be intersected, so the estimate follows the inclusion–exclusion
+/// principle, `|A ∩ B| = |A| + |B| - |A ∪ B|`, with the union computed by an [`HllUnion`] at the
+/// larger lg_k of the two sketches. The estimate is clamped to `[0, min(|A|, |B|)]`.
+///
+/// The error of the result is the combined error of the three estimates. It is absolute rather
+/// than relative to the intersection and grows with the size of the union, so an intersection
+/// much smaller than the sets has a large relative error and may be estimated as zero. The
+/// bounds combine the bounds of the three estimates at `num_std_dev` in the worst case, which
+/// makes them wider than that confidence requires, as the errors of the estimates are
+/// correlated. When the intersection itself matters, Theta sketches intersect directly with a
+/// far smaller error.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::common::NumStdDev;
+/// # use datasketches::hll::HllSketch;
+/// # use datasketches::hll::HllType;
+/// # use datasketches::hll::estimate_intersection;
+/// let mut a = HllSketch::new(12, HllType::Hll8);
+/// let mut b = HllSketch::new(12, HllType::Hll8);
+/// a.extend(0..100_000);
+/// b.extend(50_000..150_000);
+///
+/// let intersection = estimate_intersection(&a, &b, NumStdDev::Two);
+/// assert!(intersection.contains(50_000.0));
+/// assert!((intersection.estimate - 50_000.0).abs() < 5_000.0);
+/// ```
+pub fn estimate_intersection(a: &HllSketch, b: &HllSketch, num_std_dev: NumStdDev) -> Interval {
+    if a.is_empty() || b.is_empty() {
+        return Interval {
+            lower: 0.0,
+            estimate: 0.0,
+            upper: 0.0,
+        };
+    }
+
+    let mut union = HllUnion::new(a.lg_config_k().max(b.lg_config_k()));
+    union.update(a);
+    union.update(b);
+
+    let smaller = a.estimate().min(b.estimate());
+    let estimate = (a.estimate() + b.estimate() - union.estimate()).clamp(0.0, smaller);
+
+    let upper =
+        a.upper_bound(num_std_dev) + b.upper_bound(num_std_dev) - union.lower_bound(num_std_dev);
+    let upper = upper
+        .min(a.upper_bound(num_std_dev))
+        .min(b.upper_bound(num_std_dev))
+        .max(estimate);
+    let lower =
+        a.lower_bound(num_std_dev) + b.lower_bound(num_std_dev) - union.upper_bound(num_std_dev);
+    let lower = lower.clamp(0.0, estimate);
+
+    Interval {
+        lower,
+        estimate,
+        upper,
+    }
+}
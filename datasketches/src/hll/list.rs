@@ -88,6 +88,16 @@ impl List {
         // so the linear scan in update() can find an empty slot to insert into.
         let array_size = 1 << lg_arr;
         let read_count = if compact { coupon_count } else { array_size };
+        if coupon_count > array_size {
+            return Err(Error::deserial(format!(
+                "coupon_count {coupon_count} exceeds the list size {array_size}"
+            )));
+        }
+        if empty && coupon_count != 0 {
+            return Err(Error::deserial(format!(
+                "empty list image claims {coupon_count} coupons"
+            )));
+        }
 
         // Read coupons into the front of the full-sized array; remaining slots stay Coupon::EMPTY.
         let mut coupons = vec![Coupon::EMPTY; array_size];
@@ -100,6 +110,9 @@ impl List {
                 })?;
                 *coupon = Coupon(raw);
             }
+        } else if !compact {
+            // an updatable image keeps the empty array; skip it to stay aligned in a stream
+            cursor.advance((array_size * 4) as u64);
         }
 
         Ok(Self {
@@ -108,17 +121,20 @@ impl List {
     }
 
     /// Serialize a List to bytes
-    pub fn serialize(&self, lg_config_k: u8, hll_type: HllType) -> Vec<u8> {
-        let compact = true; // Always use compact format
+    ///
+    /// The compact form writes only the stored coupons; the updatable form writes the whole
+    /// coupon array, including empty entries.
+    pub fn serialize(
+        &self,
+        bytes: &mut SketchBytes,
+        lg_config_k: u8,
+        hll_type: HllType,
+        compact: bool,
+    ) {
         let empty = self.container.is_empty();
         let coupon_count = self.container.len();
         let lg_arr = self.container.lg_size();
-
-        // Compute size
         let array_size = if compact { coupon_count } else { 1 << lg_arr };
-        let total_size = LIST_PREAMBLE_SIZE + (array_size * 4);
-
-        let mut bytes = SketchBytes::with_capacity(total_size);
 
         // Write preamble
         bytes.write_u8(LIST_PREINTS);
@@ -144,7 +160,7 @@ impl List {
         bytes.write_u8(encode_mode_byte(CUR_MODE_LIST, hll_type as u8));
 
         // Write coupons (only non-empty ones if compact)
-        if !empty {
+        if !empty || !compact {
             let mut write_idx = 0;
             for coupon in self.container.coupons.iter().copied() {
                 if compact && coupon.is_empty() {
@@ -157,7 +173,15 @@ impl List {
                 }
             }
         }
+    }
 
-        bytes.into_bytes()
+    /// Returns the number of bytes [`serialize`](Self::serialize) writes.
+    pub fn serialized_size(&self, compact: bool) -> usize {
+        let array_size = if compact {
+            self.container.len()
+        } else {
+            1 << self.container.lg_size()
+        };
+        LIST_PREAMBLE_SIZE + (array_size * 4)
     }
 }
@@ -37,9 +37,28 @@
 //!
 //! The primary type for cardinality estimation is [`HllSketch`], which maintains a single
 //! sketch and provides methods to update with new values and retrieve cardinality estimates.
+//! [`HllSketchBuilder`] configures one with defaults, optionally starting in HLL mode.
 //! For combining multiple sketches, use [`HllUnion`], which efficiently merges sketches
 //! that may have different configurations.
 //!
+//! [`ConcurrentHll`] shards updates over several sketches so that many threads can update it
+//! through a shared reference.
+//!
+//! [`UniqueCountMap`] keeps approximate distinct counts for millions of keys, growing the
+//! storage of each key from a single coupon to an HLL array as its count grows.
+//! [`HllSketchMap`] keeps a full sketch per key within a memory budget, spilling the sketches
+//! updated least recently to compact images, and rolls up, merges and serializes as a whole.
+//!
+//! [`DirectHllSketch`] keeps an HLL6 or HLL8 sketch in an externally owned buffer, such as a
+//! memory-mapped file, and updates it in place.
+//!
+//! The [`druid`] module reads and writes the HLL sketch columns of Apache Druid segments.
+//! [`HllSketch::to_registers`] and [`HllSketch::from_registers`] exchange the raw registers with
+//! other HLL implementations, with the caveats listed by [`RegisterImport`].
+//!
+//! HLL sketches cannot be intersected; [`estimate_intersection`] estimates the overlap of two
+//! sketches by inclusion–exclusion over their union, with bounds reflecting its larger error.
+//!
 //! # HLL Types
 //!
 //! Three target HLL types are supported, trading precision for memory:
@@ -72,6 +91,12 @@
 //! The serialization format is compatible with Apache DataSketches implementations
 //! in Java and C++, enabling cross-platform sketch exchange.
 //!
+//! An image of a serial version this library does not read fails with
+//! [`ErrorKind::UnsupportedVersion`](crate::error::ErrorKind::UnsupportedVersion), whose
+//! [`SketchError::UnsupportedSerialVersion`](crate::error::SketchError::UnsupportedSerialVersion)
+//! cause carries the version found and the newest one supported. [`register_version_reader`]
+//! installs a reader for another version, such as one converting the images of a newer release.
+//!
 //! # Usage
 //!
 //! ```
@@ -111,21 +136,51 @@ mod array4;
 mod array6;
 mod array8;
 mod aux_map;
+mod builder;
 mod composite_interpolation;
+mod concurrent;
 mod container;
 mod coupon_mapping;
 mod cubic_interpolation;
+mod direct;
+pub mod druid;
 mod estimator;
+mod fixed;
+#[cfg(feature = "theta")]
+mod from_theta;
 mod harmonic_numbers;
 mod hash_set;
+mod inclusion_exclusion;
 mod list;
 mod mode;
+mod registers;
 mod serialization;
 mod sketch;
+mod sketch_map;
+mod snapshot;
 mod union;
+mod unique_count_map;
+mod version;
+mod wrapper;
 
+pub use self::builder::HllSketchBuilder;
+pub use self::concurrent::ConcurrentHll;
+pub use self::direct::DirectHllSketch;
+pub use self::fixed::FixedHllSketch;
+pub use self::inclusion_exclusion::estimate_intersection;
+pub use self::registers::RegisterImport;
 pub use self::sketch::HllSketch;
+pub use self::sketch_map::HllSketchMap;
+pub use self::snapshot::HllSnapshot;
 pub use self::union::HllUnion;
+pub use self::unique_count_map::UniqueCountMap;
+pub use self::version::VersionReader;
+pub use self::version::register_version_reader;
+pub use self::version::supported_versions;
+pub use self::wrapper::HllWrapper;
+
+/// An HLL sketch shared read-only across threads.
+pub type SharedHllSketch = crate::common::SharedCompactSketch<HllSketch>;
 
 /// Target HLL type.
 ///
@@ -218,7 +273,30 @@ impl Coupon {
         let mut hasher = MurmurHash3X64128::default();
         v.hash(&mut hasher);
         let (lo, hi) = hasher.finish128();
+        Self::from_hash128(lo, hi)
+    }
 
+    /// Compute the HLL coupon from an already computed 128-bit hash.
+    ///
+    /// `lo` and `hi` are the two halves returned by
+    /// [`MurmurHash3X64128::finish128`](crate::hash::MurmurHash3X64128::finish128). Passing the
+    /// MurmurHash3 of a value under [`DEFAULT_UPDATE_SEED`](crate::hash::DEFAULT_UPDATE_SEED)
+    /// gives the same coupon as [`from_hash`](Self::from_hash).
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use std::hash::Hash;
+    /// # use datasketches::hash::MurmurHash3X64128;
+    /// # use datasketches::hll::Coupon;
+    /// let mut hasher = MurmurHash3X64128::default();
+    /// "apple".hash(&mut hasher);
+    /// let (lo, hi) = hasher.finish128();
+    ///
+    /// assert_eq!(Coupon::from_hash128(lo, hi), Coupon::from_hash("apple"));
+    /// ```
+    #[inline(always)]
+    pub fn from_hash128(lo: u64, hi: u64) -> Self {
         let addr26 = lo as u32 & KEY_MASK_26;
         let lz = hi.leading_zeros();
         let capped = lz.min(62);
@@ -233,15 +311,18 @@ impl Coupon {
         Coupon(((value as u32) << KEY_BITS_26) | (slot & KEY_MASK_26))
     }
 
-    /// Extract the slot index (low 26 bits).
+    /// Returns the slot index (low 26 bits).
+    ///
+    /// A sketch with `lg_config_k` uses the low `lg_config_k` bits of the slot as its register
+    /// index.
     #[inline(always)]
-    fn slot(self) -> u32 {
+    pub fn slot(self) -> u32 {
         self.0 & KEY_MASK_26
     }
 
-    /// Extract the register value (upper 6 bits).
+    /// Returns the register value (upper 6 bits).
     #[inline(always)]
-    fn value(self) -> u8 {
+    pub fn value(self) -> u8 {
         (self.0 >> KEY_BITS_26) as u8
     }
 }
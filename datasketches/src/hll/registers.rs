@@ -0,0 +1,160 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::common::NumStdDev;
+use crate::error::Error;
+use crate::hll::Coupon;
+use crate::hll::HllSketch;
+use crate::hll::HllSketchBuilder;
+use crate::hll::HllType;
+use crate::hll::mode::Mode;
+
+/// The largest register value, the 6 bits of a coupon value
+const MAX_REGISTER: u8 = 63;
+
+/// An HLL sketch built from raw registers, with the accuracy it can be trusted to.
+///
+/// The registers of another HLL implementation, such as Redis or postgresql-hll, only describe
+/// a DataSketches sketch as far as the two agree on what a register is:
+///
+/// * The estimate is computed from the registers alone. The history of the updates behind the HIP
+///   estimator of a sketch updated with the items is not part of the registers, so the error is
+///   that of a merged sketch, [`rel_std_err`](Self::rel_std_err), rather than the smaller one of
+///   [`HllSketch::rel_err`] for a sketch that was only updated.
+/// * The sketch can be merged with sketches imported from the same implementation and
+///   configuration, but not with sketches updated by this library: the items went through another
+///   hash, so the same item lands in different registers and is counted twice.
+/// * A source hashing fewer bits than the 64 of this library saturates its registers at a smaller
+///   value, 51 for the 64-bit hash and 14 index bits of Redis, which caps the counts it can tell
+///   apart well beyond any practical cardinality, but caps them all the same.
+#[derive(Debug, Clone)]
+#[non_exhaustive]
+pub struct RegisterImport {
+    /// The sketch holding the imported registers, which is out of order and estimates from its
+    /// registers.
+    pub sketch: HllSketch,
+    /// The relative standard error of the estimates of the sketch at one standard deviation.
+    pub rel_std_err: f64,
+}
+
+impl HllSketch {
+    /// Returns the value of every register, one byte per slot from slot 0 to `2^lg_k - 1`.
+    ///
+    /// A register holds 0 if no item landed in its slot, otherwise one more than the largest
+    /// number of leading zeros among the hashes of the slot, the convention of most HLL
+    /// implementations. Sketches in list or set mode are expanded to the registers their
+    /// coupons would set. The values ignore the estimator state, so [`from_registers`]
+    /// returns an out of order sketch with the same registers rather than this sketch.
+    ///
+    /// [`from_registers`]: Self::from_registers
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll4);
+    /// sketch.extend(0..10_000);
+    /// let registers = sketch.to_registers();
+    /// assert_eq!(registers.len(), 1024);
+    /// assert!(registers.iter().all(|&value| value > 0));
+    /// ```
+    pub fn to_registers(&self) -> Vec<u8> {
+        let k = 1usize << self.lg_config_k();
+        let mut registers = vec![0; k];
+        for coupon in self.iter() {
+            let slot = coupon.slot() as usize & (k - 1);
+            registers[slot] = registers[slot].max(coupon.value());
+        }
+        registers
+    }
+
+    /// Builds an HLL sketch of `hll_type` from the value of each register of a sketch of
+    /// `lg_config_k`, one byte per slot.
+    ///
+    /// This bootstraps sketches from the registers of other HLL implementations, in the
+    /// convention of [`to_registers`](Self::to_registers). The result reports the accuracy of
+    /// the imported sketch; see [`RegisterImport`] for what the registers of another
+    /// implementation can and cannot carry over.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `lg_config_k` is not in the range `[4, 21]`, if `registers` does
+    /// not hold `2^lg_config_k` values, or if a value is larger than 63.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::common::NumStdDev;
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// // the registers of a dense Redis HLL of 2^14 registers, decoded from its 6-bit fields
+    /// # let mut source = HllSketch::new(14, HllType::Hll8);
+    /// # source.extend(0..1_000_000);
+    /// # let redis_registers = source.to_registers();
+    /// let import = HllSketch::from_registers(14, &redis_registers, HllType::Hll4).unwrap();
+    /// let sketch = import.sketch;
+    /// assert!(sketch.is_out_of_order());
+    /// assert!((sketch.estimate() - 1_000_000.0).abs() < 3.0 * import.rel_std_err * 1_000_000.0);
+    /// ```
+    pub fn from_registers(
+        lg_config_k: u8,
+        registers: &[u8],
+        hll_type: HllType,
+    ) -> Result<RegisterImport, Error> {
+        if !(4..=21).contains(&lg_config_k) {
+            return Err(Error::invalid_argument(format!(
+                "lg_config_k must be in [4, 21], got {lg_config_k}"
+            )));
+        }
+        let k = 1usize << lg_config_k;
+        if registers.len() != k {
+            return Err(Error::invalid_argument(format!(
+                "expected {k} registers for lg_config_k {lg_config_k}, got {}",
+                registers.len()
+            )));
+        }
+        if let Some(slot) = registers.iter().position(|&value| value > MAX_REGISTER) {
+            return Err(Error::invalid_argument(format!(
+                "register {slot} holds {}, larger than {MAX_REGISTER}",
+                registers[slot]
+            )));
+        }
+
+        let mut sketch = HllSketchBuilder::default()
+            .lg_k(lg_config_k)
+            .hll_type(hll_type)
+            .start_full_size(true)
+            .build();
+        for (slot, &value) in registers.iter().enumerate() {
+            if value > 0 {
+                sketch.update_with_coupon(Coupon::pack(slot as u32, value));
+            }
+        }
+        // the registers arrive in slot order, which the HIP accumulator does not allow for
+        match sketch.mode_mut() {
+            Mode::Array4(arr) => arr.set_out_of_order(true),
+            Mode::Array6(arr) => arr.set_out_of_order(true),
+            Mode::Array8(arr) => arr.set_out_of_order(true),
+            Mode::List { .. } | Mode::Set { .. } => unreachable!("the sketch starts full size"),
+        }
+        Ok(RegisterImport {
+            sketch,
+            rel_std_err: HllSketch::rel_err(true, true, lg_config_k, NumStdDev::One).abs(),
+        })
+    }
+}
@@ -20,6 +20,8 @@
 //! This module contains all constants related to the Apache DataSketches
 //! binary serialization format, shared across all sketch modes.
 
+use crate::error::Error;
+
 /// Current serialization version
 pub const SERIAL_VERSION: u8 = 1;
 
@@ -44,6 +46,28 @@ pub const SET_PREAMBLE_SIZE: usize = 12;
 /// Total size of HLL preamble in bytes
 pub const HLL_PREAMBLE_SIZE: usize = 40;
 
+/// Largest register value an HLL mode image may hold, the 6 bits of a coupon value
+pub const MAX_REGISTER_VALUE: u8 = 63;
+
+/// Check the register header of an HLL mode image
+///
+/// `cur_min` must be a register value, and at most all `2^lg_config_k` registers can be at it.
+/// HLL6 and HLL8 images store their zero count as `num_at_cur_min`, with `cur_min` 0.
+pub fn check_hll_header(lg_config_k: u8, cur_min: u8, num_at_cur_min: u32) -> Result<(), Error> {
+    if cur_min > MAX_REGISTER_VALUE {
+        return Err(Error::deserial(format!(
+            "cur_min must be at most {MAX_REGISTER_VALUE}, got {cur_min}"
+        )));
+    }
+    let k = 1u32 << lg_config_k;
+    if num_at_cur_min > k {
+        return Err(Error::deserial(format!(
+            "num_at_cur_min must be at most {k} for lg_k {lg_config_k}, got {num_at_cur_min}"
+        )));
+    }
+    Ok(())
+}
+
 /// Extract current mode from mode byte (low 2 bits)
 ///
 /// Returns: 0 = LIST, 1 = SET, 2 = HLL
@@ -20,40 +20,66 @@
 //! This module provides the main [`HllSketch`] struct, which is the primary interface
 //! for creating and using HLL sketches for cardinality estimation.
 
+use std::fmt;
 use std::hash::Hash;
+use std::io;
+use std::io::Read;
+use std::io::Write;
 
+use crate::codec::SketchBytes;
 use crate::codec::SketchSlice;
-use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::ensure_lg_k_in;
 use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
 use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::DistinctCountEstimator;
 use crate::common::NumStdDev;
+use crate::common::SketchEvent;
+use crate::common::observer::notify;
 use crate::error::Error;
+use crate::error::SketchError;
 use crate::hll::Coupon;
+use crate::hll::HllSketchBuilder;
+use crate::hll::HllSnapshot;
 use crate::hll::HllType;
+use crate::hll::HllWrapper;
 use crate::hll::RESIZE_DENOMINATOR;
 use crate::hll::RESIZE_NUMERATOR;
 use crate::hll::array4::Array4;
+use crate::hll::array6;
 use crate::hll::array6::Array6;
 use crate::hll::array8::Array8;
+use crate::hll::aux_map::lg_aux_arr_ints;
 use crate::hll::container::Container;
+use crate::hll::estimator::HipEstimator;
+use crate::hll::estimator::get_rel_err;
 use crate::hll::hash_set::HashSet;
 use crate::hll::list::List;
 use crate::hll::mode::Mode;
 use crate::hll::serialization::COMPACT_FLAG_MASK;
+use crate::hll::serialization::COUPON_SIZE_BYTES;
 use crate::hll::serialization::CUR_MODE_HLL;
 use crate::hll::serialization::CUR_MODE_LIST;
 use crate::hll::serialization::CUR_MODE_SET;
 use crate::hll::serialization::EMPTY_FLAG_MASK;
 use crate::hll::serialization::HASH_SET_PREINTS;
+use crate::hll::serialization::HLL_PREAMBLE_SIZE;
 use crate::hll::serialization::HLL_PREINTS;
+use crate::hll::serialization::LIST_PREAMBLE_SIZE;
 use crate::hll::serialization::LIST_PREINTS;
 use crate::hll::serialization::OUT_OF_ORDER_FLAG_MASK;
 use crate::hll::serialization::SERIAL_VERSION;
+use crate::hll::serialization::SET_PREAMBLE_SIZE;
 use crate::hll::serialization::TGT_HLL4;
 use crate::hll::serialization::TGT_HLL6;
 use crate::hll::serialization::TGT_HLL8;
 use crate::hll::serialization::extract_cur_mode;
 use crate::hll::serialization::extract_tgt_hll_type;
+use crate::hll::version;
 
 /// A HyperLogLog sketch.
 ///
@@ -140,6 +166,70 @@ impl HllSketch {
         }
     }
 
+    /// Reset the sketch to its empty state
+    ///
+    /// The sketch keeps its lg_config_k and target type and returns to List mode, matching
+    /// Java's `reset()`. An empty List sketch only holds a small coupon array, so the register
+    /// array of an HLL mode sketch is released rather than kept around.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll4);
+    /// for i in 0..10000 {
+    ///     sketch.update(i);
+    /// }
+    ///
+    /// sketch.reset();
+    /// assert!(sketch.is_empty());
+    /// assert_eq!(sketch, HllSketch::new(10, HllType::Hll4));
+    /// ```
+    pub fn reset(&mut self) {
+        *self = HllSketch::new(self.lg_config_k, self.target_type());
+    }
+
+    /// Empties the sketch and gives it a new configuration, for reusing sketches from a pool.
+    ///
+    /// Unlike [`reset`](Self::reset), a sketch in HLL mode whose register array fits the new
+    /// configuration, which has the same lg_config_k and target type, keeps the array: the
+    /// registers are zeroed in place and the sketch stays in HLL mode, as one built with
+    /// [`start_full_size`](crate::hll::HllSketchBuilder::start_full_size). Any other sketch
+    /// becomes the List mode sketch of [`new`](Self::new).
+    ///
+    /// # Panics
+    ///
+    /// If lg_config_k is not in range [4, 21]
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(12, HllType::Hll8);
+    /// sketch.extend(0..10000);
+    /// let size = sketch.estimated_size();
+    ///
+    /// sketch.reconfigure(12, HllType::Hll8);
+    /// assert!(sketch.is_empty());
+    /// assert_eq!(sketch.estimated_size(), size);
+    ///
+    /// sketch.reconfigure(10, HllType::Hll4);
+    /// assert_eq!(sketch, HllSketch::new(10, HllType::Hll4));
+    /// ```
+    pub fn reconfigure(&mut self, lg_config_k: u8, hll_type: HllType) {
+        if lg_config_k == self.lg_config_k {
+            match (&mut self.mode, hll_type) {
+                (Mode::Array4(arr), HllType::Hll4) => return arr.clear(),
+                (Mode::Array6(arr), HllType::Hll6) => return arr.clear(),
+                (Mode::Array8(arr), HllType::Hll8) => return arr.clear(),
+                _ => {}
+            }
+        }
+        *self = HllSketch::new(lg_config_k, hll_type);
+    }
+
     /// Get the target HLL type for this sketch
     pub fn target_type(&self) -> HllType {
         match &self.mode {
@@ -187,6 +277,31 @@ impl HllSketch {
         self.update_with_coupon(Coupon::from_hash(value));
     }
 
+    /// Update the sketch with an already computed 128-bit hash.
+    ///
+    /// `lo` and `hi` are the MurmurHash3 halves of a value under
+    /// [`DEFAULT_UPDATE_SEED`](crate::hash::DEFAULT_UPDATE_SEED), so a system that hashes each
+    /// key once can feed the same hash to several sketches. This is equivalent to
+    /// `update_with_coupon(Coupon::from_hash128(lo, hi))`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use std::hash::Hash;
+    /// # use datasketches::hash::MurmurHash3X64128;
+    /// # use datasketches::hll::{HllSketch, HllType};
+    /// let mut hasher = MurmurHash3X64128::default();
+    /// "apple".hash(&mut hasher);
+    /// let (lo, hi) = hasher.finish128();
+    ///
+    /// let mut sketch = HllSketch::new(10, HllType::Hll8);
+    /// sketch.update_hash(lo, hi);
+    /// assert!(sketch.estimate() >= 1.0);
+    /// ```
+    pub fn update_hash(&mut self, lo: u64, hi: u64) {
+        self.update_with_coupon(Coupon::from_hash128(lo, hi));
+    }
+
     /// Update the sketch with a pre-computed [`Coupon`].
     ///
     /// A [`Coupon`] encodes both the HLL bucket index (low 26 bits) and the register
@@ -212,10 +327,18 @@ impl HllSketch {
                 list.update(coupon);
                 let should_promote = list.container().is_full();
                 if should_promote {
-                    self.mode = if self.lg_config_k < 8 {
-                        promote_container_to_array(list.container(), *hll_type, self.lg_config_k)
+                    let lg_config_k = self.lg_config_k;
+                    if lg_config_k < 8 {
+                        let num_coupons = list.container().len();
+                        self.mode =
+                            promote_container_to_array(list.container(), *hll_type, lg_config_k);
+                        notify(SketchEvent::HllToArray {
+                            lg_config_k,
+                            num_coupons,
+                        });
                     } else {
-                        promote_container_to_set(list.container(), *hll_type)
+                        self.mode = promote_container_to_set(list.container(), *hll_type);
+                        notify(SketchEvent::HllListToSet { lg_config_k });
                     }
                 }
             }
@@ -224,10 +347,22 @@ impl HllSketch {
                 let should_promote = RESIZE_DENOMINATOR as usize * set.container().len()
                     > RESIZE_NUMERATOR as usize * set.container().capacity();
                 if should_promote {
-                    self.mode = if set.container().lg_size() == self.lg_config_k as usize - 3 {
-                        promote_container_to_array(set.container(), *hll_type, self.lg_config_k)
+                    let lg_config_k = self.lg_config_k;
+                    if set.container().lg_size() == lg_config_k as usize - 3 {
+                        let num_coupons = set.container().len();
+                        self.mode =
+                            promote_container_to_array(set.container(), *hll_type, lg_config_k);
+                        notify(SketchEvent::HllToArray {
+                            lg_config_k,
+                            num_coupons,
+                        });
                     } else {
-                        grow_set(set, *hll_type)
+                        let lg_size = set.container().lg_size() as u8 + 1;
+                        self.mode = grow_set(set, *hll_type);
+                        notify(SketchEvent::HllSetResize {
+                            lg_config_k,
+                            lg_size,
+                        });
                     }
                 }
             }
@@ -237,6 +372,131 @@ impl HllSketch {
         }
     }
 
+    /// Returns a copy of this sketch with `hll_type` as its target type
+    ///
+    /// Converting between target types keeps every register value as well as the HIP
+    /// accumulator and the out-of-order flag, so the copy reports the same estimate. Sketches in
+    /// List or Set mode only change the type they will promote to.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(12, HllType::Hll8);
+    /// for i in 0..10000 {
+    ///     sketch.update(i);
+    /// }
+    ///
+    /// let compact = sketch.copy_as(HllType::Hll4);
+    /// assert_eq!(compact.target_type(), HllType::Hll4);
+    /// assert_eq!(compact.estimate(), sketch.estimate());
+    /// assert!(compact.serialize().len() < sketch.serialize().len());
+    /// ```
+    pub fn copy_as(&self, hll_type: HllType) -> HllSketch {
+        if hll_type == self.target_type() {
+            return self.clone();
+        }
+
+        let lg_config_k = self.lg_config_k;
+        let mode = match &self.mode {
+            Mode::List { list, .. } => Mode::List {
+                list: list.clone(),
+                hll_type,
+            },
+            Mode::Set { set, .. } => Mode::Set {
+                set: set.clone(),
+                hll_type,
+            },
+            Mode::Array4(arr) => {
+                convert_array(lg_config_k, |slot| arr.get(slot), arr.estimator(), hll_type)
+            }
+            Mode::Array6(arr) => {
+                convert_array(lg_config_k, |slot| arr.get(slot), arr.estimator(), hll_type)
+            }
+            Mode::Array8(arr) => {
+                convert_array(lg_config_k, |slot| arr.get(slot), arr.estimator(), hll_type)
+            }
+        };
+        HllSketch { lg_config_k, mode }
+    }
+
+    /// Returns true if `other` holds the same retained state as this sketch, regardless of how
+    /// it is stored.
+    ///
+    /// Unlike `==`, which compares the representation, this ignores the target type and the
+    /// layout of the coupon tables, so for example an HLL4 sketch read from Java and an HLL8
+    /// sketch recomputed from the same stream are equivalent. The sketches must have the same
+    /// lg_config_k and the same coupons (List and Set mode) or register values (HLL mode), and
+    /// their estimates must differ by at most `tolerance` relative to the larger one. The HIP
+    /// estimate depends on the order of the updates, so a sketch recomputed from the stream in
+    /// another order, or merged through a union, needs a tolerance of about its relative error.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `tolerance` is negative or NaN.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut hll4 = HllSketch::new(10, HllType::Hll4);
+    /// let mut hll8 = HllSketch::new(10, HllType::Hll8);
+    /// hll4.extend(0..10000);
+    /// hll8.extend(0..10000);
+    ///
+    /// assert_ne!(hll4, hll8);
+    /// assert!(hll4.is_equivalent(&hll8, 0.0));
+    ///
+    /// hll8.extend(10000..20000);
+    /// assert!(!hll4.is_equivalent(&hll8, 1.0));
+    /// ```
+    pub fn is_equivalent(&self, other: &HllSketch, tolerance: f64) -> bool {
+        assert!(
+            tolerance >= 0.0,
+            "tolerance must be non-negative, got {tolerance}"
+        );
+        if self.lg_config_k != other.lg_config_k {
+            return false;
+        }
+        let same_state = match (self.sorted_coupons(), other.sorted_coupons()) {
+            (Some(coupons), Some(other_coupons)) => coupons == other_coupons,
+            (None, None) => {
+                let registers = self.register_fn();
+                let other_registers = other.register_fn();
+                (0..1u32 << self.lg_config_k).all(|slot| registers(slot) == other_registers(slot))
+            }
+            _ => false,
+        };
+        let (estimate, other_estimate) = (self.estimate(), other.estimate());
+        same_state && (estimate - other_estimate).abs() <= tolerance * estimate.max(other_estimate)
+    }
+
+    /// Returns the coupons of a List or Set mode sketch in ascending order.
+    fn sorted_coupons(&self) -> Option<Vec<Coupon>> {
+        let container = match &self.mode {
+            Mode::List { list, .. } => list.container(),
+            Mode::Set { set, .. } => set.container(),
+            _ => return None,
+        };
+        let mut coupons: Vec<Coupon> = container.iter().collect();
+        coupons.sort_unstable();
+        Some(coupons)
+    }
+
+    /// Returns the register lookup of an HLL mode sketch.
+    ///
+    /// List and Set mode sketches have no registers and read as all zeros.
+    fn register_fn(&self) -> Box<dyn Fn(u32) -> u8 + '_> {
+        match &self.mode {
+            Mode::List { .. } | Mode::Set { .. } => Box::new(|_| 0),
+            Mode::Array4(arr) => Box::new(|slot| arr.get(slot)),
+            Mode::Array6(arr) => Box::new(|slot| arr.get(slot)),
+            Mode::Array8(arr) => Box::new(|slot| arr.get(slot)),
+        }
+    }
+
     /// Get the current cardinality estimate
     ///
     /// # Examples
@@ -286,8 +546,305 @@ impl HllSketch {
         }
     }
 
+    /// Get the composite cardinality estimate
+    ///
+    /// In HLL mode this blends the raw HyperLogLog estimate with linear counting, which is the
+    /// estimator used once a sketch is out of order. It differs from [`estimate`](Self::estimate)
+    /// while the HIP accumulator is still valid. List and Set modes return the coupon estimate.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll8);
+    /// for i in 0..10000 {
+    ///     sketch.update(i);
+    /// }
+    /// let relative_diff = (sketch.composite_estimate() / sketch.estimate() - 1.0).abs();
+    /// assert!(relative_diff < 0.1);
+    /// ```
+    pub fn composite_estimate(&self) -> f64 {
+        match &self.mode {
+            Mode::List { list, .. } => list.container().estimate(),
+            Mode::Set { set, .. } => set.container().estimate(),
+            Mode::Array4(arr) => arr.composite_estimate(),
+            Mode::Array6(arr) => arr.composite_estimate(),
+            Mode::Array8(arr) => arr.composite_estimate(),
+        }
+    }
+
+    /// Get the HIP (Historical Inverse Probability) estimate
+    ///
+    /// Returns `None` in List and Set modes, and once the sketch is out of order, since the HIP
+    /// accumulator is only valid for a sketch built by sequential updates.
+    pub fn hip_estimate(&self) -> Option<f64> {
+        self.estimator()
+            .filter(|estimator| !estimator.is_out_of_order())
+            .map(|estimator| estimator.hip_accum())
+    }
+
+    /// Get the raw HyperLogLog estimate computed from the registers
+    ///
+    /// Returns `None` in List and Set modes.
+    pub fn raw_estimate(&self) -> Option<f64> {
+        self.estimator()
+            .map(|estimator| estimator.raw_estimate(self.lg_config_k))
+    }
+
+    /// Discard the cached composite estimate
+    ///
+    /// In HLL mode the composite estimate is cached until the next register change, so repeated
+    /// queries of an out-of-order sketch do not redo the interpolation. Clearing the cache makes
+    /// the next query compute it again from the registers, which is mostly useful in tests. List
+    /// and Set modes keep no cache.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll8);
+    /// sketch.extend(0..10000);
+    /// let cached = sketch.composite_estimate();
+    /// sketch.force_recompute();
+    /// assert_eq!(sketch.composite_estimate(), cached);
+    /// ```
+    pub fn force_recompute(&self) {
+        if let Some(estimator) = self.estimator() {
+            estimator.invalidate_cache();
+        }
+    }
+
+    /// Returns true if the sketch is out of order
+    ///
+    /// A sketch is out of order after it has been produced by a union; its estimate then comes
+    /// from the composite estimator instead of the HIP accumulator. Sketches in List and Set
+    /// modes are never out of order.
+    pub fn is_out_of_order(&self) -> bool {
+        self.estimator()
+            .is_some_and(|estimator| estimator.is_out_of_order())
+    }
+
+    /// Returns an immutable view of the current estimates.
+    ///
+    /// The snapshot copies a few counters rather than the registers, so a reader that shares
+    /// the sketch with a writer can take one at any rate and query it without holding on to the
+    /// sketch. See [`HllSnapshot`] for an example.
+    pub fn snapshot(&self) -> HllSnapshot {
+        let hll_type = self.target_type();
+        match &self.mode {
+            Mode::List { list, .. } => {
+                HllSnapshot::from_coupons(self.lg_config_k, hll_type, list.container().len())
+            }
+            Mode::Set { set, .. } => {
+                HllSnapshot::from_coupons(self.lg_config_k, hll_type, set.container().len())
+            }
+            Mode::Array4(arr) => HllSnapshot::from_registers(
+                self.lg_config_k,
+                hll_type,
+                arr.cur_min(),
+                arr.num_at_cur_min(),
+                arr.estimator(),
+            ),
+            Mode::Array6(arr) => HllSnapshot::from_registers(
+                self.lg_config_k,
+                hll_type,
+                0,
+                arr.num_zeros(),
+                arr.estimator(),
+            ),
+            Mode::Array8(arr) => HllSnapshot::from_registers(
+                self.lg_config_k,
+                hll_type,
+                0,
+                arr.num_zeros(),
+                arr.estimator(),
+            ),
+        }
+    }
+
+    /// Returns a human-readable description of the sketch
+    ///
+    /// The output follows the layout of Java's `HllSketch.toString(summary, detail, auxDetail)`:
+    ///
+    /// * `summary`: lg_k, target type, mode, estimate and bounds, plus the cur_min, num_at_cur_min
+    ///   and HIP registers in HLL mode.
+    /// * `detail`: the stored coupons in List and Set modes, or every register in HLL mode.
+    /// * `aux_detail`: the exception table of an HLL4 sketch in HLL mode.
+    ///
+    /// The [`Display`](fmt::Display) implementation prints the summary only.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll8);
+    /// sketch.update("apple");
+    ///
+    /// let summary = sketch.to_string();
+    /// assert!(summary.contains("Current Mode   : LIST"));
+    /// assert!(
+    ///     sketch
+    ///         .to_string_with(false, true, false)
+    ///         .contains("### COUPONS DETAIL")
+    /// );
+    /// ```
+    pub fn to_string_with(&self, summary: bool, detail: bool, aux_detail: bool) -> String {
+        let mut out = String::new();
+        self.write_description(&mut out, summary, detail, aux_detail)
+            .expect("writing to a String cannot fail");
+        out
+    }
+
+    fn write_description(
+        &self,
+        f: &mut impl fmt::Write,
+        summary: bool,
+        detail: bool,
+        aux_detail: bool,
+    ) -> fmt::Result {
+        if summary {
+            let mode_name = match self.mode {
+                Mode::List { .. } => "LIST",
+                Mode::Set { .. } => "SET",
+                Mode::Array4(_) | Mode::Array6(_) | Mode::Array8(_) => "HLL",
+            };
+            let target_name = match self.target_type() {
+                HllType::Hll4 => "HLL_4",
+                HllType::Hll6 => "HLL_6",
+                HllType::Hll8 => "HLL_8",
+            };
+            writeln!(f, "### HLL SKETCH SUMMARY:")?;
+            writeln!(f, "  Log Config K   : {}", self.lg_config_k)?;
+            writeln!(f, "  Hll Target     : {target_name}")?;
+            writeln!(f, "  Current Mode   : {mode_name}")?;
+            writeln!(f, "  LB             : {}", self.lower_bound(NumStdDev::One))?;
+            writeln!(f, "  Estimate       : {}", self.estimate())?;
+            writeln!(f, "  UB             : {}", self.upper_bound(NumStdDev::One))?;
+            writeln!(f, "  OutOfOrder Flag: {}", self.is_out_of_order())?;
+            match &self.mode {
+                Mode::List { list, .. } => write_coupons_summary(f, list.container())?,
+                Mode::Set { set, .. } => write_coupons_summary(f, set.container())?,
+                Mode::Array4(arr) => write_registers_summary(
+                    f,
+                    arr.cur_min(),
+                    arr.num_at_cur_min(),
+                    arr.estimator(),
+                )?,
+                Mode::Array6(arr) => {
+                    write_registers_summary(f, 0, arr.num_zeros(), arr.estimator())?
+                }
+                Mode::Array8(arr) => {
+                    write_registers_summary(f, 0, arr.num_zeros(), arr.estimator())?
+                }
+            }
+            writeln!(f, "### END SKETCH SUMMARY")?;
+        }
+
+        if detail {
+            match &self.mode {
+                Mode::List { list, .. } => write_coupons_detail(f, list.container())?,
+                Mode::Set { set, .. } => write_coupons_detail(f, set.container())?,
+                Mode::Array4(arr) => {
+                    write_registers_detail(f, arr.num_registers(), |slot| arr.get(slot))?
+                }
+                Mode::Array6(arr) => {
+                    write_registers_detail(f, arr.num_registers(), |slot| arr.get(slot))?
+                }
+                Mode::Array8(arr) => {
+                    write_registers_detail(f, arr.num_registers(), |slot| arr.get(slot))?
+                }
+            }
+        }
+
+        if aux_detail {
+            if let Mode::Array4(arr) = &self.mode {
+                writeln!(f, "### HLL SKETCH AUX DETAIL:")?;
+                writeln!(f, "{:>10}{:>10}", "Slot", "Value")?;
+                for (slot, value) in arr.aux_entries() {
+                    writeln!(f, "{slot:>10}{value:>10}")?;
+                }
+            }
+        }
+
+        Ok(())
+    }
+
+    fn estimator(&self) -> Option<&HipEstimator> {
+        match &self.mode {
+            Mode::List { .. } | Mode::Set { .. } => None,
+            Mode::Array4(arr) => Some(arr.estimator()),
+            Mode::Array6(arr) => Some(arr.estimator()),
+            Mode::Array8(arr) => Some(arr.estimator()),
+        }
+    }
+
+    /// Returns an iterator over the retained coupons
+    ///
+    /// In List and Set modes this yields the stored coupons in table order, with the full 26-bit
+    /// slot of each coupon. In HLL mode it yields one coupon per non-zero register, in slot
+    /// order, whose slot is the register index and whose value is the register value. This is
+    /// the counterpart of Java's `PairIterator` restricted to valid entries.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll8);
+    /// sketch.update("apple");
+    /// sketch.update("banana");
+    /// assert_eq!(sketch.iter().count(), 2);
+    ///
+    /// for i in 0..10000 {
+    ///     sketch.update(i);
+    /// }
+    /// assert!(
+    ///     sketch
+    ///         .iter()
+    ///         .all(|coupon| coupon.slot() < 1024 && coupon.value() > 0)
+    /// );
+    /// ```
+    pub fn iter(&self) -> impl Iterator<Item = Coupon> + '_ {
+        let container = match &self.mode {
+            Mode::List { list, .. } => Some(list.container()),
+            Mode::Set { set, .. } => Some(set.container()),
+            Mode::Array4(_) | Mode::Array6(_) | Mode::Array8(_) => None,
+        };
+        let num_registers = match container {
+            Some(_) => 0,
+            None => 1u32 << self.lg_config_k,
+        };
+
+        let coupons = container.into_iter().flat_map(|container| container.iter());
+        let registers = (0..num_registers).filter_map(move |slot| {
+            let value = self.register(slot);
+            (value > 0).then(|| Coupon::pack(slot, value))
+        });
+        coupons.chain(registers)
+    }
+
+    /// Get the value of the register at `slot` of an HLL mode sketch
+    fn register(&self, slot: u32) -> u8 {
+        match &self.mode {
+            Mode::Array4(arr) => arr.get(slot),
+            Mode::Array6(arr) => arr.get(slot),
+            Mode::Array8(arr) => arr.get(slot),
+            Mode::List { .. } | Mode::Set { .. } => {
+                unreachable!("register called on a List or Set sketch")
+            }
+        }
+    }
+
     /// Deserializes an HLL sketch from bytes
     ///
+    /// An image of another serial version is handed to the reader installed for it with
+    /// [`register_version_reader`](crate::hll::register_version_reader), and fails with
+    /// [`ErrorKind::UnsupportedVersion`](crate::error::ErrorKind::UnsupportedVersion) if there
+    /// is none.
+    ///
     /// # Examples
     ///
     /// ```
@@ -300,8 +857,26 @@ impl HllSketch {
     /// assert!(decoded.estimate() >= 1.0);
     /// ```
     pub fn deserialize(bytes: &[u8]) -> Result<HllSketch, Error> {
-        let mut cursor = SketchSlice::new(bytes);
+        if let Some(reader) = version::reader_for(bytes) {
+            return reader(bytes);
+        }
+        Self::read_image(SketchSlice::new(bytes))
+    }
 
+    /// Reads an HLL sketch written by [`write_to`](Self::write_to) from `reader`
+    ///
+    /// Both the compact and the updatable image are accepted. Exactly the bytes of one image
+    /// are consumed, so several sketches can be read back from the same stream.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<HllSketch, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>) -> Result<HllSketch, Error> {
         // Read and validate preamble
         let preamble_ints = cursor
             .read_u8()
@@ -325,14 +900,12 @@ impl HllSketch {
         Family::HLL.validate_id(family_id)?;
 
         // Verify serialization version
-        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        if serial_version != SERIAL_VERSION {
+            return Err(version::unsupported(serial_version));
+        }
 
         // Verify lg_k range (4-21 are valid)
-        if !(4..=21).contains(&lg_config_k) {
-            return Err(Error::deserial(format!(
-                "lg_k must be in [4; 21], got {lg_config_k}",
-            )));
-        }
+        ensure_lg_k_in(4, 21, lg_config_k)?;
 
         let hll_type = match extract_tgt_hll_type(mode_byte) {
             TGT_HLL4 => HllType::Hll4,
@@ -348,61 +921,96 @@ impl HllSketch {
         let ooo = (flags & OUT_OF_ORDER_FLAG_MASK) != 0;
 
         // Deserialize based on mode
-        let mode =
-            match extract_cur_mode(mode_byte) {
-                CUR_MODE_LIST => {
-                    if preamble_ints != LIST_PREINTS {
-                        return Err(Error::deserial(format!(
-                            "LIST mode preamble: expected {}, got {}",
-                            LIST_PREINTS, preamble_ints,
-                        )));
-                    }
+        let mode = match extract_cur_mode(mode_byte) {
+            CUR_MODE_LIST => {
+                if preamble_ints != LIST_PREINTS {
+                    return Err(Error::deserial(format!(
+                        "LIST mode preamble: expected {}, got {}",
+                        LIST_PREINTS, preamble_ints,
+                    ))
+                    .with_reason(SketchError::InvalidPreamble {
+                        actual: preamble_ints,
+                    }));
+                }
 
-                    let lg_arr = lg_arr as usize;
-                    let coupon_count = state as usize;
-                    let list = List::deserialize(cursor, lg_arr, coupon_count, empty, compact)?;
-                    Mode::List { list, hll_type }
+                let lg_arr = check_coupon_lg_arr(lg_arr, lg_config_k)?;
+                let coupon_count = state as usize;
+                let list = List::deserialize(cursor, lg_arr, coupon_count, empty, compact)?;
+                Mode::List { list, hll_type }
+            }
+            CUR_MODE_SET => {
+                if preamble_ints != HASH_SET_PREINTS {
+                    return Err(Error::deserial(format!(
+                        "SET mode preamble: expected {}, got {}",
+                        HASH_SET_PREINTS, preamble_ints
+                    ))
+                    .with_reason(SketchError::InvalidPreamble {
+                        actual: preamble_ints,
+                    }));
                 }
-                CUR_MODE_SET => {
-                    if preamble_ints != HASH_SET_PREINTS {
-                        return Err(Error::deserial(format!(
-                            "SET mode preamble: expected {}, got {}",
-                            HASH_SET_PREINTS, preamble_ints
-                        )));
-                    }
 
-                    let lg_arr = lg_arr as usize;
-                    let set = HashSet::deserialize(cursor, lg_arr, compact)?;
-                    Mode::Set { set, hll_type }
+                let lg_arr = check_coupon_lg_arr(lg_arr, lg_config_k)?;
+                let set = HashSet::deserialize(cursor, lg_arr, compact)?;
+                Mode::Set { set, hll_type }
+            }
+            CUR_MODE_HLL => {
+                if preamble_ints != HLL_PREINTS {
+                    return Err(Error::deserial(format!(
+                        "HLL mode preamble: expected {}, got {}",
+                        HLL_PREINTS, preamble_ints
+                    ))
+                    .with_reason(SketchError::InvalidPreamble {
+                        actual: preamble_ints,
+                    }));
                 }
-                CUR_MODE_HLL => {
-                    if preamble_ints != HLL_PREINTS {
-                        return Err(Error::deserial(format!(
-                            "HLL mode preamble: expected {}, got {}",
-                            HLL_PREINTS, preamble_ints
-                        )));
-                    }
 
-                    match hll_type {
-                        HllType::Hll4 => {
-                            let cur_min = state;
-                            Array4::deserialize(cursor, cur_min, lg_config_k, compact, ooo)
-                                .map(Mode::Array4)?
-                        }
-                        HllType::Hll6 => Array6::deserialize(cursor, lg_config_k, compact, ooo)
-                            .map(Mode::Array6)?,
-                        HllType::Hll8 => Array8::deserialize(cursor, lg_config_k, compact, ooo)
-                            .map(Mode::Array8)?,
+                match hll_type {
+                    HllType::Hll4 => {
+                        let cur_min = state;
+                        Array4::deserialize(cursor, cur_min, lg_config_k, lg_arr, compact, ooo)
+                            .map(Mode::Array4)?
+                    }
+                    HllType::Hll6 => {
+                        Array6::deserialize(cursor, lg_config_k, ooo).map(Mode::Array6)?
+                    }
+                    HllType::Hll8 => {
+                        Array8::deserialize(cursor, lg_config_k, ooo).map(Mode::Array8)?
                     }
                 }
-                mode => return Err(Error::deserial(format!("invalid mode: {mode}"))),
-            };
+            }
+            mode => return Err(Error::deserial(format!("invalid mode: {mode}"))),
+        };
 
         Ok(HllSketch { lg_config_k, mode })
     }
 
+    /// Wraps a serialized HLL sketch without copying it
+    ///
+    /// Accepts both the compact and the updatable image. The returned [`HllWrapper`] borrows
+    /// `bytes` and is read-only.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::common::NumStdDev;
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// # let mut sketch = HllSketch::new(10, HllType::Hll8);
+    /// # sketch.update("apple");
+    /// # let bytes = sketch.serialize();
+    /// let wrapped = HllSketch::wrap(&bytes).unwrap();
+    /// assert_eq!(wrapped.estimate(), 1.0);
+    /// assert!(wrapped.upper_bound(NumStdDev::Two) >= 1.0);
+    /// ```
+    pub fn wrap(bytes: &[u8]) -> Result<HllWrapper<'_>, Error> {
+        HllWrapper::new(bytes)
+    }
+
     /// Serializes the HLL sketch to bytes
     ///
+    /// This writes the compact image, which omits empty coupon slots. Use
+    /// [`serialize_updatable`](Self::serialize_updatable) for the updatable image.
+    ///
     /// # Examples
     ///
     /// ```
@@ -415,27 +1023,457 @@ impl HllSketch {
     /// assert!(decoded.estimate() >= 1.0);
     /// ```
     pub fn serialize(&self) -> Vec<u8> {
+        self.serialize_with(true)
+    }
+
+    /// Returns the compact image with its List, Set or HLL4 aux coupons in ascending order.
+    ///
+    /// The coupons are written in the order of the coupon table, which depends on the order of
+    /// the updates; sorting them leaves an image that depends only on the retained state.
+    fn canonical_image(&self) -> Vec<u8> {
+        let mut image = self.serialize();
+        let coupons_at = match &self.mode {
+            Mode::List { .. } => LIST_PREAMBLE_SIZE,
+            Mode::Set { .. } => SET_PREAMBLE_SIZE,
+            Mode::Array4(_) => HLL_PREAMBLE_SIZE + (1 << (self.lg_config_k - 1)),
+            Mode::Array6(_) | Mode::Array8(_) => return image,
+        };
+        let coupons = &mut image[coupons_at..];
+        let mut sorted: Vec<u32> = coupons
+            .chunks_exact(COUPON_SIZE_BYTES)
+            .map(|chunk| u32::from_le_bytes(chunk.try_into().unwrap()))
+            .collect();
+        sorted.sort_unstable();
+        for (chunk, coupon) in coupons.chunks_exact_mut(COUPON_SIZE_BYTES).zip(sorted) {
+            chunk.copy_from_slice(&coupon.to_le_bytes());
+        }
+        image
+    }
+
+    /// Serializes the sketch in the compact format as if its target type were `hll_type`
+    ///
+    /// This lets a sketch be updated as HLL8, the fastest type to update, and stored as HLL4,
+    /// the smallest. The image is the one [`copy_as`](Self::copy_as) followed by
+    /// [`serialize`](Self::serialize) would produce; the sketch itself is not changed.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(12, HllType::Hll8);
+    /// for i in 0..10000 {
+    ///     sketch.update(i);
+    /// }
+    ///
+    /// let bytes = sketch.serialize_as(HllType::Hll4);
+    /// assert!(bytes.len() < sketch.serialize().len());
+    /// assert_eq!(sketch.target_type(), HllType::Hll8);
+    ///
+    /// let decoded = HllSketch::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.target_type(), HllType::Hll4);
+    /// assert_eq!(decoded.estimate(), sketch.estimate());
+    /// ```
+    pub fn serialize_as(&self, hll_type: HllType) -> Vec<u8> {
+        if hll_type == self.target_type() {
+            return self.serialize();
+        }
+        self.copy_as(hll_type).serialize()
+    }
+
+    /// Serializes the HLL sketch to bytes in the updatable format
+    ///
+    /// The updatable image matches Java's `toUpdatableByteArray()`: List and Set modes store
+    /// their whole coupon hash table including empty entries, and HLL4 stores its whole
+    /// auxiliary exception table. HLL6 and HLL8 images are identical in both formats.
+    ///
+    /// [`deserialize`](Self::deserialize) reads both formats.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll4);
+    /// sketch.update("apple");
+    ///
+    /// let bytes = sketch.serialize_updatable();
+    /// assert!(bytes.len() > sketch.serialize().len());
+    ///
+    /// let decoded = HllSketch::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded, sketch);
+    /// ```
+    pub fn serialize_updatable(&self) -> Vec<u8> {
+        self.serialize_with(false)
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        self.serialized_size_with(true)
+    }
+
+    /// Returns the number of bytes [`serialize_updatable`](Self::serialize_updatable) produces.
+    pub fn updatable_serialized_size_bytes(&self) -> usize {
+        self.serialized_size_with(false)
+    }
+
+    /// Returns the size in bytes that the updatable image of a sketch with the given
+    /// configuration can grow to, as Java's `getMaxUpdatableSerializationBytes`.
+    ///
+    /// This is the size of the HLL mode image, which is larger than the List and Set mode
+    /// images. For [`HllType::Hll4`] it assumes the auxiliary exception table keeps its initial
+    /// size, which it outgrows only in extremely rare cases, and then by a few percent.
+    ///
+    /// # Panics
+    ///
+    /// If `lg_config_k` is not in range [4, 21].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let max_size = HllSketch::max_updatable_serialized_bytes(10, HllType::Hll8);
+    /// assert_eq!(max_size, 40 + 1024);
+    ///
+    /// let mut sketch = HllSketch::new(10, HllType::Hll8);
+    /// sketch.extend(0..10000);
+    /// assert!(sketch.serialize_updatable().len() <= max_size);
+    /// ```
+    pub fn max_updatable_serialized_bytes(lg_config_k: u8, hll_type: HllType) -> usize {
+        assert!(
+            (4..=21).contains(&lg_config_k),
+            "lg_config_k must be in [4, 21], got {}",
+            lg_config_k
+        );
+        HLL_PREAMBLE_SIZE + max_array_bytes(lg_config_k, hll_type)
+    }
+
+    /// Returns the estimated size in bytes that a sketch with the given configuration can
+    /// grow to, the counterpart of [`estimated_size`](Self::estimated_size) for budgeting
+    /// memory before any sketch is built.
+    ///
+    /// As with [`max_updatable_serialized_bytes`](Self::max_updatable_serialized_bytes), the
+    /// auxiliary exception table of an [`HllType::Hll4`] sketch is assumed to keep its initial
+    /// size.
+    ///
+    /// # Panics
+    ///
+    /// If `lg_config_k` is not in range [4, 21].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let max_size = HllSketch::max_estimated_size(12, HllType::Hll8);
+    ///
+    /// let mut sketch = HllSketch::new(12, HllType::Hll8);
+    /// assert!(sketch.estimated_size() < max_size);
+    /// sketch.extend(0..100_000);
+    /// assert_eq!(sketch.estimated_size(), max_size);
+    /// ```
+    pub fn max_estimated_size(lg_config_k: u8, hll_type: HllType) -> usize {
+        assert!(
+            (4..=21).contains(&lg_config_k),
+            "lg_config_k must be in [4, 21], got {}",
+            lg_config_k
+        );
+        // a set never grows past k / 8 slots, and a list holds 8 coupons
+        let coupon_bytes = ((1usize << lg_config_k) / 8).max(8) * size_of::<Coupon>();
+        size_of::<Self>() + coupon_bytes.max(max_array_bytes(lg_config_k, hll_type))
+    }
+
+    /// Returns the relative error of the bound of an estimate, as Java's `getRelErr`.
+    ///
+    /// The value is the one the sketch applies to its estimate: a lower bound is
+    /// `estimate / (1 + rel_err)` with a positive error, and an upper bound the same with a
+    /// negative error. With `unioned` set, the error is that of a sketch that was merged or
+    /// deserialized and estimates from its registers instead of the HIP accumulator. Up to
+    /// lg_k 12 the errors come from the empirical tables shared with Java and C++, and above
+    /// from the asymptotic formula.
+    ///
+    /// # Panics
+    ///
+    /// If `lg_config_k` is not in range [4, 21].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::common::NumStdDev;
+    /// # use datasketches::hll::HllSketch;
+    /// let lower = HllSketch::rel_err(false, false, 12, NumStdDev::Two);
+    /// let upper = HllSketch::rel_err(true, false, 12, NumStdDev::Two);
+    /// assert!(lower > 0.0 && upper < 0.0);
+    /// // merged sketches lose the more accurate HIP estimator
+    /// assert!(HllSketch::rel_err(false, true, 12, NumStdDev::Two) > lower);
+    /// ```
+    pub fn rel_err(
+        upper_bound: bool,
+        unioned: bool,
+        lg_config_k: u8,
+        num_std_dev: NumStdDev,
+    ) -> f64 {
+        assert!(
+            (4..=21).contains(&lg_config_k),
+            "lg_config_k must be in [4, 21], got {}",
+            lg_config_k
+        );
+        get_rel_err(lg_config_k, upper_bound, unioned, num_std_dev)
+    }
+
+    /// Returns the smallest lg_k whose relative errors at `num_std_dev`, as returned by
+    /// [`rel_err`](Self::rel_err), do not exceed `rel_err`, so that lg_k can be chosen from an
+    /// accuracy target.
+    ///
+    /// The errors of both bounds are checked, using those of a unioned sketch, which
+    /// are larger than those of a sketch that was only updated, so the target holds for union
+    /// results too. A target smaller than the error at lg_k 21 returns 21.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `rel_err` is not positive.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::common::NumStdDev;
+    /// # use datasketches::hll::HllSketch;
+    /// let lg_k = HllSketch::lg_k_for_rel_err(0.02, NumStdDev::Two);
+    /// assert_eq!(lg_k, 14);
+    /// assert!(HllSketch::rel_err(true, true, lg_k, NumStdDev::Two).abs() <= 0.02);
+    /// assert!(HllSketch::rel_err(true, true, lg_k - 1, NumStdDev::Two).abs() > 0.02);
+    /// ```
+    pub fn lg_k_for_rel_err(rel_err: f64, num_std_dev: NumStdDev) -> u8 {
+        assert!(rel_err > 0.0, "rel_err must be positive, got {rel_err}");
+        (4..21)
+            .find(|&lg_k| {
+                [false, true].into_iter().all(|upper_bound| {
+                    get_rel_err(lg_k, upper_bound, true, num_std_dev).abs() <= rel_err
+                })
+            })
+            .unwrap_or(21)
+    }
+
+    /// Serializes the sketch in the compact format into `buf`, returning the number of bytes
+    /// written.
+    ///
+    /// The image is the same as the one [`serialize`](Self::serialize) returns, written without
+    /// allocating so that one buffer can be reused for many sketches.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `buf` is shorter than [`serialized_size_bytes`].
+    ///
+    /// [`serialized_size_bytes`]: Self::serialized_size_bytes
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll4);
+    /// sketch.update("apple");
+    ///
+    /// let mut buf = vec![0; 4096];
+    /// let len = sketch.serialize_into(&mut buf).unwrap();
+    /// assert_eq!(&buf[..len], sketch.serialize().as_slice());
+    /// ```
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes, true))
+    }
+
+    /// Writes the sketch in the compact format to `writer`.
+    ///
+    /// This streams the image [`serialize`](Self::serialize) returns in chunks instead of
+    /// assembling it in memory first.
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll4);
+    /// sketch.update("apple");
+    ///
+    /// let mut file = Vec::new();
+    /// sketch.write_to(&mut file).unwrap();
+    ///
+    /// let decoded = HllSketch::read_from(&mut file.as_slice()).unwrap();
+    /// assert_eq!(decoded.estimate(), sketch.estimate());
+    /// ```
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes, true))
+    }
+
+    fn serialize_with(&self, compact: bool) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_with(compact));
+        self.write_image(&mut bytes, compact);
+        bytes.into_bytes()
+    }
+
+    fn serialized_size_with(&self, compact: bool) -> usize {
         match &self.mode {
-            Mode::List { list, hll_type } => list.serialize(self.lg_config_k, *hll_type),
-            Mode::Set { set, hll_type } => set.serialize(self.lg_config_k, *hll_type),
-            Mode::Array4(arr) => arr.serialize(self.lg_config_k),
-            Mode::Array6(arr) => arr.serialize(self.lg_config_k),
-            Mode::Array8(arr) => arr.serialize(self.lg_config_k),
+            Mode::List { list, .. } => list.serialized_size(compact),
+            Mode::Set { set, .. } => set.serialized_size(compact),
+            Mode::Array4(arr) => arr.serialized_size(self.lg_config_k, compact),
+            Mode::Array6(arr) => arr.serialized_size(self.lg_config_k),
+            Mode::Array8(arr) => arr.serialized_size(self.lg_config_k),
+        }
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes, compact: bool) {
+        match &self.mode {
+            Mode::List { list, hll_type } => {
+                list.serialize(bytes, self.lg_config_k, *hll_type, compact)
+            }
+            Mode::Set { set, hll_type } => {
+                set.serialize(bytes, self.lg_config_k, *hll_type, compact)
+            }
+            Mode::Array4(arr) => arr.serialize(bytes, self.lg_config_k, compact),
+            Mode::Array6(arr) => arr.serialize(bytes, self.lg_config_k),
+            Mode::Array8(arr) => arr.serialize(bytes, self.lg_config_k),
         }
     }
 
     /// Returns the estimated size of the sketch in bytes
     pub fn estimated_size(&self) -> usize {
-        let heap_size = match &self.mode {
+        size_of::<Self>() + self.heap_size()
+    }
+
+    /// Returns the size of the coupon containers or registers in bytes.
+    pub(super) fn heap_size(&self) -> usize {
+        match &self.mode {
             Mode::List { list, .. } => list.container().estimated_size(),
             Mode::Set { set, .. } => set.container().estimated_size(),
             Mode::Array4(arr) => arr.estimated_size(),
             Mode::Array6(arr) => arr.estimated_size(),
             Mode::Array8(arr) => arr.estimated_size(),
-        };
+        }
+    }
+}
+
+impl fmt::Display for HllSketch {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        self.write_description(f, true, false, false)
+    }
+}
+
+fn write_coupons_summary(f: &mut impl fmt::Write, container: &Container) -> fmt::Result {
+    writeln!(f, "  Coupon Count   : {}", container.len())?;
+    writeln!(f, "  Lg Coupon Arr  : {}", container.lg_size())
+}
 
-        size_of::<Self>() + heap_size
+fn write_registers_summary(
+    f: &mut impl fmt::Write,
+    cur_min: u8,
+    num_at_cur_min: u32,
+    estimator: &HipEstimator,
+) -> fmt::Result {
+    writeln!(f, "  CurMin         : {cur_min}")?;
+    writeln!(f, "  NumAtCurMin    : {num_at_cur_min}")?;
+    writeln!(f, "  HipAccum       : {}", estimator.hip_accum())?;
+    writeln!(f, "  KxQ0           : {}", estimator.kxq0())?;
+    writeln!(f, "  KxQ1           : {}", estimator.kxq1())
+}
+
+fn write_coupons_detail(f: &mut impl fmt::Write, container: &Container) -> fmt::Result {
+    writeln!(f, "### COUPONS DETAIL:")?;
+    writeln!(
+        f,
+        "{:>10}{:>12}{:>10}{:>10}",
+        "Index", "Key", "Slot", "Value"
+    )?;
+    for (index, coupon) in container.coupons.iter().enumerate() {
+        if !coupon.is_empty() {
+            let (key, slot, value) = (coupon.raw(), coupon.slot(), coupon.value());
+            writeln!(f, "{index:>10}{key:>12}{slot:>10}{value:>10}")?;
+        }
     }
+    Ok(())
+}
+
+fn write_registers_detail(
+    f: &mut impl fmt::Write,
+    num_registers: usize,
+    get_value: impl Fn(u32) -> u8,
+) -> fmt::Result {
+    writeln!(f, "### HLL SKETCH DATA DETAIL:")?;
+    writeln!(f, "{:>10}{:>10}", "Slot", "Value")?;
+    for slot in 0..num_registers as u32 {
+        writeln!(f, "{slot:>10}{:>10}", get_value(slot))?;
+    }
+    Ok(())
+}
+
+/// Rebuild the registers read through `get_value` as an array of `hll_type`
+///
+/// The HIP accumulator and out-of-order flag are carried over from `estimator`; the KxQ
+/// registers are recomputed by the updates.
+fn convert_array(
+    lg_config_k: u8,
+    get_value: impl Fn(u32) -> u8,
+    estimator: &HipEstimator,
+    hll_type: HllType,
+) -> Mode {
+    let coupons = (0..1u32 << lg_config_k).filter_map(|slot| {
+        let value = get_value(slot);
+        (value > 0).then(|| Coupon::pack(slot, value))
+    });
+    let ooo = estimator.is_out_of_order();
+    let hip_accum = estimator.hip_accum();
+
+    match hll_type {
+        HllType::Hll4 => {
+            let mut arr = Array4::new(lg_config_k);
+            coupons.for_each(|coupon| arr.update(coupon));
+            arr.set_out_of_order(ooo);
+            arr.set_hip_accum(hip_accum);
+            Mode::Array4(arr)
+        }
+        HllType::Hll6 => {
+            let mut arr = Array6::new(lg_config_k);
+            coupons.for_each(|coupon| arr.update(coupon));
+            arr.set_out_of_order(ooo);
+            arr.set_hip_accum(hip_accum);
+            Mode::Array6(arr)
+        }
+        HllType::Hll8 => {
+            let mut arr = Array8::new(lg_config_k);
+            coupons.for_each(|coupon| arr.update(coupon));
+            arr.set_out_of_order(ooo);
+            arr.set_hip_accum(hip_accum);
+            Mode::Array8(arr)
+        }
+    }
+}
+
+/// Validates the coupon table size of a List or Set image.
+///
+/// A Set is promoted to an HLL array once it outgrows `lg_config_k - 3`, so no valid image holds
+/// a larger table; rejecting one also bounds the table allocated for it.
+/// Bytes of the HLL mode registers, plus an Hll4 auxiliary table at its initial size.
+fn max_array_bytes(lg_config_k: u8, hll_type: HllType) -> usize {
+    let k = 1usize << lg_config_k;
+    match hll_type {
+        HllType::Hll4 => k / 2 + (COUPON_SIZE_BYTES << lg_aux_arr_ints(lg_config_k)),
+        HllType::Hll6 => array6::num_bytes_for_k(k as u32),
+        HllType::Hll8 => k,
+    }
+}
+
+fn check_coupon_lg_arr(lg_arr: u8, lg_config_k: u8) -> Result<usize, Error> {
+    let max_lg_arr = (lg_config_k as usize - 3).max(HashSet::LG_INIT_SIZE);
+    if lg_arr as usize > max_lg_arr {
+        return Err(Error::deserial(format!(
+            "lg_arr must be at most {max_lg_arr} for lg_k {lg_config_k}, got {lg_arr}"
+        )));
+    }
+    Ok(lg_arr as usize)
 }
 
 fn promote_container_to_set(container: &Container, hll_type: HllType) -> Mode {
@@ -488,3 +1526,49 @@ fn promote_container_to_array(container: &Container, hll_type: HllType, lg_confi
         }
     }
 }
+
+/// Updates the sketch with every value of the iterator, as [`HllSketch::update`] does.
+impl<T: Hash> Extend<T> for HllSketch {
+    fn extend<I: IntoIterator<Item = T>>(&mut self, iter: I) {
+        for value in iter {
+            self.update(value);
+        }
+    }
+}
+
+/// Collects the values into a sketch with the defaults of [`HllSketchBuilder`].
+impl<T: Hash> FromIterator<T> for HllSketch {
+    fn from_iter<I: IntoIterator<Item = T>>(iter: I) -> Self {
+        let mut sketch = HllSketchBuilder::default().build();
+        sketch.extend(iter);
+        sketch
+    }
+}
+
+impl DistinctCountEstimator for HllSketch {
+    fn is_empty(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn is_exact(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn estimate(&self) -> f64 {
+        self.estimate()
+    }
+
+    fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.lower_bound(num_std_dev)
+    }
+
+    fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.upper_bound(num_std_dev)
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(HllSketch);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(HllSketch);
+impl_fingerprint_via_image!([] HllSketch, |s| s.canonical_image());
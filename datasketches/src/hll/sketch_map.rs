@@ -0,0 +1,432 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Distinct counts per key within a memory budget, with a global rollup
+//!
+//! [`HllSketchMap`] keeps an HLL sketch per key, as when counting the distinct users of each
+//! page or tenant, and bounds the memory of all of them together. Recently updated keys keep
+//! an updatable sketch; when the map grows past its budget, the sketches updated least
+//! recently are spilled to their compact HLL4 image. Spilling loses nothing and pays off for
+//! the sketches in HLL mode, whose compact image takes about half the bytes of an HLL8 array,
+//! while the coupons of a list or set only shed the free slots of their table and a map of
+//! HLL4 sketches gains little. A spilled key is restored on its next update.
+//!
+//! The whole map merges with another one key by key, rolls up into the sketch of all its keys,
+//! and serializes to a single image:
+//!
+//! | Bytes | Field                                                  |
+//! |-------|--------------------------------------------------------|
+//! | 8     | magic, `DSKHMAP1`                                      |
+//! | 1     | lg_k                                                   |
+//! | 1     | target type, as its bits per register: 4, 6 or 8       |
+//! | 2     | unused, zero                                           |
+//! | 4     | number of keys                                         |
+//! | 8     | memory budget in bytes                                 |
+//! | …     | per key, in key order: key length, key, image length, compact HLL4 image |
+//!
+//! All the integers are little-endian and the lengths are `u32`. A deserialized map holds
+//! every key in compact form until it is updated.
+
+use std::collections::BTreeMap;
+use std::collections::HashMap;
+use std::hash::Hash;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::insufficient_data;
+use crate::error::Error;
+use crate::hll::HllSketch;
+use crate::hll::HllType;
+use crate::hll::HllUnion;
+use crate::hll::HllWrapper;
+
+const MAGIC: [u8; 8] = *b"DSKHMAP1";
+
+/// The bytes of the header before the first key
+const HEADER_BYTES: usize = MAGIC.len() + 16;
+
+/// The sketch of a key
+#[derive(Debug, Clone)]
+enum Entry {
+    /// An updatable sketch, with the tick of its last update
+    Updatable { sketch: HllSketch, tick: u64 },
+    /// A compact HLL4 image
+    Compact(Box<[u8]>),
+}
+
+impl Entry {
+    fn size(&self) -> usize {
+        match self {
+            Entry::Updatable { sketch, .. } => sketch.estimated_size(),
+            Entry::Compact(image) => image.len(),
+        }
+    }
+}
+
+/// HLL sketches keyed by byte strings, spilled to compact images beyond a memory budget.
+///
+/// See the [module level documentation](self) for the spill policy and the serialized form.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hll::HllSketchMap;
+/// # use datasketches::hll::HllType;
+/// let mut map = HllSketchMap::new(12, HllType::Hll8, 32 * 1024);
+/// for user in 0..100_000u32 {
+///     map.update(format!("page-{}", user % 10).as_bytes(), user);
+/// }
+/// assert!(map.memory_usage_bytes() <= 32 * 1024);
+/// assert!(map.num_compact() > 0);
+/// assert!((map.estimate(b"page-7") - 10_000.0).abs() < 600.0);
+/// assert!((map.rollup().estimate() - 100_000.0).abs() < 6000.0);
+///
+/// let copy = HllSketchMap::deserialize(&map.serialize()).unwrap();
+/// assert_eq!(copy.estimate(b"page-7"), map.estimate(b"page-7"));
+/// ```
+#[derive(Debug, Clone)]
+pub struct HllSketchMap {
+    lg_k: u8,
+    hll_type: HllType,
+    max_bytes: usize,
+    entries: HashMap<Box<[u8]>, Entry>,
+    /// the keys of the updatable entries by the tick of their last update, oldest first
+    recency: BTreeMap<u64, Box<[u8]>>,
+    tick: u64,
+    /// the bytes of the keys and of their sketches
+    memory: usize,
+}
+
+impl HllSketchMap {
+    /// Creates an empty map of sketches of `lg_k` and `hll_type`, holding about `max_bytes`.
+    ///
+    /// The budget covers the keys and their sketches. The most recently updated sketch is never
+    /// spilled, and the compact images cannot shrink further, so a map of more keys than the
+    /// budget holds as compact images exceeds it. The budget should also hold the updatable
+    /// sketches of the keys updated together: a stream cycling over more keys than that
+    /// restores and spills a sketch on every update.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `lg_k` is not in the range `[4, 21]`.
+    pub fn new(lg_k: u8, hll_type: HllType, max_bytes: usize) -> Self {
+        assert!(
+            (4..=21).contains(&lg_k),
+            "lg_k must be in [4, 21], got {lg_k}"
+        );
+        HllSketchMap {
+            lg_k,
+            hll_type,
+            max_bytes,
+            entries: HashMap::new(),
+            recency: BTreeMap::new(),
+            tick: 0,
+            memory: 0,
+        }
+    }
+
+    /// Returns the lg_k of the sketches.
+    pub fn lg_k(&self) -> u8 {
+        self.lg_k
+    }
+
+    /// Returns the target type of the sketches.
+    pub fn target_type(&self) -> HllType {
+        self.hll_type
+    }
+
+    /// Returns the memory budget in bytes.
+    pub fn max_bytes(&self) -> usize {
+        self.max_bytes
+    }
+
+    /// Returns the number of keys in the map.
+    pub fn num_keys(&self) -> usize {
+        self.entries.len()
+    }
+
+    /// Returns the number of keys whose sketch is spilled to its compact image.
+    pub fn num_compact(&self) -> usize {
+        self.entries.len() - self.recency.len()
+    }
+
+    /// Returns true if no key has been updated.
+    pub fn is_empty(&self) -> bool {
+        self.entries.is_empty()
+    }
+
+    /// Returns the approximate number of bytes held by the keys and their sketches.
+    pub fn memory_usage_bytes(&self) -> usize {
+        self.memory
+    }
+
+    /// Returns the keys of the map, in no particular order.
+    pub fn keys(&self) -> impl Iterator<Item = &[u8]> + '_ {
+        self.entries.keys().map(|key| &key[..])
+    }
+
+    /// Updates the sketch of `key` with `item`, spilling other sketches if over budget.
+    pub fn update<T: Hash>(&mut self, key: &[u8], item: T) {
+        let sketch = self.updatable(key);
+        let before = sketch.estimated_size();
+        sketch.update(item);
+        let after = sketch.estimated_size();
+        self.memory = self.memory + after - before;
+        self.spill();
+    }
+
+    /// Returns the estimated number of distinct items of `key`, or 0 if the key is absent.
+    pub fn estimate(&self, key: &[u8]) -> f64 {
+        match self.entries.get(key) {
+            None => 0.0,
+            Some(Entry::Updatable { sketch, .. }) => sketch.estimate(),
+            Some(Entry::Compact(image)) => wrap(image).estimate(),
+        }
+    }
+
+    /// Returns the sketch of `key`, or `None` if the key is absent.
+    pub fn get(&self, key: &[u8]) -> Option<HllSketch> {
+        self.entries.get(key).map(|entry| match entry {
+            Entry::Updatable { sketch, .. } => sketch.clone(),
+            Entry::Compact(image) => restore(image, self.hll_type),
+        })
+    }
+
+    /// Returns the union of the sketches of all keys, of the lg_k and type of the map.
+    pub fn rollup(&self) -> HllSketch {
+        let mut union = HllUnion::new(self.lg_k);
+        for entry in self.entries.values() {
+            match entry {
+                Entry::Updatable { sketch, .. } => union.update(sketch),
+                Entry::Compact(image) => union.update_wrapped(&wrap(image)),
+            }
+        }
+        union.to_sketch(self.hll_type)
+    }
+
+    /// Merges the sketch of each key of `other` into the sketch of the same key of this map.
+    ///
+    /// A sketch of `other` of a larger lg_k is downsampled to the lg_k of this map; one of a
+    /// smaller lg_k in HLL mode downsamples the merged sketch of its key, as an [`HllUnion`]
+    /// does.
+    pub fn merge(&mut self, other: &HllSketchMap) {
+        for (key, entry) in &other.entries {
+            let lg_k = self.lg_k;
+            let hll_type = self.hll_type;
+            let sketch = self.updatable(key);
+            let before = sketch.estimated_size();
+            let mut union = HllUnion::new(lg_k);
+            union.update(sketch);
+            match entry {
+                Entry::Updatable { sketch, .. } => union.update(sketch),
+                Entry::Compact(image) => union.update_wrapped(&wrap(image)),
+            }
+            *sketch = union.to_sketch(hll_type);
+            let after = sketch.estimated_size();
+            self.memory = self.memory + after - before;
+            self.spill();
+        }
+    }
+
+    /// Removes all keys.
+    pub fn reset(&mut self) {
+        *self = HllSketchMap::new(self.lg_k, self.hll_type, self.max_bytes);
+    }
+
+    /// Serializes the map with every sketch in compact form.
+    ///
+    /// The keys are written in ascending order, so equal maps have equal images.
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut keys: Vec<&Box<[u8]>> = self.entries.keys().collect();
+        keys.sort_unstable();
+
+        let mut bytes = SketchBytes::with_capacity(HEADER_BYTES + self.memory);
+        bytes.write(&MAGIC);
+        bytes.write_u8(self.lg_k);
+        bytes.write_u8(type_bits(self.hll_type));
+        bytes.write_u16_le(0);
+        bytes.write_u32_le(keys.len() as u32);
+        bytes.write_u64_le(self.max_bytes as u64);
+        for key in keys {
+            bytes.write_u32_le(key.len() as u32);
+            bytes.write(key);
+            match &self.entries[key] {
+                Entry::Updatable { sketch, .. } => {
+                    let image = sketch.serialize_as(HllType::Hll4);
+                    bytes.write_u32_le(image.len() as u32);
+                    bytes.write(&image);
+                }
+                Entry::Compact(image) => {
+                    bytes.write_u32_le(image.len() as u32);
+                    bytes.write(image);
+                }
+            }
+        }
+        bytes.into_bytes()
+    }
+
+    /// Deserializes a map written by [`serialize`](Self::serialize).
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the bytes are truncated or not a serialized map, if a key appears
+    /// twice, or if an image is not a valid HLL image of at most the lg_k of the map.
+    pub fn deserialize(bytes: &[u8]) -> Result<HllSketchMap, Error> {
+        let mut slice = SketchSlice::new(bytes);
+        let mut magic = [0; MAGIC.len()];
+        slice
+            .read_exact(&mut magic)
+            .map_err(insufficient_data("magic"))?;
+        if magic != MAGIC {
+            return Err(Error::deserial("not a serialized HLL sketch map"));
+        }
+        let lg_k = slice.read_u8().map_err(insufficient_data("lg_k"))?;
+        if !(4..=21).contains(&lg_k) {
+            return Err(Error::deserial(format!(
+                "lg_k must be in [4, 21], got {lg_k}"
+            )));
+        }
+        let bits = slice.read_u8().map_err(insufficient_data("hll_type"))?;
+        let hll_type = match bits {
+            4 => HllType::Hll4,
+            6 => HllType::Hll6,
+            8 => HllType::Hll8,
+            _ => {
+                return Err(Error::deserial(format!(
+                    "invalid target type of {bits} bits"
+                )));
+            }
+        };
+        slice.read_u16_le().map_err(insufficient_data("unused"))?;
+        let num_keys = slice.read_u32_le().map_err(insufficient_data("num_keys"))?;
+        let max_bytes = slice
+            .read_u64_le()
+            .map_err(insufficient_data("max_bytes"))?;
+
+        let mut map = HllSketchMap::new(lg_k, hll_type, max_bytes as usize);
+        for _ in 0..num_keys {
+            let key = read_field(&mut slice, "key")?;
+            let image = read_field(&mut slice, "image")?;
+            let sketch = HllSketch::wrap(&image)?;
+            if sketch.lg_config_k() > lg_k {
+                return Err(Error::deserial(format!(
+                    "image of lg_k {} in a map of lg_k {lg_k}",
+                    sketch.lg_config_k()
+                )));
+            }
+            map.memory += key.len() + image.len();
+            if map.entries.insert(key, Entry::Compact(image)).is_some() {
+                return Err(Error::deserial("duplicate key in HLL sketch map"));
+            }
+        }
+        Ok(map)
+    }
+
+    /// Returns the updatable sketch of `key`, inserting or restoring it as the newest one.
+    fn updatable(&mut self, key: &[u8]) -> &mut HllSketch {
+        self.tick += 1;
+        let tick = self.tick;
+        match self.entries.get_mut(key) {
+            Some(Entry::Updatable { tick: last, .. }) => {
+                let last = std::mem::replace(last, tick);
+                let key = self
+                    .recency
+                    .remove(&last)
+                    .expect("updatable keys have a tick");
+                self.recency.insert(tick, key);
+            }
+            Some(entry) => {
+                let before = entry.size();
+                if let Entry::Compact(image) = entry {
+                    let sketch = restore(image, self.hll_type);
+                    *entry = Entry::Updatable { sketch, tick };
+                }
+                self.memory = self.memory + entry.size() - before;
+                self.recency.insert(tick, key.into());
+            }
+            None => {
+                let sketch = HllSketch::new(self.lg_k, self.hll_type);
+                self.memory += key.len() + sketch.estimated_size();
+                self.entries
+                    .insert(key.into(), Entry::Updatable { sketch, tick });
+                self.recency.insert(tick, key.into());
+            }
+        }
+        match self.entries.get_mut(key) {
+            Some(Entry::Updatable { sketch, .. }) => sketch,
+            _ => unreachable!("the entry was made updatable"),
+        }
+    }
+
+    /// Spills the least recently updated sketches until the map is within budget.
+    fn spill(&mut self) {
+        while self.memory > self.max_bytes && self.recency.len() > 1 {
+            let (_, key) = self
+                .recency
+                .pop_first()
+                .expect("more than one updatable key");
+            let entry = self
+                .entries
+                .get_mut(&key)
+                .expect("updatable keys are in the map");
+            let before = entry.size();
+            if let Entry::Updatable { sketch, .. } = entry {
+                *entry = Entry::Compact(sketch.serialize_as(HllType::Hll4).into());
+            }
+            self.memory = self.memory + entry.size() - before;
+        }
+    }
+}
+
+/// Wraps an image written by the map, which is valid by construction.
+fn wrap(image: &[u8]) -> HllWrapper<'_> {
+    HllSketch::wrap(image).expect("the map holds valid images")
+}
+
+/// Returns the updatable sketch of `hll_type` of a compact image.
+fn restore(image: &[u8], hll_type: HllType) -> HllSketch {
+    let sketch = HllSketch::deserialize(image).expect("the map holds valid images");
+    if sketch.target_type() == hll_type {
+        sketch
+    } else {
+        sketch.copy_as(hll_type)
+    }
+}
+
+fn type_bits(hll_type: HllType) -> u8 {
+    match hll_type {
+        HllType::Hll4 => 4,
+        HllType::Hll6 => 6,
+        HllType::Hll8 => 8,
+    }
+}
+
+/// Reads a field of a `u32` length followed by its bytes.
+fn read_field(slice: &mut SketchSlice<'_>, name: &'static str) -> Result<Box<[u8]>, Error> {
+    let len = slice.read_u32_le().map_err(insufficient_data(name))? as usize;
+    if slice.remaining().len() < len {
+        return Err(Error::insufficient_data(format!(
+            "{name} of {len} bytes, got {}",
+            slice.remaining().len()
+        )));
+    }
+    let mut field = vec![0; len];
+    slice
+        .read_exact(&mut field)
+        .map_err(insufficient_data(name))?;
+    Ok(field.into())
+}
@@ -0,0 +1,214 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::common::DistinctCountEstimator;
+use crate::common::NumStdDev;
+use crate::hll::HllType;
+use crate::hll::container::coupon_estimate;
+use crate::hll::container::coupon_lower_bound;
+use crate::hll::container::coupon_upper_bound;
+use crate::hll::estimator::HipEstimator;
+
+/// An immutable view of the estimates of an [`HllSketch`](crate::hll::HllSketch) at one point
+/// in time.
+///
+/// All estimates of an HLL sketch derive from a few counters: the number of coupons in List and
+/// Set modes, or the HIP and KxQ registers together with the count of registers at the current
+/// minimum in HLL mode. A snapshot copies only those counters and none of the registers, so
+/// taking one costs the same for every lg_k and the writer can continue right away. The
+/// snapshot answers every estimate and bound query with the same value as the sketch did when
+/// it was taken.
+///
+/// # Examples
+///
+/// ```
+/// # use std::sync::Mutex;
+/// # use datasketches::common::NumStdDev;
+/// # use datasketches::hll::HllSketch;
+/// # use datasketches::hll::HllType;
+/// let sketch = Mutex::new(HllSketch::new(12, HllType::Hll8));
+/// sketch.lock().unwrap().extend(0..10000);
+///
+/// // the reader holds the lock only for the copy of a few counters
+/// let snapshot = sketch.lock().unwrap().snapshot();
+/// sketch.lock().unwrap().extend(10000..20000);
+///
+/// assert!(snapshot.lower_bound(NumStdDev::Two) <= 10000.0);
+/// assert!(snapshot.upper_bound(NumStdDev::Two) >= 10000.0);
+/// assert!(sketch.lock().unwrap().estimate() > snapshot.estimate());
+/// ```
+#[derive(Debug, Clone, PartialEq)]
+pub struct HllSnapshot {
+    lg_config_k: u8,
+    hll_type: HllType,
+    state: State,
+}
+
+#[derive(Debug, Clone, PartialEq)]
+enum State {
+    /// List or Set mode, with the number of stored coupons
+    Coupons(usize),
+    /// HLL mode
+    Registers {
+        cur_min: u8,
+        num_at_cur_min: u32,
+        estimator: HipEstimator,
+    },
+}
+
+impl HllSnapshot {
+    /// Creates the snapshot of a List or Set mode sketch holding `len` coupons.
+    pub(super) fn from_coupons(lg_config_k: u8, hll_type: HllType, len: usize) -> Self {
+        Self {
+            lg_config_k,
+            hll_type,
+            state: State::Coupons(len),
+        }
+    }
+
+    /// Creates the snapshot of an HLL mode sketch.
+    pub(super) fn from_registers(
+        lg_config_k: u8,
+        hll_type: HllType,
+        cur_min: u8,
+        num_at_cur_min: u32,
+        estimator: &HipEstimator,
+    ) -> Self {
+        Self {
+            lg_config_k,
+            hll_type,
+            state: State::Registers {
+                cur_min,
+                num_at_cur_min,
+                estimator: estimator.clone(),
+            },
+        }
+    }
+
+    /// Returns the lg_config_k of the sketch
+    pub fn lg_config_k(&self) -> u8 {
+        self.lg_config_k
+    }
+
+    /// Returns the target HLL type of the sketch
+    pub fn target_type(&self) -> HllType {
+        self.hll_type
+    }
+
+    /// Returns true if the sketch was empty
+    pub fn is_empty(&self) -> bool {
+        match &self.state {
+            State::Coupons(len) => *len == 0,
+            State::Registers {
+                cur_min,
+                num_at_cur_min,
+                ..
+            } => *cur_min == 0 && *num_at_cur_min == 1 << self.lg_config_k,
+        }
+    }
+
+    /// Returns the cardinality estimate, as
+    /// [`HllSketch::estimate`](crate::hll::HllSketch::estimate)
+    pub fn estimate(&self) -> f64 {
+        match &self.state {
+            State::Coupons(len) => coupon_estimate(*len),
+            State::Registers {
+                cur_min,
+                num_at_cur_min,
+                estimator,
+            } => estimator.estimate(self.lg_config_k, *cur_min, *num_at_cur_min),
+        }
+    }
+
+    /// Returns the upper bound of the cardinality estimate
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        match &self.state {
+            State::Coupons(len) => coupon_upper_bound(*len, num_std_dev),
+            State::Registers {
+                cur_min,
+                num_at_cur_min,
+                estimator,
+            } => estimator.upper_bound(self.lg_config_k, *cur_min, *num_at_cur_min, num_std_dev),
+        }
+    }
+
+    /// Returns the lower bound of the cardinality estimate
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        match &self.state {
+            State::Coupons(len) => coupon_lower_bound(*len, num_std_dev),
+            State::Registers {
+                cur_min,
+                num_at_cur_min,
+                estimator,
+            } => estimator.lower_bound(self.lg_config_k, *cur_min, *num_at_cur_min, num_std_dev),
+        }
+    }
+
+    /// Returns the composite estimate, as
+    /// [`HllSketch::composite_estimate`](crate::hll::HllSketch::composite_estimate)
+    pub fn composite_estimate(&self) -> f64 {
+        match &self.state {
+            State::Coupons(len) => coupon_estimate(*len),
+            State::Registers {
+                cur_min,
+                num_at_cur_min,
+                estimator,
+            } => estimator.composite_estimate(self.lg_config_k, *cur_min, *num_at_cur_min),
+        }
+    }
+
+    /// Returns the HIP estimate, or `None` in List and Set modes and once the sketch is out of
+    /// order
+    pub fn hip_estimate(&self) -> Option<f64> {
+        match &self.state {
+            State::Registers { estimator, .. } if !estimator.is_out_of_order() => {
+                Some(estimator.hip_accum())
+            }
+            _ => None,
+        }
+    }
+
+    /// Returns true if the sketch was out of order
+    pub fn is_out_of_order(&self) -> bool {
+        match &self.state {
+            State::Coupons(_) => false,
+            State::Registers { estimator, .. } => estimator.is_out_of_order(),
+        }
+    }
+}
+
+impl DistinctCountEstimator for HllSnapshot {
+    fn is_empty(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn is_exact(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn estimate(&self) -> f64 {
+        self.estimate()
+    }
+
+    fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.lower_bound(num_std_dev)
+    }
+
+    fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.upper_bound(num_std_dev)
+    }
+}
@@ -27,15 +27,32 @@
 //! * Different lg_k values (automatically resizes as needed)
 //! * Different modes (List, Set, Array4/6/8)
 //! * Different target HLL types
-
+//!
+//! # Target types
+//!
+//! As in Java, the gadget holds its registers as HLL8 once it leaves the coupon modes, whatever
+//! the types of the inputs. All three types store the same 6-bit register values, HLL4 keeping
+//! the values that do not fit its 4-bit slots in an exception table, so converting an input to
+//! the gadget and the gadget to the result loses nothing. Mixing HLL4, HLL6 and HLL8 inputs
+//! therefore gives the same registers and estimate as merging the same sketches all built as
+//! HLL8, and [`HllUnion::to_sketch`] can return the result in any type.
+
+use std::borrow::Borrow;
 use std::hash::Hash;
+use std::iter::Sum;
 
+#[cfg(feature = "aggregator")]
+use crate::aggregator::ImageUnion;
+use crate::common::MergeableSketch;
 use crate::common::NumStdDev;
+#[cfg(feature = "rayon")]
+use crate::common::parallel::tree_reduce;
+use crate::error::Error;
 use crate::hll::Coupon;
 use crate::hll::HllSketch;
+use crate::hll::HllSketchBuilder;
 use crate::hll::HllType;
-use crate::hll::array4::Array4;
-use crate::hll::array6::Array6;
+use crate::hll::HllWrapper;
 use crate::hll::array8::Array8;
 use crate::hll::mode::Mode;
 
@@ -152,6 +169,104 @@ impl HllUnion {
         }
     }
 
+    /// Update the union with a wrapped sketch image
+    ///
+    /// Behaves like [`update`](Self::update), but reads the coupons or registers of the
+    /// source directly from the serialized bytes instead of a deserialized sketch.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// # use datasketches::hll::HllUnion;
+    /// let mut sketch = HllSketch::new(10, HllType::Hll4);
+    /// sketch.update("apple");
+    /// let bytes = sketch.serialize();
+    ///
+    /// let mut union = HllUnion::new(10);
+    /// union.update_wrapped(&HllSketch::wrap(&bytes).unwrap());
+    /// assert_eq!(union.estimate(), 1.0);
+    /// ```
+    pub fn update_wrapped(&mut self, sketch: &HllWrapper<'_>) {
+        if sketch.is_empty() {
+            return;
+        }
+
+        if !sketch.is_array_mode() {
+            for coupon in sketch.coupons() {
+                self.gadget.update_with_coupon(coupon);
+            }
+            return;
+        }
+
+        let src_lg_k = sketch.lg_config_k();
+        let dst_lg_k = self.gadget.lg_config_k();
+        let num_registers = 1 << src_lg_k;
+        let get_value = |slot| sketch.register(slot);
+
+        if self.gadget.is_empty() || !matches!(self.gadget.mode(), Mode::Array8(_)) {
+            let mut new_array = copy_or_downsample_registers(
+                num_registers,
+                get_value,
+                sketch.hip_accum(),
+                src_lg_k,
+                self.lg_max_k,
+            );
+            if !self.gadget.is_empty() {
+                merge_coupons_into_mode(&mut new_array, self.gadget.mode());
+            }
+            let final_lg_k = new_array.num_registers().trailing_zeros() as u8;
+            self.gadget = HllSketch::from_mode(final_lg_k, Mode::Array8(new_array));
+            return;
+        }
+
+        match self.gadget.mode_mut() {
+            Mode::Array8(old_gadget) if src_lg_k < dst_lg_k => {
+                let mut new_array = Array8::new(src_lg_k);
+                new_array.merge_array_with_downsample(old_gadget.values(), dst_lg_k);
+                merge_array46_same_lgk(&mut new_array, num_registers, get_value);
+                self.gadget = HllSketch::from_mode(src_lg_k, Mode::Array8(new_array));
+            }
+            Mode::Array8(dst_array) if src_lg_k == dst_lg_k => {
+                merge_array46_same_lgk(dst_array, num_registers, get_value);
+            }
+            Mode::Array8(dst_array) => {
+                merge_array46_with_downsample(dst_array, dst_lg_k, num_registers, get_value);
+            }
+            _ => unreachable!("gadget mode changed unexpectedly; should never be Array4/Array6"),
+        }
+    }
+
+    /// Update the union with a serialized sketch image
+    ///
+    /// Wraps `bytes` like [`HllSketch::wrap`] and merges them like
+    /// [`update_wrapped`](Self::update_wrapped), so no intermediate sketch is built. Compact and
+    /// updatable images of any target type are accepted.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `bytes` is not a valid HLL image; the union is left unchanged.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// # use datasketches::hll::HllUnion;
+    /// let mut sketch = HllSketch::new(12, HllType::Hll6);
+    /// sketch.extend(0..1000);
+    ///
+    /// let mut union = HllUnion::new(12);
+    /// union.update_bytes(&sketch.serialize()).unwrap();
+    /// assert_eq!(union.estimate(), sketch.estimate());
+    /// assert!(union.update_bytes(&[0; 4]).is_err());
+    /// ```
+    pub fn update_bytes(&mut self, bytes: &[u8]) -> Result<(), Error> {
+        self.update_wrapped(&HllSketch::wrap(bytes)?);
+        Ok(())
+    }
+
     /// Update union from a List or Set mode sketch
     fn update_from_list_or_set(
         &mut self,
@@ -242,7 +357,11 @@ impl HllUnion {
     /// Get the union result as a new sketch.
     ///
     /// Returns a copy of the internal gadget sketch with the specified target HLL type.
-    /// If the requested type differs from the gadget's type, conversion is performed.
+    /// If the requested type differs from the gadget's type, it is converted with
+    /// [`HllSketch::copy_as`].
+    ///
+    /// The type of the result is independent of the types of the inputs, and the choice only
+    /// affects its size: every type holds the same registers and yields the same estimate.
     ///
     /// # Arguments
     ///
@@ -259,34 +378,50 @@ impl HllUnion {
     /// assert!(result.estimate() >= 1.0);
     /// ```
     pub fn to_sketch(&self, hll_type: HllType) -> HllSketch {
-        let gadget_type = self.gadget.target_type();
-
-        if hll_type == gadget_type {
-            return self.gadget.clone();
-        }
+        self.gadget.copy_as(hll_type)
+    }
 
-        match self.gadget.mode() {
-            Mode::List { list, .. } => HllSketch::from_mode(
-                self.gadget.lg_config_k(),
-                Mode::List {
-                    list: list.clone(),
-                    hll_type,
-                },
-            ),
-            Mode::Set { set, .. } => HllSketch::from_mode(
-                self.gadget.lg_config_k(),
-                Mode::Set {
-                    set: set.clone(),
-                    hll_type,
-                },
-            ),
-            Mode::Array8(array8) => {
-                convert_array8_to_type(array8, self.gadget.lg_config_k(), hll_type)
-            }
-            Mode::Array4(_) | Mode::Array6(_) => {
-                unreachable!("gadget mode changed unexpectedly; should never be Array4/Array6")
+    /// Union a collection of serialized sketches in parallel.
+    ///
+    /// The images are merged in a tree reduction on the rayon thread pool: chunks of images
+    /// are wrapped and merged into partial unions, which are then merged pairwise. Both
+    /// compact and updatable images of any target type are accepted. The first image that
+    /// fails to parse is reported as an error.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::hll::HllSketch;
+    /// # use datasketches::hll::HllType;
+    /// # use datasketches::hll::HllUnion;
+    /// let images: Vec<Vec<u8>> = (0..100)
+    ///     .map(|p| {
+    ///         let mut sketch = HllSketch::new(10, HllType::Hll4);
+    ///         sketch.update(p);
+    ///         sketch.serialize()
+    ///     })
+    ///     .collect();
+    ///
+    /// let union = HllUnion::par_union_serialized(10, &images).unwrap();
+    /// assert_eq!(union.estimate().round(), 100.0);
+    /// ```
+    #[cfg(feature = "rayon")]
+    pub fn par_union_serialized<B>(lg_max_k: u8, images: &[B]) -> Result<Self, Error>
+    where
+        B: AsRef<[u8]> + Sync,
+    {
+        let leaf = |chunk: &[B]| {
+            let mut union = HllUnion::new(lg_max_k);
+            for image in chunk {
+                union.update_wrapped(&HllSketch::wrap(image.as_ref())?);
             }
-        }
+            Ok(union)
+        };
+        let combine = |mut left: HllUnion, right: HllUnion| {
+            left.update(&right.gadget);
+            Ok(left)
+        };
+        tree_reduce(images, &leaf, &combine)
     }
 
     /// Get the current lg_config_k of the internal gadget
@@ -304,6 +439,15 @@ impl HllUnion {
         self.gadget.is_empty()
     }
 
+    /// Returns the estimated size of the union in bytes
+    ///
+    /// The internal gadget is an Hll8 sketch once the union leaves coupon mode, so this exceeds
+    /// `HllSketch::max_estimated_size(lg_max_k, HllType::Hll8)` only by the few bytes the union
+    /// adds around its gadget.
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>() + self.gadget.heap_size()
+    }
+
     /// Reset the union to its initial empty state
     ///
     /// Clears all data from the internal gadget, allowing the union to be reused
@@ -514,53 +658,6 @@ fn merge_array_with_downsample(dst: &mut Array8, dst_lg_k: u8, src_mode: &Mode,
     }
 }
 
-/// Convert Array8 to a different HLL type
-///
-/// Creates a new sketch with the requested type by copying register values
-/// from the Array8 source. Preserves the HIP accumulator.
-fn convert_array8_to_type(src: &Array8, lg_config_k: u8, target_type: HllType) -> HllSketch {
-    match target_type {
-        HllType::Hll8 => HllSketch::from_mode(lg_config_k, Mode::Array8(src.clone())),
-        HllType::Hll6 => {
-            let mut array6 = Array6::new(lg_config_k);
-            for slot in 0..src.num_registers() {
-                let val = src.values()[slot];
-                if val > 0 {
-                    let clamped_val = val.min(63);
-                    let coupon = Coupon::pack(slot as u32, clamped_val);
-                    array6.update(coupon);
-                }
-            }
-
-            let src_est = src.estimate();
-            let arr6_est = array6.estimate();
-            if src_est > arr6_est {
-                array6.set_hip_accum(src_est);
-            }
-
-            HllSketch::from_mode(lg_config_k, Mode::Array6(array6))
-        }
-        HllType::Hll4 => {
-            let mut array4 = Array4::new(lg_config_k);
-            for slot in 0..src.num_registers() {
-                let val = src.values()[slot];
-                if val > 0 {
-                    let coupon = Coupon::pack(slot as u32, val);
-                    array4.update(coupon);
-                }
-            }
-
-            let src_est = src.estimate();
-            let arr4_est = array4.estimate();
-            if src_est > arr4_est {
-                array4.set_hip_accum(src_est);
-            }
-
-            HllSketch::from_mode(lg_config_k, Mode::Array4(array4))
-        }
-    }
-}
-
 /// Copy Array4/Array6 registers into Array8 by converting to coupons
 fn copy_array46_via_coupons(dst: &mut Array8, num_registers: usize, get_value: impl Fn(u32) -> u8) {
     for slot in 0..num_registers {
@@ -607,3 +704,68 @@ fn copy_or_downsample(src_mode: &Mode, src_lg_k: u8, tgt_lg_k: u8) -> Array8 {
         result
     }
 }
+
+/// Copy or downsample registers read through `get_value` into a new Array8
+///
+/// Counterpart of [`copy_or_downsample`] for sources that are not held as a [`Mode`].
+fn copy_or_downsample_registers(
+    num_registers: usize,
+    get_value: impl Fn(u32) -> u8,
+    src_hip: f64,
+    src_lg_k: u8,
+    tgt_lg_k: u8,
+) -> Array8 {
+    if src_lg_k <= tgt_lg_k {
+        let mut result = Array8::new(src_lg_k);
+        copy_array46_via_coupons(&mut result, num_registers, get_value);
+        result.set_hip_accum(src_hip);
+        result
+    } else {
+        let mut result = Array8::new(tgt_lg_k);
+        merge_array46_with_downsample(&mut result, tgt_lg_k, num_registers, get_value);
+        result
+    }
+}
+
+impl MergeableSketch<HllSketch> for HllUnion {
+    fn merge(&mut self, other: &HllSketch) -> Result<(), Error> {
+        self.update(other);
+        Ok(())
+    }
+}
+
+/// Unions the sketches into a sketch of the lg_k and target type of the first one, or returns
+/// an empty sketch with the defaults of [`HllSketchBuilder`] when there are none.
+impl Sum for HllSketch {
+    fn sum<I: Iterator<Item = Self>>(iter: I) -> Self {
+        union_all(iter)
+    }
+}
+
+/// Unions the sketches, as the `Sum<HllSketch>` impl does.
+impl<'a> Sum<&'a HllSketch> for HllSketch {
+    fn sum<I: Iterator<Item = &'a Self>>(iter: I) -> Self {
+        union_all(iter)
+    }
+}
+
+fn union_all<S: Borrow<HllSketch>>(mut sketches: impl Iterator<Item = S>) -> HllSketch {
+    let Some(first) = sketches.next() else {
+        return HllSketchBuilder::default().build();
+    };
+    let first = first.borrow();
+    let mut union = HllUnion::new(first.lg_config_k());
+    union.update(first);
+    for sketch in sketches {
+        union.update(sketch.borrow());
+    }
+    union.to_sketch(first.target_type())
+}
+
+/// Merges the image in place through [`HllSketch::wrap`], without deserializing it.
+#[cfg(feature = "aggregator")]
+impl ImageUnion for HllUnion {
+    fn update_image(&mut self, image: &[u8]) -> Result<(), Error> {
+        self.update_bytes(image)
+    }
+}
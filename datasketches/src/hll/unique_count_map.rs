@@ -0,0 +1,639 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Approximate distinct counts for a large number of keys
+//!
+//! This is a port of the `UniqueCountMap` of the Java implementation. Most keys of a typical
+//! data set see only a handful of distinct items, so storing a full HLL sketch per key wastes
+//! most of its memory. Instead every key starts with a single 16-bit coupon in the base map
+//! and moves up through maps of increasing capacity as its count grows:
+//!
+//! * level 0 holds one coupon per key;
+//! * levels 1 to 3 hold up to 2, 4 and 8 coupons per key and are searched linearly;
+//! * levels 4 to 9 hold 16 to 512 coupon slots per key as small hash tables;
+//! * the last level holds an HLL array of 1024 registers per key.
+//!
+//! A coupon packs a 10-bit register index with a 6-bit register value, so the coupon maps are
+//! sparse forms of the 1024 HLL registers. Each key above level 0 keeps a HIP estimator,
+//! carried along as it is promoted, which gives the estimate of every level.
+
+use std::hash::Hash;
+
+use crate::hash::DEFAULT_UPDATE_SEED;
+use crate::hash::murmurhash3_x64_128;
+use crate::hll::Coupon;
+
+/// log2 of the number of HLL registers per key
+const HLL_LG_K: u8 = 10;
+const HLL_K: usize = 1 << HLL_LG_K;
+const SLOT_MASK: u16 = (1 << HLL_LG_K) - 1;
+/// The level holding HLL arrays
+const HLL_LEVEL: u8 = 10;
+/// HLL registers take a byte each, packed two to a block value
+const HLL_BLOCK: usize = HLL_K / 2;
+/// The highest level whose coupons are searched linearly
+const MAX_TRAVERSE_LEVEL: u8 = 3;
+/// log2 of the number of keys the maps are created with
+const LG_INITIAL_KEYS: u8 = 4;
+
+const EMPTY: u8 = 0;
+const OCCUPIED: u8 = 1;
+const DELETED: u8 = 2;
+
+/// Approximate distinct counts for many keys with memory that grows with each key's count.
+///
+/// Keys are byte strings of a fixed length given at construction. Items are hashed like
+/// [`HllSketch::update`](crate::hll::HllSketch::update). A key that saw a single distinct item
+/// costs the key bytes plus three bytes; keys with large counts end up with an HLL array of
+/// 1024 registers, for a relative standard error of about 2.6%.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hll::UniqueCountMap;
+/// let mut map = UniqueCountMap::new(4);
+/// for user in 0..1000u32 {
+///     map.update(b"home", user);
+///     map.update(b"shop", user % 3);
+/// }
+/// assert!((map.estimate(b"shop") - 3.0).abs() < 0.01);
+/// assert!((map.estimate(b"home") - 1000.0).abs() < 100.0);
+/// assert_eq!(map.estimate(b"none"), 0.0);
+/// ```
+#[derive(Debug, Clone)]
+pub struct UniqueCountMap {
+    key_size: usize,
+    /// level 0: a coupon, or the level of the key if it has been promoted
+    base: KeyTable,
+    base_values: Vec<u16>,
+    /// levels 1 to 10, created on first use
+    tiers: Vec<Option<Tier>>,
+}
+
+impl UniqueCountMap {
+    /// Creates an empty map for keys of `key_size` bytes.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `key_size` is zero.
+    pub fn new(key_size: usize) -> Self {
+        assert!(key_size > 0, "key size must be positive");
+        UniqueCountMap {
+            key_size,
+            base: KeyTable::new(key_size, LG_INITIAL_KEYS),
+            base_values: vec![0; 1 << LG_INITIAL_KEYS],
+            tiers: vec![None; HLL_LEVEL as usize],
+        }
+    }
+
+    /// Returns the size of the keys in bytes.
+    pub fn key_size(&self) -> usize {
+        self.key_size
+    }
+
+    /// Returns the number of keys in the map.
+    pub fn num_keys(&self) -> usize {
+        self.base.num_active
+    }
+
+    /// Returns true if no key has been updated.
+    pub fn is_empty(&self) -> bool {
+        self.num_keys() == 0
+    }
+
+    /// Updates the distinct count of `key` with `item` and returns the new estimate.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `key` is not [`key_size`](Self::key_size) bytes long.
+    pub fn update<T: Hash>(&mut self, key: &[u8], item: T) -> f64 {
+        self.check_key(key);
+        let coupon = coupon16(Coupon::from_hash(item));
+
+        if self.base.needs_rebuild() {
+            let (base, moves) = self.base.rebuilt();
+            let mut values = vec![0; base.capacity()];
+            for (from, to) in moves {
+                values[to] = self.base_values[from];
+            }
+            self.base = base;
+            self.base_values = values;
+        }
+        let index = match self.base.find(key) {
+            Ok(index) => index,
+            Err(index) => {
+                self.base.insert_at(index, key);
+                self.base_values[index] = coupon;
+                return 1.0;
+            }
+        };
+
+        let value = self.base_values[index];
+        let level = level_of(value);
+        if level == 0 {
+            if value == coupon {
+                return 1.0;
+            }
+            // promote the single coupon to the first coupon map
+            let mut hip = Hip::default();
+            hip.update(0, coupon_value(value));
+            let tier = self.tier(1);
+            let slot = tier.insert(key, hip);
+            tier.set_coupons(slot, &[value]);
+            self.base_values[index] = 1;
+            return self.update_tier(key, index, 1, slot, coupon);
+        }
+
+        let tier = self.tiers[level as usize - 1]
+            .as_mut()
+            .expect("promoted keys have a map");
+        let slot = tier
+            .table
+            .find(key)
+            .expect("promoted keys are in their map");
+        self.update_tier(key, index, level, slot, coupon)
+    }
+
+    /// Returns the estimated number of distinct items of `key`, or 0 if the key is absent.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `key` is not [`key_size`](Self::key_size) bytes long.
+    pub fn estimate(&self, key: &[u8]) -> f64 {
+        self.check_key(key);
+        let Ok(index) = self.base.find(key) else {
+            return 0.0;
+        };
+        let level = level_of(self.base_values[index]);
+        if level == 0 {
+            return 1.0;
+        }
+        let tier = self.tiers[level as usize - 1]
+            .as_ref()
+            .expect("promoted keys have a map");
+        let slot = tier
+            .table
+            .find(key)
+            .expect("promoted keys are in their map");
+        tier.hip[slot].estimate
+    }
+
+    /// Returns the number of bytes allocated by the map.
+    pub fn memory_usage_bytes(&self) -> usize {
+        let base = self.base.memory_usage_bytes() + self.base_values.len() * 2;
+        let tiers: usize = self
+            .tiers
+            .iter()
+            .flatten()
+            .map(Tier::memory_usage_bytes)
+            .sum();
+        base + tiers
+    }
+
+    /// Removes all keys.
+    pub fn reset(&mut self) {
+        *self = UniqueCountMap::new(self.key_size);
+    }
+
+    fn check_key(&self, key: &[u8]) {
+        assert_eq!(
+            key.len(),
+            self.key_size,
+            "key must be {} bytes long, got {}",
+            self.key_size,
+            key.len()
+        );
+    }
+
+    fn tier(&mut self, level: u8) -> &mut Tier {
+        let key_size = self.key_size;
+        self.tiers[level as usize - 1].get_or_insert_with(|| Tier::new(key_size, level))
+    }
+
+    /// Applies `coupon` to the entry at `slot` of the map at `level`, promoting the entry while
+    /// its map is full, and returns the new estimate.
+    fn update_tier(
+        &mut self,
+        key: &[u8],
+        base_index: usize,
+        mut level: u8,
+        mut slot: usize,
+        coupon: u16,
+    ) -> f64 {
+        loop {
+            let tier = self.tiers[level as usize - 1]
+                .as_mut()
+                .expect("promoted keys have a map");
+            if let Some(estimate) = tier.update(slot, coupon) {
+                return estimate;
+            }
+            let (coupons, hip) = tier.remove(slot);
+            level += 1;
+            let next = self.tier(level);
+            slot = next.insert(key, hip);
+            next.set_coupons(slot, &coupons);
+            self.base_values[base_index] = level as u16;
+        }
+    }
+}
+
+/// Packs a coupon into a 10-bit register index and a 6-bit register value.
+fn coupon16(coupon: Coupon) -> u16 {
+    ((coupon.value() as u16) << HLL_LG_K) | (coupon.slot() as u16 & SLOT_MASK)
+}
+
+fn coupon_slot(coupon: u16) -> usize {
+    (coupon & SLOT_MASK) as usize
+}
+
+fn coupon_value(coupon: u16) -> u8 {
+    (coupon >> HLL_LG_K) as u8
+}
+
+/// Returns the level recorded in a base map value, which is 0 for a coupon.
+///
+/// Coupon values are at least 1, so a value without register value bits is a level.
+fn level_of(value: u16) -> u8 {
+    if coupon_value(value) == 0 {
+        value as u8
+    } else {
+        0
+    }
+}
+
+/// HIP estimator over the 1024 virtual registers of one key.
+#[derive(Debug, Clone, Copy)]
+struct Hip {
+    estimate: f64,
+    /// sum of 2^-register over all registers
+    kxq: f64,
+}
+
+impl Default for Hip {
+    fn default() -> Self {
+        Hip {
+            estimate: 0.0,
+            kxq: HLL_K as f64,
+        }
+    }
+}
+
+impl Hip {
+    fn update(&mut self, old_value: u8, new_value: u8) {
+        self.estimate += HLL_K as f64 / self.kxq;
+        self.kxq -= inv_pow2(old_value) - inv_pow2(new_value);
+    }
+}
+
+fn inv_pow2(value: u8) -> f64 {
+    f64::from_bits((1023 - value as u64) << 52)
+}
+
+/// One level above the base map: a key table with a block of coupons or registers per key.
+#[derive(Debug, Clone)]
+struct Tier {
+    level: u8,
+    table: KeyTable,
+    /// coupons of level 1 to 9, or pairs of registers of the HLL level, `block` per key
+    values: Vec<u16>,
+    block: usize,
+    counts: Vec<u16>,
+    hip: Vec<Hip>,
+}
+
+impl Tier {
+    fn new(key_size: usize, level: u8) -> Self {
+        let table = KeyTable::new(key_size, LG_INITIAL_KEYS);
+        let block = if level == HLL_LEVEL {
+            HLL_BLOCK
+        } else {
+            1 << level
+        };
+        let capacity = table.capacity();
+        Tier {
+            level,
+            table,
+            values: vec![0; capacity * block],
+            block,
+            counts: vec![0; capacity],
+            hip: vec![Hip::default(); capacity],
+        }
+    }
+
+    fn memory_usage_bytes(&self) -> usize {
+        self.table.memory_usage_bytes()
+            + self.values.len() * 2
+            + self.counts.len() * 2
+            + self.hip.len() * size_of::<Hip>()
+    }
+
+    /// Inserts a key that is not in this map yet and returns its slot.
+    fn insert(&mut self, key: &[u8], hip: Hip) -> usize {
+        if self.table.needs_rebuild() {
+            let (table, moves) = self.table.rebuilt();
+            let capacity = table.capacity();
+            let mut values = vec![0; capacity * self.block];
+            let mut counts = vec![0; capacity];
+            let mut hips = vec![Hip::default(); capacity];
+            for (from, to) in moves {
+                values[to * self.block..(to + 1) * self.block]
+                    .copy_from_slice(self.block_values(from));
+                counts[to] = self.counts[from];
+                hips[to] = self.hip[from];
+            }
+            self.table = table;
+            self.values = values;
+            self.counts = counts;
+            self.hip = hips;
+        }
+        let slot = self
+            .table
+            .find(key)
+            .expect_err("promoted keys are not in the next map yet");
+        self.table.insert_at(slot, key);
+        self.hip[slot] = hip;
+        slot
+    }
+
+    /// Fills the block of a freshly inserted entry with coupons that fit without promotion.
+    fn set_coupons(&mut self, slot: usize, coupons: &[u16]) {
+        for &coupon in coupons {
+            if self.level == HLL_LEVEL {
+                self.set_register(slot, coupon_slot(coupon), coupon_value(coupon));
+            } else {
+                let Probe::Vacant(position) = self.find_coupon(slot, coupon) else {
+                    unreachable!("registers of a key are distinct and fit the block");
+                };
+                self.values[slot * self.block + position] = coupon;
+            }
+        }
+        self.counts[slot] = coupons.len() as u16;
+    }
+
+    /// Applies a coupon and returns the new estimate, or `None` if the entry must be promoted.
+    fn update(&mut self, slot: usize, coupon: u16) -> Option<f64> {
+        let value = coupon_value(coupon);
+        if self.level == HLL_LEVEL {
+            let register = self.register(slot, coupon_slot(coupon));
+            if value > register {
+                self.hip[slot].update(register, value);
+                self.set_register(slot, coupon_slot(coupon), value);
+            }
+            return Some(self.hip[slot].estimate);
+        }
+
+        match self.find_coupon(slot, coupon) {
+            Probe::Found(position) => {
+                let stored = &mut self.values[slot * self.block + position];
+                let stored_value = coupon_value(*stored);
+                if value > stored_value {
+                    self.hip[slot].update(stored_value, value);
+                    *stored = coupon;
+                }
+            }
+            Probe::Vacant(position) => {
+                if self.counts[slot] as usize >= self.max_count() {
+                    return None;
+                }
+                self.hip[slot].update(0, value);
+                self.values[slot * self.block + position] = coupon;
+                self.counts[slot] += 1;
+            }
+            Probe::Full => return None,
+        }
+        Some(self.hip[slot].estimate)
+    }
+
+    /// The number of registers an entry holds before it is promoted: all of a linear block,
+    /// three quarters of a hashed one.
+    fn max_count(&self) -> usize {
+        if self.level <= MAX_TRAVERSE_LEVEL {
+            self.block
+        } else {
+            self.block / 4 * 3
+        }
+    }
+
+    /// Finds the position of the coupon with the register index of `coupon` in the block of
+    /// `slot`, or the empty position where it belongs.
+    fn find_coupon(&self, slot: usize, coupon: u16) -> Probe {
+        let block = self.block_values(slot);
+        let register = coupon_slot(coupon);
+        let mask = self.block - 1;
+        // linear blocks are searched from the start, hashed ones from the register index
+        let start = if self.level <= MAX_TRAVERSE_LEVEL {
+            0
+        } else {
+            register & mask
+        };
+        for i in 0..self.block {
+            let position = (start + i) & mask;
+            let stored = block[position];
+            if stored == 0 {
+                return Probe::Vacant(position);
+            }
+            if coupon_slot(stored) == register {
+                return Probe::Found(position);
+            }
+        }
+        Probe::Full
+    }
+
+    /// Removes an entry and returns its registers as coupons together with its estimator.
+    fn remove(&mut self, slot: usize) -> (Vec<u16>, Hip) {
+        let range = slot * self.block..(slot + 1) * self.block;
+        let coupons = self.values[range.clone()]
+            .iter()
+            .copied()
+            .filter(|&coupon| coupon != 0)
+            .collect();
+        self.values[range].fill(0);
+        self.counts[slot] = 0;
+        self.table.delete(slot);
+        (coupons, self.hip[slot])
+    }
+
+    fn block_values(&self, slot: usize) -> &[u16] {
+        &self.values[slot * self.block..(slot + 1) * self.block]
+    }
+
+    fn register(&self, slot: usize, register: usize) -> u8 {
+        let pair = self.values[slot * HLL_BLOCK + register / 2];
+        (pair >> (8 * (register % 2))) as u8
+    }
+
+    fn set_register(&mut self, slot: usize, register: usize, value: u8) {
+        let pair = &mut self.values[slot * HLL_BLOCK + register / 2];
+        let shift = 8 * (register % 2);
+        *pair = (*pair & !(0xff << shift)) | ((value as u16) << shift);
+    }
+}
+
+/// The outcome of searching a block for a register.
+enum Probe {
+    Found(usize),
+    Vacant(usize),
+    Full,
+}
+
+/// An open addressing table of fixed-size keys with linear probing.
+#[derive(Debug, Clone)]
+struct KeyTable {
+    key_size: usize,
+    lg_capacity: u8,
+    keys: Vec<u8>,
+    states: Vec<u8>,
+    num_active: usize,
+    num_deleted: usize,
+}
+
+impl KeyTable {
+    fn new(key_size: usize, lg_capacity: u8) -> Self {
+        let capacity = 1 << lg_capacity;
+        KeyTable {
+            key_size,
+            lg_capacity,
+            keys: vec![0; capacity * key_size],
+            states: vec![EMPTY; capacity],
+            num_active: 0,
+            num_deleted: 0,
+        }
+    }
+
+    fn capacity(&self) -> usize {
+        1 << self.lg_capacity
+    }
+
+    fn memory_usage_bytes(&self) -> usize {
+        self.keys.len() + self.states.len()
+    }
+
+    fn key(&self, index: usize) -> &[u8] {
+        &self.keys[index * self.key_size..(index + 1) * self.key_size]
+    }
+
+    /// Returns the index of `key`, or the index where it should be inserted.
+    fn find(&self, key: &[u8]) -> Result<usize, usize> {
+        let mask = self.capacity() - 1;
+        let (hash, _) = murmurhash3_x64_128(key, DEFAULT_UPDATE_SEED);
+        let mut index = hash as usize & mask;
+        let mut first_deleted = None;
+        loop {
+            match self.states[index] {
+                EMPTY => return Err(first_deleted.unwrap_or(index)),
+                OCCUPIED if self.key(index) == key => return Ok(index),
+                DELETED if first_deleted.is_none() => first_deleted = Some(index),
+                _ => {}
+            }
+            index = (index + 1) & mask;
+        }
+    }
+
+    fn insert_at(&mut self, index: usize, key: &[u8]) {
+        if self.states[index] == DELETED {
+            self.num_deleted -= 1;
+        }
+        self.states[index] = OCCUPIED;
+        self.keys[index * self.key_size..(index + 1) * self.key_size].copy_from_slice(key);
+        self.num_active += 1;
+    }
+
+    fn delete(&mut self, index: usize) {
+        self.states[index] = DELETED;
+        self.num_active -= 1;
+        self.num_deleted += 1;
+    }
+
+    /// Whether inserting one more key would exceed a load factor of 3/4.
+    fn needs_rebuild(&self) -> bool {
+        (self.num_active + self.num_deleted + 1) * 4 > self.capacity() * 3
+    }
+
+    /// Returns a table holding the active keys without tombstones, grown if they fill more
+    /// than half of this one, with the moves from old to new indexes.
+    fn rebuilt(&self) -> (KeyTable, Vec<(usize, usize)>) {
+        let lg_capacity = if self.num_active * 2 >= self.capacity() {
+            self.lg_capacity + 1
+        } else {
+            self.lg_capacity
+        };
+        let mut table = KeyTable::new(self.key_size, lg_capacity);
+        let mut moves = Vec::with_capacity(self.num_active);
+        for index in 0..self.capacity() {
+            if self.states[index] == OCCUPIED {
+                let key = self.key(index);
+                let to = table.find(key).expect_err("keys are unique");
+                table.insert_at(to, key);
+                moves.push((index, to));
+            }
+        }
+        (table, moves)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_coupon16() {
+        let coupon = coupon16(Coupon::from_hash("apple"));
+        assert!(coupon_value(coupon) >= 1);
+        assert_eq!(level_of(coupon), 0);
+        for level in 1..=HLL_LEVEL {
+            assert_eq!(level_of(level as u16), level);
+        }
+    }
+
+    #[test]
+    fn test_promotion_through_all_levels() {
+        let mut map = UniqueCountMap::new(1);
+        let mut previous_level = 0;
+        for i in 0..10_000 {
+            map.update(b"k", i);
+            let index = map.base.find(b"k").unwrap();
+            let level = level_of(map.base_values[index]);
+            assert!(level >= previous_level);
+            previous_level = level;
+        }
+        assert_eq!(previous_level, HLL_LEVEL);
+        // promoted keys leave the lower maps
+        for tier in map.tiers[..HLL_LEVEL as usize - 1].iter().flatten() {
+            assert_eq!(tier.table.num_active, 0);
+        }
+    }
+
+    #[test]
+    fn test_key_table_rebuild_drops_tombstones() {
+        let mut table = KeyTable::new(2, 3);
+        for i in 0..6u16 {
+            let index = table.find(&i.to_le_bytes()).unwrap_err();
+            table.insert_at(index, &i.to_le_bytes());
+        }
+        for i in 0..5u16 {
+            let index = table.find(&i.to_le_bytes()).unwrap();
+            table.delete(index);
+        }
+        assert!(table.needs_rebuild());
+        let (table, moves) = table.rebuilt();
+        assert_eq!(table.capacity(), 8);
+        assert_eq!(table.num_deleted, 0);
+        assert_eq!(moves.len(), 1);
+        assert!(table.find(&5u16.to_le_bytes()).is_ok());
+        assert!(table.find(&0u16.to_le_bytes()).is_err());
+    }
+}
@@ -0,0 +1,121 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::sync::RwLock;
+
+use crate::codec::family::Family;
+use crate::error::Error;
+use crate::hll::HllSketch;
+use crate::hll::serialization::SERIAL_VERSION;
+
+/// Reads an HLL image of a serial version this library does not read natively.
+///
+/// It is given the whole image, preamble included, and typically rewrites it into the current
+/// format before calling [`HllSketch::deserialize`].
+pub type VersionReader = fn(bytes: &[u8]) -> Result<HllSketch, Error>;
+
+static READERS: RwLock<Vec<(u8, VersionReader)>> = RwLock::new(Vec::new());
+
+/// Installs `reader` for the HLL images of `serial_version`.
+///
+/// From then on, [`HllSketch::deserialize`] hands the images of that version to `reader`
+/// instead of rejecting them, so that a process can keep reading the images of a newer, or a
+/// retired, format while its fleet is upgraded. Only [`HllSketch::deserialize`] consults the
+/// readers; the streaming, wrapping and in-place readers work on the current format only.
+///
+/// # Errors
+///
+/// Returns an error if `serial_version` is the one read natively, or if a reader is already
+/// installed for it; each version can only be registered once.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::error::Error;
+/// # use datasketches::hll::HllSketch;
+/// # use datasketches::hll::HllType;
+/// # use datasketches::hll::register_version_reader;
+/// // a hypothetical version 9 that only differs in its version byte
+/// fn read_v9(bytes: &[u8]) -> Result<HllSketch, Error> {
+///     let mut bytes = bytes.to_vec();
+///     bytes[1] = 1;
+///     HllSketch::deserialize(&bytes)
+/// }
+/// register_version_reader(9, read_v9).unwrap();
+///
+/// let mut sketch = HllSketch::new(12, HllType::Hll8);
+/// sketch.update("apple");
+/// let mut bytes = sketch.serialize();
+/// bytes[1] = 9;
+/// assert_eq!(HllSketch::deserialize(&bytes).unwrap(), sketch);
+/// ```
+pub fn register_version_reader(serial_version: u8, reader: VersionReader) -> Result<(), Error> {
+    if serial_version == SERIAL_VERSION {
+        return Err(Error::invalid_argument(format!(
+            "HLL serial version {serial_version} is read natively"
+        )));
+    }
+
+    let mut readers = READERS.write().unwrap_or_else(|e| e.into_inner());
+    if readers
+        .iter()
+        .any(|&(version, _)| version == serial_version)
+    {
+        return Err(Error::invalid_argument(format!(
+            "a reader for HLL serial version {serial_version} is already installed"
+        )));
+    }
+    readers.push((serial_version, reader));
+    Ok(())
+}
+
+/// Returns the HLL serial versions [`HllSketch::deserialize`] reads, in ascending order.
+///
+/// These are the version read natively and those with a reader installed by
+/// [`register_version_reader`].
+pub fn supported_versions() -> Vec<u8> {
+    let readers = READERS.read().unwrap_or_else(|e| e.into_inner());
+    let mut versions: Vec<u8> = readers.iter().map(|&(version, _)| version).collect();
+    versions.push(SERIAL_VERSION);
+    versions.sort_unstable();
+    versions
+}
+
+/// Returns the reader installed for the serial version of the HLL image `bytes`, if the
+/// version is not read natively and has one.
+pub(super) fn reader_for(bytes: &[u8]) -> Option<VersionReader> {
+    match *bytes {
+        [_, serial_version, family_id, ..]
+            if family_id == Family::HLL.id && serial_version != SERIAL_VERSION =>
+        {
+            let readers = READERS.read().unwrap_or_else(|e| e.into_inner());
+            readers
+                .iter()
+                .find(|&&(version, _)| version == serial_version)
+                .map(|&(_, reader)| reader)
+        }
+        _ => None,
+    }
+}
+
+/// Returns the error for an HLL image of `serial_version`, which no reader reads.
+pub(super) fn unsupported(serial_version: u8) -> Error {
+    let versions = supported_versions();
+    let newest = versions.last().copied().unwrap_or(SERIAL_VERSION);
+    Error::unsupported_serial_version(newest, serial_version)
+        .with_context("supported", format!("{versions:?}"))
+}
@@ -0,0 +1,405 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! A read-only view over a serialized HLL sketch
+//!
+//! [`HllWrapper`] reads the preamble of a compact or updatable image and answers estimate
+//! queries directly from the borrowed bytes. Register values and coupons are decoded on
+//! demand, so wrapping a sketch never allocates.
+
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_lg_k_in;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+use crate::codec::family::Family;
+use crate::common::NumStdDev;
+use crate::error::Error;
+use crate::error::SketchError;
+use crate::hll::Coupon;
+use crate::hll::HllType;
+use crate::hll::array4;
+use crate::hll::array4::AUX_TOKEN;
+use crate::hll::array6;
+use crate::hll::array8;
+use crate::hll::container::coupon_estimate;
+use crate::hll::container::coupon_lower_bound;
+use crate::hll::container::coupon_upper_bound;
+use crate::hll::estimator::HipEstimator;
+use crate::hll::serialization::COMPACT_FLAG_MASK;
+use crate::hll::serialization::COUPON_SIZE_BYTES;
+use crate::hll::serialization::CUR_MODE_HLL;
+use crate::hll::serialization::CUR_MODE_LIST;
+use crate::hll::serialization::CUR_MODE_SET;
+use crate::hll::serialization::EMPTY_FLAG_MASK;
+use crate::hll::serialization::HASH_SET_PREINTS;
+use crate::hll::serialization::HLL_PREAMBLE_SIZE;
+use crate::hll::serialization::HLL_PREINTS;
+use crate::hll::serialization::LIST_PREAMBLE_SIZE;
+use crate::hll::serialization::LIST_PREINTS;
+use crate::hll::serialization::OUT_OF_ORDER_FLAG_MASK;
+use crate::hll::serialization::SERIAL_VERSION;
+use crate::hll::serialization::SET_PREAMBLE_SIZE;
+use crate::hll::serialization::TGT_HLL4;
+use crate::hll::serialization::TGT_HLL6;
+use crate::hll::serialization::TGT_HLL8;
+use crate::hll::serialization::check_hll_header;
+use crate::hll::serialization::extract_cur_mode;
+use crate::hll::serialization::extract_tgt_hll_type;
+
+/// Largest coupon table size accepted in a serialized List or Set image
+const MAX_LG_ARR: u8 = 26;
+
+/// A read-only view of a serialized image of an [`HllSketch`](super::HllSketch).
+///
+/// The wrapper borrows the image and never copies it, which makes it suitable for scanning a
+/// large number of stored sketches. Both the compact and the updatable formats are accepted.
+/// A wrapped sketch can be queried for its estimate and bounds, and merged into an
+/// [`HllUnion`](super::HllUnion) with [`update_wrapped`](super::HllUnion::update_wrapped).
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::hll::HllSketch;
+/// # use datasketches::hll::HllType;
+/// let mut sketch = HllSketch::new(12, HllType::Hll4);
+/// for i in 0..1000 {
+///     sketch.update(i);
+/// }
+/// let bytes = sketch.serialize();
+///
+/// let wrapped = HllSketch::wrap(&bytes).unwrap();
+/// assert_eq!(wrapped.estimate(), sketch.estimate());
+/// ```
+#[derive(Debug, Clone)]
+pub struct HllWrapper<'a> {
+    lg_config_k: u8,
+    hll_type: HllType,
+    image: Image<'a>,
+}
+
+#[derive(Debug, Clone)]
+enum Image<'a> {
+    /// List or Set mode: `len` coupons stored in `data`, possibly among empty entries
+    Coupons { len: usize, data: &'a [u8] },
+    /// HLL mode: packed registers in `data` followed by HLL4 exceptions in `aux`
+    Array {
+        cur_min: u8,
+        num_at_cur_min: u32,
+        estimator: HipEstimator,
+        data: &'a [u8],
+        aux: &'a [u8],
+    },
+}
+
+impl<'a> HllWrapper<'a> {
+    /// Creates a new `HllWrapper` from the given byte slice without copying bytes.
+    ///
+    /// The preamble is validated and the slice is checked to be long enough for the data it
+    /// declares. The coupon contents are not inspected; the registers of an HLL mode image are
+    /// scanned once to check that they hold register values.
+    pub fn new(bytes: &'a [u8]) -> Result<Self, Error> {
+        let mut cursor = SketchSlice::new(bytes);
+        let preamble_ints = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_ints"))?;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let lg_config_k = cursor.read_u8().map_err(insufficient_data("lg_config_k"))?;
+        let lg_arr = cursor.read_u8().map_err(insufficient_data("lg_arr"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let state = cursor.read_u8().map_err(insufficient_data("state"))?;
+        let mode_byte = cursor.read_u8().map_err(insufficient_data("mode"))?;
+
+        Family::HLL.validate_id(family_id)?;
+        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        ensure_lg_k_in(4, 21, lg_config_k)?;
+
+        let hll_type = match extract_tgt_hll_type(mode_byte) {
+            TGT_HLL4 => HllType::Hll4,
+            TGT_HLL6 => HllType::Hll6,
+            TGT_HLL8 => HllType::Hll8,
+            hll_type => {
+                return Err(Error::deserial(format!("invalid HLL type: {hll_type}")));
+            }
+        };
+
+        let empty = (flags & EMPTY_FLAG_MASK) != 0;
+        let compact = (flags & COMPACT_FLAG_MASK) != 0;
+        let ooo = (flags & OUT_OF_ORDER_FLAG_MASK) != 0;
+
+        let image = match extract_cur_mode(mode_byte) {
+            CUR_MODE_LIST => {
+                if preamble_ints != LIST_PREINTS {
+                    return Err(Error::deserial(format!(
+                        "LIST mode preamble: expected {}, got {}",
+                        LIST_PREINTS, preamble_ints,
+                    ))
+                    .with_reason(SketchError::InvalidPreamble {
+                        actual: preamble_ints,
+                    }));
+                }
+                let len = if empty { 0 } else { state as usize };
+                let num_entries = if compact || len == 0 {
+                    len
+                } else {
+                    table_size(lg_arr)?
+                };
+                check_coupon_count(len, num_entries, lg_config_k)?;
+                let data = slice_at(bytes, LIST_PREAMBLE_SIZE, num_entries * COUPON_SIZE_BYTES)?;
+                Image::Coupons { len, data }
+            }
+            CUR_MODE_SET => {
+                if preamble_ints != HASH_SET_PREINTS {
+                    return Err(Error::deserial(format!(
+                        "SET mode preamble: expected {}, got {}",
+                        HASH_SET_PREINTS, preamble_ints
+                    ))
+                    .with_reason(SketchError::InvalidPreamble {
+                        actual: preamble_ints,
+                    }));
+                }
+                let len = cursor
+                    .read_u32_le()
+                    .map_err(insufficient_data("coupon_count"))? as usize;
+                let num_entries = if compact { len } else { table_size(lg_arr)? };
+                check_coupon_count(len, num_entries, lg_config_k)?;
+                let data = slice_at(bytes, SET_PREAMBLE_SIZE, num_entries * COUPON_SIZE_BYTES)?;
+                Image::Coupons { len, data }
+            }
+            CUR_MODE_HLL => {
+                if preamble_ints != HLL_PREINTS {
+                    return Err(Error::deserial(format!(
+                        "HLL mode preamble: expected {}, got {}",
+                        HLL_PREINTS, preamble_ints
+                    ))
+                    .with_reason(SketchError::InvalidPreamble {
+                        actual: preamble_ints,
+                    }));
+                }
+                let hip_accum = cursor
+                    .read_f64_le()
+                    .map_err(insufficient_data("hip_accum"))?;
+                let kxq0 = cursor.read_f64_le().map_err(insufficient_data("kxq0"))?;
+                let kxq1 = cursor.read_f64_le().map_err(insufficient_data("kxq1"))?;
+                let num_at_cur_min = cursor
+                    .read_u32_le()
+                    .map_err(insufficient_data("num_at_cur_min"))?;
+                let aux_count = cursor
+                    .read_u32_le()
+                    .map_err(insufficient_data("aux_count"))?;
+
+                let k = 1u32 << lg_config_k;
+                let (cur_min, num_bytes) = match hll_type {
+                    HllType::Hll4 => (state, k as usize / 2),
+                    HllType::Hll6 => (0, array6::num_bytes_for_k(k)),
+                    HllType::Hll8 => (0, k as usize),
+                };
+                check_hll_header(lg_config_k, cur_min, num_at_cur_min)?;
+                let data = slice_at(bytes, HLL_PREAMBLE_SIZE, num_bytes)?;
+                // registers are decoded on demand, so values that would overflow the estimator
+                // or a union are rejected up front
+                match hll_type {
+                    HllType::Hll4 => array4::check_packed_values(data, cur_min)?,
+                    HllType::Hll6 => {}
+                    HllType::Hll8 => array8::check_values(data)?,
+                }
+                let num_aux_entries = match hll_type {
+                    HllType::Hll4 if aux_count > 0 && compact => aux_count as usize,
+                    HllType::Hll4 if aux_count > 0 => table_size(lg_arr)?,
+                    _ => 0,
+                };
+                let aux = slice_at(
+                    bytes,
+                    HLL_PREAMBLE_SIZE + num_bytes,
+                    num_aux_entries * COUPON_SIZE_BYTES,
+                )?;
+
+                let mut estimator = HipEstimator::new(lg_config_k);
+                estimator.set_hip_accum(hip_accum);
+                estimator.set_kxq0(kxq0);
+                estimator.set_kxq1(kxq1);
+                estimator.set_out_of_order(ooo);
+
+                Image::Array {
+                    cur_min,
+                    num_at_cur_min,
+                    estimator,
+                    data,
+                    aux,
+                }
+            }
+            mode => return Err(Error::deserial(format!("invalid mode: {mode}"))),
+        };
+
+        Ok(HllWrapper {
+            lg_config_k,
+            hll_type,
+            image,
+        })
+    }
+
+    /// Returns the configured lg_k of the wrapped sketch
+    pub fn lg_config_k(&self) -> u8 {
+        self.lg_config_k
+    }
+
+    /// Returns the target HLL type of the wrapped sketch
+    pub fn target_type(&self) -> HllType {
+        self.hll_type
+    }
+
+    /// Returns true if the wrapped sketch is empty
+    pub fn is_empty(&self) -> bool {
+        match &self.image {
+            Image::Coupons { len, .. } => *len == 0,
+            Image::Array {
+                cur_min,
+                num_at_cur_min,
+                ..
+            } => *cur_min == 0 && *num_at_cur_min == 1 << self.lg_config_k,
+        }
+    }
+
+    /// Returns the cardinality estimate of the wrapped sketch
+    pub fn estimate(&self) -> f64 {
+        match &self.image {
+            Image::Coupons { len, .. } => coupon_estimate(*len),
+            Image::Array {
+                cur_min,
+                num_at_cur_min,
+                estimator,
+                ..
+            } => estimator.estimate(self.lg_config_k, *cur_min, *num_at_cur_min),
+        }
+    }
+
+    /// Returns the upper bound of the cardinality estimate given `num_std_dev`
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        match &self.image {
+            Image::Coupons { len, .. } => coupon_upper_bound(*len, num_std_dev),
+            Image::Array {
+                cur_min,
+                num_at_cur_min,
+                estimator,
+                ..
+            } => estimator.upper_bound(self.lg_config_k, *cur_min, *num_at_cur_min, num_std_dev),
+        }
+    }
+
+    /// Returns the lower bound of the cardinality estimate given `num_std_dev`
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        match &self.image {
+            Image::Coupons { len, .. } => coupon_lower_bound(*len, num_std_dev),
+            Image::Array {
+                cur_min,
+                num_at_cur_min,
+                estimator,
+                ..
+            } => estimator.lower_bound(self.lg_config_k, *cur_min, *num_at_cur_min, num_std_dev),
+        }
+    }
+
+    /// Returns true if the image is in HLL mode rather than List or Set mode
+    pub(super) fn is_array_mode(&self) -> bool {
+        matches!(self.image, Image::Array { .. })
+    }
+
+    /// Iterate over the coupons of a List or Set image
+    pub(super) fn coupons(&self) -> impl Iterator<Item = Coupon> + 'a {
+        let data = match self.image {
+            Image::Coupons { data, .. } => data,
+            Image::Array { .. } => &[],
+        };
+        read_coupons(data)
+    }
+
+    /// Get the value of the register at `slot` of an HLL image
+    ///
+    /// HLL4 exceptions are found by scanning the aux entries, which are few in practice.
+    pub(super) fn register(&self, slot: u32) -> u8 {
+        let Image::Array {
+            cur_min, data, aux, ..
+        } = &self.image
+        else {
+            unreachable!("register called on a List or Set image");
+        };
+
+        match self.hll_type {
+            HllType::Hll8 => data[slot as usize],
+            HllType::Hll6 => array6::get_packed(data, slot),
+            HllType::Hll4 => {
+                let raw = array4::get_packed(data, slot);
+                if raw < AUX_TOKEN {
+                    return cur_min + raw;
+                }
+                let mask = (1 << self.lg_config_k) - 1;
+                read_coupons(aux)
+                    .find(|coupon| coupon.slot() & mask == slot)
+                    .map_or(*cur_min, |coupon| coupon.value())
+            }
+        }
+    }
+
+    /// Get the HIP accumulator of an HLL image
+    pub(super) fn hip_accum(&self) -> f64 {
+        match &self.image {
+            Image::Array { estimator, .. } => estimator.hip_accum(),
+            Image::Coupons { .. } => 0.0,
+        }
+    }
+}
+
+/// Number of entries in a serialized coupon hash table of size `1 << lg_arr`
+fn table_size(lg_arr: u8) -> Result<usize, Error> {
+    if lg_arr > MAX_LG_ARR {
+        return Err(Error::deserial(format!(
+            "lg_arr must be at most {MAX_LG_ARR}, got {lg_arr}"
+        )));
+    }
+    Ok(1 << lg_arr)
+}
+
+/// Fail if the declared coupon count exceeds the stored entries or the configured `k`
+fn check_coupon_count(len: usize, num_entries: usize, lg_config_k: u8) -> Result<(), Error> {
+    let max = num_entries.min(1 << lg_config_k);
+    if len > max {
+        return Err(Error::deserial(format!(
+            "coupon_count {len} exceeds the maximum of {max}"
+        )));
+    }
+    Ok(())
+}
+
+/// Borrow `len` bytes starting at `offset`, failing if the image is too short
+fn slice_at(bytes: &[u8], offset: usize, len: usize) -> Result<&[u8], Error> {
+    bytes.get(offset..offset + len).ok_or_else(|| {
+        Error::insufficient_data(format!(
+            "expected {} bytes, got {}",
+            offset + len,
+            bytes.len()
+        ))
+    })
+}
+
+/// Iterate over the non-empty coupons stored in `data`
+fn read_coupons(data: &[u8]) -> impl Iterator<Item = Coupon> + '_ {
+    data.chunks_exact(COUPON_SIZE_BYTES)
+        .map(|chunk| Coupon(u32::from_le_bytes(chunk.try_into().unwrap())))
+        .filter(|coupon| !coupon.is_empty())
+}
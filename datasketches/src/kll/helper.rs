@@ -0,0 +1,439 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Capacity calculations and compaction primitives shared by the KLL sketch implementation.
+
+use crate::common::random;
+
+/// The default value of K if one is not specified.
+pub(super) const DEFAULT_K: u16 = 200;
+/// The minimum level width, also the smallest supported value of K.
+pub(super) const DEFAULT_M: u8 = 8;
+/// The smallest supported value of K.
+pub(super) const MIN_K: u16 = DEFAULT_M as u16;
+
+/// The smallest epsilon reachable with the largest K, used as the floor of [`k_from_epsilon`].
+const MIN_EPSILON: f64 = 4.7634e-5;
+
+/// Returns the normalized rank error of a KLL sketch configured with `k`.
+///
+/// With `pmf` set, the result is the error of [PMF](crate::kll::KllSketch::pmf) queries;
+/// otherwise it is the single-sided error of rank, quantile and CDF queries. Both hold with 99%
+/// confidence and use the empirical fit of the Java implementation.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::kll;
+/// let eps = kll::normalized_rank_error(200, false);
+/// assert!((eps - 0.0133).abs() < 1e-4);
+/// ```
+pub fn normalized_rank_error(k: u16, pmf: bool) -> f64 {
+    let k = f64::from(k);
+    if pmf {
+        2.446 / k.powf(0.9433)
+    } else {
+        2.296 / k.powf(0.9723)
+    }
+}
+
+/// Returns the smallest k whose [`normalized_rank_error`] does not exceed `epsilon`.
+///
+/// The result is clamped to the range of k supported by [`KllSketch`](crate::kll::KllSketch);
+/// an `epsilon` below the error of the largest k yields that k.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::kll;
+/// let k = kll::k_from_epsilon(0.01, false);
+/// assert!(kll::normalized_rank_error(k, false) <= 0.01);
+/// assert!(kll::normalized_rank_error(k - 1, false) > 0.01);
+/// ```
+pub fn k_from_epsilon(epsilon: f64, pmf: bool) -> u16 {
+    let epsilon = epsilon.max(MIN_EPSILON);
+    let k = if pmf {
+        ((2.446 / epsilon).ln() / 0.9433).exp()
+    } else {
+        ((2.296 / epsilon).ln() / 0.9723).exp()
+    };
+    // do not round up values that are integers up to floating point noise
+    let rounded = k.round();
+    let k = if (rounded - k).abs() < 1e-6 {
+        rounded
+    } else {
+        k.ceil()
+    };
+    k.clamp(f64::from(MIN_K), f64::from(u16::MAX)) as u16
+}
+
+const POWERS_OF_THREE: [u64; 31] = {
+    let mut powers = [1u64; 31];
+    let mut i = 1;
+    while i < powers.len() {
+        powers[i] = powers[i - 1] * 3;
+        i += 1;
+    }
+    powers
+};
+
+/// Returns an upper bound on the number of levels needed to hold `n` items.
+pub(super) fn ub_on_num_levels(n: u64) -> u8 {
+    if n == 0 {
+        return 1;
+    }
+    1 + floor_of_log2_of_fraction(n, 1)
+}
+
+fn floor_of_log2_of_fraction(numer: u64, mut denom: u64) -> u8 {
+    if denom > numer {
+        return 0;
+    }
+    let mut count = 0;
+    // compare against numer / 2 so that doubling denom never overflows
+    while denom <= numer / 2 {
+        denom <<= 1;
+        count += 1;
+    }
+    count
+}
+
+/// Returns the total number of items a sketch with the given number of levels can hold.
+pub(super) fn compute_total_capacity(k: u16, m: u8, num_levels: u8) -> u32 {
+    (0..num_levels)
+        .map(|height| level_capacity(k, num_levels, height, m) as u32)
+        .sum()
+}
+
+/// Returns the capacity of the level at `height` in a sketch with `num_levels` levels.
+pub(super) fn level_capacity(k: u16, num_levels: u8, height: u8, min_wid: u8) -> u16 {
+    assert!(height < num_levels, "height must be less than num_levels");
+    let depth = num_levels - height - 1;
+    int_cap_aux(k, depth).max(min_wid as u16)
+}
+
+fn int_cap_aux(k: u16, depth: u8) -> u16 {
+    assert!(depth <= 60, "depth must not exceed 60");
+    if depth <= 30 {
+        return int_cap_aux_aux(k, depth);
+    }
+    let half = depth / 2;
+    let rest = depth - half;
+    let tmp = int_cap_aux_aux(k, half);
+    int_cap_aux_aux(tmp, rest)
+}
+
+fn int_cap_aux_aux(k: u16, depth: u8) -> u16 {
+    // for rounding, pre-multiply by 2, then add 1 and divide by 2 at the end
+    let twok = (k as u64) << 1;
+    let tmp = (twok << depth) / POWERS_OF_THREE[depth as usize];
+    let result = (tmp + 1) >> 1;
+    debug_assert!(result <= k as u64);
+    result as u16
+}
+
+/// Returns the total weight of the items held in the given levels.
+pub(super) fn sum_the_sample_weights(num_levels: u8, levels: &[u32]) -> u64 {
+    let mut total = 0;
+    let mut weight = 1;
+    for level in 0..num_levels as usize {
+        total += weight * (levels[level + 1] - levels[level]) as u64;
+        weight *= 2;
+    }
+    total
+}
+
+/// Keeps either the odd or the even items of `buf[start..start + length]`, chosen at random,
+/// and packs them into the lower half of the range.
+pub(super) fn randomly_halve_down<T: Clone>(buf: &mut [T], start: usize, length: usize) {
+    debug_assert!(length % 2 == 0, "length must be even");
+    let half_length = length / 2;
+    let offset = random::next_bit() as usize;
+    let mut j = start + offset;
+    for i in start..(start + half_length) {
+        buf[i] = buf[j].clone();
+        j += 2;
+    }
+}
+
+/// Keeps either the odd or the even items of `buf[start..start + length]`, chosen at random,
+/// and packs them into the upper half of the range.
+pub(super) fn randomly_halve_up<T: Clone>(buf: &mut [T], start: usize, length: usize) {
+    debug_assert!(length % 2 == 0, "length must be even");
+    let half_length = length / 2;
+    let offset = random::next_bit() as usize;
+    let mut j = (start + length) - 1 - offset;
+    for i in ((start + half_length)..(start + length)).rev() {
+        buf[i] = buf[j].clone();
+        j = j.wrapping_sub(2);
+    }
+}
+
+/// Merges the sorted runs `buf[start_a..start_a + len_a]` and `buf[start_b..start_b + len_b]`
+/// into `buf[start_c..]`.
+///
+/// The output may overlap the inputs as long as it never overtakes the unread part of them,
+/// which is the case when compacting a level into the one above it.
+pub(super) fn merge_sorted_arrays_in_place<T, F>(
+    buf: &mut [T],
+    start_a: usize,
+    len_a: usize,
+    start_b: usize,
+    len_b: usize,
+    start_c: usize,
+    less: F,
+) where
+    T: Clone,
+    F: Fn(&T, &T) -> bool,
+{
+    let lim_a = start_a + len_a;
+    let lim_b = start_b + len_b;
+    let lim_c = start_c + len_a + len_b;
+    let mut a = start_a;
+    let mut b = start_b;
+    for c in start_c..lim_c {
+        if a == lim_a {
+            buf[c] = buf[b].clone();
+            b += 1;
+        } else if b == lim_b || less(&buf[a], &buf[b]) {
+            buf[c] = buf[a].clone();
+            a += 1;
+        } else {
+            buf[c] = buf[b].clone();
+            b += 1;
+        }
+    }
+}
+
+/// Merges two sorted slices into `out`, which must be exactly as long as both inputs together.
+pub(super) fn merge_sorted_slices<T, F>(a: &[T], b: &[T], out: &mut [T], less: F)
+where
+    T: Clone,
+    F: Fn(&T, &T) -> bool,
+{
+    debug_assert_eq!(a.len() + b.len(), out.len());
+    let (mut i, mut j) = (0, 0);
+    for slot in out.iter_mut() {
+        if j == b.len() || (i < a.len() && less(&a[i], &b[j])) {
+            *slot = a[i].clone();
+            i += 1;
+        } else {
+            *slot = b[j].clone();
+            j += 1;
+        }
+    }
+}
+
+/// The outcome of [`general_compress`].
+pub(super) struct CompressResult {
+    pub(super) final_num_levels: u8,
+    pub(super) final_capacity: u32,
+    pub(super) final_num_items: u32,
+}
+
+/// Compacts the levels described by `in_levels` until the items fit into the capacity of
+/// the resulting number of levels, writing the new level boundaries into `out_levels`.
+///
+/// Both level arrays must have room for at least two more entries than the number of levels
+/// the compaction can end up with.
+pub(super) fn general_compress<T, F>(
+    k: u16,
+    m: u8,
+    num_levels_in: u8,
+    items: &mut [T],
+    in_levels: &mut [u32],
+    out_levels: &mut [u32],
+    is_level_zero_sorted: bool,
+    less: F,
+) -> CompressResult
+where
+    T: Clone,
+    F: Fn(&T, &T) -> bool + Copy,
+{
+    assert!(num_levels_in > 0, "num_levels_in must be positive");
+    let starting_item_count = in_levels[num_levels_in as usize] - in_levels[0];
+    let mut current_num_levels = num_levels_in;
+    let mut current_item_count = starting_item_count;
+    let mut target_item_count = compute_total_capacity(k, m, current_num_levels);
+    out_levels[0] = 0;
+    let mut current_level = 0u8;
+    loop {
+        let lvl = current_level as usize;
+
+        // at the current top level, add an empty level above it for convenience,
+        // but do not increment the number of levels until later
+        if current_level == current_num_levels - 1 {
+            in_levels[lvl + 2] = in_levels[lvl + 1];
+        }
+
+        let raw_beg = in_levels[lvl] as usize;
+        let raw_lim = in_levels[lvl + 1] as usize;
+        let raw_pop = raw_lim - raw_beg;
+
+        if current_item_count < target_item_count
+            || raw_pop < level_capacity(k, current_num_levels, current_level, m) as usize
+        {
+            // move the level over as is
+            let out_beg = out_levels[lvl] as usize;
+            debug_assert!(raw_beg >= out_beg, "data must never move upwards");
+            if raw_beg != out_beg {
+                for i in 0..raw_pop {
+                    items[out_beg + i] = items[raw_beg + i].clone();
+                }
+            }
+            out_levels[lvl + 1] = out_levels[lvl] + raw_pop as u32;
+        } else {
+            // the sketch is too full AND this level is too full, so compact it
+            let pop_above = in_levels[lvl + 2] as usize - raw_lim;
+            let odd_pop = raw_pop % 2 == 1;
+            let adj_beg = if odd_pop { raw_beg + 1 } else { raw_beg };
+            let adj_pop = if odd_pop { raw_pop - 1 } else { raw_pop };
+            let half_adj_pop = adj_pop / 2;
+
+            if odd_pop {
+                // move one item over
+                items[out_levels[lvl] as usize] = items[raw_beg].clone();
+                out_levels[lvl + 1] = out_levels[lvl] + 1;
+            } else {
+                out_levels[lvl + 1] = out_levels[lvl];
+            }
+
+            // level zero might not be sorted, so we must sort it before compacting it
+            if current_level == 0 && !is_level_zero_sorted {
+                sort_by_less(&mut items[adj_beg..adj_beg + adj_pop], less);
+            }
+
+            if pop_above == 0 {
+                randomly_halve_up(items, adj_beg, adj_pop);
+            } else {
+                randomly_halve_down(items, adj_beg, adj_pop);
+                merge_sorted_arrays_in_place(
+                    items,
+                    adj_beg,
+                    half_adj_pop,
+                    raw_lim,
+                    pop_above,
+                    adj_beg + half_adj_pop,
+                    less,
+                );
+            }
+
+            current_item_count -= half_adj_pop as u32;
+            in_levels[lvl + 1] -= half_adj_pop as u32;
+
+            // compacting the old top level adds a level, which creates some more capacity
+            if current_level == current_num_levels - 1 {
+                current_num_levels += 1;
+                target_item_count += level_capacity(k, current_num_levels, 0, m) as u32;
+            }
+        }
+
+        if current_level == current_num_levels - 1 {
+            break;
+        }
+        current_level += 1;
+    }
+
+    debug_assert_eq!(
+        out_levels[current_num_levels as usize] - out_levels[0],
+        current_item_count
+    );
+
+    CompressResult {
+        final_num_levels: current_num_levels,
+        final_capacity: target_item_count,
+        final_num_items: current_item_count,
+    }
+}
+
+/// Sorts the items with a strict "less than" predicate.
+pub(super) fn sort_by_less<T, F>(items: &mut [T], less: F)
+where
+    F: Fn(&T, &T) -> bool,
+{
+    items.sort_by(|a, b| {
+        if less(a, b) {
+            std::cmp::Ordering::Less
+        } else if less(b, a) {
+            std::cmp::Ordering::Greater
+        } else {
+            std::cmp::Ordering::Equal
+        }
+    });
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_level_capacity() {
+        assert_eq!(level_capacity(200, 1, 0, DEFAULT_M), 200);
+        assert_eq!(level_capacity(200, 2, 1, DEFAULT_M), 200);
+        assert_eq!(level_capacity(200, 2, 0, DEFAULT_M), 133);
+        assert_eq!(level_capacity(200, 3, 0, DEFAULT_M), 89);
+        // the lowest levels never shrink below the minimum width
+        assert_eq!(level_capacity(200, 20, 0, DEFAULT_M), 8);
+    }
+
+    #[test]
+    fn test_compute_total_capacity() {
+        assert_eq!(compute_total_capacity(200, DEFAULT_M, 1), 200);
+        assert_eq!(compute_total_capacity(200, DEFAULT_M, 2), 333);
+        assert_eq!(compute_total_capacity(200, DEFAULT_M, 3), 422);
+        assert_eq!(compute_total_capacity(8, DEFAULT_M, 3), 24);
+    }
+
+    #[test]
+    fn test_ub_on_num_levels() {
+        assert_eq!(ub_on_num_levels(0), 1);
+        assert_eq!(ub_on_num_levels(1), 1);
+        assert_eq!(ub_on_num_levels(2), 2);
+        assert_eq!(ub_on_num_levels(3), 2);
+        assert_eq!(ub_on_num_levels(4), 3);
+        assert_eq!(ub_on_num_levels(1000), 10);
+    }
+
+    #[test]
+    fn test_sum_the_sample_weights() {
+        assert_eq!(sum_the_sample_weights(1, &[0, 5]), 5);
+        assert_eq!(sum_the_sample_weights(3, &[0, 2, 3, 5]), 2 + 2 + 8);
+    }
+
+    #[test]
+    fn test_randomly_halve() {
+        let mut buf: Vec<u32> = (0..10).collect();
+        randomly_halve_down(&mut buf, 2, 6);
+        assert!(buf[2..5] == [2, 4, 6] || buf[2..5] == [3, 5, 7]);
+
+        let mut buf: Vec<u32> = (0..10).collect();
+        randomly_halve_up(&mut buf, 2, 6);
+        assert!(buf[5..8] == [2, 4, 6] || buf[5..8] == [3, 5, 7]);
+    }
+
+    #[test]
+    fn test_merge_sorted_arrays() {
+        // layout produced by halving down three items in front of a level of four
+        let mut buf = vec![1, 4, 9, 0, 0, 0, 2, 3, 5, 10];
+        merge_sorted_arrays_in_place(&mut buf, 0, 3, 6, 4, 3, |a, b| a < b);
+        assert_eq!(buf[3..], [1, 2, 3, 4, 5, 9, 10]);
+
+        let mut out = vec![0; 5];
+        merge_sorted_slices(&[1, 3, 5], &[2, 4], &mut out, |a, b| a < b);
+        assert_eq!(out, [1, 2, 3, 4, 5]);
+    }
+}
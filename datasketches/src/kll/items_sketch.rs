@@ -0,0 +1,534 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::fmt;
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::PartitionBoundaries;
+use crate::common::QuantileBounds;
+use crate::common::SortedView;
+use crate::error::Error;
+use crate::kll::KllComparator;
+use crate::kll::KllItemValue;
+use crate::kll::NaturalOrder;
+use crate::kll::helper::DEFAULT_K;
+use crate::kll::raw_sketch::RawKllSketch;
+
+/// KLL sketch for estimating quantiles and ranks of a stream of arbitrary items.
+///
+/// Items are ordered by the comparator `C`, which defaults to the [`PartialOrd`] implementation
+/// of the item type. Unlike [`KllSketch`](crate::kll::KllSketch), retained items are owned and
+/// queries return clones of them, so strings, timestamps or custom structs can be sketched.
+///
+/// Serialization requires the items to implement [`KllItemValue`]; with `String` items, the
+/// serialized images are compatible with `KllItemsSketch<String>` in Java and
+/// `kll_sketch<std::string>` in C++.
+///
+/// See the [module level documentation](super) for more.
+#[derive(Debug, Clone)]
+pub struct KllItemsSketch<T, C = NaturalOrder> {
+    raw: RawKllSketch<T, C>,
+}
+
+impl<T: Clone, C: KllComparator<T> + Default> Default for KllItemsSketch<T, C> {
+    fn default() -> Self {
+        KllItemsSketch::new(DEFAULT_K)
+    }
+}
+
+impl<T: Clone, C: KllComparator<T> + Default> KllItemsSketch<T, C> {
+    /// Creates a KLL sketch with the given value of k, ordering items with the default
+    /// comparator.
+    ///
+    /// # Panics
+    ///
+    /// Panics if k is less than 8.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// let sketch = KllItemsSketch::<String>::new(100);
+    /// assert_eq!(sketch.k(), 100);
+    /// ```
+    pub fn new(k: u16) -> Self {
+        KllItemsSketch::with_comparator(k, C::default())
+    }
+}
+
+impl<T: Clone, C: KllComparator<T>> KllItemsSketch<T, C> {
+    /// Creates a KLL sketch with the given value of k, ordering items with the given
+    /// comparator.
+    ///
+    /// # Panics
+    ///
+    /// Panics if k is less than 8.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// // order strings by length first, then lexicographically
+    /// let mut sketch = KllItemsSketch::with_comparator(200, |a: &&str, b: &&str| {
+    ///     a.len().cmp(&b.len()).then(a.cmp(b))
+    /// });
+    /// sketch.update("ccc");
+    /// sketch.update("a");
+    /// sketch.update("bb");
+    /// assert_eq!(sketch.min_item(), Some(&"a"));
+    /// assert_eq!(sketch.max_item(), Some(&"ccc"));
+    /// ```
+    pub fn with_comparator(k: u16, comparator: C) -> Self {
+        KllItemsSketch {
+            raw: RawKllSketch::new(k, comparator),
+        }
+    }
+
+    /// Updates this sketch with the given item.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// let mut sketch = KllItemsSketch::<String>::default();
+    /// sketch.update("apple".to_string());
+    /// assert_eq!(sketch.n(), 1);
+    /// ```
+    pub fn update(&mut self, item: T) {
+        self.raw.update(item);
+    }
+
+    /// Merges the given sketch into this one.
+    ///
+    /// The sketches may have been configured with different values of k. The result keeps the k
+    /// of this sketch, while its error reflects the smaller k of the two. Both sketches are
+    /// expected to order their items the same way.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// let mut left = KllItemsSketch::<String>::default();
+    /// let mut right = KllItemsSketch::<String>::new(100);
+    /// left.update("a".to_string());
+    /// right.update("b".to_string());
+    /// left.merge(&right);
+    /// assert_eq!(left.n(), 2);
+    /// assert_eq!(left.max_item().map(String::as_str), Some("b"));
+    /// ```
+    pub fn merge(&mut self, other: &KllItemsSketch<T, C>) {
+        self.raw.merge(&other.raw);
+    }
+
+    /// Resets this sketch to its empty state with the same k and comparator.
+    ///
+    /// The retained items are dropped, but their buffer is kept for the next updates.
+    pub fn reset(&mut self) {
+        self.raw.reset(self.k());
+    }
+
+    /// Empties this sketch and gives it a new value of k, keeping the comparator and the buffer
+    /// of retained items.
+    ///
+    /// # Panics
+    ///
+    /// Panics if k is less than 8.
+    pub fn reconfigure(&mut self, k: u16) {
+        self.raw.reset(k);
+    }
+
+    /// Returns parameter k that was used to configure this sketch.
+    pub fn k(&self) -> u16 {
+        self.raw.k()
+    }
+
+    /// Returns the normalized rank error of this sketch.
+    ///
+    /// The error is computed from the smallest k among this sketch and the estimation mode
+    /// sketches merged into it. See
+    /// [`normalized_rank_error`](crate::kll::normalized_rank_error) for the meaning of `pmf`.
+    pub fn normalized_rank_error(&self, pmf: bool) -> f64 {
+        self.raw.normalized_rank_error(pmf)
+    }
+
+    /// Returns the length of the input stream.
+    pub fn n(&self) -> u64 {
+        self.raw.n()
+    }
+
+    /// Returns true if this sketch has not seen any data.
+    pub fn is_empty(&self) -> bool {
+        self.raw.is_empty()
+    }
+
+    /// Returns true if this sketch has compacted its input and its results are approximate.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.raw.is_estimation_mode()
+    }
+
+    /// Returns the number of items retained by this sketch.
+    pub fn num_retained(&self) -> usize {
+        self.raw.num_retained()
+    }
+
+    /// Returns the estimated size of the sketch in bytes
+    ///
+    /// Heap memory owned by the items themselves, such as the contents of `String` items, is not
+    /// included.
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>() + self.raw.heap_size()
+    }
+
+    /// Returns the minimum item seen by this sketch; `None` if the sketch is empty.
+    pub fn min_item(&self) -> Option<&T> {
+        self.raw.min_item()
+    }
+
+    /// Returns the maximum item seen by this sketch; `None` if the sketch is empty.
+    pub fn max_item(&self) -> Option<&T> {
+        self.raw.max_item()
+    }
+
+    /// Returns the approximate normalized rank (from 0 to 1 inclusive) of the given item.
+    ///
+    /// With `inclusive` set, the rank includes the weight of the item itself; otherwise only
+    /// the weight of the smaller items is counted.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// # let mut sketch = KllItemsSketch::<&str>::default();
+    /// # for item in ["a", "b", "c", "d"] {
+    /// #     sketch.update(item);
+    /// # }
+    /// assert_eq!(sketch.rank(&"b", true), Some(0.5));
+    /// assert_eq!(sketch.rank(&"b", false), Some(0.25));
+    /// ```
+    pub fn rank(&self, item: &T, inclusive: bool) -> Option<f64> {
+        self.raw.rank(item, inclusive)
+    }
+
+    /// Returns the approximate item at the given normalized rank.
+    ///
+    /// With `inclusive` set, the result is the smallest item whose inclusive rank is at least
+    /// the given rank; otherwise it is the smallest item whose exclusive rank is greater than
+    /// it. Ranks 0 and 1 always return the exact minimum and maximum items.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if rank is not in [0.0, 1.0].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// # let mut sketch = KllItemsSketch::<&str>::default();
+    /// # for item in ["a", "b", "c", "d"] {
+    /// #     sketch.update(item);
+    /// # }
+    /// assert_eq!(sketch.quantile(0.5, true), Some("b"));
+    /// assert_eq!(sketch.quantile(0.5, false), Some("c"));
+    /// ```
+    pub fn quantile(&self, rank: f64, inclusive: bool) -> Option<T> {
+        self.raw.quantile(rank, inclusive)
+    }
+
+    /// Returns the quantile of the given normalized rank together with the items at the
+    /// bounds of the rank.
+    ///
+    /// See [`KllSketch::quantile_with_rank_bounds`](crate::kll::KllSketch::quantile_with_rank_bounds)
+    /// for the bounds.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if rank is not in [0.0, 1.0].
+    pub fn quantile_with_rank_bounds(
+        &self,
+        rank: f64,
+        inclusive: bool,
+    ) -> Option<QuantileBounds<T>> {
+        self.raw.quantile_with_rank_bounds(rank, inclusive)
+    }
+
+    /// Returns an approximation to the Cumulative Distribution Function (CDF) of the input
+    /// stream given a set of split points.
+    ///
+    /// The result holds the ranks of the _m_ split points followed by 1. See
+    /// [`KllSketch::cdf`](crate::kll::KllSketch::cdf) for the meaning of `inclusive`.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `split_points` is not unique or not monotonically increasing under the
+    /// comparator of this sketch.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// # let mut sketch = KllItemsSketch::<&str>::default();
+    /// # for item in ["a", "b", "c", "d"] {
+    /// #     sketch.update(item);
+    /// # }
+    /// let cdf = sketch.cdf(&["b", "c"], true).unwrap();
+    /// assert_eq!(cdf, [0.5, 0.75, 1.0]);
+    /// ```
+    pub fn cdf(&self, split_points: &[T], inclusive: bool) -> Option<Vec<f64>> {
+        self.raw.cdf(split_points, inclusive)
+    }
+
+    /// Returns an approximation to the Probability Mass Function (PMF) of the input stream
+    /// given a set of split points.
+    ///
+    /// The result holds the fraction of the input that falls into each of the _m+1_ intervals
+    /// delimited by the _m_ split points. See [`KllSketch::pmf`](crate::kll::KllSketch::pmf)
+    /// for the meaning of `inclusive`.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `split_points` is not unique or not monotonically increasing under the
+    /// comparator of this sketch.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// # let mut sketch = KllItemsSketch::<&str>::default();
+    /// # for item in ["a", "b", "c", "d"] {
+    /// #     sketch.update(item);
+    /// # }
+    /// let pmf = sketch.pmf(&["b", "c"], true).unwrap();
+    /// assert_eq!(pmf, [0.5, 0.25, 0.25]);
+    /// ```
+    pub fn pmf(&self, split_points: &[T], inclusive: bool) -> Option<Vec<f64>> {
+        self.raw.pmf(split_points, inclusive)
+    }
+
+    /// Returns boundaries that split the input stream into `num_parts` parts of roughly equal
+    /// size.
+    ///
+    /// See [`KllSketch::partition_boundaries`](crate::kll::KllSketch::partition_boundaries);
+    /// the boundaries are clones of retained items and of the minimum and maximum items.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `num_parts` is 0.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// let mut sketch = KllItemsSketch::<&str>::default();
+    /// sketch.extend(["a", "b", "c", "d", "e", "f"]);
+    ///
+    /// let partition = sketch.partition_boundaries(2, false).unwrap();
+    /// assert_eq!(partition.boundaries(), ["a", "d", "f"]);
+    /// assert_eq!(partition.part_sizes(), [3, 3]);
+    /// ```
+    pub fn partition_boundaries(
+        &self,
+        num_parts: usize,
+        inclusive: bool,
+    ) -> Option<PartitionBoundaries<T>> {
+        self.raw.partition_boundaries(num_parts, inclusive)
+    }
+
+    /// Returns the retained items in comparator order together with their weights.
+    ///
+    /// See [`KllSketch::sorted_view`](crate::kll::KllSketch::sorted_view). The items of the
+    /// [`SortedView`] are clones of the retained items.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// # let mut sketch = KllItemsSketch::<&str>::default();
+    /// # for item in ["c", "a", "b"] {
+    /// #     sketch.update(item);
+    /// # }
+    /// let view = sketch.sorted_view();
+    /// let entries: Vec<_> = view.iter().map(|(item, w, c)| (*item, w, c)).collect();
+    /// assert_eq!(entries, [("a", 1, 1), ("b", 1, 2), ("c", 1, 3)]);
+    /// ```
+    pub fn sorted_view(&self) -> SortedView<T> {
+        self.raw.sorted_view()
+    }
+}
+
+impl<T: Clone + fmt::Debug, C: KllComparator<T>> KllItemsSketch<T, C> {
+    /// Returns a human-readable description of the sketch, with the level sizes if
+    /// `with_levels` and the retained items if `with_data`.
+    ///
+    /// The layout is that of [`KllSketch::to_string_with`](crate::kll::KllSketch::to_string_with),
+    /// printing items with their [`Debug`](fmt::Debug) format. The
+    /// [`Display`](fmt::Display) implementation prints the summary only.
+    pub fn to_string_with(&self, with_levels: bool, with_data: bool) -> String {
+        let mut out = String::new();
+        self.raw
+            .write_description(&mut out, with_levels, with_data)
+            .expect("writing to a String cannot fail");
+        out
+    }
+}
+
+impl<T: Clone + KllItemValue, C: KllComparator<T>> KllItemsSketch<T, C> {
+    /// Serializes this sketch to bytes in the compact format shared with the Java and C++
+    /// implementations.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// # let mut sketch = KllItemsSketch::<String>::default();
+    /// # sketch.update("apple".to_string());
+    /// let bytes = sketch.serialize();
+    /// let decoded = KllItemsSketch::<String>::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.max_item().map(String::as_str), Some("apple"));
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        self.raw
+            .serialize_with(T::serialize_size, |item, bytes| item.serialize_value(bytes))
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces, as reported by
+    /// [`KllItemValue::serialize_size`] for the items.
+    pub fn serialized_size_bytes(&self) -> usize {
+        self.raw.serialized_size_with(T::serialize_size)
+    }
+
+    /// Serializes this sketch into `buf` in the same format as [`serialize`](Self::serialize),
+    /// returning the number of bytes written.
+    ///
+    /// Returns an error if `buf` is too short for the image.
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| {
+            self.raw
+                .write_with(bytes, |item, bytes| item.serialize_value(bytes))
+        })
+    }
+
+    /// Streams this sketch to `writer` in the same format as [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| {
+            self.raw
+                .write_with(bytes, |item, bytes| item.serialize_value(bytes))
+        })
+    }
+
+    /// Deserializes a sketch from bytes, ordering its items with the given comparator.
+    ///
+    /// The comparator must order the items the same way as the one used by the sketch that
+    /// produced the bytes.
+    pub fn deserialize_with_comparator(bytes: &[u8], comparator: C) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes), comparator)
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`, ordering its items
+    /// with the given comparator.
+    ///
+    /// Exactly the bytes of one image are consumed. Fails like
+    /// [`deserialize_with_comparator`](Self::deserialize_with_comparator); a failing `reader` is
+    /// reported as insufficient data.
+    pub fn read_from_with_comparator(reader: &mut impl Read, comparator: C) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader), comparator)
+    }
+
+    fn read_image(cursor: SketchSlice<'_>, comparator: C) -> Result<Self, Error> {
+        let raw =
+            RawKllSketch::read_with(cursor, comparator, |cursor, _| T::deserialize_value(cursor))?;
+        Ok(KllItemsSketch { raw })
+    }
+}
+
+impl<T: Clone + KllItemValue, C: KllComparator<T> + Default> KllItemsSketch<T, C> {
+    /// Deserializes a sketch from bytes in the compact format shared with the Java and C++
+    /// implementations.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllItemsSketch;
+    /// # let mut sketch = KllItemsSketch::<String>::default();
+    /// # sketch.update("a".to_string());
+    /// # sketch.update("b".to_string());
+    /// # let bytes = sketch.serialize();
+    /// let decoded = KllItemsSketch::<String>::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.n(), 2);
+    /// ```
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        KllItemsSketch::deserialize_with_comparator(bytes, C::default())
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`, consuming exactly
+    /// the bytes of one image.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        KllItemsSketch::read_from_with_comparator(reader, C::default())
+    }
+}
+
+impl<T: Clone + fmt::Debug, C: KllComparator<T>> fmt::Display for KllItemsSketch<T, C> {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        self.raw.write_description(f, false, false)
+    }
+}
+
+/// Updates the sketch with every item of the iterator.
+impl<T: Clone, C: KllComparator<T>> Extend<T> for KllItemsSketch<T, C> {
+    fn extend<I: IntoIterator<Item = T>>(&mut self, iter: I) {
+        self.raw.update_from_iter(iter);
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(
+    [T: Clone + KllItemValue, C: KllComparator<T> + Default] KllItemsSketch<T, C>
+);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(
+    [T: Clone + KllItemValue, C: KllComparator<T> + Default] KllItemsSketch<T, C>
+);
+impl_fingerprint_via_image!(
+    [T: Clone + KllItemValue, C: KllComparator<T> + Default] KllItemsSketch<T, C>
+);
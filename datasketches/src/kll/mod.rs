@@ -0,0 +1,82 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! KLL sketch implementation for estimating quantiles and ranks.
+//!
+//! The KLL sketch is a very compact quantiles sketch with lazy compaction scheme and nearly
+//! optimal accuracy per retained item, based on the paper
+//! [Optimal Quantile Approximation in Streams][paper] by Zohar Karnin, Kevin Lang and Edo
+//! Liberty.
+//!
+//! The sketch keeps a hierarchy of levels of sampled items. Level _h_ holds items of weight
+//! 2<sup>h</sup>; when a level fills up it is sorted and every other item, chosen at random,
+//! is promoted to the level above. The accuracy is controlled by the parameter k: the default
+//! of 200 gives a normalized rank error of about 1.65% with 99% confidence. The error is
+//! uniform across the rank domain; for better accuracy at the extremes, see REQ sketch.
+//!
+//! Rank and quantile queries accept an `inclusive` flag matching the search criteria of the
+//! Java and C++ implementations. Serialized sketches use the compact binary format shared with
+//! those implementations: `KllSketch<f64>` corresponds to `KllDoublesSketch` in Java and
+//! `kll_sketch<double>` in C++, while `KllSketch<f32>` corresponds to `KllFloatsSketch` and
+//! `kll_sketch<float>`.
+//!
+//! [`KllItemsSketch`] sketches arbitrary items ordered by a [`KllComparator`], such as strings or
+//! timestamps, and corresponds to `KllItemsSketch` in Java. Its items are serialized through the
+//! [`KllItemValue`] trait.
+//!
+//! [`KllSketchVector`] keeps one [`KllSketch`] per dimension of a stream of vectors, updated
+//! with one value per dimension at a time, to track the distributions of many features at once.
+//!
+//! For more information on the performance characteristics, see the
+//! [Datasketches page on KLL](https://datasketches.apache.org/docs/KLL/KLLSketch.html).
+//!
+//! [paper]: https://arxiv.org/abs/1603.05346
+//!
+//! # Usage
+//!
+//! ```
+//! # use datasketches::kll::KllSketch;
+//! let mut sketch = KllSketch::<f64>::default();
+//! for i in 1..=1000 {
+//!     sketch.update(i as f64);
+//! }
+//! let median = sketch.quantile(0.5, true).unwrap();
+//! assert!((450.0..=550.0).contains(&median));
+//! let rank = sketch.rank(250.0, true).unwrap();
+//! assert!((0.2..=0.3).contains(&rank));
+//! ```
+
+mod helper;
+pub use self::helper::k_from_epsilon;
+pub use self::helper::normalized_rank_error;
+mod raw_sketch;
+mod serialization;
+
+mod items_sketch;
+pub use self::items_sketch::KllItemsSketch;
+
+mod sketch;
+pub use self::sketch::KllSketch;
+
+mod vector;
+pub use self::vector::KllSketchVector;
+
+mod value;
+pub use self::value::KllComparator;
+pub use self::value::KllItemValue;
+pub use self::value::KllValue;
+pub use self::value::NaturalOrder;
@@ -0,0 +1,981 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::fmt;
+use std::iter::repeat_n;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::insufficient_data;
+use crate::codec::family::Family;
+use crate::common::PartitionBoundaries;
+use crate::common::QuantileBounds;
+use crate::common::SortedView;
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::error::SketchError;
+use crate::kll::KllComparator;
+use crate::kll::helper::DEFAULT_M;
+use crate::kll::helper::MIN_K;
+use crate::kll::helper::compute_total_capacity;
+use crate::kll::helper::general_compress;
+use crate::kll::helper::level_capacity;
+use crate::kll::helper::merge_sorted_arrays_in_place;
+use crate::kll::helper::merge_sorted_slices;
+use crate::kll::helper::normalized_rank_error;
+use crate::kll::helper::randomly_halve_down;
+use crate::kll::helper::randomly_halve_up;
+use crate::kll::helper::sort_by_less;
+use crate::kll::helper::sum_the_sample_weights;
+use crate::kll::helper::ub_on_num_levels;
+use crate::kll::serialization::FLAGS_IS_EMPTY;
+use crate::kll::serialization::FLAGS_IS_LEVEL_ZERO_SORTED;
+use crate::kll::serialization::FLAGS_IS_SINGLE_ITEM;
+use crate::kll::serialization::FULL_PREAMBLE_SIZE;
+use crate::kll::serialization::PREAMBLE_INTS_FULL;
+use crate::kll::serialization::PREAMBLE_INTS_SHORT;
+use crate::kll::serialization::SERIAL_VERSION_1;
+use crate::kll::serialization::SERIAL_VERSION_2;
+use crate::kll::serialization::SHORT_PREAMBLE_SIZE;
+
+/// The KLL state machine shared by [`KllSketch`](crate::kll::KllSketch) and
+/// [`KllItemsSketch`](crate::kll::KllItemsSketch), generic over the item type and its ordering.
+#[derive(Debug, Clone)]
+pub(super) struct RawKllSketch<T, C> {
+    comparator: C,
+    k: u16,
+    min_k: u16,
+    n: u64,
+    num_levels: u8,
+    is_level_zero_sorted: bool,
+    // boundaries of the levels in `items`; level `i` spans `levels[i]..levels[i + 1]`
+    // and the last entry is the total capacity
+    levels: Vec<u32>,
+    // allocated on the first update; level zero grows downwards from `levels[1]`
+    items: Vec<T>,
+    min_item: Option<T>,
+    max_item: Option<T>,
+}
+
+impl<T: Clone, C: KllComparator<T>> RawKllSketch<T, C> {
+    pub(super) fn new(k: u16, comparator: C) -> Self {
+        assert!(k >= MIN_K, "k must be at least {MIN_K}, got {k}");
+        RawKllSketch {
+            comparator,
+            k,
+            min_k: k,
+            n: 0,
+            num_levels: 1,
+            is_level_zero_sorted: false,
+            levels: vec![k as u32, k as u32],
+            items: vec![],
+            min_item: None,
+            max_item: None,
+        }
+    }
+
+    /// Returns to the empty state of a sketch with the given k, keeping the items allocation.
+    pub(super) fn reset(&mut self, k: u16) {
+        assert!(k >= MIN_K, "k must be at least {MIN_K}, got {k}");
+        self.k = k;
+        self.min_k = k;
+        self.n = 0;
+        self.num_levels = 1;
+        self.is_level_zero_sorted = false;
+        self.levels.clear();
+        self.levels.extend([k as u32, k as u32]);
+        self.items.clear();
+        self.min_item = None;
+        self.max_item = None;
+    }
+
+    pub(super) fn update(&mut self, item: T) {
+        self.widen_min_max(&item, &item);
+        self.internal_update(item);
+    }
+
+    /// Updates with every item of `items`, as repeated calls to [`update`](Self::update) would.
+    ///
+    /// The free space below level zero is filled a run of items at a time. A run of ascending
+    /// items that also follows the items already in level zero is stored sorted, so that
+    /// compacting level zero skips sorting it.
+    pub(super) fn update_from_iter(&mut self, items: impl IntoIterator<Item = T>) {
+        let mut items = items.into_iter().peekable();
+        while let Some(first) = items.peek() {
+            if self.items.is_empty() {
+                // a reset sketch reuses the allocation it had
+                let capacity = self.levels[self.num_levels as usize] as usize;
+                self.items.resize(capacity, first.clone());
+            }
+            if self.levels[0] == 0 {
+                self.compress_while_updating();
+            }
+
+            // write the run to the start of the free space, then move it next to level zero
+            let free = self.levels[0] as usize;
+            let mut len = 0;
+            let mut ascending = true;
+            for item in items.by_ref().take(free) {
+                if ascending {
+                    if len > 0 && self.comparator.less(&item, &self.items[len - 1]) {
+                        // the min and max of the ascending prefix are its ends
+                        ascending = false;
+                        let (first, last) = (self.items[0].clone(), self.items[len - 1].clone());
+                        self.widen_min_max(&first, &last);
+                        self.widen_min_max(&item, &item);
+                    }
+                } else {
+                    self.widen_min_max(&item, &item);
+                }
+                self.items[len] = item;
+                len += 1;
+            }
+            if ascending {
+                let (first, last) = (self.items[0].clone(), self.items[len - 1].clone());
+                self.widen_min_max(&first, &last);
+            }
+            self.items[..free].rotate_left(len);
+            let start = free - len;
+
+            // the items already in level zero go before the run if that keeps it sorted and
+            // costs no more than writing the run
+            let lim = self.levels[1] as usize;
+            let old_len = lim - free;
+            let old_sorted = old_len <= 1 || self.is_level_zero_sorted;
+            self.is_level_zero_sorted = ascending
+                && (old_len == 0
+                    || (old_sorted
+                        && old_len <= len
+                        && !self
+                            .comparator
+                            .less(&self.items[start], &self.items[lim - 1])));
+            if self.is_level_zero_sorted && old_len > 0 {
+                self.items[start..lim].rotate_right(old_len);
+            }
+            self.levels[0] = start as u32;
+            self.n += len as u64;
+        }
+    }
+
+    pub(super) fn merge(&mut self, other: &RawKllSketch<T, C>) {
+        if other.is_empty() {
+            return;
+        }
+        match (
+            &self.min_item,
+            &self.max_item,
+            &other.min_item,
+            &other.max_item,
+        ) {
+            (Some(min), Some(max), Some(other_min), Some(other_max)) => {
+                if self.comparator.less(other_min, min) {
+                    self.min_item = Some(other_min.clone());
+                }
+                if self.comparator.less(max, other_max) {
+                    self.max_item = Some(other_max.clone());
+                }
+            }
+            _ => {
+                self.min_item = other.min_item.clone();
+                self.max_item = other.max_item.clone();
+            }
+        }
+
+        let final_n = self.n + other.n;
+        for item in other.level_items(0) {
+            self.internal_update(item.clone());
+        }
+        if other.num_levels >= 2 {
+            self.merge_higher_levels(other, final_n);
+        }
+        self.n = final_n;
+        if other.is_estimation_mode() {
+            self.min_k = self.min_k.min(other.min_k);
+        }
+        debug_assert_eq!(
+            sum_the_sample_weights(self.num_levels, &self.levels),
+            self.n
+        );
+    }
+
+    pub(super) fn k(&self) -> u16 {
+        self.k
+    }
+
+    pub(super) fn normalized_rank_error(&self, pmf: bool) -> f64 {
+        normalized_rank_error(self.min_k, pmf)
+    }
+
+    pub(super) fn n(&self) -> u64 {
+        self.n
+    }
+
+    pub(super) fn is_empty(&self) -> bool {
+        self.n == 0
+    }
+
+    pub(super) fn is_estimation_mode(&self) -> bool {
+        self.num_levels > 1
+    }
+
+    pub(super) fn num_retained(&self) -> usize {
+        (self.levels[self.num_levels as usize] - self.levels[0]) as usize
+    }
+
+    /// Returns the size of the level boundaries and the item buffer in bytes.
+    pub(super) fn heap_size(&self) -> usize {
+        self.levels.capacity() * size_of::<u32>() + self.items.capacity() * size_of::<T>()
+    }
+
+    pub(super) fn min_item(&self) -> Option<&T> {
+        self.min_item.as_ref()
+    }
+
+    pub(super) fn max_item(&self) -> Option<&T> {
+        self.max_item.as_ref()
+    }
+
+    pub(super) fn rank(&self, item: &T, inclusive: bool) -> Option<f64> {
+        if self.is_empty() {
+            return None;
+        }
+
+        let mut total = 0;
+        let mut weight = 1;
+        for level in 0..self.num_levels {
+            for retained in self.level_items(level) {
+                let counted = if inclusive {
+                    !self.comparator.less(item, retained)
+                } else {
+                    self.comparator.less(retained, item)
+                };
+                if counted {
+                    total += weight;
+                } else if level > 0 || self.is_level_zero_sorted {
+                    // levels above zero are sorted, so no need to compare further
+                    break;
+                }
+            }
+            weight *= 2;
+        }
+        Some(total as f64 / self.n as f64)
+    }
+
+    pub(super) fn quantile(&self, rank: f64, inclusive: bool) -> Option<T> {
+        assert!((0.0..=1.0).contains(&rank), "rank must be in [0.0, 1.0]");
+        if self.is_empty() {
+            return None;
+        }
+        // the extremes are tracked exactly, even when they are no longer retained
+        if rank == 0.0 {
+            return self.min_item.clone();
+        }
+        if rank == 1.0 {
+            return self.max_item.clone();
+        }
+        Some(self.sorted_view().quantile(rank, inclusive))
+    }
+
+    pub(super) fn quantile_with_rank_bounds(
+        &self,
+        rank: f64,
+        inclusive: bool,
+    ) -> Option<QuantileBounds<T>> {
+        assert!((0.0..=1.0).contains(&rank), "rank must be in [0.0, 1.0]");
+        let (min_item, max_item) = (self.min_item.as_ref()?, self.max_item.as_ref()?);
+        // the ranks of a sketch that has not compacted yet are exact
+        let eps = if self.is_estimation_mode() {
+            self.normalized_rank_error(false)
+        } else {
+            0.0
+        };
+        Some(QuantileBounds::from_view(
+            &self.sorted_view(),
+            min_item,
+            max_item,
+            rank,
+            (rank - eps, rank + eps),
+            inclusive,
+        ))
+    }
+
+    pub(super) fn cdf(&self, split_points: &[T], inclusive: bool) -> Option<Vec<f64>> {
+        self.check_split_points(split_points);
+        if self.is_empty() {
+            return None;
+        }
+        let less = |a: &T, b: &T| self.comparator.less(a, b);
+        Some(self.sorted_view().cdf(split_points, inclusive, less))
+    }
+
+    pub(super) fn pmf(&self, split_points: &[T], inclusive: bool) -> Option<Vec<f64>> {
+        self.check_split_points(split_points);
+        if self.is_empty() {
+            return None;
+        }
+        let less = |a: &T, b: &T| self.comparator.less(a, b);
+        Some(self.sorted_view().pmf(split_points, inclusive, less))
+    }
+
+    pub(super) fn partition_boundaries(
+        &self,
+        num_parts: usize,
+        inclusive: bool,
+    ) -> Option<PartitionBoundaries<T>> {
+        assert!(num_parts > 0, "num_parts must be at least 1");
+        let (Some(min_item), Some(max_item)) = (&self.min_item, &self.max_item) else {
+            return None;
+        };
+        let less = |a: &T, b: &T| self.comparator.less(a, b);
+        Some(self.sorted_view().partition_boundaries(
+            num_parts,
+            inclusive,
+            min_item.clone(),
+            max_item.clone(),
+            less,
+        ))
+    }
+
+    pub(super) fn serialize_with<S, W>(&self, item_size: S, write_item: W) -> Vec<u8>
+    where
+        S: Fn(&T) -> usize,
+        W: Fn(&T, &mut SketchBytes),
+    {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_with(item_size));
+        self.write_with(&mut bytes, write_item);
+        bytes.into_bytes()
+    }
+
+    pub(super) fn serialized_size_with<S>(&self, item_size: S) -> usize
+    where
+        S: Fn(&T) -> usize,
+    {
+        let is_single_item = self.n == 1;
+        let retained = (0..self.num_levels).flat_map(|level| self.level_items(level));
+        let mut total_size = SHORT_PREAMBLE_SIZE;
+        if !self.is_empty() && !is_single_item {
+            total_size = FULL_PREAMBLE_SIZE;
+            total_size += self.num_levels as usize * size_of::<u32>();
+            total_size += self.min_item.iter().map(&item_size).sum::<usize>();
+            total_size += self.max_item.iter().map(&item_size).sum::<usize>();
+        }
+        total_size + retained.map(&item_size).sum::<usize>()
+    }
+
+    pub(super) fn write_with<W>(&self, bytes: &mut SketchBytes, write_item: W)
+    where
+        W: Fn(&T, &mut SketchBytes),
+    {
+        let is_single_item = self.n == 1;
+        let retained = (0..self.num_levels).flat_map(|level| self.level_items(level));
+        bytes.write_u8(if self.is_empty() || is_single_item {
+            PREAMBLE_INTS_SHORT
+        } else {
+            PREAMBLE_INTS_FULL
+        });
+        bytes.write_u8(if is_single_item {
+            SERIAL_VERSION_2
+        } else {
+            SERIAL_VERSION_1
+        });
+        bytes.write_u8(Family::KLL.id);
+        bytes.write_u8({
+            let mut flags = 0;
+            if self.is_empty() {
+                flags |= FLAGS_IS_EMPTY;
+            }
+            if self.is_level_zero_sorted {
+                flags |= FLAGS_IS_LEVEL_ZERO_SORTED;
+            }
+            if is_single_item {
+                flags |= FLAGS_IS_SINGLE_ITEM;
+            }
+            flags
+        });
+        bytes.write_u16_le(self.k);
+        bytes.write_u8(DEFAULT_M);
+        bytes.write_u8(0); // unused
+        if self.is_empty() {
+            return;
+        }
+
+        if !is_single_item {
+            bytes.write_u64_le(self.n);
+            bytes.write_u16_le(self.min_k);
+            bytes.write_u8(self.num_levels);
+            bytes.write_u8(0); // unused
+            for &level in &self.levels[..self.num_levels as usize] {
+                bytes.write_u32_le(level);
+            }
+            // both are present in a non-empty sketch
+            write_item(self.min_item.as_ref().unwrap(), bytes);
+            write_item(self.max_item.as_ref().unwrap(), bytes);
+        }
+        for item in retained {
+            write_item(item, bytes);
+        }
+    }
+
+    pub(super) fn read_with<R>(
+        mut cursor: SketchSlice<'_>,
+        comparator: C,
+        mut read_item: R,
+    ) -> Result<Self, Error>
+    where
+        R: FnMut(&mut SketchSlice<'_>, &'static str) -> Result<T, Error>,
+    {
+        let preamble_ints = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_ints"))?;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let k = cursor.read_u16_le().map_err(insufficient_data("k"))?;
+        let m = cursor.read_u8().map_err(insufficient_data("m"))?;
+        cursor.read_u8().map_err(insufficient_data("<unused>"))?;
+
+        Family::KLL.validate_id(family_id)?;
+        if serial_version != SERIAL_VERSION_1 && serial_version != SERIAL_VERSION_2 {
+            return Err(Error::new(
+                ErrorKind::UnsupportedVersion,
+                format!(
+                    "unsupported serial version: expected {SERIAL_VERSION_1} or {SERIAL_VERSION_2}, got {serial_version}"
+                ),
+            )
+            .with_reason(SketchError::UnsupportedSerialVersion {
+                expected: SERIAL_VERSION_2,
+                actual: serial_version,
+            }));
+        }
+        if m != DEFAULT_M {
+            return Err(Error::deserial(format!("m must be {DEFAULT_M}, got {m}")));
+        }
+        if k < MIN_K {
+            return Err(Error::deserial(format!(
+                "k must be at least {MIN_K}, got {k}"
+            )));
+        }
+
+        let is_empty = (flags & FLAGS_IS_EMPTY) != 0;
+        let is_single_item = (flags & FLAGS_IS_SINGLE_ITEM) != 0;
+        let expected_preamble_ints = if is_empty || is_single_item {
+            PREAMBLE_INTS_SHORT
+        } else {
+            PREAMBLE_INTS_FULL
+        };
+        if preamble_ints != expected_preamble_ints {
+            return Err(Error::deserial(format!(
+                "invalid preamble ints: expected {expected_preamble_ints}, got {preamble_ints}"
+            ))
+            .with_reason(SketchError::InvalidPreamble {
+                actual: preamble_ints,
+            }));
+        }
+        if is_empty {
+            return Ok(RawKllSketch::new(k, comparator));
+        }
+
+        let (n, min_k, num_levels) = if is_single_item {
+            (1, k, 1)
+        } else {
+            let n = cursor.read_u64_le().map_err(insufficient_data("n"))?;
+            let min_k = cursor.read_u16_le().map_err(insufficient_data("min_k"))?;
+            let num_levels = cursor.read_u8().map_err(insufficient_data("num_levels"))?;
+            cursor.read_u8().map_err(insufficient_data("<unused>"))?;
+            (n, min_k, num_levels)
+        };
+        if n == 0 {
+            return Err(Error::deserial("n must be positive in a non-empty sketch"));
+        }
+        if num_levels == 0 || num_levels > ub_on_num_levels(n) {
+            return Err(Error::deserial(format!(
+                "invalid number of levels {num_levels} for n = {n}"
+            )));
+        }
+
+        let capacity = compute_total_capacity(k, DEFAULT_M, num_levels);
+        let mut levels = Vec::with_capacity(num_levels as usize + 1);
+        if is_single_item {
+            levels.push(capacity - 1);
+        } else {
+            for _ in 0..num_levels {
+                let level = cursor.read_u32_le().map_err(insufficient_data("levels"))?;
+                levels.push(level);
+            }
+        }
+        levels.push(capacity);
+        if levels.windows(2).any(|w| w[0] > w[1]) || levels[0] >= capacity {
+            return Err(Error::deserial(format!("invalid levels: {levels:?}")));
+        }
+        if sum_the_sample_weights(num_levels, &levels) != n {
+            return Err(Error::deserial(format!(
+                "levels {levels:?} are inconsistent with n = {n}"
+            )));
+        }
+
+        let min_max = if is_single_item {
+            None
+        } else {
+            let min = read_item(&mut cursor, "min_item")?;
+            let max = read_item(&mut cursor, "max_item")?;
+            Some((min, max))
+        };
+
+        let num_items = (capacity - levels[0]) as usize;
+        let mut retained = Vec::with_capacity(cursor.capacity_hint(num_items, 1));
+        for _ in 0..num_items {
+            retained.push(read_item(&mut cursor, "items")?);
+        }
+        let (min_item, max_item) =
+            min_max.unwrap_or_else(|| (retained[0].clone(), retained[0].clone()));
+
+        let mut items = Vec::with_capacity(capacity as usize);
+        items.extend(repeat_n(retained[0].clone(), levels[0] as usize));
+        items.extend(retained);
+
+        Ok(RawKllSketch {
+            comparator,
+            k,
+            min_k,
+            n,
+            num_levels,
+            is_level_zero_sorted: (flags & FLAGS_IS_LEVEL_ZERO_SORTED) != 0,
+            levels,
+            items,
+            min_item: Some(min_item),
+            max_item: Some(max_item),
+        })
+    }
+
+    fn check_split_points(&self, split_points: &[T]) {
+        for pair in split_points.windows(2) {
+            if !self.comparator.less(&pair[0], &pair[1]) {
+                panic!("split_points must be unique and monotonically increasing");
+            }
+        }
+    }
+
+    /// Writes the summary and optionally the level sizes and the items of the sketch, in the
+    /// layout of the C++ `kll_sketch::to_string`.
+    pub(super) fn write_description(
+        &self,
+        f: &mut impl fmt::Write,
+        with_levels: bool,
+        with_data: bool,
+    ) -> fmt::Result
+    where
+        T: fmt::Debug,
+    {
+        writeln!(f, "### KLL sketch summary:")?;
+        writeln!(f, "   K              : {}", self.k)?;
+        writeln!(f, "   min K          : {}", self.min_k)?;
+        writeln!(f, "   M              : {DEFAULT_M}")?;
+        writeln!(f, "   N              : {}", self.n)?;
+        writeln!(
+            f,
+            "   Epsilon        : {:.2}%",
+            self.normalized_rank_error(false) * 100.0
+        )?;
+        writeln!(
+            f,
+            "   Epsilon PMF    : {:.2}%",
+            self.normalized_rank_error(true) * 100.0
+        )?;
+        writeln!(f, "   Empty          : {}", self.is_empty())?;
+        writeln!(f, "   Estimation mode: {}", self.is_estimation_mode())?;
+        writeln!(f, "   Levels         : {}", self.num_levels)?;
+        writeln!(f, "   Sorted         : {}", self.is_level_zero_sorted)?;
+        writeln!(
+            f,
+            "   Capacity items : {}",
+            self.levels[self.num_levels as usize]
+        )?;
+        writeln!(f, "   Retained items : {}", self.num_retained())?;
+        if let (Some(min), Some(max)) = (&self.min_item, &self.max_item) {
+            writeln!(f, "   Min item       : {min:?}")?;
+            writeln!(f, "   Max item       : {max:?}")?;
+        }
+        writeln!(f, "### End sketch summary")?;
+
+        if with_levels {
+            writeln!(f, "### KLL sketch levels:")?;
+            writeln!(f, "   index: nominal capacity, actual size")?;
+            for level in 0..self.num_levels {
+                let capacity = level_capacity(self.k, self.num_levels, level, DEFAULT_M);
+                let size = self.level_items(level).len();
+                writeln!(f, "   {level}: {capacity}, {size}")?;
+            }
+            writeln!(f, "### End sketch levels")?;
+        }
+
+        if with_data {
+            writeln!(f, "### KLL sketch data:")?;
+            for level in 0..self.num_levels {
+                let items = self.level_items(level);
+                if !items.is_empty() {
+                    writeln!(f, " level {level}:")?;
+                }
+                for item in items {
+                    writeln!(f, "   {item:?}")?;
+                }
+            }
+            writeln!(f, "### End sketch data")?;
+        }
+
+        Ok(())
+    }
+
+    fn level_items(&self, level: u8) -> &[T] {
+        if level >= self.num_levels {
+            return &[];
+        }
+        let from = self.levels[level as usize] as usize;
+        let to = self.levels[level as usize + 1] as usize;
+        if from == to {
+            // the items of an empty sketch may not be allocated yet
+            return &[];
+        }
+        &self.items[from..to]
+    }
+
+    pub(super) fn sorted_view(&self) -> SortedView<T> {
+        let mut entries = Vec::with_capacity(self.num_retained());
+        let mut weight = 1;
+        for level in 0..self.num_levels {
+            entries.extend(
+                self.level_items(level)
+                    .iter()
+                    .map(|item| (item.clone(), weight)),
+            );
+            weight *= 2;
+        }
+        SortedView::new(entries, |a, b| self.comparator.less(a, b))
+    }
+
+    /// Widens the min and max items to cover `min` and `max`.
+    fn widen_min_max(&mut self, min: &T, max: &T) {
+        match (&self.min_item, &self.max_item) {
+            (Some(cur_min), Some(cur_max)) => {
+                if self.comparator.less(min, cur_min) {
+                    self.min_item = Some(min.clone());
+                }
+                if self.comparator.less(cur_max, max) {
+                    self.max_item = Some(max.clone());
+                }
+            }
+            _ => {
+                self.min_item = Some(min.clone());
+                self.max_item = Some(max.clone());
+            }
+        }
+    }
+
+    fn internal_update(&mut self, item: T) {
+        if self.items.is_empty() {
+            // a reset sketch reuses the allocation it had
+            let capacity = self.levels[self.num_levels as usize] as usize;
+            self.items.resize(capacity, item.clone());
+        }
+        if self.levels[0] == 0 {
+            self.compress_while_updating();
+        }
+        self.n += 1;
+        self.is_level_zero_sorted = false;
+        self.levels[0] -= 1;
+        self.items[self.levels[0] as usize] = item;
+    }
+
+    fn compress_while_updating(&mut self) {
+        let level = self.find_level_to_compact();
+
+        // It is important to add the new top level right here. Be aware that this operation
+        // grows the buffer and shifts the data and also the boundaries of the data and grows
+        // the levels array and increments num_levels.
+        if level == self.num_levels - 1 {
+            self.add_empty_top_level_to_completely_full_sketch();
+        }
+
+        let lvl = level as usize;
+        let raw_beg = self.levels[lvl] as usize;
+        let raw_lim = self.levels[lvl + 1] as usize;
+        // +2 is OK because we already added a new top level if necessary
+        let pop_above = self.levels[lvl + 2] as usize - raw_lim;
+        let raw_pop = raw_lim - raw_beg;
+        let odd_pop = raw_pop % 2 == 1;
+        let adj_beg = if odd_pop { raw_beg + 1 } else { raw_beg };
+        let adj_pop = if odd_pop { raw_pop - 1 } else { raw_pop };
+        let half_adj_pop = adj_pop / 2;
+
+        let comparator = &self.comparator;
+        let less = |a: &T, b: &T| comparator.less(a, b);
+
+        // level zero might not be sorted, so we must sort it before compacting it
+        if level == 0 && !self.is_level_zero_sorted {
+            sort_by_less(&mut self.items[adj_beg..adj_beg + adj_pop], less);
+        }
+        if pop_above == 0 {
+            randomly_halve_up(&mut self.items, adj_beg, adj_pop);
+        } else {
+            randomly_halve_down(&mut self.items, adj_beg, adj_pop);
+            merge_sorted_arrays_in_place(
+                &mut self.items,
+                adj_beg,
+                half_adj_pop,
+                raw_lim,
+                pop_above,
+                adj_beg + half_adj_pop,
+                less,
+            );
+        }
+
+        // adjust the boundaries of the level above
+        self.levels[lvl + 1] -= half_adj_pop as u32;
+        if odd_pop {
+            // the current level now contains only the leftover item
+            self.levels[lvl] = self.levels[lvl + 1] - 1;
+            self.items.swap(self.levels[lvl] as usize, raw_beg);
+        } else {
+            self.levels[lvl] = self.levels[lvl + 1];
+        }
+        debug_assert_eq!(self.levels[lvl] as usize, raw_beg + half_adj_pop);
+
+        // shift up the data in the levels below so that the freed-up space can be used by
+        // level zero
+        if level > 0 {
+            let from = self.levels[0] as usize;
+            self.items[from..raw_beg + half_adj_pop].rotate_right(half_adj_pop);
+            for level in &mut self.levels[..lvl] {
+                *level += half_adj_pop as u32;
+            }
+        }
+    }
+
+    fn find_level_to_compact(&self) -> u8 {
+        let mut level = 0;
+        loop {
+            assert!(level < self.num_levels, "capacity calculation error");
+            let pop = self.levels[level as usize + 1] - self.levels[level as usize];
+            let cap = level_capacity(self.k, self.num_levels, level, DEFAULT_M);
+            if pop >= cap as u32 {
+                return level;
+            }
+            level += 1;
+        }
+    }
+
+    fn add_empty_top_level_to_completely_full_sketch(&mut self) {
+        let cur_total_cap = self.levels[self.num_levels as usize];
+        debug_assert_eq!(self.levels[0], 0, "full sketch expected");
+        debug_assert_eq!(cur_total_cap as usize, self.items.len());
+
+        let delta_cap = level_capacity(self.k, self.num_levels + 1, 0, DEFAULT_M) as u32;
+        let new_total_cap = cur_total_cap + delta_cap;
+
+        // shift the current data up to make room for the new bottom level
+        let fill = self.items[0].clone();
+        self.items.splice(0..0, repeat_n(fill, delta_cap as usize));
+
+        // this loop includes the old "extra" index at the top
+        for level in &mut self.levels {
+            *level += delta_cap;
+        }
+        debug_assert_eq!(self.levels[self.num_levels as usize], new_total_cap);
+
+        self.num_levels += 1;
+        self.levels.push(new_total_cap);
+    }
+
+    fn merge_higher_levels(&mut self, other: &RawKllSketch<T, C>, final_n: u64) {
+        let ub = ub_on_num_levels(final_n) as usize;
+        let mut work_levels = vec![0u32; ub + 2];
+        let mut out_levels = vec![0u32; ub + 2];
+        let provisional_num_levels = self.num_levels.max(other.num_levels);
+
+        let mut work_items =
+            self.populate_work_arrays(other, &mut work_levels, provisional_num_levels);
+        let comparator = &self.comparator;
+        let result = general_compress(
+            self.k,
+            DEFAULT_M,
+            provisional_num_levels,
+            &mut work_items,
+            &mut work_levels,
+            &mut out_levels,
+            self.is_level_zero_sorted,
+            |a: &T, b: &T| comparator.less(a, b),
+        );
+        debug_assert!(result.final_num_levels as usize <= ub);
+
+        // transfer the results back into this sketch
+        let final_capacity = result.final_capacity as usize;
+        let final_num_items = result.final_num_items as usize;
+        let free_space_at_bottom = final_capacity - final_num_items;
+        let start = out_levels[0] as usize;
+        work_items.truncate(start + final_num_items);
+        let mut items = Vec::with_capacity(final_capacity);
+        items.extend(repeat_n(work_items[start].clone(), free_space_at_bottom));
+        items.extend(work_items.drain(start..));
+
+        let offset = (free_space_at_bottom - start) as u32;
+        self.levels = out_levels[..=result.final_num_levels as usize]
+            .iter()
+            .map(|level| level + offset)
+            .collect();
+        self.num_levels = result.final_num_levels;
+        self.items = items;
+    }
+
+    fn populate_work_arrays(
+        &self,
+        other: &RawKllSketch<T, C>,
+        work_levels: &mut [u32],
+        provisional_num_levels: u8,
+    ) -> Vec<T> {
+        let mut work_items = Vec::with_capacity(self.num_retained() + other.num_retained());
+
+        // the level zero data from the other sketch was already inserted into this one
+        work_levels[0] = 0;
+        work_items.extend_from_slice(self.level_items(0));
+        work_levels[1] = work_items.len() as u32;
+
+        for level in 1..provisional_num_levels {
+            let self_items = self.level_items(level);
+            let other_items = other.level_items(level);
+            let lvl = level as usize;
+            work_levels[lvl + 1] = work_levels[lvl] + (self_items.len() + other_items.len()) as u32;
+
+            match (self_items.is_empty(), other_items.is_empty()) {
+                (true, true) => {}
+                (false, true) => work_items.extend_from_slice(self_items),
+                (true, false) => work_items.extend_from_slice(other_items),
+                (false, false) => {
+                    let start = work_items.len();
+                    let len = self_items.len() + other_items.len();
+                    work_items.extend(repeat_n(self_items[0].clone(), len));
+                    merge_sorted_slices(
+                        self_items,
+                        other_items,
+                        &mut work_items[start..],
+                        |a, b| self.comparator.less(a, b),
+                    );
+                }
+            }
+        }
+        work_items
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::kll::NaturalOrder;
+
+    fn assert_consistent<T: Clone + PartialOrd>(sketch: &RawKllSketch<T, NaturalOrder>) {
+        assert_eq!(
+            sum_the_sample_weights(sketch.num_levels, &sketch.levels),
+            sketch.n()
+        );
+        assert_eq!(
+            sketch.levels[sketch.num_levels as usize],
+            compute_total_capacity(sketch.k, DEFAULT_M, sketch.num_levels)
+        );
+        assert_eq!(
+            sketch.items.len(),
+            sketch.levels[sketch.num_levels as usize] as usize
+        );
+        for level in 1..sketch.num_levels {
+            let items = sketch.level_items(level);
+            assert!(items.windows(2).all(|w| w[0] <= w[1]));
+        }
+    }
+
+    #[test]
+    fn test_levels_stay_consistent() {
+        let mut sketch = RawKllSketch::new(MIN_K, NaturalOrder);
+        for i in 0..10_000 {
+            sketch.update(i as f64);
+            assert_consistent(&sketch);
+        }
+    }
+
+    #[test]
+    fn test_update_from_iter_keeps_levels_consistent() {
+        let ascending: Vec<f64> = (0..10_000).map(f64::from).collect();
+        let shuffled: Vec<f64> = (0..10_000)
+            .map(|i| f64::from((i * 7919) % 10_000))
+            .collect();
+        // ascending runs of ten, each starting below the end of the previous one
+        let sawtooth: Vec<f64> = (0..10_000).map(|i| f64::from(i / 10 + i % 10)).collect();
+        for input in [ascending, shuffled, sawtooth] {
+            let mut sketch = RawKllSketch::new(MIN_K, NaturalOrder);
+            for batch in input.chunks(777) {
+                sketch.update_from_iter(batch.iter().copied());
+                assert_consistent(&sketch);
+                if sketch.is_level_zero_sorted {
+                    assert!(sketch.level_items(0).is_sorted());
+                }
+            }
+            assert_eq!(sketch.n(), input.len() as u64);
+            assert_eq!(sketch.min_item(), Some(&0.0));
+            assert_eq!(
+                sketch.max_item(),
+                input.iter().max_by(|a, b| a.total_cmp(b))
+            );
+        }
+    }
+
+    #[test]
+    fn test_update_from_iter_of_ascending_items_sorts_level_zero() {
+        let mut sketch = RawKllSketch::new(MIN_K, NaturalOrder);
+        sketch.update_from_iter((0..3).map(f64::from));
+        sketch.update_from_iter((3..8).map(f64::from));
+        assert!(sketch.is_level_zero_sorted);
+        assert_eq!(
+            sketch.level_items(0),
+            [0.0, 1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0]
+        );
+
+        sketch.update(8.0);
+        assert!(!sketch.is_level_zero_sorted);
+    }
+
+    #[test]
+    fn test_merge_keeps_levels_sorted() {
+        let mut left = RawKllSketch::new(MIN_K, NaturalOrder);
+        let mut right = RawKllSketch::new(MIN_K, NaturalOrder);
+        for i in 0..1000 {
+            left.update(i as f64);
+            right.update((1000 + i) as f64);
+        }
+        left.merge(&right);
+        assert_eq!(left.n(), 2000);
+        assert_consistent(&left);
+    }
+
+    #[test]
+    fn test_owned_items() {
+        let mut sketch = RawKllSketch::new(MIN_K, NaturalOrder);
+        for i in 0..1000 {
+            sketch.update(format!("{i:04}"));
+        }
+        assert_consistent(&sketch);
+        assert_eq!(sketch.min_item().map(String::as_str), Some("0000"));
+        assert_eq!(sketch.max_item().map(String::as_str), Some("0999"));
+    }
+}
@@ -0,0 +1,35 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+/// Preamble size in 4-byte integers for an empty or single-item sketch.
+pub(super) const PREAMBLE_INTS_SHORT: u8 = 2;
+/// Preamble size in 4-byte integers for a sketch with more than one item.
+pub(super) const PREAMBLE_INTS_FULL: u8 = 5;
+
+/// Serial version of the compact format.
+pub(super) const SERIAL_VERSION_1: u8 = 1;
+/// Serial version of the compact format holding a single item.
+pub(super) const SERIAL_VERSION_2: u8 = 2;
+
+pub(super) const FLAGS_IS_EMPTY: u8 = 1 << 0;
+pub(super) const FLAGS_IS_LEVEL_ZERO_SORTED: u8 = 1 << 1;
+pub(super) const FLAGS_IS_SINGLE_ITEM: u8 = 1 << 2;
+
+/// Size of the preamble up to and including the unused byte after `m`.
+pub(super) const SHORT_PREAMBLE_SIZE: usize = 8;
+/// Size of the full preamble before the levels array.
+pub(super) const FULL_PREAMBLE_SIZE: usize = 20;
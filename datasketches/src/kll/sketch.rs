@@ -0,0 +1,689 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::fmt;
+use std::io;
+use std::io::Read;
+use std::io::Write;
+use std::iter::Sum;
+
+#[cfg(feature = "aggregator")]
+use crate::aggregator::ImageUnion;
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::MergeableSketch;
+use crate::common::PartitionBoundaries;
+use crate::common::QuantileBounds;
+use crate::common::QuantileSketch;
+use crate::common::SortedView;
+use crate::error::Error;
+use crate::kll::KllValue;
+use crate::kll::NaturalOrder;
+use crate::kll::helper::DEFAULT_K;
+use crate::kll::raw_sketch::RawKllSketch;
+
+/// KLL sketch for estimating quantiles and ranks of a stream of `f32` or `f64` values.
+///
+/// See the [module level documentation](super) for more.
+#[derive(Debug, Clone)]
+pub struct KllSketch<T: KllValue> {
+    raw: RawKllSketch<T, NaturalOrder>,
+}
+
+impl<T: KllValue> Default for KllSketch<T> {
+    fn default() -> Self {
+        KllSketch::new(DEFAULT_K)
+    }
+}
+
+impl<T: KllValue> KllSketch<T> {
+    /// Creates a KLL sketch with the given value of k.
+    ///
+    /// The parameter k controls the size and accuracy of the sketch: the default of 200 gives a
+    /// normalized rank error of about 1.65%.
+    ///
+    /// # Panics
+    ///
+    /// Panics if k is less than 8.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// let sketch = KllSketch::<f64>::new(100);
+    /// assert_eq!(sketch.k(), 100);
+    /// ```
+    pub fn new(k: u16) -> Self {
+        KllSketch {
+            raw: RawKllSketch::new(k, NaturalOrder),
+        }
+    }
+
+    /// Updates this sketch with the given value.
+    ///
+    /// `NaN` values are ignored.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// let mut sketch = KllSketch::<f64>::default();
+    /// sketch.update(1.0);
+    /// sketch.update(f64::NAN);
+    /// assert_eq!(sketch.n(), 1);
+    /// ```
+    pub fn update(&mut self, item: T) {
+        if item.is_nan() {
+            return;
+        }
+        self.raw.update(item);
+    }
+
+    /// Updates this sketch with every value of `items`, as repeated calls to
+    /// [`update`](Self::update) would.
+    ///
+    /// `NaN` values are ignored. The values are written into the sketch a run at a time, and a
+    /// run of ascending values, as when replaying sorted historical data, is kept sorted so
+    /// that compacting it skips the sort. Values in any other order are accepted too, at about
+    /// the cost of updating them one by one.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// let mut sketch = KllSketch::<f64>::new(200);
+    /// sketch.update_from_iter((0..100_000).map(f64::from));
+    /// assert_eq!(sketch.n(), 100_000);
+    /// assert_eq!(sketch.min_item(), Some(0.0));
+    /// assert_eq!(sketch.max_item(), Some(99_999.0));
+    /// ```
+    pub fn update_from_iter(&mut self, items: impl IntoIterator<Item = T>) {
+        self.raw
+            .update_from_iter(items.into_iter().filter(|item| !item.is_nan()));
+    }
+
+    /// Merges the given sketch into this one.
+    ///
+    /// The sketches may have been configured with different values of k. The result keeps the k
+    /// of this sketch, while its error reflects the smaller k of the two.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// let mut left = KllSketch::<f64>::default();
+    /// let mut right = KllSketch::<f64>::new(100);
+    /// left.update(1.0);
+    /// right.update(2.0);
+    /// left.merge(&right);
+    /// assert_eq!(left.n(), 2);
+    /// assert_eq!(left.max_item(), Some(2.0));
+    /// ```
+    pub fn merge(&mut self, other: &KllSketch<T>) {
+        self.raw.merge(&other.raw);
+    }
+
+    /// Resets this sketch to its empty state with the same k.
+    ///
+    /// The buffer of retained items is kept, so a reused sketch does not allocate again until
+    /// it outgrows the size it had.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// let mut sketch = KllSketch::<f64>::default();
+    /// sketch.extend((0..1000).map(f64::from));
+    /// sketch.reset();
+    /// assert!(sketch.is_empty());
+    /// assert_eq!(sketch.min_item(), None);
+    /// ```
+    pub fn reset(&mut self) {
+        self.raw.reset(self.k());
+    }
+
+    /// Empties this sketch and gives it a new value of k, for reusing sketches from a pool.
+    ///
+    /// Like [`reset`](Self::reset), this keeps the buffer of retained items.
+    ///
+    /// # Panics
+    ///
+    /// Panics if k is less than 8.
+    pub fn reconfigure(&mut self, k: u16) {
+        self.raw.reset(k);
+    }
+
+    /// Returns parameter k that was used to configure this sketch.
+    pub fn k(&self) -> u16 {
+        self.raw.k()
+    }
+
+    /// Returns the normalized rank error of this sketch.
+    ///
+    /// The error is computed from the smallest k among this sketch and the estimation mode
+    /// sketches merged into it. See
+    /// [`normalized_rank_error`](crate::kll::normalized_rank_error) for the meaning of `pmf`.
+    pub fn normalized_rank_error(&self, pmf: bool) -> f64 {
+        self.raw.normalized_rank_error(pmf)
+    }
+
+    /// Returns the length of the input stream.
+    pub fn n(&self) -> u64 {
+        self.raw.n()
+    }
+
+    /// Returns true if this sketch has not seen any data.
+    pub fn is_empty(&self) -> bool {
+        self.raw.is_empty()
+    }
+
+    /// Returns true if this sketch has compacted its input and its results are approximate.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.raw.is_estimation_mode()
+    }
+
+    /// Returns the number of items retained by this sketch.
+    pub fn num_retained(&self) -> usize {
+        self.raw.num_retained()
+    }
+
+    /// Returns the estimated size of the sketch in bytes
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>() + self.raw.heap_size()
+    }
+
+    /// Returns the minimum value seen by this sketch; `None` if the sketch is empty.
+    pub fn min_item(&self) -> Option<T> {
+        self.raw.min_item().copied()
+    }
+
+    /// Returns the maximum value seen by this sketch; `None` if the sketch is empty.
+    pub fn max_item(&self) -> Option<T> {
+        self.raw.max_item().copied()
+    }
+
+    /// Returns a human-readable description of the sketch.
+    ///
+    /// The output follows the layout of the C++ `kll_sketch::to_string(print_levels,
+    /// print_items)`: a summary of k, n, the error, the level count, the retained and capacity
+    /// items and the min and max items, then with `with_levels` the nominal capacity and size
+    /// of every level, and with `with_data` the retained items level by level.
+    ///
+    /// The [`Display`](fmt::Display) implementation prints the summary only.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// let mut sketch = KllSketch::<f64>::new(200);
+    /// sketch.extend((0..1000).map(f64::from));
+    ///
+    /// assert!(sketch.to_string().contains("   N              : 1000"));
+    /// let dump = sketch.to_string_with(true, true);
+    /// assert!(dump.contains("### KLL sketch levels:"));
+    /// assert!(dump.contains("### KLL sketch data:"));
+    /// assert!(dump.contains("   Max item       : 999.0"));
+    /// ```
+    pub fn to_string_with(&self, with_levels: bool, with_data: bool) -> String {
+        let mut out = String::new();
+        self.raw
+            .write_description(&mut out, with_levels, with_data)
+            .expect("writing to a String cannot fail");
+        out
+    }
+
+    /// Returns the approximate normalized rank (from 0 to 1 inclusive) of the given value.
+    ///
+    /// With `inclusive` set, the rank includes the weight of the value itself; otherwise only
+    /// the weight of the smaller values is counted.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the value is `NaN`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// # let mut sketch = KllSketch::<f64>::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// assert_eq!(sketch.rank(2.0, true), Some(0.5));
+    /// assert_eq!(sketch.rank(2.0, false), Some(0.25));
+    /// ```
+    pub fn rank(&self, item: T, inclusive: bool) -> Option<f64> {
+        assert!(!item.is_nan(), "item must not be NaN");
+        self.raw.rank(&item, inclusive)
+    }
+
+    /// Returns the approximate value at the given normalized rank.
+    ///
+    /// With `inclusive` set, the result is the smallest value whose inclusive rank is at least
+    /// the given rank; otherwise it is the smallest value whose exclusive rank is greater than
+    /// it.
+    ///
+    /// Ranks 0 and 1 always return the exact minimum and maximum values seen by the sketch.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if rank is not in [0.0, 1.0].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// # let mut sketch = KllSketch::<f64>::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// assert_eq!(sketch.quantile(0.5, true), Some(2.0));
+    /// assert_eq!(sketch.quantile(0.5, false), Some(3.0));
+    /// ```
+    pub fn quantile(&self, rank: f64, inclusive: bool) -> Option<T> {
+        self.raw.quantile(rank, inclusive)
+    }
+
+    /// Returns the quantile of the given normalized rank together with the values at the
+    /// bounds of the rank.
+    ///
+    /// The rank bounds are `rank ± ε`, clamped to `[0.0, 1.0]`, where `ε` is the single-sided
+    /// [`normalized_rank_error`](Self::normalized_rank_error), which holds with 99% confidence.
+    /// Until the sketch first compacts, its ranks are exact and all three values are the same.
+    /// See [`quantile`](Self::quantile) for the meaning of `inclusive`.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if rank is not in [0.0, 1.0].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// let mut sketch = KllSketch::<f64>::new(200);
+    /// for i in 0..100_000 {
+    ///     sketch.update(i as f64);
+    /// }
+    /// let p99 = sketch.quantile_with_rank_bounds(0.99, true).unwrap();
+    /// assert!(p99.lower <= p99.quantile && p99.quantile <= p99.upper);
+    /// assert!(p99.lower <= 99_000.0 && 99_000.0 <= p99.upper);
+    /// ```
+    pub fn quantile_with_rank_bounds(
+        &self,
+        rank: f64,
+        inclusive: bool,
+    ) -> Option<QuantileBounds<T>> {
+        self.raw.quantile_with_rank_bounds(rank, inclusive)
+    }
+
+    /// Returns an approximation to the Cumulative Distribution Function (CDF), which is the
+    /// cumulative analog of the PMF, of the input stream given a set of split points.
+    ///
+    /// # Arguments
+    ///
+    /// * `split_points`: An array of _m_ unique, monotonically increasing values that divide the
+    ///   input domain into _m+1_ consecutive disjoint intervals.
+    /// * `inclusive`: If true, each interval includes its upper split point; otherwise it includes
+    ///   its lower split point.
+    ///
+    /// # Returns
+    ///
+    /// An array of m+1 doubles: the ranks of the split points followed by 1.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `split_points` is not unique, not monotonically increasing, or contains `NaN`
+    /// values.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// # let mut sketch = KllSketch::<f64>::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// let cdf = sketch.cdf(&[2.0, 3.0], true).unwrap();
+    /// assert_eq!(cdf, [0.5, 0.75, 1.0]);
+    /// ```
+    pub fn cdf(&self, split_points: &[T], inclusive: bool) -> Option<Vec<f64>> {
+        check_split_points(split_points);
+        self.raw.cdf(split_points, inclusive)
+    }
+
+    /// Returns an approximation to the Probability Mass Function (PMF) of the input stream
+    /// given a set of split points.
+    ///
+    /// # Arguments
+    ///
+    /// * `split_points`: An array of _m_ unique, monotonically increasing values that divide the
+    ///   input domain into _m+1_ consecutive disjoint intervals (bins).
+    /// * `inclusive`: If true, each interval includes its upper split point; otherwise it includes
+    ///   its lower split point.
+    ///
+    /// # Returns
+    ///
+    /// An array of m+1 doubles each of which is an approximation to the fraction of the input
+    /// stream values (the mass) that fall into one of those intervals.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `split_points` is not unique, not monotonically increasing, or contains `NaN`
+    /// values.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// # let mut sketch = KllSketch::<f64>::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// let pmf = sketch.pmf(&[2.0, 3.0], true).unwrap();
+    /// assert_eq!(pmf, [0.5, 0.25, 0.25]);
+    /// ```
+    pub fn pmf(&self, split_points: &[T], inclusive: bool) -> Option<Vec<f64>> {
+        check_split_points(split_points);
+        self.raw.pmf(split_points, inclusive)
+    }
+
+    /// Returns boundaries that split the input stream into `num_parts` parts of roughly equal
+    /// size, like Java's `getPartitionBoundariesFromNumParts`.
+    ///
+    /// The first boundary is the minimum and the last the maximum value seen. With `inclusive`
+    /// set, each part includes its upper boundary; otherwise it includes its lower boundary.
+    /// See [`PartitionBoundaries`] for the ranks and sizes of the parts.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `num_parts` is 0.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// let mut sketch = KllSketch::<f64>::default();
+    /// sketch.extend((1..=100).map(f64::from));
+    ///
+    /// let partition = sketch.partition_boundaries(4, true).unwrap();
+    /// assert_eq!(partition.boundaries(), [1.0, 25.0, 50.0, 75.0, 100.0]);
+    /// assert_eq!(partition.part_sizes(), [25, 25, 25, 25]);
+    /// ```
+    pub fn partition_boundaries(
+        &self,
+        num_parts: usize,
+        inclusive: bool,
+    ) -> Option<PartitionBoundaries<T>> {
+        self.raw.partition_boundaries(num_parts, inclusive)
+    }
+
+    /// Returns the retained items in ascending order together with their weights.
+    ///
+    /// The weight of an item is the number of stream items it stands for; iterating the
+    /// [`SortedView`] also yields the cumulative weight. The view of an empty sketch is empty.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// # let mut sketch = KllSketch::<f64>::default();
+    /// # for value in [3.0, 1.0, 2.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// let view = sketch.sorted_view();
+    /// let entries: Vec<_> = view.iter().map(|(item, w, c)| (*item, w, c)).collect();
+    /// assert_eq!(entries, [(1.0, 1, 1), (2.0, 1, 2), (3.0, 1, 3)]);
+    /// ```
+    pub fn sorted_view(&self) -> SortedView<T> {
+        self.raw.sorted_view()
+    }
+
+    /// Serializes this sketch to bytes in the compact format shared with the Java and C++
+    /// implementations.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// # let mut sketch = KllSketch::<f64>::default();
+    /// # sketch.update(1.0);
+    /// let bytes = sketch.serialize();
+    /// let decoded = KllSketch::<f64>::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.max_item(), Some(1.0));
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        self.raw
+            .serialize_with(|_| T::SERIALIZED_SIZE, |item, bytes| item.write(bytes))
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        self.raw.serialized_size_with(|_| T::SERIALIZED_SIZE)
+    }
+
+    /// Serializes this sketch into `buf` in the same format as [`serialize`](Self::serialize),
+    /// returning the number of bytes written.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `buf` is shorter than [`serialized_size_bytes`].
+    ///
+    /// [`serialized_size_bytes`]: Self::serialized_size_bytes
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// let mut sketch = KllSketch::<f64>::default();
+    /// sketch.update(1.0);
+    ///
+    /// let mut buf = vec![0; sketch.serialized_size_bytes()];
+    /// sketch.serialize_into(&mut buf).unwrap();
+    /// assert_eq!(buf, sketch.serialize());
+    /// ```
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| {
+            self.raw.write_with(bytes, |item, bytes| item.write(bytes))
+        })
+    }
+
+    /// Writes the serialized sketch to `writer`.
+    ///
+    /// This streams the image [`serialize`](Self::serialize) returns in chunks instead of
+    /// assembling it in memory first.
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| {
+            self.raw.write_with(bytes, |item, bytes| item.write(bytes))
+        })
+    }
+
+    /// Deserializes a sketch from bytes in the compact format shared with the Java and C++
+    /// implementations.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketch;
+    /// # let mut sketch = KllSketch::<f64>::default();
+    /// # sketch.update(1.0);
+    /// # sketch.update(2.0);
+    /// # let bytes = sketch.serialize();
+    /// let decoded = KllSketch::<f64>::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.n(), 2);
+    /// ```
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// Exactly the bytes of one image are consumed, so several sketches can be read back from
+    /// the same stream.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    fn read_image(cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        let raw = RawKllSketch::read_with(cursor, NaturalOrder, |cursor, tag| {
+            let item = T::read(cursor).map_err(insufficient_data(tag))?;
+            if item.is_nan() {
+                return Err(Error::deserial(format!("{tag} must not be NaN")));
+            }
+            Ok(item)
+        })?;
+        Ok(KllSketch { raw })
+    }
+}
+
+fn check_split_points<T: KllValue>(split_points: &[T]) {
+    let len = split_points.len();
+    if len == 1 && split_points[0].is_nan() {
+        panic!("split_points must not contain NaN values: {split_points:?}");
+    }
+    for i in 0..len.saturating_sub(1) {
+        if split_points[i] < split_points[i + 1] {
+            // we must use this positive condition because NaN comparisons are always false
+            continue;
+        }
+        panic!("split_points must be unique and monotonically increasing: {split_points:?}");
+    }
+}
+
+impl<T: KllValue> fmt::Display for KllSketch<T> {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        self.raw.write_description(f, false, false)
+    }
+}
+
+/// Updates the sketch with every item of the iterator. `NaN` items are ignored.
+impl<T: KllValue> Extend<T> for KllSketch<T> {
+    fn extend<I: IntoIterator<Item = T>>(&mut self, iter: I) {
+        self.update_from_iter(iter);
+    }
+}
+
+/// Collects the items into a sketch with the default k. `NaN` items are ignored.
+impl<T: KllValue> FromIterator<T> for KllSketch<T> {
+    fn from_iter<I: IntoIterator<Item = T>>(iter: I) -> Self {
+        let mut sketch = KllSketch::default();
+        sketch.extend(iter);
+        sketch
+    }
+}
+
+impl<T: KllValue> QuantileSketch for KllSketch<T> {
+    type Item = T;
+
+    fn n(&self) -> u64 {
+        self.n()
+    }
+
+    fn is_exact(&self) -> bool {
+        !self.is_estimation_mode()
+    }
+
+    fn is_empty(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn min_item(&self) -> Option<T> {
+        self.min_item()
+    }
+
+    fn max_item(&self) -> Option<T> {
+        self.max_item()
+    }
+
+    fn rank(&self, item: T, inclusive: bool) -> Option<f64> {
+        self.rank(item, inclusive)
+    }
+
+    fn quantile(&self, rank: f64, inclusive: bool) -> Option<T> {
+        self.quantile(rank, inclusive)
+    }
+}
+
+impl<T: KllValue> MergeableSketch for KllSketch<T> {
+    fn merge(&mut self, other: &Self) -> Result<(), Error> {
+        self.merge(other);
+        Ok(())
+    }
+}
+
+/// Merges the sketchs into the first one, or returns an empty default sketch when there are none.
+impl<T: KllValue> Sum for KllSketch<T> {
+    fn sum<I: Iterator<Item = Self>>(mut iter: I) -> Self {
+        let mut result = iter.next().unwrap_or_default();
+        for other in iter {
+            result.merge(&other);
+        }
+        result
+    }
+}
+
+/// Merges the sketchs into a copy of the first one, as the `Sum<KllSketch<T>>` impl does.
+impl<'a, T: KllValue> Sum<&'a KllSketch<T>> for KllSketch<T> {
+    fn sum<I: Iterator<Item = &'a Self>>(mut iter: I) -> Self {
+        let mut result = iter.next().cloned().unwrap_or_default();
+        for other in iter {
+            result.merge(other);
+        }
+        result
+    }
+}
+
+/// Deserializes the image and merges it, as [`KllSketch::merge`] does.
+#[cfg(feature = "aggregator")]
+impl<T: KllValue> ImageUnion for KllSketch<T> {
+    fn update_image(&mut self, image: &[u8]) -> Result<(), Error> {
+        self.merge(&KllSketch::deserialize(image)?);
+        Ok(())
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!([T: KllValue] KllSketch<T>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([T: KllValue] KllSketch<T>);
+impl_fingerprint_via_image!([T: KllValue] KllSketch<T>);
@@ -0,0 +1,172 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::cmp::Ordering;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::error::Error;
+
+/// Marker trait identifying the item types supported by [`KllSketch`](crate::kll::KllSketch).
+///
+/// Implemented for `f32` and `f64`, whose serialized images match the `KllFloatsSketch` and
+/// `KllDoublesSketch` of the Java implementation respectively.
+pub trait KllValue: private::KllValue {}
+
+mod private {
+    use std::fmt::Debug;
+
+    use crate::codec::SketchBytes;
+    use crate::codec::SketchSlice;
+
+    pub trait KllValue: Sized + Copy + PartialOrd + Debug {
+        /// The number of bytes one serialized item occupies.
+        const SERIALIZED_SIZE: usize;
+
+        fn is_nan(self) -> bool;
+        fn write(self, bytes: &mut SketchBytes);
+        fn read(cursor: &mut SketchSlice<'_>) -> std::io::Result<Self>;
+    }
+}
+
+macro_rules! impl_float {
+    ($name:ty, $read:ident, $write:ident) => {
+        impl private::KllValue for $name {
+            const SERIALIZED_SIZE: usize = size_of::<$name>();
+
+            #[inline(always)]
+            fn is_nan(self) -> bool {
+                <$name>::is_nan(self)
+            }
+
+            #[inline(always)]
+            fn write(self, bytes: &mut SketchBytes) {
+                bytes.$write(self);
+            }
+
+            #[inline(always)]
+            fn read(cursor: &mut SketchSlice<'_>) -> std::io::Result<Self> {
+                cursor.$read()
+            }
+        }
+
+        impl KllValue for $name {}
+    };
+}
+
+impl_float!(f32, read_f32_le, write_f32_le);
+impl_float!(f64, read_f64_le, write_f64_le);
+
+/// Defines the total order of the items retained by a
+/// [`KllItemsSketch`](crate::kll::KllItemsSketch).
+///
+/// The comparator is supplied as an object rather than derived from the item type, so the same
+/// item type can be sketched under different orders, and the order can carry configuration such
+/// as a collation. It must be consistent: for any items `a`, `b` and `c`, `less(a, b)` and
+/// `less(b, c)` imply `less(a, c)`, and `less(a, b)` implies `!less(b, a)`.
+///
+/// Closures of the form `Fn(&T, &T) -> Ordering` implement this trait.
+pub trait KllComparator<T> {
+    /// Returns true if `a` is strictly less than `b`.
+    fn less(&self, a: &T, b: &T) -> bool;
+}
+
+/// Comparator ordering items by their [`PartialOrd`] implementation.
+///
+/// This is the default comparator of [`KllItemsSketch`](crate::kll::KllItemsSketch). Items that
+/// are incomparable with each other, such as floating point `NaN`, have no well-defined ranks.
+#[derive(Default, Debug, Clone, Copy)]
+pub struct NaturalOrder;
+
+impl<T: PartialOrd> KllComparator<T> for NaturalOrder {
+    fn less(&self, a: &T, b: &T) -> bool {
+        a < b
+    }
+}
+
+impl<T, F> KllComparator<T> for F
+where
+    F: Fn(&T, &T) -> Ordering,
+{
+    fn less(&self, a: &T, b: &T) -> bool {
+        self(a, b) == Ordering::Less
+    }
+}
+
+/// Trait for serializing and deserializing the items of a
+/// [`KllItemsSketch`](crate::kll::KllItemsSketch).
+///
+/// The `String` implementation writes a 4-byte little-endian length followed by the UTF-8 bytes,
+/// which matches `ArrayOfStringsSerDe` in Java and the default string serde in C++.
+pub trait KllItemValue: Sized {
+    /// Returns the size in bytes required to serialize the given item.
+    fn serialize_size(item: &Self) -> usize;
+    /// Serializes the item into the given byte buffer.
+    fn serialize_value(&self, bytes: &mut SketchBytes);
+    /// Deserializes an item from the given byte cursor.
+    fn deserialize_value(cursor: &mut SketchSlice<'_>) -> Result<Self, Error>;
+}
+
+impl KllItemValue for String {
+    fn serialize_size(item: &Self) -> usize {
+        size_of::<u32>() + item.len()
+    }
+
+    fn serialize_value(&self, bytes: &mut SketchBytes) {
+        let bs = self.as_bytes();
+        bytes.write_u32_le(bs.len() as u32);
+        bytes.write(bs);
+    }
+
+    fn deserialize_value(cursor: &mut SketchSlice<'_>) -> Result<Self, Error> {
+        let len = cursor.read_u32_le().map_err(|_| {
+            Error::insufficient_data("failed to read string item length".to_string())
+        })?;
+
+        let slice = cursor.read_bytes(len as usize).map_err(|_| {
+            Error::insufficient_data("failed to read string item bytes".to_string())
+        })?;
+
+        String::from_utf8(slice)
+            .map_err(|_| Error::deserial("invalid UTF-8 string payload".to_string()))
+    }
+}
+
+macro_rules! impl_primitive {
+    ($name:ty, $read:ident, $write:ident) => {
+        impl KllItemValue for $name {
+            fn serialize_size(_item: &Self) -> usize {
+                size_of::<$name>()
+            }
+
+            fn serialize_value(&self, bytes: &mut SketchBytes) {
+                bytes.$write(*self);
+            }
+
+            fn deserialize_value(cursor: &mut SketchSlice<'_>) -> Result<Self, Error> {
+                cursor.$read().map_err(|_| {
+                    Error::insufficient_data(
+                        concat!("failed to read ", stringify!($name), " item bytes").to_string(),
+                    )
+                })
+            }
+        }
+    };
+}
+
+impl_primitive!(i64, read_i64_le, write_i64_le);
+impl_primitive!(u64, read_u64_le, write_u64_le);
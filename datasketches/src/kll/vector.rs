@@ -0,0 +1,303 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::error::Error;
+use crate::kll::KllSketch;
+use crate::kll::KllValue;
+
+/// A fixed number of KLL sketches with the same k, one per dimension of a stream of vectors.
+///
+/// Each update takes one value per dimension, so the distributions of several features can be
+/// tracked with a single call per record, like the `vector_of_kll` sketches of the DataSketches
+/// Python bindings. The sketch of every dimension can also be queried on its own through
+/// [`sketch`](Self::sketch).
+///
+/// # Serialization
+///
+/// [`serialize`](Self::serialize) writes the number of dimensions as a little-endian `u32`
+/// followed by the compact image of each sketch in dimension order. The individual images are
+/// those of [`KllSketch::serialize`], but the combined layout is specific to this library.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::kll::KllSketchVector;
+/// let mut sketches = KllSketchVector::<f64>::new(200, 2);
+/// for i in 0..1000 {
+///     sketches.update(&[i as f64, -(i as f64)]);
+/// }
+/// let medians: Vec<_> = sketches
+///     .quantiles(0.5, true)
+///     .into_iter()
+///     .flatten()
+///     .collect();
+/// assert!((450.0..=550.0).contains(&medians[0]));
+/// assert!((-550.0..=-450.0).contains(&medians[1]));
+/// ```
+#[derive(Debug, Clone)]
+pub struct KllSketchVector<T: KllValue> {
+    sketches: Vec<KllSketch<T>>,
+}
+
+impl<T: KllValue> KllSketchVector<T> {
+    /// Creates `num_dimensions` empty KLL sketches with the given value of k.
+    ///
+    /// # Panics
+    ///
+    /// Panics if k is less than 8 or `num_dimensions` is 0.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketchVector;
+    /// let sketches = KllSketchVector::<f32>::new(100, 3);
+    /// assert_eq!(sketches.k(), 100);
+    /// assert_eq!(sketches.num_dimensions(), 3);
+    /// ```
+    pub fn new(k: u16, num_dimensions: usize) -> Self {
+        assert!(num_dimensions > 0, "num_dimensions must be at least 1");
+        KllSketchVector {
+            sketches: vec![KllSketch::new(k); num_dimensions],
+        }
+    }
+
+    /// Updates the sketch of each dimension with the value at the same position.
+    ///
+    /// `NaN` values are ignored, so the sketches of different dimensions may see different
+    /// numbers of values.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `values` does not have exactly one value per dimension.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketchVector;
+    /// let mut sketches = KllSketchVector::<f64>::new(200, 2);
+    /// sketches.update(&[1.0, f64::NAN]);
+    /// assert_eq!(sketches.sketch(0).n(), 1);
+    /// assert!(sketches.sketch(1).is_empty());
+    /// ```
+    pub fn update(&mut self, values: &[T]) {
+        assert_eq!(
+            values.len(),
+            self.sketches.len(),
+            "values must have one value per dimension"
+        );
+        for (sketch, &value) in self.sketches.iter_mut().zip(values) {
+            sketch.update(value);
+        }
+    }
+
+    /// Merges the sketch of each dimension of `other` into the sketch of the same dimension.
+    ///
+    /// As with [`KllSketch::merge`], the sketches may have been configured with different
+    /// values of k.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `other` has a different number of dimensions.
+    pub fn merge(&mut self, other: &KllSketchVector<T>) {
+        assert_eq!(
+            self.sketches.len(),
+            other.sketches.len(),
+            "cannot merge sketch vectors with different numbers of dimensions"
+        );
+        for (sketch, other) in self.sketches.iter_mut().zip(&other.sketches) {
+            sketch.merge(other);
+        }
+    }
+
+    /// Returns parameter k that was used to configure the sketches.
+    pub fn k(&self) -> u16 {
+        self.sketches[0].k()
+    }
+
+    /// Returns the number of dimensions, which is the number of sketches.
+    pub fn num_dimensions(&self) -> usize {
+        self.sketches.len()
+    }
+
+    /// Returns true if none of the sketches has seen a value.
+    pub fn is_empty(&self) -> bool {
+        self.sketches.iter().all(KllSketch::is_empty)
+    }
+
+    /// Returns the sketch of the given dimension.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `dimension` is not less than [`num_dimensions`](Self::num_dimensions).
+    pub fn sketch(&self, dimension: usize) -> &KllSketch<T> {
+        &self.sketches[dimension]
+    }
+
+    /// Returns the sketches of all dimensions in order.
+    pub fn sketches(&self) -> &[KllSketch<T>] {
+        &self.sketches
+    }
+
+    /// Returns the approximate normalized rank in each dimension of the value at the same
+    /// position.
+    ///
+    /// The rank of an empty dimension is `None`.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `values` does not have exactly one value per dimension.
+    pub fn ranks(&self, values: &[T], inclusive: bool) -> Vec<Option<f64>> {
+        assert_eq!(
+            values.len(),
+            self.sketches.len(),
+            "values must have one value per dimension"
+        );
+        self.sketches
+            .iter()
+            .zip(values)
+            .map(|(sketch, &value)| sketch.rank(value, inclusive))
+            .collect()
+    }
+
+    /// Returns the approximate quantile of each dimension at the given normalized rank.
+    ///
+    /// The quantile of an empty dimension is `None`.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `rank` is not in `[0.0, 1.0]`.
+    pub fn quantiles(&self, rank: f64, inclusive: bool) -> Vec<Option<T>> {
+        self.sketches
+            .iter()
+            .map(|sketch| sketch.quantile(rank, inclusive))
+            .collect()
+    }
+
+    /// Merges the sketches of the given dimensions into a single sketch with the same k.
+    ///
+    /// # Panics
+    ///
+    /// Panics if a dimension is not less than [`num_dimensions`](Self::num_dimensions).
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketchVector;
+    /// let mut sketches = KllSketchVector::<f64>::new(200, 3);
+    /// sketches.update(&[1.0, 2.0, 3.0]);
+    /// let collapsed = sketches.collapse([0, 2]);
+    /// assert_eq!(collapsed.n(), 2);
+    /// assert_eq!(collapsed.max_item(), Some(3.0));
+    /// ```
+    pub fn collapse(&self, dimensions: impl IntoIterator<Item = usize>) -> KllSketch<T> {
+        let mut result = KllSketch::new(self.k());
+        for dimension in dimensions {
+            result.merge(&self.sketches[dimension]);
+        }
+        result
+    }
+
+    /// Returns the estimated size of the sketches in bytes
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>()
+            + self
+                .sketches
+                .iter()
+                .map(KllSketch::estimated_size)
+                .sum::<usize>()
+    }
+
+    /// Serializes the sketches into one image.
+    ///
+    /// See the [type level documentation](Self#serialization) for the layout.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::kll::KllSketchVector;
+    /// let mut sketches = KllSketchVector::<f64>::new(200, 2);
+    /// sketches.update(&[1.0, 2.0]);
+    /// let bytes = sketches.serialize();
+    /// assert_eq!(bytes.len(), sketches.serialized_size_bytes());
+    ///
+    /// let decoded = KllSketchVector::<f64>::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.sketch(1).min_item(), Some(2.0));
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        bytes.write_u32_le(self.sketches.len() as u32);
+        for sketch in &self.sketches {
+            bytes.write(&sketch.serialize());
+        }
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        size_of::<u32>()
+            + self
+                .sketches
+                .iter()
+                .map(KllSketch::serialized_size_bytes)
+                .sum::<usize>()
+    }
+
+    /// Deserializes sketches written by [`serialize`](Self::serialize).
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the image holds no sketches, if any sketch image is invalid, or if
+    /// the sketches do not share the same k.
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        let mut cursor = SketchSlice::new(bytes);
+        let num_dimensions = cursor
+            .read_u32_le()
+            .map_err(insufficient_data("num_dimensions"))?;
+        if num_dimensions == 0 {
+            return Err(Error::deserial("num_dimensions must be at least 1"));
+        }
+
+        let mut images = cursor.remaining();
+        let mut sketches = Vec::with_capacity(cursor.capacity_hint(num_dimensions as usize, 8));
+        for _ in 0..num_dimensions {
+            // each read consumes exactly one image
+            sketches.push(KllSketch::read_from(&mut images)?);
+        }
+        let k = sketches[0].k();
+        if let Some(sketch) = sketches.iter().find(|sketch| sketch.k() != k) {
+            return Err(Error::deserial(format!(
+                "all sketches must have the same k: expected {k}, got {}",
+                sketch.k()
+            )));
+        }
+        Ok(KllSketchVector { sketches })
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!([T: KllValue] KllSketchVector<T>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([T: KllValue] KllSketchVector<T>);
+impl_fingerprint_via_image!([T: KllValue] KllSketchVector<T>);
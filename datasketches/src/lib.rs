@@ -22,14 +22,22 @@
 //! systems that must deal with massive data.
 //!
 //! This library is divided into modules that constitute distinct groups of functionality.
+//!
+//! Each sketch family has a module behind a Cargo feature of the same name, such as `hll`,
+//! `theta`, `bloom` or `quantiles`, and none is enabled by default, so that only the enabled
+//! sketches are compiled:
+//!
+//! ```toml
+//! [dependencies]
+//! datasketches = { version = "0.3", features = ["hll", "theta"] }
+//! ```
+//!
+//! The [`prelude`] re-exports the common types and traits of the enabled families, and the
+//! [`common`], [`error`] and [`hash`] modules are shared by all of them.
 
 #![cfg_attr(docsrs, feature(doc_cfg))]
 #![deny(missing_docs)]
 
-// See https://github.com/apache/datasketches-rust/issues/28 for more information.
-#[cfg(target_endian = "big")]
-compile_error!("datasketches does not support big-endian targets");
-
 // sketches modules
 #[cfg(feature = "bloom")]
 pub mod bloom;
@@ -37,10 +45,24 @@ pub mod bloom;
 pub mod countmin;
 #[cfg(feature = "cpc")]
 pub mod cpc;
+#[cfg(feature = "density")]
+pub mod density;
 #[cfg(feature = "frequencies")]
 pub mod frequencies;
 #[cfg(feature = "hll")]
 pub mod hll;
+#[cfg(feature = "kll")]
+pub mod kll;
+#[cfg(feature = "matrix")]
+pub mod matrix;
+#[cfg(feature = "quantiles")]
+pub mod quantiles;
+#[cfg(feature = "quotient")]
+pub mod quotient;
+#[cfg(feature = "req")]
+pub mod req;
+#[cfg(feature = "sampling")]
+pub mod sampling;
 #[cfg(feature = "tdigest")]
 pub mod tdigest;
 #[cfg(feature = "theta")]
@@ -51,11 +73,17 @@ pub mod thetacommon;
 #[cfg(feature = "tuple")]
 pub mod tuple;
 
+// utility modules
+#[cfg(feature = "aggregator")]
+pub mod aggregator;
+
 // common modules
 pub mod codec;
 pub mod common;
 pub mod error;
+pub mod hash;
 pub mod hash_value;
-
-// private internal modules
-mod hash;
+pub mod limits;
+pub mod metadata;
+pub mod preamble;
+pub mod prelude;
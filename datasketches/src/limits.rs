@@ -0,0 +1,269 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Worst-case sizes of sketch configurations
+//!
+//! [`for_family`] returns the [`Limits`] of a family ID, as [`preamble`](crate::preamble)
+//! reports it, and a configuration: the most bytes an image of the sketch takes, and the
+//! most its `estimated_size` reports once the sketch is full. A system with a fixed memory or
+//! storage budget, such as a function runtime or an embedded device, can check every
+//! configuration it accepts against its budget up front, instead of measuring sketches
+//! after they grew.
+//!
+//! The families with limits are those whose size is bounded by their configuration alone
+//! and whose feature is enabled; [`supported_families`] lists them:
+//!
+//! | Family ID | Family               | Parameters                  |
+//! |-----------|----------------------|-----------------------------|
+//! | 2         | Theta direct sketch  | `lg_k`                      |
+//! | 3         | compact Theta sketch | `lg_k`                      |
+//! | 7         | HLL                  | `lg_k`, `hll_type`          |
+//! | 16        | CPC                  | `lg_k`                      |
+//! | 18        | Count-Min            | `num_hashes`, `num_buckets` |
+//! | 21        | Bloom filter         | `num_bits`                  |
+//!
+//! The quantile sketches and the frequent items sketch grow with the number of items or
+//! their sizes, so they have no limits of their own.
+//!
+//! # Examples
+//!
+//! ```
+//! # use datasketches::hll::HllType;
+//! # use datasketches::limits;
+//! # use datasketches::limits::Params;
+//! let mut params = Params::default();
+//! params.lg_k = Some(12);
+//! params.hll_type = Some(HllType::Hll8);
+//!
+//! let limits = limits::for_family(7, &params).unwrap();
+//! assert_eq!(limits.max_serialized_bytes, 40 + 4096);
+//! assert!(limits.is_strict);
+//! ```
+
+#[cfg(feature = "bloom")]
+use crate::bloom::BloomFilter;
+#[cfg(feature = "bloom")]
+use crate::bloom::BloomFilterBuilder;
+#[cfg(any(
+    feature = "bloom",
+    feature = "countmin",
+    feature = "cpc",
+    feature = "hll",
+    feature = "theta"
+))]
+use crate::codec::family::Family;
+#[cfg(feature = "countmin")]
+use crate::countmin::CountMinSketch;
+#[cfg(feature = "cpc")]
+use crate::cpc::CpcSketch;
+use crate::error::Error;
+#[cfg(feature = "hll")]
+use crate::hll::HllSketch;
+#[cfg(feature = "hll")]
+use crate::hll::HllType;
+#[cfg(feature = "theta")]
+use crate::theta::CompactThetaSketch;
+#[cfg(feature = "theta")]
+use crate::theta::DirectThetaSketch;
+#[cfg(feature = "theta")]
+use crate::theta::ThetaSketch;
+
+/// The configuration the limits of a family are computed for.
+///
+/// Each family reads the parameters it needs, listed in the [module documentation](self), and
+/// ignores the others.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct Params {
+    /// The log2 of the nominal number of entries or registers of the HLL, CPC and Theta
+    /// sketches.
+    pub lg_k: Option<u8>,
+    /// The target type of the HLL sketches.
+    #[cfg(feature = "hll")]
+    pub hll_type: Option<HllType>,
+    /// The number of hash functions of the Count-Min sketches.
+    pub num_hashes: Option<u8>,
+    /// The number of buckets per hash function of the Count-Min sketches.
+    pub num_buckets: Option<u32>,
+    /// The number of bits of the Bloom filters.
+    pub num_bits: Option<u64>,
+}
+
+/// The worst-case sizes of a family and configuration.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+#[non_exhaustive]
+pub struct Limits {
+    /// The most bytes the image of a sketch takes, in the largest of its serialized forms.
+    pub max_serialized_bytes: usize,
+    /// The most bytes `estimated_size` reports for a sketch, if it is bounded.
+    ///
+    /// It counts the heap the sketch holds between updates; an update that grows a table
+    /// briefly holds both the old and the new table. The Count-Min size is that of `i64`
+    /// counts.
+    pub max_estimated_size: Option<usize>,
+    /// Whether the limits hold for every sketch.
+    ///
+    /// The CPC image size is the empirical 99.9th percentile, and the HLL4 limits assume that
+    /// the auxiliary exception table keeps its initial size, which it outgrows only in
+    /// extremely rare cases.
+    pub is_strict: bool,
+}
+
+/// Returns the family IDs [`for_family`] has limits for, in ascending order.
+pub fn supported_families() -> Vec<u8> {
+    // the family constants exist only with their features, so the IDs are spelled out
+    let families: [(bool, &[u8]); 5] = [
+        (cfg!(feature = "theta"), &[2, 3]),
+        (cfg!(feature = "hll"), &[7]),
+        (cfg!(feature = "cpc"), &[16]),
+        (cfg!(feature = "countmin"), &[18]),
+        (cfg!(feature = "bloom"), &[21]),
+    ];
+    families
+        .into_iter()
+        .filter(|&(enabled, _)| enabled)
+        .flat_map(|(_, ids)| ids.iter().copied())
+        .collect()
+}
+
+/// Returns the limits of the sketches of `family_id` configured with `params`.
+///
+/// # Errors
+///
+/// Returns an error if the family has no limits, see [`supported_families`], or if a
+/// parameter it needs is not set.
+///
+/// # Panics
+///
+/// Panics if a parameter is out of the range the sketch accepts, as its constructor does.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::limits;
+/// # use datasketches::limits::Params;
+/// let mut params = Params::default();
+/// assert!(limits::for_family(3, &params).is_err());
+///
+/// params.lg_k = Some(10);
+/// let limits = limits::for_family(3, &params).unwrap();
+/// assert_eq!(limits.max_serialized_bytes, 24 + 8 * 1920);
+///
+/// // KLL sketches grow with the number of items
+/// assert!(limits::for_family(15, &params).is_err());
+/// ```
+#[cfg_attr(
+    not(any(
+        feature = "bloom",
+        feature = "countmin",
+        feature = "cpc",
+        feature = "hll",
+        feature = "theta"
+    )),
+    allow(unused_variables)
+)]
+pub fn for_family(family_id: u8, params: &Params) -> Result<Limits, Error> {
+    match family_id {
+        #[cfg(feature = "theta")]
+        id if id == Family::QUICKSELECT.id => {
+            let lg_k = require(params.lg_k, "lg_k")?;
+            Ok(Limits {
+                max_serialized_bytes: DirectThetaSketch::required_size_bytes(lg_k),
+                max_estimated_size: Some(ThetaSketch::max_estimated_size(lg_k)),
+                is_strict: true,
+            })
+        }
+        #[cfg(feature = "theta")]
+        id if id == Family::THETA.id => {
+            let lg_k = require(params.lg_k, "lg_k")?;
+            // the capacity of the hash vector depends on what the sketch was compacted from
+            Ok(Limits {
+                max_serialized_bytes: CompactThetaSketch::max_serialized_bytes(lg_k),
+                max_estimated_size: None,
+                is_strict: true,
+            })
+        }
+        #[cfg(feature = "hll")]
+        id if id == Family::HLL.id => {
+            let lg_k = require(params.lg_k, "lg_k")?;
+            let hll_type = require(params.hll_type, "hll_type")?;
+            Ok(Limits {
+                max_serialized_bytes: HllSketch::max_updatable_serialized_bytes(lg_k, hll_type),
+                max_estimated_size: Some(HllSketch::max_estimated_size(lg_k, hll_type)),
+                is_strict: hll_type != HllType::Hll4,
+            })
+        }
+        #[cfg(feature = "cpc")]
+        id if id == Family::CPC.id => {
+            let lg_k = require(params.lg_k, "lg_k")?;
+            Ok(Limits {
+                max_serialized_bytes: CpcSketch::max_serialized_bytes(lg_k),
+                max_estimated_size: None,
+                is_strict: false,
+            })
+        }
+        #[cfg(feature = "countmin")]
+        id if id == Family::COUNTMIN.id => {
+            let num_hashes = require(params.num_hashes, "num_hashes")?;
+            let num_buckets = require(params.num_buckets, "num_buckets")?;
+            Ok(Limits {
+                max_serialized_bytes: CountMinSketch::<i64>::max_serialized_bytes(
+                    num_hashes,
+                    num_buckets,
+                ),
+                max_estimated_size: Some(CountMinSketch::<i64>::max_estimated_size(
+                    num_hashes,
+                    num_buckets,
+                )),
+                is_strict: true,
+            })
+        }
+        #[cfg(feature = "bloom")]
+        id if id == Family::BLOOMFILTER.id => {
+            let num_bits = require(params.num_bits, "num_bits")?;
+            assert!(
+                (BloomFilterBuilder::MIN_NUM_BITS..=BloomFilterBuilder::MAX_NUM_BITS)
+                    .contains(&num_bits),
+                "num_bits must be between {} and {}, got {}",
+                BloomFilterBuilder::MIN_NUM_BITS,
+                BloomFilterBuilder::MAX_NUM_BITS,
+                num_bits,
+            );
+            let bit_array_bytes = num_bits.div_ceil(64) as usize * 8;
+            Ok(Limits {
+                max_serialized_bytes: 8 * Family::BLOOMFILTER.max_pre_longs as usize
+                    + bit_array_bytes,
+                max_estimated_size: Some(size_of::<BloomFilter>() + bit_array_bytes),
+                is_strict: true,
+            })
+        }
+        _ => Err(Error::invalid_argument(format!(
+            "no size limits are known for family id {family_id}"
+        ))),
+    }
+}
+
+#[cfg(any(
+    feature = "bloom",
+    feature = "countmin",
+    feature = "cpc",
+    feature = "hll",
+    feature = "theta"
+))]
+fn require<T>(param: Option<T>, name: &'static str) -> Result<T, Error> {
+    param.ok_or_else(|| Error::invalid_argument(format!("the limits need the {name} parameter")))
+}
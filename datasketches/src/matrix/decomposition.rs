@@ -0,0 +1,87 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Singular value decomposition of the sketch rows by one-sided Jacobi rotations.
+
+/// Sweeps over all pairs of rows give up after this many rounds; the rotations converge
+/// quadratically, so well conditioned inputs need fewer than ten.
+const MAX_SWEEPS: usize = 64;
+
+/// Rotates the `d`-wide rows of the row-major `rows` until they are mutually orthogonal.
+///
+/// Each step applies a Givens rotation to a pair of rows, which leaves `R^T R` unchanged. Once
+/// the rows are orthogonal, they are the right singular vectors scaled by the singular values.
+/// Returns the row indices ordered by decreasing squared norm, paired with those norms.
+///
+/// Rows shorter than the usual numerical rank tolerance, `max(rows, d) * EPSILON` times the
+/// longest row, are rotation noise in directions the input does not span; they are cleared
+/// and reported with a zero norm.
+pub(super) fn orthogonalize(rows: &mut [f64], d: usize) -> Vec<(usize, f64)> {
+    let num_rows = rows.len() / d;
+    for _ in 0..MAX_SWEEPS {
+        let mut rotated = false;
+        for i in 0..num_rows {
+            for j in i + 1..num_rows {
+                let (left, right) = rows.split_at_mut(j * d);
+                let a = &mut left[i * d..(i + 1) * d];
+                let b = &mut right[..d];
+                let alpha = dot(a, a);
+                let beta = dot(b, b);
+                let gamma = dot(a, b);
+                if gamma == 0.0 || gamma.abs() <= f64::EPSILON * (alpha * beta).sqrt() {
+                    continue;
+                }
+                rotated = true;
+                let zeta = (beta - alpha) / (2.0 * gamma);
+                let t = zeta.signum() / (zeta.abs() + (1.0 + zeta * zeta).sqrt());
+                let c = 1.0 / (1.0 + t * t).sqrt();
+                let s = c * t;
+                for (x, y) in a.iter_mut().zip(b.iter_mut()) {
+                    let (u, v) = (*x, *y);
+                    *x = c * u - s * v;
+                    *y = s * u + c * v;
+                }
+            }
+        }
+        if !rotated {
+            break;
+        }
+    }
+
+    let mut order: Vec<(usize, f64)> = rows
+        .chunks_exact(d)
+        .map(|row| dot(row, row))
+        .enumerate()
+        .collect();
+    order.sort_by(|a, b| b.1.total_cmp(&a.1));
+
+    let tolerance = num_rows.max(d) as f64 * f64::EPSILON;
+    let cutoff = order
+        .first()
+        .map_or(0.0, |&(_, norm_sq)| norm_sq * tolerance * tolerance);
+    for (row, norm_sq) in &mut order {
+        if *norm_sq <= cutoff {
+            *norm_sq = 0.0;
+            rows[*row * d..(*row + 1) * d].fill(0.0);
+        }
+    }
+    order
+}
+
+fn dot(a: &[f64], b: &[f64]) -> f64 {
+    a.iter().zip(b).map(|(x, y)| x * y).sum()
+}
@@ -0,0 +1,59 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Frequent Directions sketch for low-rank approximation of streaming matrices.
+//!
+//! The sketch reads the rows of a matrix `A` with `d` columns one at a time and keeps a small
+//! matrix `B` of at most `2k` rows, such that `B^T B` approximates the covariance `A^T A`. When
+//! the buffer is full, its rows are rotated into orthogonal directions and every squared
+//! singular value is reduced by the `(k + 1)`-th largest, which frees at least half of the rows.
+//! The total reduction bounds the spectral norm of `A^T A - B^T B`, and is at most
+//! `||A||_F^2 / (k + 1)`.
+//!
+//! Sketches of the same dimension can be merged, so that rows can be sketched in parallel. The
+//! sketch follows the Frequent Directions sketch of the Java matrix component, but its
+//! serialized image is specific to this library.
+//!
+//! # Usage
+//!
+//! ```
+//! # use datasketches::matrix::FrequentDirections;
+//! let mut sketch = FrequentDirections::new(2, 3);
+//! for i in 0..100 {
+//!     let x = i as f64;
+//!     sketch.update(&[x, 2.0 * x, 0.5]);
+//! }
+//! let singular_values = sketch.singular_values();
+//! assert_eq!(singular_values.len(), 2);
+//! assert!(singular_values[0] > singular_values[1]);
+//!
+//! // the top right singular vector is close to the direction of the rows
+//! let top = &sketch.projection()[0];
+//! let cosine = (top[0] + 2.0 * top[1]).abs() / 5f64.sqrt();
+//! assert!(cosine > 0.99);
+//! ```
+//!
+//! # Reference
+//!
+//! Ghashami, Liberty, Phillips and Woodruff (2016). "Frequent Directions: Simple and
+//! Deterministic Matrix Sketching"
+
+mod decomposition;
+mod serialization;
+mod sketch;
+
+pub use self::sketch::FrequentDirections;
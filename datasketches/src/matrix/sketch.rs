@@ -0,0 +1,453 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use super::decomposition::orthogonalize;
+use super::serialization::FLAGS_IS_EMPTY;
+use super::serialization::PREAMBLE_LONGS_EMPTY;
+use super::serialization::PREAMBLE_LONGS_NON_EMPTY;
+use super::serialization::SERIAL_VERSION;
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::error::Error;
+
+/// The largest number of values the buffer of `2k` rows may hold.
+const MAX_BUFFER_ENTRIES: u64 = 1 << 28;
+
+/// A Frequent Directions sketch of a stream of `d`-dimensional rows.
+///
+/// See the [module level documentation](super) for more.
+#[derive(Debug, Clone, PartialEq)]
+pub struct FrequentDirections {
+    k: u32,
+    d: u32,
+    n: u64,
+    /// The sum of the squared singular values subtracted by all shrinks.
+    adjustment: f64,
+    /// The retained rows, row-major; at most `2k` of them.
+    rows: Vec<f64>,
+}
+
+impl FrequentDirections {
+    /// Creates a new sketch keeping the top `k` directions of rows of dimension `d`.
+    ///
+    /// The sketch buffers up to `2k` rows.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `k` or `d` is 0, or if `2k` rows of `d` values exceed 2^28 values.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::matrix::FrequentDirections;
+    /// let sketch = FrequentDirections::new(8, 100);
+    /// assert_eq!(sketch.k(), 8);
+    /// assert_eq!(sketch.d(), 100);
+    /// ```
+    pub fn new(k: u32, d: u32) -> Self {
+        if let Err(err) = check_config(k, d) {
+            panic!("{err}");
+        }
+        FrequentDirections {
+            k,
+            d,
+            n: 0,
+            adjustment: 0.0,
+            rows: vec![],
+        }
+    }
+
+    /// Returns the number of directions the sketch keeps.
+    pub fn k(&self) -> u32 {
+        self.k
+    }
+
+    /// Returns the dimension of the rows.
+    pub fn d(&self) -> u32 {
+        self.d
+    }
+
+    /// Returns the number of rows seen by the sketch.
+    pub fn n(&self) -> u64 {
+        self.n
+    }
+
+    /// Returns true if the sketch has not seen any rows.
+    pub fn is_empty(&self) -> bool {
+        self.n == 0
+    }
+
+    /// Returns the number of rows currently buffered, at most `2k`.
+    pub fn num_rows(&self) -> u32 {
+        (self.rows.len() / self.d as usize) as u32
+    }
+
+    /// Returns true if shrinking the buffer has discarded part of the input, so that
+    /// `B^T B` only approximates `A^T A`.
+    ///
+    /// Input of rank at most `k` is never discarded.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.adjustment > 0.0
+    }
+
+    /// Returns an upper bound on the spectral norm of `A^T A - B^T B`.
+    ///
+    /// `A` is the matrix of all rows seen and `B` the matrix of the buffered
+    /// [`rows`](Self::rows). The bound is the total amount subtracted from the squared singular
+    /// values by all shrinks, and is at most `||A||_F^2 / (k + 1)`. Since `A^T A - B^T B` is
+    /// positive semidefinite, it also bounds how much the squared norm of `A x` can exceed the
+    /// one of `B x` for any unit vector `x`.
+    pub fn covariance_error_bound(&self) -> f64 {
+        self.adjustment
+    }
+
+    /// Returns the estimated size of the sketch in bytes
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>() + self.rows.capacity() * size_of::<f64>()
+    }
+
+    /// Returns an iterator over the buffered rows of the sketch matrix `B`.
+    pub fn rows(&self) -> impl Iterator<Item = &[f64]> + '_ {
+        self.rows.chunks_exact(self.d as usize)
+    }
+
+    /// Updates the sketch with a row.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the length of `row` differs from the dimension of the sketch.
+    pub fn update(&mut self, row: &[f64]) {
+        self.check_dim(row.len());
+        self.push_row(row);
+        self.n += 1;
+    }
+
+    /// Merges another sketch into this one.
+    ///
+    /// The rows of `other` are appended as if they were updates, so the sketches may differ in
+    /// `k`; the error bounds of both add up.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the sketches have different dimensions.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::matrix::FrequentDirections;
+    /// let mut a = FrequentDirections::new(4, 2);
+    /// let mut b = FrequentDirections::new(4, 2);
+    /// a.update(&[1.0, 0.0]);
+    /// b.update(&[0.0, 1.0]);
+    ///
+    /// a.merge(&b);
+    /// assert_eq!(a.n(), 2);
+    /// assert_eq!(a.singular_values(), vec![1.0, 1.0]);
+    /// ```
+    pub fn merge(&mut self, other: &FrequentDirections) {
+        if other.is_empty() {
+            return;
+        }
+        self.check_dim(other.d as usize);
+        for row in other.rows() {
+            self.push_row(row);
+        }
+        self.n += other.n;
+        self.adjustment += other.adjustment;
+    }
+
+    /// Returns the largest singular values of the sketch matrix, at most `k` of them, in
+    /// decreasing order.
+    ///
+    /// Zero singular values are omitted, so fewer than `k` values are returned when the
+    /// rows span fewer than `k` dimensions.
+    pub fn singular_values(&self) -> Vec<f64> {
+        self.principal_rows()
+            .into_iter()
+            .map(|(singular_value, _)| singular_value)
+            .collect()
+    }
+
+    /// Returns the right singular vectors of the [`singular_values`](Self::singular_values),
+    /// as unit rows of dimension `d`.
+    ///
+    /// Multiplying a row by the transpose of this matrix projects it onto the approximate
+    /// top-`k` principal subspace of the input.
+    pub fn projection(&self) -> Vec<Vec<f64>> {
+        self.principal_rows()
+            .into_iter()
+            .map(|(singular_value, row)| row.into_iter().map(|x| x / singular_value).collect())
+            .collect()
+    }
+
+    /// Returns the rank-`k` approximation of the sketch matrix: its right singular vectors
+    /// scaled by the singular values.
+    ///
+    /// The rows are those of [`projection`](Self::projection), each multiplied by its
+    /// singular value; their Gram matrix is the best rank-`k` approximation of `B^T B`.
+    pub fn result(&self) -> Vec<Vec<f64>> {
+        self.principal_rows()
+            .into_iter()
+            .map(|(_, row)| row)
+            .collect()
+    }
+
+    /// Serializes the sketch to bytes.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::matrix::FrequentDirections;
+    /// let mut sketch = FrequentDirections::new(4, 2);
+    /// sketch.update(&[1.0, 2.0]);
+    ///
+    /// let bytes = sketch.serialize();
+    /// let restored = FrequentDirections::deserialize(&bytes).unwrap();
+    /// assert_eq!(restored, sketch);
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        if self.is_empty() {
+            8 * PREAMBLE_LONGS_EMPTY as usize
+        } else {
+            8 * PREAMBLE_LONGS_NON_EMPTY as usize + 8 * self.rows.len()
+        }
+    }
+
+    /// Serializes this sketch into `buf`, returning the number of bytes written.
+    ///
+    /// Writes the image [`serialize`](Self::serialize) returns. Returns an error if `buf` is
+    /// shorter than [`serialized_size_bytes`](Self::serialized_size_bytes).
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Streams this sketch to `writer` in the format of [`serialize`](Self::serialize).
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        let is_empty = self.is_empty();
+        bytes.write_u8(if is_empty {
+            PREAMBLE_LONGS_EMPTY
+        } else {
+            PREAMBLE_LONGS_NON_EMPTY
+        });
+        bytes.write_u8(SERIAL_VERSION);
+        bytes.write_u8(Family::FREQUENT_DIRECTIONS.id);
+        bytes.write_u8(if is_empty { FLAGS_IS_EMPTY } else { 0 });
+        bytes.write_u32_le(self.k);
+        bytes.write_u32_le(self.d);
+        bytes.write_u32_le(self.num_rows());
+        if is_empty {
+            return;
+        }
+
+        bytes.write_u64_le(self.n);
+        bytes.write_f64_le(self.adjustment);
+        for &value in &self.rows {
+            bytes.write_f64_le(value);
+        }
+    }
+
+    /// Deserializes a sketch from bytes.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the bytes do not hold a valid Frequent Directions image.
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// Exactly the bytes of one image are consumed.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the stream does not hold a valid Frequent Directions image. A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        let preamble_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let k = cursor.read_u32_le().map_err(insufficient_data("k"))?;
+        let d = cursor.read_u32_le().map_err(insufficient_data("d"))?;
+        let num_rows = cursor
+            .read_u32_le()
+            .map_err(insufficient_data("num_rows"))?;
+
+        Family::FREQUENT_DIRECTIONS.validate_id(family_id)?;
+        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        check_config(k, d).map_err(Error::deserial)?;
+
+        let is_empty = flags & FLAGS_IS_EMPTY != 0;
+        let expected_preamble_longs = if is_empty {
+            PREAMBLE_LONGS_EMPTY
+        } else {
+            PREAMBLE_LONGS_NON_EMPTY
+        };
+        ensure_preamble_longs_in(&[expected_preamble_longs], preamble_longs)?;
+        if is_empty {
+            return Ok(Self::new(k, d));
+        }
+
+        if u64::from(num_rows) > 2 * u64::from(k) {
+            return Err(Error::deserial(format!(
+                "num_rows must be at most 2k = {}, got {num_rows}",
+                2 * u64::from(k)
+            )));
+        }
+        let n = cursor.read_u64_le().map_err(insufficient_data("n"))?;
+        if n == 0 {
+            return Err(Error::deserial("n must be positive in a non-empty sketch"));
+        }
+        let adjustment = cursor
+            .read_f64_le()
+            .map_err(insufficient_data("adjustment"))?;
+        if !(adjustment.is_finite() && adjustment >= 0.0) {
+            return Err(Error::deserial(format!(
+                "adjustment must be finite and non-negative, got {adjustment}"
+            )));
+        }
+        let num_values = num_rows as usize * d as usize;
+        let mut rows = Vec::with_capacity(cursor.capacity_hint(num_values, 8));
+        for _ in 0..num_values {
+            rows.push(cursor.read_f64_le().map_err(insufficient_data("rows"))?);
+        }
+
+        Ok(FrequentDirections {
+            k,
+            d,
+            n,
+            adjustment,
+            rows,
+        })
+    }
+
+    fn check_dim(&self, dim: usize) {
+        assert_eq!(
+            dim, self.d as usize,
+            "dimension mismatch: expected {}, got {dim}",
+            self.d
+        );
+    }
+
+    fn push_row(&mut self, row: &[f64]) {
+        if self.num_rows() >= 2 * self.k {
+            self.shrink();
+        }
+        self.rows.extend_from_slice(row);
+    }
+
+    /// Subtracts the `(k + 1)`-th largest squared singular value from all of them, keeping the
+    /// at most `k` rows that remain non-zero.
+    fn shrink(&mut self) {
+        let d = self.d as usize;
+        let k = self.k as usize;
+        let order = orthogonalize(&mut self.rows, d);
+        let delta = order.get(k).map_or(0.0, |&(_, norm_sq)| norm_sq);
+        let mut shrunk = Vec::with_capacity(self.rows.len());
+        for &(row, norm_sq) in order.iter().take(k) {
+            if norm_sq <= delta {
+                break;
+            }
+            let scale = ((norm_sq - delta) / norm_sq).sqrt();
+            shrunk.extend(self.rows[row * d..(row + 1) * d].iter().map(|x| x * scale));
+        }
+        self.rows = shrunk;
+        self.adjustment += delta;
+    }
+
+    /// Returns the top `k` singular values of the buffered rows with their right singular
+    /// vectors scaled by them.
+    fn principal_rows(&self) -> Vec<(f64, Vec<f64>)> {
+        let d = self.d as usize;
+        let mut rows = self.rows.clone();
+        let order = orthogonalize(&mut rows, d);
+        order
+            .into_iter()
+            .take(self.k as usize)
+            .filter(|&(_, norm_sq)| norm_sq > 0.0)
+            .map(|(row, norm_sq)| (norm_sq.sqrt(), rows[row * d..(row + 1) * d].to_vec()))
+            .collect()
+    }
+}
+
+/// Updates the sketch with every row of the iterator, as [`FrequentDirections::update`] does.
+impl<R: AsRef<[f64]>> Extend<R> for FrequentDirections {
+    fn extend<I: IntoIterator<Item = R>>(&mut self, iter: I) {
+        for row in iter {
+            self.update(row.as_ref());
+        }
+    }
+}
+
+fn check_config(k: u32, d: u32) -> Result<(), String> {
+    if k == 0 {
+        return Err("k must be at least 1, got 0".to_string());
+    }
+    if d == 0 {
+        return Err("d must be at least 1, got 0".to_string());
+    }
+    let entries = 2 * u64::from(k) * u64::from(d);
+    if entries > MAX_BUFFER_ENTRIES {
+        return Err(format!(
+            "2k rows of d values must hold at most {MAX_BUFFER_ENTRIES} values, got {entries}"
+        ));
+    }
+    Ok(())
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(FrequentDirections);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(FrequentDirections);
+impl_fingerprint_via_image!(FrequentDirections);
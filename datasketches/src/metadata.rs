@@ -0,0 +1,119 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! User metadata carried with serialized sketch images
+//!
+//! [`attach`] appends a small blob, such as the dimension key or time window a sketch stands
+//! for, to a serialized image, and [`split`] separates the two again. The blob goes into a
+//! trailer after the end of the image, which the preamble of every family delimits, so a
+//! reader that consumes only the bytes of the image, as the Java and C++ deserializers do,
+//! reads a tagged image like the plain one. Like [`preamble`](crate::preamble), this works on
+//! the images of every family without enabling their features.
+//!
+//! The trailer holds the metadata bytes followed by their length as a little-endian `u32`, the
+//! 32-bit FNV-1a hash of the metadata and the eight magic bytes `DSKMETA1`. [`split`] only
+//! recognizes a trailer whose magic, length and hash all match, so an image that happens to end
+//! in the magic bytes is not mistaken for a tagged one.
+//!
+//! # Examples
+//!
+//! ```
+//! # use datasketches::metadata;
+//! // the image of an empty HLL sketch
+//! let image = [2, 1, 7, 12, 3, 12, 0, 8];
+//! let tagged = metadata::attach(&image, b"dim=region:eu;window=2024-06");
+//!
+//! let (untagged, tag) = metadata::split(&tagged);
+//! assert_eq!(untagged, image);
+//! assert_eq!(tag, Some(&b"dim=region:eu;window=2024-06"[..]));
+//! assert_eq!(metadata::split(&image), (&image[..], None));
+//! ```
+
+/// The largest metadata blob [`attach`] accepts, in bytes.
+pub const MAX_METADATA_BYTES: usize = u16::MAX as usize;
+
+const MAGIC: [u8; 8] = *b"DSKMETA1";
+
+/// The bytes following the metadata: its length, its hash and the magic.
+const TRAILER_BYTES: usize = 4 + 4 + MAGIC.len();
+
+/// Appends `metadata` to a serialized image.
+///
+/// An image that already carries metadata has it replaced.
+///
+/// # Panics
+///
+/// Panics if `metadata` is longer than [`MAX_METADATA_BYTES`].
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::metadata;
+/// let image = [2, 1, 7, 12, 3, 12, 0, 8];
+/// let tagged = metadata::attach(&image, b"v1");
+/// let retagged = metadata::attach(&tagged, b"v2");
+/// assert_eq!(metadata::split(&retagged), (&image[..], Some(&b"v2"[..])));
+/// ```
+pub fn attach(image: &[u8], metadata: &[u8]) -> Vec<u8> {
+    assert!(
+        metadata.len() <= MAX_METADATA_BYTES,
+        "metadata must be at most {MAX_METADATA_BYTES} bytes, got {}",
+        metadata.len()
+    );
+    let (image, _) = split(image);
+
+    let mut bytes = Vec::with_capacity(image.len() + metadata.len() + TRAILER_BYTES);
+    bytes.extend_from_slice(image);
+    bytes.extend_from_slice(metadata);
+    bytes.extend_from_slice(&(metadata.len() as u32).to_le_bytes());
+    bytes.extend_from_slice(&fnv1a(metadata).to_le_bytes());
+    bytes.extend_from_slice(&MAGIC);
+    bytes
+}
+
+/// Splits a serialized image from the metadata attached to it, if any.
+///
+/// Returns `bytes` unchanged and `None` when they end in no valid metadata trailer.
+pub fn split(bytes: &[u8]) -> (&[u8], Option<&[u8]>) {
+    let untagged = (bytes, None);
+    let Some(body_len) = bytes.len().checked_sub(TRAILER_BYTES) else {
+        return untagged;
+    };
+    let (body, trailer) = bytes.split_at(body_len);
+    let (len, trailer) = trailer.split_at(4);
+    let (hash, magic) = trailer.split_at(4);
+    if magic != MAGIC {
+        return untagged;
+    }
+
+    let len = u32::from_le_bytes(len.try_into().unwrap()) as usize;
+    let Some(image_len) = body.len().checked_sub(len) else {
+        return untagged;
+    };
+    let (image, metadata) = body.split_at(image_len);
+    if fnv1a(metadata).to_le_bytes() != *hash {
+        return untagged;
+    }
+    (image, Some(metadata))
+}
+
+/// Returns the 32-bit FNV-1a hash of `bytes`.
+fn fnv1a(bytes: &[u8]) -> u32 {
+    bytes.iter().fold(0x811c_9dc5, |hash, &byte| {
+        (hash ^ u32::from(byte)).wrapping_mul(0x0100_0193)
+    })
+}
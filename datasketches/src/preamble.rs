@@ -0,0 +1,157 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Probing the preamble of serialized sketch images
+//!
+//! Every DataSketches image, whichever implementation wrote it, starts with a preamble whose
+//! first three bytes hold the preamble size, the serial version and the family ID. [`probe`]
+//! reads those and the flags byte, so that code routing or storing images can tell what kind
+//! of sketch one holds without deserializing it, and without enabling the feature of that
+//! sketch family.
+//!
+//! # Examples
+//!
+//! ```
+//! # use datasketches::preamble;
+//! // the image of an empty HLL sketch
+//! let bytes = [2, 1, 7, 12, 3, 12, 0, 8];
+//! let preamble = preamble::probe(&bytes).unwrap();
+//! assert_eq!(preamble.family_id, 7);
+//! assert_eq!(preamble.family_name(), "HLL");
+//! assert_eq!(preamble.serial_version, 1);
+//! assert_eq!(preamble.preamble_longs, 2);
+//! assert_eq!(preamble.flags, 12);
+//! ```
+
+use crate::error::Error;
+
+/// The bits of the first byte holding the preamble size. Theta, Tuple and the sampling
+/// sketches keep the lg resize factor in the upper two bits.
+const PREAMBLE_SIZE_MASK: u8 = 0x3F;
+
+/// The byte offset of the sketch type of a Tuple image.
+const TUPLE_SKETCH_TYPE_BYTE: usize = 3;
+
+/// The Tuple sketch type of a compact Array-of-Doubles image.
+const ARRAY_OF_DOUBLES_SKETCH_TYPE: u8 = 3;
+
+/// The leading fields of a serialized sketch image.
+///
+/// The meaning of the flag bits, and the unit of the preamble size, vary between families;
+/// the family ID tells which sketch type can deserialize the image.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Preamble {
+    /// The preamble size, from the lower six bits of the first byte.
+    ///
+    /// Most families count it in 8-byte longs. HLL, CPC, KLL, REQ and the C++ density sketch
+    /// count it in 4-byte ints.
+    pub preamble_longs: u8,
+    /// The serial version of the image format.
+    pub serial_version: u8,
+    /// The family ID, which identifies the kind of sketch.
+    pub family_id: u8,
+    /// The flags byte of the family.
+    pub flags: u8,
+}
+
+impl Preamble {
+    /// Returns the name of the family, as in the Java implementation.
+    ///
+    /// Family ID 19 names both the EBPPS sampling sketch and the C++ density sketch; it is
+    /// reported as `EBPPS`.
+    pub fn family_name(&self) -> &'static str {
+        // probe only returns preambles of known families
+        family_layout(self.family_id).map_or("UNKNOWN", |(name, _)| name)
+    }
+}
+
+/// Returns the name and the offset of the flags byte of a family.
+fn family_layout(family_id: u8) -> Option<(&'static str, usize)> {
+    let layout = match family_id {
+        1 => ("ALPHA", 5),
+        2 => ("QUICKSELECT", 5),
+        3 => ("COMPACT", 5),
+        4 => ("UNION", 5),
+        5 => ("INTERSECTION", 5),
+        6 => ("A_NOT_B", 5),
+        7 => ("HLL", 5),
+        8 => ("QUANTILES", 3),
+        9 => ("TUPLE", 5),
+        10 => ("FREQUENCY", 5),
+        11 => ("RESERVOIR", 3),
+        12 => ("RESERVOIR_UNION", 3),
+        13 => ("VAROPT", 3),
+        14 => ("VAROPT_UNION", 3),
+        15 => ("KLL", 3),
+        16 => ("CPC", 5),
+        17 => ("REQ", 3),
+        18 => ("COUNTMIN", 3),
+        19 => ("EBPPS", 3),
+        20 => ("TDIGEST", 5),
+        21 => ("BLOOMFILTER", 3),
+        22 => ("QUOTIENTFILTER", 3),
+        _ => return None,
+    };
+    Some(layout)
+}
+
+/// Reads the preamble fields of a serialized sketch image.
+///
+/// Only the first few bytes are read; the rest of the image is not validated, so a
+/// successful probe does not mean that the image deserializes.
+///
+/// # Errors
+///
+/// Returns an error if the image is too short to hold the flags byte of its family, or if
+/// the family ID is not one of a DataSketches family.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::preamble;
+/// let err = preamble::probe(&[1, 1, 99, 0]).unwrap_err();
+/// assert!(err.message().contains("unknown family id"), "{err}");
+/// ```
+pub fn probe(bytes: &[u8]) -> Result<Preamble, Error> {
+    let read = |offset: usize, field: &'static str| {
+        bytes
+            .get(offset)
+            .copied()
+            .ok_or_else(|| Error::unexpected_end(field))
+    };
+
+    let preamble_longs = read(0, "preamble_longs")? & PREAMBLE_SIZE_MASK;
+    let serial_version = read(1, "serial_version")?;
+    let family_id = read(2, "family_id")?;
+    let Some((_, mut flags_byte)) = family_layout(family_id) else {
+        return Err(Error::deserial(format!("unknown family id: {family_id}")));
+    };
+    // the compact Array-of-Doubles layout has no unused byte before the flags
+    if family_id == 9
+        && read(TUPLE_SKETCH_TYPE_BYTE, "sketch_type")? == ARRAY_OF_DOUBLES_SKETCH_TYPE
+    {
+        flags_byte = 4;
+    }
+    let flags = read(flags_byte, "flags")?;
+
+    Ok(Preamble {
+        preamble_longs,
+        serial_version,
+        family_id,
+        flags,
+    })
+}
@@ -0,0 +1,139 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! The commonly used types and traits of the enabled sketch families
+//!
+//! A glob import brings in the sketches, their builders and set operations, and the traits
+//! their methods come from, without naming each module:
+//!
+//! ```
+//! # #[cfg(all(feature = "hll", feature = "theta"))]
+//! # {
+//! use datasketches::prelude::*;
+//!
+//! let mut hll = HllSketch::new(12, HllType::Hll8);
+//! hll.extend(0..1000);
+//!
+//! let mut theta = ThetaSketchBuilder::default().build();
+//! theta.extend(0..1000);
+//!
+//! // `estimate_with_bounds` comes from `DistinctCountEstimator`
+//! assert!(hll.estimate_with_bounds(NumStdDev::Two).contains(1000.0));
+//! assert!(
+//!     theta
+//!         .compact(true)
+//!         .estimate_with_bounds(NumStdDev::Two)
+//!         .contains(1000.0)
+//! );
+//! # }
+//! ```
+//!
+//! Only the types of the enabled features are exported. The wrappers, direct and concurrent
+//! variants and other specialized types remain in their family modules.
+
+#[cfg(feature = "bloom")]
+pub use crate::bloom::BloomFilter;
+#[cfg(feature = "bloom")]
+pub use crate::bloom::BloomFilterBuilder;
+pub use crate::common::DistinctCountEstimator;
+pub use crate::common::MergeableSketch;
+pub use crate::common::NumStdDev;
+pub use crate::common::QuantileSketch;
+pub use crate::common::SketchConfig;
+#[cfg(feature = "countmin")]
+pub use crate::countmin::CountMinSketch;
+#[cfg(feature = "cpc")]
+pub use crate::cpc::CpcSketch;
+#[cfg(feature = "cpc")]
+pub use crate::cpc::CpcUnion;
+#[cfg(feature = "density")]
+pub use crate::density::DensitySketch;
+pub use crate::error::Error;
+#[cfg(feature = "frequencies")]
+pub use crate::frequencies::ErrorType;
+#[cfg(feature = "frequencies")]
+pub use crate::frequencies::FrequentItemsSketch;
+#[cfg(feature = "hll")]
+pub use crate::hll::HllSketch;
+#[cfg(feature = "hll")]
+pub use crate::hll::HllSketchBuilder;
+#[cfg(feature = "hll")]
+pub use crate::hll::HllType;
+#[cfg(feature = "hll")]
+pub use crate::hll::HllUnion;
+#[cfg(feature = "kll")]
+pub use crate::kll::KllItemsSketch;
+#[cfg(feature = "kll")]
+pub use crate::kll::KllSketch;
+#[cfg(feature = "matrix")]
+pub use crate::matrix::FrequentDirections;
+#[cfg(feature = "quantiles")]
+pub use crate::quantiles::DoublesSketch;
+#[cfg(feature = "quotient")]
+pub use crate::quotient::QuotientFilter;
+#[cfg(feature = "quotient")]
+pub use crate::quotient::QuotientFilterBuilder;
+#[cfg(feature = "req")]
+pub use crate::req::RankAccuracy;
+#[cfg(feature = "req")]
+pub use crate::req::ReqSketch;
+#[cfg(feature = "sampling")]
+pub use crate::sampling::EbppsItemsSketch;
+#[cfg(feature = "sampling")]
+pub use crate::sampling::ReservoirItemsSketch;
+#[cfg(feature = "sampling")]
+pub use crate::sampling::ReservoirUnion;
+#[cfg(feature = "sampling")]
+pub use crate::sampling::VarOptItemsSketch;
+#[cfg(feature = "sampling")]
+pub use crate::sampling::VarOptUnion;
+#[cfg(feature = "tdigest")]
+pub use crate::tdigest::TDigest;
+#[cfg(feature = "tdigest")]
+pub use crate::tdigest::TDigestMut;
+#[cfg(feature = "theta")]
+pub use crate::theta::CompactThetaSketch;
+#[cfg(feature = "theta")]
+pub use crate::theta::ThetaAnotB;
+#[cfg(feature = "theta")]
+pub use crate::theta::ThetaIntersection;
+#[cfg(feature = "theta")]
+pub use crate::theta::ThetaSketch;
+#[cfg(feature = "theta")]
+pub use crate::theta::ThetaSketchBuilder;
+#[cfg(feature = "theta")]
+pub use crate::theta::ThetaSketchView;
+#[cfg(feature = "theta")]
+pub use crate::theta::ThetaUnion;
+#[cfg(feature = "theta")]
+pub use crate::theta::ThetaUnionBuilder;
+#[cfg(feature = "tuple")]
+pub use crate::tuple::CompactTupleSketch;
+#[cfg(feature = "tuple")]
+pub use crate::tuple::TupleAnotB;
+#[cfg(feature = "tuple")]
+pub use crate::tuple::TupleIntersection;
+#[cfg(feature = "tuple")]
+pub use crate::tuple::TupleSketch;
+#[cfg(feature = "tuple")]
+pub use crate::tuple::TupleSketchBuilder;
+#[cfg(feature = "tuple")]
+pub use crate::tuple::TupleSketchView;
+#[cfg(feature = "tuple")]
+pub use crate::tuple::TupleUnion;
+#[cfg(feature = "tuple")]
+pub use crate::tuple::TupleUnionBuilder;
@@ -0,0 +1,54 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Classic quantiles sketch implementation for estimating quantiles and ranks.
+//!
+//! This is the original quantiles sketch of the Apache DataSketches library, based on the paper
+//! [Mergeable Summaries][paper] by Agarwal et al. It keeps a base buffer of up to 2k raw values
+//! and a stack of levels of exactly k sorted values each, where level _h_ holds values of weight
+//! 2<sup>h+1</sup>. Whenever the base buffer fills up, it is sorted and half of its values,
+//! chosen at random, are carried into the levels like in a binary counter.
+//!
+//! For new applications, prefer the [KLL sketch](crate::kll), which is more accurate for the
+//! same size. This sketch exists primarily to read and continue the `DoublesSketch` images
+//! produced by the Java and C++ implementations: [`DoublesSketch::deserialize`] accepts the
+//! compact and updatable formats of all serial versions, and [`DoublesSketch::serialize`]
+//! writes the compact format of `quantiles_sketch<double>` in C++.
+//!
+//! For more information on the performance characteristics, see the
+//! [Datasketches page on quantiles](https://datasketches.apache.org/docs/Quantiles/ClassicQuantilesSketch.html).
+//!
+//! [paper]: https://dl.acm.org/doi/10.1145/2213556.2213562
+//!
+//! # Usage
+//!
+//! ```
+//! # use datasketches::quantiles::DoublesSketch;
+//! let mut sketch = DoublesSketch::default();
+//! for i in 1..=1000 {
+//!     sketch.update(i as f64);
+//! }
+//! let median = sketch.quantile(0.5, true).unwrap();
+//! assert!((450.0..=550.0).contains(&median));
+//! ```
+
+mod serialization;
+
+mod sketch;
+pub use self::sketch::DoublesSketch;
+pub use self::sketch::k_from_epsilon;
+pub use self::sketch::normalized_rank_error;
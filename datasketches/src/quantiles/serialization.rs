@@ -0,0 +1,42 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+/// Preamble size in 8-byte longs for an empty sketch.
+pub(super) const PREAMBLE_LONGS_EMPTY: u8 = 1;
+/// Preamble size in 8-byte longs for a non-empty sketch.
+pub(super) const PREAMBLE_LONGS_FULL: u8 = 2;
+/// Preamble size in 8-byte longs for a non-empty sketch of serial version 1, which also counts
+/// the min, max and buffer allocation fields.
+pub(super) const PREAMBLE_LONGS_FULL_V1: u8 = 5;
+
+/// Legacy serial version with an extra buffer allocation field after min and max.
+pub(super) const SERIAL_VERSION_1: u8 = 1;
+/// Legacy serial version that is always compact.
+pub(super) const SERIAL_VERSION_2: u8 = 2;
+/// Current serial version.
+pub(super) const SERIAL_VERSION_3: u8 = 3;
+
+pub(super) const FLAGS_IS_BIG_ENDIAN: u8 = 1 << 0;
+pub(super) const FLAGS_IS_READ_ONLY: u8 = 1 << 1;
+pub(super) const FLAGS_IS_EMPTY: u8 = 1 << 2;
+pub(super) const FLAGS_IS_COMPACT: u8 = 1 << 3;
+pub(super) const FLAGS_IS_SORTED: u8 = 1 << 4;
+
+/// Size of the preamble of an empty sketch.
+pub(super) const EMPTY_PREAMBLE_SIZE: usize = 8;
+/// Size of the preamble of a non-empty sketch, including n, min and max.
+pub(super) const FULL_PREAMBLE_SIZE: usize = 32;
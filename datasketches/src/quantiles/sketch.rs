@@ -0,0 +1,1036 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::io;
+use std::io::Read;
+use std::io::Write;
+use std::iter::Sum;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::MergeableSketch;
+use crate::common::PartitionBoundaries;
+use crate::common::QuantileSketch;
+use crate::common::SortedView;
+use crate::common::random;
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::error::SketchError;
+use crate::quantiles::serialization::EMPTY_PREAMBLE_SIZE;
+use crate::quantiles::serialization::FLAGS_IS_BIG_ENDIAN;
+use crate::quantiles::serialization::FLAGS_IS_COMPACT;
+use crate::quantiles::serialization::FLAGS_IS_EMPTY;
+use crate::quantiles::serialization::FLAGS_IS_READ_ONLY;
+use crate::quantiles::serialization::FLAGS_IS_SORTED;
+use crate::quantiles::serialization::FULL_PREAMBLE_SIZE;
+use crate::quantiles::serialization::PREAMBLE_LONGS_EMPTY;
+use crate::quantiles::serialization::PREAMBLE_LONGS_FULL;
+use crate::quantiles::serialization::PREAMBLE_LONGS_FULL_V1;
+use crate::quantiles::serialization::SERIAL_VERSION_1;
+use crate::quantiles::serialization::SERIAL_VERSION_2;
+use crate::quantiles::serialization::SERIAL_VERSION_3;
+
+const DEFAULT_K: u16 = 128;
+const MIN_K: u16 = 2;
+const MAX_K: u16 = 1 << 15;
+/// The error of the largest k, used as the floor of [`k_from_epsilon`].
+const MIN_EPSILON: f64 = 6.395e-5;
+
+/// Classic quantiles sketch for estimating quantiles and ranks of a stream of `f64` values.
+///
+/// See the [module level documentation](super) for more.
+#[derive(Debug, Clone)]
+pub struct DoublesSketch {
+    k: u16,
+    n: u64,
+    min_item: Option<f64>,
+    max_item: Option<f64>,
+    // up to 2k values of weight 1, not necessarily sorted
+    base_buffer: Vec<f64>,
+    // level `i` holds k sorted values of weight 2^(i + 1) if bit `i` of `bit_pattern` is set,
+    // and is empty otherwise
+    levels: Vec<Vec<f64>>,
+    // always n / 2k, except in the middle of a merge
+    bit_pattern: u64,
+}
+
+/// Returns the normalized rank error of a [`DoublesSketch`] configured with `k`.
+///
+/// With `pmf` set, the result is the error of PMF queries; otherwise it is the single-sided
+/// error of rank, quantile and CDF queries. The formulas are the empirical fit, with 99%
+/// confidence, used by the Java and C++ implementations.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::quantiles;
+/// let eps = quantiles::normalized_rank_error(128, true);
+/// assert!((eps - 0.0171).abs() < 1e-4);
+/// ```
+pub fn normalized_rank_error(k: u16, pmf: bool) -> f64 {
+    let k = f64::from(k);
+    if pmf {
+        1.854 / k.powf(0.9657)
+    } else {
+        1.576 / k.powf(0.9726)
+    }
+}
+
+/// Returns the smallest valid k whose [`normalized_rank_error`] does not exceed `epsilon`.
+///
+/// Since [`DoublesSketch::new`] only accepts powers of 2, the k meeting `epsilon` is rounded up
+/// to the next power of 2 and clamped to [2, 32768].
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::quantiles;
+/// # use datasketches::quantiles::DoublesSketch;
+/// let k = quantiles::k_from_epsilon(0.01, false);
+/// assert_eq!(k, 256);
+/// let sketch = DoublesSketch::new(k);
+/// assert!(sketch.normalized_rank_error(false) <= 0.01);
+/// ```
+pub fn k_from_epsilon(epsilon: f64, pmf: bool) -> u16 {
+    let epsilon = epsilon.max(MIN_EPSILON);
+    let k = if pmf {
+        ((1.854 / epsilon).ln() / 0.9657).exp()
+    } else {
+        ((1.576 / epsilon).ln() / 0.9726).exp()
+    };
+    // do not round up values that are integers up to floating point noise
+    let rounded = k.round();
+    let k = if (rounded - k).abs() < 1e-6 {
+        rounded
+    } else {
+        k.ceil()
+    };
+    let k = k.clamp(f64::from(MIN_K), f64::from(MAX_K)) as u16;
+    k.next_power_of_two()
+}
+
+impl Default for DoublesSketch {
+    fn default() -> Self {
+        DoublesSketch::new(DEFAULT_K)
+    }
+}
+
+impl DoublesSketch {
+    /// Creates a quantiles sketch with the given value of k.
+    ///
+    /// The parameter k controls the size and accuracy of the sketch: the default of 128 gives a
+    /// normalized rank error of about 1.7%.
+    ///
+    /// # Panics
+    ///
+    /// Panics if k is not a power of 2 in the range [2, 32768].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// let sketch = DoublesSketch::new(256);
+    /// assert_eq!(sketch.k(), 256);
+    /// ```
+    pub fn new(k: u16) -> Self {
+        assert!(
+            is_valid_k(k),
+            "k must be a power of 2 in [{MIN_K}, {MAX_K}], got {k}"
+        );
+        DoublesSketch {
+            k,
+            n: 0,
+            min_item: None,
+            max_item: None,
+            base_buffer: vec![],
+            levels: vec![],
+            bit_pattern: 0,
+        }
+    }
+
+    /// Updates this sketch with the given value.
+    ///
+    /// `NaN` values are ignored.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// let mut sketch = DoublesSketch::default();
+    /// sketch.update(1.0);
+    /// sketch.update(f64::NAN);
+    /// assert_eq!(sketch.n(), 1);
+    /// ```
+    pub fn update(&mut self, item: f64) {
+        if item.is_nan() {
+            return;
+        }
+        self.min_item = Some(self.min_item.map_or(item, |min| min.min(item)));
+        self.max_item = Some(self.max_item.map_or(item, |max| max.max(item)));
+
+        self.base_buffer.push(item);
+        self.n += 1;
+        if self.base_buffer.len() == 2 * self.k as usize {
+            self.base_buffer.sort_by(f64::total_cmp);
+            let carry = zip_with_stride(&self.base_buffer, 2);
+            self.base_buffer.clear();
+            self.propagate_carry(0, carry);
+        }
+        debug_assert_eq!(self.bit_pattern, self.n / (2 * self.k as u64));
+    }
+
+    /// Merges the given sketch into this one.
+    ///
+    /// If both sketches are in estimation mode and were configured with different values of k,
+    /// the result takes the smaller k, because the values of the sketch with the larger k are
+    /// downsampled. An exact or empty sketch takes the k of an estimating sketch merged into
+    /// it.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// let mut left = DoublesSketch::default();
+    /// let mut right = DoublesSketch::new(64);
+    /// left.update(1.0);
+    /// right.update(2.0);
+    /// left.merge(&right);
+    /// assert_eq!(left.n(), 2);
+    /// assert_eq!(left.max_item(), Some(2.0));
+    /// ```
+    pub fn merge(&mut self, other: &DoublesSketch) {
+        if other.is_empty() {
+            return;
+        }
+        if !other.is_estimation_mode() {
+            // all the values of the other sketch are in its base buffer, regardless of k
+            for &item in &other.base_buffer {
+                self.update(item);
+            }
+            return;
+        }
+
+        if self.is_estimation_mode() {
+            if self.k <= other.k {
+                self.merge_levels(other);
+            } else {
+                let mut merged = other.clone();
+                merged.merge_levels(self);
+                *self = merged;
+            }
+        } else {
+            let mut merged = other.clone();
+            if self.k <= other.k {
+                for &item in &self.base_buffer {
+                    merged.update(item);
+                }
+            } else {
+                merged.merge_levels(self);
+            }
+            *self = merged;
+        }
+    }
+
+    /// Returns parameter k that was used to configure this sketch.
+    pub fn k(&self) -> u16 {
+        self.k
+    }
+
+    /// Returns the normalized rank error of this sketch.
+    ///
+    /// See [`normalized_rank_error`](crate::quantiles::normalized_rank_error) for the meaning
+    /// of `pmf`.
+    pub fn normalized_rank_error(&self, pmf: bool) -> f64 {
+        normalized_rank_error(self.k, pmf)
+    }
+
+    /// Returns the length of the input stream.
+    pub fn n(&self) -> u64 {
+        self.n
+    }
+
+    /// Returns true if this sketch has not seen any data.
+    pub fn is_empty(&self) -> bool {
+        self.n == 0
+    }
+
+    /// Returns true if this sketch has carried values into its levels and its results are
+    /// approximate.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.bit_pattern != 0
+    }
+
+    /// Returns the number of values retained by this sketch.
+    pub fn num_retained(&self) -> usize {
+        self.base_buffer.len() + self.bit_pattern.count_ones() as usize * self.k as usize
+    }
+
+    /// Returns the estimated size of the sketch in bytes
+    pub fn estimated_size(&self) -> usize {
+        let levels_size: usize = self
+            .levels
+            .iter()
+            .map(|level| level.capacity() * size_of::<f64>())
+            .sum();
+        size_of::<Self>()
+            + self.base_buffer.capacity() * size_of::<f64>()
+            + self.levels.capacity() * size_of::<Vec<f64>>()
+            + levels_size
+    }
+
+    /// Returns the minimum value seen by this sketch; `None` if the sketch is empty.
+    pub fn min_item(&self) -> Option<f64> {
+        self.min_item
+    }
+
+    /// Returns the maximum value seen by this sketch; `None` if the sketch is empty.
+    pub fn max_item(&self) -> Option<f64> {
+        self.max_item
+    }
+
+    /// Returns the approximate normalized rank (from 0 to 1 inclusive) of the given value.
+    ///
+    /// With `inclusive` set, the rank includes the weight of the value itself; otherwise only
+    /// the weight of the smaller values is counted.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the value is `NaN`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// # let mut sketch = DoublesSketch::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// assert_eq!(sketch.rank(2.0, true), Some(0.5));
+    /// assert_eq!(sketch.rank(2.0, false), Some(0.25));
+    /// ```
+    pub fn rank(&self, item: f64, inclusive: bool) -> Option<f64> {
+        assert!(!item.is_nan(), "item must not be NaN");
+        if self.is_empty() {
+            return None;
+        }
+
+        let counted = |retained: &f64| {
+            if inclusive {
+                *retained <= item
+            } else {
+                *retained < item
+            }
+        };
+        let mut total = self.base_buffer.iter().filter(|v| counted(v)).count() as u64;
+        for (level, items) in self.levels.iter().enumerate() {
+            // levels are sorted
+            total += (items.partition_point(counted) as u64) << (level + 1);
+        }
+        Some(total as f64 / self.n as f64)
+    }
+
+    /// Returns the approximate value at the given normalized rank.
+    ///
+    /// With `inclusive` set, the result is the smallest value whose inclusive rank is at least
+    /// the given rank; otherwise it is the smallest value whose exclusive rank is greater than
+    /// it. Ranks 0 and 1 always return the exact minimum and maximum values.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if rank is not in [0.0, 1.0].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// # let mut sketch = DoublesSketch::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// assert_eq!(sketch.quantile(0.5, true), Some(2.0));
+    /// assert_eq!(sketch.quantile(0.5, false), Some(3.0));
+    /// ```
+    pub fn quantile(&self, rank: f64, inclusive: bool) -> Option<f64> {
+        assert!((0.0..=1.0).contains(&rank), "rank must be in [0.0, 1.0]");
+        if self.is_empty() {
+            return None;
+        }
+        if rank == 0.0 {
+            return self.min_item;
+        }
+        if rank == 1.0 {
+            return self.max_item;
+        }
+        Some(self.sorted_view().quantile(rank, inclusive))
+    }
+
+    /// Returns an approximation to the Cumulative Distribution Function (CDF) of the input
+    /// stream given a set of split points.
+    ///
+    /// # Arguments
+    ///
+    /// * `split_points`: An array of _m_ unique, monotonically increasing values that divide the
+    ///   input domain into _m+1_ consecutive disjoint intervals.
+    /// * `inclusive`: If true, each interval includes its upper split point; otherwise it includes
+    ///   its lower split point.
+    ///
+    /// # Returns
+    ///
+    /// An array of m+1 doubles: the ranks of the split points followed by 1.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `split_points` is not unique, not monotonically increasing, or contains `NaN`
+    /// values.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// # let mut sketch = DoublesSketch::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// let cdf = sketch.cdf(&[2.0, 3.0], true).unwrap();
+    /// assert_eq!(cdf, [0.5, 0.75, 1.0]);
+    /// ```
+    pub fn cdf(&self, split_points: &[f64], inclusive: bool) -> Option<Vec<f64>> {
+        check_split_points(split_points);
+        if self.is_empty() {
+            return None;
+        }
+        Some(self.sorted_view().cdf(split_points, inclusive, less))
+    }
+
+    /// Returns an approximation to the Probability Mass Function (PMF) of the input stream
+    /// given a set of split points.
+    ///
+    /// # Arguments
+    ///
+    /// * `split_points`: An array of _m_ unique, monotonically increasing values that divide the
+    ///   input domain into _m+1_ consecutive disjoint intervals (bins).
+    /// * `inclusive`: If true, each interval includes its upper split point; otherwise it includes
+    ///   its lower split point.
+    ///
+    /// # Returns
+    ///
+    /// An array of m+1 doubles each of which is an approximation to the fraction of the input
+    /// stream values (the mass) that fall into one of those intervals.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `split_points` is not unique, not monotonically increasing, or contains `NaN`
+    /// values.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// # let mut sketch = DoublesSketch::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// let pmf = sketch.pmf(&[2.0, 3.0], true).unwrap();
+    /// assert_eq!(pmf, [0.5, 0.25, 0.25]);
+    /// ```
+    pub fn pmf(&self, split_points: &[f64], inclusive: bool) -> Option<Vec<f64>> {
+        check_split_points(split_points);
+        if self.is_empty() {
+            return None;
+        }
+        Some(self.sorted_view().pmf(split_points, inclusive, less))
+    }
+
+    /// Returns boundaries that split the input stream into `num_parts` parts of roughly equal
+    /// size.
+    ///
+    /// The first boundary is the minimum and the last the maximum value seen. With `inclusive`
+    /// set, each part includes its upper boundary; otherwise it includes its lower boundary.
+    /// See [`PartitionBoundaries`] for the ranks and sizes of the parts.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `num_parts` is 0.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// let mut sketch = DoublesSketch::default();
+    /// for value in 1..=100 {
+    ///     sketch.update(value as f64);
+    /// }
+    ///
+    /// let partition = sketch.partition_boundaries(4, true).unwrap();
+    /// assert_eq!(partition.boundaries(), [1.0, 25.0, 50.0, 75.0, 100.0]);
+    /// assert_eq!(partition.part_sizes(), [25, 25, 25, 25]);
+    /// ```
+    pub fn partition_boundaries(
+        &self,
+        num_parts: usize,
+        inclusive: bool,
+    ) -> Option<PartitionBoundaries<f64>> {
+        assert!(num_parts > 0, "num_parts must be at least 1");
+        let (Some(min_item), Some(max_item)) = (self.min_item, self.max_item) else {
+            return None;
+        };
+        Some(
+            self.sorted_view()
+                .partition_boundaries(num_parts, inclusive, min_item, max_item, less),
+        )
+    }
+
+    /// Returns the retained items in ascending order together with their weights.
+    ///
+    /// Items of the base buffer have weight 1 and items of level _i_ have weight 2^(_i_+1).
+    /// Iterating the [`SortedView`] yields `(item, weight, cumulative_weight)`; the view of an
+    /// empty sketch is empty.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// # let mut sketch = DoublesSketch::default();
+    /// # for value in [3.0, 1.0, 2.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// let view = sketch.sorted_view();
+    /// let entries: Vec<_> = view.iter().map(|(item, w, c)| (*item, w, c)).collect();
+    /// assert_eq!(entries, [(1.0, 1, 1), (2.0, 1, 2), (3.0, 1, 3)]);
+    /// ```
+    pub fn sorted_view(&self) -> SortedView<f64> {
+        let mut entries = Vec::with_capacity(self.num_retained());
+        entries.extend(self.base_buffer.iter().map(|&item| (item, 1)));
+        for (level, items) in self.levels.iter().enumerate() {
+            let weight = 1 << (level + 1);
+            entries.extend(items.iter().map(|&item| (item, weight)));
+        }
+        SortedView::new(entries, less)
+    }
+
+    /// Serializes this sketch to bytes in the compact format.
+    ///
+    /// The output matches the compact `quantiles_sketch<double>` images of the C++
+    /// implementation and can be read by `DoublesSketch.heapify` in Java.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// # let mut sketch = DoublesSketch::default();
+    /// # sketch.update(1.0);
+    /// let bytes = sketch.serialize();
+    /// let decoded = DoublesSketch::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.max_item(), Some(1.0));
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        if self.is_empty() {
+            EMPTY_PREAMBLE_SIZE
+        } else {
+            FULL_PREAMBLE_SIZE + self.num_retained() * size_of::<f64>()
+        }
+    }
+
+    /// Serializes this sketch into `buf` in the compact format written by
+    /// [`serialize`](Self::serialize), returning the number of bytes written.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `buf` is shorter than [`serialized_size_bytes`].
+    ///
+    /// [`serialized_size_bytes`]: Self::serialized_size_bytes
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Writes the serialized sketch to `writer`.
+    ///
+    /// This streams the image [`serialize`](Self::serialize) returns in chunks instead of
+    /// assembling it in memory first.
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        bytes.write_u8(if self.is_empty() {
+            PREAMBLE_LONGS_EMPTY
+        } else {
+            PREAMBLE_LONGS_FULL
+        });
+        bytes.write_u8(SERIAL_VERSION_3);
+        bytes.write_u8(Family::QUANTILES.id);
+        bytes.write_u8({
+            // the base buffer is written sorted
+            let mut flags = FLAGS_IS_COMPACT | FLAGS_IS_SORTED;
+            if self.is_empty() {
+                flags |= FLAGS_IS_EMPTY;
+            }
+            flags
+        });
+        bytes.write_u16_le(self.k);
+        bytes.write_u16_le(0); // unused
+        if self.is_empty() {
+            return;
+        }
+
+        bytes.write_u64_le(self.n);
+        // both are present in a non-empty sketch
+        bytes.write_f64_le(self.min_item.unwrap());
+        bytes.write_f64_le(self.max_item.unwrap());
+        let mut base_buffer = self.base_buffer.clone();
+        base_buffer.sort_by(f64::total_cmp);
+        for item in base_buffer {
+            bytes.write_f64_le(item);
+        }
+        for &item in self.levels.iter().flatten() {
+            bytes.write_f64_le(item);
+        }
+    }
+
+    /// Deserializes a sketch from bytes.
+    ///
+    /// Both the compact and the updatable formats are accepted, in serial version 3 and the
+    /// legacy serial versions 1 and 2 of the Java implementation.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quantiles::DoublesSketch;
+    /// # let mut sketch = DoublesSketch::default();
+    /// # sketch.update(1.0);
+    /// # sketch.update(2.0);
+    /// # let bytes = sketch.serialize();
+    /// let decoded = DoublesSketch::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.n(), 2);
+    /// ```
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// Exactly the bytes of one image are consumed, so several sketches can be read back from
+    /// the same stream.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        let preamble_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let k = cursor.read_u16_le().map_err(insufficient_data("k"))?;
+        cursor
+            .read_u16_le()
+            .map_err(insufficient_data("<unused>"))?;
+
+        Family::QUANTILES.validate_id(family_id)?;
+        let is_empty = (flags & FLAGS_IS_EMPTY) != 0;
+        match serial_version {
+            SERIAL_VERSION_1 => {
+                let expected = if is_empty {
+                    PREAMBLE_LONGS_EMPTY
+                } else {
+                    PREAMBLE_LONGS_FULL_V1
+                };
+                ensure_preamble_longs_in(&[expected], preamble_longs)?;
+            }
+            SERIAL_VERSION_2 => {
+                let expected = if is_empty {
+                    PREAMBLE_LONGS_EMPTY
+                } else {
+                    PREAMBLE_LONGS_FULL
+                };
+                ensure_preamble_longs_in(&[expected], preamble_longs)?;
+            }
+            SERIAL_VERSION_3 => {
+                let expected: &[u8] = if is_empty {
+                    &[PREAMBLE_LONGS_EMPTY, PREAMBLE_LONGS_FULL]
+                } else {
+                    &[PREAMBLE_LONGS_FULL]
+                };
+                ensure_preamble_longs_in(expected, preamble_longs)?;
+            }
+            _ => {
+                return Err(Error::new(
+                    ErrorKind::UnsupportedVersion,
+                    format!(
+                        "unsupported serial version: expected {SERIAL_VERSION_1}, {SERIAL_VERSION_2} or {SERIAL_VERSION_3}, got {serial_version}"
+                    ),
+                )
+                .with_reason(SketchError::UnsupportedSerialVersion {
+                    expected: SERIAL_VERSION_3,
+                    actual: serial_version,
+                }));
+            }
+        }
+        if (flags & FLAGS_IS_BIG_ENDIAN) != 0 {
+            return Err(Error::deserial("big-endian images are not supported"));
+        }
+        if !is_valid_k(k) {
+            return Err(Error::deserial(format!(
+                "k must be a power of 2 in [{MIN_K}, {MAX_K}], got {k}"
+            )));
+        }
+        if is_empty {
+            return Ok(DoublesSketch::new(k));
+        }
+
+        // serial version 2 images are compact, but do not always carry the flag
+        let is_compact = serial_version == SERIAL_VERSION_2
+            || (flags & (FLAGS_IS_COMPACT | FLAGS_IS_READ_ONLY)) != 0;
+        let n = cursor.read_u64_le().map_err(insufficient_data("n"))?;
+        if n == 0 {
+            return Err(Error::deserial("n must be positive in a non-empty sketch"));
+        }
+        let min_item = cursor
+            .read_f64_le()
+            .map_err(insufficient_data("min_item"))?;
+        let max_item = cursor
+            .read_f64_le()
+            .map_err(insufficient_data("max_item"))?;
+        if serial_version == SERIAL_VERSION_1 {
+            cursor
+                .read_u64_le()
+                .map_err(insufficient_data("<buffer_allocation>"))?;
+        }
+
+        let k_items = k as usize;
+        let base_buffer_count = (n % (2 * k as u64)) as usize;
+        let bit_pattern = n / (2 * k as u64);
+        let num_levels = (u64::BITS - bit_pattern.leading_zeros()) as usize;
+
+        let base_buffer = read_items(&mut cursor, base_buffer_count, "base_buffer")?;
+        if !is_compact && num_levels > 0 {
+            // an updatable image reserves room for a full base buffer once it has levels
+            cursor.advance(((2 * k_items - base_buffer_count) * size_of::<f64>()) as u64);
+        }
+        let mut levels = Vec::with_capacity(num_levels);
+        for level in 0..num_levels {
+            if bit_pattern & (1 << level) != 0 {
+                levels.push(read_items(&mut cursor, k_items, "levels")?);
+            } else {
+                if !is_compact {
+                    cursor.advance((k_items * size_of::<f64>()) as u64);
+                }
+                levels.push(vec![]);
+            }
+        }
+
+        Ok(DoublesSketch {
+            k,
+            n,
+            min_item: Some(min_item),
+            max_item: Some(max_item),
+            base_buffer,
+            levels,
+            bit_pattern,
+        })
+    }
+
+    /// Adds k sorted values of weight 2^(starting_level + 1) to the levels, merging and
+    /// halving the occupied levels above like the carry of a binary adder.
+    fn propagate_carry(&mut self, starting_level: usize, mut carry: Vec<f64>) {
+        debug_assert_eq!(carry.len(), self.k as usize);
+        let ending_level =
+            starting_level + (self.bit_pattern >> starting_level).trailing_ones() as usize;
+        if self.levels.len() <= ending_level {
+            self.levels.resize_with(ending_level + 1, Vec::new);
+        }
+        for level in starting_level..ending_level {
+            let merged = merge_sorted(&self.levels[level], &carry);
+            self.levels[level].clear();
+            carry = zip_with_stride(&merged, 2);
+        }
+        self.levels[ending_level] = carry;
+        self.bit_pattern += 1 << starting_level;
+    }
+
+    /// Merges a sketch in estimation mode with a k that is a multiple of the k of this sketch.
+    fn merge_levels(&mut self, other: &DoublesSketch) {
+        debug_assert!(other.k >= self.k);
+        let factor = (other.k / self.k) as usize;
+        let lg_factor = factor.trailing_zeros() as usize;
+        let final_n = self.n + other.n;
+
+        for &item in &other.base_buffer {
+            self.update(item);
+        }
+        for (level, items) in other.levels.iter().enumerate() {
+            if !items.is_empty() {
+                // values of a sketch with a larger k are downsampled to k of this sketch
+                let carry = zip_with_stride(items, factor);
+                self.propagate_carry(level + lg_factor, carry);
+            }
+        }
+        self.n = final_n;
+        debug_assert_eq!(self.bit_pattern, self.n / (2 * self.k as u64));
+
+        if let (Some(min), Some(other_min)) = (self.min_item, other.min_item) {
+            self.min_item = Some(min.min(other_min));
+        }
+        if let (Some(max), Some(other_max)) = (self.max_item, other.max_item) {
+            self.max_item = Some(max.max(other_max));
+        }
+        if self.min_item.is_none() {
+            self.min_item = other.min_item;
+            self.max_item = other.max_item;
+        }
+    }
+}
+
+fn is_valid_k(k: u16) -> bool {
+    (MIN_K..=MAX_K).contains(&k) && k.is_power_of_two()
+}
+
+fn less(a: &f64, b: &f64) -> bool {
+    a < b
+}
+
+/// Returns every `stride`-th value of the given values, starting at a random offset.
+fn zip_with_stride(items: &[f64], stride: usize) -> Vec<f64> {
+    let offset = (random::next_u64() % stride as u64) as usize;
+    items.iter().skip(offset).step_by(stride).copied().collect()
+}
+
+fn merge_sorted(a: &[f64], b: &[f64]) -> Vec<f64> {
+    let mut out = Vec::with_capacity(a.len() + b.len());
+    let (mut i, mut j) = (0, 0);
+    while i < a.len() && j < b.len() {
+        if b[j] < a[i] {
+            out.push(b[j]);
+            j += 1;
+        } else {
+            out.push(a[i]);
+            i += 1;
+        }
+    }
+    out.extend_from_slice(&a[i..]);
+    out.extend_from_slice(&b[j..]);
+    out
+}
+
+fn read_items(
+    cursor: &mut SketchSlice<'_>,
+    count: usize,
+    tag: &'static str,
+) -> Result<Vec<f64>, Error> {
+    let mut items = Vec::with_capacity(cursor.capacity_hint(count, 8));
+    for _ in 0..count {
+        let item = cursor.read_f64_le().map_err(insufficient_data(tag))?;
+        if item.is_nan() {
+            return Err(Error::deserial(format!("{tag} must not be NaN")));
+        }
+        items.push(item);
+    }
+    Ok(items)
+}
+
+fn check_split_points(split_points: &[f64]) {
+    let len = split_points.len();
+    if len == 1 && split_points[0].is_nan() {
+        panic!("split_points must not contain NaN values: {split_points:?}");
+    }
+    for i in 0..len.saturating_sub(1) {
+        if split_points[i] < split_points[i + 1] {
+            // we must use this positive condition because NaN comparisons are always false
+            continue;
+        }
+        panic!("split_points must be unique and monotonically increasing: {split_points:?}");
+    }
+}
+
+/// Updates the sketch with every value of the iterator. `NaN` values are ignored.
+impl Extend<f64> for DoublesSketch {
+    fn extend<I: IntoIterator<Item = f64>>(&mut self, iter: I) {
+        for item in iter {
+            self.update(item);
+        }
+    }
+}
+
+/// Collects the values into a sketch with the default k. `NaN` values are ignored.
+impl FromIterator<f64> for DoublesSketch {
+    fn from_iter<I: IntoIterator<Item = f64>>(iter: I) -> Self {
+        let mut sketch = DoublesSketch::default();
+        sketch.extend(iter);
+        sketch
+    }
+}
+
+impl QuantileSketch for DoublesSketch {
+    type Item = f64;
+
+    fn n(&self) -> u64 {
+        self.n()
+    }
+
+    fn is_exact(&self) -> bool {
+        !self.is_estimation_mode()
+    }
+
+    fn is_empty(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn min_item(&self) -> Option<f64> {
+        self.min_item()
+    }
+
+    fn max_item(&self) -> Option<f64> {
+        self.max_item()
+    }
+
+    fn rank(&self, item: f64, inclusive: bool) -> Option<f64> {
+        self.rank(item, inclusive)
+    }
+
+    fn quantile(&self, rank: f64, inclusive: bool) -> Option<f64> {
+        self.quantile(rank, inclusive)
+    }
+}
+
+impl MergeableSketch for DoublesSketch {
+    fn merge(&mut self, other: &Self) -> Result<(), Error> {
+        self.merge(other);
+        Ok(())
+    }
+}
+
+/// Merges the sketchs into the first one, or returns an empty default sketch when there are none.
+impl Sum for DoublesSketch {
+    fn sum<I: Iterator<Item = Self>>(mut iter: I) -> Self {
+        let mut result = iter.next().unwrap_or_default();
+        for other in iter {
+            result.merge(&other);
+        }
+        result
+    }
+}
+
+/// Merges the sketchs into a copy of the first one, as the `Sum<DoublesSketch>` impl does.
+impl<'a> Sum<&'a DoublesSketch> for DoublesSketch {
+    fn sum<I: Iterator<Item = &'a Self>>(mut iter: I) -> Self {
+        let mut result = iter.next().cloned().unwrap_or_default();
+        for other in iter {
+            result.merge(other);
+        }
+        result
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(DoublesSketch);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(DoublesSketch);
+impl_fingerprint_via_image!(DoublesSketch);
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn assert_consistent(sketch: &DoublesSketch) {
+        let k = sketch.k as usize;
+        assert_eq!(sketch.bit_pattern, sketch.n / (2 * k as u64));
+        assert_eq!(sketch.base_buffer.len() as u64, sketch.n % (2 * k as u64));
+        let mut weight = sketch.base_buffer.len() as u64;
+        for (level, items) in sketch.levels.iter().enumerate() {
+            let occupied = sketch.bit_pattern & (1 << level) != 0;
+            assert_eq!(items.len(), if occupied { k } else { 0 });
+            assert!(items.is_sorted());
+            weight += (items.len() as u64) << (level + 1);
+        }
+        assert_eq!(weight, sketch.n);
+    }
+
+    #[test]
+    fn test_levels_stay_consistent() {
+        let mut sketch = DoublesSketch::new(MIN_K);
+        for i in 0..10_000 {
+            sketch.update(i as f64);
+            assert_consistent(&sketch);
+        }
+    }
+
+    #[test]
+    fn test_merge_keeps_levels_consistent() {
+        let mut left = DoublesSketch::new(16);
+        let mut right = DoublesSketch::new(64);
+        for i in 0..1000 {
+            left.update(i as f64);
+            right.update((1000 + i) as f64);
+        }
+        left.merge(&right);
+        assert_eq!(left.n(), 2000);
+        assert_eq!(left.k(), 16);
+        assert_consistent(&left);
+
+        right.merge(&left);
+        assert_eq!(right.n(), 3000);
+        assert_eq!(right.k(), 16);
+        assert_consistent(&right);
+    }
+
+    #[test]
+    fn test_zip_with_stride() {
+        let items: Vec<f64> = (0..16).map(|i| i as f64).collect();
+        for stride in [1, 2, 4] {
+            let zipped = zip_with_stride(&items, stride);
+            assert_eq!(zipped.len(), 16 / stride);
+            assert!(zipped.windows(2).all(|w| w[1] - w[0] == stride as f64));
+        }
+    }
+}
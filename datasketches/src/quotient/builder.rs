@@ -0,0 +1,213 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use super::QuotientFilter;
+use crate::common::SketchConfig;
+use crate::hash::DEFAULT_UPDATE_SEED;
+
+/// Builder for creating [`QuotientFilter`] instances.
+///
+/// Provides two construction modes:
+/// * [`with_accuracy()`](Self::with_accuracy): Specify target items and false positive rate
+///   (recommended)
+/// * [`with_size()`](Self::with_size): Specify the number of slots and remainder bits (manual)
+#[derive(Debug, Clone)]
+pub struct QuotientFilterBuilder {
+    lg_num_slots: u8,
+    fingerprint_bits: u8,
+    seed: u64,
+}
+
+impl QuotientFilterBuilder {
+    /// Minimum allowed log2 of the number of slots.
+    pub const MIN_LG_NUM_SLOTS: u8 = 1;
+    /// Maximum allowed log2 of the number of slots.
+    pub const MAX_LG_NUM_SLOTS: u8 = 31;
+    /// Minimum allowed number of remainder bits per slot.
+    pub const MIN_FINGERPRINT_BITS: u8 = 1;
+    /// Maximum allowed number of remainder bits per slot.
+    ///
+    /// Together with the three metadata bits, a slot always fits in a 64-bit word.
+    pub const MAX_FINGERPRINT_BITS: u8 = 61;
+
+    /// Creates a builder with suggested parameters for a target accuracy.
+    ///
+    /// The number of slots is chosen so that `max_items` fit below the expansion threshold, and
+    /// the remainder length so that a query on a full filter has a false positive probability of
+    /// at most `fpp`.
+    ///
+    /// # Arguments
+    ///
+    /// * `max_items`: Maximum expected number of distinct items
+    /// * `fpp`: Target false positive probability (e.g., 0.01 for 1%)
+    ///
+    /// # Panics
+    ///
+    /// Panics if `max_items` is 0 or `fpp` is not in (0.0, 1.0].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// let filter = QuotientFilterBuilder::with_accuracy(10_000, 0.01)
+    ///     .seed(42)
+    ///     .build();
+    /// ```
+    pub fn with_accuracy(max_items: u64, fpp: f64) -> Self {
+        assert!(max_items > 0, "max_items must be greater than 0");
+        assert!(
+            fpp > 0.0 && fpp <= 1.0,
+            "fpp must be between 0.0 and 1.0 (inclusive of 1.0)"
+        );
+
+        let lg_num_slots = Self::suggest_lg_num_slots(max_items);
+        let fingerprint_bits = Self::suggest_fingerprint_bits(fpp).min(64 - lg_num_slots);
+
+        QuotientFilterBuilder {
+            lg_num_slots,
+            fingerprint_bits,
+            seed: DEFAULT_UPDATE_SEED,
+        }
+    }
+
+    /// Creates a builder with manual size specification.
+    ///
+    /// # Arguments
+    ///
+    /// * `lg_num_slots`: Log2 of the number of slots in the table
+    /// * `fingerprint_bits`: Number of remainder bits stored in each slot
+    ///
+    /// # Panics
+    ///
+    /// Panics if any of:
+    /// * `lg_num_slots` < [`Self::MIN_LG_NUM_SLOTS`] or `lg_num_slots` > [`Self::MAX_LG_NUM_SLOTS`]
+    /// * `fingerprint_bits` < [`Self::MIN_FINGERPRINT_BITS`] or `fingerprint_bits` >
+    ///   [`Self::MAX_FINGERPRINT_BITS`]
+    /// * `lg_num_slots + fingerprint_bits` exceeds the 64 bits of the hash
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// let filter = QuotientFilterBuilder::with_size(12, 8).build();
+    /// assert_eq!(filter.num_slots(), 4096);
+    /// ```
+    pub fn with_size(lg_num_slots: u8, fingerprint_bits: u8) -> Self {
+        assert!(
+            (Self::MIN_LG_NUM_SLOTS..=Self::MAX_LG_NUM_SLOTS).contains(&lg_num_slots),
+            "lg_num_slots must be between {} and {}, got {}",
+            Self::MIN_LG_NUM_SLOTS,
+            Self::MAX_LG_NUM_SLOTS,
+            lg_num_slots,
+        );
+        assert!(
+            (Self::MIN_FINGERPRINT_BITS..=Self::MAX_FINGERPRINT_BITS).contains(&fingerprint_bits),
+            "fingerprint_bits must be between {} and {}, got {}",
+            Self::MIN_FINGERPRINT_BITS,
+            Self::MAX_FINGERPRINT_BITS,
+            fingerprint_bits,
+        );
+        assert!(
+            lg_num_slots + fingerprint_bits <= 64,
+            "lg_num_slots + fingerprint_bits must be at most 64, got {}",
+            lg_num_slots + fingerprint_bits,
+        );
+
+        QuotientFilterBuilder {
+            lg_num_slots,
+            fingerprint_bits,
+            seed: DEFAULT_UPDATE_SEED,
+        }
+    }
+
+    /// Sets a custom hash seed (default: 9001).
+    ///
+    /// **Important**: Filters with different seeds cannot be merged.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// let filter = QuotientFilterBuilder::with_accuracy(100, 0.01)
+    ///     .seed(12345)
+    ///     .build();
+    /// assert_eq!(filter.seed(), 12345);
+    /// ```
+    pub fn seed(mut self, seed: u64) -> Self {
+        self.seed = seed;
+        self
+    }
+
+    /// Apply the seed of `config`, where set.
+    pub fn config(self, config: &SketchConfig) -> Self {
+        match config.seed {
+            Some(seed) => self.seed(seed),
+            None => self,
+        }
+    }
+
+    /// Builds the quotient filter.
+    pub fn build(self) -> QuotientFilter {
+        QuotientFilter::new(self.lg_num_slots, self.fingerprint_bits, self.seed)
+    }
+
+    /// Suggests the log2 of the number of slots needed to hold `max_items` items.
+    ///
+    /// Returns the smallest table whose expansion threshold (90% of its slots) is at least
+    /// `max_items`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// assert_eq!(QuotientFilterBuilder::suggest_lg_num_slots(900), 10);
+    /// assert_eq!(QuotientFilterBuilder::suggest_lg_num_slots(1000), 11);
+    /// ```
+    pub fn suggest_lg_num_slots(max_items: u64) -> u8 {
+        let mut lg_num_slots = Self::MIN_LG_NUM_SLOTS;
+        while lg_num_slots < Self::MAX_LG_NUM_SLOTS
+            && QuotientFilter::max_entries_for(lg_num_slots) < max_items
+        {
+            lg_num_slots += 1;
+        }
+        lg_num_slots
+    }
+
+    /// Suggests the number of remainder bits given a target FPP.
+    ///
+    /// Formula: `r = -log2(p)`
+    /// where p = fpp
+    ///
+    /// A query on a filter with load factor `a` returns a false positive with probability of
+    /// about `a / 2^r`, so this bound holds at any load.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// let bits = QuotientFilterBuilder::suggest_fingerprint_bits(0.01);
+    /// assert_eq!(bits, 7); // -log2(0.01) ≈ 6.64
+    /// ```
+    pub fn suggest_fingerprint_bits(fpp: f64) -> u8 {
+        // Ceil to avoid selecting too few bits.
+        let bits = -fpp.log2();
+        bits.ceil().clamp(
+            f64::from(Self::MIN_FINGERPRINT_BITS),
+            f64::from(Self::MAX_FINGERPRINT_BITS),
+        ) as u8
+    }
+}
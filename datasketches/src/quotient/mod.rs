@@ -0,0 +1,105 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Quotient Filter implementation for probabilistic set membership testing.
+//!
+//! A quotient filter answers the same "possibly in set" or "definitely not in set" question as
+//! a Bloom filter, but stores a single fingerprint per item in a compact open-addressed hash
+//! table instead of setting bits for several hash functions. Each item's hash is split into a
+//! *quotient*, which selects a slot, and a *remainder*, which is stored in it. Three metadata
+//! bits per slot allow the remainders of colliding quotients to be kept in sorted runs so that
+//! the original fingerprints can be recovered.
+//!
+//! # Properties
+//!
+//! * **No false negatives**: If an item was inserted, `contains()` will always return `true`
+//! * **Possible false positives**: Two items collide only if their fingerprints are equal
+//! * **Single memory probe**: A query touches one contiguous cluster of slots
+//! * **Expandable**: When the load factor exceeds 90%, the filter doubles its number of slots,
+//!   moving one bit from every remainder to the quotient
+//! * **Mergeable with different sizes**: Filters that share a seed and the total number of
+//!   fingerprint bits can be merged, even after they expanded a different number of times
+//!
+//! # Usage
+//!
+//! ```
+//! use datasketches::quotient::QuotientFilter;
+//! use datasketches::quotient::QuotientFilterBuilder;
+//!
+//! // Create a filter sized for 1000 items with a 1% false positive rate
+//! let mut filter = QuotientFilterBuilder::with_accuracy(1000, 0.01).build();
+//!
+//! filter.insert("apple");
+//! filter.insert("banana");
+//! filter.insert(42_u64);
+//!
+//! assert!(filter.contains(&"apple"));
+//! assert!(!filter.contains(&"grape"));
+//!
+//! println!("Slots: {}", filter.num_slots());
+//! println!("Entries: {}", filter.num_entries());
+//! println!("Est. FPP: {:.4}%", filter.estimated_fpp() * 100.0);
+//! ```
+//!
+//! # Creating Filters
+//!
+//! As with [`crate::bloom`], a filter is either sized from a target accuracy:
+//!
+//! ```
+//! # use datasketches::quotient::QuotientFilterBuilder;
+//! let filter = QuotientFilterBuilder::with_accuracy(
+//!     10_000, // Expected max items
+//!     0.01,   // Target false positive probability (1%)
+//! )
+//! .seed(9001) // Optional: custom seed
+//! .build();
+//! assert_eq!(filter.lg_num_slots(), 14);
+//! assert_eq!(filter.fingerprint_bits(), 7);
+//! ```
+//!
+//! or from an explicit table size and fingerprint length:
+//!
+//! ```
+//! # use datasketches::quotient::QuotientFilterBuilder;
+//! let filter = QuotientFilterBuilder::with_size(
+//!     16, // log2 of the number of slots
+//!     10, // Remainder bits stored per slot
+//! )
+//! .build();
+//! assert_eq!(filter.num_slots(), 65_536);
+//! ```
+//!
+//! # Implementation Details
+//!
+//! * Uses XXHash64 for hashing; the quotient is taken from the low-order bits of the hash and the
+//!   remainder from the bits immediately above it
+//! * Each slot holds the three metadata bits (occupied, continuation, shifted) followed by the
+//!   remainder, bit-packed into `u64` words
+//! * The serialization layout follows the Bloom filter's preamble conventions under family ID 22.
+//!   The Java quotient filter does not define a serialized form yet, so these images are currently
+//!   only exchanged between Rust processes.
+//!
+//! # References
+//!
+//! * Bender et al. (2012). "Don't Thrash: How to Cache Your Hash on Flash"
+//! * Pandey et al. (2017). "A General-Purpose Counting Filter: Making Every Bit Count"
+
+mod builder;
+mod sketch;
+
+pub use self::builder::QuotientFilterBuilder;
+pub use self::sketch::QuotientFilter;
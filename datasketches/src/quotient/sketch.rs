@@ -0,0 +1,856 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::collections::VecDeque;
+use std::hash::Hash;
+use std::hash::Hasher;
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in_range;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::error::Error;
+use crate::hash::XxHash64;
+use crate::quotient::QuotientFilterBuilder;
+
+// Serialization constants
+const SERIAL_VERSION: u8 = 1;
+const EMPTY_FLAG_MASK: u8 = 1 << 2;
+
+// Slot layout: three metadata bits followed by the remainder
+const METADATA_BITS: u8 = 3;
+const OCCUPIED_MASK: u64 = 1;
+const CONTINUATION_MASK: u64 = 1 << 1;
+const SHIFTED_MASK: u64 = 1 << 2;
+const METADATA_MASK: u64 = OCCUPIED_MASK | CONTINUATION_MASK | SHIFTED_MASK;
+
+/// Largest slot array, in words, that an empty image may declare: 512 MiB.
+///
+/// Empty images do not store the array, so 16 bytes could otherwise claim gigabytes of it.
+/// Larger empty filters are written with their zeroed slots instead.
+const MAX_EMPTY_IMAGE_NUM_WORDS: usize = 1 << 26;
+
+/// A quotient filter for probabilistic set membership testing.
+///
+/// Provides fast membership queries with:
+/// * No false negatives (inserted items always return `true`)
+/// * A false positive rate set by the number of remainder bits
+/// * Automatic expansion when the table becomes too full
+///
+/// Use [`super::QuotientFilterBuilder`] to construct instances.
+#[derive(Debug, Clone, PartialEq)]
+pub struct QuotientFilter {
+    /// Hash seed
+    seed: u64,
+    /// Log2 of the number of slots (q)
+    lg_num_slots: u8,
+    /// Remainder bits per slot (r)
+    fingerprint_bits: u8,
+    /// Number of distinct fingerprints stored
+    num_entries: u64,
+    /// Slots of `METADATA_BITS + fingerprint_bits` bits, packed into u64 words
+    slots: Box<[u64]>,
+}
+
+impl QuotientFilter {
+    pub(super) fn new(lg_num_slots: u8, fingerprint_bits: u8, seed: u64) -> Self {
+        let num_words = Self::num_words(lg_num_slots, fingerprint_bits);
+        QuotientFilter {
+            seed,
+            lg_num_slots,
+            fingerprint_bits,
+            num_entries: 0,
+            slots: vec![0u64; num_words].into_boxed_slice(),
+        }
+    }
+
+    /// Returns the number of u64 words that hold `2^lg_num_slots` packed slots.
+    fn num_words(lg_num_slots: u8, fingerprint_bits: u8) -> usize {
+        let slot_bits = u64::from(METADATA_BITS + fingerprint_bits);
+        ((1u64 << lg_num_slots) * slot_bits).div_ceil(64) as usize
+    }
+
+    /// Returns the number of entries above which a table of `2^lg_num_slots` slots expands.
+    pub(super) fn max_entries_for(lg_num_slots: u8) -> u64 {
+        (1u64 << lg_num_slots) * 9 / 10
+    }
+
+    /// Tests whether an item is possibly in the set.
+    ///
+    /// Returns:
+    /// * `true`: Item was **possibly** inserted (or false positive)
+    /// * `false`: Item was **definitely not** inserted
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// let mut filter = QuotientFilterBuilder::with_accuracy(100, 0.01).build();
+    /// filter.insert("apple");
+    ///
+    /// assert!(filter.contains(&"apple"));
+    /// assert!(!filter.contains(&"grape"));
+    /// ```
+    pub fn contains<T: Hash>(&self, item: &T) -> bool {
+        if self.is_empty() {
+            return false;
+        }
+        self.contains_hash(self.compute_hash(item))
+    }
+
+    /// Tests and inserts an item in a single operation.
+    ///
+    /// Returns whether the item was possibly already in the set before insertion.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the item is new and the filter is full and can no longer expand.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// let mut filter = QuotientFilterBuilder::with_accuracy(100, 0.01).build();
+    ///
+    /// assert!(!filter.contains_and_insert(&"apple"));
+    /// assert!(filter.contains_and_insert(&"apple"));
+    /// ```
+    pub fn contains_and_insert<T: Hash>(&mut self, item: &T) -> bool {
+        !self.insert_hash(self.compute_hash(item))
+    }
+
+    /// Inserts an item into the filter.
+    ///
+    /// After insertion, `contains(item)` will always return `true`. Items whose fingerprint is
+    /// already present do not change the filter.
+    ///
+    /// Once the table holds more than 90% of its capacity, inserting expands it to twice the
+    /// number of slots with one remainder bit less, which keeps the false positive rate per
+    /// entry roughly constant. A filter with a single remainder bit, or with
+    /// [`QuotientFilterBuilder::MAX_LG_NUM_SLOTS`] slots, no longer expands.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the item is new and the filter is full and can no longer expand.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// let mut filter = QuotientFilterBuilder::with_accuracy(100, 0.01).build();
+    ///
+    /// filter.insert("apple");
+    /// filter.insert(42_u64);
+    /// filter.insert(&[1, 2, 3]);
+    ///
+    /// assert!(filter.contains(&"apple"));
+    /// assert_eq!(filter.num_entries(), 3);
+    /// ```
+    pub fn insert<T: Hash>(&mut self, item: T) {
+        self.insert_hash(self.compute_hash(&item));
+    }
+
+    /// Resets the filter to its initial empty state.
+    ///
+    /// Clears all slots while preserving the current size and configuration.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// let mut filter = QuotientFilterBuilder::with_accuracy(100, 0.01).build();
+    /// filter.insert("apple");
+    ///
+    /// filter.reset();
+    /// assert!(filter.is_empty());
+    /// assert!(!filter.contains(&"apple"));
+    /// ```
+    pub fn reset(&mut self) {
+        self.slots.fill(0);
+        self.num_entries = 0;
+    }
+
+    /// Merges another filter into this one (union).
+    ///
+    /// Every fingerprint of `other` is inserted into this filter, which expands as needed. The
+    /// filters may differ in their number of slots as long as they are
+    /// [compatible](Self::is_compatible).
+    ///
+    /// # Panics
+    ///
+    /// Panics if the filters are not compatible, or if this filter becomes full and can no longer
+    /// expand.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::QuotientFilterBuilder;
+    /// let mut f1 = QuotientFilterBuilder::with_size(8, 12).build();
+    /// let mut f2 = QuotientFilterBuilder::with_size(10, 10).build();
+    ///
+    /// f1.insert("a");
+    /// f2.insert("b");
+    ///
+    /// f1.union(&f2);
+    /// assert!(f1.contains(&"a"));
+    /// assert!(f1.contains(&"b"));
+    /// ```
+    pub fn union(&mut self, other: &QuotientFilter) {
+        assert!(
+            self.is_compatible(other),
+            "Cannot union incompatible quotient filters"
+        );
+
+        for (quotient, remainder) in other.entries() {
+            self.insert_hash(quotient | (remainder << other.lg_num_slots));
+        }
+    }
+
+    /// Returns whether the filter is empty (no items inserted).
+    pub fn is_empty(&self) -> bool {
+        self.num_entries == 0
+    }
+
+    /// Returns the number of distinct fingerprints stored.
+    pub fn num_entries(&self) -> u64 {
+        self.num_entries
+    }
+
+    /// Returns the number of slots in the table.
+    pub fn num_slots(&self) -> u64 {
+        1u64 << self.lg_num_slots
+    }
+
+    /// Returns log2 of the number of slots in the table.
+    pub fn lg_num_slots(&self) -> u8 {
+        self.lg_num_slots
+    }
+
+    /// Returns the number of remainder bits stored in each slot.
+    pub fn fingerprint_bits(&self) -> u8 {
+        self.fingerprint_bits
+    }
+
+    /// Returns the hash seed.
+    pub fn seed(&self) -> u64 {
+        self.seed
+    }
+
+    /// Returns the current load factor (fraction of slots in use).
+    pub fn load_factor(&self) -> f64 {
+        self.num_entries as f64 / self.num_slots() as f64
+    }
+
+    /// Estimates the current false positive probability.
+    ///
+    /// Uses the approximation: `1 - exp(-load_factor / 2^r)`
+    /// where:
+    /// * load_factor = fraction of slots in use (num_entries / num_slots)
+    /// * r = fingerprint_bits
+    pub fn estimated_fpp(&self) -> f64 {
+        let remainders = 2f64.powi(i32::from(self.fingerprint_bits));
+        -(-self.load_factor() / remainders).exp_m1()
+    }
+
+    /// Checks if two filters are compatible for merging.
+    ///
+    /// Filters are compatible if they have the same:
+    /// * Seed
+    /// * Total number of hash bits (`lg_num_slots + fingerprint_bits`), which expansion preserves
+    pub fn is_compatible(&self, other: &Self) -> bool {
+        self.seed == other.seed
+            && self.lg_num_slots + self.fingerprint_bits
+                == other.lg_num_slots + other.fingerprint_bits
+    }
+
+    /// Serializes the filter to a byte vector.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::{QuotientFilter, QuotientFilterBuilder};
+    /// let mut filter = QuotientFilterBuilder::with_accuracy(100, 0.01).build();
+    /// filter.insert("test");
+    ///
+    /// let bytes = filter.serialize();
+    /// let restored = QuotientFilter::deserialize(&bytes).unwrap();
+    /// assert!(restored.contains(&"test"));
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        if self.has_empty_image() {
+            8 * Family::QUOTIENTFILTER.min_pre_longs as usize
+        } else {
+            8 * Family::QUOTIENTFILTER.max_pre_longs as usize + self.slots.len() * 8
+        }
+    }
+
+    /// Returns whether the filter serializes to the short image that omits the slot array.
+    fn has_empty_image(&self) -> bool {
+        self.is_empty() && self.slots.len() <= MAX_EMPTY_IMAGE_NUM_WORDS
+    }
+
+    /// Serializes the filter into `buf`, returning the number of bytes written.
+    ///
+    /// Writes the image [`serialize`](Self::serialize) returns without allocating.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `buf` is shorter than [`serialized_size_bytes`].
+    ///
+    /// [`serialized_size_bytes`]: Self::serialized_size_bytes
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Writes the serialized filter to `writer`.
+    ///
+    /// This streams the image [`serialize`](Self::serialize) returns in chunks instead of
+    /// assembling it in memory first.
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        let is_empty = self.has_empty_image();
+        let preamble_longs = if is_empty {
+            Family::QUOTIENTFILTER.min_pre_longs
+        } else {
+            Family::QUOTIENTFILTER.max_pre_longs
+        };
+
+        // Preamble
+        bytes.write_u8(preamble_longs); // Byte 0
+        bytes.write_u8(SERIAL_VERSION); // Byte 1
+        bytes.write_u8(Family::QUOTIENTFILTER.id); // Byte 2
+        bytes.write_u8(if is_empty { EMPTY_FLAG_MASK } else { 0 }); // Byte 3: flags
+        bytes.write_u8(self.lg_num_slots); // Byte 4
+        bytes.write_u8(self.fingerprint_bits); // Byte 5
+        bytes.write_u16_le(0); // Bytes 6-7: unused
+
+        bytes.write_u64_le(self.seed);
+
+        if !is_empty {
+            bytes.write_u64_le(self.num_entries);
+
+            // Slot array
+            for &word in &self.slots {
+                bytes.write_u64_le(word);
+            }
+        }
+    }
+
+    /// Deserializes a filter from bytes.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if:
+    /// * The data is truncated or corrupted
+    /// * The family ID doesn't match (not a quotient filter)
+    /// * The serial version is unsupported
+    /// * An empty image declares a slot array larger than 512 MiB; empty images do not store the
+    ///   array, so its size is not bounded by the input
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::quotient::{QuotientFilter, QuotientFilterBuilder};
+    /// let original = QuotientFilterBuilder::with_accuracy(100, 0.01).build();
+    /// let bytes = original.serialize();
+    ///
+    /// let restored = QuotientFilter::deserialize(&bytes).unwrap();
+    /// assert_eq!(original, restored);
+    /// ```
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a filter written by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// Exactly the bytes of one image are consumed, so several filters can be read back from
+    /// the same stream.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        // Read preamble
+        let preamble_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+
+        // Validate
+        Family::QUOTIENTFILTER.validate_id(family_id)?;
+        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        ensure_preamble_longs_in_range(
+            Family::QUOTIENTFILTER.min_pre_longs..=Family::QUOTIENTFILTER.max_pre_longs,
+            preamble_longs,
+        )?;
+
+        let is_empty = (flags & EMPTY_FLAG_MASK) != 0;
+
+        let lg_num_slots = cursor
+            .read_u8()
+            .map_err(insufficient_data("lg_num_slots"))?;
+        if !(QuotientFilterBuilder::MIN_LG_NUM_SLOTS..=QuotientFilterBuilder::MAX_LG_NUM_SLOTS)
+            .contains(&lg_num_slots)
+        {
+            return Err(Error::deserial(format!(
+                "invalid lg_num_slots: expected [{}, {}], got {}",
+                QuotientFilterBuilder::MIN_LG_NUM_SLOTS,
+                QuotientFilterBuilder::MAX_LG_NUM_SLOTS,
+                lg_num_slots
+            )));
+        }
+        let fingerprint_bits = cursor
+            .read_u8()
+            .map_err(insufficient_data("fingerprint_bits"))?;
+        let max_fingerprint_bits =
+            QuotientFilterBuilder::MAX_FINGERPRINT_BITS.min(64 - lg_num_slots);
+        if !(QuotientFilterBuilder::MIN_FINGERPRINT_BITS..=max_fingerprint_bits)
+            .contains(&fingerprint_bits)
+        {
+            return Err(Error::deserial(format!(
+                "invalid fingerprint_bits: expected [{}, {}], got {}",
+                QuotientFilterBuilder::MIN_FINGERPRINT_BITS,
+                max_fingerprint_bits,
+                fingerprint_bits
+            )));
+        }
+        let _unused = cursor
+            .read_u16_le()
+            .map_err(insufficient_data("unused_header"))?;
+        let seed = cursor.read_u64_le().map_err(insufficient_data("seed"))?;
+
+        let num_words = QuotientFilter::num_words(lg_num_slots, fingerprint_bits);
+        if is_empty {
+            if num_words > MAX_EMPTY_IMAGE_NUM_WORDS {
+                return Err(Error::deserial(format!(
+                    "invalid lg_num_slots and fingerprint_bits: an empty image holds at most \
+                     {MAX_EMPTY_IMAGE_NUM_WORDS} words of slots, got {num_words}"
+                )));
+            }
+            let mut slots = Vec::new();
+            slots.try_reserve_exact(num_words).map_err(|_| {
+                Error::deserial(format!("cannot allocate a slot array of {num_words} words"))
+            })?;
+            slots.resize(num_words, 0);
+            return Ok(QuotientFilter {
+                seed,
+                lg_num_slots,
+                fingerprint_bits,
+                num_entries: 0,
+                slots: slots.into_boxed_slice(),
+            });
+        }
+
+        let num_entries = cursor
+            .read_u64_le()
+            .map_err(insufficient_data("num_entries"))?;
+        // an image declaring more slots than it holds fails here, before any large allocation
+        let mut slots = Vec::with_capacity(cursor.capacity_hint(num_words, 8));
+        for _ in 0..num_words {
+            slots.push(cursor.read_u64_le().map_err(insufficient_data("slots"))?);
+        }
+        let mut filter = QuotientFilter {
+            seed,
+            lg_num_slots,
+            fingerprint_bits,
+            num_entries: 0,
+            slots: slots.into_boxed_slice(),
+        };
+
+        let num_used_slots = (0..filter.num_slots())
+            .filter(|&index| filter.slot(index) & METADATA_MASK != 0)
+            .count() as u64;
+        if num_entries != num_used_slots {
+            return Err(Error::deserial(format!(
+                "invalid num_entries: expected {num_used_slots} from the slot array, got {num_entries}"
+            )));
+        }
+        filter.num_entries = num_entries;
+
+        Ok(filter)
+    }
+
+    /// Returns the estimated size of the filter in bytes
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>() + self.slots.len() * size_of::<u64>()
+    }
+
+    /// Computes the item hash using XXHash64 with the configured seed.
+    fn compute_hash<T: Hash>(&self, item: &T) -> u64 {
+        let mut hasher = XxHash64::with_seed(self.seed);
+        item.hash(&mut hasher);
+        hasher.finish()
+    }
+
+    /// Splits a hash into its quotient (low bits) and remainder (the bits above).
+    fn split_hash(&self, hash: u64) -> (u64, u64) {
+        let quotient = hash & (self.num_slots() - 1);
+        let remainder = (hash >> self.lg_num_slots) & ((1u64 << self.fingerprint_bits) - 1);
+        (quotient, remainder)
+    }
+
+    fn contains_hash(&self, hash: u64) -> bool {
+        let (quotient, remainder) = self.split_hash(hash);
+        if self.slot(quotient) & OCCUPIED_MASK == 0 {
+            return false;
+        }
+
+        let mut index = self.find_run_start(quotient);
+        loop {
+            if self.slot(index) >> METADATA_BITS == remainder {
+                return true;
+            }
+            index = self.next_index(index);
+            if self.slot(index) & CONTINUATION_MASK == 0 {
+                return false;
+            }
+        }
+    }
+
+    /// Inserts a hash, returning whether its fingerprint was not present before.
+    fn insert_hash(&mut self, hash: u64) -> bool {
+        if self.num_entries >= Self::max_entries_for(self.lg_num_slots) && self.can_expand() {
+            self.expand();
+        }
+
+        let (quotient, remainder) = self.split_hash(hash);
+        let canonical = self.slot(quotient);
+        if canonical & METADATA_MASK == 0 {
+            self.set_slot(quotient, (remainder << METADATA_BITS) | OCCUPIED_MASK);
+            self.num_entries += 1;
+            return true;
+        }
+
+        let (index, continuation) = if canonical & OCCUPIED_MASK != 0 {
+            // Append to the existing run unless the remainder is already in it.
+            let mut index = self.find_run_start(quotient);
+            loop {
+                if self.slot(index) >> METADATA_BITS == remainder {
+                    return false;
+                }
+                index = self.next_index(index);
+                if self.slot(index) & CONTINUATION_MASK == 0 {
+                    break;
+                }
+            }
+            (index, CONTINUATION_MASK)
+        } else {
+            (quotient, 0)
+        };
+
+        assert!(
+            self.num_entries < self.num_slots(),
+            "quotient filter is full and cannot expand"
+        );
+
+        let index = if continuation == 0 {
+            // Start a new run where it belongs among the runs of its cluster.
+            self.set_slot(quotient, canonical | OCCUPIED_MASK);
+            self.find_run_start(quotient)
+        } else {
+            index
+        };
+        let shifted = if index == quotient { 0 } else { SHIFTED_MASK };
+        self.shift_in(index, (remainder << METADATA_BITS) | continuation | shifted);
+        self.num_entries += 1;
+        true
+    }
+
+    /// Returns the index where the run of `quotient` starts, or would start.
+    ///
+    /// The occupied bit of `quotient` must be set.
+    fn find_run_start(&self, quotient: u64) -> u64 {
+        // Walk back to the start of the cluster.
+        let mut canonical = quotient;
+        while self.slot(canonical) & SHIFTED_MASK != 0 {
+            canonical = self.prev_index(canonical);
+        }
+
+        // Walk forward, skipping one run per occupied canonical slot.
+        let mut index = canonical;
+        while canonical != quotient {
+            loop {
+                index = self.next_index(index);
+                if self.slot(index) & CONTINUATION_MASK == 0 {
+                    break;
+                }
+            }
+            loop {
+                canonical = self.next_index(canonical);
+                if self.slot(canonical) & OCCUPIED_MASK != 0 {
+                    break;
+                }
+            }
+        }
+        index
+    }
+
+    /// Writes an entry at `index`, shifting the following entries of the cluster one slot right.
+    ///
+    /// Occupied bits describe canonical slots rather than entries, so they stay in place.
+    fn shift_in(&mut self, mut index: u64, entry: u64) {
+        let mut carry = entry;
+        loop {
+            let current = self.slot(index);
+            self.set_slot(index, carry | (current & OCCUPIED_MASK));
+            if current & METADATA_MASK == 0 {
+                return;
+            }
+            carry = (current & !OCCUPIED_MASK) | SHIFTED_MASK;
+            index = self.next_index(index);
+        }
+    }
+
+    /// Returns the `(quotient, remainder)` pairs of all stored fingerprints.
+    fn entries(&self) -> Vec<(u64, u64)> {
+        let mut entries = Vec::with_capacity(self.num_entries as usize);
+        if self.is_empty() {
+            return entries;
+        }
+
+        // Start at a slot that does not continue a cluster from the previous slot.
+        let num_slots = self.num_slots();
+        let start = (0..num_slots)
+            .find(|&index| self.slot(index) & SHIFTED_MASK == 0)
+            .unwrap_or(0);
+
+        let mut pending_quotients = VecDeque::new();
+        let mut quotient = 0;
+        for offset in 0..num_slots {
+            let index = (start + offset) & (num_slots - 1);
+            let slot = self.slot(index);
+            if slot & OCCUPIED_MASK != 0 {
+                pending_quotients.push_back(index);
+            }
+            if slot & METADATA_MASK == 0 {
+                continue;
+            }
+            if slot & CONTINUATION_MASK == 0 {
+                quotient = pending_quotients
+                    .pop_front()
+                    .expect("every run has an occupied canonical slot");
+            }
+            entries.push((quotient, slot >> METADATA_BITS));
+        }
+        entries
+    }
+
+    fn can_expand(&self) -> bool {
+        self.fingerprint_bits > QuotientFilterBuilder::MIN_FINGERPRINT_BITS
+            && self.lg_num_slots < QuotientFilterBuilder::MAX_LG_NUM_SLOTS
+    }
+
+    /// Doubles the number of slots, moving the low remainder bit of every entry to its quotient.
+    fn expand(&mut self) {
+        let mut expanded =
+            QuotientFilter::new(self.lg_num_slots + 1, self.fingerprint_bits - 1, self.seed);
+        for (quotient, remainder) in self.entries() {
+            expanded.insert_hash(quotient | (remainder << self.lg_num_slots));
+        }
+        *self = expanded;
+    }
+
+    fn next_index(&self, index: u64) -> u64 {
+        (index + 1) & (self.num_slots() - 1)
+    }
+
+    fn prev_index(&self, index: u64) -> u64 {
+        index.wrapping_sub(1) & (self.num_slots() - 1)
+    }
+
+    fn slot_bits(&self) -> u64 {
+        u64::from(METADATA_BITS + self.fingerprint_bits)
+    }
+
+    /// Reads the bits of one slot: metadata in the low three bits, remainder above them.
+    fn slot(&self, index: u64) -> u64 {
+        let slot_bits = self.slot_bits();
+        let bit_index = index * slot_bits;
+        let word_index = (bit_index >> 6) as usize;
+        let bit_offset = bit_index & 63;
+
+        let mut value = self.slots[word_index] >> bit_offset;
+        if bit_offset + slot_bits > 64 {
+            value |= self.slots[word_index + 1] << (64 - bit_offset);
+        }
+        value & slot_mask(slot_bits)
+    }
+
+    fn set_slot(&mut self, index: u64, value: u64) {
+        let slot_bits = self.slot_bits();
+        let mask = slot_mask(slot_bits);
+        let bit_index = index * slot_bits;
+        let word_index = (bit_index >> 6) as usize;
+        let bit_offset = bit_index & 63;
+
+        let word = &mut self.slots[word_index];
+        *word = (*word & !(mask << bit_offset)) | (value << bit_offset);
+        if bit_offset + slot_bits > 64 {
+            let spill = 64 - bit_offset;
+            let word = &mut self.slots[word_index + 1];
+            *word = (*word & !(mask >> spill)) | (value >> spill);
+        }
+    }
+}
+
+fn slot_mask(slot_bits: u64) -> u64 {
+    if slot_bits == 64 {
+        u64::MAX
+    } else {
+        (1u64 << slot_bits) - 1
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(QuotientFilter);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(QuotientFilter);
+impl_fingerprint_via_image!(QuotientFilter);
+
+#[cfg(test)]
+mod tests {
+    use super::QuotientFilter;
+    use crate::quotient::QuotientFilterBuilder;
+
+    fn check_invariants(filter: &QuotientFilter) {
+        let entries = filter.entries();
+        assert_eq!(entries.len() as u64, filter.num_entries());
+        for &(quotient, remainder) in &entries {
+            let hash = quotient | (remainder << filter.lg_num_slots);
+            assert!(filter.contains_hash(hash));
+        }
+    }
+
+    #[test]
+    fn test_slot_packing_across_words() {
+        // 3 + 10 bits per slot, so slots straddle word boundaries.
+        let mut filter = QuotientFilter::new(6, 10, 0);
+        for index in 0..filter.num_slots() {
+            filter.set_slot(index, (index * 97) & 0x1FFF);
+        }
+        for index in 0..filter.num_slots() {
+            assert_eq!(filter.slot(index), (index * 97) & 0x1FFF);
+        }
+    }
+
+    #[test]
+    fn test_colliding_quotients_build_runs() {
+        let mut filter = QuotientFilter::new(4, 8, 0);
+        // Three remainders for quotient 3, two for quotient 4, one for quotient 15.
+        for hash in [0x13, 0x23, 0x33, 0x14, 0x24, 0x1F] {
+            assert!(filter.insert_hash(hash));
+        }
+        assert!(!filter.insert_hash(0x23));
+        assert_eq!(filter.num_entries(), 6);
+        check_invariants(&filter);
+
+        assert!(filter.contains_hash(0x33));
+        assert!(filter.contains_hash(0x24));
+        assert!(!filter.contains_hash(0x43));
+        assert!(!filter.contains_hash(0x15));
+    }
+
+    #[test]
+    fn test_runs_wrap_around() {
+        let mut filter = QuotientFilter::new(3, 8, 0);
+        for hash in [0x17, 0x27, 0x37, 0x16, 0x10] {
+            assert!(filter.insert_hash(hash));
+        }
+        check_invariants(&filter);
+        assert!(filter.contains_hash(0x37));
+        assert!(filter.contains_hash(0x16));
+        assert!(filter.contains_hash(0x10));
+        assert!(!filter.contains_hash(0x47));
+    }
+
+    #[test]
+    fn test_fill_without_expansion() {
+        let mut filter = QuotientFilter::new(4, 1, 0);
+        let mut inserted = vec![];
+        for hash in 0..32 {
+            if filter.num_entries() == filter.num_slots() {
+                break;
+            }
+            if filter.insert_hash(hash) {
+                inserted.push(hash);
+            }
+        }
+        assert_eq!(filter.lg_num_slots(), 4);
+        assert_eq!(filter.num_entries(), 16);
+        check_invariants(&filter);
+        for hash in inserted {
+            assert!(filter.contains_hash(hash));
+        }
+    }
+
+    #[test]
+    #[should_panic(expected = "quotient filter is full")]
+    fn test_full_filter_panics() {
+        let mut filter = QuotientFilter::new(2, 1, 0);
+        for hash in 0..8 {
+            filter.insert_hash(hash);
+        }
+        filter.insert_hash(0x100);
+    }
+
+    #[test]
+    fn test_expansion_keeps_entries() {
+        let mut filter = QuotientFilterBuilder::with_size(4, 12).build();
+        for i in 0..1000u64 {
+            filter.insert(i);
+        }
+        assert!(filter.lg_num_slots() > 4);
+        assert_eq!(filter.lg_num_slots() + filter.fingerprint_bits(), 16);
+        check_invariants(&filter);
+        for i in 0..1000u64 {
+            assert!(filter.contains(&i));
+        }
+    }
+}
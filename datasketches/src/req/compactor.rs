@@ -0,0 +1,355 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::insufficient_data;
+use crate::common::random;
+use crate::error::Error;
+use crate::req::sketch::MAX_K;
+
+/// Smallest section size, and also the smallest k of a sketch.
+pub(super) const MIN_K: u16 = 4;
+/// Number of sections of a new compactor.
+pub(super) const INIT_NUM_SECTIONS: u8 = 3;
+
+/// Size of the serialized compactor header before the items.
+pub(super) const COMPACTOR_HEADER_SIZE: usize = 20;
+
+/// One level of a REQ sketch, holding items of weight 2^lg_weight.
+///
+/// The buffer is split into sections; each compaction halves only the sections that the binary
+/// state counter selects, so the items at the accurate end of the rank domain are compacted less
+/// often than the others. In high rank accuracy mode the smallest items are compacted and the
+/// largest are protected; in low rank accuracy mode it is the other way around.
+#[derive(Debug, Clone)]
+pub(super) struct ReqCompactor {
+    lg_weight: u8,
+    hra: bool,
+    coin: bool,
+    // the number of compactions performed so far; its trailing ones select the sections to compact
+    state: u64,
+    section_size_raw: f32,
+    section_size: u32,
+    num_sections: u8,
+    is_sorted: bool,
+    items: Vec<f32>,
+}
+
+impl ReqCompactor {
+    pub(super) fn new(lg_weight: u8, hra: bool, section_size: u16) -> Self {
+        ReqCompactor {
+            lg_weight,
+            hra,
+            coin: false,
+            state: 0,
+            section_size_raw: section_size as f32,
+            section_size: section_size as u32,
+            num_sections: INIT_NUM_SECTIONS,
+            is_sorted: true,
+            items: vec![],
+        }
+    }
+
+    pub(super) fn lg_weight(&self) -> u8 {
+        self.lg_weight
+    }
+
+    pub(super) fn is_sorted(&self) -> bool {
+        self.is_sorted
+    }
+
+    pub(super) fn items(&self) -> &[f32] {
+        &self.items
+    }
+
+    pub(super) fn num_items(&self) -> u32 {
+        self.items.len() as u32
+    }
+
+    /// Returns the size of the item buffer in bytes.
+    pub(super) fn heap_size(&self) -> usize {
+        self.items.capacity() * size_of::<f32>()
+    }
+
+    pub(super) fn nom_capacity(&self) -> u32 {
+        2 * self.num_sections as u32 * self.section_size
+    }
+
+    pub(super) fn append(&mut self, item: f32) {
+        self.items.push(item);
+        if self.items.len() > 1 {
+            self.is_sorted = false;
+        }
+    }
+
+    pub(super) fn sort(&mut self) {
+        if !self.is_sorted {
+            self.items.sort_by(f32::total_cmp);
+            self.is_sorted = true;
+        }
+    }
+
+    /// Returns the total weight of the items smaller than the given one, or not greater if
+    /// inclusive.
+    pub(super) fn compute_weight(&self, item: f32, inclusive: bool) -> u64 {
+        let counted = |retained: &f32| {
+            if inclusive {
+                *retained <= item
+            } else {
+                *retained < item
+            }
+        };
+        let count = if self.is_sorted {
+            self.items.partition_point(counted)
+        } else {
+            self.items.iter().filter(|v| counted(v)).count()
+        };
+        (count as u64) << self.lg_weight
+    }
+
+    /// Merges the items of a compactor of the same weight into this one.
+    pub(super) fn merge(&mut self, other: &ReqCompactor) {
+        debug_assert_eq!(self.lg_weight, other.lg_weight);
+        self.state |= other.state;
+        while self.ensure_enough_sections() {}
+        self.sort();
+        let mut other_items = other.items.clone();
+        if !other.is_sorted {
+            other_items.sort_by(f32::total_cmp);
+        }
+        self.items = merge_sorted(&self.items, &other_items);
+    }
+
+    /// Compacts the selected sections of this compactor and promotes half of their items into
+    /// the next one.
+    ///
+    /// Returns the number of retained items removed by the compaction and the growth of the
+    /// nominal capacity of this compactor.
+    pub(super) fn compact(&mut self, next: &mut ReqCompactor) -> (u32, u32) {
+        let starting_nom_capacity = self.nom_capacity();
+        self.sort();
+
+        let secs_to_compact = (self.state.trailing_ones() + 1).min(self.num_sections as u32);
+        let (low, high) = self.compute_compaction_range(secs_to_compact);
+        debug_assert!(high - low >= 2, "compaction range error");
+
+        if self.state & 1 == 1 {
+            // flip the coin on odd compactions, so that consecutive ones cancel out their bias
+            self.coin = !self.coin;
+        } else {
+            self.coin = random::next_bit() == 1;
+        }
+
+        let offset = if self.coin { 1 } else { 0 };
+        let promoted: Vec<f32> = self.items[low + offset..high]
+            .iter()
+            .step_by(2)
+            .copied()
+            .collect();
+        self.items.drain(low..high);
+        next.items = merge_sorted(&next.items, &promoted);
+
+        self.state += 1;
+        self.ensure_enough_sections();
+        (
+            promoted.len() as u32,
+            self.nom_capacity() - starting_nom_capacity,
+        )
+    }
+
+    pub(super) fn serialize(&self, bytes: &mut SketchBytes) {
+        bytes.write_u64_le(self.state);
+        bytes.write_f32_le(self.section_size_raw);
+        bytes.write_u8(self.lg_weight);
+        bytes.write_u8(self.num_sections);
+        bytes.write_u16_le(0); // unused
+        bytes.write_u32_le(self.num_items());
+        for &item in &self.items {
+            bytes.write_f32_le(item);
+        }
+    }
+
+    pub(super) fn deserialize(
+        cursor: &mut SketchSlice<'_>,
+        hra: bool,
+        is_sorted: bool,
+    ) -> Result<Self, Error> {
+        let state = cursor.read_u64_le().map_err(insufficient_data("state"))?;
+        let section_size_raw = cursor
+            .read_f32_le()
+            .map_err(insufficient_data("section_size"))?;
+        let lg_weight = cursor.read_u8().map_err(insufficient_data("lg_weight"))?;
+        let num_sections = cursor
+            .read_u8()
+            .map_err(insufficient_data("num_sections"))?;
+        cursor
+            .read_u16_le()
+            .map_err(insufficient_data("<unused>"))?;
+        let num_items = cursor
+            .read_u32_le()
+            .map_err(insufficient_data("num_items"))?;
+
+        let section_size = nearest_even(section_size_raw);
+        if !(MIN_K as u32..=MAX_K as u32).contains(&section_size) || num_sections == 0 {
+            return Err(Error::deserial(format!(
+                "invalid compactor sections: {num_sections} of size {section_size_raw}"
+            )));
+        }
+        let items = read_items(cursor, num_items as usize)?;
+        Ok(ReqCompactor {
+            lg_weight,
+            hra,
+            coin: false,
+            state,
+            section_size_raw,
+            section_size,
+            num_sections,
+            is_sorted,
+            items,
+        })
+    }
+
+    /// Creates a level zero compactor from the raw items of a small sketch.
+    pub(super) fn from_raw_items(hra: bool, k: u16, items: Vec<f32>, is_sorted: bool) -> Self {
+        let mut compactor = ReqCompactor::new(0, hra, k);
+        compactor.items = items;
+        compactor.is_sorted = is_sorted;
+        compactor
+    }
+
+    fn compute_compaction_range(&self, secs_to_compact: u32) -> (usize, usize) {
+        let num_items = self.num_items();
+        let mut non_compact = self.nom_capacity() / 2
+            + (self.num_sections as u32 - secs_to_compact) * self.section_size;
+        // make the compacted region even
+        if (num_items - non_compact) & 1 == 1 {
+            non_compact += 1;
+        }
+        let (low, high) = if self.hra {
+            (0, num_items - non_compact)
+        } else {
+            (non_compact, num_items)
+        };
+        (low as usize, high as usize)
+    }
+
+    /// Doubles the number of sections and shrinks them by a factor of sqrt(2), once the state
+    /// shows that all the current sections have been compacted.
+    fn ensure_enough_sections(&mut self) -> bool {
+        let section_size_raw = self.section_size_raw / std::f32::consts::SQRT_2;
+        let section_size = nearest_even(section_size_raw);
+        let threshold = 1u64.checked_shl(self.num_sections as u32 - 1);
+        if threshold.is_some_and(|threshold| self.state >= threshold)
+            && section_size >= MIN_K as u32
+        {
+            self.section_size_raw = section_size_raw;
+            self.section_size = section_size;
+            self.num_sections <<= 1;
+            return true;
+        }
+        false
+    }
+}
+
+fn nearest_even(value: f32) -> u32 {
+    ((value / 2.0).round() as u32) << 1
+}
+
+fn merge_sorted(a: &[f32], b: &[f32]) -> Vec<f32> {
+    let mut out = Vec::with_capacity(a.len() + b.len());
+    let (mut i, mut j) = (0, 0);
+    while i < a.len() && j < b.len() {
+        if b[j] < a[i] {
+            out.push(b[j]);
+            j += 1;
+        } else {
+            out.push(a[i]);
+            i += 1;
+        }
+    }
+    out.extend_from_slice(&a[i..]);
+    out.extend_from_slice(&b[j..]);
+    out
+}
+
+pub(super) fn read_items(cursor: &mut SketchSlice<'_>, count: usize) -> Result<Vec<f32>, Error> {
+    let mut items = Vec::with_capacity(cursor.capacity_hint(count, 4));
+    for _ in 0..count {
+        let item = cursor.read_f32_le().map_err(insufficient_data("items"))?;
+        if item.is_nan() {
+            return Err(Error::deserial("items must not be NaN"));
+        }
+        items.push(item);
+    }
+    Ok(items)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_nearest_even() {
+        assert_eq!(nearest_even(12.0), 12);
+        assert_eq!(nearest_even(8.485), 8);
+        assert_eq!(nearest_even(5.0), 6);
+        assert_eq!(nearest_even(2.83), 2);
+    }
+
+    #[test]
+    fn test_compaction_protects_the_accurate_end() {
+        for hra in [true, false] {
+            let mut compactor = ReqCompactor::new(0, hra, 4);
+            let mut next = ReqCompactor::new(1, hra, 4);
+            // twice the nominal capacity of 24
+            for i in 0..24 {
+                compactor.append(i as f32);
+            }
+            let (removed, _) = compactor.compact(&mut next);
+            assert_eq!(removed, next.num_items());
+            assert_eq!(compactor.num_items() + 2 * removed, 24);
+            if hra {
+                assert_eq!(compactor.items().last(), Some(&23.0));
+                assert!(next.items().iter().all(|&v| v < compactor.items()[0]));
+            } else {
+                assert_eq!(compactor.items().first(), Some(&0.0));
+                assert!(
+                    next.items()
+                        .iter()
+                        .all(|&v| v > *compactor.items().last().unwrap())
+                );
+            }
+        }
+    }
+
+    #[test]
+    fn test_sections_grow_with_state() {
+        let mut compactor = ReqCompactor::new(0, true, 12);
+        let mut next = ReqCompactor::new(1, true, 12);
+        for round in 0..8 {
+            while compactor.num_items() < compactor.nom_capacity() {
+                compactor.append(round as f32);
+            }
+            compactor.compact(&mut next);
+        }
+        // the sections double after 4 compactions, and 12 / sqrt(2) rounds to 8;
+        // the next doubling needs 32 compactions
+        assert_eq!(compactor.num_sections, 6);
+        assert_eq!(compactor.section_size, 8);
+    }
+}
@@ -0,0 +1,57 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Relative Error Quantiles (REQ) sketch implementation for estimating quantiles and ranks.
+//!
+//! The REQ sketch is based on the paper [Relative Error Streaming Quantiles][paper] by Graham
+//! Cormode, Zohar Karnin, Edo Liberty, Justin Thaler and Pavel Veselý. Unlike the
+//! [KLL sketch](crate::kll), whose rank error is uniform across the rank domain, the error of
+//! the REQ sketch is relative to the distance from one end of it: in high rank accuracy mode
+//! (the default) the ranks close to 1.0 are nearly exact, which makes it the right choice for
+//! extreme tail percentiles such as p99.99; in low rank accuracy mode the ranks close to 0.0 are.
+//!
+//! The sketch keeps a stack of compactors, one per weight. Each compactor splits its buffer into
+//! sections, and compacts the sections at the accurate end of the rank domain exponentially less
+//! often than the others. The parameter k is the initial section size and controls the
+//! accuracy; the default is 12.
+//!
+//! Serialized sketches use the binary format of `ReqSketch` in Java and `req_sketch<float>` in
+//! C++.
+//!
+//! For more information on the performance characteristics, see the
+//! [Datasketches page on REQ](https://datasketches.apache.org/docs/REQ/ReqSketch.html).
+//!
+//! [paper]: https://arxiv.org/abs/2004.01668
+//!
+//! # Usage
+//!
+//! ```
+//! # use datasketches::req::ReqSketch;
+//! let mut sketch = ReqSketch::default();
+//! for i in 1..=100_000 {
+//!     sketch.update(i as f32);
+//! }
+//! let p9999 = sketch.quantile(0.9999, true).unwrap();
+//! assert!((99_980.0..=100_000.0).contains(&p9999));
+//! ```
+
+mod compactor;
+mod serialization;
+
+mod sketch;
+pub use self::sketch::RankAccuracy;
+pub use self::sketch::ReqSketch;
@@ -0,0 +1,34 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+/// Preamble size in 4-byte integers for an empty sketch or a sketch with a single compactor.
+pub(super) const PREAMBLE_INTS_SHORT: u8 = 2;
+/// Preamble size in 4-byte integers for a sketch in estimation mode, which also stores n, min and
+/// max.
+pub(super) const PREAMBLE_INTS_FULL: u8 = 4;
+
+pub(super) const SERIAL_VERSION: u8 = 1;
+
+pub(super) const FLAGS_IS_EMPTY: u8 = 1 << 2;
+pub(super) const FLAGS_IS_HIGH_RANK: u8 = 1 << 3;
+pub(super) const FLAGS_RAW_ITEMS: u8 = 1 << 4;
+pub(super) const FLAGS_IS_LEVEL_ZERO_SORTED: u8 = 1 << 5;
+
+/// Size of the preamble up to and including the number of raw items.
+pub(super) const SHORT_PREAMBLE_SIZE: usize = 8;
+/// Size of n, min and max following the short preamble in estimation mode.
+pub(super) const ESTIMATION_FIELDS_SIZE: usize = 16;
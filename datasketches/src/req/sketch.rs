@@ -0,0 +1,1095 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::fmt;
+use std::io;
+use std::io::Read;
+use std::io::Write;
+use std::iter::Sum;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::MergeableSketch;
+use crate::common::NumStdDev;
+use crate::common::PartitionBoundaries;
+use crate::common::QuantileBounds;
+use crate::common::QuantileSketch;
+use crate::common::SortedView;
+use crate::error::Error;
+use crate::error::SketchError;
+use crate::req::compactor::COMPACTOR_HEADER_SIZE;
+use crate::req::compactor::INIT_NUM_SECTIONS;
+use crate::req::compactor::MIN_K;
+use crate::req::compactor::ReqCompactor;
+use crate::req::compactor::read_items;
+use crate::req::serialization::ESTIMATION_FIELDS_SIZE;
+use crate::req::serialization::FLAGS_IS_EMPTY;
+use crate::req::serialization::FLAGS_IS_HIGH_RANK;
+use crate::req::serialization::FLAGS_IS_LEVEL_ZERO_SORTED;
+use crate::req::serialization::FLAGS_RAW_ITEMS;
+use crate::req::serialization::PREAMBLE_INTS_FULL;
+use crate::req::serialization::PREAMBLE_INTS_SHORT;
+use crate::req::serialization::SERIAL_VERSION;
+use crate::req::serialization::SHORT_PREAMBLE_SIZE;
+
+const DEFAULT_K: u16 = 12;
+pub(super) const MAX_K: u16 = 1024;
+
+const FIXED_RSE_FACTOR: f64 = 0.084;
+
+/// Selects the end of the rank domain where a [`ReqSketch`] is most accurate.
+#[derive(Debug, Default, Clone, Copy, PartialEq, Eq)]
+pub enum RankAccuracy {
+    /// Ranks close to 1.0 are the most accurate, for estimating high percentiles.
+    #[default]
+    HighRanks,
+    /// Ranks close to 0.0 are the most accurate, for estimating low percentiles.
+    LowRanks,
+}
+
+/// Relative Error Quantiles sketch for estimating quantiles and ranks of a stream of `f32`
+/// values.
+///
+/// See the [module level documentation](super) for more.
+#[derive(Debug, Clone)]
+pub struct ReqSketch {
+    k: u16,
+    hra: bool,
+    n: u64,
+    min_item: Option<f32>,
+    max_item: Option<f32>,
+    // the sum of the nominal capacities of the compactors; exceeding it triggers a compression
+    max_nom_size: u32,
+    num_retained: u32,
+    // compactor `h` holds the items of weight 2^h
+    compactors: Vec<ReqCompactor>,
+}
+
+impl Default for ReqSketch {
+    fn default() -> Self {
+        ReqSketch::new(DEFAULT_K, RankAccuracy::default())
+    }
+}
+
+impl ReqSketch {
+    /// Creates a REQ sketch with the given value of k and rank accuracy mode.
+    ///
+    /// The parameter k is the initial section size of the compactors: larger values give a
+    /// smaller error at the cost of more retained items.
+    ///
+    /// # Panics
+    ///
+    /// Panics if k is odd or not in the range [4, 1024].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::RankAccuracy;
+    /// # use datasketches::req::ReqSketch;
+    /// let sketch = ReqSketch::new(20, RankAccuracy::LowRanks);
+    /// assert_eq!(sketch.k(), 20);
+    /// assert_eq!(sketch.rank_accuracy(), RankAccuracy::LowRanks);
+    /// ```
+    pub fn new(k: u16, rank_accuracy: RankAccuracy) -> Self {
+        assert!(
+            is_valid_k(k),
+            "k must be even and in [{MIN_K}, {MAX_K}], got {k}"
+        );
+        let hra = rank_accuracy == RankAccuracy::HighRanks;
+        let mut sketch = ReqSketch {
+            k,
+            hra,
+            n: 0,
+            min_item: None,
+            max_item: None,
+            max_nom_size: 0,
+            num_retained: 0,
+            compactors: vec![],
+        };
+        sketch.grow();
+        sketch
+    }
+
+    /// Updates this sketch with the given value.
+    ///
+    /// `NaN` values are ignored.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// let mut sketch = ReqSketch::default();
+    /// sketch.update(1.0);
+    /// sketch.update(f32::NAN);
+    /// assert_eq!(sketch.n(), 1);
+    /// ```
+    pub fn update(&mut self, item: f32) {
+        if item.is_nan() {
+            return;
+        }
+        self.min_item = Some(self.min_item.map_or(item, |min| min.min(item)));
+        self.max_item = Some(self.max_item.map_or(item, |max| max.max(item)));
+
+        self.compactors[0].append(item);
+        self.num_retained += 1;
+        self.n += 1;
+        if self.num_retained == self.max_nom_size {
+            self.compress();
+        }
+    }
+
+    /// Merges the given sketch into this one.
+    ///
+    /// The sketches may have been configured with different values of k.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the sketches have different rank accuracy modes.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// let mut left = ReqSketch::default();
+    /// let mut right = ReqSketch::default();
+    /// left.update(1.0);
+    /// right.update(2.0);
+    /// left.merge(&right);
+    /// assert_eq!(left.n(), 2);
+    /// assert_eq!(left.max_item(), Some(2.0));
+    /// ```
+    pub fn merge(&mut self, other: &ReqSketch) {
+        assert_eq!(
+            self.hra, other.hra,
+            "cannot merge sketches with different rank accuracy modes"
+        );
+        if other.is_empty() {
+            return;
+        }
+        self.min_item = match (self.min_item, other.min_item) {
+            (Some(min), Some(other_min)) => Some(min.min(other_min)),
+            (min, other_min) => min.or(other_min),
+        };
+        self.max_item = match (self.max_item, other.max_item) {
+            (Some(max), Some(other_max)) => Some(max.max(other_max)),
+            (max, other_max) => max.or(other_max),
+        };
+
+        while self.compactors.len() < other.compactors.len() {
+            self.grow();
+        }
+        for (compactor, other_compactor) in self.compactors.iter_mut().zip(&other.compactors) {
+            compactor.merge(other_compactor);
+        }
+        self.n += other.n;
+        self.update_max_nom_size();
+        self.update_num_retained();
+        if self.num_retained >= self.max_nom_size {
+            self.compress();
+        }
+    }
+
+    /// Returns parameter k that was used to configure this sketch.
+    pub fn k(&self) -> u16 {
+        self.k
+    }
+
+    /// Returns the end of the rank domain where this sketch is most accurate.
+    pub fn rank_accuracy(&self) -> RankAccuracy {
+        if self.hra {
+            RankAccuracy::HighRanks
+        } else {
+            RankAccuracy::LowRanks
+        }
+    }
+
+    /// Returns the length of the input stream.
+    pub fn n(&self) -> u64 {
+        self.n
+    }
+
+    /// Returns true if this sketch has not seen any data.
+    pub fn is_empty(&self) -> bool {
+        self.n == 0
+    }
+
+    /// Returns true if this sketch has compacted its input and its results are approximate.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.compactors.len() > 1
+    }
+
+    /// Returns the number of items retained by this sketch.
+    pub fn num_retained(&self) -> usize {
+        self.num_retained as usize
+    }
+
+    /// Returns the estimated size of the sketch in bytes
+    pub fn estimated_size(&self) -> usize {
+        let compactors_size: usize = self.compactors.iter().map(ReqCompactor::heap_size).sum();
+        size_of::<Self>() + self.compactors.capacity() * size_of::<ReqCompactor>() + compactors_size
+    }
+
+    /// Returns the minimum value seen by this sketch; `None` if the sketch is empty.
+    pub fn min_item(&self) -> Option<f32> {
+        self.min_item
+    }
+
+    /// Returns the maximum value seen by this sketch; `None` if the sketch is empty.
+    pub fn max_item(&self) -> Option<f32> {
+        self.max_item
+    }
+
+    /// Returns a human-readable description of the sketch.
+    ///
+    /// The output follows the layout of the C++ `req_sketch::to_string(print_levels,
+    /// print_items)`: a summary of k, the rank accuracy, n, the compactor count, the retained
+    /// and capacity items and the min and max items, then with `with_levels` the nominal
+    /// capacity and size of every compactor, and with `with_data` the items of every
+    /// compactor.
+    ///
+    /// The [`Display`](fmt::Display) implementation prints the summary only.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// let mut sketch = ReqSketch::default();
+    /// sketch.extend([1.0, 2.0, 3.0]);
+    ///
+    /// assert!(sketch.to_string().contains("   Retained items : 3"));
+    /// let dump = sketch.to_string_with(true, true);
+    /// assert!(dump.contains("   0: 72, 3"));
+    /// assert!(dump.contains("   2.0\n"));
+    /// ```
+    pub fn to_string_with(&self, with_levels: bool, with_data: bool) -> String {
+        let mut out = String::new();
+        self.write_description(&mut out, with_levels, with_data)
+            .expect("writing to a String cannot fail");
+        out
+    }
+
+    fn write_description(
+        &self,
+        f: &mut impl fmt::Write,
+        with_levels: bool,
+        with_data: bool,
+    ) -> fmt::Result {
+        writeln!(f, "### REQ sketch summary:")?;
+        writeln!(f, "   K              : {}", self.k)?;
+        writeln!(f, "   High Rank Acc  : {}", self.hra)?;
+        writeln!(f, "   Empty          : {}", self.is_empty())?;
+        writeln!(f, "   Estimation mode: {}", self.is_estimation_mode())?;
+        writeln!(
+            f,
+            "   Sorted         : {}",
+            self.compactors.first().is_some_and(ReqCompactor::is_sorted)
+        )?;
+        writeln!(f, "   N              : {}", self.n)?;
+        writeln!(f, "   Levels         : {}", self.compactors.len())?;
+        writeln!(f, "   Retained items : {}", self.num_retained)?;
+        writeln!(f, "   Capacity items : {}", self.max_nom_size)?;
+        if let (Some(min), Some(max)) = (self.min_item, self.max_item) {
+            writeln!(f, "   Min item       : {min:?}")?;
+            writeln!(f, "   Max item       : {max:?}")?;
+        }
+        writeln!(f, "### End sketch summary")?;
+
+        if with_levels {
+            writeln!(f, "### REQ sketch levels:")?;
+            writeln!(f, "   index: nominal capacity, actual size")?;
+            for (level, compactor) in self.compactors.iter().enumerate() {
+                let capacity = compactor.nom_capacity();
+                let size = compactor.num_items();
+                writeln!(f, "   {level}: {capacity}, {size}")?;
+            }
+            writeln!(f, "### End sketch levels")?;
+        }
+
+        if with_data {
+            writeln!(f, "### REQ sketch data:")?;
+            for (level, compactor) in self.compactors.iter().enumerate() {
+                writeln!(f, " level {level}:")?;
+                for item in compactor.items() {
+                    writeln!(f, "   {item:?}")?;
+                }
+            }
+            writeln!(f, "### End sketch data")?;
+        }
+
+        Ok(())
+    }
+
+    /// Returns the approximate normalized rank (from 0 to 1 inclusive) of the given value.
+    ///
+    /// With `inclusive` set, the rank includes the weight of the value itself; otherwise only
+    /// the weight of the smaller values is counted.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the value is `NaN`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// # let mut sketch = ReqSketch::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// assert_eq!(sketch.rank(2.0, true), Some(0.5));
+    /// assert_eq!(sketch.rank(2.0, false), Some(0.25));
+    /// ```
+    pub fn rank(&self, item: f32, inclusive: bool) -> Option<f64> {
+        assert!(!item.is_nan(), "item must not be NaN");
+        if self.is_empty() {
+            return None;
+        }
+        let weight: u64 = self
+            .compactors
+            .iter()
+            .map(|compactor| compactor.compute_weight(item, inclusive))
+            .sum();
+        Some(weight as f64 / self.n as f64)
+    }
+
+    /// Returns an approximate lower bound of the given normalized rank, with the confidence
+    /// of the given number of standard deviations.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::common::NumStdDev;
+    /// # use datasketches::req::ReqSketch;
+    /// # let mut sketch = ReqSketch::default();
+    /// # for i in 0..10_000 {
+    /// #     sketch.update(i as f32);
+    /// # }
+    /// let rank = sketch.rank(5000.0, true).unwrap();
+    /// assert!(sketch.rank_lower_bound(rank, NumStdDev::Two) <= rank);
+    /// ```
+    pub fn rank_lower_bound(&self, rank: f64, num_std_dev: NumStdDev) -> f64 {
+        if self.is_exact_rank(rank) {
+            return rank;
+        }
+        let (relative, fixed) = self.rank_errors(rank);
+        let num_std_dev = num_std_dev.as_u8() as f64;
+        (rank - num_std_dev * relative).max(rank - num_std_dev * fixed)
+    }
+
+    /// Returns an approximate upper bound of the given normalized rank, with the confidence
+    /// of the given number of standard deviations.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::common::NumStdDev;
+    /// # use datasketches::req::ReqSketch;
+    /// # let mut sketch = ReqSketch::default();
+    /// # for i in 0..10_000 {
+    /// #     sketch.update(i as f32);
+    /// # }
+    /// let rank = sketch.rank(5000.0, true).unwrap();
+    /// assert!(sketch.rank_upper_bound(rank, NumStdDev::Two) >= rank);
+    /// ```
+    pub fn rank_upper_bound(&self, rank: f64, num_std_dev: NumStdDev) -> f64 {
+        if self.is_exact_rank(rank) {
+            return rank;
+        }
+        let (relative, fixed) = self.rank_errors(rank);
+        let num_std_dev = num_std_dev.as_u8() as f64;
+        (rank + num_std_dev * relative).min(rank + num_std_dev * fixed)
+    }
+
+    /// Returns the approximate value at the given normalized rank.
+    ///
+    /// With `inclusive` set, the result is the smallest value whose inclusive rank is at least
+    /// the given rank; otherwise it is the smallest value whose exclusive rank is greater than
+    /// it. Ranks 0 and 1 always return the exact minimum and maximum values.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if rank is not in [0.0, 1.0].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// # let mut sketch = ReqSketch::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// assert_eq!(sketch.quantile(0.5, true), Some(2.0));
+    /// assert_eq!(sketch.quantile(0.5, false), Some(3.0));
+    /// ```
+    pub fn quantile(&self, rank: f64, inclusive: bool) -> Option<f32> {
+        assert!((0.0..=1.0).contains(&rank), "rank must be in [0.0, 1.0]");
+        if self.is_empty() {
+            return None;
+        }
+        if rank == 0.0 {
+            return self.min_item;
+        }
+        if rank == 1.0 {
+            return self.max_item;
+        }
+        Some(self.sorted_view().quantile(rank, inclusive))
+    }
+
+    /// Returns the quantile of the given normalized rank together with the values at the
+    /// bounds of the rank.
+    ///
+    /// The rank bounds are [`rank_lower_bound`](Self::rank_lower_bound) and
+    /// [`rank_upper_bound`](Self::rank_upper_bound) with `num_std_dev`, clamped to
+    /// `[0.0, 1.0]`. They are tightest at the end of the ranks this sketch is accurate for, so
+    /// a sketch of [`RankAccuracy::HighRanks`] draws a narrow band around its tail quantiles.
+    /// See [`quantile`](Self::quantile) for the meaning of `inclusive`.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if rank is not in [0.0, 1.0].
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::common::NumStdDev;
+    /// # use datasketches::req::RankAccuracy;
+    /// # use datasketches::req::ReqSketch;
+    /// let mut sketch = ReqSketch::new(12, RankAccuracy::HighRanks);
+    /// for i in 0..100_000 {
+    ///     sketch.update(i as f32);
+    /// }
+    /// let p99 = sketch
+    ///     .quantile_with_rank_bounds(0.99, true, NumStdDev::Two)
+    ///     .unwrap();
+    /// assert!(p99.lower <= p99.quantile && p99.quantile <= p99.upper);
+    /// assert!(p99.lower <= 99_000.0 && 99_000.0 <= p99.upper);
+    /// ```
+    pub fn quantile_with_rank_bounds(
+        &self,
+        rank: f64,
+        inclusive: bool,
+        num_std_dev: NumStdDev,
+    ) -> Option<QuantileBounds<f32>> {
+        assert!((0.0..=1.0).contains(&rank), "rank must be in [0.0, 1.0]");
+        let (min_item, max_item) = (self.min_item?, self.max_item?);
+        Some(QuantileBounds::from_view(
+            &self.sorted_view(),
+            &min_item,
+            &max_item,
+            rank,
+            (
+                self.rank_lower_bound(rank, num_std_dev),
+                self.rank_upper_bound(rank, num_std_dev),
+            ),
+            inclusive,
+        ))
+    }
+
+    /// Returns an approximation to the Cumulative Distribution Function (CDF) of the input
+    /// stream given a set of split points.
+    ///
+    /// # Arguments
+    ///
+    /// * `split_points`: An array of _m_ unique, monotonically increasing values that divide the
+    ///   input domain into _m+1_ consecutive disjoint intervals.
+    /// * `inclusive`: If true, each interval includes its upper split point; otherwise it includes
+    ///   its lower split point.
+    ///
+    /// # Returns
+    ///
+    /// An array of m+1 doubles: the ranks of the split points followed by 1.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `split_points` is not unique, not monotonically increasing, or contains `NaN`
+    /// values.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// # let mut sketch = ReqSketch::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// let cdf = sketch.cdf(&[2.0, 3.0], true).unwrap();
+    /// assert_eq!(cdf, [0.5, 0.75, 1.0]);
+    /// ```
+    pub fn cdf(&self, split_points: &[f32], inclusive: bool) -> Option<Vec<f64>> {
+        check_split_points(split_points);
+        if self.is_empty() {
+            return None;
+        }
+        Some(self.sorted_view().cdf(split_points, inclusive, less))
+    }
+
+    /// Returns an approximation to the Probability Mass Function (PMF) of the input stream
+    /// given a set of split points.
+    ///
+    /// # Arguments
+    ///
+    /// * `split_points`: An array of _m_ unique, monotonically increasing values that divide the
+    ///   input domain into _m+1_ consecutive disjoint intervals (bins).
+    /// * `inclusive`: If true, each interval includes its upper split point; otherwise it includes
+    ///   its lower split point.
+    ///
+    /// # Returns
+    ///
+    /// An array of m+1 doubles each of which is an approximation to the fraction of the input
+    /// stream values (the mass) that fall into one of those intervals.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `split_points` is not unique, not monotonically increasing, or contains `NaN`
+    /// values.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// # let mut sketch = ReqSketch::default();
+    /// # for value in [1.0, 2.0, 3.0, 4.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// let pmf = sketch.pmf(&[2.0, 3.0], true).unwrap();
+    /// assert_eq!(pmf, [0.5, 0.25, 0.25]);
+    /// ```
+    pub fn pmf(&self, split_points: &[f32], inclusive: bool) -> Option<Vec<f64>> {
+        check_split_points(split_points);
+        if self.is_empty() {
+            return None;
+        }
+        Some(self.sorted_view().pmf(split_points, inclusive, less))
+    }
+
+    /// Returns boundaries that split the input stream into `num_parts` parts of roughly equal
+    /// size.
+    ///
+    /// The first boundary is the minimum and the last the maximum value seen. With `inclusive`
+    /// set, each part includes its upper boundary; otherwise it includes its lower boundary.
+    /// See [`PartitionBoundaries`] for the ranks and sizes of the parts.
+    ///
+    /// Returns `None` if the sketch is empty.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `num_parts` is 0.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// let mut sketch = ReqSketch::default();
+    /// for value in 1..=100 {
+    ///     sketch.update(value as f32);
+    /// }
+    ///
+    /// let partition = sketch.partition_boundaries(4, true).unwrap();
+    /// assert_eq!(partition.boundaries(), [1.0, 25.0, 50.0, 75.0, 100.0]);
+    /// assert_eq!(partition.part_sizes(), [25, 25, 25, 25]);
+    /// ```
+    pub fn partition_boundaries(
+        &self,
+        num_parts: usize,
+        inclusive: bool,
+    ) -> Option<PartitionBoundaries<f32>> {
+        assert!(num_parts > 0, "num_parts must be at least 1");
+        let (Some(min_item), Some(max_item)) = (self.min_item, self.max_item) else {
+            return None;
+        };
+        Some(
+            self.sorted_view()
+                .partition_boundaries(num_parts, inclusive, min_item, max_item, less),
+        )
+    }
+
+    /// Returns the retained items in ascending order together with their weights.
+    ///
+    /// Items of the compactor at height _h_ have weight 2^_h_. Iterating the [`SortedView`]
+    /// yields `(item, weight, cumulative_weight)`; the view of an empty sketch is empty.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// # let mut sketch = ReqSketch::default();
+    /// # for value in [3.0, 1.0, 2.0] {
+    /// #     sketch.update(value);
+    /// # }
+    /// let view = sketch.sorted_view();
+    /// let entries: Vec<_> = view.iter().map(|(item, w, c)| (*item, w, c)).collect();
+    /// assert_eq!(entries, [(1.0, 1, 1), (2.0, 1, 2), (3.0, 1, 3)]);
+    /// ```
+    pub fn sorted_view(&self) -> SortedView<f32> {
+        let mut entries = Vec::with_capacity(self.num_retained());
+        for compactor in &self.compactors {
+            let weight = 1 << compactor.lg_weight();
+            entries.extend(compactor.items().iter().map(|&item| (item, weight)));
+        }
+        SortedView::new(entries, less)
+    }
+
+    /// Serializes this sketch to bytes in the format shared with the Java and C++
+    /// implementations.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// # let mut sketch = ReqSketch::default();
+    /// # sketch.update(1.0);
+    /// let bytes = sketch.serialize();
+    /// let decoded = ReqSketch::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.max_item(), Some(1.0));
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        let mut size = SHORT_PREAMBLE_SIZE;
+        if self.is_estimation_mode() {
+            size += ESTIMATION_FIELDS_SIZE;
+        }
+        if self.n > MIN_K as u64 {
+            size += self.compactors.len() * COMPACTOR_HEADER_SIZE;
+        }
+        size + self.num_retained() * size_of::<f32>()
+    }
+
+    /// Serializes this sketch into `buf` in the format written by
+    /// [`serialize`](Self::serialize), returning the number of bytes written.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `buf` is shorter than [`serialized_size_bytes`].
+    ///
+    /// [`serialized_size_bytes`]: Self::serialized_size_bytes
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Writes the serialized sketch to `writer`.
+    ///
+    /// This streams the image [`serialize`](Self::serialize) returns in chunks instead of
+    /// assembling it in memory first.
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        let is_empty = self.is_empty();
+        let raw_items = self.n <= MIN_K as u64;
+
+        bytes.write_u8(if self.is_estimation_mode() {
+            PREAMBLE_INTS_FULL
+        } else {
+            PREAMBLE_INTS_SHORT
+        });
+        bytes.write_u8(SERIAL_VERSION);
+        bytes.write_u8(Family::REQ.id);
+        bytes.write_u8({
+            let mut flags = 0;
+            if is_empty {
+                flags |= FLAGS_IS_EMPTY;
+            }
+            if self.hra {
+                flags |= FLAGS_IS_HIGH_RANK;
+            }
+            if raw_items {
+                flags |= FLAGS_RAW_ITEMS;
+            }
+            if self.compactors[0].is_sorted() {
+                flags |= FLAGS_IS_LEVEL_ZERO_SORTED;
+            }
+            flags
+        });
+        bytes.write_u16_le(self.k);
+        bytes.write_u8(if is_empty {
+            0
+        } else {
+            self.compactors.len() as u8
+        });
+        bytes.write_u8(if raw_items { self.n as u8 } else { 0 });
+        if is_empty {
+            return;
+        }
+
+        if self.is_estimation_mode() {
+            bytes.write_u64_le(self.n);
+            // both are present in a non-empty sketch
+            bytes.write_f32_le(self.min_item.unwrap());
+            bytes.write_f32_le(self.max_item.unwrap());
+        }
+        if raw_items {
+            for &item in self.compactors[0].items() {
+                bytes.write_f32_le(item);
+            }
+        } else {
+            for compactor in &self.compactors {
+                compactor.serialize(bytes);
+            }
+        }
+    }
+
+    /// Deserializes a sketch from bytes in the format shared with the Java and C++
+    /// implementations.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::req::ReqSketch;
+    /// # let mut sketch = ReqSketch::default();
+    /// # sketch.update(1.0);
+    /// # sketch.update(2.0);
+    /// # let bytes = sketch.serialize();
+    /// let decoded = ReqSketch::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.n(), 2);
+    /// ```
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// Exactly the bytes of one image are consumed, so several sketches can be read back from
+    /// the same stream.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        let preamble_ints = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_ints"))?;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let k = cursor.read_u16_le().map_err(insufficient_data("k"))?;
+        let num_levels = cursor.read_u8().map_err(insufficient_data("num_levels"))?;
+        let num_raw_items = cursor
+            .read_u8()
+            .map_err(insufficient_data("num_raw_items"))?;
+
+        Family::REQ.validate_id(family_id)?;
+        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        let is_empty = (flags & FLAGS_IS_EMPTY) != 0;
+        // empty images have no levels, so a full preamble contradicts the empty flag
+        let expected_preamble_ints = if num_levels > 1 && !is_empty {
+            PREAMBLE_INTS_FULL
+        } else {
+            PREAMBLE_INTS_SHORT
+        };
+        if preamble_ints != expected_preamble_ints {
+            return Err(Error::deserial(format!(
+                "invalid preamble ints: expected {expected_preamble_ints}, got {preamble_ints}"
+            ))
+            .with_reason(SketchError::InvalidPreamble {
+                actual: preamble_ints,
+            }));
+        }
+        if !is_valid_k(k) {
+            return Err(Error::deserial(format!(
+                "k must be even and in [{MIN_K}, {MAX_K}], got {k}"
+            )));
+        }
+
+        let hra = (flags & FLAGS_IS_HIGH_RANK) != 0;
+        let rank_accuracy = if hra {
+            RankAccuracy::HighRanks
+        } else {
+            RankAccuracy::LowRanks
+        };
+        if is_empty {
+            return Ok(ReqSketch::new(k, rank_accuracy));
+        }
+
+        let is_level_zero_sorted = (flags & FLAGS_IS_LEVEL_ZERO_SORTED) != 0;
+        let mut n_min_max = None;
+        if num_levels > 1 {
+            let n = cursor.read_u64_le().map_err(insufficient_data("n"))?;
+            let min = cursor
+                .read_f32_le()
+                .map_err(insufficient_data("min_item"))?;
+            let max = cursor
+                .read_f32_le()
+                .map_err(insufficient_data("max_item"))?;
+            n_min_max = Some((n, min, max));
+        }
+
+        let mut compactors = Vec::with_capacity(num_levels as usize);
+        if (flags & FLAGS_RAW_ITEMS) != 0 {
+            let items = read_items(&mut cursor, num_raw_items as usize)?;
+            compactors.push(ReqCompactor::from_raw_items(
+                hra,
+                k,
+                items,
+                is_level_zero_sorted,
+            ));
+        } else {
+            for level in 0..num_levels {
+                let is_sorted = level > 0 || is_level_zero_sorted;
+                let compactor = ReqCompactor::deserialize(&mut cursor, hra, is_sorted)?;
+                if compactor.lg_weight() != level {
+                    return Err(Error::deserial(format!(
+                        "compactor at level {level} has weight 2^{}",
+                        compactor.lg_weight()
+                    )));
+                }
+                compactors.push(compactor);
+            }
+        }
+        if compactors.is_empty() || compactors[0].num_items() == 0 && num_levels <= 1 {
+            return Err(Error::deserial("no items in a non-empty sketch"));
+        }
+
+        let (n, min_item, max_item) = match n_min_max {
+            Some(n_min_max) => n_min_max,
+            None => {
+                let items = compactors[0].items();
+                let min = items.iter().copied().fold(f32::INFINITY, f32::min);
+                let max = items.iter().copied().fold(f32::NEG_INFINITY, f32::max);
+                (items.len() as u64, min, max)
+            }
+        };
+
+        let mut sketch = ReqSketch {
+            k,
+            hra,
+            n,
+            min_item: Some(min_item),
+            max_item: Some(max_item),
+            max_nom_size: 0,
+            num_retained: 0,
+            compactors,
+        };
+        sketch.update_max_nom_size();
+        sketch.update_num_retained();
+        let weight: u64 = sketch
+            .compactors
+            .iter()
+            .map(|c| (c.num_items() as u64) << c.lg_weight())
+            .sum();
+        if weight != n {
+            return Err(Error::deserial(format!(
+                "compactor weights {weight} are inconsistent with n = {n}"
+            )));
+        }
+        Ok(sketch)
+    }
+
+    fn grow(&mut self) {
+        let lg_weight = self.compactors.len() as u8;
+        self.compactors
+            .push(ReqCompactor::new(lg_weight, self.hra, self.k));
+        self.update_max_nom_size();
+    }
+
+    fn update_max_nom_size(&mut self) {
+        self.max_nom_size = self.compactors.iter().map(ReqCompactor::nom_capacity).sum();
+    }
+
+    fn update_num_retained(&mut self) {
+        self.num_retained = self.compactors.iter().map(ReqCompactor::num_items).sum();
+    }
+
+    fn compress(&mut self) {
+        for h in 0..self.compactors.len() {
+            if self.compactors[h].num_items() >= self.compactors[h].nom_capacity() {
+                if h + 1 >= self.compactors.len() {
+                    // add a level, which increases max_nom_size
+                    self.grow();
+                }
+                let (compactor, next) = self.compactors.split_at_mut(h + 1);
+                let (num_removed, capacity_growth) = compactor[h].compact(&mut next[0]);
+                self.num_retained -= num_removed;
+                self.max_nom_size += capacity_growth;
+                // compress lazily: stop as soon as there is room again
+                if self.num_retained < self.max_nom_size {
+                    break;
+                }
+            }
+        }
+    }
+
+    fn is_exact_rank(&self, rank: f64) -> bool {
+        let base_capacity = self.k as u64 * INIT_NUM_SECTIONS as u64;
+        if self.compactors.len() == 1 || self.n <= base_capacity {
+            return true;
+        }
+        let exact_rank_threshold = base_capacity as f64 / self.n as f64;
+        if self.hra {
+            rank >= 1.0 - exact_rank_threshold
+        } else {
+            rank <= exact_rank_threshold
+        }
+    }
+
+    /// Returns the relative and the fixed components of the normalized rank error.
+    fn rank_errors(&self, rank: f64) -> (f64, f64) {
+        let relative_rse_factor = (0.0512 / INIT_NUM_SECTIONS as f64).sqrt();
+        let distance = if self.hra { 1.0 - rank } else { rank };
+        let relative = relative_rse_factor / self.k as f64 * distance;
+        let fixed = FIXED_RSE_FACTOR / self.k as f64;
+        (relative, fixed)
+    }
+}
+
+fn is_valid_k(k: u16) -> bool {
+    (MIN_K..=MAX_K).contains(&k) && k % 2 == 0
+}
+
+fn less(a: &f32, b: &f32) -> bool {
+    a < b
+}
+
+fn check_split_points(split_points: &[f32]) {
+    let len = split_points.len();
+    if len == 1 && split_points[0].is_nan() {
+        panic!("split_points must not contain NaN values: {split_points:?}");
+    }
+    for i in 0..len.saturating_sub(1) {
+        if split_points[i] < split_points[i + 1] {
+            // we must use this positive condition because NaN comparisons are always false
+            continue;
+        }
+        panic!("split_points must be unique and monotonically increasing: {split_points:?}");
+    }
+}
+
+impl fmt::Display for ReqSketch {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        self.write_description(f, false, false)
+    }
+}
+
+/// Updates the sketch with every value of the iterator. `NaN` values are ignored.
+impl Extend<f32> for ReqSketch {
+    fn extend<I: IntoIterator<Item = f32>>(&mut self, iter: I) {
+        for item in iter {
+            self.update(item);
+        }
+    }
+}
+
+/// Collects the values into a sketch with the default k. `NaN` values are ignored.
+impl FromIterator<f32> for ReqSketch {
+    fn from_iter<I: IntoIterator<Item = f32>>(iter: I) -> Self {
+        let mut sketch = ReqSketch::default();
+        sketch.extend(iter);
+        sketch
+    }
+}
+
+impl QuantileSketch for ReqSketch {
+    type Item = f32;
+
+    fn n(&self) -> u64 {
+        self.n()
+    }
+
+    fn is_exact(&self) -> bool {
+        !self.is_estimation_mode()
+    }
+
+    fn is_empty(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn min_item(&self) -> Option<f32> {
+        self.min_item()
+    }
+
+    fn max_item(&self) -> Option<f32> {
+        self.max_item()
+    }
+
+    fn rank(&self, item: f32, inclusive: bool) -> Option<f64> {
+        self.rank(item, inclusive)
+    }
+
+    fn quantile(&self, rank: f64, inclusive: bool) -> Option<f32> {
+        self.quantile(rank, inclusive)
+    }
+}
+
+impl MergeableSketch for ReqSketch {
+    fn merge(&mut self, other: &Self) -> Result<(), Error> {
+        self.merge(other);
+        Ok(())
+    }
+}
+
+/// Merges the sketchs into the first one, or returns an empty default sketch when there are none.
+impl Sum for ReqSketch {
+    fn sum<I: Iterator<Item = Self>>(mut iter: I) -> Self {
+        let mut result = iter.next().unwrap_or_default();
+        for other in iter {
+            result.merge(&other);
+        }
+        result
+    }
+}
+
+/// Merges the sketchs into a copy of the first one, as the `Sum<ReqSketch>` impl does.
+impl<'a> Sum<&'a ReqSketch> for ReqSketch {
+    fn sum<I: Iterator<Item = &'a Self>>(mut iter: I) -> Self {
+        let mut result = iter.next().cloned().unwrap_or_default();
+        for other in iter {
+            result.merge(other);
+        }
+        result
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(ReqSketch);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(ReqSketch);
+impl_fingerprint_via_image!(ReqSketch);
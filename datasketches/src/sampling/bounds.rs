@@ -0,0 +1,172 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Approximate confidence bounds on the success probability of a binomial distribution, used to
+//! bound subset sums estimated from a sample.
+//!
+//! This is a port of `BoundsOnBinomialProportions` in Java, which approximates the inverse of
+//! the incomplete beta function with formula 26.5.22 of Abramowitz and Stegun, and uses exact
+//! solutions in the corner cases where that approximation is poor.
+
+/// The number of standard deviations of the subset sum bounds, before the finite population
+/// correction.
+const DEFAULT_KAPPA: f64 = 2.0;
+
+/// Lower bound on the fraction of a population satisfying a predicate, given that `k` of `n`
+/// samples drawn without replacement at `sampling_rate` satisfy it.
+pub(super) fn pseudo_hypergeometric_lower_bound(n: u64, k: u64, sampling_rate: f64) -> f64 {
+    let adjusted_kappa = DEFAULT_KAPPA * (1.0 - sampling_rate).sqrt();
+    approximate_lower_bound_on_p(n, k, adjusted_kappa)
+}
+
+/// Upper bound counterpart of [`pseudo_hypergeometric_lower_bound`].
+pub(super) fn pseudo_hypergeometric_upper_bound(n: u64, k: u64, sampling_rate: f64) -> f64 {
+    let adjusted_kappa = DEFAULT_KAPPA * (1.0 - sampling_rate).sqrt();
+    approximate_upper_bound_on_p(n, k, adjusted_kappa)
+}
+
+fn approximate_lower_bound_on_p(n: u64, k: u64, num_std_devs: f64) -> f64 {
+    debug_assert!(k <= n, "k must not exceed n, got k={k}, n={n}");
+    if n == 0 || k == 0 {
+        0.0
+    } else if k == 1 {
+        let delta = delta_of_num_std_devs(num_std_devs);
+        1.0 - (1.0 - delta).powf(1.0 / n as f64)
+    } else if k == n {
+        let delta = delta_of_num_std_devs(num_std_devs);
+        delta.powf(1.0 / n as f64)
+    } else {
+        let x = abramowitz_stegun_26_5_22((n - k + 1) as f64, k as f64, -num_std_devs);
+        1.0 - x
+    }
+}
+
+fn approximate_upper_bound_on_p(n: u64, k: u64, num_std_devs: f64) -> f64 {
+    debug_assert!(k <= n, "k must not exceed n, got k={k}, n={n}");
+    if n == 0 || k == n {
+        1.0
+    } else if k == n - 1 {
+        let delta = delta_of_num_std_devs(num_std_devs);
+        (1.0 - delta).powf(1.0 / n as f64)
+    } else if k == 0 {
+        let delta = delta_of_num_std_devs(num_std_devs);
+        1.0 - delta.powf(1.0 / n as f64)
+    } else {
+        let x = abramowitz_stegun_26_5_22((n - k) as f64, (k + 1) as f64, num_std_devs);
+        1.0 - x
+    }
+}
+
+fn delta_of_num_std_devs(kappa: f64) -> f64 {
+    normal_cdf(-kappa)
+}
+
+fn normal_cdf(x: f64) -> f64 {
+    0.5 * (1.0 + erf(x / std::f64::consts::SQRT_2))
+}
+
+fn erf(x: f64) -> f64 {
+    if x < 0.0 {
+        -erf_of_non_negative(-x)
+    } else {
+        erf_of_non_negative(x)
+    }
+}
+
+/// Formula 7.1.28 of Abramowitz and Stegun, with a maximum error of 3e-7.
+fn erf_of_non_negative(x: f64) -> f64 {
+    const A: [f64; 6] = [
+        0.0705230784,
+        0.0422820123,
+        0.0092705272,
+        0.0001520143,
+        0.0002765672,
+        0.0000430638,
+    ];
+    let mut sum = 1.0;
+    let mut power = 1.0;
+    for a in A {
+        power *= x;
+        sum += a * power;
+    }
+    // raise the sum to the 16th power
+    let sum2 = sum * sum;
+    let sum4 = sum2 * sum2;
+    let sum8 = sum4 * sum4;
+    1.0 - 1.0 / (sum8 * sum8)
+}
+
+/// Formula 26.5.22 of Abramowitz and Stegun, approximating the quantile of the beta
+/// distribution with parameters `a` and `b` at the normal deviate `yp`.
+fn abramowitz_stegun_26_5_22(a: f64, b: f64, yp: f64) -> f64 {
+    let b2m1 = 2.0 * b - 1.0;
+    let a2m1 = 2.0 * a - 1.0;
+    let lambda = (yp * yp - 3.0) / 6.0;
+    let h = 2.0 / (1.0 / a2m1 + 1.0 / b2m1);
+    let term1 = yp * (h + lambda).sqrt() / h;
+    let term2 = 1.0 / b2m1 - 1.0 / a2m1;
+    let term3 = lambda + 5.0 / 6.0 - 2.0 / (3.0 * h);
+    let w = term1 - term2 * term3;
+    a / (a + b * (2.0 * w).exp())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_erf() {
+        assert_eq!(erf(0.0), 0.0);
+        assert!((erf(1.0) - 0.8427007929).abs() < 1e-6);
+        assert!((erf(-2.0) + 0.9953222650).abs() < 1e-6);
+    }
+
+    #[test]
+    fn test_bounds_bracket_the_proportion() {
+        for (n, k) in [
+            (1, 0),
+            (1, 1),
+            (10, 1),
+            (10, 5),
+            (10, 9),
+            (1000, 250),
+            (1000, 1000),
+        ] {
+            let p = k as f64 / n as f64;
+            let lb = approximate_lower_bound_on_p(n, k, 2.0);
+            let ub = approximate_upper_bound_on_p(n, k, 2.0);
+            assert!((0.0..=p).contains(&lb), "n={n}, k={k}, lb={lb}");
+            assert!((p..=1.0).contains(&ub), "n={n}, k={k}, ub={ub}");
+        }
+    }
+
+    #[test]
+    fn test_bounds_narrow_with_sampling_rate() {
+        let sparse_lb = pseudo_hypergeometric_lower_bound(100, 50, 0.1);
+        let sparse_ub = pseudo_hypergeometric_upper_bound(100, 50, 0.1);
+        let dense_lb = pseudo_hypergeometric_lower_bound(100, 50, 0.9);
+        let dense_ub = pseudo_hypergeometric_upper_bound(100, 50, 0.9);
+        assert!(
+            sparse_lb < dense_lb && dense_lb < 0.5,
+            "{sparse_lb} {dense_lb}"
+        );
+        assert!(
+            0.5 < dense_ub && dense_ub < sparse_ub,
+            "{dense_ub} {sparse_ub}"
+        );
+    }
+}
@@ -0,0 +1,245 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::common::random;
+
+/// The sample of an EBPPS sketch: `floor(c)` full items plus, when `c` has a fractional part,
+/// one partial item that belongs to the sample with probability `c - floor(c)`.
+#[derive(Debug, Clone, PartialEq)]
+pub(super) struct EbppsSample<T> {
+    c: f64,
+    data: Vec<T>,
+    partial_item: Option<T>,
+}
+
+impl<T> EbppsSample<T> {
+    pub(super) fn new() -> Self {
+        Self {
+            c: 0.0,
+            data: Vec::new(),
+            partial_item: None,
+        }
+    }
+
+    /// A sample holding one item with inclusion probability `theta`, which rounding can push
+    /// just past 1 for the heaviest item.
+    pub(super) fn single(item: T, theta: f64) -> Self {
+        if theta >= 1.0 {
+            Self {
+                c: 1.0,
+                data: vec![item],
+                partial_item: None,
+            }
+        } else {
+            Self {
+                c: theta,
+                data: Vec::new(),
+                partial_item: Some(item),
+            }
+        }
+    }
+
+    /// Returns the size of the full items buffer in bytes; the partial item is inline.
+    pub(super) fn heap_size(&self) -> usize {
+        self.data.capacity() * size_of::<T>()
+    }
+
+    pub(super) fn from_parts(c: f64, data: Vec<T>, partial_item: Option<T>) -> Self {
+        Self {
+            c,
+            data,
+            partial_item,
+        }
+    }
+
+    pub(super) fn c(&self) -> f64 {
+        self.c
+    }
+
+    pub(super) fn full_items(&self) -> &[T] {
+        &self.data
+    }
+
+    pub(super) fn partial_item(&self) -> Option<&T> {
+        self.partial_item.as_ref()
+    }
+
+    /// Draws a sample, including the partial item with probability `c - floor(c)`.
+    pub(super) fn sample(&self) -> Vec<&T> {
+        let include_partial = random::next_f64() < self.c.fract();
+        let partial = self.partial_item.as_ref().filter(|_| include_partial);
+        self.data.iter().chain(partial).collect()
+    }
+
+    /// Scales every inclusion probability by `theta`, which must not exceed 1.
+    pub(super) fn downsample(&mut self, theta: f64) {
+        if theta >= 1.0 {
+            return;
+        }
+
+        let new_c = theta * self.c;
+        let new_c_int = new_c.floor();
+        let new_c_frac = new_c.fract();
+        let c_int = self.c.floor();
+        let c_frac = self.c.fract();
+
+        if new_c_int == 0.0 {
+            // no full items are retained
+            if random::next_f64() > c_frac / self.c {
+                self.swap_with_partial_item();
+            }
+            self.data.clear();
+        } else if new_c_int == c_int {
+            // no items are deleted
+            if random::next_f64() > (1.0 - theta * c_frac) / (1.0 - new_c_frac) {
+                self.swap_with_partial_item();
+            }
+        } else if random::next_f64() < theta * c_frac {
+            // subsample in random order; the last item is swapped with the partial item
+            self.subsample(new_c_int as usize);
+            self.swap_with_partial_item();
+        } else {
+            // subsample one more item and make a random one of them the partial item
+            self.subsample(new_c_int as usize + 1);
+            self.move_one_to_partial_item();
+        }
+
+        if new_c == new_c_int {
+            self.partial_item = None;
+        }
+        self.c = new_c;
+    }
+
+    /// Merges another sample into this one, combining the two partial items by their
+    /// fractional weights.
+    pub(super) fn merge(&mut self, other: EbppsSample<T>) {
+        let c_frac = self.c.fract();
+        let other_c_frac = other.c.fract();
+        self.c += other.c;
+        self.data.extend(other.data);
+
+        // numeric precision can make the fractional parts add up to exactly 1 even when c does
+        // not come out integral, or the other way round, or c can absorb a partial item too
+        // light to change it; either way at most one of the partial items is kept, and it only
+        // becomes a full item while fewer than floor(c) are held
+        if c_frac == 0.0 && other_c_frac == 0.0 {
+            self.partial_item = None;
+        } else if c_frac + other_c_frac == 1.0 || self.c == self.c.floor() {
+            let kept = if random::next_f64() <= c_frac {
+                self.partial_item.take()
+            } else {
+                other.partial_item
+            };
+            if self.data.len() < self.c.floor() as usize {
+                self.data.extend(kept);
+                self.partial_item = None;
+            } else {
+                self.partial_item = kept.filter(|_| self.c.fract() > 0.0);
+            }
+        } else if c_frac + other_c_frac < 1.0 {
+            if random::next_f64() > c_frac / (c_frac + other_c_frac) {
+                self.partial_item = other.partial_item;
+            }
+        } else if random::next_f64() <= (1.0 - c_frac) / ((1.0 - c_frac) + (1.0 - other_c_frac)) {
+            self.data.extend(other.partial_item);
+        } else {
+            self.data.extend(self.partial_item.take());
+            self.partial_item = other.partial_item;
+        }
+    }
+
+    fn swap_with_partial_item(&mut self) {
+        match self.partial_item.take() {
+            None => self.move_one_to_partial_item(),
+            Some(partial_item) => {
+                let idx = random_index(self.data.len());
+                self.partial_item = Some(std::mem::replace(&mut self.data[idx], partial_item));
+            }
+        }
+    }
+
+    fn move_one_to_partial_item(&mut self) {
+        let idx = random_index(self.data.len());
+        self.partial_item = Some(self.data.swap_remove(idx));
+    }
+
+    /// Keeps a uniformly random subset of `num_samples` full items.
+    fn subsample(&mut self, num_samples: usize) {
+        // a Fisher-Yates shuffle can stop after num_samples swaps, since any item is equally
+        // likely to have ended up in the prefix
+        let len = self.data.len();
+        if num_samples >= len {
+            return;
+        }
+        for i in 0..num_samples {
+            let j = i + random_index(len - i);
+            self.data.swap(i, j);
+        }
+        self.data.truncate(num_samples);
+    }
+}
+
+fn random_index(n: usize) -> usize {
+    (n as f64 * random::next_f64()) as usize
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_downsample_keeps_c() {
+        for theta in [0.9, 0.5, 0.25, 0.1] {
+            let mut sample = EbppsSample::new();
+            for i in 0..10u32 {
+                sample.merge(EbppsSample::single(i, 1.0));
+            }
+            sample.downsample(theta);
+            let c = 10.0 * theta;
+            assert_eq!(sample.c(), c);
+            assert_eq!(sample.full_items().len(), c.floor() as usize);
+            assert_eq!(sample.partial_item().is_some(), c.fract() > 0.0);
+        }
+    }
+
+    #[test]
+    fn test_merge_partial_items() {
+        let mut sample = EbppsSample::single(1, 0.5);
+        sample.merge(EbppsSample::single(2, 0.25));
+        assert_eq!(sample.c(), 0.75);
+        assert!(sample.full_items().is_empty());
+        assert!(sample.partial_item().is_some());
+
+        sample.merge(EbppsSample::single(3, 0.25));
+        assert_eq!(sample.c(), 1.0);
+        assert_eq!(sample.full_items().len(), 1);
+        assert!(sample.partial_item().is_none());
+    }
+
+    #[test]
+    fn test_merge_absorbed_partial_item() {
+        let mut sample = EbppsSample::new();
+        for i in 0..24u32 {
+            sample.merge(EbppsSample::single(i, 1.0));
+        }
+        // too light to change c, so it must not become a 25th full item
+        sample.merge(EbppsSample::single(24, 1e-15));
+        assert_eq!(sample.c(), 24.0);
+        assert_eq!(sample.full_items().len(), 24);
+        assert!(sample.partial_item().is_none());
+    }
+}
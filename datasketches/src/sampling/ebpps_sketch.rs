@@ -0,0 +1,469 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::error::Error;
+use crate::sampling::ebpps_sample::EbppsSample;
+use crate::sampling::serialization::EBPPS_PREAMBLE_LONGS_EMPTY;
+use crate::sampling::serialization::EBPPS_PREAMBLE_LONGS_FULL;
+use crate::sampling::serialization::EBPPS_SERIAL_VERSION;
+use crate::sampling::serialization::FLAGS_HAS_PARTIAL_ITEM;
+use crate::sampling::serialization::FLAGS_IS_EMPTY;
+use crate::sampling::serialization::SamplingItemValue;
+
+/// The largest allowed sample size.
+const MAX_K: u32 = i32::MAX as u32 - 2;
+
+/// Exact and bounded probability proportional to size (EBPPS) sampling sketch.
+///
+/// Every item is in the sample with probability exactly proportional to its weight, and the
+/// sample never holds more than `k` items. Since both guarantees cannot always hold with an
+/// integral sample size, the expected sample size `c` may be fractional: the sample then has
+/// `floor(c)` items plus one partial item that is included with probability `c - floor(c)`.
+///
+/// See the [module level documentation](super) for more.
+#[derive(Debug, Clone, PartialEq)]
+pub struct EbppsItemsSketch<T> {
+    k: u32,
+    n: u64,
+    cumulative_weight: f64,
+    max_weight: f64,
+    // the latest scale factor from weights to inclusion probabilities
+    rho: f64,
+    sample: EbppsSample<T>,
+}
+
+impl<T> EbppsItemsSketch<T> {
+    /// Creates a new sketch keeping at most `k` samples.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `k` is zero or larger than `2^31 - 3`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::EbppsItemsSketch;
+    /// let sketch = EbppsItemsSketch::<u64>::new(64);
+    /// assert_eq!(sketch.k(), 64);
+    /// assert!(sketch.is_empty());
+    /// ```
+    pub fn new(k: u32) -> Self {
+        assert!(
+            (1..=MAX_K).contains(&k),
+            "k must be in [1, {MAX_K}], got {k}"
+        );
+        Self {
+            k,
+            n: 0,
+            cumulative_weight: 0.0,
+            max_weight: 0.0,
+            rho: 1.0,
+            sample: EbppsSample::new(),
+        }
+    }
+
+    /// Updates the sketch with an item of the given weight. Items with zero weight are ignored.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `weight` is negative or not finite.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::EbppsItemsSketch;
+    /// let mut sketch = EbppsItemsSketch::new(4);
+    /// for i in 1..=100u64 {
+    ///     sketch.update(i, 1.0);
+    /// }
+    /// assert_eq!(sketch.n(), 100);
+    /// assert!((sketch.c() - 4.0).abs() < 1e-9);
+    /// assert!(sketch.sample().len() <= 4);
+    /// ```
+    pub fn update(&mut self, item: T, weight: f64) {
+        assert!(
+            weight >= 0.0 && weight.is_finite(),
+            "weight must be non-negative and finite, got {weight}"
+        );
+        if weight == 0.0 {
+            return;
+        }
+
+        let new_cumulative_weight = self.cumulative_weight + weight;
+        let new_max_weight = self.max_weight.max(weight);
+        let new_rho = (1.0 / new_max_weight).min(self.k as f64 / new_cumulative_weight);
+        self.insert(item, weight, new_cumulative_weight, new_rho);
+        self.max_weight = new_max_weight;
+        self.n += 1;
+    }
+
+    /// Rescales the sample to `new_rho` and inserts an item with weight `weight`.
+    fn insert(&mut self, item: T, weight: f64, new_cumulative_weight: f64, new_rho: f64) {
+        if self.cumulative_weight > 0.0 {
+            self.sample.downsample(new_rho / self.rho);
+        }
+        self.sample
+            .merge(EbppsSample::single(item, new_rho * weight));
+        self.cumulative_weight = new_cumulative_weight;
+        self.rho = new_rho;
+    }
+
+    /// Returns the maximum number of samples kept by the sketch.
+    pub fn k(&self) -> u32 {
+        self.k
+    }
+
+    /// Returns the number of items the sketch has seen.
+    pub fn n(&self) -> u64 {
+        self.n
+    }
+
+    /// Returns the expected sample size, which is at most `k`.
+    pub fn c(&self) -> f64 {
+        self.sample.c()
+    }
+
+    /// Returns the total weight of the items the sketch has seen.
+    pub fn cumulative_weight(&self) -> f64 {
+        self.cumulative_weight
+    }
+
+    /// Returns true if the sketch has not seen any items.
+    pub fn is_empty(&self) -> bool {
+        self.n == 0
+    }
+
+    /// Returns the estimated size of the sketch in bytes
+    ///
+    /// Heap memory owned by the sampled items themselves is not included.
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>() + self.sample.heap_size()
+    }
+
+    /// Draws the sample, whose size is `floor(c)` or `ceil(c)`.
+    ///
+    /// The partial item is included at random, so repeated calls may differ.
+    pub fn sample(&self) -> Vec<&T> {
+        self.sample.sample()
+    }
+
+    /// Resets the sketch to its empty state, keeping `k`.
+    pub fn reset(&mut self) {
+        *self = Self::new(self.k);
+    }
+}
+
+impl<T: Clone> EbppsItemsSketch<T> {
+    /// Merges another sketch into this one.
+    ///
+    /// The result keeps the smaller of the two k values.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::EbppsItemsSketch;
+    /// let mut left = EbppsItemsSketch::new(8);
+    /// let mut right = EbppsItemsSketch::new(4);
+    /// for i in 0..100u64 {
+    ///     left.update(i, 1.0);
+    ///     right.update(i + 100, 1.0);
+    /// }
+    /// left.merge(&right);
+    /// assert_eq!(left.k(), 4);
+    /// assert_eq!(left.n(), 200);
+    /// assert_eq!(left.cumulative_weight(), 200.0);
+    /// ```
+    pub fn merge(&mut self, other: &EbppsItemsSketch<T>) {
+        if other.cumulative_weight == 0.0 {
+            return;
+        }
+        if other.cumulative_weight > self.cumulative_weight {
+            // the heavier sketch must absorb the lighter one
+            let mut merged = other.clone();
+            merged.merge_lighter(self);
+            *self = merged;
+        } else {
+            self.merge_lighter(other);
+        }
+    }
+
+    /// Merges a sketch whose cumulative weight does not exceed this one's.
+    fn merge_lighter(&mut self, other: &EbppsItemsSketch<T>) {
+        debug_assert!(other.cumulative_weight <= self.cumulative_weight);
+        let final_cumulative_weight = self.cumulative_weight + other.cumulative_weight;
+        let new_max_weight = self.max_weight.max(other.max_weight);
+        self.k = self.k.min(other.k);
+
+        // each item of the other sample stands for the same share of its cumulative weight,
+        // and the partial item for the fractional part of that share
+        let other_c = other.sample.c();
+        let average_weight = other.cumulative_weight / other_c;
+        for item in other.sample.full_items() {
+            let new_cumulative_weight = self.cumulative_weight + average_weight;
+            let new_rho = (1.0 / new_max_weight).min(self.k as f64 / new_cumulative_weight);
+            self.insert(item.clone(), average_weight, new_cumulative_weight, new_rho);
+        }
+        if let Some(item) = other.sample.partial_item() {
+            let weight = other_c.fract() * average_weight;
+            let new_cumulative_weight = self.cumulative_weight + weight;
+            let new_rho = (1.0 / new_max_weight).min(self.k as f64 / new_cumulative_weight);
+            self.insert(item.clone(), weight, new_cumulative_weight, new_rho);
+        }
+
+        // use the exact total instead of the running sum, rescaling the sample when that sum
+        // fell short or nothing was inserted to apply a smaller k
+        let final_rho = (1.0 / new_max_weight).min(self.k as f64 / final_cumulative_weight);
+        if final_rho < self.rho {
+            self.sample.downsample(final_rho / self.rho);
+            self.rho = final_rho;
+        }
+        self.cumulative_weight = final_cumulative_weight;
+        self.max_weight = new_max_weight;
+        self.n = self.n.saturating_add(other.n);
+    }
+}
+
+impl<T: SamplingItemValue> EbppsItemsSketch<T> {
+    /// Serializes the sketch in the format of `EbppsItemsSketch` in Java and `ebpps_sketch` in
+    /// C++.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::EbppsItemsSketch;
+    /// let mut sketch = EbppsItemsSketch::new(8);
+    /// sketch.update("apple".to_string(), 2.5);
+    /// let bytes = sketch.serialize();
+    /// let decoded = EbppsItemsSketch::<String>::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.n(), 1);
+    /// assert_eq!(decoded.c(), 1.0);
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces, as reported by
+    /// [`SamplingItemValue::serialize_size`] for the sampled items.
+    pub fn serialized_size_bytes(&self) -> usize {
+        if self.is_empty() {
+            return EBPPS_PREAMBLE_LONGS_EMPTY as usize * 8;
+        }
+        let items_size: usize = self
+            .sample
+            .full_items()
+            .iter()
+            .chain(self.sample.partial_item())
+            .map(T::serialize_size)
+            .sum();
+        EBPPS_PREAMBLE_LONGS_FULL as usize * 8 + size_of::<f64>() + items_size
+    }
+
+    /// Serializes this sketch into `buf` in the format written by
+    /// [`serialize`](Self::serialize), returning the number of bytes written.
+    ///
+    /// Returns an error if `buf` is too short for the image.
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Streams the sketch to `writer` in the format written by [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        let preamble_longs = if self.is_empty() {
+            EBPPS_PREAMBLE_LONGS_EMPTY
+        } else {
+            EBPPS_PREAMBLE_LONGS_FULL
+        };
+        let partial_item = self.sample.partial_item();
+
+        bytes.write_u8(preamble_longs);
+        bytes.write_u8(EBPPS_SERIAL_VERSION);
+        bytes.write_u8(Family::EBPPS.id);
+        bytes.write_u8({
+            let mut flags = 0;
+            if self.is_empty() {
+                flags |= FLAGS_IS_EMPTY;
+            }
+            if partial_item.is_some() {
+                flags |= FLAGS_HAS_PARTIAL_ITEM;
+            }
+            flags
+        });
+        bytes.write_u32_le(self.k);
+        if self.is_empty() {
+            return;
+        }
+
+        bytes.write_u64_le(self.n);
+        bytes.write_f64_le(self.cumulative_weight);
+        bytes.write_f64_le(self.max_weight);
+        bytes.write_f64_le(self.rho);
+        bytes.write_f64_le(self.sample.c());
+        for item in self.sample.full_items().iter().chain(partial_item) {
+            item.serialize_value(bytes);
+        }
+    }
+
+    /// Deserializes a sketch from bytes written by [`Self::serialize`], Java or C++.
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`, consuming exactly
+    /// the bytes of one image.
+    ///
+    /// Fails like [`deserialize`](Self::deserialize); a failing `reader` is reported as
+    /// insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    pub(super) fn read_image(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        fn ensure_positive(value: f64, name: &str) -> Result<f64, Error> {
+            if value.is_finite() && value > 0.0 {
+                Ok(value)
+            } else {
+                Err(Error::deserial(format!(
+                    "{name} must be positive and finite, got {value}"
+                )))
+            }
+        }
+
+        let preamble_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let k = cursor.read_u32_le().map_err(insufficient_data("k"))?;
+
+        Family::EBPPS.validate_id(family_id)?;
+        ensure_serial_version_is(EBPPS_SERIAL_VERSION, serial_version)?;
+        let is_empty = (flags & FLAGS_IS_EMPTY) != 0;
+        let expected = if is_empty {
+            EBPPS_PREAMBLE_LONGS_EMPTY
+        } else {
+            EBPPS_PREAMBLE_LONGS_FULL
+        };
+        ensure_preamble_longs_in(&[expected], preamble_longs)?;
+        if !(1..=MAX_K).contains(&k) {
+            return Err(Error::deserial(format!(
+                "k must be in [1, {MAX_K}], got {k}"
+            )));
+        }
+        if is_empty {
+            return Ok(Self::new(k));
+        }
+
+        let n = cursor.read_u64_le().map_err(insufficient_data("n"))?;
+        let cumulative_weight = cursor
+            .read_f64_le()
+            .map_err(insufficient_data("cumulative_weight"))?;
+        let max_weight = cursor
+            .read_f64_le()
+            .map_err(insufficient_data("max_weight"))?;
+        let rho = cursor.read_f64_le().map_err(insufficient_data("rho"))?;
+        let c = cursor.read_f64_le().map_err(insufficient_data("c"))?;
+        let cumulative_weight = ensure_positive(cumulative_weight, "cumulative_weight")?;
+        let max_weight = ensure_positive(max_weight, "max_weight")?;
+        let rho = ensure_positive(rho, "rho")?;
+        let c = ensure_positive(c, "c")?;
+        if c.floor() > k as f64 {
+            return Err(Error::deserial(format!("sample size c={c} exceeds k={k}")));
+        }
+        if max_weight > cumulative_weight {
+            return Err(Error::deserial(format!(
+                "max_weight={max_weight} exceeds cumulative_weight={cumulative_weight}"
+            )));
+        }
+        // updates and merges keep rho = min(1 / max_weight, k / cumulative_weight) and
+        // c = rho * cumulative_weight; merging anything else can push an inclusion probability
+        // past 1
+        let expected_rho = (1.0 / max_weight).min(k as f64 / cumulative_weight);
+        if !approx_eq(rho, expected_rho) {
+            return Err(Error::deserial(format!(
+                "rho={rho} does not match min(1 / max_weight, k / cumulative_weight)={expected_rho}"
+            )));
+        }
+        let expected_c = (cumulative_weight / max_weight).min(k as f64);
+        if !approx_eq(c, expected_c) {
+            return Err(Error::deserial(format!(
+                "sample size c={c} does not match min(k, cumulative_weight / max_weight)={expected_c}"
+            )));
+        }
+        if (flags & FLAGS_HAS_PARTIAL_ITEM) != 0 && c.fract() == 0.0 {
+            return Err(Error::deserial(format!(
+                "integral sample size c={c} cannot have a partial item"
+            )));
+        }
+
+        let num_full_items = c.floor() as usize;
+        let mut data = Vec::with_capacity(cursor.capacity_hint(num_full_items, 1));
+        for _ in 0..num_full_items {
+            data.push(T::deserialize_value(&mut cursor)?);
+        }
+        let partial_item = if (flags & FLAGS_HAS_PARTIAL_ITEM) != 0 {
+            Some(T::deserialize_value(&mut cursor)?)
+        } else {
+            None
+        };
+
+        Ok(Self {
+            k,
+            n,
+            cumulative_weight,
+            max_weight,
+            rho,
+            sample: EbppsSample::from_parts(c, data, partial_item),
+        })
+    }
+}
+
+/// Returns whether two derived quantities agree up to the rounding of summed weights.
+fn approx_eq(actual: f64, expected: f64) -> bool {
+    (actual - expected).abs() <= 1e-9 * expected
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!([T: SamplingItemValue] EbppsItemsSketch<T>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([T: SamplingItemValue] EbppsItemsSketch<T>);
+impl_fingerprint_via_image!([T: SamplingItemValue] EbppsItemsSketch<T>);
@@ -0,0 +1,78 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Sampling sketches that keep a bounded random sample of the items in a stream.
+//!
+//! [`ReservoirItemsSketch`] implements reservoir sampling ([Vitter, 1985][vitter]): it keeps a
+//! sample of at most `k` items such that every item seen so far is equally likely to be in it.
+//! Unlike the count-based sketches, a sample keeps the items themselves, so it can answer
+//! arbitrary predicates after the fact.
+//!
+//! [`ReservoirUnion`] combines sketches built over disjoint streams into a uniform sample of
+//! their concatenation, even when the inputs have different k.
+//!
+//! [`VarOptItemsSketch`] samples weighted items with the variance optimal scheme of
+//! [Cohen et al.][varopt]: items heavier than a threshold are always kept with their exact
+//! weight, and the rest share the remaining slots. Subset sum estimates over the sample are
+//! unbiased and have the least possible average variance for a sample of that size.
+//! [`VarOptUnion`] merges VarOpt and reservoir sketches into a VarOpt sample.
+//!
+//! [`EbppsItemsSketch`] implements exact and bounded probability proportional to size
+//! sampling ([Hentschel et al.][ebpps]): each item is in the sample with probability exactly
+//! proportional to its weight, and the sample holds at most `k` items. The price is that the
+//! expected sample size may be fractional, in which case the actual size varies by one.
+//!
+//! The reservoir and VarOpt sketches estimate the total weight of the items satisfying a
+//! predicate, with bounds, as a [`SampleSubsetSummary`].
+//!
+//! Items implementing [`SamplingItemValue`] (`String`, `i64`, `u64` and `f64`) can be serialized
+//! in the binary format of the sketches and unions of the Java sampling package, which C++
+//! shares for EBPPS.
+//!
+//! [vitter]: https://doi.org/10.1145/3147.3165
+//! [varopt]: https://arxiv.org/abs/0803.0473
+//! [ebpps]: https://arxiv.org/abs/2305.16259
+//!
+//! # Usage
+//!
+//! ```
+//! # use datasketches::sampling::ReservoirItemsSketch;
+//! let mut sketch = ReservoirItemsSketch::new(100);
+//! for i in 0..10_000u64 {
+//!     sketch.update(i);
+//! }
+//! assert_eq!(sketch.num_samples(), 100);
+//! assert!(sketch.iter().all(|&i| i < 10_000));
+//! ```
+
+mod bounds;
+mod ebpps_sample;
+mod ebpps_sketch;
+mod reservoir_sketch;
+mod reservoir_union;
+mod serialization;
+mod subset_summary;
+mod varopt_sketch;
+mod varopt_union;
+
+pub use self::ebpps_sketch::EbppsItemsSketch;
+pub use self::reservoir_sketch::ReservoirItemsSketch;
+pub use self::reservoir_union::ReservoirUnion;
+pub use self::serialization::SamplingItemValue;
+pub use self::subset_summary::SampleSubsetSummary;
+pub use self::varopt_sketch::VarOptItemsSketch;
+pub use self::varopt_union::VarOptUnion;
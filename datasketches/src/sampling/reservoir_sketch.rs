@@ -0,0 +1,453 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::random;
+use crate::error::Error;
+use crate::sampling::SampleSubsetSummary;
+use crate::sampling::bounds::pseudo_hypergeometric_lower_bound;
+use crate::sampling::bounds::pseudo_hypergeometric_upper_bound;
+use crate::sampling::serialization::FLAGS_IS_EMPTY;
+use crate::sampling::serialization::LG_RESIZE_FACTOR;
+use crate::sampling::serialization::LG_RESIZE_FACTOR_SHIFT;
+use crate::sampling::serialization::PREAMBLE_LONGS_MASK;
+use crate::sampling::serialization::RESERVOIR_PREAMBLE_LONGS_EMPTY;
+use crate::sampling::serialization::RESERVOIR_PREAMBLE_LONGS_FULL;
+use crate::sampling::serialization::SERIAL_VERSION;
+use crate::sampling::serialization::SamplingItemValue;
+
+/// The smallest allowed reservoir size.
+const MIN_K: u32 = 2;
+
+/// Reservoir sampling sketch keeping a uniform random sample of the items seen.
+///
+/// Until `k` items have been seen the sketch retains every item. After that, the `n`-th item
+/// replaces a uniformly chosen sample with probability `k / n`, so at any point every item seen
+/// so far is in the sample with the same probability.
+#[derive(Debug, Clone, PartialEq)]
+pub struct ReservoirItemsSketch<T> {
+    k: u32,
+    n: u64,
+    samples: Vec<T>,
+}
+
+impl<T> ReservoirItemsSketch<T> {
+    /// Creates a new sketch keeping at most `k` samples.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `k` is less than 2.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::ReservoirItemsSketch;
+    /// let sketch = ReservoirItemsSketch::<u64>::new(64);
+    /// assert_eq!(sketch.k(), 64);
+    /// assert!(sketch.is_empty());
+    /// ```
+    pub fn new(k: u32) -> Self {
+        assert!(k >= MIN_K, "k must be at least {MIN_K}, got {k}");
+        Self {
+            k,
+            n: 0,
+            samples: Vec::with_capacity(k.min(1024) as usize),
+        }
+    }
+
+    /// Updates the sketch with an item.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::ReservoirItemsSketch;
+    /// let mut sketch = ReservoirItemsSketch::new(4);
+    /// for i in 0..100u64 {
+    ///     sketch.update(i);
+    /// }
+    /// assert_eq!(sketch.n(), 100);
+    /// assert_eq!(sketch.num_samples(), 4);
+    /// ```
+    pub fn update(&mut self, item: T) {
+        self.n += 1;
+        if self.n <= self.k as u64 {
+            self.samples.push(item);
+            return;
+        }
+
+        // the new item is kept with probability k/n, in a uniformly chosen slot
+        let slot = (self.n as f64 * random::next_f64()) as u64;
+        if slot < self.k as u64 {
+            self.samples[slot as usize] = item;
+        }
+    }
+
+    /// Returns the maximum number of samples kept by the sketch.
+    pub fn k(&self) -> u32 {
+        self.k
+    }
+
+    /// Returns the number of items the sketch has seen.
+    pub fn n(&self) -> u64 {
+        self.n
+    }
+
+    /// Returns the number of samples currently in the sketch, which is `min(n, k)`.
+    pub fn num_samples(&self) -> usize {
+        self.samples.len()
+    }
+
+    /// Returns true if the sketch has not seen any items.
+    pub fn is_empty(&self) -> bool {
+        self.n == 0
+    }
+
+    /// Returns true if the sketch has seen more items than it can keep.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.n > self.k as u64
+    }
+
+    /// Returns the estimated size of the sketch in bytes
+    ///
+    /// Only the inline size of the samples is counted, not any heap memory they own.
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>() + self.samples.capacity() * size_of::<T>()
+    }
+
+    /// Returns the samples, in no particular order.
+    pub fn samples(&self) -> &[T] {
+        &self.samples
+    }
+
+    /// Returns an iterator over the samples, in no particular order.
+    pub fn iter(&self) -> impl Iterator<Item = &T> {
+        self.samples.iter()
+    }
+
+    /// Returns the number of items each sample stands for, which is `n / k` in estimation mode
+    /// and 1 otherwise.
+    pub fn implicit_sample_weight(&self) -> f64 {
+        if self.is_estimation_mode() {
+            self.n as f64 / self.k as f64
+        } else {
+            1.0
+        }
+    }
+
+    /// Estimates how many of the items seen satisfy the predicate, from the fraction of matching
+    /// samples.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::ReservoirItemsSketch;
+    /// let mut sketch = ReservoirItemsSketch::new(16);
+    /// for i in 0..10u64 {
+    ///     sketch.update(i);
+    /// }
+    /// let summary = sketch.estimate_subset_sum(|&i| i % 2 == 0);
+    /// assert_eq!(summary.estimate(), 5.0);
+    /// assert_eq!(summary.total_sketch_weight(), 10.0);
+    /// ```
+    pub fn estimate_subset_sum<P>(&self, mut predicate: P) -> SampleSubsetSummary
+    where
+        P: FnMut(&T) -> bool,
+    {
+        if self.is_empty() {
+            return SampleSubsetSummary::new(0.0, 0.0, 0.0, 0.0);
+        }
+
+        let num_samples = self.samples.len() as u64;
+        let matching = self.samples.iter().filter(|item| predicate(item)).count() as u64;
+        if !self.is_estimation_mode() {
+            let matching = matching as f64;
+            return SampleSubsetSummary::new(matching, matching, matching, num_samples as f64);
+        }
+
+        let n = self.n as f64;
+        let sampling_rate = num_samples as f64 / n;
+        let lower_fraction =
+            pseudo_hypergeometric_lower_bound(num_samples, matching, sampling_rate);
+        let fraction = matching as f64 / num_samples as f64;
+        let upper_fraction =
+            pseudo_hypergeometric_upper_bound(num_samples, matching, sampling_rate);
+        SampleSubsetSummary::new(n * lower_fraction, n * fraction, n * upper_fraction, n)
+    }
+
+    /// Resets the sketch to its empty state, keeping `k`.
+    pub fn reset(&mut self) {
+        self.n = 0;
+        self.samples.clear();
+    }
+
+    /// Replaces the sample in the given slot; used by the union when merging weighted samples.
+    pub(super) fn replace_sample(&mut self, slot: usize, item: T) {
+        self.samples[slot] = item;
+    }
+
+    /// Accounts for items represented by samples merged in through [`Self::replace_sample`],
+    /// saturating for decoded sketches that claim counts near `u64::MAX`.
+    pub(super) fn increment_n(&mut self, count: u64) {
+        self.n = self.n.saturating_add(count);
+    }
+}
+
+impl<T: Clone> ReservoirItemsSketch<T> {
+    /// Updates the sketch with `weight` copies of an item, as `weight` calls of
+    /// [`update`](Self::update) would.
+    ///
+    /// This suits pre-aggregated streams: the weight counts the item towards [`n`](Self::n)
+    /// `weight` times, and the resulting sample has the distribution of the one-by-one updates.
+    /// Once the reservoir is full, the cost depends on `k` rather than on `weight`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::ReservoirItemsSketch;
+    /// let mut sketch = ReservoirItemsSketch::new(4);
+    /// sketch.update_with_weight("rare", 1);
+    /// sketch.update_with_weight("common", 1_000_000);
+    /// assert_eq!(sketch.n(), 1_000_001);
+    /// assert_eq!(sketch.num_samples(), 4);
+    /// ```
+    pub fn update_with_weight(&mut self, item: T, weight: u64) {
+        let k = self.k as u64;
+        let mut remaining = weight;
+        while remaining > 0 && self.n < k {
+            self.samples.push(item.clone());
+            self.n += 1;
+            remaining -= 1;
+        }
+        if remaining <= k {
+            for _ in 0..remaining {
+                self.update(item.clone());
+            }
+            return;
+        }
+
+        // The reservoir ends up a uniform k-subset of all n + remaining items, so the number
+        // of copies in it is hypergeometric, and the slots they replace are uniformly chosen.
+        let mut copies_left = remaining;
+        let mut items_left = self.n + remaining;
+        let mut slots: Vec<usize> = (0..self.samples.len()).collect();
+        let mut num_copies = 0;
+        for _ in 0..k {
+            if (items_left as f64 * random::next_f64()) < copies_left as f64 {
+                let slot = num_copies + (random::next_u64() % (k - num_copies as u64)) as usize;
+                slots.swap(num_copies, slot);
+                self.samples[slots[num_copies]] = item.clone();
+                num_copies += 1;
+                copies_left -= 1;
+            }
+            items_left -= 1;
+        }
+        self.n += remaining;
+    }
+}
+
+/// Offers every item of the iterator to the reservoir.
+impl<T> Extend<T> for ReservoirItemsSketch<T> {
+    fn extend<I: IntoIterator<Item = T>>(&mut self, iter: I) {
+        for item in iter {
+            self.update(item);
+        }
+    }
+}
+
+impl<T: SamplingItemValue> ReservoirItemsSketch<T> {
+    /// Serializes the sketch in the format of Java's `ReservoirItemsSketch`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::ReservoirItemsSketch;
+    /// let mut sketch = ReservoirItemsSketch::new(8);
+    /// sketch.update("apple".to_string());
+    /// let bytes = sketch.serialize();
+    /// let decoded = ReservoirItemsSketch::<String>::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.samples(), ["apple".to_string()]);
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces, as reported by
+    /// [`SamplingItemValue::serialize_size`] for the samples.
+    pub fn serialized_size_bytes(&self) -> usize {
+        let preamble_longs = if self.is_empty() {
+            RESERVOIR_PREAMBLE_LONGS_EMPTY
+        } else {
+            RESERVOIR_PREAMBLE_LONGS_FULL
+        };
+        let items_size: usize = self.samples.iter().map(T::serialize_size).sum();
+        preamble_longs as usize * 8 + items_size
+    }
+
+    /// Serializes this sketch into `buf` in the format written by
+    /// [`serialize`](Self::serialize), returning the number of bytes written.
+    ///
+    /// Returns an error if `buf` is too short for the image.
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Streams the sketch to `writer` in the format written by [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    pub(super) fn write_image(&self, bytes: &mut SketchBytes) {
+        let preamble_longs = if self.is_empty() {
+            RESERVOIR_PREAMBLE_LONGS_EMPTY
+        } else {
+            RESERVOIR_PREAMBLE_LONGS_FULL
+        };
+
+        bytes.write_u8(preamble_longs | (LG_RESIZE_FACTOR << LG_RESIZE_FACTOR_SHIFT));
+        bytes.write_u8(SERIAL_VERSION);
+        bytes.write_u8(Family::RESERVOIR.id);
+        bytes.write_u8(if self.is_empty() { FLAGS_IS_EMPTY } else { 0 });
+        bytes.write_u32_le(self.k);
+        if self.is_empty() {
+            return;
+        }
+
+        bytes.write_u64_le(self.n);
+        for item in &self.samples {
+            item.serialize_value(bytes);
+        }
+    }
+
+    /// Deserializes a sketch from bytes written by [`Self::serialize`] or by Java's
+    /// `ReservoirItemsSketch`.
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`, consuming exactly
+    /// the bytes of one image.
+    ///
+    /// Fails like [`deserialize`](Self::deserialize); a failing `reader` is reported as
+    /// insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    pub(super) fn read_image(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        let preamble_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?
+            & PREAMBLE_LONGS_MASK;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let k = cursor.read_u32_le().map_err(insufficient_data("k"))?;
+
+        Family::RESERVOIR.validate_id(family_id)?;
+        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        let is_empty = (flags & FLAGS_IS_EMPTY) != 0;
+        let expected = if is_empty {
+            RESERVOIR_PREAMBLE_LONGS_EMPTY
+        } else {
+            RESERVOIR_PREAMBLE_LONGS_FULL
+        };
+        ensure_preamble_longs_in(&[expected], preamble_longs)?;
+        if k < MIN_K {
+            return Err(Error::deserial(format!(
+                "k must be at least {MIN_K}, got {k}"
+            )));
+        }
+        if is_empty {
+            return Ok(Self::new(k));
+        }
+
+        let n = cursor.read_u64_le().map_err(insufficient_data("n"))?;
+        if n == 0 {
+            return Err(Error::deserial(
+                "non-empty reservoir sketch with n = 0".to_string(),
+            ));
+        }
+        let num_samples = n.min(k as u64) as usize;
+        let mut samples = Vec::with_capacity(cursor.capacity_hint(num_samples, 1));
+        for _ in 0..num_samples {
+            samples.push(T::deserialize_value(&mut cursor)?);
+        }
+        Ok(Self { k, n, samples })
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!([T: SamplingItemValue] ReservoirItemsSketch<T>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([T: SamplingItemValue] ReservoirItemsSketch<T>);
+impl_fingerprint_via_image!([T: SamplingItemValue] ReservoirItemsSketch<T>);
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_exact_mode_keeps_every_item() {
+        let mut sketch = ReservoirItemsSketch::new(10);
+        for i in 0..10u64 {
+            sketch.update(i);
+        }
+        assert!(!sketch.is_estimation_mode());
+        assert_eq!(sketch.samples(), (0..10).collect::<Vec<_>>());
+    }
+
+    #[test]
+    fn test_sampling_is_uniform() {
+        // each of the 100 items should be sampled about 1000 * 10 / 100 = 100 times
+        let mut counts = [0u32; 100];
+        for _ in 0..1000 {
+            let mut sketch = ReservoirItemsSketch::new(10);
+            for i in 0..100usize {
+                sketch.update(i);
+            }
+            for &i in sketch.samples() {
+                counts[i] += 1;
+            }
+        }
+        for (i, &count) in counts.iter().enumerate() {
+            assert!(
+                (50..=150).contains(&count),
+                "item {i} sampled {count} times"
+            );
+        }
+    }
+}
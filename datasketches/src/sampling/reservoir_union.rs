@@ -0,0 +1,375 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::borrow::Cow;
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::random;
+use crate::error::Error;
+use crate::sampling::ReservoirItemsSketch;
+use crate::sampling::serialization::FLAGS_IS_EMPTY;
+use crate::sampling::serialization::PREAMBLE_LONGS_MASK;
+use crate::sampling::serialization::RESERVOIR_UNION_PREAMBLE_LONGS;
+use crate::sampling::serialization::SERIAL_VERSION;
+use crate::sampling::serialization::SamplingItemValue;
+
+/// Union of reservoir sampling sketches.
+///
+/// The union keeps a gadget sketch with at most `max_k` samples. Input sketches with a larger k
+/// are downsampled first, and sketches in estimation mode are merged by weighting each of their
+/// samples with the number of items it stands for, so the result is a uniform sample of the
+/// combined streams.
+#[derive(Debug, Clone, PartialEq)]
+pub struct ReservoirUnion<T> {
+    max_k: u32,
+    gadget: Option<ReservoirItemsSketch<T>>,
+}
+
+impl<T> ReservoirUnion<T> {
+    /// Creates a new union producing sketches with at most `max_k` samples.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `max_k` is less than 2.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::ReservoirUnion;
+    /// let union = ReservoirUnion::<u64>::new(64);
+    /// assert_eq!(union.max_k(), 64);
+    /// assert!(union.is_empty());
+    /// ```
+    pub fn new(max_k: u32) -> Self {
+        assert!(max_k >= 2, "max_k must be at least 2, got {max_k}");
+        Self {
+            max_k,
+            gadget: None,
+        }
+    }
+
+    /// Updates the union with a single item.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::ReservoirUnion;
+    /// let mut union = ReservoirUnion::new(8);
+    /// union.update_value(1u64);
+    /// union.update_value(2u64);
+    /// assert_eq!(union.to_sketch().n(), 2);
+    /// ```
+    pub fn update_value(&mut self, item: T) {
+        let max_k = self.max_k;
+        self.gadget
+            .get_or_insert_with(|| ReservoirItemsSketch::new(max_k))
+            .update(item);
+    }
+
+    /// Returns the maximum number of samples of the union's result.
+    pub fn max_k(&self) -> u32 {
+        self.max_k
+    }
+
+    /// Returns true if the union has not seen any items.
+    pub fn is_empty(&self) -> bool {
+        self.gadget.as_ref().is_none_or(|gadget| gadget.is_empty())
+    }
+
+    /// Resets the union to its empty state, keeping `max_k`.
+    pub fn reset(&mut self) {
+        self.gadget = None;
+    }
+}
+
+impl<T: Clone> ReservoirUnion<T> {
+    /// Updates the union with a sketch.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::ReservoirItemsSketch;
+    /// # use datasketches::sampling::ReservoirUnion;
+    /// let mut left = ReservoirItemsSketch::new(16);
+    /// let mut right = ReservoirItemsSketch::new(16);
+    /// for i in 0..100u64 {
+    ///     left.update(i);
+    ///     right.update(i + 100);
+    /// }
+    ///
+    /// let mut union = ReservoirUnion::new(16);
+    /// union.update(&left);
+    /// union.update(&right);
+    /// let result = union.to_sketch();
+    /// assert_eq!(result.n(), 200);
+    /// assert_eq!(result.num_samples(), 16);
+    /// ```
+    pub fn update(&mut self, sketch: &ReservoirItemsSketch<T>) {
+        if sketch.is_empty() {
+            return;
+        }
+
+        let sketch = if sketch.k() > self.max_k {
+            Cow::Owned(downsample(sketch, self.max_k))
+        } else {
+            Cow::Borrowed(sketch)
+        };
+        let gadget = match self.gadget.take() {
+            None => {
+                if sketch.k() < self.max_k && !sketch.is_estimation_mode() {
+                    // widen the gadget to max_k while the input still holds every item
+                    let mut gadget = ReservoirItemsSketch::new(self.max_k);
+                    for item in sketch.iter() {
+                        gadget.update(item.clone());
+                    }
+                    gadget
+                } else {
+                    sketch.into_owned()
+                }
+            }
+            Some(mut gadget) => {
+                if !sketch.is_estimation_mode() {
+                    for item in sketch.iter() {
+                        gadget.update(item.clone());
+                    }
+                    gadget
+                } else if !gadget.is_estimation_mode() {
+                    let mut result = sketch.into_owned();
+                    for item in gadget.samples() {
+                        result.update(item.clone());
+                    }
+                    result
+                } else if sketch.implicit_sample_weight()
+                    < gadget.n() as f64 / (gadget.k() - 1) as f64
+                {
+                    merge_weighted(&mut gadget, &sketch);
+                    gadget
+                } else {
+                    let mut result = sketch.into_owned();
+                    merge_weighted(&mut result, &gadget);
+                    result
+                }
+            }
+        };
+        self.gadget = Some(gadget);
+    }
+
+    /// Returns the union result as a sketch.
+    ///
+    /// An empty union yields an empty sketch with k equal to `max_k`.
+    pub fn to_sketch(&self) -> ReservoirItemsSketch<T> {
+        match &self.gadget {
+            Some(gadget) => gadget.clone(),
+            None => ReservoirItemsSketch::new(self.max_k),
+        }
+    }
+}
+
+impl<T: SamplingItemValue> ReservoirUnion<T> {
+    /// Serializes the union in the format of Java's `ReservoirItemsUnion`.
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        8 + self
+            .gadget
+            .as_ref()
+            .map_or(0, ReservoirItemsSketch::serialized_size_bytes)
+    }
+
+    /// Serializes the union into `buf` in the format written by
+    /// [`serialize`](Self::serialize), returning the number of bytes written.
+    ///
+    /// Returns an error if `buf` is too short for the image.
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Streams the union to `writer` in the format written by [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        bytes.write_u8(RESERVOIR_UNION_PREAMBLE_LONGS);
+        bytes.write_u8(SERIAL_VERSION);
+        bytes.write_u8(Family::RESERVOIR_UNION.id);
+        bytes.write_u8(if self.gadget.is_none() {
+            FLAGS_IS_EMPTY
+        } else {
+            0
+        });
+        bytes.write_u32_le(self.max_k);
+        if let Some(gadget) = &self.gadget {
+            gadget.write_image(bytes);
+        }
+    }
+
+    /// Deserializes a union from bytes written by [`Self::serialize`] or by Java's
+    /// `ReservoirItemsUnion`.
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a union written by [`write_to`](Self::write_to) from `reader`, consuming exactly
+    /// the bytes of one image.
+    ///
+    /// Fails like [`deserialize`](Self::deserialize); a failing `reader` is reported as
+    /// insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        let preamble_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?
+            & PREAMBLE_LONGS_MASK;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let max_k = cursor.read_u32_le().map_err(insufficient_data("max_k"))?;
+
+        Family::RESERVOIR_UNION.validate_id(family_id)?;
+        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        ensure_preamble_longs_in(&[RESERVOIR_UNION_PREAMBLE_LONGS], preamble_longs)?;
+        if max_k < 2 {
+            return Err(Error::deserial(format!(
+                "max_k must be at least 2, got {max_k}"
+            )));
+        }
+        if (flags & FLAGS_IS_EMPTY) != 0 {
+            return Ok(Self::new(max_k));
+        }
+
+        let gadget = ReservoirItemsSketch::read_image(cursor)?;
+        if gadget.k() > max_k {
+            return Err(Error::deserial(format!(
+                "gadget k {} exceeds the union max_k {max_k}",
+                gadget.k()
+            )));
+        }
+        Ok(Self {
+            max_k,
+            gadget: Some(gadget),
+        })
+    }
+}
+
+/// Returns a copy of an estimation mode sketch reduced to `k` samples.
+fn downsample<T: Clone>(sketch: &ReservoirItemsSketch<T>, k: u32) -> ReservoirItemsSketch<T> {
+    let mut result = ReservoirItemsSketch::new(k);
+    for item in sketch.iter() {
+        result.update(item.clone());
+    }
+    // each retained sample now stands for the items the input had already skipped
+    result.increment_n(sketch.n() - result.n());
+    result
+}
+
+/// Merges the samples of an estimation mode `source` into an estimation mode `target`.
+///
+/// Each source sample carries weight `source.n / source.k` and replaces a random target sample
+/// with probability proportional to that weight over the running total.
+fn merge_weighted<T: Clone>(
+    target: &mut ReservoirItemsSketch<T>,
+    source: &ReservoirItemsSketch<T>,
+) {
+    let source_weight = source.implicit_sample_weight();
+    let rescaled_prob = target.k() as f64 * source_weight;
+    let mut total = target.n() as f64;
+    for item in source.iter() {
+        total += source_weight;
+        if total * random::next_f64() < rescaled_prob {
+            let slot = (target.k() as f64 * random::next_f64()) as usize;
+            target.replace_sample(slot, item.clone());
+        }
+    }
+    target.increment_n(source.n());
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!([T: SamplingItemValue] ReservoirUnion<T>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([T: SamplingItemValue] ReservoirUnion<T>);
+impl_fingerprint_via_image!([T: SamplingItemValue] ReservoirUnion<T>);
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_downsample_keeps_n() {
+        let mut sketch = ReservoirItemsSketch::new(100);
+        for i in 0..1000u64 {
+            sketch.update(i);
+        }
+        let downsampled = downsample(&sketch, 10);
+        assert_eq!(downsampled.k(), 10);
+        assert_eq!(downsampled.n(), 1000);
+        assert_eq!(downsampled.num_samples(), 10);
+        assert!(
+            downsampled
+                .iter()
+                .all(|item| sketch.samples().contains(item))
+        );
+    }
+
+    #[test]
+    fn test_weighted_merge_is_balanced() {
+        // both inputs stand for the same number of items, so the result should hold about as
+        // many samples from each
+        let mut from_right = 0;
+        for _ in 0..200 {
+            let mut left = ReservoirItemsSketch::new(20);
+            let mut right = ReservoirItemsSketch::new(20);
+            for i in 0..1000u64 {
+                left.update(i);
+                right.update(i + 1000);
+            }
+            merge_weighted(&mut left, &right);
+            assert_eq!(left.n(), 2000);
+            from_right += left.iter().filter(|&&item| item >= 1000).count();
+        }
+        // the expectation is 200 * 20 / 2 = 2000
+        assert!(
+            (1700..=2300).contains(&from_right),
+            "from_right: {from_right}"
+        );
+    }
+}
@@ -0,0 +1,122 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::error::Error;
+
+/// Serialization version of the reservoir and VarOpt sketches and unions.
+pub const SERIAL_VERSION: u8 = 2;
+/// Serialization version of the EBPPS sketch.
+pub const EBPPS_SERIAL_VERSION: u8 = 1;
+
+/// Preamble longs for an empty reservoir sketch.
+pub const RESERVOIR_PREAMBLE_LONGS_EMPTY: u8 = 1;
+/// Preamble longs for a non-empty reservoir sketch.
+pub const RESERVOIR_PREAMBLE_LONGS_FULL: u8 = 2;
+/// Preamble longs for a reservoir union.
+pub const RESERVOIR_UNION_PREAMBLE_LONGS: u8 = 1;
+/// Preamble longs for an empty VarOpt sketch.
+pub const VAROPT_PREAMBLE_LONGS_EMPTY: u8 = 1;
+/// Preamble longs for a VarOpt sketch in warmup, with heavy items only.
+pub const VAROPT_PREAMBLE_LONGS_WARMUP: u8 = 3;
+/// Preamble longs for a VarOpt sketch with items in its reservoir.
+pub const VAROPT_PREAMBLE_LONGS_FULL: u8 = 4;
+/// Preamble longs for an empty EBPPS sketch.
+pub const EBPPS_PREAMBLE_LONGS_EMPTY: u8 = 1;
+/// Preamble longs for a non-empty EBPPS sketch.
+pub const EBPPS_PREAMBLE_LONGS_FULL: u8 = 5;
+/// Preamble longs for an empty VarOpt union.
+pub const VAROPT_UNION_PREAMBLE_LONGS_EMPTY: u8 = 1;
+/// Preamble longs for a non-empty VarOpt union.
+pub const VAROPT_UNION_PREAMBLE_LONGS_FULL: u8 = 4;
+
+/// Only the low 6 bits of the first byte hold the preamble longs; the upper 2 bits hold the
+/// log2 of the resize factor.
+pub const PREAMBLE_LONGS_MASK: u8 = 0x3F;
+/// Log2 of the resize factor written by Java, which is `ResizeFactor.X8`.
+pub const LG_RESIZE_FACTOR: u8 = 3;
+/// Bit offset of the resize factor in the first byte.
+pub const LG_RESIZE_FACTOR_SHIFT: u8 = 6;
+
+/// Empty flag mask.
+pub const FLAGS_IS_EMPTY: u8 = 1 << 2;
+/// Flag mask of an EBPPS sketch whose sample has a partial item.
+pub const FLAGS_HAS_PARTIAL_ITEM: u8 = 1 << 3;
+/// Flag mask of a VarOpt union gadget, whose image carries the marks of its heavy items.
+pub const FLAGS_IS_GADGET: u8 = 1 << 7;
+
+/// Trait for serializing and deserializing sampled items.
+pub trait SamplingItemValue: Sized {
+    /// Returns the size in bytes required to serialize the given item.
+    fn serialize_size(item: &Self) -> usize;
+    /// Serializes the item into the given byte buffer.
+    fn serialize_value(&self, bytes: &mut SketchBytes);
+    /// Deserializes an item from the given byte cursor.
+    fn deserialize_value(cursor: &mut SketchSlice<'_>) -> Result<Self, Error>;
+}
+
+impl SamplingItemValue for String {
+    fn serialize_size(item: &Self) -> usize {
+        size_of::<u32>() + item.len()
+    }
+
+    fn serialize_value(&self, bytes: &mut SketchBytes) {
+        let bs = self.as_bytes();
+        bytes.write_u32_le(bs.len() as u32);
+        bytes.write(bs);
+    }
+
+    fn deserialize_value(cursor: &mut SketchSlice<'_>) -> Result<Self, Error> {
+        let len = cursor.read_u32_le().map_err(|_| {
+            Error::insufficient_data("failed to read string item length".to_string())
+        })?;
+
+        let slice = cursor.read_bytes(len as usize).map_err(|_| {
+            Error::insufficient_data("failed to read string item bytes".to_string())
+        })?;
+
+        String::from_utf8(slice)
+            .map_err(|_| Error::deserial("invalid UTF-8 string payload".to_string()))
+    }
+}
+
+macro_rules! impl_primitive {
+    ($name:ty, $read:ident, $write:ident) => {
+        impl SamplingItemValue for $name {
+            fn serialize_size(_item: &Self) -> usize {
+                size_of::<$name>()
+            }
+
+            fn serialize_value(&self, bytes: &mut SketchBytes) {
+                bytes.$write(*self);
+            }
+
+            fn deserialize_value(cursor: &mut SketchSlice<'_>) -> Result<Self, Error> {
+                cursor.$read().map_err(|_| {
+                    Error::insufficient_data(
+                        concat!("failed to read ", stringify!($name), " item bytes").to_string(),
+                    )
+                })
+            }
+        }
+    };
+}
+
+impl_primitive!(i64, read_i64_le, write_i64_le);
+impl_primitive!(u64, read_u64_le, write_u64_le);
+impl_primitive!(f64, read_f64_le, write_f64_le);
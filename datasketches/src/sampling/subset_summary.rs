@@ -0,0 +1,65 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+/// Estimate of the total weight of the sampled items satisfying a predicate.
+///
+/// The true total lies between the lower and upper bounds with a confidence of roughly two
+/// standard deviations.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct SampleSubsetSummary {
+    lower_bound: f64,
+    estimate: f64,
+    upper_bound: f64,
+    total_sketch_weight: f64,
+}
+
+impl SampleSubsetSummary {
+    pub(super) fn new(
+        lower_bound: f64,
+        estimate: f64,
+        upper_bound: f64,
+        total_sketch_weight: f64,
+    ) -> Self {
+        Self {
+            lower_bound,
+            estimate,
+            upper_bound,
+            total_sketch_weight,
+        }
+    }
+
+    /// Returns the lower bound on the subset sum.
+    pub fn lower_bound(&self) -> f64 {
+        self.lower_bound
+    }
+
+    /// Returns the estimated subset sum.
+    pub fn estimate(&self) -> f64 {
+        self.estimate
+    }
+
+    /// Returns the upper bound on the subset sum.
+    pub fn upper_bound(&self) -> f64 {
+        self.upper_bound
+    }
+
+    /// Returns the total weight of all items the sketch has seen, the sum over an always-true
+    /// predicate.
+    pub fn total_sketch_weight(&self) -> f64 {
+        self.total_sketch_weight
+    }
+}
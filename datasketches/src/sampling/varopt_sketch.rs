@@ -0,0 +1,1027 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::random;
+use crate::error::Error;
+use crate::sampling::SampleSubsetSummary;
+use crate::sampling::bounds::pseudo_hypergeometric_lower_bound;
+use crate::sampling::bounds::pseudo_hypergeometric_upper_bound;
+use crate::sampling::serialization::FLAGS_IS_EMPTY;
+use crate::sampling::serialization::FLAGS_IS_GADGET;
+use crate::sampling::serialization::LG_RESIZE_FACTOR;
+use crate::sampling::serialization::LG_RESIZE_FACTOR_SHIFT;
+use crate::sampling::serialization::PREAMBLE_LONGS_MASK;
+use crate::sampling::serialization::SERIAL_VERSION;
+use crate::sampling::serialization::SamplingItemValue;
+use crate::sampling::serialization::VAROPT_PREAMBLE_LONGS_EMPTY;
+use crate::sampling::serialization::VAROPT_PREAMBLE_LONGS_FULL;
+use crate::sampling::serialization::VAROPT_PREAMBLE_LONGS_WARMUP;
+
+/// Variance optimal (VarOpt) sampling sketch for weighted items.
+///
+/// The sketch keeps a sample of at most `k` items, chosen so that subset sum estimates have the
+/// least possible average variance. Items heavier than the threshold `tau` are kept with their
+/// exact weights in a heavy region H. The remaining samples form a reservoir R, and each stands
+/// for `tau` units of weight, where `tau` is the total weight of R spread evenly over its items.
+///
+/// See the [module level documentation](super) for more.
+#[derive(Debug, Clone, PartialEq)]
+pub struct VarOptItemsSketch<T> {
+    k: u32,
+    n: u64,
+    // the heavy items form a min-heap by weight in [0, h), followed by the middle region M in
+    // [h, h + m), which is non-empty only during an update; once the sketch is full, a gap at
+    // slot h separates H from the reservoir in [h + 1, h + 1 + r)
+    h: usize,
+    m: usize,
+    r: usize,
+    total_weight_r: f64,
+    data: Vec<Option<T>>,
+    weights: Vec<f64>,
+    // only a union gadget marks items, namely those from the reservoir of an input sketch
+    marks: Option<Vec<bool>>,
+    num_marks_in_h: usize,
+}
+
+impl<T> VarOptItemsSketch<T> {
+    /// Creates a new sketch keeping at most `k` samples.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `k` is zero.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::VarOptItemsSketch;
+    /// let sketch = VarOptItemsSketch::<u64>::new(64);
+    /// assert_eq!(sketch.k(), 64);
+    /// assert!(sketch.is_empty());
+    /// ```
+    pub fn new(k: u32) -> Self {
+        assert!(k >= 1, "k must be at least 1, got {k}");
+        Self::with_marks(k, None)
+    }
+
+    /// Creates a sketch that records marks, for use as the gadget of a union.
+    pub(super) fn new_gadget(k: u32) -> Self {
+        Self::with_marks(k, Some(Vec::new()))
+    }
+
+    fn with_marks(k: u32, marks: Option<Vec<bool>>) -> Self {
+        let capacity = (k as usize + 1).min(1024);
+        Self {
+            k,
+            n: 0,
+            h: 0,
+            m: 0,
+            r: 0,
+            total_weight_r: 0.0,
+            data: Vec::with_capacity(capacity),
+            weights: Vec::with_capacity(capacity),
+            marks: marks.map(|_| Vec::with_capacity(capacity)),
+            num_marks_in_h: 0,
+        }
+    }
+
+    /// Updates the sketch with an item of the given weight.
+    ///
+    /// A pre-aggregated count can be passed as the weight: subset sum estimates then count the
+    /// item as often as the count says, while [`n`](Self::n) counts the update once.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `weight` is not positive and finite.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::VarOptItemsSketch;
+    /// let mut sketch = VarOptItemsSketch::new(4);
+    /// for i in 1..=100u64 {
+    ///     sketch.update(i, i as f64);
+    /// }
+    /// assert_eq!(sketch.n(), 100);
+    /// assert_eq!(sketch.num_samples(), 4);
+    /// ```
+    pub fn update(&mut self, item: T, weight: f64) {
+        assert!(
+            weight > 0.0 && weight.is_finite(),
+            "weight must be positive and finite, got {weight}"
+        );
+        self.update_with_mark(item, weight, false);
+    }
+
+    /// Returns the maximum number of samples kept by the sketch.
+    pub fn k(&self) -> u32 {
+        self.k
+    }
+
+    /// Returns the number of items the sketch has seen.
+    pub fn n(&self) -> u64 {
+        self.n
+    }
+
+    /// Returns the number of samples currently in the sketch, which is `min(n, k)`.
+    pub fn num_samples(&self) -> usize {
+        (self.h + self.r).min(self.k as usize)
+    }
+
+    /// Returns true if the sketch has not seen any items.
+    pub fn is_empty(&self) -> bool {
+        self.n == 0
+    }
+
+    /// Returns true if the sketch has seen more items than it can keep.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.r > 0
+    }
+
+    /// Returns the estimated size of the sketch in bytes
+    ///
+    /// Only the inline size of the samples is counted, not any heap memory they own.
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>()
+            + self.data.capacity() * size_of::<Option<T>>()
+            + self.weights.capacity() * size_of::<f64>()
+            + self.marks.as_ref().map_or(0, Vec::capacity)
+    }
+
+    /// Returns an iterator over the samples and their adjusted weights, in no particular order.
+    ///
+    /// Heavy items carry their own weight and reservoir items carry the threshold `tau`, so the
+    /// weights add up to the total weight of the items seen.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::VarOptItemsSketch;
+    /// let mut sketch = VarOptItemsSketch::new(2);
+    /// sketch.update("a", 1.0);
+    /// sketch.update("b", 2.0);
+    /// sketch.update("c", 100.0);
+    /// let total: f64 = sketch.iter().map(|(_, weight)| weight).sum();
+    /// assert_eq!(total, 103.0);
+    /// assert!(
+    ///     sketch
+    ///         .iter()
+    ///         .any(|(&item, weight)| item == "c" && weight == 100.0)
+    /// );
+    /// ```
+    pub fn iter(&self) -> impl Iterator<Item = (&T, f64)> {
+        let tau = self.tau();
+        let heavy = self.heavy_items();
+        let light = self.reservoir_items().map(move |item| (item, tau));
+        heavy.chain(light)
+    }
+
+    /// Estimates the total weight of the items seen that satisfy the predicate.
+    ///
+    /// Heavy items contribute their exact weight, so the bounds only reflect the uncertainty
+    /// about the reservoir.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::VarOptItemsSketch;
+    /// let mut sketch = VarOptItemsSketch::new(16);
+    /// for i in 0..10u64 {
+    ///     sketch.update(i, 2.0);
+    /// }
+    /// let summary = sketch.estimate_subset_sum(|&i| i < 5);
+    /// assert_eq!(summary.estimate(), 10.0);
+    /// assert_eq!(summary.total_sketch_weight(), 20.0);
+    /// ```
+    pub fn estimate_subset_sum<P>(&self, mut predicate: P) -> SampleSubsetSummary
+    where
+        P: FnMut(&T) -> bool,
+    {
+        if self.is_empty() {
+            return SampleSubsetSummary::new(0.0, 0.0, 0.0, 0.0);
+        }
+
+        let mut total_weight_h = 0.0;
+        let mut matching_weight_h = 0.0;
+        for (item, weight) in self.heavy_items() {
+            total_weight_h += weight;
+            if predicate(item) {
+                matching_weight_h += weight;
+            }
+        }
+        // with heavy items only, the answer is exact
+        if self.r == 0 {
+            return SampleSubsetSummary::new(
+                matching_weight_h,
+                matching_weight_h,
+                matching_weight_h,
+                total_weight_h,
+            );
+        }
+
+        let num_sampled = self.n - self.h as u64;
+        let sampling_rate = self.r as f64 / num_sampled as f64;
+        let r = self.r as u64;
+        let matching_r = self
+            .reservoir_items()
+            .filter(|item| predicate(item))
+            .count() as u64;
+        let lower_fraction = pseudo_hypergeometric_lower_bound(r, matching_r, sampling_rate);
+        let fraction = matching_r as f64 / r as f64;
+        let upper_fraction = pseudo_hypergeometric_upper_bound(r, matching_r, sampling_rate);
+        SampleSubsetSummary::new(
+            matching_weight_h + self.total_weight_r * lower_fraction,
+            matching_weight_h + self.total_weight_r * fraction,
+            matching_weight_h + self.total_weight_r * upper_fraction,
+            total_weight_h + self.total_weight_r,
+        )
+    }
+
+    /// Resets the sketch to its empty state, keeping `k`.
+    pub fn reset(&mut self) {
+        self.n = 0;
+        self.h = 0;
+        self.m = 0;
+        self.r = 0;
+        self.total_weight_r = 0.0;
+        self.data.clear();
+        self.weights.clear();
+        if let Some(marks) = &mut self.marks {
+            marks.clear();
+        }
+        self.num_marks_in_h = 0;
+    }
+
+    pub(super) fn update_with_mark(&mut self, item: T, weight: f64, mark: bool) {
+        self.n += 1;
+        if self.r == 0 {
+            self.update_warmup_phase(item, weight, mark);
+            return;
+        }
+
+        // tau if the deletion candidates turn out to be R plus the new item
+        let hypothetical_tau = (weight + self.total_weight_r) / self.r as f64;
+        // is it the new item's turn to be considered for the reservoir, and is it light enough?
+        let is_lightest = self.h == 0 || weight <= self.peek_min();
+        let is_light = weight < hypothetical_tau;
+        if is_lightest && is_light {
+            self.update_light(item, weight, mark);
+        } else if self.r == 1 {
+            self.update_heavy_r_eq_1(item, weight, mark);
+        } else {
+            self.update_heavy_general(item, weight, mark);
+        }
+    }
+
+    /// Returns the heavy items with their weights.
+    pub(super) fn heavy_items(&self) -> impl Iterator<Item = (&T, f64)> {
+        self.data[..self.h]
+            .iter()
+            .flatten()
+            .zip(self.weights[..self.h].iter().copied())
+    }
+
+    /// Returns the heavy items with their weights and marks.
+    pub(super) fn marked_heavy_items(&self) -> impl Iterator<Item = (&T, f64, bool)> {
+        self.heavy_items()
+            .enumerate()
+            .map(|(i, (item, weight))| (item, weight, self.is_marked(i)))
+    }
+
+    /// Returns the reservoir items, whose weight is `tau` each.
+    pub(super) fn reservoir_items(&self) -> impl Iterator<Item = &T> {
+        self.data.iter().skip(self.h + 1).take(self.r).flatten()
+    }
+
+    /// Returns the threshold weight of the reservoir items, or NaN outside estimation mode.
+    pub(super) fn tau(&self) -> f64 {
+        if self.r == 0 {
+            f64::NAN
+        } else {
+            self.total_weight_r / self.r as f64
+        }
+    }
+
+    pub(super) fn num_heavy(&self) -> usize {
+        self.h
+    }
+
+    pub(super) fn num_reservoir(&self) -> usize {
+        self.r
+    }
+
+    pub(super) fn total_weight_r(&self) -> f64 {
+        self.total_weight_r
+    }
+
+    pub(super) fn has_marks(&self) -> bool {
+        self.marks.is_some()
+    }
+
+    pub(super) fn num_marks_in_h(&self) -> usize {
+        self.num_marks_in_h
+    }
+
+    pub(super) fn set_n(&mut self, n: u64) {
+        self.n = n;
+    }
+
+    pub(super) fn set_k(&mut self, k: u32) {
+        self.k = k;
+    }
+
+    pub(super) fn strip_marks(&mut self) {
+        self.marks = None;
+        self.num_marks_in_h = 0;
+    }
+
+    /// Builds a sketch from the regions assembled by a union. `data` and `weights` hold
+    /// `k + 1` slots laid out as in a full sketch, except that H need not be a heap yet.
+    pub(super) fn from_union_result(
+        data: Vec<Option<T>>,
+        weights: Vec<f64>,
+        n: u64,
+        h: usize,
+        r: usize,
+        total_weight_r: f64,
+    ) -> Self {
+        let k = data.len() - 1;
+        debug_assert_eq!(h + r, k);
+        let mut sketch = Self {
+            k: k as u32,
+            n,
+            h,
+            m: 0,
+            r,
+            total_weight_r,
+            data,
+            weights,
+            marks: None,
+            num_marks_in_h: 0,
+        };
+        sketch.convert_to_heap();
+        sketch
+    }
+
+    /// Decreases k by one, moving a sample into the reservoir or dropping one from it.
+    pub(super) fn decrease_k_by_1(&mut self) {
+        assert!(self.k > 1, "cannot decrease k below 1 in union");
+        if self.r == 0 {
+            // exact mode, so only a full sketch needs to change
+            self.k -= 1;
+            if self.h > self.k as usize {
+                self.transition_from_warmup();
+            }
+        } else if self.h > 0 {
+            // pull an item out of H, which is allowed because it is heavy, decrease k, and
+            // re-insert the item; first slide R to the left to fill the gap
+            let old_gap = self.h;
+            let old_final_r = self.h + self.r;
+            self.swap_values(old_final_r, old_gap);
+
+            // taking the rightmost heap item preserves the heap and restores the gap
+            let pulled = self.h - 1;
+            let item = self.data[pulled].take().expect("heavy items are present");
+            let weight = self.weights[pulled];
+            let mark = self.is_marked(pulled);
+            if mark {
+                self.num_marks_in_h -= 1;
+            }
+            self.weights[pulled] = -1.0;
+
+            self.h -= 1;
+            self.k -= 1;
+            self.n -= 1; // re-incremented by the update
+            self.truncate_to_k();
+            self.update_with_mark(item, weight, mark);
+        } else {
+            // pure reservoir mode, so eject a random sample
+            let delete_slot = 1 + random_index(self.r);
+            let rightmost = self.r;
+            self.swap_values(delete_slot, rightmost);
+            self.weights[rightmost] = -1.0;
+            self.k -= 1;
+            self.r -= 1;
+            self.truncate_to_k();
+        }
+    }
+
+    fn truncate_to_k(&mut self) {
+        let len = self.k as usize + 1;
+        self.data.truncate(len);
+        self.weights.truncate(len);
+        if let Some(marks) = &mut self.marks {
+            marks.truncate(len);
+        }
+    }
+
+    fn update_warmup_phase(&mut self, item: T, weight: f64, mark: bool) {
+        debug_assert_eq!(self.data.len(), self.h);
+        self.data.push(Some(item));
+        self.weights.push(weight);
+        if let Some(marks) = &mut self.marks {
+            marks.push(mark);
+        }
+        self.h += 1;
+        if mark {
+            self.num_marks_in_h += 1;
+        }
+
+        if self.h > self.k as usize {
+            self.transition_from_warmup();
+        }
+    }
+
+    fn transition_from_warmup(&mut self) {
+        // move the two lightest items from H to M, although the lighter one belongs in R
+        self.convert_to_heap();
+        self.pop_min_to_m_region();
+        self.pop_min_to_m_region();
+        self.m -= 1;
+        self.r += 1;
+
+        let k = self.k as usize;
+        debug_assert_eq!((self.h, self.m, self.r), (k - 1, 1, 1));
+        self.total_weight_r = self.weights[k];
+        self.weights[k] = -1.0;
+
+        // any two items can be downsampled to one, so they are a valid initial candidate set
+        self.grow_candidate_set(self.weights[k - 1] + self.total_weight_r, 2);
+    }
+
+    fn update_light(&mut self, item: T, weight: f64, mark: bool) {
+        debug_assert_eq!(self.h + self.r, self.k as usize);
+        // the gap becomes the M region
+        let m_slot = self.h;
+        self.data[m_slot] = Some(item);
+        self.weights[m_slot] = weight;
+        if let Some(marks) = &mut self.marks {
+            marks[m_slot] = mark;
+        }
+        self.m += 1;
+        self.grow_candidate_set(self.total_weight_r + weight, self.r + 1);
+    }
+
+    fn update_heavy_general(&mut self, item: T, weight: f64, mark: bool) {
+        debug_assert!(self.m == 0 && self.r >= 2);
+        // put the item into H, although it may come back out momentarily
+        self.push(item, weight, mark);
+        self.grow_candidate_set(self.total_weight_r, self.r);
+    }
+
+    fn update_heavy_r_eq_1(&mut self, item: T, weight: f64, mark: bool) {
+        debug_assert!(self.m == 0 && self.r == 1);
+        self.push(item, weight, mark);
+        self.pop_min_to_m_region();
+
+        // any two items can be downsampled to one, so the lightest two are a valid start; with
+        // one item in R, the slot before it is M
+        let m_slot = self.k as usize - 1;
+        self.grow_candidate_set(self.weights[m_slot] + self.total_weight_r, 2);
+    }
+
+    fn grow_candidate_set(&mut self, mut weight_cands: f64, mut num_cands: usize) {
+        debug_assert_eq!(num_cands, self.m + self.r);
+        while self.h > 0 {
+            let next_weight = self.peek_min();
+            let next_total_weight = weight_cands + next_weight;
+            // the next prospect must be strictly light, with the denominator multiplied through
+            if next_weight * (num_cands as f64) < next_total_weight {
+                weight_cands = next_total_weight;
+                num_cands += 1;
+                self.pop_min_to_m_region();
+            } else {
+                break;
+            }
+        }
+        self.downsample_candidate_set(weight_cands, num_cands);
+    }
+
+    fn pop_min_to_m_region(&mut self) {
+        debug_assert!(self.h > 0);
+        if self.h > 1 {
+            self.swap_values(0, self.h - 1);
+        }
+        self.m += 1;
+        self.h -= 1;
+        if self.h > 0 {
+            self.restore_towards_leaves(0);
+        }
+
+        if self.is_marked(self.h) {
+            self.num_marks_in_h -= 1;
+        }
+    }
+
+    fn downsample_candidate_set(&mut self, weight_cands: f64, num_cands: usize) {
+        debug_assert_eq!(self.h + num_cands, self.k as usize + 1);
+        // choose before anything is overwritten
+        let delete_slot = self.choose_delete_slot(weight_cands, num_cands);
+
+        // the items of M move into R, whose weights are implied by tau
+        let leftmost_cand_slot = self.h;
+        for weight in &mut self.weights[leftmost_cand_slot..leftmost_cand_slot + self.m] {
+            *weight = -1.0;
+        }
+
+        // the deleted slot takes the leftmost candidate, which leaves the gap behind
+        let moved = self.data[leftmost_cand_slot].take();
+        if delete_slot != leftmost_cand_slot {
+            self.data[delete_slot] = moved;
+        }
+
+        self.m = 0;
+        self.r = num_cands - 1;
+        self.total_weight_r = weight_cands;
+    }
+
+    fn choose_delete_slot(&self, weight_cands: f64, num_cands: usize) -> usize {
+        debug_assert!(self.r > 0);
+        match self.m {
+            // a really heavy item was inserted
+            0 => self.pick_random_slot_in_r(),
+            1 => {
+                // keep the item in M with probability (num_cands - 1) * weight_m / weight_cands
+                let weight_m = self.weights[self.h];
+                if weight_cands * next_f64_excluding_zero() < (num_cands - 1) as f64 * weight_m {
+                    self.pick_random_slot_in_r()
+                } else {
+                    self.h
+                }
+            }
+            _ => {
+                let delete_slot = self.choose_weighted_delete_slot(weight_cands, num_cands);
+                if delete_slot == self.h + self.m {
+                    self.pick_random_slot_in_r()
+                } else {
+                    delete_slot
+                }
+            }
+        }
+    }
+
+    /// Picks a slot of M with probability proportional to how much lighter it is than tau, or
+    /// returns the first slot of R.
+    fn choose_weighted_delete_slot(&self, weight_cands: f64, num_cands: usize) -> usize {
+        let offset = self.h;
+        let final_m = offset + self.m - 1;
+        let num_to_keep = (num_cands - 1) as f64;
+
+        let mut left_subtotal = 0.0;
+        let mut right_subtotal = -weight_cands * next_f64_excluding_zero();
+        for i in offset..=final_m {
+            left_subtotal += num_to_keep * self.weights[i];
+            right_subtotal += weight_cands;
+            if left_subtotal < right_subtotal {
+                return i;
+            }
+        }
+        final_m + 1
+    }
+
+    fn pick_random_slot_in_r(&self) -> usize {
+        let offset = self.h + self.m;
+        if self.r == 1 {
+            offset
+        } else {
+            offset + random_index(self.r)
+        }
+    }
+
+    fn peek_min(&self) -> f64 {
+        debug_assert!(self.h > 0);
+        self.weights[0]
+    }
+
+    fn is_marked(&self, slot: usize) -> bool {
+        self.marks.as_ref().is_some_and(|marks| marks[slot])
+    }
+
+    fn push(&mut self, item: T, weight: f64, mark: bool) {
+        let slot = self.h;
+        self.data[slot] = Some(item);
+        self.weights[slot] = weight;
+        if let Some(marks) = &mut self.marks {
+            marks[slot] = mark;
+        }
+        if mark {
+            self.num_marks_in_h += 1;
+        }
+        self.h += 1;
+        self.restore_towards_root(slot);
+    }
+
+    fn convert_to_heap(&mut self) {
+        if self.h < 2 {
+            return;
+        }
+        let last_non_leaf = self.h / 2 - 1;
+        for slot in (0..=last_non_leaf).rev() {
+            self.restore_towards_leaves(slot);
+        }
+    }
+
+    fn restore_towards_leaves(&mut self, mut slot: usize) {
+        let last_slot = self.h - 1;
+        let mut child = 2 * slot + 1;
+        while child <= last_slot {
+            // switch to the other child if it is both valid and smaller
+            if child < last_slot && self.weights[child + 1] < self.weights[child] {
+                child += 1;
+            }
+            if self.weights[slot] <= self.weights[child] {
+                break;
+            }
+            self.swap_values(slot, child);
+            slot = child;
+            child = 2 * slot + 1;
+        }
+    }
+
+    fn restore_towards_root(&mut self, mut slot: usize) {
+        while slot > 0 {
+            let parent = (slot - 1) / 2;
+            if self.weights[slot] >= self.weights[parent] {
+                break;
+            }
+            self.swap_values(slot, parent);
+            slot = parent;
+        }
+    }
+
+    fn swap_values(&mut self, a: usize, b: usize) {
+        self.data.swap(a, b);
+        self.weights.swap(a, b);
+        if let Some(marks) = &mut self.marks {
+            marks.swap(a, b);
+        }
+    }
+}
+
+impl<T: SamplingItemValue> VarOptItemsSketch<T> {
+    /// Serializes the sketch in the format of Java's `VarOptItemsSketch`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::VarOptItemsSketch;
+    /// let mut sketch = VarOptItemsSketch::new(8);
+    /// sketch.update("apple".to_string(), 2.5);
+    /// let bytes = sketch.serialize();
+    /// let decoded = VarOptItemsSketch::<String>::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.n(), 1);
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces, as reported by
+    /// [`SamplingItemValue::serialize_size`] for the sampled items.
+    pub fn serialized_size_bytes(&self) -> usize {
+        let preamble_longs = if self.is_empty() {
+            VAROPT_PREAMBLE_LONGS_EMPTY
+        } else if self.r == 0 {
+            VAROPT_PREAMBLE_LONGS_WARMUP
+        } else {
+            VAROPT_PREAMBLE_LONGS_FULL
+        };
+        let num_mark_bytes = if self.marks.is_some() {
+            self.h.div_ceil(8)
+        } else {
+            0
+        };
+        let items_size: usize = self
+            .heavy_items()
+            .map(|(item, _)| T::serialize_size(item))
+            .sum::<usize>()
+            + self.reservoir_items().map(T::serialize_size).sum::<usize>();
+        preamble_longs as usize * 8 + self.h * size_of::<f64>() + num_mark_bytes + items_size
+    }
+
+    /// Serializes the sketch into `buf` in the format written by
+    /// [`serialize`](Self::serialize), returning the number of bytes written.
+    ///
+    /// Returns an error if `buf` is too short for the image.
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Streams the sketch to `writer` in the format written by [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    pub(super) fn write_image(&self, bytes: &mut SketchBytes) {
+        let preamble_longs = if self.is_empty() {
+            VAROPT_PREAMBLE_LONGS_EMPTY
+        } else if self.r == 0 {
+            VAROPT_PREAMBLE_LONGS_WARMUP
+        } else {
+            VAROPT_PREAMBLE_LONGS_FULL
+        };
+
+        bytes.write_u8(preamble_longs | (LG_RESIZE_FACTOR << LG_RESIZE_FACTOR_SHIFT));
+        bytes.write_u8(SERIAL_VERSION);
+        bytes.write_u8(Family::VAROPT.id);
+        bytes.write_u8({
+            let mut flags = 0;
+            if self.is_empty() {
+                flags |= FLAGS_IS_EMPTY;
+            }
+            if self.marks.is_some() {
+                flags |= FLAGS_IS_GADGET;
+            }
+            flags
+        });
+        bytes.write_u32_le(self.k);
+        if self.is_empty() {
+            return;
+        }
+
+        bytes.write_u64_le(self.n);
+        bytes.write_u32_le(self.h as u32);
+        bytes.write_u32_le(self.r as u32);
+        if self.r > 0 {
+            bytes.write_f64_le(self.total_weight_r);
+        }
+        for &weight in &self.weights[..self.h] {
+            bytes.write_f64_le(weight);
+        }
+        if let Some(marks) = &self.marks {
+            for chunk in marks[..self.h].chunks(8) {
+                let byte = chunk
+                    .iter()
+                    .enumerate()
+                    .fold(0u8, |byte, (i, &mark)| byte | ((mark as u8) << i));
+                bytes.write_u8(byte);
+            }
+        }
+        for (item, _) in self.heavy_items() {
+            item.serialize_value(bytes);
+        }
+        for item in self.reservoir_items() {
+            item.serialize_value(bytes);
+        }
+    }
+
+    /// Deserializes a sketch from bytes written by [`Self::serialize`] or by Java's
+    /// `VarOptItemsSketch`.
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a sketch written by [`write_to`](Self::write_to) from `reader`, consuming exactly
+    /// the bytes of one image.
+    ///
+    /// Fails like [`deserialize`](Self::deserialize); a failing `reader` is reported as
+    /// insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    pub(super) fn read_image(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        let preamble_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?
+            & PREAMBLE_LONGS_MASK;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let k = cursor.read_u32_le().map_err(insufficient_data("k"))?;
+
+        Family::VAROPT.validate_id(family_id)?;
+        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        if k == 0 {
+            return Err(Error::deserial("k must be at least 1, got 0"));
+        }
+        let is_empty = (flags & FLAGS_IS_EMPTY) != 0;
+        let is_gadget = (flags & FLAGS_IS_GADGET) != 0;
+        let marks = is_gadget.then(Vec::new);
+        if is_empty {
+            ensure_preamble_longs_in(&[VAROPT_PREAMBLE_LONGS_EMPTY], preamble_longs)?;
+            return Ok(Self::with_marks(k, marks));
+        }
+        ensure_preamble_longs_in(
+            &[VAROPT_PREAMBLE_LONGS_WARMUP, VAROPT_PREAMBLE_LONGS_FULL],
+            preamble_longs,
+        )?;
+
+        let n = cursor.read_u64_le().map_err(insufficient_data("n"))?;
+        let h = cursor.read_u32_le().map_err(insufficient_data("h_count"))? as usize;
+        let r = cursor.read_u32_le().map_err(insufficient_data("r_count"))? as usize;
+        let k_slots = k as usize;
+        let total_weight_r = if preamble_longs == VAROPT_PREAMBLE_LONGS_FULL {
+            if r == 0 || h + r != k_slots {
+                return Err(Error::deserial(format!(
+                    "a full sketch must have h + r = k with r > 0, got h={h}, r={r}, k={k}"
+                )));
+            }
+            let total_weight_r = cursor
+                .read_f64_le()
+                .map_err(insufficient_data("total_weight_r"))?;
+            if !total_weight_r.is_finite() || total_weight_r <= 0.0 {
+                return Err(Error::deserial(format!(
+                    "total weight of the reservoir must be positive, got {total_weight_r}"
+                )));
+            }
+            total_weight_r
+        } else {
+            if r != 0 || h > k_slots {
+                return Err(Error::deserial(format!(
+                    "a warmup sketch must have r = 0 and h <= k, got h={h}, r={r}, k={k}"
+                )));
+            }
+            0.0
+        };
+        if n < (h + r) as u64 {
+            return Err(Error::deserial(format!(
+                "n={n} is smaller than the number of samples {}",
+                h + r
+            )));
+        }
+
+        let mut weights = Vec::with_capacity(cursor.capacity_hint(h, 8));
+        for _ in 0..h {
+            let weight = cursor.read_f64_le().map_err(insufficient_data("weights"))?;
+            if !weight.is_finite() || weight <= 0.0 {
+                return Err(Error::deserial(format!(
+                    "item weights must be positive, got {weight}"
+                )));
+            }
+            weights.push(weight);
+        }
+        let mut marks = marks;
+        let mut num_marks_in_h = 0;
+        if let Some(marks) = &mut marks {
+            let mut byte = 0;
+            for i in 0..h {
+                if i % 8 == 0 {
+                    byte = cursor.read_u8().map_err(insufficient_data("marks"))?;
+                }
+                let mark = (byte >> (i % 8)) & 1 != 0;
+                num_marks_in_h += mark as usize;
+                marks.push(mark);
+            }
+            if h % 8 != 0 && byte >> (h % 8) != 0 {
+                return Err(Error::deserial(format!(
+                    "mark bits set beyond the {h} heavy items"
+                )));
+            }
+        }
+
+        let num_slots = if r > 0 { h + 1 + r } else { h };
+        let mut data = Vec::with_capacity(cursor.capacity_hint(num_slots, 1));
+        for _ in 0..h {
+            data.push(Some(T::deserialize_value(&mut cursor)?));
+        }
+        if r > 0 {
+            // the gap and the reservoir
+            data.push(None);
+            weights.resize(num_slots, -1.0);
+            if let Some(marks) = &mut marks {
+                marks.resize(num_slots, false);
+            }
+            for _ in 0..r {
+                data.push(Some(T::deserialize_value(&mut cursor)?));
+            }
+        }
+
+        let mut sketch = Self {
+            k,
+            n,
+            h,
+            m: 0,
+            r,
+            total_weight_r,
+            data,
+            weights,
+            marks,
+            num_marks_in_h,
+        };
+        if r > 0 {
+            // H is a heap outside warmup; rebuilding it keeps a corrupt image from breaking the
+            // update logic, and leaves a valid one untouched
+            sketch.convert_to_heap();
+        }
+        Ok(sketch)
+    }
+}
+
+/// Returns a uniformly distributed index in `[0, n)`.
+fn random_index(n: usize) -> usize {
+    (n as f64 * random::next_f64()) as usize
+}
+
+fn next_f64_excluding_zero() -> f64 {
+    loop {
+        let x = random::next_f64();
+        if x != 0.0 {
+            return x;
+        }
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!([T: SamplingItemValue] VarOptItemsSketch<T>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([T: SamplingItemValue] VarOptItemsSketch<T>);
+impl_fingerprint_via_image!([T: SamplingItemValue] VarOptItemsSketch<T>);
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn assert_consistent<T>(sketch: &VarOptItemsSketch<T>) {
+        assert_eq!(sketch.m, 0);
+        let heavy = &sketch.weights[..sketch.h];
+        if sketch.r > 0 {
+            // H only becomes a heap when the sketch leaves warmup
+            for slot in 1..heavy.len() {
+                assert!(heavy[(slot - 1) / 2] <= heavy[slot], "heap order at {slot}");
+            }
+            assert_eq!(sketch.data.len(), sketch.k as usize + 1);
+            assert_eq!(sketch.h + sketch.r, sketch.k as usize);
+            assert!(sketch.data[sketch.h].is_none());
+            // heavy items are never lighter than tau
+            assert!(heavy.iter().all(|&weight| weight >= sketch.tau()));
+        } else {
+            assert_eq!(sketch.data.len(), sketch.h);
+        }
+        assert!(sketch.data.iter().filter(|item| item.is_none()).count() <= 1);
+    }
+
+    #[test]
+    fn test_regions_stay_consistent() {
+        let mut sketch = VarOptItemsSketch::new(16);
+        for i in 0..2000u64 {
+            // weights spanning several orders of magnitude exercise every update path
+            let weight = ((i * 7919) % 1000 + 1) as f64 * if i % 50 == 0 { 1e6 } else { 1.0 };
+            sketch.update(i, weight);
+            assert_consistent(&sketch);
+        }
+    }
+
+    #[test]
+    fn test_total_weight_is_preserved() {
+        let mut sketch = VarOptItemsSketch::new(10);
+        let mut total = 0.0;
+        for i in 1..=1000u64 {
+            let weight = (i % 17 + 1) as f64;
+            total += weight;
+            sketch.update(i, weight);
+        }
+        let sum: f64 = sketch.iter().map(|(_, weight)| weight).sum();
+        assert!(
+            (sum - total).abs() < 1e-9 * total,
+            "sum={sum}, total={total}"
+        );
+    }
+
+    #[test]
+    fn test_decrease_k() {
+        let mut sketch = VarOptItemsSketch::new_gadget(8);
+        for i in 0..100u64 {
+            sketch.update_with_mark(i, (i % 3 + 1) as f64, i % 2 == 0);
+        }
+        while sketch.k() > 1 {
+            sketch.decrease_k_by_1();
+            assert_consistent(&sketch);
+            assert_eq!(sketch.n(), 100);
+            assert_eq!(sketch.num_samples(), sketch.k() as usize);
+        }
+    }
+}
@@ -0,0 +1,485 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::error::Error;
+use crate::sampling::ReservoirItemsSketch;
+use crate::sampling::VarOptItemsSketch;
+use crate::sampling::serialization::FLAGS_IS_EMPTY;
+use crate::sampling::serialization::PREAMBLE_LONGS_MASK;
+use crate::sampling::serialization::SERIAL_VERSION;
+use crate::sampling::serialization::SamplingItemValue;
+use crate::sampling::serialization::VAROPT_UNION_PREAMBLE_LONGS_EMPTY;
+use crate::sampling::serialization::VAROPT_UNION_PREAMBLE_LONGS_FULL;
+
+/// Union of VarOpt sampling sketches.
+///
+/// The union feeds the samples of its inputs into a gadget sketch with at most `max_k` samples,
+/// weighting reservoir items with the `tau` of their sketch and marking them. Marked items are
+/// not truly heavy, so when the result is requested they are pushed back into the reservoir,
+/// which may leave the result with fewer than `max_k` samples.
+#[derive(Debug, Clone, PartialEq)]
+pub struct VarOptUnion<T> {
+    max_k: u32,
+    n: u64,
+    // the largest tau of any input, as the total weight and the number of items of the input
+    // reservoirs sharing it; the denominator is zero until an estimation mode input is merged
+    outer_tau_numer: f64,
+    outer_tau_denom: u64,
+    gadget: VarOptItemsSketch<T>,
+}
+
+impl<T> VarOptUnion<T> {
+    /// Creates a new union producing sketches with at most `max_k` samples.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `max_k` is zero.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::VarOptUnion;
+    /// let union = VarOptUnion::<u64>::new(64);
+    /// assert_eq!(union.max_k(), 64);
+    /// assert!(union.is_empty());
+    /// ```
+    pub fn new(max_k: u32) -> Self {
+        assert!(max_k >= 1, "max_k must be at least 1, got {max_k}");
+        Self {
+            max_k,
+            n: 0,
+            outer_tau_numer: 0.0,
+            outer_tau_denom: 0,
+            gadget: VarOptItemsSketch::new_gadget(max_k),
+        }
+    }
+
+    /// Returns the maximum number of samples of the union's result.
+    pub fn max_k(&self) -> u32 {
+        self.max_k
+    }
+
+    /// Returns the total number of items seen by the input sketches.
+    pub fn n(&self) -> u64 {
+        self.n
+    }
+
+    /// Returns true if the union has not seen any items.
+    pub fn is_empty(&self) -> bool {
+        self.n == 0
+    }
+
+    /// Resets the union to its empty state, keeping `max_k`.
+    pub fn reset(&mut self) {
+        self.n = 0;
+        self.outer_tau_numer = 0.0;
+        self.outer_tau_denom = 0;
+        self.gadget.reset();
+    }
+
+    fn outer_tau(&self) -> f64 {
+        if self.outer_tau_denom == 0 {
+            0.0
+        } else {
+            self.outer_tau_numer / self.outer_tau_denom as f64
+        }
+    }
+
+    /// Adopts the tau of an input reservoir if it is at least as large as the current one.
+    fn resolve_tau(&mut self, total_weight_r: f64, num_r: u64) {
+        let tau = total_weight_r / num_r as f64;
+        let outer_tau = self.outer_tau();
+        if self.outer_tau_denom == 0 || tau > outer_tau {
+            self.outer_tau_numer = total_weight_r;
+            self.outer_tau_denom = num_r;
+        } else if tau == outer_tau {
+            // an imperfect equality test is benign in either direction
+            self.outer_tau_numer += total_weight_r;
+            self.outer_tau_denom += num_r;
+        }
+    }
+}
+
+impl<T: Clone> VarOptUnion<T> {
+    /// Updates the union with a VarOpt sketch.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::VarOptItemsSketch;
+    /// # use datasketches::sampling::VarOptUnion;
+    /// let mut left = VarOptItemsSketch::new(16);
+    /// let mut right = VarOptItemsSketch::new(16);
+    /// for i in 0..100u64 {
+    ///     left.update(i, 1.0);
+    ///     right.update(i + 100, 1.0);
+    /// }
+    ///
+    /// let mut union = VarOptUnion::new(16);
+    /// union.update(&left);
+    /// union.update(&right);
+    /// let result = union.to_sketch();
+    /// assert_eq!(result.n(), 200);
+    /// assert!(result.num_samples() <= 16);
+    /// ```
+    pub fn update(&mut self, sketch: &VarOptItemsSketch<T>) {
+        if sketch.is_empty() {
+            return;
+        }
+        self.n = self.n.saturating_add(sketch.n());
+
+        for (item, weight) in sketch.heavy_items() {
+            self.gadget.update_with_mark(item.clone(), weight, false);
+        }
+
+        let num_r = sketch.num_reservoir();
+        if num_r == 0 {
+            return;
+        }
+        // the last item absorbs the rounding error, so the weights add up to the reservoir total
+        let tau = sketch.tau();
+        let mut cumulative_weight = 0.0;
+        for (i, item) in sketch.reservoir_items().enumerate() {
+            let weight = if i + 1 == num_r {
+                sketch.total_weight_r() - cumulative_weight
+            } else {
+                tau
+            };
+            cumulative_weight += weight;
+            self.gadget.update_with_mark(item.clone(), weight, true);
+        }
+        self.resolve_tau(sketch.total_weight_r(), num_r as u64);
+    }
+
+    /// Updates the union with a reservoir sketch, whose samples all weigh `n / k`.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::sampling::ReservoirItemsSketch;
+    /// # use datasketches::sampling::VarOptUnion;
+    /// let mut sketch = ReservoirItemsSketch::new(8);
+    /// for i in 0..100u64 {
+    ///     sketch.update(i);
+    /// }
+    ///
+    /// let mut union = VarOptUnion::new(8);
+    /// union.update_reservoir(&sketch);
+    /// let result = union.to_sketch();
+    /// assert_eq!(result.n(), 100);
+    /// let total: f64 = result.iter().map(|(_, weight)| weight).sum();
+    /// assert!((total - 100.0).abs() < 1e-9);
+    /// ```
+    pub fn update_reservoir(&mut self, sketch: &ReservoirItemsSketch<T>) {
+        if sketch.is_empty() {
+            return;
+        }
+        self.n = self.n.saturating_add(sketch.n());
+
+        if !sketch.is_estimation_mode() {
+            for item in sketch.iter() {
+                self.gadget.update_with_mark(item.clone(), 1.0, false);
+            }
+            return;
+        }
+
+        let tau = sketch.implicit_sample_weight();
+        let num_samples = sketch.num_samples();
+        let mut cumulative_weight = 0.0;
+        for (i, item) in sketch.iter().enumerate() {
+            let weight = if i + 1 == num_samples {
+                sketch.n() as f64 - cumulative_weight
+            } else {
+                tau
+            };
+            cumulative_weight += weight;
+            self.gadget.update_with_mark(item.clone(), weight, true);
+        }
+        self.resolve_tau(sketch.n() as f64, num_samples as u64);
+    }
+
+    /// Returns the union result as a sketch.
+    pub fn to_sketch(&self) -> VarOptItemsSketch<T> {
+        if self.gadget.num_marks_in_h() == 0 {
+            // without marked items in H the gadget is already a valid sample
+            let mut result = self.gadget.clone();
+            result.strip_marks();
+            result.set_n(self.n);
+            return result;
+        }
+
+        // the marked items in H must be absorbed into the reservoir, which puts the result in
+        // estimation mode
+        if self.is_pseudo_exact() {
+            self.move_marked_items_to_reservoir()
+        } else {
+            self.migrate_marked_items_by_decreasing_k()
+        }
+    }
+
+    /// Detects a gadget with marked items but no reservoir whose marks all came from input
+    /// reservoirs with the same tau, so the marked items can form the result's reservoir as is.
+    fn is_pseudo_exact(&self) -> bool {
+        let gadget = &self.gadget;
+        if gadget.num_reservoir() != 0 || gadget.num_marks_in_h() as u64 != self.outer_tau_denom {
+            return false;
+        }
+        // unmarked items in H must not be lighter than tau; outside estimation mode the
+        // gadget's tau is NaN, so the comparison never holds
+        let tau = gadget.tau();
+        !gadget
+            .marked_heavy_items()
+            .any(|(_, weight, mark)| !mark && weight < tau)
+    }
+
+    fn move_marked_items_to_reservoir(&self) -> VarOptItemsSketch<T> {
+        let gadget = &self.gadget;
+        let result_k = gadget.num_heavy() + gadget.num_reservoir();
+        let mut data = vec![None; result_k + 1];
+        let mut weights = vec![-1.0; result_k + 1];
+
+        // fill R from the back, and H from the front, leaving the gap in between
+        let mut num_h = 0;
+        let mut num_r = 0;
+        let mut next_r_slot = result_k;
+        for item in gadget.reservoir_items() {
+            data[next_r_slot] = Some(item.clone());
+            num_r += 1;
+            next_r_slot -= 1;
+        }
+        let mut transferred_weight = 0.0;
+        for (item, weight, mark) in gadget.marked_heavy_items() {
+            if mark {
+                data[next_r_slot] = Some(item.clone());
+                transferred_weight += weight;
+                num_r += 1;
+                next_r_slot -= 1;
+            } else {
+                data[num_h] = Some(item.clone());
+                weights[num_h] = weight;
+                num_h += 1;
+            }
+        }
+        debug_assert_eq!(num_h + num_r, result_k);
+
+        let total_weight_r = gadget.total_weight_r() + transferred_weight;
+        VarOptItemsSketch::from_union_result(data, weights, self.n, num_h, num_r, total_weight_r)
+    }
+
+    fn migrate_marked_items_by_decreasing_k(&self) -> VarOptItemsSketch<T> {
+        let mut result = self.gadget.clone();
+        result.set_n(self.n);
+
+        // a pseudo-exact gadget that is not full shrinks k to make it full
+        let num_h = result.num_heavy();
+        if result.num_reservoir() == 0 && num_h < result.k() as usize {
+            result.set_k(num_h as u32);
+        }
+
+        // with k equal to the number of samples, each decrement raises tau; there are at least
+        // two samples, since fewer are handled by the other cases
+        result.decrease_k_by_1();
+        while result.num_marks_in_h() > 0 {
+            result.decrease_k_by_1();
+        }
+        result.strip_marks();
+        result
+    }
+}
+
+impl<T: SamplingItemValue> VarOptUnion<T> {
+    /// Serializes the union in the format of Java's `VarOptItemsUnion`.
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        if self.gadget.num_samples() == 0 {
+            VAROPT_UNION_PREAMBLE_LONGS_EMPTY as usize * 8
+        } else {
+            VAROPT_UNION_PREAMBLE_LONGS_FULL as usize * 8 + self.gadget.serialized_size_bytes()
+        }
+    }
+
+    /// Serializes the union into `buf` in the format written by
+    /// [`serialize`](Self::serialize), returning the number of bytes written.
+    ///
+    /// Returns an error if `buf` is too short for the image.
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Streams the union to `writer` in the format written by [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        let is_empty = self.gadget.num_samples() == 0;
+        let preamble_longs = if is_empty {
+            VAROPT_UNION_PREAMBLE_LONGS_EMPTY
+        } else {
+            VAROPT_UNION_PREAMBLE_LONGS_FULL
+        };
+        bytes.write_u8(preamble_longs);
+        bytes.write_u8(SERIAL_VERSION);
+        bytes.write_u8(Family::VAROPT_UNION.id);
+        bytes.write_u8(if is_empty { FLAGS_IS_EMPTY } else { 0 });
+        bytes.write_u32_le(self.max_k);
+        if !is_empty {
+            bytes.write_u64_le(self.n);
+            bytes.write_f64_le(self.outer_tau_numer);
+            bytes.write_u64_le(self.outer_tau_denom);
+            self.gadget.write_image(bytes);
+        }
+    }
+
+    /// Deserializes a union from bytes written by [`Self::serialize`] or by Java's
+    /// `VarOptItemsUnion`.
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes))
+    }
+
+    /// Reads a union written by [`write_to`](Self::write_to) from `reader`, consuming exactly
+    /// the bytes of one image.
+    ///
+    /// Fails like [`deserialize`](Self::deserialize); a failing `reader` is reported as
+    /// insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader))
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
+        let preamble_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?
+            & PREAMBLE_LONGS_MASK;
+        let serial_version = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let max_k = cursor.read_u32_le().map_err(insufficient_data("max_k"))?;
+
+        Family::VAROPT_UNION.validate_id(family_id)?;
+        ensure_serial_version_is(SERIAL_VERSION, serial_version)?;
+        if max_k == 0 {
+            return Err(Error::deserial("max_k must be at least 1, got 0"));
+        }
+        if (flags & FLAGS_IS_EMPTY) != 0 {
+            ensure_preamble_longs_in(&[VAROPT_UNION_PREAMBLE_LONGS_EMPTY], preamble_longs)?;
+            return Ok(Self::new(max_k));
+        }
+        ensure_preamble_longs_in(&[VAROPT_UNION_PREAMBLE_LONGS_FULL], preamble_longs)?;
+
+        let n = cursor.read_u64_le().map_err(insufficient_data("n"))?;
+        let outer_tau_numer = cursor
+            .read_f64_le()
+            .map_err(insufficient_data("outer_tau_numer"))?;
+        let outer_tau_denom = cursor
+            .read_u64_le()
+            .map_err(insufficient_data("outer_tau_denom"))?;
+        let gadget = VarOptItemsSketch::read_image(cursor)?;
+        if !gadget.has_marks() {
+            return Err(Error::deserial("union gadget is missing its marks"));
+        }
+        if gadget.k() > max_k {
+            return Err(Error::deserial(format!(
+                "gadget k {} exceeds the union max_k {max_k}",
+                gadget.k()
+            )));
+        }
+        check_outer_tau(outer_tau_numer, outer_tau_denom, &gadget)?;
+        Ok(Self {
+            max_k,
+            n,
+            outer_tau_numer,
+            outer_tau_denom,
+            gadget,
+        })
+    }
+}
+
+/// Checks the outer tau fields against the marked items of a decoded gadget.
+///
+/// Marks come only from input reservoirs, and the outer tau is the largest tau among them,
+/// so a marked item never outweighs it. `to_sketch` relies on this to absorb the marked
+/// items before k runs out.
+fn check_outer_tau<T>(
+    outer_tau_numer: f64,
+    outer_tau_denom: u64,
+    gadget: &VarOptItemsSketch<T>,
+) -> Result<(), Error> {
+    if outer_tau_denom == 0 {
+        if outer_tau_numer != 0.0 {
+            return Err(Error::deserial(format!(
+                "outer_tau_numer must be 0 without an outer tau denominator, got \
+                 {outer_tau_numer}"
+            )));
+        }
+        if gadget.num_marks_in_h() > 0 {
+            return Err(Error::deserial(format!(
+                "{} marked items in H without an outer tau",
+                gadget.num_marks_in_h()
+            )));
+        }
+        return Ok(());
+    }
+    if !outer_tau_numer.is_finite() || outer_tau_numer <= 0.0 {
+        return Err(Error::deserial(format!(
+            "outer_tau_numer must be positive and finite, got {outer_tau_numer}"
+        )));
+    }
+    // the last item of an input reservoir absorbs its rounding error, so allow for that
+    let outer_tau = outer_tau_numer / outer_tau_denom as f64;
+    let max_marked_weight = outer_tau * (1.0 + 1e-9);
+    if let Some((_, weight, _)) = gadget
+        .marked_heavy_items()
+        .find(|&(_, weight, mark)| mark && weight > max_marked_weight)
+    {
+        return Err(Error::deserial(format!(
+            "marked item weight {weight} exceeds the outer tau {outer_tau}"
+        )));
+    }
+    Ok(())
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!([T: SamplingItemValue] VarOptUnion<T>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([T: SamplingItemValue] VarOptUnion<T>);
+impl_fingerprint_via_image!([T: SamplingItemValue] VarOptUnion<T>);
@@ -17,6 +17,10 @@
 
 use std::cmp::Ordering;
 use std::convert::identity;
+use std::io;
+use std::io::Read;
+use std::io::Write;
+use std::iter::Sum;
 use std::num::NonZeroU64;
 
 use crate::codec::SketchBytes;
@@ -24,7 +28,12 @@ use crate::codec::SketchSlice;
 use crate::codec::assert::ensure_preamble_longs_in;
 use crate::codec::assert::ensure_serial_version_is;
 use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
 use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
 use crate::error::Error;
 use crate::tdigest::serialization::COMPAT_DOUBLE;
 use crate::tdigest::serialization::COMPAT_FLOAT;
@@ -403,7 +412,41 @@ impl TDigestMut {
     /// ```
     pub fn serialize(&mut self) -> Vec<u8> {
         self.compress();
+        let mut bytes = SketchBytes::with_capacity(self.compressed_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    ///
+    /// Like serializing, this first compresses the buffered values into centroids.
+    pub fn serialized_size_bytes(&mut self) -> usize {
+        self.compress();
+        self.compressed_size_bytes()
+    }
+
+    /// Compresses the sketch and serializes it into `buf`, returning the number of bytes
+    /// written.
+    ///
+    /// Writes the image [`serialize`](Self::serialize) returns. Returns an error if `buf` is
+    /// shorter than [`serialized_size_bytes`](Self::serialized_size_bytes).
+    pub fn serialize_into(&mut self, buf: &mut [u8]) -> Result<usize, Error> {
+        self.compress();
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Compresses the sketch and streams it to `writer` in the format of
+    /// [`serialize`](Self::serialize).
+    ///
+    /// # Errors
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&mut self, writer: &mut impl Write) -> io::Result<()> {
+        self.compress();
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
 
+    fn compressed_size_bytes(&self) -> usize {
         let mut total_size = 0;
         if self.is_empty() || self.is_single_value() {
             // 1 byte preamble
@@ -431,8 +474,10 @@ impl TDigestMut {
             // + (8+8) bytes per centroid
             total_size += self.centroids.len() * (size_of::<f64>() + size_of::<u64>());
         }
+        total_size
+    }
 
-        let mut bytes = SketchBytes::with_capacity(total_size);
+    fn write_image(&self, bytes: &mut SketchBytes) {
         bytes.write_u8(match self.total_weight() {
             0 => PREAMBLE_LONGS_EMPTY_OR_SINGLE,
             1 => PREAMBLE_LONGS_EMPTY_OR_SINGLE,
@@ -456,11 +501,11 @@ impl TDigestMut {
         });
         bytes.write_u16_le(0); // unused
         if self.is_empty() {
-            return bytes.into_bytes();
+            return;
         }
         if self.is_single_value() {
             bytes.write_f64_le(self.min);
-            return bytes.into_bytes();
+            return;
         }
         bytes.write_u32_le(self.centroids.len() as u32);
         bytes.write_u32_le(0); // unused
@@ -470,7 +515,6 @@ impl TDigestMut {
             bytes.write_f64_le(centroid.mean);
             bytes.write_u64_le(centroid.weight.get());
         }
-        bytes.into_bytes()
     }
 
     /// Deserializes a TDigest from bytes.
@@ -495,8 +539,18 @@ impl TDigestMut {
     /// assert_eq!(decoded.max_value(), Some(2.0));
     /// ```
     pub fn deserialize(bytes: &[u8], is_f32: bool) -> Result<Self, Error> {
-        let mut cursor = SketchSlice::new(bytes);
+        Self::read_image(SketchSlice::new(bytes), is_f32)
+    }
 
+    /// Reads a TDigest written by [`write_to`](Self::write_to) from `reader`.
+    ///
+    /// Accepts the same formats as [`deserialize`](Self::deserialize) and consumes exactly the
+    /// bytes of one image. A failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read, is_f32: bool) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader), is_f32)
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>, is_f32: bool) -> Result<Self, Error> {
         let preamble_longs = cursor
             .read_u8()
             .map_err(insufficient_data("preamble_longs"))?;
@@ -506,7 +560,7 @@ impl TDigestMut {
         let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
         if let Err(err) = Family::TDIGEST.validate_id(family_id) {
             return if preamble_longs == 0 && serial_version == 0 && family_id == 0 {
-                Self::deserialize_compat(bytes)
+                Self::deserialize_compat(cursor)
             } else {
                 Err(err)
             };
@@ -577,7 +631,8 @@ impl TDigestMut {
         };
         check_non_nan(min, "min")?;
         check_non_nan(max, "max")?;
-        let mut centroids = Vec::with_capacity(num_centroids);
+        let centroid_size = if is_f32 { 8 } else { 16 };
+        let mut centroids = Vec::with_capacity(cursor.capacity_hint(num_centroids, centroid_size));
         let mut centroids_weight = 0u64;
         for _ in 0..num_centroids {
             let (mean, weight) = if is_f32 {
@@ -594,10 +649,13 @@ impl TDigestMut {
             check_non_nan(mean, "centroid mean")?;
             check_finite(mean, "centroid")?;
             let weight = check_nonzero(weight, "centroid weight")?;
-            centroids_weight += weight.get();
+            centroids_weight = centroids_weight
+                .checked_add(weight.get())
+                .ok_or_else(|| Error::deserial("total centroid weight overflows u64"))?;
             centroids.push(Centroid { mean, weight });
         }
-        let mut buffer = Vec::with_capacity(num_buffered);
+        let value_size = if is_f32 { 4 } else { 8 };
+        let mut buffer = Vec::with_capacity(cursor.capacity_hint(num_buffered, value_size));
         for _ in 0..num_buffered {
             let value = if is_f32 {
                 cursor
@@ -612,6 +670,12 @@ impl TDigestMut {
             check_finite(value, "buffered_value mean")?;
             buffer.push(value);
         }
+        // each buffered value weighs 1 once compressed into the centroids
+        if centroids_weight.checked_add(num_buffered as u64).is_none() {
+            return Err(Error::deserial(
+                "total weight of centroids and buffered values overflows u64",
+            ));
+        }
         Ok(TDigestMut::make(
             k,
             reverse_merge,
@@ -625,14 +689,15 @@ impl TDigestMut {
 
     // compatibility with the format of the reference implementation
     // default byte order of ByteBuffer is used there, which is big endian
-    fn deserialize_compat(bytes: &[u8]) -> Result<Self, Error> {
+    //
+    // the three high bytes of the big-endian type were already read as the zero preamble longs,
+    // serial version and family, so only its low byte is left
+    fn deserialize_compat(mut cursor: SketchSlice<'_>) -> Result<Self, Error> {
         fn make_error(tag: &'static str) -> impl FnOnce(std::io::Error) -> Error {
             move |_| Error::insufficient_data_of("compat format", tag)
         }
 
-        let mut cursor = SketchSlice::new(bytes);
-
-        let ty = cursor.read_u32_be().map_err(make_error("type"))?;
+        let ty = cursor.read_u8().map_err(make_error("type"))? as u32;
         match ty {
             COMPAT_DOUBLE => {
                 fn make_error(tag: &'static str) -> impl FnOnce(std::io::Error) -> Error {
@@ -652,7 +717,7 @@ impl TDigestMut {
                 let num_centroids =
                     cursor.read_u32_be().map_err(make_error("num_centroids"))? as usize;
                 let mut total_weight = 0u64;
-                let mut centroids = Vec::with_capacity(num_centroids);
+                let mut centroids = Vec::with_capacity(cursor.capacity_hint(num_centroids, 16));
                 for _ in 0..num_centroids {
                     let weight = cursor.read_f64_be().map_err(make_error("weight"))? as u64;
                     let mean = cursor.read_f64_be().map_err(make_error("mean"))?;
@@ -694,7 +759,7 @@ impl TDigestMut {
                 let num_centroids =
                     cursor.read_u16_be().map_err(make_error("num_centroids"))? as usize;
                 let mut total_weight = 0u64;
-                let mut centroids = Vec::with_capacity(num_centroids);
+                let mut centroids = Vec::with_capacity(cursor.capacity_hint(num_centroids, 8));
                 for _ in 0..num_centroids {
                     let weight = cursor.read_f32_be().map_err(make_error("weight"))? as u64;
                     let mean = cursor.read_f32_be().map_err(make_error("mean"))? as f64;
@@ -767,7 +832,7 @@ impl TDigestMut {
                 let centroids_weight = self.centroids_weight as f64;
                 let q0 = weight_so_far / centroids_weight;
                 let q2 = (weight_so_far + proposed_weight) / centroids_weight;
-                let normalizer = scale_function::normalizer((2 * self.k) as f64, centroids_weight);
+                let normalizer = scale_function::normalizer(2.0 * self.k as f64, centroids_weight);
                 add_this = proposed_weight
                     <= (centroids_weight
                         * scale_function::max(q0, normalizer)
@@ -1350,3 +1415,63 @@ mod scale_function {
 const fn weighted_average(x1: f64, w1: f64, x2: f64, w2: f64) -> f64 {
     (x1 * w1 + x2 * w2) / (w1 + w2)
 }
+
+/// Updates the digest with every value of the iterator. `NaN` and infinite values are ignored.
+impl Extend<f64> for TDigestMut {
+    fn extend<I: IntoIterator<Item = f64>>(&mut self, iter: I) {
+        for value in iter {
+            self.update(value);
+        }
+    }
+}
+
+/// Merges the digests into the first one, or returns an empty default digest when there are none.
+impl Sum for TDigestMut {
+    fn sum<I: Iterator<Item = Self>>(mut iter: I) -> Self {
+        let mut result = iter.next().unwrap_or_default();
+        for other in iter {
+            result.merge(&other);
+        }
+        result
+    }
+}
+
+/// Merges the digests into a copy of the first one, as the `Sum<TDigestMut>` impl does.
+impl<'a> Sum<&'a TDigestMut> for TDigestMut {
+    fn sum<I: Iterator<Item = &'a Self>>(mut iter: I) -> Self {
+        let mut result = iter.next().cloned().unwrap_or_default();
+        for other in iter {
+            result.merge(other);
+        }
+        result
+    }
+}
+
+/// Collects the values into a digest with the default k. `NaN` and infinite values are ignored.
+impl FromIterator<f64> for TDigestMut {
+    fn from_iter<I: IntoIterator<Item = f64>>(iter: I) -> Self {
+        let mut sketch = TDigestMut::default();
+        sketch.extend(iter);
+        sketch
+    }
+}
+
+#[cfg(feature = "serde")]
+// Serialization compresses the digest, which needs a mutable copy.
+impl_serde_via_image!(
+    [] TDigestMut,
+    |s| TDigestMut::serialize(&mut s.clone()),
+    |b| TDigestMut::deserialize(b, false)
+);
+#[cfg(feature = "base64")]
+// Serialization compresses the digest, which needs a mutable copy.
+impl_base64_via_image!(
+    [] TDigestMut,
+    |s| TDigestMut::serialize(&mut s.clone()),
+    |b| TDigestMut::deserialize(b, false)
+);
+// Likewise, the fingerprint hashes the image of a compressed copy.
+impl_fingerprint_via_image!(
+    [] TDigestMut,
+    |s| TDigestMut::serialize(&mut s.clone())
+);
@@ -0,0 +1,164 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::hash::DEFAULT_UPDATE_SEED;
+use crate::hash::compute_seed_hash;
+use crate::theta::CompactThetaSketch;
+use crate::theta::ThetaSketchView;
+use crate::theta::hash_table::ThetaEntry;
+use crate::thetacommon::RawHashTableEntry;
+use crate::thetacommon::a_not_b::raw_a_not_b;
+use crate::thetacommon::constants::MAX_THETA;
+use crate::thetacommon::hash_table::RawCompactParts;
+
+/// Set difference (A and not B) operator for Theta sketches.
+///
+/// The operator can be used statelessly through [`compute`](Self::compute), or statefully by
+/// calling [`set_a`](Self::set_a) once and then [`not_b`](Self::not_b) for every sketch to
+/// subtract.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::theta::ThetaAnotB;
+/// # use datasketches::theta::ThetaSketchBuilder;
+/// let mut a = ThetaSketchBuilder::default().build();
+/// let mut b = ThetaSketchBuilder::default().build();
+/// for i in 0..10 {
+///     a.update(i);
+/// }
+/// for i in 5..15 {
+///     b.update(i);
+/// }
+///
+/// let a_not_b = ThetaAnotB::new_with_default_seed();
+/// let result = a_not_b.compute(&a, &b, true).unwrap();
+/// assert_eq!(result.estimate(), 5.0);
+///
+/// let mut a_not_b = ThetaAnotB::new_with_default_seed();
+/// a_not_b.set_a(&a).unwrap();
+/// a_not_b.not_b(&b).unwrap();
+/// assert_eq!(a_not_b.to_sketch(true).estimate(), 5.0);
+/// ```
+#[derive(Debug)]
+pub struct ThetaAnotB {
+    seed_hash: u16,
+    state: RawCompactParts<ThetaEntry>,
+}
+
+impl ThetaAnotB {
+    /// Creates a new set difference operator for the given `seed`.
+    pub fn new(seed: u64) -> Self {
+        let seed_hash = compute_seed_hash(seed);
+        Self {
+            seed_hash,
+            state: empty_state(seed_hash),
+        }
+    }
+
+    /// Creates a new set difference operator with the default seed.
+    pub fn new_with_default_seed() -> Self {
+        Self::new(DEFAULT_UPDATE_SEED)
+    }
+
+    /// Computes `a` minus `b` without touching the stateful result.
+    ///
+    /// Returns an error if either non-empty input was built with a different seed.
+    pub fn compute<A: ThetaSketchView, B: ThetaSketchView>(
+        &self,
+        a: &A,
+        b: &B,
+        ordered: bool,
+    ) -> Result<CompactThetaSketch, Error> {
+        raw_a_not_b(a, b, self.seed_hash, ordered).map(into_compact)
+    }
+
+    /// Sets the sketch that subsequent [`not_b`](Self::not_b) calls subtract from.
+    ///
+    /// Any previous stateful result is discarded.
+    pub fn set_a<A: ThetaSketchView>(&mut self, a: &A) -> Result<(), Error> {
+        if !a.is_empty() && a.seed_hash() != self.seed_hash {
+            return Err(Error::incompatible_seed_hash(
+                ErrorKind::InvalidArgument,
+                self.seed_hash,
+                a.seed_hash(),
+            ));
+        }
+        self.state = RawCompactParts {
+            entries: a.iter().collect(),
+            theta: a.theta(),
+            seed_hash: self.seed_hash,
+            ordered: a.is_ordered(),
+            empty: a.is_empty(),
+        };
+        Ok(())
+    }
+
+    /// Subtracts `b` from the current stateful result.
+    ///
+    /// Calling this before [`set_a`](Self::set_a) is a no-op: the result stays empty.
+    pub fn not_b<B: ThetaSketchView>(&mut self, b: &B) -> Result<(), Error> {
+        self.state = raw_a_not_b(&self.state, b, self.seed_hash, self.state.ordered)?;
+        Ok(())
+    }
+
+    /// Returns the current stateful result as a compact theta sketch.
+    pub fn to_sketch(&self, ordered: bool) -> CompactThetaSketch {
+        let mut entries = self.state.entries.clone();
+        if ordered && !self.state.ordered {
+            entries.sort_unstable_by_key(RawHashTableEntry::hash);
+        }
+        into_compact(RawCompactParts {
+            entries,
+            theta: self.state.theta,
+            seed_hash: self.state.seed_hash,
+            ordered: ordered || self.state.ordered,
+            empty: self.state.empty,
+        })
+    }
+
+    /// Resets the stateful result to empty.
+    pub fn reset(&mut self) {
+        self.state = empty_state(self.seed_hash);
+    }
+}
+
+fn empty_state(seed_hash: u16) -> RawCompactParts<ThetaEntry> {
+    RawCompactParts {
+        entries: vec![],
+        theta: MAX_THETA,
+        seed_hash,
+        ordered: true,
+        empty: true,
+    }
+}
+
+fn into_compact(parts: RawCompactParts<ThetaEntry>) -> CompactThetaSketch {
+    CompactThetaSketch::from_parts(
+        parts
+            .entries
+            .into_iter()
+            .map(|entry| entry.hash())
+            .collect(),
+        parts.theta,
+        parts.seed_hash,
+        parts.ordered,
+        parts.empty,
+    )
+}
@@ -0,0 +1,272 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! A Theta sketch shared by many producer threads
+//!
+//! The design follows the concurrent Theta sketch of the Java implementation: a shared
+//! gadget sketch holds the result, and each thread updates its own [`ConcurrentThetaBuffer`]
+//! which propagates batches of hashes into the gadget. Buffers screen hashes against the
+//! gadget's current theta, so once the gadget is in estimation mode most updates never leave
+//! the thread. The gadget publishes its theta and estimate through atomics, which readers load
+//! without taking the lock.
+
+use std::hash::Hash;
+use std::sync::Arc;
+use std::sync::Mutex;
+use std::sync::MutexGuard;
+use std::sync::atomic::AtomicBool;
+use std::sync::atomic::AtomicU64;
+use std::sync::atomic::Ordering;
+
+use crate::common::NumStdDev;
+use crate::hash::MurmurHash3X64128;
+use crate::theta::CompactThetaSketch;
+use crate::theta::ThetaSketch;
+use crate::thetacommon::constants::MAX_THETA;
+
+/// Number of hashes a buffer collects before propagating them, like Java's default local
+/// sketch of 2^4 entries.
+const DEFAULT_BUFFER_CAPACITY: usize = 16;
+
+/// A Theta sketch that many threads update concurrently through local buffers.
+///
+/// Create it with
+/// [`ThetaSketchBuilder::build_concurrent`](super::ThetaSketchBuilder::build_concurrent)
+/// and hand each producer thread its own [`buffer`](Self::buffer). Cloning the sketch is cheap
+/// and yields another handle to the same shared state.
+///
+/// [`estimate`](Self::estimate) and [`theta`](Self::theta) read published values and never
+/// block. They lag behind by the hashes still held in buffers; call
+/// [`ConcurrentThetaBuffer::flush`] or drop the buffers for an up to date result.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::theta::ThetaSketchBuilder;
+/// let sketch = ThetaSketchBuilder::default().build_concurrent();
+/// std::thread::scope(|s| {
+///     for t in 0..4 {
+///         let mut buffer = sketch.buffer();
+///         s.spawn(move || {
+///             for i in 0..1000 {
+///                 buffer.update(t * 1000 + i);
+///             }
+///         });
+///     }
+/// });
+/// assert_eq!(sketch.estimate(), 4000.0);
+/// ```
+#[derive(Debug, Clone)]
+pub struct ConcurrentThetaSketch {
+    shared: Arc<Shared>,
+}
+
+#[derive(Debug)]
+struct Shared {
+    gadget: Mutex<ThetaSketch>,
+    seed: u64,
+    /// Theta of the gadget, used by buffers to screen hashes
+    theta: AtomicU64,
+    /// Bits of the gadget's estimate
+    estimate: AtomicU64,
+    /// Whether the gadget has not seen any update yet
+    empty: AtomicBool,
+}
+
+impl Shared {
+    fn lock(&self) -> MutexGuard<'_, ThetaSketch> {
+        // The gadget is only mutated by non-panicking updates, so a poisoned lock still guards
+        // a consistent sketch.
+        self.gadget.lock().unwrap_or_else(|e| e.into_inner())
+    }
+
+    fn propagate(&self, hashes: &[u64]) {
+        let mut gadget = self.lock();
+        for &hash in hashes {
+            gadget.update_hash(hash);
+        }
+        self.publish(&gadget);
+    }
+
+    fn publish(&self, gadget: &ThetaSketch) {
+        self.theta.store(gadget.theta64(), Ordering::Relaxed);
+        self.estimate
+            .store(gadget.estimate().to_bits(), Ordering::Relaxed);
+        self.empty.store(gadget.is_empty(), Ordering::Relaxed);
+    }
+}
+
+impl ConcurrentThetaSketch {
+    pub(super) fn new(gadget: ThetaSketch, seed: u64) -> Self {
+        let shared = Shared {
+            theta: AtomicU64::new(gadget.theta64()),
+            estimate: AtomicU64::new(gadget.estimate().to_bits()),
+            empty: AtomicBool::new(gadget.is_empty()),
+            gadget: Mutex::new(gadget),
+            seed,
+        };
+        Self {
+            shared: Arc::new(shared),
+        }
+    }
+
+    /// Returns a new local buffer propagating into this sketch.
+    ///
+    /// The buffer collects 16 hashes before it takes the lock of the shared sketch.
+    pub fn buffer(&self) -> ConcurrentThetaBuffer {
+        self.buffer_with_capacity(DEFAULT_BUFFER_CAPACITY)
+    }
+
+    /// Returns a new local buffer that propagates after collecting `capacity` hashes.
+    ///
+    /// Larger buffers take the lock less often and let the published estimate lag further
+    /// behind.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `capacity` is zero.
+    pub fn buffer_with_capacity(&self, capacity: usize) -> ConcurrentThetaBuffer {
+        assert!(capacity > 0, "buffer capacity must be positive");
+        ConcurrentThetaBuffer {
+            shared: Arc::clone(&self.shared),
+            hashes: Vec::with_capacity(capacity),
+            capacity,
+        }
+    }
+
+    /// Return the published cardinality estimate without locking.
+    pub fn estimate(&self) -> f64 {
+        f64::from_bits(self.shared.estimate.load(Ordering::Relaxed))
+    }
+
+    /// Return the published theta as a fraction (0.0 to 1.0) without locking.
+    pub fn theta(&self) -> f64 {
+        self.theta64() as f64 / MAX_THETA as f64
+    }
+
+    /// Return the published theta as u64 without locking.
+    pub fn theta64(&self) -> u64 {
+        self.shared.theta.load(Ordering::Relaxed)
+    }
+
+    /// Check if no update has been propagated yet
+    pub fn is_empty(&self) -> bool {
+        self.shared.empty.load(Ordering::Relaxed)
+    }
+
+    /// Check if the published theta is below 1.0, without locking
+    pub fn is_estimation_mode(&self) -> bool {
+        self.theta64() < MAX_THETA
+    }
+
+    /// Return the number of retained entries of the shared sketch.
+    ///
+    /// This takes the lock of the shared sketch.
+    pub fn num_retained(&self) -> usize {
+        self.shared.lock().num_retained()
+    }
+
+    /// Returns the approximate lower error bound of the propagated state.
+    ///
+    /// This takes the lock of the shared sketch. See [`ThetaSketch::lower_bound`].
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.shared.lock().lower_bound(num_std_dev)
+    }
+
+    /// Returns the approximate upper error bound of the propagated state.
+    ///
+    /// This takes the lock of the shared sketch. See [`ThetaSketch::upper_bound`].
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.shared.lock().upper_bound(num_std_dev)
+    }
+
+    /// Return lg_k
+    pub fn lg_k(&self) -> u8 {
+        self.shared.lock().lg_k()
+    }
+
+    /// Return the propagated state in compact (immutable) form.
+    ///
+    /// This takes the lock of the shared sketch for the duration of the copy. If `ordered` is
+    /// true, retained hash values are sorted in ascending order.
+    pub fn compact(&self, ordered: bool) -> CompactThetaSketch {
+        self.shared.lock().compact(ordered)
+    }
+
+    /// Reset the shared sketch to empty state.
+    ///
+    /// Hashes still held in buffers are propagated after the reset when they are flushed.
+    pub fn reset(&self) {
+        let mut gadget = self.shared.lock();
+        gadget.reset();
+        self.shared.publish(&gadget);
+    }
+}
+
+/// A thread-local buffer feeding a [`ConcurrentThetaSketch`].
+///
+/// The buffer owns a handle to the shared sketch and can be moved to another thread. Dropping
+/// it propagates the hashes it still holds.
+#[derive(Debug)]
+pub struct ConcurrentThetaBuffer {
+    shared: Arc<Shared>,
+    hashes: Vec<u64>,
+    capacity: usize,
+}
+
+impl ConcurrentThetaBuffer {
+    /// Update the sketch with a hashable value.
+    ///
+    /// See [`ThetaSketch::update`].
+    pub fn update<T: Hash>(&mut self, value: T) {
+        let mut hasher = MurmurHash3X64128::with_seed(self.shared.seed);
+        value.hash(&mut hasher);
+        let (h1, _) = hasher.finish128();
+        self.update_hash(h1);
+    }
+
+    /// Update the sketch with an already computed hash.
+    ///
+    /// See [`ThetaSketch::update_hash`].
+    pub fn update_hash(&mut self, hash: u64) {
+        // Screened hashes are dropped right away, except that the first update has to reach
+        // the gadget to clear its empty flag.
+        if (hash >> 1) >= self.shared.theta.load(Ordering::Relaxed)
+            && !self.shared.empty.load(Ordering::Relaxed)
+        {
+            return;
+        }
+        self.hashes.push(hash);
+        if self.hashes.len() >= self.capacity {
+            self.flush();
+        }
+    }
+
+    /// Propagate the buffered hashes into the shared sketch.
+    pub fn flush(&mut self) {
+        if !self.hashes.is_empty() {
+            self.shared.propagate(&self.hashes);
+            self.hashes.clear();
+        }
+    }
+}
+
+impl Drop for ConcurrentThetaBuffer {
+    fn drop(&mut self) {
+        self.flush();
+    }
+}
@@ -0,0 +1,517 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! A Theta sketch operating directly over an externally owned buffer
+//!
+//! [`DirectThetaSketch`] keeps its whole state, preamble and hash table, in a caller-provided
+//! byte slice laid out like the updatable QuickSelect sketch of the Java implementation. The
+//! slice can be a memory-mapped file or a shared memory segment, so several processes can
+//! aggregate into the same sketch.
+
+use std::hash::Hash;
+
+use crate::codec::assert::ensure_lg_k_in;
+use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_seed_hash_is;
+use crate::codec::assert::ensure_serial_version_is;
+use crate::codec::family::Family;
+use crate::common::NumStdDev;
+use crate::common::ResizeFactor;
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::hash::DEFAULT_UPDATE_SEED;
+use crate::hash::MurmurHash3X64128;
+use crate::hash::compute_seed_hash;
+use crate::theta::CompactThetaSketch;
+use crate::theta::ThetaEntry;
+use crate::theta::serialization::UNCOMPRESSED_SERIAL_VERSION;
+use crate::thetacommon::RawThetaSketchView;
+use crate::thetacommon::binomial_bounds;
+use crate::thetacommon::constants::FLAGS_IS_EMPTY;
+use crate::thetacommon::constants::HASH_TABLE_REBUILD_THRESHOLD;
+use crate::thetacommon::constants::HASH_TABLE_RESIZE_THRESHOLD;
+use crate::thetacommon::constants::MAX_LG_K;
+use crate::thetacommon::constants::MAX_THETA;
+use crate::thetacommon::constants::MIN_LG_K;
+use crate::thetacommon::constants::STRIDE_MASK;
+use crate::thetacommon::hash_table::starting_sub_multiple;
+use crate::thetacommon::hash_table::starting_theta_from_sampling_probability;
+
+const PREAMBLE_LONGS: u8 = 3;
+const PREAMBLE_SIZE: usize = 24;
+
+// Byte offsets of the preamble fields
+const PREAMBLE_LONGS_BYTE: usize = 0;
+const SERIAL_VERSION_BYTE: usize = 1;
+const FAMILY_BYTE: usize = 2;
+const LG_NOM_LONGS_BYTE: usize = 3;
+const LG_ARR_LONGS_BYTE: usize = 4;
+const FLAGS_BYTE: usize = 5;
+const SEED_HASH_SHORT: usize = 6;
+const RETAINED_ENTRIES_INT: usize = 8;
+const P_FLOAT: usize = 12;
+const THETA_LONG: usize = 16;
+
+/// The preamble longs byte keeps the lg of the resize factor in its two high bits.
+const LG_RESIZE_FACTOR_SHIFT: u8 = 6;
+const PREAMBLE_LONGS_MASK: u8 = 0x3F;
+
+/// A Theta sketch whose state lives in a borrowed, fixed-size byte buffer.
+///
+/// Every update reads and writes the buffer in place; nothing is cached on the heap, so the
+/// buffer always holds a complete updatable image that another process can pick up with
+/// [`wrap`](Self::wrap). The buffer is sized for the largest hash table the sketch can reach,
+/// see [`required_size_bytes`](Self::required_size_bytes). The table starts small and grows
+/// inside the buffer according to the resize factor.
+///
+/// The sketch does not synchronize access to the buffer. Processes sharing one buffer must
+/// serialize their updates, for example with a file lock around each batch.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::theta::DirectThetaSketch;
+/// # use datasketches::theta::ThetaSketchBuilder;
+/// let mut buf = vec![0u8; DirectThetaSketch::required_size_bytes(10)];
+/// let mut sketch = ThetaSketchBuilder::default()
+///     .lg_k(10)
+///     .build_direct(&mut buf)
+///     .unwrap();
+/// sketch.update("apple");
+///
+/// // Another handle, possibly in another process, picks up the same buffer.
+/// let mut sketch = DirectThetaSketch::wrap(&mut buf).unwrap();
+/// sketch.update("banana");
+/// assert_eq!(sketch.estimate(), 2.0);
+/// ```
+#[derive(Debug)]
+pub struct DirectThetaSketch<'a> {
+    bytes: &'a mut [u8],
+    seed: u64,
+}
+
+impl<'a> DirectThetaSketch<'a> {
+    /// Returns the number of bytes a direct sketch with the given lg_k needs.
+    ///
+    /// This covers the preamble and a hash table of `2^(lg_k + 1)` entries.
+    ///
+    /// # Panics
+    ///
+    /// If lg_k is not in range [5, 26]
+    pub fn required_size_bytes(lg_k: u8) -> usize {
+        assert!(
+            (MIN_LG_K..=MAX_LG_K).contains(&lg_k),
+            "lg_k must be in [{}, {}], got {}",
+            MIN_LG_K,
+            MAX_LG_K,
+            lg_k
+        );
+        PREAMBLE_SIZE + (8 << (lg_k + 1))
+    }
+
+    /// Initializes an empty sketch in `bytes`, overwriting its contents.
+    pub(super) fn initialize(
+        bytes: &'a mut [u8],
+        lg_k: u8,
+        resize_factor: ResizeFactor,
+        sampling_probability: f32,
+        seed: u64,
+    ) -> Result<Self, Error> {
+        let required = Self::required_size_bytes(lg_k);
+        if bytes.len() < required {
+            return Err(Error::insufficient_buffer(
+                ErrorKind::InvalidArgument,
+                required,
+                bytes.len(),
+            ));
+        }
+        let mut sketch = Self { bytes, seed };
+        sketch.write_empty(
+            lg_k,
+            resize_factor.lg_value(),
+            sampling_probability,
+            compute_seed_hash(seed),
+        );
+        Ok(sketch)
+    }
+
+    /// Wraps a buffer holding a direct sketch written with the default seed.
+    ///
+    /// See [`wrap_with_seed`](Self::wrap_with_seed).
+    pub fn wrap(bytes: &'a mut [u8]) -> Result<Self, Error> {
+        Self::wrap_with_seed(bytes, DEFAULT_UPDATE_SEED)
+    }
+
+    /// Wraps a buffer holding a direct sketch, continuing to update it in place.
+    ///
+    /// The buffer must start with an updatable QuickSelect image, as written by
+    /// [`ThetaSketchBuilder::build_direct`](super::ThetaSketchBuilder::build_direct) or by
+    /// Java's `UpdateSketch` in writable memory, and be at least
+    /// [`required_size_bytes`](Self::required_size_bytes) long for its lg_k. The seed must
+    /// match the seed the sketch was created with.
+    pub fn wrap_with_seed(bytes: &'a mut [u8], seed: u64) -> Result<Self, Error> {
+        if bytes.len() < PREAMBLE_SIZE {
+            return Err(Error::insufficient_buffer(
+                ErrorKind::InvalidData,
+                PREAMBLE_SIZE,
+                bytes.len(),
+            ));
+        }
+        Family::QUICKSELECT.validate_id(bytes[FAMILY_BYTE])?;
+        ensure_preamble_longs_in(
+            &[PREAMBLE_LONGS],
+            bytes[PREAMBLE_LONGS_BYTE] & PREAMBLE_LONGS_MASK,
+        )?;
+        ensure_serial_version_is(UNCOMPRESSED_SERIAL_VERSION, bytes[SERIAL_VERSION_BYTE])?;
+
+        let sketch = Self { bytes, seed };
+        let lg_k = sketch.lg_k();
+        ensure_lg_k_in(MIN_LG_K, MAX_LG_K, lg_k)?;
+        let lg_arr = sketch.lg_arr();
+        if !(MIN_LG_K..=lg_k + 1).contains(&lg_arr) {
+            return Err(Error::deserial(format!(
+                "lg_arr must be in [{MIN_LG_K}, {}], got {lg_arr}",
+                lg_k + 1
+            )));
+        }
+        let required = Self::required_size_bytes(lg_k);
+        if sketch.bytes.len() < required {
+            return Err(Error::insufficient_buffer(
+                ErrorKind::InvalidData,
+                required,
+                sketch.bytes.len(),
+            )
+            .with_context("lg_k", lg_k));
+        }
+        let expected_seed_hash = compute_seed_hash(seed);
+        ensure_seed_hash_is(expected_seed_hash, sketch.seed_hash())?;
+        if sketch.num_retained() >= 1 << lg_arr {
+            return Err(Error::deserial(format!(
+                "corrupted: {} retained entries in a table of {} slots",
+                sketch.num_retained(),
+                1 << lg_arr
+            )));
+        }
+        if sketch.theta64() == 0 || sketch.theta64() > MAX_THETA {
+            return Err(Error::deserial("corrupted: invalid theta"));
+        }
+        let occupied = sketch.hashes().count();
+        if occupied != sketch.num_retained() {
+            return Err(Error::deserial(format!(
+                "corrupted: {} retained entries declared, {occupied} slots occupied",
+                sketch.num_retained()
+            )));
+        }
+        Ok(sketch)
+    }
+
+    /// Update the sketch with a hashable value.
+    ///
+    /// Values are hashed exactly like [`ThetaSketch::update`](super::ThetaSketch::update) hashes
+    /// them, so a direct sketch and a heap sketch built from the same input agree.
+    pub fn update<T: Hash>(&mut self, value: T) {
+        let mut hasher = MurmurHash3X64128::with_seed(self.seed);
+        value.hash(&mut hasher);
+        let (h1, _) = hasher.finish128();
+        self.insert_hash(h1 >> 1);
+    }
+
+    /// Update the sketch with an already computed hash.
+    ///
+    /// See [`ThetaSketch::update_hash`](super::ThetaSketch::update_hash).
+    pub fn update_hash(&mut self, hash: u64) {
+        self.insert_hash(hash >> 1);
+    }
+
+    /// Return cardinality estimate
+    pub fn estimate(&self) -> f64 {
+        if self.is_empty() {
+            return 0.0;
+        }
+        let num_retained = self.num_retained() as f64;
+        if !self.is_estimation_mode() {
+            return num_retained;
+        }
+        num_retained / self.theta()
+    }
+
+    /// Return theta as a fraction (0.0 to 1.0)
+    pub fn theta(&self) -> f64 {
+        self.theta64() as f64 / MAX_THETA as f64
+    }
+
+    /// Return theta as u64
+    pub fn theta64(&self) -> u64 {
+        read_u64(self.bytes, THETA_LONG)
+    }
+
+    /// Return 16-bit seed hash.
+    pub fn seed_hash(&self) -> u16 {
+        u16::from_le_bytes([self.bytes[SEED_HASH_SHORT], self.bytes[SEED_HASH_SHORT + 1]])
+    }
+
+    /// Check if sketch is empty
+    pub fn is_empty(&self) -> bool {
+        self.bytes[FLAGS_BYTE] & FLAGS_IS_EMPTY != 0
+    }
+
+    /// Check if sketch is in estimation mode
+    pub fn is_estimation_mode(&self) -> bool {
+        self.theta64() < MAX_THETA
+    }
+
+    /// Return number of retained entries
+    pub fn num_retained(&self) -> usize {
+        read_u32(self.bytes, RETAINED_ENTRIES_INT) as usize
+    }
+
+    /// Return lg_k
+    pub fn lg_k(&self) -> u8 {
+        self.bytes[LG_NOM_LONGS_BYTE]
+    }
+
+    /// Reset the sketch to empty state, keeping its configuration
+    pub fn reset(&mut self) {
+        let lg_resize_factor = self.bytes[PREAMBLE_LONGS_BYTE] >> LG_RESIZE_FACTOR_SHIFT;
+        let sampling_probability = f32::from_le_bytes(
+            self.bytes[P_FLOAT..P_FLOAT + 4]
+                .try_into()
+                .expect("preamble holds p"),
+        );
+        self.write_empty(
+            self.lg_k(),
+            lg_resize_factor,
+            sampling_probability,
+            self.seed_hash(),
+        );
+    }
+
+    /// Return iterator over retained entries.
+    pub fn iter(&self) -> impl Iterator<Item = ThetaEntry> + '_ {
+        self.hashes().map(ThetaEntry::new)
+    }
+
+    /// Return a heap copy of this sketch in compact (immutable) form.
+    ///
+    /// If `ordered` is true, retained hash values are sorted in ascending order.
+    pub fn compact(&self, ordered: bool) -> CompactThetaSketch {
+        let mut entries: Vec<u64> = self.hashes().collect();
+        let empty = self.is_empty();
+        let theta = if empty { MAX_THETA } else { self.theta64() };
+        let ordered = ordered || empty || (entries.len() == 1 && theta == MAX_THETA);
+        if ordered {
+            entries.sort_unstable();
+        }
+        CompactThetaSketch::from_parts(entries, theta, self.seed_hash(), ordered, empty)
+    }
+
+    /// Returns the approximate lower error bound given the specified number of Standard Deviations.
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        if !self.is_estimation_mode() {
+            return self.num_retained() as f64;
+        }
+        binomial_bounds::lower_bound(self.num_retained() as u64, self.theta(), num_std_dev)
+            .expect("theta should always be valid")
+    }
+
+    /// Returns the approximate upper error bound given the specified number of Standard Deviations.
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        if !self.is_estimation_mode() {
+            return self.num_retained() as f64;
+        }
+        binomial_bounds::upper_bound(
+            self.num_retained() as u64,
+            self.theta(),
+            num_std_dev,
+            self.is_empty(),
+        )
+        .expect("theta should always be valid")
+    }
+
+    fn write_empty(
+        &mut self,
+        lg_k: u8,
+        lg_resize_factor: u8,
+        sampling_probability: f32,
+        seed_hash: u16,
+    ) {
+        let lg_arr = starting_sub_multiple(lg_k + 1, MIN_LG_K, lg_resize_factor);
+        let theta = starting_theta_from_sampling_probability(sampling_probability);
+
+        self.bytes[PREAMBLE_LONGS_BYTE] =
+            PREAMBLE_LONGS | (lg_resize_factor << LG_RESIZE_FACTOR_SHIFT);
+        self.bytes[SERIAL_VERSION_BYTE] = UNCOMPRESSED_SERIAL_VERSION;
+        self.bytes[FAMILY_BYTE] = Family::QUICKSELECT.id;
+        self.bytes[LG_NOM_LONGS_BYTE] = lg_k;
+        self.bytes[LG_ARR_LONGS_BYTE] = lg_arr;
+        self.bytes[FLAGS_BYTE] = FLAGS_IS_EMPTY;
+        self.bytes[SEED_HASH_SHORT..SEED_HASH_SHORT + 2].copy_from_slice(&seed_hash.to_le_bytes());
+        self.set_num_retained(0);
+        self.bytes[P_FLOAT..P_FLOAT + 4].copy_from_slice(&sampling_probability.to_le_bytes());
+        self.set_theta(theta);
+        self.table_mut(lg_arr).fill(0);
+    }
+
+    fn insert_hash(&mut self, hash: u64) {
+        self.bytes[FLAGS_BYTE] &= !FLAGS_IS_EMPTY;
+        if hash == 0 || hash >= self.theta64() {
+            return;
+        }
+
+        let lg_arr = self.lg_arr();
+        let index = self.find_slot(hash, lg_arr);
+        if self.slot(index) == hash {
+            return;
+        }
+        self.set_slot(index, hash);
+        let num_retained = self.num_retained() + 1;
+        self.set_num_retained(num_retained);
+
+        let fraction = if lg_arr <= self.lg_k() {
+            HASH_TABLE_RESIZE_THRESHOLD
+        } else {
+            HASH_TABLE_REBUILD_THRESHOLD
+        };
+        if num_retained > (fraction * (1u64 << lg_arr) as f64) as usize {
+            if lg_arr <= self.lg_k() {
+                self.resize();
+            } else {
+                self.rebuild();
+            }
+        }
+    }
+
+    /// Grow the table by the resize factor; the buffer always has room for the full table.
+    fn resize(&mut self) {
+        let lg_resize_factor = (self.bytes[PREAMBLE_LONGS_BYTE] >> LG_RESIZE_FACTOR_SHIFT).max(1);
+        let new_lg_arr = (self.lg_arr() + lg_resize_factor).min(self.lg_k() + 1);
+        let entries: Vec<u64> = self.hashes().collect();
+        self.bytes[LG_ARR_LONGS_BYTE] = new_lg_arr;
+        self.reinsert(&entries);
+    }
+
+    /// Keep the k smallest hashes and lower theta to the k-th smallest one.
+    fn rebuild(&mut self) {
+        let k = 1usize << self.lg_k();
+        let mut entries: Vec<u64> = self.hashes().collect();
+        let (_lesser, kth, _greater) = entries.select_nth_unstable(k);
+        let theta = *kth;
+        entries.truncate(k);
+        self.set_theta(theta);
+        self.reinsert(&entries);
+    }
+
+    fn reinsert(&mut self, entries: &[u64]) {
+        let lg_arr = self.lg_arr();
+        self.table_mut(lg_arr).fill(0);
+        for &hash in entries {
+            let index = self.find_slot(hash, lg_arr);
+            self.set_slot(index, hash);
+        }
+        self.set_num_retained(entries.len());
+    }
+
+    /// Find the slot holding `hash`, or the empty slot where it belongs.
+    fn find_slot(&self, hash: u64, lg_arr: u8) -> usize {
+        let mask = (1usize << lg_arr) - 1;
+        let stride = (2 * ((hash >> lg_arr) & STRIDE_MASK) + 1) as usize;
+        let start = (hash as usize) & mask;
+        let mut index = start;
+        loop {
+            let entry = self.slot(index);
+            if entry == 0 || entry == hash {
+                return index;
+            }
+            index = (index + stride) & mask;
+            assert_ne!(index, start, "corrupted direct sketch: hash table is full");
+        }
+    }
+
+    fn hashes(&self) -> impl Iterator<Item = u64> + '_ {
+        (0..1usize << self.lg_arr())
+            .map(|index| self.slot(index))
+            .filter(|&hash| hash != 0)
+    }
+
+    fn lg_arr(&self) -> u8 {
+        self.bytes[LG_ARR_LONGS_BYTE]
+    }
+
+    fn slot(&self, index: usize) -> u64 {
+        read_u64(self.bytes, PREAMBLE_SIZE + index * 8)
+    }
+
+    fn set_slot(&mut self, index: usize, hash: u64) {
+        let offset = PREAMBLE_SIZE + index * 8;
+        self.bytes[offset..offset + 8].copy_from_slice(&hash.to_le_bytes());
+    }
+
+    fn set_num_retained(&mut self, num_retained: usize) {
+        self.bytes[RETAINED_ENTRIES_INT..RETAINED_ENTRIES_INT + 4]
+            .copy_from_slice(&(num_retained as u32).to_le_bytes());
+    }
+
+    fn set_theta(&mut self, theta: u64) {
+        self.bytes[THETA_LONG..THETA_LONG + 8].copy_from_slice(&theta.to_le_bytes());
+    }
+
+    fn table_mut(&mut self, lg_arr: u8) -> &mut [u8] {
+        &mut self.bytes[PREAMBLE_SIZE..PREAMBLE_SIZE + (8 << lg_arr)]
+    }
+}
+
+impl RawThetaSketchView<ThetaEntry> for DirectThetaSketch<'_> {
+    fn seed_hash(&self) -> u16 {
+        DirectThetaSketch::seed_hash(self)
+    }
+
+    fn theta(&self) -> u64 {
+        DirectThetaSketch::theta64(self)
+    }
+
+    fn is_empty(&self) -> bool {
+        DirectThetaSketch::is_empty(self)
+    }
+
+    fn is_ordered(&self) -> bool {
+        false
+    }
+
+    fn iter(&self) -> impl Iterator<Item = ThetaEntry> + '_ {
+        DirectThetaSketch::iter(self)
+    }
+
+    fn num_retained(&self) -> usize {
+        DirectThetaSketch::num_retained(self)
+    }
+}
+
+fn read_u32(bytes: &[u8], offset: usize) -> u32 {
+    u32::from_le_bytes(
+        bytes[offset..offset + 4]
+            .try_into()
+            .expect("slice has 4 bytes"),
+    )
+}
+
+fn read_u64(bytes: &[u8], offset: usize) -> u64 {
+    u64::from_le_bytes(
+        bytes[offset..offset + 8]
+            .try_into()
+            .expect("slice has 8 bytes"),
+    )
+}
@@ -0,0 +1,212 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::error::Error;
+use crate::hash::DEFAULT_UPDATE_SEED;
+use crate::theta::CompactThetaSketch;
+use crate::theta::ThetaIntersection;
+use crate::theta::ThetaSketchView;
+use crate::theta::ThetaUnionBuilder;
+use crate::thetacommon::bounds_on_ratios;
+use crate::thetacommon::constants::MAX_LG_K;
+use crate::thetacommon::constants::MIN_LG_K;
+
+/// Bounds and estimate of the Jaccard index of two sets.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct JaccardSimilarity {
+    lower_bound: f64,
+    estimate: f64,
+    upper_bound: f64,
+}
+
+impl JaccardSimilarity {
+    const IDENTICAL: Self = Self {
+        lower_bound: 1.0,
+        estimate: 1.0,
+        upper_bound: 1.0,
+    };
+
+    const DISJOINT: Self = Self {
+        lower_bound: 0.0,
+        estimate: 0.0,
+        upper_bound: 0.0,
+    };
+
+    /// Returns the approximate lower bound of the Jaccard index at about 2 standard deviations.
+    pub fn lower_bound(&self) -> f64 {
+        self.lower_bound
+    }
+
+    /// Returns the estimate of the Jaccard index.
+    pub fn estimate(&self) -> f64 {
+        self.estimate
+    }
+
+    /// Returns the approximate upper bound of the Jaccard index at about 2 standard deviations.
+    pub fn upper_bound(&self) -> f64 {
+        self.upper_bound
+    }
+}
+
+/// Jaccard similarity operator for Theta sketches.
+///
+/// The Jaccard index of two sets A and B is |A ∩ B| / |A ∪ B|. It is estimated by sketching the
+/// union of the inputs and intersecting it with both of them.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::theta::ThetaJaccardSimilarity;
+/// # use datasketches::theta::ThetaSketchBuilder;
+/// let mut a = ThetaSketchBuilder::default().build();
+/// let mut b = ThetaSketchBuilder::default().build();
+/// for i in 0..1000 {
+///     a.update(i);
+///     b.update(i + 500);
+/// }
+///
+/// let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+/// let similarity = jaccard.jaccard(&a, &b).unwrap();
+/// assert!((similarity.estimate() - 1.0 / 3.0).abs() < 1e-9);
+/// assert!(jaccard.similarity_test(&a, &b, 0.3).unwrap());
+/// ```
+#[derive(Debug, Clone)]
+pub struct ThetaJaccardSimilarity {
+    seed: u64,
+}
+
+impl ThetaJaccardSimilarity {
+    /// Creates a new Jaccard similarity operator for the given `seed`.
+    pub fn new(seed: u64) -> Self {
+        Self { seed }
+    }
+
+    /// Creates a new Jaccard similarity operator with the default seed.
+    pub fn new_with_default_seed() -> Self {
+        Self::new(DEFAULT_UPDATE_SEED)
+    }
+
+    /// Computes the Jaccard index of the sets represented by `a` and `b`.
+    ///
+    /// Two empty sketches are considered identical. Returns an error if a non-empty input was
+    /// built with a different seed.
+    pub fn jaccard<A: ThetaSketchView, B: ThetaSketchView>(
+        &self,
+        a: &A,
+        b: &B,
+    ) -> Result<JaccardSimilarity, Error> {
+        if std::ptr::addr_eq(a, b) || (a.is_empty() && b.is_empty()) {
+            return Ok(JaccardSimilarity::IDENTICAL);
+        }
+        if a.is_empty() || b.is_empty() {
+            return Ok(JaccardSimilarity::DISJOINT);
+        }
+
+        let union_ab = self.union(a, b)?;
+        if identical_sets(a, b, &union_ab) {
+            return Ok(JaccardSimilarity::IDENTICAL);
+        }
+
+        // intersecting with the union guarantees the result is a subset of the union
+        let mut intersection = ThetaIntersection::new(self.seed);
+        intersection.update(a)?;
+        intersection.update(b)?;
+        intersection.update(&union_ab)?;
+        let inter_abu = intersection.to_sketch(false);
+
+        Ok(JaccardSimilarity {
+            lower_bound: bounds_on_ratios::lower_bound_for_b_over_a(&union_ab, &inter_abu)?,
+            estimate: bounds_on_ratios::estimate_of_b_over_a(&union_ab, &inter_abu)?,
+            upper_bound: bounds_on_ratios::upper_bound_for_b_over_a(&union_ab, &inter_abu)?,
+        })
+    }
+
+    /// Returns true if `a` and `b` retain exactly the same hashes with the same theta.
+    ///
+    /// This is stronger than a Jaccard index of 1.0 estimated from sampled data.
+    pub fn exactly_equal<A: ThetaSketchView, B: ThetaSketchView>(
+        &self,
+        a: &A,
+        b: &B,
+    ) -> Result<bool, Error> {
+        if std::ptr::addr_eq(a, b) || (a.is_empty() && b.is_empty()) {
+            return Ok(true);
+        }
+        if a.is_empty() || b.is_empty() {
+            return Ok(false);
+        }
+        let union_ab = self.union(a, b)?;
+        Ok(identical_sets(a, b, &union_ab))
+    }
+
+    /// Tests whether `actual` is similar to `expected` with a Jaccard index of at least
+    /// `threshold`.
+    ///
+    /// Returns true if the lower bound of the Jaccard index is at or above `threshold`, which
+    /// means the sets are similar with a confidence of about 97.7%.
+    pub fn similarity_test<A: ThetaSketchView, B: ThetaSketchView>(
+        &self,
+        actual: &A,
+        expected: &B,
+        threshold: f64,
+    ) -> Result<bool, Error> {
+        let jaccard = self.jaccard(actual, expected)?;
+        Ok(jaccard.lower_bound >= threshold)
+    }
+
+    /// Tests whether `actual` is dissimilar to `expected` with a Jaccard index of at most
+    /// `threshold`.
+    ///
+    /// Returns true if the upper bound of the Jaccard index is at or below `threshold`, which
+    /// means the sets are dissimilar with a confidence of about 97.7%.
+    pub fn dissimilarity_test<A: ThetaSketchView, B: ThetaSketchView>(
+        &self,
+        actual: &A,
+        expected: &B,
+        threshold: f64,
+    ) -> Result<bool, Error> {
+        let jaccard = self.jaccard(actual, expected)?;
+        Ok(jaccard.upper_bound <= threshold)
+    }
+
+    fn union<A: ThetaSketchView, B: ThetaSketchView>(
+        &self,
+        a: &A,
+        b: &B,
+    ) -> Result<CompactThetaSketch, Error> {
+        let count = (a.num_retained() + b.num_retained()).next_power_of_two();
+        let lg_k = (count.trailing_zeros() as u8).clamp(MIN_LG_K, MAX_LG_K);
+        let mut union = ThetaUnionBuilder::default()
+            .lg_k(lg_k)
+            .seed(self.seed)
+            .build();
+        union.update(a)?;
+        union.update(b)?;
+        Ok(union.to_sketch(false))
+    }
+}
+
+fn identical_sets<A: ThetaSketchView, B: ThetaSketchView>(
+    a: &A,
+    b: &B,
+    union_ab: &CompactThetaSketch,
+) -> bool {
+    union_ab.num_retained() == a.num_retained()
+        && union_ab.num_retained() == b.num_retained()
+        && union_ab.theta64() == a.theta()
+        && union_ab.theta64() == b.theta()
+}
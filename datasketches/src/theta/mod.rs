@@ -29,6 +29,19 @@
 //!
 //! * **ThetaSketch**: Mutable sketch for building from input data
 //! * **CompactThetaSketch**: Immutable sketch with compact memory layout
+//! * **CompactThetaWrapper**: Read-only view answering queries from a serialized compact sketch
+//! * **ConcurrentThetaSketch**: Sketch shared by many threads updating it through local buffers
+//! * **DirectThetaSketch**: Updatable sketch living in an external, possibly memory-mapped buffer
+//! * **ThetaUnion**, **ThetaIntersection** and **ThetaAnotB**: Set operations over sketches
+//! * **ThetaJaccardSimilarity**: Jaccard index estimation between two sketches
+//!
+//! # Error Bounds
+//!
+//! Bounds are computed from the number of retained entries and theta with the binomial
+//! approximation of Java's `BinomialBoundsN`. The result of an intersection or a set
+//! difference is a sketch like any other, so its bounds come from the entries that survived
+//! the operation: a small overlap of two large sets retains few entries and gets relatively
+//! wide bounds, and a result with no entries left below theta still has a non-zero upper bound.
 //!
 //! # Usage
 //!
@@ -39,18 +52,33 @@
 //! assert!(sketch.estimate() >= 1.0);
 //! ```
 
+mod a_not_b;
 mod bit_pack;
+mod concurrent;
+mod direct;
 mod hash_table;
 mod intersection;
+mod jaccard_similarity;
 mod serialization;
 mod sketch;
 mod union;
+mod wrapper;
 
+pub use self::a_not_b::ThetaAnotB;
+pub use self::concurrent::ConcurrentThetaBuffer;
+pub use self::concurrent::ConcurrentThetaSketch;
+pub use self::direct::DirectThetaSketch;
 pub use self::hash_table::ThetaEntry;
 pub use self::intersection::ThetaIntersection;
+pub use self::jaccard_similarity::JaccardSimilarity;
+pub use self::jaccard_similarity::ThetaJaccardSimilarity;
 pub use self::sketch::CompactThetaSketch;
 pub use self::sketch::ThetaSketch;
 pub use self::sketch::ThetaSketchBuilder;
 pub use self::sketch::ThetaSketchView;
 pub use self::union::ThetaUnion;
 pub use self::union::ThetaUnionBuilder;
+pub use self::wrapper::CompactThetaWrapper;
+
+/// A compact theta sketch shared read-only across threads.
+pub type SharedCompactThetaSketch = crate::common::SharedCompactSketch<CompactThetaSketch>;
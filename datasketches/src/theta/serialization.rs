@@ -17,9 +17,26 @@
 
 //! Binary serialization format constants for Theta sketches.
 
+use crate::error::Error;
+
 pub(super) const UNCOMPRESSED_SERIAL_VERSION: u8 = 3;
 pub(super) const COMPRESSED_SERIAL_VERSION: u8 = 4;
 
 pub(super) const V2_PREAMBLE_EMPTY: u8 = 1;
 pub(super) const V2_PREAMBLE_PRECISE: u8 = 2;
 pub(super) const V2_PREAMBLE_ESTIMATE: u8 = 3;
+
+/// Checks that the hashes of an image marked ordered strictly ascend, as the compressed form
+/// and the ordered set operations assume.
+pub(super) fn ensure_ascending(hashes: impl IntoIterator<Item = u64>) -> Result<(), Error> {
+    let mut previous = None;
+    for hash in hashes {
+        if previous.is_some_and(|previous| hash <= previous) {
+            return Err(Error::deserial(
+                "corrupted: hashes of an ordered image are not ascending",
+            ));
+        }
+        previous = Some(hash);
+    }
+    Ok(())
+}
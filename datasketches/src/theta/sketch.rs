@@ -21,17 +21,33 @@
 //! for cardinality estimation.
 
 use std::hash::Hash;
+use std::io;
+use std::io::Read;
+use std::io::Write;
 
 use crate::codec::SketchBytes;
 use crate::codec::SketchSlice;
 use crate::codec::assert::ensure_preamble_longs_in_range;
+use crate::codec::assert::ensure_seed_hash_is;
 use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
 use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::DistinctCountEstimator;
 use crate::common::NumStdDev;
 use crate::common::ResizeFactor;
+use crate::common::SketchConfig;
 use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::error::SketchError;
 use crate::hash::DEFAULT_UPDATE_SEED;
 use crate::hash::compute_seed_hash;
+use crate::theta::CompactThetaWrapper;
+use crate::theta::ConcurrentThetaSketch;
+use crate::theta::DirectThetaSketch;
 use crate::theta::bit_pack::BLOCK_WIDTH;
 use crate::theta::bit_pack::BitPacker;
 use crate::theta::bit_pack::BitUnpacker;
@@ -118,6 +134,32 @@ impl ThetaSketch {
         self.table.try_insert(value);
     }
 
+    /// Update the sketch with an already computed hash.
+    ///
+    /// `hash` is the first half of the MurmurHash3 of a value under this sketch's seed, as
+    /// returned by [`MurmurHash3X64128::finish128`](crate::hash::MurmurHash3X64128::finish128).
+    /// The sketch drops its lowest bit like [`update`](Self::update) does, so the same hash can
+    /// be shared with other sketches that hash with the same seed.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use std::hash::Hash;
+    /// # use datasketches::hash::DEFAULT_UPDATE_SEED;
+    /// # use datasketches::hash::MurmurHash3X64128;
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// let mut hasher = MurmurHash3X64128::with_seed(DEFAULT_UPDATE_SEED);
+    /// "apple".hash(&mut hasher);
+    /// let (h1, _) = hasher.finish128();
+    ///
+    /// let mut sketch = ThetaSketchBuilder::default().build();
+    /// sketch.update_hash(h1);
+    /// assert_eq!(sketch.estimate(), 1.0);
+    /// ```
+    pub fn update_hash(&mut self, hash: u64) {
+        self.table.try_insert_hash(hash >> 1);
+    }
+
     /// Return cardinality estimate
     ///
     /// # Examples
@@ -133,6 +175,9 @@ impl ThetaSketch {
             return 0.0;
         }
         let num_retained = self.table.num_retained() as f64;
+        if !self.is_estimation_mode() {
+            return num_retained;
+        }
         let theta = self.table.theta() as f64 / MAX_THETA as f64;
         num_retained / theta
     }
@@ -182,6 +227,38 @@ impl ThetaSketch {
         self.table.reset();
     }
 
+    /// Empties the sketch and gives it a new lg_k, for reusing sketches from a pool.
+    ///
+    /// As with [`reset`](Self::reset), the hash table keeps its allocation, so a sketch that
+    /// grew to a large table does not allocate again until it outgrows it. The resize factor,
+    /// sampling probability and seed are kept.
+    ///
+    /// # Panics
+    ///
+    /// If lg_k is not in range [5, 26]
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// let mut sketch = ThetaSketchBuilder::default().lg_k(12).build();
+    /// sketch.extend(0..10000);
+    ///
+    /// sketch.reconfigure(10);
+    /// assert!(sketch.is_empty());
+    /// assert_eq!(sketch.lg_k(), 10);
+    /// ```
+    pub fn reconfigure(&mut self, lg_k: u8) {
+        assert!(
+            (MIN_LG_K..=MAX_LG_K).contains(&lg_k),
+            "lg_k must be in [{}, {}], got {}",
+            MIN_LG_K,
+            MAX_LG_K,
+            lg_k
+        );
+        self.table.reset_with_lg_nom_size(lg_k);
+    }
+
     /// Return iterator over retained entries.
     ///
     /// # Examples
@@ -302,13 +379,47 @@ impl ThetaSketch {
     pub fn estimated_size(&self) -> usize {
         size_of::<Self>() + self.table.estimated_size()
     }
+
+    /// Returns the estimated size in bytes a sketch of `lg_k` can grow to, the bound of
+    /// [`estimated_size`](Self::estimated_size) once its hash table reached `2^(lg_k + 1)`
+    /// entries.
+    ///
+    /// # Panics
+    ///
+    /// If lg_k is not in range [5, 26]
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::theta::ThetaSketch;
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// let max_size = ThetaSketch::max_estimated_size(10);
+    ///
+    /// let mut sketch = ThetaSketchBuilder::default().lg_k(10).build();
+    /// assert!(sketch.estimated_size() < max_size);
+    /// sketch.extend(0..100_000);
+    /// assert_eq!(sketch.estimated_size(), max_size);
+    /// ```
+    pub fn max_estimated_size(lg_k: u8) -> usize {
+        assert!(
+            (MIN_LG_K..=MAX_LG_K).contains(&lg_k),
+            "lg_k must be in [{}, {}], got {}",
+            MIN_LG_K,
+            MAX_LG_K,
+            lg_k
+        );
+        size_of::<Self>() + ThetaHashTable::max_estimated_size(lg_k)
+    }
 }
 
 /// Compact (immutable) theta sketch.
 ///
 /// This is the serialized-friendly form of a theta sketch: a compact array of retained hash values
 /// plus theta and a 16-bit seed hash. It can be ordered (sorted ascending) or unordered.
-#[derive(Clone, Debug)]
+///
+/// `==` compares the representation, including the order of the entries; see
+/// [`is_equivalent`](Self::is_equivalent) to compare only the retained state.
+#[derive(Clone, Debug, PartialEq)]
 pub struct CompactThetaSketch {
     entries: Vec<u64>,
     theta: u64,
@@ -387,6 +498,43 @@ impl CompactThetaSketch {
         self.entries.iter().copied().map(ThetaEntry::new)
     }
 
+    /// Returns true if `other` retains the same hash values under the same theta and seed hash,
+    /// in any order.
+    ///
+    /// Two empty sketches are always equivalent. The retained state of a theta sketch is all
+    /// integers, so unlike the HLL and CPC counterparts this takes no tolerance.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// let mut sketch = ThetaSketchBuilder::default().build();
+    /// sketch.extend(0..1000);
+    /// let ordered = sketch.compact(true);
+    /// let unordered = sketch.compact(false);
+    ///
+    /// assert!(ordered.is_equivalent(&unordered));
+    /// ```
+    pub fn is_equivalent(&self, other: &CompactThetaSketch) -> bool {
+        if self.empty || other.empty {
+            return self.empty == other.empty;
+        }
+        if self.theta != other.theta
+            || self.seed_hash != other.seed_hash
+            || self.entries.len() != other.entries.len()
+        {
+            return false;
+        }
+        let sorted = |sketch: &CompactThetaSketch| {
+            let mut entries = sketch.entries.clone();
+            if !sketch.ordered {
+                entries.sort_unstable();
+            }
+            entries
+        };
+        sorted(self) == sorted(other)
+    }
+
     /// Returns the approximate lower error bound given the specified number of Standard Deviations.
     pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
         if !self.is_estimation_mode() {
@@ -442,8 +590,44 @@ impl CompactThetaSketch {
 
     /// Serializes this sketch into the uncompressed compact theta format.
     pub fn serialize(&self) -> Vec<u8> {
-        let mut bytes = SketchBytes::with_capacity(64 + self.entries.len() * 8);
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
 
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        8 * self.preamble_longs(false) as usize + 8 * self.entries.len()
+    }
+
+    /// Returns the image of this sketch with its hashes in ascending order, the form
+    /// `compact(true)` produces, whatever order the hashes are retained in.
+    fn canonical_image(&self) -> Vec<u8> {
+        if self.ordered {
+            return self.serialize();
+        }
+        let mut entries = self.entries.clone();
+        entries.sort_unstable();
+        Self::from_parts(entries, self.theta, self.seed_hash, true, self.empty).serialize()
+    }
+
+    /// Serializes this sketch like [`serialize`](Self::serialize) into `buf`, returning the
+    /// number of bytes written.
+    ///
+    /// Returns an error if `buf` is shorter than
+    /// [`serialized_size_bytes`](Self::serialized_size_bytes).
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Streams this sketch to `writer` in the format of [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
         let pre_longs = self.preamble_longs(false);
         bytes.write_u8(pre_longs);
         bytes.write_u8(serialization::UNCOMPRESSED_SERIAL_VERSION);
@@ -473,7 +657,6 @@ impl CompactThetaSketch {
         for hash in self.entries.iter() {
             bytes.write_u64_le(*hash);
         }
-        bytes.into_bytes()
     }
 
     fn serialize_v4(&self) -> Vec<u8> {
@@ -562,13 +745,44 @@ impl CompactThetaSketch {
     }
 
     /// Deserializes a compact theta sketch from bytes.
+    ///
+    /// Besides the current serial versions 3 and 4, this reads the legacy serial version 1 and 2
+    /// images written by older Java releases.
     pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
         Self::deserialize_with_seed(bytes, DEFAULT_UPDATE_SEED)
     }
 
+    /// Reads a compact theta sketch from `reader`, consuming exactly the bytes of its image.
+    ///
+    /// Fails like [`deserialize`](Self::deserialize); a failing `reader` is reported as
+    /// insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_from_with_seed(reader, DEFAULT_UPDATE_SEED)
+    }
+
+    /// Reads a compact theta sketch from `reader` using the provided expected seed.
+    pub fn read_from_with_seed(reader: &mut impl Read, seed: u64) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader), seed)
+    }
+
     /// Deserializes a compact theta sketch from bytes using the provided expected seed.
     pub fn deserialize_with_seed(bytes: &[u8], seed: u64) -> Result<Self, Error> {
-        let mut cursor = SketchSlice::new(bytes);
+        Self::read_image(SketchSlice::new(bytes), seed)
+    }
+
+    /// Wraps a serial version 3 or 4 image for queries, without copying or decoding it.
+    ///
+    /// See [`CompactThetaWrapper`] for what is validated up front.
+    pub fn wrap(bytes: &[u8]) -> Result<CompactThetaWrapper<'_>, Error> {
+        CompactThetaWrapper::new(bytes)
+    }
+
+    /// Wraps a serial version 3 or 4 image written with the provided seed.
+    pub fn wrap_with_seed(bytes: &[u8], seed: u64) -> Result<CompactThetaWrapper<'_>, Error> {
+        CompactThetaWrapper::new_with_seed(bytes, seed)
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>, seed: u64) -> Result<Self, Error> {
         let pre_longs = cursor
             .read_u8()
             .map_err(insufficient_data("preamble_longs"))?;
@@ -586,13 +800,18 @@ impl CompactThetaSketch {
         )?;
 
         match ser_ver {
-            1 => Self::deserialize_v1(cursor, seed),
+            1 => Self::deserialize_v1(pre_longs, cursor, seed),
             2 => Self::deserialize_v2(pre_longs, cursor, seed),
             3 => Self::deserialize_v3(pre_longs, cursor, seed),
             4 => Self::deserialize_v4(pre_longs, cursor, seed),
-            _ => Err(Error::deserial(format!(
-                "unsupported serial version: expected 1, 2, 3, or 4, got {ser_ver}",
-            ))),
+            _ => Err(Error::new(
+                ErrorKind::UnsupportedVersion,
+                format!("unsupported serial version: expected 1, 2, 3, or 4, got {ser_ver}"),
+            )
+            .with_reason(SketchError::UnsupportedSerialVersion {
+                expected: 4,
+                actual: ser_ver,
+            })),
         }
     }
 
@@ -600,8 +819,9 @@ impl CompactThetaSketch {
         cursor: &mut SketchSlice<'_>,
         num_entries: usize,
         theta: u64,
+        ordered: bool,
     ) -> Result<Vec<u64>, Error> {
-        let mut entries = Vec::with_capacity(num_entries);
+        let mut entries = Vec::with_capacity(cursor.capacity_hint(num_entries, 8));
         for _ in 0..num_entries {
             let hash = cursor.read_u64_le().map_err(insufficient_data("entries"))?;
             if hash == 0 || hash >= theta {
@@ -609,10 +829,21 @@ impl CompactThetaSketch {
             }
             entries.push(hash);
         }
+        if ordered {
+            serialization::ensure_ascending(entries.iter().copied())?;
+        }
         Ok(entries)
     }
 
-    fn deserialize_v1(mut cursor: SketchSlice<'_>, expected_seed: u64) -> Result<Self, Error> {
+    fn deserialize_v1(
+        pre_longs: u8,
+        mut cursor: SketchSlice<'_>,
+        expected_seed: u64,
+    ) -> Result<Self, Error> {
+        // Serial version 1 images always carry the full three-long preamble.
+        if pre_longs != 3 {
+            return Err(Error::invalid_preamble_longs(&[3], pre_longs));
+        }
         let seed_hash = compute_seed_hash(expected_seed);
         cursor.read_u8().map_err(insufficient_data("<unused>"))?;
         cursor
@@ -639,7 +870,7 @@ impl CompactThetaSketch {
             });
         }
 
-        let entries = Self::read_entries(&mut cursor, num_entries, theta)?;
+        let entries = Self::read_entries(&mut cursor, num_entries, theta, true)?;
 
         Ok(Self {
             entries,
@@ -663,11 +894,7 @@ impl CompactThetaSketch {
             .read_u16_le()
             .map_err(insufficient_data("seed_hash"))?;
         let expected_seed_hash = compute_seed_hash(expected_seed);
-        if seed_hash != expected_seed_hash {
-            return Err(Error::deserial(format!(
-                "incompatible seed hash: expected {expected_seed_hash}, got {seed_hash}",
-            )));
-        }
+        ensure_seed_hash_is(expected_seed_hash, seed_hash)?;
 
         match pre_longs {
             V2_PREAMBLE_EMPTY => Ok(Self {
@@ -685,13 +912,13 @@ impl CompactThetaSketch {
                 cursor
                     .read_u32_le()
                     .map_err(insufficient_data("<unused_u32>"))?;
-                let entries = Self::read_entries(&mut cursor, num_entries, MAX_THETA)?;
+                let entries = Self::read_entries(&mut cursor, num_entries, MAX_THETA, true)?;
                 Ok(Self {
+                    empty: entries.is_empty(),
                     entries,
                     theta: MAX_THETA,
                     seed_hash,
                     ordered: true,
-                    empty: true,
                 })
             }
             V2_PREAMBLE_ESTIMATE => {
@@ -706,7 +933,7 @@ impl CompactThetaSketch {
                     .read_u64_le()
                     .map_err(insufficient_data("theta_long"))?;
                 let empty = (num_entries == 0) && (theta == MAX_THETA);
-                let entries = Self::read_entries(&mut cursor, num_entries, theta)?;
+                let entries = Self::read_entries(&mut cursor, num_entries, theta, true)?;
                 Ok(Self {
                     entries,
                     theta,
@@ -733,16 +960,13 @@ impl CompactThetaSketch {
             .map_err(insufficient_data("seed_hash"))?;
 
         let empty = (flags & FLAGS_IS_EMPTY) != 0;
+        let ordered = (flags & FLAGS_IS_ORDERED) != 0;
         let mut theta = MAX_THETA;
         let num_entries;
         let mut entries = vec![];
         if !empty {
             let expected_seed_hash = compute_seed_hash(expected_seed);
-            if seed_hash != expected_seed_hash {
-                return Err(Error::deserial(format!(
-                    "incompatible seed hash: expected {expected_seed_hash}, got {seed_hash}",
-                )));
-            }
+            ensure_seed_hash_is(expected_seed_hash, seed_hash)?;
             if pre_longs == 1 {
                 num_entries = 1;
             } else {
@@ -758,9 +982,8 @@ impl CompactThetaSketch {
                         .map_err(insufficient_data("theta_long"))?;
                 }
             }
-            entries = Self::read_entries(&mut cursor, num_entries as usize, theta)?;
+            entries = Self::read_entries(&mut cursor, num_entries as usize, theta, ordered)?;
         }
-        let ordered = (flags & FLAGS_IS_ORDERED) != 0;
         Ok(Self {
             entries,
             theta,
@@ -784,11 +1007,7 @@ impl CompactThetaSketch {
         let empty = (flags & FLAGS_IS_EMPTY) != 0;
         if !empty {
             let expected_seed_hash = compute_seed_hash(expected_seed);
-            if seed_hash != expected_seed_hash {
-                return Err(Error::deserial(format!(
-                    "incompatible seed hash: expected {expected_seed_hash}, got {seed_hash}",
-                )));
-            }
+            ensure_seed_hash_is(expected_seed_hash, seed_hash)?;
         }
         let theta = if pre_longs > 1 {
             cursor
@@ -798,6 +1017,17 @@ impl CompactThetaSketch {
             MAX_THETA
         };
 
+        if !(1..=63).contains(&entry_bits) {
+            return Err(Error::deserial(format!(
+                "entry_bits must be in [1, 63], got {entry_bits}"
+            )));
+        }
+        if !(1..=4).contains(&num_entries_bytes) {
+            return Err(Error::deserial(format!(
+                "num_entries_bytes must be in [1, 4], got {num_entries_bytes}"
+            )));
+        }
+
         // unpack num_entries
         let mut num_entries = 0usize;
         for i in 0..num_entries_bytes {
@@ -809,12 +1039,14 @@ impl CompactThetaSketch {
 
         // unpack blocks of BLOCK_WIDTH deltas
         let mut i = 0usize;
-        let mut entries = vec![0u64; num_entries];
+        let entry_bytes = (entry_bits as usize / 8).max(1);
+        let mut entries = Vec::with_capacity(cursor.capacity_hint(num_entries, entry_bytes));
         while i + BLOCK_WIDTH <= num_entries {
             let mut block = vec![0u8; entry_bits as usize];
             cursor
                 .read_exact(&mut block)
                 .map_err(insufficient_data("delta_block"))?;
+            entries.resize(i + BLOCK_WIDTH, 0);
             unpack_bits_block(&mut entries[i..i + BLOCK_WIDTH], &block, entry_bits);
             i += BLOCK_WIDTH;
         }
@@ -830,7 +1062,8 @@ impl CompactThetaSketch {
                 .map_err(insufficient_data("delta_tail"))?;
 
             let mut unpacker = BitUnpacker::new(&tail);
-            for slot in entries.iter_mut().take(num_entries).skip(i) {
+            entries.resize(num_entries, 0);
+            for slot in entries.iter_mut().skip(i) {
                 *slot = unpacker.unpack_value(entry_bits);
             }
         }
@@ -838,7 +1071,9 @@ impl CompactThetaSketch {
         // undo deltas
         let mut previous = 0;
         for e in &mut entries {
-            *e += previous;
+            *e = e
+                .checked_add(previous)
+                .ok_or_else(|| Error::deserial("corrupted: invalid retained hash value"))?;
             previous = *e;
             if *e == 0 || *e >= theta {
                 return Err(Error::deserial("corrupted: invalid retained hash value"));
@@ -860,6 +1095,39 @@ impl CompactThetaSketch {
     pub fn estimated_size(&self) -> usize {
         size_of::<Self>() + self.entries.capacity() * size_of::<u64>()
     }
+
+    /// Returns the size in bytes that [`serialize`](Self::serialize) can produce for the
+    /// compact form of a sketch, union or set operation result of `lg_k`.
+    ///
+    /// This is the size of an estimation mode image retaining as many hashes as the hash table
+    /// of an update sketch holds before it is rebuilt, `15/16` of `2^(lg_k + 1)`.
+    ///
+    /// # Panics
+    ///
+    /// If lg_k is not in range [5, 26]
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::theta::CompactThetaSketch;
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// let max_size = CompactThetaSketch::max_serialized_bytes(10);
+    /// assert_eq!(max_size, 24 + 8 * 1920);
+    ///
+    /// let mut sketch = ThetaSketchBuilder::default().lg_k(10).build();
+    /// sketch.extend(0..100_000);
+    /// assert!(sketch.compact(false).serialize().len() <= max_size);
+    /// ```
+    pub fn max_serialized_bytes(lg_k: u8) -> usize {
+        assert!(
+            (MIN_LG_K..=MAX_LG_K).contains(&lg_k),
+            "lg_k must be in [{}, {}], got {}",
+            MIN_LG_K,
+            MAX_LG_K,
+            lg_k
+        );
+        8 * Family::THETA.max_pre_longs as usize + 8 * ThetaHashTable::max_retained(lg_k)
+    }
 }
 
 impl RawThetaSketchView<ThetaEntry> for CompactThetaSketch {
@@ -979,6 +1247,21 @@ impl ThetaSketchBuilder {
         self
     }
 
+    /// Apply the lg_k and seed of `config`, where set.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the lg_k of `config` is outside of the range accepted by [`lg_k`](Self::lg_k).
+    pub fn config(mut self, config: &SketchConfig) -> Self {
+        if let Some(lg_k) = config.lg_k {
+            self = self.lg_k(lg_k);
+        }
+        if let Some(seed) = config.seed {
+            self = self.seed(seed);
+        }
+        self
+    }
+
     /// Build the ThetaSketch.
     ///
     /// # Examples
@@ -997,8 +1280,122 @@ impl ThetaSketchBuilder {
 
         ThetaSketch { table }
     }
+
+    /// Build a [`ConcurrentThetaSketch`] for updates from many threads.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// let sketch = ThetaSketchBuilder::default().lg_k(10).build_concurrent();
+    /// let mut buffer = sketch.buffer();
+    /// buffer.update("apple");
+    /// buffer.flush();
+    /// assert_eq!(sketch.estimate(), 1.0);
+    /// ```
+    pub fn build_concurrent(self) -> ConcurrentThetaSketch {
+        let seed = self.seed;
+        ConcurrentThetaSketch::new(self.build(), seed)
+    }
+
+    /// Build a [`DirectThetaSketch`] over `bytes`, overwriting its contents.
+    ///
+    /// The buffer must hold at least
+    /// [`DirectThetaSketch::required_size_bytes`] for the configured lg_k; otherwise an
+    /// `InvalidArgument` error is returned.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::theta::DirectThetaSketch;
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// let mut buf = vec![0u8; DirectThetaSketch::required_size_bytes(10)];
+    /// let mut sketch = ThetaSketchBuilder::default()
+    ///     .lg_k(10)
+    ///     .build_direct(&mut buf)
+    ///     .unwrap();
+    /// sketch.update("apple");
+    /// assert_eq!(sketch.estimate(), 1.0);
+    /// ```
+    pub fn build_direct(self, bytes: &mut [u8]) -> Result<DirectThetaSketch<'_>, Error> {
+        DirectThetaSketch::initialize(
+            bytes,
+            self.lg_k,
+            self.resize_factor,
+            self.sampling_probability,
+            self.seed,
+        )
+    }
+}
+
+/// Updates the sketch with every value of the iterator, as [`ThetaSketch::update`] does.
+impl<T: Hash> Extend<T> for ThetaSketch {
+    fn extend<I: IntoIterator<Item = T>>(&mut self, iter: I) {
+        for value in iter {
+            self.update(value);
+        }
+    }
 }
 
+/// Collects the values into a sketch with the defaults of [`ThetaSketchBuilder`].
+impl<T: Hash> FromIterator<T> for ThetaSketch {
+    fn from_iter<I: IntoIterator<Item = T>>(iter: I) -> Self {
+        let mut sketch = ThetaSketchBuilder::default().build();
+        sketch.extend(iter);
+        sketch
+    }
+}
+
+impl DistinctCountEstimator for ThetaSketch {
+    fn is_empty(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn is_exact(&self) -> bool {
+        !self.is_estimation_mode()
+    }
+
+    fn estimate(&self) -> f64 {
+        self.estimate()
+    }
+
+    fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.lower_bound(num_std_dev)
+    }
+
+    fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.upper_bound(num_std_dev)
+    }
+}
+
+impl DistinctCountEstimator for CompactThetaSketch {
+    fn is_empty(&self) -> bool {
+        self.is_empty()
+    }
+
+    fn is_exact(&self) -> bool {
+        !self.is_estimation_mode()
+    }
+
+    fn estimate(&self) -> f64 {
+        self.estimate()
+    }
+
+    fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.lower_bound(num_std_dev)
+    }
+
+    fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.upper_bound(num_std_dev)
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(CompactThetaSketch);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(CompactThetaSketch);
+impl_fingerprint_via_image!([] CompactThetaSketch, |s| s.canonical_image());
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -1163,7 +1560,7 @@ mod tests {
         bytes[1] = 99;
 
         let err = CompactThetaSketch::deserialize(&bytes).unwrap_err();
-        assert_eq!(err.kind(), crate::error::ErrorKind::InvalidData);
+        assert_eq!(err.kind(), crate::error::ErrorKind::UnsupportedVersion);
         assert!(err.message().contains("unsupported serial version"));
     }
 
@@ -1180,4 +1577,77 @@ mod tests {
         assert_eq!(err.kind(), crate::error::ErrorKind::InvalidData);
         assert!(err.message().contains("insufficient data"));
     }
+
+    fn legacy_image(pre_longs: u8, ser_ver: u8, seed_hash: u16, num_entries: u32) -> Vec<u8> {
+        let mut bytes = vec![pre_longs, ser_ver, Family::THETA.id, 0, 0, 0];
+        bytes.extend_from_slice(&seed_hash.to_le_bytes());
+        if pre_longs > 1 {
+            bytes.extend_from_slice(&num_entries.to_le_bytes());
+            bytes.extend_from_slice(&1.0f32.to_le_bytes());
+        }
+        bytes
+    }
+
+    #[test]
+    fn deserialize_serial_version_1() {
+        let mut theta = ThetaSketchBuilder::default().lg_k(5).build();
+        for i in 0..5000 {
+            theta.update(i);
+        }
+        let compact = theta.compact(true);
+
+        // Version 1 has no seed hash and always stores theta.
+        let mut bytes = legacy_image(3, 1, 0, compact.num_retained() as u32);
+        bytes.extend_from_slice(&compact.theta64().to_le_bytes());
+        for hash in &compact.entries {
+            bytes.extend_from_slice(&hash.to_le_bytes());
+        }
+        let decoded = CompactThetaSketch::deserialize(&bytes).unwrap();
+        assert_compact_equivalent(&compact, &decoded);
+
+        let mut empty = legacy_image(3, 1, 0, 0);
+        empty.extend_from_slice(&MAX_THETA.to_le_bytes());
+        assert!(CompactThetaSketch::deserialize(&empty).unwrap().is_empty());
+
+        bytes[0] = 2;
+        let err = CompactThetaSketch::deserialize(&bytes).unwrap_err();
+        assert!(err.message().contains("preamble"));
+    }
+
+    #[test]
+    fn deserialize_serial_version_2() {
+        let seed_hash = compute_seed_hash(DEFAULT_UPDATE_SEED);
+
+        let empty = legacy_image(1, 2, seed_hash, 0);
+        assert!(CompactThetaSketch::deserialize(&empty).unwrap().is_empty());
+
+        let mut exact = ThetaSketchBuilder::default().build();
+        for i in 0..100 {
+            exact.update(i);
+        }
+        let compact = exact.compact(true);
+        let mut bytes = legacy_image(2, 2, seed_hash, compact.num_retained() as u32);
+        for hash in &compact.entries {
+            bytes.extend_from_slice(&hash.to_le_bytes());
+        }
+        let decoded = CompactThetaSketch::deserialize(&bytes).unwrap();
+        assert!(!decoded.is_empty());
+        assert_compact_equivalent(&compact, &decoded);
+
+        let mut estimation = ThetaSketchBuilder::default().lg_k(5).build();
+        for i in 0..5000 {
+            estimation.update(i);
+        }
+        let compact = estimation.compact(true);
+        let mut bytes = legacy_image(3, 2, seed_hash, compact.num_retained() as u32);
+        bytes.extend_from_slice(&compact.theta64().to_le_bytes());
+        for hash in &compact.entries {
+            bytes.extend_from_slice(&hash.to_le_bytes());
+        }
+        let decoded = CompactThetaSketch::deserialize(&bytes).unwrap();
+        assert_compact_equivalent(&compact, &decoded);
+
+        let err = CompactThetaSketch::deserialize_with_seed(&bytes, 7).unwrap_err();
+        assert!(err.message().contains("incompatible seed hash"));
+    }
 }
@@ -15,10 +15,20 @@
 // specific language governing permissions and limitations
 // under the License.
 
+use std::borrow::Borrow;
+use std::iter::Sum;
+
+#[cfg(feature = "aggregator")]
+use crate::aggregator::ImageUnion;
+use crate::common::MergeableSketch;
 use crate::common::ResizeFactor;
+use crate::common::SketchConfig;
+#[cfg(feature = "rayon")]
+use crate::common::parallel::tree_reduce;
 use crate::error::Error;
 use crate::hash::DEFAULT_UPDATE_SEED;
 use crate::theta::CompactThetaSketch;
+use crate::theta::CompactThetaWrapper;
 use crate::theta::ThetaSketchView;
 use crate::theta::hash_table::ThetaEntry;
 use crate::thetacommon::constants::DEFAULT_LG_K;
@@ -46,7 +56,43 @@ impl ThetaUnion {
         self.raw.update(sketch)
     }
 
+    /// Update this union with a serialized compact sketch.
+    ///
+    /// Serial version 3 and 4 images are merged straight from the bytes through a
+    /// [`CompactThetaWrapper`], streaming their hashes into the union without building an
+    /// intermediate sketch. The legacy serial version 1 and 2 images are deserialized first.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `bytes` is not a valid compact Theta image or was written with a
+    /// different seed than the union's.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// # use datasketches::theta::ThetaUnionBuilder;
+    /// let mut sketch = ThetaSketchBuilder::default().build();
+    /// sketch.extend(0..1000);
+    /// let compact = sketch.compact(true);
+    ///
+    /// let mut union = ThetaUnionBuilder::default().build();
+    /// union.update_bytes(&compact.serialize()).unwrap();
+    /// union.update_bytes(&compact.serialize_compressed()).unwrap();
+    /// assert_eq!(union.to_sketch(true).estimate(), 1000.0);
+    /// ```
+    pub fn update_bytes(&mut self, bytes: &[u8]) -> Result<(), Error> {
+        let seed = self.raw.hash_seed();
+        match bytes.get(1) {
+            Some(1 | 2) => self.update(&CompactThetaSketch::deserialize_with_seed(bytes, seed)?),
+            _ => self.update(&CompactThetaWrapper::new_with_seed(bytes, seed)?),
+        }
+    }
+
     /// Return this union as a compact sketch.
+    ///
+    /// The result retains at most the k nominal entries of the union, whatever the sizes of
+    /// the sketches it was updated with, as Java's `getResult` does.
     pub fn to_sketch(&self, ordered: bool) -> CompactThetaSketch {
         let parts = self.raw.to_compact_parts(ordered);
         CompactThetaSketch::from_parts(
@@ -66,6 +112,11 @@ impl ThetaUnion {
     pub fn reset(&mut self) {
         self.raw.reset();
     }
+
+    /// Returns the estimated size of the union in bytes
+    pub fn estimated_size(&self) -> usize {
+        size_of::<Self>() + self.raw.estimated_size()
+    }
 }
 
 /// Builder for [`ThetaUnion`].
@@ -91,6 +142,10 @@ impl Default for ThetaUnionBuilder {
 impl ThetaUnionBuilder {
     /// Set lg_k (log2 of nominal size k).
     ///
+    /// This is independent of the lg_k of the sketches fed to the union. The union keeps its
+    /// hash table at nominal size k, so its memory stays bounded however large the inputs are,
+    /// and [`ThetaUnion::to_sketch`] trims the result to k entries.
+    ///
     /// # Panics
     ///
     /// If lg_k is not in range [5, 26]
@@ -152,6 +207,21 @@ impl ThetaUnionBuilder {
         self
     }
 
+    /// Apply the lg_k and seed of `config`, where set.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the lg_k of `config` is outside of the range accepted by [`lg_k`](Self::lg_k).
+    pub fn config(mut self, config: &SketchConfig) -> Self {
+        if let Some(lg_k) = config.lg_k {
+            self = self.lg_k(lg_k);
+        }
+        if let Some(seed) = config.seed {
+            self = self.seed(seed);
+        }
+        self
+    }
+
     /// Build the ThetaUnion.
     ///
     /// # Examples
@@ -171,4 +241,92 @@ impl ThetaUnionBuilder {
             ),
         }
     }
+
+    /// Build a union of a collection of serialized sketches, merging them in parallel.
+    ///
+    /// The images are merged in a tree reduction on the rayon thread pool: chunks of images
+    /// are deserialized with this builder's seed and merged into partial unions built from this
+    /// builder, which are then merged pairwise. The first image that fails to deserialize,
+    /// including one written with another seed, is reported as an error.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::theta::ThetaSketchBuilder;
+    /// # use datasketches::theta::ThetaUnionBuilder;
+    /// let images: Vec<Vec<u8>> = (0..100)
+    ///     .map(|p| {
+    ///         let mut sketch = ThetaSketchBuilder::default().build();
+    ///         sketch.update(p);
+    ///         sketch.compact(true).serialize()
+    ///     })
+    ///     .collect();
+    ///
+    /// let union = ThetaUnionBuilder::default()
+    ///     .par_union_serialized(&images)
+    ///     .unwrap();
+    /// assert_eq!(union.to_sketch(true).estimate(), 100.0);
+    /// ```
+    #[cfg(feature = "rayon")]
+    pub fn par_union_serialized<B>(self, images: &[B]) -> Result<ThetaUnion, Error>
+    where
+        B: AsRef<[u8]> + Sync,
+    {
+        let leaf = |chunk: &[B]| {
+            let mut union = self.clone().build();
+            for image in chunk {
+                union.update(&CompactThetaSketch::deserialize_with_seed(
+                    image.as_ref(),
+                    self.seed,
+                )?)?;
+            }
+            Ok(union)
+        };
+        let combine = |mut left: ThetaUnion, right: ThetaUnion| {
+            left.update(&right.to_sketch(false))?;
+            Ok(left)
+        };
+        tree_reduce(images, &leaf, &combine)
+    }
+}
+
+impl<S: ThetaSketchView> MergeableSketch<S> for ThetaUnion {
+    fn merge(&mut self, other: &S) -> Result<(), Error> {
+        self.update(other)
+    }
+}
+
+/// Unions the sketches with a [`ThetaUnion`] of the defaults of [`ThetaUnionBuilder`] into an
+/// ordered compact sketch.
+///
+/// Returns an error if a sketch was not built with the default seed.
+impl Sum<CompactThetaSketch> for Result<CompactThetaSketch, Error> {
+    fn sum<I: Iterator<Item = CompactThetaSketch>>(iter: I) -> Self {
+        union_all(iter)
+    }
+}
+
+/// Unions the sketches, as the `Sum<CompactThetaSketch>` impl does.
+impl<'a> Sum<&'a CompactThetaSketch> for Result<CompactThetaSketch, Error> {
+    fn sum<I: Iterator<Item = &'a CompactThetaSketch>>(iter: I) -> Self {
+        union_all(iter)
+    }
+}
+
+fn union_all<S: Borrow<CompactThetaSketch>>(
+    sketches: impl Iterator<Item = S>,
+) -> Result<CompactThetaSketch, Error> {
+    let mut union = ThetaUnionBuilder::default().build();
+    for sketch in sketches {
+        union.update(sketch.borrow())?;
+    }
+    Ok(union.to_sketch(true))
+}
+
+/// Deserializes the image as a compact sketch with the seed of the union.
+#[cfg(feature = "aggregator")]
+impl ImageUnion for ThetaUnion {
+    fn update_image(&mut self, image: &[u8]) -> Result<(), Error> {
+        self.update_bytes(image)
+    }
 }
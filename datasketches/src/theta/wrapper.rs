@@ -0,0 +1,434 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! A read-only view over a serialized compact Theta sketch
+//!
+//! [`CompactThetaWrapper`] reads the preamble of a serial version 3 or 4 image and answers
+//! estimate queries directly from the borrowed bytes. Retained hashes are decoded on demand
+//! while iterating, so wrapping a sketch never allocates.
+
+use std::slice::ChunksExact;
+
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in_range;
+use crate::codec::assert::ensure_seed_hash_is;
+use crate::codec::assert::insufficient_data;
+use crate::codec::family::Family;
+use crate::common::NumStdDev;
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::error::SketchError;
+use crate::hash::DEFAULT_UPDATE_SEED;
+use crate::hash::compute_seed_hash;
+use crate::theta::ThetaEntry;
+use crate::theta::bit_pack::BitUnpacker;
+use crate::theta::serialization;
+use crate::theta::serialization::COMPRESSED_SERIAL_VERSION;
+use crate::theta::serialization::UNCOMPRESSED_SERIAL_VERSION;
+use crate::thetacommon::RawThetaSketchView;
+use crate::thetacommon::binomial_bounds;
+use crate::thetacommon::constants::FLAGS_IS_EMPTY;
+use crate::thetacommon::constants::FLAGS_IS_ORDERED;
+use crate::thetacommon::constants::MAX_THETA;
+
+/// A read-only view of a serialized image of a
+/// [`CompactThetaSketch`](super::CompactThetaSketch).
+///
+/// The wrapper borrows the image and never copies it, which makes it suitable for evaluating a
+/// large number of stored sketches. Both the uncompressed (serial version 3) and the compressed
+/// (serial version 4) formats are accepted. A wrapped sketch answers the estimate and bound
+/// queries of a compact sketch, and is a [`ThetaSketchView`](super::ThetaSketchView), so it can
+/// be passed to a union, an intersection or a set difference as it is.
+///
+/// Only the preamble and the length of the image are validated. The retained hashes are read
+/// while iterating, which skips the zero hashes and the hashes not below theta that only a
+/// corrupted image holds; use [`deserialize`](super::CompactThetaSketch::deserialize) to
+/// validate every hash.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::theta::CompactThetaSketch;
+/// # use datasketches::theta::ThetaSketchBuilder;
+/// let mut sketch = ThetaSketchBuilder::default().build();
+/// sketch.extend(0..10000);
+/// let compact = sketch.compact(true);
+///
+/// for bytes in [compact.serialize(), compact.serialize_compressed()] {
+///     let wrapped = CompactThetaSketch::wrap(&bytes).unwrap();
+///     assert_eq!(wrapped.estimate(), compact.estimate());
+///     assert!(
+///         wrapped
+///             .iter()
+///             .map(|e| e.hash())
+///             .eq(compact.iter().map(|e| e.hash()))
+///     );
+/// }
+/// ```
+#[derive(Debug, Clone)]
+pub struct CompactThetaWrapper<'a> {
+    theta: u64,
+    seed_hash: u16,
+    ordered: bool,
+    empty: bool,
+    num_entries: usize,
+    entries: Entries<'a>,
+}
+
+#[derive(Debug, Clone)]
+enum Entries<'a> {
+    /// Serial version 3: each hash as 8 little-endian bytes
+    Raw(&'a [u8]),
+    /// Serial version 4: the deltas between ascending hashes, `entry_bits` bits each
+    Packed { entry_bits: u8, data: &'a [u8] },
+}
+
+impl<'a> CompactThetaWrapper<'a> {
+    /// Creates a new `CompactThetaWrapper` from the given byte slice without copying bytes,
+    /// expecting an image written with the default seed.
+    pub fn new(bytes: &'a [u8]) -> Result<Self, Error> {
+        Self::new_with_seed(bytes, DEFAULT_UPDATE_SEED)
+    }
+
+    /// Creates a new `CompactThetaWrapper` from the given byte slice without copying bytes,
+    /// expecting an image written with `seed`.
+    ///
+    /// The preamble is validated and the slice is checked to be long enough for the entries it
+    /// declares. The entries themselves are not inspected, except that the hashes of an
+    /// uncompressed image marked ordered are checked to ascend.
+    pub fn new_with_seed(bytes: &'a [u8], seed: u64) -> Result<Self, Error> {
+        let mut cursor = SketchSlice::new(bytes);
+        let pre_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?;
+        let ser_ver = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+
+        Family::THETA.validate_id(family_id)?;
+        ensure_preamble_longs_in_range(
+            Family::THETA.min_pre_longs..=Family::THETA.max_pre_longs,
+            pre_longs,
+        )?;
+
+        match ser_ver {
+            UNCOMPRESSED_SERIAL_VERSION => Self::wrap_v3(pre_longs, cursor, bytes, seed),
+            COMPRESSED_SERIAL_VERSION => Self::wrap_v4(pre_longs, cursor, bytes, seed),
+            _ => Err(Error::new(
+                ErrorKind::UnsupportedVersion,
+                format!(
+                    "unsupported serial version: expected 3 or 4, got {ser_ver}; \
+                     deserialize reads the older versions",
+                ),
+            )
+            .with_reason(SketchError::UnsupportedSerialVersion {
+                expected: COMPRESSED_SERIAL_VERSION,
+                actual: ser_ver,
+            })),
+        }
+    }
+
+    fn wrap_v3(
+        pre_longs: u8,
+        mut cursor: SketchSlice<'_>,
+        bytes: &'a [u8],
+        seed: u64,
+    ) -> Result<Self, Error> {
+        cursor
+            .read_u16_le()
+            .map_err(insufficient_data("<unused_u16>"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let seed_hash = cursor
+            .read_u16_le()
+            .map_err(insufficient_data("seed_hash"))?;
+
+        let empty = (flags & FLAGS_IS_EMPTY) != 0;
+        let mut theta = MAX_THETA;
+        let mut num_entries = 0;
+        if !empty {
+            ensure_seed_hash_is(compute_seed_hash(seed), seed_hash)?;
+            if pre_longs == 1 {
+                num_entries = 1;
+            } else {
+                num_entries = cursor
+                    .read_u32_le()
+                    .map_err(insufficient_data("num_entries"))?
+                    as usize;
+                cursor
+                    .read_u32_le()
+                    .map_err(insufficient_data("<unused_u32>"))?;
+                if pre_longs > 2 {
+                    theta = cursor
+                        .read_u64_le()
+                        .map_err(insufficient_data("theta_long"))?;
+                }
+            }
+        }
+
+        let data = entries_at(bytes, &cursor, num_entries * 8)?;
+        let ordered = (flags & FLAGS_IS_ORDERED) != 0;
+        if ordered {
+            serialization::ensure_ascending(
+                data.chunks_exact(8)
+                    .map(|chunk| u64::from_le_bytes(chunk.try_into().unwrap())),
+            )?;
+        }
+
+        Ok(Self {
+            theta,
+            seed_hash,
+            ordered,
+            empty,
+            num_entries,
+            entries: Entries::Raw(data),
+        })
+    }
+
+    fn wrap_v4(
+        pre_longs: u8,
+        mut cursor: SketchSlice<'_>,
+        bytes: &'a [u8],
+        seed: u64,
+    ) -> Result<Self, Error> {
+        let entry_bits = cursor.read_u8().map_err(insufficient_data("entry_bits"))?;
+        let num_entries_bytes = cursor.read_u8().map_err(insufficient_data("num_entries"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let seed_hash = cursor
+            .read_u16_le()
+            .map_err(insufficient_data("seed_hash"))?;
+        let empty = (flags & FLAGS_IS_EMPTY) != 0;
+        if !empty {
+            ensure_seed_hash_is(compute_seed_hash(seed), seed_hash)?;
+        }
+        let theta = if pre_longs > 1 {
+            cursor
+                .read_u64_le()
+                .map_err(insufficient_data("theta_long"))?
+        } else {
+            MAX_THETA
+        };
+
+        if !(1..=63).contains(&entry_bits) {
+            return Err(Error::deserial(format!(
+                "entry_bits must be in [1, 63], got {entry_bits}"
+            )));
+        }
+        if !(1..=4).contains(&num_entries_bytes) {
+            return Err(Error::deserial(format!(
+                "num_entries_bytes must be in [1, 4], got {num_entries_bytes}"
+            )));
+        }
+
+        let mut num_entries = 0usize;
+        for i in 0..num_entries_bytes {
+            let entry_count_byte = cursor
+                .read_u8()
+                .map_err(insufficient_data("num_entries_byte"))?;
+            num_entries |= (entry_count_byte as usize) << ((i as usize) << 3);
+        }
+
+        // a block of 8 deltas takes entry_bits bytes, so the deltas are contiguous bits
+        let len = (num_entries * entry_bits as usize).div_ceil(8);
+        let data = entries_at(bytes, &cursor, len)?;
+
+        Ok(Self {
+            theta,
+            seed_hash,
+            ordered: (flags & FLAGS_IS_ORDERED) != 0,
+            empty,
+            num_entries,
+            entries: Entries::Packed { entry_bits, data },
+        })
+    }
+
+    /// Returns the cardinality estimate.
+    pub fn estimate(&self) -> f64 {
+        if self.is_empty() {
+            return 0.0;
+        }
+        let num_retained = self.num_retained() as f64;
+        if self.theta == MAX_THETA {
+            return num_retained;
+        }
+        num_retained / self.theta()
+    }
+
+    /// Returns the approximate lower error bound given the specified number of Standard Deviations.
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        if !self.is_estimation_mode() {
+            return self.num_retained() as f64;
+        }
+        binomial_bounds::lower_bound(self.num_retained() as u64, self.theta(), num_std_dev)
+            .expect("theta of a wrapped image should always be valid")
+    }
+
+    /// Returns the approximate upper error bound given the specified number of Standard Deviations.
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        if !self.is_estimation_mode() {
+            return self.num_retained() as f64;
+        }
+        binomial_bounds::upper_bound(
+            self.num_retained() as u64,
+            self.theta(),
+            num_std_dev,
+            self.is_empty(),
+        )
+        .expect("theta of a wrapped image should always be valid")
+    }
+
+    /// Returns theta as a fraction (0.0 to 1.0).
+    pub fn theta(&self) -> f64 {
+        self.theta as f64 / MAX_THETA as f64
+    }
+
+    /// Returns theta as u64.
+    pub fn theta64(&self) -> u64 {
+        self.theta
+    }
+
+    /// Returns true if the wrapped sketch is empty.
+    pub fn is_empty(&self) -> bool {
+        self.empty
+    }
+
+    /// Returns true if the wrapped sketch is in estimation mode.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.theta < MAX_THETA
+    }
+
+    /// Returns the number of retained entries declared by the image.
+    pub fn num_retained(&self) -> usize {
+        self.num_entries
+    }
+
+    /// Returns true if retained entries are ordered (sorted ascending).
+    pub fn is_ordered(&self) -> bool {
+        self.ordered
+    }
+
+    /// Returns the 16-bit seed hash.
+    pub fn seed_hash(&self) -> u16 {
+        self.seed_hash
+    }
+
+    /// Returns an iterator over the retained entries, decoded from the image as it advances.
+    pub fn iter(&self) -> impl Iterator<Item = ThetaEntry> + '_ {
+        let source = match &self.entries {
+            Entries::Raw(data) => Source::Raw(data.chunks_exact(8)),
+            Entries::Packed { entry_bits, data } => Source::Packed {
+                unpacker: BitUnpacker::new(data),
+                entry_bits: *entry_bits,
+                previous: 0,
+            },
+        };
+        let theta = self.theta;
+        Hashes {
+            remaining: self.num_entries,
+            source,
+        }
+        .filter(move |&hash| hash != 0 && hash < theta)
+        .map(ThetaEntry::new)
+    }
+}
+
+/// Returns the `len` bytes of `bytes` following the preamble read by `cursor`.
+fn entries_at<'a>(
+    bytes: &'a [u8],
+    cursor: &SketchSlice<'_>,
+    len: usize,
+) -> Result<&'a [u8], Error> {
+    let offset = bytes.len() - cursor.remaining().len();
+    bytes.get(offset..offset + len).ok_or_else(|| {
+        Error::insufficient_data(format!(
+            "expected {} bytes, got {}",
+            offset + len,
+            bytes.len()
+        ))
+    })
+}
+
+/// The hashes stored in an image, valid or not
+struct Hashes<'a> {
+    remaining: usize,
+    source: Source<'a>,
+}
+
+enum Source<'a> {
+    Raw(ChunksExact<'a, u8>),
+    Packed {
+        unpacker: BitUnpacker<'a>,
+        entry_bits: u8,
+        previous: u64,
+    },
+}
+
+impl Iterator for Hashes<'_> {
+    type Item = u64;
+
+    fn next(&mut self) -> Option<u64> {
+        if self.remaining == 0 {
+            return None;
+        }
+        self.remaining -= 1;
+        match &mut self.source {
+            Source::Raw(chunks) => chunks
+                .next()
+                .map(|chunk| u64::from_le_bytes(chunk.try_into().unwrap())),
+            Source::Packed {
+                unpacker,
+                entry_bits,
+                previous,
+            } => {
+                // the packed length was checked against the number of entries; a delta past the
+                // hash range saturates, so the hashes never descend and the rest are filtered
+                *previous = previous.saturating_add(unpacker.unpack_value(*entry_bits));
+                Some(*previous)
+            }
+        }
+    }
+
+    fn size_hint(&self) -> (usize, Option<usize>) {
+        (self.remaining, Some(self.remaining))
+    }
+}
+
+impl RawThetaSketchView<ThetaEntry> for CompactThetaWrapper<'_> {
+    fn seed_hash(&self) -> u16 {
+        CompactThetaWrapper::seed_hash(self)
+    }
+
+    fn theta(&self) -> u64 {
+        CompactThetaWrapper::theta64(self)
+    }
+
+    fn is_empty(&self) -> bool {
+        CompactThetaWrapper::is_empty(self)
+    }
+
+    fn is_ordered(&self) -> bool {
+        CompactThetaWrapper::is_ordered(self)
+    }
+
+    fn iter(&self) -> impl Iterator<Item = ThetaEntry> + '_ {
+        CompactThetaWrapper::iter(self)
+    }
+
+    fn num_retained(&self) -> usize {
+        CompactThetaWrapper::num_retained(self)
+    }
+}
@@ -0,0 +1,250 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::collections::HashSet;
+
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::thetacommon::RawHashTableEntry;
+use crate::thetacommon::RawThetaSketchView;
+use crate::thetacommon::constants::MAX_THETA;
+use crate::thetacommon::hash_table::RawCompactParts;
+
+/// Compute the set difference `a` minus `b` as raw compact-sketch parts.
+///
+/// Only entries of `a` survive, so tuple summaries pass through untouched and `b` may use a
+/// different entry type (a tuple sketch minus a plain Theta sketch, for example).
+pub fn raw_a_not_b<E, F, A, B>(
+    a: &A,
+    b: &B,
+    seed_hash: u16,
+    ordered: bool,
+) -> Result<RawCompactParts<E>, Error>
+where
+    E: RawHashTableEntry,
+    F: RawHashTableEntry,
+    A: RawThetaSketchView<E>,
+    B: RawThetaSketchView<F>,
+{
+    if a.is_empty() || (a.num_retained() == 0 && b.is_empty()) {
+        let mut entries: Vec<E> = a.iter().collect();
+        if ordered && !a.is_ordered() {
+            entries.sort_unstable_by_key(RawHashTableEntry::hash);
+        }
+        return Ok(RawCompactParts {
+            entries,
+            theta: a.theta(),
+            seed_hash,
+            ordered: a.is_ordered() || ordered,
+            empty: a.is_empty(),
+        });
+    }
+
+    ensure_seed_hash_is(a, seed_hash)?;
+    if !b.is_empty() {
+        ensure_seed_hash_is(b, seed_hash)?;
+    }
+
+    let theta = a.theta().min(b.theta());
+    let mut entries = Vec::new();
+    if b.num_retained() == 0 {
+        collect_below_theta(a, theta, |_| true, &mut entries);
+    } else if a.is_ordered() && b.is_ordered() {
+        // both inputs are sorted, so a single merge pass suffices
+        let mut b_iter = b.iter().map(|entry| entry.hash()).peekable();
+        collect_below_theta(
+            a,
+            theta,
+            |hash| {
+                while b_iter.next_if(|&b_hash| b_hash < hash).is_some() {}
+                b_iter.peek() != Some(&hash)
+            },
+            &mut entries,
+        );
+    } else {
+        let mut b_hashes = HashSet::with_capacity(b.num_retained());
+        for entry in b.iter() {
+            let hash = entry.hash();
+            if hash < theta {
+                b_hashes.insert(hash);
+            } else if b.is_ordered() {
+                break;
+            }
+        }
+        collect_below_theta(a, theta, |hash| !b_hashes.contains(&hash), &mut entries);
+    }
+
+    if ordered && !a.is_ordered() {
+        entries.sort_unstable_by_key(RawHashTableEntry::hash);
+    }
+
+    Ok(RawCompactParts {
+        empty: entries.is_empty() && theta == MAX_THETA,
+        entries,
+        theta,
+        seed_hash,
+        ordered: a.is_ordered() || ordered,
+    })
+}
+
+fn ensure_seed_hash_is<E, S>(sketch: &S, seed_hash: u16) -> Result<(), Error>
+where
+    S: RawThetaSketchView<E>,
+    E: RawHashTableEntry,
+{
+    if sketch.seed_hash() != seed_hash {
+        return Err(Error::incompatible_seed_hash(
+            ErrorKind::InvalidArgument,
+            seed_hash,
+            sketch.seed_hash(),
+        ));
+    }
+    Ok(())
+}
+
+fn collect_below_theta<E, S>(
+    sketch: &S,
+    theta: u64,
+    mut keep: impl FnMut(u64) -> bool,
+    entries: &mut Vec<E>,
+) where
+    S: RawThetaSketchView<E>,
+    E: RawHashTableEntry,
+{
+    for entry in sketch.iter() {
+        let hash = entry.hash();
+        if hash < theta {
+            if keep(hash) {
+                entries.push(entry);
+            }
+        } else if sketch.is_ordered() {
+            break;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::hash::DEFAULT_UPDATE_SEED;
+    use crate::hash::compute_seed_hash;
+
+    #[derive(Clone, Debug, Eq, PartialEq)]
+    struct TestEntry {
+        hash: u64,
+        summary: u64,
+    }
+
+    impl RawHashTableEntry for TestEntry {
+        fn hash(&self) -> u64 {
+            self.hash
+        }
+    }
+
+    struct TestSketch {
+        entries: Vec<TestEntry>,
+        theta: u64,
+        ordered: bool,
+    }
+
+    impl RawThetaSketchView<TestEntry> for TestSketch {
+        fn seed_hash(&self) -> u16 {
+            compute_seed_hash(DEFAULT_UPDATE_SEED)
+        }
+
+        fn theta(&self) -> u64 {
+            self.theta
+        }
+
+        fn is_empty(&self) -> bool {
+            self.entries.is_empty() && self.theta == MAX_THETA
+        }
+
+        fn is_ordered(&self) -> bool {
+            self.ordered
+        }
+
+        fn iter(&self) -> impl Iterator<Item = TestEntry> + '_ {
+            self.entries.iter().cloned()
+        }
+
+        fn num_retained(&self) -> usize {
+            self.entries.len()
+        }
+    }
+
+    fn sketch(hashes: &[u64], theta: u64, ordered: bool) -> TestSketch {
+        TestSketch {
+            entries: hashes
+                .iter()
+                .map(|&hash| TestEntry {
+                    hash,
+                    summary: hash * 10,
+                })
+                .collect(),
+            theta,
+            ordered,
+        }
+    }
+
+    fn hashes(parts: &RawCompactParts<TestEntry>) -> Vec<u64> {
+        parts.entries.iter().map(|entry| entry.hash).collect()
+    }
+
+    #[test]
+    fn keeps_entries_of_a_with_their_summaries() {
+        let seed_hash = compute_seed_hash(DEFAULT_UPDATE_SEED);
+        let a = sketch(&[5, 1, 3], MAX_THETA, false);
+        let b = sketch(&[3, 4], MAX_THETA, false);
+
+        let parts = raw_a_not_b(&a, &b, seed_hash, true).unwrap();
+        assert_eq!(hashes(&parts), vec![1, 5]);
+        assert_eq!(parts.entries[1].summary, 50);
+        assert!(parts.ordered);
+        assert!(!parts.empty);
+    }
+
+    #[test]
+    fn ordered_and_hashed_paths_agree() {
+        let seed_hash = compute_seed_hash(DEFAULT_UPDATE_SEED);
+        let a_hashes = [2, 4, 6, 8, 10, 12];
+        let b_hashes = [1, 4, 5, 10, 11];
+        for (a_ordered, b_ordered) in [(true, true), (true, false), (false, true), (false, false)] {
+            let a = sketch(&a_hashes, 11, a_ordered);
+            let b = sketch(&b_hashes, MAX_THETA, b_ordered);
+            let parts = raw_a_not_b(&a, &b, seed_hash, true).unwrap();
+            assert_eq!(hashes(&parts), vec![2, 6, 8]);
+            assert_eq!(parts.theta, 11);
+        }
+    }
+
+    #[test]
+    fn identical_inputs_in_exact_mode_are_empty() {
+        let seed_hash = compute_seed_hash(DEFAULT_UPDATE_SEED);
+        let a = sketch(&[1, 2, 3], MAX_THETA, true);
+        let parts = raw_a_not_b(&a, &a, seed_hash, true).unwrap();
+        assert!(parts.entries.is_empty());
+        assert!(parts.empty);
+    }
+
+    #[test]
+    fn rejects_mismatched_seed_hash() {
+        let a = sketch(&[1], MAX_THETA, true);
+        let err = raw_a_not_b(&a, &a, 0, true).unwrap_err();
+        assert!(err.message().contains("incompatible seed hash"));
+    }
+}
@@ -0,0 +1,261 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Bounds on the ratio |B| / |A| of two Theta-sketched sets where B is a subset of A.
+//!
+//! This is a port of `BoundsOnRatiosInThetaSketchedSets`, `BoundsOnRatiosInSampledSets` and
+//! `BoundsOnBinomialProportions` from datasketches-java.
+
+use crate::error::Error;
+use crate::thetacommon::RawHashTableEntry;
+use crate::thetacommon::RawThetaSketchView;
+use crate::thetacommon::constants::MAX_THETA;
+
+const NUM_STD_DEVS: f64 = 2.0;
+
+/// Return the approximate lower bound of |B| / |A| where B is a subset of A.
+pub(crate) fn lower_bound_for_b_over_a<E, F, A, B>(a: &A, b: &B) -> Result<f64, Error>
+where
+    E: RawHashTableEntry,
+    F: RawHashTableEntry,
+    A: RawThetaSketchView<E>,
+    B: RawThetaSketchView<F>,
+{
+    let (count_a, count_b, f) = sampled_counts(a, b)?;
+    if count_a == 0 {
+        return Ok(0.0);
+    }
+    Ok(sampled_lower_bound_for_b_over_a(count_a, count_b, f))
+}
+
+/// Return the approximate upper bound of |B| / |A| where B is a subset of A.
+pub(crate) fn upper_bound_for_b_over_a<E, F, A, B>(a: &A, b: &B) -> Result<f64, Error>
+where
+    E: RawHashTableEntry,
+    F: RawHashTableEntry,
+    A: RawThetaSketchView<E>,
+    B: RawThetaSketchView<F>,
+{
+    let (count_a, count_b, f) = sampled_counts(a, b)?;
+    if count_a == 0 {
+        return Ok(1.0);
+    }
+    Ok(sampled_upper_bound_for_b_over_a(count_a, count_b, f))
+}
+
+/// Return the estimate of |B| / |A| where B is a subset of A.
+pub(crate) fn estimate_of_b_over_a<E, F, A, B>(a: &A, b: &B) -> Result<f64, Error>
+where
+    E: RawHashTableEntry,
+    F: RawHashTableEntry,
+    A: RawThetaSketchView<E>,
+    B: RawThetaSketchView<F>,
+{
+    let (count_a, count_b, _) = sampled_counts(a, b)?;
+    if count_a == 0 {
+        return Ok(0.5);
+    }
+    Ok(count_b as f64 / count_a as f64)
+}
+
+/// Return the counts of A and B below the common theta, and that theta as a fraction.
+fn sampled_counts<E, F, A, B>(a: &A, b: &B) -> Result<(u64, u64, f64), Error>
+where
+    E: RawHashTableEntry,
+    F: RawHashTableEntry,
+    A: RawThetaSketchView<E>,
+    B: RawThetaSketchView<F>,
+{
+    let theta_a = a.theta();
+    let theta_b = b.theta();
+    if theta_b > theta_a {
+        return Err(Error::invalid_argument(format!(
+            "theta of B ({theta_b}) must not exceed theta of A ({theta_a})"
+        )));
+    }
+    let count_b = b.num_retained() as u64;
+    let count_a = if theta_a == theta_b {
+        a.num_retained() as u64
+    } else {
+        a.iter().filter(|entry| entry.hash() < theta_b).count() as u64
+    };
+    Ok((count_a, count_b, theta_b as f64 / MAX_THETA as f64))
+}
+
+fn sampled_lower_bound_for_b_over_a(a: u64, b: u64, f: f64) -> f64 {
+    debug_assert!(b <= a, "B must be a subset of A");
+    if f == 1.0 {
+        return b as f64 / a as f64;
+    }
+    approximate_lower_bound_on_p(a, b, NUM_STD_DEVS * hacky_adjuster(f))
+}
+
+fn sampled_upper_bound_for_b_over_a(a: u64, b: u64, f: f64) -> f64 {
+    debug_assert!(b <= a, "B must be a subset of A");
+    if f == 1.0 {
+        return b as f64 / a as f64;
+    }
+    approximate_upper_bound_on_p(a, b, NUM_STD_DEVS * hacky_adjuster(f))
+}
+
+/// Widens the bounds for large sampling fractions, where the binomial approximation is too
+/// optimistic because sampling is without replacement.
+fn hacky_adjuster(f: f64) -> f64 {
+    let tmp = (1.0 - f).sqrt();
+    if f <= 0.5 {
+        tmp
+    } else {
+        tmp + 0.01 * (f - 0.5)
+    }
+}
+
+/// Approximate lower bound on the success probability p of a binomial distribution, given `k`
+/// successes in `n` trials.
+fn approximate_lower_bound_on_p(n: u64, k: u64, num_std_devs: f64) -> f64 {
+    if n == 0 || k == 0 {
+        0.0
+    } else if k == 1 {
+        exact_lower_bound_on_p_k_eq_1(n, delta_of_num_std_devs(num_std_devs))
+    } else if k == n {
+        exact_lower_bound_on_p_k_eq_n(n, delta_of_num_std_devs(num_std_devs))
+    } else {
+        let x = abramowitz_stegun_formula_26p5p22((n - k) as f64 + 1.0, k as f64, -num_std_devs);
+        1.0 - x
+    }
+}
+
+/// Approximate upper bound on the success probability p of a binomial distribution, given `k`
+/// successes in `n` trials.
+fn approximate_upper_bound_on_p(n: u64, k: u64, num_std_devs: f64) -> f64 {
+    if n == 0 || k == n {
+        1.0
+    } else if k == n - 1 {
+        exact_upper_bound_on_p_k_eq_minus_one(n, delta_of_num_std_devs(num_std_devs))
+    } else if k == 0 {
+        exact_upper_bound_on_p_k_eq_zero(n, delta_of_num_std_devs(num_std_devs))
+    } else {
+        let x = abramowitz_stegun_formula_26p5p22((n - k) as f64, k as f64 + 1.0, num_std_devs);
+        1.0 - x
+    }
+}
+
+fn erf(x: f64) -> f64 {
+    if x < 0.0 {
+        -erf_of_non_neg(-x)
+    } else {
+        erf_of_non_neg(x)
+    }
+}
+
+fn normal_cdf(x: f64) -> f64 {
+    0.5 * (1.0 + erf(x / 2f64.sqrt()))
+}
+
+/// Formula 7.1.28 on page 299 of Abramowitz & Stegun.
+fn erf_of_non_neg(x: f64) -> f64 {
+    const A1: f64 = 0.0705230784;
+    const A2: f64 = 0.0422820123;
+    const A3: f64 = 0.0092705272;
+    const A4: f64 = 0.0001520143;
+    const A5: f64 = 0.0002765672;
+    const A6: f64 = 0.0000430638;
+
+    let x2 = x * x;
+    let x3 = x2 * x;
+    let x4 = x2 * x2;
+    let x5 = x2 * x3;
+    let x6 = x3 * x3;
+    let sum = 1.0 + A1 * x + A2 * x2 + A3 * x3 + A4 * x4 + A5 * x5 + A6 * x6;
+    // raise the sum to the 16th power
+    let sum2 = sum * sum;
+    let sum4 = sum2 * sum2;
+    let sum8 = sum4 * sum4;
+    let sum16 = sum8 * sum8;
+    1.0 - 1.0 / sum16
+}
+
+fn delta_of_num_std_devs(kappa: f64) -> f64 {
+    normal_cdf(-kappa)
+}
+
+/// Formula 26.5.22 on page 945 of Abramowitz & Stegun.
+///
+/// Approximates the inverse of the incomplete beta function I_x(a, b) = delta at the point
+/// where the standard normal deviate is `yp`.
+fn abramowitz_stegun_formula_26p5p22(a: f64, b: f64, yp: f64) -> f64 {
+    let b2m1 = 2.0 * b - 1.0;
+    let a2m1 = 2.0 * a - 1.0;
+    let lambda = (yp * yp - 3.0) / 6.0;
+    let htmp = 1.0 / a2m1 + 1.0 / b2m1;
+    let h = 2.0 / htmp;
+    let term1 = (yp * (h + lambda).sqrt()) / h;
+    let term2 = 1.0 / b2m1 - 1.0 / a2m1;
+    let term3 = (lambda + 5.0 / 6.0) - 2.0 / (3.0 * h);
+    let w = term1 - term2 * term3;
+    a / (a + b * (2.0 * w).exp())
+}
+
+fn exact_upper_bound_on_p_k_eq_zero(n: u64, delta: f64) -> f64 {
+    1.0 - delta.powf(1.0 / n as f64)
+}
+
+fn exact_lower_bound_on_p_k_eq_n(n: u64, delta: f64) -> f64 {
+    delta.powf(1.0 / n as f64)
+}
+
+fn exact_lower_bound_on_p_k_eq_1(n: u64, delta: f64) -> f64 {
+    1.0 - (1.0 - delta).powf(1.0 / n as f64)
+}
+
+fn exact_upper_bound_on_p_k_eq_minus_one(n: u64, delta: f64) -> f64 {
+    (1.0 - delta).powf(1.0 / n as f64)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_erf_and_normal_cdf() {
+        assert!(erf(0.0).abs() < 1e-12);
+        assert!((erf(1.0) - 0.8427007929).abs() < 1e-6);
+        assert!((erf(-1.0) + 0.8427007929).abs() < 1e-6);
+        assert!((normal_cdf(0.0) - 0.5).abs() < 1e-12);
+        assert!((normal_cdf(-2.0) - 0.0227501319).abs() < 1e-6);
+    }
+
+    #[test]
+    fn test_binomial_proportions_bracket_ratio() {
+        for (n, k) in [(100, 0), (100, 1), (100, 37), (100, 99), (100, 100)] {
+            let lb = approximate_lower_bound_on_p(n, k, 2.0);
+            let ub = approximate_upper_bound_on_p(n, k, 2.0);
+            let p = k as f64 / n as f64;
+            assert!(lb <= p && p <= ub, "n={n} k={k} lb={lb} ub={ub}");
+            assert!((0.0..=1.0).contains(&lb));
+            assert!((0.0..=1.0).contains(&ub));
+        }
+    }
+
+    #[test]
+    fn test_sampled_bounds_exact_when_not_sampled() {
+        assert_eq!(sampled_lower_bound_for_b_over_a(10, 4, 1.0), 0.4);
+        assert_eq!(sampled_upper_bound_for_b_over_a(10, 4, 1.0), 0.4);
+        let lb = sampled_lower_bound_for_b_over_a(1000, 400, 0.1);
+        let ub = sampled_upper_bound_for_b_over_a(1000, 400, 0.1);
+        assert!(lb < 0.4 && 0.4 < ub);
+    }
+}
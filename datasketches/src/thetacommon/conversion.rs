@@ -0,0 +1,60 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Helpers for feeding the retained hashes of a Theta sketch into HLL and CPC sketches.
+//!
+//! A retained hash is a uniform 63-bit value below theta. Its low bits select the slot of the
+//! target sketch and the leading zeros of its 63 bits pick the value, so that the hashes below
+//! theta are exactly those with the most leading zeros. The hashes above theta were dropped by
+//! the Theta sketch; what they would have contributed to each slot is drawn at random from the
+//! stream the retained hashes estimate.
+
+use crate::common::random;
+use crate::thetacommon::constants::MAX_THETA;
+
+/// Returns the number of leading zeros of a 63-bit retained hash.
+pub(crate) fn leading_zeros(hash: u64) -> u32 {
+    (hash << 1).leading_zeros()
+}
+
+/// Returns, for each number of leading zeros `c` that hashes above `theta` can have, the
+/// probability that a slot of a sketch with `2^lg_k` slots saw at least one of them.
+///
+/// The hashes with `c` leading zeros span `[2^(62 - c), 2^(63 - c))`, of which the part above
+/// theta was dropped. The number of hashes of the stream is estimated from `num_retained`,
+/// which makes the probabilities small for the sparse result of an intersection. Returns no
+/// probabilities in exact mode, where nothing was dropped.
+pub(crate) fn dropped_hit_probabilities(theta: u64, num_retained: usize, lg_k: u8) -> Vec<f64> {
+    if theta >= MAX_THETA || num_retained == 0 {
+        return vec![];
+    }
+    let fraction = theta as f64 / MAX_THETA as f64;
+    let hashes_per_slot = num_retained as f64 / fraction / (1u64 << lg_k) as f64;
+    (0..=leading_zeros(theta))
+        .map(|c| {
+            let upper = 1u64 << (63 - c);
+            let lower = (upper >> 1).max(theta);
+            let dropped = (upper - lower) as f64 / MAX_THETA as f64;
+            -(-hashes_per_slot * dropped).exp_m1()
+        })
+        .collect()
+}
+
+/// Returns whether a slot saw a dropped hash hit with probability `p`.
+pub(crate) fn hit(p: f64) -> bool {
+    random::next_f64() < p
+}
@@ -18,9 +18,12 @@
 use std::hash::Hash;
 
 use crate::common::ResizeFactor;
+use crate::common::SketchEvent;
+use crate::common::observer::notify;
 use crate::hash::MurmurHash3X64128;
 use crate::hash::compute_seed_hash;
 use crate::thetacommon::RawHashTableEntry;
+use crate::thetacommon::RawThetaSketchView;
 use crate::thetacommon::constants::HASH_TABLE_REBUILD_THRESHOLD;
 use crate::thetacommon::constants::HASH_TABLE_RESIZE_THRESHOLD;
 use crate::thetacommon::constants::MAX_THETA;
@@ -37,6 +40,32 @@ pub struct RawCompactParts<E> {
     pub empty: bool,
 }
 
+impl<E: RawHashTableEntry + Clone> RawThetaSketchView<E> for RawCompactParts<E> {
+    fn seed_hash(&self) -> u16 {
+        self.seed_hash
+    }
+
+    fn theta(&self) -> u64 {
+        self.theta
+    }
+
+    fn is_empty(&self) -> bool {
+        self.empty
+    }
+
+    fn is_ordered(&self) -> bool {
+        self.ordered
+    }
+
+    fn iter(&self) -> impl Iterator<Item = E> + '_ {
+        self.entries.iter().cloned()
+    }
+
+    fn num_retained(&self) -> usize {
+        self.entries.len()
+    }
+}
+
 /// Generic hash-table mechanics shared by Theta and Tuple sketches.
 ///
 /// The entry type supplies the retained hash and any sketch-specific payload. The table owns all
@@ -240,6 +269,13 @@ where
         self.lg_cur_size = init_lg_cur;
     }
 
+    /// Reset the table to empty state with a new nominal size, keeping the entries allocation.
+    pub fn reset_with_lg_nom_size(&mut self, lg_nom_size: u8) {
+        self.lg_nom_size = lg_nom_size;
+        self.lg_max_size = lg_nom_size + 1;
+        self.reset();
+    }
+
     /// Return number of retained entries.
     pub fn num_retained(&self) -> usize {
         self.num_retained
@@ -347,6 +383,18 @@ where
         self.entries.capacity() * size_of::<Option<E>>()
     }
 
+    /// Returns the bound of [`estimated_size`](Self::estimated_size) for `lg_nom_size`, that of
+    /// a table grown to its largest size.
+    pub fn max_estimated_size(lg_nom_size: u8) -> usize {
+        (1 << (lg_nom_size + 1)) * size_of::<Option<E>>()
+    }
+
+    /// Returns the most entries a table of `lg_nom_size` retains, the rebuild threshold of its
+    /// largest size.
+    pub fn max_retained(lg_nom_size: u8) -> usize {
+        (HASH_TABLE_REBUILD_THRESHOLD * (1u64 << (lg_nom_size + 1)) as f64) as usize
+    }
+
     fn find_in_curr_entries(&self, key: u64) -> Option<usize> {
         Self::find_in_entries(&self.entries, key, self.lg_cur_size)
     }
@@ -395,6 +443,10 @@ where
 
         self.entries = new_entries;
         self.lg_cur_size = new_lg_size;
+        notify(SketchEvent::ThetaResize {
+            lg_nom_size: self.lg_nom_size,
+            lg_cur_size: new_lg_size,
+        });
     }
 
     fn rebuild(&mut self) {
@@ -432,6 +484,10 @@ where
         );
         self.num_retained = num_inserted;
         self.entries = new_entries;
+        notify(SketchEvent::ThetaRebuild {
+            lg_nom_size: self.lg_nom_size,
+            theta: self.theta,
+        });
     }
 
     fn get_stride(key: u64, lg_size: u8) -> usize {
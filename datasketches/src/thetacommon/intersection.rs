@@ -0,0 +1,223 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use crate::common::ResizeFactor;
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::thetacommon::RawHashTableEntry;
+use crate::thetacommon::RawThetaSketchView;
+use crate::thetacommon::constants::HASH_TABLE_REBUILD_THRESHOLD;
+use crate::thetacommon::constants::MAX_THETA;
+use crate::thetacommon::hash_table::RawCompactParts;
+use crate::thetacommon::hash_table::RawHashTable;
+
+/// Combines an incoming entry with the retained entry of the same hash.
+pub trait RawThetaIntersectionPolicy<E> {
+    fn merge(&self, existing: &mut E, incoming: E);
+}
+
+/// Generic state machine shared by Theta and Tuple intersections.
+///
+/// `E` is the retained entry type, and `P` defines how the entries of a key present in every
+/// input are combined.
+#[derive(Debug)]
+pub struct RawThetaIntersection<E, P> {
+    is_valid: bool,
+    table: RawHashTable<E>,
+    policy: P,
+}
+
+impl<E, P> RawThetaIntersection<E, P>
+where
+    E: RawHashTableEntry,
+{
+    pub fn new(seed: u64, policy: P) -> Self {
+        Self {
+            is_valid: false,
+            table: RawHashTable::from_raw_parts(
+                0,
+                0,
+                ResizeFactor::X1,
+                1.0,
+                MAX_THETA,
+                seed,
+                false,
+            ),
+            policy,
+        }
+    }
+
+    /// Intersect the current state with a sketch.
+    pub fn update<S>(&mut self, sketch: &S) -> Result<(), Error>
+    where
+        S: RawThetaSketchView<E>,
+        P: RawThetaIntersectionPolicy<E>,
+        E: Clone,
+    {
+        if self.table.is_empty() {
+            return Ok(());
+        }
+
+        if !sketch.is_empty() && sketch.seed_hash() != self.table.seed_hash() {
+            return Err(Error::incompatible_seed_hash(
+                ErrorKind::InvalidArgument,
+                self.table.seed_hash(),
+                sketch.seed_hash(),
+            ));
+        }
+
+        if sketch.is_empty() {
+            self.table.set_empty(true);
+        }
+
+        self.table.set_theta(if self.table.is_empty() {
+            MAX_THETA
+        } else {
+            self.table.theta().min(sketch.theta())
+        });
+
+        if self.is_valid && self.table.num_retained() == 0 {
+            return Ok(());
+        }
+
+        if sketch.num_retained() == 0 {
+            self.is_valid = true;
+            self.table = self.with_capacity_for(0);
+            return Ok(());
+        }
+
+        // first update, copy or move incoming sketch
+        if !self.is_valid {
+            self.is_valid = true;
+            self.table = self.with_capacity_for(sketch.num_retained());
+            for entry in sketch.iter() {
+                if !self.insert(entry) {
+                    return Err(Error::invalid_argument(
+                        "Insert entries from sketch fail, possibly corrupted input sketch",
+                    ));
+                }
+            }
+            // Safety check.
+            if self.table.num_retained() != sketch.num_retained() {
+                return Err(Error::invalid_argument(
+                    "num entries mismatch, possibly corrupted input sketch",
+                ));
+            }
+        } else {
+            let max_matches = self.table.num_retained().min(sketch.num_retained());
+            let mut matched_entries = Vec::with_capacity(max_matches);
+            let mut count = 0;
+            for entry in sketch.iter() {
+                let hash = entry.hash();
+                if hash < self.table.theta() {
+                    if let Some(existing) = self.table.get_entry(hash) {
+                        if matched_entries.len() == max_matches {
+                            return Err(Error::invalid_argument(
+                                "max matches exceeded, possibly corrupted input sketch",
+                            ));
+                        }
+                        let mut matched = existing.clone();
+                        self.policy.merge(&mut matched, entry);
+                        matched_entries.push(matched);
+                    }
+                } else if sketch.is_ordered() {
+                    break; // early stop for ordered sketches
+                }
+                count += 1;
+            }
+            // Safety check.
+            if count > sketch.num_retained() {
+                return Err(Error::invalid_argument(
+                    "more keys than expected, possibly corrupted input sketch",
+                ));
+            } else if !sketch.is_ordered() && count < sketch.num_retained() {
+                return Err(Error::invalid_argument(
+                    "fewer keys than expected, possibly corrupted input sketch",
+                ));
+            }
+            if matched_entries.is_empty() {
+                self.table = self.with_capacity_for(0);
+                if self.table.theta() == MAX_THETA {
+                    self.table.set_empty(true);
+                }
+            } else {
+                self.table = self.with_capacity_for(matched_entries.len());
+                for entry in matched_entries {
+                    if !self.insert(entry) {
+                        return Err(Error::invalid_argument(
+                            "duplicate key, possibly corrupted input sketch",
+                        ));
+                    }
+                }
+            }
+        }
+        Ok(())
+    }
+
+    /// Return whether at least one sketch has been intersected.
+    pub fn has_result(&self) -> bool {
+        self.is_valid
+    }
+
+    /// Return the current intersection state as raw compact-sketch parts.
+    pub fn to_compact_parts(&self, ordered: bool) -> RawCompactParts<E>
+    where
+        E: Clone,
+    {
+        let mut entries: Vec<E> = self.table.iter_entries().cloned().collect();
+        if ordered {
+            entries.sort_unstable_by_key(RawHashTableEntry::hash);
+        }
+        RawCompactParts {
+            entries,
+            theta: self.table.theta(),
+            seed_hash: self.table.seed_hash(),
+            ordered,
+            empty: self.table.is_empty(),
+        }
+    }
+
+    /// Return an empty table, keeping theta, seed and emptiness, sized to hold `count` entries.
+    fn with_capacity_for(&self, count: usize) -> RawHashTable<E> {
+        let (lg_cur_size, lg_nom_size) = if count == 0 {
+            (0, 0)
+        } else {
+            let lg_size = RawHashTable::<E>::lg_size_from_count_for_rebuild(
+                count,
+                HASH_TABLE_REBUILD_THRESHOLD,
+            );
+            (lg_size, lg_size - 1)
+        };
+        RawHashTable::from_raw_parts(
+            lg_cur_size,
+            lg_nom_size,
+            ResizeFactor::X1,
+            1.0,
+            self.table.theta(),
+            self.table.hash_seed(),
+            self.table.is_empty(),
+        )
+    }
+
+    fn insert(&mut self, entry: E) -> bool {
+        self.table
+            .upsert_entry(entry.hash(), |existing| match existing {
+                Some(_) => None,
+                None => Some(entry),
+            })
+    }
+}
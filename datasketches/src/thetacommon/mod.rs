@@ -17,9 +17,14 @@
 
 //! Data structures and functions that may be used across all the Theta sketch family.
 
+pub(crate) mod a_not_b;
 pub(crate) mod binomial_bounds;
+pub(crate) mod bounds_on_ratios;
 pub(crate) mod constants;
+#[cfg(all(feature = "theta", any(feature = "hll", feature = "cpc")))]
+pub(crate) mod conversion;
 pub(crate) mod hash_table;
+pub(crate) mod intersection;
 pub(crate) mod union;
 
 /// An entry retained by a Theta sketch family hash table.
@@ -17,6 +17,7 @@
 
 use crate::common::ResizeFactor;
 use crate::error::Error;
+use crate::error::ErrorKind;
 use crate::thetacommon::RawHashTableEntry;
 use crate::thetacommon::RawThetaSketchView;
 use crate::thetacommon::constants::MAX_THETA;
@@ -58,6 +59,11 @@ where
         }
     }
 
+    /// Return the hash seed of the union.
+    pub fn hash_seed(&self) -> u64 {
+        self.table.hash_seed()
+    }
+
     /// Incorporate a sketch into the union.
     pub fn update<S>(&mut self, sketch: &S) -> Result<(), Error>
     where
@@ -69,11 +75,11 @@ where
         }
 
         if self.table.seed_hash() != sketch.seed_hash() {
-            return Err(Error::invalid_argument(format!(
-                "incompatible seed hash: expected {}, got {}",
+            return Err(Error::incompatible_seed_hash(
+                ErrorKind::InvalidArgument,
                 self.table.seed_hash(),
                 sketch.seed_hash(),
-            )));
+            ));
         }
 
         self.table.set_empty(false);
@@ -152,6 +158,11 @@ where
         self.table.reset();
         self.union_theta = self.table.theta();
     }
+
+    /// Returns the estimated size of the heap allocations in bytes.
+    pub fn estimated_size(&self) -> usize {
+        self.table.estimated_size()
+    }
 }
 
 #[cfg(test)]
@@ -0,0 +1,172 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Tuple sketch set difference.
+//!
+//! [`TupleAnotB`] keeps the keys of sketch A that are absent from sketch B. Only entries of A
+//! survive, so their summaries are carried over unchanged and no combine policy is needed.
+
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::hash::DEFAULT_UPDATE_SEED;
+use crate::hash::compute_seed_hash;
+use crate::thetacommon::RawHashTableEntry;
+use crate::thetacommon::RawThetaSketchView;
+use crate::thetacommon::a_not_b::raw_a_not_b;
+use crate::thetacommon::constants::MAX_THETA;
+use crate::thetacommon::hash_table::RawCompactParts;
+use crate::tuple::hash_table::TupleEntry;
+use crate::tuple::sketch::CompactTupleSketch;
+use crate::tuple::sketch::TupleSketchView;
+
+/// Set difference (A and not B) operator for Tuple sketches.
+///
+/// Sketch B may be any Theta-family sketch: either a Tuple sketch with any summary type, or a plain
+/// Theta sketch.
+///
+/// The operator can be used statelessly through [`compute`](Self::compute), or statefully by
+/// calling [`set_a`](Self::set_a) once and then [`not_b`](Self::not_b) for every sketch to
+/// subtract.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::tuple::{DefaultUpdatePolicy, TupleAnotB, TupleSketchBuilder};
+/// let update_policy = DefaultUpdatePolicy::<u64>::default();
+/// let mut a = TupleSketchBuilder::new(update_policy).build();
+/// a.update("apple", 1);
+/// a.update("banana", 2);
+///
+/// let mut b = TupleSketchBuilder::new(update_policy).build();
+/// b.update("banana", 3);
+///
+/// let a_not_b = TupleAnotB::new_with_default_seed();
+/// let result = a_not_b.compute(&a, &b, true).unwrap();
+/// assert_eq!(result.num_retained(), 1); // apple
+/// assert_eq!(*result.iter().next().unwrap().1, 1);
+/// ```
+#[derive(Debug)]
+pub struct TupleAnotB<S> {
+    seed_hash: u16,
+    state: RawCompactParts<TupleEntry<S>>,
+}
+
+impl<S: Clone> TupleAnotB<S> {
+    /// Creates a new set difference operator for the given `seed`.
+    pub fn new(seed: u64) -> Self {
+        let seed_hash = compute_seed_hash(seed);
+        Self {
+            seed_hash,
+            state: empty_state(seed_hash),
+        }
+    }
+
+    /// Creates a new set difference operator with the default seed.
+    pub fn new_with_default_seed() -> Self {
+        Self::new(DEFAULT_UPDATE_SEED)
+    }
+
+    /// Computes `a` minus `b` without touching the stateful result.
+    ///
+    /// Returns an error if either non-empty input was built with a different seed.
+    pub fn compute<A, B, E>(
+        &self,
+        a: &A,
+        b: &B,
+        ordered: bool,
+    ) -> Result<CompactTupleSketch<S>, Error>
+    where
+        A: TupleSketchView<S>,
+        B: RawThetaSketchView<E>,
+        E: RawHashTableEntry,
+    {
+        raw_a_not_b(a, b, self.seed_hash, ordered).map(into_compact)
+    }
+
+    /// Sets the sketch that subsequent [`not_b`](Self::not_b) calls subtract from.
+    ///
+    /// Any previous stateful result is discarded.
+    pub fn set_a<A: TupleSketchView<S>>(&mut self, a: &A) -> Result<(), Error> {
+        if !a.is_empty() && a.seed_hash() != self.seed_hash {
+            return Err(Error::incompatible_seed_hash(
+                ErrorKind::InvalidArgument,
+                self.seed_hash,
+                a.seed_hash(),
+            ));
+        }
+        self.state = RawCompactParts {
+            entries: a.iter().collect(),
+            theta: a.theta(),
+            seed_hash: self.seed_hash,
+            ordered: a.is_ordered(),
+            empty: a.is_empty(),
+        };
+        Ok(())
+    }
+
+    /// Subtracts `b` from the current stateful result.
+    ///
+    /// Calling this before [`set_a`](Self::set_a) is a no-op: the result stays empty.
+    pub fn not_b<B, E>(&mut self, b: &B) -> Result<(), Error>
+    where
+        B: RawThetaSketchView<E>,
+        E: RawHashTableEntry,
+    {
+        self.state = raw_a_not_b(&self.state, b, self.seed_hash, self.state.ordered)?;
+        Ok(())
+    }
+
+    /// Returns the current stateful result as a compact Tuple sketch.
+    pub fn to_sketch(&self, ordered: bool) -> CompactTupleSketch<S> {
+        let mut entries = self.state.entries.clone();
+        if ordered && !self.state.ordered {
+            entries.sort_unstable_by_key(RawHashTableEntry::hash);
+        }
+        into_compact(RawCompactParts {
+            entries,
+            theta: self.state.theta,
+            seed_hash: self.state.seed_hash,
+            ordered: ordered || self.state.ordered,
+            empty: self.state.empty,
+        })
+    }
+
+    /// Resets the stateful result to empty.
+    pub fn reset(&mut self) {
+        self.state = empty_state(self.seed_hash);
+    }
+}
+
+fn empty_state<S>(seed_hash: u16) -> RawCompactParts<TupleEntry<S>> {
+    RawCompactParts {
+        entries: vec![],
+        theta: MAX_THETA,
+        seed_hash,
+        ordered: true,
+        empty: true,
+    }
+}
+
+fn into_compact<S>(parts: RawCompactParts<TupleEntry<S>>) -> CompactTupleSketch<S> {
+    CompactTupleSketch::from_parts(
+        parts.entries,
+        parts.theta,
+        parts.seed_hash,
+        parts.ordered,
+        parts.empty,
+    )
+}
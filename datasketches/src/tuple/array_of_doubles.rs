@@ -0,0 +1,745 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Array-of-Doubles Tuple sketch.
+//!
+//! This is the Tuple sketch specialization that keeps a fixed number of `f64` values per retained
+//! key, summed on every update and on union. It is the Tuple flavor emitted by Druid and Hive
+//! integrations, and it has its own compact binary format that differs from the generic Tuple
+//! layout: the header records the number of values, and all keys are written before all values.
+
+use std::hash::Hash;
+use std::io;
+use std::io::Read;
+use std::io::Write;
+
+use crate::codec::SketchBytes;
+use crate::codec::SketchSlice;
+use crate::codec::assert::ensure_preamble_longs_in;
+use crate::codec::assert::ensure_seed_hash_is;
+use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
+use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
+use crate::common::NumStdDev;
+use crate::common::ResizeFactor;
+use crate::common::SketchConfig;
+use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::error::SketchError;
+use crate::hash::DEFAULT_UPDATE_SEED;
+use crate::hash::compute_seed_hash;
+use crate::thetacommon::RawThetaSketchView;
+use crate::thetacommon::constants::MAX_THETA;
+use crate::tuple::hash_table::TupleEntry;
+use crate::tuple::policy::SummaryCombinePolicy;
+use crate::tuple::policy::SummaryPolicy;
+use crate::tuple::policy::SummaryUpdatePolicy;
+use crate::tuple::sketch::CompactTupleSketch;
+use crate::tuple::sketch::TupleSketch;
+use crate::tuple::sketch::TupleSketchBuilder;
+
+const SERIAL_VERSION: u8 = 1;
+const SKETCH_TYPE: u8 = 3;
+const PREAMBLE_LONGS: u8 = 1;
+
+const FLAGS_IS_BIG_ENDIAN: u8 = 1 << 0;
+const FLAGS_IS_EMPTY: u8 = 1 << 2;
+const FLAGS_HAS_ENTRIES: u8 = 1 << 3;
+const FLAGS_IS_ORDERED: u8 = 1 << 4;
+
+/// Summary policy that sums fixed-length arrays of doubles element-wise.
+#[derive(Debug, Clone, Copy)]
+pub(super) struct ArrayOfDoublesPolicy {
+    num_values: u8,
+}
+
+impl ArrayOfDoublesPolicy {
+    pub(super) fn new(num_values: u8) -> Self {
+        assert!(num_values > 0, "num_values must be at least 1");
+        Self { num_values }
+    }
+
+    pub(super) fn num_values(&self) -> u8 {
+        self.num_values
+    }
+}
+
+impl SummaryPolicy for ArrayOfDoublesPolicy {
+    type Summary = Vec<f64>;
+
+    fn create(&self) -> Self::Summary {
+        vec![0.0; self.num_values as usize]
+    }
+}
+
+impl SummaryUpdatePolicy<&[f64]> for ArrayOfDoublesPolicy {
+    fn update(&self, summary: &mut Self::Summary, values: &[f64]) {
+        assert_eq!(
+            values.len(),
+            summary.len(),
+            "expected {} values, got {}",
+            summary.len(),
+            values.len()
+        );
+        for (acc, value) in summary.iter_mut().zip(values) {
+            *acc += value;
+        }
+    }
+}
+
+impl SummaryCombinePolicy for ArrayOfDoublesPolicy {
+    fn combine(&self, summary: &mut Self::Summary, other: &Self::Summary) {
+        self.update(summary, other.as_slice());
+    }
+}
+
+/// Mutable Array-of-Doubles sketch for building from input data.
+///
+/// Every retained key carries `num_values` doubles. Updating an existing key adds the incoming
+/// values element-wise to the retained ones.
+///
+/// # Examples
+///
+/// ```
+/// # use datasketches::tuple::ArrayOfDoublesSketchBuilder;
+/// let mut sketch = ArrayOfDoublesSketchBuilder::new(2).build();
+/// sketch.update("apple", &[1.0, 10.0]);
+/// sketch.update("apple", &[2.0, 20.0]);
+/// assert_eq!(sketch.num_retained(), 1);
+///
+/// let (_, values) = sketch.iter().next().unwrap();
+/// assert_eq!(values, &[3.0, 30.0]);
+/// ```
+#[derive(Debug)]
+pub struct ArrayOfDoublesSketch {
+    inner: TupleSketch<ArrayOfDoublesPolicy>,
+}
+
+impl ArrayOfDoublesSketch {
+    /// Updates the sketch with a key and its values.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `values.len()` differs from [`num_values`](Self::num_values).
+    pub fn update(&mut self, key: impl Hash, values: &[f64]) {
+        let num_values = self.num_values() as usize;
+        assert_eq!(
+            values.len(),
+            num_values,
+            "expected {num_values} values, got {}",
+            values.len()
+        );
+        self.inner.update(key, values);
+    }
+
+    /// Returns the number of doubles retained per key.
+    pub fn num_values(&self) -> u8 {
+        self.inner.policy().num_values()
+    }
+
+    /// Returns the cardinality (distinct key count) estimate.
+    pub fn estimate(&self) -> f64 {
+        self.inner.estimate()
+    }
+
+    /// Returns theta as a fraction (0.0 to 1.0).
+    pub fn theta(&self) -> f64 {
+        self.inner.theta()
+    }
+
+    /// Returns theta as `u64`.
+    pub fn theta64(&self) -> u64 {
+        self.inner.theta64()
+    }
+
+    /// Returns the 16-bit seed hash.
+    pub fn seed_hash(&self) -> u16 {
+        self.inner.seed_hash()
+    }
+
+    /// Returns true if the sketch is empty.
+    pub fn is_empty(&self) -> bool {
+        self.inner.is_empty()
+    }
+
+    /// Returns true if the sketch is in estimation mode.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.inner.is_estimation_mode()
+    }
+
+    /// Returns the number of retained entries.
+    pub fn num_retained(&self) -> usize {
+        self.inner.num_retained()
+    }
+
+    /// Returns lg_k.
+    pub fn lg_k(&self) -> u8 {
+        self.inner.lg_k()
+    }
+
+    /// Trims the sketch to nominal size k.
+    pub fn trim(&mut self) {
+        self.inner.trim();
+    }
+
+    /// Resets the sketch to empty state.
+    pub fn reset(&mut self) {
+        self.inner.reset();
+    }
+
+    /// Returns an iterator over retained entries as `(hash, values)` pairs.
+    pub fn iter(&self) -> impl Iterator<Item = (u64, &[f64])> + '_ {
+        self.inner
+            .iter()
+            .map(|(hash, values)| (hash, values.as_slice()))
+    }
+
+    /// Returns the approximate lower error bound given the number of standard deviations.
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.inner.lower_bound(num_std_dev)
+    }
+
+    /// Returns the approximate upper error bound given the number of standard deviations.
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.inner.upper_bound(num_std_dev)
+    }
+
+    /// Returns the estimated size of the sketch in bytes.
+    pub fn estimated_size(&self) -> usize {
+        self.inner.estimated_size() + self.num_retained() * self.num_values() as usize * 8
+    }
+
+    /// Returns this sketch in compact (immutable) form.
+    ///
+    /// If `ordered` is true, retained entries are sorted by hash in ascending order.
+    pub fn compact(&self, ordered: bool) -> CompactArrayOfDoublesSketch {
+        CompactArrayOfDoublesSketch {
+            num_values: self.num_values(),
+            inner: self.inner.compact(ordered),
+        }
+    }
+}
+
+impl RawThetaSketchView<TupleEntry<Vec<f64>>> for ArrayOfDoublesSketch {
+    fn seed_hash(&self) -> u16 {
+        self.inner.seed_hash()
+    }
+
+    fn theta(&self) -> u64 {
+        self.inner.theta64()
+    }
+
+    fn is_empty(&self) -> bool {
+        self.inner.is_empty()
+    }
+
+    fn is_ordered(&self) -> bool {
+        false
+    }
+
+    fn iter(&self) -> impl Iterator<Item = TupleEntry<Vec<f64>>> + '_ {
+        RawThetaSketchView::iter(&self.inner)
+    }
+
+    fn num_retained(&self) -> usize {
+        self.inner.num_retained()
+    }
+}
+
+/// Compact (immutable) Array-of-Doubles sketch.
+///
+/// This is the serialization-friendly form, readable and writable in the compact format of the
+/// Java `ArrayOfDoublesCompactSketch` and the C++ `compact_array_of_doubles_sketch`.
+#[derive(Clone, Debug)]
+pub struct CompactArrayOfDoublesSketch {
+    num_values: u8,
+    inner: CompactTupleSketch<Vec<f64>>,
+}
+
+impl CompactArrayOfDoublesSketch {
+    pub(super) fn from_tuple_sketch(num_values: u8, inner: CompactTupleSketch<Vec<f64>>) -> Self {
+        Self { num_values, inner }
+    }
+
+    /// Returns the number of doubles retained per key.
+    pub fn num_values(&self) -> u8 {
+        self.num_values
+    }
+
+    /// Returns the cardinality (distinct key count) estimate.
+    pub fn estimate(&self) -> f64 {
+        self.inner.estimate()
+    }
+
+    /// Returns theta as a fraction (0.0 to 1.0).
+    pub fn theta(&self) -> f64 {
+        self.inner.theta()
+    }
+
+    /// Returns theta as `u64`.
+    pub fn theta64(&self) -> u64 {
+        self.inner.theta64()
+    }
+
+    /// Returns true if the sketch is empty.
+    pub fn is_empty(&self) -> bool {
+        self.inner.is_empty()
+    }
+
+    /// Returns true if the sketch is in estimation mode.
+    pub fn is_estimation_mode(&self) -> bool {
+        self.inner.is_estimation_mode()
+    }
+
+    /// Returns the number of retained entries.
+    pub fn num_retained(&self) -> usize {
+        self.inner.num_retained()
+    }
+
+    /// Returns true if retained entries are ordered (sorted ascending by hash).
+    pub fn is_ordered(&self) -> bool {
+        self.inner.is_ordered()
+    }
+
+    /// Returns the 16-bit seed hash.
+    pub fn seed_hash(&self) -> u16 {
+        self.inner.seed_hash()
+    }
+
+    /// Returns an iterator over retained entries as `(hash, values)` pairs.
+    pub fn iter(&self) -> impl Iterator<Item = (u64, &[f64])> + '_ {
+        self.inner
+            .iter()
+            .map(|(hash, values)| (hash, values.as_slice()))
+    }
+
+    /// Returns the approximate lower error bound given the number of standard deviations.
+    pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.inner.lower_bound(num_std_dev)
+    }
+
+    /// Returns the approximate upper error bound given the number of standard deviations.
+    pub fn upper_bound(&self, num_std_dev: NumStdDev) -> f64 {
+        self.inner.upper_bound(num_std_dev)
+    }
+
+    /// Returns the estimated size of the sketch in bytes.
+    pub fn estimated_size(&self) -> usize {
+        self.inner.estimated_size() + self.num_retained() * self.num_values as usize * 8
+    }
+
+    /// Serializes this sketch into the compact Array-of-Doubles binary format.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::tuple::ArrayOfDoublesSketchBuilder;
+    /// # use datasketches::tuple::CompactArrayOfDoublesSketch;
+    /// let mut sketch = ArrayOfDoublesSketchBuilder::new(1).build();
+    /// sketch.update(1, &[1.0]);
+    /// let bytes = sketch.compact(true).serialize();
+    /// let decoded = CompactArrayOfDoublesSketch::deserialize(&bytes).unwrap();
+    /// assert_eq!(decoded.num_retained(), 1);
+    /// ```
+    pub fn serialize(&self) -> Vec<u8> {
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces.
+    pub fn serialized_size_bytes(&self) -> usize {
+        let num_entries = self.num_retained();
+        let entries_size = if num_entries > 0 {
+            8 + num_entries * (8 + 8 * self.num_values as usize)
+        } else {
+            0
+        };
+        16 + entries_size
+    }
+
+    /// Serializes this sketch into `buf` in the format written by
+    /// [`serialize`](Self::serialize), returning the number of bytes written.
+    ///
+    /// Returns an error if `buf` is shorter than
+    /// [`serialized_size_bytes`](Self::serialized_size_bytes).
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error> {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
+
+    /// Streams this sketch to `writer` in the format written by [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()> {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    /// Returns the image of this sketch with its entries sorted by hash.
+    fn canonical_image(&self) -> Vec<u8> {
+        if self.is_ordered() {
+            self.serialize()
+        } else {
+            Self::from_tuple_sketch(self.num_values, self.inner.to_ordered()).serialize()
+        }
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes) {
+        let num_entries = self.num_retained();
+
+        bytes.write_u8(PREAMBLE_LONGS);
+        bytes.write_u8(SERIAL_VERSION);
+        bytes.write_u8(Family::TUPLE.id);
+        bytes.write_u8(SKETCH_TYPE);
+
+        let mut flags = 0;
+        if self.is_empty() {
+            flags |= FLAGS_IS_EMPTY;
+        }
+        if num_entries > 0 {
+            flags |= FLAGS_HAS_ENTRIES;
+        }
+        if self.is_ordered() {
+            flags |= FLAGS_IS_ORDERED;
+        }
+        bytes.write_u8(flags);
+        bytes.write_u8(self.num_values);
+        bytes.write_u16_le(self.seed_hash());
+        bytes.write_u64_le(self.theta64());
+
+        if num_entries > 0 {
+            bytes.write_u32_le(num_entries as u32);
+            bytes.write_u32_le(0); // unused
+            for (hash, _) in self.inner.iter() {
+                bytes.write_u64_le(hash);
+            }
+            for (_, values) in self.inner.iter() {
+                for value in values {
+                    bytes.write_f64_le(*value);
+                }
+            }
+        }
+    }
+
+    /// Deserializes a compact Array-of-Doubles sketch using the default seed.
+    pub fn deserialize(bytes: &[u8]) -> Result<Self, Error> {
+        Self::deserialize_with_seed(bytes, DEFAULT_UPDATE_SEED)
+    }
+
+    /// Reads a compact Array-of-Doubles sketch written by [`write_to`](Self::write_to) from
+    /// `reader`, using the default seed.
+    ///
+    /// Exactly the bytes of one image are consumed. Fails like
+    /// [`deserialize`](Self::deserialize); a failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error> {
+        Self::read_from_with_seed(reader, DEFAULT_UPDATE_SEED)
+    }
+
+    /// Reads a compact Array-of-Doubles sketch from `reader` using the provided expected `seed`.
+    pub fn read_from_with_seed(reader: &mut impl Read, seed: u64) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::from_reader(reader), seed)
+    }
+
+    /// Deserializes a compact Array-of-Doubles sketch using the provided expected `seed`.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if the bytes are truncated, the family/serial version/sketch type are
+    /// unexpected, the seed hash does not match (for sketches with entries), or an entry is
+    /// corrupted.
+    pub fn deserialize_with_seed(bytes: &[u8], seed: u64) -> Result<Self, Error> {
+        Self::read_image(SketchSlice::new(bytes), seed)
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>, seed: u64) -> Result<Self, Error> {
+        let pre_longs = cursor
+            .read_u8()
+            .map_err(insufficient_data("preamble_longs"))?;
+        let ser_ver = cursor
+            .read_u8()
+            .map_err(insufficient_data("serial_version"))?;
+        let family_id = cursor.read_u8().map_err(insufficient_data("family_id"))?;
+        let sketch_type = cursor.read_u8().map_err(insufficient_data("sketch_type"))?;
+        let flags = cursor.read_u8().map_err(insufficient_data("flags"))?;
+        let num_values = cursor.read_u8().map_err(insufficient_data("num_values"))?;
+        let seed_hash = cursor
+            .read_u16_le()
+            .map_err(insufficient_data("seed_hash"))?;
+
+        Family::TUPLE.validate_id(family_id)?;
+        ensure_preamble_longs_in(&[PREAMBLE_LONGS], pre_longs)?;
+        if ser_ver != SERIAL_VERSION {
+            return Err(Error::new(
+                ErrorKind::UnsupportedVersion,
+                format!("unsupported serial version: expected {SERIAL_VERSION}, got {ser_ver}"),
+            )
+            .with_reason(SketchError::UnsupportedSerialVersion {
+                expected: SERIAL_VERSION,
+                actual: ser_ver,
+            }));
+        }
+        if sketch_type != SKETCH_TYPE {
+            return Err(Error::deserial(format!(
+                "unsupported sketch type: expected {SKETCH_TYPE}, got {sketch_type}"
+            )));
+        }
+        if flags & FLAGS_IS_BIG_ENDIAN != 0 {
+            return Err(Error::deserial("big-endian sketches are not supported"));
+        }
+        if num_values == 0 {
+            return Err(Error::deserial("corrupted: num_values must be at least 1"));
+        }
+
+        let empty = (flags & FLAGS_IS_EMPTY) != 0;
+        let ordered = (flags & FLAGS_IS_ORDERED) != 0;
+        let has_entries = (flags & FLAGS_HAS_ENTRIES) != 0;
+
+        let theta = cursor.read_u64_le().map_err(insufficient_data("theta"))?;
+        if theta == 0 || theta > MAX_THETA {
+            return Err(Error::deserial(format!(
+                "corrupted: theta out of range: {theta}"
+            )));
+        }
+
+        let mut entries = vec![];
+        if has_entries {
+            let expected_seed_hash = compute_seed_hash(seed);
+            ensure_seed_hash_is(expected_seed_hash, seed_hash)?;
+
+            let num_entries = cursor
+                .read_u32_le()
+                .map_err(insufficient_data("num_entries"))? as usize;
+            cursor
+                .read_u32_le()
+                .map_err(insufficient_data("<unused_u32>"))?;
+
+            let mut hashes = Vec::with_capacity(cursor.capacity_hint(num_entries, 8));
+            for _ in 0..num_entries {
+                let hash = cursor
+                    .read_u64_le()
+                    .map_err(insufficient_data("entry_hash"))?;
+                if hash == 0 || hash >= theta {
+                    return Err(Error::deserial("corrupted: invalid retained hash value"));
+                }
+                hashes.push(hash);
+            }
+
+            entries.reserve(num_entries);
+            for hash in hashes {
+                let mut values = Vec::with_capacity(num_values as usize);
+                for _ in 0..num_values {
+                    let value = cursor
+                        .read_f64_le()
+                        .map_err(insufficient_data("entry_values"))?;
+                    values.push(value);
+                }
+                entries.push(TupleEntry::new(hash, values));
+            }
+        }
+
+        Ok(Self::from_tuple_sketch(
+            num_values,
+            CompactTupleSketch::from_parts(entries, theta, seed_hash, ordered, empty),
+        ))
+    }
+}
+
+impl RawThetaSketchView<TupleEntry<Vec<f64>>> for CompactArrayOfDoublesSketch {
+    fn seed_hash(&self) -> u16 {
+        self.inner.seed_hash()
+    }
+
+    fn theta(&self) -> u64 {
+        self.inner.theta64()
+    }
+
+    fn is_empty(&self) -> bool {
+        self.inner.is_empty()
+    }
+
+    fn is_ordered(&self) -> bool {
+        self.inner.is_ordered()
+    }
+
+    fn iter(&self) -> impl Iterator<Item = TupleEntry<Vec<f64>>> + '_ {
+        RawThetaSketchView::iter(&self.inner)
+    }
+
+    fn num_retained(&self) -> usize {
+        self.inner.num_retained()
+    }
+}
+
+/// Builder for [`ArrayOfDoublesSketch`].
+#[derive(Debug)]
+pub struct ArrayOfDoublesSketchBuilder {
+    inner: TupleSketchBuilder<ArrayOfDoublesPolicy>,
+}
+
+impl ArrayOfDoublesSketchBuilder {
+    /// Creates a builder for sketches retaining `num_values` doubles per key.
+    ///
+    /// # Panics
+    ///
+    /// Panics if `num_values` is zero.
+    pub fn new(num_values: u8) -> Self {
+        Self {
+            inner: TupleSketchBuilder::new(ArrayOfDoublesPolicy::new(num_values)),
+        }
+    }
+
+    /// Sets lg_k (log2 of the nominal size k).
+    ///
+    /// # Panics
+    ///
+    /// Panics if lg_k is not in range [5, 26].
+    pub fn lg_k(mut self, lg_k: u8) -> Self {
+        self.inner = self.inner.lg_k(lg_k);
+        self
+    }
+
+    /// Sets the resize factor.
+    pub fn resize_factor(mut self, factor: ResizeFactor) -> Self {
+        self.inner = self.inner.resize_factor(factor);
+        self
+    }
+
+    /// Sets the sampling probability p.
+    ///
+    /// # Panics
+    ///
+    /// Panics if p is not in range `(0.0, 1.0]`.
+    pub fn sampling_probability(mut self, probability: f32) -> Self {
+        self.inner = self.inner.sampling_probability(probability);
+        self
+    }
+
+    /// Sets the hash seed.
+    pub fn seed(mut self, seed: u64) -> Self {
+        self.inner = self.inner.seed(seed);
+        self
+    }
+
+    /// Apply the lg_k and seed of `config`, where set.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the lg_k of `config` is outside of the range accepted by [`lg_k`](Self::lg_k).
+    pub fn config(mut self, config: &SketchConfig) -> Self {
+        if let Some(lg_k) = config.lg_k {
+            self = self.lg_k(lg_k);
+        }
+        if let Some(seed) = config.seed {
+            self = self.seed(seed);
+        }
+        self
+    }
+
+    /// Builds an [`ArrayOfDoublesSketch`].
+    pub fn build(self) -> ArrayOfDoublesSketch {
+        ArrayOfDoublesSketch {
+            inner: self.inner.build(),
+        }
+    }
+}
+
+#[cfg(feature = "serde")]
+impl_serde_via_image!(CompactArrayOfDoublesSketch);
+#[cfg(feature = "base64")]
+impl_base64_via_image!(CompactArrayOfDoublesSketch);
+impl_fingerprint_via_image!([] CompactArrayOfDoublesSketch, |s| s.canonical_image());
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn compact_with_entries(n: u64, num_values: u8) -> CompactArrayOfDoublesSketch {
+        let mut sketch = ArrayOfDoublesSketchBuilder::new(num_values).build();
+        let values = vec![1.0; num_values as usize];
+        for i in 0..n {
+            sketch.update(i, &values);
+        }
+        sketch.compact(true)
+    }
+
+    #[test]
+    fn empty_sketch_layout() {
+        let bytes = compact_with_entries(0, 2).serialize();
+        assert_eq!(bytes.len(), 16);
+        assert_eq!(bytes[0], PREAMBLE_LONGS);
+        assert_eq!(bytes[1], SERIAL_VERSION);
+        assert_eq!(bytes[2], Family::TUPLE.id);
+        assert_eq!(bytes[3], SKETCH_TYPE);
+        assert_eq!(bytes[4], FLAGS_IS_EMPTY | FLAGS_IS_ORDERED);
+        assert_eq!(bytes[5], 2);
+        assert_eq!(
+            u16::from_le_bytes([bytes[6], bytes[7]]),
+            compute_seed_hash(DEFAULT_UPDATE_SEED)
+        );
+        assert_eq!(
+            u64::from_le_bytes(bytes[8..16].try_into().unwrap()),
+            MAX_THETA
+        );
+    }
+
+    #[test]
+    fn keys_are_written_before_values() {
+        let sketch = compact_with_entries(2, 3);
+        let bytes = sketch.serialize();
+        assert_eq!(bytes.len(), 24 + 2 * 8 + 2 * 3 * 8);
+        assert_eq!(bytes[4], FLAGS_HAS_ENTRIES | FLAGS_IS_ORDERED);
+        assert_eq!(u32::from_le_bytes(bytes[16..20].try_into().unwrap()), 2);
+
+        let hashes: Vec<u64> = sketch.iter().map(|(hash, _)| hash).collect();
+        assert_eq!(
+            u64::from_le_bytes(bytes[24..32].try_into().unwrap()),
+            hashes[0]
+        );
+        assert_eq!(
+            u64::from_le_bytes(bytes[32..40].try_into().unwrap()),
+            hashes[1]
+        );
+        assert_eq!(f64::from_le_bytes(bytes[40..48].try_into().unwrap()), 1.0);
+    }
+
+    #[test]
+    fn rejects_big_endian_flag() {
+        let mut bytes = compact_with_entries(0, 1).serialize();
+        bytes[4] |= FLAGS_IS_BIG_ENDIAN;
+        let err = CompactArrayOfDoublesSketch::deserialize(&bytes).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidData);
+    }
+
+    #[test]
+    fn rejects_truncated_values() {
+        let bytes = compact_with_entries(10, 2).serialize();
+        let err = CompactArrayOfDoublesSketch::deserialize(&bytes[..bytes.len() - 1]).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidData);
+    }
+
+    #[test]
+    fn combine_policy_sums_element_wise() {
+        let policy = ArrayOfDoublesPolicy::new(2);
+        let mut summary = policy.create();
+        policy.combine(&mut summary, &vec![1.0, 2.0]);
+        policy.combine(&mut summary, &vec![3.0, 4.0]);
+        assert_eq!(summary, vec![4.0, 6.0]);
+    }
+}
@@ -0,0 +1,164 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Tuple sketch intersection.
+//!
+//! [`TupleIntersection`] computes the intersection (set AND) of any number of Tuple sketches using
+//! the raw intersection state machine shared with the Theta intersection. The summaries of a key
+//! present in every input are combined with a [`SummaryCombinePolicy`].
+
+use crate::error::Error;
+use crate::hash::DEFAULT_UPDATE_SEED;
+use crate::thetacommon::intersection::RawThetaIntersection;
+use crate::thetacommon::intersection::RawThetaIntersectionPolicy;
+use crate::tuple::hash_table::TupleEntry;
+use crate::tuple::policy::SummaryCombinePolicy;
+use crate::tuple::sketch::CompactTupleSketch;
+use crate::tuple::sketch::TupleSketchView;
+use crate::tuple::union::CombinePolicyAdapter;
+
+impl<P> RawThetaIntersectionPolicy<TupleEntry<P::Summary>> for CombinePolicyAdapter<P>
+where
+    P: SummaryCombinePolicy,
+{
+    fn merge(&self, existing: &mut TupleEntry<P::Summary>, incoming: TupleEntry<P::Summary>) {
+        self.0.combine(existing.summary_mut(), incoming.summary());
+    }
+}
+
+/// Intersection (set AND) of Tuple sketches.
+///
+/// `P` is the [`SummaryCombinePolicy`] applied to the summaries of keys present in every input.
+/// There is no default policy: whether to add, keep the minimum, or otherwise combine summaries is
+/// application-specific.
+///
+/// Before the first [`update`](Self::update), the result is undefined; use
+/// [`has_result`](Self::has_result) to check.
+///
+/// # Examples
+///
+/// ```
+/// use datasketches::tuple::DefaultUpdatePolicy;
+/// use datasketches::tuple::SummaryCombinePolicy;
+/// use datasketches::tuple::SummaryPolicy;
+/// use datasketches::tuple::TupleIntersection;
+/// use datasketches::tuple::TupleSketchBuilder;
+///
+/// struct MinPolicy;
+///
+/// impl SummaryPolicy for MinPolicy {
+///     type Summary = u64;
+///
+///     fn create(&self) -> Self::Summary {
+///         u64::MAX
+///     }
+/// }
+///
+/// impl SummaryCombinePolicy for MinPolicy {
+///     fn combine(&self, summary: &mut Self::Summary, other: &Self::Summary) {
+///         *summary = (*summary).min(*other);
+///     }
+/// }
+///
+/// let update_policy = DefaultUpdatePolicy::<u64>::default();
+/// let mut a = TupleSketchBuilder::new(update_policy).build();
+/// a.update("apple", 1);
+/// a.update("banana", 2);
+///
+/// let mut b = TupleSketchBuilder::new(update_policy).build();
+/// b.update("banana", 3);
+/// b.update("cherry", 4);
+///
+/// let mut intersection = TupleIntersection::new_with_default_seed(MinPolicy);
+/// intersection.update(&a).unwrap();
+/// intersection.update(&b).unwrap();
+///
+/// let result = intersection.to_sketch(true);
+/// assert_eq!(result.num_retained(), 1); // banana
+/// assert_eq!(*result.iter().next().unwrap().1, 2);
+/// ```
+#[derive(Debug)]
+pub struct TupleIntersection<P>
+where
+    P: SummaryCombinePolicy,
+{
+    raw: RawThetaIntersection<TupleEntry<P::Summary>, CombinePolicyAdapter<P>>,
+}
+
+impl<P> TupleIntersection<P>
+where
+    P: SummaryCombinePolicy,
+{
+    /// Creates a new intersection operator for the given combine `policy` and `seed`.
+    pub fn new(policy: P, seed: u64) -> Self {
+        Self {
+            raw: RawThetaIntersection::new(seed, CombinePolicyAdapter(policy)),
+        }
+    }
+
+    /// Creates a new intersection operator for the given combine `policy` with the default seed.
+    pub fn new_with_default_seed(policy: P) -> Self {
+        Self::new(policy, DEFAULT_UPDATE_SEED)
+    }
+
+    /// Intersects a sketch into the current result.
+    ///
+    /// Accepts either a [`TupleSketch`](crate::tuple::TupleSketch) or a [`CompactTupleSketch`]
+    /// through the shared [`TupleSketchView`] trait.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error if `sketch` was built with a different seed than this intersection, or if
+    /// `sketch` is corrupted.
+    pub fn update<V>(&mut self, sketch: &V) -> Result<(), Error>
+    where
+        V: TupleSketchView<P::Summary>,
+        P::Summary: Clone,
+    {
+        self.raw.update(sketch)
+    }
+
+    /// Returns whether this operator has received at least one update.
+    pub fn has_result(&self) -> bool {
+        self.raw.has_result()
+    }
+
+    /// Returns the intersection as a [`CompactTupleSketch`].
+    ///
+    /// If `ordered` is true, retained entries are sorted ascending by hash.
+    ///
+    /// # Panics
+    ///
+    /// Panics if called before the first [`update`](Self::update).
+    pub fn to_sketch(&self, ordered: bool) -> CompactTupleSketch<P::Summary>
+    where
+        P::Summary: Clone,
+    {
+        assert!(
+            self.raw.has_result(),
+            "TupleIntersection::to_sketch() called before first update()"
+        );
+        let result = self.raw.to_compact_parts(ordered);
+        CompactTupleSketch::from_parts(
+            result.entries,
+            result.theta,
+            result.seed_hash,
+            result.ordered,
+            result.empty,
+        )
+    }
+}
@@ -26,7 +26,11 @@
 //! creates summaries, while [`SummaryUpdatePolicy`] folds update values into them. Summaries that
 //! implement `Default` and `AddAssign` can use [`DefaultUpdatePolicy`]. Set operations combine the
 //! summaries of shared keys through [`SummaryCombinePolicy`]; the union defaults to
-//! [`DefaultUnionPolicy`].
+//! [`DefaultUnionPolicy`], while [`TupleIntersection`] always takes an explicit policy.
+//! [`TupleAnotB`] keeps the summaries of sketch A unchanged.
+//!
+//! [`ArrayOfDoublesSketch`] is a ready-made specialization that keeps a fixed number of `f64`
+//! values per key and reads and writes the Java/C++ Array-of-Doubles compact format.
 //!
 //! # Usage
 //!
@@ -38,13 +42,21 @@
 //! assert!(sketch.estimate() >= 1.0);
 //! ```
 
+mod a_not_b;
+mod array_of_doubles;
 mod hash_table;
+mod intersection;
 mod policy;
 mod serialization;
 mod sketch;
 mod union;
 
+pub use self::a_not_b::TupleAnotB;
+pub use self::array_of_doubles::ArrayOfDoublesSketch;
+pub use self::array_of_doubles::ArrayOfDoublesSketchBuilder;
+pub use self::array_of_doubles::CompactArrayOfDoublesSketch;
 pub use self::hash_table::TupleEntry;
+pub use self::intersection::TupleIntersection;
 pub use self::policy::DefaultUnionPolicy;
 pub use self::policy::DefaultUpdatePolicy;
 pub use self::policy::SummaryCombinePolicy;
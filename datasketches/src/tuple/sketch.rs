@@ -23,15 +23,27 @@
 //! implementations.
 
 use std::hash::Hash;
+use std::io;
+use std::io::Read;
+use std::io::Write;
 
 use crate::codec::SketchBytes;
 use crate::codec::SketchSlice;
 use crate::codec::assert::ensure_preamble_longs_in_range;
+use crate::codec::assert::ensure_seed_hash_is;
 use crate::codec::assert::insufficient_data;
+#[cfg(feature = "base64")]
+use crate::codec::base64::impl_base64_via_image;
 use crate::codec::family::Family;
+use crate::codec::fingerprint::impl_fingerprint_via_image;
+#[cfg(feature = "serde")]
+use crate::codec::serde::impl_serde_via_image;
 use crate::common::NumStdDev;
 use crate::common::ResizeFactor;
+use crate::common::SketchConfig;
 use crate::error::Error;
+use crate::error::ErrorKind;
+use crate::error::SketchError;
 use crate::hash::DEFAULT_UPDATE_SEED;
 use crate::hash::compute_seed_hash;
 use crate::thetacommon::RawThetaSketchView;
@@ -134,6 +146,9 @@ where
             return 0.0;
         }
         let num_retained = self.table.num_retained() as f64;
+        if !self.is_estimation_mode() {
+            return num_retained;
+        }
         let theta = self.table.theta() as f64 / MAX_THETA as f64;
         num_retained / theta
     }
@@ -188,6 +203,44 @@ where
         self.table.iter()
     }
 
+    /// Returns a compact sketch of the same keys whose summaries are transformed by `f`.
+    ///
+    /// Theta and the empty state are kept, so the estimate and bounds are unchanged. If `ordered`
+    /// is true, retained entries are sorted by hash in ascending order.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::tuple::{DefaultUpdatePolicy, TupleSketchBuilder};
+    /// let policy = DefaultUpdatePolicy::<u64>::default();
+    /// let mut sketch = TupleSketchBuilder::new(policy).build();
+    /// sketch.update("apple", 3);
+    /// let doubled = sketch.map_summaries(|count| *count as f64 * 2.0, true);
+    /// assert_eq!(*doubled.iter().next().unwrap().1, 6.0);
+    /// ```
+    pub fn map_summaries<T>(
+        &self,
+        mut f: impl FnMut(&P::Summary) -> T,
+        ordered: bool,
+    ) -> CompactTupleSketch<T> {
+        self.compact_filter_map(|summary| Some(f(summary)), ordered)
+    }
+
+    fn compact_filter_map<T>(
+        &self,
+        f: impl FnMut(&P::Summary) -> Option<T>,
+        ordered: bool,
+    ) -> CompactTupleSketch<T> {
+        let empty = self.table.is_empty();
+        let theta = if empty { MAX_THETA } else { self.table.theta() };
+        let mut entries = filter_map_entries(self.table.iter(), f);
+        let ordered = ordered || entries.len() <= 1;
+        if ordered {
+            entries.sort_unstable_by_key(TupleEntry::hash);
+        }
+        CompactTupleSketch::from_parts(entries, theta, self.table.seed_hash(), ordered, empty)
+    }
+
     /// Returns the approximate lower error bound given the number of standard deviations.
     pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
         if !self.is_estimation_mode() {
@@ -211,6 +264,11 @@ where
         .expect("theta should always be valid")
     }
 
+    /// Returns the policy used to create and update summaries.
+    pub(super) fn policy(&self) -> &P {
+        &self.policy
+    }
+
     /// Returns the estimated size of the sketch in bytes.
     pub fn estimated_size(&self) -> usize {
         size_of::<Self>() + self.table.estimated_size()
@@ -246,6 +304,36 @@ where
             parts.empty,
         )
     }
+
+    /// Returns a compact sketch of the retained entries whose summary satisfies `predicate`.
+    ///
+    /// This is the Tuple `Filter` of Java. Theta is kept, so the estimate of the result is
+    /// the estimated number of distinct keys whose summary satisfies the predicate. If
+    /// `ordered` is true, retained entries are sorted by hash in ascending order.
+    ///
+    /// # Examples
+    ///
+    /// ```
+    /// # use datasketches::tuple::{DefaultUpdatePolicy, TupleSketchBuilder};
+    /// let policy = DefaultUpdatePolicy::<u64>::default();
+    /// let mut revenue = TupleSketchBuilder::new(policy).build();
+    /// revenue.update("alice", 120);
+    /// revenue.update("bob", 30);
+    /// revenue.update("alice", 15);
+    ///
+    /// let big_spenders = revenue.filter(|total| *total > 100, true);
+    /// assert_eq!(big_spenders.estimate(), 1.0);
+    /// ```
+    pub fn filter(
+        &self,
+        mut predicate: impl FnMut(&P::Summary) -> bool,
+        ordered: bool,
+    ) -> CompactTupleSketch<P::Summary> {
+        self.compact_filter_map(
+            |summary| predicate(summary).then(|| summary.clone()),
+            ordered,
+        )
+    }
 }
 
 impl<P> RawThetaSketchView<TupleEntry<P::Summary>> for TupleSketch<P>
@@ -311,6 +399,29 @@ impl<S> CompactTupleSketch<S> {
         }
     }
 
+    /// Returns a copy with its entries sorted by hash, as an ordered compact sketch keeps them.
+    pub(super) fn to_ordered(&self) -> Self
+    where
+        S: Clone,
+    {
+        let mut entries = self.entries.clone();
+        entries.sort_unstable_by_key(|entry| entry.hash());
+        Self::from_parts(entries, self.theta, self.seed_hash, true, self.empty)
+    }
+
+    /// Returns the image of the ordered form of this sketch, so that unordered sketches
+    /// retaining the same entries in different orders share one image.
+    fn canonical_image(&self) -> Vec<u8>
+    where
+        S: TupleSummaryValue + Clone,
+    {
+        if self.ordered {
+            self.serialize()
+        } else {
+            self.to_ordered().serialize()
+        }
+    }
+
     /// Returns the cardinality (distinct key count) estimate.
     pub fn estimate(&self) -> f64 {
         if self.is_empty() {
@@ -366,6 +477,42 @@ impl<S> CompactTupleSketch<S> {
             .map(|entry| (entry.hash(), entry.summary()))
     }
 
+    /// Returns a compact sketch of the retained entries whose summary satisfies `predicate`.
+    ///
+    /// This is the Tuple `Filter` of Java. Theta, the seed hash and the order of the entries are
+    /// kept, so the estimate of the result is the estimated number of distinct keys whose
+    /// summary satisfies the predicate.
+    pub fn filter(&self, mut predicate: impl FnMut(&S) -> bool) -> Self
+    where
+        S: Clone,
+    {
+        let entries = filter_map_entries(self.iter(), |summary| {
+            predicate(summary).then(|| summary.clone())
+        });
+        Self::from_parts(
+            entries,
+            self.theta,
+            self.seed_hash,
+            self.ordered,
+            self.empty,
+        )
+    }
+
+    /// Returns a compact sketch of the same keys whose summaries are transformed by `f`.
+    ///
+    /// Theta, the seed hash and the order of the entries are kept, so the estimate and bounds
+    /// are unchanged.
+    pub fn map_summaries<T>(&self, mut f: impl FnMut(&S) -> T) -> CompactTupleSketch<T> {
+        let entries = filter_map_entries(self.iter(), |summary| Some(f(summary)));
+        CompactTupleSketch::from_parts(
+            entries,
+            self.theta,
+            self.seed_hash,
+            self.ordered,
+            self.empty,
+        )
+    }
+
     /// Returns the approximate lower error bound given the number of standard deviations.
     pub fn lower_bound(&self, num_std_dev: NumStdDev) -> f64 {
         if !self.is_estimation_mode() {
@@ -424,14 +571,51 @@ impl<S> CompactTupleSketch<S> {
     where
         S: TupleSummaryValue,
     {
-        let pre_longs = self.preamble_longs();
+        let mut bytes = SketchBytes::with_capacity(self.serialized_size_bytes());
+        self.write_image(&mut bytes);
+        bytes.into_bytes()
+    }
+
+    /// Returns the number of bytes [`serialize`](Self::serialize) produces, as reported by
+    /// [`TupleSummaryValue::serialize_size`] for the summaries.
+    pub fn serialized_size_bytes(&self) -> usize
+    where
+        S: TupleSummaryValue,
+    {
         let entries_size: usize = self
             .entries
             .iter()
             .map(|entry| 8 + entry.summary().serialize_size())
             .sum();
-        let mut bytes = SketchBytes::with_capacity(8 * pre_longs as usize + entries_size);
+        8 * self.preamble_longs() as usize + entries_size
+    }
+
+    /// Serializes this sketch into `buf` in the format written by
+    /// [`serialize`](Self::serialize), returning the number of bytes written.
+    ///
+    /// Returns an error if `buf` is too short for the image.
+    pub fn serialize_into(&self, buf: &mut [u8]) -> Result<usize, Error>
+    where
+        S: TupleSummaryValue,
+    {
+        SketchBytes::write_into(buf, |bytes| self.write_image(bytes))
+    }
 
+    /// Streams this sketch to `writer` in the format written by [`serialize`](Self::serialize).
+    ///
+    /// Returns any error of `writer`.
+    pub fn write_to(&self, writer: &mut impl Write) -> io::Result<()>
+    where
+        S: TupleSummaryValue,
+    {
+        SketchBytes::write_to(writer, |bytes| self.write_image(bytes))
+    }
+
+    fn write_image(&self, bytes: &mut SketchBytes)
+    where
+        S: TupleSummaryValue,
+    {
+        let pre_longs = self.preamble_longs();
         bytes.write_u8(pre_longs);
         bytes.write_u8(SERIAL_VERSION);
         bytes.write_u8(Family::TUPLE.id);
@@ -458,9 +642,8 @@ impl<S> CompactTupleSketch<S> {
 
         for entry in &self.entries {
             bytes.write_u64_le(entry.hash());
-            entry.summary().serialize_value(&mut bytes);
+            entry.summary().serialize_value(bytes);
         }
-        bytes.into_bytes()
     }
 
     /// Deserializes a compact Tuple sketch using the default seed.
@@ -481,7 +664,43 @@ impl<S> CompactTupleSketch<S> {
     where
         S: TupleSummaryValue,
     {
-        let mut cursor = SketchSlice::new(bytes);
+        Self::read_image(SketchSlice::new(bytes), seed)
+    }
+
+    /// Reads a compact Tuple sketch written by [`write_to`](Self::write_to) from `reader`,
+    /// using the default seed.
+    ///
+    /// Exactly the bytes of one image are consumed, so several sketches can be read back from
+    /// the same stream.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as [`deserialize`](Self::deserialize). A
+    /// failing `reader` is reported as insufficient data.
+    pub fn read_from(reader: &mut impl Read) -> Result<Self, Error>
+    where
+        S: TupleSummaryValue,
+    {
+        Self::read_from_with_seed(reader, DEFAULT_UPDATE_SEED)
+    }
+
+    /// Reads a compact Tuple sketch from `reader` using the provided expected `seed`.
+    ///
+    /// # Errors
+    ///
+    /// Returns an error under the same conditions as
+    /// [`deserialize_with_seed`](Self::deserialize_with_seed).
+    pub fn read_from_with_seed(reader: &mut impl Read, seed: u64) -> Result<Self, Error>
+    where
+        S: TupleSummaryValue,
+    {
+        Self::read_image(SketchSlice::from_reader(reader), seed)
+    }
+
+    fn read_image(mut cursor: SketchSlice<'_>, seed: u64) -> Result<Self, Error>
+    where
+        S: TupleSummaryValue,
+    {
         let pre_longs = cursor
             .read_u8()
             .map_err(insufficient_data("preamble_longs"))?;
@@ -502,10 +721,17 @@ impl<S> CompactTupleSketch<S> {
             pre_longs,
         )?;
         if ser_ver != SERIAL_VERSION && ser_ver != SERIAL_VERSION_LEGACY {
-            return Err(Error::deserial(format!(
-                "unsupported serial version: expected {} or {}, got {ser_ver}",
-                SERIAL_VERSION, SERIAL_VERSION_LEGACY,
-            )));
+            return Err(Error::new(
+                ErrorKind::UnsupportedVersion,
+                format!(
+                    "unsupported serial version: expected {} or {}, got {ser_ver}",
+                    SERIAL_VERSION, SERIAL_VERSION_LEGACY,
+                ),
+            )
+            .with_reason(SketchError::UnsupportedSerialVersion {
+                expected: SERIAL_VERSION,
+                actual: ser_ver,
+            }));
         }
         if sketch_type != SKETCH_TYPE && sketch_type != SKETCH_TYPE_LEGACY {
             return Err(Error::deserial(format!(
@@ -528,11 +754,7 @@ impl<S> CompactTupleSketch<S> {
         }
 
         let expected_seed_hash = compute_seed_hash(seed);
-        if seed_hash != expected_seed_hash {
-            return Err(Error::deserial(format!(
-                "incompatible seed hash: expected {expected_seed_hash}, got {seed_hash}",
-            )));
-        }
+        ensure_seed_hash_is(expected_seed_hash, seed_hash)?;
 
         let mut theta = MAX_THETA;
         let num_entries = if pre_longs == 1 {
@@ -550,7 +772,7 @@ impl<S> CompactTupleSketch<S> {
             n
         };
 
-        let mut entries = Vec::with_capacity(num_entries);
+        let mut entries = Vec::with_capacity(cursor.capacity_hint(num_entries, 8));
         for _ in 0..num_entries {
             let hash = cursor
                 .read_u64_le()
@@ -592,6 +814,16 @@ impl<S: Clone> RawThetaSketchView<TupleEntry<S>> for CompactTupleSketch<S> {
     }
 }
 
+/// Keeps the entries for which `f` returns a summary, paired with that summary.
+fn filter_map_entries<'a, S: 'a, T>(
+    entries: impl Iterator<Item = (u64, &'a S)>,
+    mut f: impl FnMut(&S) -> Option<T>,
+) -> Vec<TupleEntry<T>> {
+    entries
+        .filter_map(|(hash, summary)| f(summary).map(|summary| TupleEntry::new(hash, summary)))
+        .collect()
+}
+
 /// Builder for [`TupleSketch`].
 ///
 /// Every builder carries a concrete [`SummaryPolicy`]. Use
@@ -692,6 +924,21 @@ where
         self
     }
 
+    /// Apply the lg_k and seed of `config`, where set.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the lg_k of `config` is outside of the range accepted by [`lg_k`](Self::lg_k).
+    pub fn config(mut self, config: &SketchConfig) -> Self {
+        if let Some(lg_k) = config.lg_k {
+            self = self.lg_k(lg_k);
+        }
+        if let Some(seed) = config.seed {
+            self = self.seed(seed);
+        }
+        self
+    }
+
     /// Builds a [`TupleSketch`] using the supplied policy.
     pub fn build(self) -> TupleSketch<P> {
         TupleSketch {
@@ -706,10 +953,18 @@ where
     }
 }
 
+#[cfg(feature = "serde")]
+impl_serde_via_image!([S: TupleSummaryValue] CompactTupleSketch<S>);
+#[cfg(feature = "base64")]
+impl_base64_via_image!([S: TupleSummaryValue] CompactTupleSketch<S>);
+impl_fingerprint_via_image!(
+    [S: TupleSummaryValue + Clone] CompactTupleSketch<S>,
+    |s| s.canonical_image()
+);
+
 #[cfg(test)]
 mod tests {
     use super::*;
-    use crate::error::ErrorKind;
     use crate::tuple::policy::DefaultUpdatePolicy;
     use crate::tuple::policy::SummaryPolicy;
     use crate::tuple::policy::SummaryUpdatePolicy;
@@ -23,6 +23,7 @@
 //! combined with a [`SummaryCombinePolicy`] instead of one being dropped.
 
 use crate::common::ResizeFactor;
+use crate::common::SketchConfig;
 use crate::error::Error;
 use crate::hash::DEFAULT_UPDATE_SEED;
 use crate::thetacommon::constants::DEFAULT_LG_K;
@@ -35,9 +36,9 @@ use crate::tuple::policy::SummaryCombinePolicy;
 use crate::tuple::sketch::CompactTupleSketch;
 use crate::tuple::sketch::TupleSketchView;
 
-/// Adapts a [`SummaryCombinePolicy`] to the raw union's entry-merge policy.
+/// Adapts a [`SummaryCombinePolicy`] to the raw set operations' entry-merge policies.
 #[derive(Debug)]
-struct CombinePolicyAdapter<P>(P);
+pub(super) struct CombinePolicyAdapter<P>(pub(super) P);
 
 impl<P> RawThetaUnionPolicy<TupleEntry<P::Summary>> for CombinePolicyAdapter<P>
 where
@@ -209,6 +210,21 @@ where
         self
     }
 
+    /// Apply the lg_k and seed of `config`, where set.
+    ///
+    /// # Panics
+    ///
+    /// Panics if the lg_k of `config` is outside of the range accepted by [`lg_k`](Self::lg_k).
+    pub fn config(mut self, config: &SketchConfig) -> Self {
+        if let Some(lg_k) = config.lg_k {
+            self = self.lg_k(lg_k);
+        }
+        if let Some(seed) = config.seed {
+            self = self.seed(seed);
+        }
+        self
+    }
+
     /// Builds the [`TupleUnion`].
     pub fn build(self) -> TupleUnion<P> {
         TupleUnion {
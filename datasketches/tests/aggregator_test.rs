@@ -0,0 +1,183 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(
+    feature = "aggregator",
+    feature = "cpc",
+    feature = "hll",
+    feature = "kll",
+    feature = "theta"
+))]
+
+use std::sync::mpsc;
+use std::time::Duration;
+
+use datasketches::aggregator::Aggregator;
+use datasketches::aggregator::Flush;
+use datasketches::cpc::CpcSketch;
+use datasketches::cpc::CpcUnion;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+use datasketches::kll::KllSketch;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::theta::ThetaUnion;
+use datasketches::theta::ThetaUnionBuilder;
+
+const LONG: Duration = Duration::from_secs(3600);
+
+fn hll_image(range: std::ops::Range<u64>) -> Vec<u8> {
+    let mut sketch = HllSketch::new(12, HllType::Hll4);
+    sketch.extend(range);
+    sketch.serialize()
+}
+
+#[test]
+fn test_unions_per_key_from_many_producers() {
+    let (flushes, received) = mpsc::channel();
+    let aggregator = Aggregator::spawn(
+        LONG,
+        |_: &u32| HllUnion::new(12),
+        move |flush| flushes.send(flush).unwrap(),
+    );
+
+    let producers: Vec<_> = (0..4u64)
+        .map(|p| {
+            let sender = aggregator.sender();
+            std::thread::spawn(move || {
+                for i in 0..10 {
+                    let start = (p * 10 + i) * 100;
+                    assert!(sender.send(0, hll_image(start..start + 100)));
+                    assert!(sender.send(1, hll_image(0..100)));
+                }
+            })
+        })
+        .collect();
+    for producer in producers {
+        producer.join().unwrap();
+    }
+    aggregator.close();
+
+    let flush: Flush<u32, HllUnion> = received.recv().unwrap();
+    assert!(flush.errors().is_empty());
+    let unions = flush.into_unions();
+    assert_eq!(unions.len(), 2);
+    let error = (unions[&0].estimate() - 4000.0).abs() / 4000.0;
+    assert!(error < 0.05, "{}", unions[&0].estimate());
+    assert_eq!(unions[&1].estimate().round(), 100.0);
+    assert!(received.recv().is_err());
+}
+
+#[test]
+fn test_flush_starts_new_unions() {
+    let (flushes, received) = mpsc::channel();
+    let aggregator = Aggregator::spawn(
+        LONG,
+        |_: &&str| CpcUnion::new(11),
+        move |flush: Flush<_, CpcUnion>| flushes.send(flush.into_unions()).unwrap(),
+    );
+
+    let image = |n: u64| {
+        let mut sketch = CpcSketch::new(11);
+        sketch.extend(0..n);
+        sketch.serialize()
+    };
+    aggregator.send("a", image(10));
+    aggregator.flush();
+    let first = received.recv().unwrap();
+    assert_eq!(first["a"].to_sketch().estimate().round(), 10.0);
+
+    // a flush without new images does not call back
+    aggregator.flush();
+    aggregator.send("b", image(20));
+    aggregator.flush();
+    let second = received.recv().unwrap();
+    assert_eq!(second.len(), 1);
+    assert_eq!(second["b"].to_sketch().estimate().round(), 20.0);
+
+    aggregator.close();
+    assert!(received.recv().is_err());
+}
+
+#[test]
+fn test_periodic_flush() {
+    let (flushes, received) = mpsc::channel();
+    let aggregator = Aggregator::spawn(
+        Duration::from_millis(10),
+        |_: &()| ThetaUnionBuilder::default().build(),
+        move |flush: Flush<(), ThetaUnion>| flushes.send(flush.into_unions()).unwrap(),
+    );
+
+    let mut sketch = ThetaSketchBuilder::default().build();
+    sketch.extend(0..50);
+    aggregator.send((), sketch.compact(true).serialize());
+    // no explicit flush; the timer hands over the union
+    let unions = received.recv_timeout(Duration::from_secs(60)).unwrap();
+    assert_eq!(unions[&()].to_sketch(true).estimate(), 50.0);
+    drop(aggregator);
+}
+
+#[test]
+fn test_invalid_images_are_reported() {
+    let (flushes, received) = mpsc::channel();
+    let aggregator = Aggregator::spawn(
+        LONG,
+        |_: &&str| KllSketch::<f64>::default(),
+        move |flush| flushes.send(flush).unwrap(),
+    );
+
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.extend((0..100).map(f64::from));
+    aggregator.send("good", sketch.serialize());
+    aggregator.send("bad", vec![1, 2, 3]);
+    aggregator.send("good", vec![]);
+    aggregator.close();
+
+    let flush: Flush<&str, KllSketch<f64>> = received.recv().unwrap();
+    // a key whose only image was invalid has no union
+    assert_eq!(flush.unions().len(), 1);
+    assert_eq!(flush.unions()["good"].n(), 100);
+    let keys: Vec<_> = flush.errors().iter().map(|(key, _)| *key).collect();
+    assert_eq!(keys, ["bad", "good"]);
+}
+
+#[test]
+fn test_send_after_close() {
+    let aggregator = Aggregator::spawn(LONG, |_: &u8| HllUnion::new(12), |_| {});
+    let sender = aggregator.sender();
+    assert!(sender.send(1, hll_image(0..10)));
+    aggregator.close();
+    assert!(!sender.send(1, hll_image(0..10)));
+}
+
+#[test]
+#[should_panic(expected = "flush_interval must be positive")]
+fn test_zero_flush_interval() {
+    Aggregator::spawn(Duration::ZERO, |_: &u8| HllUnion::new(12), |_| {});
+}
+
+#[test]
+#[should_panic(expected = "callback failed")]
+fn test_close_resumes_callback_panic() {
+    let aggregator = Aggregator::spawn(
+        LONG,
+        |_: &u8| HllUnion::new(12),
+        |_| panic!("callback failed"),
+    );
+    aggregator.send(1, hll_image(0..10));
+    aggregator.close();
+}
@@ -0,0 +1,77 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(
+    feature = "base64",
+    feature = "hll",
+    feature = "kll",
+    feature = "tdigest",
+    feature = "theta"
+))]
+
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::kll::KllSketch;
+use datasketches::tdigest::TDigestMut;
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+
+#[test]
+fn test_round_trip() {
+    let mut hll = HllSketch::new(10, HllType::Hll4);
+    hll.extend(0..1000);
+    let decoded = HllSketch::from_base64(&hll.to_base64()).unwrap();
+    assert_eq!(decoded.serialize(), hll.serialize());
+
+    let mut kll = KllSketch::<f64>::default();
+    kll.extend((0..1000).map(f64::from));
+    let decoded = KllSketch::<f64>::from_base64(&kll.to_base64()).unwrap();
+    assert_eq!(decoded.serialize(), kll.serialize());
+
+    let mut theta = ThetaSketchBuilder::default().build();
+    theta.extend(0..1000);
+    let compact = theta.compact(true);
+    let decoded = CompactThetaSketch::from_base64(&compact.to_base64()).unwrap();
+    assert_eq!(decoded.serialize(), compact.serialize());
+
+    let mut tdigest = TDigestMut::new(100);
+    tdigest.extend((0..1000).map(f64::from));
+    let mut decoded = TDigestMut::from_base64(&tdigest.to_base64()).unwrap();
+    assert_eq!(decoded.serialize(), tdigest.serialize());
+}
+
+#[test]
+fn test_encodes_serialized_image() {
+    // the 8-byte image of an empty List mode sketch
+    let sketch = HllSketch::new(12, HllType::Hll8);
+    assert_eq!(sketch.serialize(), [2, 1, 7, 12, 3, 12, 0, 8]);
+    assert_eq!(sketch.to_base64(), "AgEHDAMMAAg=");
+
+    // surrounding whitespace, as left by a text column or a shell, is ignored
+    let decoded = HllSketch::from_base64(" AgEHDAMMAAg=\n").unwrap();
+    assert_eq!(decoded, sketch);
+}
+
+#[test]
+fn test_invalid_text_is_an_error() {
+    let err = HllSketch::from_base64("not base64!").unwrap_err();
+    assert!(err.message().contains("invalid base64"), "{err}");
+
+    // valid base64 of a truncated image
+    let err = HllSketch::from_base64("AgEH").unwrap_err();
+    assert!(err.message().contains("insufficient data"), "{err}");
+}
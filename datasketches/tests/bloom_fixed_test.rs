@@ -0,0 +1,72 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "bloom")]
+
+use std::sync::Mutex;
+
+use datasketches::bloom::BloomFilter;
+use datasketches::bloom::BloomFilterBuilder;
+use datasketches::bloom::FixedBloomFilter;
+
+#[test]
+fn test_matches_heap_filter() {
+    let mut fixed = FixedBloomFilter::<16>::new(5, 7);
+    let mut heap = BloomFilterBuilder::with_size(1024, 5).seed(7).build();
+    assert_eq!(fixed.to_filter(), heap);
+
+    for i in 0..100_u64 {
+        fixed.insert(i);
+        heap.insert(i);
+    }
+    fixed.insert_hash(1, 2);
+    heap.insert_hash(1, 2);
+    assert_eq!(fixed.to_filter(), heap);
+    assert_eq!(fixed.capacity(), heap.capacity());
+    assert_eq!(fixed.bits_used(), heap.bits_used());
+    assert_eq!(fixed.bit_array()[..], heap.bit_array()[..]);
+    for i in 0..1000_u64 {
+        assert_eq!(fixed.contains(&i), heap.contains(&i), "{i}");
+    }
+    assert!(fixed.contains_hash(1, 2));
+
+    let restored = BloomFilter::deserialize(&fixed.to_filter().serialize()).unwrap();
+    assert_eq!(restored, heap);
+}
+
+#[test]
+fn test_static_filter_and_reset() {
+    static FILTER: Mutex<FixedBloomFilter<4>> = Mutex::new(FixedBloomFilter::new(3, 0));
+
+    let mut filter = FILTER.lock().unwrap();
+    assert!(filter.is_empty());
+    assert!(!filter.contains(&"apple"));
+    filter.insert("apple");
+    assert!(filter.contains(&"apple"));
+    assert_eq!(filter.num_hashes(), 3);
+    assert_eq!(filter.seed(), 0);
+
+    filter.reset();
+    assert!(filter.is_empty());
+    assert_eq!(*filter, FixedBloomFilter::new(3, 0));
+}
+
+#[test]
+#[should_panic(expected = "num_hashes out of range")]
+fn test_zero_hashes() {
+    FixedBloomFilter::<1>::new(0, 0);
+}
@@ -0,0 +1,79 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "bloom")]
+
+use std::hash::Hash;
+
+use datasketches::bloom::BloomFilter;
+use datasketches::bloom::BloomFilterBuilder;
+use datasketches::bloom::Murmur3BloomHasher;
+use datasketches::bloom::PrehashedBloomHasher;
+use datasketches::hash::MurmurHash3X64128;
+
+#[test]
+fn test_custom_hasher_round_trip() {
+    let mut filter =
+        BloomFilterBuilder::with_accuracy(1000, 0.01).build_with_hasher(Murmur3BloomHasher);
+    for i in 0..500_u64 {
+        filter.insert(i);
+    }
+    let bytes = filter.serialize();
+
+    let restored = BloomFilter::deserialize_with_hasher(&bytes, Murmur3BloomHasher).unwrap();
+    assert_eq!(restored, filter);
+    for i in 0..500_u64 {
+        assert!(restored.contains(&i));
+    }
+}
+
+#[test]
+fn test_prehashed_hasher() {
+    let mut filter =
+        BloomFilterBuilder::with_accuracy(1000, 0.01).build_with_hasher(PrehashedBloomHasher);
+    let hashes: Vec<u128> = (0..500_u64)
+        .map(|i| {
+            let mut hasher = MurmurHash3X64128::with_seed(9001);
+            i.hash(&mut hasher);
+            let (h1, h2) = hasher.finish128();
+            (u128::from(h2) << 64) | u128::from(h1)
+        })
+        .collect();
+    filter.insert_all(&hashes);
+
+    // Feeding the upstream 128-bit hashes sets the same bits as hashing the keys with Murmur3.
+    let mut murmur =
+        BloomFilterBuilder::with_accuracy(1000, 0.01).build_with_hasher(Murmur3BloomHasher);
+    murmur.insert_all(0..500_u64);
+    assert_eq!(filter.serialize(), murmur.serialize());
+}
+
+#[test]
+fn test_insert_hash_matches_insert() {
+    let mut hashed = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+    let mut direct =
+        BloomFilterBuilder::with_accuracy(1000, 0.01).build_with_hasher(Murmur3BloomHasher);
+    for i in 0..500_u64 {
+        let mut hasher = MurmurHash3X64128::with_seed(hashed.seed());
+        i.hash(&mut hasher);
+        let (h0, h1) = hasher.finish128();
+        hashed.insert_hash(h0, h1);
+        direct.insert(i);
+        assert!(hashed.contains_hash(h0, h1));
+    }
+    assert_eq!(hashed.serialize(), direct.serialize());
+}
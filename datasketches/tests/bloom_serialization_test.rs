@@ -24,6 +24,7 @@ use std::path::PathBuf;
 
 use common::serialization_test_data;
 use datasketches::bloom::BloomFilter;
+use datasketches::bloom::BloomFilterBuilder;
 
 fn test_bloom_filter_file(path: PathBuf, expected_num_items: u64, expected_num_hashes: u16) {
     let bytes = fs::read(&path).unwrap();
@@ -222,3 +223,129 @@ fn test_cpp_bloom_n30000000_h5() {
     let path = serialization_test_data("cpp_generated_files", "bf_n30000000_h5_cpp.sk");
     test_bloom_filter_file(path, 30000000, 5);
 }
+
+#[test]
+fn test_compressed_round_trip() {
+    for n in [1, 10, 1000, 100_000] {
+        let mut filter = BloomFilterBuilder::with_size(1 << 20, 5).seed(3).build();
+        filter.insert_all(0..n);
+
+        let bytes = filter.serialize_compressed();
+        let restored = BloomFilter::deserialize(&bytes).unwrap();
+        assert_eq!(restored, filter, "n = {n}");
+        assert_eq!(restored.bits_used(), filter.bits_used(), "n = {n}");
+
+        let mut reader = bytes.as_slice();
+        assert_eq!(BloomFilter::read_from(&mut reader).unwrap(), filter);
+        assert!(reader.is_empty());
+    }
+}
+
+#[test]
+fn test_compressed_sparse_filter_is_smaller() {
+    let mut filter = BloomFilterBuilder::with_size(1 << 20, 3).build();
+    filter.insert_all(0..1000);
+
+    let plain = filter.serialize();
+    let compressed = filter.serialize_compressed();
+    // at most 3000 set bits with gaps below 2^14, each in at most two bytes
+    assert!(compressed.len() < 32 + 2 * 3000, "{}", compressed.len());
+    assert!(compressed.len() * 10 < plain.len());
+}
+
+#[test]
+fn test_compressed_falls_back_to_plain() {
+    let empty = BloomFilterBuilder::with_size(1024, 3).build();
+    assert_eq!(empty.serialize_compressed(), empty.serialize());
+
+    let mut full = BloomFilterBuilder::with_size(1024, 3).build();
+    full.insert_all(0..1000);
+    assert_eq!(full.serialize_compressed(), full.serialize());
+}
+
+#[test]
+fn test_compressed_image_rejects_bad_input() {
+    let mut filter = BloomFilterBuilder::with_size(1 << 12, 3).build();
+    filter.insert_all(0..10);
+    let bytes = filter.serialize_compressed();
+    assert!(bytes.len() < filter.serialize().len());
+
+    assert!(BloomFilter::wrap(&bytes).is_err());
+    for len in 0..bytes.len() {
+        assert!(
+            BloomFilter::deserialize(&bytes[..len]).is_err(),
+            "len {len}"
+        );
+    }
+
+    // a gap past the end of the bit array
+    let mut out_of_range = bytes[..32].to_vec();
+    out_of_range[24..32].copy_from_slice(&1u64.to_le_bytes());
+    out_of_range.extend_from_slice(&[0x80, 0x80, 0x01]);
+    assert!(BloomFilter::deserialize(&out_of_range).is_err());
+
+    // more set bits than the bit array holds
+    let mut overfull = bytes.clone();
+    overfull[24..32].copy_from_slice(&(1u64 << 13).to_le_bytes());
+    assert!(BloomFilter::deserialize(&overfull).is_err());
+
+    // a truncated image claiming more words than an image without its bit array may hold
+    // fails before allocating
+    let mut huge = bytes[..32].to_vec();
+    huge[16..20].copy_from_slice(&i32::MAX.to_le_bytes());
+    for image in [&huge[..], &huge[..24]] {
+        assert!(BloomFilter::deserialize(image).is_err());
+        assert!(BloomFilter::read_from(&mut &image[..]).is_err());
+    }
+}
+
+#[test]
+fn test_empty_image_claiming_a_huge_bit_array() {
+    let empty = BloomFilterBuilder::with_size(1024, 3).build();
+    let bytes = empty.serialize();
+    assert_eq!(bytes.len(), 24);
+
+    // up to num_longs near i32::MAX, a 16 GiB bit array from a 24-byte image
+    for num_longs in [(1 << 26) + 1, i32::MAX - 8] {
+        let mut huge = bytes.clone();
+        huge[16..20].copy_from_slice(&num_longs.to_le_bytes());
+        assert!(BloomFilter::deserialize(&huge).is_err(), "{num_longs}");
+        assert!(BloomFilter::wrap(&huge).is_err(), "{num_longs}");
+        assert!(
+            BloomFilter::read_from(&mut &huge[..]).is_err(),
+            "{num_longs}"
+        );
+    }
+
+    let mut large = bytes.clone();
+    large[16..20].copy_from_slice(&(1i32 << 16).to_le_bytes());
+    let filter = BloomFilter::deserialize(&large).unwrap();
+    assert!(filter.is_empty());
+    assert_eq!(filter.capacity(), 1 << 22);
+}
+
+#[test]
+fn test_compressed_image_of_a_shrunk_plain_image() {
+    for item in 0..16u64 {
+        let mut filter = BloomFilterBuilder::with_size(960, 3).build();
+        filter.insert(item);
+        let mut bytes = filter.serialize();
+        assert_eq!(bytes[16..20], 15i32.to_le_bytes());
+
+        // keep only the first two words: the stored bit count may now exceed the bits left
+        bytes[16..20].copy_from_slice(&2i32.to_le_bytes());
+        let shrunk = BloomFilter::deserialize(&bytes).unwrap();
+        assert_eq!(shrunk.capacity(), 128);
+
+        let compressed = shrunk.serialize_compressed();
+        let restored = BloomFilter::deserialize(&compressed).unwrap();
+        assert_eq!(restored.capacity(), 128, "item {item}");
+        assert_eq!(
+            restored.contains(&item),
+            shrunk.contains(&item),
+            "item {item}"
+        );
+        let again = BloomFilter::deserialize(&restored.serialize_compressed()).unwrap();
+        assert_eq!(again, restored, "item {item}");
+    }
+}
@@ -0,0 +1,99 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "bloom")]
+
+use datasketches::bloom::BloomFilter;
+use datasketches::bloom::BloomFilterBuilder;
+
+#[test]
+fn test_wrap_empty() {
+    let filter = BloomFilterBuilder::with_size(1000, 5).seed(123).build();
+    let bytes = filter.serialize();
+
+    let wrapped = BloomFilter::wrap(&bytes).unwrap();
+    assert!(wrapped.is_empty());
+    assert_eq!(wrapped.bits_used(), 0);
+    assert_eq!(wrapped.capacity(), filter.capacity());
+    assert_eq!(wrapped.num_hashes(), 5);
+    assert_eq!(wrapped.seed(), 123);
+    assert!(!wrapped.contains(&"anything"));
+    assert_eq!(wrapped.heapify(), filter);
+}
+
+#[test]
+fn test_wrap_matches_filter() {
+    let mut filter = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+    for i in 0..500_u64 {
+        filter.insert(i);
+    }
+    let bytes = filter.serialize();
+
+    let wrapped = BloomFilter::wrap(&bytes).unwrap();
+    assert!(!wrapped.is_empty());
+    assert_eq!(wrapped.bits_used(), filter.bits_used());
+    assert_eq!(wrapped.capacity(), filter.capacity());
+    assert_eq!(wrapped.load_factor(), filter.load_factor());
+    assert_eq!(wrapped.estimated_fpp(), filter.estimated_fpp());
+    assert_eq!(wrapped.estimated_num_items(), filter.estimated_num_items());
+    for i in 0..2000_u64 {
+        assert_eq!(wrapped.contains(&i), filter.contains(&i), "item {i}");
+    }
+}
+
+#[test]
+fn test_heapify_is_mutable_copy() {
+    let mut filter = BloomFilterBuilder::with_accuracy(100, 0.01).build();
+    filter.insert("apple");
+    let bytes = filter.serialize();
+
+    let mut heapified = BloomFilter::wrap(&bytes).unwrap().heapify();
+    assert_eq!(heapified, filter);
+    assert_eq!(heapified, BloomFilter::deserialize(&bytes).unwrap());
+
+    heapified.insert("banana");
+    assert!(heapified.contains(&"banana"));
+    assert!(!BloomFilter::wrap(&bytes).unwrap().contains(&"banana"));
+}
+
+#[test]
+fn test_wrap_recounts_dirty_bits() {
+    let mut filter = BloomFilterBuilder::with_size(256, 3).build();
+    filter.insert(7_u64);
+    let mut bytes = filter.serialize();
+    bytes[24..32].copy_from_slice(&u64::MAX.to_le_bytes());
+
+    let wrapped = BloomFilter::wrap(&bytes).unwrap();
+    assert_eq!(wrapped.bits_used(), filter.bits_used());
+    assert!(wrapped.contains(&7_u64));
+}
+
+#[test]
+fn test_wrap_rejects_truncated_image() {
+    let mut filter = BloomFilterBuilder::with_size(256, 3).build();
+    filter.insert(7_u64);
+    let bytes = filter.serialize();
+
+    for len in [0, 8, 24, 31, bytes.len() - 1] {
+        assert!(BloomFilter::wrap(&bytes[..len]).is_err(), "len {len}");
+    }
+    assert!(BloomFilter::wrap(&bytes).is_ok());
+
+    let mut bad_family = bytes.clone();
+    bad_family[2] = 0;
+    assert!(BloomFilter::wrap(&bad_family).is_err());
+}
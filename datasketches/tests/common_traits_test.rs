@@ -0,0 +1,272 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(
+    feature = "cpc",
+    feature = "hll",
+    feature = "kll",
+    feature = "quantiles",
+    feature = "req",
+    feature = "theta"
+))]
+
+use datasketches::common::DistinctCountEstimator;
+use datasketches::common::MergeableSketch;
+use datasketches::common::NumStdDev;
+use datasketches::common::QuantileSketch;
+use datasketches::cpc::CpcSketch;
+use datasketches::cpc::CpcUnion;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+use datasketches::kll::KllSketch;
+use datasketches::quantiles::DoublesSketch;
+use datasketches::req::ReqSketch;
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::theta::ThetaUnionBuilder;
+
+fn check_distinct_count(sketch: &dyn DistinctCountEstimator, n: f64) {
+    assert!(!sketch.is_empty());
+    let estimate = sketch.estimate();
+    assert!((estimate - n).abs() < n * 0.05, "{estimate}");
+    assert!(sketch.lower_bound(NumStdDev::Two) <= estimate);
+    assert!(sketch.upper_bound(NumStdDev::Two) >= estimate);
+
+    for num_std_dev in [NumStdDev::One, NumStdDev::Two, NumStdDev::Three] {
+        let interval = sketch.estimate_with_bounds(num_std_dev);
+        assert_eq!(interval.lower, sketch.lower_bound(num_std_dev));
+        assert_eq!(interval.estimate, estimate);
+        assert_eq!(interval.upper, sketch.upper_bound(num_std_dev));
+        assert!(interval.contains(estimate));
+    }
+}
+
+fn check_median<S: QuantileSketch>(sketch: &S)
+where
+    S::Item: PartialOrd,
+{
+    assert_eq!(sketch.n(), 1000);
+    assert!(!sketch.is_empty());
+    assert!(sketch.min_item() < sketch.max_item());
+    let median = sketch.quantile(0.5, true).unwrap();
+    let rank = sketch.rank(median, true).unwrap();
+    assert!((rank - 0.5).abs() < 0.02, "{rank}");
+}
+
+fn merge_into<U, S>(union: &mut U, sketches: &[S])
+where
+    U: MergeableSketch<S>,
+{
+    for sketch in sketches {
+        union.merge(sketch).unwrap();
+    }
+}
+
+#[test]
+fn test_distinct_count_estimators() {
+    let mut hll = HllSketch::new(12, HllType::Hll8);
+    let mut cpc = CpcSketch::new(11);
+    let mut theta = ThetaSketchBuilder::default().build();
+    for i in 0..1000 {
+        hll.update(i);
+        cpc.update(i);
+        theta.update(i);
+    }
+
+    check_distinct_count(&hll, 1000.0);
+    check_distinct_count(&cpc, 1000.0);
+    check_distinct_count(&theta, 1000.0);
+    check_distinct_count(&theta.compact(true), 1000.0);
+}
+
+#[test]
+fn test_quantile_sketches() {
+    let mut kll = KllSketch::<f64>::default();
+    let mut doubles = DoublesSketch::default();
+    let mut req = ReqSketch::default();
+    for i in 1..=1000 {
+        kll.update(i as f64);
+        doubles.update(i as f64);
+        req.update(i as f32);
+    }
+
+    check_median(&kll);
+    check_median(&doubles);
+    check_median(&req);
+}
+
+#[test]
+fn test_mergeable_sketches() {
+    let sketches: Vec<HllSketch> = (0..4)
+        .map(|s| {
+            let mut sketch = HllSketch::new(12, HllType::Hll8);
+            for i in 0..250 {
+                sketch.update(s * 250 + i);
+            }
+            sketch
+        })
+        .collect();
+    let mut union = HllUnion::new(12);
+    merge_into(&mut union, &sketches);
+    check_distinct_count(&union.to_sketch(HllType::Hll8), 1000.0);
+
+    let sketches: Vec<CpcSketch> = (0..4)
+        .map(|s| {
+            let mut sketch = CpcSketch::new(11);
+            for i in 0..250 {
+                sketch.update(s * 250 + i);
+            }
+            sketch
+        })
+        .collect();
+    let mut union = CpcUnion::new(11);
+    merge_into(&mut union, &sketches);
+    check_distinct_count(&union.to_sketch(), 1000.0);
+
+    let sketches: Vec<ThetaSketch> = (0..4)
+        .map(|s| {
+            let mut sketch = ThetaSketchBuilder::default().build();
+            for i in 0..250 {
+                sketch.update(s * 250 + i);
+            }
+            sketch
+        })
+        .collect();
+    let mut union = ThetaUnionBuilder::default().build();
+    merge_into(&mut union, &sketches);
+    check_distinct_count(&union.to_sketch(true), 1000.0);
+
+    let mut other = ThetaSketchBuilder::default().seed(1).build();
+    other.update(0);
+    assert!(union.merge(&other).is_err());
+
+    let mut kll = KllSketch::<f64>::default();
+    let mut other = KllSketch::<f64>::default();
+    kll.update(1.0);
+    other.update(2.0);
+    MergeableSketch::merge(&mut kll, &other).unwrap();
+    assert_eq!(kll.n(), 2);
+}
+
+#[test]
+fn test_collect_and_sum_distinct_count_sketches() {
+    let hll: Vec<HllSketch> = (0..4).map(|s| (s * 250..(s + 1) * 250).collect()).collect();
+    check_distinct_count(&hll.iter().sum::<HllSketch>(), 1000.0);
+    assert_eq!(hll[0].lg_config_k(), 12);
+    assert_eq!(
+        hll.into_iter().sum::<HllSketch>().target_type(),
+        HllType::Hll4
+    );
+    assert!(
+        std::iter::empty::<HllSketch>()
+            .sum::<HllSketch>()
+            .is_empty()
+    );
+
+    let cpc: Vec<CpcSketch> = (0..4).map(|s| (s * 250..(s + 1) * 250).collect()).collect();
+    check_distinct_count(&cpc.iter().sum::<CpcSketch>(), 1000.0);
+    check_distinct_count(&cpc.into_iter().sum::<CpcSketch>(), 1000.0);
+
+    let theta: Vec<CompactThetaSketch> = (0..4)
+        .map(|s| {
+            (s * 250..(s + 1) * 250)
+                .collect::<ThetaSketch>()
+                .compact(true)
+        })
+        .collect();
+    let sum: Result<CompactThetaSketch, _> = theta.iter().sum();
+    check_distinct_count(&sum.unwrap(), 1000.0);
+
+    let mut other = ThetaSketchBuilder::default().seed(1).build();
+    other.update(0);
+    let sum: Result<CompactThetaSketch, _> = theta.into_iter().chain([other.compact(true)]).sum();
+    assert!(sum.is_err());
+}
+
+#[test]
+fn test_collect_and_sum_quantile_sketches() {
+    let kll: Vec<KllSketch<f64>> = (0..4)
+        .map(|s| (s * 250 + 1..=(s + 1) * 250).map(f64::from).collect())
+        .collect();
+    check_median(&kll.iter().sum::<KllSketch<f64>>());
+    check_median(&kll.into_iter().sum::<KllSketch<f64>>());
+
+    let doubles: Vec<DoublesSketch> = (0..4)
+        .map(|s| (s * 250 + 1..=(s + 1) * 250).map(f64::from).collect())
+        .collect();
+    check_median(&doubles.iter().sum::<DoublesSketch>());
+
+    let req: Vec<ReqSketch> = (0..4)
+        .map(|s| (s * 250 + 1..=(s + 1) * 250).map(|i| i as f32).collect())
+        .collect();
+    check_median(&req.iter().sum::<ReqSketch>());
+    assert!(
+        std::iter::empty::<ReqSketch>()
+            .sum::<ReqSketch>()
+            .is_empty()
+    );
+}
+
+#[test]
+fn test_exactness() {
+    let mut hll = HllSketch::new(12, HllType::Hll8);
+    let mut cpc = CpcSketch::new(11);
+    let mut theta = ThetaSketchBuilder::default().lg_k(10).build();
+    assert!(hll.is_exact() && cpc.is_exact() && theta.is_exact());
+
+    for i in 0..1000 {
+        hll.update(i);
+        cpc.update(i);
+        theta.update(i);
+    }
+    assert!(!DistinctCountEstimator::is_exact(&hll));
+    assert!(!DistinctCountEstimator::is_exact(&cpc));
+    assert!(DistinctCountEstimator::is_exact(&theta));
+    let interval = theta.estimate_with_bounds(NumStdDev::Three);
+    assert_eq!(
+        (interval.lower, interval.estimate, interval.upper),
+        (1000.0, 1000.0, 1000.0)
+    );
+    assert!(DistinctCountEstimator::is_exact(&theta.compact(true)));
+
+    theta.extend(1000..10_000);
+    assert!(!DistinctCountEstimator::is_exact(&theta));
+    assert!(!DistinctCountEstimator::is_exact(&theta.compact(true)));
+
+    let mut kll = KllSketch::<f64>::new(200);
+    let mut doubles = DoublesSketch::new(128);
+    let mut req = ReqSketch::new(12, Default::default());
+    assert!(kll.is_exact() && doubles.is_exact() && req.is_exact());
+    for i in 0..30 {
+        kll.update(i as f64);
+        doubles.update(i as f64);
+        req.update(i as f32);
+    }
+    assert!(QuantileSketch::is_exact(&kll));
+    assert!(QuantileSketch::is_exact(&doubles));
+    assert!(QuantileSketch::is_exact(&req));
+    for i in 30..10_000 {
+        kll.update(i as f64);
+        doubles.update(i as f64);
+        req.update(i as f32);
+    }
+    assert!(!QuantileSketch::is_exact(&kll));
+    assert!(!QuantileSketch::is_exact(&doubles));
+    assert!(!QuantileSketch::is_exact(&req));
+}
@@ -0,0 +1,490 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Conformance suite over the whole cross-language snapshot corpus.
+//!
+//! Rather than naming fixtures one by one like the per-family serialization tests, this walks
+//! every `.sk` file the Java and C++ generators wrote (see
+//! `tools/generate_serialization_test_data.py`), as well as the images this crate writes itself
+//! (see `rust_generated_files_test`), and checks it against the expectations its name
+//! encodes: the generators name each image after what was fed to it, such as
+//! `hll8_n1000_java.sk` for an HLL8 sketch of 1000 distinct items or `bf_n10000_h3_cpp.sk`
+//! for a Bloom filter with 3 hash functions. Every image must deserialize, report the
+//! expected count, then survive a serialize and deserialize round trip unchanged.
+//!
+//! Images whose name matches no registered family are listed but not failed, so that a newer
+//! generator can add fixtures before this crate supports them.
+
+mod common;
+
+use std::fs;
+use std::path::PathBuf;
+
+/// Checks one image against the count `n` encoded in its file name, if any.
+type Check = fn(name: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String>;
+
+/// Returns the number following `key` in one of the `_`-separated fields of `name`.
+#[allow(dead_code)] // only some checks read extra fields
+fn name_field(name: &str, key: char) -> Option<u64> {
+    name.split('_').find_map(|field| {
+        let digits = field.strip_prefix(key)?;
+        if digits.is_empty() || !digits.bytes().all(|b| b.is_ascii_digit()) {
+            return None;
+        }
+        digits.parse().ok()
+    })
+}
+
+#[allow(dead_code)] // unused when no distinct counting family is enabled
+fn check_distinct_count(
+    n: Option<u64>,
+    estimate: f64,
+    lower_bound: f64,
+    upper_bound: f64,
+) -> Result<(), String> {
+    let Some(n) = n else { return Ok(()) };
+    let n = n as f64;
+    if n < lower_bound || n > upper_bound {
+        return Err(format!(
+            "{n} distinct items lie outside the bounds [{lower_bound}, {upper_bound}] of estimate {estimate}"
+        ));
+    }
+    Ok(())
+}
+
+#[allow(dead_code)] // unused when no family is enabled
+fn check_eq<T: PartialEq + std::fmt::Debug>(
+    what: &str,
+    actual: T,
+    expected: T,
+) -> Result<(), String> {
+    if actual != expected {
+        return Err(format!("{what} is {actual:?}, expected {expected:?}"));
+    }
+    Ok(())
+}
+
+#[cfg(feature = "hll")]
+fn check_hll(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::common::NumStdDev;
+    use datasketches::hll::HllSketch;
+
+    let sketch = HllSketch::deserialize(bytes).map_err(|e| e.to_string())?;
+    check_distinct_count(
+        n,
+        sketch.estimate(),
+        sketch.lower_bound(NumStdDev::Three),
+        sketch.upper_bound(NumStdDev::Three),
+    )?;
+    let decoded = HllSketch::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq("round-trip estimate", decoded.estimate(), sketch.estimate())
+}
+
+#[cfg(feature = "cpc")]
+fn check_cpc(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::common::NumStdDev;
+    use datasketches::cpc::CpcSketch;
+
+    let sketch = CpcSketch::deserialize(bytes).map_err(|e| e.to_string())?;
+    check_distinct_count(
+        n,
+        sketch.estimate(),
+        sketch.lower_bound(NumStdDev::Three),
+        sketch.upper_bound(NumStdDev::Three),
+    )?;
+    let decoded = CpcSketch::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq("round-trip estimate", decoded.estimate(), sketch.estimate())
+}
+
+#[cfg(feature = "theta")]
+fn check_theta(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::common::NumStdDev;
+    use datasketches::theta::CompactThetaSketch;
+
+    let sketch = CompactThetaSketch::deserialize(bytes).map_err(|e| e.to_string())?;
+    check_distinct_count(
+        n,
+        sketch.estimate(),
+        sketch.lower_bound(NumStdDev::Three),
+        sketch.upper_bound(NumStdDev::Three),
+    )?;
+    let decoded =
+        CompactThetaSketch::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq("round-trip estimate", decoded.estimate(), sketch.estimate())
+}
+
+#[cfg(feature = "tuple")]
+fn check_tuple_int(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::common::NumStdDev;
+    use datasketches::tuple::CompactTupleSketch;
+
+    let sketch = CompactTupleSketch::<i32>::deserialize(bytes).map_err(|e| e.to_string())?;
+    check_distinct_count(
+        n,
+        sketch.estimate(),
+        sketch.lower_bound(NumStdDev::Three),
+        sketch.upper_bound(NumStdDev::Three),
+    )?;
+    let decoded =
+        CompactTupleSketch::<i32>::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq("round-trip estimate", decoded.estimate(), sketch.estimate())
+}
+
+#[cfg(feature = "tuple")]
+fn check_array_of_doubles(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::common::NumStdDev;
+    use datasketches::tuple::CompactArrayOfDoublesSketch;
+
+    let sketch = CompactArrayOfDoublesSketch::deserialize(bytes).map_err(|e| e.to_string())?;
+    check_distinct_count(
+        n,
+        sketch.estimate(),
+        sketch.lower_bound(NumStdDev::Three),
+        sketch.upper_bound(NumStdDev::Three),
+    )?;
+    let decoded =
+        CompactArrayOfDoublesSketch::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq("round-trip estimate", decoded.estimate(), sketch.estimate())
+}
+
+#[cfg(feature = "kll")]
+fn check_kll_double(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::kll::KllSketch;
+
+    let sketch = KllSketch::<f64>::deserialize(bytes).map_err(|e| e.to_string())?;
+    if let Some(n) = n {
+        check_eq("n", sketch.n(), n)?;
+    }
+    let decoded = KllSketch::<f64>::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq("round-trip n", decoded.n(), sketch.n())?;
+    check_eq(
+        "round-trip median",
+        decoded.quantile(0.5, true),
+        sketch.quantile(0.5, true),
+    )
+}
+
+#[cfg(feature = "kll")]
+fn check_kll_float(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::kll::KllSketch;
+
+    let sketch = KllSketch::<f32>::deserialize(bytes).map_err(|e| e.to_string())?;
+    if let Some(n) = n {
+        check_eq("n", sketch.n(), n)?;
+    }
+    let decoded = KllSketch::<f32>::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq("round-trip n", decoded.n(), sketch.n())?;
+    check_eq(
+        "round-trip median",
+        decoded.quantile(0.5, true),
+        sketch.quantile(0.5, true),
+    )
+}
+
+#[cfg(feature = "kll")]
+fn check_kll_string(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use std::cmp::Ordering;
+
+    use datasketches::kll::KllItemsSketch;
+
+    // the string images hold numbers, ordered numerically rather than lexicographically
+    let numeric_order = |a: &String, b: &String| -> Ordering {
+        let a: u64 = a.trim().parse().unwrap_or(0);
+        let b: u64 = b.trim().parse().unwrap_or(0);
+        a.cmp(&b)
+    };
+
+    let sketch = KllItemsSketch::deserialize_with_comparator(bytes, numeric_order)
+        .map_err(|e| e.to_string())?;
+    if let Some(n) = n {
+        check_eq("n", sketch.n(), n)?;
+    }
+    let decoded = KllItemsSketch::deserialize_with_comparator(&sketch.serialize(), numeric_order)
+        .map_err(|e| e.to_string())?;
+    check_eq("round-trip n", decoded.n(), sketch.n())?;
+    check_eq(
+        "round-trip median",
+        decoded.quantile(0.5, true),
+        sketch.quantile(0.5, true),
+    )
+}
+
+#[cfg(feature = "quantiles")]
+fn check_quantiles_double(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::quantiles::DoublesSketch;
+
+    let sketch = DoublesSketch::deserialize(bytes).map_err(|e| e.to_string())?;
+    if let Some(n) = n {
+        check_eq("n", sketch.n(), n)?;
+    }
+    let decoded = DoublesSketch::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq("round-trip n", decoded.n(), sketch.n())
+}
+
+#[cfg(feature = "req")]
+fn check_req_float(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::req::ReqSketch;
+
+    let sketch = ReqSketch::deserialize(bytes).map_err(|e| e.to_string())?;
+    if let Some(n) = n {
+        check_eq("n", sketch.n(), n)?;
+    }
+    let decoded = ReqSketch::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq("round-trip n", decoded.n(), sketch.n())
+}
+
+#[cfg(feature = "tdigest")]
+fn check_tdigest(name: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::tdigest::TDigestMut;
+
+    let is_f32 = name.starts_with("tdigest_float");
+    let mut td = TDigestMut::deserialize(bytes, is_f32).map_err(|e| e.to_string())?;
+    if let Some(n) = n {
+        check_eq("total weight", td.total_weight(), n)?;
+    }
+    let decoded = TDigestMut::deserialize(&td.serialize(), false).map_err(|e| e.to_string())?;
+    check_eq(
+        "round-trip total weight",
+        decoded.total_weight(),
+        td.total_weight(),
+    )
+}
+
+#[cfg(feature = "frequencies")]
+fn check_frequent_long(name: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::frequencies::FrequentItemsSketch;
+
+    let sketch = match FrequentItemsSketch::<i64>::deserialize(bytes) {
+        Ok(sketch) => sketch,
+        // as in frequencies_serialization_test, these C++ images need not be readable on Windows
+        Err(err) if cfg!(windows) && name.ends_with("_cpp.sk") => {
+            eprintln!("tolerating {name} on Windows: {err}");
+            return Ok(());
+        }
+        Err(err) => return Err(err.to_string()),
+    };
+    if let Some(n) = n {
+        check_eq("total weight", sketch.total_weight(), n)?;
+    }
+    let decoded =
+        FrequentItemsSketch::<i64>::deserialize(&sketch.serialize()).map_err(|e| e.to_string())?;
+    check_eq(
+        "round-trip total weight",
+        decoded.total_weight(),
+        sketch.total_weight(),
+    )
+}
+
+#[cfg(feature = "frequencies")]
+fn check_frequent_string(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::frequencies::FrequentItemsSketch;
+
+    let sketch = FrequentItemsSketch::<String>::deserialize(bytes).map_err(|e| e.to_string())?;
+    if let Some(n) = n {
+        check_eq("total weight", sketch.total_weight(), n)?;
+    }
+    let decoded = FrequentItemsSketch::<String>::deserialize(&sketch.serialize())
+        .map_err(|e| e.to_string())?;
+    check_eq(
+        "round-trip total weight",
+        decoded.total_weight(),
+        sketch.total_weight(),
+    )
+}
+
+#[cfg(feature = "bloom")]
+fn check_bloom(name: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String> {
+    use datasketches::bloom::BloomFilter;
+
+    let filter = BloomFilter::deserialize(bytes).map_err(|e| e.to_string())?;
+    if let Some(num_hashes) = name_field(name, 'h') {
+        check_eq("num_hashes", u64::from(filter.num_hashes()), num_hashes)?;
+    }
+    if let Some(n) = n {
+        check_eq("is_empty", filter.is_empty(), n == 0)?;
+    }
+    let decoded = BloomFilter::deserialize(&filter.serialize()).map_err(|e| e.to_string())?;
+    check_eq(
+        "round-trip bits_used",
+        decoded.bits_used(),
+        filter.bits_used(),
+    )
+}
+
+#[cfg(feature = "countmin")]
+fn check_count_min(_: &str, bytes: &[u8], _: Option<u64>) -> Result<(), String> {
+    use datasketches::countmin::CountMinSketch;
+
+    // the C++ generator uses this seed for every Count-Min image
+    const SEED: u64 = 9001;
+    let sketch =
+        CountMinSketch::<u64>::deserialize_with_seed(bytes, SEED).map_err(|e| e.to_string())?;
+    check_eq("round-trip image", sketch.serialize().as_slice(), bytes)
+}
+
+#[cfg(feature = "sampling")]
+fn check_reservoir<T>(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String>
+where
+    T: datasketches::sampling::SamplingItemValue,
+{
+    use datasketches::sampling::ReservoirItemsSketch;
+
+    let sketch = ReservoirItemsSketch::<T>::deserialize(bytes).map_err(|e| e.to_string())?;
+    if let Some(n) = n {
+        check_eq("n", sketch.n(), n)?;
+    }
+    // the samples are written in the order they are held, so the image must come back unchanged
+    check_eq("round-trip image", sketch.serialize().as_slice(), bytes)
+}
+
+#[cfg(feature = "sampling")]
+fn check_varopt<T>(_: &str, bytes: &[u8], n: Option<u64>) -> Result<(), String>
+where
+    T: datasketches::sampling::SamplingItemValue,
+{
+    use datasketches::sampling::VarOptItemsSketch;
+
+    let sketch = VarOptItemsSketch::<T>::deserialize(bytes).map_err(|e| e.to_string())?;
+    if let Some(n) = n {
+        check_eq("n", sketch.n(), n)?;
+    }
+    // includes the total weight of the sampled region and the weights of the heavy items
+    check_eq("round-trip image", sketch.serialize().as_slice(), bytes)
+}
+
+/// Maps file name prefixes to the check for the family the generators write under them.
+#[allow(clippy::vec_init_then_push)] // the pushes depend on the enabled features
+fn registry() -> Vec<(&'static str, Check)> {
+    #[allow(unused_mut)] // empty when no family is enabled
+    let mut checks: Vec<(&'static str, Check)> = vec![];
+    #[cfg(feature = "hll")]
+    checks.extend([
+        ("hll4_", check_hll as Check),
+        ("hll6_", check_hll),
+        ("hll8_", check_hll),
+    ]);
+    #[cfg(feature = "cpc")]
+    checks.push(("cpc_", check_cpc));
+    #[cfg(feature = "theta")]
+    checks.push(("theta_", check_theta));
+    #[cfg(feature = "tuple")]
+    checks.extend([
+        ("tuple_int_", check_tuple_int as Check),
+        ("aod_", check_array_of_doubles),
+    ]);
+    #[cfg(feature = "kll")]
+    checks.extend([
+        ("kll_double_", check_kll_double as Check),
+        ("kll_float_", check_kll_float),
+        ("kll_string_", check_kll_string),
+    ]);
+    #[cfg(feature = "quantiles")]
+    checks.push(("quantiles_double_", check_quantiles_double));
+    #[cfg(feature = "req")]
+    checks.push(("req_float_", check_req_float));
+    #[cfg(feature = "tdigest")]
+    checks.extend([
+        ("tdigest_double_", check_tdigest as Check),
+        ("tdigest_float_", check_tdigest),
+    ]);
+    #[cfg(feature = "frequencies")]
+    checks.extend([
+        ("frequent_long_", check_frequent_long as Check),
+        ("frequent_string_", check_frequent_string),
+    ]);
+    #[cfg(feature = "bloom")]
+    checks.push(("bf_", check_bloom));
+    #[cfg(feature = "countmin")]
+    checks.push(("count_min_", check_count_min));
+    #[cfg(feature = "sampling")]
+    checks.extend([
+        ("reservoir_long_", check_reservoir::<i64> as Check),
+        ("reservoir_string_", check_reservoir::<String>),
+        ("varopt_long_", check_varopt::<i64>),
+        ("varopt_string_", check_varopt::<String>),
+    ]);
+    checks
+}
+
+fn check_corpus(sub_dir: &str) {
+    let dir = PathBuf::from(env!("CARGO_MANIFEST_DIR"))
+        .join("tests/serialization_test_data")
+        .join(sub_dir);
+    // fails with the regeneration hint when the corpus is missing
+    common::serialization_test_data(sub_dir, "");
+
+    let registry = registry();
+    let mut names = fs::read_dir(&dir)
+        .unwrap()
+        .map(|entry| entry.unwrap().file_name().into_string().unwrap())
+        .filter(|name| name.ends_with(".sk"))
+        .collect::<Vec<_>>();
+    names.sort();
+
+    let mut checked = 0;
+    let mut unmatched = vec![];
+    let mut failures = vec![];
+    for name in &names {
+        let check = registry
+            .iter()
+            .filter(|(prefix, _)| name.starts_with(prefix))
+            .max_by_key(|(prefix, _)| prefix.len());
+        let Some((_, check)) = check else {
+            unmatched.push(name.as_str());
+            continue;
+        };
+        let bytes = fs::read(dir.join(name)).unwrap();
+        if let Err(err) = check(name, &bytes, name_field(name, 'n')) {
+            failures.push(format!("{name}: {err}"));
+        }
+        checked += 1;
+    }
+
+    if !unmatched.is_empty() {
+        eprintln!("{sub_dir}: no check registered for {unmatched:?}");
+    }
+    assert!(
+        failures.is_empty(),
+        "{} of {checked} images in {sub_dir} do not conform:\n{}",
+        failures.len(),
+        failures.join("\n")
+    );
+}
+
+#[test]
+fn test_java_corpus() {
+    check_corpus("java_generated_files");
+}
+
+#[test]
+fn test_cpp_corpus() {
+    check_corpus("cpp_generated_files");
+}
+
+#[test]
+fn test_rust_corpus() {
+    check_corpus("rust_generated_files");
+}
+
+#[test]
+fn test_name_field() {
+    assert_eq!(name_field("hll8_n1000_java.sk", 'n'), Some(1000));
+    assert_eq!(name_field("bf_n10000_h3_cpp.sk", 'h'), Some(3));
+    assert_eq!(name_field("aod_3_n0_java.sk", 'n'), Some(0));
+    assert_eq!(name_field("theta_non_empty_no_entries_java.sk", 'n'), None);
+    assert_eq!(name_field("frequent_string_ascii_cpp.sk", 'n'), None);
+}
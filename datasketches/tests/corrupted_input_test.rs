@@ -0,0 +1,386 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Corrupted-input conformance tests.
+//!
+//! Each family contributes a valid image, from which the corrupted corpus is generated:
+//! every truncation, a foreign family ID, an unknown serial version, an impossible preamble
+//! size and, where the family stores them in its preamble, an out-of-range lg_k and flags
+//! that contradict the preamble size. Each corruption must be rejected with the matching
+//! [`SketchError`] rather than a panic or a sketch with a wrong estimate.
+
+use std::panic::AssertUnwindSafe;
+use std::panic::catch_unwind;
+
+use datasketches::error::Error;
+use datasketches::error::ErrorKind;
+use datasketches::error::SketchError;
+
+struct Case {
+    name: &'static str,
+    image: Vec<u8>,
+    deserialize: fn(&[u8]) -> Result<(), Error>,
+    /// Offset of an lg_k byte that deserialization validates against the supported range.
+    lg_k_offset: Option<usize>,
+    /// Offset and mask of a flag whose flip contradicts the preamble size of `image`.
+    preamble_flag: Option<(usize, u8)>,
+}
+
+fn cases() -> Vec<Case> {
+    #[allow(unused_mut)] // empty when no family is enabled
+    let mut cases = vec![];
+
+    #[cfg(feature = "hll")]
+    {
+        use datasketches::hll::HllSketch;
+        use datasketches::hll::HllType;
+
+        let mut sketch = HllSketch::new(12, HllType::Hll8);
+        sketch.extend(0..5000);
+        cases.push(Case {
+            name: "hll",
+            image: sketch.serialize(),
+            deserialize: |bytes| HllSketch::deserialize(bytes).map(drop),
+            lg_k_offset: Some(3),
+            preamble_flag: None,
+        });
+    }
+    #[cfg(feature = "cpc")]
+    {
+        use datasketches::cpc::CpcSketch;
+
+        let mut sketch = CpcSketch::new(11);
+        sketch.extend(0..5000);
+        cases.push(Case {
+            name: "cpc",
+            image: sketch.serialize(),
+            deserialize: |bytes| CpcSketch::deserialize(bytes).map(drop),
+            lg_k_offset: Some(3),
+            // the has-table flag decides whether the table size is in the preamble
+            preamble_flag: Some((5, 1 << 3)),
+        });
+    }
+    #[cfg(feature = "theta")]
+    {
+        use datasketches::theta::CompactThetaSketch;
+        use datasketches::theta::ThetaSketchBuilder;
+
+        let mut sketch = ThetaSketchBuilder::default().build();
+        sketch.extend(0..5000);
+        let compact = sketch.compact(true);
+        cases.push(Case {
+            name: "theta",
+            image: compact.serialize(),
+            deserialize: |bytes| CompactThetaSketch::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            preamble_flag: None,
+        });
+        cases.push(Case {
+            name: "theta compressed",
+            image: compact.serialize_compressed(),
+            deserialize: |bytes| CompactThetaSketch::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            preamble_flag: None,
+        });
+    }
+    #[cfg(feature = "tuple")]
+    {
+        use datasketches::tuple::ArrayOfDoublesSketchBuilder;
+        use datasketches::tuple::CompactArrayOfDoublesSketch;
+        use datasketches::tuple::CompactTupleSketch;
+        use datasketches::tuple::DefaultUpdatePolicy;
+        use datasketches::tuple::TupleSketchBuilder;
+
+        let mut sketch = TupleSketchBuilder::new(DefaultUpdatePolicy::<i32>::default()).build();
+        for i in 0..5000 {
+            sketch.update(i, 1);
+        }
+        cases.push(Case {
+            name: "tuple",
+            image: sketch.compact(true).serialize(),
+            deserialize: |bytes| CompactTupleSketch::<i32>::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            preamble_flag: None,
+        });
+
+        let mut sketch = ArrayOfDoublesSketchBuilder::new(2).build();
+        for i in 0..5000 {
+            sketch.update(i, &[1.0, 2.0]);
+        }
+        cases.push(Case {
+            name: "array of doubles",
+            image: sketch.compact(true).serialize(),
+            deserialize: |bytes| CompactArrayOfDoublesSketch::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            preamble_flag: None,
+        });
+    }
+    #[cfg(feature = "kll")]
+    {
+        use datasketches::kll::KllSketch;
+
+        let mut sketch = KllSketch::<f64>::new(200);
+        sketch.extend((0..5000).map(f64::from));
+        cases.push(Case {
+            name: "kll",
+            image: sketch.serialize(),
+            deserialize: |bytes| KllSketch::<f64>::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            // an empty image has the short preamble
+            preamble_flag: Some((3, 1 << 0)),
+        });
+    }
+    #[cfg(feature = "quantiles")]
+    {
+        use datasketches::quantiles::DoublesSketch;
+
+        let mut sketch = DoublesSketch::new(128);
+        sketch.extend((0..5000).map(f64::from));
+        cases.push(Case {
+            name: "quantiles",
+            image: sketch.serialize(),
+            deserialize: |bytes| DoublesSketch::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            preamble_flag: None,
+        });
+    }
+    #[cfg(feature = "req")]
+    {
+        use datasketches::req::RankAccuracy;
+        use datasketches::req::ReqSketch;
+
+        let mut sketch = ReqSketch::new(12, RankAccuracy::HighRanks);
+        sketch.extend((0..5000).map(|i| i as f32));
+        cases.push(Case {
+            name: "req",
+            image: sketch.serialize(),
+            deserialize: |bytes| ReqSketch::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            // an empty image has the short preamble
+            preamble_flag: Some((3, 1 << 2)),
+        });
+    }
+    #[cfg(feature = "frequencies")]
+    {
+        use datasketches::frequencies::FrequentItemsSketch;
+
+        let mut sketch = FrequentItemsSketch::<i64>::new(64);
+        sketch.extend((0..5000).map(|i| i % 100));
+        cases.push(Case {
+            name: "frequencies",
+            image: sketch.serialize(),
+            deserialize: |bytes| FrequentItemsSketch::<i64>::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            // an empty image has the short preamble
+            preamble_flag: Some((5, 1 << 2)),
+        });
+    }
+    #[cfg(feature = "tdigest")]
+    {
+        use datasketches::tdigest::TDigestMut;
+
+        let mut sketch = TDigestMut::new(100);
+        sketch.extend((0..5000).map(f64::from));
+        cases.push(Case {
+            name: "tdigest",
+            image: sketch.serialize(),
+            deserialize: |bytes| TDigestMut::deserialize(bytes, false).map(drop),
+            lg_k_offset: None,
+            preamble_flag: None,
+        });
+    }
+    #[cfg(feature = "bloom")]
+    {
+        use datasketches::bloom::BloomFilter;
+        use datasketches::bloom::BloomFilterBuilder;
+
+        let mut filter = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+        filter.extend(0..500);
+        cases.push(Case {
+            name: "bloom",
+            image: filter.serialize(),
+            deserialize: |bytes| BloomFilter::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            preamble_flag: None,
+        });
+    }
+    #[cfg(feature = "countmin")]
+    {
+        use datasketches::countmin::CountMinSketch;
+
+        let mut sketch = CountMinSketch::<u64>::new(3, 128);
+        sketch.extend(0..500);
+        cases.push(Case {
+            name: "countmin",
+            image: sketch.serialize(),
+            deserialize: |bytes| CountMinSketch::<u64>::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            preamble_flag: None,
+        });
+    }
+    #[cfg(feature = "sampling")]
+    {
+        use datasketches::sampling::ReservoirItemsSketch;
+
+        let mut sketch = ReservoirItemsSketch::<u64>::new(32);
+        sketch.extend(0..500);
+        cases.push(Case {
+            name: "reservoir",
+            image: sketch.serialize(),
+            deserialize: |bytes| ReservoirItemsSketch::<u64>::deserialize(bytes).map(drop),
+            lg_k_offset: None,
+            // an empty image has the short preamble
+            preamble_flag: Some((3, 1 << 2)),
+        });
+    }
+    cases
+}
+
+/// Deserializes `image`, failing the test if it panics or is accepted.
+fn reject(case: &Case, corruption: &str, image: &[u8]) -> Error {
+    match catch_unwind(AssertUnwindSafe(|| (case.deserialize)(image))) {
+        Ok(Ok(())) => panic!("{} with {corruption} was accepted", case.name),
+        Ok(Err(err)) => err,
+        Err(_) => panic!("{} with {corruption} panicked", case.name),
+    }
+}
+
+fn assert_reason(
+    case: &Case,
+    corruption: &str,
+    image: &[u8],
+    expected: impl Fn(&SketchError) -> bool,
+) {
+    let err = reject(case, corruption, image);
+    assert!(
+        err.sketch_error().is_some_and(expected),
+        "{} with {corruption} failed with an unexpected cause: {err}",
+        case.name
+    );
+}
+
+#[test]
+fn test_valid_images_are_accepted() {
+    for case in cases() {
+        (case.deserialize)(&case.image).unwrap();
+    }
+}
+
+#[test]
+fn test_truncated_images() {
+    for case in cases() {
+        for len in 0..8 {
+            assert_reason(
+                &case,
+                &format!("{len} bytes"),
+                &case.image[..len],
+                |reason| matches!(reason, SketchError::UnexpectedEnd { .. }),
+            );
+        }
+        // past the preamble the error may name an item rather than a field, but every
+        // truncation must still be rejected
+        let step = (case.image.len() / 64).max(1);
+        for len in (8..case.image.len())
+            .step_by(step)
+            .chain([case.image.len() - 1])
+        {
+            reject(&case, &format!("{len} bytes"), &case.image[..len]);
+        }
+    }
+}
+
+#[test]
+fn test_wrong_family_id() {
+    for case in cases() {
+        let family_id = case.image[2];
+        let mut image = case.image.clone();
+        image[2] = 99;
+        assert_reason(&case, "family 99", &image, |reason| {
+            *reason
+                == SketchError::InvalidFamily {
+                    expected: family_id,
+                    actual: 99,
+                }
+        });
+    }
+}
+
+#[test]
+fn test_unsupported_serial_version() {
+    for case in cases() {
+        let mut image = case.image.clone();
+        image[1] = 0x7F;
+        assert_reason(&case, "serial version 127", &image, |reason| {
+            matches!(
+                reason,
+                SketchError::UnsupportedSerialVersion { actual: 0x7F, .. }
+            )
+        });
+        let err = reject(&case, "serial version 127", &image);
+        assert_eq!(err.kind(), ErrorKind::UnsupportedVersion, "{}", case.name);
+    }
+}
+
+#[test]
+fn test_invalid_preamble_size() {
+    for case in cases() {
+        for size in [0, 0x3F] {
+            let mut image = case.image.clone();
+            // the two high bits are spare in formats counting the preamble in longs
+            image[0] = (image[0] & 0xC0) | size;
+            assert_reason(&case, &format!("preamble size {size}"), &image, |reason| {
+                *reason == SketchError::InvalidPreamble { actual: size }
+            });
+        }
+    }
+}
+
+#[test]
+fn test_lg_k_out_of_range() {
+    for case in cases() {
+        let Some(offset) = case.lg_k_offset else {
+            continue;
+        };
+        for lg_k in [0, 30] {
+            let mut image = case.image.clone();
+            image[offset] = lg_k;
+            assert_reason(
+                &case,
+                &format!("lg_k {lg_k}"),
+                &image,
+                |reason| matches!(reason, SketchError::LgKOutOfRange { lg_k: actual, .. } if *actual == lg_k),
+            );
+        }
+    }
+}
+
+#[test]
+fn test_flags_contradicting_preamble() {
+    for case in cases() {
+        let Some((offset, mask)) = case.preamble_flag else {
+            continue;
+        };
+        let mut image = case.image.clone();
+        image[offset] ^= mask;
+        assert_reason(
+            &case,
+            &format!("flags {:#04x}", image[offset]),
+            &image,
+            |reason| matches!(reason, SketchError::InvalidPreamble { .. }),
+        );
+    }
+}
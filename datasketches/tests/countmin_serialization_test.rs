@@ -23,6 +23,7 @@ use std::fs;
 
 use common::serialization_test_data;
 use datasketches::countmin::CountMinSketch;
+use datasketches::error::SketchError;
 use googletest::assert_that;
 use googletest::prelude::contains_substring;
 
@@ -68,4 +69,8 @@ fn test_deserialize_cpp_snapshot_with_wrong_seed() {
 
     let err = CountMinSketch::<u64>::deserialize_with_seed(&bytes, 9000).unwrap_err();
     assert_that!(err.message(), contains_substring("incompatible seed hash"));
+    assert!(matches!(
+        err.sketch_error(),
+        Some(SketchError::IncompatibleSeedHash { .. })
+    ));
 }
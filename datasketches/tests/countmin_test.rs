@@ -162,6 +162,53 @@ fn test_decay() {
     }
 }
 
+#[test]
+fn test_conservative_update() {
+    let mut plain = CountMinSketch::<u64>::new(3, 32);
+    let mut conservative = CountMinSketch::<u64>::new(3, 32);
+    // a few heavy items among many light ones, in a table small enough to collide often
+    for i in 0..1000u64 {
+        let weight = if i % 100 == 0 { 1000 } else { 1 };
+        plain.update_with_weight(i, weight);
+        conservative.update_conservative_with_weight(i, weight);
+    }
+    assert_eq!(conservative.total_weight(), plain.total_weight());
+
+    let mut plain_error = 0;
+    let mut conservative_error = 0;
+    for i in 0..1000u64 {
+        let weight = if i % 100 == 0 { 1000 } else { 1 };
+        let estimate = conservative.estimate(i);
+        assert_that!(estimate, ge(weight));
+        assert_that!(estimate, le(plain.estimate(i)));
+        assert_that!(conservative.upper_bound(i), ge(weight));
+        plain_error += plain.estimate(i) - weight;
+        conservative_error += estimate - weight;
+    }
+    assert!(
+        conservative_error < plain_error,
+        "{conservative_error} >= {plain_error}"
+    );
+}
+
+#[test]
+fn test_conservative_update_merge() {
+    let mut left = CountMinSketch::<u32>::new(3, 64);
+    let mut right = CountMinSketch::<u32>::new(3, 64);
+    for _ in 0..10 {
+        left.update_conservative("a");
+    }
+    right.update_conservative_with_weight("a", 4);
+    right.update_conservative_with_weight("b", 4);
+    right.update_conservative_with_weight("c", 0);
+    assert_eq!(right.total_weight(), 8);
+
+    left.merge(&right);
+    assert_eq!(left.total_weight(), 18);
+    assert_that!(left.estimate("a"), ge(14));
+    assert_that!(left.estimate("b"), ge(4));
+}
+
 #[test]
 fn test_merge() {
     let mut left = CountMinSketch::<i64>::new(3, 64);
@@ -214,6 +261,27 @@ fn test_serialize_deserialize_non_empty_u64() {
     assert_eq!(decoded.estimate(42u64), sketch.estimate(42u64));
 }
 
+#[test]
+fn test_empty_image_claiming_a_huge_table() {
+    let bytes = CountMinSketch::<i64>::new(2, 5).serialize();
+    assert_eq!(bytes.len(), 16);
+
+    // 2^29 counters, a 4 GiB table from a 16-byte image
+    let mut huge = bytes.clone();
+    huge[8..12].copy_from_slice(&(1u32 << 23).to_le_bytes());
+    huge[12] = 64;
+    assert!(CountMinSketch::<i64>::deserialize(&huge).is_err());
+    assert!(CountMinSketch::<i64>::read_from(&mut &huge[..]).is_err());
+
+    let mut large = bytes.clone();
+    large[8..12].copy_from_slice(&(1u32 << 20).to_le_bytes());
+    large[12] = 4;
+    let sketch = CountMinSketch::<i64>::deserialize(&large).unwrap();
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.num_buckets(), 1 << 20);
+    assert_eq!(sketch.serialize(), large);
+}
+
 #[test]
 #[should_panic(expected = "num_hashes must be at least 1")]
 fn test_invalid_hashes() {
@@ -234,6 +302,14 @@ fn test_merge_incompatible() {
     left.merge(&right);
 }
 
+#[test]
+#[should_panic(expected = "cannot merge sketches with different num_buckets")]
+fn test_merge_different_num_buckets() {
+    let mut left = CountMinSketch::<i64>::new(3, 64);
+    let right = CountMinSketch::<i64>::new(3, 32);
+    left.merge(&right);
+}
+
 #[test]
 fn test_increment_single_key_like_rust_count_min_sketch() {
     let mut sketch = CountMinSketch::<i64>::new(4, 32);
@@ -24,6 +24,7 @@ use std::path::PathBuf;
 
 use common::serialization_test_data;
 use datasketches::cpc::CpcSketch;
+use datasketches::error::ErrorKind;
 use googletest::assert_that;
 use googletest::prelude::near;
 
@@ -84,3 +85,29 @@ fn test_cpp_compatibility() {
         test_sketch_file(path, n);
     }
 }
+
+#[test]
+fn test_deserialize_invalid() {
+    for n in [100, 3_000, 30_000] {
+        let mut sketch = CpcSketch::new(11);
+        for i in 0..n {
+            sketch.update(i);
+        }
+        let bytes = sketch.serialize();
+        CpcSketch::deserialize(&bytes).unwrap();
+
+        let err = CpcSketch::deserialize(&bytes[..bytes.len() - 1]).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidData, "{err}");
+
+        if n < 1_000 {
+            // sparse images store no separate table count, so a smaller coupon count
+            // decodes as a valid prefix of the table
+            continue;
+        }
+        // the coupon count no longer agrees with the compressed table and window
+        let mut corrupted = bytes.clone();
+        corrupted[8] ^= 1;
+        let err = CpcSketch::deserialize(&corrupted).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidData, "{err}");
+    }
+}
@@ -19,6 +19,7 @@
 
 use datasketches::common::NumStdDev;
 use datasketches::cpc::CpcSketch;
+use datasketches::cpc::CpcUnion;
 use googletest::assert_that;
 use googletest::prelude::ge;
 use googletest::prelude::le;
@@ -62,3 +63,62 @@ fn test_many_values() {
     assert_that!(sketch.estimate(), le(sketch.upper_bound(NumStdDev::One)));
     assert!(sketch.validate());
 }
+
+#[test]
+fn test_is_equivalent() {
+    for n in [0u64, 10, 500, 20_000] {
+        let mut sketch = CpcSketch::new(11);
+        sketch.extend(0..n);
+        let mut recomputed = CpcSketch::new(11);
+        recomputed.extend(0..n);
+        assert_eq!(sketch, recomputed, "n {n}");
+        assert!(sketch.is_equivalent(&recomputed, 0.0), "n {n}");
+
+        let restored = CpcSketch::deserialize(&sketch.serialize()).unwrap();
+        assert!(restored.is_equivalent(&sketch, 0.0), "n {n}");
+
+        let mut reordered = CpcSketch::new(11);
+        reordered.extend((0..n).rev());
+        assert!(reordered.is_equivalent(&sketch, 0.05), "n {n}");
+    }
+
+    let mut left = CpcSketch::new(11);
+    left.extend(0..1000);
+    let mut right = left.clone();
+    assert_eq!(left, right);
+    right.update(1000);
+    assert_ne!(left, right);
+    assert!(!left.is_equivalent(&right, 1.0));
+    assert!(!left.is_equivalent(&CpcSketch::with_seed(11, 1), 1.0));
+}
+
+#[test]
+fn test_snapshot_matches_sketch() {
+    let assert_matches = |sketch: &CpcSketch| {
+        let snapshot = sketch.snapshot();
+        assert_eq!(snapshot.lg_k(), sketch.lg_k());
+        assert_eq!(snapshot.is_empty(), sketch.is_empty());
+        assert_eq!(snapshot.estimate(), sketch.estimate());
+        for kappa in [NumStdDev::One, NumStdDev::Two, NumStdDev::Three] {
+            assert_eq!(snapshot.lower_bound(kappa), sketch.lower_bound(kappa));
+            assert_eq!(snapshot.upper_bound(kappa), sketch.upper_bound(kappa));
+        }
+    };
+
+    let mut sketch = CpcSketch::new(10);
+    assert_matches(&sketch);
+    // sparse, hybrid, pinned and sliding flavors
+    for n in [10, 600, 2000, 20_000] {
+        sketch.extend(0..n);
+        assert_matches(&sketch);
+    }
+
+    // a merged sketch estimates with ICON
+    let mut union = CpcUnion::new(10);
+    union.update(&sketch);
+    assert_matches(&union.to_sketch());
+
+    let snapshot = sketch.snapshot();
+    sketch.extend(20_000..40_000);
+    assert!(sketch.estimate() > snapshot.estimate());
+}
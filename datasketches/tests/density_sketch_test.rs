@@ -0,0 +1,214 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "density")]
+
+use datasketches::density::DensityKernel;
+use datasketches::density::DensitySketch;
+use datasketches::density::GaussianKernel;
+
+#[test]
+fn test_empty() {
+    let sketch = DensitySketch::new(10, 3);
+    assert!(sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), 0);
+    assert_eq!(sketch.num_retained(), 0);
+    assert_eq!(sketch.estimate(&[0.0, 0.0, 0.0]), None);
+    assert_eq!(sketch.iter().count(), 0);
+}
+
+#[test]
+#[should_panic(expected = "k must be at least 2")]
+fn test_invalid_k() {
+    DensitySketch::new(1, 3);
+}
+
+#[test]
+#[should_panic(expected = "dimension mismatch")]
+fn test_dimension_mismatch() {
+    let mut sketch = DensitySketch::new(10, 3);
+    sketch.update(&[0.0, 0.0]);
+}
+
+#[test]
+fn test_one_item() {
+    let mut sketch = DensitySketch::new(10, 3);
+    sketch.update(&[0.0, 0.0, 0.0]);
+    assert!(!sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), 1);
+    assert_eq!(sketch.num_retained(), 1);
+    assert_eq!(sketch.estimate(&[0.0, 0.0, 0.0]), Some(1.0));
+
+    let near = sketch.estimate(&[0.01, 0.01, 0.01]).unwrap();
+    assert!((near - 0.9997).abs() < 1e-4, "near: {near}");
+    let far = sketch.estimate(&[1.0, 1.0, 1.0]).unwrap();
+    assert!((far - (-3.0f64).exp()).abs() < 1e-12, "far: {far}");
+}
+
+#[test]
+fn test_merge() {
+    let mut sketch1 = DensitySketch::new(10, 4);
+    sketch1.update(&[0.0, 0.0, 0.0, 0.0]);
+    sketch1.update(&[1.0, 2.0, 3.0, 4.0]);
+
+    let mut sketch2 = DensitySketch::new(10, 4);
+    sketch2.update(&[1.0, 1.0, 1.0, 1.0]);
+    sketch2.update(&[4.0, 3.0, 2.0, 1.0]);
+
+    sketch1.merge(&sketch2);
+    assert_eq!(sketch1.n(), 4);
+    assert_eq!(sketch1.num_retained(), 4);
+
+    let expected = (1.0 + (-30.0f64).exp() + (-4.0f64).exp() + (-30.0f64).exp()) / 4.0;
+    let estimate = sketch1.estimate(&[0.0, 0.0, 0.0, 0.0]).unwrap();
+    assert!((estimate - expected).abs() < 1e-12);
+
+    // merging an empty sketch is a no-op, even if its dimension differs
+    sketch1.merge(&DensitySketch::new(10, 2));
+    assert_eq!(sketch1.n(), 4);
+}
+
+#[test]
+fn test_merge_estimation_mode() {
+    let mut sketch1 = DensitySketch::new(16, 1);
+    let mut sketch2 = DensitySketch::new(16, 1);
+    for i in 0..1000 {
+        sketch1.update(&[i as f64 / 1000.0]);
+        sketch2.update(&[1.0 + i as f64 / 1000.0]);
+    }
+    sketch1.merge(&sketch2);
+    assert_eq!(sketch1.n(), 2000);
+    assert!(sketch1.is_estimation_mode());
+    assert_eq!(sketch1.iter().count(), sketch1.num_retained() as usize);
+}
+
+#[test]
+fn test_estimation_accuracy() {
+    let n = 10_000;
+    let points: Vec<f64> = (0..n).map(|i| 4.0 * i as f64 / n as f64).collect();
+
+    let mut sketch = DensitySketch::new(64, 1);
+    for &x in &points {
+        sketch.update(&[x]);
+    }
+    assert!(sketch.is_estimation_mode());
+    assert!(sketch.num_retained() < 1000);
+
+    for query in [0.0, 1.0, 2.0, 3.5, 6.0] {
+        let exact = points
+            .iter()
+            .map(|&x| GaussianKernel.evaluate(&[x], &[query]))
+            .sum::<f64>()
+            / n as f64;
+        let estimate = sketch.estimate(&[query]).unwrap();
+        assert!(
+            (estimate - exact).abs() < 0.05,
+            "query {query}: estimate {estimate}, exact {exact}"
+        );
+    }
+}
+
+#[test]
+fn test_custom_kernel() {
+    let inverse_distance = |a: &[f64], b: &[f64]| {
+        let squared_distance: f64 = a.iter().zip(b).map(|(x, y)| (x - y) * (x - y)).sum();
+        1.0 / (1.0 + squared_distance)
+    };
+    let mut sketch = DensitySketch::with_kernel(10, 2, inverse_distance);
+    sketch.update(&[0.0, 0.0]);
+    sketch.update(&[1.0, 1.0]);
+    assert_eq!(sketch.estimate(&[0.0, 0.0]), Some((1.0 + 1.0 / 3.0) / 2.0));
+
+    let bytes = sketch.serialize();
+    let restored = DensitySketch::deserialize_with_kernel(&bytes, inverse_distance).unwrap();
+    assert_eq!(restored.estimate(&[0.0, 0.0]), sketch.estimate(&[0.0, 0.0]));
+}
+
+#[test]
+fn test_serialize_empty() {
+    let sketch = DensitySketch::new(10, 3);
+    let bytes = sketch.serialize();
+    assert_eq!(bytes, [3, 1, 19, 4, 10, 0, 0, 0, 3, 0, 0, 0]);
+
+    let restored = DensitySketch::deserialize(&bytes).unwrap();
+    assert!(restored.is_empty());
+    assert_eq!(restored.k(), 10);
+    assert_eq!(restored.dim(), 3);
+}
+
+#[test]
+fn test_serialize_exact_mode() {
+    let mut sketch = DensitySketch::new(10, 3);
+    sketch.update(&[1.0, 2.0, 3.0]);
+    sketch.update(&[4.0, 5.0, 6.0]);
+
+    let bytes = sketch.serialize();
+    assert_eq!(bytes.len(), 24 + 4 + 2 * 3 * 8);
+
+    let restored = DensitySketch::deserialize(&bytes).unwrap();
+    assert_eq!(restored.n(), 2);
+    assert_eq!(restored.num_retained(), 2);
+    let points: Vec<_> = restored.iter().collect();
+    assert_eq!(
+        points,
+        [(&[1.0, 2.0, 3.0][..], 1), (&[4.0, 5.0, 6.0][..], 1)]
+    );
+}
+
+#[test]
+fn test_serialize_estimation_mode() {
+    let mut sketch = DensitySketch::new(10, 2);
+    for i in 0..1000 {
+        sketch.update(&[i as f64, (i % 7) as f64]);
+    }
+    assert!(sketch.is_estimation_mode());
+
+    let bytes = sketch.serialize();
+    let restored = DensitySketch::deserialize(&bytes).unwrap();
+    assert_eq!(restored.k(), sketch.k());
+    assert_eq!(restored.n(), sketch.n());
+    assert_eq!(restored.num_retained(), sketch.num_retained());
+    assert!(restored.iter().eq(sketch.iter()));
+    assert_eq!(
+        restored.estimate(&[500.0, 3.0]),
+        sketch.estimate(&[500.0, 3.0])
+    );
+    assert_eq!(restored.serialize(), bytes);
+}
+
+#[test]
+fn test_deserialize_errors() {
+    let mut sketch = DensitySketch::new(10, 1);
+    sketch.update(&[1.0]);
+    let bytes = sketch.serialize();
+
+    assert!(DensitySketch::deserialize(&bytes[..bytes.len() - 1]).is_err());
+
+    let mut wrong_family = bytes.clone();
+    wrong_family[2] = 20;
+    assert!(DensitySketch::deserialize(&wrong_family).is_err());
+
+    let mut wrong_preamble = bytes.clone();
+    wrong_preamble[0] = 3;
+    assert!(DensitySketch::deserialize(&wrong_preamble).is_err());
+
+    let mut wrong_num_retained = bytes;
+    wrong_num_retained[12] = 2;
+    assert!(DensitySketch::deserialize(&wrong_num_retained).is_err());
+}
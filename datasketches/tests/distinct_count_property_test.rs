@@ -0,0 +1,420 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Property tests for the distinct counting sketches.
+//!
+//! Each property is checked over a fixed set of seeded cases, each drawing its own
+//! configuration and stream, so that a failure reproduces from the seed in its message:
+//!
+//! * the true count lies within the 3 standard deviation bounds, bar the expected few misses;
+//! * a union does not depend on the order of its inputs;
+//! * repeating an input, to a sketch or to a union, changes nothing.
+
+use std::f64::consts::LN_10;
+
+#[allow(dead_code)] // unused when no distinct counting family is enabled
+const NUM_CASES: u64 = 64;
+
+/// A splitmix64 stream, so that every case is reproducible from its seed.
+#[allow(dead_code)] // unused when no distinct counting family is enabled
+struct Rng(u64);
+
+#[allow(dead_code)] // unused when no distinct counting family is enabled
+impl Rng {
+    fn next_u64(&mut self) -> u64 {
+        self.0 = self.0.wrapping_add(0x9E37_79B9_7F4A_7C15);
+        let mut z = self.0;
+        z = (z ^ (z >> 30)).wrapping_mul(0xBF58_476D_1CE4_E5B9);
+        z = (z ^ (z >> 27)).wrapping_mul(0x94D0_49BB_1331_11EB);
+        z ^ (z >> 31)
+    }
+
+    fn in_range(&mut self, min: u8, max: u8) -> u8 {
+        min + (self.next_u64() % u64::from(max - min + 1)) as u8
+    }
+
+    /// A stream length between 0 and 100,000, uniform on a log scale so that every mode of
+    /// the sketches is exercised.
+    fn stream_len(&mut self) -> usize {
+        let exponent = (self.next_u64() >> 11) as f64 / (1u64 << 53) as f64 * 5.0;
+        (exponent * LN_10).exp() as usize - 1
+    }
+
+    /// Distinct items, barring a 64-bit collision.
+    fn stream(&mut self, len: usize) -> Vec<u64> {
+        (0..len).map(|_| self.next_u64()).collect()
+    }
+
+    fn random_stream(&mut self) -> Vec<u64> {
+        let len = self.stream_len();
+        self.stream(len)
+    }
+}
+
+/// Counts the cases whose true count falls outside the 3 standard deviation bounds.
+///
+/// Each bound misses about 0.13% of the time, so a few misses over all cases are expected;
+/// more than one in 64 means the bounds are too tight.
+#[allow(dead_code)] // unused when no distinct counting family is enabled
+#[derive(Default)]
+struct Misses(Vec<String>);
+
+#[allow(dead_code)] // unused when no distinct counting family is enabled
+impl Misses {
+    fn check(&mut self, seed: u64, n: usize, lower_bound: f64, upper_bound: f64) {
+        let n = n as f64;
+        if !(lower_bound <= n && n <= upper_bound) {
+            self.0.push(format!(
+                "seed {seed}: {n} outside [{lower_bound}, {upper_bound}]"
+            ));
+        }
+    }
+
+    fn assert_few(&self, what: &str) {
+        assert!(
+            self.0.len() as u64 <= NUM_CASES / 64,
+            "too many {what} bound misses:\n{}",
+            self.0.join("\n")
+        );
+    }
+}
+
+#[cfg(feature = "hll")]
+mod hll {
+    use std::collections::HashSet;
+
+    use datasketches::common::NumStdDev;
+    use datasketches::hll::Coupon;
+    use datasketches::hll::HllSketch;
+    use datasketches::hll::HllType;
+    use datasketches::hll::HllUnion;
+
+    use super::*;
+
+    fn random_sketch(rng: &mut Rng, lg_k: u8, items: &[u64]) -> HllSketch {
+        let hll_type = [HllType::Hll4, HllType::Hll6, HllType::Hll8][rng.in_range(0, 2) as usize];
+        let mut sketch = HllSketch::new(lg_k, hll_type);
+        sketch.extend(items);
+        sketch
+    }
+
+    #[test]
+    fn test_estimate_within_bounds() {
+        let mut misses = Misses::default();
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let lg_k = rng.in_range(4, 16);
+            let n = rng.stream_len();
+            let items = rng.stream(n);
+            let sketch = random_sketch(&mut rng, lg_k, &items);
+            misses.check(
+                seed,
+                n,
+                sketch.lower_bound(NumStdDev::Three),
+                sketch.upper_bound(NumStdDev::Three),
+            );
+        }
+        misses.assert_few("HLL");
+    }
+
+    #[test]
+    fn test_union_commutative_and_idempotent() {
+        let mut misses = Misses::default();
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let lg_k = rng.in_range(4, 16);
+            let mut items = rng.random_stream();
+            // the inputs share the middle of the stream
+            let shared = items.len() / 2;
+            items.extend(rng.random_stream());
+            let a = random_sketch(&mut rng, lg_k, &items[..shared * 2]);
+            let lg_k = rng.in_range(4, 16);
+            let b = random_sketch(&mut rng, lg_k, &items[shared..]);
+
+            let union_of = |inputs: &[&HllSketch]| {
+                let mut union = HllUnion::new(16);
+                for input in inputs {
+                    union.update(input);
+                }
+                union.to_sketch(HllType::Hll8)
+            };
+            // whether the HIP estimate survives depends on the order of the inputs, as in
+            // C++, so the registers are compared through the composite estimate
+            let ab = union_of(&[&a, &b]);
+            let ba = union_of(&[&b, &a]);
+            assert_eq!(ab.lg_config_k(), ba.lg_config_k(), "seed {seed}");
+            assert_eq!(
+                ab.composite_estimate(),
+                ba.composite_estimate(),
+                "seed {seed}"
+            );
+            assert_eq!(
+                union_of(&[&a, &a]).composite_estimate(),
+                a.composite_estimate(),
+                "seed {seed}"
+            );
+            assert_eq!(
+                union_of(&[&a, &b, &a]).composite_estimate(),
+                ab.composite_estimate(),
+                "seed {seed}"
+            );
+            misses.check(
+                seed,
+                items.len(),
+                ab.lower_bound(NumStdDev::Three),
+                ab.upper_bound(NumStdDev::Three),
+            );
+        }
+        misses.assert_few("HLL union");
+    }
+
+    /// The current mode stored in the low two bits of byte 7 of an image
+    fn serialized_mode(sketch: &HllSketch) -> u8 {
+        sketch.serialize()[7] & 3
+    }
+
+    /// Draws `count` distinct coupons, so that each one grows a List or Set by one.
+    fn distinct_coupons(rng: &mut Rng, count: usize) -> Vec<Coupon> {
+        let mut seen = HashSet::with_capacity(count);
+        let mut coupons = Vec::with_capacity(count);
+        while coupons.len() < count {
+            let coupon = Coupon::from_hash(rng.next_u64());
+            if seen.insert(coupon) {
+                coupons.push(coupon);
+            }
+        }
+        coupons
+    }
+
+    #[test]
+    fn test_set_mode_at_promotion_boundary() {
+        // random streams rarely stop right before a Set fills up, so the cases are built to
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let lg_k = rng.in_range(8, 16);
+            // a Set of 2^(lg_k - 3) slots is promoted to HLL once it is more than 3/4 full
+            let max_set_len = 3 << (lg_k - 5);
+            let coupons = distinct_coupons(&mut rng, max_set_len + 1);
+            let (last, coupons) = coupons.split_last().unwrap();
+
+            let mut full_set = random_sketch(&mut rng, lg_k, &[]);
+            for &coupon in coupons {
+                full_set.update_with_coupon(coupon);
+            }
+            assert_eq!(serialized_mode(&full_set), 1, "seed {seed}");
+
+            let mut promoted = full_set.clone();
+            promoted.update_with_coupon(*last);
+            assert_eq!(serialized_mode(&promoted), 2, "seed {seed}");
+
+            // a sketch read back at the boundary promotes on the same coupon
+            let mut decoded = HllSketch::deserialize(&full_set.serialize()).unwrap();
+            assert_eq!(decoded, full_set, "seed {seed}");
+            decoded.update_with_coupon(*last);
+            assert_eq!(decoded.serialize(), promoted.serialize(), "seed {seed}");
+
+            let mut single = HllSketch::new(lg_k, HllType::Hll8);
+            single.update_with_coupon(*last);
+            let mut union = HllUnion::new(lg_k);
+            union.update(&full_set);
+            union.update(&single);
+            assert_eq!(
+                union.to_sketch(HllType::Hll8).composite_estimate(),
+                promoted.composite_estimate(),
+                "seed {seed}"
+            );
+        }
+    }
+
+    #[test]
+    fn test_duplicate_updates_change_nothing() {
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let lg_k = rng.in_range(4, 16);
+            let items = rng.random_stream();
+            let mut sketch = random_sketch(&mut rng, lg_k, &items);
+            let once = sketch.clone();
+            sketch.extend(&items);
+            assert_eq!(sketch, once, "seed {seed}");
+        }
+    }
+}
+
+#[cfg(feature = "cpc")]
+mod cpc {
+    use datasketches::common::NumStdDev;
+    use datasketches::cpc::CpcSketch;
+    use datasketches::cpc::CpcUnion;
+
+    use super::*;
+
+    fn sketch_of(lg_k: u8, items: &[u64]) -> CpcSketch {
+        let mut sketch = CpcSketch::new(lg_k);
+        sketch.extend(items);
+        sketch
+    }
+
+    #[test]
+    fn test_estimate_within_bounds() {
+        let mut misses = Misses::default();
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let lg_k = rng.in_range(4, 16);
+            let n = rng.stream_len();
+            let sketch = sketch_of(lg_k, &rng.stream(n));
+            misses.check(
+                seed,
+                n,
+                sketch.lower_bound(NumStdDev::Three),
+                sketch.upper_bound(NumStdDev::Three),
+            );
+        }
+        misses.assert_few("CPC");
+    }
+
+    #[test]
+    fn test_union_commutative_and_idempotent() {
+        let mut misses = Misses::default();
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let mut items = rng.random_stream();
+            let shared = items.len() / 2;
+            items.extend(rng.random_stream());
+            let a = sketch_of(rng.in_range(4, 16), &items[..shared * 2]);
+            let b = sketch_of(rng.in_range(4, 16), &items[shared..]);
+
+            let union_of = |inputs: &[&CpcSketch]| {
+                let mut union = CpcUnion::new(16);
+                for input in inputs {
+                    union.update(input);
+                }
+                union.to_sketch()
+            };
+            let ab = union_of(&[&a, &b]);
+            let ba = union_of(&[&b, &a]);
+            assert_eq!(ab.lg_k(), ba.lg_k(), "seed {seed}");
+            assert_eq!(ab.num_coupons(), ba.num_coupons(), "seed {seed}");
+            assert_eq!(ab.estimate(), ba.estimate(), "seed {seed}");
+            assert_eq!(
+                union_of(&[&a, &a]).estimate(),
+                union_of(&[&a]).estimate(),
+                "seed {seed}"
+            );
+            misses.check(
+                seed,
+                items.len(),
+                ab.lower_bound(NumStdDev::Three),
+                ab.upper_bound(NumStdDev::Three),
+            );
+        }
+        misses.assert_few("CPC union");
+    }
+
+    #[test]
+    fn test_duplicate_updates_change_nothing() {
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let items = rng.random_stream();
+            let mut sketch = sketch_of(rng.in_range(4, 16), &items);
+            let estimate = sketch.estimate();
+            sketch.extend(&items);
+            assert_eq!(sketch.estimate(), estimate, "seed {seed}");
+        }
+    }
+}
+
+#[cfg(feature = "theta")]
+mod theta {
+    use datasketches::common::NumStdDev;
+    use datasketches::theta::CompactThetaSketch;
+    use datasketches::theta::ThetaSketchBuilder;
+    use datasketches::theta::ThetaUnionBuilder;
+
+    use super::*;
+
+    fn sketch_of(lg_k: u8, items: &[u64]) -> CompactThetaSketch {
+        let mut sketch = ThetaSketchBuilder::default().lg_k(lg_k).build();
+        sketch.extend(items);
+        sketch.compact(true)
+    }
+
+    #[test]
+    fn test_estimate_within_bounds() {
+        let mut misses = Misses::default();
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let lg_k = rng.in_range(5, 16);
+            let n = rng.stream_len();
+            let sketch = sketch_of(lg_k, &rng.stream(n));
+            misses.check(
+                seed,
+                n,
+                sketch.lower_bound(NumStdDev::Three),
+                sketch.upper_bound(NumStdDev::Three),
+            );
+        }
+        misses.assert_few("Theta");
+    }
+
+    #[test]
+    fn test_union_commutative_and_idempotent() {
+        let mut misses = Misses::default();
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let mut items = rng.random_stream();
+            let shared = items.len() / 2;
+            items.extend(rng.random_stream());
+            let a = sketch_of(rng.in_range(5, 16), &items[..shared * 2]);
+            let b = sketch_of(rng.in_range(5, 16), &items[shared..]);
+
+            let union_of = |inputs: &[&CompactThetaSketch]| {
+                let mut union = ThetaUnionBuilder::default().lg_k(16).build();
+                for input in inputs {
+                    union.update(*input).unwrap();
+                }
+                // compact sketches compare by their images
+                union.to_sketch(true).serialize()
+            };
+            let ab = union_of(&[&a, &b]);
+            assert_eq!(ab, union_of(&[&b, &a]), "seed {seed}");
+            assert_eq!(union_of(&[&a, &a]), union_of(&[&a]), "seed {seed}");
+            assert_eq!(union_of(&[&a, &b, &a]), ab, "seed {seed}");
+            let ab = CompactThetaSketch::deserialize(&ab).unwrap();
+            misses.check(
+                seed,
+                items.len(),
+                ab.lower_bound(NumStdDev::Three),
+                ab.upper_bound(NumStdDev::Three),
+            );
+        }
+        misses.assert_few("Theta union");
+    }
+
+    #[test]
+    fn test_duplicate_updates_change_nothing() {
+        for seed in 0..NUM_CASES {
+            let mut rng = Rng(seed);
+            let lg_k = rng.in_range(5, 16);
+            let items = rng.random_stream();
+            let mut sketch = ThetaSketchBuilder::default().lg_k(lg_k).build();
+            sketch.extend(&items);
+            let once = sketch.compact(true).serialize();
+            sketch.extend(&items);
+            assert_eq!(sketch.compact(true).serialize(), once, "seed {seed}");
+        }
+    }
+}
@@ -0,0 +1,130 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(
+    feature = "frequencies",
+    feature = "hll",
+    feature = "kll",
+    feature = "tdigest",
+    feature = "theta"
+))]
+
+use datasketches::frequencies::FrequentItemsSketch;
+use datasketches::hash::murmurhash3_x64_128;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::kll::KllSketch;
+use datasketches::tdigest::TDigestMut;
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+
+fn hll_sketch(n: u64) -> HllSketch {
+    let mut sketch = HllSketch::new(10, HllType::Hll4);
+    sketch.extend(0..n);
+    sketch
+}
+
+fn theta_sketch(n: u64) -> CompactThetaSketch {
+    let mut sketch = ThetaSketchBuilder::default().build();
+    sketch.extend(0..n);
+    sketch.compact(true)
+}
+
+#[test]
+fn test_replicas_have_equal_fingerprints() {
+    for n in [0, 10, 1000, 100000] {
+        let hll = hll_sketch(n);
+        assert_eq!(hll.fingerprint(), hll_sketch(n).fingerprint());
+        let decoded = HllSketch::deserialize(&hll.serialize()).unwrap();
+        assert_eq!(decoded.fingerprint(), hll.fingerprint());
+        assert_ne!(hll.fingerprint(), hll_sketch(n + 1000).fingerprint());
+
+        let theta = theta_sketch(n);
+        assert_eq!(theta.fingerprint(), theta_sketch(n).fingerprint());
+        let decoded = CompactThetaSketch::deserialize(&theta.serialize()).unwrap();
+        assert_eq!(decoded.fingerprint(), theta.fingerprint());
+        assert_ne!(theta.fingerprint(), theta_sketch(n + 1000).fingerprint());
+    }
+
+    let mut kll = KllSketch::<f64>::default();
+    kll.extend((0..1000).map(f64::from));
+    let decoded = KllSketch::<f64>::deserialize(&kll.serialize()).unwrap();
+    assert_eq!(decoded.fingerprint(), kll.fingerprint());
+    kll.update(1000.0);
+    assert_ne!(decoded.fingerprint(), kll.fingerprint());
+
+    // the fingerprint of a digest covers its compressed state, whether or not it is buffered
+    let mut tdigest = TDigestMut::new(100);
+    tdigest.extend((0..1000).map(f64::from));
+    let fingerprint = tdigest.fingerprint();
+    let image = tdigest.serialize();
+    assert_eq!(tdigest.fingerprint(), fingerprint);
+    assert_eq!(
+        TDigestMut::deserialize(&image, false)
+            .unwrap()
+            .fingerprint(),
+        fingerprint
+    );
+}
+
+#[test]
+fn test_fingerprint_hashes_serialized_image() {
+    let sketch = hll_sketch(100000);
+    assert_eq!(
+        sketch.fingerprint(),
+        murmurhash3_x64_128(&sketch.serialize(), 0).0
+    );
+
+    // the 8-byte image of an empty List mode sketch, pinned across platforms
+    let sketch = HllSketch::new(12, HllType::Hll8);
+    assert_eq!(sketch.serialize(), [2, 1, 7, 12, 3, 12, 0, 8]);
+    assert_eq!(sketch.fingerprint(), 1189770568034835851);
+}
+
+#[test]
+fn test_fingerprint_ignores_table_layout() {
+    // List and Set modes, updated in opposite orders; in HLL mode the HIP estimate depends on
+    // the order of the updates, so the state differs too
+    for n in [5, 50] {
+        let mut forward = HllSketch::new(10, HllType::Hll4);
+        forward.extend(0..n);
+        let mut backward = HllSketch::new(10, HllType::Hll4);
+        backward.extend((0..n).rev());
+        assert_ne!(forward.serialize(), backward.serialize(), "n={n}");
+        assert_eq!(forward.fingerprint(), backward.fingerprint(), "n={n}");
+    }
+
+    let mut theta = ThetaSketchBuilder::default().build();
+    theta.extend(0..1000);
+    let ordered = theta.compact(true);
+    let unordered = theta.compact(false);
+    assert_ne!(ordered.serialize(), unordered.serialize());
+    assert_eq!(ordered.fingerprint(), unordered.fingerprint());
+
+    let mut forward = FrequentItemsSketch::<String>::new(64);
+    let mut backward = FrequentItemsSketch::<String>::new(64);
+    let items: Vec<String> = (0..20).map(|i| format!("item-{i}")).collect();
+    for item in &items {
+        forward.update_with_count(item.clone(), 3);
+    }
+    for item in items.iter().rev() {
+        backward.update_with_count(item.clone(), 3);
+    }
+    assert_eq!(forward.fingerprint(), backward.fingerprint());
+    backward.update("item-0".to_string());
+    assert_ne!(forward.fingerprint(), backward.fingerprint());
+}
@@ -117,6 +117,23 @@ fn test_purged_to_empty_round_trip() {
     assert!(restored.is_empty());
 }
 
+#[test]
+fn test_deserialize_weight_below_counts() {
+    let mut sketch = FrequentItemsSketch::<i64>::new(32);
+    sketch.update_with_count(1, 10);
+    sketch.update_with_count(2, 5);
+    let mut bytes = sketch.serialize();
+    // stream weight follows the 16 bytes of header and item count
+    bytes[16..24].copy_from_slice(&14u64.to_le_bytes());
+    let err = FrequentItemsSketch::<i64>::deserialize(&bytes).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+    assert!(err.message().contains("stream weight"), "{err}");
+
+    bytes[16..24].copy_from_slice(&15u64.to_le_bytes());
+    let restored = FrequentItemsSketch::<i64>::deserialize(&bytes).unwrap();
+    assert_eq!(restored.total_weight(), 15);
+}
+
 #[test]
 fn test_java_frequent_longs_compatibility() {
     let test_cases = [0, 1, 10, 100, 1000, 10000, 100000, 1000000];
@@ -526,6 +526,62 @@ fn test_longs_reset() {
     assert_eq!(sketch.lg_max_map_size(), 3);
 }
 
+#[test]
+fn test_purge_sample_size_and_count() {
+    let mut sketch = FrequentItemsSketch::<i64>::new(8);
+    // min(1024, 0.75 * 8)
+    assert_eq!(sketch.sample_size(), 6);
+    assert_eq!(sketch.num_purges(), 0);
+
+    sketch.extend(0..6);
+    assert_eq!(sketch.num_purges(), 0);
+    assert_eq!(sketch.maximum_error(), 0);
+    sketch.update(6);
+    assert_eq!(sketch.num_purges(), 1);
+    assert!(sketch.maximum_error() > 0);
+
+    sketch.set_sample_size(1);
+    sketch.extend(100..200);
+    assert_eq!(sketch.sample_size(), 1);
+    assert!(sketch.num_purges() > 1);
+    assert!(sketch.num_active_items() <= sketch.maximum_map_capacity());
+
+    // the configuration survives a reset, the statistic does not
+    sketch.reset();
+    assert_eq!(sketch.sample_size(), 1);
+    assert_eq!(sketch.num_purges(), 0);
+
+    let bytes = sketch.serialize();
+    let restored = FrequentItemsSketch::<i64>::deserialize(&bytes).unwrap();
+    assert_eq!(restored.sample_size(), 6);
+    assert_eq!(restored.num_purges(), 0);
+}
+
+#[test]
+fn test_purge_count_during_merge() {
+    let mut left = FrequentItemsSketch::<i64>::new(8);
+    let mut right = FrequentItemsSketch::<i64>::new(8);
+    left.extend(0..6);
+    right.extend(6..12);
+    assert_eq!(right.num_purges(), 0);
+
+    left.merge(&right);
+    assert!(left.num_purges() > 0);
+    assert_eq!(right.num_purges(), 0);
+}
+
+#[test]
+#[should_panic(expected = "sample_size must be in [1, 1024], got 0")]
+fn test_zero_sample_size_panics() {
+    FrequentItemsSketch::<i64>::new(8).set_sample_size(0);
+}
+
+#[test]
+#[should_panic(expected = "sample_size must be in [1, 1024], got 1025")]
+fn test_oversized_sample_size_panics() {
+    FrequentItemsSketch::<i64>::new(8).set_sample_size(1025);
+}
+
 #[test]
 #[should_panic(expected = "max_map_size must be power of 2")]
 fn test_longs_invalid_map_size_panics() {
@@ -537,3 +593,16 @@ fn test_longs_invalid_map_size_panics() {
 fn test_items_invalid_map_size_panics() {
     FrequentItemsSketch::<String>::new(6);
 }
+
+#[test]
+fn test_estimated_size_grows_to_max_map_size() {
+    let mut sketch = FrequentItemsSketch::<i64>::new(64);
+    let empty_size = sketch.estimated_size();
+    sketch.extend(0..1_000);
+    let full_size = sketch.estimated_size();
+    assert!(full_size > empty_size);
+
+    // the map stops growing at the maximum size and purges instead
+    sketch.extend(1_000..10_000);
+    assert_eq!(sketch.estimated_size(), full_size);
+}
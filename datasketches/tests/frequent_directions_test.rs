@@ -0,0 +1,250 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "matrix")]
+
+use datasketches::matrix::FrequentDirections;
+
+/// Deterministic pseudo-random rows in [-1, 1).
+fn random_rows(num_rows: usize, d: usize, seed: u64) -> Vec<Vec<f64>> {
+    let mut state = seed;
+    let mut next = move || {
+        state = state
+            .wrapping_mul(6364136223846793005)
+            .wrapping_add(1442695040888963407);
+        (state >> 11) as f64 / (1u64 << 52) as f64 - 1.0
+    };
+    (0..num_rows)
+        .map(|_| (0..d).map(|_| next()).collect())
+        .collect()
+}
+
+fn gram<'a>(rows: impl IntoIterator<Item = &'a [f64]>, d: usize) -> Vec<Vec<f64>> {
+    let mut gram = vec![vec![0.0; d]; d];
+    for row in rows {
+        for i in 0..d {
+            for j in 0..d {
+                gram[i][j] += row[i] * row[j];
+            }
+        }
+    }
+    gram
+}
+
+/// Spectral norm of a symmetric positive semidefinite matrix by power iteration.
+fn spectral_norm(matrix: &[Vec<f64>]) -> f64 {
+    let d = matrix.len();
+    let mut x = vec![1.0; d];
+    let mut norm = 0.0;
+    for _ in 0..500 {
+        let y: Vec<f64> = matrix
+            .iter()
+            .map(|row| row.iter().zip(&x).map(|(a, b)| a * b).sum())
+            .collect();
+        norm = y.iter().map(|v| v * v).sum::<f64>().sqrt();
+        if norm == 0.0 {
+            return 0.0;
+        }
+        x = y.into_iter().map(|v| v / norm).collect();
+    }
+    norm
+}
+
+fn covariance_error(sketch: &FrequentDirections, input: &[Vec<f64>]) -> Vec<Vec<f64>> {
+    let d = sketch.d() as usize;
+    let a = gram(input.iter().map(|row| row.as_slice()), d);
+    let b = gram(sketch.rows(), d);
+    a.iter()
+        .zip(&b)
+        .map(|(a, b)| a.iter().zip(b).map(|(x, y)| x - y).collect())
+        .collect()
+}
+
+fn squared_frobenius(rows: &[Vec<f64>]) -> f64 {
+    rows.iter().flatten().map(|x| x * x).sum()
+}
+
+#[test]
+fn test_empty() {
+    let sketch = FrequentDirections::new(4, 3);
+    assert!(sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), 0);
+    assert_eq!(sketch.num_rows(), 0);
+    assert_eq!(sketch.covariance_error_bound(), 0.0);
+    assert!(sketch.singular_values().is_empty());
+    assert!(sketch.projection().is_empty());
+    assert!(sketch.result().is_empty());
+}
+
+#[test]
+fn test_low_rank_input_is_exact() {
+    let basis = [[1.0, 2.0, 0.0, -1.0, 0.5], [0.0, 1.0, 1.0, 0.0, -2.0]];
+    let input: Vec<Vec<f64>> = random_rows(500, 2, 1)
+        .into_iter()
+        .map(|c| {
+            (0..5)
+                .map(|j| c[0] * basis[0][j] + c[1] * basis[1][j])
+                .collect()
+        })
+        .collect();
+
+    let mut sketch = FrequentDirections::new(3, 5);
+    sketch.extend(&input);
+    assert_eq!(sketch.n(), 500);
+    assert!(sketch.num_rows() <= 6);
+    assert_eq!(sketch.singular_values().len(), 2);
+    assert!(!sketch.is_estimation_mode());
+
+    let scale = squared_frobenius(&input);
+    let error = spectral_norm(&covariance_error(&sketch, &input));
+    assert!(error <= 1e-9 * scale, "error {error}");
+    assert!(sketch.covariance_error_bound() <= 1e-9 * scale);
+}
+
+#[test]
+fn test_covariance_error_bound() {
+    let input = random_rows(1000, 12, 7);
+    let mut sketch = FrequentDirections::new(4, 12);
+    sketch.extend(&input);
+    assert!(sketch.is_estimation_mode());
+    assert!(sketch.num_rows() <= 8);
+
+    let bound = sketch.covariance_error_bound();
+    assert!(bound <= squared_frobenius(&input) / 5.0);
+    let error = spectral_norm(&covariance_error(&sketch, &input));
+    assert!(
+        error <= bound * (1.0 + 1e-9),
+        "error {error} > bound {bound}"
+    );
+}
+
+#[test]
+fn test_decomposition() {
+    let input = random_rows(200, 6, 3);
+    let mut sketch = FrequentDirections::new(3, 6);
+    sketch.extend(&input);
+
+    let singular_values = sketch.singular_values();
+    assert_eq!(singular_values.len(), 3);
+    assert!(singular_values.windows(2).all(|w| w[0] >= w[1]));
+
+    let projection = sketch.projection();
+    for (i, u) in projection.iter().enumerate() {
+        for (j, v) in projection.iter().enumerate() {
+            let dot: f64 = u.iter().zip(v).map(|(x, y)| x * y).sum();
+            let expected = if i == j { 1.0 } else { 0.0 };
+            assert!((dot - expected).abs() < 1e-9, "<v{i}, v{j}> = {dot}");
+        }
+    }
+
+    for ((row, direction), singular_value) in sketch
+        .result()
+        .iter()
+        .zip(&projection)
+        .zip(&singular_values)
+    {
+        for (x, y) in row.iter().zip(direction) {
+            assert!((x - y * singular_value).abs() < 1e-9);
+        }
+    }
+}
+
+#[test]
+fn test_merge() {
+    let input = random_rows(600, 8, 11);
+    let mut left = FrequentDirections::new(4, 8);
+    let mut right = FrequentDirections::new(4, 8);
+    left.extend(&input[..300]);
+    right.extend(&input[300..]);
+
+    left.merge(&right);
+    assert_eq!(left.n(), 600);
+    assert!(left.num_rows() <= 8);
+    let bound = left.covariance_error_bound();
+    let error = spectral_norm(&covariance_error(&left, &input));
+    assert!(
+        error <= bound * (1.0 + 1e-9),
+        "error {error} > bound {bound}"
+    );
+
+    let before = left.clone();
+    left.merge(&FrequentDirections::new(2, 8));
+    assert_eq!(left, before);
+}
+
+#[test]
+fn test_serialize_round_trip() {
+    let empty = FrequentDirections::new(5, 3);
+    let bytes = empty.serialize();
+    assert_eq!(bytes.len(), empty.serialized_size_bytes());
+    assert_eq!(FrequentDirections::deserialize(&bytes).unwrap(), empty);
+
+    let mut sketch = FrequentDirections::new(5, 3);
+    sketch.extend(random_rows(100, 3, 5));
+    let bytes = sketch.serialize();
+    assert_eq!(bytes.len(), sketch.serialized_size_bytes());
+    let restored = FrequentDirections::deserialize(&bytes).unwrap();
+    assert_eq!(restored, sketch);
+    assert_eq!(restored.fingerprint(), sketch.fingerprint());
+
+    let mut buf = vec![];
+    sketch.write_to(&mut buf).unwrap();
+    empty.write_to(&mut buf).unwrap();
+    let mut reader = buf.as_slice();
+    assert_eq!(FrequentDirections::read_from(&mut reader).unwrap(), sketch);
+    assert_eq!(FrequentDirections::read_from(&mut reader).unwrap(), empty);
+    assert!(reader.is_empty());
+}
+
+#[test]
+fn test_deserialize_invalid() {
+    let mut sketch = FrequentDirections::new(5, 3);
+    sketch.extend(random_rows(20, 3, 9));
+    let bytes = sketch.serialize();
+
+    assert!(FrequentDirections::deserialize(&bytes[..bytes.len() - 1]).is_err());
+
+    let mut wrong_family = bytes.clone();
+    wrong_family[2] = 7;
+    assert!(FrequentDirections::deserialize(&wrong_family).is_err());
+
+    let mut zero_k = bytes.clone();
+    zero_k[4..8].copy_from_slice(&0u32.to_le_bytes());
+    assert!(FrequentDirections::deserialize(&zero_k).is_err());
+
+    let mut too_many_rows = bytes.clone();
+    too_many_rows[12..16].copy_from_slice(&11u32.to_le_bytes());
+    assert!(FrequentDirections::deserialize(&too_many_rows).is_err());
+
+    let mut negative_adjustment = bytes;
+    negative_adjustment[24..32].copy_from_slice(&(-1.0f64).to_le_bytes());
+    assert!(FrequentDirections::deserialize(&negative_adjustment).is_err());
+}
+
+#[test]
+#[should_panic(expected = "dimension mismatch")]
+fn test_update_dimension_mismatch() {
+    let mut sketch = FrequentDirections::new(4, 3);
+    sketch.update(&[1.0, 2.0]);
+}
+
+#[test]
+#[should_panic(expected = "k must be at least 1")]
+fn test_zero_k() {
+    FrequentDirections::new(0, 3);
+}
@@ -0,0 +1,80 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "hll")]
+
+use std::sync::Arc;
+
+use datasketches::common::NumStdDev;
+use datasketches::hll::ConcurrentHll;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+
+#[test]
+fn test_merged_registers_match_sequential_sketch() {
+    let sketch = Arc::new(ConcurrentHll::with_shards(10, 4));
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.num_shards(), 4);
+
+    let handles: Vec<_> = (0..8u64)
+        .map(|t| {
+            let sketch = Arc::clone(&sketch);
+            std::thread::spawn(move || {
+                for i in 0..10_000 {
+                    sketch.update(t * 10_000 + i);
+                }
+            })
+        })
+        .collect();
+    for handle in handles {
+        handle.join().unwrap();
+    }
+
+    let mut sequential = HllSketch::new(10, HllType::Hll8);
+    for i in 0..80_000u64 {
+        sequential.update(i);
+    }
+    let merged = sketch.to_sketch(HllType::Hll8);
+    assert!(merged.iter().eq(sequential.iter()));
+    assert_eq!(merged.composite_estimate(), sequential.composite_estimate());
+
+    assert!(!sketch.is_empty());
+    assert_eq!(sketch.estimate(), merged.estimate());
+    assert!(sketch.lower_bound(NumStdDev::Two) <= sketch.estimate());
+    assert!(sketch.upper_bound(NumStdDev::Two) >= sketch.estimate());
+}
+
+#[test]
+fn test_single_shard_and_reset() {
+    let sketch = ConcurrentHll::with_shards(12, 1);
+    for i in 0..100 {
+        sketch.update(i);
+        sketch.update(i);
+    }
+    assert_eq!(sketch.estimate().round(), 100.0);
+
+    sketch.reset();
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.estimate(), 0.0);
+    assert!(ConcurrentHll::new(12).num_shards() >= 1);
+}
+
+#[test]
+#[should_panic(expected = "num_shards must be positive")]
+fn test_zero_shards() {
+    ConcurrentHll::with_shards(12, 0);
+}
@@ -0,0 +1,119 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "hll")]
+
+use datasketches::common::NumStdDev;
+use datasketches::error::ErrorKind;
+use datasketches::hll::DirectHllSketch;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+
+#[test]
+fn test_direct_registers_match_heap_sketch() {
+    for hll_type in [HllType::Hll6, HllType::Hll8] {
+        let mut buf = vec![0u8; DirectHllSketch::required_size_bytes(10, hll_type)];
+        let mut direct = DirectHllSketch::new(&mut buf, 10, hll_type).unwrap();
+        let mut heap = HllSketch::new(10, hll_type);
+        assert!(direct.is_empty());
+        assert_eq!(direct.estimate(), 0.0);
+
+        for i in 0..20_000 {
+            direct.update(i);
+            heap.update(i);
+        }
+        assert!(!direct.is_empty());
+        assert_eq!(direct.target_type(), hll_type);
+
+        let copy = direct.to_sketch();
+        assert_eq!(copy.estimate(), direct.estimate());
+        assert!(copy.iter().eq(heap.iter()));
+
+        let error = (direct.estimate() - 20_000.0).abs() / 20_000.0;
+        assert!(error < 0.1, "estimate {} too far off", direct.estimate());
+        assert!(direct.lower_bound(NumStdDev::Two) <= direct.estimate());
+        assert!(direct.upper_bound(NumStdDev::Two) >= direct.estimate());
+    }
+}
+
+#[test]
+fn test_wrap_continues_in_place() {
+    let mut heap = HllSketch::new(8, HllType::Hll8);
+    for i in 0..5000 {
+        heap.update(i);
+    }
+    let mut buf = heap.serialize_updatable();
+
+    let mut direct = DirectHllSketch::wrap(&mut buf).unwrap();
+    assert_eq!(direct.lg_config_k(), 8);
+    assert_eq!(direct.estimate(), heap.estimate());
+    for i in 5000..10_000 {
+        direct.update(i);
+        heap.update(i);
+    }
+    assert_eq!(direct.estimate(), heap.estimate());
+
+    let wrapped = HllSketch::wrap(&buf).unwrap();
+    assert_eq!(wrapped.estimate(), heap.estimate());
+    let mut union = HllUnion::new(8);
+    union.update_wrapped(&wrapped);
+    assert_eq!(
+        union.to_sketch(HllType::Hll8).composite_estimate(),
+        heap.composite_estimate()
+    );
+}
+
+#[test]
+fn test_invalid_buffers() {
+    let required = DirectHllSketch::required_size_bytes(10, HllType::Hll8);
+    assert_eq!(required, 40 + 1024);
+
+    let mut small = vec![0u8; required - 1];
+    let err = DirectHllSketch::new(&mut small, 10, HllType::Hll8).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidArgument);
+
+    let mut buf = vec![0u8; required];
+    DirectHllSketch::new(&mut buf, 10, HllType::Hll8).unwrap();
+    let err = DirectHllSketch::wrap(&mut buf[..required - 1]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    // A zero count that disagrees with the registers would underflow on the next update.
+    let mut miscounted = buf.clone();
+    miscounted[32..36].copy_from_slice(&0u32.to_le_bytes());
+    let err = DirectHllSketch::wrap(&mut miscounted).unwrap_err();
+    assert!(err.message().contains("zero registers"), "{err}");
+
+    // List mode images have no registers to update in place.
+    let mut list = HllSketch::new(10, HllType::Hll8).serialize_updatable();
+    let err = DirectHllSketch::wrap(&mut list).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut hll4 = HllSketch::new(4, HllType::Hll4);
+    for i in 0..1000 {
+        hll4.update(i);
+    }
+    let mut hll4 = hll4.serialize_updatable();
+    let err = DirectHllSketch::wrap(&mut hll4).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+}
+
+#[test]
+#[should_panic(expected = "direct HLL sketches support only Hll6 and Hll8")]
+fn test_hll4_is_rejected() {
+    DirectHllSketch::required_size_bytes(10, HllType::Hll4);
+}
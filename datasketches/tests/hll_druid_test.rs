@@ -0,0 +1,164 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "hll")]
+
+use datasketches::error::ErrorKind;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+use datasketches::hll::druid;
+
+fn sketch_of(range: std::ops::Range<u64>, hll_type: HllType) -> HllSketch {
+    let mut sketch = HllSketch::new(druid::DEFAULT_LG_K, hll_type);
+    sketch.extend(range);
+    sketch
+}
+
+/// Assembles a column field by field, to check the writer against the layout.
+fn column_of(rows: &[(i32, &[u8])]) -> Vec<u8> {
+    let mut offsets = Vec::new();
+    let mut values = Vec::new();
+    for (marker, image) in rows {
+        values.extend_from_slice(&marker.to_be_bytes());
+        values.extend_from_slice(image);
+        offsets.extend_from_slice(&(values.len() as u32).to_be_bytes());
+    }
+    let mut column = vec![0x01, 0x00];
+    column.extend_from_slice(&((4 + offsets.len() + values.len()) as u32).to_be_bytes());
+    column.extend_from_slice(&(rows.len() as u32).to_be_bytes());
+    column.extend_from_slice(&offsets);
+    column.extend_from_slice(&values);
+    column
+}
+
+#[test]
+fn test_column_layout() {
+    let empty = HllSketch::new(druid::DEFAULT_LG_K, druid::DEFAULT_HLL_TYPE);
+    let small = sketch_of(0..10, HllType::Hll4);
+    let large = sketch_of(0..100_000, HllType::Hll6);
+    let column = druid::write_column([Some(&empty), None, Some(&small), Some(&large)]);
+    assert_eq!(
+        column,
+        column_of(&[
+            (0, &empty.serialize()),
+            (-1, &[]),
+            (0, &small.serialize()),
+            (0, &large.serialize()),
+        ])
+    );
+
+    // an empty sketch is not a null row
+    let rows = druid::read_column(&column).unwrap();
+    assert_eq!(rows, [Some(empty), None, Some(small), Some(large)]);
+    assert!(rows[0].as_ref().unwrap().is_empty());
+
+    assert_eq!(druid::write_column([]), [1, 0, 0, 0, 0, 4, 0, 0, 0, 0]);
+    assert!(
+        druid::read_column(&druid::write_column([]))
+            .unwrap()
+            .is_empty()
+    );
+}
+
+#[test]
+fn test_legacy_null_rows() {
+    // older segments wrote null rows without the -1 marker
+    let sketch = sketch_of(0..1000, HllType::Hll8);
+    let column = column_of(&[(0, &[]), (0, &sketch.serialize()), (0, &[])]);
+    assert_eq!(
+        druid::read_column(&column).unwrap(),
+        [None, Some(sketch), None]
+    );
+
+    assert_eq!(druid::read_value(&[]).unwrap(), None);
+    assert!(druid::write_value(None).is_empty());
+    let sketch = sketch_of(0..10, HllType::Hll4);
+    assert_eq!(
+        druid::read_value(&druid::write_value(Some(&sketch))).unwrap(),
+        Some(sketch)
+    );
+}
+
+#[test]
+fn test_trailing_bytes_are_ignored() {
+    let sketch = sketch_of(0..1000, HllType::Hll4);
+    let mut column = druid::write_column([Some(&sketch)]);
+    column.extend_from_slice(&[0xFF; 16]);
+    assert_eq!(druid::read_column(&column).unwrap(), [Some(sketch)]);
+}
+
+#[test]
+fn test_malformed_columns() {
+    let sketch = sketch_of(0..1000, HllType::Hll4);
+    let column = druid::write_column([Some(&sketch), None]);
+
+    for len in 0..column.len() {
+        let err = druid::column_values(&column[..len]).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidData, "{err}");
+    }
+
+    for version in [0, 2, 3] {
+        let mut corrupt = column.clone();
+        corrupt[0] = version;
+        assert!(druid::column_values(&corrupt).is_err());
+    }
+
+    // an offset past the values, and one before the end of the previous row
+    let mut corrupt = column.clone();
+    corrupt[10..14].copy_from_slice(&u32::MAX.to_be_bytes());
+    assert!(druid::column_values(&corrupt).is_err());
+    let mut corrupt = column.clone();
+    corrupt[14..18].copy_from_slice(&2u32.to_be_bytes());
+    assert!(druid::column_values(&corrupt).is_err());
+
+    // a row count the column cannot hold
+    let mut corrupt = column.clone();
+    corrupt[6..10].copy_from_slice(&u32::MAX.to_be_bytes());
+    assert!(druid::column_values(&corrupt).is_err());
+
+    // a row that is not an HLL image
+    let column = column_of(&[(0, &[1, 2, 3])]);
+    assert!(druid::column_values(&column).is_ok());
+    assert!(druid::read_column(&column).is_err());
+}
+
+#[test]
+fn test_merge() {
+    let left = sketch_of(0..50_000, HllType::Hll4);
+    let right = sketch_of(25_000..75_000, HllType::Hll8);
+    let column = druid::write_column([Some(&left), None, Some(&right)]);
+
+    let merged = druid::merge(
+        druid::column_values(&column).unwrap(),
+        druid::DEFAULT_LG_K,
+        druid::DEFAULT_HLL_TYPE,
+    )
+    .unwrap();
+    let mut union = HllUnion::new(druid::DEFAULT_LG_K);
+    union.update(&left);
+    union.update(&right);
+    assert_eq!(merged, union.to_sketch(druid::DEFAULT_HLL_TYPE));
+    assert_eq!(merged.target_type(), HllType::Hll4);
+
+    // only null rows merge into an empty sketch
+    let merged = druid::merge([None, Some(&[][..])], 10, HllType::Hll8).unwrap();
+    assert!(merged.is_empty());
+    assert_eq!(merged.lg_config_k(), 10);
+
+    assert!(druid::merge([Some(&[1, 2, 3][..])], 12, HllType::Hll4).is_err());
+}
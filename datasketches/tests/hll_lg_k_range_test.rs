@@ -0,0 +1,207 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Tests over the whole lg_k range, `[4, 21]`, with the focus on both extremes.
+
+#![cfg(feature = "hll")]
+
+use std::collections::HashSet;
+
+use datasketches::common::NumStdDev;
+use datasketches::hll::Coupon;
+use datasketches::hll::DirectHllSketch;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+
+const MIN_LG_K: u8 = 4;
+const MAX_LG_K: u8 = 21;
+const TYPES: [HllType; 3] = [HllType::Hll4, HllType::Hll6, HllType::Hll8];
+
+/// The `Current Mode` line of the sketch summary.
+fn mode(sketch: &HllSketch) -> String {
+    let summary = sketch.to_string();
+    let line = summary
+        .lines()
+        .find(|line| line.trim_start().starts_with("Current Mode"))
+        .unwrap();
+    line.split(':').nth(1).unwrap().trim().to_string()
+}
+
+/// The number of coupons after which a sketch leaves Set mode, as in Java and C++: the set
+/// starts at 32 slots and promotes once it would grow past `k / 8` slots at 3/4 load.
+fn set_capacity(lg_k: u8) -> u64 {
+    3 << (lg_k - 5)
+}
+
+/// Enough distinct items to put a sketch of any size well into HLL mode.
+fn hll_mode_len(lg_k: u8) -> u64 {
+    (1 << lg_k >> 2).max(64)
+}
+
+/// Coupons of distinct values, skipping the values whose coupon collides with an earlier one
+/// so that promotions happen at exact counts.
+fn distinct_coupons(count: u64) -> Vec<Coupon> {
+    let mut seen = HashSet::new();
+    (0..)
+        .map(Coupon::from_hash)
+        .filter(|coupon| seen.insert((coupon.slot(), coupon.value())))
+        .take(count as usize)
+        .collect()
+}
+
+fn assert_within_bounds(sketch: &HllSketch, n: u64) {
+    let n = n as f64;
+    let lower_bound = sketch.lower_bound(NumStdDev::Three);
+    let upper_bound = sketch.upper_bound(NumStdDev::Three);
+    assert!(
+        lower_bound <= n && n <= upper_bound,
+        "lg_k {} {:?}: {n} outside [{lower_bound}, {upper_bound}]",
+        sketch.lg_config_k(),
+        sketch.target_type()
+    );
+}
+
+#[test]
+fn test_mode_transitions() {
+    for lg_k in MIN_LG_K..=MAX_LG_K {
+        let last = if lg_k < 8 { 8 } else { set_capacity(lg_k) + 1 };
+        let coupons = distinct_coupons(last);
+        let mut sketch = HllSketch::new(lg_k, HllType::Hll8);
+        for &coupon in &coupons[..7] {
+            sketch.update_with_coupon(coupon);
+        }
+        assert_eq!(mode(&sketch), "LIST", "lg_k {lg_k}");
+        sketch.update_with_coupon(coupons[7]);
+        if lg_k < 8 {
+            // the list promotes straight to an array when k / 8 slots would not fit it
+            assert_eq!(mode(&sketch), "HLL", "lg_k {lg_k}");
+            continue;
+        }
+        assert_eq!(mode(&sketch), "SET", "lg_k {lg_k}");
+        for &coupon in &coupons[8..coupons.len() - 1] {
+            sketch.update_with_coupon(coupon);
+        }
+        assert_eq!(mode(&sketch), "SET", "lg_k {lg_k}");
+        sketch.update_with_coupon(coupons[coupons.len() - 1]);
+        assert_eq!(mode(&sketch), "HLL", "lg_k {lg_k}");
+    }
+}
+
+#[test]
+fn test_coupon_mode_estimates() {
+    for lg_k in MIN_LG_K..=MAX_LG_K {
+        let last = if lg_k < 8 { 7 } else { set_capacity(lg_k) };
+        let mut sketch = HllSketch::new(lg_k, HllType::Hll4);
+        for n in 1..=last {
+            sketch.update(n);
+            if n.is_power_of_two() || n == last {
+                // the estimate corrects for the coupons that distinct values share
+                let estimate = sketch.estimate();
+                assert!(
+                    (estimate - n as f64).abs() <= 1e-3 * n as f64,
+                    "lg_k {lg_k}: estimate {estimate} for {n} values"
+                );
+                assert_within_bounds(&sketch, n);
+            }
+        }
+    }
+}
+
+#[test]
+fn test_estimate_and_round_trip() {
+    for lg_k in MIN_LG_K..=MAX_LG_K {
+        let n = hll_mode_len(lg_k);
+        for hll_type in TYPES {
+            let mut sketch = HllSketch::new(lg_k, hll_type);
+            sketch.extend(0..n);
+            assert_eq!(mode(&sketch), "HLL", "lg_k {lg_k} {hll_type:?}");
+            assert_within_bounds(&sketch, n);
+
+            for bytes in [sketch.serialize(), sketch.serialize_updatable()] {
+                let restored = HllSketch::deserialize(&bytes).unwrap();
+                assert_eq!(restored.lg_config_k(), lg_k);
+                assert_eq!(restored.target_type(), hll_type);
+                assert_eq!(restored.estimate(), sketch.estimate(), "lg_k {lg_k}");
+
+                let wrapped = HllSketch::wrap(&bytes).unwrap();
+                assert_eq!(wrapped.lg_config_k(), lg_k);
+                assert_eq!(wrapped.estimate(), sketch.estimate(), "lg_k {lg_k}");
+            }
+        }
+    }
+}
+
+#[test]
+fn test_direct_at_extremes() {
+    for lg_k in [MIN_LG_K, MAX_LG_K] {
+        let n = hll_mode_len(lg_k);
+        let mut heap = HllSketch::new(lg_k, HllType::Hll8);
+        heap.extend(0..n);
+
+        let mut bytes = vec![0; DirectHllSketch::required_size_bytes(lg_k, HllType::Hll8)];
+        let mut direct = DirectHllSketch::new(&mut bytes, lg_k, HllType::Hll8).unwrap();
+        for i in 0..n {
+            direct.update(i);
+        }
+        // a direct sketch starts in HLL mode, so only the registers match the heap sketch
+        let direct = direct.to_sketch();
+        assert_eq!(direct.lg_config_k(), lg_k);
+        assert_eq!(
+            direct.composite_estimate(),
+            heap.composite_estimate(),
+            "lg_k {lg_k}"
+        );
+        assert_within_bounds(&direct, n);
+    }
+}
+
+#[test]
+fn test_union_across_extremes() {
+    let mut smallest = HllSketch::new(MIN_LG_K, HllType::Hll4);
+    smallest.extend(0..hll_mode_len(MIN_LG_K));
+    let mut largest = HllSketch::new(MAX_LG_K, HllType::Hll4);
+    let n = hll_mode_len(MAX_LG_K);
+    largest.extend(0..n);
+
+    // a union keeps the largest lg_k it can
+    let mut union = HllUnion::new(MAX_LG_K);
+    union.update(&largest);
+    assert_eq!(union.lg_config_k(), MAX_LG_K);
+    let result = union.to_sketch(HllType::Hll4);
+    assert_eq!(result.estimate(), largest.estimate());
+
+    // and drops to the smallest input
+    union.update(&smallest);
+    assert_eq!(union.lg_config_k(), MIN_LG_K);
+    assert_within_bounds(&union.to_sketch(HllType::Hll8), n);
+
+    // or to lg_max_k
+    let mut union = HllUnion::new(MIN_LG_K);
+    union.update(&largest);
+    assert_eq!(union.lg_config_k(), MIN_LG_K);
+    assert_within_bounds(&union.to_sketch(HllType::Hll6), n);
+
+    // coupons from the smallest configuration can seed the largest
+    let mut sparse = HllSketch::new(MIN_LG_K, HllType::Hll8);
+    sparse.extend(0..5);
+    let mut union = HllUnion::new(MAX_LG_K);
+    union.update(&sparse);
+    union.update(&largest);
+    assert_eq!(union.lg_config_k(), MAX_LG_K);
+    assert_within_bounds(&union.to_sketch(HllType::Hll8), n);
+}
@@ -0,0 +1,145 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "hll")]
+
+use datasketches::common::NumStdDev;
+use datasketches::error::ErrorKind;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+
+const TYPES: [HllType; 3] = [HllType::Hll4, HllType::Hll6, HllType::Hll8];
+
+#[test]
+fn test_round_trip_in_every_mode() {
+    // list, set and HLL mode of an lg_k 10 sketch
+    for n in [0, 5, 200, 20_000] {
+        for source_type in TYPES {
+            let mut source = HllSketch::new(10, source_type);
+            source.extend(0..n);
+            let registers = source.to_registers();
+            assert_eq!(registers.len(), 1024);
+            assert!(registers.iter().filter(|&&value| value > 0).count() <= n as usize);
+
+            for target_type in TYPES {
+                let import = HllSketch::from_registers(10, &registers, target_type).unwrap();
+                let sketch = import.sketch;
+                assert_eq!(sketch.target_type(), target_type);
+                assert_eq!(sketch.lg_config_k(), 10);
+                assert!(sketch.is_out_of_order());
+                assert_eq!(sketch.to_registers(), registers, "n={n} {target_type:?}");
+                assert_eq!(sketch.is_empty(), n == 0);
+            }
+        }
+    }
+}
+
+#[test]
+fn test_hll4_exceptions_are_exported() {
+    // values 15 or more above the smallest register go to the aux map of an HLL4 sketch
+    let mut registers = vec![1u8; 1 << 8];
+    registers[3] = 40;
+    registers[200] = 63;
+    let sketch = HllSketch::from_registers(8, &registers, HllType::Hll4)
+        .unwrap()
+        .sketch;
+    assert_eq!(sketch.to_registers(), registers);
+
+    let copy = HllSketch::deserialize(&sketch.serialize()).unwrap();
+    assert_eq!(copy.to_registers(), registers);
+}
+
+#[test]
+fn test_estimate_within_reported_error() {
+    for n in [1_000u64, 100_000, 1_000_000] {
+        let mut source = HllSketch::new(14, HllType::Hll8);
+        source.extend(0..n);
+        let import = HllSketch::from_registers(14, &source.to_registers(), HllType::Hll4).unwrap();
+        assert_eq!(
+            import.rel_std_err,
+            HllSketch::rel_err(true, true, 14, NumStdDev::One).abs()
+        );
+        assert!(import.rel_std_err > 0.0 && import.rel_std_err < 0.01);
+
+        let estimate = import.sketch.estimate();
+        let error = (estimate - n as f64).abs() / n as f64;
+        assert!(
+            error < 3.0 * import.rel_std_err,
+            "n={n} estimate={estimate}"
+        );
+        // the imported sketch estimates from its registers, as the source does once merged
+        assert_eq!(import.sketch.hip_estimate(), None);
+        if n >= 100_000 {
+            assert_eq!(
+                import.sketch.composite_estimate(),
+                source.composite_estimate()
+            );
+        }
+    }
+}
+
+#[test]
+fn test_imports_of_one_source_merge() {
+    let mut left = HllSketch::new(12, HllType::Hll6);
+    left.extend(0..60_000);
+    let mut right = HllSketch::new(12, HllType::Hll6);
+    right.extend(40_000..100_000);
+
+    let mut union = HllUnion::new(12);
+    for source in [&left, &right] {
+        let import = HllSketch::from_registers(12, &source.to_registers(), HllType::Hll8).unwrap();
+        union.update(&import.sketch);
+    }
+    let merged = union.to_sketch(HllType::Hll8);
+
+    let mut direct = HllUnion::new(12);
+    direct.update(&left);
+    direct.update(&right);
+    assert_eq!(
+        merged.to_registers(),
+        direct.to_sketch(HllType::Hll8).to_registers()
+    );
+    let error = (merged.estimate() - 100_000.0).abs() / 100_000.0;
+    assert!(error < 3.0 * HllSketch::rel_err(true, true, 12, NumStdDev::One).abs());
+}
+
+#[test]
+fn test_redis_like_registers() {
+    // a dense Redis HLL: 2^14 registers of at most 51, from 50 hash bits past the index
+    let registers: Vec<u8> = (0..1u32 << 14)
+        .map(|slot| 1 + (slot.wrapping_mul(2_654_435_761) >> 27) as u8 % 4)
+        .collect();
+    let import = HllSketch::from_registers(14, &registers, HllType::Hll4).unwrap();
+    assert_eq!(import.sketch.to_registers(), registers);
+    assert!(import.sketch.estimate() > 16_384.0);
+    assert!(HllSketch::from_registers(14, &vec![51; 1 << 14], HllType::Hll4).is_ok());
+}
+
+#[test]
+fn test_invalid_registers() {
+    for (lg_k, len) in [(3, 8), (22, 16), (10, 1023), (10, 1025), (10, 0)] {
+        let err = HllSketch::from_registers(lg_k, &vec![0; len], HllType::Hll8).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidArgument, "{err}");
+    }
+
+    let mut registers = vec![0u8; 16];
+    registers[7] = 64;
+    let err = HllSketch::from_registers(4, &registers, HllType::Hll6).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidArgument);
+    assert!(err.message().contains("register 7"), "{err}");
+}
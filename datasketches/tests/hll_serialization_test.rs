@@ -26,6 +26,7 @@ use common::serialization_test_data;
 use datasketches::hash_value::natural_extend;
 use datasketches::hll::HllSketch;
 use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
 
 fn test_sketch_file(path: PathBuf, expected_cardinality: usize, expected_lg_k: u8) {
     let expected = expected_cardinality as f64;
@@ -133,6 +134,216 @@ fn test_update_after_deserialize_list_mode() {
     }
 }
 
+#[test]
+fn test_round_trip_preserves_registers() {
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let mut sketch = HllSketch::new(10, hll_type);
+        for i in 0..10_000u64 {
+            sketch.update(i);
+        }
+
+        let decoded = HllSketch::deserialize(&sketch.serialize()).unwrap();
+        assert_eq!(decoded, sketch, "{hll_type:?}");
+    }
+}
+
+#[test]
+fn test_updatable_round_trip() {
+    // List, Set and HLL modes for each target type
+    for n in [0u64, 5, 100, 10_000] {
+        for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+            let mut sketch = HllSketch::new(10, hll_type);
+            for i in 0..n {
+                sketch.update(i);
+            }
+
+            let compact = sketch.serialize();
+            let updatable = sketch.serialize_updatable();
+            assert_eq!(updatable[5] & 8, 0, "{hll_type:?} n={n}: compact flag set");
+
+            let decoded = HllSketch::deserialize(&updatable).unwrap();
+            assert_eq!(decoded, sketch, "{hll_type:?} n={n}");
+            assert_eq!(decoded.serialize(), compact, "{hll_type:?} n={n}");
+            assert_eq!(
+                decoded.serialize_updatable(),
+                updatable,
+                "{hll_type:?} n={n}"
+            );
+        }
+    }
+}
+
+#[test]
+fn test_serialize_as_other_type() {
+    // List, Set and HLL modes, with enough values in HLL mode for HLL4 exceptions
+    for n in [0u64, 5, 100, 10_000, 1_000_000] {
+        let mut sketch = HllSketch::new(10, HllType::Hll8);
+        for i in 0..n {
+            sketch.update(i);
+        }
+
+        for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+            let bytes = sketch.serialize_as(hll_type);
+            assert_eq!(
+                bytes,
+                sketch.copy_as(hll_type).serialize(),
+                "{hll_type:?} n={n}"
+            );
+
+            let decoded = HllSketch::deserialize(&bytes).unwrap();
+            assert_eq!(decoded.target_type(), hll_type, "{hll_type:?} n={n}");
+            assert_eq!(decoded.estimate(), sketch.estimate(), "{hll_type:?} n={n}");
+        }
+        assert_eq!(sketch.target_type(), HllType::Hll8);
+        assert_eq!(sketch.serialize_as(HllType::Hll8), sketch.serialize());
+    }
+}
+
+#[test]
+fn test_serialized_size_bytes() {
+    for lg_k in [4, 8, 12, 21] {
+        for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+            let max_size = HllSketch::max_updatable_serialized_bytes(lg_k, hll_type);
+            let mut sketch = HllSketch::new(lg_k, hll_type);
+            let mut n = 0;
+            // walk through List, Set and HLL mode
+            for target in [0u64, 1, 7, 100, 1000, 10000] {
+                sketch.extend(n..target);
+                n = target;
+                let compact = sketch.serialize();
+                let updatable = sketch.serialize_updatable();
+                assert_eq!(sketch.serialized_size_bytes(), compact.len());
+                assert_eq!(sketch.updatable_serialized_size_bytes(), updatable.len());
+                assert!(
+                    updatable.len() <= max_size,
+                    "lg_k {lg_k} {hll_type:?} n {n}: {} > {max_size}",
+                    updatable.len()
+                );
+            }
+            // in HLL mode, HLL6 and HLL8 images reach the maximum
+            if lg_k <= 12 && hll_type != HllType::Hll4 {
+                assert_eq!(sketch.updatable_serialized_size_bytes(), max_size);
+            }
+        }
+    }
+}
+
+#[test]
+#[should_panic(expected = "lg_config_k must be in [4, 21], got 22")]
+fn test_max_updatable_serialized_bytes_invalid_lg_k() {
+    HllSketch::max_updatable_serialized_bytes(22, HllType::Hll8);
+}
+
+#[test]
+fn test_updatable_coupon_modes_store_whole_table() {
+    let mut sketch = HllSketch::new(12, HllType::Hll8);
+    sketch.update(1u64);
+    // LIST: 8-byte preamble plus 2^3 coupon slots
+    assert_eq!(sketch.serialize().len(), 8 + 4);
+    assert_eq!(sketch.serialize_updatable().len(), 8 + 4 * 8);
+
+    for i in 0..100u64 {
+        sketch.update(i);
+    }
+    // SET: 12-byte preamble plus the whole hash table
+    let updatable = sketch.serialize_updatable();
+    let lg_arr = updatable[4];
+    assert_eq!(updatable.len(), 12 + (4 << lg_arr));
+    assert_eq!(sketch.serialize().len(), 12 + 4 * 100);
+
+    // the restored set keeps accepting updates
+    let mut decoded = HllSketch::deserialize(&updatable).unwrap();
+    for i in 100..200u64 {
+        decoded.update(i);
+        sketch.update(i);
+    }
+    assert_eq!(decoded.estimate(), sketch.estimate());
+}
+
+#[test]
+fn test_empty_list_image_with_coupons() {
+    let mut sketch = HllSketch::new(12, HllType::Hll8);
+    sketch.update(1u64);
+    let bytes = sketch.serialize();
+    assert_eq!(bytes[6], 1);
+
+    // the empty flag contradicts the coupon count
+    let mut corrupt = bytes.clone();
+    corrupt[5] |= 4;
+    assert!(HllSketch::deserialize(&corrupt).is_err());
+}
+
+#[test]
+fn test_updatable_hll4_aux_table_size() {
+    // all but one register are exceptions, so the aux table outgrows the 16 registers
+    let mut registers = vec![20u8; 16];
+    registers[0] = 1;
+    let sketch = HllSketch::from_registers(4, &registers, HllType::Hll4)
+        .unwrap()
+        .sketch;
+    let bytes = sketch.serialize_updatable();
+    assert_eq!(bytes[4], 5);
+    assert_eq!(
+        HllSketch::deserialize(&bytes).unwrap().to_registers(),
+        registers
+    );
+
+    // a table size past that, up to one the shift cannot hold, is rejected
+    for lg_arr in [6, 26, 31, 32, 255] {
+        let mut corrupt = bytes.clone();
+        corrupt[4] = lg_arr;
+        assert!(HllSketch::deserialize(&corrupt).is_err(), "lg_arr {lg_arr}");
+    }
+}
+
+#[test]
+fn test_hll_mode_images_with_invalid_registers() {
+    let k = 1u32 << 10;
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let mut sketch = HllSketch::new(10, hll_type);
+        sketch.extend(0..20_000);
+        let bytes = sketch.serialize();
+
+        // more registers at cur_min than the sketch has
+        let mut corrupt = bytes.clone();
+        corrupt[32..36].copy_from_slice(&(k + 1).to_le_bytes());
+        assert!(HllSketch::deserialize(&corrupt).is_err(), "{hll_type:?}");
+    }
+
+    // a cur_min that is no register value, or that offsets the 4-bit values past the largest
+    let mut sketch = HllSketch::new(10, HllType::Hll4);
+    sketch.extend(0..20_000);
+    let bytes = sketch.serialize();
+    for cur_min in [255, 64, 63] {
+        let mut corrupt = bytes.clone();
+        corrupt[6] = cur_min;
+        assert!(
+            HllSketch::deserialize(&corrupt).is_err(),
+            "cur_min {cur_min}"
+        );
+    }
+
+    // an HLL8 register holding more than 6 bits
+    let mut sketch = HllSketch::new(10, HllType::Hll8);
+    sketch.extend(0..20_000);
+    let mut corrupt = sketch.serialize();
+    corrupt[40] = 64;
+    assert!(HllSketch::deserialize(&corrupt).is_err());
+
+    // an HLL4 aux map listing a slot twice
+    let mut registers = vec![1u8; 1 << 8];
+    registers[3] = 40;
+    registers[200] = 50;
+    let sketch = HllSketch::from_registers(8, &registers, HllType::Hll4)
+        .unwrap()
+        .sketch;
+    let mut corrupt = sketch.serialize();
+    let aux_start = 40 + (1 << 7);
+    assert_eq!(corrupt.len(), aux_start + 8);
+    corrupt.copy_within(aux_start..aux_start + 4, aux_start + 4);
+    assert!(HllSketch::deserialize(&corrupt).is_err());
+}
+
 #[test]
 fn test_serialized_bytes_match_reference_files_for_coupon_modes() {
     fn serialized_mode_name(bytes: &[u8]) -> &'static str {
@@ -188,6 +399,45 @@ fn test_serialized_bytes_match_reference_files_for_coupon_modes() {
     }
 }
 
+#[test]
+fn test_union_of_reference_files_matches_rust_union() {
+    // Unions mixing modes: List with HLL, Set with HLL, and two HLL sketches
+    let input_pairs = [(1_u32, 10_000_u32), (100, 100_000), (1000, 100_000)];
+
+    for type_name in ["hll4", "hll6", "hll8"] {
+        for (n1, n2) in input_pairs {
+            let mut rust_union = HllUnion::new(12);
+            for n in [n1, n2] {
+                let mut sketch = HllSketch::new(12, HllType::Hll8);
+                for value in 0..n {
+                    sketch.update(natural_extend::from_u32(value));
+                }
+                rust_union.update(&sketch);
+            }
+            let expected = rust_union.to_sketch(HllType::Hll8);
+
+            for (dir, suffix) in [
+                ("java_generated_files", "java"),
+                ("cpp_generated_files", "cpp"),
+            ] {
+                let mut union = HllUnion::new(12);
+                for n in [n1, n2] {
+                    let filename = format!("{type_name}_n{n}_{suffix}.sk");
+                    let bytes = fs::read(serialization_test_data(dir, &filename)).unwrap();
+                    union.update(&HllSketch::deserialize(&bytes).unwrap());
+                }
+                let result = union.to_sketch(HllType::Hll8);
+                assert_eq!(
+                    result.serialize(),
+                    expected.serialize(),
+                    "union of {type_name} n{n1} and n{n2} {suffix} sketches"
+                );
+                assert_eq!(result.estimate(), expected.estimate());
+            }
+        }
+    }
+}
+
 #[test]
 fn test_java_hll4_compatibility() {
     let test_cases = [0, 1, 10, 100, 1000, 10000, 100000, 1000000];
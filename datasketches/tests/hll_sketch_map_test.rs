@@ -0,0 +1,221 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "hll")]
+
+use datasketches::error::ErrorKind;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllSketchMap;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+
+const KEYS: u32 = 20;
+
+/// Streams the items over the keys, key `k` seeing the items `i` with `i % KEYS == k`, in
+/// blocks of a thousand items per key as a burst of traffic would.
+fn fill(map: &mut HllSketchMap, items: std::ops::Range<u32>) {
+    let block = KEYS * 1000;
+    for start in items.clone().step_by(block as usize) {
+        let end = (start + block).min(items.end);
+        for k in 0..KEYS {
+            let key = format!("key-{k}");
+            for i in (start..end).filter(|i| i % KEYS == k) {
+                map.update(key.as_bytes(), i);
+            }
+        }
+    }
+}
+
+fn reference(lg_k: u8, items: std::ops::Range<u32>) -> Vec<HllSketch> {
+    let mut sketches = vec![HllSketch::new(lg_k, HllType::Hll8); KEYS as usize];
+    for i in items {
+        sketches[(i % KEYS) as usize].update(i);
+    }
+    sketches
+}
+
+#[test]
+fn test_spilling_keeps_the_budget_and_the_counts() {
+    let budget = 64 * 1024;
+    let mut map = HllSketchMap::new(12, HllType::Hll8, budget);
+    // many passes over the keys, so that spilled keys are restored again
+    fill(&mut map, 0..200_000);
+    assert_eq!(map.num_keys(), KEYS as usize);
+    assert!(map.num_compact() > 0);
+    assert!(map.num_compact() < KEYS as usize);
+    assert!(map.memory_usage_bytes() <= budget);
+
+    for (k, sketch) in reference(12, 0..200_000).iter().enumerate() {
+        let key = format!("key-{k}");
+        assert_eq!(map.estimate(key.as_bytes()), sketch.estimate(), "{key}");
+        let got = map.get(key.as_bytes()).unwrap();
+        assert_eq!(got.target_type(), HllType::Hll8);
+        assert_eq!(got.estimate(), sketch.estimate(), "{key}");
+    }
+    assert_eq!(map.estimate(b"absent"), 0.0);
+    assert!(map.get(b"absent").is_none());
+}
+
+#[test]
+fn test_unbounded_map_never_spills() {
+    let mut map = HllSketchMap::new(12, HllType::Hll6, usize::MAX);
+    fill(&mut map, 0..50_000);
+    assert_eq!(map.num_compact(), 0);
+
+    // the most recently updated sketch stays updatable even beyond the budget
+    let mut tiny = HllSketchMap::new(12, HllType::Hll6, 0);
+    fill(&mut tiny, 0..50_000);
+    assert_eq!(tiny.num_compact(), KEYS as usize - 1);
+    for k in 0..KEYS {
+        let key = format!("key-{k}");
+        assert_eq!(tiny.estimate(key.as_bytes()), map.estimate(key.as_bytes()));
+    }
+}
+
+#[test]
+fn test_rollup_is_the_union_of_all_keys() {
+    let mut map = HllSketchMap::new(11, HllType::Hll8, 24 * 1024);
+    fill(&mut map, 0..100_000);
+    assert!(map.num_compact() > 0);
+
+    let mut union = HllUnion::new(11);
+    for sketch in reference(11, 0..100_000) {
+        union.update(&sketch);
+    }
+    let rollup = map.rollup();
+    assert_eq!(rollup.lg_config_k(), 11);
+    assert_eq!(rollup.target_type(), HllType::Hll8);
+    assert!(rollup.is_equivalent(&union.to_sketch(HllType::Hll8), 1e-9));
+    assert!((rollup.estimate() - 100_000.0).abs() < 100_000.0 * 0.1);
+
+    assert_eq!(
+        HllSketchMap::new(11, HllType::Hll4, 0).rollup().estimate(),
+        0.0
+    );
+}
+
+#[test]
+fn test_merge_key_by_key() {
+    let mut left = HllSketchMap::new(12, HllType::Hll8, 64 * 1024);
+    let mut right = HllSketchMap::new(12, HllType::Hll8, 64 * 1024);
+    let mut whole = HllSketchMap::new(12, HllType::Hll8, usize::MAX);
+    fill(&mut left, 0..60_000);
+    fill(&mut right, 40_000..100_000);
+    right.update(b"right only", 1);
+    fill(&mut whole, 0..100_000);
+
+    left.merge(&right);
+    assert_eq!(left.num_keys(), KEYS as usize + 1);
+    assert_eq!(left.estimate(b"right only"), 1.0);
+    assert!(left.memory_usage_bytes() <= 64 * 1024);
+    for k in 0..KEYS {
+        let key = format!("key-{k}");
+        let expected = whole.estimate(key.as_bytes());
+        let actual = left.estimate(key.as_bytes());
+        assert!((actual - expected).abs() < expected * 0.05, "{key}");
+    }
+
+    // a sketch of a smaller lg_k in HLL mode downsamples its key
+    let mut coarse = HllSketchMap::new(10, HllType::Hll8, usize::MAX);
+    for i in 0..5000 {
+        coarse.update(b"key-0", i);
+    }
+    left.merge(&coarse);
+    assert_eq!(left.get(b"key-0").unwrap().lg_config_k(), 10);
+    assert_eq!(left.get(b"key-1").unwrap().lg_config_k(), 12);
+    let copy = HllSketchMap::deserialize(&left.serialize()).unwrap();
+    assert_eq!(copy.estimate(b"key-0"), left.estimate(b"key-0"));
+}
+
+#[test]
+fn test_serialization_round_trip() {
+    let mut map = HllSketchMap::new(12, HllType::Hll6, 48 * 1024);
+    fill(&mut map, 0..80_000);
+    map.update(b"", "empty key");
+    let bytes = map.serialize();
+    assert_eq!(&bytes[..8], b"DSKHMAP1");
+
+    let copy = HllSketchMap::deserialize(&bytes).unwrap();
+    assert_eq!(copy.lg_k(), 12);
+    assert_eq!(copy.target_type(), HllType::Hll6);
+    assert_eq!(copy.max_bytes(), 48 * 1024);
+    assert_eq!(copy.num_keys(), map.num_keys());
+    assert_eq!(copy.num_compact(), copy.num_keys());
+    assert!(copy.memory_usage_bytes() <= map.memory_usage_bytes());
+    for key in map.keys() {
+        assert_eq!(copy.estimate(key), map.estimate(key));
+    }
+    // the keys are written in order, whatever the state of the sketches
+    assert_eq!(copy.serialize(), bytes);
+
+    // a deserialized map keeps updating from its compact images
+    let mut copy = copy;
+    copy.update(b"key-3", u32::MAX);
+    map.update(b"key-3", u32::MAX);
+    assert_eq!(copy.estimate(b"key-3"), map.estimate(b"key-3"));
+
+    let empty = HllSketchMap::new(4, HllType::Hll4, 0);
+    let copy = HllSketchMap::deserialize(&empty.serialize()).unwrap();
+    assert!(copy.is_empty());
+    assert_eq!(copy.lg_k(), 4);
+}
+
+#[test]
+fn test_invalid_images_are_rejected() {
+    let mut map = HllSketchMap::new(12, HllType::Hll8, usize::MAX);
+    map.update(b"a", 1);
+    map.update(b"b", 2);
+    let bytes = map.serialize();
+
+    for len in [0, 7, 20, bytes.len() - 1] {
+        let err = HllSketchMap::deserialize(&bytes[..len]).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidData, "{len}: {err}");
+    }
+
+    let mut corrupt = bytes.clone();
+    corrupt[0] = b'X';
+    assert!(HllSketchMap::deserialize(&corrupt).is_err());
+
+    let mut corrupt = bytes.clone();
+    corrupt[9] = 5;
+    assert!(HllSketchMap::deserialize(&corrupt).is_err());
+
+    let mut corrupt = bytes.clone();
+    corrupt[8] = 30;
+    assert!(HllSketchMap::deserialize(&corrupt).is_err());
+
+    // the key of the second entry renamed to the first one
+    let mut corrupt = bytes.clone();
+    let at = corrupt
+        .windows(5)
+        .position(|w| w == [1, 0, 0, 0, b'b'])
+        .unwrap();
+    corrupt[at + 4] = b'a';
+    let err = HllSketchMap::deserialize(&corrupt).unwrap_err();
+    assert!(err.message().contains("duplicate"), "{err}");
+
+    // an image of a larger lg_k than the map
+    let mut corrupt = bytes.clone();
+    corrupt[8] = 11;
+    assert!(HllSketchMap::deserialize(&corrupt).is_err());
+}
+
+#[test]
+#[should_panic(expected = "lg_k must be in [4, 21]")]
+fn test_invalid_lg_k() {
+    HllSketchMap::new(22, HllType::Hll8, 0);
+}
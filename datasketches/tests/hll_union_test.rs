@@ -33,6 +33,7 @@ use datasketches::common::NumStdDev;
 use datasketches::hll::HllSketch;
 use datasketches::hll::HllType;
 use datasketches::hll::HllUnion;
+use datasketches::hll::estimate_intersection;
 
 #[test]
 fn test_union_basic_operations() {
@@ -230,6 +231,51 @@ fn test_union_mixed_hll_types() {
     }
 }
 
+#[test]
+fn test_union_result_independent_of_input_types() {
+    const TYPES: [HllType; 3] = [HllType::Hll4, HllType::Hll6, HllType::Hll8];
+    // the first input in HLL mode, the second in List and HLL mode
+    let ranges = [0..20_000u64, 10_000..10_005, 15_000..40_000];
+
+    let union_of = |types: [HllType; 3]| {
+        let mut union = HllUnion::new(12);
+        for (range, hll_type) in ranges.iter().zip(types) {
+            let mut sketch = HllSketch::new(12, hll_type);
+            sketch.extend(range.clone());
+            union.update(&sketch);
+        }
+        union
+    };
+
+    let expected = union_of([HllType::Hll8; 3]).to_sketch(HllType::Hll8);
+    for first in TYPES {
+        for second in TYPES {
+            for third in TYPES {
+                let union = union_of([first, second, third]);
+                for result_type in TYPES {
+                    let result = union.to_sketch(result_type);
+                    assert_eq!(result.target_type(), result_type);
+                    assert_eq!(
+                        result.estimate(),
+                        expected.estimate(),
+                        "{first:?} {second:?} {third:?} into {result_type:?}"
+                    );
+                    // no register value is lost in any representation
+                    assert_eq!(result.copy_as(HllType::Hll8), expected);
+                }
+            }
+        }
+    }
+
+    let hll4 = union_of([HllType::Hll4; 3]).to_sketch(HllType::Hll4);
+    assert_eq!(
+        HllSketch::deserialize(&hll4.serialize())
+            .unwrap()
+            .estimate(),
+        expected.estimate()
+    );
+}
+
 #[test]
 fn test_union_lg_k_handling() {
     // Test multiple downsizing operations: 12 → 10 → 8
@@ -586,3 +632,73 @@ fn test_union_validation() {
     union.reset();
     assert_eq!(union.lg_max_k(), 15, "lg_max_k should persist after reset");
 }
+
+#[test]
+fn test_union_update_bytes_matches_update() {
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let mut expected = HllUnion::new(12);
+        let mut union = HllUnion::new(12);
+        // List, Set and HLL mode sources, at a smaller and a larger lg_k than the union
+        for (lg_k, n) in [(10, 5), (14, 300), (10, 20000), (14, 50000)] {
+            let mut sketch = HllSketch::new(lg_k, hll_type);
+            for i in 0..n {
+                sketch.update(i);
+            }
+            expected.update(&sketch);
+            union.update_bytes(&sketch.serialize()).unwrap();
+            union.update_bytes(&sketch.serialize_updatable()).unwrap();
+        }
+
+        assert_eq!(union.lg_config_k(), expected.lg_config_k());
+        assert_eq!(union.estimate(), expected.estimate(), "{hll_type:?}");
+        assert_eq!(
+            union.to_sketch(HllType::Hll8).serialize(),
+            expected.to_sketch(HllType::Hll8).serialize()
+        );
+    }
+
+    let mut union = HllUnion::new(12);
+    assert!(union.update_bytes(&[]).is_err());
+    assert!(union.update_bytes(&[2, 1, 7, 12]).is_err());
+    assert!(union.is_empty());
+}
+
+#[test]
+fn test_estimate_intersection() {
+    let build = |lg_k: u8, range: std::ops::Range<u64>| {
+        let mut sketch = HllSketch::new(lg_k, HllType::Hll8);
+        sketch.extend(range);
+        sketch
+    };
+
+    // (a, b, true intersection), covering List and HLL modes and mixed lg_k
+    let cases = [
+        (build(12, 0..10), build(12, 5..20), 5.0),
+        (build(12, 0..100_000), build(12, 0..100_000), 100_000.0),
+        (build(12, 0..100_000), build(12, 50_000..150_000), 50_000.0),
+        (build(12, 0..100_000), build(12, 100_000..200_000), 0.0),
+        (build(10, 0..100_000), build(14, 20_000..40_000), 20_000.0),
+    ];
+    for (a, b, expected) in &cases {
+        let interval = estimate_intersection(a, b, NumStdDev::Three);
+        assert!(interval.lower >= 0.0);
+        assert!(interval.lower <= interval.estimate && interval.estimate <= interval.upper);
+        assert!(interval.estimate <= a.estimate().min(b.estimate()));
+        assert!(interval.contains(*expected), "{interval:?} {expected}");
+
+        let swapped = estimate_intersection(b, a, NumStdDev::Three);
+        assert_eq!(swapped, interval);
+    }
+
+    // the bounds of a small overlap of large sets reflect the error of the union
+    let (a, b) = (build(12, 0..1_000_000), build(12, 999_000..2_000_000));
+    let interval = estimate_intersection(&a, &b, NumStdDev::Two);
+    assert!(interval.upper - interval.lower > 10_000.0, "{interval:?}");
+
+    let empty = HllSketch::new(12, HllType::Hll8);
+    let interval = estimate_intersection(&empty, &cases[1].0, NumStdDev::Two);
+    assert_eq!(
+        (interval.lower, interval.estimate, interval.upper),
+        (0.0, 0.0, 0.0)
+    );
+}
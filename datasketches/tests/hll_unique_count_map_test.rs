@@ -0,0 +1,95 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "hll")]
+
+use datasketches::hll::UniqueCountMap;
+
+#[test]
+fn test_empty() {
+    let map = UniqueCountMap::new(8);
+    assert!(map.is_empty());
+    assert_eq!(map.num_keys(), 0);
+    assert_eq!(map.key_size(), 8);
+    assert_eq!(map.estimate(&[0; 8]), 0.0);
+}
+
+#[test]
+fn test_duplicates_do_not_count() {
+    let mut map = UniqueCountMap::new(4);
+    for _ in 0..10 {
+        assert_eq!(map.update(b"only", "apple"), 1.0);
+    }
+    assert_eq!(map.num_keys(), 1);
+    assert_eq!(map.estimate(b"only"), 1.0);
+}
+
+#[test]
+fn test_estimates_across_levels() {
+    // every count exercises a different level of the map, ending in an HLL array
+    let counts = [
+        1u64, 2, 3, 5, 8, 13, 30, 60, 120, 250, 500, 1_000, 10_000, 100_000,
+    ];
+    let mut map = UniqueCountMap::new(8);
+    for round in 0..2 {
+        for (key, &count) in counts.iter().enumerate() {
+            for i in 0..count {
+                map.update(&(key as u64).to_le_bytes(), (key as u64) << 32 | i);
+            }
+        }
+        // the second round repeats the same items and must not change the estimates
+        assert_eq!(map.num_keys(), counts.len(), "round {round}");
+        for (key, &count) in counts.iter().enumerate() {
+            let estimate = map.estimate(&(key as u64).to_le_bytes());
+            let error = (estimate - count as f64).abs() / count as f64;
+            // 4 standard errors of a 1024 register HIP estimator
+            assert!(error < 0.11, "count {count}: estimate {estimate}");
+        }
+    }
+}
+
+#[test]
+fn test_many_keys() {
+    let mut map = UniqueCountMap::new(4);
+    for key in 0..50_000u32 {
+        for item in 0..key % 7 + 1 {
+            map.update(&key.to_le_bytes(), item);
+        }
+    }
+    assert_eq!(map.num_keys(), 50_000);
+    for key in (0..50_000u32).step_by(997) {
+        let count = (key % 7 + 1) as f64;
+        let estimate = map.estimate(&key.to_le_bytes());
+        assert!(
+            (estimate - count).abs() <= 1.0,
+            "key {key}: estimate {estimate}"
+        );
+    }
+    // small keys stay far below the kilobyte of an HLL array per key
+    assert!(map.memory_usage_bytes() < 50_000 * 100);
+
+    map.reset();
+    assert!(map.is_empty());
+    assert_eq!(map.estimate(&7u32.to_le_bytes()), 0.0);
+}
+
+#[test]
+#[should_panic(expected = "key must be 4 bytes long, got 3")]
+fn test_wrong_key_size() {
+    let mut map = UniqueCountMap::new(4);
+    map.update(b"abc", 1);
+}
@@ -17,9 +17,16 @@
 
 #![cfg(feature = "hll")]
 
+use std::hash::Hash;
+
 use datasketches::common::NumStdDev;
+use datasketches::hash::MurmurHash3X64128;
+use datasketches::hll::Coupon;
+use datasketches::hll::FixedHllSketch;
 use datasketches::hll::HllSketch;
+use datasketches::hll::HllSketchBuilder;
 use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
 
 #[test]
 fn test_basic_update() {
@@ -356,3 +363,623 @@ fn test_bounds_empty_sketch() {
     assert!(upper >= 0.0, "Upper bound should be non-negative");
     assert!(lower <= upper, "Lower bound should be <= upper bound");
 }
+
+#[test]
+fn test_estimator_accessors_in_coupon_mode() {
+    let mut sketch = HllSketch::new(12, HllType::Hll4);
+    for i in 0..10 {
+        sketch.update(i);
+    }
+
+    assert_eq!(sketch.composite_estimate(), sketch.estimate());
+    assert_eq!(sketch.hip_estimate(), None);
+    assert_eq!(sketch.raw_estimate(), None);
+    assert!(!sketch.is_out_of_order());
+}
+
+#[test]
+fn test_estimator_accessors_in_hll_mode() {
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let mut sketch = HllSketch::new(10, hll_type);
+        for i in 0..100_000 {
+            sketch.update(i);
+        }
+
+        // A sketch built by sequential updates reports its HIP accumulator
+        assert!(!sketch.is_out_of_order());
+        assert_eq!(sketch.hip_estimate(), Some(sketch.estimate()));
+
+        let composite = sketch.composite_estimate();
+        let raw = sketch.raw_estimate().unwrap();
+        for estimate in [composite, raw] {
+            let relative_error = (estimate / 100_000.0 - 1.0).abs();
+            assert!(relative_error < 0.1, "{hll_type:?}: {estimate}");
+        }
+
+        // A union result is out of order and falls back to the composite estimator
+        let mut other = HllSketch::new(10, hll_type);
+        for i in 50_000..150_000 {
+            other.update(i);
+        }
+        let mut union = HllUnion::new(10);
+        union.update(&sketch);
+        union.update(&other);
+        let merged = union.to_sketch(HllType::Hll8);
+        assert!(merged.is_out_of_order());
+        assert_eq!(merged.hip_estimate(), None);
+        assert_eq!(merged.estimate(), merged.composite_estimate());
+    }
+}
+
+#[test]
+fn test_to_string_summary() {
+    let mut sketch = HllSketch::new(10, HllType::Hll6);
+    let summary = sketch.to_string();
+    assert!(summary.starts_with("### HLL SKETCH SUMMARY:"), "{summary}");
+    assert!(summary.contains("Log Config K   : 10"), "{summary}");
+    assert!(summary.contains("Hll Target     : HLL_6"), "{summary}");
+    assert!(summary.contains("Current Mode   : LIST"), "{summary}");
+    assert!(summary.contains("Coupon Count   : 0"), "{summary}");
+    assert!(summary.ends_with("### END SKETCH SUMMARY\n"), "{summary}");
+
+    for i in 0..20 {
+        sketch.update(i);
+    }
+    assert!(sketch.to_string().contains("Current Mode   : SET"));
+
+    for i in 0..10_000 {
+        sketch.update(i);
+    }
+    let summary = sketch.to_string();
+    assert!(summary.contains("Current Mode   : HLL"), "{summary}");
+    assert!(summary.contains("OutOfOrder Flag: false"), "{summary}");
+    assert!(
+        summary.contains(&format!("Estimate       : {}", sketch.estimate())),
+        "{summary}"
+    );
+    assert!(summary.contains("KxQ0"), "{summary}");
+    assert_eq!(summary, sketch.to_string_with(true, false, false));
+}
+
+#[test]
+fn test_to_string_detail() {
+    let mut sketch = HllSketch::new(4, HllType::Hll4);
+    sketch.update("apple");
+    let detail = sketch.to_string_with(false, true, false);
+    assert!(detail.starts_with("### COUPONS DETAIL:"), "{detail}");
+    // Header plus a single coupon
+    assert_eq!(detail.lines().count(), 3, "{detail}");
+
+    for i in 0..1000 {
+        sketch.update(i);
+    }
+    let detail = sketch.to_string_with(false, true, true);
+    assert!(
+        detail.starts_with("### HLL SKETCH DATA DETAIL:"),
+        "{detail}"
+    );
+    assert!(detail.contains("### HLL SKETCH AUX DETAIL:"), "{detail}");
+    // Header plus one line per register, then the aux header lines
+    let data_lines = detail
+        .lines()
+        .take_while(|line| !line.starts_with("### HLL SKETCH AUX"))
+        .count();
+    assert_eq!(data_lines, 2 + 16, "{detail}");
+
+    assert_eq!(sketch.to_string_with(false, false, false), "");
+}
+
+#[test]
+fn test_copy_as_preserves_registers_and_estimate() {
+    let types = [HllType::Hll4, HllType::Hll6, HllType::Hll8];
+    for src_type in types {
+        for n in [0, 10, 100, 100_000] {
+            let mut sketch = HllSketch::new(11, src_type);
+            for i in 0..n {
+                sketch.update(i);
+            }
+            let registers = sketch.to_string_with(false, true, false);
+
+            for tgt_type in types {
+                let copy = sketch.copy_as(tgt_type);
+                assert_eq!(copy.target_type(), tgt_type);
+                assert_eq!(copy.lg_config_k(), 11);
+                assert_eq!(
+                    copy.estimate(),
+                    sketch.estimate(),
+                    "{src_type:?} -> {tgt_type:?}"
+                );
+                assert_eq!(copy.to_string_with(false, true, false), registers);
+                assert_eq!(copy.copy_as(src_type).estimate(), sketch.estimate());
+            }
+        }
+    }
+}
+
+#[test]
+fn test_copy_as_keeps_out_of_order_flag() {
+    let mut union = HllUnion::new(12);
+    for offset in [0, 30_000] {
+        let mut sketch = HllSketch::new(12, HllType::Hll8);
+        for i in 0..50_000 {
+            sketch.update(i + offset);
+        }
+        union.update(&sketch);
+    }
+    let merged = union.to_sketch(HllType::Hll8);
+    assert!(merged.is_out_of_order());
+
+    for tgt_type in [HllType::Hll4, HllType::Hll6] {
+        let copy = merged.copy_as(tgt_type);
+        assert!(copy.is_out_of_order());
+        assert_eq!(copy.hip_estimate(), None);
+        let relative_diff = (copy.estimate() / merged.estimate() - 1.0).abs();
+        assert!(relative_diff < 1e-9, "{tgt_type:?}: {relative_diff}");
+    }
+}
+
+#[test]
+fn test_reset() {
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        for n in [10, 100, 10_000] {
+            let mut sketch = HllSketch::new(10, hll_type);
+            for i in 0..n {
+                sketch.update(i);
+            }
+            sketch.reset();
+            assert!(sketch.is_empty());
+            assert_eq!(sketch.estimate(), 0.0);
+            assert_eq!(sketch, HllSketch::new(10, hll_type));
+
+            // The sketch is usable again after a reset
+            for i in 0..n {
+                sketch.update(i + n);
+            }
+            let relative_error = (sketch.estimate() / n as f64 - 1.0).abs();
+            assert!(relative_error < 0.1, "{hll_type:?} n={n}");
+        }
+    }
+}
+
+#[test]
+fn test_iter_coupon_modes() {
+    let mut sketch = HllSketch::new(12, HllType::Hll6);
+    assert_eq!(sketch.iter().count(), 0);
+
+    let values = ["apple", "banana", "cherry"];
+    for value in values {
+        sketch.update(value);
+    }
+    let mut actual: Vec<Coupon> = sketch.iter().collect();
+    let mut expected: Vec<Coupon> = values.iter().map(Coupon::from_hash).collect();
+    actual.sort();
+    expected.sort();
+    assert_eq!(actual, expected);
+
+    // Set mode still yields every stored coupon
+    for i in 0..100 {
+        sketch.update(i);
+    }
+    assert_eq!(sketch.iter().count() as f64, sketch.estimate().round());
+}
+
+#[test]
+fn test_iter_hll_mode_yields_non_zero_registers() {
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let mut sketch = HllSketch::new(8, hll_type);
+        for i in 0..200 {
+            sketch.update(i);
+        }
+        let coupons: Vec<Coupon> = sketch.iter().collect();
+        assert!(!coupons.is_empty());
+        assert!(coupons.len() < 256, "some registers should still be zero");
+        assert!(
+            coupons
+                .windows(2)
+                .all(|pair| pair[0].slot() < pair[1].slot())
+        );
+        assert!(coupons.iter().all(|coupon| coupon.value() > 0));
+
+        // Rebuilding a sketch from the registers reproduces them
+        let mut rebuilt = HllSketch::new(8, hll_type);
+        for &coupon in &coupons {
+            rebuilt.update_with_coupon(coupon);
+        }
+        assert_eq!(rebuilt.iter().collect::<Vec<_>>(), coupons);
+    }
+}
+
+#[test]
+fn test_update_hash_matches_update() {
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let mut hashed = HllSketch::new(11, hll_type);
+        let mut direct = HllSketch::new(11, hll_type);
+        for i in 0..10_000_u64 {
+            let mut hasher = MurmurHash3X64128::default();
+            i.hash(&mut hasher);
+            let (lo, hi) = hasher.finish128();
+            hashed.update_hash(lo, hi);
+            direct.update(i);
+        }
+        assert_eq!(hashed.serialize(), direct.serialize());
+    }
+}
+
+#[test]
+fn test_extend_matches_update() {
+    let mut updated = HllSketch::new(12, HllType::Hll8);
+    for i in 0..10_000u64 {
+        updated.update(i);
+    }
+    let mut extended = HllSketch::new(12, HllType::Hll8);
+    extended.extend(0..10_000u64);
+    assert_eq!(extended.serialize(), updated.serialize());
+
+    // borrowed strings hash like owned ones
+    let words = ["apple", "banana", "cherry"];
+    let mut sketch = HllSketch::new(12, HllType::Hll8);
+    sketch.extend(words);
+    let estimate = sketch.estimate();
+    sketch.extend(words.map(String::from));
+    assert_eq!(sketch.estimate(), estimate);
+    assert!((estimate - 3.0).abs() < 0.01);
+}
+
+#[test]
+fn test_builder_defaults() {
+    let sketch = HllSketchBuilder::default().build();
+    assert_eq!(sketch.lg_config_k(), 12);
+    assert_eq!(sketch.target_type(), HllType::Hll4);
+    assert_eq!(sketch, HllSketch::new(12, HllType::Hll4));
+
+    let sketch = HllSketchBuilder::default()
+        .lg_k(21)
+        .hll_type(HllType::Hll6)
+        .build();
+    assert_eq!(sketch, HllSketch::new(21, HllType::Hll6));
+}
+
+#[test]
+#[should_panic(expected = "lg_config_k must be in [4, 21]")]
+fn test_builder_invalid_lg_k_low() {
+    HllSketchBuilder::default().lg_k(3);
+}
+
+#[test]
+#[should_panic(expected = "lg_config_k must be in [4, 21]")]
+fn test_builder_invalid_lg_k_high() {
+    HllSketchBuilder::default().lg_k(22);
+}
+
+#[test]
+fn test_builder_start_full_size() {
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let builder = HllSketchBuilder::default().lg_k(10).hll_type(hll_type);
+        let mut full = builder.clone().start_full_size(true).build();
+        assert!(full.is_empty());
+        assert_eq!(full.estimate(), 0.0);
+        assert_eq!(full.target_type(), hll_type);
+
+        let restored = HllSketch::deserialize(&full.serialize()).unwrap();
+        assert!(restored.is_empty());
+        assert_eq!(restored.estimate(), 0.0);
+
+        // the registers end up as in a sketch promoted from List mode, but the HIP estimate
+        // covers every update
+        let mut promoted = builder.build();
+        full.extend(0..10_000);
+        promoted.extend(0..10_000);
+        assert!(full.hip_estimate().is_some());
+        assert_eq!(full.composite_estimate(), promoted.composite_estimate());
+        let relative_error = (full.estimate() - 10_000.0).abs() / 10_000.0;
+        assert!(relative_error < 0.1, "{hll_type:?}: {}", full.estimate());
+
+        let restored = HllSketch::deserialize(&full.serialize()).unwrap();
+        assert_eq!(restored.estimate(), full.estimate());
+
+        // a few updates are counted exactly, as in List mode
+        let mut full = HllSketchBuilder::default()
+            .hll_type(hll_type)
+            .start_full_size(true)
+            .build();
+        full.extend(0..3);
+        assert!((full.estimate() - 3.0).abs() < 0.01, "{}", full.estimate());
+
+        full.reset();
+        assert_eq!(full, HllSketch::new(12, hll_type));
+    }
+}
+
+#[test]
+fn test_is_equivalent() {
+    for n in [0u64, 5, 100, 20_000] {
+        let mut hll8 = HllSketch::new(11, HllType::Hll8);
+        hll8.extend(0..n);
+        for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+            let mut sketch = HllSketch::new(11, hll_type);
+            sketch.extend(0..n);
+            assert!(sketch.is_equivalent(&hll8, 0.0), "n {n} {hll_type:?}");
+            assert!(hll8.is_equivalent(&sketch, 0.0), "n {n} {hll_type:?}");
+
+            let restored = HllSketch::deserialize(&sketch.serialize()).unwrap();
+            assert!(restored.is_equivalent(&hll8, 0.0), "n {n} {hll_type:?}");
+
+            // the same registers, but another HIP estimate
+            let mut reordered = HllSketch::new(11, hll_type);
+            reordered.extend((0..n).rev());
+            assert!(reordered.is_equivalent(&hll8, 0.05), "n {n} {hll_type:?}");
+        }
+    }
+
+    // a full-size sketch holds the coupons of a List mode sketch in its registers
+    let mut list = HllSketch::new(11, HllType::Hll8);
+    list.extend(0..5);
+    let mut full = HllSketchBuilder::default()
+        .lg_k(11)
+        .hll_type(HllType::Hll8)
+        .start_full_size(true)
+        .build();
+    full.extend(0..5);
+    assert!(!list.is_equivalent(&full, 1.0));
+
+    let mut left = HllSketch::new(11, HllType::Hll8);
+    left.extend(0..20_000);
+    let mut right = left.clone();
+    right.extend(20_000..40_000);
+    assert!(!left.is_equivalent(&right, 1.0));
+    assert!(!left.is_equivalent(&HllSketch::new(12, HllType::Hll8), 1.0));
+
+    // a union result estimates from its registers instead of the HIP accumulator
+    let mut union = HllUnion::new(11);
+    union.update(&left);
+    let merged = union.to_sketch(HllType::Hll8);
+    assert!(!merged.is_equivalent(&left, 0.0));
+    let tolerance = (merged.estimate() - left.estimate()).abs() / left.estimate();
+    assert!(merged.is_equivalent(&left, tolerance * 1.01));
+}
+
+#[test]
+#[should_panic(expected = "tolerance must be non-negative")]
+fn test_is_equivalent_negative_tolerance() {
+    let sketch = HllSketch::new(11, HllType::Hll8);
+    sketch.is_equivalent(&sketch, -1.0);
+}
+
+#[test]
+fn test_estimated_size_within_max() {
+    for lg_k in [4, 8, 12, 16] {
+        for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+            let max_size = HllSketch::max_estimated_size(lg_k, hll_type);
+            let mut sketch = HllSketch::new(lg_k, hll_type);
+            // at small lg_k the coupon list is larger than the registers it promotes to
+            for n in [0, 10, 100, 1_000, 100_000] {
+                sketch.extend(0..n);
+                let size = sketch.estimated_size();
+                assert!(
+                    size <= max_size,
+                    "lg_k {lg_k} {hll_type:?}: {size} > {max_size}"
+                );
+            }
+        }
+    }
+
+    let mut union = HllUnion::new(12);
+    let empty_size = union.estimated_size();
+    let mut sketch = HllSketch::new(12, HllType::Hll4);
+    sketch.extend(0..100_000);
+    union.update(&sketch);
+    assert!(union.estimated_size() > empty_size);
+    let max_size = HllSketch::max_estimated_size(12, HllType::Hll8);
+    assert!(union.estimated_size() <= max_size + size_of::<HllUnion>() - size_of::<HllSketch>());
+}
+
+#[test]
+#[should_panic(expected = "lg_config_k must be in [4, 21]")]
+fn test_max_estimated_size_invalid_lg_k() {
+    HllSketch::max_estimated_size(22, HllType::Hll8);
+}
+
+#[test]
+fn test_rel_err_matches_bounds() {
+    for lg_k in [10, 14] {
+        let mut sketch = HllSketch::new(lg_k, HllType::Hll8);
+        sketch.extend(0..100_000);
+        let hip = sketch.hip_estimate().unwrap();
+        for num_std_dev in [NumStdDev::One, NumStdDev::Two, NumStdDev::Three] {
+            let lower = hip / (1.0 + HllSketch::rel_err(false, false, lg_k, num_std_dev));
+            let upper = hip / (1.0 + HllSketch::rel_err(true, false, lg_k, num_std_dev));
+            assert!((sketch.lower_bound(num_std_dev) - lower).abs() <= 1e-9 * lower);
+            assert!((sketch.upper_bound(num_std_dev) - upper).abs() <= 1e-9 * upper);
+        }
+
+        let mut union = HllUnion::new(lg_k);
+        union.update(&sketch);
+        let merged = union.to_sketch(HllType::Hll8);
+        let estimate = merged.composite_estimate();
+        let upper = estimate / (1.0 + HllSketch::rel_err(true, true, lg_k, NumStdDev::Two));
+        assert!((merged.upper_bound(NumStdDev::Two) - upper).abs() <= 1e-9 * upper);
+    }
+}
+
+#[test]
+fn test_lg_k_for_rel_err() {
+    assert_eq!(HllSketch::lg_k_for_rel_err(1.0, NumStdDev::One), 4);
+    assert_eq!(HllSketch::lg_k_for_rel_err(1e-6, NumStdDev::Three), 21);
+
+    let mut last_lg_k = 4;
+    for rel_err in [0.2, 0.1, 0.05, 0.02, 0.01, 0.005] {
+        for num_std_dev in [NumStdDev::One, NumStdDev::Two, NumStdDev::Three] {
+            let lg_k = HllSketch::lg_k_for_rel_err(rel_err, num_std_dev);
+            for upper_bound in [false, true] {
+                let err = HllSketch::rel_err(upper_bound, true, lg_k, num_std_dev).abs();
+                assert!(err <= rel_err, "lg_k {lg_k}: {err} > {rel_err}");
+            }
+            if num_std_dev == NumStdDev::One {
+                assert!(lg_k >= last_lg_k);
+                last_lg_k = lg_k;
+            }
+        }
+    }
+}
+
+#[test]
+#[should_panic(expected = "rel_err must be positive")]
+fn test_lg_k_for_non_positive_rel_err() {
+    HllSketch::lg_k_for_rel_err(0.0, NumStdDev::Two);
+}
+
+#[test]
+fn test_reconfigure() {
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let full_size = HllSketchBuilder::default()
+            .lg_k(11)
+            .hll_type(hll_type)
+            .start_full_size(true)
+            .build();
+
+        let mut sketch = HllSketch::new(11, hll_type);
+        sketch.extend(0..100_000);
+        let size = sketch.estimated_size();
+        // the registers are kept and zeroed
+        sketch.reconfigure(11, hll_type);
+        assert_eq!(sketch, full_size, "{hll_type:?}");
+        assert!(sketch.estimated_size() <= size);
+        sketch.extend(0..100_000);
+        let mut expected = full_size.clone();
+        expected.extend(0..100_000);
+        assert_eq!(sketch, expected, "{hll_type:?}");
+
+        // a different configuration starts over in List mode
+        sketch.reconfigure(12, hll_type);
+        assert_eq!(sketch, HllSketch::new(12, hll_type));
+        sketch.extend(0..100);
+        sketch.reconfigure(12, hll_type);
+        assert_eq!(sketch, HllSketch::new(12, hll_type));
+    }
+
+    let mut sketch = HllSketch::new(11, HllType::Hll8);
+    sketch.extend(0..100_000);
+    sketch.reconfigure(11, HllType::Hll4);
+    assert_eq!(sketch, HllSketch::new(11, HllType::Hll4));
+}
+
+#[test]
+fn test_snapshot_matches_sketch() {
+    let assert_matches = |sketch: &HllSketch| {
+        let snapshot = sketch.snapshot();
+        assert_eq!(snapshot.lg_config_k(), sketch.lg_config_k());
+        assert_eq!(snapshot.target_type(), sketch.target_type());
+        assert_eq!(snapshot.is_empty(), sketch.is_empty());
+        assert_eq!(snapshot.estimate(), sketch.estimate());
+        assert_eq!(snapshot.composite_estimate(), sketch.composite_estimate());
+        assert_eq!(snapshot.hip_estimate(), sketch.hip_estimate());
+        assert_eq!(snapshot.is_out_of_order(), sketch.is_out_of_order());
+        for num_std_dev in [NumStdDev::One, NumStdDev::Two, NumStdDev::Three] {
+            assert_eq!(
+                snapshot.lower_bound(num_std_dev),
+                sketch.lower_bound(num_std_dev)
+            );
+            assert_eq!(
+                snapshot.upper_bound(num_std_dev),
+                sketch.upper_bound(num_std_dev)
+            );
+        }
+    };
+
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        // List, Set and HLL mode
+        let mut sketch = HllSketch::new(10, hll_type);
+        assert_matches(&sketch);
+        for n in [5, 100, 10_000] {
+            sketch.extend(0..n);
+            assert_matches(&sketch);
+        }
+
+        // an out of order sketch
+        let mut union = HllUnion::new(10);
+        union.update(&sketch);
+        assert_matches(&union.to_sketch(hll_type));
+    }
+}
+
+#[test]
+fn test_snapshot_is_unaffected_by_later_updates() {
+    let mut sketch = HllSketch::new(12, HllType::Hll4);
+    sketch.extend(0..50_000);
+    let snapshot = sketch.snapshot();
+    let estimate = sketch.estimate();
+
+    sketch.extend(50_000..100_000);
+    assert_eq!(snapshot.estimate(), estimate);
+    assert!(sketch.estimate() > snapshot.estimate());
+    assert_ne!(sketch.snapshot(), snapshot);
+}
+
+#[test]
+fn test_fixed_sketch_matches_full_size_sketch() {
+    fn check<const K: usize>(n: u64) {
+        let mut fixed = FixedHllSketch::<K>::new();
+        let lg_k = fixed.lg_config_k();
+        assert_eq!(1 << lg_k, K);
+        let mut heap = HllSketchBuilder::default()
+            .lg_k(lg_k)
+            .hll_type(HllType::Hll8)
+            .start_full_size(true)
+            .build();
+        assert!(fixed.is_empty());
+        assert_eq!(fixed.to_sketch(), heap);
+
+        fixed.extend(0..n);
+        heap.extend(0..n);
+        assert!(!fixed.is_empty());
+        assert_eq!(fixed.to_sketch(), heap);
+        assert_eq!(fixed.estimate(), heap.estimate());
+        assert_eq!(fixed.composite_estimate(), heap.composite_estimate());
+        assert_eq!(
+            fixed.lower_bound(NumStdDev::Two),
+            heap.lower_bound(NumStdDev::Two)
+        );
+        assert_eq!(
+            fixed.upper_bound(NumStdDev::Two),
+            heap.upper_bound(NumStdDev::Two)
+        );
+        let nonzero = fixed.registers().iter().filter(|&&r| r > 0).count();
+        assert_eq!(nonzero, heap.iter().count());
+
+        fixed.reset();
+        assert_eq!(fixed, FixedHllSketch::default());
+    }
+
+    check::<16>(1000);
+    check::<1024>(10_000);
+    check::<4096>(100);
+}
+
+#[test]
+fn test_composite_estimate_cache_follows_updates() {
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let mut left = HllSketch::new(10, hll_type);
+        left.extend(0..3000);
+        let mut right = HllSketch::new(10, hll_type);
+        right.extend(2000..5000);
+        let mut union = HllUnion::new(10);
+        union.update(&left);
+        union.update(&right);
+        let mut sketch = union.to_sketch(hll_type);
+        assert!(sketch.is_out_of_order());
+
+        let cached = sketch.estimate();
+        assert_eq!(sketch.estimate(), cached);
+        sketch.force_recompute();
+        assert_eq!(sketch.estimate(), cached);
+        assert_eq!(sketch.clone(), sketch);
+
+        sketch.extend(5000..20000);
+        let updated = sketch.estimate();
+        assert_ne!(updated, cached);
+        let fresh = HllSketch::deserialize(&sketch.serialize()).unwrap();
+        assert_eq!(updated, fresh.estimate());
+        sketch.force_recompute();
+        assert_eq!(sketch.estimate(), updated);
+    }
+}
@@ -0,0 +1,110 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "hll")]
+
+use datasketches::error::Error;
+use datasketches::error::ErrorKind;
+use datasketches::error::SketchError;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::register_version_reader;
+use datasketches::hll::supported_versions;
+
+fn image_of_version(serial_version: u8) -> (HllSketch, Vec<u8>) {
+    let mut sketch = HllSketch::new(12, HllType::Hll6);
+    sketch.extend(0..5000);
+    let mut bytes = sketch.serialize();
+    bytes[1] = serial_version;
+    (sketch, bytes)
+}
+
+/// Reads a mock version 2, which stores the serial version in the flags byte too.
+fn read_v2(bytes: &[u8]) -> Result<HllSketch, Error> {
+    let mut bytes = bytes.to_vec();
+    bytes[1] = 1;
+    bytes[5] &= !0x80;
+    HllSketch::deserialize(&bytes)
+}
+
+#[test]
+fn test_unknown_versions_are_reported() {
+    // the versions no test of this file registers a reader for
+    for serial_version in [0, 100, u8::MAX] {
+        let (_, bytes) = image_of_version(serial_version);
+        for err in [
+            HllSketch::deserialize(&bytes).unwrap_err(),
+            HllSketch::read_from(&mut &bytes[..]).unwrap_err(),
+        ] {
+            assert_eq!(err.kind(), ErrorKind::UnsupportedVersion);
+            let Some(&SketchError::UnsupportedSerialVersion { expected, actual }) =
+                err.sketch_error()
+            else {
+                panic!("unexpected cause: {err}");
+            };
+            assert_eq!(actual, serial_version);
+            assert!(supported_versions().contains(&expected));
+            assert_eq!(
+                err.message().contains("newer"),
+                serial_version > expected,
+                "{err}"
+            );
+        }
+    }
+}
+
+#[test]
+fn test_registered_reader() {
+    let (sketch, mut bytes) = image_of_version(2);
+    bytes[5] |= 0x80;
+    let err = HllSketch::deserialize(&bytes).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::UnsupportedVersion);
+
+    register_version_reader(2, read_v2).unwrap();
+    assert!(supported_versions().starts_with(&[1, 2]));
+    assert_eq!(HllSketch::deserialize(&bytes).unwrap(), sketch);
+    // the stream reader does not consult the registered readers
+    let err = HllSketch::read_from(&mut &bytes[..]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::UnsupportedVersion);
+
+    // only the images of the HLL family are handed to the reader
+    let mut foreign = bytes.clone();
+    foreign[2] = 3;
+    let err = HllSketch::deserialize(&foreign).unwrap_err();
+    assert!(matches!(
+        err.sketch_error(),
+        Some(SketchError::InvalidFamily { actual: 3, .. })
+    ));
+
+    // the newest supported version now is the registered one
+    let (_, bytes) = image_of_version(3);
+    let err = HllSketch::deserialize(&bytes).unwrap_err();
+    assert_eq!(
+        err.sketch_error(),
+        Some(&SketchError::UnsupportedSerialVersion {
+            expected: 2,
+            actual: 3
+        })
+    );
+    assert!(err.message().contains("newer"), "{err}");
+
+    // neither the native version nor a registered one can be registered again
+    for serial_version in [1, 2] {
+        let err = register_version_reader(serial_version, read_v2).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidArgument);
+    }
+}
@@ -0,0 +1,209 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "hll")]
+
+use datasketches::common::NumStdDev;
+use datasketches::error::SketchError;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+
+const HLL_TYPES: [HllType; 3] = [HllType::Hll4, HllType::Hll6, HllType::Hll8];
+
+// Cardinalities covering the empty, List, Set and HLL modes
+const COUNTS: [usize; 4] = [0, 5, 200, 20000];
+
+fn build_sketch(lg_k: u8, hll_type: HllType, n: usize, offset: usize) -> HllSketch {
+    let mut sketch = HllSketch::new(lg_k, hll_type);
+    for i in 0..n {
+        sketch.update(i + offset);
+    }
+    sketch
+}
+
+fn images(sketch: &HllSketch) -> [Vec<u8>; 2] {
+    [sketch.serialize(), sketch.serialize_updatable()]
+}
+
+#[test]
+fn test_wrap_matches_deserialize() {
+    for hll_type in HLL_TYPES {
+        for n in COUNTS {
+            let sketch = build_sketch(11, hll_type, n, 0);
+            for bytes in images(&sketch) {
+                let wrapped = HllSketch::wrap(&bytes).unwrap();
+                let decoded = HllSketch::deserialize(&bytes).unwrap();
+
+                assert_eq!(wrapped.lg_config_k(), 11);
+                assert_eq!(wrapped.target_type(), hll_type);
+                assert_eq!(wrapped.is_empty(), n == 0);
+                assert_eq!(wrapped.estimate(), decoded.estimate(), "{hll_type:?} n={n}");
+                for num_std_dev in [NumStdDev::One, NumStdDev::Two, NumStdDev::Three] {
+                    assert_eq!(
+                        wrapped.lower_bound(num_std_dev),
+                        decoded.lower_bound(num_std_dev)
+                    );
+                    assert_eq!(
+                        wrapped.upper_bound(num_std_dev),
+                        decoded.upper_bound(num_std_dev)
+                    );
+                }
+            }
+        }
+    }
+}
+
+#[test]
+fn test_wrap_out_of_order_image() {
+    let mut union = HllUnion::new(10);
+    union.update(&build_sketch(10, HllType::Hll8, 5000, 0));
+    union.update(&build_sketch(10, HllType::Hll8, 5000, 2500));
+    let merged = union.to_sketch(HllType::Hll6);
+
+    let bytes = merged.serialize();
+    let wrapped = HllSketch::wrap(&bytes).unwrap();
+    assert_eq!(wrapped.estimate(), merged.estimate());
+    assert_eq!(
+        wrapped.upper_bound(NumStdDev::Two),
+        merged.upper_bound(NumStdDev::Two)
+    );
+}
+
+#[test]
+fn test_union_update_wrapped_matches_update() {
+    for hll_type in HLL_TYPES {
+        for src_lg_k in [8, 10, 12] {
+            let sources: Vec<HllSketch> = COUNTS
+                .iter()
+                .enumerate()
+                .map(|(i, &n)| build_sketch(src_lg_k, hll_type, n, i * 1000))
+                .collect();
+
+            for compact in [true, false] {
+                let mut expected = HllUnion::new(10);
+                let mut actual = HllUnion::new(10);
+                for sketch in &sources {
+                    let bytes = if compact {
+                        sketch.serialize()
+                    } else {
+                        sketch.serialize_updatable()
+                    };
+                    expected.update(&HllSketch::deserialize(&bytes).unwrap());
+                    actual.update_wrapped(&HllSketch::wrap(&bytes).unwrap());
+                }
+
+                assert_eq!(actual.lg_config_k(), expected.lg_config_k());
+                assert_eq!(
+                    actual.to_sketch(HllType::Hll8),
+                    expected.to_sketch(HllType::Hll8),
+                    "{hll_type:?} src_lg_k={src_lg_k} compact={compact}"
+                );
+            }
+        }
+    }
+}
+
+#[test]
+fn test_union_update_wrapped_into_coupon_gadget() {
+    let mut expected = HllUnion::new(12);
+    let mut actual = HllUnion::new(12);
+    let small = build_sketch(12, HllType::Hll8, 10, 0);
+    expected.update(&small);
+    actual.update(&small);
+
+    let large = build_sketch(12, HllType::Hll4, 50000, 0);
+    let bytes = large.serialize();
+    expected.update(&HllSketch::deserialize(&bytes).unwrap());
+    actual.update_wrapped(&HllSketch::wrap(&bytes).unwrap());
+
+    assert_eq!(
+        actual.to_sketch(HllType::Hll8),
+        expected.to_sketch(HllType::Hll8)
+    );
+}
+
+#[test]
+fn test_hll4_exceptions_are_read_in_place() {
+    // While some registers are still zero, a few values beyond 14 land in the aux table.
+    let sketch = build_sketch(16, HllType::Hll4, 50000, 0);
+    let aux_count = u32::from_le_bytes(sketch.serialize()[36..40].try_into().unwrap());
+    assert!(aux_count > 0);
+
+    for bytes in images(&sketch) {
+        let mut expected = HllUnion::new(16);
+        expected.update(&HllSketch::deserialize(&bytes).unwrap());
+        let mut actual = HllUnion::new(16);
+        actual.update_wrapped(&HllSketch::wrap(&bytes).unwrap());
+
+        assert_eq!(
+            actual.to_sketch(HllType::Hll8),
+            expected.to_sketch(HllType::Hll8)
+        );
+    }
+}
+
+#[test]
+fn test_wrap_rejects_invalid_images() {
+    let sketch = build_sketch(10, HllType::Hll6, 20000, 0);
+    let bytes = sketch.serialize();
+
+    let err = HllSketch::wrap(&bytes[..bytes.len() - 1]).unwrap_err();
+    assert!(err.message().contains("insufficient data"), "{err}");
+
+    let err = HllSketch::wrap(&bytes[..6]).unwrap_err();
+    assert!(err.message().contains("insufficient data"), "{err}");
+
+    let mut bad_family = bytes.clone();
+    bad_family[2] = 3;
+    assert!(HllSketch::wrap(&bad_family).is_err());
+
+    let mut bad_lg_k = bytes;
+    bad_lg_k[3] = 22;
+    let err = HllSketch::wrap(&bad_lg_k).unwrap_err();
+    assert!(err.message().contains("lg_k must be in [4, 21]"), "{err}");
+    assert_eq!(
+        err.sketch_error(),
+        Some(&SketchError::LgKOutOfRange {
+            lg_k: 22,
+            min: 4,
+            max: 21
+        })
+    );
+}
+
+#[test]
+fn test_wrap_rejects_out_of_range_registers() {
+    let bytes = build_sketch(10, HllType::Hll4, 20000, 0).serialize();
+    for cur_min in [255, 64, 63] {
+        let mut corrupt = bytes.clone();
+        corrupt[6] = cur_min;
+        assert!(HllSketch::wrap(&corrupt).is_err(), "cur_min {cur_min}");
+        let mut union = HllUnion::new(10);
+        assert!(union.update_bytes(&corrupt).is_err(), "cur_min {cur_min}");
+    }
+
+    let mut corrupt = build_sketch(10, HllType::Hll8, 20000, 0).serialize();
+    corrupt[40] = 64;
+    assert!(HllSketch::wrap(&corrupt).is_err());
+
+    for hll_type in HLL_TYPES {
+        let mut corrupt = build_sketch(10, hll_type, 20000, 0).serialize();
+        corrupt[32..36].copy_from_slice(&1025u32.to_le_bytes());
+        assert!(HllSketch::wrap(&corrupt).is_err(), "{hll_type:?}");
+    }
+}
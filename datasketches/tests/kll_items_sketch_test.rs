@@ -0,0 +1,183 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "kll")]
+
+use datasketches::kll::KllComparator;
+use datasketches::kll::KllItemsSketch;
+use googletest::assert_that;
+use googletest::prelude::near;
+
+// normalized rank error with 99% confidence for k = 200, with some slack for randomness
+const RANK_EPS_FOR_K_200: f64 = 0.02;
+
+#[test]
+fn test_empty() {
+    let sketch = KllItemsSketch::<String>::default();
+    assert!(sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.k(), 200);
+    assert_eq!(sketch.n(), 0);
+    assert_eq!(sketch.num_retained(), 0);
+    assert_eq!(sketch.min_item(), None);
+    assert_eq!(sketch.max_item(), None);
+    assert_eq!(sketch.rank(&"a".to_string(), true), None);
+    assert_eq!(sketch.quantile(0.5, true), None);
+
+    let split_points = ["a".to_string()];
+    assert_eq!(sketch.pmf(&split_points, true), None);
+    assert_eq!(sketch.cdf(&split_points, true), None);
+}
+
+#[test]
+#[should_panic(expected = "k must be at least 8")]
+fn test_k_too_small() {
+    KllItemsSketch::<String>::new(7);
+}
+
+#[test]
+#[should_panic(expected = "split_points must be unique and monotonically increasing")]
+fn test_unsorted_split_points() {
+    let mut sketch = KllItemsSketch::<&str>::default();
+    sketch.update("a");
+    sketch.pmf(&["b", "a"], true);
+}
+
+#[test]
+fn test_exact_mode() {
+    let mut sketch = KllItemsSketch::<String>::default();
+    // zero padding keeps the lexicographic order equal to the numeric one
+    for i in 0..200 {
+        sketch.update(format!("{i:03}"));
+    }
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.num_retained(), 200);
+    assert_eq!(sketch.min_item().map(String::as_str), Some("000"));
+    assert_eq!(sketch.max_item().map(String::as_str), Some("199"));
+    for i in 0..200 {
+        let item = format!("{i:03}");
+        assert_eq!(sketch.rank(&item, false), Some(i as f64 / 200.0));
+        assert_eq!(sketch.rank(&item, true), Some((i + 1) as f64 / 200.0));
+    }
+    assert_eq!(sketch.quantile(0.5, true).as_deref(), Some("099"));
+    assert_eq!(sketch.quantile(0.5, false).as_deref(), Some("100"));
+}
+
+#[test]
+fn test_estimation_mode() {
+    let n = 100_000;
+    let mut sketch = KllItemsSketch::<String>::default();
+    for i in 0..n {
+        sketch.update(format!("{i:06}"));
+    }
+    assert!(sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), n);
+    assert!(sketch.num_retained() < 1000);
+    assert_eq!(sketch.min_item().map(String::as_str), Some("000000"));
+    assert_eq!(sketch.max_item().map(String::as_str), Some("099999"));
+
+    for i in (0..n).step_by(1000) {
+        let rank = sketch.rank(&format!("{i:06}"), true).unwrap();
+        assert_that!(rank, near(i as f64 / n as f64, RANK_EPS_FOR_K_200));
+    }
+    let median: u64 = sketch.quantile(0.5, true).unwrap().parse().unwrap();
+    assert_that!(median as f64 / n as f64, near(0.5, RANK_EPS_FOR_K_200));
+}
+
+#[test]
+fn test_closure_comparator() {
+    // reverse order: the largest number comes first
+    let reverse = |a: &u64, b: &u64| b.cmp(a);
+    let mut sketch = KllItemsSketch::with_comparator(200, reverse);
+    for i in 0..100 {
+        sketch.update(i);
+    }
+    assert_eq!(sketch.min_item(), Some(&99));
+    assert_eq!(sketch.max_item(), Some(&0));
+    assert_eq!(sketch.rank(&99, true), Some(0.01));
+    assert_eq!(sketch.quantile(0.1, true), Some(90));
+    assert_eq!(sketch.cdf(&[50], false), Some(vec![0.49, 1.0]));
+}
+
+#[derive(Debug, Clone)]
+struct Event {
+    name: &'static str,
+    timestamp: u64,
+}
+
+#[derive(Default, Clone, Copy)]
+struct ByTimestamp;
+
+impl KllComparator<Event> for ByTimestamp {
+    fn less(&self, a: &Event, b: &Event) -> bool {
+        a.timestamp < b.timestamp
+    }
+}
+
+#[test]
+fn test_custom_struct() {
+    let mut sketch = KllItemsSketch::<Event, ByTimestamp>::new(100);
+    for (i, name) in ["d", "a", "c", "b"].into_iter().enumerate() {
+        sketch.update(Event {
+            name,
+            timestamp: 40 - 10 * i as u64,
+        });
+    }
+    assert_eq!(sketch.min_item().map(|e| e.name), Some("b"));
+    assert_eq!(sketch.max_item().map(|e| e.name), Some("d"));
+    let probe = Event {
+        name: "probe",
+        timestamp: 25,
+    };
+    assert_eq!(sketch.rank(&probe, true), Some(0.5));
+    assert_eq!(sketch.quantile(0.5, true).map(|e| e.timestamp), Some(20));
+}
+
+#[test]
+fn test_merge() {
+    let n = 10_000;
+    let mut left = KllItemsSketch::<String>::default();
+    let mut right = KllItemsSketch::<String>::new(100);
+    for i in 0..n {
+        left.update(format!("{i:05}"));
+        right.update(format!("{:05}", i + n));
+    }
+    left.merge(&right);
+    assert_eq!(left.n(), 2 * n);
+    assert_eq!(left.k(), 200);
+    assert_eq!(left.min_item().map(String::as_str), Some("00000"));
+    assert_eq!(left.max_item().map(String::as_str), Some("19999"));
+    let median: u64 = left.quantile(0.5, true).unwrap().parse().unwrap();
+    assert_that!(median as f64 / (2 * n) as f64, near(0.5, 0.05));
+}
+
+#[test]
+fn test_merge_closure_comparator() {
+    let order = |a: &i64, b: &i64| a.cmp(b);
+    let mut left = KllItemsSketch::with_comparator(200, order);
+    let mut right = KllItemsSketch::with_comparator(200, order);
+    for i in 0..1000 {
+        left.update(i);
+        right.update(-i);
+    }
+    left.merge(&right);
+    assert_eq!(left.n(), 2000);
+    assert_eq!(left.min_item(), Some(&-999));
+    assert_eq!(left.max_item(), Some(&999));
+    let rank = left.rank(&0, false).unwrap();
+    assert_that!(rank, near(0.5, RANK_EPS_FOR_K_200));
+}
@@ -0,0 +1,378 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "kll")]
+
+mod common;
+
+use std::cmp::Ordering;
+use std::fs;
+use std::path::PathBuf;
+
+use common::serialization_test_data;
+use datasketches::error::ErrorKind;
+use datasketches::kll::KllItemsSketch;
+use datasketches::kll::KllSketch;
+use googletest::assert_that;
+use googletest::prelude::near;
+
+fn test_sketch_file(path: PathBuf, n: u64, check_roundtrip: bool) {
+    let bytes = fs::read(&path).unwrap();
+    let sketch = KllSketch::<f64>::deserialize(&bytes).unwrap();
+
+    let path = path.display();
+    assert_eq!(sketch.n(), n, "filepath: {path}");
+    assert_eq!(sketch.is_empty(), n == 0, "filepath: {path}");
+    assert_eq!(sketch.is_estimation_mode(), n > 200, "filepath: {path}");
+    if n > 0 {
+        assert_eq!(sketch.min_item(), Some(1.0), "filepath: {path}");
+        assert_eq!(sketch.max_item(), Some(n as f64), "filepath: {path}");
+        assert_eq!(sketch.rank(n as f64, true), Some(1.0), "filepath: {path}");
+        assert_that!(
+            sketch.rank((n / 2) as f64, true).unwrap(),
+            near(0.5, 0.02),
+            "filepath: {path}"
+        );
+    }
+
+    if check_roundtrip {
+        assert_eq!(bytes, sketch.serialize(), "filepath: {path}");
+    }
+}
+
+fn test_f32_sketch_file(path: PathBuf, n: u64, check_roundtrip: bool) {
+    let bytes = fs::read(&path).unwrap();
+    let sketch = KllSketch::<f32>::deserialize(&bytes).unwrap();
+
+    let path = path.display();
+    assert_eq!(sketch.n(), n, "filepath: {path}");
+    assert_eq!(sketch.is_empty(), n == 0, "filepath: {path}");
+    assert_eq!(sketch.is_estimation_mode(), n > 200, "filepath: {path}");
+    if n > 0 {
+        assert_eq!(sketch.min_item(), Some(1.0), "filepath: {path}");
+        assert_eq!(sketch.max_item(), Some(n as f32), "filepath: {path}");
+        assert_eq!(sketch.rank(n as f32, true), Some(1.0), "filepath: {path}");
+        assert_that!(
+            sketch.rank((n / 2) as f32, true).unwrap(),
+            near(0.5, 0.02),
+            "filepath: {path}"
+        );
+    }
+
+    if check_roundtrip {
+        assert_eq!(bytes, sketch.serialize(), "filepath: {path}");
+    }
+}
+
+fn test_string_sketch_file(path: PathBuf, n: u64, check_roundtrip: bool) {
+    // the string images hold numbers, ordered numerically rather than lexicographically
+    let numeric_order = |a: &String, b: &String| -> Ordering {
+        let a: u64 = a.trim().parse().unwrap();
+        let b: u64 = b.trim().parse().unwrap();
+        a.cmp(&b)
+    };
+    let bytes = fs::read(&path).unwrap();
+    let sketch = KllItemsSketch::deserialize_with_comparator(&bytes, numeric_order).unwrap();
+
+    let path = path.display();
+    assert_eq!(sketch.n(), n, "filepath: {path}");
+    assert_eq!(sketch.is_empty(), n == 0, "filepath: {path}");
+    assert_eq!(sketch.is_estimation_mode(), n > 200, "filepath: {path}");
+    if n > 0 {
+        let min = sketch.min_item().unwrap();
+        let max = sketch.max_item().unwrap();
+        assert_eq!(min.trim(), "1", "filepath: {path}");
+        assert_eq!(max.trim(), n.to_string(), "filepath: {path}");
+        assert_eq!(sketch.rank(max, true), Some(1.0), "filepath: {path}");
+    }
+
+    if check_roundtrip {
+        assert_eq!(bytes, sketch.serialize(), "filepath: {path}");
+    }
+}
+
+#[test]
+fn test_deserialize_from_java_snapshots() {
+    let ns = [0, 1, 10, 100, 1000, 10_000, 100_000, 1_000_000];
+    for n in ns {
+        let filename = format!("kll_double_n{}_java.sk", n);
+        let path = serialization_test_data("java_generated_files", &filename);
+        test_sketch_file(path, n, false);
+    }
+    for n in ns {
+        let filename = format!("kll_float_n{}_java.sk", n);
+        let path = serialization_test_data("java_generated_files", &filename);
+        test_f32_sketch_file(path, n, false);
+    }
+    for n in ns {
+        let filename = format!("kll_string_n{}_java.sk", n);
+        let path = serialization_test_data("java_generated_files", &filename);
+        test_string_sketch_file(path, n, false);
+    }
+}
+
+#[test]
+fn test_deserialize_from_cpp_snapshots() {
+    let ns = [0, 1, 10, 100, 1000, 10_000, 100_000, 1_000_000];
+    for n in ns {
+        let filename = format!("kll_double_n{}_cpp.sk", n);
+        let path = serialization_test_data("cpp_generated_files", &filename);
+        test_sketch_file(path, n, true);
+    }
+    for n in ns {
+        let filename = format!("kll_float_n{}_cpp.sk", n);
+        let path = serialization_test_data("cpp_generated_files", &filename);
+        test_f32_sketch_file(path, n, true);
+    }
+    for n in ns {
+        let filename = format!("kll_string_n{}_cpp.sk", n);
+        let path = serialization_test_data("cpp_generated_files", &filename);
+        test_string_sketch_file(path, n, true);
+    }
+}
+
+#[test]
+fn test_empty() {
+    let sketch = KllSketch::<f64>::new(100);
+    let bytes = sketch.serialize();
+    assert_eq!(bytes.len(), 8);
+
+    let decoded = KllSketch::<f64>::deserialize(&bytes).unwrap();
+    assert!(decoded.is_empty());
+    assert_eq!(decoded.k(), 100);
+    assert_eq!(decoded.n(), 0);
+    assert_eq!(decoded.min_item(), None);
+    assert_eq!(decoded.max_item(), None);
+}
+
+#[test]
+fn test_single_item() {
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.update(123.0);
+    let bytes = sketch.serialize();
+    assert_eq!(bytes.len(), 16);
+
+    let decoded = KllSketch::<f64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.k(), 200);
+    assert_eq!(decoded.n(), 1);
+    assert_eq!(decoded.num_retained(), 1);
+    assert_eq!(decoded.min_item(), Some(123.0));
+    assert_eq!(decoded.max_item(), Some(123.0));
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_image_byte_order() {
+    // every multi-byte field is little-endian, whatever the byte order of the host
+    #[rustfmt::skip]
+    let image = [
+        5, 1, 15, 0, // preamble ints, serial version, family, flags
+        200, 0, // k
+        8, 0, // m, unused
+        2, 0, 0, 0, 0, 0, 0, 0, // n
+        200, 0, // min k
+        1, 0, // num levels, unused
+        198, 0, 0, 0, // level offsets
+        0, 0, 0, 0, 0, 0, 0xf0, 0x3f, // min item 1.0
+        0, 0, 0, 0, 0, 0, 0, 0x40, // max item 2.0
+        0, 0, 0, 0, 0, 0, 0, 0x40, // items
+        0, 0, 0, 0, 0, 0, 0xf0, 0x3f,
+    ];
+
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.update(1.0);
+    sketch.update(2.0);
+    assert_eq!(sketch.serialize(), image);
+
+    let decoded = KllSketch::<f64>::deserialize(&image).unwrap();
+    assert_eq!(decoded.n(), 2);
+    assert_eq!(decoded.min_item(), Some(1.0));
+    assert_eq!(decoded.max_item(), Some(2.0));
+}
+
+#[test]
+fn test_exact_mode() {
+    let mut sketch = KllSketch::<f64>::default();
+    for i in 0..10 {
+        sketch.update(i as f64);
+    }
+    let bytes = sketch.serialize();
+    // full preamble, one level, min and max, and ten items
+    assert_eq!(bytes.len(), 20 + 4 + 8 * 12);
+
+    let decoded = KllSketch::<f64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.n(), 10);
+    assert_eq!(decoded.num_retained(), 10);
+    assert_eq!(decoded.min_item(), Some(0.0));
+    assert_eq!(decoded.max_item(), Some(9.0));
+    for i in 0..10 {
+        let value = i as f64;
+        assert_eq!(decoded.rank(value, true), sketch.rank(value, true));
+    }
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_estimation_mode() {
+    let mut sketch = KllSketch::<f64>::default();
+    for i in 0..100_000 {
+        sketch.update(i as f64);
+    }
+    let bytes = sketch.serialize();
+
+    let mut decoded = KllSketch::<f64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.n(), sketch.n());
+    assert_eq!(decoded.num_retained(), sketch.num_retained());
+    assert_eq!(decoded.min_item(), sketch.min_item());
+    assert_eq!(decoded.max_item(), sketch.max_item());
+    assert_eq!(decoded.rank(50_000.0, true), sketch.rank(50_000.0, true));
+    assert_eq!(decoded.quantile(0.5, true), sketch.quantile(0.5, true));
+    assert_eq!(decoded.serialize(), bytes);
+
+    // a deserialized sketch keeps accepting updates
+    for i in 100_000..200_000 {
+        decoded.update(i as f64);
+    }
+    assert_eq!(decoded.n(), 200_000);
+    assert_eq!(decoded.max_item(), Some(199_999.0));
+}
+
+#[test]
+fn test_f32_images() {
+    let mut sketch = KllSketch::<f32>::default();
+    assert_eq!(sketch.serialize().len(), 8);
+
+    sketch.update(1.5);
+    let bytes = sketch.serialize();
+    assert_eq!(bytes.len(), 12);
+    let decoded = KllSketch::<f32>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.min_item(), Some(1.5));
+
+    for i in 0..10 {
+        sketch.update(i as f32);
+    }
+    let bytes = sketch.serialize();
+    // full preamble, one level, min and max, and eleven items
+    assert_eq!(bytes.len(), 20 + 4 + 4 * 13);
+
+    for i in 0..100_000 {
+        sketch.update(i as f32);
+    }
+    let bytes = sketch.serialize();
+    let decoded = KllSketch::<f32>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.n(), sketch.n());
+    assert_eq!(decoded.num_retained(), sketch.num_retained());
+    assert_eq!(decoded.min_item(), Some(0.0));
+    assert_eq!(decoded.max_item(), Some(99_999.0));
+    assert_eq!(decoded.quantile(0.5, true), sketch.quantile(0.5, true));
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_deserialize_invalid() {
+    let mut sketch = KllSketch::<f64>::default();
+    for i in 0..1000 {
+        sketch.update(i as f64);
+    }
+    let bytes = sketch.serialize();
+
+    let err = KllSketch::<f64>::deserialize(&bytes[..bytes.len() - 1]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut corrupted = bytes.clone();
+    corrupted[2] = 0; // family id
+    let err = KllSketch::<f64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut corrupted = bytes.clone();
+    corrupted[0] = 2; // preamble ints of an empty or single-item sketch
+    let err = KllSketch::<f64>::deserialize(&corrupted).unwrap_err();
+    assert!(err.message().contains("preamble ints"), "{err}");
+
+    let mut corrupted = bytes.clone();
+    corrupted[6] = 4; // m
+    let err = KllSketch::<f64>::deserialize(&corrupted).unwrap_err();
+    assert!(err.message().contains("m must be 8"), "{err}");
+
+    let mut corrupted = bytes.clone();
+    corrupted[8] = corrupted[8].wrapping_add(1); // n
+    let err = KllSketch::<f64>::deserialize(&corrupted).unwrap_err();
+    assert!(err.message().contains("inconsistent"), "{err}");
+
+    let mut corrupted = bytes;
+    let len = corrupted.len();
+    corrupted[len - 8..].copy_from_slice(&f64::NAN.to_le_bytes()); // last retained item
+    let err = KllSketch::<f64>::deserialize(&corrupted).unwrap_err();
+    assert!(err.message().contains("NaN"), "{err}");
+}
+
+#[test]
+fn test_string_items() {
+    let mut sketch = KllItemsSketch::<String>::default();
+    assert_eq!(sketch.serialize().len(), 8);
+
+    sketch.update("apple".to_string());
+    let bytes = sketch.serialize();
+    // short preamble, then the length-prefixed item
+    assert_eq!(bytes.len(), 8 + 4 + 5);
+    let decoded = KllItemsSketch::<String>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.min_item().map(String::as_str), Some("apple"));
+
+    for i in 0..10_000 {
+        sketch.update(format!("item{i:05}"));
+    }
+    let bytes = sketch.serialize();
+    let decoded = KllItemsSketch::<String>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.n(), sketch.n());
+    assert_eq!(decoded.num_retained(), sketch.num_retained());
+    assert_eq!(decoded.min_item(), sketch.min_item());
+    assert_eq!(decoded.max_item(), sketch.max_item());
+    assert_eq!(decoded.quantile(0.5, true), sketch.quantile(0.5, true));
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_u64_items() {
+    let mut sketch = KllItemsSketch::<u64>::default();
+    for i in 0..1000 {
+        sketch.update(i);
+    }
+    let bytes = sketch.serialize();
+    let decoded = KllItemsSketch::<u64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.n(), 1000);
+    assert_eq!(decoded.min_item(), Some(&0));
+    assert_eq!(decoded.max_item(), Some(&999));
+    assert_eq!(decoded.rank(&500, true), sketch.rank(&500, true));
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_deserialize_invalid_string_items() {
+    let mut sketch = KllItemsSketch::<String>::default();
+    sketch.update("apple".to_string());
+    let bytes = sketch.serialize();
+
+    let err = KllItemsSketch::<String>::deserialize(&bytes[..bytes.len() - 1]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut invalid_utf8 = bytes.clone();
+    let last = invalid_utf8.len() - 1;
+    invalid_utf8[last] = 0xff;
+    let err = KllItemsSketch::<String>::deserialize(&invalid_utf8).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+    assert!(err.message().contains("UTF-8"));
+}
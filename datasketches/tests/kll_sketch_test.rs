@@ -0,0 +1,588 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "kll")]
+
+use datasketches::kll;
+use datasketches::kll::KllSketch;
+use googletest::assert_that;
+use googletest::prelude::near;
+
+// normalized rank error with 99% confidence for k = 200, with some slack for randomness
+const RANK_EPS_FOR_K_200: f64 = 0.02;
+
+#[test]
+fn test_empty() {
+    let sketch = KllSketch::<f64>::default();
+    assert!(sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.k(), 200);
+    assert_eq!(sketch.n(), 0);
+    assert_eq!(sketch.num_retained(), 0);
+    assert_eq!(sketch.min_item(), None);
+    assert_eq!(sketch.max_item(), None);
+    assert_eq!(sketch.rank(0.0, true), None);
+    assert_eq!(sketch.quantile(0.5, true), None);
+
+    let split_points = [0.0];
+    assert_eq!(sketch.pmf(&split_points, true), None);
+    assert_eq!(sketch.cdf(&split_points, true), None);
+}
+
+#[test]
+#[should_panic(expected = "k must be at least 8")]
+fn test_k_too_small() {
+    KllSketch::<f64>::new(7);
+}
+
+#[test]
+fn test_one_item() {
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.update(1.0);
+    assert!(!sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), 1);
+    assert_eq!(sketch.num_retained(), 1);
+    assert_eq!(sketch.min_item(), Some(1.0));
+    assert_eq!(sketch.max_item(), Some(1.0));
+    assert_eq!(sketch.rank(1.0, false), Some(0.0));
+    assert_eq!(sketch.rank(1.0, true), Some(1.0));
+    assert_eq!(sketch.rank(2.0, false), Some(1.0));
+    assert_eq!(sketch.quantile(0.0, true), Some(1.0));
+    assert_eq!(sketch.quantile(0.5, true), Some(1.0));
+    assert_eq!(sketch.quantile(1.0, true), Some(1.0));
+}
+
+#[test]
+fn test_nan_is_ignored() {
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.update(f64::NAN);
+    assert!(sketch.is_empty());
+    sketch.update(0.0);
+    sketch.update(f64::NAN);
+    assert_eq!(sketch.n(), 1);
+}
+
+#[test]
+#[should_panic(expected = "item must not be NaN")]
+fn test_rank_of_nan() {
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.update(1.0);
+    sketch.rank(f64::NAN, true);
+}
+
+#[test]
+#[should_panic(expected = "rank must be in [0.0, 1.0]")]
+fn test_quantile_of_invalid_rank() {
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.update(1.0);
+    sketch.quantile(1.5, true);
+}
+
+#[test]
+#[should_panic(expected = "split_points must be unique and monotonically increasing")]
+fn test_unsorted_split_points() {
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.update(1.0);
+    sketch.cdf(&[2.0, 1.0], true);
+}
+
+#[test]
+fn test_exact_mode() {
+    let n = 200;
+    let mut sketch = KllSketch::<f64>::default();
+    for i in 0..n {
+        sketch.update(i as f64);
+    }
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), n);
+    assert_eq!(sketch.num_retained(), n as usize);
+    assert_eq!(sketch.min_item(), Some(0.0));
+    assert_eq!(sketch.max_item(), Some((n - 1) as f64));
+    assert_eq!(sketch.quantile(0.0, true), Some(0.0));
+    assert_eq!(sketch.quantile(1.0, true), Some((n - 1) as f64));
+
+    for i in 0..n {
+        let value = i as f64;
+        let exclusive_rank = i as f64 / n as f64;
+        let inclusive_rank = (i + 1) as f64 / n as f64;
+        assert_eq!(sketch.rank(value, false), Some(exclusive_rank));
+        assert_eq!(sketch.rank(value, true), Some(inclusive_rank));
+    }
+    assert_eq!(sketch.quantile(0.5, true), Some(99.0));
+    assert_eq!(sketch.quantile(0.5, false), Some(100.0));
+}
+
+#[test]
+fn test_estimation_mode() {
+    let n = 1_000_000u64;
+    let mut sketch = KllSketch::<f64>::default();
+    for i in 0..n {
+        sketch.update(i as f64);
+    }
+    assert!(sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), n);
+    assert!(sketch.num_retained() < n as usize);
+    assert_eq!(sketch.min_item(), Some(0.0));
+    assert_eq!(sketch.max_item(), Some((n - 1) as f64));
+    assert_eq!(sketch.quantile(0.0, true), Some(0.0));
+    assert_eq!(sketch.quantile(1.0, true), Some((n - 1) as f64));
+
+    for i in (0..n).step_by(10_000) {
+        let true_rank = i as f64 / n as f64;
+        assert_that!(
+            sketch.rank(i as f64, false).unwrap(),
+            near(true_rank, RANK_EPS_FOR_K_200)
+        );
+    }
+    for rank in [0.01, 0.25, 0.5, 0.75, 0.99] {
+        let quantile = sketch.quantile(rank, true).unwrap();
+        assert_that!(quantile / n as f64, near(rank, RANK_EPS_FOR_K_200));
+    }
+}
+
+#[test]
+fn test_out_of_order_updates() {
+    let mut sketch = KllSketch::<f64>::default();
+    for value in [5.0, 1.0, 4.0, 2.0, 3.0] {
+        sketch.update(value);
+    }
+    assert_eq!(sketch.min_item(), Some(1.0));
+    assert_eq!(sketch.max_item(), Some(5.0));
+    assert_eq!(sketch.rank(3.0, true), Some(0.6));
+    assert_eq!(sketch.quantile(0.6, true), Some(3.0));
+}
+
+#[test]
+fn test_cdf_and_pmf() {
+    let n = 1000;
+    let mut sketch = KllSketch::<f64>::default();
+    for i in 0..n {
+        sketch.update(i as f64);
+    }
+
+    let split_points = [250.0, 500.0, 750.0];
+    let cdf = sketch.cdf(&split_points, false).unwrap();
+    let pmf = sketch.pmf(&split_points, false).unwrap();
+    assert_eq!(cdf.len(), 4);
+    assert_eq!(pmf.len(), 4);
+    assert_eq!(cdf[3], 1.0);
+    let mut total = 0.0;
+    for i in 0..4 {
+        assert_that!(pmf[i], near(0.25, RANK_EPS_FOR_K_200));
+        total += pmf[i];
+        assert_that!(cdf[i], near(total, 1e-9));
+    }
+
+    // inclusive ranks count the split point itself
+    let inclusive = sketch.cdf(&split_points, true).unwrap();
+    assert!(inclusive.iter().zip(cdf.iter()).all(|(a, b)| a >= b));
+}
+
+#[test]
+fn test_merge() {
+    let n = 10_000;
+    let mut left = KllSketch::<f64>::default();
+    let mut right = KllSketch::<f64>::default();
+    for i in 0..n {
+        left.update(i as f64);
+        right.update((2 * n - i - 1) as f64);
+    }
+
+    left.merge(&right);
+    assert_eq!(left.n(), 2 * n);
+    assert_eq!(left.min_item(), Some(0.0));
+    assert_eq!(left.max_item(), Some((2 * n - 1) as f64));
+    let median = left.quantile(0.5, true).unwrap();
+    assert_that!(median / (2 * n) as f64, near(0.5, RANK_EPS_FOR_K_200));
+}
+
+#[test]
+fn test_merge_with_empty() {
+    let mut sketch = KllSketch::<f64>::default();
+    for i in 0..1000 {
+        sketch.update(i as f64);
+    }
+    let retained = sketch.num_retained();
+
+    sketch.merge(&KllSketch::default());
+    assert_eq!(sketch.n(), 1000);
+    assert_eq!(sketch.num_retained(), retained);
+
+    let mut empty = KllSketch::<f64>::default();
+    empty.merge(&sketch);
+    assert_eq!(empty.n(), 1000);
+    assert_eq!(empty.min_item(), Some(0.0));
+    assert_eq!(empty.max_item(), Some(999.0));
+    assert_that!(
+        empty.rank(500.0, false).unwrap(),
+        near(0.5, RANK_EPS_FOR_K_200)
+    );
+}
+
+#[test]
+fn test_merge_exact_mode() {
+    let mut left = KllSketch::<f64>::default();
+    let mut right = KllSketch::<f64>::default();
+    for i in 0..50 {
+        left.update(i as f64);
+        right.update((50 + i) as f64);
+    }
+    left.merge(&right);
+    assert!(!left.is_estimation_mode());
+    assert_eq!(left.n(), 100);
+    assert_eq!(left.num_retained(), 100);
+    assert_eq!(left.rank(49.0, true), Some(0.5));
+}
+
+#[test]
+fn test_merge_different_k() {
+    let n = 10_000;
+    let mut left = KllSketch::<f64>::new(256);
+    let mut right = KllSketch::<f64>::new(128);
+    for i in 0..n {
+        left.update(i as f64);
+        right.update((2 * n - i - 1) as f64);
+    }
+
+    left.merge(&right);
+    assert_eq!(left.k(), 256);
+    assert_eq!(left.n(), 2 * n);
+    assert_eq!(left.min_item(), Some(0.0));
+    assert_eq!(left.max_item(), Some((2 * n - 1) as f64));
+    let median = left.quantile(0.5, true).unwrap();
+    assert_that!(median / (2 * n) as f64, near(0.5, 0.03));
+}
+
+#[test]
+fn test_small_k_many_items() {
+    let n = 100_000;
+    let mut sketch = KllSketch::<f64>::new(8);
+    for i in 0..n {
+        sketch.update(i as f64);
+    }
+    assert_eq!(sketch.n(), n);
+    assert_eq!(sketch.min_item(), Some(0.0));
+    assert_eq!(sketch.max_item(), Some((n - 1) as f64));
+    assert!(sketch.num_retained() < 100);
+}
+
+#[test]
+fn test_f32_estimation_mode() {
+    let n = 100_000u32;
+    let mut sketch = KllSketch::<f32>::default();
+    for i in 0..n {
+        sketch.update(i as f32);
+    }
+    sketch.update(f32::NAN);
+    assert!(sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), n as u64);
+    assert_eq!(sketch.min_item(), Some(0.0));
+    assert_eq!(sketch.max_item(), Some((n - 1) as f32));
+
+    let median = sketch.quantile(0.5, true).unwrap();
+    assert_that!(median as f64 / n as f64, near(0.5, RANK_EPS_FOR_K_200));
+    assert_that!(
+        sketch.rank((n / 4) as f32, true).unwrap(),
+        near(0.25, RANK_EPS_FOR_K_200)
+    );
+
+    let pmf = sketch.pmf(&[(n / 2) as f32], false).unwrap();
+    assert_that!(pmf[0], near(0.5, RANK_EPS_FOR_K_200));
+    assert_that!(pmf[0] + pmf[1], near(1.0, 1e-9));
+}
+
+#[test]
+fn test_f32_merge() {
+    let mut left = KllSketch::<f32>::default();
+    let mut right = KllSketch::<f32>::default();
+    for i in 0..1000 {
+        left.update(i as f32);
+        right.update((1000 + i) as f32);
+    }
+    left.merge(&right);
+    assert_eq!(left.n(), 2000);
+    assert_eq!(left.min_item(), Some(0.0));
+    assert_eq!(left.max_item(), Some(1999.0));
+}
+
+#[test]
+fn test_sorted_view() {
+    let mut sketch = KllSketch::<f64>::default();
+    assert!(sketch.sorted_view().is_empty());
+
+    let n = 100_000;
+    for i in 0..n {
+        sketch.update(i as f64);
+    }
+    let view = sketch.sorted_view();
+    assert_eq!(view.len(), sketch.num_retained());
+    assert_eq!(view.total_weight(), n);
+
+    let mut previous_item = f64::NEG_INFINITY;
+    let mut previous_cumulative = 0;
+    for (&item, weight, cumulative) in view.iter() {
+        assert!(item >= previous_item);
+        assert_eq!(cumulative, previous_cumulative + weight);
+        previous_item = item;
+        previous_cumulative = cumulative;
+    }
+    assert_eq!(previous_cumulative, n);
+}
+
+#[test]
+fn test_normalized_rank_error() {
+    assert_that!(kll::normalized_rank_error(200, false), near(0.0133, 1e-4));
+    assert_that!(kll::normalized_rank_error(200, true), near(0.0165, 1e-4));
+
+    let mut sketch = KllSketch::<f64>::new(400);
+    assert_eq!(
+        sketch.normalized_rank_error(false),
+        kll::normalized_rank_error(400, false)
+    );
+    // the error of a merged sketch follows the smallest k of the estimation mode inputs
+    let mut other = KllSketch::<f64>::new(100);
+    other.update(1.0);
+    sketch.merge(&other);
+    assert_eq!(
+        sketch.normalized_rank_error(true),
+        kll::normalized_rank_error(400, true)
+    );
+    for i in 0..10_000 {
+        other.update(i as f64);
+    }
+    sketch.merge(&other);
+    assert_eq!(
+        sketch.normalized_rank_error(true),
+        kll::normalized_rank_error(100, true)
+    );
+}
+
+#[test]
+fn test_k_from_epsilon() {
+    for pmf in [false, true] {
+        for k in [8, 100, 200, 1000, 10_000, 65_535] {
+            let eps = kll::normalized_rank_error(k, pmf);
+            assert_eq!(kll::k_from_epsilon(eps, pmf), k);
+        }
+        let k = kll::k_from_epsilon(0.005, pmf);
+        assert!(kll::normalized_rank_error(k, pmf) <= 0.005);
+        assert!(kll::normalized_rank_error(k - 1, pmf) > 0.005);
+    }
+    assert_eq!(kll::k_from_epsilon(0.5, false), 8);
+    assert_eq!(kll::k_from_epsilon(0.0, false), u16::MAX);
+}
+
+#[test]
+fn test_extend() {
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.extend([3.0, f64::NAN, 1.0, 2.0]);
+    assert_eq!(sketch.n(), 3);
+    assert_eq!(sketch.min_item(), Some(1.0));
+    assert_eq!(sketch.max_item(), Some(3.0));
+}
+
+#[test]
+fn test_estimated_size() {
+    let mut sketch = KllSketch::<f64>::new(200);
+    let empty_size = sketch.estimated_size();
+    assert!(empty_size >= size_of::<KllSketch<f64>>());
+
+    sketch.extend((0..100_000).map(f64::from));
+    let size = sketch.estimated_size();
+    assert!(size > empty_size);
+    // the retained items account for most of the size
+    assert!(size >= empty_size + sketch.num_retained() * size_of::<f64>());
+}
+
+#[test]
+fn test_partition_boundaries() {
+    let n = 1_000_000u64;
+    let mut sketch = KllSketch::<f64>::new(200);
+    // a shuffled stream, so the sketch has compacted many levels
+    sketch.extend((0..n).map(|i| ((i * 7_919) % n) as f64));
+    let eps = sketch.normalized_rank_error(true);
+
+    for inclusive in [true, false] {
+        let partition = sketch.partition_boundaries(10, inclusive).unwrap();
+        assert_eq!(partition.num_parts(), 10);
+        assert_eq!(partition.is_inclusive(), inclusive);
+        assert_eq!(partition.total_weight(), n);
+
+        let boundaries = partition.boundaries();
+        assert_eq!(boundaries.len(), 11);
+        assert_eq!(boundaries[0], 0.0);
+        assert_eq!(boundaries[10], (n - 1) as f64);
+        assert!(boundaries.is_sorted());
+
+        let sizes = partition.part_sizes();
+        assert_eq!(sizes.iter().sum::<u64>(), n);
+        for size in sizes {
+            let fraction = size as f64 / n as f64;
+            assert!((fraction - 0.1).abs() <= 2.0 * eps, "part of {size} items");
+        }
+
+        // each interior boundary is the exact quantile of its estimated rank, within the error
+        for (boundary, rank) in boundaries.iter().zip(partition.normalized_ranks()).take(10) {
+            assert!((boundary / n as f64 - rank).abs() <= eps);
+        }
+    }
+}
+
+#[test]
+fn test_partition_boundaries_of_small_sketches() {
+    assert!(
+        KllSketch::<f64>::default()
+            .partition_boundaries(4, true)
+            .is_none()
+    );
+
+    // more parts than items leave some parts empty
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.extend([1.0, 2.0]);
+    let partition = sketch.partition_boundaries(4, true).unwrap();
+    assert_eq!(partition.boundaries(), [1.0, 1.0, 1.0, 2.0, 2.0]);
+    assert_eq!(partition.part_sizes(), [1, 0, 1, 0]);
+
+    let partition = sketch.partition_boundaries(1, false).unwrap();
+    assert_eq!(partition.boundaries(), [1.0, 2.0]);
+    assert_eq!(partition.natural_ranks(), [0, 1]);
+    assert_eq!(partition.part_sizes(), [2]);
+}
+
+#[test]
+#[should_panic(expected = "num_parts must be at least 1")]
+fn test_partition_boundaries_zero_parts() {
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.update(1.0);
+    sketch.partition_boundaries(0, true);
+}
+
+#[test]
+fn test_reset_and_reconfigure() {
+    let mut sketch = KllSketch::<f64>::new(200);
+    sketch.extend((0..100_000).map(f64::from));
+    let size = sketch.estimated_size();
+
+    sketch.reset();
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.k(), 200);
+    assert_eq!(sketch.num_retained(), 0);
+    assert_eq!(sketch.min_item(), None);
+    assert_eq!(sketch.estimated_size(), size);
+
+    // in exact mode the sketch holds its input like a new one
+    sketch.extend([3.0, 1.0, 2.0]);
+    let mut fresh = KllSketch::<f64>::new(200);
+    fresh.extend([3.0, 1.0, 2.0]);
+    assert_eq!(sketch.serialize(), fresh.serialize());
+
+    sketch.reconfigure(100);
+    assert_eq!(sketch.k(), 100);
+    assert!(sketch.is_empty());
+    sketch.extend((0..100_000).map(f64::from));
+    assert_eq!(sketch.n(), 100_000);
+    assert_eq!(sketch.max_item(), Some(99_999.0));
+    let median = sketch.quantile(0.5, true).unwrap();
+    assert!((median / 100_000.0 - 0.5).abs() <= sketch.normalized_rank_error(false));
+}
+
+#[test]
+fn test_to_string_with() {
+    let mut sketch = KllSketch::<f64>::new(8);
+    let empty = sketch.to_string();
+    assert!(empty.starts_with("### KLL sketch summary:\n"));
+    assert!(empty.contains("   Empty          : true\n"));
+    assert!(!empty.contains("Min item"));
+    assert!(empty.ends_with("### End sketch summary\n"));
+
+    sketch.extend((0..30).map(f64::from));
+    let summary = sketch.to_string();
+    assert_eq!(summary, sketch.to_string_with(false, false));
+    assert!(summary.contains("   N              : 30\n"));
+    assert!(summary.contains("   Estimation mode: true\n"));
+    assert!(summary.contains(&format!("   Retained items : {}\n", sketch.num_retained())));
+    assert!(summary.contains("   Min item       : 0.0\n"));
+    assert!(summary.contains("   Max item       : 29.0\n"));
+    assert!(!summary.contains("### KLL sketch levels:"));
+
+    let levels = sketch.to_string_with(true, false);
+    assert!(levels.contains("### KLL sketch levels:\n   index: nominal capacity, actual size\n"));
+    assert!(!levels.contains("### KLL sketch data:"));
+
+    // every retained item is printed once, under its level
+    let data = sketch.to_string_with(false, true);
+    let section = data.split("### KLL sketch data:\n").nth(1).unwrap();
+    let items = section
+        .lines()
+        .filter(|line| line.starts_with("   "))
+        .count();
+    assert_eq!(items, sketch.num_retained());
+    assert!(section.starts_with(" level 0:\n"));
+}
+
+#[test]
+fn test_update_from_iter() {
+    const N: u32 = 100_000;
+    let ascending = (0..N).map(f64::from);
+    let descending = (0..N).rev().map(f64::from);
+    let with_nan = (0..N).map(|i| if i % 10 == 0 { f64::NAN } else { f64::from(i) });
+    let inputs: [Box<dyn Iterator<Item = f64>>; 3] = [
+        Box::new(ascending),
+        Box::new(descending),
+        Box::new(with_nan),
+    ];
+    for items in inputs {
+        let items: Vec<f64> = items.collect();
+        let mut bulk = KllSketch::<f64>::new(200);
+        bulk.update_from_iter(items.iter().copied());
+        let mut single = KllSketch::<f64>::new(200);
+        for &item in &items {
+            single.update(item);
+        }
+
+        assert_eq!(bulk.n(), single.n());
+        assert_eq!(bulk.min_item(), single.min_item());
+        assert_eq!(bulk.max_item(), single.max_item());
+        for rank in [0.01, 0.25, 0.5, 0.75, 0.99] {
+            let quantile = bulk.quantile(rank, true).unwrap();
+            assert_that!(
+                single.rank(quantile, true).unwrap(),
+                near(rank, RANK_EPS_FOR_K_200)
+            );
+        }
+        let bytes = bulk.serialize();
+        assert_eq!(KllSketch::<f64>::deserialize(&bytes).unwrap().n(), bulk.n());
+    }
+
+    // in exact mode the two paths retain the same items
+    let mut bulk = KllSketch::<f64>::new(200);
+    bulk.update_from_iter([3.0, 1.0, 2.0]);
+    bulk.extend([5.0, 4.0]);
+    let mut single = KllSketch::<f64>::new(200);
+    for item in [3.0, 1.0, 2.0, 5.0, 4.0] {
+        single.update(item);
+    }
+    let items = |sketch: &KllSketch<f64>| -> Vec<_> {
+        sketch
+            .sorted_view()
+            .iter()
+            .map(|(&item, _, _)| item)
+            .collect()
+    };
+    assert_eq!(items(&bulk), items(&single));
+}
@@ -0,0 +1,160 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "kll")]
+
+use datasketches::kll::KllSketch;
+use datasketches::kll::KllSketchVector;
+
+fn filled(num_dimensions: usize, n: usize) -> KllSketchVector<f64> {
+    let mut sketches = KllSketchVector::new(200, num_dimensions);
+    let mut values = vec![0.0; num_dimensions];
+    for i in 0..n {
+        for (dimension, value) in values.iter_mut().enumerate() {
+            *value = (i * (dimension + 1)) as f64;
+        }
+        sketches.update(&values);
+    }
+    sketches
+}
+
+#[test]
+fn test_empty() {
+    let sketches = KllSketchVector::<f32>::new(100, 4);
+    assert!(sketches.is_empty());
+    assert_eq!(sketches.k(), 100);
+    assert_eq!(sketches.num_dimensions(), 4);
+    assert_eq!(sketches.quantiles(0.5, true), [None; 4]);
+    assert_eq!(sketches.ranks(&[1.0; 4], true), [None; 4]);
+}
+
+#[test]
+fn test_update_and_query() {
+    let n = 10_000;
+    let sketches = filled(3, n);
+    assert!(!sketches.is_empty());
+    for (dimension, sketch) in sketches.sketches().iter().enumerate() {
+        let scale = (dimension + 1) as f64;
+        assert_eq!(sketch.n(), n as u64);
+        assert_eq!(sketch.min_item(), Some(0.0));
+        assert_eq!(sketch.max_item(), Some((n - 1) as f64 * scale));
+    }
+
+    let eps = sketches.sketch(0).normalized_rank_error(false);
+    let medians = sketches.quantiles(0.5, true);
+    for (dimension, median) in medians.into_iter().enumerate() {
+        let scale = (dimension + 1) as f64;
+        let rank = median.unwrap() / scale / n as f64;
+        assert!(
+            (rank - 0.5).abs() <= eps,
+            "dimension {dimension}: rank {rank}"
+        );
+    }
+
+    let ranks = sketches.ranks(&[2_500.0, 5_000.0, 7_500.0], true);
+    for rank in ranks {
+        assert!((rank.unwrap() - 0.25).abs() <= eps);
+    }
+}
+
+#[test]
+fn test_merge_and_collapse() {
+    let mut left = filled(2, 1_000);
+    let right = filled(2, 3_000);
+    left.merge(&right);
+    assert_eq!(left.sketch(0).n(), 4_000);
+    assert_eq!(left.sketch(1).max_item(), Some(5_998.0));
+
+    let collapsed = left.collapse(0..2);
+    assert_eq!(collapsed.k(), 200);
+    assert_eq!(collapsed.n(), 8_000);
+    assert_eq!(collapsed.min_item(), Some(0.0));
+    assert_eq!(collapsed.max_item(), Some(5_998.0));
+
+    let single = left.collapse([1]);
+    assert_eq!(single.n(), left.sketch(1).n());
+    assert!(left.collapse([]).is_empty());
+}
+
+#[test]
+fn test_serialization_round_trip() {
+    for sketches in [
+        KllSketchVector::new(200, 1),
+        filled(1, 100),
+        filled(5, 50_000),
+    ] {
+        let bytes = sketches.serialize();
+        assert_eq!(bytes.len(), sketches.serialized_size_bytes());
+        let num_dimensions = u32::from_le_bytes(bytes[..4].try_into().unwrap());
+        assert_eq!(num_dimensions as usize, sketches.num_dimensions());
+
+        let decoded = KllSketchVector::<f64>::deserialize(&bytes).unwrap();
+        assert_eq!(decoded.num_dimensions(), sketches.num_dimensions());
+        assert_eq!(decoded.serialize(), bytes);
+        // the combined image is the concatenation of the single sketch images
+        let mut offset = 4;
+        for sketch in decoded.sketches() {
+            let image = sketch.serialize();
+            assert_eq!(bytes[offset..offset + image.len()], image);
+            offset += image.len();
+        }
+        assert_eq!(offset, bytes.len());
+    }
+}
+
+#[test]
+fn test_deserialize_invalid() {
+    let err = KllSketchVector::<f64>::deserialize(&[]).unwrap_err();
+    assert!(err.message().contains("insufficient data"), "{err}");
+
+    let err = KllSketchVector::<f64>::deserialize(&[0, 0, 0, 0]).unwrap_err();
+    assert!(err.message().contains("num_dimensions"), "{err}");
+
+    // fewer images than dimensions
+    let bytes = filled(2, 100).serialize();
+    let mut truncated = bytes.clone();
+    truncated[0] = 3;
+    assert!(KllSketchVector::<f64>::deserialize(&truncated).is_err());
+    assert!(KllSketchVector::<f64>::deserialize(&bytes[..bytes.len() - 1]).is_err());
+
+    // images of sketches with different k
+    let mut mixed = 2u32.to_le_bytes().to_vec();
+    mixed.extend(KllSketch::<f64>::new(200).serialize());
+    mixed.extend(KllSketch::<f64>::new(100).serialize());
+    let err = KllSketchVector::<f64>::deserialize(&mixed).unwrap_err();
+    assert!(err.message().contains("same k"), "{err}");
+}
+
+#[test]
+#[should_panic(expected = "values must have one value per dimension")]
+fn test_update_with_wrong_length() {
+    let mut sketches = KllSketchVector::<f64>::new(200, 3);
+    sketches.update(&[1.0, 2.0]);
+}
+
+#[test]
+#[should_panic(expected = "num_dimensions must be at least 1")]
+fn test_zero_dimensions() {
+    KllSketchVector::<f64>::new(200, 0);
+}
+
+#[test]
+#[should_panic(expected = "different numbers of dimensions")]
+fn test_merge_with_different_dimensions() {
+    let mut sketches = KllSketchVector::<f64>::new(200, 3);
+    sketches.merge(&KllSketchVector::new(200, 2));
+}
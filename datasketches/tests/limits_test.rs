@@ -0,0 +1,183 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(
+    feature = "bloom",
+    feature = "countmin",
+    feature = "cpc",
+    feature = "hll",
+    feature = "theta"
+))]
+
+use datasketches::bloom::BloomFilterBuilder;
+use datasketches::countmin::CountMinSketch;
+use datasketches::cpc::CpcSketch;
+use datasketches::error::ErrorKind;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+use datasketches::limits;
+use datasketches::limits::Limits;
+use datasketches::limits::Params;
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::DirectThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::theta::ThetaUnionBuilder;
+
+fn lg_k_params(lg_k: u8) -> Params {
+    let mut params = Params::default();
+    params.lg_k = Some(lg_k);
+    params
+}
+
+fn limits_of(family_id: u8, params: &Params) -> Limits {
+    limits::for_family(family_id, params).unwrap()
+}
+
+#[test]
+fn test_supported_families() {
+    let mut params = lg_k_params(10);
+    params.hll_type = Some(HllType::Hll6);
+    params.num_hashes = Some(3);
+    params.num_buckets = Some(100);
+    params.num_bits = Some(1000);
+
+    let families = limits::supported_families();
+    assert_eq!(families, [2, 3, 7, 16, 18, 21]);
+    for family_id in 0..=u8::MAX {
+        let result = limits::for_family(family_id, &params);
+        assert_eq!(result.is_ok(), families.contains(&family_id), "{family_id}");
+        if let Ok(limits) = result {
+            assert!(limits.max_serialized_bytes > 0);
+        }
+    }
+
+    // each family needs its own parameters
+    for family_id in families {
+        let err = limits::for_family(family_id, &Params::default()).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidArgument);
+        assert!(err.message().contains("parameter"), "{err}");
+    }
+    let err = limits::for_family(7, &lg_k_params(10)).unwrap_err();
+    assert!(err.message().contains("hll_type"), "{err}");
+}
+
+#[test]
+fn test_hll_limits() {
+    for lg_k in [4, 8, 11, 14] {
+        for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+            let mut params = lg_k_params(lg_k);
+            params.hll_type = Some(hll_type);
+            let limits = limits_of(7, &params);
+            assert_eq!(limits.is_strict, hll_type != HllType::Hll4);
+
+            let mut sketch = HllSketch::new(lg_k, hll_type);
+            for n in [0, 7, 1 << (lg_k - 3), 1 << (lg_k + 5)] {
+                sketch.extend(0..n);
+                assert!(sketch.serialize().len() <= limits.max_serialized_bytes);
+                assert!(sketch.serialize_updatable().len() <= limits.max_serialized_bytes);
+                assert!(sketch.estimated_size() <= limits.max_estimated_size.unwrap());
+            }
+
+            let mut union = HllUnion::new(lg_k);
+            union.update(&sketch);
+            let merged = union.to_sketch(hll_type);
+            assert!(merged.serialize_updatable().len() <= limits.max_serialized_bytes);
+        }
+    }
+}
+
+#[test]
+fn test_theta_limits() {
+    for lg_k in [5, 9, 12] {
+        let direct = limits_of(2, &lg_k_params(lg_k));
+        let compact = limits_of(3, &lg_k_params(lg_k));
+        assert!(direct.is_strict && compact.is_strict);
+        assert_eq!(compact.max_estimated_size, None);
+        assert_eq!(
+            direct.max_serialized_bytes,
+            DirectThetaSketch::required_size_bytes(lg_k)
+        );
+
+        let mut sketch = ThetaSketchBuilder::default().lg_k(lg_k).build();
+        let mut union = ThetaUnionBuilder::default().lg_k(lg_k).build();
+        let mut largest = None;
+        for i in 0..(64u64 << lg_k) {
+            sketch.update(i);
+            if largest
+                .as_ref()
+                .is_none_or(|c: &CompactThetaSketch| c.num_retained() < sketch.num_retained())
+            {
+                largest = Some(sketch.compact(false));
+            }
+            assert!(sketch.estimated_size() <= direct.max_estimated_size.unwrap());
+        }
+        // right before a rebuild, the compact form comes within a hash of the limit
+        let largest = largest.unwrap().serialize();
+        assert!(largest.len() <= compact.max_serialized_bytes);
+        assert!(largest.len() + 8 >= compact.max_serialized_bytes);
+        assert_eq!(sketch.estimated_size(), direct.max_estimated_size.unwrap());
+
+        union.update(&sketch).unwrap();
+        assert!(union.to_sketch(false).serialize().len() <= compact.max_serialized_bytes);
+    }
+}
+
+#[test]
+fn test_cpc_limits() {
+    for lg_k in [4, 8, 11] {
+        let limits = limits_of(16, &lg_k_params(lg_k));
+        assert!(!limits.is_strict);
+        assert_eq!(limits.max_estimated_size, None);
+
+        let mut sketch = CpcSketch::new(lg_k);
+        for n in [0, 10, 1 << lg_k, 10 << lg_k, 100 << lg_k] {
+            sketch.extend(0..n);
+            assert!(sketch.serialize().len() <= limits.max_serialized_bytes);
+        }
+    }
+}
+
+#[test]
+fn test_fixed_size_limits() {
+    let mut params = Params::default();
+    params.num_hashes = Some(5);
+    params.num_buckets = Some(300);
+    let limits = limits_of(18, &params);
+    let mut sketch = CountMinSketch::<i64>::new(5, 300);
+    assert!(sketch.serialize().len() < limits.max_serialized_bytes);
+    sketch.extend(0..1000);
+    assert_eq!(sketch.serialize().len(), limits.max_serialized_bytes);
+    assert_eq!(sketch.estimated_size(), limits.max_estimated_size.unwrap());
+
+    for num_bits in [1, 64, 65, 10_000] {
+        let mut params = Params::default();
+        params.num_bits = Some(num_bits);
+        let limits = limits_of(21, &params);
+        let mut filter = BloomFilterBuilder::with_size(num_bits, 3).build();
+        assert!(filter.serialize().len() < limits.max_serialized_bytes);
+        filter.insert("apple");
+        assert_eq!(filter.serialize().len(), limits.max_serialized_bytes);
+        assert_eq!(filter.estimated_size(), limits.max_estimated_size.unwrap());
+    }
+}
+
+#[test]
+#[should_panic(expected = "lg_k")]
+fn test_out_of_range_params() {
+    limits::for_family(3, &lg_k_params(30)).unwrap();
+}
@@ -0,0 +1,101 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use datasketches::metadata;
+
+#[test]
+fn test_split_untagged_bytes() {
+    for bytes in [&[][..], &[1, 2, 3], b"DSKMETA1", &[0; 64]] {
+        assert_eq!(metadata::split(bytes), (bytes, None));
+    }
+}
+
+#[test]
+fn test_round_trip_empty_and_large_metadata() {
+    let image = [3, 3, 3, 0, 1, 2, 3, 4];
+    let large = vec![0xAB; metadata::MAX_METADATA_BYTES];
+    for tag in [&[][..], b"k", &large] {
+        let tagged = metadata::attach(&image, tag);
+        assert_eq!(tagged.len(), image.len() + tag.len() + 16);
+        assert_eq!(metadata::split(&tagged), (&image[..], Some(tag)));
+    }
+}
+
+#[test]
+fn test_corrupt_trailer_is_not_recognized() {
+    let image = [3, 3, 3, 0, 1, 2, 3, 4];
+    let tagged = metadata::attach(&image, b"window=2024-06");
+
+    // a flipped metadata byte no longer matches the hash
+    let mut corrupt = tagged.clone();
+    corrupt[image.len()] ^= 1;
+    assert_eq!(metadata::split(&corrupt), (&corrupt[..], None));
+
+    // a length beyond the start of the bytes
+    let mut corrupt = tagged.clone();
+    let len_at = corrupt.len() - 16;
+    corrupt[len_at..len_at + 4].copy_from_slice(&u32::MAX.to_le_bytes());
+    assert_eq!(metadata::split(&corrupt), (&corrupt[..], None));
+
+    // a truncated trailer
+    assert_eq!(
+        metadata::split(&tagged[..tagged.len() - 1]),
+        (&tagged[..tagged.len() - 1], None)
+    );
+}
+
+#[test]
+#[should_panic(expected = "metadata must be at most")]
+fn test_oversized_metadata() {
+    metadata::attach(&[], &vec![0; metadata::MAX_METADATA_BYTES + 1]);
+}
+
+#[cfg(all(feature = "hll", feature = "kll", feature = "theta"))]
+#[test]
+fn test_tagged_images_deserialize_as_plain_ones() {
+    use datasketches::hll::HllSketch;
+    use datasketches::hll::HllType;
+    use datasketches::kll::KllSketch;
+    use datasketches::theta::CompactThetaSketch;
+    use datasketches::theta::ThetaSketchBuilder;
+
+    let tag = b"dim=country:fr;window=2024-06-01T00/PT1H";
+
+    let mut hll = HllSketch::new(12, HllType::Hll8);
+    hll.extend(0..1000);
+    let tagged = metadata::attach(&hll.serialize(), tag);
+    assert_eq!(HllSketch::deserialize(&tagged).unwrap(), hll);
+    let (image, found) = metadata::split(&tagged);
+    assert_eq!(found, Some(&tag[..]));
+    assert_eq!(image, hll.serialize());
+
+    let mut theta = ThetaSketchBuilder::default().build();
+    theta.extend(0..1000);
+    let compact = theta.compact(true);
+    let tagged = metadata::attach(&compact.serialize(), tag);
+    let decoded = CompactThetaSketch::deserialize(&tagged).unwrap();
+    assert_eq!(decoded.estimate(), compact.estimate());
+
+    let mut kll = KllSketch::<f64>::default();
+    for i in 0..1000 {
+        kll.update(i as f64);
+    }
+    let tagged = metadata::attach(&kll.serialize(), tag);
+    let decoded = KllSketch::<f64>::deserialize(&tagged).unwrap();
+    assert_eq!(decoded.n(), kll.n());
+    assert_eq!(metadata::split(&tagged).1, Some(&tag[..]));
+}
@@ -0,0 +1,139 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! The observer is process-wide, so this binary holds a single test that installs it and goes
+//! through the sketches one after another.
+
+#![cfg(all(feature = "bloom", feature = "hll", feature = "theta"))]
+
+use std::sync::Mutex;
+
+use datasketches::bloom::BloomFilterBuilder;
+use datasketches::common::ResizeFactor;
+use datasketches::common::SketchEvent;
+use datasketches::common::set_observer;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::theta::ThetaSketchBuilder;
+
+static EVENTS: Mutex<Vec<SketchEvent>> = Mutex::new(Vec::new());
+
+fn take_events() -> Vec<SketchEvent> {
+    std::mem::take(&mut EVENTS.lock().unwrap())
+}
+
+#[test]
+fn test_observer_receives_lifecycle_events() {
+    set_observer(|event: &SketchEvent| EVENTS.lock().unwrap().push(*event)).unwrap();
+    let err = set_observer(|_: &SketchEvent| {}).unwrap_err();
+    assert!(err.message().contains("already installed"), "{err}");
+
+    // List -> Set -> growing Set -> HLL
+    let mut sketch = HllSketch::new(10, HllType::Hll4);
+    sketch.extend(0..10_000);
+    let events = take_events();
+    assert_eq!(events[0], SketchEvent::HllListToSet { lg_config_k: 10 });
+    assert_eq!(
+        events[1..events.len() - 1],
+        [
+            SketchEvent::HllSetResize {
+                lg_config_k: 10,
+                lg_size: 6
+            },
+            SketchEvent::HllSetResize {
+                lg_config_k: 10,
+                lg_size: 7
+            },
+        ]
+    );
+    assert!(matches!(
+        events[events.len() - 1],
+        SketchEvent::HllToArray {
+            lg_config_k: 10,
+            num_coupons: 97
+        }
+    ));
+
+    // small sketches go from List straight to HLL
+    let mut sketch = HllSketch::new(6, HllType::Hll8);
+    sketch.extend(0..100);
+    assert_eq!(
+        take_events(),
+        [SketchEvent::HllToArray {
+            lg_config_k: 6,
+            num_coupons: 8
+        }]
+    );
+
+    // the table doubles up to twice the nominal size, then rebuilds
+    let mut sketch = ThetaSketchBuilder::default()
+        .lg_k(10)
+        .resize_factor(ResizeFactor::X2)
+        .build();
+    sketch.extend(0..10_000);
+    let events = take_events();
+    let resizes: Vec<_> = events
+        .iter()
+        .filter_map(|event| match event {
+            SketchEvent::ThetaResize {
+                lg_nom_size: 10,
+                lg_cur_size,
+            } => Some(*lg_cur_size),
+            _ => None,
+        })
+        .collect();
+    assert_eq!(resizes, [6, 7, 8, 9, 10, 11]);
+    let thetas: Vec<_> = events
+        .iter()
+        .filter_map(|event| match event {
+            SketchEvent::ThetaRebuild {
+                lg_nom_size: 10,
+                theta,
+            } => Some(*theta),
+            _ => None,
+        })
+        .collect();
+    assert!(!thetas.is_empty());
+    assert!(thetas.is_sorted_by(|a, b| a > b));
+    assert_eq!(*thetas.last().unwrap(), sketch.theta64());
+
+    // reported once, when half of the bits are set
+    let mut filter = BloomFilterBuilder::with_size(1024, 3).build();
+    let mut reported = false;
+    for i in 0..1000 {
+        filter.insert(i);
+        let saturated = filter.bits_used() >= 512;
+        let events = take_events();
+        if events.is_empty() {
+            assert!(!saturated);
+            continue;
+        }
+        assert_eq!(
+            events,
+            [SketchEvent::BloomSaturated {
+                capacity: 1024,
+                num_hashes: 3
+            }]
+        );
+        assert!(saturated);
+        reported = true;
+        break;
+    }
+    assert!(reported);
+    filter.insert_all(1000..2000);
+    assert!(take_events().is_empty());
+}
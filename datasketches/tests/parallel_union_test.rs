@@ -0,0 +1,116 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "rayon")]
+
+#[cfg(feature = "hll")]
+#[test]
+fn test_hll_par_union_serialized() {
+    use datasketches::error::ErrorKind;
+    use datasketches::hll::HllSketch;
+    use datasketches::hll::HllType;
+    use datasketches::hll::HllUnion;
+
+    let mut images = vec![];
+    let mut sequential = HllUnion::new(12);
+    for p in 0..1000u64 {
+        let hll_type = [HllType::Hll4, HllType::Hll6, HllType::Hll8][p as usize % 3];
+        let mut sketch = HllSketch::new(12, hll_type);
+        for i in 0..(p % 50) * 10 {
+            sketch.update(p * 1000 + i);
+        }
+        sequential.update(&sketch);
+        images.push(sketch.serialize());
+    }
+
+    let union = HllUnion::par_union_serialized(12, &images).unwrap();
+    let expected = sequential.to_sketch(HllType::Hll8);
+    let actual = union.to_sketch(HllType::Hll8);
+    assert!(actual.iter().eq(expected.iter()));
+    assert_eq!(actual.composite_estimate(), expected.composite_estimate());
+
+    let empty: [&[u8]; 0] = [];
+    assert!(
+        HllUnion::par_union_serialized(12, &empty)
+            .unwrap()
+            .is_empty()
+    );
+
+    images[700].truncate(3);
+    let err = HllUnion::par_union_serialized(12, &images).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+}
+
+#[cfg(feature = "cpc")]
+#[test]
+fn test_cpc_par_union_serialized() {
+    use datasketches::cpc::CpcSketch;
+    use datasketches::cpc::CpcUnion;
+    use datasketches::error::ErrorKind;
+
+    let mut images = vec![];
+    for p in 0..500u64 {
+        let mut sketch = CpcSketch::new(11);
+        for i in 0..100 {
+            sketch.update(p * 100 + i);
+        }
+        images.push(sketch.serialize());
+    }
+
+    let union = CpcUnion::par_union_serialized(11, &images).unwrap();
+    let estimate = union.to_sketch().estimate();
+    assert!((estimate - 50_000.0).abs() / 50_000.0 < 0.05);
+
+    let err = CpcUnion::par_union_serialized_with_seed(11, 7, &images).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+}
+
+#[cfg(feature = "theta")]
+#[test]
+fn test_theta_par_union_serialized() {
+    use datasketches::error::ErrorKind;
+    use datasketches::theta::ThetaSketchBuilder;
+    use datasketches::theta::ThetaUnionBuilder;
+
+    // Overlapping partitions of 0..20_000
+    let mut images = vec![];
+    let mut sequential = ThetaUnionBuilder::default().lg_k(10).build();
+    for p in 0..400u64 {
+        let mut sketch = ThetaSketchBuilder::default().lg_k(10).build();
+        for i in 0..100 {
+            sketch.update(p * 50 + i);
+        }
+        let compact = sketch.compact(true);
+        sequential.update(&compact).unwrap();
+        images.push(compact.serialize());
+    }
+
+    let union = ThetaUnionBuilder::default()
+        .lg_k(10)
+        .par_union_serialized(&images)
+        .unwrap();
+    let actual = union.to_sketch(true);
+    let expected = sequential.to_sketch(true);
+    assert_eq!(actual.theta64(), expected.theta64());
+    assert_eq!(actual.serialize(), expected.serialize());
+
+    let err = ThetaUnionBuilder::default()
+        .seed(7)
+        .par_union_serialized(&images)
+        .unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+}
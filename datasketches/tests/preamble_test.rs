@@ -0,0 +1,117 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(
+    feature = "cpc",
+    feature = "hll",
+    feature = "kll",
+    feature = "tdigest",
+    feature = "theta",
+    feature = "tuple"
+))]
+
+use datasketches::cpc::CpcSketch;
+use datasketches::error::SketchError;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::kll::KllSketch;
+use datasketches::preamble;
+use datasketches::tdigest::TDigestMut;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::tuple::ArrayOfDoublesSketchBuilder;
+
+/// Checks the probe of an empty and a non-empty image of the same family, which differ in the
+/// empty flag.
+fn check_family(empty: &[u8], non_empty: &[u8], family_name: &str, empty_flag: u8) {
+    let probed = preamble::probe(empty).unwrap();
+    assert_eq!(probed.family_name(), family_name);
+    assert_eq!(probed.family_id, empty[2]);
+    assert_eq!(probed.serial_version, empty[1]);
+    assert_eq!(probed.preamble_longs, empty[0] & 0x3F);
+    assert_ne!(probed.flags & empty_flag, 0, "{family_name}: {probed:?}");
+
+    let probed = preamble::probe(non_empty).unwrap();
+    assert_eq!(probed.family_name(), family_name);
+    assert_eq!(probed.flags & empty_flag, 0, "{family_name}: {probed:?}");
+}
+
+#[test]
+fn test_probe_families() {
+    let mut hll = HllSketch::new(12, HllType::Hll8);
+    let empty = hll.serialize();
+    hll.extend(0..1000);
+    check_family(&empty, &hll.serialize(), "HLL", 1 << 2);
+
+    let mut kll = KllSketch::<f64>::default();
+    let empty = kll.serialize();
+    kll.extend((0..1000).map(f64::from));
+    check_family(&empty, &kll.serialize(), "KLL", 1 << 0);
+
+    let mut theta = ThetaSketchBuilder::default().build();
+    let empty = theta.compact(true).serialize();
+    theta.extend(0..1000);
+    check_family(&empty, &theta.compact(true).serialize(), "COMPACT", 1 << 2);
+
+    let mut tdigest = TDigestMut::new(100);
+    let empty = tdigest.serialize();
+    tdigest.extend((0..1000).map(f64::from));
+    check_family(&empty, &tdigest.serialize(), "TDIGEST", 1 << 0);
+
+    let mut aod = ArrayOfDoublesSketchBuilder::new(2).build();
+    let empty = aod.compact(true).serialize();
+    for i in 0..1000 {
+        aod.update(i, &[1.0, 2.0]);
+    }
+    check_family(&empty, &aod.compact(true).serialize(), "TUPLE", 1 << 2);
+
+    // CPC has no empty flag, but always sets the compressed flag
+    let mut cpc = CpcSketch::new(11);
+    cpc.extend(0..1000);
+    let probed = preamble::probe(&cpc.serialize()).unwrap();
+    assert_eq!(probed.family_name(), "CPC");
+    assert_ne!(probed.flags & (1 << 1), 0, "{probed:?}");
+}
+
+#[test]
+fn test_probe_reads_only_the_preamble() {
+    let mut hll = HllSketch::new(12, HllType::Hll8);
+    hll.extend(0..1000);
+    let bytes = hll.serialize();
+    assert_eq!(
+        preamble::probe(&bytes[..6]).unwrap(),
+        preamble::probe(&bytes).unwrap()
+    );
+
+    let err = preamble::probe(&bytes[..5]).unwrap_err();
+    assert_eq!(
+        err.sketch_error(),
+        Some(&SketchError::UnexpectedEnd { field: "flags" })
+    );
+    let err = preamble::probe(&[]).unwrap_err();
+    assert_eq!(
+        err.sketch_error(),
+        Some(&SketchError::UnexpectedEnd {
+            field: "preamble_longs"
+        })
+    );
+}
+
+#[test]
+fn test_probe_unknown_family() {
+    let err = preamble::probe(&[1, 1, 0, 0, 0, 0, 0, 0]).unwrap_err();
+    assert!(err.message().contains("unknown family id: 0"), "{err}");
+}
@@ -0,0 +1,83 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(
+    feature = "bloom",
+    feature = "cpc",
+    feature = "hll",
+    feature = "kll",
+    feature = "theta"
+))]
+
+use datasketches::prelude::*;
+
+fn merged<S: MergeableSketch + Clone>(left: &S, right: &S) -> S {
+    let mut merged = left.clone();
+    merged.merge(right).unwrap();
+    merged
+}
+
+#[test]
+fn test_prelude_covers_common_workflows() {
+    let mut hll = HllSketch::new(12, HllType::Hll8);
+    hll.extend(0..1000);
+    let mut union = HllUnion::new(12);
+    union.update(&hll);
+    assert!((union.estimate() - 1000.0).abs() < 50.0);
+
+    let mut left = ThetaSketchBuilder::default().build();
+    let mut right = ThetaSketchBuilder::default().build();
+    left.extend(0..600);
+    right.extend(400..1000);
+    let mut intersection = ThetaIntersection::new_with_default_seed();
+    intersection.update(&left).unwrap();
+    intersection.update(&right).unwrap();
+    assert_eq!(intersection.to_sketch(true).estimate(), 200.0);
+
+    let mut cpc = CpcSketch::new(11);
+    cpc.extend(0..1000);
+    let estimators: [&dyn DistinctCountEstimator; 3] = [&hll, &cpc, &left];
+    for sketch in estimators {
+        assert!(
+            sketch
+                .estimate_with_bounds(NumStdDev::Three)
+                .contains(sketch.estimate())
+        );
+    }
+
+    let mut kll = KllSketch::<f64>::default();
+    kll.extend((0..1000).map(f64::from));
+    assert_eq!(QuantileSketch::n(&kll), 1000);
+    assert_eq!(merged(&kll, &kll).n(), 2000);
+
+    let mut filter = BloomFilterBuilder::with_accuracy(100, 0.01).build();
+    filter.insert("apple");
+    assert!(filter.contains(&"apple"));
+
+    let mut config = SketchConfig::default();
+    config.lg_k = Some(10);
+    let sketch = HllSketchBuilder::default().config(&config).build();
+    assert_eq!(sketch.lg_config_k(), 10);
+
+    let mut union = ThetaUnionBuilder::default().build();
+    union.merge(&left.compact(false)).unwrap();
+    union.merge(&right).unwrap();
+    assert_eq!(union.to_sketch(true).estimate(), 1000.0);
+
+    let result: Result<HllSketch, Error> = HllSketch::deserialize(&[]);
+    assert!(result.is_err());
+}
@@ -0,0 +1,172 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(feature = "kll", feature = "req"))]
+
+use datasketches::common::NumStdDev;
+use datasketches::common::QuantileBounds;
+use datasketches::kll::KllItemsSketch;
+use datasketches::kll::KllSketch;
+use datasketches::req::RankAccuracy;
+use datasketches::req::ReqSketch;
+
+const N: u32 = 100_000;
+const RANKS: [f64; 7] = [0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99];
+
+/// Checks the band of `rank` over the stream `0..N`, whose true quantile of a rank is the item
+/// `rank * N` under inclusive ranks.
+fn check_band(bounds: &QuantileBounds<f64>, rank: f64) {
+    assert!(bounds.lower_rank <= rank && rank <= bounds.upper_rank);
+    assert!(bounds.lower <= bounds.quantile && bounds.quantile <= bounds.upper);
+    let expected = (rank * N as f64).ceil() - 1.0;
+    assert!(
+        bounds.lower <= expected && expected <= bounds.upper,
+        "rank {rank}: {expected} not in {bounds:?}"
+    );
+}
+
+#[test]
+fn test_kll_bands() {
+    let mut sketch = KllSketch::<f64>::new(200);
+    assert!(sketch.quantile_with_rank_bounds(0.5, true).is_none());
+    for i in 0..N {
+        sketch.update(i as f64);
+    }
+
+    let eps = sketch.normalized_rank_error(false);
+    for rank in RANKS {
+        let bounds = sketch.quantile_with_rank_bounds(rank, true).unwrap();
+        assert_eq!(Some(bounds.quantile), sketch.quantile(rank, true));
+        assert_eq!(bounds.lower_rank, (rank - eps).max(0.0));
+        assert_eq!(bounds.upper_rank, (rank + eps).min(1.0));
+        assert_eq!(Some(bounds.lower), sketch.quantile(bounds.lower_rank, true));
+        assert_eq!(Some(bounds.upper), sketch.quantile(bounds.upper_rank, true));
+        check_band(&bounds, rank);
+    }
+
+    // the bounds of the extreme ranks are clamped to the exact extremes
+    let bounds = sketch.quantile_with_rank_bounds(0.0, true).unwrap();
+    assert_eq!(
+        (bounds.lower_rank, bounds.lower, bounds.quantile),
+        (0.0, 0.0, 0.0)
+    );
+    let bounds = sketch.quantile_with_rank_bounds(1.0, false).unwrap();
+    assert_eq!(bounds.upper_rank, 1.0);
+    assert_eq!(bounds.upper, (N - 1) as f64);
+    assert_eq!(bounds.quantile, (N - 1) as f64);
+}
+
+#[test]
+fn test_exact_sketches_have_no_band() {
+    let mut kll = KllSketch::<f32>::new(200);
+    let mut req = ReqSketch::new(12, RankAccuracy::LowRanks);
+    for i in 0..20 {
+        kll.update(i as f32);
+        req.update(i as f32);
+    }
+    assert!(!kll.is_estimation_mode() && !req.is_estimation_mode());
+    for rank in RANKS {
+        let bounds = kll.quantile_with_rank_bounds(rank, false).unwrap();
+        assert_eq!((bounds.lower_rank, bounds.upper_rank), (rank, rank));
+        assert_eq!(
+            (bounds.lower, bounds.upper),
+            (bounds.quantile, bounds.quantile)
+        );
+
+        let bounds = req
+            .quantile_with_rank_bounds(rank, false, NumStdDev::Three)
+            .unwrap();
+        assert_eq!((bounds.lower_rank, bounds.upper_rank), (rank, rank));
+        assert_eq!(
+            (bounds.lower, bounds.upper),
+            (bounds.quantile, bounds.quantile)
+        );
+    }
+}
+
+#[test]
+fn test_kll_items_bands() {
+    let mut sketch = KllItemsSketch::<u32>::new(100);
+    assert!(sketch.quantile_with_rank_bounds(0.5, true).is_none());
+    for i in 0..N {
+        sketch.update(i);
+    }
+    for rank in RANKS {
+        let bounds = sketch.quantile_with_rank_bounds(rank, true).unwrap();
+        let bounds = QuantileBounds {
+            lower: bounds.lower as f64,
+            quantile: bounds.quantile as f64,
+            upper: bounds.upper as f64,
+            lower_rank: bounds.lower_rank,
+            upper_rank: bounds.upper_rank,
+        };
+        check_band(&bounds, rank);
+    }
+}
+
+#[test]
+fn test_req_bands_narrow_at_the_accurate_end() {
+    let mut sketch = ReqSketch::new(12, RankAccuracy::HighRanks);
+    assert!(
+        sketch
+            .quantile_with_rank_bounds(0.5, true, NumStdDev::Two)
+            .is_none()
+    );
+    for i in 0..N {
+        sketch.update(i as f32);
+    }
+    assert!(sketch.is_estimation_mode());
+
+    let mut widths = vec![];
+    for rank in RANKS {
+        let bounds = sketch
+            .quantile_with_rank_bounds(rank, true, NumStdDev::Three)
+            .unwrap();
+        assert_eq!(
+            bounds.lower_rank,
+            sketch.rank_lower_bound(rank, NumStdDev::Three).max(0.0)
+        );
+        assert_eq!(Some(bounds.quantile), sketch.quantile(rank, true));
+        let bounds = QuantileBounds {
+            lower: bounds.lower as f64,
+            quantile: bounds.quantile as f64,
+            upper: bounds.upper as f64,
+            lower_rank: bounds.lower_rank,
+            upper_rank: bounds.upper_rank,
+        };
+        check_band(&bounds, rank);
+        widths.push(bounds.upper - bounds.lower);
+    }
+    assert!(widths[6] < widths[0], "{widths:?}");
+
+    // a wider confidence gives a wider band
+    let one = sketch
+        .quantile_with_rank_bounds(0.5, true, NumStdDev::One)
+        .unwrap();
+    let three = sketch
+        .quantile_with_rank_bounds(0.5, true, NumStdDev::Three)
+        .unwrap();
+    assert!(three.lower <= one.lower && one.upper <= three.upper);
+}
+
+#[test]
+#[should_panic(expected = "rank must be in [0.0, 1.0]")]
+fn test_invalid_rank() {
+    let mut sketch = KllSketch::<f64>::default();
+    sketch.update(1.0);
+    sketch.quantile_with_rank_bounds(1.5, true);
+}
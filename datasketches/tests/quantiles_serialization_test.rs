@@ -0,0 +1,217 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "quantiles")]
+
+mod common;
+
+use std::fs;
+use std::path::PathBuf;
+
+use common::serialization_test_data;
+use datasketches::error::ErrorKind;
+use datasketches::quantiles::DoublesSketch;
+use googletest::assert_that;
+use googletest::prelude::near;
+
+fn test_sketch_file(path: PathBuf, n: u64, check_roundtrip: bool) {
+    let bytes = fs::read(&path).unwrap();
+    let sketch = DoublesSketch::deserialize(&bytes).unwrap();
+
+    let path = path.display();
+    assert_eq!(sketch.n(), n, "filepath: {path}");
+    assert_eq!(sketch.is_empty(), n == 0, "filepath: {path}");
+    assert_eq!(sketch.is_estimation_mode(), n >= 256, "filepath: {path}");
+    if n > 0 {
+        assert_eq!(sketch.min_item(), Some(1.0), "filepath: {path}");
+        assert_eq!(sketch.max_item(), Some(n as f64), "filepath: {path}");
+        assert_eq!(sketch.rank(n as f64, true), Some(1.0), "filepath: {path}");
+        assert_that!(
+            sketch.rank((n / 2) as f64, true).unwrap(),
+            near(0.5, 0.025),
+            "filepath: {path}"
+        );
+    }
+
+    if check_roundtrip {
+        assert_eq!(bytes, sketch.serialize(), "filepath: {path}");
+    }
+}
+
+#[test]
+fn test_deserialize_from_java_snapshots() {
+    let ns = [0, 1, 10, 100, 1000, 10_000, 100_000, 1_000_000];
+    for n in ns {
+        let filename = format!("quantiles_double_n{}_java.sk", n);
+        let path = serialization_test_data("java_generated_files", &filename);
+        test_sketch_file(path, n, false);
+    }
+}
+
+#[test]
+fn test_deserialize_from_cpp_snapshots() {
+    let ns = [0, 1, 10, 100, 1000, 10_000, 100_000, 1_000_000];
+    for n in ns {
+        let filename = format!("quantiles_double_n{}_cpp.sk", n);
+        let path = serialization_test_data("cpp_generated_files", &filename);
+        test_sketch_file(path, n, true);
+    }
+}
+
+#[test]
+fn test_empty() {
+    let sketch = DoublesSketch::new(64);
+    let bytes = sketch.serialize();
+    assert_eq!(bytes.len(), 8);
+
+    let decoded = DoublesSketch::deserialize(&bytes).unwrap();
+    assert!(decoded.is_empty());
+    assert_eq!(decoded.k(), 64);
+    assert_eq!(decoded.min_item(), None);
+    assert_eq!(decoded.max_item(), None);
+}
+
+#[test]
+fn test_exact_mode() {
+    let mut sketch = DoublesSketch::default();
+    for i in (0..10).rev() {
+        sketch.update(i as f64);
+    }
+    let bytes = sketch.serialize();
+    // preamble with n, min and max, and ten items
+    assert_eq!(bytes.len(), 32 + 8 * 10);
+
+    let decoded = DoublesSketch::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.n(), 10);
+    assert_eq!(decoded.num_retained(), 10);
+    assert_eq!(decoded.min_item(), Some(0.0));
+    assert_eq!(decoded.max_item(), Some(9.0));
+    for i in 0..10 {
+        let value = i as f64;
+        assert_eq!(decoded.rank(value, true), sketch.rank(value, true));
+    }
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_estimation_mode() {
+    let mut sketch = DoublesSketch::default();
+    for i in 0..100_000 {
+        sketch.update(i as f64);
+    }
+    let bytes = sketch.serialize();
+    assert_eq!(bytes.len(), 32 + 8 * sketch.num_retained());
+
+    let mut decoded = DoublesSketch::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.n(), sketch.n());
+    assert_eq!(decoded.num_retained(), sketch.num_retained());
+    assert_eq!(decoded.min_item(), sketch.min_item());
+    assert_eq!(decoded.max_item(), sketch.max_item());
+    assert_eq!(decoded.rank(50_000.0, true), sketch.rank(50_000.0, true));
+    assert_eq!(decoded.quantile(0.5, true), sketch.quantile(0.5, true));
+    assert_eq!(decoded.serialize(), bytes);
+
+    // a deserialized sketch keeps accepting updates
+    for i in 100_000..200_000 {
+        decoded.update(i as f64);
+    }
+    assert_eq!(decoded.n(), 200_000);
+    assert_eq!(decoded.max_item(), Some(199_999.0));
+}
+
+/// Builds an image in the updatable layout of the Java implementation, where the base buffer
+/// region has room for 2k items and every level up to the highest one has room for k items.
+fn updatable_image(serial_version: u8, k: u16, n: u64, items: &[f64]) -> Vec<u8> {
+    let preamble_longs = if serial_version == 1 { 5 } else { 2 };
+    let mut bytes = vec![preamble_longs, serial_version, 8, 0];
+    bytes.extend_from_slice(&k.to_le_bytes());
+    bytes.extend_from_slice(&[0, 0]);
+    bytes.extend_from_slice(&n.to_le_bytes());
+    let min = items.iter().copied().fold(f64::INFINITY, f64::min);
+    let max = items.iter().copied().fold(f64::NEG_INFINITY, f64::max);
+    bytes.extend_from_slice(&min.to_le_bytes());
+    bytes.extend_from_slice(&max.to_le_bytes());
+    if serial_version == 1 {
+        // buffer allocation
+        bytes.extend_from_slice(&(items.len() as u64).to_le_bytes());
+    }
+    for item in items {
+        bytes.extend_from_slice(&item.to_le_bytes());
+    }
+    bytes
+}
+
+#[test]
+fn test_deserialize_updatable_images() {
+    let k = 2;
+    // n = 21 = 5 * 2k + 1 leaves one value in the base buffer and occupies levels 0 and 2:
+    // [base buffer: 2k] [level 0: k] [level 1: k, unused] [level 2: k]
+    let items = [
+        5.0, -1.0, -1.0, -1.0, // base buffer, only the first value is valid
+        1.0, 3.0, // level 0, weight 2
+        -1.0, -1.0, // level 1, unused
+        2.0, 4.0, // level 2, weight 8
+    ];
+    for serial_version in [1, 3] {
+        let bytes = updatable_image(serial_version, k, 21, &items);
+        let sketch = DoublesSketch::deserialize(&bytes).unwrap();
+        assert_eq!(sketch.k(), 2);
+        assert_eq!(sketch.n(), 21);
+        assert_eq!(sketch.num_retained(), 5);
+        assert_eq!(sketch.rank(1.0, true), Some(2.0 / 21.0));
+        assert_eq!(sketch.rank(2.0, true), Some(10.0 / 21.0));
+        assert_eq!(sketch.rank(3.0, true), Some(12.0 / 21.0));
+        assert_eq!(sketch.rank(4.0, true), Some(20.0 / 21.0));
+        assert_eq!(sketch.rank(5.0, true), Some(1.0));
+
+        // re-serializing produces the compact image of the same sketch
+        let compact = DoublesSketch::deserialize(&sketch.serialize()).unwrap();
+        assert_eq!(compact.rank(3.0, true), sketch.rank(3.0, true));
+    }
+}
+
+#[test]
+fn test_deserialize_invalid() {
+    let mut sketch = DoublesSketch::default();
+    for i in 0..1000 {
+        sketch.update(i as f64);
+    }
+    let bytes = sketch.serialize();
+
+    let err = DoublesSketch::deserialize(&bytes[..bytes.len() - 1]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut wrong_family = bytes.clone();
+    wrong_family[2] = 15;
+    let err = DoublesSketch::deserialize(&wrong_family).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut wrong_serial_version = bytes.clone();
+    wrong_serial_version[1] = 4;
+    let err = DoublesSketch::deserialize(&wrong_serial_version).unwrap_err();
+    assert!(err.message().contains("unsupported serial version"));
+
+    let mut wrong_preamble_longs = bytes.clone();
+    wrong_preamble_longs[0] = 1;
+    let err = DoublesSketch::deserialize(&wrong_preamble_longs).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut wrong_k = bytes.clone();
+    wrong_k[4] = 100;
+    let err = DoublesSketch::deserialize(&wrong_k).unwrap_err();
+    assert!(err.message().contains("k must be a power of 2"));
+}
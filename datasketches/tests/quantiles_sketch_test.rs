@@ -0,0 +1,314 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "quantiles")]
+
+use datasketches::quantiles;
+use datasketches::quantiles::DoublesSketch;
+use googletest::assert_that;
+use googletest::prelude::near;
+
+// normalized rank error with 99% confidence for k = 128, with some slack for randomness
+const RANK_EPS_FOR_K_128: f64 = 0.025;
+
+#[test]
+fn test_empty() {
+    let sketch = DoublesSketch::default();
+    assert!(sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.k(), 128);
+    assert_eq!(sketch.n(), 0);
+    assert_eq!(sketch.num_retained(), 0);
+    assert_eq!(sketch.min_item(), None);
+    assert_eq!(sketch.max_item(), None);
+    assert_eq!(sketch.rank(0.0, true), None);
+    assert_eq!(sketch.quantile(0.5, true), None);
+
+    let split_points = [0.0];
+    assert_eq!(sketch.pmf(&split_points, true), None);
+    assert_eq!(sketch.cdf(&split_points, true), None);
+}
+
+#[test]
+#[should_panic(expected = "k must be a power of 2")]
+fn test_k_not_power_of_two() {
+    DoublesSketch::new(100);
+}
+
+#[test]
+#[should_panic(expected = "k must be a power of 2")]
+fn test_k_too_small() {
+    DoublesSketch::new(1);
+}
+
+#[test]
+fn test_nan_is_ignored() {
+    let mut sketch = DoublesSketch::default();
+    sketch.update(f64::NAN);
+    assert!(sketch.is_empty());
+    sketch.update(1.0);
+    sketch.update(f64::NAN);
+    assert_eq!(sketch.n(), 1);
+}
+
+#[test]
+#[should_panic(expected = "item must not be NaN")]
+fn test_rank_of_nan() {
+    let mut sketch = DoublesSketch::default();
+    sketch.update(1.0);
+    sketch.rank(f64::NAN, true);
+}
+
+#[test]
+#[should_panic(expected = "rank must be in [0.0, 1.0]")]
+fn test_quantile_of_invalid_rank() {
+    let mut sketch = DoublesSketch::default();
+    sketch.update(1.0);
+    sketch.quantile(1.5, true);
+}
+
+#[test]
+#[should_panic(expected = "split_points must be unique and monotonically increasing")]
+fn test_unsorted_split_points() {
+    let mut sketch = DoublesSketch::default();
+    sketch.update(1.0);
+    sketch.pmf(&[2.0, 1.0], true);
+}
+
+#[test]
+fn test_exact_mode() {
+    let mut sketch = DoublesSketch::default();
+    // fewer than 2k values stay in the base buffer
+    for i in 0..255 {
+        sketch.update(i as f64);
+    }
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.num_retained(), 255);
+    assert_eq!(sketch.min_item(), Some(0.0));
+    assert_eq!(sketch.max_item(), Some(254.0));
+    for i in 0..255 {
+        let value = i as f64;
+        assert_eq!(sketch.rank(value, false), Some(i as f64 / 255.0));
+        assert_eq!(sketch.rank(value, true), Some((i + 1) as f64 / 255.0));
+    }
+    assert_eq!(sketch.quantile(0.5, true), Some(127.0));
+}
+
+#[test]
+fn test_estimation_mode() {
+    let n = 1_000_000;
+    let mut sketch = DoublesSketch::default();
+    for i in 0..n {
+        sketch.update(i as f64);
+    }
+    assert!(sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), n);
+    assert!(sketch.num_retained() < 3000);
+    assert_eq!(sketch.min_item(), Some(0.0));
+    assert_eq!(sketch.max_item(), Some((n - 1) as f64));
+    assert_eq!(sketch.quantile(0.0, true), Some(0.0));
+    assert_eq!(sketch.quantile(1.0, true), Some((n - 1) as f64));
+
+    for i in (0..n).step_by(10_000) {
+        let rank = sketch.rank(i as f64, true).unwrap();
+        assert_that!(rank, near(i as f64 / n as f64, RANK_EPS_FOR_K_128));
+    }
+    let median = sketch.quantile(0.5, true).unwrap();
+    assert_that!(median / n as f64, near(0.5, RANK_EPS_FOR_K_128));
+}
+
+#[test]
+fn test_cdf_and_pmf() {
+    let n = 100_000;
+    let mut sketch = DoublesSketch::default();
+    for i in 0..n {
+        sketch.update(i as f64);
+    }
+    let split_points = [25_000.0, 50_000.0, 75_000.0];
+    let cdf = sketch.cdf(&split_points, true).unwrap();
+    let pmf = sketch.pmf(&split_points, true).unwrap();
+    assert_eq!(cdf.len(), 4);
+    assert_eq!(pmf.len(), 4);
+    assert_eq!(cdf[3], 1.0);
+    for i in 0..3 {
+        assert_that!(cdf[i], near(0.25 * (i + 1) as f64, RANK_EPS_FOR_K_128));
+    }
+    for mass in pmf {
+        assert_that!(mass, near(0.25, RANK_EPS_FOR_K_128));
+    }
+}
+
+#[test]
+fn test_merge() {
+    let n = 100_000;
+    let mut left = DoublesSketch::default();
+    let mut right = DoublesSketch::default();
+    for i in 0..n {
+        left.update(i as f64);
+        right.update((n + i) as f64);
+    }
+    left.merge(&right);
+    assert_eq!(left.n(), 2 * n);
+    assert_eq!(left.k(), 128);
+    assert_eq!(left.min_item(), Some(0.0));
+    assert_eq!(left.max_item(), Some((2 * n - 1) as f64));
+    let median = left.quantile(0.5, true).unwrap();
+    assert_that!(median / (2 * n) as f64, near(0.5, RANK_EPS_FOR_K_128));
+}
+
+#[test]
+fn test_merge_with_empty() {
+    let mut sketch = DoublesSketch::default();
+    sketch.update(1.0);
+    sketch.merge(&DoublesSketch::default());
+    assert_eq!(sketch.n(), 1);
+
+    let mut empty = DoublesSketch::default();
+    empty.merge(&sketch);
+    assert_eq!(empty.n(), 1);
+    assert_eq!(empty.min_item(), Some(1.0));
+    assert_eq!(empty.max_item(), Some(1.0));
+}
+
+#[test]
+fn test_merge_different_k() {
+    let n = 100_000;
+    let mut small = DoublesSketch::new(64);
+    let mut large = DoublesSketch::new(256);
+    for i in 0..n {
+        small.update(i as f64);
+        large.update((n + i) as f64);
+    }
+
+    // the result of merging two estimating sketches takes the smaller k
+    let mut merged = large.clone();
+    merged.merge(&small);
+    assert_eq!(merged.k(), 64);
+    assert_eq!(merged.n(), 2 * n);
+    assert_eq!(merged.min_item(), Some(0.0));
+    assert_eq!(merged.max_item(), Some((2 * n - 1) as f64));
+    let median = merged.quantile(0.5, true).unwrap();
+    assert_that!(median / (2 * n) as f64, near(0.5, 0.05));
+
+    small.merge(&large);
+    assert_eq!(small.k(), 64);
+    assert_eq!(small.n(), 2 * n);
+    let median = small.quantile(0.5, true).unwrap();
+    assert_that!(median / (2 * n) as f64, near(0.5, 0.05));
+}
+
+#[test]
+fn test_merge_exact_into_estimating() {
+    let mut exact = DoublesSketch::new(256);
+    for i in 0..100 {
+        exact.update(i as f64);
+    }
+    let mut estimating = DoublesSketch::new(64);
+    for i in 100..10_000 {
+        estimating.update(i as f64);
+    }
+    exact.merge(&estimating);
+    assert_eq!(exact.k(), 64);
+    assert_eq!(exact.n(), 10_000);
+    assert_eq!(exact.min_item(), Some(0.0));
+    assert_eq!(exact.max_item(), Some(9999.0));
+}
+
+#[test]
+fn test_sorted_view() {
+    let mut sketch = DoublesSketch::default();
+    assert!(sketch.sorted_view().is_empty());
+
+    let n = 100_000;
+    for i in 0..n {
+        sketch.update(i as f64);
+    }
+    let view = sketch.sorted_view();
+    assert_eq!(view.len(), sketch.num_retained());
+    assert_eq!(view.total_weight(), n);
+
+    let mut previous_item = f64::NEG_INFINITY;
+    let mut previous_cumulative = 0;
+    for (&item, weight, cumulative) in view.iter() {
+        assert!(item >= previous_item);
+        assert_eq!(cumulative, previous_cumulative + weight);
+        previous_item = item;
+        previous_cumulative = cumulative;
+    }
+    assert_eq!(previous_cumulative, n);
+}
+
+#[test]
+fn test_normalized_rank_error() {
+    assert_that!(
+        quantiles::normalized_rank_error(128, false),
+        near(0.0141, 1e-4)
+    );
+    assert_that!(
+        quantiles::normalized_rank_error(128, true),
+        near(0.0171, 1e-4)
+    );
+    assert_eq!(
+        DoublesSketch::default().normalized_rank_error(true),
+        quantiles::normalized_rank_error(128, true)
+    );
+}
+
+#[test]
+fn test_k_from_epsilon() {
+    for pmf in [false, true] {
+        for lg_k in 1..=15 {
+            let k = 1 << lg_k;
+            let eps = quantiles::normalized_rank_error(k, pmf);
+            assert_eq!(quantiles::k_from_epsilon(eps, pmf), k);
+        }
+        let k = quantiles::k_from_epsilon(0.005, pmf);
+        assert!(k.is_power_of_two());
+        assert!(quantiles::normalized_rank_error(k, pmf) <= 0.005);
+        assert!(quantiles::normalized_rank_error(k / 2, pmf) > 0.005);
+    }
+    assert_eq!(quantiles::k_from_epsilon(0.9, false), 2);
+    assert_eq!(quantiles::k_from_epsilon(0.0, false), 1 << 15);
+}
+
+#[test]
+fn test_partition_boundaries() {
+    let n = 1_000_000u64;
+    let mut sketch = DoublesSketch::new(128);
+    for i in 0..n {
+        sketch.update(((i * 7_919) % n) as f64);
+    }
+    let eps = sketch.normalized_rank_error(true);
+
+    let partition = sketch.partition_boundaries(8, false).unwrap();
+    assert_eq!(partition.boundaries()[0], 0.0);
+    assert_eq!(partition.boundaries()[8], (n - 1) as f64);
+    let sizes = partition.part_sizes();
+    assert_eq!(sizes.iter().sum::<u64>(), n);
+    for size in sizes {
+        assert!(
+            (size as f64 / n as f64 - 0.125).abs() <= 2.0 * eps,
+            "part of {size} items"
+        );
+    }
+
+    assert!(
+        DoublesSketch::default()
+            .partition_boundaries(8, false)
+            .is_none()
+    );
+}
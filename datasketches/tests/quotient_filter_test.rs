@@ -0,0 +1,194 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "quotient")]
+
+use datasketches::quotient::QuotientFilter;
+use datasketches::quotient::QuotientFilterBuilder;
+
+#[test]
+fn test_empty_filter() {
+    let filter = QuotientFilterBuilder::with_size(10, 8).build();
+    assert!(filter.is_empty());
+    assert_eq!(filter.num_entries(), 0);
+    assert_eq!(filter.num_slots(), 1024);
+    assert_eq!(filter.load_factor(), 0.0);
+    assert_eq!(filter.estimated_fpp(), 0.0);
+    assert!(!filter.contains(&"anything"));
+}
+
+#[test]
+fn test_no_false_negatives() {
+    let mut filter = QuotientFilterBuilder::with_accuracy(10_000, 0.01).build();
+    for i in 0..10_000u64 {
+        filter.insert(i);
+    }
+    for i in 0..10_000u64 {
+        assert!(filter.contains(&i), "false negative for {i}");
+    }
+    assert_eq!(filter.lg_num_slots(), 14);
+}
+
+#[test]
+fn test_false_positive_rate() {
+    let mut filter = QuotientFilterBuilder::with_accuracy(10_000, 0.01).build();
+    for i in 0..10_000u64 {
+        filter.insert(i);
+    }
+
+    let false_positives = (10_000..110_000u64).filter(|i| filter.contains(i)).count();
+    let observed = false_positives as f64 / 100_000.0;
+    assert!(observed < 0.01, "observed fpp {observed}");
+    assert!((observed - filter.estimated_fpp()).abs() < 0.002);
+}
+
+#[test]
+fn test_duplicates_are_not_counted() {
+    let mut filter = QuotientFilterBuilder::with_size(8, 16).build();
+    for _ in 0..3 {
+        filter.insert("apple");
+        filter.insert("banana");
+    }
+    assert_eq!(filter.num_entries(), 2);
+}
+
+#[test]
+fn test_expansion() {
+    let mut filter = QuotientFilterBuilder::with_size(6, 14).build();
+    for i in 0..5_000u64 {
+        filter.insert(i);
+    }
+    assert_eq!(filter.lg_num_slots(), 13);
+    assert_eq!(filter.fingerprint_bits(), 7);
+    assert!(filter.load_factor() <= 0.9);
+    for i in 0..5_000u64 {
+        assert!(filter.contains(&i));
+    }
+}
+
+#[test]
+fn test_reset() {
+    let mut filter = QuotientFilterBuilder::with_size(8, 10).build();
+    for i in 0..100u64 {
+        filter.insert(i);
+    }
+    filter.reset();
+    assert!(filter.is_empty());
+    assert_eq!(filter.lg_num_slots(), 8);
+    assert!(!filter.contains(&1u64));
+}
+
+#[test]
+fn test_union_of_different_sizes() {
+    let mut small = QuotientFilterBuilder::with_size(8, 16).build();
+    let mut large = QuotientFilterBuilder::with_size(12, 12).build();
+    for i in 0..200u64 {
+        small.insert(i);
+    }
+    for i in 100..2_000u64 {
+        large.insert(i);
+    }
+    assert!(small.is_compatible(&large));
+
+    small.union(&large);
+    for i in 0..2_000u64 {
+        assert!(small.contains(&i));
+    }
+    assert!(small.lg_num_slots() >= 12);
+    assert!(small.num_entries() <= 2_000);
+    assert!(small.num_entries() > 1_990);
+}
+
+#[test]
+#[should_panic(expected = "Cannot union incompatible quotient filters")]
+fn test_union_incompatible_seed() {
+    let mut f1 = QuotientFilterBuilder::with_size(8, 8).seed(1).build();
+    let f2 = QuotientFilterBuilder::with_size(8, 8).seed(2).build();
+    f1.union(&f2);
+}
+
+#[test]
+#[should_panic(expected = "lg_num_slots + fingerprint_bits must be at most 64")]
+fn test_invalid_size() {
+    QuotientFilterBuilder::with_size(31, 40);
+}
+
+#[test]
+fn test_serialize_empty() {
+    let filter = QuotientFilterBuilder::with_size(10, 9).seed(7).build();
+    let bytes = filter.serialize();
+    assert_eq!(bytes.len(), 16);
+    assert_eq!(bytes[0], 2);
+    assert_eq!(bytes[2], 22);
+
+    let restored = QuotientFilter::deserialize(&bytes).unwrap();
+    assert_eq!(restored, filter);
+}
+
+#[test]
+fn test_empty_image_claiming_a_huge_slot_array() {
+    let mut bytes = QuotientFilterBuilder::with_size(10, 9).build().serialize();
+    // 2^31 slots of 36 bits each would take 9 GiB, which a 16-byte image must not allocate
+    bytes[4] = 31;
+    bytes[5] = 33;
+    assert!(QuotientFilter::deserialize(&bytes).is_err());
+    assert!(QuotientFilter::read_from(&mut bytes.as_slice()).is_err());
+
+    bytes[4] = 20;
+    bytes[5] = 13;
+    let restored = QuotientFilter::deserialize(&bytes).unwrap();
+    assert!(restored.is_empty());
+    assert_eq!(restored.lg_num_slots(), 20);
+}
+
+#[test]
+fn test_serialize_round_trip() {
+    let mut filter = QuotientFilterBuilder::with_size(10, 13).build();
+    for i in 0..900u64 {
+        filter.insert(i);
+    }
+    let bytes = filter.serialize();
+    // 1024 slots of 16 bits each
+    assert_eq!(bytes.len(), 24 + 2048);
+
+    let restored = QuotientFilter::deserialize(&bytes).unwrap();
+    assert_eq!(restored, filter);
+    for i in 0..900u64 {
+        assert!(restored.contains(&i));
+    }
+}
+
+#[test]
+fn test_deserialize_errors() {
+    let mut filter = QuotientFilterBuilder::with_size(6, 10).build();
+    filter.insert("a");
+    let bytes = filter.serialize();
+
+    assert!(QuotientFilter::deserialize(&bytes[..bytes.len() - 1]).is_err());
+
+    let mut wrong_family = bytes.clone();
+    wrong_family[2] = 21;
+    assert!(QuotientFilter::deserialize(&wrong_family).is_err());
+
+    let mut wrong_size = bytes.clone();
+    wrong_size[5] = 62;
+    assert!(QuotientFilter::deserialize(&wrong_size).is_err());
+
+    let mut wrong_count = bytes;
+    wrong_count[16] = 2;
+    assert!(QuotientFilter::deserialize(&wrong_count).is_err());
+}
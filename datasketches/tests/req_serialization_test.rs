@@ -0,0 +1,177 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "req")]
+
+mod common;
+
+use std::fs;
+use std::path::PathBuf;
+
+use common::serialization_test_data;
+use datasketches::error::ErrorKind;
+use datasketches::req::RankAccuracy;
+use datasketches::req::ReqSketch;
+use googletest::assert_that;
+use googletest::prelude::near;
+
+fn test_sketch_file(path: PathBuf, n: u64, check_roundtrip: bool) {
+    let bytes = fs::read(&path).unwrap();
+    let sketch = ReqSketch::deserialize(&bytes).unwrap();
+
+    let path = path.display();
+    assert_eq!(sketch.n(), n, "filepath: {path}");
+    assert_eq!(sketch.is_empty(), n == 0, "filepath: {path}");
+    assert_eq!(sketch.k(), 12, "filepath: {path}");
+    if n > 0 {
+        assert_eq!(sketch.min_item(), Some(1.0), "filepath: {path}");
+        assert_eq!(sketch.max_item(), Some(n as f32), "filepath: {path}");
+        assert_eq!(sketch.rank(n as f32, true), Some(1.0), "filepath: {path}");
+        assert_that!(
+            sketch.rank((n / 2) as f32, true).unwrap(),
+            near(0.5, 0.02),
+            "filepath: {path}"
+        );
+    }
+
+    if check_roundtrip {
+        assert_eq!(bytes, sketch.serialize(), "filepath: {path}");
+    }
+}
+
+#[test]
+fn test_deserialize_from_java_snapshots() {
+    let ns = [0, 1, 10, 100, 1000, 10_000, 100_000, 1_000_000];
+    for n in ns {
+        let filename = format!("req_float_n{}_java.sk", n);
+        let path = serialization_test_data("java_generated_files", &filename);
+        test_sketch_file(path, n, false);
+    }
+}
+
+#[test]
+fn test_deserialize_from_cpp_snapshots() {
+    let ns = [0, 1, 10, 100, 1000, 10_000, 100_000, 1_000_000];
+    for n in ns {
+        let filename = format!("req_float_n{}_cpp.sk", n);
+        let path = serialization_test_data("cpp_generated_files", &filename);
+        test_sketch_file(path, n, true);
+    }
+}
+
+#[test]
+fn test_empty() {
+    let sketch = ReqSketch::new(20, RankAccuracy::LowRanks);
+    let bytes = sketch.serialize();
+    assert_eq!(bytes.len(), 8);
+
+    let decoded = ReqSketch::deserialize(&bytes).unwrap();
+    assert!(decoded.is_empty());
+    assert_eq!(decoded.k(), 20);
+    assert_eq!(decoded.rank_accuracy(), RankAccuracy::LowRanks);
+}
+
+#[test]
+fn test_raw_items() {
+    let mut sketch = ReqSketch::default();
+    for value in [3.0, 1.0, 2.0] {
+        sketch.update(value);
+    }
+    let bytes = sketch.serialize();
+    // up to 4 items are stored without a compactor header
+    assert_eq!(bytes.len(), 8 + 4 * 3);
+
+    let decoded = ReqSketch::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.n(), 3);
+    assert_eq!(decoded.min_item(), Some(1.0));
+    assert_eq!(decoded.max_item(), Some(3.0));
+    assert_eq!(decoded.rank(2.0, true), Some(2.0 / 3.0));
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_exact_mode() {
+    let mut sketch = ReqSketch::default();
+    for i in 0..50 {
+        sketch.update(i as f32);
+    }
+    let bytes = sketch.serialize();
+    // short preamble, then one compactor
+    assert_eq!(bytes.len(), 8 + 20 + 4 * 50);
+
+    let decoded = ReqSketch::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.n(), 50);
+    assert_eq!(decoded.min_item(), Some(0.0));
+    assert_eq!(decoded.max_item(), Some(49.0));
+    assert_eq!(decoded.rank(10.0, true), sketch.rank(10.0, true));
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_estimation_mode() {
+    for rank_accuracy in [RankAccuracy::HighRanks, RankAccuracy::LowRanks] {
+        let mut sketch = ReqSketch::new(12, rank_accuracy);
+        for i in 0..100_000 {
+            sketch.update(i as f32);
+        }
+        let bytes = sketch.serialize();
+
+        let mut decoded = ReqSketch::deserialize(&bytes).unwrap();
+        assert_eq!(decoded.rank_accuracy(), rank_accuracy);
+        assert_eq!(decoded.n(), sketch.n());
+        assert_eq!(decoded.num_retained(), sketch.num_retained());
+        assert_eq!(decoded.min_item(), sketch.min_item());
+        assert_eq!(decoded.max_item(), sketch.max_item());
+        assert_eq!(decoded.rank(50_000.0, true), sketch.rank(50_000.0, true));
+        assert_eq!(decoded.quantile(0.5, true), sketch.quantile(0.5, true));
+        assert_eq!(decoded.serialize(), bytes);
+
+        // a deserialized sketch keeps accepting updates
+        for i in 100_000..200_000 {
+            decoded.update(i as f32);
+        }
+        assert_eq!(decoded.n(), 200_000);
+        assert_eq!(decoded.max_item(), Some(199_999.0));
+    }
+}
+
+#[test]
+fn test_deserialize_invalid() {
+    let mut sketch = ReqSketch::default();
+    for i in 0..1000 {
+        sketch.update(i as f32);
+    }
+    let bytes = sketch.serialize();
+
+    let err = ReqSketch::deserialize(&bytes[..bytes.len() - 1]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut wrong_family = bytes.clone();
+    wrong_family[2] = 15;
+    let err = ReqSketch::deserialize(&wrong_family).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut wrong_preamble_ints = bytes.clone();
+    wrong_preamble_ints[0] = 2;
+    let err = ReqSketch::deserialize(&wrong_preamble_ints).unwrap_err();
+    assert!(err.message().contains("invalid preamble ints"));
+
+    let mut wrong_n = bytes.clone();
+    wrong_n[8] += 1;
+    let err = ReqSketch::deserialize(&wrong_n).unwrap_err();
+    assert!(err.message().contains("inconsistent"));
+}
@@ -0,0 +1,286 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "req")]
+
+use datasketches::common::NumStdDev;
+use datasketches::req::RankAccuracy;
+use datasketches::req::ReqSketch;
+use googletest::assert_that;
+use googletest::prelude::near;
+
+#[test]
+fn test_empty() {
+    let sketch = ReqSketch::default();
+    assert!(sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.k(), 12);
+    assert_eq!(sketch.rank_accuracy(), RankAccuracy::HighRanks);
+    assert_eq!(sketch.n(), 0);
+    assert_eq!(sketch.num_retained(), 0);
+    assert_eq!(sketch.min_item(), None);
+    assert_eq!(sketch.max_item(), None);
+    assert_eq!(sketch.rank(0.0, true), None);
+    assert_eq!(sketch.quantile(0.5, true), None);
+
+    let split_points = [0.0];
+    assert_eq!(sketch.pmf(&split_points, true), None);
+    assert_eq!(sketch.cdf(&split_points, true), None);
+}
+
+#[test]
+#[should_panic(expected = "k must be even and in [4, 1024]")]
+fn test_odd_k() {
+    ReqSketch::new(13, RankAccuracy::HighRanks);
+}
+
+#[test]
+#[should_panic(expected = "k must be even and in [4, 1024]")]
+fn test_k_too_small() {
+    ReqSketch::new(2, RankAccuracy::HighRanks);
+}
+
+#[test]
+fn test_nan_is_ignored() {
+    let mut sketch = ReqSketch::default();
+    sketch.update(f32::NAN);
+    assert!(sketch.is_empty());
+    sketch.update(1.0);
+    sketch.update(f32::NAN);
+    assert_eq!(sketch.n(), 1);
+}
+
+#[test]
+#[should_panic(expected = "item must not be NaN")]
+fn test_rank_of_nan() {
+    let mut sketch = ReqSketch::default();
+    sketch.update(1.0);
+    sketch.rank(f32::NAN, true);
+}
+
+#[test]
+#[should_panic(expected = "rank must be in [0.0, 1.0]")]
+fn test_quantile_of_invalid_rank() {
+    let mut sketch = ReqSketch::default();
+    sketch.update(1.0);
+    sketch.quantile(-0.1, true);
+}
+
+#[test]
+#[should_panic(expected = "split_points must be unique and monotonically increasing")]
+fn test_unsorted_split_points() {
+    let mut sketch = ReqSketch::default();
+    sketch.update(1.0);
+    sketch.pmf(&[1.0, 1.0], true);
+}
+
+#[test]
+fn test_exact_mode() {
+    let mut sketch = ReqSketch::default();
+    // the nominal capacity of the first compactor is 2 * 3 * k = 72
+    for i in 0..70 {
+        sketch.update(i as f32);
+    }
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.num_retained(), 70);
+    assert_eq!(sketch.min_item(), Some(0.0));
+    assert_eq!(sketch.max_item(), Some(69.0));
+    for i in 0..70 {
+        let value = i as f32;
+        assert_eq!(sketch.rank(value, false), Some(i as f64 / 70.0));
+        assert_eq!(sketch.rank(value, true), Some((i + 1) as f64 / 70.0));
+        let rank = (i + 1) as f64 / 70.0;
+        assert_eq!(sketch.rank_lower_bound(rank, NumStdDev::Two), rank);
+        assert_eq!(sketch.rank_upper_bound(rank, NumStdDev::Two), rank);
+    }
+    assert_eq!(sketch.quantile(0.5, true), Some(34.0));
+    assert_eq!(sketch.quantile(0.5, false), Some(35.0));
+}
+
+#[test]
+fn test_high_rank_accuracy() {
+    let n = 1_000_000;
+    let mut sketch = ReqSketch::default();
+    for i in 0..n {
+        sketch.update(i as f32);
+    }
+    assert!(sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), n);
+    assert!(sketch.num_retained() < 2000);
+    assert_eq!(sketch.min_item(), Some(0.0));
+    assert_eq!(sketch.max_item(), Some((n - 1) as f32));
+
+    // the error shrinks towards the high end of the rank domain
+    for (rank, eps) in [(0.5, 0.02), (0.99, 0.002), (0.9999, 0.0001)] {
+        let value = sketch.quantile(rank, true).unwrap() as f64;
+        assert_that!(value / n as f64, near(rank, eps));
+    }
+    let rank = sketch.rank((n - 100) as f32, true).unwrap();
+    assert_that!(rank, near(1.0 - 100.0 / n as f64, 1e-5));
+}
+
+#[test]
+fn test_low_rank_accuracy() {
+    let n = 1_000_000;
+    let mut sketch = ReqSketch::new(12, RankAccuracy::LowRanks);
+    for i in 0..n {
+        sketch.update(i as f32);
+    }
+    assert!(sketch.is_estimation_mode());
+    for (rank, eps) in [(0.5, 0.02), (0.01, 0.002), (0.0001, 0.0001)] {
+        let value = sketch.quantile(rank, true).unwrap() as f64;
+        assert_that!(value / n as f64, near(rank, eps));
+    }
+    let rank = sketch.rank(100.0, true).unwrap();
+    assert_that!(rank, near(101.0 / n as f64, 1e-5));
+}
+
+#[test]
+fn test_rank_bounds() {
+    let n = 100_000;
+    let mut sketch = ReqSketch::default();
+    for i in 0..n {
+        sketch.update(i as f32);
+    }
+    for i in (0..n).step_by(1000) {
+        let true_rank = (i + 1) as f64 / n as f64;
+        let rank = sketch.rank(i as f32, true).unwrap();
+        let lower = sketch.rank_lower_bound(rank, NumStdDev::Three);
+        let upper = sketch.rank_upper_bound(rank, NumStdDev::Three);
+        assert!(lower <= rank && rank <= upper);
+        assert!(
+            lower <= true_rank && true_rank <= upper,
+            "{true_rank} not in [{lower}, {upper}]"
+        );
+    }
+}
+
+#[test]
+fn test_cdf_and_pmf() {
+    let n = 100_000;
+    let mut sketch = ReqSketch::default();
+    for i in 0..n {
+        sketch.update(i as f32);
+    }
+    let split_points = [25_000.0, 50_000.0, 75_000.0];
+    let cdf = sketch.cdf(&split_points, true).unwrap();
+    let pmf = sketch.pmf(&split_points, true).unwrap();
+    assert_eq!(cdf.len(), 4);
+    assert_eq!(pmf.len(), 4);
+    assert_eq!(cdf[3], 1.0);
+    for i in 0..3 {
+        assert_that!(cdf[i], near(0.25 * (i + 1) as f64, 0.02));
+    }
+    for mass in pmf {
+        assert_that!(mass, near(0.25, 0.02));
+    }
+}
+
+#[test]
+fn test_merge() {
+    let n = 100_000;
+    let mut left = ReqSketch::default();
+    let mut right = ReqSketch::new(24, RankAccuracy::HighRanks);
+    for i in 0..n {
+        left.update(i as f32);
+        right.update((n + i) as f32);
+    }
+    left.merge(&right);
+    assert_eq!(left.n(), 2 * n);
+    assert_eq!(left.min_item(), Some(0.0));
+    assert_eq!(left.max_item(), Some((2 * n - 1) as f32));
+    let median = left.quantile(0.5, true).unwrap() as f64;
+    assert_that!(median / (2 * n) as f64, near(0.5, 0.02));
+    let p999 = left.quantile(0.999, true).unwrap() as f64;
+    assert_that!(p999 / (2 * n) as f64, near(0.999, 0.001));
+}
+
+#[test]
+fn test_merge_with_empty() {
+    let mut sketch = ReqSketch::default();
+    sketch.update(1.0);
+    sketch.merge(&ReqSketch::default());
+    assert_eq!(sketch.n(), 1);
+
+    let mut empty = ReqSketch::default();
+    empty.merge(&sketch);
+    assert_eq!(empty.n(), 1);
+    assert_eq!(empty.min_item(), Some(1.0));
+    assert_eq!(empty.max_item(), Some(1.0));
+}
+
+#[test]
+#[should_panic(expected = "cannot merge sketches with different rank accuracy modes")]
+fn test_merge_different_modes() {
+    let mut sketch = ReqSketch::new(12, RankAccuracy::HighRanks);
+    sketch.merge(&ReqSketch::new(12, RankAccuracy::LowRanks));
+}
+
+#[test]
+fn test_sorted_view() {
+    let mut sketch = ReqSketch::default();
+    assert!(sketch.sorted_view().is_empty());
+
+    let n = 100_000;
+    for i in 0..n {
+        sketch.update(i as f32);
+    }
+    let view = sketch.sorted_view();
+    assert_eq!(view.len(), sketch.num_retained());
+    assert_eq!(view.total_weight(), n);
+
+    let mut previous_item = f32::NEG_INFINITY;
+    let mut previous_cumulative = 0;
+    for (&item, weight, cumulative) in view.iter() {
+        assert!(item >= previous_item);
+        assert_eq!(cumulative, previous_cumulative + weight);
+        previous_item = item;
+        previous_cumulative = cumulative;
+    }
+    assert_eq!(previous_cumulative, n);
+}
+
+#[test]
+fn test_to_string_with() {
+    let mut sketch = ReqSketch::new(12, RankAccuracy::LowRanks);
+    let empty = sketch.to_string();
+    assert!(empty.starts_with("### REQ sketch summary:\n"));
+    assert!(empty.contains("   High Rank Acc  : false\n"));
+    assert!(!empty.contains("Min item"));
+
+    sketch.extend((0..1000).map(|i| i as f32));
+    let summary = sketch.to_string();
+    assert_eq!(summary, sketch.to_string_with(false, false));
+    assert!(summary.contains("   N              : 1000\n"));
+    assert!(summary.contains("   Estimation mode: true\n"));
+    assert!(summary.contains("   Min item       : 0.0\n"));
+    assert!(summary.contains("   Max item       : 999.0\n"));
+
+    let dump = sketch.to_string_with(true, true);
+    let levels = dump
+        .split("### REQ sketch levels:\n")
+        .nth(1)
+        .unwrap()
+        .split("### End sketch levels\n")
+        .next()
+        .unwrap();
+    // the header and one line per compactor
+    assert!(levels.lines().count() > 2);
+    let data = dump.split("### REQ sketch data:\n").nth(1).unwrap();
+    let items = data.lines().filter(|line| line.starts_with("   ")).count();
+    assert_eq!(items, sketch.num_retained());
+}
@@ -0,0 +1,397 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Golden images written by this crate.
+//!
+//! Like the Java, C++ and Go generators, [`test_generate_rust_files`] writes one `.sk` file per
+//! sketch configuration into `tests/serialization_test_data/rust_generated_files`, named after
+//! what was fed to the sketch, such as `hll8_n1000_rust.sk`. It only runs when the
+//! `DSKETCH_TEST_GENERATE_RUST` environment variable is set:
+//!
+//! ```shell
+//! $ DSKETCH_TEST_GENERATE_RUST=1 cargo test --all-features --test rust_generated_files_test
+//! ```
+//!
+//! Besides the counts of [`NS`], each family is generated near the points where its state
+//! saturates, where implementations have historically diverged: the HLL, CPC and Theta
+//! sketches at 10^8 items, the Theta and Tuple hash tables on both sides of their first
+//! rebuild, and the Bloom filter close to every bit set. Generating them takes minutes
+//! without optimizations, so the generator is best run with `--release`.
+//!
+//! [`test_rust_files_are_stable`] serializes the same sketches again and compares them with the
+//! committed files byte for byte, so that a change of the serialized format fails here before
+//! any cross-language comparison. Regenerate the files only for an intended format change. The
+//! images of more than [`QUICK_MAX_N`] items are only regenerated for the comparison when
+//! `DSKETCH_TEST_LARGE_N` is set; the conformance suite still reads them on every run.
+
+mod common;
+
+use std::env;
+use std::fs;
+use std::path::PathBuf;
+
+use common::serialization_test_data;
+
+const GENERATE_ENV: &str = "DSKETCH_TEST_GENERATE_RUST";
+const LARGE_ENV: &str = "DSKETCH_TEST_LARGE_N";
+const SUB_DIR: &str = "rust_generated_files";
+
+/// Item counts of the generated images.
+#[allow(dead_code)] // unused when no family is enabled
+const NS: [u64; 6] = [0, 1, 10, 100, 1000, 10_000];
+
+/// The most items an image is regenerated from by default in [`test_rust_files_are_stable`].
+const QUICK_MAX_N: u64 = 1_000_000;
+
+/// The Theta and Tuple sketches of lg_k 12 retain every item until the 7681st, which triggers
+/// the first rebuild of their hash table at `15/16` of `2^13` entries.
+#[allow(dead_code)] // unused without the theta and tuple features
+const REBUILD_NS: [u64; 2] = [7680, 7681];
+
+/// Serializes a sketch of `n` items.
+type Generate = fn(n: u64) -> Vec<u8>;
+
+/// Deserializes an image and serializes the sketch again.
+type Reserialize = fn(bytes: &[u8]) -> Vec<u8>;
+
+/// The images written under one file name prefix.
+struct Golden {
+    prefix: &'static str,
+    generate: Generate,
+    /// Set for the sketches that compact at random, whose images are not reproducible once
+    /// they hold more items than their first level. Their committed images are checked to
+    /// survive a round trip unchanged instead.
+    reserialize: Option<Reserialize>,
+    /// Item counts generated on top of [`NS`], around the saturation points of the family.
+    saturation_ns: Vec<u64>,
+}
+
+impl Golden {
+    #[allow(dead_code)] // unused when no family is enabled
+    fn new(prefix: &'static str, generate: Generate) -> Self {
+        Self {
+            prefix,
+            generate,
+            reserialize: None,
+            saturation_ns: vec![],
+        }
+    }
+
+    #[allow(dead_code)] // unused when no family is enabled
+    fn saturating(mut self, ns: impl IntoIterator<Item = u64>) -> Self {
+        self.saturation_ns.extend(ns);
+        self
+    }
+
+    fn ns(&self) -> impl Iterator<Item = u64> + '_ {
+        NS.iter().chain(&self.saturation_ns).copied()
+    }
+
+    #[allow(dead_code)] // unused when no randomized family is enabled
+    fn randomized(mut self, reserialize: Reserialize) -> Self {
+        self.reserialize = Some(reserialize);
+        self
+    }
+}
+
+#[allow(clippy::vec_init_then_push)] // the pushes depend on the enabled features
+fn goldens() -> Vec<Golden> {
+    #[allow(unused_mut)] // empty when no family is enabled
+    let mut goldens = vec![];
+    #[cfg(feature = "hll")]
+    goldens.extend([
+        Golden::new("hll4", generate_hll::<4>).saturating([1_000_000, 100_000_000]),
+        Golden::new("hll6", generate_hll::<6>).saturating([1_000_000, 100_000_000]),
+        Golden::new("hll8", generate_hll::<8>).saturating([1_000_000, 100_000_000]),
+    ]);
+    #[cfg(feature = "cpc")]
+    goldens.push(Golden::new("cpc", generate_cpc).saturating([1_000_000, 100_000_000]));
+    #[cfg(feature = "theta")]
+    goldens.push(
+        Golden::new("theta", generate_theta)
+            .saturating(REBUILD_NS)
+            .saturating([1_000_000, 100_000_000]),
+    );
+    #[cfg(feature = "tuple")]
+    goldens.extend([
+        Golden::new("tuple_int", generate_tuple_int)
+            .saturating(REBUILD_NS)
+            .saturating([1_000_000]),
+        // shares the hash table of the sketches above
+        Golden::new("aod_2", generate_array_of_doubles),
+    ]);
+    #[cfg(feature = "kll")]
+    goldens.extend([
+        Golden::new("kll_double", generate_kll::<f64>)
+            .randomized(|b| {
+                datasketches::kll::KllSketch::<f64>::deserialize(b)
+                    .unwrap()
+                    .serialize()
+            })
+            .saturating([1_000_000, 100_000_000]),
+        Golden::new("kll_float", generate_kll::<f32>)
+            .randomized(|b| {
+                datasketches::kll::KllSketch::<f32>::deserialize(b)
+                    .unwrap()
+                    .serialize()
+            })
+            .saturating([1_000_000, 100_000_000]),
+    ]);
+    #[cfg(feature = "quantiles")]
+    goldens.push(
+        Golden::new("quantiles_double", generate_quantiles_double)
+            .randomized(|b| {
+                datasketches::quantiles::DoublesSketch::deserialize(b)
+                    .unwrap()
+                    .serialize()
+            })
+            .saturating([1_000_000, 100_000_000]),
+    );
+    #[cfg(feature = "req")]
+    goldens.push(
+        Golden::new("req_float", generate_req_float)
+            .randomized(|b| {
+                datasketches::req::ReqSketch::deserialize(b)
+                    .unwrap()
+                    .serialize()
+            })
+            .saturating([1_000_000]),
+    );
+    #[cfg(feature = "tdigest")]
+    goldens.push(Golden::new("tdigest_double", generate_tdigest_double).saturating([1_000_000]));
+    #[cfg(feature = "frequencies")]
+    goldens.extend([
+        Golden::new("frequent_long", generate_frequent_long).saturating([1_000_000]),
+        Golden::new("frequent_string", generate_frequent_string).saturating([1_000_000]),
+    ]);
+    // 3 hash functions over 2^16 bits leave about 1% of the bits unset at 10^5 items, and
+    // practically none at 10^6
+    #[cfg(feature = "bloom")]
+    goldens.push(Golden::new("bf_h3", generate_bloom).saturating([100_000, 1_000_000]));
+    #[cfg(feature = "countmin")]
+    goldens.push(Golden::new("count_min", generate_count_min).saturating([1_000_000]));
+    goldens
+}
+
+#[cfg(feature = "hll")]
+fn generate_hll<const BITS: u8>(n: u64) -> Vec<u8> {
+    use datasketches::hll::HllSketch;
+    use datasketches::hll::HllType;
+
+    let hll_type = match BITS {
+        4 => HllType::Hll4,
+        6 => HllType::Hll6,
+        _ => HllType::Hll8,
+    };
+    let mut sketch = HllSketch::new(12, hll_type);
+    sketch.extend(0..n);
+    sketch.serialize()
+}
+
+#[cfg(feature = "cpc")]
+fn generate_cpc(n: u64) -> Vec<u8> {
+    use datasketches::cpc::CpcSketch;
+
+    let mut sketch = CpcSketch::new(11);
+    for i in 0..n {
+        sketch.update(i);
+    }
+    sketch.serialize()
+}
+
+#[cfg(feature = "theta")]
+fn generate_theta(n: u64) -> Vec<u8> {
+    use datasketches::theta::ThetaSketchBuilder;
+
+    let mut sketch = ThetaSketchBuilder::default().lg_k(12).build();
+    sketch.extend(0..n);
+    sketch.compact(true).serialize()
+}
+
+#[cfg(feature = "tuple")]
+fn generate_tuple_int(n: u64) -> Vec<u8> {
+    use datasketches::tuple::DefaultUpdatePolicy;
+    use datasketches::tuple::TupleSketchBuilder;
+
+    let mut sketch = TupleSketchBuilder::new(DefaultUpdatePolicy::<i32>::default()).build();
+    for i in 0..n {
+        sketch.update(i, i as i32);
+    }
+    sketch.compact(true).serialize()
+}
+
+#[cfg(feature = "tuple")]
+fn generate_array_of_doubles(n: u64) -> Vec<u8> {
+    use datasketches::tuple::ArrayOfDoublesSketchBuilder;
+
+    let mut sketch = ArrayOfDoublesSketchBuilder::new(2).build();
+    for i in 0..n {
+        sketch.update(i, &[i as f64, -(i as f64)]);
+    }
+    sketch.compact(true).serialize()
+}
+
+#[cfg(feature = "kll")]
+fn generate_kll<T>(n: u64) -> Vec<u8>
+where
+    T: datasketches::kll::KllValue + From<u16>,
+{
+    use datasketches::kll::KllSketch;
+
+    let mut sketch = KllSketch::<T>::new(200);
+    for i in 0..n {
+        sketch.update(T::from(i as u16));
+    }
+    sketch.serialize()
+}
+
+#[cfg(feature = "quantiles")]
+fn generate_quantiles_double(n: u64) -> Vec<u8> {
+    use datasketches::quantiles::DoublesSketch;
+
+    let mut sketch = DoublesSketch::new(128);
+    for i in 0..n {
+        sketch.update(i as f64);
+    }
+    sketch.serialize()
+}
+
+#[cfg(feature = "req")]
+fn generate_req_float(n: u64) -> Vec<u8> {
+    use datasketches::req::RankAccuracy;
+    use datasketches::req::ReqSketch;
+
+    let mut sketch = ReqSketch::new(12, RankAccuracy::HighRanks);
+    for i in 0..n {
+        sketch.update(i as f32);
+    }
+    sketch.serialize()
+}
+
+#[cfg(feature = "tdigest")]
+fn generate_tdigest_double(n: u64) -> Vec<u8> {
+    use datasketches::tdigest::TDigestMut;
+
+    let mut td = TDigestMut::new(100);
+    for i in 0..n {
+        td.update(i as f64);
+    }
+    td.serialize()
+}
+
+#[cfg(feature = "frequencies")]
+fn generate_frequent_long(n: u64) -> Vec<u8> {
+    use datasketches::frequencies::FrequentItemsSketch;
+
+    let mut sketch = FrequentItemsSketch::<i64>::new(64);
+    for i in 0..n {
+        // a skewed stream, so that the heavy hitters survive the purges
+        sketch.update((i % (i / 10 + 1)) as i64);
+    }
+    sketch.serialize()
+}
+
+#[cfg(feature = "frequencies")]
+fn generate_frequent_string(n: u64) -> Vec<u8> {
+    use datasketches::frequencies::FrequentItemsSketch;
+
+    let mut sketch = FrequentItemsSketch::<String>::new(64);
+    for i in 0..n {
+        sketch.update((i % (i / 10 + 1)).to_string());
+    }
+    sketch.serialize()
+}
+
+#[cfg(feature = "bloom")]
+fn generate_bloom(n: u64) -> Vec<u8> {
+    use datasketches::bloom::BloomFilterBuilder;
+
+    let mut filter = BloomFilterBuilder::with_size(1 << 16, 3).build();
+    for i in 0..n {
+        filter.insert(i);
+    }
+    filter.serialize()
+}
+
+#[cfg(feature = "countmin")]
+fn generate_count_min(n: u64) -> Vec<u8> {
+    use datasketches::countmin::CountMinSketch;
+
+    // the seed of the C++ images, which the conformance suite reads them with
+    let mut sketch = CountMinSketch::<u64>::with_seed(3, 128, 9001);
+    for i in 0..n {
+        sketch.update(i);
+    }
+    sketch.serialize()
+}
+
+/// Returns the file name of the image of `n` items generated under `prefix`.
+fn file_name(prefix: &str, n: u64) -> String {
+    match prefix.split_once('_') {
+        // the Bloom filter images put the count before the number of hash functions
+        Some(("bf", hashes)) => format!("bf_n{n}_{hashes}_rust.sk"),
+        _ => format!("{prefix}_n{n}_rust.sk"),
+    }
+}
+
+#[test]
+fn test_generate_rust_files() {
+    if env::var_os(GENERATE_ENV).is_none() {
+        eprintln!("set {GENERATE_ENV} to write the Rust generated files");
+        return;
+    }
+
+    let dir = PathBuf::from(env!("CARGO_MANIFEST_DIR"))
+        .join("tests/serialization_test_data")
+        .join(SUB_DIR);
+    fs::create_dir_all(&dir).unwrap();
+    for golden in goldens() {
+        for n in golden.ns() {
+            fs::write(dir.join(file_name(golden.prefix, n)), (golden.generate)(n)).unwrap();
+        }
+    }
+}
+
+#[test]
+fn test_rust_files_are_stable() {
+    if env::var_os(GENERATE_ENV).is_some() {
+        // the files are being rewritten concurrently
+        return;
+    }
+
+    let large = env::var_os(LARGE_ENV).is_some();
+    let mut changed = vec![];
+    for golden in goldens() {
+        for n in golden.ns() {
+            let name = file_name(golden.prefix, n);
+            let expected = fs::read(serialization_test_data(SUB_DIR, &name)).unwrap();
+            let actual = match golden.reserialize {
+                Some(reserialize) => reserialize(&expected),
+                None if n > QUICK_MAX_N && !large => continue,
+                None => (golden.generate)(n),
+            };
+            if actual != expected {
+                changed.push(name);
+            }
+        }
+    }
+    assert!(
+        changed.is_empty(),
+        "the serialized images of {changed:?} changed; if the format change is intended, \
+         regenerate them with {GENERATE_ENV}=1"
+    );
+}
@@ -0,0 +1,182 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "sampling")]
+
+use datasketches::sampling::EbppsItemsSketch;
+
+#[test]
+fn test_empty() {
+    let sketch = EbppsItemsSketch::<u64>::new(16);
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.k(), 16);
+    assert_eq!(sketch.n(), 0);
+    assert_eq!(sketch.c(), 0.0);
+    assert_eq!(sketch.cumulative_weight(), 0.0);
+    assert!(sketch.sample().is_empty());
+}
+
+#[test]
+#[should_panic(expected = "k must be in")]
+fn test_k_too_small() {
+    EbppsItemsSketch::<u64>::new(0);
+}
+
+#[test]
+#[should_panic(expected = "weight must be non-negative and finite")]
+fn test_invalid_weight() {
+    let mut sketch = EbppsItemsSketch::new(4);
+    sketch.update(1u64, f64::NAN);
+}
+
+#[test]
+fn test_zero_weight_is_ignored() {
+    let mut sketch = EbppsItemsSketch::new(4);
+    sketch.update(1u64, 0.0);
+    assert!(sketch.is_empty());
+}
+
+#[test]
+fn test_exact_mode() {
+    let mut sketch = EbppsItemsSketch::new(8);
+    for i in 0..8u64 {
+        sketch.update(i, 1.0);
+    }
+    assert_eq!(sketch.c(), 8.0);
+    let mut sample: Vec<_> = sketch.sample().into_iter().copied().collect();
+    sample.sort();
+    assert_eq!(sample, (0..8).collect::<Vec<_>>());
+}
+
+#[test]
+fn test_heavy_item_bounds_sample_size() {
+    // with one item of weight 10 among ten of weight 1, inclusion probabilities proportional to
+    // weight cap the expected sample size at 20 / 10 = 2
+    let mut sketch = EbppsItemsSketch::new(8);
+    sketch.update(0u64, 10.0);
+    for i in 1..=10u64 {
+        sketch.update(i, 1.0);
+    }
+    assert!((sketch.c() - 2.0).abs() < 1e-12, "c: {}", sketch.c());
+    assert!(sketch.sample().contains(&&0));
+}
+
+#[test]
+fn test_inclusion_is_proportional_to_weight() {
+    // item i has weight i + 1, so it should be in the sample i + 1 times as often as item 0
+    let trials = 2000;
+    let mut counts = [0u32; 10];
+    for _ in 0..trials {
+        let mut sketch = EbppsItemsSketch::new(5);
+        for i in 0..10usize {
+            sketch.update(i, (i + 1) as f64);
+        }
+        assert!((sketch.c() - 5.0).abs() < 1e-9);
+        let sample = sketch.sample();
+        assert!((4..=5).contains(&sample.len()));
+        for &i in sample {
+            counts[i] += 1;
+        }
+    }
+    for (i, &count) in counts.iter().enumerate() {
+        // the inclusion probability is 5 * (i + 1) / 55
+        let expected = trials as f64 * 5.0 * (i + 1) as f64 / 55.0;
+        let tolerance = 4.0 * expected.sqrt() + 10.0;
+        assert!(
+            (count as f64 - expected).abs() < tolerance,
+            "item {i}: {count} vs {expected}"
+        );
+    }
+}
+
+#[test]
+fn test_merge() {
+    let mut left = EbppsItemsSketch::new(10);
+    let mut right = EbppsItemsSketch::new(10);
+    for i in 0..100u64 {
+        left.update(i, 1.0);
+    }
+    for i in 100..400u64 {
+        right.update(i, 1.0);
+    }
+
+    let mut merged = left.clone();
+    merged.merge(&right);
+    assert_eq!(merged.n(), 400);
+    assert_eq!(merged.cumulative_weight(), 400.0);
+    assert!((merged.c() - 10.0).abs() < 1e-9, "c: {}", merged.c());
+
+    // merging is symmetric in the resulting state
+    let mut reversed = right.clone();
+    reversed.merge(&left);
+    assert_eq!(reversed.n(), 400);
+    assert_eq!(reversed.cumulative_weight(), 400.0);
+
+    merged.merge(&EbppsItemsSketch::new(10));
+    assert_eq!(merged.n(), 400);
+}
+
+#[test]
+fn test_merge_into_empty_sketch_with_smaller_k() {
+    let mut heavy = EbppsItemsSketch::new(20);
+    for i in 0..100u64 {
+        heavy.update(i, 1.0);
+    }
+
+    let mut merged = EbppsItemsSketch::new(5);
+    merged.merge(&heavy);
+    assert_eq!(merged.k(), 5);
+    assert!((merged.c() - 5.0).abs() < 1e-9, "c: {}", merged.c());
+    assert!(merged.sample().len() <= 5);
+
+    let decoded = EbppsItemsSketch::<u64>::deserialize(&merged.serialize()).unwrap();
+    assert_eq!(decoded, merged);
+}
+
+#[test]
+fn test_merge_is_proportional_to_weight() {
+    // the right stream holds three quarters of the weight
+    let trials = 500;
+    let mut from_right = 0;
+    for _ in 0..trials {
+        let mut left = EbppsItemsSketch::new(8);
+        let mut right = EbppsItemsSketch::new(8);
+        for i in 0..100u64 {
+            left.update(i, 1.0);
+            right.update(i + 100, 3.0);
+        }
+        left.merge(&right);
+        from_right += left.sample().iter().filter(|&&&i| i >= 100).count();
+    }
+    let expected = trials as f64 * 8.0 * 0.75;
+    assert!(
+        (from_right as f64 - expected).abs() < 0.05 * expected,
+        "{from_right} vs {expected}"
+    );
+}
+
+#[test]
+fn test_reset() {
+    let mut sketch = EbppsItemsSketch::new(4);
+    for i in 0..100u64 {
+        sketch.update(i, 1.0);
+    }
+    sketch.reset();
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.k(), 4);
+    assert_eq!(sketch.c(), 0.0);
+}
@@ -0,0 +1,222 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "sampling")]
+
+use datasketches::sampling::ReservoirItemsSketch;
+use datasketches::sampling::ReservoirUnion;
+
+#[test]
+fn test_empty() {
+    let sketch = ReservoirItemsSketch::<u64>::new(16);
+    assert!(sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.k(), 16);
+    assert_eq!(sketch.n(), 0);
+    assert_eq!(sketch.num_samples(), 0);
+    assert_eq!(sketch.implicit_sample_weight(), 1.0);
+    assert_eq!(sketch.estimate_subset_sum(|_| true).estimate(), 0.0);
+}
+
+#[test]
+#[should_panic(expected = "k must be at least 2")]
+fn test_k_too_small() {
+    ReservoirItemsSketch::<u64>::new(1);
+}
+
+#[test]
+fn test_exact_mode() {
+    let mut sketch = ReservoirItemsSketch::new(16);
+    for i in 0..16u64 {
+        sketch.update(i);
+    }
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.num_samples(), 16);
+    assert_eq!(sketch.samples(), (0..16).collect::<Vec<_>>());
+    let summary = sketch.estimate_subset_sum(|&i| i < 4);
+    assert_eq!(summary.lower_bound(), 4.0);
+    assert_eq!(summary.estimate(), 4.0);
+    assert_eq!(summary.upper_bound(), 4.0);
+    assert_eq!(summary.total_sketch_weight(), 16.0);
+}
+
+#[test]
+fn test_estimation_mode() {
+    let mut sketch = ReservoirItemsSketch::new(1000);
+    for i in 0..100_000u64 {
+        sketch.update(i);
+    }
+    assert!(sketch.is_estimation_mode());
+    assert_eq!(sketch.n(), 100_000);
+    assert_eq!(sketch.num_samples(), 1000);
+    assert_eq!(sketch.implicit_sample_weight(), 100.0);
+
+    let mut samples = sketch.samples().to_vec();
+    samples.sort();
+    samples.dedup();
+    assert_eq!(samples.len(), 1000);
+
+    // a quarter of the items are below 25,000; the sample is off by a few standard deviations
+    // at most, which is about 1,400 items here
+    let summary = sketch.estimate_subset_sum(|&i| i < 25_000);
+    let estimate = summary.estimate();
+    assert!(
+        (20_000.0..=30_000.0).contains(&estimate),
+        "estimate: {estimate}"
+    );
+    assert!(summary.lower_bound() < estimate && estimate < summary.upper_bound());
+    assert_eq!(summary.total_sketch_weight(), 100_000.0);
+}
+
+#[test]
+fn test_update_with_weight() {
+    let mut sketch = ReservoirItemsSketch::new(4);
+    sketch.update_with_weight(7u64, 0);
+    assert!(sketch.is_empty());
+    sketch.update_with_weight(7, 3);
+    assert_eq!(sketch.n(), 3);
+    assert_eq!(sketch.samples(), [7, 7, 7]);
+    sketch.update_with_weight(8, 2);
+    assert_eq!(sketch.n(), 5);
+    assert_eq!(sketch.num_samples(), 4);
+    assert!(sketch.samples().contains(&8));
+
+    sketch.update_with_weight(9, 1 << 40);
+    assert_eq!(sketch.n(), (1 << 40) + 5);
+    assert_eq!(sketch.num_samples(), 4);
+}
+
+#[test]
+fn test_update_with_weight_is_uniform() {
+    // after 10 distinct items, 90 copies of one item take 9 of the 10 slots on average
+    let trials = 2000;
+    let mut copies = 0;
+    for _ in 0..trials {
+        let mut sketch = ReservoirItemsSketch::new(10);
+        sketch.extend(0..10u64);
+        sketch.update_with_weight(99, 90);
+        assert_eq!(sketch.n(), 100);
+        copies += sketch.iter().filter(|&&i| i == 99).count();
+    }
+    // the standard deviation of the mean is about 0.02
+    let mean = copies as f64 / trials as f64;
+    assert!((mean - 9.0).abs() < 0.15, "mean: {mean}");
+}
+
+#[test]
+fn test_reset() {
+    let mut sketch = ReservoirItemsSketch::new(4);
+    for i in 0..100u64 {
+        sketch.update(i);
+    }
+    sketch.reset();
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.k(), 4);
+    assert_eq!(sketch.num_samples(), 0);
+}
+
+#[test]
+fn test_union_empty() {
+    let mut union = ReservoirUnion::<u64>::new(8);
+    assert!(union.is_empty());
+    union.update(&ReservoirItemsSketch::new(8));
+    assert!(union.is_empty());
+
+    let result = union.to_sketch();
+    assert!(result.is_empty());
+    assert_eq!(result.k(), 8);
+}
+
+#[test]
+fn test_union_exact_sketches() {
+    let mut left = ReservoirItemsSketch::new(4);
+    let mut right = ReservoirItemsSketch::new(4);
+    for i in 0..3u64 {
+        left.update(i);
+        right.update(i + 3);
+    }
+
+    // the gadget is widened to max_k, so no item is dropped
+    let mut union = ReservoirUnion::new(16);
+    union.update(&left);
+    union.update(&right);
+    let result = union.to_sketch();
+    assert_eq!(result.k(), 16);
+    assert_eq!(result.n(), 6);
+    let mut samples = result.samples().to_vec();
+    samples.sort();
+    assert_eq!(samples, [0, 1, 2, 3, 4, 5]);
+}
+
+#[test]
+fn test_union_downsamples_large_k() {
+    let mut sketch = ReservoirItemsSketch::new(256);
+    for i in 0..10_000u64 {
+        sketch.update(i);
+    }
+
+    let mut union = ReservoirUnion::new(32);
+    union.update(&sketch);
+    let result = union.to_sketch();
+    assert_eq!(result.k(), 32);
+    assert_eq!(result.n(), 10_000);
+    assert_eq!(result.num_samples(), 32);
+    assert!(result.iter().all(|item| sketch.samples().contains(item)));
+}
+
+#[test]
+fn test_union_estimation_sketches() {
+    // the right stream is three times longer, so it should contribute about 3/4 of the samples
+    let mut from_right = 0;
+    for _ in 0..100 {
+        let mut left = ReservoirItemsSketch::new(64);
+        let mut right = ReservoirItemsSketch::new(64);
+        for i in 0..1000u64 {
+            left.update(i);
+        }
+        for i in 0..3000u64 {
+            right.update(i + 1000);
+        }
+
+        let mut union = ReservoirUnion::new(64);
+        union.update(&left);
+        union.update(&right);
+        let result = union.to_sketch();
+        assert_eq!(result.n(), 4000);
+        assert_eq!(result.num_samples(), 64);
+        from_right += result.iter().filter(|&&i| i >= 1000).count();
+    }
+    // the expectation is 100 * 64 * 3 / 4 = 4800
+    assert!(
+        (4400..=5200).contains(&from_right),
+        "from_right: {from_right}"
+    );
+}
+
+#[test]
+fn test_union_update_value() {
+    let mut union = ReservoirUnion::new(4);
+    for i in 0..100u64 {
+        union.update_value(i);
+    }
+    let result = union.to_sketch();
+    assert_eq!(result.n(), 100);
+    assert_eq!(result.num_samples(), 4);
+
+    union.reset();
+    assert!(union.is_empty());
+}
@@ -0,0 +1,388 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "sampling")]
+
+use datasketches::error::ErrorKind;
+use datasketches::sampling::EbppsItemsSketch;
+use datasketches::sampling::ReservoirItemsSketch;
+use datasketches::sampling::ReservoirUnion;
+use datasketches::sampling::VarOptItemsSketch;
+use datasketches::sampling::VarOptUnion;
+
+#[test]
+fn test_empty() {
+    let sketch = ReservoirItemsSketch::<u64>::new(32);
+    let bytes = sketch.serialize();
+    // preamble longs 1 with resize factor X8, serial version 2, family 11, empty flag, k
+    assert_eq!(bytes, [0xC1, 2, 11, 4, 32, 0, 0, 0]);
+
+    let decoded = ReservoirItemsSketch::<u64>::deserialize(&bytes).unwrap();
+    assert!(decoded.is_empty());
+    assert_eq!(decoded.k(), 32);
+}
+
+#[test]
+fn test_exact_layout() {
+    let mut sketch = ReservoirItemsSketch::new(4);
+    sketch.update(7i64);
+    sketch.update(-1i64);
+    let bytes = sketch.serialize();
+
+    let mut expected = vec![0xC2, 2, 11, 0, 4, 0, 0, 0];
+    expected.extend_from_slice(&2u64.to_le_bytes());
+    expected.extend_from_slice(&7i64.to_le_bytes());
+    expected.extend_from_slice(&(-1i64).to_le_bytes());
+    assert_eq!(bytes, expected);
+
+    let decoded = ReservoirItemsSketch::<i64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded, sketch);
+}
+
+#[test]
+fn test_estimation_roundtrip() {
+    let mut sketch = ReservoirItemsSketch::new(100);
+    for i in 0..10_000 {
+        sketch.update(format!("item{i}"));
+    }
+    let bytes = sketch.serialize();
+    let decoded = ReservoirItemsSketch::<String>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded, sketch);
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_f64_roundtrip() {
+    let mut sketch = ReservoirItemsSketch::new(8);
+    for i in 0..100 {
+        sketch.update(i as f64 / 4.0);
+    }
+    let decoded = ReservoirItemsSketch::<f64>::deserialize(&sketch.serialize()).unwrap();
+    assert_eq!(decoded, sketch);
+}
+
+#[test]
+fn test_union_roundtrip() {
+    let empty = ReservoirUnion::<u64>::new(16);
+    let bytes = empty.serialize();
+    assert_eq!(bytes, [1, 2, 12, 4, 16, 0, 0, 0]);
+    assert_eq!(ReservoirUnion::<u64>::deserialize(&bytes).unwrap(), empty);
+
+    let mut union = ReservoirUnion::new(16);
+    for i in 0..1000u64 {
+        union.update_value(i);
+    }
+    let bytes = union.serialize();
+    assert_eq!(&bytes[..8], [1, 2, 12, 0, 16, 0, 0, 0]);
+    assert_eq!(&bytes[8..], union.to_sketch().serialize());
+
+    let decoded = ReservoirUnion::<u64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded, union);
+}
+
+#[test]
+fn test_deserialize_invalid() {
+    let mut sketch = ReservoirItemsSketch::new(4);
+    for i in 0..10u64 {
+        sketch.update(i);
+    }
+    let bytes = sketch.serialize();
+
+    let err = ReservoirItemsSketch::<u64>::deserialize(&bytes[..7]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+    let err = ReservoirItemsSketch::<u64>::deserialize(&bytes[..bytes.len() - 1]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut corrupted = bytes.clone();
+    corrupted[2] = 12;
+    let err = ReservoirItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut corrupted = bytes.clone();
+    corrupted[1] = 1;
+    let err = ReservoirItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::UnsupportedVersion);
+
+    let mut corrupted = bytes.clone();
+    corrupted[0] = 0xC1;
+    let err = ReservoirItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut corrupted = bytes;
+    corrupted[4] = 1;
+    let err = ReservoirItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut union = ReservoirUnion::new(4);
+    union.update(&sketch);
+    let mut corrupted = union.serialize();
+    corrupted[4] = 2;
+    let err = ReservoirUnion::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+}
+
+#[test]
+fn test_varopt_empty() {
+    let sketch = VarOptItemsSketch::<u64>::new(32);
+    let bytes = sketch.serialize();
+    // preamble longs 1 with resize factor X8, serial version 2, family 13, empty flag, k
+    assert_eq!(bytes, [0xC1, 2, 13, 4, 32, 0, 0, 0]);
+
+    let decoded = VarOptItemsSketch::<u64>::deserialize(&bytes).unwrap();
+    assert!(decoded.is_empty());
+    assert_eq!(decoded.k(), 32);
+}
+
+#[test]
+fn test_varopt_warmup_layout() {
+    let mut sketch = VarOptItemsSketch::new(4);
+    sketch.update(7i64, 1.5);
+    sketch.update(-1i64, 0.5);
+    let bytes = sketch.serialize();
+
+    let mut expected = vec![0xC3, 2, 13, 0, 4, 0, 0, 0];
+    expected.extend_from_slice(&2u64.to_le_bytes());
+    expected.extend_from_slice(&2u32.to_le_bytes());
+    expected.extend_from_slice(&0u32.to_le_bytes());
+    expected.extend_from_slice(&1.5f64.to_le_bytes());
+    expected.extend_from_slice(&0.5f64.to_le_bytes());
+    expected.extend_from_slice(&7i64.to_le_bytes());
+    expected.extend_from_slice(&(-1i64).to_le_bytes());
+    assert_eq!(bytes, expected);
+
+    let decoded = VarOptItemsSketch::<i64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded, sketch);
+}
+
+#[test]
+fn test_varopt_estimation_roundtrip() {
+    let mut sketch = VarOptItemsSketch::new(64);
+    for i in 0..10_000u64 {
+        let weight = if i % 100 == 0 { 1000.0 } else { 1.0 };
+        sketch.update(format!("item{i}"), weight);
+    }
+    assert!(sketch.is_estimation_mode());
+    let bytes = sketch.serialize();
+    assert_eq!(bytes[0], 0xC4);
+
+    let decoded = VarOptItemsSketch::<String>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.serialize(), bytes);
+    assert_eq!(decoded.n(), sketch.n());
+    let mut expected: Vec<_> = sketch.iter().collect();
+    let mut actual: Vec<_> = decoded.iter().collect();
+    expected.sort_by(|a, b| a.0.cmp(b.0));
+    actual.sort_by(|a, b| a.0.cmp(b.0));
+    assert_eq!(actual, expected);
+}
+
+#[test]
+fn test_varopt_union_roundtrip() {
+    let empty = VarOptUnion::<u64>::new(16);
+    let bytes = empty.serialize();
+    assert_eq!(bytes, [1, 2, 14, 4, 16, 0, 0, 0]);
+    assert_eq!(VarOptUnion::<u64>::deserialize(&bytes).unwrap(), empty);
+
+    let mut sketch = VarOptItemsSketch::new(8);
+    for i in 0..1000u64 {
+        sketch.update(i, (i % 5 + 1) as f64);
+    }
+    let mut union = VarOptUnion::new(16);
+    union.update(&sketch);
+    let bytes = union.serialize();
+    assert_eq!(&bytes[..8], [4, 2, 14, 0, 16, 0, 0, 0]);
+    assert_eq!(&bytes[8..16], 1000u64.to_le_bytes());
+    // the gadget records marks
+    assert_eq!(bytes[32 + 3] & 0x80, 0x80);
+
+    let decoded = VarOptUnion::<u64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded, union);
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_varopt_deserialize_invalid() {
+    let mut sketch = VarOptItemsSketch::new(4);
+    for i in 0..10u64 {
+        sketch.update(i, 1.0);
+    }
+    let bytes = sketch.serialize();
+
+    let err = VarOptItemsSketch::<u64>::deserialize(&bytes[..bytes.len() - 1]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut corrupted = bytes.clone();
+    corrupted[2] = 11;
+    let err = VarOptItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    // a full image whose regions do not add up to k
+    let mut corrupted = bytes.clone();
+    corrupted[4] = 5;
+    let err = VarOptItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    // a union needs the marks of a gadget
+    let mut union_bytes = vec![4, 2, 14, 0, 4, 0, 0, 0];
+    union_bytes.extend_from_slice(&10u64.to_le_bytes());
+    union_bytes.extend_from_slice(&0f64.to_le_bytes());
+    union_bytes.extend_from_slice(&0u64.to_le_bytes());
+    union_bytes.extend_from_slice(&bytes);
+    let err = VarOptUnion::<u64>::deserialize(&union_bytes).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+}
+
+#[test]
+fn test_varopt_union_marks_need_an_outer_tau() {
+    let mut sketch = VarOptItemsSketch::new(4);
+    sketch.update(7u64, 2.0);
+    let mut union = VarOptUnion::new(4);
+    union.update(&sketch);
+    let bytes = union.serialize();
+    // the mark byte of the single heavy item follows its weight
+    assert_eq!(bytes[64], 0);
+
+    // a marked item from an exact input used to panic in to_sketch
+    let mut marked = bytes.clone();
+    marked[64] = 1;
+    let err = VarOptUnion::<u64>::deserialize(&marked).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    // a mark bit past the heavy items
+    let mut stray = bytes.clone();
+    stray[64] = 2;
+    let err = VarOptUnion::<u64>::deserialize(&stray).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    // a marked item heavier than the outer tau
+    let mut estimation = VarOptItemsSketch::new(4);
+    for i in 0..100u64 {
+        estimation.update(i, 1.0);
+    }
+    let mut union = VarOptUnion::new(8);
+    union.update(&estimation);
+    let bytes = union.serialize();
+    let decoded = VarOptUnion::<u64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded.to_sketch().n(), 100);
+    let mut heavy = bytes.clone();
+    heavy[16..24].copy_from_slice(&1f64.to_le_bytes());
+    let err = VarOptUnion::<u64>::deserialize(&heavy).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+}
+
+#[test]
+fn test_ebpps_empty() {
+    let sketch = EbppsItemsSketch::<u64>::new(32);
+    let bytes = sketch.serialize();
+    // preamble longs 1, serial version 1, family 19, empty flag, k
+    assert_eq!(bytes, [1, 1, 19, 4, 32, 0, 0, 0]);
+
+    let decoded = EbppsItemsSketch::<u64>::deserialize(&bytes).unwrap();
+    assert!(decoded.is_empty());
+    assert_eq!(decoded.k(), 32);
+}
+
+#[test]
+fn test_ebpps_layout() {
+    let mut sketch = EbppsItemsSketch::new(4);
+    sketch.update(7i64, 1.0);
+    sketch.update(-1i64, 2.0);
+    // rho = 1 / 2, so c = 1.5 with item -1 as the full item and item 7 as the partial one
+    assert_eq!(sketch.c(), 1.5);
+    let bytes = sketch.serialize();
+
+    let mut expected = vec![5, 1, 19, 8, 4, 0, 0, 0];
+    expected.extend_from_slice(&2u64.to_le_bytes());
+    expected.extend_from_slice(&3f64.to_le_bytes());
+    expected.extend_from_slice(&2f64.to_le_bytes());
+    expected.extend_from_slice(&0.5f64.to_le_bytes());
+    expected.extend_from_slice(&1.5f64.to_le_bytes());
+    expected.extend_from_slice(&(-1i64).to_le_bytes());
+    expected.extend_from_slice(&7i64.to_le_bytes());
+    assert_eq!(bytes, expected);
+
+    let decoded = EbppsItemsSketch::<i64>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded, sketch);
+}
+
+#[test]
+fn test_ebpps_roundtrip() {
+    let mut sketch = EbppsItemsSketch::new(50);
+    for i in 0..10_000 {
+        sketch.update(format!("item{i}"), (i % 13 + 1) as f64);
+    }
+    let bytes = sketch.serialize();
+    let decoded = EbppsItemsSketch::<String>::deserialize(&bytes).unwrap();
+    assert_eq!(decoded, sketch);
+    assert_eq!(decoded.serialize(), bytes);
+}
+
+#[test]
+fn test_ebpps_deserialize_invalid() {
+    let mut sketch = EbppsItemsSketch::new(4);
+    for i in 0..10u64 {
+        sketch.update(i, 1.0);
+    }
+    let bytes = sketch.serialize();
+
+    let err = EbppsItemsSketch::<u64>::deserialize(&bytes[..bytes.len() - 1]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut corrupted = bytes.clone();
+    corrupted[0] = 4;
+    let err = EbppsItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    // a negative cumulative weight
+    let mut corrupted = bytes.clone();
+    corrupted[16..24].copy_from_slice(&(-1f64).to_le_bytes());
+    let err = EbppsItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    // a sample larger than k
+    let mut corrupted = bytes.clone();
+    corrupted[40..48].copy_from_slice(&5f64.to_le_bytes());
+    let err = EbppsItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    // a sample size or rho that the weights do not produce
+    for (range, value) in [(40..48, 3.5), (32..40, 0.5), (24..32, 20.0)] {
+        let mut corrupted = bytes.clone();
+        corrupted[range.clone()].copy_from_slice(&f64::to_le_bytes(value));
+        let err = EbppsItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+        assert_eq!(err.kind(), ErrorKind::InvalidData, "{range:?}");
+    }
+}
+
+#[test]
+fn test_ebpps_inconsistent_weights_are_rejected_before_merge() {
+    let mut sketch = EbppsItemsSketch::new(10);
+    for i in 0..5u64 {
+        sketch.update(i, 1.0 + i as f64);
+    }
+    let bytes = sketch.serialize();
+
+    // a cumulative weight far from the one that produced c used to panic while merging
+    let mut corrupted = bytes.clone();
+    corrupted[22] ^= 0x10;
+    let err = EbppsItemsSketch::<u64>::deserialize(&corrupted).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    let mut merged = EbppsItemsSketch::<u64>::deserialize(&bytes).unwrap();
+    merged.merge(&sketch);
+    let decoded = EbppsItemsSketch::<u64>::deserialize(&merged.serialize()).unwrap();
+    assert_eq!(decoded, merged);
+}
@@ -0,0 +1,303 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "sampling")]
+
+use datasketches::sampling::ReservoirItemsSketch;
+use datasketches::sampling::VarOptItemsSketch;
+use datasketches::sampling::VarOptUnion;
+
+fn total_weight<T>(sketch: &VarOptItemsSketch<T>) -> f64 {
+    sketch.iter().map(|(_, weight)| weight).sum()
+}
+
+#[test]
+fn test_empty() {
+    let sketch = VarOptItemsSketch::<u64>::new(16);
+    assert!(sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.k(), 16);
+    assert_eq!(sketch.num_samples(), 0);
+    assert_eq!(sketch.iter().count(), 0);
+    let summary = sketch.estimate_subset_sum(|_| true);
+    assert_eq!(summary.estimate(), 0.0);
+    assert_eq!(summary.total_sketch_weight(), 0.0);
+}
+
+#[test]
+#[should_panic(expected = "k must be at least 1")]
+fn test_k_too_small() {
+    VarOptItemsSketch::<u64>::new(0);
+}
+
+#[test]
+#[should_panic(expected = "weight must be positive and finite")]
+fn test_invalid_weight() {
+    let mut sketch = VarOptItemsSketch::new(4);
+    sketch.update(1u64, -1.0);
+}
+
+#[test]
+fn test_exact_mode() {
+    let mut sketch = VarOptItemsSketch::new(16);
+    for i in 1..=16u64 {
+        sketch.update(i, i as f64);
+    }
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.num_samples(), 16);
+
+    let mut samples: Vec<_> = sketch
+        .iter()
+        .map(|(&item, weight)| (item, weight))
+        .collect();
+    samples.sort_by_key(|&(item, _)| item);
+    let expected: Vec<_> = (1..=16u64).map(|i| (i, i as f64)).collect();
+    assert_eq!(samples, expected);
+
+    let summary = sketch.estimate_subset_sum(|&i| i <= 4);
+    assert_eq!(summary.lower_bound(), 10.0);
+    assert_eq!(summary.estimate(), 10.0);
+    assert_eq!(summary.upper_bound(), 10.0);
+    assert_eq!(summary.total_sketch_weight(), 136.0);
+}
+
+#[test]
+fn test_cumulative_weight() {
+    // weights spread over several orders of magnitude
+    let mut sketch = VarOptItemsSketch::new(256);
+    let mut expected = 0.0;
+    for i in 0..2560u64 {
+        let weight = ((i * 2654435761) % 10_007) as f64 / 100.0 + 0.01;
+        let weight = weight * weight * weight;
+        expected += weight;
+        sketch.update(i, weight);
+    }
+    assert!(sketch.is_estimation_mode());
+    assert_eq!(sketch.num_samples(), 256);
+    let actual = total_weight(&sketch);
+    assert!(
+        (actual - expected).abs() < 1e-9 * expected,
+        "{actual} vs {expected}"
+    );
+    let estimate = sketch.estimate_subset_sum(|_| true).estimate();
+    assert!(
+        (estimate - expected).abs() < 1e-9 * expected,
+        "{estimate} vs {expected}"
+    );
+}
+
+#[test]
+fn test_heavy_items_are_kept() {
+    let mut sketch = VarOptItemsSketch::new(10);
+    for i in 0..1000u64 {
+        sketch.update(i, 1.0);
+    }
+    sketch.update(10_000, 1e9);
+    sketch.update(20_000, 1e9);
+    let heavy: Vec<_> = sketch.iter().filter(|&(_, weight)| weight == 1e9).collect();
+    assert_eq!(heavy.len(), 2);
+    assert!(sketch.iter().any(|(&item, _)| item == 10_000));
+    assert!(sketch.iter().any(|(&item, _)| item == 20_000));
+}
+
+#[test]
+fn test_subset_sum_is_unbiased() {
+    // items 0..1000 with weight i % 10 + 1; the even items weigh 2500 in total
+    let trials = 500;
+    let mut sum = 0.0;
+    let mut covered = 0;
+    for _ in 0..trials {
+        let mut sketch = VarOptItemsSketch::new(50);
+        for i in 0..1000u64 {
+            sketch.update(i, (i % 10 + 1) as f64);
+        }
+        let summary = sketch.estimate_subset_sum(|&i| i % 2 == 0);
+        assert_eq!(summary.total_sketch_weight().round(), 5500.0);
+        assert!(summary.lower_bound() <= summary.estimate());
+        assert!(summary.estimate() <= summary.upper_bound());
+        if (summary.lower_bound()..=summary.upper_bound()).contains(&2500.0) {
+            covered += 1;
+        }
+        sum += summary.estimate();
+    }
+    let mean = sum / trials as f64;
+    // a single estimate has a standard deviation of about 375, so the mean of 500 trials
+    // stays within five standard errors of the true sum
+    assert!((mean - 2500.0).abs() < 85.0, "mean: {mean}");
+    // the bounds are about two standard deviations wide
+    assert!(covered >= trials * 9 / 10, "covered: {covered}");
+}
+
+#[test]
+fn test_reset() {
+    let mut sketch = VarOptItemsSketch::new(4);
+    for i in 0..100u64 {
+        sketch.update(i, 1.0);
+    }
+    sketch.reset();
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.k(), 4);
+    assert_eq!(sketch.num_samples(), 0);
+
+    sketch.update(1, 1.0);
+    assert_eq!(sketch.n(), 1);
+}
+
+#[test]
+fn test_union_empty() {
+    let mut union = VarOptUnion::<u64>::new(8);
+    union.update(&VarOptItemsSketch::new(8));
+    union.update_reservoir(&ReservoirItemsSketch::new(8));
+    assert!(union.is_empty());
+
+    let result = union.to_sketch();
+    assert!(result.is_empty());
+    assert_eq!(result.k(), 8);
+}
+
+#[test]
+fn test_union_exact_sketches() {
+    let mut left = VarOptItemsSketch::new(8);
+    let mut right = VarOptItemsSketch::new(8);
+    for i in 0..4u64 {
+        left.update(i, 1.0);
+        right.update(i + 4, 2.0);
+    }
+
+    let mut union = VarOptUnion::new(16);
+    union.update(&left);
+    union.update(&right);
+    let result = union.to_sketch();
+    assert!(!result.is_estimation_mode());
+    assert_eq!(result.n(), 8);
+    assert_eq!(result.num_samples(), 8);
+    assert_eq!(total_weight(&result), 12.0);
+}
+
+#[test]
+fn test_union_estimation_sketches() {
+    let mut left = VarOptItemsSketch::new(32);
+    let mut right = VarOptItemsSketch::new(64);
+    let mut expected = 0.0;
+    for i in 0..1000u64 {
+        let weight = (i % 7 + 1) as f64;
+        expected += 2.0 * weight;
+        left.update(i, weight);
+        right.update(i + 1000, weight);
+    }
+
+    let mut union = VarOptUnion::new(32);
+    union.update(&left);
+    union.update(&right);
+    let result = union.to_sketch();
+    assert_eq!(result.n(), 2000);
+    assert!(result.is_estimation_mode());
+    assert!(result.num_samples() <= 32);
+    let actual = total_weight(&result);
+    assert!(
+        (actual - expected).abs() < 1e-9 * expected,
+        "{actual} vs {expected}"
+    );
+}
+
+#[test]
+fn test_union_pseudo_exact() {
+    // a single estimation mode input fits in the gadget, and its reservoir items come back
+    // out as the reservoir of the result
+    let mut sketch = VarOptItemsSketch::new(8);
+    for i in 0..100u64 {
+        sketch.update(i, 1.0);
+    }
+
+    let mut union = VarOptUnion::new(16);
+    union.update(&sketch);
+    let result = union.to_sketch();
+    assert_eq!(result.n(), 100);
+    assert_eq!(result.k(), 8);
+    assert!(result.is_estimation_mode());
+    let mut expected: Vec<_> = sketch.iter().map(|(&item, _)| item).collect();
+    let mut actual: Vec<_> = result.iter().map(|(&item, _)| item).collect();
+    expected.sort();
+    actual.sort();
+    assert_eq!(actual, expected);
+    assert!((total_weight(&result) - 100.0).abs() < 1e-9);
+}
+
+#[test]
+fn test_union_with_heavy_item() {
+    let mut sketch = VarOptItemsSketch::new(8);
+    for i in 0..100u64 {
+        sketch.update(i, 1.0);
+    }
+    let mut heavy = VarOptItemsSketch::new(8);
+    heavy.update(1000, 1e6);
+
+    let mut union = VarOptUnion::new(8);
+    union.update(&sketch);
+    union.update(&heavy);
+    let result = union.to_sketch();
+    assert_eq!(result.n(), 101);
+    assert!(
+        result
+            .iter()
+            .any(|(&item, weight)| item == 1000 && weight == 1e6)
+    );
+    assert!((total_weight(&result) - 1_000_100.0).abs() < 1e-6);
+}
+
+#[test]
+fn test_union_reservoir() {
+    let mut reservoir = ReservoirItemsSketch::new(16);
+    for i in 0..1000u64 {
+        reservoir.update(i);
+    }
+    let mut varopt = VarOptItemsSketch::new(16);
+    for i in 1000..1010u64 {
+        varopt.update(i, 1.0);
+    }
+
+    let mut union = VarOptUnion::new(16);
+    union.update_reservoir(&reservoir);
+    union.update(&varopt);
+    let result = union.to_sketch();
+    assert_eq!(result.n(), 1010);
+    assert!(result.num_samples() <= 16);
+    assert!((total_weight(&result) - 1010.0).abs() < 1e-9);
+}
+
+#[test]
+fn test_union_reset() {
+    let mut union = VarOptUnion::new(4);
+    let mut sketch = VarOptItemsSketch::new(4);
+    for i in 0..100u64 {
+        sketch.update(i, 1.0);
+    }
+    union.update(&sketch);
+    union.reset();
+    assert!(union.is_empty());
+    assert!(union.to_sketch().is_empty());
+}
+
+#[test]
+fn test_estimated_size() {
+    let mut sketch = VarOptItemsSketch::<u64>::new(32);
+    for i in 0..1_000 {
+        sketch.update(i, 1.0 + i as f64);
+    }
+    assert!(sketch.estimated_size() >= 32 * (size_of::<u64>() + size_of::<f64>()));
+    assert!(sketch.estimated_size() < VarOptItemsSketch::<u64>::new(1024).estimated_size());
+}
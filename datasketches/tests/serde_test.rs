@@ -0,0 +1,70 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(feature = "serde", feature = "hll", feature = "kll", feature = "theta"))]
+
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::kll::KllSketch;
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+
+#[derive(serde::Serialize, serde::Deserialize)]
+struct Stats {
+    name: String,
+    distinct: HllSketch,
+    latencies: KllSketch<f64>,
+}
+
+#[test]
+fn test_round_trip_through_json() {
+    let mut stats = Stats {
+        name: "requests".to_string(),
+        distinct: HllSketch::new(10, HllType::Hll4),
+        latencies: KllSketch::default(),
+    };
+    for i in 0..1000 {
+        stats.distinct.update(i);
+        stats.latencies.update(i as f64);
+    }
+
+    let json = serde_json::to_string(&stats).unwrap();
+    let decoded: Stats = serde_json::from_str(&json).unwrap();
+    assert_eq!(decoded.name, "requests");
+    assert_eq!(decoded.distinct.serialize(), stats.distinct.serialize());
+    assert_eq!(decoded.latencies.serialize(), stats.latencies.serialize());
+}
+
+#[test]
+fn test_serializes_as_binary_image() {
+    let mut sketch = ThetaSketchBuilder::default().build();
+    sketch.update("apple");
+    let compact = sketch.compact(true);
+
+    let value = serde_json::to_value(&compact).unwrap();
+    let image: Vec<u8> = serde_json::from_value(value.clone()).unwrap();
+    assert_eq!(image, compact.serialize());
+
+    let decoded: CompactThetaSketch = serde_json::from_value(value).unwrap();
+    assert_eq!(decoded.estimate(), 1.0);
+}
+
+#[test]
+fn test_invalid_image_is_an_error() {
+    let err = serde_json::from_str::<HllSketch>("[1, 2, 3]").unwrap_err();
+    assert!(err.to_string().contains("insufficient data"), "{err}");
+}
@@ -0,0 +1,423 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use datasketches::error::Error;
+use datasketches::error::ErrorKind;
+use datasketches::error::SketchError;
+
+/// Checks that `serialize_into` agrees with `serialize` and `serialized_size_bytes`, and that a
+/// buffer one byte short is rejected.
+#[allow(dead_code)]
+fn check_serialize_into(
+    image: &[u8],
+    size: usize,
+    mut serialize_into: impl FnMut(&mut [u8]) -> Result<usize, Error>,
+) {
+    assert_eq!(size, image.len());
+
+    let mut exact = vec![0u8; size];
+    assert_eq!(serialize_into(&mut exact).unwrap(), size);
+    assert_eq!(exact, image);
+
+    let mut larger = vec![0xAAu8; size + 16];
+    assert_eq!(serialize_into(&mut larger).unwrap(), size);
+    assert_eq!(&larger[..size], image);
+    assert!(larger[size..].iter().all(|&b| b == 0xAA));
+
+    let mut short = vec![0u8; size - 1];
+    let err = serialize_into(&mut short).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidArgument);
+    assert_eq!(
+        err.sketch_error(),
+        Some(&SketchError::InsufficientBuffer {
+            needed: size,
+            got: size - 1
+        })
+    );
+}
+
+#[cfg(feature = "bloom")]
+#[test]
+fn test_bloom_serialize_into() {
+    use datasketches::bloom::BloomFilterBuilder;
+
+    let mut filter = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+    check_serialize_into(&filter.serialize(), filter.serialized_size_bytes(), |buf| {
+        filter.serialize_into(buf)
+    });
+    for i in 0..100 {
+        filter.insert(i);
+    }
+    check_serialize_into(&filter.serialize(), filter.serialized_size_bytes(), |buf| {
+        filter.serialize_into(buf)
+    });
+}
+
+#[cfg(feature = "countmin")]
+#[test]
+fn test_countmin_serialize_into() {
+    use datasketches::countmin::CountMinSketch;
+
+    let mut sketch = CountMinSketch::<u64>::new(3, 64);
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    for i in 0..100 {
+        sketch.update(i);
+    }
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+}
+
+#[cfg(feature = "cpc")]
+#[test]
+fn test_cpc_serialize_into() {
+    use datasketches::cpc::CpcSketch;
+
+    let mut sketch = CpcSketch::new(11);
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    for n in [10, 1_000, 100_000] {
+        for i in 0..n {
+            sketch.update(i);
+        }
+        check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+            sketch.serialize_into(buf)
+        });
+    }
+}
+
+#[cfg(feature = "density")]
+#[test]
+fn test_density_serialize_into() {
+    use datasketches::density::DensitySketch;
+
+    let mut sketch = DensitySketch::new(10, 3);
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    for i in 0..1000 {
+        let x = i as f64;
+        sketch.update(&[x, x * 2.0, x * 3.0]);
+    }
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+}
+
+#[cfg(feature = "frequencies")]
+#[test]
+fn test_frequencies_serialize_into() {
+    use datasketches::frequencies::FrequentItemsSketch;
+
+    let mut longs = FrequentItemsSketch::<i64>::new(32);
+    check_serialize_into(&longs.serialize(), longs.serialized_size_bytes(), |buf| {
+        longs.serialize_into(buf)
+    });
+    let mut strings = FrequentItemsSketch::<String>::new(32);
+    for i in 0..1000 {
+        longs.update(i % 50);
+        strings.update(format!("item{}", i % 50));
+    }
+    check_serialize_into(&longs.serialize(), longs.serialized_size_bytes(), |buf| {
+        longs.serialize_into(buf)
+    });
+    check_serialize_into(
+        &strings.serialize(),
+        strings.serialized_size_bytes(),
+        |buf| strings.serialize_into(buf),
+    );
+}
+
+#[cfg(feature = "hll")]
+#[test]
+fn test_hll_serialize_into() {
+    use datasketches::hll::HllSketch;
+    use datasketches::hll::HllType;
+
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let mut sketch = HllSketch::new(10, hll_type);
+        check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+            sketch.serialize_into(buf)
+        });
+        // Walk through list, set and HLL modes.
+        let mut next = 0u64;
+        for n in [5, 100, 10_000] {
+            while next < n {
+                sketch.update(next);
+                next += 1;
+            }
+            check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+                sketch.serialize_into(buf)
+            });
+        }
+    }
+}
+
+#[cfg(feature = "kll")]
+#[test]
+fn test_kll_serialize_into() {
+    use datasketches::kll::KllItemsSketch;
+    use datasketches::kll::KllSketch;
+
+    let mut sketch = KllSketch::<f64>::new(200);
+    let mut items = KllItemsSketch::<String>::new(200);
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    check_serialize_into(&items.serialize(), items.serialized_size_bytes(), |buf| {
+        items.serialize_into(buf)
+    });
+    sketch.update(1.0);
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    for i in 0..10_000 {
+        sketch.update(i as f64);
+        items.update(format!("{i:05}"));
+    }
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    check_serialize_into(&items.serialize(), items.serialized_size_bytes(), |buf| {
+        items.serialize_into(buf)
+    });
+}
+
+#[cfg(feature = "matrix")]
+#[test]
+fn test_matrix_serialize_into() {
+    use datasketches::matrix::FrequentDirections;
+
+    let mut sketch = FrequentDirections::new(4, 3);
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    for i in 0..1000 {
+        let x = i as f64;
+        sketch.update(&[x, x.cos(), 1.0]);
+    }
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+}
+
+#[cfg(feature = "quantiles")]
+#[test]
+fn test_quantiles_serialize_into() {
+    use datasketches::quantiles::DoublesSketch;
+
+    let mut sketch = DoublesSketch::new(64);
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    for i in 0..10_000 {
+        sketch.update(i as f64);
+    }
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+}
+
+#[cfg(feature = "quotient")]
+#[test]
+fn test_quotient_serialize_into() {
+    use datasketches::quotient::QuotientFilterBuilder;
+
+    let mut filter = QuotientFilterBuilder::with_size(8, 16).build();
+    check_serialize_into(&filter.serialize(), filter.serialized_size_bytes(), |buf| {
+        filter.serialize_into(buf)
+    });
+    for i in 0..100 {
+        filter.insert(i);
+    }
+    check_serialize_into(&filter.serialize(), filter.serialized_size_bytes(), |buf| {
+        filter.serialize_into(buf)
+    });
+}
+
+#[cfg(feature = "req")]
+#[test]
+fn test_req_serialize_into() {
+    use datasketches::req::RankAccuracy;
+    use datasketches::req::ReqSketch;
+
+    let mut sketch = ReqSketch::new(12, RankAccuracy::HighRanks);
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    sketch.update(1.0);
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+    for i in 0..10_000 {
+        sketch.update(i as f32);
+    }
+    check_serialize_into(&sketch.serialize(), sketch.serialized_size_bytes(), |buf| {
+        sketch.serialize_into(buf)
+    });
+}
+
+#[cfg(feature = "sampling")]
+#[test]
+fn test_sampling_serialize_into() {
+    use datasketches::sampling::EbppsItemsSketch;
+    use datasketches::sampling::ReservoirItemsSketch;
+    use datasketches::sampling::ReservoirUnion;
+    use datasketches::sampling::VarOptItemsSketch;
+    use datasketches::sampling::VarOptUnion;
+
+    let mut reservoir = ReservoirItemsSketch::<String>::new(16);
+    let mut varopt = VarOptItemsSketch::<u64>::new(16);
+    let mut ebpps = EbppsItemsSketch::<u64>::new(16);
+    check_serialize_into(
+        &reservoir.serialize(),
+        reservoir.serialized_size_bytes(),
+        |buf| reservoir.serialize_into(buf),
+    );
+    check_serialize_into(&varopt.serialize(), varopt.serialized_size_bytes(), |buf| {
+        varopt.serialize_into(buf)
+    });
+    check_serialize_into(&ebpps.serialize(), ebpps.serialized_size_bytes(), |buf| {
+        ebpps.serialize_into(buf)
+    });
+
+    // Check each sketch while still filling up and once it is sampling.
+    let mut next = 0u64;
+    for n in [8, 1000] {
+        while next < n {
+            reservoir.update(format!("item{next}"));
+            varopt.update(next, (next % 7 + 1) as f64);
+            ebpps.update(next, (next % 7 + 1) as f64);
+            next += 1;
+        }
+        check_serialize_into(
+            &reservoir.serialize(),
+            reservoir.serialized_size_bytes(),
+            |buf| reservoir.serialize_into(buf),
+        );
+        check_serialize_into(&varopt.serialize(), varopt.serialized_size_bytes(), |buf| {
+            varopt.serialize_into(buf)
+        });
+        check_serialize_into(&ebpps.serialize(), ebpps.serialized_size_bytes(), |buf| {
+            ebpps.serialize_into(buf)
+        });
+    }
+
+    let mut reservoir_union = ReservoirUnion::<String>::new(16);
+    check_serialize_into(
+        &reservoir_union.serialize(),
+        reservoir_union.serialized_size_bytes(),
+        |buf| reservoir_union.serialize_into(buf),
+    );
+    reservoir_union.update(&reservoir);
+    check_serialize_into(
+        &reservoir_union.serialize(),
+        reservoir_union.serialized_size_bytes(),
+        |buf| reservoir_union.serialize_into(buf),
+    );
+
+    let mut varopt_union = VarOptUnion::<u64>::new(16);
+    check_serialize_into(
+        &varopt_union.serialize(),
+        varopt_union.serialized_size_bytes(),
+        |buf| varopt_union.serialize_into(buf),
+    );
+    varopt_union.update(&varopt);
+    check_serialize_into(
+        &varopt_union.serialize(),
+        varopt_union.serialized_size_bytes(),
+        |buf| varopt_union.serialize_into(buf),
+    );
+}
+
+#[cfg(feature = "tdigest")]
+#[test]
+fn test_tdigest_serialize_into() {
+    use datasketches::tdigest::TDigestMut;
+
+    let mut td = TDigestMut::new(100);
+    let image = td.serialize();
+    let size = td.serialized_size_bytes();
+    check_serialize_into(&image, size, |buf| td.serialize_into(buf));
+    td.update(1.0);
+    let image = td.serialize();
+    let size = td.serialized_size_bytes();
+    check_serialize_into(&image, size, |buf| td.serialize_into(buf));
+    for i in 0..10_000 {
+        td.update(i as f64);
+    }
+    let image = td.serialize();
+    let size = td.serialized_size_bytes();
+    check_serialize_into(&image, size, |buf| td.serialize_into(buf));
+}
+
+#[cfg(feature = "theta")]
+#[test]
+fn test_theta_serialize_into() {
+    use datasketches::theta::ThetaSketchBuilder;
+
+    let mut sketch = ThetaSketchBuilder::default().lg_k(10).build();
+    let mut next = 0u64;
+    for n in [0, 1, 100, 10_000] {
+        while next < n {
+            sketch.update(next);
+            next += 1;
+        }
+        for ordered in [false, true] {
+            let compact = sketch.compact(ordered);
+            check_serialize_into(
+                &compact.serialize(),
+                compact.serialized_size_bytes(),
+                |buf| compact.serialize_into(buf),
+            );
+        }
+    }
+}
+
+#[cfg(feature = "tuple")]
+#[test]
+fn test_tuple_serialize_into() {
+    use datasketches::tuple::ArrayOfDoublesSketchBuilder;
+    use datasketches::tuple::DefaultUpdatePolicy;
+    use datasketches::tuple::TupleSketchBuilder;
+
+    let mut sketch = TupleSketchBuilder::new(DefaultUpdatePolicy::<u64>::default()).build();
+    let mut aod = ArrayOfDoublesSketchBuilder::new(3).build();
+    let mut next = 0u64;
+    for n in [0, 1, 10_000] {
+        while next < n {
+            sketch.update(next, 1u64);
+            aod.update(next, &[1.0, 2.0, 3.0]);
+            next += 1;
+        }
+        let compact = sketch.compact(true);
+        check_serialize_into(
+            &compact.serialize(),
+            compact.serialized_size_bytes(),
+            |buf| compact.serialize_into(buf),
+        );
+        let compact = aod.compact(true);
+        check_serialize_into(
+            &compact.serialize(),
+            compact.serialized_size_bytes(),
+            |buf| compact.serialize_into(buf),
+        );
+    }
+}
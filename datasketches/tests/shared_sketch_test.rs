@@ -0,0 +1,117 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(feature = "bloom", feature = "hll", feature = "theta"))]
+
+use std::sync::Arc;
+use std::thread;
+
+use datasketches::bloom::BloomFilterBuilder;
+use datasketches::bloom::SharedBloomFilter;
+use datasketches::common::SharedCompactSketch;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+use datasketches::hll::SharedHllSketch;
+use datasketches::theta::SharedCompactThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+
+fn assert_send_sync<T: Send + Sync>() {}
+
+#[test]
+fn test_shared_sketches_are_send_and_sync() {
+    assert_send_sync::<SharedHllSketch>();
+    assert_send_sync::<SharedCompactThetaSketch>();
+    assert_send_sync::<SharedBloomFilter>();
+}
+
+#[test]
+fn test_concurrent_queries_agree() {
+    // a union result estimates through the lazily cached composite estimator
+    let mut sketch = HllSketch::new(12, HllType::Hll4);
+    sketch.extend(0..100_000);
+    let mut other = HllSketch::new(12, HllType::Hll4);
+    other.extend(50_000..150_000);
+    let mut union = HllUnion::new(12);
+    union.update(&sketch);
+    union.update(&other);
+    let merged = union.to_sketch(HllType::Hll4);
+    assert!(merged.is_out_of_order());
+    let expected = merged.estimate();
+
+    let hll = SharedHllSketch::deserialize(&merged.serialize()).unwrap();
+    let mut theta = ThetaSketchBuilder::default().build();
+    theta.extend(0..100_000);
+    let theta = SharedCompactThetaSketch::new(theta.compact(true));
+    let mut bloom = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+    for i in 0..1000 {
+        bloom.insert(i);
+    }
+    let bloom = SharedBloomFilter::new(bloom);
+
+    let handles: Vec<_> = (0..8)
+        .map(|_| {
+            let (hll, theta, bloom) = (hll.clone(), theta.clone(), bloom.clone());
+            thread::spawn(move || {
+                let found = (0..1000).filter(|i| bloom.contains(i)).count();
+                (hll.estimate(), theta.estimate(), found)
+            })
+        })
+        .collect();
+    for handle in handles {
+        let (hll_estimate, theta_estimate, found) = handle.join().unwrap();
+        assert_eq!(hll_estimate, expected);
+        assert_eq!(theta_estimate, theta.estimate());
+        assert_eq!(found, 1000);
+    }
+}
+
+#[test]
+fn test_handles() {
+    let mut sketch = HllSketch::new(10, HllType::Hll8);
+    sketch.extend(0..100);
+    let shared = SharedHllSketch::new(sketch.clone());
+    let copy = shared.clone();
+    assert!(SharedCompactSketch::ptr_eq(&shared, &copy));
+    assert_eq!(shared, SharedHllSketch::from(sketch.clone()));
+    assert!(!SharedCompactSketch::ptr_eq(
+        &shared,
+        &SharedHllSketch::from(sketch.clone())
+    ));
+    assert_eq!(shared.as_ref().lg_config_k(), 10);
+
+    // the last handle unwraps the sketch, which can be updated again
+    drop(copy);
+    let mut owned = shared.into_inner();
+    owned.update("more");
+    assert_ne!(owned, sketch);
+
+    let arc = Arc::new(sketch.clone());
+    let shared = SharedHllSketch::from(Arc::clone(&arc));
+    assert_eq!(shared.into_inner(), *arc);
+}
+
+#[test]
+fn test_invalid_images() {
+    assert!(SharedHllSketch::deserialize(&[1, 2, 3]).is_err());
+    assert!(SharedCompactThetaSketch::deserialize(&[1, 2, 3]).is_err());
+    assert!(SharedBloomFilter::deserialize(&[1, 2, 3]).is_err());
+
+    let bloom = BloomFilterBuilder::with_size(1024, 3).build();
+    let shared = SharedBloomFilter::deserialize(&bloom.serialize()).unwrap();
+    assert_eq!(*shared, bloom);
+}
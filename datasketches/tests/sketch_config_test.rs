@@ -0,0 +1,124 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(all(
+    feature = "bloom",
+    feature = "hll",
+    feature = "theta",
+    feature = "tuple"
+))]
+
+use datasketches::bloom::BloomFilterBuilder;
+use datasketches::common::SketchConfig;
+use datasketches::hll::HllSketchBuilder;
+use datasketches::hll::HllType;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::theta::ThetaUnionBuilder;
+use datasketches::tuple::ArrayOfDoublesSketchBuilder;
+
+fn config() -> SketchConfig {
+    let mut config = SketchConfig::default();
+    config.seed = Some(42);
+    config.lg_k = Some(11);
+    config.hll_type = Some(HllType::Hll6);
+    config
+}
+
+#[test]
+fn test_default_config_keeps_builder_defaults() {
+    let config = SketchConfig::default();
+    assert_eq!(
+        HllSketchBuilder::default().config(&config).build(),
+        HllSketchBuilder::default().build()
+    );
+
+    let mut sketch = ThetaSketchBuilder::default().config(&config).build();
+    let mut expected = ThetaSketchBuilder::default().build();
+    sketch.extend(0..100);
+    expected.extend(0..100);
+    assert_eq!(sketch.compact(true), expected.compact(true));
+
+    let filter = BloomFilterBuilder::with_size(1024, 3)
+        .config(&config)
+        .build();
+    assert_eq!(
+        filter.serialize(),
+        BloomFilterBuilder::with_size(1024, 3).build().serialize()
+    );
+}
+
+#[test]
+fn test_config_applies_to_builders() {
+    let config = config();
+
+    let hll = HllSketchBuilder::default().config(&config).build();
+    assert_eq!(hll.lg_config_k(), 11);
+    assert_eq!(hll.target_type(), HllType::Hll6);
+
+    let mut theta = ThetaSketchBuilder::default().config(&config).build();
+    let mut expected = ThetaSketchBuilder::default().lg_k(11).seed(42).build();
+    assert_eq!(theta.lg_k(), 11);
+    theta.extend(0..10000);
+    expected.extend(0..10000);
+    assert_eq!(theta.compact(true), expected.compact(true));
+
+    let mut union = ThetaUnionBuilder::default().config(&config).build();
+    union.update(&theta).unwrap();
+    assert!(union.update(&ThetaSketchBuilder::default().build()).is_ok());
+    let mut unseeded = ThetaSketchBuilder::default().build();
+    unseeded.update(1);
+    assert!(union.update(&unseeded).is_err());
+
+    let aod = ArrayOfDoublesSketchBuilder::new(2).config(&config).build();
+    assert_eq!(aod.lg_k(), 11);
+    assert_eq!(
+        aod.seed_hash(),
+        ArrayOfDoublesSketchBuilder::new(2)
+            .seed(42)
+            .build()
+            .seed_hash()
+    );
+
+    let filter = BloomFilterBuilder::with_size(1024, 3)
+        .config(&config)
+        .build();
+    assert_eq!(
+        filter.serialize(),
+        BloomFilterBuilder::with_size(1024, 3)
+            .seed(42)
+            .build()
+            .serialize()
+    );
+}
+
+#[test]
+fn test_setters_after_config_take_precedence() {
+    let hll = HllSketchBuilder::default()
+        .config(&config())
+        .lg_k(8)
+        .build();
+    assert_eq!(hll.lg_config_k(), 8);
+    assert_eq!(hll.target_type(), HllType::Hll6);
+}
+
+#[test]
+#[should_panic(expected = "lg_config_k must be in [4, 21]")]
+fn test_config_lg_k_out_of_range_for_hll() {
+    let mut config = SketchConfig::default();
+    config.lg_k = Some(24);
+    HllSketchBuilder::default().config(&config);
+}
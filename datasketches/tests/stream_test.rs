@@ -0,0 +1,524 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+use std::io;
+
+use datasketches::error::Error;
+use datasketches::error::ErrorKind;
+
+/// Checks that `write_to` streams the image `serialize` returns, and that `read_from` reads
+/// back-to-back images one at a time and rejects a truncated one.
+#[allow(dead_code)]
+fn check_stream<S>(
+    image: &[u8],
+    write_to: impl Fn(&mut Vec<u8>) -> io::Result<()>,
+    read_from: impl Fn(&mut &[u8]) -> Result<S, Error>,
+    serialize: impl Fn(&S) -> Vec<u8>,
+) {
+    let mut stream = Vec::new();
+    write_to(&mut stream).unwrap();
+    write_to(&mut stream).unwrap();
+    assert_eq!(stream, [image, image].concat());
+
+    let mut reader = stream.as_slice();
+    for _ in 0..2 {
+        let decoded = read_from(&mut reader).unwrap();
+        assert_eq!(serialize(&decoded), image);
+    }
+    assert!(reader.is_empty());
+
+    let mut truncated = &image[..image.len() - 1];
+    let err = read_from(&mut truncated).err().unwrap();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+}
+
+#[cfg(feature = "bloom")]
+#[test]
+fn test_bloom_stream() {
+    use datasketches::bloom::BloomFilter;
+    use datasketches::bloom::BloomFilterBuilder;
+
+    let mut filter = BloomFilterBuilder::with_accuracy(1000, 0.01).build();
+    for n in [0, 100] {
+        for i in 0..n {
+            filter.insert(i);
+        }
+        check_stream(
+            &filter.serialize(),
+            |w| filter.write_to(w),
+            |r| BloomFilter::read_from(r),
+            |f| f.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "bloom")]
+#[test]
+fn test_write_to_reports_writer_error() {
+    use datasketches::bloom::BloomFilterBuilder;
+
+    /// A writer that fails once it has accepted `capacity` bytes.
+    struct LimitedWriter {
+        written: Vec<u8>,
+        capacity: usize,
+    }
+
+    impl io::Write for LimitedWriter {
+        fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
+            let n = buf.len().min(self.capacity - self.written.len());
+            if n == 0 && !buf.is_empty() {
+                return Err(io::Error::other("writer is full"));
+            }
+            self.written.extend_from_slice(&buf[..n]);
+            Ok(n)
+        }
+
+        fn flush(&mut self) -> io::Result<()> {
+            Ok(())
+        }
+    }
+
+    // large enough to be handed to the writer in several chunks
+    let mut filter = BloomFilterBuilder::with_accuracy(100_000, 0.01).build();
+    filter.insert(1);
+    let image = filter.serialize();
+    assert!(image.len() > 3 * 8192);
+
+    for capacity in [0, 100, 8192, image.len() - 1] {
+        let mut writer = LimitedWriter {
+            written: Vec::new(),
+            capacity,
+        };
+        assert!(filter.write_to(&mut writer).is_err());
+        assert_eq!(writer.written, image[..capacity]);
+    }
+    let mut writer = LimitedWriter {
+        written: Vec::new(),
+        capacity: image.len(),
+    };
+    filter.write_to(&mut writer).unwrap();
+    assert_eq!(writer.written, image);
+}
+
+#[cfg(feature = "countmin")]
+#[test]
+fn test_countmin_stream() {
+    use datasketches::countmin::CountMinSketch;
+
+    let mut sketch = CountMinSketch::<u64>::with_seed(3, 64, 7);
+    for n in [0, 100] {
+        for i in 0..n {
+            sketch.update(i);
+        }
+        check_stream(
+            &sketch.serialize(),
+            |w| sketch.write_to(w),
+            |r| CountMinSketch::<u64>::read_from_with_seed(r, 7),
+            |s| s.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "cpc")]
+#[test]
+fn test_cpc_stream() {
+    use datasketches::cpc::CpcSketch;
+
+    let mut sketch = CpcSketch::new(11);
+    let mut next = 0;
+    for n in [0, 10, 1_000, 100_000] {
+        while next < n {
+            sketch.update(next);
+            next += 1;
+        }
+        check_stream(
+            &sketch.serialize(),
+            |w| sketch.write_to(w),
+            |r| CpcSketch::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "density")]
+#[test]
+fn test_density_stream() {
+    use datasketches::density::DensitySketch;
+
+    let mut sketch = DensitySketch::new(10, 2);
+    for n in [0, 1000] {
+        for i in 0..n {
+            let x = i as f64;
+            sketch.update(&[x, -x]);
+        }
+        check_stream(
+            &sketch.serialize(),
+            |w| sketch.write_to(w),
+            |r| DensitySketch::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "frequencies")]
+#[test]
+fn test_frequencies_stream() {
+    use datasketches::frequencies::FrequentItemsSketch;
+
+    let mut sketch = FrequentItemsSketch::<String>::new(32);
+    for n in [0, 1000] {
+        for i in 0..n {
+            sketch.update(format!("item{}", i % 50));
+        }
+        check_stream(
+            &sketch.serialize(),
+            |w| sketch.write_to(w),
+            |r| FrequentItemsSketch::<String>::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "hll")]
+#[test]
+fn test_hll_stream() {
+    use datasketches::hll::HllSketch;
+    use datasketches::hll::HllType;
+
+    for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+        let mut sketch = HllSketch::new(10, hll_type);
+        let mut next = 0u64;
+        // empty, List, Set and HLL modes
+        for n in [0, 5, 100, 10_000] {
+            while next < n {
+                sketch.update(next);
+                next += 1;
+            }
+            check_stream(
+                &sketch.serialize(),
+                |w| sketch.write_to(w),
+                |r| HllSketch::read_from(r),
+                |s| s.serialize(),
+            );
+        }
+    }
+}
+
+#[cfg(feature = "hll")]
+#[test]
+fn test_hll_read_updatable_images_from_stream() {
+    use datasketches::hll::HllSketch;
+    use datasketches::hll::HllType;
+
+    let mut sketch = HllSketch::new(10, HllType::Hll4);
+    let mut next = 0u64;
+    for n in [0, 5, 100, 10_000] {
+        while next < n {
+            sketch.update(next);
+            next += 1;
+        }
+        let image = sketch.serialize_updatable();
+        let stream = [image.as_slice(), image.as_slice()].concat();
+        let mut reader = stream.as_slice();
+        for _ in 0..2 {
+            let decoded = HllSketch::read_from(&mut reader).unwrap();
+            assert_eq!(decoded.serialize(), sketch.serialize());
+        }
+        assert!(reader.is_empty());
+    }
+}
+
+#[cfg(feature = "kll")]
+#[test]
+fn test_kll_stream() {
+    use datasketches::kll::KllItemsSketch;
+    use datasketches::kll::KllSketch;
+
+    let mut sketch = KllSketch::<f32>::new(200);
+    let mut items = KllItemsSketch::<String>::new(200);
+    let mut next = 0;
+    for n in [0, 1, 10_000] {
+        while next < n {
+            sketch.update(next as f32);
+            items.update(format!("{next:05}"));
+            next += 1;
+        }
+        check_stream(
+            &sketch.serialize(),
+            |w| sketch.write_to(w),
+            |r| KllSketch::<f32>::read_from(r),
+            |s| s.serialize(),
+        );
+        check_stream(
+            &items.serialize(),
+            |w| items.write_to(w),
+            |r| KllItemsSketch::<String>::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "matrix")]
+#[test]
+fn test_matrix_stream() {
+    use datasketches::matrix::FrequentDirections;
+
+    let mut sketch = FrequentDirections::new(4, 3);
+    for n in [0, 1000] {
+        for i in 0..n {
+            let x = i as f64;
+            sketch.update(&[x, x.sin(), -x]);
+        }
+        check_stream(
+            &sketch.serialize(),
+            |w| sketch.write_to(w),
+            |r| FrequentDirections::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "quantiles")]
+#[test]
+fn test_quantiles_stream() {
+    use datasketches::quantiles::DoublesSketch;
+
+    let mut sketch = DoublesSketch::new(64);
+    for n in [0, 10_000] {
+        for i in 0..n {
+            sketch.update(i as f64);
+        }
+        check_stream(
+            &sketch.serialize(),
+            |w| sketch.write_to(w),
+            |r| DoublesSketch::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "quotient")]
+#[test]
+fn test_quotient_stream() {
+    use datasketches::quotient::QuotientFilter;
+    use datasketches::quotient::QuotientFilterBuilder;
+
+    let mut filter = QuotientFilterBuilder::with_size(8, 16).build();
+    for n in [0, 100] {
+        for i in 0..n {
+            filter.insert(i);
+        }
+        check_stream(
+            &filter.serialize(),
+            |w| filter.write_to(w),
+            |r| QuotientFilter::read_from(r),
+            |f| f.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "req")]
+#[test]
+fn test_req_stream() {
+    use datasketches::req::ReqSketch;
+
+    let mut sketch = ReqSketch::default();
+    let mut next = 0;
+    for n in [0, 1, 10_000] {
+        while next < n {
+            sketch.update(next as f32);
+            next += 1;
+        }
+        check_stream(
+            &sketch.serialize(),
+            |w| sketch.write_to(w),
+            |r| ReqSketch::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "sampling")]
+#[test]
+fn test_sampling_stream() {
+    use datasketches::sampling::EbppsItemsSketch;
+    use datasketches::sampling::ReservoirItemsSketch;
+    use datasketches::sampling::ReservoirUnion;
+    use datasketches::sampling::VarOptItemsSketch;
+    use datasketches::sampling::VarOptUnion;
+
+    let mut reservoir = ReservoirItemsSketch::<String>::new(16);
+    let mut varopt = VarOptItemsSketch::<u64>::new(16);
+    let mut ebpps = EbppsItemsSketch::<u64>::new(16);
+    let mut next = 0u64;
+    for n in [0, 8, 1000] {
+        while next < n {
+            reservoir.update(format!("item{next}"));
+            varopt.update(next, (next % 7 + 1) as f64);
+            ebpps.update(next, (next % 7 + 1) as f64);
+            next += 1;
+        }
+        check_stream(
+            &reservoir.serialize(),
+            |w| reservoir.write_to(w),
+            |r| ReservoirItemsSketch::<String>::read_from(r),
+            |s| s.serialize(),
+        );
+        check_stream(
+            &varopt.serialize(),
+            |w| varopt.write_to(w),
+            |r| VarOptItemsSketch::<u64>::read_from(r),
+            |s| s.serialize(),
+        );
+        check_stream(
+            &ebpps.serialize(),
+            |w| ebpps.write_to(w),
+            |r| EbppsItemsSketch::<u64>::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+
+    let mut reservoir_union = ReservoirUnion::<String>::new(16);
+    reservoir_union.update(&reservoir);
+    check_stream(
+        &reservoir_union.serialize(),
+        |w| reservoir_union.write_to(w),
+        |r| ReservoirUnion::<String>::read_from(r),
+        |u| u.serialize(),
+    );
+
+    let mut varopt_union = VarOptUnion::<u64>::new(16);
+    varopt_union.update(&varopt);
+    check_stream(
+        &varopt_union.serialize(),
+        |w| varopt_union.write_to(w),
+        |r| VarOptUnion::<u64>::read_from(r),
+        |u| u.serialize(),
+    );
+}
+
+#[cfg(feature = "tdigest")]
+#[test]
+fn test_tdigest_stream() {
+    use std::cell::RefCell;
+
+    use datasketches::tdigest::TDigestMut;
+
+    let td = RefCell::new(TDigestMut::new(100));
+    let mut next = 0;
+    for n in [0, 1, 10_000] {
+        while next < n {
+            td.borrow_mut().update(next as f64);
+            next += 1;
+        }
+        let image = td.borrow_mut().serialize();
+        check_stream(
+            &image,
+            |w| td.borrow_mut().write_to(w),
+            |r| TDigestMut::read_from(r, false),
+            |t| t.clone().serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "tdigest")]
+#[test]
+fn test_tdigest_read_compat_image_from_stream() {
+    use datasketches::tdigest::TDigestMut;
+
+    // the big-endian asBytes() format of the reference implementation
+    let mut image = Vec::new();
+    image.extend_from_slice(&1u32.to_be_bytes());
+    image.extend_from_slice(&1.0f64.to_be_bytes());
+    image.extend_from_slice(&2.0f64.to_be_bytes());
+    image.extend_from_slice(&100.0f64.to_be_bytes());
+    image.extend_from_slice(&2u32.to_be_bytes());
+    for (weight, mean) in [(1.0f64, 1.0f64), (1.0, 2.0)] {
+        image.extend_from_slice(&weight.to_be_bytes());
+        image.extend_from_slice(&mean.to_be_bytes());
+    }
+
+    let stream = [image.as_slice(), image.as_slice()].concat();
+    let mut reader = stream.as_slice();
+    for _ in 0..2 {
+        let mut td = TDigestMut::read_from(&mut reader, false).unwrap();
+        assert_eq!(td.total_weight(), 2);
+        assert_eq!(
+            td.serialize(),
+            TDigestMut::deserialize(&image, false).unwrap().serialize()
+        );
+    }
+    assert!(reader.is_empty());
+}
+
+#[cfg(feature = "theta")]
+#[test]
+fn test_theta_stream() {
+    use datasketches::theta::CompactThetaSketch;
+    use datasketches::theta::ThetaSketchBuilder;
+
+    let mut sketch = ThetaSketchBuilder::default().lg_k(10).build();
+    let mut next = 0u64;
+    for n in [0, 1, 100, 10_000] {
+        while next < n {
+            sketch.update(next);
+            next += 1;
+        }
+        let compact = sketch.compact(true);
+        check_stream(
+            &compact.serialize(),
+            |w| compact.write_to(w),
+            |r| CompactThetaSketch::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+}
+
+#[cfg(feature = "tuple")]
+#[test]
+fn test_tuple_stream() {
+    use datasketches::tuple::ArrayOfDoublesSketchBuilder;
+    use datasketches::tuple::CompactArrayOfDoublesSketch;
+    use datasketches::tuple::CompactTupleSketch;
+    use datasketches::tuple::DefaultUpdatePolicy;
+    use datasketches::tuple::TupleSketchBuilder;
+
+    let mut sketch = TupleSketchBuilder::new(DefaultUpdatePolicy::<u64>::default()).build();
+    let mut aod = ArrayOfDoublesSketchBuilder::new(2).build();
+    let mut next = 0u64;
+    for n in [0, 1, 10_000] {
+        while next < n {
+            sketch.update(next, 1u64);
+            aod.update(next, &[1.0, 2.0]);
+            next += 1;
+        }
+        let compact = sketch.compact(true);
+        check_stream(
+            &compact.serialize(),
+            |w| compact.write_to(w),
+            |r| CompactTupleSketch::<u64>::read_from(r),
+            |s| s.serialize(),
+        );
+        let compact = aod.compact(true);
+        check_stream(
+            &compact.serialize(),
+            |w| compact.write_to(w),
+            |r| CompactArrayOfDoublesSketch::read_from(r),
+            |s| s.serialize(),
+        );
+    }
+}
@@ -190,3 +190,31 @@ fn test_many_values() {
     assert_eq!(td.rank(500.0), deserialized_td.rank(500.0));
     assert_eq!(td.quantile(0.5), deserialized_td.quantile(0.5));
 }
+
+#[test]
+fn test_total_weight_bounded_with_buffered_values() {
+    let mut td = TDigestMut::new(100);
+    td.update(0.0);
+    td.update(1.0);
+    let header = &td.serialize()[..8];
+
+    let image = |centroid_weight: u64| {
+        let mut bytes = header.to_vec();
+        bytes.extend_from_slice(&1u32.to_le_bytes()); // num_centroids
+        bytes.extend_from_slice(&1u32.to_le_bytes()); // num_buffered
+        bytes.extend_from_slice(&0.0f64.to_le_bytes());
+        bytes.extend_from_slice(&1.0f64.to_le_bytes());
+        bytes.extend_from_slice(&0.5f64.to_le_bytes());
+        bytes.extend_from_slice(&centroid_weight.to_le_bytes());
+        bytes.extend_from_slice(&1.0f64.to_le_bytes());
+        bytes
+    };
+
+    // the buffered value would push the total weight past u64::MAX
+    assert!(TDigestMut::deserialize(&image(u64::MAX), false).is_err());
+
+    let mut td = TDigestMut::deserialize(&image(u64::MAX - 1), false).unwrap();
+    assert_eq!(td.total_weight(), u64::MAX);
+    let restored = TDigestMut::deserialize(&td.serialize(), false).unwrap();
+    assert_eq!(restored.total_weight(), u64::MAX);
+}
@@ -198,6 +198,18 @@ fn test_merge_large() {
     assert_that!(td1.rank(n as f64).unwrap(), eq(1.0));
 }
 
+#[test]
+fn test_merge_with_largest_k() {
+    let mut td = TDigestMut::new(u16::MAX);
+    for i in 0..1000 {
+        td.update(i as f64);
+    }
+    let mut merged = TDigestMut::new(u16::MAX);
+    merged.merge(&td);
+    assert_eq!(merged.total_weight(), 1000);
+    assert_eq!(merged.quantile(0.5), td.quantile(0.5));
+}
+
 #[test]
 fn test_invalid_inputs() {
     let n = 100;
@@ -0,0 +1,206 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "theta")]
+
+use datasketches::common::NumStdDev;
+use datasketches::theta::ThetaAnotB;
+use datasketches::theta::ThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+
+fn sketch_with_range(lg_k: u8, start: u64, count: u64) -> ThetaSketch {
+    let mut sketch = ThetaSketchBuilder::default().lg_k(lg_k).build();
+    for i in 0..count {
+        sketch.update(start + i);
+    }
+    sketch
+}
+
+#[test]
+fn test_empty_inputs() {
+    let empty = ThetaSketchBuilder::default().build();
+    let a_not_b = ThetaAnotB::new_with_default_seed();
+
+    let result = a_not_b.compute(&empty, &empty, true).unwrap();
+    assert!(result.is_empty());
+    assert_eq!(result.estimate(), 0.0);
+
+    let mut stateful = ThetaAnotB::new_with_default_seed();
+    stateful.not_b(&empty).unwrap();
+    assert!(stateful.to_sketch(true).is_empty());
+}
+
+#[test]
+fn test_non_empty_minus_empty_is_identity() {
+    let a = sketch_with_range(12, 0, 1000);
+    let empty = ThetaSketchBuilder::default().build();
+
+    let result = ThetaAnotB::new_with_default_seed()
+        .compute(&a, &empty, false)
+        .unwrap();
+    assert_eq!(result.estimate(), a.estimate());
+    assert_eq!(result.num_retained(), a.num_retained());
+}
+
+#[test]
+fn test_empty_minus_non_empty_is_empty() {
+    let empty = ThetaSketchBuilder::default().build();
+    let b = sketch_with_range(12, 0, 1000);
+
+    let result = ThetaAnotB::new_with_default_seed()
+        .compute(&empty, &b, true)
+        .unwrap();
+    assert!(result.is_empty());
+}
+
+#[test]
+fn test_exact_half_overlap() {
+    let a = sketch_with_range(12, 0, 1000);
+    let b = sketch_with_range(12, 500, 1000);
+
+    let a_not_b = ThetaAnotB::new_with_default_seed();
+    let result = a_not_b.compute(&a, &b, false).unwrap();
+    assert!(!result.is_empty());
+    assert!(!result.is_estimation_mode());
+    assert_eq!(result.estimate(), 500.0);
+
+    let ordered = a_not_b
+        .compute(&a.compact(true), &b.compact(true), true)
+        .unwrap();
+    assert!(ordered.is_ordered());
+    assert_eq!(ordered.estimate(), 500.0);
+}
+
+#[test]
+fn test_exact_disjoint() {
+    let a = sketch_with_range(12, 0, 1000);
+    let b = sketch_with_range(12, 1000, 1000);
+
+    let result = ThetaAnotB::new_with_default_seed()
+        .compute(&a, &b, true)
+        .unwrap();
+    assert_eq!(result.estimate(), 1000.0);
+}
+
+#[test]
+fn test_exact_full_overlap() {
+    let a = sketch_with_range(12, 0, 1000);
+
+    let result = ThetaAnotB::new_with_default_seed()
+        .compute(&a, &a, true)
+        .unwrap();
+    assert!(result.is_empty());
+    assert_eq!(result.estimate(), 0.0);
+}
+
+#[test]
+fn test_estimation_half_overlap() {
+    let a = sketch_with_range(12, 0, 10000);
+    let b = sketch_with_range(12, 5000, 10000);
+
+    let result = ThetaAnotB::new_with_default_seed()
+        .compute(&a, &b, true)
+        .unwrap();
+    assert!(!result.is_empty());
+    assert!(result.is_estimation_mode());
+    assert!(result.lower_bound(NumStdDev::Three) <= 5000.0);
+    assert!(result.upper_bound(NumStdDev::Three) >= 5000.0);
+    assert!((result.estimate() - 5000.0).abs() < 5000.0 * 0.03);
+}
+
+#[test]
+fn test_estimation_full_overlap_is_not_empty() {
+    let a = sketch_with_range(12, 0, 10000);
+
+    let result = ThetaAnotB::new_with_default_seed()
+        .compute(&a, &a, true)
+        .unwrap();
+    assert!(!result.is_empty());
+    assert!(result.is_estimation_mode());
+    assert_eq!(result.num_retained(), 0);
+    assert_eq!(result.estimate(), 0.0);
+}
+
+#[test]
+fn test_stateful_matches_stateless() {
+    let a = sketch_with_range(12, 0, 10000);
+    let b = sketch_with_range(12, 2000, 2000);
+    let c = sketch_with_range(12, 6000, 2000);
+
+    let mut stateful = ThetaAnotB::new_with_default_seed();
+    stateful.set_a(&a).unwrap();
+    stateful.not_b(&b).unwrap();
+    stateful.not_b(&c.compact(false)).unwrap();
+    let result = stateful.to_sketch(true);
+
+    let stateless = ThetaAnotB::new_with_default_seed();
+    let a_not_b = stateless.compute(&a, &b, false).unwrap();
+    let expected = stateless.compute(&a_not_b, &c, true).unwrap();
+
+    assert!(result.is_ordered());
+    assert_eq!(result.num_retained(), expected.num_retained());
+    assert_eq!(result.theta64(), expected.theta64());
+    assert_eq!(result.estimate(), expected.estimate());
+}
+
+#[test]
+fn test_stateful_set_a_replaces_state() {
+    let a = sketch_with_range(12, 0, 1000);
+    let b = sketch_with_range(12, 0, 500);
+
+    let mut stateful = ThetaAnotB::new_with_default_seed();
+    stateful.set_a(&a).unwrap();
+    stateful.not_b(&b).unwrap();
+    assert_eq!(stateful.to_sketch(false).estimate(), 500.0);
+
+    stateful.set_a(&a).unwrap();
+    assert_eq!(stateful.to_sketch(false).estimate(), 1000.0);
+
+    stateful.reset();
+    assert!(stateful.to_sketch(true).is_empty());
+}
+
+#[test]
+fn test_seed_mismatch() {
+    let mut a = ThetaSketchBuilder::default().seed(123).build();
+    a.update(1);
+    let mut b = ThetaSketchBuilder::default().build();
+    b.update(1);
+
+    let a_not_b = ThetaAnotB::new_with_default_seed();
+    assert!(a_not_b.compute(&a, &b, true).is_err());
+    assert!(a_not_b.compute(&b, &a, true).is_err());
+
+    let mut stateful = ThetaAnotB::new_with_default_seed();
+    assert!(stateful.set_a(&a).is_err());
+}
+
+#[test]
+fn test_estimation_bounds_of_contained_a() {
+    let a = sketch_with_range(12, 0, 10000);
+    let b = sketch_with_range(12, 0, 20000);
+
+    let result = ThetaAnotB::new_with_default_seed()
+        .compute(&a, &b, true)
+        .unwrap();
+    // every retained entry of A is in B, yet the difference is only known to be small
+    assert!(!result.is_empty());
+    assert_eq!(result.num_retained(), 0);
+    assert_eq!(result.lower_bound(NumStdDev::Two), 0.0);
+    assert!(result.upper_bound(NumStdDev::Two) > 0.0);
+    assert!(result.upper_bound(NumStdDev::Two) < a.estimate() * 0.01);
+}
@@ -0,0 +1,126 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "theta")]
+
+use datasketches::common::NumStdDev;
+use datasketches::theta::ThetaSketchBuilder;
+
+#[test]
+fn test_exact_mode_matches_sequential_sketch() {
+    let sketch = ThetaSketchBuilder::default().lg_k(12).build_concurrent();
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.estimate(), 0.0);
+
+    // Every thread sees the same 1000 values.
+    std::thread::scope(|s| {
+        for _ in 0..4 {
+            let mut buffer = sketch.buffer();
+            s.spawn(move || {
+                for i in 0..1000 {
+                    buffer.update(i);
+                }
+            });
+        }
+    });
+
+    let mut sequential = ThetaSketchBuilder::default().lg_k(12).build();
+    for i in 0..1000 {
+        sequential.update(i);
+    }
+    assert!(!sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.estimate(), 1000.0);
+    assert_eq!(sketch.num_retained(), 1000);
+    assert_eq!(sketch.lower_bound(NumStdDev::One), 1000.0);
+    assert_eq!(
+        sketch.compact(true).serialize(),
+        sequential.compact(true).serialize()
+    );
+}
+
+#[test]
+fn test_estimation_mode() {
+    let sketch = ThetaSketchBuilder::default().lg_k(10).build_concurrent();
+    std::thread::scope(|s| {
+        for t in 0..8u64 {
+            let mut buffer = sketch.buffer_with_capacity(64);
+            s.spawn(move || {
+                for i in 0..25_000 {
+                    buffer.update(t * 25_000 + i);
+                }
+            });
+        }
+    });
+
+    assert!(sketch.theta() < 1.0);
+    assert!(sketch.is_estimation_mode());
+    let compact = sketch.compact(false);
+    assert_eq!(compact.estimate(), sketch.estimate());
+    assert_eq!(compact.theta64(), sketch.theta64());
+    assert_eq!(compact.num_retained(), sketch.num_retained());
+    assert!(compact.lower_bound(NumStdDev::Three) <= 200_000.0);
+    assert!(compact.upper_bound(NumStdDev::Three) >= 200_000.0);
+    assert_eq!(
+        sketch.lower_bound(NumStdDev::Two),
+        compact.lower_bound(NumStdDev::Two)
+    );
+    assert_eq!(
+        sketch.upper_bound(NumStdDev::Two),
+        compact.upper_bound(NumStdDev::Two)
+    );
+}
+
+#[test]
+fn test_estimate_lags_until_flush() {
+    let sketch = ThetaSketchBuilder::default().build_concurrent();
+    let mut buffer = sketch.buffer_with_capacity(10);
+    for i in 0..5 {
+        buffer.update(i);
+    }
+    assert_eq!(sketch.estimate(), 0.0);
+    buffer.flush();
+    assert_eq!(sketch.estimate(), 5.0);
+
+    for i in 5..15 {
+        buffer.update(i);
+    }
+    // The buffer propagated once it held 10 hashes.
+    assert_eq!(sketch.estimate(), 15.0);
+
+    buffer.update(15);
+    drop(buffer);
+    assert_eq!(sketch.estimate(), 16.0);
+
+    let handle = sketch.clone();
+    handle.reset();
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.estimate(), 0.0);
+}
+
+#[test]
+fn test_sampled_sketch_is_not_empty_after_updates() {
+    let sketch = ThetaSketchBuilder::default()
+        .sampling_probability(0.001)
+        .build_concurrent();
+    let mut buffer = sketch.buffer();
+    for i in 0..10 {
+        buffer.update(i);
+    }
+    buffer.flush();
+    assert!(!sketch.is_empty());
+}
@@ -0,0 +1,153 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "theta")]
+
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaIntersection;
+use datasketches::theta::ThetaSketchBuilder;
+
+fn theta_of(range: std::ops::Range<u64>) -> CompactThetaSketch {
+    let mut sketch = ThetaSketchBuilder::default().lg_k(12).build();
+    sketch.extend(range);
+    sketch.compact(true)
+}
+
+fn assert_near(estimate: f64, expected: f64, tolerance: f64) {
+    assert!(
+        (estimate - expected).abs() <= expected * tolerance,
+        "estimate {estimate} is not within {tolerance} of {expected}"
+    );
+}
+
+#[cfg(feature = "hll")]
+mod hll {
+    use datasketches::hll::HllSketch;
+    use datasketches::hll::HllType;
+    use datasketches::hll::HllUnion;
+    use datasketches::theta::ThetaSketchBuilder;
+
+    use super::*;
+
+    #[test]
+    fn test_empty_and_exact_sketches() {
+        let empty = ThetaSketchBuilder::default().build();
+        assert!(HllSketch::from_theta(&empty, 10, HllType::Hll8).is_empty());
+
+        // Set mode counts the coupons of the retained hashes
+        let sketch = HllSketch::from_theta(&theta_of(0..50), 10, HllType::Hll8);
+        assert!(!sketch.is_out_of_order());
+        assert_near(sketch.estimate(), 50.0, 0.05);
+
+        for hll_type in [HllType::Hll4, HllType::Hll6, HllType::Hll8] {
+            let sketch = HllSketch::from_theta(&theta_of(0..4000), 10, hll_type);
+            assert_eq!(sketch.target_type(), hll_type);
+            assert!(sketch.is_out_of_order());
+            assert_near(sketch.estimate(), 4000.0, 0.1);
+        }
+    }
+
+    #[test]
+    fn test_estimation_mode() {
+        for n in [10_000, 100_000, 400_000] {
+            let theta = theta_of(0..n);
+            assert!(theta.is_estimation_mode());
+            for lg_config_k in [8, 10, 12] {
+                let sketch = HllSketch::from_theta(&theta, lg_config_k, HllType::Hll8);
+                assert_near(sketch.estimate(), n as f64, 0.25);
+            }
+        }
+
+        // the compact form of the image is read the same
+        let bytes = theta_of(0..100_000).serialize();
+        let wrapper = CompactThetaSketch::wrap(&bytes).unwrap();
+        let sketch = HllSketch::from_theta(&wrapper, 10, HllType::Hll4);
+        assert_near(sketch.estimate(), 100_000.0, 0.15);
+    }
+
+    #[test]
+    fn test_union_of_converted_sketches() {
+        let mut union = HllUnion::new(10);
+        for part in 0..4 {
+            let theta = theta_of(part * 100_000..(part + 2) * 100_000);
+            union.update(&HllSketch::from_theta(&theta, 10, HllType::Hll8));
+        }
+        assert_near(union.estimate(), 500_000.0, 0.15);
+    }
+
+    #[test]
+    fn test_intersection_result() {
+        let mut intersection = ThetaIntersection::new_with_default_seed();
+        intersection.update(&theta_of(0..400_000)).unwrap();
+        intersection.update(&theta_of(300_000..700_000)).unwrap();
+        let result = intersection.to_sketch(true);
+
+        // the few retained hashes of the overlap do not stand for the whole theta range
+        let sketch = HllSketch::from_theta(&result, 10, HllType::Hll8);
+        assert_near(sketch.estimate(), 100_000.0, 0.3);
+    }
+}
+
+#[cfg(feature = "cpc")]
+mod cpc {
+    use datasketches::cpc::CpcSketch;
+    use datasketches::cpc::CpcUnion;
+    use datasketches::theta::ThetaSketchBuilder;
+
+    use super::*;
+
+    #[test]
+    fn test_empty_and_exact_sketches() {
+        let empty = ThetaSketchBuilder::default().build();
+        assert!(CpcSketch::from_theta(&empty, 10).is_empty());
+
+        for n in [100, 4000] {
+            let sketch = CpcSketch::from_theta(&theta_of(0..n), 10);
+            assert_near(sketch.estimate(), n as f64, 0.1);
+        }
+    }
+
+    #[test]
+    fn test_estimation_mode() {
+        for n in [10_000, 100_000, 400_000] {
+            let theta = theta_of(0..n);
+            for lg_k in [8, 10, 12] {
+                let sketch = CpcSketch::from_theta(&theta, lg_k);
+                assert_near(sketch.estimate(), n as f64, 0.25);
+            }
+        }
+
+        // an update sketch converts like its compact form
+        let mut theta = ThetaSketchBuilder::default().lg_k(12).build();
+        theta.extend(0..100_000);
+        assert_near(
+            CpcSketch::from_theta(&theta, 10).estimate(),
+            100_000.0,
+            0.15,
+        );
+    }
+
+    #[test]
+    fn test_union_of_converted_sketches() {
+        let mut union = CpcUnion::new(10);
+        for part in 0..4 {
+            let theta = theta_of(part * 100_000..(part + 2) * 100_000);
+            union.update(&CpcSketch::from_theta(&theta, 10));
+        }
+        assert_near(union.to_sketch().estimate(), 500_000.0, 0.15);
+    }
+}
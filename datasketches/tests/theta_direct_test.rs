@@ -0,0 +1,179 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "theta")]
+
+use datasketches::common::NumStdDev;
+use datasketches::common::ResizeFactor;
+use datasketches::error::ErrorKind;
+use datasketches::theta::DirectThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::theta::ThetaUnionBuilder;
+
+#[test]
+fn test_direct_matches_heap_sketch() {
+    for resize_factor in [ResizeFactor::X1, ResizeFactor::X2, ResizeFactor::X8] {
+        for n in [0, 1, 100, 10_000] {
+            let builder = || {
+                ThetaSketchBuilder::default()
+                    .lg_k(9)
+                    .resize_factor(resize_factor)
+            };
+            let mut heap = builder().build();
+            let mut buf = vec![0u8; DirectThetaSketch::required_size_bytes(9)];
+            let mut direct = builder().build_direct(&mut buf).unwrap();
+            for i in 0..n {
+                heap.update(i);
+                direct.update(i);
+            }
+
+            assert_eq!(direct.is_empty(), heap.is_empty());
+            assert_eq!(direct.num_retained(), heap.num_retained());
+            assert_eq!(direct.theta64(), heap.theta64());
+            assert_eq!(direct.estimate(), heap.estimate());
+            assert_eq!(
+                direct.lower_bound(NumStdDev::Two),
+                heap.lower_bound(NumStdDev::Two)
+            );
+            assert_eq!(
+                direct.upper_bound(NumStdDev::Two),
+                heap.upper_bound(NumStdDev::Two)
+            );
+            assert_eq!(
+                direct.compact(true).serialize(),
+                heap.compact(true).serialize()
+            );
+        }
+    }
+}
+
+#[test]
+fn test_wrap_continues_in_place() {
+    let mut buf = vec![0u8; DirectThetaSketch::required_size_bytes(10)];
+    let mut heap = ThetaSketchBuilder::default().lg_k(10).build();
+    {
+        let mut direct = ThetaSketchBuilder::default()
+            .lg_k(10)
+            .build_direct(&mut buf)
+            .unwrap();
+        for i in 0..3000 {
+            direct.update(i);
+            heap.update(i);
+        }
+    }
+
+    let mut direct = DirectThetaSketch::wrap(&mut buf).unwrap();
+    assert_eq!(direct.lg_k(), 10);
+    for i in 3000..6000 {
+        direct.update(i);
+        heap.update(i);
+    }
+    assert!(direct.is_estimation_mode());
+    assert_eq!(
+        direct.compact(true).serialize(),
+        heap.compact(true).serialize()
+    );
+
+    direct.reset();
+    assert!(direct.is_empty());
+    assert_eq!(direct.num_retained(), 0);
+    assert_eq!(direct.estimate(), 0.0);
+}
+
+#[test]
+fn test_direct_sketch_in_union() {
+    let mut buf = vec![0u8; DirectThetaSketch::required_size_bytes(12)];
+    let mut direct = ThetaSketchBuilder::default()
+        .build_direct(&mut buf)
+        .unwrap();
+    let mut heap = ThetaSketchBuilder::default().build();
+    for i in 0..1000 {
+        direct.update(i);
+        heap.update(i + 500);
+    }
+
+    let mut union = ThetaUnionBuilder::default().build();
+    union.update(&direct).unwrap();
+    union.update(&heap).unwrap();
+    assert_eq!(union.to_sketch(true).estimate(), 1500.0);
+}
+
+#[test]
+fn test_sampling_probability_and_seed() {
+    let mut buf = vec![0u8; DirectThetaSketch::required_size_bytes(12)];
+    let mut heap = ThetaSketchBuilder::default()
+        .sampling_probability(0.5)
+        .seed(7)
+        .build();
+    let mut direct = ThetaSketchBuilder::default()
+        .sampling_probability(0.5)
+        .seed(7)
+        .build_direct(&mut buf)
+        .unwrap();
+    assert!(direct.is_empty());
+    assert_eq!(
+        direct.compact(false).theta64(),
+        heap.compact(false).theta64()
+    );
+    for i in 0..1000 {
+        direct.update(i);
+        heap.update(i);
+    }
+    assert_eq!(direct.seed_hash(), heap.seed_hash());
+    assert_eq!(direct.estimate(), heap.estimate());
+
+    let err = DirectThetaSketch::wrap(&mut buf).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+    let direct = DirectThetaSketch::wrap_with_seed(&mut buf, 7).unwrap();
+    assert_eq!(direct.estimate(), heap.estimate());
+}
+
+#[test]
+fn test_invalid_buffers() {
+    let required = DirectThetaSketch::required_size_bytes(10);
+    assert_eq!(required, 24 + 8 * 2048);
+
+    let mut small = vec![0u8; required - 1];
+    let err = ThetaSketchBuilder::default()
+        .lg_k(10)
+        .build_direct(&mut small)
+        .unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidArgument);
+
+    let mut buf = vec![0u8; required];
+    ThetaSketchBuilder::default()
+        .lg_k(10)
+        .build_direct(&mut buf)
+        .unwrap();
+    let err = DirectThetaSketch::wrap(&mut buf[..required - 1]).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+
+    // The retained count must match the occupied slots of the hash table.
+    let mut miscounted = buf.clone();
+    miscounted[8..12].copy_from_slice(&5u32.to_le_bytes());
+    let err = DirectThetaSketch::wrap(&mut miscounted).unwrap_err();
+    assert!(err.message().contains("slots occupied"), "{err}");
+
+    // A compact image is not an updatable sketch.
+    let mut compact = ThetaSketchBuilder::default()
+        .build()
+        .compact(true)
+        .serialize();
+    compact.resize(required, 0);
+    let err = DirectThetaSketch::wrap(&mut compact).unwrap_err();
+    assert_eq!(err.kind(), ErrorKind::InvalidData);
+}
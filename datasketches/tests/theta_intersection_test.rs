@@ -17,6 +17,7 @@
 
 #![cfg(feature = "theta")]
 
+use datasketches::common::NumStdDev;
 use datasketches::theta::CompactThetaSketch;
 use datasketches::theta::ThetaIntersection;
 use datasketches::theta::ThetaSketch;
@@ -319,3 +320,45 @@ fn test_seed_mismatch_non_empty_returns_error() {
     let mut i = ThetaIntersection::new(123);
     assert!(i.update(&s).is_err());
 }
+
+#[test]
+fn test_estimation_bounds_of_small_overlap() {
+    let a = sketch_with_range(0, 100_000);
+    let b = sketch_with_range(99_000, 100_000);
+
+    let mut intersection = ThetaIntersection::new_with_default_seed();
+    intersection.update(&a).unwrap();
+    intersection.update(&b).unwrap();
+    let result = intersection.to_sketch(true);
+    assert!(result.is_estimation_mode());
+    let lower_bound = result.lower_bound(NumStdDev::Three);
+    let upper_bound = result.upper_bound(NumStdDev::Three);
+    assert!(lower_bound <= 1000.0 && 1000.0 <= upper_bound);
+    assert!(lower_bound <= result.estimate() && result.estimate() <= upper_bound);
+
+    // the bounds follow the few retained entries, so they are relatively much wider than those
+    // of an input sketch at the same theta
+    let relative_width = |sketch: &CompactThetaSketch| {
+        (sketch.upper_bound(NumStdDev::Two) - sketch.lower_bound(NumStdDev::Two))
+            / sketch.estimate()
+    };
+    assert!(relative_width(&result) > 5.0 * relative_width(&a.compact(true)));
+}
+
+#[test]
+fn test_estimation_bounds_of_disjoint_inputs() {
+    let a = sketch_with_range(0, 100_000);
+    let b = sketch_with_range(200_000, 100_000);
+
+    let mut intersection = ThetaIntersection::new_with_default_seed();
+    intersection.update(&a).unwrap();
+    intersection.update(&b).unwrap();
+    let result = intersection.to_sketch(true);
+    // no entries retained below theta, but an overlap too small to sample is still possible
+    assert!(!result.is_empty());
+    assert_eq!(result.num_retained(), 0);
+    assert_eq!(result.estimate(), 0.0);
+    assert_eq!(result.lower_bound(NumStdDev::Three), 0.0);
+    assert!(result.upper_bound(NumStdDev::One) > 0.0);
+    assert!(result.upper_bound(NumStdDev::Three) > result.upper_bound(NumStdDev::One));
+}
@@ -0,0 +1,147 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "theta")]
+
+use datasketches::theta::ThetaJaccardSimilarity;
+use datasketches::theta::ThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
+
+fn sketch_with_range(lg_k: u8, start: u64, count: u64) -> ThetaSketch {
+    let mut sketch = ThetaSketchBuilder::default().lg_k(lg_k).build();
+    for i in 0..count {
+        sketch.update(start + i);
+    }
+    sketch
+}
+
+#[test]
+fn test_empty() {
+    let a = ThetaSketchBuilder::default().build();
+    let b = ThetaSketchBuilder::default().build();
+    let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+
+    let jc = jaccard.jaccard(&a, &b).unwrap();
+    assert_eq!(jc.lower_bound(), 1.0);
+    assert_eq!(jc.estimate(), 1.0);
+    assert_eq!(jc.upper_bound(), 1.0);
+    assert!(jaccard.exactly_equal(&a, &b).unwrap());
+
+    let c = sketch_with_range(12, 0, 10);
+    let jc = jaccard.jaccard(&a, &c).unwrap();
+    assert_eq!(jc.estimate(), 0.0);
+    assert!(!jaccard.exactly_equal(&a, &c).unwrap());
+}
+
+#[test]
+fn test_same_sketch_exact_mode() {
+    let a = sketch_with_range(12, 0, 1000);
+    let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+
+    let jc = jaccard.jaccard(&a, &a).unwrap();
+    assert_eq!(jc.estimate(), 1.0);
+    assert!(jaccard.exactly_equal(&a, &a).unwrap());
+
+    // compact copy is a different object with identical content
+    let jc = jaccard.jaccard(&a, &a.compact(true)).unwrap();
+    assert_eq!(jc.lower_bound(), 1.0);
+    assert_eq!(jc.estimate(), 1.0);
+    assert_eq!(jc.upper_bound(), 1.0);
+    assert!(jaccard.exactly_equal(&a, &a.compact(false)).unwrap());
+}
+
+#[test]
+fn test_full_overlap_estimation_mode() {
+    let a = sketch_with_range(12, 0, 10000);
+    let b = sketch_with_range(12, 0, 10000);
+    let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+
+    let jc = jaccard.jaccard(&a, &b).unwrap();
+    assert_eq!(jc.estimate(), 1.0);
+    assert!(jaccard.exactly_equal(&a, &b).unwrap());
+}
+
+#[test]
+fn test_disjoint_exact_mode() {
+    let a = sketch_with_range(12, 0, 1000);
+    let b = sketch_with_range(12, 1000, 1000);
+    let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+
+    let jc = jaccard.jaccard(&a, &b).unwrap();
+    assert_eq!(jc.lower_bound(), 0.0);
+    assert_eq!(jc.estimate(), 0.0);
+    assert_eq!(jc.upper_bound(), 0.0);
+    assert!(!jaccard.exactly_equal(&a, &b).unwrap());
+}
+
+#[test]
+fn test_half_overlap_exact_mode() {
+    let a = sketch_with_range(12, 0, 1000);
+    let b = sketch_with_range(12, 500, 1000);
+    let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+
+    let jc = jaccard.jaccard(&a, &b).unwrap();
+    assert_eq!(jc.lower_bound(), 1.0 / 3.0);
+    assert_eq!(jc.estimate(), 1.0 / 3.0);
+    assert_eq!(jc.upper_bound(), 1.0 / 3.0);
+}
+
+#[test]
+fn test_half_overlap_estimation_mode() {
+    let a = sketch_with_range(12, 0, 10000);
+    let b = sketch_with_range(12, 5000, 10000);
+    let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+
+    let jc = jaccard.jaccard(&a, &b).unwrap();
+    assert!(jc.lower_bound() < jc.estimate());
+    assert!(jc.estimate() < jc.upper_bound());
+    assert!((jc.estimate() - 1.0 / 3.0).abs() < 0.02);
+    assert!(jc.lower_bound() <= 1.0 / 3.0);
+    assert!(jc.upper_bound() >= 1.0 / 3.0);
+    assert!(!jaccard.exactly_equal(&a, &b).unwrap());
+}
+
+#[test]
+fn test_similarity() {
+    let expected = sketch_with_range(12, 0, 8192);
+    let actual = sketch_with_range(12, 0, 8192 + 16);
+    let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+
+    assert!(jaccard.similarity_test(&actual, &expected, 0.7).unwrap());
+    assert!(!jaccard.dissimilarity_test(&actual, &expected, 0.7).unwrap());
+}
+
+#[test]
+fn test_dissimilarity() {
+    let expected = sketch_with_range(12, 0, 8192);
+    let actual = sketch_with_range(12, 8192 - 256, 8192);
+    let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+
+    assert!(jaccard.dissimilarity_test(&actual, &expected, 0.1).unwrap());
+    assert!(!jaccard.similarity_test(&actual, &expected, 0.1).unwrap());
+}
+
+#[test]
+fn test_seed_mismatch() {
+    let mut a = ThetaSketchBuilder::default().seed(123).build();
+    a.update(1);
+    let b = sketch_with_range(12, 0, 10);
+
+    let jaccard = ThetaJaccardSimilarity::new_with_default_seed();
+    assert!(jaccard.jaccard(&a, &b).is_err());
+    assert!(jaccard.exactly_equal(&a, &b).is_err());
+}
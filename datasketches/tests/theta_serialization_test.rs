@@ -24,6 +24,7 @@ use std::path::PathBuf;
 
 use common::serialization_test_data;
 use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaSketchBuilder;
 use googletest::assert_that;
 use googletest::prelude::near;
 
@@ -116,3 +117,23 @@ fn test_cpp_compatibility() {
     let path = serialization_test_data("cpp_generated_files", "theta_non_empty_no_entries_cpp.sk");
     test_sketch_file(path, 0, false);
 }
+
+#[test]
+fn test_compressed_image_is_smaller() {
+    let mut sketch = ThetaSketchBuilder::default().lg_k(12).build();
+    sketch.extend(0..100_000);
+    let compact = sketch.compact(true);
+
+    let uncompressed = compact.serialize();
+    let compressed = compact.serialize_compressed();
+    assert_eq!(compressed[1], 4, "serVer of the compressed image");
+    assert!(compressed.len() < uncompressed.len());
+
+    let restored = CompactThetaSketch::deserialize(&compressed).unwrap();
+    assert_eq!(restored.estimate(), compact.estimate());
+    assert_eq!(restored.serialize(), uncompressed);
+
+    // unordered sketches cannot be compressed and keep serVer 3
+    let unordered = sketch.compact(false);
+    assert_eq!(unordered.serialize_compressed(), unordered.serialize());
+}
@@ -17,7 +17,10 @@
 
 #![cfg(feature = "theta")]
 
+use std::hash::Hash;
+
 use datasketches::common::NumStdDev;
+use datasketches::hash::MurmurHash3X64128;
 use datasketches::hash_value;
 use datasketches::theta::ThetaSketchBuilder;
 
@@ -307,3 +310,94 @@ fn test_compact_preserves_logical_non_empty_after_screened_update() {
     assert_eq!(compact.num_retained(), 0);
     assert_eq!(compact.theta64(), sketch.theta64());
 }
+
+#[test]
+fn test_update_hash_matches_update() {
+    let seed = 12345;
+    let mut hashed = ThetaSketchBuilder::default().lg_k(10).seed(seed).build();
+    let mut direct = ThetaSketchBuilder::default().lg_k(10).seed(seed).build();
+    for i in 0..5000_u64 {
+        let mut hasher = MurmurHash3X64128::with_seed(seed);
+        i.hash(&mut hasher);
+        let (h1, _) = hasher.finish128();
+        hashed.update_hash(h1);
+        direct.update(i);
+    }
+    assert_eq!(hashed.estimate(), direct.estimate());
+    assert_eq!(
+        hashed.compact(true).serialize(),
+        direct.compact(true).serialize()
+    );
+}
+
+#[test]
+fn test_extend_matches_update() {
+    let mut updated = ThetaSketchBuilder::default().lg_k(10).build();
+    for i in 0..10_000u64 {
+        updated.update(i);
+    }
+    let mut extended = ThetaSketchBuilder::default().lg_k(10).build();
+    // the optional values of a nullable column
+    extended.extend((0..10_000u64).map(Some).chain([None]).flatten());
+    assert_eq!(
+        extended.compact(true).serialize(),
+        updated.compact(true).serialize()
+    );
+}
+
+#[test]
+fn test_compact_is_equivalent() {
+    let mut sketch = ThetaSketchBuilder::default().lg_k(10).build();
+    sketch.extend(0..10_000);
+    let ordered = sketch.compact(true);
+    let unordered = sketch.compact(false);
+    assert_ne!(ordered, unordered);
+    assert!(ordered.is_equivalent(&unordered));
+    assert!(unordered.is_equivalent(&ordered));
+    assert_eq!(ordered, sketch.compact(true));
+
+    let mut recomputed = ThetaSketchBuilder::default().lg_k(10).build();
+    recomputed.extend(0..10_000);
+    assert!(recomputed.compact(false).is_equivalent(&ordered));
+
+    let mut other = ThetaSketchBuilder::default().lg_k(10).build();
+    other.extend(10_000..20_000);
+    assert!(!other.compact(true).is_equivalent(&ordered));
+
+    let mut seeded = ThetaSketchBuilder::default().lg_k(10).seed(7).build();
+    seeded.extend(0..10_000);
+    assert!(!seeded.compact(true).is_equivalent(&ordered));
+
+    let empty = ThetaSketchBuilder::default().build().compact(true);
+    let sampled_empty = ThetaSketchBuilder::default()
+        .sampling_probability(0.5)
+        .build()
+        .compact(true);
+    assert!(empty.is_equivalent(&sampled_empty));
+    assert!(!empty.is_equivalent(&ordered));
+}
+
+#[test]
+fn test_reconfigure() {
+    let mut sketch = ThetaSketchBuilder::default().lg_k(12).build();
+    sketch.extend(0..100_000);
+    let size = sketch.estimated_size();
+
+    sketch.reconfigure(10);
+    assert!(sketch.is_empty());
+    assert_eq!(sketch.lg_k(), 10);
+    assert_eq!(sketch.num_retained(), 0);
+    // the table keeps its allocation
+    assert_eq!(sketch.estimated_size(), size);
+
+    sketch.extend(0..100_000);
+    let mut fresh = ThetaSketchBuilder::default().lg_k(10).build();
+    fresh.extend(0..100_000);
+    assert_eq!(sketch.compact(true), fresh.compact(true));
+}
+
+#[test]
+#[should_panic(expected = "lg_k must be in [5, 26]")]
+fn test_reconfigure_invalid_lg_k() {
+    ThetaSketchBuilder::default().build().reconfigure(4);
+}
@@ -192,6 +192,30 @@ fn test_larger_k() {
     assert_eq!(result2.estimate(), sketch3.estimate());
 }
 
+#[test]
+fn test_smaller_union_k_bounds_result_and_memory() {
+    let lg_k = 8;
+    let k = 1usize << lg_k;
+    let mut union = ThetaUnionBuilder::default().lg_k(lg_k).build();
+    let mut max_size = 0;
+    for part in 0..20i64 {
+        // each input retains far more entries than the union's nominal size
+        let sketch = sketch_with_range(16, part * 20_000, 20_000);
+        assert!(sketch.num_retained() > 16 * k);
+        union.update(&sketch).unwrap();
+        max_size = max_size.max(union.estimated_size());
+
+        let result = union.to_sketch(true);
+        assert!(result.num_retained() <= k, "{}", result.num_retained());
+    }
+
+    let result = union.to_sketch(false);
+    assert_eq!(result.num_retained(), k);
+    assert_estimate_close(&result, 400_000.0, 400_000.0 * 0.2);
+    // the hash table of the union holds up to twice the nominal entries, 8 bytes each
+    assert!(max_size <= 2 * k * 8 + 1024, "max_size={max_size}");
+}
+
 #[test]
 fn test_exact_union_no_overlap() {
     let lg_k = 9;
@@ -689,3 +713,45 @@ fn test_corner_case_union_states() {
         assert_eq!(compact_result.is_empty(), expected_empty);
     }
 }
+
+#[test]
+fn test_update_bytes_matches_update() {
+    let sketches = [
+        sketch_with_range(12, 0, 0),
+        sketch_with_range(12, 0, 1),
+        sketch_with_range(12, 0, 2000),
+        sketch_with_range(10, 1000, 30000),
+        sketch_with_range(14, -5000, 50000),
+    ];
+
+    let mut expected = ThetaUnionBuilder::default().build();
+    let mut union = ThetaUnionBuilder::default().build();
+    for sketch in &sketches {
+        expected.update(sketch).unwrap();
+        let ordered = sketch.compact(true);
+        union.update_bytes(&ordered.serialize()).unwrap();
+        union.update_bytes(&ordered.serialize_compressed()).unwrap();
+        union
+            .update_bytes(&sketch.compact(false).serialize())
+            .unwrap();
+    }
+
+    let result = union.to_sketch(true);
+    let expected = expected.to_sketch(true);
+    assert_eq!(result.theta64(), expected.theta64());
+    assert_eq!(result.num_retained(), expected.num_retained());
+    assert_eq!(result.serialize(), expected.serialize());
+}
+
+#[test]
+fn test_update_bytes_errors() {
+    let mut sketch = ThetaSketchBuilder::default().build();
+    sketch.update(1u64);
+    let bytes = sketch.compact(true).serialize();
+
+    let mut union = ThetaUnionBuilder::default().seed(123).build();
+    assert!(union.update_bytes(&bytes).is_err());
+    assert!(union.update_bytes(&bytes[..bytes.len() - 1]).is_err());
+    assert!(union.update_bytes(&[]).is_err());
+    assert!(union.to_sketch(true).is_empty());
+}
@@ -0,0 +1,178 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "theta")]
+
+use datasketches::common::NumStdDev;
+use datasketches::error::SketchError;
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::ThetaEntry;
+use datasketches::theta::ThetaSketchBuilder;
+use datasketches::theta::ThetaUnionBuilder;
+
+// Counts covering the empty, single entry, exact and estimation modes
+const COUNTS: [u64; 5] = [0, 1, 100, 4000, 50000];
+
+fn build_sketch(n: u64, offset: u64) -> CompactThetaSketch {
+    let mut sketch = ThetaSketchBuilder::default().lg_k(12).build();
+    sketch.extend(offset..offset + n);
+    sketch.compact(true)
+}
+
+fn hashes(entries: impl Iterator<Item = ThetaEntry>) -> Vec<u64> {
+    entries.map(|entry| entry.hash()).collect()
+}
+
+fn images(sketch: &CompactThetaSketch) -> [Vec<u8>; 2] {
+    [sketch.serialize(), sketch.serialize_compressed()]
+}
+
+#[test]
+fn test_wrap_matches_deserialize() {
+    for n in COUNTS {
+        let sketch = build_sketch(n, 0);
+        for bytes in images(&sketch) {
+            let wrapped = CompactThetaSketch::wrap(&bytes).unwrap();
+            let decoded = CompactThetaSketch::deserialize(&bytes).unwrap();
+
+            assert_eq!(wrapped.is_empty(), n == 0);
+            assert_eq!(wrapped.is_ordered(), decoded.is_ordered());
+            assert_eq!(wrapped.seed_hash(), decoded.seed_hash());
+            assert_eq!(wrapped.theta64(), decoded.theta64());
+            assert_eq!(wrapped.num_retained(), decoded.num_retained());
+            assert_eq!(wrapped.estimate(), decoded.estimate(), "n={n}");
+            for num_std_dev in [NumStdDev::One, NumStdDev::Two, NumStdDev::Three] {
+                assert_eq!(
+                    wrapped.lower_bound(num_std_dev),
+                    decoded.lower_bound(num_std_dev)
+                );
+                assert_eq!(
+                    wrapped.upper_bound(num_std_dev),
+                    decoded.upper_bound(num_std_dev)
+                );
+            }
+            assert_eq!(hashes(wrapped.iter()), hashes(decoded.iter()), "n={n}");
+        }
+    }
+}
+
+#[test]
+fn test_wrap_unordered_image() {
+    let mut sketch = ThetaSketchBuilder::default().build();
+    sketch.extend(0..1000);
+    let compact = sketch.compact(false);
+
+    let bytes = compact.serialize();
+    let wrapped = CompactThetaSketch::wrap(&bytes).unwrap();
+    assert!(!wrapped.is_ordered());
+    assert_eq!(wrapped.estimate(), compact.estimate());
+    assert_eq!(hashes(wrapped.iter()), hashes(compact.iter()));
+}
+
+#[test]
+fn test_wrapped_images_in_union() {
+    let a = build_sketch(30000, 0);
+    let b = build_sketch(30000, 15000);
+
+    let mut expected = ThetaUnionBuilder::default().build();
+    expected.update(&a).unwrap();
+    expected.update(&b).unwrap();
+
+    let (bytes_a, bytes_b) = (a.serialize(), b.serialize_compressed());
+    let mut union = ThetaUnionBuilder::default().build();
+    union
+        .update(&CompactThetaSketch::wrap(&bytes_a).unwrap())
+        .unwrap();
+    union
+        .update(&CompactThetaSketch::wrap(&bytes_b).unwrap())
+        .unwrap();
+
+    let result = union.to_sketch(true);
+    assert_eq!(result.estimate(), expected.to_sketch(true).estimate());
+    assert_eq!(
+        hashes(result.iter()),
+        hashes(expected.to_sketch(true).iter())
+    );
+}
+
+#[test]
+fn test_wrap_with_seed() {
+    let mut sketch = ThetaSketchBuilder::default().seed(123).build();
+    sketch.extend(0..100);
+    let compact = sketch.compact(true);
+
+    for bytes in images(&compact) {
+        let wrapped = CompactThetaSketch::wrap_with_seed(&bytes, 123).unwrap();
+        assert_eq!(wrapped.estimate(), 100.0);
+
+        let err = CompactThetaSketch::wrap(&bytes).unwrap_err();
+        assert!(matches!(
+            err.sketch_error(),
+            Some(SketchError::IncompatibleSeedHash { .. })
+        ));
+    }
+}
+
+#[test]
+fn test_wrap_truncated_image() {
+    let sketch = build_sketch(4000, 0);
+    for bytes in images(&sketch) {
+        for len in [0, 4, 8, 16, bytes.len() / 2, bytes.len() - 1] {
+            assert!(
+                CompactThetaSketch::wrap(&bytes[..len]).is_err(),
+                "len={len} of {}",
+                bytes.len()
+            );
+        }
+    }
+}
+
+#[test]
+fn test_wrap_rejects_legacy_serial_version() {
+    let mut bytes = build_sketch(100, 0).serialize();
+    bytes[1] = 2;
+    let err = CompactThetaSketch::wrap(&bytes).unwrap_err();
+    assert!(matches!(
+        err.sketch_error(),
+        Some(SketchError::UnsupportedSerialVersion {
+            expected: 4,
+            actual: 2
+        })
+    ));
+}
+
+#[test]
+fn test_unordered_image_marked_ordered_is_rejected() {
+    let mut sketch = ThetaSketchBuilder::default().build();
+    sketch.extend(0..1000);
+    let mut bytes = sketch.compact(false).serialize();
+    // the ordered flag, bit 4 of the flags byte
+    bytes[5] |= 1 << 4;
+
+    assert!(CompactThetaSketch::deserialize(&bytes).is_err());
+    assert!(CompactThetaSketch::wrap(&bytes).is_err());
+    let mut union = ThetaUnionBuilder::default().build();
+    assert!(union.update_bytes(&bytes).is_err());
+
+    // the same hashes in ascending order are accepted
+    let mut bytes = sketch.compact(true).serialize();
+    bytes[5] |= 1 << 4;
+    let decoded = CompactThetaSketch::deserialize(&bytes).unwrap();
+    assert!(decoded.is_ordered());
+    assert!(CompactThetaSketch::deserialize(&decoded.serialize_compressed()).is_ok());
+    assert!(CompactThetaSketch::wrap(&bytes).unwrap().is_ordered());
+}
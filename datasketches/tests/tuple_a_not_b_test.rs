@@ -0,0 +1,147 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "tuple")]
+
+use datasketches::tuple::DefaultUpdatePolicy;
+use datasketches::tuple::TupleAnotB;
+use datasketches::tuple::TupleSketch;
+use datasketches::tuple::TupleSketchBuilder;
+
+fn sketch_with_range(
+    lg_k: u8,
+    start: u64,
+    count: u64,
+    value: u64,
+) -> TupleSketch<DefaultUpdatePolicy<u64>> {
+    let mut sketch = TupleSketchBuilder::new(DefaultUpdatePolicy::<u64>::default())
+        .lg_k(lg_k)
+        .build();
+    for i in 0..count {
+        sketch.update(start + i, value);
+    }
+    sketch
+}
+
+#[test]
+fn test_empty_inputs() {
+    let empty = sketch_with_range(12, 0, 0, 1);
+    let a_not_b = TupleAnotB::<u64>::new_with_default_seed();
+
+    let result = a_not_b.compute(&empty, &empty, true).unwrap();
+    assert!(result.is_empty());
+    assert_eq!(result.estimate(), 0.0);
+
+    let mut stateful = TupleAnotB::<u64>::new_with_default_seed();
+    stateful.not_b(&empty).unwrap();
+    assert!(stateful.to_sketch(true).is_empty());
+}
+
+#[test]
+fn test_exact_half_overlap_keeps_summaries_of_a() {
+    let a = sketch_with_range(12, 0, 1000, 3);
+    let b = sketch_with_range(12, 500, 1000, 7);
+
+    let result = TupleAnotB::new_with_default_seed()
+        .compute(&a, &b, true)
+        .unwrap();
+    assert!(result.is_ordered());
+    assert!(!result.is_estimation_mode());
+    assert_eq!(result.estimate(), 500.0);
+    assert!(result.iter().all(|(_, summary)| *summary == 3));
+}
+
+#[test]
+fn test_exact_full_overlap() {
+    let a = sketch_with_range(12, 0, 1000, 1);
+
+    let result = TupleAnotB::new_with_default_seed()
+        .compute(&a, &a.compact(false), false)
+        .unwrap();
+    assert!(result.is_empty());
+    assert_eq!(result.num_retained(), 0);
+}
+
+#[test]
+fn test_estimation_half_overlap() {
+    let a = sketch_with_range(12, 0, 10_000, 1);
+    let b = sketch_with_range(12, 5000, 10_000, 1);
+
+    let result = TupleAnotB::new_with_default_seed()
+        .compute(&a, &b, false)
+        .unwrap();
+    assert!(result.is_estimation_mode());
+    assert!((result.estimate() - 5000.0).abs() < 5000.0 * 0.05);
+}
+
+#[test]
+fn test_stateful_matches_stateless() {
+    let a = sketch_with_range(12, 0, 10_000, 2);
+    let b = sketch_with_range(12, 2000, 2000, 1);
+    let c = sketch_with_range(12, 6000, 2000, 1);
+
+    let mut stateful = TupleAnotB::new_with_default_seed();
+    stateful.set_a(&a).unwrap();
+    stateful.not_b(&b).unwrap();
+    stateful.not_b(&c.compact(true)).unwrap();
+    let result = stateful.to_sketch(true);
+
+    let stateless = TupleAnotB::new_with_default_seed();
+    let a_not_b = stateless.compute(&a, &b, false).unwrap();
+    let expected = stateless.compute(&a_not_b, &c, true).unwrap();
+
+    assert_eq!(result.num_retained(), expected.num_retained());
+    assert_eq!(result.theta64(), expected.theta64());
+    assert!(result.iter().eq(expected.iter()));
+
+    stateful.reset();
+    assert!(stateful.to_sketch(true).is_empty());
+}
+
+#[cfg(feature = "theta")]
+#[test]
+fn test_tuple_minus_theta() {
+    use datasketches::theta::ThetaSketchBuilder;
+
+    let a = sketch_with_range(12, 0, 1000, 4);
+    let mut b = ThetaSketchBuilder::default().lg_k(12).build();
+    for i in 0..500u64 {
+        b.update(i);
+    }
+
+    let result = TupleAnotB::new_with_default_seed()
+        .compute(&a, &b, true)
+        .unwrap();
+    assert_eq!(result.estimate(), 500.0);
+    assert!(result.iter().all(|(_, summary)| *summary == 4));
+}
+
+#[test]
+fn test_seed_mismatch() {
+    let mut a = TupleSketchBuilder::new(DefaultUpdatePolicy::<u64>::default())
+        .seed(123)
+        .build();
+    a.update(1, 1u64);
+    let b = sketch_with_range(12, 0, 10, 1);
+
+    let a_not_b = TupleAnotB::new_with_default_seed();
+    assert!(a_not_b.compute(&a, &b, true).is_err());
+    assert!(a_not_b.compute(&b, &a, true).is_err());
+
+    let mut stateful = TupleAnotB::new_with_default_seed();
+    assert!(stateful.set_a(&a).is_err());
+}
@@ -0,0 +1,116 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! Cross-language compatibility tests for Array-of-Doubles Tuple sketch serialization.
+//!
+//! The fixtures are produced by the upstream Java and C++ generators (see
+//! `tools/generate_serialization_test_data.py`). Both build a sketch with `update(i, values)` for
+//! `i` in `0..n`, where every one of the `num_values` doubles is `i`. The
+//! `aod_1_non_empty_no_entries_*` fixtures use a low sampling probability so that the single update
+//! is screened out, leaving a non-empty sketch without retained entries.
+
+#![cfg(feature = "tuple")]
+
+mod common;
+
+use std::fs;
+use std::path::PathBuf;
+
+use common::serialization_test_data;
+use datasketches::tuple::CompactArrayOfDoublesSketch;
+use googletest::assert_that;
+use googletest::prelude::near;
+
+fn test_sketch_file(path: PathBuf, expected_cardinality: usize, num_values: u8) {
+    let expected = expected_cardinality as f64;
+
+    let bytes = fs::read(&path).unwrap();
+    let sketch1 = CompactArrayOfDoublesSketch::deserialize(&bytes)
+        .unwrap_or_else(|err| panic!("Deserialization failed for {}: {}", path.display(), err));
+
+    assert_eq!(
+        sketch1.is_empty(),
+        expected_cardinality == 0,
+        "Unexpected is_empty for {}",
+        path.display()
+    );
+    assert_eq!(sketch1.num_values(), num_values, "{}", path.display());
+    assert_that!(sketch1.estimate(), near(expected, expected * 0.03));
+    for (_, values) in sketch1.iter() {
+        assert_eq!(values.len(), num_values as usize);
+        assert!(values.iter().all(|v| *v == values[0] && *v >= 0.0));
+    }
+
+    let serialized_bytes = sketch1.serialize();
+    let sketch2 =
+        CompactArrayOfDoublesSketch::deserialize(&serialized_bytes).unwrap_or_else(|err| {
+            panic!(
+                "Deserialization failed after round-trip for {}: {}",
+                path.display(),
+                err
+            )
+        });
+    assert_eq!(
+        serialized_bytes,
+        sketch2.serialize(),
+        "Serialized bytes are unstable after round-trip for {}",
+        path.display()
+    );
+    assert_eq!(sketch1.estimate(), sketch2.estimate());
+}
+
+fn test_non_empty_no_entries_file(path: PathBuf) {
+    let bytes = fs::read(&path).unwrap();
+    let sketch = CompactArrayOfDoublesSketch::deserialize(&bytes)
+        .unwrap_or_else(|err| panic!("Deserialization failed for {}: {}", path.display(), err));
+    assert!(!sketch.is_empty(), "{}", path.display());
+    assert_eq!(sketch.num_retained(), 0, "{}", path.display());
+    assert!(sketch.is_estimation_mode(), "{}", path.display());
+}
+
+#[test]
+fn test_java_compatibility() {
+    let test_cases = [0, 1, 10, 100, 1000, 10_000, 100_000, 1_000_000];
+
+    for num_values in [1, 3] {
+        for n in test_cases {
+            let filename = format!("aod_{num_values}_n{n}_java.sk");
+            let path = serialization_test_data("java_generated_files", &filename);
+            test_sketch_file(path, n, num_values);
+        }
+    }
+
+    let path =
+        serialization_test_data("java_generated_files", "aod_1_non_empty_no_entries_java.sk");
+    test_non_empty_no_entries_file(path);
+}
+
+#[test]
+fn test_cpp_compatibility() {
+    let test_cases = [0, 1, 10, 100, 1000, 10_000, 100_000, 1_000_000];
+
+    for num_values in [1, 3] {
+        for n in test_cases {
+            let filename = format!("aod_{num_values}_n{n}_cpp.sk");
+            let path = serialization_test_data("cpp_generated_files", &filename);
+            test_sketch_file(path, n, num_values);
+        }
+    }
+
+    let path = serialization_test_data("cpp_generated_files", "aod_1_non_empty_no_entries_cpp.sk");
+    test_non_empty_no_entries_file(path);
+}
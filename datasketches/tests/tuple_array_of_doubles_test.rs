@@ -0,0 +1,140 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "tuple")]
+
+use datasketches::common::NumStdDev;
+use datasketches::tuple::ArrayOfDoublesSketch;
+use datasketches::tuple::ArrayOfDoublesSketchBuilder;
+use datasketches::tuple::CompactArrayOfDoublesSketch;
+
+fn sketch_with_range(num_values: u8, start: u64, count: u64) -> ArrayOfDoublesSketch {
+    let mut sketch = ArrayOfDoublesSketchBuilder::new(num_values).build();
+    for i in start..start + count {
+        let values = vec![i as f64; num_values as usize];
+        sketch.update(i, &values);
+    }
+    sketch
+}
+
+#[test]
+fn test_empty() {
+    let sketch = ArrayOfDoublesSketchBuilder::new(2).build();
+    assert!(sketch.is_empty());
+    assert!(!sketch.is_estimation_mode());
+    assert_eq!(sketch.num_values(), 2);
+    assert_eq!(sketch.estimate(), 0.0);
+    assert_eq!(sketch.lower_bound(NumStdDev::One), 0.0);
+    assert_eq!(sketch.upper_bound(NumStdDev::One), 0.0);
+
+    let compact = sketch.compact(false);
+    assert!(compact.is_empty());
+    assert_eq!(compact.num_values(), 2);
+
+    let decoded = CompactArrayOfDoublesSketch::deserialize(&compact.serialize()).unwrap();
+    assert!(decoded.is_empty());
+    assert_eq!(decoded.num_values(), 2);
+    assert_eq!(decoded.num_retained(), 0);
+}
+
+#[test]
+fn test_updates_sum_values() {
+    let mut sketch = ArrayOfDoublesSketchBuilder::new(3).build();
+    sketch.update("a", &[1.0, 2.0, 3.0]);
+    sketch.update("a", &[0.5, 0.5, 0.5]);
+    sketch.update("b", &[-1.0, 0.0, 1.0]);
+    assert_eq!(sketch.num_retained(), 2);
+    assert_eq!(sketch.estimate(), 2.0);
+
+    let mut values: Vec<Vec<f64>> = sketch.iter().map(|(_, values)| values.to_vec()).collect();
+    values.sort_by(|a, b| a[0].total_cmp(&b[0]));
+    assert_eq!(values, vec![vec![-1.0, 0.0, 1.0], vec![1.5, 2.5, 3.5]]);
+}
+
+#[test]
+#[should_panic(expected = "expected 2 values, got 1")]
+fn test_update_with_wrong_number_of_values_panics() {
+    let mut sketch = ArrayOfDoublesSketchBuilder::new(2).build();
+    sketch.update(1, &[1.0]);
+}
+
+#[test]
+#[should_panic(expected = "num_values must be at least 1")]
+fn test_zero_num_values_panics() {
+    ArrayOfDoublesSketchBuilder::new(0);
+}
+
+#[test]
+fn test_estimation_mode() {
+    let sketch = sketch_with_range(1, 0, 10_000);
+    assert!(sketch.is_estimation_mode());
+    let estimate = sketch.estimate();
+    assert!((estimate - 10_000.0).abs() < 10_000.0 * 0.03);
+    assert!(sketch.lower_bound(NumStdDev::Two) <= estimate);
+    assert!(sketch.upper_bound(NumStdDev::Two) >= estimate);
+}
+
+#[test]
+fn test_serialization_round_trip() {
+    for (n, ordered) in [(1, true), (100, false), (10_000, true), (10_000, false)] {
+        let compact = sketch_with_range(2, 0, n).compact(ordered);
+        let bytes = compact.serialize();
+        let decoded = CompactArrayOfDoublesSketch::deserialize(&bytes).unwrap();
+
+        assert_eq!(decoded.is_ordered(), ordered);
+        assert_eq!(decoded.num_values(), 2);
+        assert_eq!(decoded.theta64(), compact.theta64());
+        assert_eq!(decoded.num_retained(), compact.num_retained());
+        assert_eq!(decoded.estimate(), compact.estimate());
+        assert!(decoded.iter().eq(compact.iter()));
+        assert_eq!(decoded.serialize(), bytes);
+    }
+}
+
+#[test]
+fn test_non_empty_no_entries_round_trip() {
+    let mut sketch = ArrayOfDoublesSketchBuilder::new(1)
+        .sampling_probability(0.01)
+        .build();
+    sketch.update(1, &[1.0]);
+    assert!(!sketch.is_empty());
+    assert_eq!(sketch.num_retained(), 0);
+
+    let bytes = sketch.compact(true).serialize();
+    assert_eq!(bytes.len(), 16);
+    let decoded = CompactArrayOfDoublesSketch::deserialize(&bytes).unwrap();
+    assert!(!decoded.is_empty());
+    assert_eq!(decoded.num_retained(), 0);
+    assert_eq!(decoded.theta64(), sketch.theta64());
+}
+
+#[test]
+fn test_deserialize_seed_mismatch() {
+    let bytes = sketch_with_range(1, 0, 10).compact(true).serialize();
+    assert!(CompactArrayOfDoublesSketch::deserialize_with_seed(&bytes, 123).is_err());
+
+    // without entries the seed hash is not checked, matching the reference implementations
+    let bytes = sketch_with_range(1, 0, 0).compact(true).serialize();
+    assert!(CompactArrayOfDoublesSketch::deserialize_with_seed(&bytes, 123).is_ok());
+}
+
+#[test]
+fn test_deserialize_rejects_generic_tuple_bytes() {
+    let mut bytes = sketch_with_range(1, 0, 10).compact(true).serialize();
+    bytes[3] = 1; // generic compact tuple sketch type
+    assert!(CompactArrayOfDoublesSketch::deserialize(&bytes).is_err());
+}
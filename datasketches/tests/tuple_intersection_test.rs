@@ -0,0 +1,152 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+#![cfg(feature = "tuple")]
+
+use datasketches::tuple::DefaultUnionPolicy;
+use datasketches::tuple::DefaultUpdatePolicy;
+use datasketches::tuple::SummaryCombinePolicy;
+use datasketches::tuple::SummaryPolicy;
+use datasketches::tuple::TupleIntersection;
+use datasketches::tuple::TupleSketch;
+use datasketches::tuple::TupleSketchBuilder;
+
+#[derive(Debug, Clone, Copy)]
+struct MaxPolicy;
+
+impl SummaryPolicy for MaxPolicy {
+    type Summary = u64;
+
+    fn create(&self) -> Self::Summary {
+        0
+    }
+}
+
+impl SummaryCombinePolicy for MaxPolicy {
+    fn combine(&self, summary: &mut Self::Summary, other: &Self::Summary) {
+        *summary = (*summary).max(*other);
+    }
+}
+
+fn sketch_with_range(
+    lg_k: u8,
+    start: u64,
+    count: u64,
+    value: u64,
+) -> TupleSketch<DefaultUpdatePolicy<u64>> {
+    let mut sketch = TupleSketchBuilder::new(DefaultUpdatePolicy::<u64>::default())
+        .lg_k(lg_k)
+        .build();
+    for i in 0..count {
+        sketch.update(start + i, value);
+    }
+    sketch
+}
+
+#[test]
+fn test_has_result_state_machine() {
+    let a = sketch_with_range(12, 0, 1, 1);
+
+    let mut i = TupleIntersection::new_with_default_seed(MaxPolicy);
+    assert!(!i.has_result());
+    i.update(&a).unwrap();
+    assert!(i.has_result());
+    assert_eq!(i.to_sketch(true).estimate(), 1.0);
+}
+
+#[test]
+fn test_result_before_update_panics() {
+    let i = TupleIntersection::new(MaxPolicy, 123);
+    let result = std::panic::catch_unwind(|| {
+        i.to_sketch(true);
+    });
+    assert!(result.is_err());
+}
+
+#[test]
+fn test_empty_input_makes_result_empty() {
+    let a = sketch_with_range(12, 0, 100, 1);
+    let empty = sketch_with_range(12, 0, 0, 1);
+
+    let mut i = TupleIntersection::new_with_default_seed(MaxPolicy);
+    i.update(&a).unwrap();
+    i.update(&empty).unwrap();
+    let result = i.to_sketch(true);
+    assert!(result.is_empty());
+    assert_eq!(result.estimate(), 0.0);
+}
+
+#[test]
+fn test_exact_half_overlap_combines_summaries() {
+    let a = sketch_with_range(12, 0, 1000, 1);
+    let b = sketch_with_range(12, 500, 1000, 5);
+
+    let mut i = TupleIntersection::new_with_default_seed(MaxPolicy);
+    i.update(&a).unwrap();
+    i.update(&b.compact(false)).unwrap();
+    let result = i.to_sketch(true);
+    assert!(result.is_ordered());
+    assert!(!result.is_estimation_mode());
+    assert_eq!(result.estimate(), 500.0);
+    assert!(result.iter().all(|(_, summary)| *summary == 5));
+
+    let mut i = TupleIntersection::new_with_default_seed(DefaultUnionPolicy::<u64>::default());
+    i.update(&a).unwrap();
+    i.update(&b).unwrap();
+    let result = i.to_sketch(false);
+    assert_eq!(result.estimate(), 500.0);
+    assert!(result.iter().all(|(_, summary)| *summary == 6));
+}
+
+#[test]
+fn test_exact_disjoint() {
+    let a = sketch_with_range(12, 0, 1000, 1);
+    let b = sketch_with_range(12, 1000, 1000, 1);
+
+    let mut i = TupleIntersection::new_with_default_seed(MaxPolicy);
+    i.update(&a).unwrap();
+    i.update(&b).unwrap();
+    let result = i.to_sketch(true);
+    assert!(result.is_empty());
+    assert_eq!(result.num_retained(), 0);
+}
+
+#[test]
+fn test_estimation_half_overlap() {
+    let a = sketch_with_range(12, 0, 10_000, 1);
+    let b = sketch_with_range(12, 5000, 10_000, 1);
+
+    let mut i = TupleIntersection::new_with_default_seed(DefaultUnionPolicy::<u64>::default());
+    i.update(&a.compact(true)).unwrap();
+    i.update(&b.compact(true)).unwrap();
+    let result = i.to_sketch(true);
+    assert!(!result.is_empty());
+    assert!(result.is_estimation_mode());
+    assert!((result.estimate() - 5000.0).abs() < 5000.0 * 0.05);
+    assert!(result.iter().all(|(_, summary)| *summary == 2));
+}
+
+#[test]
+fn test_seed_mismatch() {
+    let mut a = TupleSketchBuilder::new(DefaultUpdatePolicy::<u64>::default())
+        .seed(123)
+        .build();
+    a.update(1, 1u64);
+
+    let mut i = TupleIntersection::new_with_default_seed(MaxPolicy);
+    assert!(i.update(&a).is_err());
+}
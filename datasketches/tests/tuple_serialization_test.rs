@@ -27,8 +27,9 @@
 //!
 //! Both build a tuple sketch with `update(i, i)` for `i` in `0..n`, so the summary is a 4-byte
 //! little-endian signed integer — exactly what the `i32` [`TupleSummaryValue`] implementation
-//! reads. The `aod_*`/`aos_*` fixtures use Array-of-Doubles / Array-of-Strings summaries, which
-//! this crate does not implement, so they are intentionally not covered here.
+//! reads. The `aod_*` Array-of-Doubles fixtures are covered by
+//! `tuple_array_of_doubles_serialization_test.rs`; the `aos_*` Array-of-Strings fixtures are not
+//! implemented by this crate, so they are intentionally not covered.
 
 #![cfg(feature = "tuple")]
 
@@ -24,6 +24,7 @@
 
 use datasketches::common::NumStdDev;
 use datasketches::hash_value;
+use datasketches::tuple::CompactTupleSketch;
 use datasketches::tuple::DefaultUpdatePolicy;
 use datasketches::tuple::TupleSketchBuilder;
 
@@ -315,3 +316,79 @@ fn test_compact_preserves_logical_non_empty_after_screened_update() {
     assert_eq!(compact.num_retained(), 0);
     assert_eq!(compact.theta64(), sketch.theta64());
 }
+
+#[test]
+fn test_filter_conditional_distinct_count() {
+    let n = 100_000u64;
+    let mut sketch = builder().lg_k(12).build();
+    for i in 0..n {
+        // a tenth of the keys get each summary value in 0..10
+        sketch.update(i, i % 10);
+    }
+    assert!(sketch.is_estimation_mode());
+
+    let filtered = sketch.filter(|summary| *summary < 3, false);
+    assert_eq!(filtered.theta64(), sketch.theta64());
+    assert_eq!(filtered.seed_hash(), sketch.seed_hash());
+    assert!(filtered.iter().all(|(_, summary)| *summary < 3));
+    let expected = (3 * n / 10) as f64;
+    assert!(filtered.lower_bound(NumStdDev::Three) <= expected);
+    assert!(filtered.upper_bound(NumStdDev::Three) >= expected);
+
+    // filtering the compact form keeps the same entries
+    let compact = sketch.compact(true).filter(|summary| *summary < 3);
+    assert!(compact.is_ordered());
+    let mut hashes: Vec<u64> = filtered.iter().map(|(hash, _)| hash).collect();
+    hashes.sort_unstable();
+    assert!(compact.iter().map(|(hash, _)| hash).eq(hashes));
+    assert_eq!(compact.estimate(), filtered.estimate());
+}
+
+#[test]
+fn test_filter_keeps_empty_state() {
+    let sketch = builder().build();
+    let filtered = sketch.filter(|_| true, true);
+    assert!(filtered.is_empty());
+    assert_eq!(filtered.estimate(), 0.0);
+
+    // a sketch that saw keys stays non-empty when no entry passes
+    let mut sketch = builder().build();
+    sketch.update("apple", 1u64);
+    let filtered = sketch.filter(|_| false, false);
+    assert!(!filtered.is_empty());
+    assert_eq!(filtered.num_retained(), 0);
+    assert_eq!(filtered.estimate(), 0.0);
+    assert!(!sketch.compact(false).filter(|_| false).is_empty());
+
+    let restored = CompactTupleSketch::<u64>::deserialize(&filtered.serialize()).unwrap();
+    assert!(!restored.is_empty());
+    assert_eq!(restored.num_retained(), 0);
+}
+
+#[test]
+fn test_map_summaries() {
+    let mut sketch = builder().lg_k(10).build();
+    for i in 0..10_000u64 {
+        sketch.update(i, 2u64);
+    }
+    sketch.update(0u64, 3u64);
+
+    let mapped = sketch.map_summaries(|summary| *summary as f64 / 2.0, true);
+    assert!(mapped.is_ordered());
+    assert_eq!(mapped.num_retained(), sketch.num_retained());
+    assert_eq!(mapped.estimate(), sketch.estimate());
+    assert_eq!(
+        mapped.upper_bound(NumStdDev::Two),
+        sketch.upper_bound(NumStdDev::Two)
+    );
+
+    let compact = sketch.compact(true);
+    let remapped = compact.map_summaries(|summary| *summary as f64 / 2.0);
+    assert!(remapped.iter().eq(mapped.iter()));
+    assert!(
+        compact
+            .iter()
+            .zip(remapped.iter())
+            .all(|((_, &before), (_, &after))| after == before as f64 / 2.0)
+    );
+}
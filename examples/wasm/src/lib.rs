@@ -0,0 +1,141 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//! JavaScript bindings for a couple of datasketches types.
+//!
+//! Strings are hashed through [`raw_bytes`] so that a sketch built in the browser agrees with one
+//! built by the Java or C++ libraries, and serialized images can be exchanged with them as is.
+
+use datasketches::bloom::BloomFilter;
+use datasketches::bloom::BloomFilterBuilder;
+use datasketches::hash_value::raw_bytes;
+use datasketches::hll::HllSketch;
+use datasketches::hll::HllType;
+use datasketches::hll::HllUnion;
+use wasm_bindgen::prelude::*;
+
+fn to_js_error(err: datasketches::error::Error) -> JsError {
+    JsError::new(&err.to_string())
+}
+
+/// A HyperLogLog distinct counter.
+#[wasm_bindgen]
+pub struct Hll {
+    inner: HllSketch,
+}
+
+#[wasm_bindgen]
+impl Hll {
+    /// Creates an empty HLL_4 sketch with `2^lg_k` buckets.
+    #[wasm_bindgen(constructor)]
+    pub fn new(lg_k: u8) -> Hll {
+        Hll {
+            inner: HllSketch::new(lg_k, HllType::Hll4),
+        }
+    }
+
+    /// Adds a string to the sketch.
+    pub fn update(&mut self, value: &str) {
+        self.inner.update(raw_bytes::from_str(value));
+    }
+
+    /// Adds an integer to the sketch. JavaScript numbers map to `f64`, so this takes a `BigInt`.
+    pub fn update_i64(&mut self, value: i64) {
+        self.inner.update(value);
+    }
+
+    /// Returns the estimated number of distinct values.
+    pub fn estimate(&self) -> f64 {
+        self.inner.estimate()
+    }
+
+    /// Returns `true` if nothing has been added.
+    pub fn is_empty(&self) -> bool {
+        self.inner.is_empty()
+    }
+
+    /// Merges `other` into this sketch.
+    pub fn merge(&mut self, other: &Hll) {
+        let mut union = HllUnion::new(self.inner.lg_config_k().max(other.inner.lg_config_k()));
+        union.update(&self.inner);
+        union.update(&other.inner);
+        self.inner = union.to_sketch(self.inner.target_type());
+    }
+
+    /// Serializes the sketch into the compact image shared with Java and C++.
+    pub fn serialize(&self) -> Vec<u8> {
+        self.inner.serialize()
+    }
+
+    /// Reads a sketch from a serialized image.
+    pub fn deserialize(bytes: &[u8]) -> Result<Hll, JsError> {
+        let inner = HllSketch::deserialize(bytes).map_err(to_js_error)?;
+        Ok(Hll { inner })
+    }
+}
+
+/// A Bloom filter for approximate membership queries.
+#[wasm_bindgen]
+pub struct Bloom {
+    inner: BloomFilter,
+}
+
+#[wasm_bindgen]
+impl Bloom {
+    /// Creates a filter sized for `max_items` insertions at the target false positive rate.
+    #[wasm_bindgen(constructor)]
+    pub fn new(max_items: u64, fpp: f64) -> Bloom {
+        Bloom {
+            inner: BloomFilterBuilder::with_accuracy(max_items, fpp).build(),
+        }
+    }
+
+    /// Inserts a string into the filter.
+    pub fn insert(&mut self, value: &str) {
+        self.inner.insert(raw_bytes::from_str(value));
+    }
+
+    /// Returns `true` if the string may have been inserted, `false` if it definitely was not.
+    pub fn contains(&self, value: &str) -> bool {
+        self.inner.contains(&raw_bytes::from_str(value))
+    }
+
+    /// Returns the estimated false positive probability at the current load.
+    pub fn estimated_fpp(&self) -> f64 {
+        self.inner.estimated_fpp()
+    }
+
+    /// Merges `other` into this filter. Both filters must share size, hash count and seed.
+    pub fn merge(&mut self, other: &Bloom) -> Result<(), JsError> {
+        if !self.inner.is_compatible(&other.inner) {
+            return Err(JsError::new("incompatible Bloom filters"));
+        }
+        self.inner.union(&other.inner);
+        Ok(())
+    }
+
+    /// Serializes the filter.
+    pub fn serialize(&self) -> Vec<u8> {
+        self.inner.serialize()
+    }
+
+    /// Reads a filter from a serialized image.
+    pub fn deserialize(bytes: &[u8]) -> Result<Bloom, JsError> {
+        let inner = BloomFilter::deserialize(bytes).map_err(to_js_error)?;
+        Ok(Bloom { inner })
+    }
+}
@@ -0,0 +1,44 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+
+#![no_main]
+
+use datasketches::countmin::CountMinSketch;
+use datasketches::countmin::CountMinValue;
+use libfuzzer_sys::fuzz_target;
+
+fn check_countmin<T: CountMinValue>(data: &[u8]) {
+    if let Ok(sketch) = CountMinSketch::<T>::deserialize(data) {
+        let _ = sketch.estimate(0u64);
+        let _ = sketch.lower_bound(0u64);
+        let _ = sketch.upper_bound(0u64);
+        let mut merged = CountMinSketch::<T>::with_seed(
+            sketch.num_hashes(),
+            sketch.num_buckets(),
+            sketch.seed(),
+        );
+        merged.merge(&sketch);
+        let _ = merged.estimate(0u64);
+        assert!(CountMinSketch::<T>::deserialize(&sketch.serialize()).is_ok());
+    }
+}
+
+fuzz_target!(|data: &[u8]| {
+    check_countmin::<i64>(data);
+    check_countmin::<u64>(data);
+});
@@ -0,0 +1,43 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+
+#![no_main]
+
+use datasketches::common::NumStdDev;
+use datasketches::cpc::CpcSketch;
+use datasketches::cpc::CpcUnion;
+use datasketches::cpc::CpcWrapper;
+use libfuzzer_sys::fuzz_target;
+
+fuzz_target!(|data: &[u8]| {
+    if let Ok(sketch) = CpcSketch::deserialize(data) {
+        let _ = sketch.estimate();
+        let _ = sketch.lower_bound(NumStdDev::Two);
+        let _ = sketch.upper_bound(NumStdDev::Two);
+        let mut union = CpcUnion::new(sketch.lg_k());
+        union.update(&sketch);
+        union.update(&sketch);
+        let _ = union.to_sketch().serialize();
+        assert!(CpcSketch::deserialize(&sketch.serialize()).is_ok());
+    }
+    if let Ok(wrapper) = CpcWrapper::new(data) {
+        let _ = wrapper.estimate();
+        let _ = wrapper.lower_bound(NumStdDev::Two);
+        let _ = wrapper.upper_bound(NumStdDev::Two);
+    }
+});
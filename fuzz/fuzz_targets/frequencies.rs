@@ -0,0 +1,41 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+
+#![no_main]
+
+use datasketches::frequencies::ErrorType;
+use datasketches::frequencies::FrequentItemsSketch;
+use libfuzzer_sys::fuzz_target;
+
+fuzz_target!(|data: &[u8]| {
+    if let Ok(sketch) = FrequentItemsSketch::<i64>::deserialize(data) {
+        let _ = sketch.estimate(&0);
+        let _ = sketch.frequent_items(ErrorType::NoFalseNegatives);
+        let mut merged = FrequentItemsSketch::new(8);
+        merged.merge(&sketch);
+        let _ = merged.frequent_items(ErrorType::NoFalsePositives);
+        assert!(FrequentItemsSketch::<i64>::deserialize(&sketch.serialize()).is_ok());
+    }
+    if let Ok(sketch) = FrequentItemsSketch::<String>::deserialize(data) {
+        let _ = sketch.frequent_items(ErrorType::NoFalseNegatives);
+        let mut merged = FrequentItemsSketch::new(8);
+        merged.merge(&sketch);
+        let _ = merged.frequent_items(ErrorType::NoFalsePositives);
+        assert!(FrequentItemsSketch::<String>::deserialize(&sketch.serialize()).is_ok());
+    }
+});
@@ -0,0 +1,61 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+
+#![no_main]
+
+use datasketches::kll::KllItemValue;
+use datasketches::kll::KllItemsSketch;
+use datasketches::kll::KllSketch;
+use datasketches::kll::KllValue;
+use libfuzzer_sys::fuzz_target;
+
+fn check_kll<T: KllValue>(data: &[u8]) {
+    if let Ok(mut sketch) = KllSketch::<T>::deserialize(data) {
+        let _ = sketch.quantile(0.5, true);
+        let _ = sketch.sorted_view();
+        if let Some(min) = sketch.min_item() {
+            let _ = sketch.rank(min, true);
+            let _ = sketch.cdf(&[min], false);
+        }
+        let other = sketch.clone();
+        sketch.merge(&other);
+        let _ = sketch.quantile(0.5, false);
+        assert!(KllSketch::<T>::deserialize(&sketch.serialize()).is_ok());
+    }
+}
+
+fn check_kll_items<T: Clone + Ord + KllItemValue>(data: &[u8]) {
+    if let Ok(mut sketch) = KllItemsSketch::<T>::deserialize(data) {
+        let _ = sketch.quantile(0.5, true);
+        if let Some(min) = sketch.min_item().cloned() {
+            let _ = sketch.rank(&min, true);
+            let _ = sketch.pmf(&[min], false);
+        }
+        let other = sketch.clone();
+        sketch.merge(&other);
+        let _ = sketch.quantile(0.5, false);
+        assert!(KllItemsSketch::<T>::deserialize(&sketch.serialize()).is_ok());
+    }
+}
+
+fuzz_target!(|data: &[u8]| {
+    check_kll::<f32>(data);
+    check_kll::<f64>(data);
+    check_kll_items::<i64>(data);
+    check_kll_items::<String>(data);
+});
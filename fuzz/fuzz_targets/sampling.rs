@@ -0,0 +1,76 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+
+#![no_main]
+
+use datasketches::sampling::EbppsItemsSketch;
+use datasketches::sampling::ReservoirItemsSketch;
+use datasketches::sampling::ReservoirUnion;
+use datasketches::sampling::SamplingItemValue;
+use datasketches::sampling::VarOptItemsSketch;
+use datasketches::sampling::VarOptUnion;
+use libfuzzer_sys::fuzz_target;
+
+fn check_reservoir<T: Clone + SamplingItemValue>(data: &[u8]) {
+    if let Ok(sketch) = ReservoirItemsSketch::<T>::deserialize(data) {
+        let _ = sketch.estimate_subset_sum(|_| true);
+        let mut union = ReservoirUnion::new(sketch.k());
+        union.update(&sketch);
+        union.update(&sketch);
+        let _ = union.to_sketch().serialize();
+        assert!(ReservoirItemsSketch::<T>::deserialize(&sketch.serialize()).is_ok());
+    }
+}
+
+fn check_varopt<T: Clone + SamplingItemValue>(data: &[u8]) {
+    if let Ok(sketch) = VarOptItemsSketch::<T>::deserialize(data) {
+        let _ = sketch.estimate_subset_sum(|_| true);
+        let mut union = VarOptUnion::new(sketch.k());
+        union.update(&sketch);
+        union.update(&sketch);
+        let _ = union.to_sketch().serialize();
+        assert!(VarOptItemsSketch::<T>::deserialize(&sketch.serialize()).is_ok());
+    }
+}
+
+fuzz_target!(|data: &[u8]| {
+    check_reservoir::<i64>(data);
+    check_reservoir::<String>(data);
+    check_varopt::<i64>(data);
+    check_varopt::<String>(data);
+    if let Ok(mut union) = ReservoirUnion::<i64>::deserialize(data) {
+        let result = union.to_sketch();
+        union.update(&result);
+        let _ = union.to_sketch().serialize();
+        assert!(ReservoirUnion::<i64>::deserialize(&union.serialize()).is_ok());
+    }
+    if let Ok(mut union) = VarOptUnion::<i64>::deserialize(data) {
+        let result = union.to_sketch();
+        let _ = result.estimate_subset_sum(|item| *item > 0);
+        union.update(&result);
+        let _ = union.to_sketch().serialize();
+        assert!(VarOptUnion::<i64>::deserialize(&union.serialize()).is_ok());
+    }
+    if let Ok(mut sketch) = EbppsItemsSketch::<i64>::deserialize(data) {
+        let _ = sketch.sample();
+        let other = sketch.clone();
+        sketch.merge(&other);
+        let _ = sketch.sample();
+        assert!(EbppsItemsSketch::<i64>::deserialize(&sketch.serialize()).is_ok());
+    }
+});
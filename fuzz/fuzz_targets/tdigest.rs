@@ -0,0 +1,38 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+
+#![no_main]
+
+use datasketches::tdigest::TDigestMut;
+use libfuzzer_sys::fuzz_target;
+
+fuzz_target!(|data: &[u8]| {
+    for is_f32 in [false, true] {
+        if let Ok(mut digest) = TDigestMut::deserialize(data, is_f32) {
+            let _ = digest.quantile(0.5);
+            let _ = digest.rank(0.0);
+            let _ = digest.cdf(&[0.0]);
+            let mut merged = TDigestMut::new(digest.k());
+            merged.merge(&digest);
+            let _ = merged.quantile(0.5);
+            assert!(TDigestMut::deserialize(&digest.serialize(), false).is_ok());
+            let frozen = digest.freeze();
+            let _ = frozen.pmf(&[0.0]);
+        }
+    }
+});
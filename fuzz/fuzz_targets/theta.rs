@@ -0,0 +1,45 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+
+#![no_main]
+
+use datasketches::theta::CompactThetaSketch;
+use datasketches::theta::DirectThetaSketch;
+use datasketches::theta::ThetaUnionBuilder;
+use libfuzzer_sys::fuzz_target;
+
+fuzz_target!(|data: &[u8]| {
+    if let Ok(sketch) = CompactThetaSketch::deserialize(data) {
+        let _ = sketch.estimate();
+        assert!(CompactThetaSketch::deserialize(&sketch.serialize()).is_ok());
+        assert!(CompactThetaSketch::deserialize(&sketch.serialize_compressed()).is_ok());
+    }
+    if let Ok(wrapped) = CompactThetaSketch::wrap(data) {
+        let _ = wrapped.estimate();
+        let _ = wrapped.iter().count();
+        let mut union = ThetaUnionBuilder::default().build();
+        if union.update(&wrapped).is_ok() {
+            let _ = union.to_sketch(true).serialize_compressed();
+        }
+    }
+    let mut bytes = data.to_vec();
+    if let Ok(mut direct) = DirectThetaSketch::wrap(&mut bytes) {
+        direct.update(0u64);
+        let _ = direct.estimate();
+    }
+});
@@ -179,16 +179,43 @@ def generate_cpp_files(workspace_dir, project_root):
         print(f"Successfully copied {files_copied} files.")
 
 
+def generate_rust_files(workspace_dir):
+    print("--- Generating Rust Test Data ---")
+
+    # 1. Check prerequisites
+    check_command_installed("cargo")
+
+    # 2. Run the generator test, which writes into
+    # datasketches/tests/serialization_test_data/rust_generated_files;
+    # optimized, since the saturation cases update up to 10^8 items
+    env = dict(os.environ, DSKETCH_TEST_GENERATE_RUST="1")
+    cmd = [
+        "cargo", "test", "--release",
+        "--package", "datasketches",
+        "--all-features",
+        "--test", "rust_generated_files_test",
+        "test_generate_rust_files",
+    ]
+    print(f"Running: {' '.join(cmd)}")
+    sys.stdout.flush()
+    try:
+        subprocess.check_call(cmd, cwd=workspace_dir, env=env)
+    except subprocess.CalledProcessError as e:
+        print(f"Error running command: {e}")
+        sys.exit(1)
+
+
 def main():
-    parser = argparse.ArgumentParser(description="Generate serialization test data for Java and/or C++.")
+    parser = argparse.ArgumentParser(description="Generate serialization test data for Java, C++ and/or Rust.")
     parser.add_argument("--java", action="store_true", help="Generate Java test data")
     parser.add_argument("--cpp", action="store_true", help="Generate C++ test data")
-    parser.add_argument("--all", action="store_true", help="Generate both Java and C++ test data")
+    parser.add_argument("--rust", action="store_true", help="Generate Rust test data")
+    parser.add_argument("--all", action="store_true", help="Generate Java, C++ and Rust test data")
 
     args = parser.parse_args()
 
     # Default to all if no arguments provided
-    if not args.java and not args.cpp and not args.all:
+    if not args.java and not args.cpp and not args.rust and not args.all:
         args.all = True
 
     tools_dir = Path(__file__).resolve().parent
@@ -201,5 +228,8 @@ def main():
     if args.cpp or args.all:
         generate_cpp_files(workspace_dir, project_dir)
 
+    if args.rust or args.all:
+        generate_rust_files(workspace_dir)
+
 if __name__ == "__main__":
     main()
@@ -32,6 +32,7 @@ impl Command {
         match self.sub {
             SubCommand::Check(cmd) => cmd.run(),
             SubCommand::Docs(cmd) => cmd.run(),
+            SubCommand::GenSnapshots(cmd) => cmd.run(),
             SubCommand::Lint(cmd) => cmd.run(),
             SubCommand::Test(cmd) => cmd.run(),
         }
@@ -44,6 +45,8 @@ enum SubCommand {
     Check(CommandCheck),
     #[clap(about = "Generate documentation and open for preview")]
     Docs(CommandDocs),
+    #[clap(about = "Regenerate the serialization test data and run the conformance tests.")]
+    GenSnapshots(CommandGenSnapshots),
     #[clap(about = "Run linter checks.")]
     Lint(CommandLint),
     #[clap(about = "Run unit tests.")]
@@ -52,17 +55,24 @@ enum SubCommand {
 
 #[derive(Parser)]
 #[clap(name = "check")]
-struct CommandCheck {}
+struct CommandCheck {
+    #[arg(
+        long,
+        help = "Check for the given target triple, e.g. wasm32-unknown-unknown."
+    )]
+    target: Option<String>,
+}
 
 impl CommandCheck {
     fn run(self) {
         let features = datasketches_features();
+        let target = self.target.as_deref();
 
-        run_command(make_check_cmd(&[]));
+        run_command(make_check_cmd(&[], target));
         for feature in features.chunks(1) {
-            run_command(make_check_cmd(feature));
+            run_command(make_check_cmd(feature, target));
         }
-        run_command(make_check_cmd(&features));
+        run_command(make_check_cmd(&features, target));
     }
 }
 
@@ -76,6 +86,42 @@ impl CommandDocs {
     }
 }
 
+#[derive(Parser)]
+#[clap(name = "gen-snapshots")]
+struct CommandGenSnapshots {
+    #[arg(long, help = "Generate the Java files.")]
+    java: bool,
+    #[arg(long, help = "Generate the C++ files.")]
+    cpp: bool,
+    #[arg(long, help = "Generate the Rust files.")]
+    rust: bool,
+    #[arg(long, help = "Skip the conformance tests after generating.")]
+    no_verify: bool,
+}
+
+impl CommandGenSnapshots {
+    fn run(self) {
+        // like the script, generate every language unless some are selected
+        let all = !(self.java || self.cpp || self.rust);
+        let mut cmd = find_python();
+        cmd.arg("tools/generate_serialization_test_data.py");
+        for (selected, flag) in [
+            (self.java, "--java"),
+            (self.cpp, "--cpp"),
+            (self.rust, "--rust"),
+        ] {
+            if all || selected {
+                cmd.arg(flag);
+            }
+        }
+        run_command(cmd);
+
+        if !self.no_verify {
+            run_command(make_conformance_cmd());
+        }
+    }
+}
+
 #[derive(Parser)]
 struct CommandTest {
     #[arg(long, help = "Run tests serially and do not capture output.")]
@@ -145,6 +191,14 @@ fn find_command(cmd: &str) -> StdCommand {
     }
 }
 
+fn find_python() -> StdCommand {
+    // Windows installs name the interpreter `python` only
+    match which::which("python3") {
+        Ok(_) => find_command("python3"),
+        Err(_) => find_command("python"),
+    }
+}
+
 fn ensure_installed(bin: &str, crate_name: &str) {
     if which::which(bin).is_err() {
         let mut cmd = find_command("cargo");
@@ -171,7 +225,22 @@ fn make_test_cmd(no_capture: bool, features: &[String]) -> StdCommand {
     cmd
 }
 
-fn make_check_cmd(features: &[String]) -> StdCommand {
+fn make_conformance_cmd() -> StdCommand {
+    let mut cmd = find_command("cargo");
+    cmd.args([
+        "test",
+        "--package",
+        "datasketches",
+        "--all-features",
+        "--test",
+        "conformance_test",
+        "--test",
+        "rust_generated_files_test",
+    ]);
+    cmd
+}
+
+fn make_check_cmd(features: &[String], target: Option<&str>) -> StdCommand {
     let mut cmd = find_command("cargo");
     cmd.env("RUSTFLAGS", "-Dwarnings");
     cmd.args([
@@ -185,6 +254,9 @@ fn make_check_cmd(features: &[String]) -> StdCommand {
     for feature in features {
         cmd.args(["--features", feature]);
     }
+    if let Some(target) = target {
+        cmd.args(["--target", target]);
+    }
     cmd
 }
 